@@ -0,0 +1,10 @@
+// The messages of the narwhal.events.v1 package: the event envelope, the
+// payloads of the event catalog and the event management services.
+
+export * from "./gen/events/v1/dead_letter_pb.js";
+export * from "./gen/events/v1/diagnostics_pb.js";
+export * from "./gen/events/v1/envelope_pb.js";
+export * from "./gen/events/v1/library_events_pb.js";
+export * from "./gen/events/v1/status_events_pb.js";
+export * from "./gen/events/v1/tasks_pb.js";
+export * from "./gen/events/v1/user_events_pb.js";
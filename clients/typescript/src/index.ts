@@ -0,0 +1,72 @@
+// TypeScript client for the Narwhal APIs.
+//
+// The message types and service descriptors under ./gen are generated from
+// api/proto, so they change with the protos; the helpers here wire them up
+// for browsers.
+
+import { createClient, type Client, type Interceptor, type Transport } from "@connectrpc/connect";
+import { createGrpcWebTransport } from "@connectrpc/connect-web";
+
+import { AcquisitionService } from "./gen/acquisition/v1/acquisition_pb.js";
+import { AuthService } from "./gen/auth/v1/auth_pb.js";
+import { LibraryService } from "./gen/library/v1/library_pb.js";
+import { StreamingService } from "./gen/streaming/v1/streaming_pb.js";
+
+// Each proto package is exported as a namespace named like its Go package,
+// as packages share message names.
+export * as acquisitionpb from "./gen/acquisition/v1/acquisition_pb.js";
+export * as authpb from "./gen/auth/v1/auth_pb.js";
+export * as commonpb from "./gen/common/v1/common_pb.js";
+export * as librarypb from "./gen/library/v1/library_pb.js";
+export * as streamingpb from "./gen/streaming/v1/streaming_pb.js";
+export * as eventspb from "./events.js";
+
+export interface NarwhalClientOptions {
+  // URL of the gRPC-Web endpoint in front of the services, such as
+  // https://narwhal.example.com/api.
+  baseUrl: string;
+  // Returns the access token to send with calls, if any.
+  getAccessToken?: () => string | undefined | Promise<string | undefined>;
+  // Interceptors run after the one adding the access token.
+  interceptors?: Interceptor[];
+}
+
+export interface NarwhalClient {
+  auth: Client<typeof AuthService>;
+  library: Client<typeof LibraryService>;
+  streaming: Client<typeof StreamingService>;
+  acquisition: Client<typeof AcquisitionService>;
+}
+
+// bearerToken adds the access token to the authorization header of calls.
+export function bearerToken(
+  getAccessToken: NonNullable<NarwhalClientOptions["getAccessToken"]>,
+): Interceptor {
+  return (next) => async (req) => {
+    const token = await getAccessToken();
+    if (token) {
+      req.header.set("authorization", `Bearer ${token}`);
+    }
+    return next(req);
+  };
+}
+
+// createNarwhalTransport creates a gRPC-Web transport for the services.
+export function createNarwhalTransport(options: NarwhalClientOptions): Transport {
+  const interceptors = [...(options.interceptors ?? [])];
+  if (options.getAccessToken) {
+    interceptors.unshift(bearerToken(options.getAccessToken));
+  }
+  return createGrpcWebTransport({ baseUrl: options.baseUrl, interceptors });
+}
+
+// createNarwhalClient creates clients of the services sharing one transport.
+export function createNarwhalClient(options: NarwhalClientOptions): NarwhalClient {
+  const transport = createNarwhalTransport(options);
+  return {
+    auth: createClient(AuthService, transport),
+    library: createClient(LibraryService, transport),
+    streaming: createClient(StreamingService, transport),
+    acquisition: createClient(AcquisitionService, transport),
+  };
+}
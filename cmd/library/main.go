@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"expvar"
 	"fmt"
 	"net"
 	"net/http"
@@ -14,17 +16,33 @@ import (
 	"google.golang.org/grpc/reflection"
 
 	"github.com/narwhalmedia/narwhal/cmd/constants"
+	eventsHandler "github.com/narwhalmedia/narwhal/internal/events/handler"
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
 	"github.com/narwhalmedia/narwhal/internal/library/handler"
+	"github.com/narwhalmedia/narwhal/internal/library/plugins"
 	"github.com/narwhalmedia/narwhal/internal/library/repository"
 	"github.com/narwhalmedia/narwhal/internal/library/service"
+	"github.com/narwhalmedia/narwhal/pkg/apiversion"
+	"github.com/narwhalmedia/narwhal/pkg/assets"
 	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/clientip"
 	"github.com/narwhalmedia/narwhal/pkg/config"
 	"github.com/narwhalmedia/narwhal/pkg/database"
+	"github.com/narwhalmedia/narwhal/pkg/diagnostics"
+	"github.com/narwhalmedia/narwhal/pkg/downloadclient"
 	"github.com/narwhalmedia/narwhal/pkg/events"
+	eventspb "github.com/narwhalmedia/narwhal/pkg/events/v1"
+	"github.com/narwhalmedia/narwhal/pkg/i18n"
 	"github.com/narwhalmedia/narwhal/pkg/interfaces"
 	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
+	"github.com/narwhalmedia/narwhal/pkg/loadshed"
 	"github.com/narwhalmedia/narwhal/pkg/logger"
+	"github.com/narwhalmedia/narwhal/pkg/metrics"
+	"github.com/narwhalmedia/narwhal/pkg/middleware"
+	"github.com/narwhalmedia/narwhal/pkg/models"
 	"github.com/narwhalmedia/narwhal/pkg/pagination"
+	"github.com/narwhalmedia/narwhal/pkg/plugin"
+	"github.com/narwhalmedia/narwhal/pkg/storage"
 	"github.com/narwhalmedia/narwhal/pkg/utils"
 )
 
@@ -32,9 +50,10 @@ func main() {
 	// Load configuration
 	cfg := config.MustLoadServiceConfig("library", config.GetDefaultLibraryConfig())
 
-	// Initialize logger
+	// Initialize logger. Recent entries are kept for the log viewer.
 	// TODO: Update logger package to support configuration
-	logger := logger.New()
+	logs := logger.NewRingBuffer(logger.DefaultRingSize)
+	logger := logger.WithRing(logger.New(), logs, "library")
 
 	logger.Info("Library service starting",
 		interfaces.String("version", config.GetServiceVersion(&cfg.Service)),
@@ -58,10 +77,34 @@ func main() {
 	if err != nil {
 		logger.Fatal("Failed to create repository", interfaces.Error(err))
 	}
+	encryptor, err := cfg.Secrets.NewEncryptor()
+	switch {
+	case errors.Is(err, config.ErrNoEncryptionKey):
+		logger.Warn("No encryption key configured; secrets are encrypted with NARWHAL_ENCRYPTION_KEY or a development key")
+	case err != nil:
+		logger.Fatal("Failed to load encryption key", interfaces.Error(err))
+	default:
+		repo.WithEncryptor(encryptor)
+	}
+	// Secrets left under a previous key are re-encrypted with the current one
+	if rotated, err := repo.RotateSecrets(context.Background()); err != nil {
+		logger.Error("Failed to re-encrypt secrets", interfaces.Error(err))
+	} else if rotated > 0 {
+		logger.Info("Re-encrypted secrets", interfaces.Int("count", rotated))
+	}
 
 	// Initialize components
 	cache := utils.NewInMemoryCache()
-	eventBus := events.NewInMemoryEventBus(logger)
+	// Handlers that keep failing dead-letter their events for inspection
+	deadLetters := events.NewDeadLetterQueue(cfg.Events.DeadLetterAlertThreshold, logger)
+	bus := events.NewInMemoryEventBus(logger).WithDeadLetterQueue(deadLetters, cfg.Events.MaxDeliveryAttempts)
+	eventBus := events.NewPublisher(bus, logger)
+
+	// Notable events are kept for the admin activity feed
+	activity := events.NewActivityFeed(events.DefaultActivityFeedSize)
+	if err := activity.Subscribe(eventBus); err != nil {
+		logger.Fatal("Failed to subscribe activity feed", interfaces.Error(err))
+	}
 
 	// Start event bus
 	ctx, cancel := context.WithCancel(context.Background())
@@ -77,7 +120,209 @@ func main() {
 		eventBus,
 		cache,
 		logger,
+	).WithScanLimits(service.ScanLimits{
+		MaxConcurrentScans: cfg.Library.MaxConcurrentScan,
+		Workers:            cfg.Library.ScanWorkers,
+		BatchSize:          cfg.Library.ScanBatchSize,
+	}).WithImportModes(importModes(cfg.Library)).WithReplaceRules(domain.ReplaceRules{
+		Auto:            cfg.Library.AutoReplace,
+		PreferredCodecs: cfg.Library.ReplacePreferredCodecs,
+		MaxSizeRatio:    cfg.Library.ReplaceMaxSizeRatio,
+	}, cfg.Library.RecycleBinPath).WithMalwareScanner(malwareScanner(cfg.Library), cfg.Library.QuarantinePath).
+		WithPrunePolicy(domain.PrunePolicy{
+			UnwatchedFor: cfg.Library.PruneUnwatchedAfter,
+			MinFreeShare: cfg.Library.PruneMinFreeSpace,
+		})
+
+	// Pool sizes set through the API outlive restarts
+	if err := libraryService.LoadWorkerPoolSizes(ctx); err != nil {
+		logger.Error("Failed to load worker pool sizes", interfaces.Error(err))
+	}
+
+	// Work left in progress by a previous process can never finish
+	libraryService.Reconcile(ctx)
+
+	// Finished workflows are moved to the workflow history once retention
+	// no longer keeps them
+	if cfg.Library.WorkflowArchiveInterval > 0 {
+		go libraryService.RunWorkflowArchiver(ctx, cfg.Library.WorkflowArchiveInterval, domain.RetentionPolicy{
+			MaxAge:       cfg.Library.WorkflowRetention,
+			KeepPerMedia: cfg.Library.WorkflowKeepPerMedia,
+		})
+	}
+
+	// Libraries running out of disk space are reported with the titles
+	// worth deleting
+	if cfg.Library.PruneAdviceInterval > 0 {
+		go libraryService.RunPruneAdvisor(ctx, cfg.Library.PruneAdviceInterval)
+	}
+
+	// Artwork and theme music live in the shared asset store
+	objectStore, err := cfg.Storage.NewObjectStore()
+	if err != nil {
+		logger.Fatal("Failed to initialize asset storage", interfaces.Error(err))
+	}
+	assetStore := assets.NewStore(assets.NewGormRepository(db), objectStore, logger)
+	if cfg.Storage.GCInterval > 0 {
+		go assetStore.RunGarbageCollector(ctx, cfg.Storage.GCInterval, cfg.Storage.GCGracePeriod)
+	}
+
+	// Theme music is picked up from sidecars of added series and, when a
+	// provider is configured, downloaded on request
+	themeService := service.NewThemeService(
+		repo,
+		assetStore,
+		cache,
+		eventBus,
+		logger,
+		cfg.Assets.MaxThemeBytes,
 	)
+	if cfg.Assets.ThemeProviderURL != "" {
+		themeService.WithProviders(
+			domain.NewURLThemeProvider(cfg.Assets.ThemeProviderURL, &http.Client{Timeout: 30 * time.Second}),
+		)
+	}
+	if err := themeService.Start(); err != nil {
+		logger.Fatal("Failed to start theme service", interfaces.Error(err))
+	}
+
+	// Transcode policies request transcodes of media as it becomes available,
+	// ahead of others if the media is likely to be watched soon
+	policyService := service.NewTranscodePolicyService(repo, eventBus, logger)
+	if cfg.Library.TranscodePriorityInterval > 0 {
+		policyService.WithPriorities(domain.TranscodePriorityPolicy{
+			Window:         cfg.Library.TranscodePriorityWindow,
+			BackCatalogAge: cfg.Library.TranscodeBackCatalogAge,
+			PopularGenres:  cfg.Library.TranscodePopularGenres,
+		})
+		go policyService.Run(ctx, cfg.Library.TranscodePriorityInterval)
+	}
+	if err := policyService.Start(); err != nil {
+		logger.Fatal("Failed to start transcode policy service", interfaces.Error(err))
+	}
+
+	// The search index follows media events and is rebuilt on request
+	searchIndex := service.NewSearchIndexService(repo, libraryService.Tasks(), eventBus, logger)
+	if err := searchIndex.Start(); err != nil {
+		logger.Fatal("Failed to start search index updater", interfaces.Error(err))
+	}
+
+	userData := service.NewUserDataService(repo, eventBus, logger)
+	if err := userData.Start(); err != nil {
+		logger.Fatal("Failed to start user data service", interfaces.Error(err))
+	}
+	// Composes the library part of the email digests the user service sends
+	if err := service.NewDigestService(repo, eventBus, logger).Start(); err != nil {
+		logger.Fatal("Failed to start digest service", interfaces.Error(err))
+	}
+
+	storage := service.NewStorageService(repo, eventBus, logger)
+	if err := storage.Start(); err != nil {
+		logger.Fatal("Failed to start storage accounting", interfaces.Error(err))
+	}
+	go func() {
+		if err := storage.RefreshAll(ctx); err != nil {
+			logger.Error("Failed to refresh storage usage", interfaces.Error(err))
+		}
+	}()
+	expvar.Publish("storage_usage", expvar.Func(storage.Snapshot))
+
+	// Stream segments of deleted media are invalidated on the CDN
+	if cfg.CDN.Enabled {
+		invalidator, err := cfg.CDN.NewInvalidator()
+		if err != nil {
+			logger.Fatal("Failed to configure CDN invalidation", interfaces.Error(err))
+		}
+		if invalidator != nil {
+			if err := service.NewCDNService(invalidator, eventBus, logger).Start(); err != nil {
+				logger.Fatal("Failed to start CDN invalidation", interfaces.Error(err))
+			}
+		}
+	}
+
+	// Hooks run user scripts on imports, completed transcodes and deletes
+	hookService := service.NewHookService(repo, eventBus, logger, hooks(cfg.Library)).
+		WithRunRetention(cfg.Library.HookRunRetention)
+	if err := hookService.Start(ctx); err != nil {
+		logger.Fatal("Failed to start hook service", interfaces.Error(err))
+	}
+
+	// Indexers and download clients failing in a row are disabled and re-tested
+	healthService := service.NewHealthService(domain.HealthPolicy{
+		FailureThreshold:  cfg.Library.HealthFailureThreshold,
+		RetestInterval:    cfg.Library.HealthRetestInterval,
+		MaxRetestInterval: cfg.Library.HealthMaxRetestInterval,
+	}, cfg.Library.CriticalComponents, eventBus, logger)
+
+	// RSS feeds grab matching releases into download clients
+	clients, err := downloadClients(cfg.Library, healthService)
+	if err != nil {
+		logger.Fatal("Failed to configure download clients", interfaces.Error(err))
+	}
+	feedService := service.NewFeedService(repo, clients, &http.Client{Timeout: 30 * time.Second}, eventBus, logger)
+	if cfg.Library.FeedPollInterval > 0 {
+		go feedService.Run(ctx, cfg.Library.FeedPollInterval)
+	}
+	go healthService.Run(ctx, cfg.Library.HealthRetestInterval)
+
+	// Media failing playback for too many sessions is flagged
+	playbackService := service.NewPlaybackIssueService(repo, domain.PlaybackFlagPolicy{
+		ErrorRate:   cfg.Library.PlaybackErrorRate,
+		MinSessions: int64(cfg.Library.PlaybackMinSessions),
+	}, cfg.Library.PlaybackIssueWindow, eventBus, logger)
+
+	// Sidecar plugins add metadata providers and indexers
+	pluginManager := plugin.NewManager(plugins.Handshake, logger, plugin.KindMetadataProvider, plugin.KindIndexer).
+		WithStartTimeout(cfg.Plugins.StartTimeout)
+	for _, sidecar := range cfg.Plugins.Sidecars {
+		if !sidecar.Enabled {
+			continue
+		}
+		// Failed plugins are logged and listed with their error
+		_, _ = pluginManager.Load(ctx, plugin.Config{
+			Name:    sidecar.Name,
+			Command: sidecar.Command,
+			Args:    sidecar.Args,
+			Env:     sidecar.Env,
+		})
+	}
+	metadataFetcher := domain.NewMetadataFetcher(logger)
+	for _, provider := range plugins.MetadataProviders(pluginManager) {
+		metadataFetcher.RegisterProvider(provider)
+	}
+	// Anime libraries look titles up on AniList first
+	if cfg.Library.AniListURL != "" {
+		metadataFetcher.RegisterProvider(
+			domain.NewAniListProvider(cfg.Library.AniListURL, &http.Client{Timeout: 30 * time.Second}),
+		)
+	}
+	// Music video libraries look videos up on IMVDb, then TheAudioDB
+	if cfg.Library.IMVDbAPIKey != "" {
+		metadataFetcher.RegisterProvider(domain.NewIMVDbProvider(
+			cfg.Library.IMVDbURL, cfg.Library.IMVDbAPIKey, &http.Client{Timeout: 30 * time.Second},
+		))
+	}
+	if cfg.Library.AudioDBAPIKey != "" {
+		metadataFetcher.RegisterProvider(domain.NewTheAudioDBProvider(
+			cfg.Library.AudioDBURL, cfg.Library.AudioDBAPIKey, &http.Client{Timeout: 30 * time.Second},
+		))
+	}
+	// Interactive searches look up the indexers of the plugins running at the
+	// time, leaving out those disabled for failing
+	wantedService := service.NewWantedService(repo, func() []domain.Indexer {
+		return healthService.Indexers(plugins.Indexers(pluginManager))
+	}, clients, eventBus, logger)
+
+	// Approved content requests become wanted media, looked up with the
+	// same metadata providers
+	contentRequests := service.NewContentRequestService(repo, metadataFetcher, requestPolicy(cfg.Library), eventBus, logger)
+	if err := contentRequests.Start(); err != nil {
+		logger.Fatal("Failed to start content request tracking", interfaces.Error(err))
+	}
+
+	// Admins resolve media issues by downloading, transcoding or looking up
+	// the media again
+	mediaIssues := service.NewMediaIssueService(repo, policyService, metadataFetcher, eventBus, logger)
 
 	logger.Info("Media Library Service starting...")
 
@@ -103,13 +348,57 @@ func main() {
 		logger.Fatal("Failed to initialize RBAC", interfaces.Error(err))
 	}
 
-	// Create auth interceptor
-	authInterceptor := auth.NewAuthInterceptor(jwtManager, rbac)
+	// Create auth interceptor. Library grants back the library-membership
+	// conditions of method policies. API keys are looked up in the user
+	// tables, which share the library's database.
+	accounts := auth.NewGormAccountStore(db)
+	authInterceptor := auth.NewAuthInterceptor(jwtManager, rbac).
+		WithAttributeResolver(repository.NewAccessResolver(db)).
+		WithAPIKeyValidator(auth.NewAPIKeys(accounts, logger)).
+		WithPublicMethods(config.GetPublicMethods(&cfg.Service)).
+		WithImpersonationAudit(logger)
+
+	// Flags calls to deprecated API versions and counts calls per version
+	apiVersions := apiversion.DefaultPolicy(logger).EnforceSunset(cfg.Service.EnforceAPISunset)
+
+	// Client IPs that share link play limits and audits see are only taken
+	// from trusted proxies' headers
+	clientIPs, err := clientip.NewResolver(cfg.Service.TrustedProxies)
+	if err != nil {
+		logger.Fatal("Invalid trusted proxies", interfaces.Error(err))
+	}
+
+	// Sheds scans, exports and reports while the database or disk is
+	// saturated, keeping playback progress and browsing responsive
+	shedder, err := cfg.LoadShedding.NewShedder(logger)
+	if err != nil {
+		logger.Fatal("Failed to create load shedder", interfaces.Error(err))
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		shedder.WithDB(sqlDB)
+	}
+	if cfg.LoadShedding.Enabled {
+		go shedder.Run(ctx, cfg.LoadShedding.Interval)
+	}
 
 	// Create gRPC server with auth interceptor
 	grpcServer := grpc.NewServer(
-		grpc.UnaryInterceptor(authInterceptor.UnaryServerInterceptor()),
-		grpc.StreamInterceptor(authInterceptor.StreamServerInterceptor()),
+		grpc.ChainUnaryInterceptor(
+			clientIPs.UnaryServerInterceptor(),
+			middleware.LocalizationInterceptor(i18n.Default()),
+			shedder.UnaryServerInterceptor(),
+			middleware.TimeoutInterceptor(middleware.NewTimeouts(cfg.Service.RequestTimeout, cfg.Service.MethodTimeouts)),
+			apiVersions.UnaryServerInterceptor(),
+			authInterceptor.UnaryServerInterceptor(),
+		),
+		grpc.ChainStreamInterceptor(
+			clientIPs.StreamServerInterceptor(),
+			middleware.StreamLocalizationInterceptor(i18n.Default()),
+			shedder.StreamServerInterceptor(),
+			middleware.StreamTimeoutInterceptor(),
+			apiVersions.StreamServerInterceptor(),
+			authInterceptor.StreamServerInterceptor(),
+		),
 	)
 
 	// Initialize pagination encoder
@@ -137,8 +426,49 @@ func main() {
 	}
 
 	// Create and register gRPC handler
-	grpcHandler := handler.NewGRPCHandler(libraryService, logger, paginationEncoder)
+	// iCalendar export of the calendar, for calendar apps to subscribe to.
+	// Feed tokens act as their user, who is looked up in the user tables.
+	calendarFeed := handler.NewCalendarFeed(libraryService, accounts, []byte(cfg.Auth.JWTSecret), logger)
+
+	// Kiosks read what is playing and what was added with kiosk tokens,
+	// over a slim RPC surface and a server-sent event stream
+	kiosks := service.NewKioskService(repo, jwtManager,
+		cfg.Library.KioskTokenTTL, cfg.Library.KioskRefreshInterval, eventBus, logger)
+	kioskEvents := handler.NewKioskEvents(kiosks, jwtManager, logger)
+
+	grpcHandler := handler.NewGRPCHandler(libraryService, logger, paginationEncoder).
+		WithThemeService(themeService).
+		WithTranscodePolicyService(policyService).
+		WithSearchIndexService(searchIndex).
+		WithStorageService(storage).
+		WithHookService(hookService).
+		WithPluginManager(pluginManager).
+		WithFeedService(feedService).
+		WithCalendarFeed(calendarFeed).
+		WithWantedService(wantedService).
+		WithBlocklistService(service.NewBlocklistService(repo, logger)).
+		WithHealthService(healthService).
+		WithPlaybackIssueService(playbackService).
+		WithWatchlistService(service.NewWatchlistService(repo, logger)).
+		WithShareLinkService(service.NewShareLinkService(repo, jwtManager, domain.ShareLinkPolicy{
+			MaxTTL:     cfg.Library.ShareLinkMaxTTL,
+			MaxBitrate: cfg.Library.ShareMaxBitrate,
+			StreamTTL:  cfg.Library.ShareStreamTTL,
+		}, eventBus, logger)).
+		WithContentRequestService(contentRequests).
+		WithMediaIssueService(mediaIssues).
+		WithKioskService(kiosks).
+		WithAnalyticsService(service.NewAnalyticsService(repo, logger))
 	librarypb.RegisterLibraryServiceServer(grpcServer, grpcHandler)
+	librarypb.RegisterKioskServiceServer(grpcServer, handler.NewKioskHandler(kiosks, logger))
+	eventspb.RegisterDeadLetterServiceServer(grpcServer, eventsHandler.NewGRPCHandler(deadLetters, logger))
+	redactedConfig, err := config.Redacted(cfg)
+	if err != nil {
+		logger.Warn("Failed to redact config for diagnostics", interfaces.Error(err))
+	}
+	eventspb.RegisterDiagnosticsServiceServer(grpcServer,
+		eventsHandler.NewDiagnosticsHandler(logs, activity, logger).WithConfig("library", redactedConfig))
+	eventspb.RegisterTaskServiceServer(grpcServer, eventsHandler.NewTaskHandler(libraryService.Tasks(), logger))
 
 	// Register reflection service for grpcurl
 	reflection.Register(grpcServer)
@@ -159,11 +489,17 @@ func main() {
 
 	// Start metrics server if enabled
 	if cfg.Metrics.Enabled {
-		go startMetricsServer(cfg.Metrics, logger)
+		go startMetricsServer(cfg.Metrics, libraryService, bus, deadLetters, apiVersions, shedder, logger)
+	}
+
+	// Runtime diagnostics on the HTTP port, for loopback clients or admins
+	var debugHandler http.Handler
+	if cfg.Diagnostics.Enabled {
+		debugHandler = diagnostics.NewHandler(diagnostics.Guard(cfg.Diagnostics.LocalhostOnly, clientIPs, jwtManager, rbac))
 	}
 
 	// Start health check server
-	go startHealthServer(cfg.Service.Port, logger)
+	go startHealthServer(cfg.Service.Port, localAssetRoot(objectStore), calendarFeed, kioskEvents, debugHandler, logger)
 
 	// Wait for interrupt signal
 	sigChan := make(chan os.Signal, 1)
@@ -179,6 +515,12 @@ func main() {
 	// Stop gRPC server
 	grpcServer.GracefulStop()
 
+	// Cancel running scans
+	libraryService.Stop()
+
+	// Stop plugins
+	_ = pluginManager.Close()
+
 	// Stop event bus
 	if err := eventBus.Stop(); err != nil {
 		logger.Error("Failed to stop event bus", interfaces.Error(err))
@@ -193,13 +535,40 @@ func main() {
 	logger.Info("Library service stopped")
 }
 
-func startMetricsServer(cfg config.MetricsConfig, log interfaces.Logger) {
+func startMetricsServer(
+	cfg config.MetricsConfig,
+	libraryService *service.LibraryService,
+	bus *events.InMemoryEventBus,
+	deadLetters *events.DeadLetterQueue,
+	apiVersions *apiversion.Policy,
+	shedder *loadshed.Shedder,
+	log interfaces.Logger,
+) {
 	mux := http.NewServeMux()
-	mux.HandleFunc(cfg.Path, func(w http.ResponseWriter, r *http.Request) {
-		// TODO: Implement Prometheus metrics
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("# Metrics endpoint\n"))
-	})
+	mux.Handle(cfg.Path, metrics.Handler(func(w *metrics.Writer) {
+		// Metrics of the latest scan of each library
+		for _, m := range libraryService.ScanMetrics() {
+			id := m.LibraryID.String()
+			w.Gauge("narwhal_library_scan_files_total", "Files seen by the latest scan.",
+				float64(m.FilesScanned), "library_id", id)
+			w.Gauge("narwhal_library_scan_errors_total", "Errors of the latest scan.",
+				float64(m.Errors), "library_id", id)
+			w.Gauge(metrics.LibraryScanDurationSeconds, "Duration of the latest scan.",
+				m.Duration.Seconds(), "library_id", id)
+			w.Gauge("narwhal_library_scan_files_per_second", "Throughput of the latest scan.",
+				m.FilesPerSecond, "library_id", id)
+			w.Gauge("narwhal_library_scan_rows_per_second", "Media rows written per second by the latest scan.",
+				m.RowsPerSecond, "library_id", id)
+		}
+		w.Counter(metrics.LibraryImportFailuresTotal, "Media that failed to import.",
+			float64(libraryService.ImportFailures()))
+		w.Counter(metrics.LibraryImportSpaceSavedBytesTotal, "Bytes imports did not duplicate by hardlinking downloads.",
+			float64(libraryService.ImportSpaceSaved()))
+
+		writeEventMetrics(w, bus, deadLetters)
+		apiVersions.WriteMetrics(w)
+		shedder.WriteMetrics(w)
+	}))
 
 	addr := fmt.Sprintf(":%d", cfg.Port)
 	log.Info("Metrics server starting", interfaces.String("address", addr))
@@ -209,7 +578,107 @@ func startMetricsServer(cfg config.MetricsConfig, log interfaces.Logger) {
 	}
 }
 
-func startHealthServer(port int, log interfaces.Logger) {
+// importModes returns the configured import modes. The configuration has
+// been validated, so every mode parses.
+func importModes(settings config.LibrarySettings) domain.ImportModes {
+	modes := domain.ImportModes{ByClient: make(map[string]domain.ImportMode, len(settings.ImportModes))}
+	modes.Default, _ = domain.ParseImportMode(settings.ImportMode)
+	for client, mode := range settings.ImportModes {
+		modes.ByClient[client], _ = domain.ParseImportMode(mode)
+	}
+	return modes
+}
+
+// malwareScanner returns the configured malware scanner, or nil if
+// downloads are not scanned.
+func malwareScanner(settings config.LibrarySettings) domain.MalwareScanner {
+	switch settings.MalwareScanner {
+	case "clamd":
+		return domain.NewClamdScanner(settings.ClamdAddress, settings.MalwareScanTimeout)
+	case "command":
+		return domain.NewCommandScanner(settings.MalwareScanCommand, settings.MalwareScanArgs, settings.MalwareScanTimeout)
+	default:
+		return nil
+	}
+}
+
+// hooks returns the configured hooks. The configuration has been
+// validated, so every hook point parses.
+func hooks(settings config.LibrarySettings) []*domain.Hook {
+	hooks := make([]*domain.Hook, len(settings.Hooks))
+	for i, hook := range settings.Hooks {
+		point, _ := domain.ParseHookPoint(hook.Point)
+		hooks[i] = &domain.Hook{
+			Name:      hook.Name,
+			Point:     point,
+			Command:   hook.Command,
+			Args:      hook.Args,
+			Timeout:   hook.Timeout,
+			MaxMemory: hook.MaxMemory,
+			MaxCPU:    hook.MaxCPU,
+			Enabled:   hook.Enabled,
+		}
+	}
+	return hooks
+}
+
+// requestPolicy returns the configured content request quotas and
+// auto-approval rules.
+func requestPolicy(settings config.LibrarySettings) domain.RequestPolicy {
+	policy := domain.RequestPolicy{
+		Period:      settings.RequestQuotaPeriod,
+		Quotas:      make(map[string]domain.RequestQuota, len(settings.RequestQuotas)),
+		AutoApprove: make([]domain.AutoApproveRule, len(settings.RequestAutoApprove)),
+	}
+	for role, quota := range settings.RequestQuotas {
+		policy.Quotas[role] = domain.RequestQuota{Movies: quota.Movies, Seasons: quota.Seasons}
+	}
+	for i, rule := range settings.RequestAutoApprove {
+		policy.AutoApprove[i] = domain.AutoApproveRule{
+			Role:       rule.Role,
+			MediaType:  models.MediaType(rule.MediaType),
+			MaxQuality: rule.MaxQuality,
+		}
+	}
+	return policy
+}
+
+// downloadClients returns the enabled download clients, tracked by health.
+func downloadClients(settings config.LibrarySettings, health *service.HealthService) (*downloadclient.Clients, error) {
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	var clients []downloadclient.Client
+	for _, c := range settings.DownloadClients {
+		if !c.Enabled {
+			continue
+		}
+		client, err := downloadclient.New(downloadclient.Config{
+			Name:     c.Name,
+			Type:     c.Type,
+			URL:      c.URL,
+			Username: c.Username,
+			Password: c.Password,
+			Category: c.Category,
+		}, httpClient)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	return downloadclient.NewClients(settings.DefaultDownloadClient, health.Clients(clients)...)
+}
+
+// writeEventMetrics writes the delivery state of the event bus.
+func writeEventMetrics(w *metrics.Writer, bus *events.InMemoryEventBus, deadLetters *events.DeadLetterQueue) {
+	stats := bus.Stats()
+	w.Gauge(metrics.EventsPending, "Published events not yet delivered to every handler.", float64(stats.Pending))
+	for handler, lag := range stats.Lag {
+		w.Gauge(metrics.EventsConsumerLagSeconds, "Delay between an event and its delivery to the handler.",
+			lag.Seconds(), "handler", handler)
+	}
+	w.Gauge(metrics.EventsDeadLetters, "Events in the dead-letter queue.", float64(deadLetters.Depth()))
+}
+
+func startHealthServer(port int, assetRoot string, calendar, kiosk, debug http.Handler, log interfaces.Logger) {
 	mux := http.NewServeMux()
 
 	// Health check endpoint
@@ -227,6 +696,22 @@ func startHealthServer(port int, log interfaces.Logger) {
 		_, _ = w.Write([]byte(`{"status":"ready"}`))
 	})
 
+	// Assets of the local asset store
+	if assetRoot != "" {
+		mux.Handle("/assets/", http.StripPrefix("/assets/", http.FileServer(http.Dir(assetRoot))))
+	}
+
+	// iCalendar export, authenticated by feed tokens
+	mux.Handle(handler.CalendarFeedPath, calendar)
+
+	// Display event stream, authenticated by kiosk tokens
+	mux.Handle(handler.KioskEventsPath, kiosk)
+
+	// Runtime diagnostics, if enabled
+	if debug != nil {
+		mux.Handle(diagnostics.Prefix, debug)
+	}
+
 	addr := fmt.Sprintf(":%d", port)
 	log.Info("Health server starting", interfaces.String("address", addr))
 
@@ -234,3 +719,12 @@ func startHealthServer(port int, log interfaces.Logger) {
 		log.Error("Health server failed", interfaces.Error(err))
 	}
 }
+
+// localAssetRoot returns the directory of a local object store, which is
+// served over HTTP; objects of other stores are served by the store itself.
+func localAssetRoot(store interfaces.ObjectStore) string {
+	if local, ok := store.(*storage.LocalStore); ok {
+		return local.Root()
+	}
+	return ""
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+
+	streamingpb "github.com/narwhalmedia/narwhal/api/proto/streaming/v1"
+	"github.com/narwhalmedia/narwhal/cmd/constants"
+	eventsHandler "github.com/narwhalmedia/narwhal/internal/events/handler"
+	streamingHandler "github.com/narwhalmedia/narwhal/internal/streaming/handler"
+	"github.com/narwhalmedia/narwhal/internal/streaming/hls"
+	"github.com/narwhalmedia/narwhal/pkg/apiversion"
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/cdn"
+	"github.com/narwhalmedia/narwhal/pkg/clientip"
+	"github.com/narwhalmedia/narwhal/pkg/config"
+	"github.com/narwhalmedia/narwhal/pkg/database"
+	"github.com/narwhalmedia/narwhal/pkg/diagnostics"
+	eventspb "github.com/narwhalmedia/narwhal/pkg/events/v1"
+	"github.com/narwhalmedia/narwhal/pkg/i18n"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/loadshed"
+	"github.com/narwhalmedia/narwhal/pkg/logger"
+	"github.com/narwhalmedia/narwhal/pkg/metrics"
+	"github.com/narwhalmedia/narwhal/pkg/middleware"
+)
+
+// streamingServiceName is the name the streaming service reports health under.
+const streamingServiceName = "narwhal.streaming.v1.StreamingService"
+
+func main() {
+	// Load configuration
+	cfg := config.MustLoadServiceConfig("streaming", config.GetDefaultStreamingConfig())
+
+	// Initialize logger. Recent entries are kept for the log viewer.
+	logs := logger.NewRingBuffer(logger.DefaultRingSize)
+	log := logger.WithRing(logger.New(), logs, "streaming")
+
+	log.Info("Streaming service starting",
+		interfaces.String("version", config.GetServiceVersion(&cfg.Service)),
+		interfaces.String("environment", cfg.Service.Environment))
+
+	// Segments are cached below the cache path
+	if err := os.MkdirAll(cfg.Streaming.CachePath, 0o755); err != nil {
+		log.Fatal("Failed to create segment cache directory", interfaces.Error(err))
+	}
+
+	// JIT and live sessions write their segments below the cache path; the
+	// directories of sessions of a previous run are deleted
+	sessions, err := hls.NewSessionManager(filepath.Join(cfg.Streaming.CachePath, "sessions"), hls.RetentionPolicy{
+		Window:       cfg.Streaming.SessionWindow,
+		MaxDiskBytes: cfg.Streaming.SessionMaxDisk,
+	})
+	if err != nil {
+		log.Fatal("Failed to initialize transcode sessions", interfaces.Error(err))
+	}
+
+	// Through a CDN, playlists list signed CDN URLs of segments, which edges
+	// pull from the origin endpoint or which are pushed to the asset store
+	var origin http.Handler
+	if cfg.CDN.Enabled {
+		signer, err := cfg.CDN.NewSigner()
+		if err != nil {
+			log.Fatal("Failed to configure CDN URL signing", interfaces.Error(err))
+		}
+		urls, err := cdn.NewURLBuilder(cfg.CDN.BaseURL, signer, cfg.CDN.TokenTTL)
+		if err != nil {
+			log.Fatal("Failed to configure CDN URL signing", interfaces.Error(err))
+		}
+		sessions.WithURLs(urls.Stream)
+
+		if cfg.CDN.Mode == "push" {
+			store, err := cfg.Storage.NewObjectStore()
+			if err != nil {
+				log.Fatal("Failed to initialize CDN origin storage", interfaces.Error(err))
+			}
+			sessions.WithPublisher(hls.NewStorePublisher(store, func(session *hls.Session, name string) string {
+				return cdn.Key(session.MediaID(), session.ID(), name)
+			}))
+		} else {
+			origin = cdn.Origin(cfg.CDN.OriginSecret, sessions.FileHandler())
+		}
+	}
+
+	// Keys of encrypted HLS streams are derived from the key secret
+	var keyManager *hls.KeyManager
+	if method := cfg.Streaming.EncryptionMethod; method != "" && method != "none" {
+		keyManager, err = hls.NewKeyManager(
+			[]byte(cfg.Streaming.KeySecret),
+			strings.ToUpper(method),
+			cfg.Streaming.KeyRotationSegments,
+			cfg.Streaming.KeyBaseURL,
+		)
+		if err != nil {
+			log.Fatal("Failed to initialize HLS encryption", interfaces.Error(err))
+		}
+	}
+
+	// API keys are looked up in the user tables. The streaming service only
+	// reads them; the services owning the tables run the migrations.
+	db, err := database.NewGormDB(cfg.Database.ToDatabaseConfig())
+	if err != nil {
+		log.Fatal("Failed to connect to database", interfaces.Error(err))
+	}
+
+	// Initialize JWT manager for auth middleware
+	jwtManager := auth.NewJWTManager(
+		cfg.Auth.JWTSecret,
+		cfg.Auth.JWTSecret, // Use same secret for refresh tokens
+		"narwhal-streaming-service",
+		cfg.Auth.AccessTokenDuration,
+		cfg.Auth.RefreshTokenDuration,
+	)
+
+	// Initialize RBAC
+	rbac, err := auth.NewRBACFromConfig(auth.RBACConfig{
+		Type:             auth.RBACType(cfg.Auth.RBACType),
+		CasbinModelPath:  cfg.Auth.RBACModelPath,
+		CasbinPolicyPath: cfg.Auth.RBACPolicyPath,
+		Logger:           log,
+	})
+	if err != nil {
+		log.Fatal("Failed to initialize RBAC", interfaces.Error(err))
+	}
+
+	authInterceptor := auth.NewAuthInterceptor(jwtManager, rbac).
+		WithAPIKeyValidator(auth.NewAPIKeys(auth.NewGormAccountStore(db), log)).
+		WithPublicMethods(config.GetPublicMethods(&cfg.Service)).
+		WithImpersonationAudit(log)
+
+	// Flags calls to deprecated API versions and counts calls per version
+	apiVersions := apiversion.DefaultPolicy(log).EnforceSunset(cfg.Service.EnforceAPISunset)
+
+	// Sheds everything but playback while transcodes saturate the disk
+	shedder, err := cfg.LoadShedding.NewShedder(log)
+	if err != nil {
+		log.Fatal("Failed to create load shedder", interfaces.Error(err))
+	}
+	if cfg.LoadShedding.Enabled {
+		go shedder.Run(context.Background(), cfg.LoadShedding.Interval)
+	}
+
+	// Create gRPC server with auth interceptor
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			middleware.LocalizationInterceptor(i18n.Default()),
+			shedder.UnaryServerInterceptor(),
+			middleware.TimeoutInterceptor(middleware.NewTimeouts(cfg.Service.RequestTimeout, cfg.Service.MethodTimeouts)),
+			apiVersions.UnaryServerInterceptor(),
+			authInterceptor.UnaryServerInterceptor(),
+		),
+		grpc.ChainStreamInterceptor(
+			middleware.StreamLocalizationInterceptor(i18n.Default()),
+			shedder.StreamServerInterceptor(),
+			middleware.StreamTimeoutInterceptor(),
+			apiVersions.StreamServerInterceptor(),
+			authInterceptor.StreamServerInterceptor(),
+		),
+	)
+
+	// Register services. Stream and session methods answer Unimplemented
+	// until the stream service is implemented.
+	streamingpb.RegisterStreamingServiceServer(grpcServer, streamingHandler.NewGRPCHandler())
+	// The stream service has no event bus, so it has no activity feed
+	redactedConfig, err := config.Redacted(cfg)
+	if err != nil {
+		log.Warn("Failed to redact config for diagnostics", interfaces.Error(err))
+	}
+	eventspb.RegisterDiagnosticsServiceServer(grpcServer,
+		eventsHandler.NewDiagnosticsHandler(logs, nil, log).WithConfig("streaming", redactedConfig))
+
+	// Register health service
+	healthServer := health.NewServer()
+	grpc_health_v1.RegisterHealthServer(grpcServer, healthServer)
+	healthServer.SetServingStatus(streamingServiceName, grpc_health_v1.HealthCheckResponse_SERVING)
+
+	// Enable reflection
+	reflection.Register(grpcServer)
+
+	// Start gRPC server
+	grpcAddr := config.GetGRPCListenAddress(&cfg.Service)
+	listener, err := net.Listen("tcp", grpcAddr)
+	if err != nil {
+		log.Fatal("Failed to listen", interfaces.Error(err))
+	}
+
+	go func() {
+		log.Info("gRPC server starting", interfaces.String("address", grpcAddr))
+		if err := grpcServer.Serve(listener); err != nil {
+			log.Fatal("Failed to serve gRPC", interfaces.Error(err))
+		}
+	}()
+
+	counters := &streamMetrics{}
+
+	// Start metrics server if enabled
+	var metricsServer *http.Server
+	if cfg.Metrics.Enabled {
+		metricsServer = newMetricsServer(cfg.Metrics, counters, sessions, apiVersions, shedder)
+		go serveHTTP(metricsServer, "Metrics", log)
+	}
+
+	// Runtime diagnostics on the HTTP port, for loopback clients or admins
+	var debugHandler http.Handler
+	if cfg.Diagnostics.Enabled {
+		clientIPs, err := clientip.NewResolver(cfg.Service.TrustedProxies)
+		if err != nil {
+			log.Fatal("Invalid trusted proxies", interfaces.Error(err))
+		}
+		debugHandler = diagnostics.NewHandler(diagnostics.Guard(cfg.Diagnostics.LocalhostOnly, clientIPs, jwtManager, rbac))
+	}
+
+	// Start health check server, which also serves HLS keys and the CDN origin
+	httpServer := newHTTPServer(cfg.Service.Port, cfg.Streaming.CachePath, keyManager, origin, debugHandler, counters)
+	go serveHTTP(httpServer, "Health", log)
+
+	// Wait for interrupt signal
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	<-sigChan
+
+	log.Info("Shutting down streaming service...")
+
+	// Report not serving so load balancers drain the instance
+	healthServer.Shutdown()
+
+	// Graceful shutdown with timeout
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), constants.ShutdownTimeout)
+	defer shutdownCancel()
+
+	// Stop gRPC server
+	grpcServer.GracefulStop()
+
+	// Delete the segments of sessions still running
+	if err := sessions.CloseAll(); err != nil {
+		log.Error("Failed to clean up transcode sessions", interfaces.Error(err))
+	}
+
+	// Close database connection
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+
+	// Stop HTTP servers
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Error("Failed to stop HTTP server", interfaces.Error(err))
+	}
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+			log.Error("Failed to stop metrics server", interfaces.Error(err))
+		}
+	}
+
+	log.Info("Streaming service stopped")
+}
+
+// streamMetrics counts the requests served over HTTP.
+type streamMetrics struct {
+	keyRequests atomic.Int64
+}
+
+func newMetricsServer(
+	cfg config.MetricsConfig,
+	counters *streamMetrics,
+	sessions *hls.SessionManager,
+	apiVersions *apiversion.Policy,
+	shedder *loadshed.Shedder,
+) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle(cfg.Path, metrics.Handler(func(w *metrics.Writer) {
+		w.Counter("narwhal_streaming_key_requests_total", "HLS key requests served.",
+			float64(counters.keyRequests.Load()))
+
+		stats := sessions.Stats()
+		w.Gauge("narwhal_streaming_sessions_active", "JIT and live transcode sessions running.",
+			float64(stats.Active))
+		w.Gauge("narwhal_streaming_session_disk_bytes", "Bytes of segments kept by running sessions.",
+			float64(stats.DiskBytes))
+		w.Gauge("narwhal_streaming_session_max_disk_bytes", "Bytes of segments kept by the largest running session.",
+			float64(stats.MaxSessionBytes))
+
+		apiVersions.WriteMetrics(w)
+		shedder.WriteMetrics(w)
+	}))
+
+	return &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
+
+func newHTTPServer(
+	port int,
+	cachePath string,
+	keyManager *hls.KeyManager,
+	origin http.Handler,
+	debug http.Handler,
+	counters *streamMetrics,
+) *http.Server {
+	mux := http.NewServeMux()
+
+	// Health check endpoint
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"status":"healthy"}`))
+	})
+
+	// Readiness check endpoint
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		// Segments cannot be served without the segment cache
+		w.Header().Set("Content-Type", "application/json")
+		if info, err := os.Stat(cachePath); err != nil || !info.IsDir() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"status":"not ready"}`))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"status":"ready"}`))
+	})
+
+	// Keys of encrypted HLS streams, authorized by stream tokens
+	if keyManager != nil {
+		keys := keyManager.KeyHandler()
+		mux.Handle("/keys/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			counters.keyRequests.Add(1)
+			keys.ServeHTTP(w, r)
+		}))
+	}
+
+	// Segments edges of the CDN pull, if it pulls from the origin
+	if origin != nil {
+		mux.Handle("/origin/", http.StripPrefix("/origin", origin))
+	}
+
+	// Runtime diagnostics, if enabled
+	if debug != nil {
+		mux.Handle(diagnostics.Prefix, debug)
+	}
+
+	return &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
+
+func serveHTTP(server *http.Server, name string, log interfaces.Logger) {
+	log.Info(name+" server starting", interfaces.String("address", server.Addr))
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error(name+" server failed", interfaces.Error(err))
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -19,18 +20,30 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/narwhalmedia/narwhal/cmd/constants"
+	eventsHandler "github.com/narwhalmedia/narwhal/internal/events/handler"
 	"github.com/narwhalmedia/narwhal/internal/user/domain"
 	"github.com/narwhalmedia/narwhal/internal/user/handler"
 	"github.com/narwhalmedia/narwhal/internal/user/repository"
 	"github.com/narwhalmedia/narwhal/internal/user/service"
+	"github.com/narwhalmedia/narwhal/pkg/apiversion"
+	"github.com/narwhalmedia/narwhal/pkg/assets"
 	"github.com/narwhalmedia/narwhal/pkg/auth"
 	authpb "github.com/narwhalmedia/narwhal/pkg/auth/v1"
+	"github.com/narwhalmedia/narwhal/pkg/clientip"
 	"github.com/narwhalmedia/narwhal/pkg/config"
 	"github.com/narwhalmedia/narwhal/pkg/database"
+	"github.com/narwhalmedia/narwhal/pkg/diagnostics"
 	"github.com/narwhalmedia/narwhal/pkg/events"
+	eventspb "github.com/narwhalmedia/narwhal/pkg/events/v1"
+	"github.com/narwhalmedia/narwhal/pkg/i18n"
 	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/loadshed"
 	"github.com/narwhalmedia/narwhal/pkg/logger"
+	"github.com/narwhalmedia/narwhal/pkg/mail"
+	"github.com/narwhalmedia/narwhal/pkg/metrics"
 	"github.com/narwhalmedia/narwhal/pkg/middleware"
+	"github.com/narwhalmedia/narwhal/pkg/oidc"
+	"github.com/narwhalmedia/narwhal/pkg/storage"
 	"github.com/narwhalmedia/narwhal/pkg/utils"
 )
 
@@ -38,8 +51,9 @@ func main() {
 	// Load configuration
 	cfg := config.MustLoadServiceConfig("user", config.GetDefaultUserConfig())
 
-	// Initialize logger
-	log := logger.New()
+	// Initialize logger. Recent entries are kept for the log viewer.
+	logs := logger.NewRingBuffer(logger.DefaultRingSize)
+	log := logger.WithRing(logger.New(), logs, "user")
 
 	log.Info("User service starting",
 		interfaces.String("version", config.GetServiceVersion(&cfg.Service)),
@@ -66,8 +80,17 @@ func main() {
 	// Initialize cache
 	cacheClient := utils.NewInMemoryCache()
 
-	// Initialize event bus
-	eventBus := events.NewLocalEventBus(log)
+	// Initialize event bus. Handlers that keep failing dead-letter their
+	// events for inspection.
+	deadLetters := events.NewDeadLetterQueue(cfg.Events.DeadLetterAlertThreshold, log)
+	bus := events.NewLocalEventBus(log).WithDeadLetterQueue(deadLetters, cfg.Events.MaxDeliveryAttempts)
+	eventBus := events.NewPublisher(bus, log)
+
+	// Notable events are kept for the admin activity feed
+	activity := events.NewActivityFeed(events.DefaultActivityFeedSize)
+	if err := activity.Subscribe(eventBus); err != nil {
+		log.Fatal("Failed to subscribe activity feed", interfaces.Error(err))
+	}
 
 	// Initialize JWT manager
 	jwtSecret := cfg.Auth.JWTSecret
@@ -92,20 +115,185 @@ func main() {
 	repo := repository.NewGormRepository(db)
 
 	// Initialize services
+	mailer := newMailer(cfg.Mail, log)
 	authService := service.NewAuthService(repo, jwtManager, eventBus, log)
+	if cfg.Auth.SignInProtection != config.SignInProtectionOff {
+		var locator domain.GeoLocator
+		if cfg.Auth.GeoIPURL != "" {
+			locator = service.NewHTTPGeoLocator(cfg.Auth.GeoIPURL, 5*time.Second)
+		}
+		authService.WithSignInProtection(service.SignInProtection{
+			RequireVerification: cfg.Auth.SignInProtection == config.SignInProtectionVerify,
+			MaxTravelSpeed:      cfg.Auth.ImpossibleTravelSpeed,
+			ChallengeTTL:        cfg.Auth.LoginChallengeTTL,
+		}, locator, mailer)
+	}
+	// The shared auth config holds the OpenID Connect providers
+	oidcProviders := make([]service.OIDCProvider, len(cfg.BaseConfig.Auth.OIDCProviders))
+	for i, p := range cfg.BaseConfig.Auth.OIDCProviders {
+		oidcProviders[i] = service.OIDCProvider{
+			Name:     p.Name,
+			Verifier: oidc.NewVerifier(p.IssuerURL, p.ClientID, &http.Client{Timeout: 10 * time.Second}),
+			Roles: domain.RoleMapping{
+				Claim:   p.RoleClaim,
+				Roles:   p.RoleMapping,
+				Default: p.DefaultRole,
+			},
+		}
+	}
+	authService.WithOIDCProviders(oidcProviders...)
+	// Two-factor secrets are encrypted with the master key
+	encryptor, err := cfg.Secrets.NewEncryptor()
+	switch {
+	case errors.Is(err, config.ErrNoEncryptionKey):
+		log.Warn("No encryption key configured; users cannot enable two-factor authentication")
+	case err != nil:
+		log.Fatal("Failed to load encryption key", interfaces.Error(err))
+	}
+	authService.WithTOTP(cfg.Auth.TOTPIssuer, encryptor)
 	userService := service.NewUserService(repo, eventBus, cacheClient, log)
+	tenantService := service.NewTenantService(repo, eventBus, log)
+	inviteService := service.NewInviteService(repo, eventBus, log)
+	regService := service.NewRegistrationService(repo, mailer, eventBus, log, service.RegistrationConfig{
+		Enabled:         cfg.Auth.AllowRegistration,
+		RequireApproval: cfg.Auth.RequireApproval,
+		RateLimit:       cfg.Auth.RegistrationRateLimit,
+		BlockedDomains:  cfg.Auth.BlockedEmailDomains,
+		VerifyURL:       strings.TrimRight(cfg.Mail.BaseURL, "/") + "/verify-email",
+	})
+
+	objectStore, err := cfg.Storage.NewObjectStore()
+	if err != nil {
+		log.Fatal("Failed to initialize asset storage", interfaces.Error(err))
+	}
+	assetStore := assets.NewStore(assets.NewGormRepository(db), objectStore, log)
+	if cfg.Storage.GCInterval > 0 {
+		go assetStore.RunGarbageCollector(context.Background(), cfg.Storage.GCInterval, cfg.Storage.GCGracePeriod)
+	}
+
+	avatarService := service.NewAvatarService(
+		repo,
+		assetStore,
+		cacheClient,
+		eventBus,
+		log,
+		cfg.Avatar.MaxBytes,
+		cfg.Avatar.Size,
+	)
+	if err := avatarService.Start(); err != nil {
+		log.Fatal("Failed to start avatar service", interfaces.Error(err))
+	}
+
+	prefService := service.NewPreferenceService(repo, cacheClient, eventBus, log)
+	deviceService := service.NewDeviceService(repo, eventBus, log)
+	impersonationService := service.NewImpersonationService(
+		repo,
+		jwtManager,
+		eventBus,
+		log,
+		cfg.Auth.ImpersonationTTL,
+	)
+	permissionService := service.NewPermissionService(repo, cacheClient, eventBus, log)
+	if err := permissionService.Start(); err != nil {
+		log.Fatal("Failed to start permission service", interfaces.Error(err))
+	}
+	featureFlagService := service.NewFeatureFlagService(repo, cacheClient, eventBus, log)
+	if err := featureFlagService.Start(); err != nil {
+		log.Fatal("Failed to start feature flag service", interfaces.Error(err))
+	}
+	consentService := service.NewConsentService(repo, eventBus, log)
+	privacyService := service.NewPrivacyService(repo, cacheClient, eventBus, log)
+	if err := privacyService.Start(); err != nil {
+		log.Fatal("Failed to start privacy service", interfaces.Error(err))
+	}
+	// Requesters are emailed when their content requests are decided or
+	// become available
+	if err := service.NewRequestNotifier(repo, mailer, eventBus, log).Start(); err != nil {
+		log.Fatal("Failed to start request notifier", interfaces.Error(err))
+	}
+	if err := service.NewIssueNotifier(repo, mailer, eventBus, log).Start(); err != nil {
+		log.Fatal("Failed to start issue notifier", interfaces.Error(err))
+	}
+	apiKeyService := service.NewAPIKeyService(repo, eventBus, log)
+	digestService := service.NewDigestService(repo, mailer, eventBus, log)
+	if err := digestService.Start(); err != nil {
+		log.Fatal("Failed to start digest service", interfaces.Error(err))
+	}
 
 	// Initialize gRPC handler
-	grpcHandler := handler.NewGRPCHandler(authService, userService, log)
+	grpcHandler := handler.NewGRPCHandler(
+		authService,
+		userService,
+		tenantService,
+		inviteService,
+		regService,
+		avatarService,
+		prefService,
+		deviceService,
+		impersonationService,
+		permissionService,
+		featureFlagService,
+		consentService,
+		privacyService,
+		apiKeyService,
+		log,
+	)
+
+	// Flags calls to deprecated API versions and counts calls per version
+	apiVersions := apiversion.DefaultPolicy(log).EnforceSunset(cfg.Service.EnforceAPISunset)
+
+	// Client IPs recorded on sessions, devices, consents and audits and
+	// used for rate limiting are only taken from trusted proxies' headers
+	clientIPs, err := clientip.NewResolver(cfg.Service.TrustedProxies)
+	if err != nil {
+		log.Fatal("Invalid trusted proxies", interfaces.Error(err))
+	}
+
+	// Sheds exports and audits while the database is saturated, keeping
+	// logins and token checks responsive
+	shedder, err := cfg.LoadShedding.NewShedder(log)
+	if err != nil {
+		log.Fatal("Failed to create load shedder", interfaces.Error(err))
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		shedder.WithDB(sqlDB)
+	}
+	if cfg.LoadShedding.Enabled {
+		go shedder.Run(context.Background(), cfg.LoadShedding.Interval)
+	}
 
 	// Create gRPC server with interceptors
+	publicMethods := config.GetPublicMethods(&cfg.Service)
 	grpcServer := grpc.NewServer(
-		grpc.UnaryInterceptor(middleware.AuthInterceptor(jwtManager, middleware.PublicMethods())),
-		grpc.StreamInterceptor(middleware.StreamAuthInterceptor(jwtManager, middleware.PublicMethods())),
+		grpc.ChainUnaryInterceptor(
+			clientIPs.UnaryServerInterceptor(),
+			middleware.LocalizationInterceptor(i18n.Default()),
+			shedder.UnaryServerInterceptor(),
+			middleware.TimeoutInterceptor(middleware.NewTimeouts(cfg.Service.RequestTimeout, cfg.Service.MethodTimeouts)),
+			apiVersions.UnaryServerInterceptor(),
+			middleware.AuthInterceptor(jwtManager, publicMethods, apiKeyService),
+			middleware.ImpersonationInterceptor(log, auth.ImpersonationBlockedMethods()),
+		),
+		grpc.ChainStreamInterceptor(
+			clientIPs.StreamServerInterceptor(),
+			middleware.StreamLocalizationInterceptor(i18n.Default()),
+			shedder.StreamServerInterceptor(),
+			middleware.StreamTimeoutInterceptor(),
+			apiVersions.StreamServerInterceptor(),
+			middleware.StreamAuthInterceptor(jwtManager, publicMethods, apiKeyService),
+			middleware.StreamImpersonationInterceptor(log, auth.ImpersonationBlockedMethods()),
+		),
 	)
 
 	// Register services
 	authpb.RegisterAuthServiceServer(grpcServer, grpcHandler)
+	eventspb.RegisterDeadLetterServiceServer(grpcServer, eventsHandler.NewGRPCHandler(deadLetters, log))
+	redactedConfig, err := config.Redacted(cfg)
+	if err != nil {
+		log.Warn("Failed to redact config for diagnostics", interfaces.Error(err))
+	}
+	eventspb.RegisterDiagnosticsServiceServer(grpcServer,
+		eventsHandler.NewDiagnosticsHandler(logs, activity, log).WithConfig("user", redactedConfig))
 
 	// Register health service
 	healthServer := health.NewServer()
@@ -115,7 +303,8 @@ func main() {
 	// Enable reflection
 	reflection.Register(grpcServer)
 
-	// Start session cleanup routine
+	// Start cleanup routine for sessions, data exports and deleted accounts,
+	// which also requests the email digests that are due
 	go func() {
 		ticker := time.NewTicker(1 * time.Hour)
 		defer ticker.Stop()
@@ -125,6 +314,15 @@ func main() {
 			if err := authService.CleanupExpiredSessions(ctx); err != nil {
 				log.Error("Failed to cleanup expired sessions", interfaces.Error(err))
 			}
+			if err := privacyService.CleanupExpiredDataExports(ctx); err != nil {
+				log.Error("Failed to cleanup expired data exports", interfaces.Error(err))
+			}
+			if _, err := privacyService.PurgeDueAccounts(ctx); err != nil {
+				log.Error("Failed to delete accounts due for deletion", interfaces.Error(err))
+			}
+			if _, err := digestService.RequestDue(ctx, time.Now()); err != nil {
+				log.Error("Failed to request email digests", interfaces.Error(err))
+			}
 			cancel()
 		}
 	}()
@@ -147,11 +345,19 @@ func main() {
 
 	// Start metrics server if enabled
 	if cfg.Metrics.Enabled {
-		go startMetricsServer(cfg.Metrics, log)
+		go startMetricsServer(cfg.Metrics, bus, deadLetters, apiVersions, shedder, log)
+	}
+
+	// Runtime diagnostics on the HTTP port, for loopback clients or admins.
+	// Method permissions are not enforced here, so admins are recognized by
+	// the built-in role permissions.
+	var debugHandler http.Handler
+	if cfg.Diagnostics.Enabled {
+		debugHandler = diagnostics.NewHandler(diagnostics.Guard(cfg.Diagnostics.LocalhostOnly, clientIPs, jwtManager, auth.NewRBAC()))
 	}
 
 	// Start health check server
-	go startHealthServer(cfg.Service.Port, db, log)
+	go startHealthServer(cfg.Service.Port, db, localAssetRoot(objectStore), cfg.Avatar.StoragePath, debugHandler, log)
 
 	// Wait for interrupt signal
 	sigChan := make(chan os.Signal, 1)
@@ -176,13 +382,35 @@ func main() {
 	log.Info("User service stopped")
 }
 
-func startMetricsServer(cfg config.MetricsConfig, log interfaces.Logger) {
-	mux := http.NewServeMux()
-	mux.HandleFunc(cfg.Path, func(w http.ResponseWriter, r *http.Request) {
-		// TODO: Implement Prometheus metrics
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("# Metrics endpoint\n"))
+// newMailer returns an SMTP mailer, or a log mailer when no relay is configured.
+func newMailer(cfg config.MailSettings, log interfaces.Logger) interfaces.Mailer {
+	if cfg.SMTPHost == "" {
+		log.Warn("No SMTP host configured, emails will be logged instead of sent")
+		return mail.NewLogMailer(log)
+	}
+	return mail.NewSMTPMailer(mail.SMTPConfig{
+		Host:     cfg.SMTPHost,
+		Port:     cfg.SMTPPort,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.From,
 	})
+}
+
+func startMetricsServer(
+	cfg config.MetricsConfig,
+	bus *events.LocalEventBus,
+	deadLetters *events.DeadLetterQueue,
+	apiVersions *apiversion.Policy,
+	shedder *loadshed.Shedder,
+	log interfaces.Logger,
+) {
+	mux := http.NewServeMux()
+	mux.Handle(cfg.Path, metrics.Handler(func(w *metrics.Writer) {
+		writeEventMetrics(w, bus, deadLetters)
+		apiVersions.WriteMetrics(w)
+		shedder.WriteMetrics(w)
+	}))
 
 	addr := fmt.Sprintf(":%d", cfg.Port)
 	log.Info("Metrics server starting", interfaces.String("address", addr))
@@ -192,7 +420,24 @@ func startMetricsServer(cfg config.MetricsConfig, log interfaces.Logger) {
 	}
 }
 
-func startHealthServer(port int, db *gorm.DB, log interfaces.Logger) {
+// writeEventMetrics writes the delivery state of the event bus.
+func writeEventMetrics(w *metrics.Writer, bus *events.LocalEventBus, deadLetters *events.DeadLetterQueue) {
+	stats := bus.Stats()
+	w.Gauge(metrics.EventsPending, "Published events not yet delivered to every handler.", float64(stats.Pending))
+	for handler, lag := range stats.Lag {
+		w.Gauge(metrics.EventsConsumerLagSeconds, "Delay between an event and its delivery to the handler.",
+			lag.Seconds(), "handler", handler)
+	}
+	w.Gauge(metrics.EventsDeadLetters, "Events in the dead-letter queue.", float64(deadLetters.Depth()))
+}
+
+func startHealthServer(
+	port int,
+	db *gorm.DB,
+	assetRoot, legacyAvatarRoot string,
+	debug http.Handler,
+	log interfaces.Logger,
+) {
 	mux := http.NewServeMux()
 
 	// Health check endpoint
@@ -218,6 +463,17 @@ func startHealthServer(port int, db *gorm.DB, log interfaces.Logger) {
 		_, _ = w.Write([]byte(`{"status":"ready"}`))
 	})
 
+	// Assets of the local asset store, and avatars uploaded before it
+	if assetRoot != "" {
+		mux.Handle("/assets/", http.StripPrefix("/assets/", http.FileServer(http.Dir(assetRoot))))
+	}
+	mux.Handle("/avatars/", http.StripPrefix("/avatars/", http.FileServer(http.Dir(legacyAvatarRoot))))
+
+	// Runtime diagnostics, if enabled
+	if debug != nil {
+		mux.Handle(diagnostics.Prefix, debug)
+	}
+
 	addr := fmt.Sprintf(":%d", port)
 	log.Info("Health server starting", interfaces.String("address", addr))
 
@@ -284,10 +540,12 @@ func seedInitialData(db *gorm.DB) error {
 		}
 	}
 
-	// Create roles
+	// Create roles. Each role inherits everything its parent can do, so
+	// parents are created first.
 	roles := []struct {
 		name        string
 		description string
+		parent      string
 		permissions []string
 	}{
 		{
@@ -295,25 +553,36 @@ func seedInitialData(db *gorm.DB) error {
 			description: "Administrator with full access",
 			permissions: []string{"*:*"}, // All permissions
 		},
+		{
+			name:        domain.RoleGuest,
+			description: "Guest with limited access",
+			permissions: []string{
+				domain.ResourceMedia + ":" + domain.ActionRead,
+			},
+		},
 		{
 			name:        domain.RoleUser,
 			description: "Regular user with media access",
+			parent:      domain.RoleGuest,
 			permissions: []string{
 				domain.ResourceLibrary + ":" + domain.ActionRead,
-				domain.ResourceMedia + ":" + domain.ActionRead,
 				domain.ResourceStreaming + ":" + domain.ActionRead,
 				domain.ResourceAnalytics + ":" + domain.ActionRead,
 			},
 		},
 		{
-			name:        domain.RoleGuest,
-			description: "Guest with limited access",
+			name:        domain.RoleModerator,
+			description: "Moderator who curates library content",
+			parent:      domain.RoleUser,
 			permissions: []string{
-				domain.ResourceMedia + ":" + domain.ActionRead,
+				domain.ResourceLibrary + ":" + domain.ActionWrite,
+				domain.ResourceMedia + ":" + domain.ActionWrite,
+				domain.ResourceMedia + ":" + domain.ActionDelete,
 			},
 		},
 	}
 
+	roleIDs := make(map[string]uuid.UUID, len(roles))
 	for _, r := range roles {
 		role := &domain.Role{
 			ID:          uuid.New(),
@@ -343,7 +612,23 @@ func seedInitialData(db *gorm.DB) error {
 		if err := repo.CreateRole(ctx, role); err != nil {
 			return fmt.Errorf("failed to create role %s: %w", r.name, err)
 		}
+		roleIDs[r.name] = role.ID
+
+		if r.parent != "" {
+			if err := repo.SetRoleParents(ctx, role.ID, []uuid.UUID{roleIDs[r.parent]}); err != nil {
+				return fmt.Errorf("failed to set parent of role %s: %w", r.name, err)
+			}
+		}
 	}
 
 	return nil
 }
+
+// localAssetRoot returns the directory of a local object store, which is
+// served over HTTP; objects of other stores are served by the store itself.
+func localAssetRoot(store interfaces.ObjectStore) string {
+	if local, ok := store.(*storage.LocalStore); ok {
+		return local.Root()
+	}
+	return ""
+}
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/pkg/diagnostics"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	eventspb "github.com/narwhalmedia/narwhal/pkg/events/v1"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/logger"
+)
+
+// DiagnosticsHandler implements the DiagnosticsService gRPC server on top of
+// a service's log buffer and activity feed.
+type DiagnosticsHandler struct {
+	eventspb.UnimplementedDiagnosticsServiceServer
+
+	logs   *logger.RingBuffer
+	feed   *events.ActivityFeed
+	logger interfaces.Logger
+
+	service string
+	config  map[string]interface{}
+}
+
+// NewDiagnosticsHandler creates a new diagnostics handler. feed may be nil
+// for services without an event bus.
+func NewDiagnosticsHandler(
+	logs *logger.RingBuffer,
+	feed *events.ActivityFeed,
+	logger interfaces.Logger,
+) *DiagnosticsHandler {
+	return &DiagnosticsHandler{
+		logs:   logs,
+		feed:   feed,
+		logger: logger,
+	}
+}
+
+// WithConfig names the service in captured archives and includes its
+// configuration, which must already be redacted.
+func (h *DiagnosticsHandler) WithConfig(service string, config map[string]interface{}) *DiagnosticsHandler {
+	h.service = service
+	h.config = config
+	return h
+}
+
+// TailLogs returns the service's most recent log entries.
+func (h *DiagnosticsHandler) TailLogs(
+	_ context.Context,
+	req *eventspb.TailLogsRequest,
+) (*eventspb.TailLogsResponse, error) {
+	if req.GetLimit() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit cannot be negative")
+	}
+
+	filter := logger.TailFilter{
+		MinLevel: zapcore.DebugLevel,
+		Service:  req.GetService(),
+		AfterSeq: req.GetAfterSeq(),
+		Limit:    int(req.GetLimit()),
+	}
+	if req.GetMinLevel() != "" {
+		level, err := zapcore.ParseLevel(req.GetMinLevel())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid log level %q", req.GetMinLevel())
+		}
+		filter.MinLevel = level
+	}
+
+	entries := h.logs.Tail(filter)
+	protoEntries := make([]*eventspb.LogEntry, len(entries))
+	for i, entry := range entries {
+		protoEntries[i] = &eventspb.LogEntry{
+			Seq:     entry.Seq,
+			Time:    timestamppb.New(entry.Time),
+			Level:   entry.Level.String(),
+			Service: entry.Service,
+			Message: entry.Message,
+			Fields:  entry.Fields,
+		}
+	}
+
+	return &eventspb.TailLogsResponse{
+		Entries: protoEntries,
+		LastSeq: h.logs.LastSeq(),
+	}, nil
+}
+
+// ListActivity lists notable events, newest first.
+func (h *DiagnosticsHandler) ListActivity(
+	_ context.Context,
+	req *eventspb.ListActivityRequest,
+) (*eventspb.ListActivityResponse, error) {
+	if req.GetLimit() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit cannot be negative")
+	}
+	if h.feed == nil {
+		return &eventspb.ListActivityResponse{}, nil
+	}
+
+	var since time.Time
+	if req.GetSince() != nil {
+		since = req.GetSince().AsTime()
+	}
+
+	activities := h.feed.List(req.GetKind(), since, int(req.GetLimit()))
+	protoActivities := make([]*eventspb.Activity, len(activities))
+	for i, activity := range activities {
+		payload, err := payloadToStruct(activity.Payload)
+		if err != nil {
+			h.logger.Warn("Failed to encode activity payload",
+				interfaces.String("event_id", activity.ID),
+				interfaces.Error(err))
+		}
+		protoActivities[i] = &eventspb.Activity{
+			Id:          activity.ID,
+			Kind:        activity.Kind,
+			EventType:   activity.EventType,
+			AggregateId: activity.AggregateID,
+			OccurredAt:  timestamppb.New(activity.OccurredAt),
+			Payload:     payload,
+		}
+	}
+
+	return &eventspb.ListActivityResponse{
+		Activities: protoActivities,
+	}, nil
+}
+
+// CaptureDiagnostics bundles runtime profiles and the configuration into an
+// archive for bug reports.
+func (h *DiagnosticsHandler) CaptureDiagnostics(
+	_ context.Context,
+	_ *eventspb.CaptureDiagnosticsRequest,
+) (*eventspb.CaptureDiagnosticsResponse, error) {
+	archive, err := diagnostics.Capture(h.service, h.config)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to capture diagnostics: %v", err)
+	}
+
+	h.logger.Info("Diagnostics captured", interfaces.Int("bytes", len(archive)))
+
+	name := "narwhal"
+	if h.service != "" {
+		name += "-" + h.service
+	}
+	return &eventspb.CaptureDiagnosticsResponse{
+		Archive:  archive,
+		Filename: fmt.Sprintf("%s-diagnostics-%s.tar.gz", name, time.Now().UTC().Format("20060102T150405Z")),
+	}, nil
+}
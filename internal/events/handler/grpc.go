@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	eventspb "github.com/narwhalmedia/narwhal/pkg/events/v1"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// GRPCHandler implements the DeadLetterService gRPC server on top of a
+// service's dead-letter queue.
+type GRPCHandler struct {
+	eventspb.UnimplementedDeadLetterServiceServer
+
+	queue  *events.DeadLetterQueue
+	logger interfaces.Logger
+}
+
+// NewGRPCHandler creates a new gRPC handler.
+func NewGRPCHandler(queue *events.DeadLetterQueue, logger interfaces.Logger) *GRPCHandler {
+	return &GRPCHandler{
+		queue:  queue,
+		logger: logger,
+	}
+}
+
+// ListDeadLetters lists dead-lettered events.
+func (h *GRPCHandler) ListDeadLetters(
+	_ context.Context,
+	req *eventspb.ListDeadLettersRequest,
+) (*eventspb.ListDeadLettersResponse, error) {
+	if req.GetLimit() < 0 || req.GetOffset() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit and offset cannot be negative")
+	}
+
+	letters, total := h.queue.List(req.GetEventType(), int(req.GetLimit()), int(req.GetOffset()))
+
+	protoLetters := make([]*eventspb.DeadLetter, len(letters))
+	for i := range letters {
+		protoLetters[i] = h.deadLetterToProto(&letters[i])
+	}
+
+	return &eventspb.ListDeadLettersResponse{
+		DeadLetters: protoLetters,
+		Total:       int32(total),
+		Depth:       int32(h.queue.Depth()),
+	}, nil
+}
+
+// GetDeadLetter gets a dead-lettered event with its failure details.
+func (h *GRPCHandler) GetDeadLetter(
+	_ context.Context,
+	req *eventspb.GetDeadLetterRequest,
+) (*eventspb.GetDeadLetterResponse, error) {
+	letter, err := h.queue.Get(req.GetId())
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, status.Error(codes.NotFound, "dead letter not found")
+		}
+		return nil, status.Errorf(codes.Internal, "failed to get dead letter: %v", err)
+	}
+
+	return &eventspb.GetDeadLetterResponse{
+		DeadLetter: h.deadLetterToProto(&letter),
+	}, nil
+}
+
+// RequeueDeadLetters delivers dead-lettered events to their handler again.
+func (h *GRPCHandler) RequeueDeadLetters(
+	ctx context.Context,
+	req *eventspb.RequeueDeadLettersRequest,
+) (*eventspb.RequeueDeadLettersResponse, error) {
+	if len(req.GetIds()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "at least one dead letter ID is required")
+	}
+
+	requeued, err := h.queue.Requeue(ctx, req.GetIds())
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, status.Errorf(codes.Internal, "failed to requeue dead letters: %v", err)
+	}
+
+	processed := make(map[string]bool, len(requeued))
+	for _, id := range requeued {
+		processed[id] = true
+	}
+	var failed []string
+	for _, id := range req.GetIds() {
+		if !processed[id] {
+			failed = append(failed, id)
+		}
+	}
+
+	return &eventspb.RequeueDeadLettersResponse{
+		RequeuedIds: requeued,
+		FailedIds:   failed,
+	}, nil
+}
+
+// DiscardDeadLetters drops dead-lettered events without processing them.
+func (h *GRPCHandler) DiscardDeadLetters(
+	_ context.Context,
+	req *eventspb.DiscardDeadLettersRequest,
+) (*eventspb.DiscardDeadLettersResponse, error) {
+	if len(req.GetIds()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "at least one dead letter ID is required")
+	}
+
+	return &eventspb.DiscardDeadLettersResponse{
+		Discarded: int32(h.queue.Discard(req.GetIds())),
+	}, nil
+}
+
+func (h *GRPCHandler) deadLetterToProto(letter *events.DeadLetter) *eventspb.DeadLetter {
+	proto := &eventspb.DeadLetter{
+		Id:            letter.ID,
+		EventType:     letter.Event.EventType(),
+		AggregateId:   letter.Event.AggregateID(),
+		Handler:       letter.Handler,
+		Reason:        letter.Reason,
+		Attempts:      int32(letter.Attempts),
+		FirstFailedAt: timestamppb.New(letter.FirstFailedAt),
+		LastFailedAt:  timestamppb.New(letter.LastFailedAt),
+	}
+
+	if env, ok := letter.Event.(*events.Envelope); ok {
+		proto.EventId = env.ID
+		proto.EventVersion = env.Version
+		proto.OccurredAt = timestamppb.New(env.OccurredAt)
+	}
+
+	payload, err := payloadToStruct(events.PayloadOf(letter.Event))
+	if err != nil {
+		h.logger.Warn("Failed to encode dead letter payload",
+			interfaces.String("dead_letter_id", letter.ID),
+			interfaces.Error(err))
+	}
+	proto.Payload = payload
+
+	return proto
+}
+
+// payloadToStruct converts a payload to a Struct. Payload values such as
+// UUIDs are not Struct-compatible, so the payload goes through JSON first.
+func payloadToStruct(payload map[string]interface{}) (*structpb.Struct, error) {
+	if payload == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var generic map[string]interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	return structpb.NewStruct(generic)
+}
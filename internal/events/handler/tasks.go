@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	eventspb "github.com/narwhalmedia/narwhal/pkg/events/v1"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/task"
+)
+
+const (
+	defaultTaskPageSize = 50
+	maxTaskPageSize     = 200
+)
+
+// TaskHandler implements the TaskService gRPC server on top of a service's
+// task manager.
+type TaskHandler struct {
+	eventspb.UnimplementedTaskServiceServer
+
+	tasks  *task.Manager
+	logger interfaces.Logger
+}
+
+// NewTaskHandler creates a new task handler.
+func NewTaskHandler(tasks *task.Manager, logger interfaces.Logger) *TaskHandler {
+	return &TaskHandler{
+		tasks:  tasks,
+		logger: logger,
+	}
+}
+
+// ListTasks lists tasks, newest first.
+func (h *TaskHandler) ListTasks(
+	ctx context.Context,
+	req *eventspb.ListTasksRequest,
+) (*eventspb.ListTasksResponse, error) {
+	if req.GetLimit() < 0 || req.GetOffset() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit and offset cannot be negative")
+	}
+
+	limit := defaultTaskPageSize
+	if req.GetLimit() > 0 {
+		limit = min(int(req.GetLimit()), maxTaskPageSize)
+	}
+
+	filter := task.Filter{
+		Type:   req.GetType(),
+		Status: task.Status(req.GetStatus()),
+	}
+	tasks, err := h.tasks.List(ctx, filter, limit, int(req.GetOffset()))
+	if err != nil {
+		h.logger.Error("Failed to list tasks", interfaces.Error(err))
+		return nil, status.Error(codes.Internal, "failed to list tasks")
+	}
+
+	protoTasks := make([]*eventspb.Task, len(tasks))
+	for i, t := range tasks {
+		protoTasks[i] = taskToProto(t, false)
+	}
+
+	return &eventspb.ListTasksResponse{
+		Tasks: protoTasks,
+	}, nil
+}
+
+// GetTask gets a task with its logs.
+func (h *TaskHandler) GetTask(
+	ctx context.Context,
+	req *eventspb.GetTaskRequest,
+) (*eventspb.GetTaskResponse, error) {
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid task ID")
+	}
+
+	t, err := h.tasks.Get(ctx, id)
+	if err != nil {
+		return nil, taskError(err, "failed to get task")
+	}
+
+	return &eventspb.GetTaskResponse{
+		Task: taskToProto(t, true),
+	}, nil
+}
+
+// CancelTask asks a running task to stop.
+func (h *TaskHandler) CancelTask(
+	ctx context.Context,
+	req *eventspb.CancelTaskRequest,
+) (*eventspb.CancelTaskResponse, error) {
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid task ID")
+	}
+
+	t, err := h.tasks.Cancel(ctx, id)
+	if err != nil {
+		return nil, taskError(err, "failed to cancel task")
+	}
+
+	h.logger.Info("Task cancelled",
+		interfaces.String("task_id", t.ID.String()),
+		interfaces.String("type", t.Type))
+
+	return &eventspb.CancelTaskResponse{
+		Task: taskToProto(t, false),
+	}, nil
+}
+
+func taskError(err error, message string) error {
+	switch {
+	case errors.IsNotFound(err):
+		return status.Error(codes.NotFound, "task not found")
+	case errors.IsConflict(err):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return status.Errorf(codes.Internal, "%s: %v", message, err)
+	}
+}
+
+func taskToProto(t *task.Task, withLogs bool) *eventspb.Task {
+	protoTask := &eventspb.Task{
+		Id:          t.ID.String(),
+		Type:        t.Type,
+		Payload:     t.Payload,
+		Status:      string(t.Status),
+		Progress:    t.Progress,
+		Message:     t.Message,
+		Error:       t.Error,
+		Created:     timestamppb.New(t.CreatedAt),
+		StartedAt:   optionalTimestamp(t.StartedAt),
+		CompletedAt: optionalTimestamp(t.CompletedAt),
+		Updated:     timestamppb.New(t.UpdatedAt),
+	}
+	if withLogs {
+		protoTask.Logs = make([]*eventspb.TaskLogLine, len(t.Logs))
+		for i, line := range t.Logs {
+			protoTask.Logs[i] = &eventspb.TaskLogLine{
+				Time:    timestamppb.New(line.Time),
+				Message: line.Message,
+			}
+		}
+	}
+	return protoTask
+}
+
+func optionalTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
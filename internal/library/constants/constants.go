@@ -12,4 +12,9 @@ const (
 
 	// Cache constants.
 	CacheTTL = 5 * time.Minute
+
+	// Scan limits.
+	DefaultMaxConcurrentScans = 2
+	DefaultScanWorkers        = 4
+	DefaultScanBatchSize      = 100
 )
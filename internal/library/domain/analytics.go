@@ -0,0 +1,203 @@
+package domain
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// RetentionBuckets is the number of points of a retention curve, each
+	// covering an equal share of the runtime.
+	RetentionBuckets = 20
+	// MaxDropOffs is the number of drop-off points reported per title.
+	MaxDropOffs = 3
+)
+
+// Viewing is one user watching a title, or an episode of it, from the
+// first progress heartbeat to the last. It records how far they got, which
+// retention curves and completion rates are aggregated from.
+type Viewing struct {
+	ID        uuid.UUID
+	MediaID   uuid.UUID
+	EpisodeID *uuid.UUID
+	UserID    uuid.UUID
+	// Furthest is the furthest position reached, in seconds.
+	Furthest int
+	// Duration is the runtime of the title or episode, in seconds.
+	Duration  int
+	Completed bool
+	// Rewatch is set on viewings started after the user completed the
+	// title before.
+	Rewatch       bool
+	StartedAt     time.Time
+	LastHeartbeat time.Time
+}
+
+// Continues reports whether a heartbeat at position belongs to the viewing.
+// Heartbeats after a completed viewing start a new one once the user goes
+// back to the first half, so end credits do not count as rewatches.
+func (v *Viewing) Continues(position int) bool {
+	return !v.Completed || position >= v.Furthest/2
+}
+
+// Record applies a progress heartbeat to the viewing.
+func (v *Viewing) Record(position, duration int, completed bool, at time.Time) {
+	v.Furthest = max(v.Furthest, position)
+	if duration > 0 {
+		v.Duration = duration
+	}
+	v.Completed = v.Completed || completed
+	v.LastHeartbeat = at
+}
+
+// Watched returns the share of the runtime the viewing got through, from 0
+// to 1.
+func (v *Viewing) Watched() float64 {
+	if v.Completed {
+		return 1
+	}
+	if v.Duration <= 0 {
+		return 0
+	}
+	return min(float64(v.Furthest)/float64(v.Duration), 1)
+}
+
+// TitleStats aggregates the viewings of a title.
+type TitleStats struct {
+	MediaID uuid.UUID
+	Title   string
+	// Viewings and Viewers are the number of viewings and of distinct
+	// users who watched.
+	Viewings    int64
+	Viewers     int64
+	Completions int64
+	Rewatches   int64
+	// AverageWatched is the mean share of the runtime viewings got
+	// through.
+	AverageWatched float64
+	LastViewedAt   *time.Time
+}
+
+// CompletionRate returns the share of viewings that were completed.
+func (s *TitleStats) CompletionRate() float64 {
+	if s.Viewings == 0 {
+		return 0
+	}
+	return float64(s.Completions) / float64(s.Viewings)
+}
+
+// DropOff is a point where viewers stop watching a title.
+type DropOff struct {
+	// Position is where in the runtime viewers stopped, from 0 to 1.
+	Position float64
+	// Share is the share of viewings that stopped there.
+	Share float64
+}
+
+// TitleAnalytics are the stats of a title with its retention curve and the
+// points where most viewers stop watching.
+type TitleAnalytics struct {
+	TitleStats
+	// Retention holds, for each of RetentionBuckets equal shares of the
+	// runtime, the share of viewings that reached its start.
+	Retention []float64
+	// DropOffs are the points where most viewings stopped, most first.
+	// Completed viewings did not stop.
+	DropOffs []DropOff
+}
+
+// AggregateViewings returns the stats of the viewings of a title.
+func AggregateViewings(mediaID uuid.UUID, viewings []*Viewing) TitleStats {
+	stats := TitleStats{MediaID: mediaID, Viewings: int64(len(viewings))}
+	viewers := make(map[uuid.UUID]bool)
+	var watched float64
+	for _, v := range viewings {
+		viewers[v.UserID] = true
+		if v.Completed {
+			stats.Completions++
+		}
+		if v.Rewatch {
+			stats.Rewatches++
+		}
+		watched += v.Watched()
+		if stats.LastViewedAt == nil || v.LastHeartbeat.After(*stats.LastViewedAt) {
+			last := v.LastHeartbeat
+			stats.LastViewedAt = &last
+		}
+	}
+	stats.Viewers = int64(len(viewers))
+	if len(viewings) > 0 {
+		stats.AverageWatched = watched / float64(len(viewings))
+	}
+	return stats
+}
+
+// NewTitleAnalytics returns the analytics of a title from its viewings.
+func NewTitleAnalytics(mediaID uuid.UUID, viewings []*Viewing) *TitleAnalytics {
+	analytics := &TitleAnalytics{
+		TitleStats: AggregateViewings(mediaID, viewings),
+		Retention:  make([]float64, RetentionBuckets),
+		DropOffs:   []DropOff{},
+	}
+	if len(viewings) == 0 {
+		return analytics
+	}
+
+	reached := make([]int, RetentionBuckets)
+	stopped := make([]int, RetentionBuckets)
+	for _, v := range viewings {
+		// A viewing reaches every bucket up to the one it stopped in
+		last := min(int(v.Watched()*RetentionBuckets), RetentionBuckets-1)
+		for b := 0; b <= last; b++ {
+			reached[b]++
+		}
+		if !v.Completed {
+			stopped[last]++
+		}
+	}
+
+	total := float64(len(viewings))
+	for b := range analytics.Retention {
+		analytics.Retention[b] = float64(reached[b]) / total
+	}
+	for b, n := range stopped {
+		if n > 0 {
+			analytics.DropOffs = append(analytics.DropOffs, DropOff{
+				Position: float64(b) / RetentionBuckets,
+				Share:    float64(n) / total,
+			})
+		}
+	}
+	sort.SliceStable(analytics.DropOffs, func(i, j int) bool {
+		return analytics.DropOffs[i].Share > analytics.DropOffs[j].Share
+	})
+	if len(analytics.DropOffs) > MaxDropOffs {
+		analytics.DropOffs = analytics.DropOffs[:MaxDropOffs]
+	}
+	return analytics
+}
+
+// AnalyticsSort orders the titles of an analytics listing.
+type AnalyticsSort string
+
+const (
+	// AnalyticsLeastWatched lists the titles with the fewest viewings
+	// first, titles nobody watched leading: candidates for pruning.
+	AnalyticsLeastWatched AnalyticsSort = "least_watched"
+	// AnalyticsMostWatched lists the titles with the most viewings first.
+	AnalyticsMostWatched AnalyticsSort = "most_watched"
+	// AnalyticsLowestCompletion lists the watched titles viewers finish
+	// least first.
+	AnalyticsLowestCompletion AnalyticsSort = "lowest_completion"
+)
+
+// AnalyticsFilter selects the titles and viewings of an analytics listing.
+type AnalyticsFilter struct {
+	// LibraryID limits the titles to a library, if set.
+	LibraryID *uuid.UUID
+	// Since ignores viewings started before it.
+	Since time.Time
+	Sort  AnalyticsSort
+}
@@ -0,0 +1,62 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+)
+
+func TestViewingContinues(t *testing.T) {
+	now := time.Now()
+	viewing := &domain.Viewing{}
+	viewing.Record(5400, 6000, true, now)
+
+	assert.True(t, viewing.Continues(5900), "end credits continue a completed viewing")
+	assert.False(t, viewing.Continues(60), "going back to the start is a rewatch")
+	assert.True(t, (&domain.Viewing{Furthest: 3000}).Continues(0), "unfinished viewings continue")
+
+	viewing.Record(100, 0, false, now)
+	assert.Equal(t, 5400, viewing.Furthest)
+	assert.Equal(t, 6000, viewing.Duration, "heartbeats without a duration keep it")
+	assert.True(t, viewing.Completed)
+}
+
+func TestNewTitleAnalytics(t *testing.T) {
+	mediaID, alice, bob := uuid.New(), uuid.New(), uuid.New()
+	now := time.Now()
+	viewings := []*domain.Viewing{
+		{UserID: alice, Furthest: 1000, Duration: 1000, Completed: true, LastHeartbeat: now.Add(-time.Hour)},
+		{UserID: alice, Furthest: 1000, Duration: 1000, Completed: true, Rewatch: true, LastHeartbeat: now},
+		{UserID: bob, Furthest: 120, Duration: 1000, LastHeartbeat: now.Add(-2 * time.Hour)},
+		{UserID: uuid.New(), Furthest: 130, Duration: 1000, LastHeartbeat: now.Add(-3 * time.Hour)},
+	}
+
+	analytics := domain.NewTitleAnalytics(mediaID, viewings)
+
+	assert.Equal(t, int64(4), analytics.Viewings)
+	assert.Equal(t, int64(3), analytics.Viewers)
+	assert.Equal(t, int64(1), analytics.Rewatches)
+	assert.InDelta(t, 0.5, analytics.CompletionRate(), 0.001)
+	assert.InDelta(t, (1+1+0.12+0.13)/4, analytics.AverageWatched, 0.001)
+	require.NotNil(t, analytics.LastViewedAt)
+	assert.Equal(t, now, *analytics.LastViewedAt)
+
+	require.Len(t, analytics.Retention, domain.RetentionBuckets)
+	assert.InDelta(t, 1, analytics.Retention[0], 0.001)
+	assert.InDelta(t, 1, analytics.Retention[2], 0.001)
+	assert.InDelta(t, 0.5, analytics.Retention[3], 0.001, "half the viewers stop before 15%")
+	assert.InDelta(t, 0.5, analytics.Retention[domain.RetentionBuckets-1], 0.001)
+
+	require.Len(t, analytics.DropOffs, 1)
+	assert.InDelta(t, 0.1, analytics.DropOffs[0].Position, 0.001)
+	assert.InDelta(t, 0.5, analytics.DropOffs[0].Share, 0.001)
+
+	empty := domain.NewTitleAnalytics(mediaID, nil)
+	assert.Zero(t, empty.CompletionRate())
+	assert.Empty(t, empty.DropOffs)
+}
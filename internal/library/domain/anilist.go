@@ -0,0 +1,355 @@
+package domain
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// AniListProviderName is the name of the AniList metadata provider.
+const AniListProviderName = "anilist"
+
+// aniListMediaFields are the fields of AniList media that metadata is made
+// of.
+const aniListMediaFields = `
+	id
+	format
+	title { romaji english native }
+	description(asHtml: false)
+	startDate { year month day }
+	averageScore
+	genres
+	coverImage { extraLarge }
+	bannerImage
+	trailer { id site }
+	staff(perPage: 25) { edges { role node { name { full } } } }
+	characters(sort: ROLE, perPage: 10) { edges { voiceActors(language: JAPANESE) { name { full } } } }
+`
+
+const (
+	aniListSearchQuery = `query ($search: String, $formats: [MediaFormat], $year: Int) {
+	Page(perPage: 10) {
+		media(search: $search, type: ANIME, format_in: $formats, seasonYear: $year) {
+			id
+			format
+			title { romaji english native }
+			description(asHtml: false)
+			startDate { year }
+			coverImage { extraLarge }
+		}
+	}
+}`
+	aniListDetailsQuery = `query ($id: Int) {
+	Media(id: $id, type: ANIME) {` + aniListMediaFields + `}
+}`
+	aniListEpisodeQuery = `query ($id: Int, $episode: Int) {
+	AiringSchedule(mediaId: $id, episode: $episode) { episode airingAt }
+}`
+)
+
+var (
+	aniListMovieFormats = []string{"MOVIE"}
+	aniListTVFormats    = []string{"TV", "TV_SHORT", "ONA", "OVA", "SPECIAL"}
+)
+
+// AniListProvider fetches anime metadata from the AniList GraphQL API. It
+// is only used for anime libraries, and identifies series by AniList IDs.
+type AniListProvider struct {
+	url    string
+	client *http.Client
+}
+
+var _ MetadataProvider = (*AniListProvider)(nil)
+
+// NewAniListProvider creates a provider for the AniList API at a URL, such
+// as "https://graphql.anilist.co".
+func NewAniListProvider(url string, client *http.Client) *AniListProvider {
+	return &AniListProvider{
+		url:    url,
+		client: client,
+	}
+}
+
+// GetName returns the provider name.
+func (p *AniListProvider) GetName() string {
+	return AniListProviderName
+}
+
+// GetType returns "anime": the provider covers anime movies and series.
+func (p *AniListProvider) GetType() string {
+	return MetadataProviderTypeAnime
+}
+
+// SeriesID returns the AniList ID of a series.
+func (p *AniListProvider) SeriesID(metadata *models.Metadata) string {
+	return metadata.AniListID
+}
+
+// SearchMovie searches for anime movies.
+func (p *AniListProvider) SearchMovie(
+	ctx context.Context,
+	query string,
+	year int,
+	prefs MetadataPreferences,
+) ([]models.SearchResult, error) {
+	return p.search(ctx, query, year, aniListMovieFormats, "movie", prefs)
+}
+
+// SearchTV searches for anime series, OVAs and specials.
+func (p *AniListProvider) SearchTV(
+	ctx context.Context,
+	query string,
+	year int,
+	prefs MetadataPreferences,
+) ([]models.SearchResult, error) {
+	return p.search(ctx, query, year, aniListTVFormats, "tv", prefs)
+}
+
+// GetMovieDetails returns the metadata of an anime movie.
+func (p *AniListProvider) GetMovieDetails(
+	ctx context.Context,
+	providerID string,
+	prefs MetadataPreferences,
+) (*models.Metadata, error) {
+	return p.details(ctx, providerID, prefs)
+}
+
+// GetTVDetails returns the metadata of an anime series.
+func (p *AniListProvider) GetTVDetails(
+	ctx context.Context,
+	providerID string,
+	prefs MetadataPreferences,
+) (*models.Metadata, error) {
+	return p.details(ctx, providerID, prefs)
+}
+
+// GetEpisodeDetails returns the air date of an episode. AniList lists each
+// season as its own series, so the season is not used.
+func (p *AniListProvider) GetEpisodeDetails(
+	ctx context.Context,
+	providerID string,
+	season, episode int,
+	_ MetadataPreferences,
+) (*models.EpisodeMetadata, error) {
+	id, err := strconv.Atoi(providerID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AniList ID %q", providerID)
+	}
+
+	var data struct {
+		AiringSchedule *struct {
+			Episode  int   `json:"episode"`
+			AiringAt int64 `json:"airingAt"`
+		} `json:"AiringSchedule"`
+	}
+	if err := p.query(ctx, aniListEpisodeQuery, map[string]any{"id": id, "episode": episode}, &data); err != nil {
+		return nil, err
+	}
+	if data.AiringSchedule == nil {
+		return nil, nil
+	}
+	return &models.EpisodeMetadata{
+		SeasonNumber:  season,
+		EpisodeNumber: data.AiringSchedule.Episode,
+		AirDate:       time.Unix(data.AiringSchedule.AiringAt, 0).UTC().Format(time.DateOnly),
+	}, nil
+}
+
+type aniListTitle struct {
+	Romaji  string `json:"romaji"`
+	English string `json:"english"`
+	Native  string `json:"native"`
+}
+
+type aniListMedia struct {
+	ID          int          `json:"id"`
+	Format      string       `json:"format"`
+	Title       aniListTitle `json:"title"`
+	Description string       `json:"description"`
+	StartDate   struct {
+		Year  int `json:"year"`
+		Month int `json:"month"`
+		Day   int `json:"day"`
+	} `json:"startDate"`
+	AverageScore int      `json:"averageScore"`
+	Genres       []string `json:"genres"`
+	CoverImage   struct {
+		ExtraLarge string `json:"extraLarge"`
+	} `json:"coverImage"`
+	BannerImage string `json:"bannerImage"`
+	Trailer     *struct {
+		ID   string `json:"id"`
+		Site string `json:"site"`
+	} `json:"trailer"`
+	Staff struct {
+		Edges []struct {
+			Role string `json:"role"`
+			Node struct {
+				Name struct {
+					Full string `json:"full"`
+				} `json:"name"`
+			} `json:"node"`
+		} `json:"edges"`
+	} `json:"staff"`
+	Characters struct {
+		Edges []struct {
+			VoiceActors []struct {
+				Name struct {
+					Full string `json:"full"`
+				} `json:"name"`
+			} `json:"voiceActors"`
+		} `json:"edges"`
+	} `json:"characters"`
+}
+
+func (p *AniListProvider) search(
+	ctx context.Context,
+	query string,
+	year int,
+	formats []string,
+	resultType string,
+	prefs MetadataPreferences,
+) ([]models.SearchResult, error) {
+	variables := map[string]any{"search": query, "formats": formats}
+	if year > 0 {
+		variables["year"] = year
+	}
+
+	var data struct {
+		Page struct {
+			Media []aniListMedia `json:"media"`
+		} `json:"Page"`
+	}
+	if err := p.query(ctx, aniListSearchQuery, variables, &data); err != nil {
+		return nil, err
+	}
+
+	results := make([]models.SearchResult, len(data.Page.Media))
+	for i, media := range data.Page.Media {
+		results[i] = models.SearchResult{
+			ProviderID:   strconv.Itoa(media.ID),
+			ProviderName: AniListProviderName,
+			Title:        aniListTitleFor(media.Title, prefs),
+			Year:         media.StartDate.Year,
+			Type:         resultType,
+			PosterURL:    media.CoverImage.ExtraLarge,
+			Overview:     media.Description,
+		}
+	}
+	return results, nil
+}
+
+func (p *AniListProvider) details(
+	ctx context.Context,
+	providerID string,
+	prefs MetadataPreferences,
+) (*models.Metadata, error) {
+	id, err := strconv.Atoi(providerID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AniList ID %q", providerID)
+	}
+
+	var data struct {
+		Media *aniListMedia `json:"Media"`
+	}
+	if err := p.query(ctx, aniListDetailsQuery, map[string]any{"id": id}, &data); err != nil {
+		return nil, err
+	}
+	if data.Media == nil {
+		return nil, nil
+	}
+
+	media := data.Media
+	metadata := &models.Metadata{
+		AniListID:     strconv.Itoa(media.ID),
+		Title:         aniListTitleFor(media.Title, prefs),
+		OriginalTitle: media.Title.Native,
+		Description:   media.Description,
+		Rating:        float32(media.AverageScore) / 10,
+		Genres:        media.Genres,
+		PosterURL:     media.CoverImage.ExtraLarge,
+		BackdropURL:   media.BannerImage,
+	}
+	if d := media.StartDate; d.Year > 0 && d.Month > 0 && d.Day > 0 {
+		metadata.ReleaseDate = fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+	}
+	if media.Trailer != nil && media.Trailer.Site == "youtube" {
+		metadata.TrailerURL = "https://www.youtube.com/watch?v=" + media.Trailer.ID
+	}
+	for _, edge := range media.Staff.Edges {
+		if edge.Role == "Director" {
+			metadata.Directors = append(metadata.Directors, edge.Node.Name.Full)
+		}
+	}
+	for _, edge := range media.Characters.Edges {
+		for _, actor := range edge.VoiceActors {
+			metadata.Cast = append(metadata.Cast, actor.Name.Full)
+		}
+	}
+	return metadata, nil
+}
+
+// query runs a GraphQL query and decodes its data into out.
+func (p *AniListProvider) query(ctx context.Context, query string, variables map[string]any, out any) error {
+	body, err := json.Marshal(map[string]any{"query": query, "variables": variables})
+	if err != nil {
+		return fmt.Errorf("failed to encode AniList query: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create AniList request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to query AniList: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+			Status  int    `json:"status"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode AniList response: %w", err)
+	}
+
+	// Unknown IDs are reported as 404 errors with null data
+	for _, e := range result.Errors {
+		if e.Status != http.StatusNotFound {
+			return fmt.Errorf("AniList query failed: %s", e.Message)
+		}
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("AniList query failed: unexpected status %d", resp.StatusCode)
+	}
+	if len(result.Data) == 0 {
+		return errors.New("AniList query failed: no data")
+	}
+	return json.Unmarshal(result.Data, out)
+}
+
+// aniListTitleFor returns the English title for English metadata, and the
+// romanized title otherwise, as AniList has no other translations.
+func aniListTitleFor(title aniListTitle, prefs MetadataPreferences) string {
+	if title.English != "" && (prefs.Language == "" || strings.HasPrefix(prefs.Language, "en")) {
+		return title.English
+	}
+	if title.Romaji != "" {
+		return title.Romaji
+	}
+	return title.Native
+}
@@ -0,0 +1,84 @@
+package domain_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+func TestAniListProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query     string         `json:"query"`
+			Variables map[string]any `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		switch {
+		case strings.Contains(req.Query, "Page("):
+			_, _ = w.Write([]byte(`{"data":{"Page":{"media":[{"id":154587,"format":"TV",
+				"title":{"romaji":"Sousou no Frieren","english":"Frieren: Beyond Journey's End","native":"葬送のフリーレン"},
+				"startDate":{"year":2023}}]}}}`))
+		case strings.Contains(req.Query, "AiringSchedule"):
+			_, _ = w.Write([]byte(`{"data":{"AiringSchedule":{"episode":5,"airingAt":1696608000}}}`))
+		case req.Variables["id"] == float64(154587):
+			_, _ = w.Write([]byte(`{"data":{"Media":{"id":154587,
+				"title":{"romaji":"Sousou no Frieren","english":"Frieren: Beyond Journey's End","native":"葬送のフリーレン"},
+				"startDate":{"year":2023,"month":9,"day":29},"averageScore":91,"genres":["Adventure","Drama"],
+				"trailer":{"id":"qgQmO0WQyMk","site":"youtube"},
+				"staff":{"edges":[{"role":"Director","node":{"name":{"full":"Keiichirou Saitou"}}},
+					{"role":"Original Creator","node":{"name":{"full":"Kanehito Yamada"}}}]},
+				"characters":{"edges":[{"voiceActors":[{"name":{"full":"Atsumi Tanezaki"}}]}]}}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"data":{"Media":null},"errors":[{"message":"Not Found.","status":404}]}`))
+		}
+	}))
+	defer server.Close()
+
+	provider := domain.NewAniListProvider(server.URL, server.Client())
+	ctx := context.Background()
+	english := domain.MetadataPreferences{Language: "en"}
+
+	results, err := provider.SearchTV(ctx, "Frieren", 2023, english)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "154587", results[0].ProviderID)
+	assert.Equal(t, "Frieren: Beyond Journey's End", results[0].Title)
+
+	// Titles fall back to romaji outside English
+	results, err = provider.SearchTV(ctx, "Frieren", 0, domain.MetadataPreferences{Language: "de"})
+	require.NoError(t, err)
+	assert.Equal(t, "Sousou no Frieren", results[0].Title)
+
+	metadata, err := provider.GetTVDetails(ctx, "154587", english)
+	require.NoError(t, err)
+	assert.Equal(t, "154587", metadata.AniListID)
+	assert.Equal(t, "葬送のフリーレン", metadata.OriginalTitle)
+	assert.Equal(t, "2023-09-29", metadata.ReleaseDate)
+	assert.InDelta(t, 9.1, metadata.Rating, 0.001)
+	assert.Equal(t, []string{"Keiichirou Saitou"}, metadata.Directors)
+	assert.Equal(t, []string{"Atsumi Tanezaki"}, metadata.Cast)
+	assert.Equal(t, "https://www.youtube.com/watch?v=qgQmO0WQyMk", metadata.TrailerURL)
+	assert.Equal(t, "154587", provider.SeriesID(metadata))
+
+	metadata, err = provider.GetMovieDetails(ctx, "1", english)
+	require.NoError(t, err)
+	assert.Nil(t, metadata)
+
+	episode, err := provider.GetEpisodeDetails(ctx, "154587", 1, 5, english)
+	require.NoError(t, err)
+	assert.Equal(t, &models.EpisodeMetadata{SeasonNumber: 1, EpisodeNumber: 5, AirDate: "2023-10-06"}, episode)
+}
@@ -0,0 +1,218 @@
+package domain
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+var (
+	// seasonEpisodesPattern matches episode tags of one or more episodes,
+	// such as "S01E02", "S01E02E03", "S01E02-E03" and "S01E02-03".
+	seasonEpisodesPattern = regexp.MustCompile(
+		`(?i)(?:^|[^a-z0-9])s(\d{1,2})e(\d{1,3})((?:-?e\d{1,3})+|-\d{1,3})?(?:\D|$)`,
+	)
+
+	// fileExtensionPattern matches the extension of a file name.
+	fileExtensionPattern = regexp.MustCompile(`(?i)\.[a-z0-9]{2,4}$`)
+
+	// releaseTagPattern matches the bracketed tags of anime releases, such
+	// as "[SubsPlease]", "[ABCD1234]" and "(1080p)".
+	releaseTagPattern = regexp.MustCompile(`\[[^\]]*\]|\([^)]*\)`)
+
+	// absoluteEpisodePattern matches the absolute numbers of anime
+	// releases, such as "Show - 012", "Show - 12v2", "Show - 12-13" and
+	// "Show Ep 12".
+	absoluteEpisodePattern = regexp.MustCompile(
+		`(?i)(?:\s-\s*|\bep\.?\s?|\bepisode\s?|#)(\d{1,4})(?:v\d)?(?:\s?-\s?(\d{1,4})(?:v\d)?)?(?:[\s._]|$)`,
+	)
+
+	// specialPattern matches anime specials, such as "OVA", "OVA2", "SP01"
+	// and "Special 3".
+	specialPattern = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])(?:ova|oad|sp|special)\s?(\d{1,3})?(?:[^a-z0-9]|$)`)
+
+	// filePartPattern matches the part tags of episodes split across files,
+	// such as "Part 2", "pt1", "CD2" and "Disc 1".
+	filePartPattern = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])(?:part|pt|cd|dis[ck])[\s._-]?(\d{1,2})(?:[^a-z0-9]|$)`)
+)
+
+// EpisodeNumbers are the episodes a file holds. Files of two episodes hold
+// both; specials are in season 0.
+type EpisodeNumbers struct {
+	Season   int
+	Episodes []int
+	// Absolute are the absolute numbers of anime releases, which count
+	// episodes across seasons. Season and Episodes are unset for them.
+	Absolute []int
+	// Part is the part of an episode split across files the file holds,
+	// counted from 1; 0 for files holding whole episodes.
+	Part int
+}
+
+// Special reports whether the file holds a special.
+func (n EpisodeNumbers) Special() bool {
+	return n.Season == 0 && len(n.Episodes) > 0
+}
+
+// ParseEpisodeNumbers returns the episodes a file name refers to. Names
+// are parsed for "S01E02" style tags; anime names are also parsed for
+// absolute numbers and specials. Part tags following the episode, as in
+// "S01E02 Part 2", mark one part of a split episode.
+func ParseEpisodeNumbers(name string, anime bool) (EpisodeNumbers, bool) {
+	name = fileExtensionPattern.ReplaceAllString(name, "")
+
+	if match := seasonEpisodesPattern.FindStringSubmatchIndex(name); match != nil {
+		season, _ := strconv.Atoi(name[match[2]:match[3]])
+		first, _ := strconv.Atoi(name[match[4]:match[5]])
+		var rest string
+		if match[6] >= 0 {
+			rest = name[match[6]:match[7]]
+		}
+		return EpisodeNumbers{
+			Season:   season,
+			Episodes: episodeRange(first, rest),
+			Part:     parseFilePart(name[match[5]:]),
+		}, true
+	}
+	if !anime {
+		return EpisodeNumbers{}, false
+	}
+
+	name = releaseTagPattern.ReplaceAllString(name, " ")
+	part := parseFilePart(name)
+	absolute := absoluteEpisodePattern.FindStringSubmatch(name)
+
+	// Specials are numbered by their own tag, such as "OVA2", or else by
+	// the episode number next to it
+	if special := specialPattern.FindStringSubmatch(name); special != nil {
+		episode := 1
+		switch {
+		case special[1] != "":
+			episode, _ = strconv.Atoi(special[1])
+		case absolute != nil:
+			episode, _ = strconv.Atoi(absolute[1])
+		}
+		return EpisodeNumbers{Episodes: []int{episode}, Part: part}, true
+	}
+
+	if absolute == nil {
+		return EpisodeNumbers{}, false
+	}
+	first, _ := strconv.Atoi(absolute[1])
+	numbers := EpisodeNumbers{Absolute: []int{first}, Part: part}
+	if absolute[2] != "" {
+		last, _ := strconv.Atoi(absolute[2])
+		for n := first + 1; n <= last; n++ {
+			numbers.Absolute = append(numbers.Absolute, n)
+		}
+	}
+	return numbers, true
+}
+
+// parseFilePart returns the part number of a split episode in a name, or 0.
+func parseFilePart(name string) int {
+	match := filePartPattern.FindStringSubmatch(name)
+	if match == nil {
+		return 0
+	}
+	part, _ := strconv.Atoi(match[1])
+	return part
+}
+
+// episodeRange returns the episodes of a tag from its first episode and the
+// rest of it: "-03" and "-E03" are ranges, "E02E03" lists episodes.
+func episodeRange(first int, rest string) []int {
+	episodes := []int{first}
+	if rest == "" {
+		return episodes
+	}
+
+	var numbers []int
+	for _, part := range strings.FieldsFunc(strings.ToLower(rest), func(r rune) bool { return r == '-' || r == 'e' }) {
+		n, _ := strconv.Atoi(part)
+		numbers = append(numbers, n)
+	}
+	if strings.HasPrefix(rest, "-") && len(numbers) == 1 {
+		for n := first + 1; n <= numbers[0]; n++ {
+			episodes = append(episodes, n)
+		}
+		return episodes
+	}
+	return append(episodes, numbers...)
+}
+
+// EpisodeMap maps between the season numbering of a series, as TVDB
+// numbers it, and the absolute numbering anime releases use. Episodes
+// without a known absolute number are counted on from the previous one;
+// specials have none.
+type EpisodeMap struct {
+	byAbsolute map[int]*models.Episode
+	byNumber   map[[2]int]*models.Episode
+	absolute   map[[2]int]int
+}
+
+// NewEpisodeMap maps the episodes of a series.
+func NewEpisodeMap(episodes []*models.Episode) *EpisodeMap {
+	m := &EpisodeMap{
+		byAbsolute: make(map[int]*models.Episode),
+		byNumber:   make(map[[2]int]*models.Episode, len(episodes)),
+		absolute:   make(map[[2]int]int),
+	}
+
+	regular := make([]*models.Episode, 0, len(episodes))
+	for _, ep := range episodes {
+		m.byNumber[[2]int{ep.SeasonNumber, ep.EpisodeNumber}] = ep
+		if ep.SeasonNumber > 0 {
+			regular = append(regular, ep)
+		}
+	}
+	sort.Slice(regular, func(i, j int) bool {
+		if regular[i].SeasonNumber != regular[j].SeasonNumber {
+			return regular[i].SeasonNumber < regular[j].SeasonNumber
+		}
+		return regular[i].EpisodeNumber < regular[j].EpisodeNumber
+	})
+
+	next := 1
+	for _, ep := range regular {
+		absolute := ep.AbsoluteNumber
+		if absolute == 0 {
+			absolute = next
+		}
+		next = absolute + 1
+		m.byAbsolute[absolute] = ep
+		m.absolute[[2]int{ep.SeasonNumber, ep.EpisodeNumber}] = absolute
+	}
+	return m
+}
+
+// Episode returns the episode with an absolute number.
+func (m *EpisodeMap) Episode(absolute int) (*models.Episode, bool) {
+	ep, ok := m.byAbsolute[absolute]
+	return ep, ok
+}
+
+// Absolute returns the absolute number of an episode, or 0 for specials
+// and unknown episodes.
+func (m *EpisodeMap) Absolute(season, episode int) int {
+	return m.absolute[[2]int{season, episode}]
+}
+
+// Resolve returns the known episodes a file holds.
+func (m *EpisodeMap) Resolve(numbers EpisodeNumbers) []*models.Episode {
+	var episodes []*models.Episode
+	for _, n := range numbers.Episodes {
+		if ep, ok := m.byNumber[[2]int{numbers.Season, n}]; ok {
+			episodes = append(episodes, ep)
+		}
+	}
+	for _, n := range numbers.Absolute {
+		if ep, ok := m.byAbsolute[n]; ok {
+			episodes = append(episodes, ep)
+		}
+	}
+	return episodes
+}
@@ -0,0 +1,81 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+func TestParseEpisodeNumbers(t *testing.T) {
+	tests := []struct {
+		name  string
+		anime bool
+		want  domain.EpisodeNumbers
+		ok    bool
+	}{
+		{"Show.S01E02.mkv", false, domain.EpisodeNumbers{Season: 1, Episodes: []int{2}}, true},
+		{"Show.S01E02E03.mkv", false, domain.EpisodeNumbers{Season: 1, Episodes: []int{2, 3}}, true},
+		{"Show - S02E01-E03.mkv", false, domain.EpisodeNumbers{Season: 2, Episodes: []int{1, 2, 3}}, true},
+		{"Show - S02E05-06.mkv", false, domain.EpisodeNumbers{Season: 2, Episodes: []int{5, 6}}, true},
+		{"Show.S00E04.mkv", false, domain.EpisodeNumbers{Season: 0, Episodes: []int{4}}, true},
+		{"Show.S01E02-deleted.mkv", false, domain.EpisodeNumbers{Season: 1, Episodes: []int{2}}, true},
+		{"[SubsPlease] Frieren - 12 (1080p) [ABCD1234].mkv", false, domain.EpisodeNumbers{}, false},
+		{"[SubsPlease] Frieren - 12 (1080p) [ABCD1234].mkv", true, domain.EpisodeNumbers{Absolute: []int{12}}, true},
+		{"[Group] One Piece - 1071v2 [1080p].mkv", true, domain.EpisodeNumbers{Absolute: []int{1071}}, true},
+		{"[Group] Show - 12-13 [720p].mkv", true, domain.EpisodeNumbers{Absolute: []int{12, 13}}, true},
+		{"Show Ep 07.mkv", true, domain.EpisodeNumbers{Absolute: []int{7}}, true},
+		{"[Group] Show - OVA2 [1080p].mkv", true, domain.EpisodeNumbers{Episodes: []int{2}}, true},
+		{"[Group] Show - SP01.mkv", true, domain.EpisodeNumbers{Episodes: []int{1}}, true},
+		{"[Group] Spy x Family - 05 [1080p].mkv", true, domain.EpisodeNumbers{Absolute: []int{5}}, true},
+		{"[Group] Show (2019) [1080p].mkv", true, domain.EpisodeNumbers{}, false},
+		{"Show.S01E02.Part.2.mkv", false, domain.EpisodeNumbers{Season: 1, Episodes: []int{2}, Part: 2}, true},
+		{"Show - S01E02 - pt1.mkv", false, domain.EpisodeNumbers{Season: 1, Episodes: []int{2}, Part: 1}, true},
+		{"Show S01E02 CD2.avi", false, domain.EpisodeNumbers{Season: 1, Episodes: []int{2}, Part: 2}, true},
+		{"Part 2 of Show - S01E02.mkv", false, domain.EpisodeNumbers{Season: 1, Episodes: []int{2}}, true},
+		{"[Group] Show - 12 Part 2 [1080p].mkv", true, domain.EpisodeNumbers{Absolute: []int{12}, Part: 2}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := domain.ParseEpisodeNumbers(tt.name, tt.anime)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	special, _ := domain.ParseEpisodeNumbers("[Group] Show - OVA2.mkv", true)
+	assert.True(t, special.Special())
+	regular, _ := domain.ParseEpisodeNumbers("Show.S01E02.mkv", true)
+	assert.False(t, regular.Special())
+}
+
+func TestEpisodeMap(t *testing.T) {
+	episodes := []*models.Episode{
+		{SeasonNumber: 2, EpisodeNumber: 1},
+		{SeasonNumber: 1, EpisodeNumber: 1},
+		{SeasonNumber: 0, EpisodeNumber: 1},
+		{SeasonNumber: 1, EpisodeNumber: 2},
+		{SeasonNumber: 3, EpisodeNumber: 1, AbsoluteNumber: 10},
+		{SeasonNumber: 3, EpisodeNumber: 2},
+	}
+	m := domain.NewEpisodeMap(episodes)
+
+	// Absolute numbers count regular episodes on from the last known one
+	assert.Equal(t, 1, m.Absolute(1, 1))
+	assert.Equal(t, 2, m.Absolute(1, 2))
+	assert.Equal(t, 3, m.Absolute(2, 1))
+	assert.Equal(t, 10, m.Absolute(3, 1))
+	assert.Equal(t, 11, m.Absolute(3, 2))
+	assert.Zero(t, m.Absolute(0, 1), "specials have no absolute number")
+
+	ep, ok := m.Episode(3)
+	assert.True(t, ok)
+	assert.Same(t, episodes[0], ep)
+	_, ok = m.Episode(4)
+	assert.False(t, ok)
+
+	assert.Equal(t, []*models.Episode{episodes[3], episodes[0]}, m.Resolve(domain.EpisodeNumbers{Absolute: []int{2, 3}}))
+	assert.Equal(t, []*models.Episode{episodes[2]}, m.Resolve(domain.EpisodeNumbers{Episodes: []int{1}}))
+}
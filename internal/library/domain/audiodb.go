@@ -0,0 +1,210 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// TheAudioDBProviderName is the name of the TheAudioDB metadata provider.
+const TheAudioDBProviderName = "theaudiodb"
+
+// audioDBMinTitleSimilarity is how similar the track title of a video and a
+// searched title must be for the video to match.
+const audioDBMinTitleSimilarity = 0.75
+
+// TheAudioDBProvider fetches music video metadata from TheAudioDB, which
+// lists the videos of an artist rather than searching them. It only covers
+// music videos, and identifies them by their track IDs.
+type TheAudioDBProvider struct {
+	url    string
+	client *http.Client
+}
+
+var (
+	_ MetadataProvider   = (*TheAudioDBProvider)(nil)
+	_ MusicVideoProvider = (*TheAudioDBProvider)(nil)
+)
+
+// NewTheAudioDBProvider creates a provider for TheAudioDB API with an API
+// key, at a URL such as "https://www.theaudiodb.com/api/v1/json".
+func NewTheAudioDBProvider(url, apiKey string, client *http.Client) *TheAudioDBProvider {
+	return &TheAudioDBProvider{
+		url:    strings.TrimSuffix(url, "/") + "/" + apiKey,
+		client: client,
+	}
+}
+
+// GetName returns the provider name.
+func (p *TheAudioDBProvider) GetName() string {
+	return TheAudioDBProviderName
+}
+
+// GetType returns "music_video": the provider covers music videos only.
+func (p *TheAudioDBProvider) GetType() string {
+	return MetadataProviderTypeMusicVideo
+}
+
+// SearchMovie returns no results: TheAudioDB has no movies.
+func (p *TheAudioDBProvider) SearchMovie(
+	context.Context,
+	string,
+	int,
+	MetadataPreferences,
+) ([]models.SearchResult, error) {
+	return nil, nil
+}
+
+// SearchTV returns no results: TheAudioDB has no series.
+func (p *TheAudioDBProvider) SearchTV(
+	context.Context,
+	string,
+	int,
+	MetadataPreferences,
+) ([]models.SearchResult, error) {
+	return nil, nil
+}
+
+// GetMovieDetails returns no metadata: TheAudioDB has no movies.
+func (p *TheAudioDBProvider) GetMovieDetails(context.Context, string, MetadataPreferences) (*models.Metadata, error) {
+	return nil, nil
+}
+
+// GetTVDetails returns no metadata: TheAudioDB has no series.
+func (p *TheAudioDBProvider) GetTVDetails(context.Context, string, MetadataPreferences) (*models.Metadata, error) {
+	return nil, nil
+}
+
+// GetEpisodeDetails returns no metadata: TheAudioDB has no series.
+func (p *TheAudioDBProvider) GetEpisodeDetails(
+	context.Context,
+	string,
+	int, int,
+	MetadataPreferences,
+) (*models.EpisodeMetadata, error) {
+	return nil, nil
+}
+
+type audioDBTrack struct {
+	ID          string `json:"idTrack"`
+	Track       string `json:"strTrack"`
+	Artist      string `json:"strArtist"`
+	Genre       string `json:"strGenre"`
+	Thumb       string `json:"strTrackThumb"`
+	MusicVid    string `json:"strMusicVid"`
+	Description string `json:"strDescriptionEN"`
+}
+
+// SearchMusicVideo looks the artist up and returns those of their videos
+// whose track title resembles the title, or all of them without a title.
+func (p *TheAudioDBProvider) SearchMusicVideo(
+	ctx context.Context,
+	artist, title string,
+	_ MetadataPreferences,
+) ([]models.SearchResult, error) {
+	if artist == "" {
+		return nil, nil
+	}
+
+	var artists struct {
+		Artists []struct {
+			ID     string `json:"idArtist"`
+			Artist string `json:"strArtist"`
+		} `json:"artists"`
+	}
+	if err := p.get(ctx, "/search.php?s="+url.QueryEscape(artist), &artists); err != nil {
+		return nil, err
+	}
+	if len(artists.Artists) == 0 {
+		return nil, nil
+	}
+
+	var videos struct {
+		Videos []audioDBTrack `json:"mvids"`
+	}
+	if err := p.get(ctx, "/mvid.php?i="+url.QueryEscape(artists.Artists[0].ID), &videos); err != nil {
+		return nil, err
+	}
+
+	var results []models.SearchResult
+	for _, video := range videos.Videos {
+		if title != "" && titleSimilarity(video.Track, title) < audioDBMinTitleSimilarity {
+			continue
+		}
+		results = append(results, models.SearchResult{
+			ProviderID:   video.ID,
+			ProviderName: TheAudioDBProviderName,
+			Title:        video.Track,
+			Type:         string(models.MediaTypeMusicVideo),
+			PosterURL:    video.Thumb,
+			Overview:     video.Description,
+		})
+	}
+	return results, nil
+}
+
+// GetMusicVideoDetails returns the metadata of the video of a track, or nil
+// if TheAudioDB does not know it.
+func (p *TheAudioDBProvider) GetMusicVideoDetails(
+	ctx context.Context,
+	providerID string,
+	_ MetadataPreferences,
+) (*models.Metadata, error) {
+	if _, err := strconv.Atoi(providerID); err != nil {
+		return nil, fmt.Errorf("invalid TheAudioDB ID %q", providerID)
+	}
+
+	var data struct {
+		Tracks []audioDBTrack `json:"track"`
+	}
+	if err := p.get(ctx, "/track.php?h="+providerID, &data); err != nil {
+		return nil, err
+	}
+	if len(data.Tracks) == 0 {
+		return nil, nil
+	}
+
+	track := data.Tracks[0]
+	metadata := &models.Metadata{
+		AudioDBID:   track.ID,
+		Title:       track.Track,
+		Artist:      track.Artist,
+		Description: track.Description,
+		PosterURL:   track.Thumb,
+		TrailerURL:  track.MusicVid,
+	}
+	if track.Genre != "" {
+		metadata.Genres = []string{track.Genre}
+	}
+	return metadata, nil
+}
+
+// get requests a path of the API and decodes the response into out.
+// TheAudioDB answers unknown IDs with null lists.
+func (p *TheAudioDBProvider) get(ctx context.Context, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create TheAudioDB request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to query TheAudioDB: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("TheAudioDB query failed: unexpected status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode TheAudioDB response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package domain_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+)
+
+func TestTheAudioDBProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/key/search.php" && r.URL.Query().Get("s") == "Coldplay":
+			_, _ = w.Write([]byte(`{"artists":[{"idArtist":"111239","strArtist":"Coldplay"}]}`))
+		case r.URL.Path == "/key/search.php":
+			_, _ = w.Write([]byte(`{"artists":null}`))
+		case r.URL.Path == "/key/mvid.php" && r.URL.Query().Get("i") == "111239":
+			_, _ = w.Write([]byte(`{"mvids":[
+				{"idTrack":"32793500","strTrack":"Yellow","strTrackThumb":"https://audiodb.example/yellow.jpg"},
+				{"idTrack":"32793501","strTrack":"The Scientist"}]}`))
+		case r.URL.Path == "/key/track.php" && r.URL.Query().Get("h") == "32793500":
+			_, _ = w.Write([]byte(`{"track":[{"idTrack":"32793500","strTrack":"Yellow","strArtist":"Coldplay",
+				"strGenre":"Alternative Rock","strMusicVid":"https://www.youtube.com/watch?v=yKNxeF4KMsY"}]}`))
+		case r.URL.Path == "/key/track.php":
+			_, _ = w.Write([]byte(`{"track":null}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	provider := domain.NewTheAudioDBProvider(server.URL, "key", server.Client())
+	ctx := context.Background()
+	prefs := domain.MetadataPreferences{}
+
+	// Videos of the artist are matched by title
+	results, err := provider.SearchMusicVideo(ctx, "Coldplay", "yellow", prefs)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "32793500", results[0].ProviderID)
+
+	results, err = provider.SearchMusicVideo(ctx, "Coldplay", "", prefs)
+	require.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	results, err = provider.SearchMusicVideo(ctx, "Unknown", "Yellow", prefs)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	metadata, err := provider.GetMusicVideoDetails(ctx, "32793500", prefs)
+	require.NoError(t, err)
+	assert.Equal(t, "32793500", metadata.AudioDBID)
+	assert.Equal(t, "Coldplay", metadata.Artist)
+	assert.Equal(t, []string{"Alternative Rock"}, metadata.Genres)
+	assert.Equal(t, "https://www.youtube.com/watch?v=yKNxeF4KMsY", metadata.TrailerURL)
+
+	metadata, err = provider.GetMusicVideoDetails(ctx, "1", prefs)
+	require.NoError(t, err)
+	assert.Nil(t, metadata)
+}
@@ -0,0 +1,96 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BlocklistSource is how a release came to be blocklisted.
+type BlocklistSource string
+
+const (
+	// BlocklistSourceManual is a release an admin blocklisted, such as a
+	// fake.
+	BlocklistSourceManual BlocklistSource = "manual"
+	// BlocklistSourceImportFailed is a release whose download failed to
+	// import.
+	BlocklistSourceImportFailed BlocklistSource = "import_failed"
+	// BlocklistSourceMalware is a release whose download was flagged as
+	// malware.
+	BlocklistSourceMalware BlocklistSource = "malware"
+)
+
+// ReleaseIdentity identifies a release across grabs: by info hash, by the
+// GUID an indexer gave it, or by its title on an indexer.
+type ReleaseIdentity struct {
+	InfoHash string // lower case
+	GUID     string
+	Title    string
+	Indexer  string
+}
+
+// Validate checks that the identity can match a release.
+func (r ReleaseIdentity) Validate() error {
+	if r.InfoHash == "" && r.GUID == "" && (r.Title == "" || r.Indexer == "") {
+		return errors.New("an info hash, a guid, or a title and indexer are required")
+	}
+	return nil
+}
+
+// BlocklistEntry is a release that is never grabbed again.
+type BlocklistEntry struct {
+	ID uuid.UUID
+	ReleaseIdentity
+	// MediaID is the movie or series the release was grabbed for, if known.
+	MediaID   *uuid.UUID
+	Source    BlocklistSource
+	Reason    string
+	CreatedAt time.Time
+}
+
+// Matches reports whether the entry blocks a release. Titles only match on
+// the same indexer, as indexers title releases differently.
+func (e *BlocklistEntry) Matches(release ReleaseIdentity) bool {
+	switch {
+	case e.InfoHash != "" && e.InfoHash == release.InfoHash:
+		return true
+	case e.GUID != "" && e.GUID == release.GUID:
+		return true
+	default:
+		return e.Title != "" && e.Indexer != "" &&
+			strings.EqualFold(e.Title, release.Title) && strings.EqualFold(e.Indexer, release.Indexer)
+	}
+}
+
+// MatchBlocklist returns the first entry blocking a release, or nil.
+func MatchBlocklist(entries []*BlocklistEntry, release ReleaseIdentity) *BlocklistEntry {
+	for _, entry := range entries {
+		if entry.Matches(release) {
+			return entry
+		}
+	}
+	return nil
+}
+
+// Identity returns the identity of a feed item listed by an indexer.
+func (i *FeedItem) Identity(indexer string) ReleaseIdentity {
+	return ReleaseIdentity{
+		InfoHash: i.InfoHash,
+		GUID:     i.GUID,
+		Title:    i.Title,
+		Indexer:  indexer,
+	}
+}
+
+// Identity returns the identity of a release found by an indexer search.
+func (r *Release) Identity() ReleaseIdentity {
+	return ReleaseIdentity{
+		InfoHash: magnetInfoHash(r.DownloadURL),
+		GUID:     r.ID,
+		Title:    r.Title,
+		Indexer:  r.Indexer,
+	}
+}
@@ -0,0 +1,38 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+)
+
+func TestBlocklistEntryMatches(t *testing.T) {
+	hash := &domain.BlocklistEntry{ReleaseIdentity: domain.ReleaseIdentity{InfoHash: "abc"}}
+	guid := &domain.BlocklistEntry{ReleaseIdentity: domain.ReleaseIdentity{GUID: "guid-1"}}
+	title := &domain.BlocklistEntry{ReleaseIdentity: domain.ReleaseIdentity{Title: "Show.S01E01.1080p", Indexer: "torznab"}}
+
+	assert.True(t, hash.Matches(domain.ReleaseIdentity{InfoHash: "abc", Title: "Renamed"}))
+	assert.True(t, guid.Matches(domain.ReleaseIdentity{GUID: "guid-1"}))
+	assert.True(t, title.Matches(domain.ReleaseIdentity{Title: "show.s01e01.1080p", Indexer: "Torznab"}))
+	assert.False(t, title.Matches(domain.ReleaseIdentity{Title: "Show.S01E01.1080p", Indexer: "other"}), "other indexer")
+	assert.False(t, hash.Matches(domain.ReleaseIdentity{}), "empty identity")
+
+	release := &domain.Release{
+		Indexer:     "torznab",
+		Title:       "Other",
+		DownloadURL: "magnet:?xt=urn:btih:0123456789ABCDEF0123456789abcdef01234567",
+	}
+	entries := []*domain.BlocklistEntry{guid, {ReleaseIdentity: domain.ReleaseIdentity{
+		InfoHash: "0123456789abcdef0123456789abcdef01234567",
+	}}}
+	assert.Equal(t, entries[1], domain.MatchBlocklist(entries, release.Identity()))
+	assert.Nil(t, domain.MatchBlocklist(entries[:1], release.Identity()))
+}
+
+func TestReleaseIdentityValidate(t *testing.T) {
+	assert.NoError(t, domain.ReleaseIdentity{InfoHash: "abc"}.Validate())
+	assert.NoError(t, domain.ReleaseIdentity{Title: "Show", Indexer: "torznab"}.Validate())
+	assert.Error(t, domain.ReleaseIdentity{Title: "Show"}.Validate(), "title without indexer")
+}
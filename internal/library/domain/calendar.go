@@ -0,0 +1,209 @@
+package domain
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CalendarEntryType is the kind of date a calendar entry marks.
+type CalendarEntryType string
+
+const (
+	// CalendarEntryEpisode is the air date of an episode.
+	CalendarEntryEpisode CalendarEntryType = "episode"
+	// CalendarEntryCinemaRelease is the theatrical release of a movie.
+	CalendarEntryCinemaRelease CalendarEntryType = "cinema_release"
+	// CalendarEntryDigitalRelease is the digital release of a movie.
+	CalendarEntryDigitalRelease CalendarEntryType = "digital_release"
+	// CalendarEntryPhysicalRelease is the disc release of a movie.
+	CalendarEntryPhysicalRelease CalendarEntryType = "physical_release"
+)
+
+const (
+	// DefaultCalendarRange is the range a calendar covers when no end is
+	// given.
+	DefaultCalendarRange = 7 * 24 * time.Hour
+	// MaxCalendarRange bounds the range of one calendar request.
+	MaxCalendarRange = 366 * 24 * time.Hour
+)
+
+// CalendarEntry is an episode air date or a movie release date of monitored
+// media. Dates are days; providers do not know air times.
+type CalendarEntry struct {
+	Type      CalendarEntryType
+	MediaID   uuid.UUID
+	LibraryID uuid.UUID
+	// Title is the title of the series or movie.
+	Title string
+	// EpisodeID, SeasonNumber, EpisodeNumber and EpisodeTitle are set for
+	// episodes only.
+	EpisodeID     *uuid.UUID
+	SeasonNumber  int
+	EpisodeNumber int
+	EpisodeTitle  string
+	Date          time.Time
+	// Available reports whether the episode or movie is in the library.
+	Available bool
+}
+
+// Summary is the one-line description of the entry shown by calendar apps.
+func (e *CalendarEntry) Summary() string {
+	switch e.Type {
+	case CalendarEntryEpisode:
+		summary := fmt.Sprintf("%s - S%02dE%02d", e.Title, e.SeasonNumber, e.EpisodeNumber)
+		if e.EpisodeTitle != "" {
+			summary += " - " + e.EpisodeTitle
+		}
+		return summary
+	case CalendarEntryCinemaRelease:
+		return e.Title + " (In Cinemas)"
+	case CalendarEntryDigitalRelease:
+		return e.Title + " (Digital Release)"
+	case CalendarEntryPhysicalRelease:
+		return e.Title + " (Physical Release)"
+	default:
+		return e.Title
+	}
+}
+
+// uid identifies the entry across exports, so calendar apps update events
+// instead of duplicating them.
+func (e *CalendarEntry) uid() string {
+	id := e.MediaID
+	if e.EpisodeID != nil {
+		id = *e.EpisodeID
+	}
+	return fmt.Sprintf("%s-%s@narwhal", e.Type, id)
+}
+
+// WriteICal writes entries as an iCalendar (RFC 5545) document of all-day
+// events.
+func WriteICal(w io.Writer, name string, entries []*CalendarEntry, now time.Time) error {
+	bw := bufio.NewWriter(w)
+	line := func(s string) {
+		writeICalLine(bw, s)
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//Narwhal//Calendar//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:" + escapeICalText(name))
+
+	stamp := now.UTC().Format("20060102T150405Z")
+	for _, e := range entries {
+		day := e.Date.UTC()
+		line("BEGIN:VEVENT")
+		line("UID:" + e.uid())
+		line("DTSTAMP:" + stamp)
+		line("DTSTART;VALUE=DATE:" + day.Format("20060102"))
+		line("DTEND;VALUE=DATE:" + day.AddDate(0, 0, 1).Format("20060102"))
+		line("SUMMARY:" + escapeICalText(e.Summary()))
+		line("CATEGORIES:" + escapeICalText(string(e.Type)))
+		if e.Available {
+			line("STATUS:CONFIRMED")
+		} else {
+			line("STATUS:TENTATIVE")
+		}
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+
+	return bw.Flush()
+}
+
+// writeICalLine writes a content line, folded after 75 octets as RFC 5545
+// requires. Folds never split a UTF-8 sequence.
+func writeICalLine(w *bufio.Writer, s string) {
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(s[cut]) {
+			cut--
+		}
+		_, _ = w.WriteString(s[:cut])
+		_, _ = w.WriteString("\r\n ")
+		s = s[cut:]
+		// Continuation lines start with the folding space
+		limit = 74
+	}
+	_, _ = w.WriteString(s)
+	_, _ = w.WriteString("\r\n")
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+var icalTextEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+)
+
+func escapeICalText(s string) string {
+	return icalTextEscaper.Replace(s)
+}
+
+// CalendarFeedKey is the key the feed tokens of a user are derived from.
+// Replacing it revokes every feed token issued to the user before.
+type CalendarFeedKey struct {
+	UserID    uuid.UUID
+	TenantID  uuid.UUID
+	Key       string
+	CreatedAt time.Time
+}
+
+// CalendarFeedToken returns the token a user subscribes to the iCalendar
+// export with, derived from the feed key of the user. Calendar apps cannot
+// refresh access tokens, so feed tokens do not expire; they grant reading
+// the calendar only, and are revoked by replacing the key.
+func CalendarFeedToken(secret []byte, userID, key string) string {
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(userID))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(calendarFeedMAC(secret, userID, key))
+}
+
+// CalendarFeedTokenUser returns the user a feed token claims to be issued
+// to. The token is only valid if VerifyCalendarFeedToken accepts it with
+// the feed key of that user.
+func CalendarFeedTokenUser(token string) (string, bool) {
+	encoded, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", false
+	}
+	userID, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(userID) == 0 {
+		return "", false
+	}
+	return string(userID), true
+}
+
+// VerifyCalendarFeedToken reports whether a feed token was issued with the
+// feed key of the user it claims to be issued to.
+func VerifyCalendarFeedToken(secret []byte, token, key string) bool {
+	userID, ok := CalendarFeedTokenUser(token)
+	if !ok {
+		return false
+	}
+	_, mac, _ := strings.Cut(token, ".")
+	sum, err := base64.RawURLEncoding.DecodeString(mac)
+	return err == nil && hmac.Equal(sum, calendarFeedMAC(secret, userID, key))
+}
+
+func calendarFeedMAC(secret []byte, userID, key string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte("calendar-feed:" + userID + ":" + key))
+	return h.Sum(nil)
+}
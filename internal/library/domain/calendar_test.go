@@ -0,0 +1,76 @@
+package domain_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+)
+
+func TestWriteICal(t *testing.T) {
+	episodeID := uuid.New()
+	entries := []*domain.CalendarEntry{
+		{
+			Type:          domain.CalendarEntryEpisode,
+			MediaID:       uuid.New(),
+			EpisodeID:     &episodeID,
+			Title:         "Show",
+			SeasonNumber:  1,
+			EpisodeNumber: 2,
+			EpisodeTitle:  "Pilot, Part 2; The Return",
+			Date:          time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			Type:      domain.CalendarEntryDigitalRelease,
+			MediaID:   uuid.New(),
+			Title:     strings.Repeat("Long Movie Title ", 6),
+			Date:      time.Date(2024, 4, 2, 0, 0, 0, 0, time.UTC),
+			Available: true,
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, domain.WriteICal(&buf, "Narwhal", entries, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)))
+	ical := buf.String()
+
+	assert.True(t, strings.HasPrefix(ical, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"))
+	assert.True(t, strings.HasSuffix(ical, "END:VCALENDAR\r\n"))
+	assert.Equal(t, 2, strings.Count(ical, "BEGIN:VEVENT"))
+	assert.Contains(t, ical, "UID:episode-"+episodeID.String()+"@narwhal\r\n")
+	assert.Contains(t, ical, "DTSTART;VALUE=DATE:20240331\r\nDTEND;VALUE=DATE:20240401\r\n")
+	assert.Contains(t, ical, `SUMMARY:Show - S01E02 - Pilot\, Part 2\; The Return`)
+	assert.Contains(t, ical, "STATUS:TENTATIVE")
+	assert.Contains(t, ical, "STATUS:CONFIRMED")
+
+	for _, line := range strings.Split(strings.TrimSuffix(ical, "\r\n"), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75, "line %q is not folded", line)
+	}
+	unfolded := strings.ReplaceAll(ical, "\r\n ", "")
+	assert.Contains(t, unfolded, "SUMMARY:"+strings.Repeat("Long Movie Title ", 6)+" (Digital Release)")
+}
+
+func TestCalendarFeedToken(t *testing.T) {
+	secret := []byte("secret")
+	token := domain.CalendarFeedToken(secret, "user-1", "key-1")
+
+	userID, ok := domain.CalendarFeedTokenUser(token)
+	assert.True(t, ok)
+	assert.Equal(t, "user-1", userID)
+	assert.True(t, domain.VerifyCalendarFeedToken(secret, token, "key-1"))
+
+	assert.False(t, domain.VerifyCalendarFeedToken([]byte("other"), token, "key-1"), "tokens are bound to the secret")
+	assert.False(t, domain.VerifyCalendarFeedToken(secret, token, "key-2"), "replacing the key revokes tokens")
+
+	forged := domain.CalendarFeedToken([]byte("other"), "user-2", "key-1")
+	assert.False(t, domain.VerifyCalendarFeedToken(secret, forged, "key-1"))
+
+	_, ok = domain.CalendarFeedTokenUser("garbage")
+	assert.False(t, ok)
+	assert.False(t, domain.VerifyCalendarFeedToken(secret, "garbage", "key-1"))
+}
@@ -0,0 +1,323 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// ContentRequestStatus is where a content request is in its review.
+type ContentRequestStatus string
+
+const (
+	// ContentRequestPending waits for an admin to approve or deny it.
+	ContentRequestPending ContentRequestStatus = "pending"
+	// ContentRequestApproved was approved and added to a library as wanted
+	// media, which acquisition looks for.
+	ContentRequestApproved ContentRequestStatus = "approved"
+	// ContentRequestDenied was turned down.
+	ContentRequestDenied ContentRequestStatus = "denied"
+	// ContentRequestAvailable was acquired and can be watched.
+	ContentRequestAvailable ContentRequestStatus = "available"
+)
+
+// ContentRequest is a user asking for a movie or series that is not in the
+// libraries, identified by a metadata provider.
+type ContentRequest struct {
+	ID        uuid.UUID
+	TenantID  uuid.UUID
+	UserID    uuid.UUID
+	MediaType models.MediaType
+	// Provider and ProviderID identify the requested title at a metadata
+	// provider.
+	Provider   string
+	ProviderID string
+	Title      string
+	Year       int
+	Overview   string
+	PosterURL  string
+	// Seasons are the season numbers requested of a series; empty requests
+	// the whole series.
+	Seasons []int
+	// Quality is the quality the requester wants, one of the feed
+	// qualities; empty leaves it to the library.
+	Quality string
+	Status  ContentRequestStatus
+	// LibraryID and MediaID are the library the approved request was added
+	// to and its media item there.
+	LibraryID *uuid.UUID
+	MediaID   *uuid.UUID
+	// DecidedBy is the admin who decided on the request; nil for requests
+	// approved automatically.
+	DecidedBy    *uuid.UUID
+	AutoApproved bool
+	// Reason explains a denial to the requester.
+	Reason      string
+	CreatedAt   time.Time
+	DecidedAt   *time.Time
+	AvailableAt *time.Time
+}
+
+// Validate checks a new request.
+func (r *ContentRequest) Validate() error {
+	if r.MediaType != models.MediaTypeMovie && r.MediaType != models.MediaTypeSeries {
+		return fmt.Errorf("only movies and series can be requested, not %q", r.MediaType)
+	}
+	if r.Provider == "" || r.ProviderID == "" {
+		return errors.New("provider and provider ID are required")
+	}
+	if len(r.Seasons) > 0 && r.MediaType != models.MediaTypeSeries {
+		return errors.New("only series requests can name seasons")
+	}
+	seen := make(map[int]bool, len(r.Seasons))
+	for _, season := range r.Seasons {
+		if season < 0 || seen[season] {
+			return fmt.Errorf("invalid season %d", season)
+		}
+		seen[season] = true
+	}
+	if r.Quality != "" && QualityRank(r.Quality) == 0 {
+		return fmt.Errorf("unsupported quality %q", r.Quality)
+	}
+	return nil
+}
+
+// Approve records the approval of a pending request. decidedBy is nil for
+// automatic approvals.
+func (r *ContentRequest) Approve(decidedBy *uuid.UUID, libraryID, mediaID uuid.UUID, at time.Time) error {
+	if r.Status != ContentRequestPending {
+		return fmt.Errorf("request is %s, not pending", r.Status)
+	}
+	r.Status = ContentRequestApproved
+	r.DecidedBy = decidedBy
+	r.AutoApproved = decidedBy == nil
+	r.LibraryID = &libraryID
+	r.MediaID = &mediaID
+	r.DecidedAt = &at
+	return nil
+}
+
+// Deny records the denial of a pending request.
+func (r *ContentRequest) Deny(decidedBy uuid.UUID, reason string, at time.Time) error {
+	if r.Status != ContentRequestPending {
+		return fmt.Errorf("request is %s, not pending", r.Status)
+	}
+	r.Status = ContentRequestDenied
+	r.DecidedBy = &decidedBy
+	r.Reason = reason
+	r.DecidedAt = &at
+	return nil
+}
+
+// SeasonCount returns the number of seasons a series request counts as;
+// one for a whole series.
+func (r *ContentRequest) SeasonCount() int {
+	return max(len(r.Seasons), 1)
+}
+
+// ContentRequestFilter narrows the requests listed.
+type ContentRequestFilter struct {
+	UserID *uuid.UUID
+	Status ContentRequestStatus
+}
+
+// RequestQuota limits how many movies and series seasons a user may
+// request within a quota period. A zero limit is unlimited.
+type RequestQuota struct {
+	Movies  int
+	Seasons int
+}
+
+// Unlimited reports whether the quota limits nothing.
+func (q RequestQuota) Unlimited() bool {
+	return q.Movies == 0 && q.Seasons == 0
+}
+
+// AutoApproveRule approves the requests of users with Role right away.
+// An empty MediaType matches movies and series; an empty MaxQuality
+// matches any quality.
+type AutoApproveRule struct {
+	Role       string
+	MediaType  models.MediaType
+	MaxQuality string
+}
+
+// Matches reports whether the rule approves a request of a user with the
+// given roles. Requests leaving the quality to the library match any
+// quality.
+func (r AutoApproveRule) Matches(roles []string, request *ContentRequest) bool {
+	if !slices.Contains(roles, r.Role) {
+		return false
+	}
+	if r.MediaType != "" && r.MediaType != request.MediaType {
+		return false
+	}
+	return r.MaxQuality == "" || QualityRank(request.Quality) <= QualityRank(r.MaxQuality)
+}
+
+// RequestPolicy holds the request quotas of each role within Period and
+// the rules approving requests automatically.
+type RequestPolicy struct {
+	Period      time.Duration
+	Quotas      map[string]RequestQuota
+	AutoApprove []AutoApproveRule
+}
+
+// QuotaFor returns the quota of a user with the given roles: the most
+// generous quota of their roles. Roles without a quota do not limit, so
+// users holding one are unlimited.
+func (p RequestPolicy) QuotaFor(roles []string) RequestQuota {
+	var quota RequestQuota
+	for i, role := range roles {
+		q, ok := p.Quotas[role]
+		if !ok || q.Unlimited() {
+			return RequestQuota{}
+		}
+		if i == 0 {
+			quota = q
+			continue
+		}
+		quota.Movies = moreGenerous(quota.Movies, q.Movies)
+		quota.Seasons = moreGenerous(quota.Seasons, q.Seasons)
+	}
+	return quota
+}
+
+// AutoApproves reports whether a rule approves a request of a user with
+// the given roles right away.
+func (p RequestPolicy) AutoApproves(roles []string, request *ContentRequest) bool {
+	for _, rule := range p.AutoApprove {
+		if rule.Matches(roles, request) {
+			return true
+		}
+	}
+	return false
+}
+
+// moreGenerous returns the more generous of two limits, zero being
+// unlimited.
+func moreGenerous(a, b int) int {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return max(a, b)
+}
+
+// RequestQuotaOverride replaces the role quota of a user, as set by an
+// admin.
+type RequestQuotaOverride struct {
+	TenantID  uuid.UUID
+	UserID    uuid.UUID
+	Quota     RequestQuota
+	SetBy     uuid.UUID
+	UpdatedAt time.Time
+}
+
+// RequestQuotaState is how much of their quota a user used within the
+// current period.
+type RequestQuotaState struct {
+	Quota  RequestQuota
+	Period time.Duration
+	// Overridden is set if an admin set the quota of the user.
+	Overridden bool
+	// Movies and Seasons are the movies and seasons the user requested
+	// within the period; denied requests do not count.
+	Movies  int
+	Seasons int
+	// ResetsAt is when the oldest counted request leaves the period, or
+	// nil if none counts.
+	ResetsAt *time.Time
+}
+
+// NewRequestQuotaState returns the state of a quota, given the requests
+// the user made within the period ending now.
+func NewRequestQuotaState(quota RequestQuota, period time.Duration, requests []*ContentRequest) *RequestQuotaState {
+	state := &RequestQuotaState{Quota: quota, Period: period}
+	for _, request := range requests {
+		if request.Status == ContentRequestDenied {
+			continue
+		}
+		if request.MediaType == models.MediaTypeSeries {
+			state.Seasons += request.SeasonCount()
+		} else {
+			state.Movies++
+		}
+		resets := request.CreatedAt.Add(period)
+		if state.ResetsAt == nil || resets.Before(*state.ResetsAt) {
+			state.ResetsAt = &resets
+		}
+	}
+	return state
+}
+
+// MoviesRemaining returns how many more movies the user may request, or
+// -1 if that is unlimited.
+func (s *RequestQuotaState) MoviesRemaining() int {
+	return remaining(s.Quota.Movies, s.Movies)
+}
+
+// SeasonsRemaining returns how many more seasons the user may request, or
+// -1 if that is unlimited.
+func (s *RequestQuotaState) SeasonsRemaining() int {
+	return remaining(s.Quota.Seasons, s.Seasons)
+}
+
+// Admits checks that a request fits in the quota. Requests for a whole
+// series cannot be counted against a season limit, so they must name
+// their seasons then.
+func (s *RequestQuotaState) Admits(request *ContentRequest) error {
+	if request.MediaType == models.MediaTypeSeries {
+		if s.Quota.Seasons == 0 {
+			return nil
+		}
+		if len(request.Seasons) == 0 {
+			return errors.New("name the seasons to request, as season requests are limited")
+		}
+		if left := s.SeasonsRemaining(); request.SeasonCount() > left {
+			return fmt.Errorf("season request quota exhausted: %d of %d seasons left", left, s.Quota.Seasons)
+		}
+		return nil
+	}
+	if s.Quota.Movies > 0 && s.MoviesRemaining() == 0 {
+		return fmt.Errorf("movie request quota of %d exhausted", s.Quota.Movies)
+	}
+	return nil
+}
+
+func remaining(limit, used int) int {
+	if limit == 0 {
+		return -1
+	}
+	return max(limit-used, 0)
+}
+
+// RequestableTitle is a title found at a metadata provider, with the
+// request for it, if any.
+type RequestableTitle struct {
+	models.SearchResult
+	Request *ContentRequest
+}
+
+// LibraryFor returns the library requests of a media type are added to:
+// the first enabled library of that type, or nil.
+func LibraryFor(libraries []*Library, mediaType models.MediaType) *Library {
+	for _, l := range libraries {
+		if !l.Enabled {
+			continue
+		}
+		switch l.Type {
+		case string(mediaType):
+			return l
+		case string(models.MediaTypeTV), "tv_show":
+			if mediaType == models.MediaTypeSeries {
+				return l
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+func TestContentRequestDecisions(t *testing.T) {
+	now := time.Now()
+	admin, library, media := uuid.New(), uuid.New(), uuid.New()
+
+	request := &domain.ContentRequest{Status: domain.ContentRequestPending}
+	require.NoError(t, request.Approve(nil, library, media, now))
+	assert.Equal(t, domain.ContentRequestApproved, request.Status)
+	assert.True(t, request.AutoApproved, "approvals without an admin are automatic")
+	assert.Equal(t, media, *request.MediaID)
+	assert.Error(t, request.Deny(admin, "too late", now), "only pending requests are decided")
+
+	request = &domain.ContentRequest{Status: domain.ContentRequestPending}
+	require.NoError(t, request.Deny(admin, "Not available in this region", now))
+	assert.Equal(t, domain.ContentRequestDenied, request.Status)
+	assert.Equal(t, admin, *request.DecidedBy)
+	assert.Error(t, request.Approve(&admin, library, media, now))
+}
+
+func TestRequestPolicyQuotaFor(t *testing.T) {
+	policy := domain.RequestPolicy{
+		Period: 7 * 24 * time.Hour,
+		Quotas: map[string]domain.RequestQuota{
+			"user":   {Movies: 3, Seasons: 2},
+			"family": {Movies: 5},
+			"friend": {Movies: 1, Seasons: 4},
+		},
+	}
+
+	assert.Equal(t, domain.RequestQuota{Movies: 3, Seasons: 2}, policy.QuotaFor([]string{"user"}))
+	assert.Equal(t, domain.RequestQuota{Movies: 3, Seasons: 4}, policy.QuotaFor([]string{"user", "friend"}),
+		"the most generous limit of each kind applies")
+	assert.Equal(t, domain.RequestQuota{Movies: 5}, policy.QuotaFor([]string{"user", "family"}),
+		"a zero limit is unlimited")
+	assert.True(t, policy.QuotaFor([]string{"user", "admin"}).Unlimited(), "roles without a quota do not limit")
+}
+
+func TestRequestPolicyAutoApproves(t *testing.T) {
+	policy := domain.RequestPolicy{AutoApprove: []domain.AutoApproveRule{
+		{Role: "family", MaxQuality: domain.FeedQuality1080p},
+		{Role: "user", MediaType: models.MediaTypeSeries},
+	}}
+	movie := &domain.ContentRequest{MediaType: models.MediaTypeMovie, Quality: domain.FeedQuality1080p}
+	uhd := &domain.ContentRequest{MediaType: models.MediaTypeMovie, Quality: domain.FeedQuality2160p}
+	series := &domain.ContentRequest{MediaType: models.MediaTypeSeries}
+
+	assert.True(t, policy.AutoApproves([]string{"family"}, movie))
+	assert.False(t, policy.AutoApproves([]string{"family"}, uhd), "qualities above the rule wait for an admin")
+	assert.False(t, policy.AutoApproves([]string{"user"}, movie))
+	assert.True(t, policy.AutoApproves([]string{"user"}, series))
+}
+
+func TestRequestQuotaState(t *testing.T) {
+	now := time.Now()
+	requests := []*domain.ContentRequest{
+		{MediaType: models.MediaTypeMovie, Status: domain.ContentRequestApproved, CreatedAt: now.Add(-2 * time.Hour)},
+		{MediaType: models.MediaTypeMovie, Status: domain.ContentRequestDenied, CreatedAt: now.Add(-3 * time.Hour)},
+		{MediaType: models.MediaTypeSeries, Seasons: []int{1, 2}, Status: domain.ContentRequestPending, CreatedAt: now},
+	}
+
+	state := domain.NewRequestQuotaState(domain.RequestQuota{Movies: 1, Seasons: 3}, 24*time.Hour, requests)
+
+	assert.Equal(t, 1, state.Movies, "denied requests do not count")
+	assert.Equal(t, 2, state.Seasons)
+	assert.Equal(t, 0, state.MoviesRemaining())
+	assert.Equal(t, 1, state.SeasonsRemaining())
+	assert.Equal(t, now.Add(22*time.Hour), *state.ResetsAt)
+	assert.Error(t, state.Admits(&domain.ContentRequest{MediaType: models.MediaTypeMovie}))
+	assert.NoError(t, state.Admits(&domain.ContentRequest{MediaType: models.MediaTypeSeries, Seasons: []int{3}}))
+	assert.Error(t, state.Admits(&domain.ContentRequest{MediaType: models.MediaTypeSeries, Seasons: []int{3, 4}}))
+	assert.Error(t, state.Admits(&domain.ContentRequest{MediaType: models.MediaTypeSeries}),
+		"whole series cannot be counted against a season limit")
+
+	unlimited := domain.NewRequestQuotaState(domain.RequestQuota{}, 24*time.Hour, requests)
+	assert.Equal(t, -1, unlimited.MoviesRemaining())
+	assert.NoError(t, unlimited.Admits(&domain.ContentRequest{MediaType: models.MediaTypeSeries}))
+}
+
+func TestLibraryFor(t *testing.T) {
+	disabled := &domain.Library{Name: "Old movies", Type: "movie"}
+	movies := &domain.Library{Name: "Movies", Type: "movie", Enabled: true}
+	shows := &domain.Library{Name: "Shows", Type: "tv_show", Enabled: true}
+	libraries := []*domain.Library{disabled, movies, shows}
+
+	assert.Same(t, movies, domain.LibraryFor(libraries, models.MediaTypeMovie))
+	assert.Same(t, shows, domain.LibraryFor(libraries, models.MediaTypeSeries))
+	assert.Nil(t, domain.LibraryFor([]*domain.Library{disabled}, models.MediaTypeMovie))
+}
@@ -0,0 +1,67 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// MaxDigestItems bounds each section of a digest.
+const MaxDigestItems = 50
+
+// Digest is the library part of a user's email digest over a period: the
+// titles added to the libraries they can access, the upcoming episodes of
+// the series on their watchlist and their content requests that are
+// pending or changed.
+type Digest struct {
+	Added    []DigestTitle   `json:"added"`
+	Upcoming []DigestEpisode `json:"upcoming"`
+	Requests []DigestRequest `json:"requests"`
+}
+
+// DigestTitle is a title added within the digest period.
+type DigestTitle struct {
+	MediaID   uuid.UUID        `json:"media_id"`
+	Title     string           `json:"title"`
+	Year      int              `json:"year,omitempty"`
+	MediaType models.MediaType `json:"media_type"`
+}
+
+// DigestEpisode is an episode airing in the next digest period.
+type DigestEpisode struct {
+	MediaID       uuid.UUID `json:"media_id"`
+	Series        string    `json:"series"`
+	SeasonNumber  int       `json:"season_number"`
+	EpisodeNumber int       `json:"episode_number"`
+	Title         string    `json:"title,omitempty"`
+	AirDate       string    `json:"air_date"`
+}
+
+// DigestRequest is the status of a content request of the user.
+type DigestRequest struct {
+	RequestID uuid.UUID            `json:"request_id"`
+	Title     string               `json:"title"`
+	Year      int                  `json:"year,omitempty"`
+	Status    ContentRequestStatus `json:"status"`
+}
+
+// Empty reports whether the digest has nothing to tell.
+func (d *Digest) Empty() bool {
+	return len(d.Added) == 0 && len(d.Upcoming) == 0 && len(d.Requests) == 0
+}
+
+// InDigest reports whether a content request belongs in a digest of the
+// period starting at since: pending requests, and requests decided or
+// made available within the period.
+func (r *ContentRequest) InDigest(since time.Time) bool {
+	switch {
+	case r.Status == ContentRequestPending:
+		return true
+	case r.AvailableAt != nil && r.AvailableAt.After(since):
+		return true
+	default:
+		return r.DecidedAt != nil && r.DecidedAt.After(since)
+	}
+}
@@ -0,0 +1,23 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+)
+
+func TestContentRequestInDigest(t *testing.T) {
+	since := time.Now().Add(-7 * 24 * time.Hour)
+	before, after := since.Add(-time.Hour), since.Add(time.Hour)
+
+	assert.True(t, (&domain.ContentRequest{Status: domain.ContentRequestPending, DecidedAt: &before}).InDigest(since),
+		"pending requests are always listed")
+	assert.True(t, (&domain.ContentRequest{Status: domain.ContentRequestDenied, DecidedAt: &after}).InDigest(since))
+	assert.False(t, (&domain.ContentRequest{Status: domain.ContentRequestApproved, DecidedAt: &before}).InDigest(since))
+	assert.True(t, (&domain.ContentRequest{
+		Status: domain.ContentRequestAvailable, DecidedAt: &before, AvailableAt: &after,
+	}).InDigest(since))
+}
@@ -0,0 +1,140 @@
+package domain
+
+import (
+	"sort"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// WatchedFraction is how much of an episode must be watched for it to count
+// as watched.
+const WatchedFraction = 0.9
+
+// EpisodeProgress is the watch progress of one episode.
+type EpisodeProgress struct {
+	EpisodeID uuid.UUID
+	// Position and Duration are in seconds into the episode. Duration is 0
+	// if unknown.
+	Position  int
+	Duration  int
+	Completed bool
+}
+
+// AttributeProgress attributes a playback position to the episodes played.
+// Position is in seconds into what plays for an episode: the parts of a
+// split episode stitched together, or else its file.
+//
+// Files holding several episodes play them in episode order, each taking
+// its own duration if all of them have one, or else an even share of the
+// file. Episodes the position has passed are completed; episodes after the
+// one playing are not reported.
+func AttributeProgress(
+	episodes []*models.Episode,
+	files []*models.EpisodeFile,
+	episodeID uuid.UUID,
+	position int,
+) []EpisodeProgress {
+	byID := make(map[uuid.UUID]*models.Episode, len(episodes))
+	for _, ep := range episodes {
+		byID[ep.ID] = ep
+	}
+	episode, ok := byID[episodeID]
+	if !ok {
+		return nil
+	}
+
+	var own []*models.EpisodeFile
+	for _, file := range files {
+		if file.EpisodeID == episodeID {
+			own = append(own, file)
+		}
+	}
+
+	// Split episodes play their parts back to back
+	if len(own) != 1 {
+		duration := 0
+		for _, file := range own {
+			if file.Duration <= 0 {
+				duration = 0
+				break
+			}
+			duration += file.Duration
+		}
+		if duration == 0 {
+			duration = episode.Duration
+		}
+		return []EpisodeProgress{newEpisodeProgress(episodeID, position, duration)}
+	}
+
+	// Episodes sharing the file, in episode order
+	var shared []*models.Episode
+	for _, file := range files {
+		if file.Path != own[0].Path {
+			continue
+		}
+		if ep, ok := byID[file.EpisodeID]; ok {
+			shared = append(shared, ep)
+		}
+	}
+	if len(shared) < 2 {
+		duration := own[0].Duration
+		if duration <= 0 {
+			duration = episode.Duration
+		}
+		return []EpisodeProgress{newEpisodeProgress(episodeID, position, duration)}
+	}
+	sort.SliceStable(shared, func(i, j int) bool {
+		if shared[i].SeasonNumber != shared[j].SeasonNumber {
+			return shared[i].SeasonNumber < shared[j].SeasonNumber
+		}
+		return shared[i].EpisodeNumber < shared[j].EpisodeNumber
+	})
+
+	lengths := make([]int, len(shared))
+	for i, ep := range shared {
+		lengths[i] = ep.Duration
+		if ep.Duration <= 0 {
+			lengths = nil
+			break
+		}
+	}
+	if lengths == nil {
+		if own[0].Duration <= 0 {
+			// Nothing to split the file by
+			return []EpisodeProgress{newEpisodeProgress(episodeID, position, episode.Duration)}
+		}
+		lengths = make([]int, len(shared))
+		for i := range lengths {
+			lengths[i] = own[0].Duration / len(shared)
+		}
+	}
+
+	var progress []EpisodeProgress
+	offset := position
+	for i, ep := range shared {
+		if offset >= lengths[i] && i < len(shared)-1 {
+			progress = append(progress, EpisodeProgress{
+				EpisodeID: ep.ID,
+				Position:  lengths[i],
+				Duration:  lengths[i],
+				Completed: true,
+			})
+			offset -= lengths[i]
+			continue
+		}
+		progress = append(progress, newEpisodeProgress(ep.ID, min(offset, lengths[i]), lengths[i]))
+		break
+	}
+	return progress
+}
+
+func newEpisodeProgress(episodeID uuid.UUID, position, duration int) EpisodeProgress {
+	return EpisodeProgress{
+		EpisodeID: episodeID,
+		Position:  position,
+		Duration:  duration,
+		Completed: duration > 0 && float64(position) >= WatchedFraction*float64(duration),
+	}
+}
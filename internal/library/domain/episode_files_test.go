@@ -0,0 +1,83 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+func TestAttributeProgress(t *testing.T) {
+	ep1 := &models.Episode{ID: uuid.New(), SeasonNumber: 1, EpisodeNumber: 1, Duration: 1200}
+	ep2 := &models.Episode{ID: uuid.New(), SeasonNumber: 1, EpisodeNumber: 2, Duration: 1500}
+	ep3 := &models.Episode{ID: uuid.New(), SeasonNumber: 1, EpisodeNumber: 3, Duration: 1800}
+	episodes := []*models.Episode{ep3, ep2, ep1}
+
+	t.Run("multi-episode file", func(t *testing.T) {
+		files := []*models.EpisodeFile{
+			{EpisodeID: ep2.ID, Path: "/tv/Show - S01E01-E02.mkv"},
+			{EpisodeID: ep1.ID, Path: "/tv/Show - S01E01-E02.mkv"},
+		}
+
+		// Halfway into the second episode of the file
+		progress := domain.AttributeProgress(episodes, files, ep1.ID, 1200+750)
+		assert.Equal(t, []domain.EpisodeProgress{
+			{EpisodeID: ep1.ID, Position: 1200, Duration: 1200, Completed: true},
+			{EpisodeID: ep2.ID, Position: 750, Duration: 1500},
+		}, progress)
+
+		// Within the first episode, the second is not reported
+		progress = domain.AttributeProgress(episodes, files, ep2.ID, 1100)
+		assert.Equal(t, []domain.EpisodeProgress{
+			{EpisodeID: ep1.ID, Position: 1100, Duration: 1200, Completed: true},
+		}, progress)
+	})
+
+	t.Run("multi-episode file split evenly", func(t *testing.T) {
+		unknown := []*models.Episode{
+			{ID: ep1.ID, SeasonNumber: 1, EpisodeNumber: 1},
+			{ID: ep2.ID, SeasonNumber: 1, EpisodeNumber: 2},
+		}
+		files := []*models.EpisodeFile{
+			{EpisodeID: ep1.ID, Path: "/tv/a.mkv", Duration: 3000},
+			{EpisodeID: ep2.ID, Path: "/tv/a.mkv", Duration: 3000},
+		}
+
+		progress := domain.AttributeProgress(unknown, files, ep1.ID, 3000)
+		assert.Equal(t, []domain.EpisodeProgress{
+			{EpisodeID: ep1.ID, Position: 1500, Duration: 1500, Completed: true},
+			{EpisodeID: ep2.ID, Position: 1500, Duration: 1500, Completed: true},
+		}, progress)
+	})
+
+	t.Run("split episode", func(t *testing.T) {
+		files := []*models.EpisodeFile{
+			{EpisodeID: ep3.ID, Path: "/tv/Show - S01E03 - Part 1.mkv", Part: 1, Duration: 900},
+			{EpisodeID: ep3.ID, Path: "/tv/Show - S01E03 - Part 2.mkv", Part: 2, Duration: 1000},
+		}
+
+		progress := domain.AttributeProgress(episodes, files, ep3.ID, 1000)
+		assert.Equal(t, []domain.EpisodeProgress{
+			{EpisodeID: ep3.ID, Position: 1000, Duration: 1900},
+		}, progress)
+
+		progress = domain.AttributeProgress(episodes, files, ep3.ID, 1800)
+		assert.True(t, progress[0].Completed)
+	})
+
+	t.Run("single file", func(t *testing.T) {
+		files := []*models.EpisodeFile{{EpisodeID: ep1.ID, Path: "/tv/Show - S01E01.mkv"}}
+
+		progress := domain.AttributeProgress(episodes, files, ep1.ID, 600)
+		assert.Equal(t, []domain.EpisodeProgress{
+			{EpisodeID: ep1.ID, Position: 600, Duration: 1200},
+		}, progress)
+	})
+
+	t.Run("unknown episode", func(t *testing.T) {
+		assert.Empty(t, domain.AttributeProgress(episodes, nil, uuid.New(), 600))
+	})
+}
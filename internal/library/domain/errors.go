@@ -21,4 +21,7 @@ var (
 
 	// ErrInvalidMediaType is returned when an invalid media type is provided.
 	ErrInvalidMediaType = errors.New("invalid media type")
+
+	// ErrThemeNotFound is returned when no theme music is available for a series.
+	ErrThemeNotFound = errors.New("theme music not found")
 )
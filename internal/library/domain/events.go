@@ -17,7 +17,7 @@ type LibraryCreatedEvent struct {
 func NewLibraryCreatedEvent(library *Library) *LibraryCreatedEvent {
 	return &LibraryCreatedEvent{
 		Library:   library,
-		timestamp: time.Now().Unix(),
+		timestamp: time.Now().UnixNano(),
 	}
 }
 
@@ -33,6 +33,10 @@ func (e *LibraryCreatedEvent) AggregateID() string {
 	return e.Library.ID.String()
 }
 
+func (e *LibraryCreatedEvent) Payload() map[string]interface{} {
+	return libraryPayload(e.Library)
+}
+
 // LibraryUpdatedEvent is published when a library is updated.
 type LibraryUpdatedEvent struct {
 	Library   *Library
@@ -42,7 +46,7 @@ type LibraryUpdatedEvent struct {
 func NewLibraryUpdatedEvent(library *Library) *LibraryUpdatedEvent {
 	return &LibraryUpdatedEvent{
 		Library:   library,
-		timestamp: time.Now().Unix(),
+		timestamp: time.Now().UnixNano(),
 	}
 }
 
@@ -58,6 +62,10 @@ func (e *LibraryUpdatedEvent) AggregateID() string {
 	return e.Library.ID.String()
 }
 
+func (e *LibraryUpdatedEvent) Payload() map[string]interface{} {
+	return libraryPayload(e.Library)
+}
+
 // LibraryDeletedEvent is published when a library is deleted.
 type LibraryDeletedEvent struct {
 	LibraryID uuid.UUID
@@ -67,7 +75,7 @@ type LibraryDeletedEvent struct {
 func NewLibraryDeletedEvent(libraryID uuid.UUID) *LibraryDeletedEvent {
 	return &LibraryDeletedEvent{
 		LibraryID: libraryID,
-		timestamp: time.Now().Unix(),
+		timestamp: time.Now().UnixNano(),
 	}
 }
 
@@ -83,6 +91,12 @@ func (e *LibraryDeletedEvent) AggregateID() string {
 	return e.LibraryID.String()
 }
 
+func (e *LibraryDeletedEvent) Payload() map[string]interface{} {
+	return map[string]interface{}{
+		"library_id": e.LibraryID.String(),
+	}
+}
+
 // LibraryScanCompletedEvent is published when a library scan is completed.
 type LibraryScanCompletedEvent struct {
 	Library      *Library
@@ -96,7 +110,7 @@ func NewLibraryScanCompletedEvent(library *Library, newFiles, updatedFiles int)
 		Library:      library,
 		NewFiles:     newFiles,
 		UpdatedFiles: updatedFiles,
-		timestamp:    time.Now().Unix(),
+		timestamp:    time.Now().UnixNano(),
 	}
 }
 
@@ -112,6 +126,14 @@ func (e *LibraryScanCompletedEvent) AggregateID() string {
 	return e.Library.ID.String()
 }
 
+func (e *LibraryScanCompletedEvent) Payload() map[string]interface{} {
+	return map[string]interface{}{
+		"library_id":    e.Library.ID.String(),
+		"new_files":     e.NewFiles,
+		"updated_files": e.UpdatedFiles,
+	}
+}
+
 // MediaAddedEvent is published when a media item is added.
 type MediaAddedEvent struct {
 	Media     *models.Media
@@ -121,7 +143,7 @@ type MediaAddedEvent struct {
 func NewMediaAddedEvent(media *models.Media) *MediaAddedEvent {
 	return &MediaAddedEvent{
 		Media:     media,
-		timestamp: time.Now().Unix(),
+		timestamp: time.Now().UnixNano(),
 	}
 }
 
@@ -137,6 +159,10 @@ func (e *MediaAddedEvent) AggregateID() string {
 	return e.Media.ID.String()
 }
 
+func (e *MediaAddedEvent) Payload() map[string]interface{} {
+	return mediaPayload(e.Media)
+}
+
 // MediaUpdatedEvent is published when a media item is updated.
 type MediaUpdatedEvent struct {
 	Media     *models.Media
@@ -146,7 +172,7 @@ type MediaUpdatedEvent struct {
 func NewMediaUpdatedEvent(media *models.Media) *MediaUpdatedEvent {
 	return &MediaUpdatedEvent{
 		Media:     media,
-		timestamp: time.Now().Unix(),
+		timestamp: time.Now().UnixNano(),
 	}
 }
 
@@ -162,16 +188,22 @@ func (e *MediaUpdatedEvent) AggregateID() string {
 	return e.Media.ID.String()
 }
 
+func (e *MediaUpdatedEvent) Payload() map[string]interface{} {
+	return mediaPayload(e.Media)
+}
+
 // MediaDeletedEvent is published when a media item is deleted.
 type MediaDeletedEvent struct {
 	MediaID   string
+	LibraryID uuid.UUID
 	timestamp int64
 }
 
-func NewMediaDeletedEvent(mediaID string) *MediaDeletedEvent {
+func NewMediaDeletedEvent(mediaID string, libraryID uuid.UUID) *MediaDeletedEvent {
 	return &MediaDeletedEvent{
 		MediaID:   mediaID,
-		timestamp: time.Now().Unix(),
+		LibraryID: libraryID,
+		timestamp: time.Now().UnixNano(),
 	}
 }
 
@@ -186,3 +218,845 @@ func (e *MediaDeletedEvent) Timestamp() int64 {
 func (e *MediaDeletedEvent) AggregateID() string {
 	return e.MediaID
 }
+
+func (e *MediaDeletedEvent) Payload() map[string]interface{} {
+	return map[string]interface{}{
+		"media_id":   e.MediaID,
+		"library_id": e.LibraryID.String(),
+	}
+}
+
+// MediaFileReplacedEvent is published when the file of a media item is
+// replaced by another, and the old file moved to the recycle bin.
+type MediaFileReplacedEvent struct {
+	Media        *models.Media
+	PreviousPath string
+	RecycledPath string
+	timestamp    int64
+}
+
+func NewMediaFileReplacedEvent(media *models.Media, previousPath, recycledPath string) *MediaFileReplacedEvent {
+	return &MediaFileReplacedEvent{
+		Media:        media,
+		PreviousPath: previousPath,
+		RecycledPath: recycledPath,
+		timestamp:    time.Now().UnixNano(),
+	}
+}
+
+func (e *MediaFileReplacedEvent) EventType() string {
+	return "media.file_replaced"
+}
+
+func (e *MediaFileReplacedEvent) Timestamp() int64 {
+	return e.timestamp
+}
+
+func (e *MediaFileReplacedEvent) AggregateID() string {
+	return e.Media.ID.String()
+}
+
+func (e *MediaFileReplacedEvent) Payload() map[string]interface{} {
+	return map[string]interface{}{
+		"media_id":      e.Media.ID.String(),
+		"library_id":    e.Media.LibraryID.String(),
+		"path":          e.Media.Path,
+		"previous_path": e.PreviousPath,
+		"recycled_path": e.RecycledPath,
+	}
+}
+
+// PruneSuggestedEvent is published when the disk of a library is short of
+// free space and titles of it are suggested for deletion.
+type PruneSuggestedEvent struct {
+	LibraryID  uuid.UUID
+	Candidates int
+	Savings    int64
+	timestamp  int64
+}
+
+func NewPruneSuggestedEvent(libraryID uuid.UUID, candidates int, savings int64) *PruneSuggestedEvent {
+	return &PruneSuggestedEvent{
+		LibraryID:  libraryID,
+		Candidates: candidates,
+		Savings:    savings,
+		timestamp:  time.Now().UnixNano(),
+	}
+}
+
+func (e *PruneSuggestedEvent) EventType() string {
+	return "library.prune_suggested"
+}
+
+func (e *PruneSuggestedEvent) Timestamp() int64 {
+	return e.timestamp
+}
+
+func (e *PruneSuggestedEvent) AggregateID() string {
+	return e.LibraryID.String()
+}
+
+func (e *PruneSuggestedEvent) Payload() map[string]interface{} {
+	return map[string]interface{}{
+		"library_id":    e.LibraryID.String(),
+		"candidates":    e.Candidates,
+		"savings_bytes": e.Savings,
+	}
+}
+
+// LibraryImportedEvent is published when an export has been imported into a library.
+type LibraryImportedEvent struct {
+	LibraryID uuid.UUID
+	Created   int
+	Updated   int
+	Skipped   int
+	timestamp int64
+}
+
+func NewLibraryImportedEvent(libraryID uuid.UUID, result *ImportResult) *LibraryImportedEvent {
+	return &LibraryImportedEvent{
+		LibraryID: libraryID,
+		Created:   result.Created,
+		Updated:   result.Updated,
+		Skipped:   result.Skipped,
+		timestamp: time.Now().UnixNano(),
+	}
+}
+
+func (e *LibraryImportedEvent) EventType() string {
+	return "library.imported"
+}
+
+func (e *LibraryImportedEvent) Timestamp() int64 {
+	return e.timestamp
+}
+
+func (e *LibraryImportedEvent) AggregateID() string {
+	return e.LibraryID.String()
+}
+
+func (e *LibraryImportedEvent) Payload() map[string]interface{} {
+	return map[string]interface{}{
+		"library_id": e.LibraryID.String(),
+		"created":    e.Created,
+		"updated":    e.Updated,
+		"skipped":    e.Skipped,
+	}
+}
+
+// LibraryRelocatedEvent is published when the paths of a library and its
+// files have been rewritten to a new location.
+type LibraryRelocatedEvent struct {
+	LibraryID uuid.UUID
+	From      string
+	To        string
+	Files     int
+	timestamp int64
+}
+
+func NewLibraryRelocatedEvent(relocation *Relocation, files int) *LibraryRelocatedEvent {
+	return &LibraryRelocatedEvent{
+		LibraryID: relocation.LibraryID,
+		From:      relocation.From,
+		To:        relocation.To,
+		Files:     files,
+		timestamp: time.Now().UnixNano(),
+	}
+}
+
+func (e *LibraryRelocatedEvent) EventType() string {
+	return "library.relocated"
+}
+
+func (e *LibraryRelocatedEvent) Timestamp() int64 {
+	return e.timestamp
+}
+
+func (e *LibraryRelocatedEvent) AggregateID() string {
+	return e.LibraryID.String()
+}
+
+func (e *LibraryRelocatedEvent) Payload() map[string]interface{} {
+	return map[string]interface{}{
+		"library_id": e.LibraryID.String(),
+		"from":       e.From,
+		"to":         e.To,
+		"files":      e.Files,
+	}
+}
+
+func libraryPayload(library *Library) map[string]interface{} {
+	return map[string]interface{}{
+		"library_id": library.ID.String(),
+		"tenant_id":  library.TenantID.String(),
+		"name":       library.Name,
+		"path":       library.Path,
+		"media_type": library.Type,
+		"enabled":    library.Enabled,
+	}
+}
+
+func mediaPayload(media *models.Media) map[string]interface{} {
+	return map[string]interface{}{
+		"media_id":   media.ID.String(),
+		"library_id": media.LibraryID.String(),
+		"tenant_id":  media.TenantID.String(),
+		"title":      media.Title,
+		"media_type": string(media.Type),
+		"path":       media.Path,
+	}
+}
+
+// TranscodeRequestedEvent is published for each transcode a policy asks for.
+// The transcode service creates a job for it. Normalized transcodes of
+// sources measured before carry the measurement, so the job skips the
+// measuring pass.
+type TranscodeRequestedEvent struct {
+	Media     *models.Media
+	Policy    *TranscodePolicy
+	Key       string
+	Priority  TranscodePriority
+	Loudness  *LoudnessMeasurement
+	timestamp int64
+}
+
+func NewTranscodeRequestedEvent(
+	media *models.Media,
+	policy *TranscodePolicy,
+	key string,
+	priority TranscodePriority,
+	measured *LoudnessMeasurement,
+) *TranscodeRequestedEvent {
+	return &TranscodeRequestedEvent{
+		Media:     media,
+		Policy:    policy,
+		Key:       key,
+		Priority:  priority,
+		Loudness:  measured,
+		timestamp: time.Now().UnixNano(),
+	}
+}
+
+func (e *TranscodeRequestedEvent) EventType() string {
+	return "transcode.requested"
+}
+
+func (e *TranscodeRequestedEvent) Timestamp() int64 {
+	return e.timestamp
+}
+
+func (e *TranscodeRequestedEvent) AggregateID() string {
+	return e.Media.ID.String()
+}
+
+func (e *TranscodeRequestedEvent) Payload() map[string]interface{} {
+	payload := map[string]interface{}{
+		"media_id":            e.Media.ID.String(),
+		"library_id":          e.Media.LibraryID.String(),
+		"tenant_id":           e.Media.TenantID.String(),
+		"path":                e.Media.Path,
+		"profile":             e.Policy.Profile,
+		"format":              e.Policy.Format,
+		"policy_id":           e.Policy.ID.String(),
+		"dedupe_key":          e.Key,
+		"priority":            string(e.Priority),
+		"audio_normalization": string(e.Policy.AudioNormalization),
+	}
+	// Named after the loudnorm options the measurement is passed as
+	if m := e.Loudness; m != nil {
+		payload["measured_i"] = m.Loudness.Integrated
+		payload["measured_tp"] = m.Loudness.TruePeak
+		payload["measured_lra"] = m.Loudness.Range
+		payload["measured_thresh"] = m.Loudness.Threshold
+		payload["target_offset"] = m.Loudness.TargetOffset
+	}
+	return payload
+}
+
+// TranscodeReusedEvent is published instead of TranscodeRequestedEvent when
+// the source of a transcode was transcoded with the same profile before.
+// The transcode service links the earlier output to the media instead of
+// encoding it again.
+type TranscodeReusedEvent struct {
+	Media     *models.Media
+	Policy    *TranscodePolicy
+	Key       string
+	Output    *TranscodeOutput
+	timestamp int64
+}
+
+func NewTranscodeReusedEvent(
+	media *models.Media,
+	policy *TranscodePolicy,
+	key string,
+	output *TranscodeOutput,
+) *TranscodeReusedEvent {
+	return &TranscodeReusedEvent{
+		Media:     media,
+		Policy:    policy,
+		Key:       key,
+		Output:    output,
+		timestamp: time.Now().UnixNano(),
+	}
+}
+
+func (e *TranscodeReusedEvent) EventType() string {
+	return "transcode.reused"
+}
+
+func (e *TranscodeReusedEvent) Timestamp() int64 {
+	return e.timestamp
+}
+
+func (e *TranscodeReusedEvent) AggregateID() string {
+	return e.Media.ID.String()
+}
+
+func (e *TranscodeReusedEvent) Payload() map[string]interface{} {
+	return map[string]interface{}{
+		"media_id":        e.Media.ID.String(),
+		"library_id":      e.Media.LibraryID.String(),
+		"tenant_id":       e.Media.TenantID.String(),
+		"profile":         e.Policy.Profile,
+		"format":          e.Policy.Format,
+		"policy_id":       e.Policy.ID.String(),
+		"dedupe_key":      e.Key,
+		"output_path":     e.Output.Path,
+		"source_media_id": e.Output.MediaID.String(),
+	}
+}
+
+// TranscodeReprioritizedEvent is published when the priority of a requested
+// transcode changes. The transcode service moves its job in the queue if
+// it is still pending.
+type TranscodeReprioritizedEvent struct {
+	Request   TranscodeRequest
+	From      TranscodePriority
+	timestamp int64
+}
+
+func NewTranscodeReprioritizedEvent(request TranscodeRequest, from TranscodePriority) *TranscodeReprioritizedEvent {
+	return &TranscodeReprioritizedEvent{
+		Request:   request,
+		From:      from,
+		timestamp: time.Now().UnixNano(),
+	}
+}
+
+func (e *TranscodeReprioritizedEvent) EventType() string {
+	return "transcode.reprioritized"
+}
+
+func (e *TranscodeReprioritizedEvent) Timestamp() int64 {
+	return e.timestamp
+}
+
+func (e *TranscodeReprioritizedEvent) AggregateID() string {
+	return e.Request.MediaID.String()
+}
+
+func (e *TranscodeReprioritizedEvent) Payload() map[string]interface{} {
+	return map[string]interface{}{
+		"media_id":   e.Request.MediaID.String(),
+		"policy_id":  e.Request.PolicyID.String(),
+		"dedupe_key": e.Request.Key,
+		"from":       string(e.From),
+		"priority":   string(e.Request.Priority),
+	}
+}
+
+// FeedItemGrabbedEvent is published when an item of a feed is handed to a
+// download client.
+type FeedItemGrabbedEvent struct {
+	Feed      *Feed
+	Item      *FeedItem
+	Grab      *FeedGrab
+	timestamp int64
+}
+
+func NewFeedItemGrabbedEvent(feed *Feed, item *FeedItem, grab *FeedGrab) *FeedItemGrabbedEvent {
+	return &FeedItemGrabbedEvent{
+		Feed:      feed,
+		Item:      item,
+		Grab:      grab,
+		timestamp: time.Now().UnixNano(),
+	}
+}
+
+func (e *FeedItemGrabbedEvent) EventType() string {
+	return "feed.item_grabbed"
+}
+
+func (e *FeedItemGrabbedEvent) Timestamp() int64 {
+	return e.timestamp
+}
+
+func (e *FeedItemGrabbedEvent) AggregateID() string {
+	return e.Feed.ID.String()
+}
+
+func (e *FeedItemGrabbedEvent) Payload() map[string]interface{} {
+	return map[string]interface{}{
+		"feed_id":         e.Feed.ID.String(),
+		"library_id":      e.Feed.LibraryID.String(),
+		"title":           e.Item.Title,
+		"download_url":    e.Item.DownloadURL,
+		"info_hash":       e.Item.InfoHash,
+		"size":            e.Item.Size,
+		"download_client": e.Grab.DownloadClient,
+		"download_id":     e.Grab.DownloadID,
+	}
+}
+
+// ReleaseGrabbedEvent is published when a user grabs a release found by an
+// interactive search.
+type ReleaseGrabbedEvent struct {
+	Item           *WantedItem
+	Release        *Release
+	DownloadClient string
+	DownloadID     string
+	timestamp      int64
+}
+
+func NewReleaseGrabbedEvent(item *WantedItem, release *Release, client, downloadID string) *ReleaseGrabbedEvent {
+	return &ReleaseGrabbedEvent{
+		Item:           item,
+		Release:        release,
+		DownloadClient: client,
+		DownloadID:     downloadID,
+		timestamp:      time.Now().UnixNano(),
+	}
+}
+
+func (e *ReleaseGrabbedEvent) EventType() string {
+	return "release.grabbed"
+}
+
+func (e *ReleaseGrabbedEvent) Timestamp() int64 {
+	return e.timestamp
+}
+
+func (e *ReleaseGrabbedEvent) AggregateID() string {
+	return e.Item.MediaID.String()
+}
+
+func (e *ReleaseGrabbedEvent) Payload() map[string]interface{} {
+	payload := map[string]interface{}{
+		"media_id":        e.Item.MediaID.String(),
+		"library_id":      e.Item.LibraryID.String(),
+		"title":           e.Release.Title,
+		"indexer":         e.Release.Indexer,
+		"download_url":    e.Release.DownloadURL,
+		"download_client": e.DownloadClient,
+		"download_id":     e.DownloadID,
+	}
+	if e.Item.EpisodeID != nil {
+		payload["episode_id"] = e.Item.EpisodeID.String()
+	}
+	return payload
+}
+
+// ComponentDisabledEvent is published when an indexer or download client
+// is disabled after failing too often in a row.
+type ComponentDisabledEvent struct {
+	Health    ComponentHealth
+	timestamp int64
+}
+
+func NewComponentDisabledEvent(health ComponentHealth) *ComponentDisabledEvent {
+	return &ComponentDisabledEvent{
+		Health:    health,
+		timestamp: time.Now().UnixNano(),
+	}
+}
+
+func (e *ComponentDisabledEvent) EventType() string {
+	return "component.disabled"
+}
+
+func (e *ComponentDisabledEvent) Timestamp() int64 {
+	return e.timestamp
+}
+
+func (e *ComponentDisabledEvent) AggregateID() string {
+	return string(e.Health.Kind) + "/" + e.Health.Name
+}
+
+func (e *ComponentDisabledEvent) Payload() map[string]interface{} {
+	return map[string]interface{}{
+		"kind":                 string(e.Health.Kind),
+		"name":                 e.Health.Name,
+		"critical":             e.Health.Critical,
+		"consecutive_failures": e.Health.ConsecutiveFailures,
+		"last_error":           e.Health.LastError,
+		"retest_at":            e.Health.RetestAt.Unix(),
+	}
+}
+
+// ComponentEnabledEvent is published when a disabled indexer or download
+// client passes its re-test.
+type ComponentEnabledEvent struct {
+	Health    ComponentHealth
+	timestamp int64
+}
+
+func NewComponentEnabledEvent(health ComponentHealth) *ComponentEnabledEvent {
+	return &ComponentEnabledEvent{
+		Health:    health,
+		timestamp: time.Now().UnixNano(),
+	}
+}
+
+func (e *ComponentEnabledEvent) EventType() string {
+	return "component.enabled"
+}
+
+func (e *ComponentEnabledEvent) Timestamp() int64 {
+	return e.timestamp
+}
+
+func (e *ComponentEnabledEvent) AggregateID() string {
+	return string(e.Health.Kind) + "/" + e.Health.Name
+}
+
+func (e *ComponentEnabledEvent) Payload() map[string]interface{} {
+	return map[string]interface{}{
+		"kind":     string(e.Health.Kind),
+		"name":     e.Health.Name,
+		"critical": e.Health.Critical,
+	}
+}
+
+// MediaPlaybackFlaggedEvent is published when media is flagged for the
+// playback errors its clients report.
+type MediaPlaybackFlaggedEvent struct {
+	Flag      PlaybackFlag
+	Stats     PlaybackIssueStats
+	timestamp int64
+}
+
+func NewMediaPlaybackFlaggedEvent(flag PlaybackFlag, stats PlaybackIssueStats) *MediaPlaybackFlaggedEvent {
+	return &MediaPlaybackFlaggedEvent{
+		Flag:      flag,
+		Stats:     stats,
+		timestamp: time.Now().UnixNano(),
+	}
+}
+
+func (e *MediaPlaybackFlaggedEvent) EventType() string {
+	return "media.playback_flagged"
+}
+
+func (e *MediaPlaybackFlaggedEvent) Timestamp() int64 {
+	return e.timestamp
+}
+
+func (e *MediaPlaybackFlaggedEvent) AggregateID() string {
+	return e.Flag.MediaID.String()
+}
+
+func (e *MediaPlaybackFlaggedEvent) Payload() map[string]interface{} {
+	return map[string]interface{}{
+		"media_id":       e.Flag.MediaID.String(),
+		"reason":         string(e.Flag.Reason),
+		"error_rate":     e.Flag.ErrorRate,
+		"sessions":       e.Stats.Sessions,
+		"error_sessions": e.Stats.ErrorSessions,
+	}
+}
+
+// DownloadQuarantinedEvent is published when a download is flagged as
+// malware and its infected file quarantined.
+type DownloadQuarantinedEvent struct {
+	WorkflowID      uuid.UUID
+	MediaID         uuid.UUID
+	Scan            MalwareScan
+	QuarantinedPath string
+	Release         ReleaseIdentity
+	DownloadClient  string
+	timestamp       int64
+}
+
+func NewDownloadQuarantinedEvent(
+	workflowID, mediaID uuid.UUID,
+	scan MalwareScan,
+	quarantinedPath string,
+	release ReleaseIdentity,
+	downloadClient string,
+) *DownloadQuarantinedEvent {
+	return &DownloadQuarantinedEvent{
+		WorkflowID:      workflowID,
+		MediaID:         mediaID,
+		Scan:            scan,
+		QuarantinedPath: quarantinedPath,
+		Release:         release,
+		DownloadClient:  downloadClient,
+		timestamp:       time.Now().UnixNano(),
+	}
+}
+
+func (e *DownloadQuarantinedEvent) EventType() string {
+	return "download.quarantined"
+}
+
+func (e *DownloadQuarantinedEvent) Timestamp() int64 {
+	return e.timestamp
+}
+
+func (e *DownloadQuarantinedEvent) AggregateID() string {
+	return e.WorkflowID.String()
+}
+
+func (e *DownloadQuarantinedEvent) Payload() map[string]interface{} {
+	return map[string]interface{}{
+		"workflow_id":      e.WorkflowID.String(),
+		"media_id":         e.MediaID.String(),
+		"path":             e.Scan.Path,
+		"quarantined_path": e.QuarantinedPath,
+		"threat":           e.Scan.Threat,
+		"scanner":          e.Scan.Scanner,
+		"release_title":    e.Release.Title,
+		"release_indexer":  e.Release.Indexer,
+		"download_client":  e.DownloadClient,
+	}
+}
+
+// MediaSharedEvent is published when a user creates a share link.
+type MediaSharedEvent struct {
+	Link      ShareLink
+	timestamp int64
+}
+
+func NewMediaSharedEvent(link ShareLink) *MediaSharedEvent {
+	return &MediaSharedEvent{
+		Link:      link,
+		timestamp: time.Now().UnixNano(),
+	}
+}
+
+func (e *MediaSharedEvent) EventType() string {
+	return "media.shared"
+}
+
+func (e *MediaSharedEvent) Timestamp() int64 {
+	return e.timestamp
+}
+
+func (e *MediaSharedEvent) AggregateID() string {
+	return e.Link.MediaID.String()
+}
+
+func (e *MediaSharedEvent) Payload() map[string]interface{} {
+	return map[string]interface{}{
+		"share_link_id": e.Link.ID.String(),
+		"media_id":      e.Link.MediaID.String(),
+		"user_id":       e.Link.CreatedBy.String(),
+		"expires_at":    e.Link.ExpiresAt.Unix(),
+		"max_views":     e.Link.MaxViews,
+		"max_bitrate":   e.Link.MaxBitrate,
+	}
+}
+
+// ShareLinkPlayedEvent is published when a guest plays a share link.
+type ShareLinkPlayedEvent struct {
+	Link      ShareLink
+	Play      ShareLinkPlay
+	timestamp int64
+}
+
+func NewShareLinkPlayedEvent(link ShareLink, play ShareLinkPlay) *ShareLinkPlayedEvent {
+	return &ShareLinkPlayedEvent{
+		Link:      link,
+		Play:      play,
+		timestamp: time.Now().UnixNano(),
+	}
+}
+
+func (e *ShareLinkPlayedEvent) EventType() string {
+	return "media.share_played"
+}
+
+func (e *ShareLinkPlayedEvent) Timestamp() int64 {
+	return e.timestamp
+}
+
+func (e *ShareLinkPlayedEvent) AggregateID() string {
+	return e.Link.MediaID.String()
+}
+
+func (e *ShareLinkPlayedEvent) Payload() map[string]interface{} {
+	return map[string]interface{}{
+		"share_link_id": e.Link.ID.String(),
+		"media_id":      e.Link.MediaID.String(),
+		"user_id":       e.Link.CreatedBy.String(),
+		"views":         e.Link.Views,
+		"ip_address":    e.Play.IPAddress,
+		"user_agent":    e.Play.UserAgent,
+	}
+}
+
+// ContentRequestCreatedEvent is published when a user requests content.
+type ContentRequestCreatedEvent struct {
+	Request   ContentRequest
+	timestamp int64
+}
+
+func NewContentRequestCreatedEvent(request ContentRequest) *ContentRequestCreatedEvent {
+	return &ContentRequestCreatedEvent{
+		Request:   request,
+		timestamp: time.Now().UnixNano(),
+	}
+}
+
+func (e *ContentRequestCreatedEvent) EventType() string {
+	return "content_request.created"
+}
+
+func (e *ContentRequestCreatedEvent) Timestamp() int64 {
+	return e.timestamp
+}
+
+func (e *ContentRequestCreatedEvent) AggregateID() string {
+	return e.Request.ID.String()
+}
+
+func (e *ContentRequestCreatedEvent) Payload() map[string]interface{} {
+	return contentRequestPayload(e.Request)
+}
+
+// ContentRequestUpdatedEvent is published when a content request is
+// approved, denied or becomes available.
+type ContentRequestUpdatedEvent struct {
+	Request   ContentRequest
+	timestamp int64
+}
+
+func NewContentRequestUpdatedEvent(request ContentRequest) *ContentRequestUpdatedEvent {
+	return &ContentRequestUpdatedEvent{
+		Request:   request,
+		timestamp: time.Now().UnixNano(),
+	}
+}
+
+func (e *ContentRequestUpdatedEvent) EventType() string {
+	return "content_request.updated"
+}
+
+func (e *ContentRequestUpdatedEvent) Timestamp() int64 {
+	return e.timestamp
+}
+
+func (e *ContentRequestUpdatedEvent) AggregateID() string {
+	return e.Request.ID.String()
+}
+
+func (e *ContentRequestUpdatedEvent) Payload() map[string]interface{} {
+	return contentRequestPayload(e.Request)
+}
+
+func contentRequestPayload(r ContentRequest) map[string]interface{} {
+	payload := map[string]interface{}{
+		"request_id":    r.ID.String(),
+		"user_id":       r.UserID.String(),
+		"media_type":    string(r.MediaType),
+		"title":         r.Title,
+		"year":          r.Year,
+		"status":        string(r.Status),
+		"reason":        r.Reason,
+		"auto_approved": r.AutoApproved,
+	}
+	if r.MediaID != nil {
+		payload["media_id"] = r.MediaID.String()
+	}
+	if len(r.Seasons) > 0 {
+		payload["seasons"] = r.Seasons
+	}
+	if r.Quality != "" {
+		payload["quality"] = r.Quality
+	}
+	return payload
+}
+
+// MediaIssueReportedEvent is published when a user reports an issue with a
+// media item.
+type MediaIssueReportedEvent struct {
+	Issue      MediaIssue
+	MediaTitle string
+	timestamp  int64
+}
+
+func NewMediaIssueReportedEvent(issue MediaIssue, mediaTitle string) *MediaIssueReportedEvent {
+	return &MediaIssueReportedEvent{
+		Issue:      issue,
+		MediaTitle: mediaTitle,
+		timestamp:  time.Now().UnixNano(),
+	}
+}
+
+func (e *MediaIssueReportedEvent) EventType() string {
+	return "media_issue.reported"
+}
+
+func (e *MediaIssueReportedEvent) Timestamp() int64 {
+	return e.timestamp
+}
+
+func (e *MediaIssueReportedEvent) AggregateID() string {
+	return e.Issue.ID.String()
+}
+
+func (e *MediaIssueReportedEvent) Payload() map[string]interface{} {
+	return mediaIssuePayload(e.Issue, e.MediaTitle)
+}
+
+// MediaIssueResolvedEvent is published when an admin resolves a media
+// issue.
+type MediaIssueResolvedEvent struct {
+	Issue      MediaIssue
+	MediaTitle string
+	timestamp  int64
+}
+
+func NewMediaIssueResolvedEvent(issue MediaIssue, mediaTitle string) *MediaIssueResolvedEvent {
+	return &MediaIssueResolvedEvent{
+		Issue:      issue,
+		MediaTitle: mediaTitle,
+		timestamp:  time.Now().UnixNano(),
+	}
+}
+
+func (e *MediaIssueResolvedEvent) EventType() string {
+	return "media_issue.resolved"
+}
+
+func (e *MediaIssueResolvedEvent) Timestamp() int64 {
+	return e.timestamp
+}
+
+func (e *MediaIssueResolvedEvent) AggregateID() string {
+	return e.Issue.ID.String()
+}
+
+func (e *MediaIssueResolvedEvent) Payload() map[string]interface{} {
+	return mediaIssuePayload(e.Issue, e.MediaTitle)
+}
+
+func mediaIssuePayload(i MediaIssue, mediaTitle string) map[string]interface{} {
+	payload := map[string]interface{}{
+		"issue_id":    i.ID.String(),
+		"media_id":    i.MediaID.String(),
+		"media_title": mediaTitle,
+		"user_id":     i.UserID.String(),
+		"category":    string(i.Category),
+		"comment":     i.Comment,
+		"status":      string(i.Status),
+	}
+	if i.EpisodeID != nil {
+		payload["episode_id"] = i.EpisodeID.String()
+	}
+	if i.Status == IssueResolved {
+		payload["action"] = string(i.Action)
+		payload["resolution"] = i.Resolution
+	}
+	return payload
+}
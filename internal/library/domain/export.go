@@ -0,0 +1,371 @@
+package domain
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// ExportSchemaVersion is the version of the library export document format.
+// Bump it whenever a field is removed or changes meaning.
+const ExportSchemaVersion = 1
+
+// ExportFormat is the serialization format of a library export.
+type ExportFormat string
+
+const (
+	// ExportFormatJSON is the full-fidelity export including episodes and watch states.
+	ExportFormatJSON ExportFormat = "json"
+	// ExportFormatCSV is a flat, one-row-per-media export intended for bulk editing.
+	ExportFormatCSV ExportFormat = "csv"
+)
+
+// ConflictStrategy controls how imported media is reconciled with existing media.
+type ConflictStrategy string
+
+const (
+	// ConflictSkip leaves existing media untouched.
+	ConflictSkip ConflictStrategy = "skip"
+	// ConflictOverwrite replaces existing fields with the imported values.
+	ConflictOverwrite ConflictStrategy = "overwrite"
+	// ConflictMerge fills empty fields and unions genres and tags.
+	ConflictMerge ConflictStrategy = "merge"
+)
+
+// ParseConflictStrategy parses a conflict strategy, defaulting to skip.
+func ParseConflictStrategy(s string) (ConflictStrategy, error) {
+	switch ConflictStrategy(strings.ToLower(s)) {
+	case "", ConflictSkip:
+		return ConflictSkip, nil
+	case ConflictOverwrite:
+		return ConflictOverwrite, nil
+	case ConflictMerge:
+		return ConflictMerge, nil
+	default:
+		return "", fmt.Errorf("unknown conflict strategy %q", s)
+	}
+}
+
+// LibraryExport is the portable representation of a library.
+//
+// The JSON document looks like:
+//
+//	{
+//	  "schema_version": 1,
+//	  "exported_at": "2024-01-01T00:00:00Z",
+//	  "library": {"name": "...", "path": "...", "type": "movie", ...},
+//	  "media": [
+//	    {
+//	      "media": { ...models.Media incl. metadata, tags and episodes... },
+//	      "watch_states": [ ...models.WatchHistory... ]
+//	    }
+//	  ]
+//	}
+type LibraryExport struct {
+	SchemaVersion int             `json:"schema_version"`
+	ExportedAt    time.Time       `json:"exported_at"`
+	Library       ExportedLibrary `json:"library"`
+	Media         []ExportedMedia `json:"media"`
+}
+
+// ExportedLibrary holds the library settings carried by an export.
+type ExportedLibrary struct {
+	Name         string `json:"name"`
+	Path         string `json:"path"`
+	Type         string `json:"type"`
+	Enabled      bool   `json:"enabled"`
+	ScanInterval int    `json:"scan_interval"`
+
+	ExcludePatterns []string   `json:"exclude_patterns,omitempty"`
+	ExtrasMode      ExtrasMode `json:"extras_mode,omitempty"`
+	QualityCutoff   string     `json:"quality_cutoff,omitempty"`
+
+	IgnoreExtrasFolders bool          `json:"ignore_extras_folders,omitempty"`
+	FolderProfile       FolderProfile `json:"folder_profile,omitempty"`
+}
+
+// ExportedMedia is a media item together with its per-user watch states.
+type ExportedMedia struct {
+	Media       *models.Media          `json:"media"`
+	WatchStates []*models.WatchHistory `json:"watch_states,omitempty"`
+}
+
+// ImportResult summarizes the outcome of a library import.
+type ImportResult struct {
+	Created int
+	Updated int
+	Skipped int
+	Failed  int
+	Errors  []string
+}
+
+// NewLibraryExport creates an empty export for the given library.
+func NewLibraryExport(library *Library) *LibraryExport {
+	return &LibraryExport{
+		SchemaVersion: ExportSchemaVersion,
+		ExportedAt:    time.Now().UTC(),
+		Library: ExportedLibrary{
+			Name:         library.Name,
+			Path:         library.Path,
+			Type:         library.Type,
+			Enabled:      library.Enabled,
+			ScanInterval: library.ScanInterval,
+
+			ExcludePatterns: library.ExcludePatterns,
+			ExtrasMode:      library.ExtrasMode,
+			QualityCutoff:   library.QualityCutoff,
+
+			IgnoreExtrasFolders: library.IgnoreExtrasFolders,
+			FolderProfile:       library.FolderProfile,
+		},
+		Media: make([]ExportedMedia, 0),
+	}
+}
+
+// RebasePath rewrites a path from the exported library root to a new root.
+// It reports false for paths that do not rebase under the new root: paths
+// outside the exported root, including those leaving it through "..".
+func (e *LibraryExport) RebasePath(path, newRoot string) (string, bool) {
+	if e.Library.Path == "" || newRoot == "" || path == "" {
+		return "", false
+	}
+	rel, err := filepath.Rel(filepath.Clean(e.Library.Path), filepath.Clean(path))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.Join(newRoot, rel), true
+}
+
+// OverwriteMedia copies the portable fields of src onto dst.
+// Identity fields (ID, LibraryID) and scan bookkeeping are preserved.
+func OverwriteMedia(dst, src *models.Media) {
+	dst.Title = src.Title
+	dst.Description = src.Description
+	dst.ReleaseDate = src.ReleaseDate
+	dst.Year = src.Year
+	dst.Genres = src.Genres
+	dst.Tags = src.Tags
+	dst.TMDBID = src.TMDBID
+	dst.IMDBID = src.IMDBID
+	dst.TVDBID = src.TVDBID
+	if src.Status != "" {
+		dst.Status = src.Status
+	}
+	if src.Metadata != nil {
+		dst.Metadata = src.Metadata
+	}
+}
+
+// MergeMedia fills empty fields of dst from src and unions genres and tags.
+func MergeMedia(dst, src *models.Media) {
+	if dst.Title == "" {
+		dst.Title = src.Title
+	}
+	if dst.Description == "" {
+		dst.Description = src.Description
+	}
+	if dst.ReleaseDate.IsZero() {
+		dst.ReleaseDate = src.ReleaseDate
+	}
+	if dst.Year == 0 {
+		dst.Year = src.Year
+	}
+	if dst.TMDBID == 0 {
+		dst.TMDBID = src.TMDBID
+	}
+	if dst.IMDBID == "" {
+		dst.IMDBID = src.IMDBID
+	}
+	if dst.TVDBID == 0 {
+		dst.TVDBID = src.TVDBID
+	}
+	if dst.Metadata == nil {
+		dst.Metadata = src.Metadata
+	}
+	dst.Genres = unionStrings(dst.Genres, src.Genres)
+	dst.Tags = unionStrings(dst.Tags, src.Tags)
+}
+
+func unionStrings(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	out := make([]string, 0, len(a)+len(b))
+	for _, s := range append(append([]string{}, a...), b...) {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// EncodeLibraryExport writes the export in the requested format.
+func EncodeLibraryExport(w io.Writer, export *LibraryExport, format ExportFormat) error {
+	switch format {
+	case ExportFormatJSON, "":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(export)
+	case ExportFormatCSV:
+		return writeExportCSV(w, export)
+	default:
+		return fmt.Errorf("unsupported export format %q", format)
+	}
+}
+
+// DecodeLibraryExport reads an export in the given format.
+func DecodeLibraryExport(r io.Reader, format ExportFormat) (*LibraryExport, error) {
+	switch format {
+	case ExportFormatJSON, "":
+		var export LibraryExport
+		if err := json.NewDecoder(r).Decode(&export); err != nil {
+			return nil, fmt.Errorf("failed to decode export: %w", err)
+		}
+		if export.SchemaVersion > ExportSchemaVersion {
+			return nil, fmt.Errorf("unsupported export schema version %d", export.SchemaVersion)
+		}
+		return &export, nil
+	case ExportFormatCSV:
+		return readExportCSV(r)
+	default:
+		return nil, fmt.Errorf("unsupported export format %q", format)
+	}
+}
+
+// csvHeader is the column layout of CSV exports. List columns are "|" separated.
+var csvHeader = []string{
+	"id", "title", "type", "path", "status", "year", "release_date",
+	"description", "genres", "tags", "tmdb_id", "imdb_id", "tvdb_id",
+}
+
+const csvListSeparator = "|"
+
+func writeExportCSV(w io.Writer, export *LibraryExport) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, item := range export.Media {
+		m := item.Media
+		if m == nil {
+			continue
+		}
+		releaseDate := ""
+		if !m.ReleaseDate.IsZero() {
+			releaseDate = m.ReleaseDate.Format(time.DateOnly)
+		}
+		row := []string{
+			m.ID.String(),
+			m.Title,
+			string(m.Type),
+			m.Path,
+			m.Status,
+			strconv.Itoa(m.Year),
+			releaseDate,
+			m.Description,
+			strings.Join(m.Genres, csvListSeparator),
+			strings.Join(m.Tags, csvListSeparator),
+			strconv.Itoa(m.TMDBID),
+			m.IMDBID,
+			strconv.Itoa(m.TVDBID),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func readExportCSV(r io.Reader) (*LibraryExport, error) {
+	cr := csv.NewReader(r)
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("csv export is empty")
+	}
+
+	columns := make(map[string]int, len(rows[0]))
+	for i, name := range rows[0] {
+		columns[strings.TrimSpace(name)] = i
+	}
+	if _, ok := columns["path"]; !ok {
+		return nil, fmt.Errorf("csv export is missing the path column")
+	}
+
+	get := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+	list := func(s string) []string {
+		if s == "" {
+			return nil
+		}
+		return strings.Split(s, csvListSeparator)
+	}
+
+	export := &LibraryExport{
+		SchemaVersion: ExportSchemaVersion,
+		ExportedAt:    time.Now().UTC(),
+		Media:         make([]ExportedMedia, 0, len(rows)-1),
+	}
+
+	for n, row := range rows[1:] {
+		m := &models.Media{
+			Title:       get(row, "title"),
+			Type:        models.MediaType(get(row, "type")),
+			Path:        get(row, "path"),
+			Status:      get(row, "status"),
+			Description: get(row, "description"),
+			Genres:      list(get(row, "genres")),
+			Tags:        list(get(row, "tags")),
+			IMDBID:      get(row, "imdb_id"),
+		}
+		m.FilePath = m.Path
+
+		if id := get(row, "id"); id != "" {
+			if m.ID, err = uuid.Parse(id); err != nil {
+				return nil, fmt.Errorf("row %d: invalid id: %w", n+2, err)
+			}
+		}
+		if m.Year, err = atoiOrZero(get(row, "year")); err != nil {
+			return nil, fmt.Errorf("row %d: invalid year: %w", n+2, err)
+		}
+		if m.TMDBID, err = atoiOrZero(get(row, "tmdb_id")); err != nil {
+			return nil, fmt.Errorf("row %d: invalid tmdb_id: %w", n+2, err)
+		}
+		if m.TVDBID, err = atoiOrZero(get(row, "tvdb_id")); err != nil {
+			return nil, fmt.Errorf("row %d: invalid tvdb_id: %w", n+2, err)
+		}
+		if d := get(row, "release_date"); d != "" {
+			if m.ReleaseDate, err = time.Parse(time.DateOnly, d); err != nil {
+				return nil, fmt.Errorf("row %d: invalid release_date: %w", n+2, err)
+			}
+		}
+
+		export.Media = append(export.Media, ExportedMedia{Media: m})
+	}
+
+	return export, nil
+}
+
+func atoiOrZero(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(s)
+}
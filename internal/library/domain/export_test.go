@@ -0,0 +1,132 @@
+package domain_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+type ExportTestSuite struct {
+	suite.Suite
+}
+
+func (suite *ExportTestSuite) newExport() *domain.LibraryExport {
+	export := domain.NewLibraryExport(&domain.Library{
+		Name: "Movies",
+		Path: "/media/movies",
+		Type: "movie",
+	})
+	export.Media = append(export.Media, domain.ExportedMedia{
+		Media: &models.Media{
+			ID:          uuid.New(),
+			Title:       "The Matrix, Reloaded",
+			Type:        models.MediaTypeMovie,
+			Path:        "/media/movies/matrix.mkv",
+			Year:        2003,
+			ReleaseDate: time.Date(2003, 5, 15, 0, 0, 0, 0, time.UTC),
+			Genres:      []string{"action", "sci-fi"},
+			Tags:        []string{"4k"},
+			TMDBID:      604,
+			IMDBID:      "tt0234215",
+		},
+		WatchStates: []*models.WatchHistory{{UserID: uuid.New(), Position: 300}},
+	})
+	return export
+}
+
+func (suite *ExportTestSuite) TestJSONRoundTrip() {
+	export := suite.newExport()
+
+	var buf bytes.Buffer
+	suite.Require().NoError(domain.EncodeLibraryExport(&buf, export, domain.ExportFormatJSON))
+
+	decoded, err := domain.DecodeLibraryExport(&buf, domain.ExportFormatJSON)
+	suite.Require().NoError(err)
+	suite.Equal(domain.ExportSchemaVersion, decoded.SchemaVersion)
+	suite.Equal(export.Library, decoded.Library)
+	suite.Require().Len(decoded.Media, 1)
+	suite.Equal("The Matrix, Reloaded", decoded.Media[0].Media.Title)
+	suite.Len(decoded.Media[0].WatchStates, 1)
+}
+
+func (suite *ExportTestSuite) TestCSVRoundTrip() {
+	export := suite.newExport()
+
+	var buf bytes.Buffer
+	suite.Require().NoError(domain.EncodeLibraryExport(&buf, export, domain.ExportFormatCSV))
+
+	decoded, err := domain.DecodeLibraryExport(&buf, domain.ExportFormatCSV)
+	suite.Require().NoError(err)
+	suite.Require().Len(decoded.Media, 1)
+
+	original, media := export.Media[0].Media, decoded.Media[0].Media
+	suite.Equal(original.ID, media.ID)
+	suite.Equal(original.Title, media.Title)
+	suite.Equal(original.Path, media.Path)
+	suite.Equal(original.Year, media.Year)
+	suite.Equal(original.ReleaseDate, media.ReleaseDate)
+	suite.Equal(original.Genres, media.Genres)
+	suite.Equal(original.TMDBID, media.TMDBID)
+}
+
+func (suite *ExportTestSuite) TestDecodeRejectsNewerSchema() {
+	_, err := domain.DecodeLibraryExport(
+		bytes.NewBufferString(`{"schema_version": 99}`),
+		domain.ExportFormatJSON,
+	)
+	suite.Error(err)
+}
+
+func (suite *ExportTestSuite) TestRebasePath() {
+	export := suite.newExport()
+
+	path, ok := export.RebasePath("/media/movies/matrix.mkv", "/mnt/films")
+	suite.True(ok)
+	suite.Equal("/mnt/films/matrix.mkv", path)
+
+	for _, outside := range []string{
+		"/media/moviesextra/a.mkv",
+		"/other/a.mkv",
+		"/media/movies/../../etc/passwd",
+		"relative/a.mkv",
+		"",
+	} {
+		_, ok := export.RebasePath(outside, "/mnt/films")
+		suite.False(ok, outside)
+	}
+}
+
+func (suite *ExportTestSuite) TestParseConflictStrategy() {
+	strategy, err := domain.ParseConflictStrategy("")
+	suite.Require().NoError(err)
+	suite.Equal(domain.ConflictSkip, strategy)
+
+	strategy, err = domain.ParseConflictStrategy("MERGE")
+	suite.Require().NoError(err)
+	suite.Equal(domain.ConflictMerge, strategy)
+
+	_, err = domain.ParseConflictStrategy("replace")
+	suite.Error(err)
+}
+
+func (suite *ExportTestSuite) TestMergeMedia() {
+	dst := &models.Media{Title: "Kept", Tags: []string{"a"}}
+	src := &models.Media{Title: "Ignored", Description: "filled", Tags: []string{"a", "b"}, TMDBID: 7}
+
+	domain.MergeMedia(dst, src)
+
+	suite.Equal("Kept", dst.Title)
+	suite.Equal("filled", dst.Description)
+	suite.Equal([]string{"a", "b"}, dst.Tags)
+	suite.Equal(7, dst.TMDBID)
+}
+
+func TestExportTestSuite(t *testing.T) {
+	suite.Run(t, new(ExportTestSuite))
+}
@@ -0,0 +1,329 @@
+package domain
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Qualities a feed can filter on, as found in release titles.
+const (
+	FeedQuality2160p = "2160p"
+	FeedQuality1080p = "1080p"
+	FeedQuality720p  = "720p"
+	FeedQualitySD    = "sd"
+)
+
+// Feed is an RSS feed of torrent releases polled for items to grab into a
+// library.
+type Feed struct {
+	ID        uuid.UUID
+	TenantID  uuid.UUID
+	LibraryID uuid.UUID
+	Name      string
+	URL       string
+	// Include and Exclude are regular expressions matched against item
+	// titles, case-insensitively. An empty Include matches every item.
+	Include string
+	Exclude string
+	// Qualities are the qualities to grab; empty grabs any quality.
+	Qualities []string
+	// DownloadClient is the client grabs are handed to; empty uses the
+	// default client.
+	DownloadClient string
+	Enabled        bool
+	LastPolledAt   *time.Time
+	LastError      string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// Redacted returns a copy of the feed for clients, with the credentials
+// indexers embed in its URL, such as passkeys and API keys, replaced in
+// the URL and in the error of its last poll, which may quote it.
+func (f *Feed) Redacted() *Feed {
+	redacted := *f
+	redacted.URL = redactFeedURL(f.URL)
+	if redacted.URL != f.URL {
+		redacted.LastError = strings.ReplaceAll(f.LastError, f.URL, redacted.URL)
+	}
+	return &redacted
+}
+
+// redactFeedURL replaces the password and the credential query parameters
+// of a feed URL.
+func redactFeedURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	changed := false
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "REDACTED")
+		changed = true
+	}
+	query := u.Query()
+	for name := range query {
+		if isCredentialParam(name) {
+			query.Set(name, "REDACTED")
+			changed = true
+		}
+	}
+	if !changed {
+		return raw
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func isCredentialParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, part := range []string{"key", "pass", "token", "auth", "secret"} {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks that the feed is complete and its filters compile.
+func (f *Feed) Validate() error {
+	if f.Name == "" || f.URL == "" {
+		return errors.New("feed name and url are required")
+	}
+	if u, err := url.Parse(f.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("feed url %q must be an http or https url", f.URL)
+	}
+	if _, err := compileFilter(f.Include); err != nil {
+		return fmt.Errorf("invalid include pattern: %w", err)
+	}
+	if _, err := compileFilter(f.Exclude); err != nil {
+		return fmt.Errorf("invalid exclude pattern: %w", err)
+	}
+	for _, quality := range f.Qualities {
+		switch quality {
+		case FeedQuality2160p, FeedQuality1080p, FeedQuality720p, FeedQualitySD:
+		default:
+			return fmt.Errorf("unsupported quality %q", quality)
+		}
+	}
+	return nil
+}
+
+// Match reports whether the feed grabs an item. Items that do not match
+// come with the reason, for previews.
+func (f *Feed) Match(item *FeedItem) (bool, string) {
+	if item.DownloadURL == "" {
+		return false, "no download link"
+	}
+	// Filters were validated when the feed was saved
+	if include, _ := compileFilter(f.Include); include != nil && !include.MatchString(item.Title) {
+		return false, "does not match include pattern"
+	}
+	if exclude, _ := compileFilter(f.Exclude); exclude != nil && exclude.MatchString(item.Title) {
+		return false, "matches exclude pattern"
+	}
+	if len(f.Qualities) > 0 {
+		quality := ParseFeedQuality(item.Title)
+		for _, q := range f.Qualities {
+			if q == quality {
+				return true, ""
+			}
+		}
+		if quality == "" {
+			return false, "quality unknown"
+		}
+		return false, "quality " + quality + " not wanted"
+	}
+	return true, ""
+}
+
+func compileFilter(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile("(?i)" + pattern)
+}
+
+var (
+	quality2160p = regexp.MustCompile(`(?i)\b(2160p|4k|uhd)\b`)
+	quality1080p = regexp.MustCompile(`(?i)\b1080[pi]\b`)
+	quality720p  = regexp.MustCompile(`(?i)\b720p\b`)
+	qualitySD    = regexp.MustCompile(`(?i)\b(480p|576p|sdtv|dvdrip|xvid)\b`)
+)
+
+// ParseFeedQuality returns the quality named in a release title, or an
+// empty string if it names none.
+func ParseFeedQuality(title string) string {
+	switch {
+	case quality2160p.MatchString(title):
+		return FeedQuality2160p
+	case quality1080p.MatchString(title):
+		return FeedQuality1080p
+	case quality720p.MatchString(title):
+		return FeedQuality720p
+	case qualitySD.MatchString(title):
+		return FeedQualitySD
+	default:
+		return ""
+	}
+}
+
+// FeedItem is a release listed by a feed.
+type FeedItem struct {
+	GUID  string
+	Title string
+	// DownloadURL is the magnet link or .torrent URL of the release.
+	DownloadURL string
+	InfoHash    string // lower case; empty if the feed does not say
+	Size        int64
+	PublishedAt time.Time
+}
+
+// DedupeKey identifies the release of an item. Releases carried by several
+// feeds, or relisted under a new GUID, share the info hash.
+func (i *FeedItem) DedupeKey() string {
+	switch {
+	case i.InfoHash != "":
+		return "btih:" + i.InfoHash
+	case i.GUID != "":
+		return "guid:" + i.GUID
+	default:
+		return "url:" + i.DownloadURL
+	}
+}
+
+// FeedGrab records an item grabbed from a feed.
+type FeedGrab struct {
+	FeedID         uuid.UUID
+	Key            string
+	Title          string
+	DownloadClient string
+	DownloadID     string
+	GrabbedAt      time.Time
+}
+
+// rssDocument is an RSS 2.0 document, with the torznab and ezRSS
+// extensions torrent indexers use.
+type rssDocument struct {
+	Items []struct {
+		GUID      string `xml:"guid"`
+		Title     string `xml:"title"`
+		Link      string `xml:"link"`
+		PubDate   string `xml:"pubDate"`
+		Size      int64  `xml:"size"`
+		Enclosure struct {
+			URL    string `xml:"url,attr"`
+			Length int64  `xml:"length,attr"`
+		} `xml:"enclosure"`
+		Attrs []struct {
+			Name  string `xml:"name,attr"`
+			Value string `xml:"value,attr"`
+		} `xml:"attr"`
+		InfoHash      string `xml:"infoHash"`
+		MagnetURI     string `xml:"magnetURI"`
+		ContentLength int64  `xml:"contentLength"`
+	} `xml:"channel>item"`
+}
+
+// ParseFeed reads the items of an RSS feed.
+func ParseFeed(r io.Reader) ([]*FeedItem, error) {
+	var doc rssDocument
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse feed: %w", err)
+	}
+
+	items := make([]*FeedItem, 0, len(doc.Items))
+	for _, raw := range doc.Items {
+		item := &FeedItem{
+			GUID:     strings.TrimSpace(raw.GUID),
+			Title:    strings.TrimSpace(raw.Title),
+			InfoHash: strings.ToLower(strings.TrimSpace(raw.InfoHash)),
+			Size:     firstPositive(raw.Size, raw.ContentLength, raw.Enclosure.Length),
+		}
+		magnet := strings.TrimSpace(raw.MagnetURI)
+		for _, attr := range raw.Attrs {
+			switch attr.Name {
+			case "infohash":
+				item.InfoHash = strings.ToLower(attr.Value)
+			case "magneturl":
+				magnet = attr.Value
+			case "size":
+				if size, err := strconv.ParseInt(attr.Value, 10, 64); err == nil && item.Size == 0 {
+					item.Size = size
+				}
+			}
+		}
+
+		link := strings.TrimSpace(raw.Link)
+		switch {
+		case raw.Enclosure.URL != "":
+			item.DownloadURL = raw.Enclosure.URL
+		case magnet != "":
+			item.DownloadURL = magnet
+		case strings.HasPrefix(link, "magnet:") || strings.HasSuffix(link, ".torrent"):
+			item.DownloadURL = link
+		}
+		if item.InfoHash == "" {
+			item.InfoHash = magnetInfoHash(item.DownloadURL)
+		}
+		if t, err := time.Parse(time.RFC1123Z, strings.TrimSpace(raw.PubDate)); err == nil {
+			item.PublishedAt = t
+		} else if t, err := time.Parse(time.RFC1123, strings.TrimSpace(raw.PubDate)); err == nil {
+			item.PublishedAt = t
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// magnetInfoHash returns the hex info hash of a magnet link, or an empty
+// string.
+func magnetInfoHash(link string) string {
+	if !strings.HasPrefix(link, "magnet:") {
+		return ""
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	for _, xt := range u.Query()["xt"] {
+		hash, ok := strings.CutPrefix(xt, "urn:btih:")
+		if ok && len(hash) == 40 {
+			return strings.ToLower(hash)
+		}
+	}
+	return ""
+}
+
+func firstPositive(values ...int64) int64 {
+	for _, v := range values {
+		if v > 0 {
+			return v
+		}
+	}
+	return 0
+}
+
+// FeedPreviewItem is an item of a feed with what polling the feed would do
+// with it.
+type FeedPreviewItem struct {
+	Item    *FeedItem
+	Quality string
+	Matched bool
+	// Reason says why an unmatched item is skipped.
+	Reason string
+	// Grabbed reports whether the release was grabbed before, so a poll
+	// skips it even if it matches.
+	Grabbed bool
+}
@@ -0,0 +1,216 @@
+package domain
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// Normalized video codecs.
+const (
+	CodecAV1   = "av1"
+	CodecHEVC  = "hevc"
+	CodecVP9   = "vp9"
+	CodecH264  = "h264"
+	CodecMPEG4 = "mpeg4"
+)
+
+var codecPatterns = []struct {
+	codec   string
+	pattern *regexp.Regexp
+}{
+	{CodecAV1, regexp.MustCompile(`(?i)\bav1\b`)},
+	{CodecHEVC, regexp.MustCompile(`(?i)\b(x265|h\.?265|hevc)\b`)},
+	{CodecVP9, regexp.MustCompile(`(?i)\bvp9\b`)},
+	{CodecH264, regexp.MustCompile(`(?i)\b(x264|h\.?264|avc)\b`)},
+	{CodecMPEG4, regexp.MustCompile(`(?i)\b(xvid|divx|mpeg-?4)\b`)},
+}
+
+// ParseCodec returns the video codec named by a probed codec or release
+// title, such as "x265" or "HEVC", or an empty string if it names none.
+func ParseCodec(s string) string {
+	for _, c := range codecPatterns {
+		if c.pattern.MatchString(s) {
+			return c.codec
+		}
+	}
+	return ""
+}
+
+// FileProperties describe a media file for comparison with another file
+// of the same movie or episode.
+type FileProperties struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// Quality is the resolution quality of the file, one of the feed
+	// qualities, or empty if it is unknown.
+	Quality string `json:"quality,omitempty"`
+	Codec   string `json:"codec,omitempty"`
+	Bitrate int    `json:"bitrate,omitempty"` // bits per second; 0 if unknown
+}
+
+// ParseFileProperties describes a file that has not been probed by its
+// name.
+func ParseFileProperties(path string, size int64) FileProperties {
+	name := filepath.Base(path)
+	return FileProperties{
+		Path:    path,
+		Size:    size,
+		Quality: ParseFeedQuality(name),
+		Codec:   ParseCodec(name),
+	}
+}
+
+// FilePropertiesOf describes the file of a media item. Properties that
+// were not probed are parsed from the file name.
+func FilePropertiesOf(media *models.Media) FileProperties {
+	file := ParseFileProperties(media.FilePath, media.FileSize)
+	if quality := ResolutionQuality(media.Resolution); quality != "" {
+		file.Quality = quality
+	}
+	if codec := ParseCodec(media.Codec); codec != "" {
+		file.Codec = codec
+	}
+	file.Bitrate = media.Bitrate
+	return file
+}
+
+// FileComparison compares a file imported for a movie or episode with the
+// file the library already has. Resolution, Codec and Bitrate are 1 when
+// the candidate is better, -1 when it is worse and 0 when they are equal
+// or unknown.
+type FileComparison struct {
+	Existing   FileProperties `json:"existing"`
+	Candidate  FileProperties `json:"candidate"`
+	Resolution int            `json:"resolution"`
+	Codec      int            `json:"codec"`
+	Bitrate    int            `json:"bitrate"`
+	// SizeRatio is the size of the candidate relative to the existing
+	// file; 0 if either size is unknown.
+	SizeRatio float64 `json:"size_ratio,omitempty"`
+	// ScoreGain is the quality profile score the candidate gains, which
+	// does not count qualities above the cutoff of the library.
+	ScoreGain int `json:"score_gain"`
+	// Replace reports whether the candidate should replace the existing
+	// file, and Reason says why.
+	Replace bool   `json:"replace"`
+	Reason  string `json:"reason"`
+}
+
+// ReplaceRules decide whether a file imported for a movie or episode
+// replaces the file the library already has.
+type ReplaceRules struct {
+	// Auto replaces files with better ones as they are imported. Without
+	// it, imports of items that have a file wait for an admin.
+	Auto bool
+	// PreferredCodecs rank codecs best first. At equal quality, a file in
+	// a codec ranked higher replaces one ranked lower or not at all.
+	PreferredCodecs []string
+	// MaxSizeRatio is how many times larger than the existing file a
+	// replacement may be, such as 2; zero is unlimited.
+	MaxSizeRatio float64
+}
+
+// Compare compares a candidate file with the existing file of an item in a
+// library with a quality cutoff, and decides whether it replaces it.
+// Quality decides first, then codec, then bitrate.
+func (r ReplaceRules) Compare(existing, candidate FileProperties, cutoff string) FileComparison {
+	c := FileComparison{
+		Existing:   existing,
+		Candidate:  candidate,
+		Resolution: compareRanks(QualityRank(candidate.Quality), QualityRank(existing.Quality)),
+		Codec:      compareRanks(r.codecRank(candidate.Codec), r.codecRank(existing.Codec)),
+		ScoreGain:  qualityScore(candidate.Quality, cutoff) - qualityScore(existing.Quality, cutoff),
+	}
+	if candidate.Bitrate > 0 && existing.Bitrate > 0 {
+		c.Bitrate = compareRanks(candidate.Bitrate, existing.Bitrate)
+	}
+	if candidate.Size > 0 && existing.Size > 0 {
+		c.SizeRatio = float64(candidate.Size) / float64(existing.Size)
+	}
+
+	switch {
+	case r.MaxSizeRatio > 0 && c.SizeRatio > r.MaxSizeRatio:
+		c.Reason = fmt.Sprintf("%.1f times the size of the existing file", c.SizeRatio)
+	case c.ScoreGain > 0:
+		c.Replace, c.Reason = true, "upgrades "+qualityName(existing.Quality)+" to "+candidate.Quality
+	case c.ScoreGain < 0:
+		c.Reason = "lower quality than the existing file"
+	case c.Codec > 0:
+		c.Replace, c.Reason = true, "preferred codec "+candidate.Codec
+	case c.Codec < 0:
+		c.Reason = "less preferred codec than the existing file"
+	case c.Bitrate > 0:
+		c.Replace, c.Reason = true, "higher bitrate"
+	default:
+		c.Reason = "not better than the existing file"
+	}
+	return c
+}
+
+// codecRank ranks a codec by its position in PreferredCodecs, higher being
+// better. Unlisted codecs rank 0.
+func (r ReplaceRules) codecRank(codec string) int {
+	if codec == "" {
+		return 0
+	}
+	for i, preferred := range r.PreferredCodecs {
+		if ParseCodec(preferred) == codec {
+			return len(r.PreferredCodecs) - i
+		}
+	}
+	return 0
+}
+
+// qualityScore is the score a quality earns in a library with a quality
+// cutoff: better qualities score higher, up to the cutoff.
+func qualityScore(quality, cutoff string) int {
+	rank := QualityRank(quality)
+	if limit := QualityRank(cutoff); limit > 0 && rank > limit {
+		rank = limit
+	}
+	return rank * 100
+}
+
+func qualityName(quality string) string {
+	if quality == "" {
+		return "unknown quality"
+	}
+	return quality
+}
+
+func compareRanks(candidate, existing int) int {
+	switch {
+	case candidate > existing:
+		return 1
+	case candidate < existing:
+		return -1
+	default:
+		return 0
+	}
+}
+
+// RecycleBinDir is the recycle bin of a library when none is configured.
+// It is hidden, so scans skip it.
+const RecycleBinDir = ".recycle"
+
+// RecyclePath is where a replaced file of a library is kept: under the
+// library's directory of the recycle bin, or the library's own recycle bin
+// if bin is empty, in a directory for the time it was replaced, at its
+// path within the library.
+func RecyclePath(bin string, library *Library, path string, now time.Time) string {
+	dir := filepath.Join(library.Path, RecycleBinDir)
+	if bin != "" {
+		dir = filepath.Join(bin, library.ID.String())
+	}
+
+	rel, err := filepath.Rel(library.Path, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		rel = filepath.Base(path)
+	}
+	return filepath.Join(dir, now.UTC().Format("20060102T150405"), rel)
+}
@@ -0,0 +1,116 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+func TestFileProperties(t *testing.T) {
+	file := domain.ParseFileProperties("/downloads/Movie.2020.1080p.WEB.x265-GRP.mkv", 4<<30)
+	assert.Equal(t, domain.FeedQuality1080p, file.Quality)
+	assert.Equal(t, domain.CodecHEVC, file.Codec)
+	assert.Equal(t, int64(4<<30), file.Size)
+
+	// Probed properties win over the file name
+	file = domain.FilePropertiesOf(&models.Media{
+		FilePath:   "/media/movies/Movie.2020.720p.x264.mkv",
+		FileSize:   2 << 30,
+		Resolution: "1920x1080",
+		Codec:      "HEVC",
+		Bitrate:    8_000_000,
+	})
+	assert.Equal(t, domain.FeedQuality1080p, file.Quality)
+	assert.Equal(t, domain.CodecHEVC, file.Codec)
+	assert.Equal(t, 8_000_000, file.Bitrate)
+}
+
+func TestReplaceRulesCompare(t *testing.T) {
+	rules := domain.ReplaceRules{
+		Auto:            true,
+		PreferredCodecs: []string{"hevc", "h264"},
+		MaxSizeRatio:    3,
+	}
+	file := func(quality, codec string, size int64, bitrate int) domain.FileProperties {
+		return domain.FileProperties{Quality: quality, Codec: codec, Size: size, Bitrate: bitrate}
+	}
+
+	tests := []struct {
+		name      string
+		existing  domain.FileProperties
+		candidate domain.FileProperties
+		cutoff    string
+		replace   bool
+		reason    string
+	}{
+		{
+			name:      "higher quality",
+			existing:  file(domain.FeedQuality720p, domain.CodecH264, 2, 0),
+			candidate: file(domain.FeedQuality1080p, domain.CodecH264, 4, 0),
+			replace:   true,
+			reason:    "upgrades 720p to 1080p",
+		},
+		{
+			name:      "lower quality",
+			existing:  file(domain.FeedQuality1080p, domain.CodecH264, 4, 0),
+			candidate: file(domain.FeedQuality720p, domain.CodecHEVC, 1, 0),
+			reason:    "lower quality than the existing file",
+		},
+		{
+			name:      "above the cutoff",
+			existing:  file(domain.FeedQuality1080p, domain.CodecH264, 4, 0),
+			candidate: file(domain.FeedQuality2160p, domain.CodecH264, 10, 0),
+			cutoff:    domain.FeedQuality1080p,
+			reason:    "not better than the existing file",
+		},
+		{
+			name:      "too large",
+			existing:  file(domain.FeedQuality720p, domain.CodecH264, 2, 0),
+			candidate: file(domain.FeedQuality2160p, domain.CodecH264, 20, 0),
+			reason:    "10.0 times the size of the existing file",
+		},
+		{
+			name:      "preferred codec",
+			existing:  file(domain.FeedQuality1080p, domain.CodecH264, 4, 0),
+			candidate: file(domain.FeedQuality1080p, domain.CodecHEVC, 2, 0),
+			replace:   true,
+			reason:    "preferred codec hevc",
+		},
+		{
+			name:      "higher bitrate",
+			existing:  file(domain.FeedQuality1080p, domain.CodecHEVC, 4, 6_000_000),
+			candidate: file(domain.FeedQuality1080p, domain.CodecHEVC, 6, 9_000_000),
+			replace:   true,
+			reason:    "higher bitrate",
+		},
+		{
+			name:      "same file",
+			existing:  file(domain.FeedQuality1080p, domain.CodecHEVC, 4, 0),
+			candidate: file(domain.FeedQuality1080p, domain.CodecHEVC, 4, 0),
+			reason:    "not better than the existing file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := rules.Compare(tt.existing, tt.candidate, tt.cutoff)
+			assert.Equal(t, tt.replace, c.Replace)
+			assert.Equal(t, tt.reason, c.Reason)
+		})
+	}
+}
+
+func TestRecyclePath(t *testing.T) {
+	library := &domain.Library{ID: uuid.New(), Path: "/media/movies"}
+	now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	assert.Equal(t, "/media/movies/.recycle/20240501T123000/Movie (2020)/Movie.mkv",
+		domain.RecyclePath("", library, "/media/movies/Movie (2020)/Movie.mkv", now))
+	assert.Equal(t, "/recycle/"+library.ID.String()+"/20240501T123000/Movie.mkv",
+		domain.RecyclePath("/recycle", library, "/elsewhere/Movie.mkv", now))
+}
@@ -0,0 +1,175 @@
+package domain
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// FolderProfile is how the files of a library are organized on disk. It
+// tunes where scans take titles from, the formats renames default to and
+// the layout scans expect.
+type FolderProfile string
+
+const (
+	// FolderProfileAuto has no expectations of the layout. It is the
+	// default.
+	FolderProfileAuto FolderProfile = ""
+	// FolderProfileFlat keeps movie files side by side in the library
+	// folder, titled by their file names.
+	FolderProfileFlat FolderProfile = "flat"
+	// FolderProfileMovieFolders keeps each movie in its own folder, which
+	// names the movie.
+	FolderProfileMovieFolders FolderProfile = "movie_folders"
+	// FolderProfileSeasonFolders keeps episodes in season folders of series
+	// folders, as in "Series/Season 01/".
+	FolderProfileSeasonFolders FolderProfile = "season_folders"
+	// FolderProfileSeriesFolders keeps the episodes of a series directly in
+	// its folder.
+	FolderProfileSeriesFolders FolderProfile = "series_folders"
+)
+
+// Naming formats of the profiles whose layout differs from the defaults.
+const (
+	FlatMovieFormat            = "{Title} ({Year}) [{Quality}]"
+	SeriesFoldersEpisodeFormat = "{Series}/{Series} - S{season:00}E{episode:00} - {Title} [{Quality}]"
+)
+
+// MaxLayoutMismatches bounds the layout mismatches reported per scan.
+const MaxLayoutMismatches = 50
+
+var folderProfileTypes = map[FolderProfile][]models.MediaType{
+	FolderProfileFlat:          {models.MediaTypeMovie, models.MediaTypeMusicVideo},
+	FolderProfileMovieFolders:  {models.MediaTypeMovie},
+	FolderProfileSeasonFolders: {models.MediaTypeSeries, models.MediaTypeTV},
+	FolderProfileSeriesFolders: {models.MediaTypeSeries, models.MediaTypeTV},
+}
+
+// seasonFolderPattern matches season folder names, such as "Season 01",
+// "S2" or "Specials".
+var seasonFolderPattern = regexp.MustCompile(`(?i)^(?:season[ ._-]*|s)(\d{1,4})$|^specials$`)
+
+// Validate checks that a profile exists and suits the media type of a
+// library.
+func (p FolderProfile) Validate(mediaType string) error {
+	if p == FolderProfileAuto {
+		return nil
+	}
+	types, ok := folderProfileTypes[p]
+	if !ok {
+		return fmt.Errorf("unknown folder profile %q", p)
+	}
+	if !slices.Contains(types, models.MediaType(mediaType)) {
+		return fmt.Errorf("folder profile %s does not apply to %s libraries", p, mediaType)
+	}
+	return nil
+}
+
+// NamingRules returns the naming formats of a library, with the defaults
+// of its folder profile for the formats it does not set.
+func (l *Library) NamingRules() NamingRules {
+	rules := l.Naming
+	switch l.FolderProfile {
+	case FolderProfileFlat:
+		if rules.MovieFormat == "" {
+			rules.MovieFormat = FlatMovieFormat
+		}
+	case FolderProfileSeriesFolders:
+		if rules.EpisodeFormat == "" {
+			rules.EpisodeFormat = SeriesFoldersEpisodeFormat
+		}
+	}
+	return rules
+}
+
+// TitlePath returns the path whose name titles the media of a file. In
+// movie folder libraries that is the movie's folder, given the extension of
+// the file so dots in the folder name are kept; otherwise it is the file.
+func (l *Library) TitlePath(path string) string {
+	if l.FolderProfile != FolderProfileMovieFolders {
+		return path
+	}
+	rel, err := filepath.Rel(l.Path, path)
+	if err != nil {
+		return path
+	}
+	folder, _, nested := strings.Cut(filepath.ToSlash(rel), "/")
+	if !nested {
+		return path
+	}
+	return filepath.Join(l.Path, folder, folder+filepath.Ext(path))
+}
+
+// LayoutMismatch is a file whose place in a library does not match its
+// folder profile.
+type LayoutMismatch struct {
+	Path   string
+	Reason string
+}
+
+// CheckLayout returns the main media files of a library that are not where
+// its folder profile expects them. Extras are not checked.
+func (l *Library) CheckLayout(files []*MediaFile) []LayoutMismatch {
+	if l.FolderProfile == FolderProfileAuto {
+		return nil
+	}
+
+	var mismatches []LayoutMismatch
+	for _, file := range files {
+		if file.Extra != "" {
+			continue
+		}
+		rel, err := filepath.Rel(l.Path, file.Path)
+		if err != nil {
+			continue
+		}
+		if reason := l.layoutMismatch(filepath.ToSlash(rel)); reason != "" {
+			mismatches = append(mismatches, LayoutMismatch{Path: file.Path, Reason: reason})
+		}
+	}
+	return mismatches
+}
+
+// layoutMismatch returns why a file, given by its slash-separated path
+// relative to the library, does not match the profile, or "".
+func (l *Library) layoutMismatch(rel string) string {
+	dirs := strings.Split(rel, "/")
+	dirs = dirs[:len(dirs)-1]
+
+	switch l.FolderProfile {
+	case FolderProfileFlat:
+		if len(dirs) > 0 {
+			return "file is in a subfolder of a flat library"
+		}
+	case FolderProfileMovieFolders:
+		if len(dirs) == 0 {
+			return "file is not in a movie folder"
+		}
+	case FolderProfileSeriesFolders:
+		if len(dirs) != 1 {
+			return "file is not directly in a series folder"
+		}
+	case FolderProfileSeasonFolders:
+		if len(dirs) != 2 {
+			return "file is not in a season folder of a series folder"
+		}
+		match := seasonFolderPattern.FindStringSubmatch(dirs[1])
+		if match == nil {
+			return fmt.Sprintf("folder %q is not a season folder", dirs[1])
+		}
+		season := 0 // Specials
+		if match[1] != "" {
+			season, _ = strconv.Atoi(match[1])
+		}
+		numbers, ok := ParseEpisodeNumbers(filepath.Base(rel), l.Anime)
+		if ok && len(numbers.Episodes) > 0 && numbers.Season != season {
+			return fmt.Sprintf("episode of season %d is in the folder of season %d", numbers.Season, season)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,116 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+func TestFolderProfileValidate(t *testing.T) {
+	movie, series := string(models.MediaTypeMovie), string(models.MediaTypeSeries)
+
+	assert.NoError(t, domain.FolderProfileAuto.Validate(movie))
+	assert.NoError(t, domain.FolderProfileMovieFolders.Validate(movie))
+	assert.NoError(t, domain.FolderProfileSeasonFolders.Validate(series))
+	assert.NoError(t, domain.FolderProfileSeriesFolders.Validate(string(models.MediaTypeTV)))
+	assert.Error(t, domain.FolderProfileSeasonFolders.Validate(movie))
+	assert.Error(t, domain.FolderProfileMovieFolders.Validate(series))
+	assert.Error(t, domain.FolderProfile("nested").Validate(movie))
+}
+
+func TestLibraryNamingRules(t *testing.T) {
+	flat := &domain.Library{FolderProfile: domain.FolderProfileFlat}
+	assert.Equal(t, domain.FlatMovieFormat, flat.NamingRules().MovieFormat)
+	assert.Empty(t, flat.NamingRules().EpisodeFormat)
+
+	// Formats set on the library win over the profile's
+	flat.Naming.MovieFormat = "{Title}"
+	assert.Equal(t, "{Title}", flat.NamingRules().MovieFormat)
+
+	series := &domain.Library{FolderProfile: domain.FolderProfileSeriesFolders}
+	assert.Equal(t, domain.SeriesFoldersEpisodeFormat, series.NamingRules().EpisodeFormat)
+
+	for _, format := range []string{domain.FlatMovieFormat, domain.SeriesFoldersEpisodeFormat} {
+		assert.NoError(t, domain.NamingRules{MovieFormat: format, EpisodeFormat: format}.Validate())
+	}
+}
+
+func TestLibraryTitlePath(t *testing.T) {
+	folders := &domain.Library{Path: "/movies", FolderProfile: domain.FolderProfileMovieFolders}
+	assert.Equal(t, "/movies/Heat (1995)/Heat (1995).mkv", folders.TitlePath("/movies/Heat (1995)/heat.1080p.mkv"))
+	assert.Equal(t, "/movies/Heat (1995)/Heat (1995).mkv", folders.TitlePath("/movies/Heat (1995)/CD1/heat.mkv"))
+	assert.Equal(t, "/movies/heat.mkv", folders.TitlePath("/movies/heat.mkv"))
+
+	flat := &domain.Library{Path: "/movies", FolderProfile: domain.FolderProfileFlat}
+	assert.Equal(t, "/movies/Heat (1995)/heat.mkv", flat.TitlePath("/movies/Heat (1995)/heat.mkv"))
+
+	change := domain.NewScanChange(folders, domain.ScanChangeAdded,
+		&domain.MediaFile{Path: "/movies/The Matrix (1999)/tm-1080p.mkv"})
+	assert.Equal(t, "The Matrix", change.Title)
+	assert.Equal(t, 1999, change.Year)
+}
+
+func TestLibraryCheckLayout(t *testing.T) {
+	files := func(paths ...string) []*domain.MediaFile {
+		var files []*domain.MediaFile
+		for _, path := range paths {
+			files = append(files, &domain.MediaFile{Path: path})
+		}
+		return files
+	}
+	mismatched := func(mismatches []domain.LayoutMismatch) []string {
+		var paths []string
+		for _, mismatch := range mismatches {
+			paths = append(paths, mismatch.Path)
+		}
+		return paths
+	}
+
+	flat := &domain.Library{Path: "/movies", FolderProfile: domain.FolderProfileFlat}
+	assert.Equal(t, []string{"/movies/Heat (1995)/Heat.mkv"}, mismatched(flat.CheckLayout(files(
+		"/movies/Alien (1979).mkv",
+		"/movies/Heat (1995)/Heat.mkv",
+	))))
+
+	folders := &domain.Library{Path: "/movies", FolderProfile: domain.FolderProfileMovieFolders}
+	assert.Equal(t, []string{"/movies/Alien (1979).mkv"}, mismatched(folders.CheckLayout(files(
+		"/movies/Alien (1979).mkv",
+		"/movies/Heat (1995)/Heat.mkv",
+	))))
+
+	seasons := &domain.Library{Path: "/tv", FolderProfile: domain.FolderProfileSeasonFolders}
+	assert.Equal(t, []string{
+		"/tv/Show/Show.S01E03.mkv",
+		"/tv/Show/Extras Disc/Show.S01E04.mkv",
+		"/tv/Show/Season 02/Show.S01E05.mkv",
+	}, mismatched(seasons.CheckLayout(files(
+		"/tv/Show/Season 01/Show.S01E01.mkv",
+		"/tv/Show/Specials/Show.S00E01.mkv",
+		"/tv/Show/S1/Show.S01E02.mkv",
+		"/tv/Show/Show.S01E03.mkv",
+		"/tv/Show/Extras Disc/Show.S01E04.mkv",
+		"/tv/Show/Season 02/Show.S01E05.mkv",
+	))))
+
+	series := &domain.Library{Path: "/tv", FolderProfile: domain.FolderProfileSeriesFolders}
+	assert.Equal(t, []string{"/tv/Show/Season 01/Show.S01E02.mkv"}, mismatched(series.CheckLayout(files(
+		"/tv/Show/Show.S01E01.mkv",
+		"/tv/Show/Season 01/Show.S01E02.mkv",
+	))))
+
+	// Extras and libraries without a profile are not checked
+	extra := &domain.MediaFile{Path: "/movies/Heat (1995)/Heat-trailer.mkv", Extra: domain.ExtraTypeTrailer}
+	assert.Empty(t, flat.CheckLayout([]*domain.MediaFile{extra}))
+	assert.Empty(t, (&domain.Library{Path: "/movies"}).CheckLayout(files("/movies/a/b/c.mkv")))
+}
+
+func TestScanPreviewSetLayoutMismatches(t *testing.T) {
+	mismatches := make([]domain.LayoutMismatch, domain.MaxLayoutMismatches+5)
+	var preview domain.ScanPreview
+	preview.SetLayoutMismatches(mismatches)
+	assert.Equal(t, domain.MaxLayoutMismatches+5, preview.LayoutMismatchCount)
+	assert.Len(t, preview.LayoutMismatches, domain.MaxLayoutMismatches)
+}
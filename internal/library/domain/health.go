@@ -0,0 +1,137 @@
+package domain
+
+import "time"
+
+// ComponentKind is the kind of external component whose health is tracked.
+type ComponentKind string
+
+const (
+	ComponentIndexer        ComponentKind = "indexer"
+	ComponentDownloadClient ComponentKind = "download_client"
+)
+
+// HealthPolicy decides when a failing component is disabled and how long
+// until it is tried again.
+type HealthPolicy struct {
+	// FailureThreshold is the number of failures in a row that disable a
+	// component.
+	FailureThreshold int
+	// RetestInterval is how long a component stays disabled before it is
+	// tried again. Every failed re-test doubles it, up to MaxRetestInterval.
+	RetestInterval    time.Duration
+	MaxRetestInterval time.Duration
+}
+
+// responseTimeWeight is the weight of the latest call in the moving average
+// of response times.
+const responseTimeWeight = 0.2
+
+// ComponentHealth is the track record of an indexer or download client.
+// A component failing too often in a row is disabled: calls to it are
+// refused until its re-test is due, when one call is let through. A
+// successful re-test enables it again; a failed one doubles the wait.
+type ComponentHealth struct {
+	Kind ComponentKind
+	Name string
+	// Critical components alert when they are disabled.
+	Critical bool
+
+	Successes           int64
+	Failures            int64
+	ConsecutiveFailures int
+	// ResponseTime is the moving average of the duration of calls.
+	ResponseTime  time.Duration
+	LastError     string
+	LastSuccessAt *time.Time
+	LastFailureAt *time.Time
+
+	// DisabledAt is when the component was disabled, or nil if it is
+	// enabled. RetestAt is when it is tried again and RetestInterval how
+	// long the wait was.
+	DisabledAt     *time.Time
+	RetestAt       time.Time
+	RetestInterval time.Duration
+}
+
+// Disabled reports whether the component is disabled.
+func (h *ComponentHealth) Disabled() bool {
+	return h.DisabledAt != nil
+}
+
+// Available reports whether calls to the component are let through: it is
+// enabled or its re-test is due.
+func (h *ComponentHealth) Available(now time.Time) bool {
+	return !h.Disabled() || !now.Before(h.RetestAt)
+}
+
+// SuccessRate returns the share of calls that succeeded, or 1 if there were
+// none.
+func (h *ComponentHealth) SuccessRate() float64 {
+	total := h.Successes + h.Failures
+	if total == 0 {
+		return 1
+	}
+	return float64(h.Successes) / float64(total)
+}
+
+// Allow reports whether a call to the component may go ahead. The call
+// that starts a re-test pushes the next re-test back, so calls made while
+// it runs are refused.
+func (h *ComponentHealth) Allow(now time.Time) bool {
+	if !h.Available(now) {
+		return false
+	}
+	if h.Disabled() {
+		h.RetestAt = now.Add(h.RetestInterval)
+	}
+	return true
+}
+
+// RecordSuccess records a call that succeeded. It reports whether the call
+// enabled the component again.
+func (h *ComponentHealth) RecordSuccess(elapsed time.Duration, now time.Time) bool {
+	h.Successes++
+	h.ConsecutiveFailures = 0
+	h.LastSuccessAt = &now
+	h.recordResponseTime(elapsed)
+
+	if !h.Disabled() {
+		return false
+	}
+	h.DisabledAt = nil
+	h.RetestAt = time.Time{}
+	h.RetestInterval = 0
+	return true
+}
+
+// RecordFailure records a call that failed. It reports whether the call
+// disabled the component; failed re-tests of disabled components only back
+// off further.
+func (h *ComponentHealth) RecordFailure(err error, elapsed time.Duration, now time.Time, policy HealthPolicy) bool {
+	h.Failures++
+	h.ConsecutiveFailures++
+	h.LastError = err.Error()
+	h.LastFailureAt = &now
+	h.recordResponseTime(elapsed)
+
+	if h.Disabled() {
+		h.RetestInterval = min(2*h.RetestInterval, policy.MaxRetestInterval)
+		h.RetestAt = now.Add(h.RetestInterval)
+		return false
+	}
+	if h.ConsecutiveFailures < policy.FailureThreshold {
+		return false
+	}
+	h.DisabledAt = &now
+	h.RetestInterval = policy.RetestInterval
+	h.RetestAt = now.Add(h.RetestInterval)
+	return true
+}
+
+func (h *ComponentHealth) recordResponseTime(elapsed time.Duration) {
+	if h.Successes+h.Failures == 1 {
+		h.ResponseTime = elapsed
+		return
+	}
+	h.ResponseTime += time.Duration(responseTimeWeight * float64(elapsed-h.ResponseTime))
+}
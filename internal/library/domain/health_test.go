@@ -0,0 +1,45 @@
+package domain_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+)
+
+func TestComponentHealth_DisablesAndBacksOff(t *testing.T) {
+	policy := domain.HealthPolicy{FailureThreshold: 2, RetestInterval: time.Minute, MaxRetestInterval: 3 * time.Minute}
+	health := &domain.ComponentHealth{Kind: domain.ComponentIndexer, Name: "torznab"}
+	now := time.Now()
+	down := errors.New("connection refused")
+
+	assert.False(t, health.RecordSuccess(100*time.Millisecond, now))
+	assert.False(t, health.RecordFailure(down, 300*time.Millisecond, now, policy))
+	assert.True(t, health.RecordFailure(down, 300*time.Millisecond, now, policy), "the second failure in a row disables")
+	assert.True(t, health.Disabled())
+	assert.Equal(t, "connection refused", health.LastError)
+	assert.InDelta(t, 1.0/3, health.SuccessRate(), 0.001)
+	assert.Equal(t, 172*time.Millisecond, health.ResponseTime)
+
+	// Calls are refused until the re-test is due, and while it runs
+	assert.False(t, health.Allow(now.Add(30*time.Second)))
+	retest := now.Add(time.Minute)
+	assert.True(t, health.Allow(retest))
+	assert.False(t, health.Allow(retest))
+
+	// Failed re-tests double the wait, up to the maximum
+	assert.False(t, health.RecordFailure(down, time.Second, retest, policy))
+	assert.Equal(t, 2*time.Minute, health.RetestInterval)
+	assert.Equal(t, retest.Add(2*time.Minute), health.RetestAt)
+	health.RecordFailure(down, time.Second, retest, policy)
+	assert.Equal(t, 3*time.Minute, health.RetestInterval)
+
+	// A passed re-test enables it again
+	assert.True(t, health.RecordSuccess(time.Second, retest.Add(3*time.Minute)))
+	assert.False(t, health.Disabled())
+	assert.Zero(t, health.ConsecutiveFailures)
+	assert.True(t, health.Available(retest))
+}
@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// HookPoint is the library event a hook runs on.
+type HookPoint string
+
+const (
+	// HookPointImport runs when a media item is added to a library.
+	HookPointImport HookPoint = "import"
+	// HookPointTranscodeComplete runs when a transcode job completes.
+	HookPointTranscodeComplete HookPoint = "transcode_complete"
+	// HookPointDelete runs when a media item is deleted.
+	HookPointDelete HookPoint = "delete"
+	// HookPointComponentDown runs when a critical indexer or download
+	// client is disabled for failing.
+	HookPointComponentDown HookPoint = "component_down"
+	// HookPointMalwareDetected runs when a download is quarantined as
+	// malware.
+	HookPointMalwareDetected HookPoint = "malware_detected"
+)
+
+// ParseHookPoint parses a hook point.
+func ParseHookPoint(s string) (HookPoint, error) {
+	switch point := HookPoint(s); point {
+	case HookPointImport, HookPointTranscodeComplete, HookPointDelete, HookPointComponentDown,
+		HookPointMalwareDetected:
+		return point, nil
+	default:
+		return "", fmt.Errorf("unknown hook point %q", s)
+	}
+}
+
+// Hook is a user script run on a hook point. The script gets the event as a
+// JSON document on stdin. Hooks are defined in the service configuration;
+// only whether they are enabled can change at runtime.
+type Hook struct {
+	Name    string
+	Point   HookPoint
+	Command string // absolute path of the script
+	Args    []string
+	Timeout time.Duration
+	// MaxMemory limits the address space of the script in bytes, and MaxCPU
+	// its CPU time. Zero leaves either unlimited.
+	MaxMemory int64
+	MaxCPU    time.Duration
+	Enabled   bool
+}
+
+// HookRun is the outcome of one run of a hook.
+type HookRun struct {
+	ID        uuid.UUID
+	Hook      string
+	Point     HookPoint
+	EventType string
+	// EntityID is the media item, transcode job, component or workflow the
+	// run was about.
+	EntityID  string
+	ExitCode  int
+	TimedOut  bool
+	Output    string // stdout and stderr, truncated to MaxHookOutput
+	Error     string
+	StartedAt time.Time
+	Duration  time.Duration
+}
+
+// MaxHookOutput is the number of bytes of script output kept per run.
+const MaxHookOutput = 64 * 1024
+
+// Succeeded reports whether the script ran to completion and exited zero.
+func (r *HookRun) Succeeded() bool {
+	return r.ExitCode == 0 && !r.TimedOut && r.Error == ""
+}
@@ -0,0 +1,28 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+)
+
+func TestParseHookPoint(t *testing.T) {
+	point, err := domain.ParseHookPoint("transcode_complete")
+	require.NoError(t, err)
+	assert.Equal(t, domain.HookPointTranscodeComplete, point)
+
+	_, err = domain.ParseHookPoint("")
+	assert.Error(t, err)
+	_, err = domain.ParseHookPoint("on_import")
+	assert.Error(t, err)
+}
+
+func TestHookRunSucceeded(t *testing.T) {
+	assert.True(t, (&domain.HookRun{}).Succeeded())
+	assert.False(t, (&domain.HookRun{ExitCode: 1}).Succeeded())
+	assert.False(t, (&domain.HookRun{ExitCode: -1, TimedOut: true}).Succeeded())
+	assert.False(t, (&domain.HookRun{Error: "exec: not found"}).Succeeded())
+}
@@ -0,0 +1,69 @@
+package domain
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// ImportMode is how a downloaded file is placed in a library.
+type ImportMode string
+
+const (
+	// ImportModeLink hardlinks the file, so a torrent keeps seeding from the
+	// download without taking the space twice. Files on another file system
+	// than the library are copied instead.
+	ImportModeLink ImportMode = "link"
+	// ImportModeCopy copies the file, leaving the download alone.
+	ImportModeCopy ImportMode = "copy"
+	// ImportModeMove moves the file out of the downloads.
+	ImportModeMove ImportMode = "move"
+)
+
+// How an imported file ended up in the library.
+const (
+	ImportMethodLinked  = "linked"
+	ImportMethodCopied  = "copied"
+	ImportMethodMoved   = "moved"
+	ImportMethodInPlace = "in_place" // the file was already inside the library
+)
+
+// ParseImportMode parses an import mode. An empty string is the default,
+// ImportModeLink.
+func ParseImportMode(s string) (ImportMode, error) {
+	switch mode := ImportMode(s); mode {
+	case "":
+		return ImportModeLink, nil
+	case ImportModeLink, ImportModeCopy, ImportModeMove:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown import mode %q", s)
+	}
+}
+
+// ImportModes picks the import mode of a file by the download client that
+// fetched it, such as move for usenet and link for torrents.
+type ImportModes struct {
+	Default  ImportMode
+	ByClient map[string]ImportMode
+}
+
+// For returns the import mode of files fetched by client.
+func (m ImportModes) For(client string) ImportMode {
+	if mode, ok := m.ByClient[client]; ok {
+		return mode
+	}
+	if m.Default == "" {
+		return ImportModeLink
+	}
+	return m.Default
+}
+
+// ImportPath is where a downloaded file is placed in a library: directly
+// inside it, under its own name. Files already inside the library stay
+// where they are.
+func ImportPath(library *Library, source string) (string, bool) {
+	if _, inside := RelocatePath(source, library.Path, library.Path); inside {
+		return source, false
+	}
+	return filepath.Join(library.Path, filepath.Base(source)), true
+}
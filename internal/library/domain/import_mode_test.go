@@ -0,0 +1,38 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+)
+
+func TestImportModes(t *testing.T) {
+	mode, err := domain.ParseImportMode("")
+	require.NoError(t, err)
+	assert.Equal(t, domain.ImportModeLink, mode)
+	_, err = domain.ParseImportMode("symlink")
+	assert.Error(t, err)
+
+	modes := domain.ImportModes{
+		Default:  domain.ImportModeMove,
+		ByClient: map[string]domain.ImportMode{"qbittorrent": domain.ImportModeLink},
+	}
+	assert.Equal(t, domain.ImportModeLink, modes.For("qbittorrent"))
+	assert.Equal(t, domain.ImportModeMove, modes.For("sabnzbd"))
+	assert.Equal(t, domain.ImportModeLink, domain.ImportModes{}.For("sabnzbd"))
+}
+
+func TestImportPath(t *testing.T) {
+	library := &domain.Library{Path: "/media/movies"}
+
+	path, outside := domain.ImportPath(library, "/downloads/complete/Movie.mkv")
+	assert.True(t, outside)
+	assert.Equal(t, "/media/movies/Movie.mkv", path)
+
+	path, outside = domain.ImportPath(library, "/media/movies/Movie (2020)/Movie.mkv")
+	assert.False(t, outside)
+	assert.Equal(t, "/media/movies/Movie (2020)/Movie.mkv", path)
+}
@@ -0,0 +1,199 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// IMVDbProviderName is the name of the IMVDb metadata provider.
+const IMVDbProviderName = "imvdb"
+
+// IMVDbProvider fetches music video metadata from the IMVDb REST API. It
+// only covers music videos.
+type IMVDbProvider struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+var (
+	_ MetadataProvider   = (*IMVDbProvider)(nil)
+	_ MusicVideoProvider = (*IMVDbProvider)(nil)
+)
+
+// NewIMVDbProvider creates a provider for the IMVDb API at a URL, such as
+// "https://imvdb.com/api/v1", authenticating with an app key.
+func NewIMVDbProvider(url, apiKey string, client *http.Client) *IMVDbProvider {
+	return &IMVDbProvider{
+		url:    strings.TrimSuffix(url, "/"),
+		apiKey: apiKey,
+		client: client,
+	}
+}
+
+// GetName returns the provider name.
+func (p *IMVDbProvider) GetName() string {
+	return IMVDbProviderName
+}
+
+// GetType returns "music_video": the provider covers music videos only.
+func (p *IMVDbProvider) GetType() string {
+	return MetadataProviderTypeMusicVideo
+}
+
+// SearchMovie returns no results: IMVDb has no movies.
+func (p *IMVDbProvider) SearchMovie(
+	context.Context,
+	string,
+	int,
+	MetadataPreferences,
+) ([]models.SearchResult, error) {
+	return nil, nil
+}
+
+// SearchTV returns no results: IMVDb has no series.
+func (p *IMVDbProvider) SearchTV(context.Context, string, int, MetadataPreferences) ([]models.SearchResult, error) {
+	return nil, nil
+}
+
+// GetMovieDetails returns no metadata: IMVDb has no movies.
+func (p *IMVDbProvider) GetMovieDetails(context.Context, string, MetadataPreferences) (*models.Metadata, error) {
+	return nil, nil
+}
+
+// GetTVDetails returns no metadata: IMVDb has no series.
+func (p *IMVDbProvider) GetTVDetails(context.Context, string, MetadataPreferences) (*models.Metadata, error) {
+	return nil, nil
+}
+
+// GetEpisodeDetails returns no metadata: IMVDb has no series.
+func (p *IMVDbProvider) GetEpisodeDetails(
+	context.Context,
+	string,
+	int, int,
+	MetadataPreferences,
+) (*models.EpisodeMetadata, error) {
+	return nil, nil
+}
+
+type imvdbVideo struct {
+	ID        int64  `json:"id"`
+	SongTitle string `json:"song_title"`
+	Year      int    `json:"year"`
+	Artists   []struct {
+		Name string `json:"name"`
+	} `json:"artists"`
+	Image struct {
+		Original string `json:"o"`
+	} `json:"image"`
+	Directors []struct {
+		Name string `json:"entity_name"`
+	} `json:"directors"`
+}
+
+func (v imvdbVideo) artist() string {
+	names := make([]string, len(v.Artists))
+	for i, artist := range v.Artists {
+		names[i] = artist.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// SearchMusicVideo searches for videos of an artist by title.
+func (p *IMVDbProvider) SearchMusicVideo(
+	ctx context.Context,
+	artist, title string,
+	_ MetadataPreferences,
+) ([]models.SearchResult, error) {
+	query := strings.TrimSpace(artist + " " + title)
+	var data struct {
+		Results []imvdbVideo `json:"results"`
+	}
+	if err := p.get(ctx, "/search/videos?q="+url.QueryEscape(query), &data); err != nil {
+		return nil, err
+	}
+
+	results := make([]models.SearchResult, len(data.Results))
+	for i, video := range data.Results {
+		results[i] = models.SearchResult{
+			ProviderID:   strconv.FormatInt(video.ID, 10),
+			ProviderName: IMVDbProviderName,
+			Title:        video.SongTitle,
+			Year:         video.Year,
+			Type:         string(models.MediaTypeMusicVideo),
+			PosterURL:    video.Image.Original,
+			Overview:     video.artist(),
+		}
+	}
+	return results, nil
+}
+
+// GetMusicVideoDetails returns the metadata of a video, or nil if IMVDb
+// does not know it.
+func (p *IMVDbProvider) GetMusicVideoDetails(
+	ctx context.Context,
+	providerID string,
+	_ MetadataPreferences,
+) (*models.Metadata, error) {
+	if _, err := strconv.ParseInt(providerID, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid IMVDb ID %q", providerID)
+	}
+
+	var video imvdbVideo
+	if err := p.get(ctx, "/video/"+providerID+"?include=credits", &video); err != nil {
+		return nil, err
+	}
+	if video.ID == 0 {
+		return nil, nil
+	}
+
+	metadata := &models.Metadata{
+		IMVDbID:   strconv.FormatInt(video.ID, 10),
+		Title:     video.SongTitle,
+		Artist:    video.artist(),
+		PosterURL: video.Image.Original,
+	}
+	if video.Year > 0 {
+		metadata.ReleaseDate = strconv.Itoa(video.Year)
+	}
+	for _, director := range video.Directors {
+		metadata.Directors = append(metadata.Directors, director.Name)
+	}
+	return metadata, nil
+}
+
+// get requests a path of the API and decodes the response into out. Not
+// found responses leave out unchanged.
+func (p *IMVDbProvider) get(ctx context.Context, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create IMVDb request: %w", err)
+	}
+	req.Header.Set("IMVDB-APP-KEY", p.apiKey)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to query IMVDb: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil
+	default:
+		return fmt.Errorf("IMVDb query failed: unexpected status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode IMVDb response: %w", err)
+	}
+	return nil
+}
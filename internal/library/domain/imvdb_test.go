@@ -0,0 +1,62 @@
+package domain_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+)
+
+func TestIMVDbProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("IMVDB-APP-KEY") != "key" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch {
+		case r.URL.Path == "/search/videos" && r.URL.Query().Get("q") == "Daft Punk Around the World":
+			_, _ = w.Write([]byte(`{"results":[{"id":121779770452,"song_title":"Around the World","year":1997,
+				"artists":[{"name":"Daft Punk"}],"image":{"o":"https://imvdb.example/atw.jpg"}}]}`))
+		case r.URL.Path == "/video/121779770452":
+			_, _ = w.Write([]byte(`{"id":121779770452,"song_title":"Around the World","year":1997,
+				"artists":[{"name":"Daft Punk"}],"image":{"o":"https://imvdb.example/atw.jpg"},
+				"directors":[{"entity_name":"Michel Gondry"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	provider := domain.NewIMVDbProvider(server.URL, "key", server.Client())
+	ctx := context.Background()
+	prefs := domain.MetadataPreferences{}
+
+	results, err := provider.SearchMusicVideo(ctx, "Daft Punk", "Around the World", prefs)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "121779770452", results[0].ProviderID)
+	assert.Equal(t, "Around the World", results[0].Title)
+	assert.Equal(t, 1997, results[0].Year)
+
+	metadata, err := provider.GetMusicVideoDetails(ctx, "121779770452", prefs)
+	require.NoError(t, err)
+	assert.Equal(t, "121779770452", metadata.IMVDbID)
+	assert.Equal(t, "Daft Punk", metadata.Artist)
+	assert.Equal(t, "1997", metadata.ReleaseDate)
+	assert.Equal(t, []string{"Michel Gondry"}, metadata.Directors)
+
+	metadata, err = provider.GetMusicVideoDetails(ctx, "1", prefs)
+	require.NoError(t, err)
+	assert.Nil(t, metadata)
+
+	_, err = provider.GetMusicVideoDetails(ctx, "abc", prefs)
+	assert.Error(t, err)
+
+	_, err = domain.NewIMVDbProvider(server.URL, "wrong", server.Client()).SearchMusicVideo(ctx, "a", "b", prefs)
+	assert.Error(t, err)
+}
@@ -0,0 +1,77 @@
+package domain
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+const (
+	// NowPlayingWindow is how recently watch progress must have been
+	// recorded for media to count as playing.
+	NowPlayingWindow = 5 * time.Minute
+	// MaxDisplayItems bounds each section of a display snapshot.
+	MaxDisplayItems = 12
+)
+
+// Kiosk is a lobby display or dashboard that reads what is playing and
+// what was added to some libraries without a user account. It redeems its
+// key for short-lived kiosk tokens; only a hash of the key is stored.
+type Kiosk struct {
+	ID       uuid.UUID
+	TenantID uuid.UUID
+	Name     string
+	// LibraryIDs are the libraries the kiosk shows; empty shows every
+	// library.
+	LibraryIDs []uuid.UUID
+	KeyHash    string
+	CreatedBy  uuid.UUID
+	CreatedAt  time.Time
+	RevokedAt  *time.Time
+}
+
+// Shows reports whether the kiosk shows media of a library.
+func (k *Kiosk) Shows(libraryID uuid.UUID) bool {
+	return len(k.LibraryIDs) == 0 || slices.Contains(k.LibraryIDs, libraryID)
+}
+
+// DisplayItem is a title on a display. Displays are shown to anyone
+// passing by, so items never name the users watching them.
+type DisplayItem struct {
+	MediaID   uuid.UUID        `json:"media_id"`
+	Title     string           `json:"title"`
+	Year      int              `json:"year,omitempty"`
+	MediaType models.MediaType `json:"media_type"`
+	// Progress is how far a playing title is watched, from 0 to 1.
+	Progress float64 `json:"progress,omitempty"`
+	// At is when a title was last played or was added.
+	At time.Time `json:"at"`
+}
+
+// DisplaySnapshot is what a display shows: the titles playing and the
+// titles added last.
+type DisplaySnapshot struct {
+	NowPlaying    []DisplayItem `json:"now_playing"`
+	RecentlyAdded []DisplayItem `json:"recently_added"`
+}
+
+// Equal reports whether two snapshots show the same, so displays are only
+// pushed changes.
+func (s *DisplaySnapshot) Equal(other *DisplaySnapshot) bool {
+	return other != nil &&
+		slices.EqualFunc(s.NowPlaying, other.NowPlaying, DisplayItem.equal) &&
+		slices.EqualFunc(s.RecentlyAdded, other.RecentlyAdded, DisplayItem.equal)
+}
+
+func (i DisplayItem) equal(other DisplayItem) bool {
+	return i.MediaID == other.MediaID && i.Title == other.Title && i.Year == other.Year &&
+		i.MediaType == other.MediaType && i.Progress == other.Progress && i.At.Equal(other.At)
+}
+
+// HashKioskKey returns the stored representation of a kiosk key.
+func HashKioskKey(key string) string {
+	return HashShareToken(key)
+}
@@ -0,0 +1,38 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+)
+
+func TestKioskShows(t *testing.T) {
+	shown, other := uuid.New(), uuid.New()
+
+	assert.True(t, (&domain.Kiosk{}).Shows(other), "kiosks without libraries show every library")
+	kiosk := &domain.Kiosk{LibraryIDs: []uuid.UUID{shown}}
+	assert.True(t, kiosk.Shows(shown))
+	assert.False(t, kiosk.Shows(other))
+}
+
+func TestDisplaySnapshotEqual(t *testing.T) {
+	at := time.Now()
+	item := domain.DisplayItem{MediaID: uuid.New(), Title: "Heat", Year: 1995, At: at}
+	snapshot := &domain.DisplaySnapshot{RecentlyAdded: []domain.DisplayItem{item}}
+
+	same := item
+	same.At = at.Round(0)
+	assert.True(t, snapshot.Equal(&domain.DisplaySnapshot{RecentlyAdded: []domain.DisplayItem{same}}))
+
+	playing := item
+	playing.Progress = 0.5
+	assert.False(t, snapshot.Equal(&domain.DisplaySnapshot{
+		NowPlaying:    []domain.DisplayItem{playing},
+		RecentlyAdded: []domain.DisplayItem{item},
+	}))
+	assert.False(t, snapshot.Equal(nil))
+}
@@ -0,0 +1,270 @@
+package domain
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MalwareVerdict is the outcome of scanning a download for malware.
+type MalwareVerdict string
+
+const (
+	MalwareVerdictClean    MalwareVerdict = "clean"
+	MalwareVerdictInfected MalwareVerdict = "infected"
+)
+
+// MalwareScan is the result of scanning a download.
+type MalwareScan struct {
+	Scanner string
+	Verdict MalwareVerdict
+	// Threat names what infected files were flagged as, and Path the first
+	// of them; both are empty for clean downloads.
+	Threat string
+	Path   string
+}
+
+// MalwareScanner scans downloaded files for malware. Downloads that are
+// directories, such as season packs, are scanned file by file.
+type MalwareScanner interface {
+	Name() string
+	Scan(ctx context.Context, path string) (*MalwareScan, error)
+}
+
+// scanFiles scans the file at path, or every file under it if it is a
+// directory, stopping at the first infected one.
+func scanFiles(ctx context.Context, scanner string, path string, scan func(string) (string, error)) (*MalwareScan, error) {
+	result := &MalwareScan{Scanner: scanner, Verdict: MalwareVerdictClean}
+	err := filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		threat, err := scan(file)
+		if err != nil {
+			return fmt.Errorf("failed to scan %s: %w", file, err)
+		}
+		if threat != "" {
+			result.Verdict = MalwareVerdictInfected
+			result.Threat = threat
+			result.Path = file
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// clamdChunkSize is the size of the chunks files are streamed to clamd in,
+// well under its default StreamMaxLength.
+const clamdChunkSize = 64 * 1024
+
+// ClamdScanner scans files with a ClamAV daemon, streaming them over its
+// socket so clamd does not need access to the download directory.
+type ClamdScanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+var _ MalwareScanner = (*ClamdScanner)(nil)
+
+// NewClamdScanner creates a scanner for the clamd socket at address, either
+// a Unix socket path such as "/var/run/clamav/clamd.ctl" or "tcp://host:3310".
+// Each file must be scanned within timeout.
+func NewClamdScanner(address string, timeout time.Duration) *ClamdScanner {
+	network := "unix"
+	if rest, ok := strings.CutPrefix(address, "tcp://"); ok {
+		network, address = "tcp", rest
+	} else {
+		address = strings.TrimPrefix(address, "unix://")
+	}
+	return &ClamdScanner{network: network, address: address, timeout: timeout}
+}
+
+// Name returns "clamd".
+func (s *ClamdScanner) Name() string {
+	return "clamd"
+}
+
+// Scan streams the files at path to clamd.
+func (s *ClamdScanner) Scan(ctx context.Context, path string) (*MalwareScan, error) {
+	return scanFiles(ctx, s.Name(), path, func(file string) (string, error) {
+		return s.scanFile(ctx, file)
+	})
+}
+
+// scanFile streams a file to clamd with the INSTREAM command and returns
+// the threat it reports, if any.
+func (s *ClamdScanner) scanFile(ctx context.Context, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	dialer := &net.Dialer{Timeout: s.timeout}
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+	if s.timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(s.timeout))
+	}
+
+	w := bufio.NewWriterSize(conn, clamdChunkSize+4)
+	if _, err := w.WriteString("zINSTREAM\x00"); err != nil {
+		return "", fmt.Errorf("failed to send file to clamd: %w", err)
+	}
+	chunk := make([]byte, clamdChunkSize)
+	for {
+		n, err := f.Read(chunk)
+		if n > 0 {
+			if err := binary.Write(w, binary.BigEndian, uint32(n)); err != nil {
+				return "", fmt.Errorf("failed to send file to clamd: %w", err)
+			}
+			if _, err := w.Write(chunk[:n]); err != nil {
+				return "", fmt.Errorf("failed to send file to clamd: %w", err)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	// A zero-length chunk ends the stream
+	if err := binary.Write(w, binary.BigEndian, uint32(0)); err != nil {
+		return "", fmt.Errorf("failed to send file to clamd: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		return "", fmt.Errorf("failed to send file to clamd: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	return parseClamdReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// parseClamdReply parses a reply such as "stream: OK" or
+// "stream: Eicar-Signature FOUND" into the threat found.
+func parseClamdReply(reply string) (string, error) {
+	_, result, _ := strings.Cut(reply, ": ")
+	switch {
+	case result == "OK":
+		return "", nil
+	case strings.HasSuffix(result, " FOUND"):
+		return strings.TrimSuffix(result, " FOUND"), nil
+	default:
+		return "", fmt.Errorf("clamd scan failed: %s", reply)
+	}
+}
+
+// CommandScanner scans files with an external program run with the path
+// of each file as its last argument. Like clamscan, the program exits 0 for
+// clean files and 1 for infected ones, printing what it found; any other
+// exit is a failed scan.
+type CommandScanner struct {
+	command string
+	args    []string
+	timeout time.Duration
+}
+
+var _ MalwareScanner = (*CommandScanner)(nil)
+
+// NewCommandScanner creates a scanner running command with args. Each file
+// must be scanned within timeout.
+func NewCommandScanner(command string, args []string, timeout time.Duration) *CommandScanner {
+	return &CommandScanner{command: command, args: args, timeout: timeout}
+}
+
+// Name returns the base name of the command.
+func (s *CommandScanner) Name() string {
+	return filepath.Base(s.command)
+}
+
+// Scan runs the command on the files at path.
+func (s *CommandScanner) Scan(ctx context.Context, path string) (*MalwareScan, error) {
+	return scanFiles(ctx, s.Name(), path, func(file string) (string, error) {
+		return s.scanFile(ctx, file)
+	})
+}
+
+func (s *CommandScanner) scanFile(ctx context.Context, path string) (string, error) {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.command, append(append([]string{}, s.args...), path)...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err := cmd.Run()
+
+	var exit *exec.ExitError
+	switch {
+	case err == nil:
+		return "", nil
+	case errors.As(err, &exit) && exit.ExitCode() == 1:
+		return commandThreat(output.String(), path), nil
+	default:
+		return "", fmt.Errorf("%s failed: %w: %s", s.Name(), err, strings.TrimSpace(output.String()))
+	}
+}
+
+// commandThreat returns what a scanner printed about an infected file: the
+// threat of clamscan style "path: Threat FOUND" lines, or else the first
+// line of output.
+func commandThreat(output, path string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	for _, line := range lines {
+		if rest, ok := strings.CutPrefix(line, path+": "); ok {
+			return strings.TrimSuffix(strings.TrimSpace(rest), " FOUND")
+		}
+	}
+	if lines[0] != "" {
+		return strings.TrimSpace(lines[0])
+	}
+	return "flagged by " + filepath.Base(path)
+}
+
+// QuarantineDir is the directory infected downloads are moved to, next to
+// them, when no quarantine directory is configured.
+const QuarantineDir = ".quarantine"
+
+// QuarantinePath returns where an infected file of the download of a
+// workflow is quarantined: under dir, or QuarantineDir next to the file
+// when dir is empty, in a directory per workflow.
+func QuarantinePath(dir string, workflowID uuid.UUID, path string) string {
+	if dir == "" {
+		dir = filepath.Join(filepath.Dir(path), QuarantineDir)
+	}
+	return filepath.Join(dir, workflowID.String(), filepath.Base(path))
+}
@@ -0,0 +1,138 @@
+package domain_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+)
+
+// serveClamd answers INSTREAM scans on a Unix socket like clamd, flagging
+// streams that contain the EICAR marker.
+func serveClamd(t *testing.T) string {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "clamd.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				if command, err := r.ReadString(0); err != nil || command != "zINSTREAM\x00" {
+					_, _ = conn.Write([]byte("UNKNOWN COMMAND\x00"))
+					return
+				}
+				var stream bytes.Buffer
+				for {
+					var size uint32
+					if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+						return
+					}
+					if size == 0 {
+						break
+					}
+					if _, err := io.CopyN(&stream, r, int64(size)); err != nil {
+						return
+					}
+				}
+				if bytes.Contains(stream.Bytes(), []byte("EICAR")) {
+					_, _ = conn.Write([]byte("stream: Eicar-Signature FOUND\x00"))
+				} else {
+					_, _ = conn.Write([]byte("stream: OK\x00"))
+				}
+			}()
+		}
+	}()
+	return socket
+}
+
+func TestClamdScanner(t *testing.T) {
+	scanner := domain.NewClamdScanner("unix://"+serveClamd(t), 5*time.Second)
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	clean := filepath.Join(dir, "Movie.mkv")
+	require.NoError(t, os.WriteFile(clean, bytes.Repeat([]byte("movie"), 100_000), 0o644))
+
+	scan, err := scanner.Scan(ctx, clean)
+	require.NoError(t, err)
+	assert.Equal(t, domain.MalwareVerdictClean, scan.Verdict)
+	assert.Equal(t, "clamd", scan.Scanner)
+
+	infected := filepath.Join(dir, "Extras", "codec.exe")
+	require.NoError(t, os.MkdirAll(filepath.Dir(infected), 0o755))
+	require.NoError(t, os.WriteFile(infected, []byte("X5O!P%@AP EICAR-STANDARD-ANTIVIRUS-TEST-FILE"), 0o644))
+
+	scan, err = scanner.Scan(ctx, dir)
+	require.NoError(t, err)
+	assert.Equal(t, domain.MalwareVerdictInfected, scan.Verdict)
+	assert.Equal(t, "Eicar-Signature", scan.Threat)
+	assert.Equal(t, infected, scan.Path)
+
+	_, err = domain.NewClamdScanner(filepath.Join(dir, "missing.sock"), time.Second).Scan(ctx, clean)
+	assert.Error(t, err)
+}
+
+func TestCommandScanner(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "scan.sh")
+	require.NoError(t, os.WriteFile(script, []byte(`#!/bin/sh
+case "$2" in
+*.exe) echo "$2: Win.Trojan.Agent FOUND"; exit 1 ;;
+*.broken) echo "cannot read $2"; exit 2 ;;
+esac
+exit 0
+`), 0o755))
+	scanner := domain.NewCommandScanner(script, []string{"--no-summary"}, 5*time.Second)
+	ctx := context.Background()
+
+	downloads := t.TempDir()
+	clean := filepath.Join(downloads, "Movie.mkv")
+	require.NoError(t, os.WriteFile(clean, []byte("movie"), 0o644))
+
+	scan, err := scanner.Scan(ctx, downloads)
+	require.NoError(t, err)
+	assert.Equal(t, domain.MalwareVerdictClean, scan.Verdict)
+	assert.Equal(t, "scan.sh", scan.Scanner)
+
+	infected := filepath.Join(downloads, "Movie.mkv.exe")
+	require.NoError(t, os.WriteFile(infected, []byte("payload"), 0o644))
+	scan, err = scanner.Scan(ctx, downloads)
+	require.NoError(t, err)
+	assert.Equal(t, domain.MalwareVerdictInfected, scan.Verdict)
+	assert.Equal(t, "Win.Trojan.Agent", scan.Threat)
+	assert.Equal(t, infected, scan.Path)
+
+	broken := filepath.Join(t.TempDir(), "Movie.broken")
+	require.NoError(t, os.WriteFile(broken, []byte("movie"), 0o644))
+	_, err = scanner.Scan(ctx, broken)
+	assert.ErrorContains(t, err, "cannot read")
+}
+
+func TestQuarantinePath(t *testing.T) {
+	id := uuid.New()
+
+	assert.Equal(t, filepath.Join("/quarantine", id.String(), "codec.exe"),
+		domain.QuarantinePath("/quarantine", id, "/downloads/Movie/codec.exe"))
+	assert.Equal(t, filepath.Join("/downloads/Movie", domain.QuarantineDir, id.String(), "codec.exe"),
+		domain.QuarantinePath("", id, "/downloads/Movie/codec.exe"))
+}
@@ -0,0 +1,182 @@
+package domain
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// Import candidate scores range from 0 to 1.
+const (
+	// ImportCandidateThreshold is the score library items need to be
+	// offered as a match for a download.
+	ImportCandidateThreshold = 0.5
+	// ImportConfidentScore is the score a match needs to be imported
+	// without asking, if no other candidate comes within
+	// ImportConfidentMargin of it.
+	ImportConfidentScore  = 0.9
+	ImportConfidentMargin = 0.2
+)
+
+// ManualImportStatus is the state of a parked import.
+type ManualImportStatus string
+
+const (
+	ManualImportPending  ManualImportStatus = "pending"
+	ManualImportImported ManualImportStatus = "imported"
+	ManualImportRejected ManualImportStatus = "rejected"
+)
+
+// ImportCandidate is a library item a download may be a file of.
+type ImportCandidate struct {
+	MediaID uuid.UUID `json:"media_id"`
+	Title   string    `json:"title"`
+	Year    int       `json:"year,omitempty"`
+	Score   float64   `json:"score"`
+}
+
+// ManualImport is a completed download that could not be matched to a
+// library item with confidence, or that was not imported over the file of
+// its item. It waits for an admin to pick the item it belongs to, import
+// it as a new item, or reject it.
+type ManualImport struct {
+	ID         uuid.UUID
+	LibraryID  uuid.UUID
+	WorkflowID uuid.UUID
+	// MediaID is the ID of the workflow, given to the file if it is
+	// imported as a new item.
+	MediaID        uuid.UUID
+	Path           string
+	DownloadClient string
+	// Release identifies the downloaded release, if the workflow named it,
+	// so rejecting the file blocklists it.
+	Release ReleaseIdentity
+	// Title and Year are parsed from the file name.
+	Title      string
+	Year       int
+	Candidates []ImportCandidate
+	// Replacement compares the file with the file of the item it matched,
+	// if the item has one and the file was not better by the replace
+	// rules.
+	Replacement *FileComparison
+	Status      ManualImportStatus
+	// ImportedMediaID is the item the file was imported as.
+	ImportedMediaID *uuid.UUID
+	CreatedAt       time.Time
+	ResolvedAt      *time.Time
+}
+
+// Candidate returns the candidate for a library item, or nil.
+func (m *ManualImport) Candidate(mediaID uuid.UUID) *ImportCandidate {
+	for i := range m.Candidates {
+		if m.Candidates[i].MediaID == mediaID {
+			return &m.Candidates[i]
+		}
+	}
+	return nil
+}
+
+var importYearPattern = regexp.MustCompile(`(?:^|[^0-9])((?:19|20)[0-9]{2})(?:[^0-9]|$)`)
+
+// ExtractYear returns the release year in a file name, or 0. The last
+// year wins, as titles can contain years too.
+func ExtractYear(path string) int {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	matches := importYearPattern.FindAllStringSubmatch(name, -1)
+	if len(matches) == 0 {
+		return 0
+	}
+	year, _ := strconv.Atoi(matches[len(matches)-1][1])
+	return year
+}
+
+// MatchImportCandidates scores library items against the title and year
+// parsed from a download, and returns those that may be its item, best
+// first.
+func MatchImportCandidates(title string, year int, media []*models.Media) []ImportCandidate {
+	var candidates []ImportCandidate
+	for _, item := range media {
+		score := scoreImportCandidate(title, year, item)
+		if score < ImportCandidateThreshold {
+			continue
+		}
+		candidates = append(candidates, ImportCandidate{
+			MediaID: item.ID,
+			Title:   item.Title,
+			Year:    item.Year,
+			Score:   score,
+		})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	return candidates
+}
+
+// ConfidentMatch returns the candidate to import into without asking, or
+// nil if there is none or the best ones are too close to tell apart.
+func ConfidentMatch(candidates []ImportCandidate) *ImportCandidate {
+	if len(candidates) == 0 || candidates[0].Score < ImportConfidentScore {
+		return nil
+	}
+	if len(candidates) > 1 && candidates[0].Score-candidates[1].Score < ImportConfidentMargin {
+		return nil
+	}
+	return &candidates[0]
+}
+
+// scoreImportCandidate compares the words of the titles, then discounts
+// items of another year. Unknown years are not held against an item.
+func scoreImportCandidate(title string, year int, item *models.Media) float64 {
+	score := titleSimilarity(title, item.Title)
+	if year > 0 && item.Year > 0 {
+		switch diff := year - item.Year; {
+		case diff == 0:
+		case diff == 1 || diff == -1:
+			// Festival and theatrical releases straddle years
+			score *= 0.9
+		default:
+			score *= 0.5
+		}
+	}
+	return score
+}
+
+// titleSimilarity is the Dice coefficient of the words of two titles.
+func titleSimilarity(a, b string) float64 {
+	wordsA, wordsB := titleWords(a), titleWords(b)
+	if len(wordsA) == 0 || len(wordsB) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for word, count := range wordsA {
+		shared += min(count, wordsB[word])
+	}
+	total := 0
+	for _, count := range wordsA {
+		total += count
+	}
+	for _, count := range wordsB {
+		total += count
+	}
+	return 2 * float64(shared) / float64(total)
+}
+
+func titleWords(title string) map[string]int {
+	words := make(map[string]int)
+	for _, word := range strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !('a' <= r && r <= 'z' || '0' <= r && r <= '9' || r > 127)
+	}) {
+		words[word]++
+	}
+	return words
+}
@@ -0,0 +1,45 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+func TestExtractYear(t *testing.T) {
+	assert.Equal(t, 2021, domain.ExtractYear("/downloads/Dune.2021.1080p.WEB.mkv"))
+	assert.Equal(t, 2017, domain.ExtractYear("Blade Runner 2049 (2017).mkv"), "last year wins")
+	assert.Equal(t, 0, domain.ExtractYear("Dune.1080p.mkv"))
+}
+
+func TestMatchImportCandidates(t *testing.T) {
+	dune1984 := &models.Media{ID: uuid.New(), Title: "Dune", Year: 1984}
+	dune2021 := &models.Media{ID: uuid.New(), Title: "Dune", Year: 2021}
+	other := &models.Media{ID: uuid.New(), Title: "Arrival", Year: 2016}
+	media := []*models.Media{dune1984, dune2021, other}
+
+	// The year settles it
+	candidates := domain.MatchImportCandidates("Dune", 2021, media)
+	require.Len(t, candidates, 2)
+	assert.Equal(t, dune2021.ID, candidates[0].MediaID)
+	match := domain.ConfidentMatch(candidates)
+	require.NotNil(t, match)
+	assert.Equal(t, dune2021.ID, match.MediaID)
+
+	// Without a year both are as likely
+	candidates = domain.MatchImportCandidates("Dune", 0, media)
+	require.Len(t, candidates, 2)
+	assert.Nil(t, domain.ConfidentMatch(candidates))
+
+	// A partial title is offered but not imported
+	candidates = domain.MatchImportCandidates("Dune Part Two", 0, media)
+	require.NotEmpty(t, candidates)
+	assert.Nil(t, domain.ConfidentMatch(candidates))
+
+	assert.Empty(t, domain.MatchImportCandidates("Heat", 1995, media))
+}
@@ -0,0 +1,122 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MaxIssueCommentLength bounds the comment of a media issue, in bytes.
+const MaxIssueCommentLength = 2000
+
+// IssueCategory is what is wrong with a media item.
+type IssueCategory string
+
+const (
+	IssueWrongAudio       IssueCategory = "wrong_audio"
+	IssueBadQuality       IssueCategory = "bad_quality"
+	IssueMissingSubtitles IssueCategory = "missing_subtitles"
+	IssueWrongMetadata    IssueCategory = "wrong_metadata"
+	IssueOther            IssueCategory = "other"
+)
+
+// ParseIssueCategory parses an issue category.
+func ParseIssueCategory(s string) (IssueCategory, error) {
+	switch c := IssueCategory(s); c {
+	case IssueWrongAudio, IssueBadQuality, IssueMissingSubtitles, IssueWrongMetadata, IssueOther:
+		return c, nil
+	}
+	return "", fmt.Errorf("unknown issue category %q", s)
+}
+
+// IssueStatus is whether a media issue was dealt with.
+type IssueStatus string
+
+const (
+	IssueOpen     IssueStatus = "open"
+	IssueResolved IssueStatus = "resolved"
+)
+
+// IssueAction is what an admin did about a media issue when resolving it.
+type IssueAction string
+
+const (
+	// IssueActionNone resolves an issue without acting on the media, such
+	// as one that was fixed already or is not a problem.
+	IssueActionNone IssueAction = "none"
+	// IssueActionRedownload marks a movie missing, so the wanted searches
+	// acquire it again.
+	IssueActionRedownload IssueAction = "redownload"
+	// IssueActionRetranscode requests the transcodes of the media again.
+	IssueActionRetranscode IssueAction = "retranscode"
+	// IssueActionRefreshMetadata fetches the metadata of the media again.
+	IssueActionRefreshMetadata IssueAction = "refresh_metadata"
+)
+
+// ParseIssueAction parses an issue action. An empty action is none.
+func ParseIssueAction(s string) (IssueAction, error) {
+	switch a := IssueAction(s); a {
+	case "":
+		return IssueActionNone, nil
+	case IssueActionNone, IssueActionRedownload, IssueActionRetranscode, IssueActionRefreshMetadata:
+		return a, nil
+	}
+	return "", fmt.Errorf("unknown issue action %q", s)
+}
+
+// MediaIssue is a problem a user reported with a media item, such as wrong
+// audio or missing subtitles.
+type MediaIssue struct {
+	ID       uuid.UUID
+	TenantID uuid.UUID
+	MediaID  uuid.UUID
+	// EpisodeID narrows the issue to an episode of a series.
+	EpisodeID *uuid.UUID
+	UserID    uuid.UUID
+	Category  IssueCategory
+	Comment   string
+	Status    IssueStatus
+	// Action and Resolution are what the admin who resolved the issue did
+	// and told the reporter.
+	Action     IssueAction
+	Resolution string
+	ResolvedBy *uuid.UUID
+	CreatedAt  time.Time
+	ResolvedAt *time.Time
+}
+
+// Validate checks a new issue.
+func (i *MediaIssue) Validate() error {
+	if i.MediaID == uuid.Nil {
+		return errors.New("media ID is required")
+	}
+	if _, err := ParseIssueCategory(string(i.Category)); err != nil {
+		return err
+	}
+	if len(i.Comment) > MaxIssueCommentLength {
+		return fmt.Errorf("comment is longer than %d bytes", MaxIssueCommentLength)
+	}
+	return nil
+}
+
+// Resolve records the resolution of an open issue.
+func (i *MediaIssue) Resolve(by uuid.UUID, action IssueAction, resolution string, at time.Time) error {
+	if i.Status != IssueOpen {
+		return fmt.Errorf("issue is %s, not open", i.Status)
+	}
+	i.Status = IssueResolved
+	i.Action = action
+	i.Resolution = resolution
+	i.ResolvedBy = &by
+	i.ResolvedAt = &at
+	return nil
+}
+
+// MediaIssueFilter narrows the issues listed.
+type MediaIssueFilter struct {
+	UserID  *uuid.UUID
+	MediaID *uuid.UUID
+	Status  IssueStatus
+}
@@ -0,0 +1,51 @@
+package domain_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+)
+
+func TestMediaIssueValidate(t *testing.T) {
+	issue := &domain.MediaIssue{MediaID: uuid.New(), Category: domain.IssueWrongAudio, Comment: "German dub"}
+	require.NoError(t, issue.Validate())
+
+	issue.Category = "broken"
+	assert.Error(t, issue.Validate())
+	issue.Category = domain.IssueOther
+	issue.Comment = strings.Repeat("x", domain.MaxIssueCommentLength+1)
+	assert.Error(t, issue.Validate())
+}
+
+func TestMediaIssueResolve(t *testing.T) {
+	admin := uuid.New()
+	now := time.Now()
+	issue := &domain.MediaIssue{Status: domain.IssueOpen}
+
+	require.NoError(t, issue.Resolve(admin, domain.IssueActionRetranscode, "Transcoding again", now))
+	assert.Equal(t, domain.IssueResolved, issue.Status)
+	assert.Equal(t, domain.IssueActionRetranscode, issue.Action)
+	assert.Equal(t, admin, *issue.ResolvedBy)
+	assert.Equal(t, now, *issue.ResolvedAt)
+
+	assert.Error(t, issue.Resolve(admin, domain.IssueActionNone, "", now), "issues are resolved once")
+}
+
+func TestParseIssueAction(t *testing.T) {
+	action, err := domain.ParseIssueAction("")
+	require.NoError(t, err)
+	assert.Equal(t, domain.IssueActionNone, action)
+
+	action, err = domain.ParseIssueAction("refresh_metadata")
+	require.NoError(t, err)
+	assert.Equal(t, domain.IssueActionRefreshMetadata, action)
+
+	_, err = domain.ParseIssueAction("delete")
+	assert.Error(t, err)
+}
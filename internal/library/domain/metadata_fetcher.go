@@ -10,15 +10,34 @@ import (
 	"github.com/narwhalmedia/narwhal/pkg/models"
 )
 
-// MetadataProvider interface for external metadata providers.
+// MetadataProviderTypeAnime is the type of providers covering anime movies
+// and series, which are only used for anime libraries.
+const MetadataProviderTypeAnime = "anime"
+
+// MetadataProvider interface for external metadata providers. Providers
+// return metadata in the language and region of the preferences where
+// they can.
 type MetadataProvider interface {
 	GetName() string
+	// GetType returns the media the provider covers: movie, tv, all,
+	// anime or music_video.
 	GetType() string
-	SearchMovie(ctx context.Context, query string, year int) ([]models.SearchResult, error)
-	SearchTV(ctx context.Context, query string, year int) ([]models.SearchResult, error)
-	GetMovieDetails(ctx context.Context, providerID string) (*models.Metadata, error)
-	GetTVDetails(ctx context.Context, providerID string) (*models.Metadata, error)
-	GetEpisodeDetails(ctx context.Context, providerID string, season, episode int) (*models.EpisodeMetadata, error)
+	SearchMovie(ctx context.Context, query string, year int, prefs MetadataPreferences) ([]models.SearchResult, error)
+	SearchTV(ctx context.Context, query string, year int, prefs MetadataPreferences) ([]models.SearchResult, error)
+	GetMovieDetails(ctx context.Context, providerID string, prefs MetadataPreferences) (*models.Metadata, error)
+	GetTVDetails(ctx context.Context, providerID string, prefs MetadataPreferences) (*models.Metadata, error)
+	GetEpisodeDetails(
+		ctx context.Context,
+		providerID string,
+		season, episode int,
+		prefs MetadataPreferences,
+	) (*models.EpisodeMetadata, error)
+}
+
+// SeriesIDProvider is implemented by metadata providers that identify
+// series by their own IDs rather than TVDB or TMDB ones.
+type SeriesIDProvider interface {
+	SeriesID(metadata *models.Metadata) string
 }
 
 // MetadataFetcher manages metadata providers and fetching.
@@ -67,13 +86,15 @@ func (f *MetadataFetcher) GetProviders() []MetadataProvider {
 	return providers
 }
 
-// FetchMetadata fetches metadata for a media item.
-func (f *MetadataFetcher) FetchMetadata(ctx context.Context, media *models.Media) (*models.Metadata, error) {
-	f.mu.RLock()
-	providers := make([]MetadataProvider, len(f.providers))
-	copy(providers, f.providers)
-	f.mu.RUnlock()
-
+// FetchMetadata fetches metadata for a media item with the metadata
+// preferences of its library.
+func (f *MetadataFetcher) FetchMetadata(
+	ctx context.Context,
+	media *models.Media,
+	library *Library,
+) (*models.Metadata, error) {
+	prefs := library.MetadataPreferences
+	providers := f.providersFor(library)
 	if len(providers) == 0 {
 		return nil, errors.New("no metadata providers registered")
 	}
@@ -86,15 +107,21 @@ func (f *MetadataFetcher) FetchMetadata(ctx context.Context, media *models.Media
 		// Search based on media type
 		switch media.Type {
 		case models.MediaTypeMovie:
-			if provider.GetType() != "movie" && provider.GetType() != "all" {
+			if !providerCovers(provider, "movie") {
 				continue
 			}
-			searchResults, err = provider.SearchMovie(ctx, media.Title, media.Year)
+			searchResults, err = provider.SearchMovie(ctx, media.Title, media.Year, prefs)
 		case models.MediaTypeTV, models.MediaTypeSeries:
-			if provider.GetType() != "tv" && provider.GetType() != "all" {
+			if !providerCovers(provider, "tv") {
 				continue
 			}
-			searchResults, err = provider.SearchTV(ctx, media.Title, media.Year)
+			searchResults, err = provider.SearchTV(ctx, media.Title, media.Year, prefs)
+		case models.MediaTypeMusicVideo:
+			videos, ok := provider.(MusicVideoProvider)
+			if !ok {
+				continue
+			}
+			searchResults, err = videos.SearchMusicVideo(ctx, media.Artist, media.Title, prefs)
 		default:
 			return nil, fmt.Errorf("unsupported media type: %s", media.Type)
 		}
@@ -117,9 +144,11 @@ func (f *MetadataFetcher) FetchMetadata(ctx context.Context, media *models.Media
 		var metadata *models.Metadata
 		switch media.Type {
 		case models.MediaTypeMovie:
-			metadata, err = provider.GetMovieDetails(ctx, result.ProviderID)
+			metadata, err = provider.GetMovieDetails(ctx, result.ProviderID, prefs)
 		case models.MediaTypeTV, models.MediaTypeSeries:
-			metadata, err = provider.GetTVDetails(ctx, result.ProviderID)
+			metadata, err = provider.GetTVDetails(ctx, result.ProviderID, prefs)
+		case models.MediaTypeMusicVideo:
+			metadata, err = provider.(MusicVideoProvider).GetMusicVideoDetails(ctx, result.ProviderID, prefs)
 		}
 
 		if err != nil {
@@ -131,6 +160,9 @@ func (f *MetadataFetcher) FetchMetadata(ctx context.Context, media *models.Media
 
 		if metadata != nil {
 			metadata.MediaID = media.ID
+			if prefs.TitleStyle == TitleStyleOriginal && metadata.OriginalTitle != "" {
+				metadata.Title = metadata.OriginalTitle
+			}
 			return metadata, nil
 		}
 	}
@@ -138,34 +170,29 @@ func (f *MetadataFetcher) FetchMetadata(ctx context.Context, media *models.Media
 	return nil, fmt.Errorf("no metadata found for media: %s", media.Title)
 }
 
-// FetchEpisodeMetadata fetches metadata for a specific episode.
+// FetchEpisodeMetadata fetches metadata for a specific episode with the
+// metadata preferences of its library.
 func (f *MetadataFetcher) FetchEpisodeMetadata(
 	ctx context.Context,
 	seriesMetadata *models.Metadata,
 	season, episode int,
+	library *Library,
 ) (*models.EpisodeMetadata, error) {
-	f.mu.RLock()
-	providers := make([]MetadataProvider, len(f.providers))
-	copy(providers, f.providers)
-	f.mu.RUnlock()
+	prefs := library.MetadataPreferences
 
 	// Try each provider that supports TV
-	for _, provider := range providers {
-		if provider.GetType() != "tv" && provider.GetType() != "all" {
+	for _, provider := range f.providersFor(library) {
+		if !providerCovers(provider, "tv") {
 			continue
 		}
 
 		// Try different provider IDs
-		var providerID string
-		if seriesMetadata.TVDBID != "" {
-			providerID = seriesMetadata.TVDBID
-		} else if seriesMetadata.TMDBID != "" {
-			providerID = seriesMetadata.TMDBID
-		} else {
+		providerID := seriesID(provider, seriesMetadata)
+		if providerID == "" {
 			continue
 		}
 
-		episodeMetadata, err := provider.GetEpisodeDetails(ctx, providerID, season, episode)
+		episodeMetadata, err := provider.GetEpisodeDetails(ctx, providerID, season, episode, prefs)
 		if err != nil {
 			f.logger.Error("Failed to get episode metadata",
 				interfaces.String("provider", provider.GetName()),
@@ -180,3 +207,125 @@ func (f *MetadataFetcher) FetchEpisodeMetadata(
 
 	return nil, fmt.Errorf("no episode metadata found for S%02dE%02d", season, episode)
 }
+
+// SearchTitles searches the providers covering a movie or series media
+// type for titles, in the order the providers were registered. Providers
+// that fail are skipped. Anime providers are left out.
+func (f *MetadataFetcher) SearchTitles(
+	ctx context.Context,
+	mediaType models.MediaType,
+	query string,
+	year int,
+	prefs MetadataPreferences,
+) ([]models.SearchResult, error) {
+	providers := f.providersFor(&Library{})
+	if len(providers) == 0 {
+		return nil, errors.New("no metadata providers registered")
+	}
+
+	var results []models.SearchResult
+	for _, provider := range providers {
+		var found []models.SearchResult
+		var err error
+		switch mediaType {
+		case models.MediaTypeMovie:
+			if !providerCovers(provider, "movie") {
+				continue
+			}
+			found, err = provider.SearchMovie(ctx, query, year, prefs)
+		case models.MediaTypeTV, models.MediaTypeSeries:
+			if !providerCovers(provider, "tv") {
+				continue
+			}
+			found, err = provider.SearchTV(ctx, query, year, prefs)
+		default:
+			return nil, fmt.Errorf("unsupported media type: %s", mediaType)
+		}
+
+		if err != nil {
+			f.logger.Error("Provider search failed",
+				interfaces.String("provider", provider.GetName()),
+				interfaces.String("error", err.Error()))
+			continue
+		}
+		for _, result := range found {
+			if result.ProviderName == "" {
+				result.ProviderName = provider.GetName()
+			}
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// TitleDetails fetches the details of a movie or series from the provider
+// of the given name.
+func (f *MetadataFetcher) TitleDetails(
+	ctx context.Context,
+	providerName, providerID string,
+	mediaType models.MediaType,
+	prefs MetadataPreferences,
+) (*models.Metadata, error) {
+	var provider MetadataProvider
+	for _, p := range f.GetProviders() {
+		if p.GetName() == providerName {
+			provider = p
+			break
+		}
+	}
+	if provider == nil {
+		return nil, fmt.Errorf("unknown metadata provider %q", providerName)
+	}
+
+	switch mediaType {
+	case models.MediaTypeMovie:
+		return provider.GetMovieDetails(ctx, providerID, prefs)
+	case models.MediaTypeTV, models.MediaTypeSeries:
+		return provider.GetTVDetails(ctx, providerID, prefs)
+	default:
+		return nil, fmt.Errorf("unsupported media type: %s", mediaType)
+	}
+}
+
+// providersFor returns the providers metadata of a library is fetched from,
+// in the order they are tried. Anime providers come first for anime
+// libraries and are left out for others.
+func (f *MetadataFetcher) providersFor(library *Library) []MetadataProvider {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var anime, other []MetadataProvider
+	for _, provider := range f.providers {
+		if provider.GetType() == MetadataProviderTypeAnime {
+			anime = append(anime, provider)
+		} else {
+			other = append(other, provider)
+		}
+	}
+	if !library.Anime {
+		return other
+	}
+	return append(anime, other...)
+}
+
+// providerCovers reports whether a provider covers movie or tv media.
+func providerCovers(provider MetadataProvider, mediaType string) bool {
+	switch provider.GetType() {
+	case mediaType, "all", MetadataProviderTypeAnime:
+		return true
+	default:
+		return false
+	}
+}
+
+// seriesID returns the ID a provider knows a series by, or an empty string
+// if the series has none.
+func seriesID(provider MetadataProvider, metadata *models.Metadata) string {
+	if p, ok := provider.(SeriesIDProvider); ok {
+		return p.SeriesID(metadata)
+	}
+	if metadata.TVDBID != "" {
+		return metadata.TVDBID
+	}
+	return metadata.TMDBID
+}
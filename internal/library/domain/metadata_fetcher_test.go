@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
 
@@ -28,32 +29,50 @@ func (m *MockMetadataProvider) GetType() string {
 	return args.String(0)
 }
 
-func (m *MockMetadataProvider) SearchMovie(ctx context.Context, query string, year int) ([]models.SearchResult, error) {
-	args := m.Called(ctx, query, year)
+func (m *MockMetadataProvider) SearchMovie(
+	ctx context.Context,
+	query string,
+	year int,
+	prefs domain.MetadataPreferences,
+) ([]models.SearchResult, error) {
+	args := m.Called(ctx, query, year, prefs)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).([]models.SearchResult), args.Error(1)
 }
 
-func (m *MockMetadataProvider) SearchTV(ctx context.Context, query string, year int) ([]models.SearchResult, error) {
-	args := m.Called(ctx, query, year)
+func (m *MockMetadataProvider) SearchTV(
+	ctx context.Context,
+	query string,
+	year int,
+	prefs domain.MetadataPreferences,
+) ([]models.SearchResult, error) {
+	args := m.Called(ctx, query, year, prefs)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).([]models.SearchResult), args.Error(1)
 }
 
-func (m *MockMetadataProvider) GetMovieDetails(ctx context.Context, providerID string) (*models.Metadata, error) {
-	args := m.Called(ctx, providerID)
+func (m *MockMetadataProvider) GetMovieDetails(
+	ctx context.Context,
+	providerID string,
+	prefs domain.MetadataPreferences,
+) (*models.Metadata, error) {
+	args := m.Called(ctx, providerID, prefs)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*models.Metadata), args.Error(1)
 }
 
-func (m *MockMetadataProvider) GetTVDetails(ctx context.Context, providerID string) (*models.Metadata, error) {
-	args := m.Called(ctx, providerID)
+func (m *MockMetadataProvider) GetTVDetails(
+	ctx context.Context,
+	providerID string,
+	prefs domain.MetadataPreferences,
+) (*models.Metadata, error) {
+	args := m.Called(ctx, providerID, prefs)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
@@ -64,24 +83,59 @@ func (m *MockMetadataProvider) GetEpisodeDetails(
 	ctx context.Context,
 	providerID string,
 	season, episode int,
+	prefs domain.MetadataPreferences,
 ) (*models.EpisodeMetadata, error) {
-	args := m.Called(ctx, providerID, season, episode)
+	args := m.Called(ctx, providerID, season, episode, prefs)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*models.EpisodeMetadata), args.Error(1)
 }
 
+// MockMusicVideoProvider is a mock metadata provider that also looks music
+// videos up.
+type MockMusicVideoProvider struct {
+	MockMetadataProvider
+}
+
+func (m *MockMusicVideoProvider) SearchMusicVideo(
+	ctx context.Context,
+	artist, title string,
+	prefs domain.MetadataPreferences,
+) ([]models.SearchResult, error) {
+	args := m.Called(ctx, artist, title, prefs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.SearchResult), args.Error(1)
+}
+
+func (m *MockMusicVideoProvider) GetMusicVideoDetails(
+	ctx context.Context,
+	providerID string,
+	prefs domain.MetadataPreferences,
+) (*models.Metadata, error) {
+	args := m.Called(ctx, providerID, prefs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Metadata), args.Error(1)
+}
+
 type MetadataFetcherTestSuite struct {
 	suite.Suite
 
 	ctx          context.Context
+	prefs        domain.MetadataPreferences
+	library      *domain.Library
 	fetcher      *domain.MetadataFetcher
 	mockProvider *MockMetadataProvider
 }
 
 func (suite *MetadataFetcherTestSuite) SetupTest() {
 	suite.ctx = context.Background()
+	suite.prefs = domain.MetadataPreferences{Language: "en-US", Region: "US", TitleStyle: domain.TitleStyleTranslated}
+	suite.library = &domain.Library{MetadataPreferences: suite.prefs}
 	suite.mockProvider = new(MockMetadataProvider)
 	suite.fetcher = domain.NewMetadataFetcher(logger.NewNoopLogger())
 
@@ -127,11 +181,11 @@ func (suite *MetadataFetcherTestSuite) TestFetchMovieMetadata_Success() {
 	}
 
 	suite.mockProvider.On("GetType").Return("movie")
-	suite.mockProvider.On("SearchMovie", suite.ctx, "Test Movie", 2023).Return(searchResults, nil)
-	suite.mockProvider.On("GetMovieDetails", suite.ctx, "tmdb123").Return(expectedMetadata, nil)
+	suite.mockProvider.On("SearchMovie", suite.ctx, "Test Movie", 2023, suite.prefs).Return(searchResults, nil)
+	suite.mockProvider.On("GetMovieDetails", suite.ctx, "tmdb123", suite.prefs).Return(expectedMetadata, nil)
 
 	// Act
-	metadata, err := suite.fetcher.FetchMetadata(suite.ctx, media)
+	metadata, err := suite.fetcher.FetchMetadata(suite.ctx, media, suite.library)
 
 	// Assert
 	suite.Require().NoError(err)
@@ -171,11 +225,11 @@ func (suite *MetadataFetcherTestSuite) TestFetchTVMetadata_Success() {
 	}
 
 	suite.mockProvider.On("GetType").Return("tv")
-	suite.mockProvider.On("SearchTV", suite.ctx, "Test Series", 2023).Return(searchResults, nil)
-	suite.mockProvider.On("GetTVDetails", suite.ctx, "tvdb123").Return(expectedMetadata, nil)
+	suite.mockProvider.On("SearchTV", suite.ctx, "Test Series", 2023, suite.prefs).Return(searchResults, nil)
+	suite.mockProvider.On("GetTVDetails", suite.ctx, "tvdb123", suite.prefs).Return(expectedMetadata, nil)
 
 	// Act
-	metadata, err := suite.fetcher.FetchMetadata(suite.ctx, media)
+	metadata, err := suite.fetcher.FetchMetadata(suite.ctx, media, suite.library)
 
 	// Assert
 	suite.Require().NoError(err)
@@ -184,6 +238,97 @@ func (suite *MetadataFetcherTestSuite) TestFetchTVMetadata_Success() {
 	suite.Equal(expectedMetadata.TVDBID, metadata.TVDBID)
 }
 
+func (suite *MetadataFetcherTestSuite) TestFetchMetadata_OriginalTitleStyle() {
+	// Arrange
+	media := &models.Media{
+		ID:    uuid.New(),
+		Title: "Spirited Away",
+		Type:  models.MediaTypeMovie,
+		Year:  2001,
+	}
+	prefs := domain.MetadataPreferences{Language: "de", Region: "DE", TitleStyle: domain.TitleStyleOriginal}
+
+	searchResults := []models.SearchResult{{ProviderID: "tmdb129", Title: "Chihiros Reise ins Zauberland", Year: 2001}}
+	details := &models.Metadata{
+		TMDBID:        "tmdb129",
+		Title:         "Chihiros Reise ins Zauberland",
+		OriginalTitle: "千と千尋の神隠し",
+		Certification: "6",
+	}
+
+	suite.mockProvider.On("SearchMovie", suite.ctx, "Spirited Away", 2001, prefs).Return(searchResults, nil)
+	suite.mockProvider.On("GetMovieDetails", suite.ctx, "tmdb129", prefs).Return(details, nil)
+
+	// Act
+	metadata, err := suite.fetcher.FetchMetadata(suite.ctx, media, &domain.Library{MetadataPreferences: prefs})
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Equal("千と千尋の神隠し", metadata.Title)
+	suite.Equal("6", metadata.Certification)
+}
+
+func (suite *MetadataFetcherTestSuite) TestFetchMetadata_AnimeProviders() {
+	// Arrange
+	media := &models.Media{
+		ID:    uuid.New(),
+		Title: "Frieren",
+		Type:  models.MediaTypeTV,
+		Year:  2023,
+	}
+	animeProvider := new(MockMetadataProvider)
+	animeProvider.On("GetName").Return("anilist")
+	animeProvider.On("GetType").Return(domain.MetadataProviderTypeAnime)
+	suite.fetcher.RegisterProvider(animeProvider)
+
+	anime := &domain.Library{Anime: true, MetadataPreferences: suite.prefs}
+	animeProvider.On("SearchTV", suite.ctx, "Frieren", 2023, suite.prefs).
+		Return([]models.SearchResult{{ProviderID: "154587"}}, nil).Once()
+	animeProvider.On("GetTVDetails", suite.ctx, "154587", suite.prefs).
+		Return(&models.Metadata{Title: "Frieren: Beyond Journey's End", AniListID: "154587"}, nil).Once()
+	suite.mockProvider.On("SearchTV", suite.ctx, "Frieren", 2023, suite.prefs).
+		Return([]models.SearchResult{}, nil).Once()
+
+	// Act: anime libraries try anime providers first, other libraries
+	// leave them out
+	animeMetadata, animeErr := suite.fetcher.FetchMetadata(suite.ctx, media, anime)
+	_, err := suite.fetcher.FetchMetadata(suite.ctx, media, suite.library)
+
+	// Assert
+	suite.Require().NoError(animeErr)
+	suite.Equal("154587", animeMetadata.AniListID)
+	suite.Require().Error(err)
+	animeProvider.AssertExpectations(suite.T())
+}
+
+func (suite *MetadataFetcherTestSuite) TestFetchMetadata_MusicVideoProviders() {
+	// Arrange
+	media := &models.Media{
+		ID:     uuid.New(),
+		Title:  "Around The World",
+		Artist: "Daft Punk",
+		Type:   models.MediaTypeMusicVideo,
+	}
+	videoProvider := new(MockMusicVideoProvider)
+	videoProvider.On("GetName").Return("imvdb")
+	videoProvider.On("GetType").Return(domain.MetadataProviderTypeMusicVideo)
+	suite.fetcher.RegisterProvider(videoProvider)
+
+	videoProvider.On("SearchMusicVideo", suite.ctx, "Daft Punk", "Around The World", suite.prefs).
+		Return([]models.SearchResult{{ProviderID: "121779770452"}}, nil).Once()
+	videoProvider.On("GetMusicVideoDetails", suite.ctx, "121779770452", suite.prefs).
+		Return(&models.Metadata{Title: "Around the World", IMVDbID: "121779770452"}, nil).Once()
+
+	// Act: providers that cannot look music videos up are skipped
+	metadata, err := suite.fetcher.FetchMetadata(suite.ctx, media, suite.library)
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Equal("121779770452", metadata.IMVDbID)
+	suite.Equal(media.ID, metadata.MediaID)
+	videoProvider.AssertExpectations(suite.T())
+}
+
 func (suite *MetadataFetcherTestSuite) TestFetchMetadata_NoResults() {
 	// Arrange
 	media := &models.Media{
@@ -194,10 +339,10 @@ func (suite *MetadataFetcherTestSuite) TestFetchMetadata_NoResults() {
 	}
 
 	suite.mockProvider.On("GetType").Return("movie")
-	suite.mockProvider.On("SearchMovie", suite.ctx, "Unknown Movie", 2023).Return([]models.SearchResult{}, nil)
+	suite.mockProvider.On("SearchMovie", suite.ctx, "Unknown Movie", 2023, suite.prefs).Return([]models.SearchResult{}, nil)
 
 	// Act
-	metadata, err := suite.fetcher.FetchMetadata(suite.ctx, media)
+	metadata, err := suite.fetcher.FetchMetadata(suite.ctx, media, suite.library)
 
 	// Assert
 	suite.Require().Error(err)
@@ -214,7 +359,7 @@ func (suite *MetadataFetcherTestSuite) TestFetchMetadata_InvalidMediaType() {
 	}
 
 	// Act
-	metadata, err := suite.fetcher.FetchMetadata(suite.ctx, media)
+	metadata, err := suite.fetcher.FetchMetadata(suite.ctx, media, suite.library)
 
 	// Assert
 	suite.Require().Error(err)
@@ -239,10 +384,10 @@ func (suite *MetadataFetcherTestSuite) TestFetchEpisodeMetadata_Success() {
 	}
 
 	suite.mockProvider.On("GetType").Return("tv")
-	suite.mockProvider.On("GetEpisodeDetails", suite.ctx, "tvdb123", 1, 1).Return(expectedEpisodeMetadata, nil)
+	suite.mockProvider.On("GetEpisodeDetails", suite.ctx, "tvdb123", 1, 1, suite.prefs).Return(expectedEpisodeMetadata, nil)
 
 	// Act
-	episodeMetadata, err := suite.fetcher.FetchEpisodeMetadata(suite.ctx, seriesMetadata, 1, 1)
+	episodeMetadata, err := suite.fetcher.FetchEpisodeMetadata(suite.ctx, seriesMetadata, 1, 1, suite.library)
 
 	// Assert
 	suite.Require().NoError(err)
@@ -293,7 +438,7 @@ func (suite *MetadataFetcherTestSuite) TestFetchMetadata_MultipleProviders() {
 
 	// First provider returns no results
 	suite.mockProvider.On("GetType").Return("movie")
-	suite.mockProvider.On("SearchMovie", suite.ctx, "Test Movie", 2023).Return([]models.SearchResult{}, nil)
+	suite.mockProvider.On("SearchMovie", suite.ctx, "Test Movie", 2023, suite.prefs).Return([]models.SearchResult{}, nil)
 
 	// Second provider returns results
 	searchResults := []models.SearchResult{
@@ -311,14 +456,14 @@ func (suite *MetadataFetcherTestSuite) TestFetchMetadata_MultipleProviders() {
 		Title:   "Test Movie",
 	}
 
-	mockProvider2.On("SearchMovie", suite.ctx, "Test Movie", 2023).Return(searchResults, nil)
-	mockProvider2.On("GetMovieDetails", suite.ctx, "provider2_123").Return(expectedMetadata, nil)
+	mockProvider2.On("SearchMovie", suite.ctx, "Test Movie", 2023, suite.prefs).Return(searchResults, nil)
+	mockProvider2.On("GetMovieDetails", suite.ctx, "provider2_123", suite.prefs).Return(expectedMetadata, nil)
 
 	// Register second provider
 	suite.fetcher.RegisterProvider(mockProvider2)
 
 	// Act
-	metadata, err := suite.fetcher.FetchMetadata(suite.ctx, media)
+	metadata, err := suite.fetcher.FetchMetadata(suite.ctx, media, suite.library)
 
 	// Assert
 	suite.Require().NoError(err)
@@ -332,3 +477,30 @@ func (suite *MetadataFetcherTestSuite) TestFetchMetadata_MultipleProviders() {
 func TestMetadataFetcherTestSuite(t *testing.T) {
 	suite.Run(t, new(MetadataFetcherTestSuite))
 }
+
+func (suite *MetadataFetcherTestSuite) TestSearchTitles_MergesProviders() {
+	// Arrange
+	failing := new(MockMetadataProvider)
+	failing.On("GetName").Return("FailingProvider")
+	failing.On("GetType").Return("movie")
+	failing.On("SearchMovie", suite.ctx, "Dune", 0, suite.prefs).Return(nil, assert.AnError)
+	suite.fetcher.RegisterProvider(failing)
+
+	suite.mockProvider.On("SearchMovie", suite.ctx, "Dune", 0, suite.prefs).
+		Return([]models.SearchResult{{ProviderID: "438631", Title: "Dune", Year: 2021}}, nil)
+	suite.mockProvider.On("GetMovieDetails", suite.ctx, "438631", suite.prefs).
+		Return(&models.Metadata{Title: "Dune", TMDBID: "438631"}, nil)
+
+	// Act
+	results, err := suite.fetcher.SearchTitles(suite.ctx, models.MediaTypeMovie, "Dune", 0, suite.prefs)
+	details, detailsErr := suite.fetcher.TitleDetails(suite.ctx, "TestProvider", "438631", models.MediaTypeMovie, suite.prefs)
+	_, unknownErr := suite.fetcher.TitleDetails(suite.ctx, "Missing", "438631", models.MediaTypeMovie, suite.prefs)
+
+	// Assert
+	suite.Require().NoError(err, "failing providers are skipped")
+	suite.Require().Len(results, 1)
+	suite.Equal("TestProvider", results[0].ProviderName, "results name their provider")
+	suite.Require().NoError(detailsErr)
+	suite.Equal("438631", details.TMDBID)
+	suite.Error(unknownErr)
+}
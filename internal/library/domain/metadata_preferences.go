@@ -0,0 +1,57 @@
+package domain
+
+import (
+	"fmt"
+
+	"golang.org/x/text/language"
+)
+
+// TitleStyle controls which title metadata refreshes give media.
+type TitleStyle string
+
+const (
+	// TitleStyleTranslated uses the title in the metadata language. It is
+	// the default.
+	TitleStyleTranslated TitleStyle = "translated"
+	// TitleStyleOriginal uses the title media was released under.
+	TitleStyleOriginal TitleStyle = "original"
+)
+
+// MetadataPreferences control the language and region metadata of a
+// library is fetched in.
+type MetadataPreferences struct {
+	// Language is a BCP 47 tag such as "en" or "pt-BR". Empty leaves the
+	// language to the providers.
+	Language string
+	// Region is the ISO 3166-1 country whose certifications and release
+	// dates are used. Empty leaves the region to the providers.
+	Region     string
+	TitleStyle TitleStyle
+}
+
+// Normalize checks the preferences and returns them in canonical form,
+// with the default title style when none is set.
+func (p MetadataPreferences) Normalize() (MetadataPreferences, error) {
+	if p.Language != "" {
+		tag, err := language.Parse(p.Language)
+		if err != nil {
+			return p, fmt.Errorf("invalid metadata language %q", p.Language)
+		}
+		p.Language = tag.String()
+	}
+	if p.Region != "" {
+		region, err := language.ParseRegion(p.Region)
+		if err != nil || !region.IsCountry() {
+			return p, fmt.Errorf("invalid metadata region %q", p.Region)
+		}
+		p.Region = region.String()
+	}
+	switch p.TitleStyle {
+	case "":
+		p.TitleStyle = TitleStyleTranslated
+	case TitleStyleTranslated, TitleStyleOriginal:
+	default:
+		return p, fmt.Errorf("unsupported title style %q", p.TitleStyle)
+	}
+	return p, nil
+}
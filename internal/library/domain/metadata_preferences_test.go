@@ -0,0 +1,35 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+)
+
+func TestMetadataPreferences_Normalize(t *testing.T) {
+	prefs, err := domain.MetadataPreferences{Language: "PT_br", Region: "gb"}.Normalize()
+	require.NoError(t, err)
+	assert.Equal(t, domain.MetadataPreferences{
+		Language:   "pt-BR",
+		Region:     "GB",
+		TitleStyle: domain.TitleStyleTranslated,
+	}, prefs)
+
+	prefs, err = domain.MetadataPreferences{}.Normalize()
+	require.NoError(t, err)
+	assert.Equal(t, domain.MetadataPreferences{TitleStyle: domain.TitleStyleTranslated}, prefs)
+
+	invalid := []domain.MetadataPreferences{
+		{Language: "not a language"},
+		{Region: "EU"},
+		{Region: "ZZ"},
+		{TitleStyle: "romanized"},
+	}
+	for _, p := range invalid {
+		_, err := p.Normalize()
+		assert.Error(t, err, "%+v", p)
+	}
+}
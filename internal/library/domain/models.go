@@ -9,6 +9,7 @@ import (
 // Library represents a media library.
 type Library struct {
 	ID           uuid.UUID
+	TenantID     uuid.UUID
 	Name         string
 	Path         string
 	Type         string // movie, tv_show, music
@@ -17,8 +18,49 @@ type Library struct {
 	LastScanAt   *time.Time
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
+
+	// Scan rules
+	ExcludePatterns []string   // globs, or regular expressions prefixed with "re:"
+	ExtrasMode      ExtrasMode // how samples, trailers and other extras are handled
+
+	// IgnoreExtrasFolders leaves folders such as "Extras" and "Featurettes"
+	// out of scans, whatever the extras mode.
+	IgnoreExtrasFolders bool
+
+	// FolderProfile is how files are organized on disk.
+	FolderProfile FolderProfile
+
+	// QualityCutoff is the quality files are upgraded to, one of the feed
+	// qualities; empty means any quality is good enough.
+	QualityCutoff string
+
+	// MetadataPreferences control the language and region metadata
+	// refreshes fetch.
+	MetadataPreferences MetadataPreferences
+
+	// Anime libraries parse absolute episode numbers and specials from
+	// file names.
+	Anime bool
+
+	// Naming is the formats renames organize files into.
+	Naming NamingRules
+
+	// AudioNormalization levels the audio of the transcodes of policies
+	// that leave it to the library, so episodes of a series play at the
+	// same volume; empty is off.
+	AudioNormalization AudioNormalization
 }
 
+// ExtrasMode controls how scans handle samples, trailers and other extras.
+type ExtrasMode string
+
+const (
+	// ExtrasModeSkip leaves extras out of the library. It is the default.
+	ExtrasModeSkip ExtrasMode = "skip"
+	// ExtrasModeAttach adds extras as media attached to their parent media.
+	ExtrasModeAttach ExtrasMode = "attach"
+)
+
 // MetadataProviderConfig represents a metadata provider configuration.
 type MetadataProviderConfig struct {
 	ID           uuid.UUID
@@ -42,12 +84,37 @@ type ScanResult struct {
 	FilesUpdated int
 	FilesDeleted int
 	FilesFound   int
+	RowsWritten  int // media rows created or updated; not persisted
 	Status       string
 	Errors       int
 	ErrorMessage string
 	Duration     int64 // milliseconds
 }
 
+// ScanMetrics describes the throughput of the latest scan of a library.
+type ScanMetrics struct {
+	LibraryID      uuid.UUID
+	FilesScanned   int
+	Errors         int
+	Duration       time.Duration
+	FilesPerSecond float64
+	RowsWritten    int
+	RowsPerSecond  float64 // media rows written per second of processing
+	Cancelled      bool
+	CompletedAt    time.Time
+}
+
+// DirectoryState records a library directory as seen by a scan.
+type DirectoryState struct {
+	Path    string
+	ModTime time.Time
+	Size    int64 // total size of the media files directly in the directory
+	Files   int
+}
+
+// ScanManifest maps directory paths to their state at the previous scan.
+type ScanManifest map[string]DirectoryState
+
 // Media represents a media item.
 type Media struct {
 	ID          uuid.UUID
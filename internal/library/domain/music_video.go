@@ -0,0 +1,130 @@
+package domain
+
+import (
+	"context"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// MetadataProviderTypeMusicVideo is the type of providers covering music
+// videos, which are only used for music video libraries.
+const MetadataProviderTypeMusicVideo = "music_video"
+
+// MusicVideoTagConcert tags music video media that are concert films rather
+// than single videos.
+const MusicVideoTagConcert = "concert"
+
+// MusicVideoProvider is implemented by metadata providers that look music
+// videos up by artist and title.
+type MusicVideoProvider interface {
+	SearchMusicVideo(
+		ctx context.Context,
+		artist, title string,
+		prefs MetadataPreferences,
+	) ([]models.SearchResult, error)
+	GetMusicVideoDetails(ctx context.Context, providerID string, prefs MetadataPreferences) (*models.Metadata, error)
+}
+
+// MusicVideoInfo is what the path of a music video file tells about it.
+type MusicVideoInfo struct {
+	Artist  string
+	Title   string
+	Year    int
+	Concert bool
+}
+
+var (
+	musicVideoSeparator = regexp.MustCompile(`\s+-\s+`)
+	musicVideoConcert   = regexp.MustCompile(`(?i)\b(?:live\s+(?:at|in|from)|concert)\b`)
+)
+
+// ParseMusicVideo parses a music video file in a library at root. Files are
+// named "Artist - Title (Year)", or just "Title (Year)" inside a directory
+// named after the artist. Concert films are named "Live at ..." or kept in
+// a directory named "Concerts".
+func ParseMusicVideo(root, path string) MusicVideoInfo {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	name = strings.NewReplacer("_", " ", ".", " ").Replace(name)
+	info := MusicVideoInfo{Year: ExtractYear(path)}
+
+	var dirs []string
+	if rel, err := filepath.Rel(root, filepath.Dir(path)); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+		dirs = strings.Split(filepath.ToSlash(rel), "/")
+	}
+	for _, dir := range dirs {
+		if strings.EqualFold(dir, "concerts") {
+			info.Concert = true
+		}
+	}
+
+	if artist, title, ok := splitMusicVideoName(name); ok {
+		info.Artist = artist
+		info.Title = ExtractTitle(title)
+	} else {
+		info.Title = ExtractTitle(name)
+		// The closest directory that is not a grouping one names the artist
+		for i := len(dirs) - 1; i >= 0; i-- {
+			if !strings.EqualFold(dirs[i], "concerts") && !strings.EqualFold(dirs[i], "videos") {
+				info.Artist = strings.TrimSpace(dirs[i])
+				break
+			}
+		}
+	}
+	if musicVideoConcert.MatchString(name) {
+		info.Concert = true
+	}
+	return info
+}
+
+// splitMusicVideoName splits an "Artist - Title" file name.
+func splitMusicVideoName(name string) (string, string, bool) {
+	loc := musicVideoSeparator.FindStringIndex(name)
+	if loc == nil {
+		return "", "", false
+	}
+	artist := strings.TrimSpace(name[:loc[0]])
+	title := strings.TrimSpace(name[loc[1]:])
+	if artist == "" || title == "" {
+		return "", "", false
+	}
+	return artist, title, true
+}
+
+// TrackArtist returns the artist of a music track in a library at root:
+// music libraries keep tracks in Artist/Album directories.
+func TrackArtist(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[0]
+}
+
+// Artist is a performer with their music tracks and music videos, matched
+// across libraries by name.
+type Artist struct {
+	Name        string
+	Tracks      []*models.Media
+	MusicVideos []*models.Media
+}
+
+// DefaultTranscodePolicies returns the transcode policies a new library of
+// a type starts with. Music videos are short and watched on every kind of
+// device, so they get an HLS ladder and a 720p MP4 for offline playback;
+// other libraries start with none.
+func DefaultTranscodePolicies(library *Library) []*TranscodePolicy {
+	if models.MediaType(library.Type) != models.MediaTypeMusicVideo {
+		return nil
+	}
+	return []*TranscodePolicy{
+		{LibraryID: library.ID, Name: "Adaptive streaming", Profile: "ladder", Format: TranscodeFormatHLS, Enabled: true},
+		{LibraryID: library.ID, Name: "Offline 720p", Profile: "720p", Format: TranscodeFormatMP4, Enabled: true},
+	}
+}
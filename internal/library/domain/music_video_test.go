@@ -0,0 +1,70 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+func TestParseMusicVideo(t *testing.T) {
+	tests := []struct {
+		path string
+		want domain.MusicVideoInfo
+	}{
+		{
+			path: "/videos/Daft Punk - Around the World (1997).mkv",
+			want: domain.MusicVideoInfo{Artist: "Daft Punk", Title: "Around The World", Year: 1997},
+		},
+		{
+			path: "/videos/Radiohead/Karma.Police.mp4",
+			want: domain.MusicVideoInfo{Artist: "Radiohead", Title: "Karma Police"},
+		},
+		{
+			path: "/videos/Queen/Videos/Bohemian_Rhapsody.mp4",
+			want: domain.MusicVideoInfo{Artist: "Queen", Title: "Bohemian Rhapsody"},
+		},
+		{
+			path: "/videos/Queen - Live at Wembley Stadium (1986).mkv",
+			want: domain.MusicVideoInfo{Artist: "Queen", Title: "Live At Wembley Stadium", Year: 1986, Concert: true},
+		},
+		{
+			path: "/videos/Concerts/Nirvana/MTV Unplugged in New York.mkv",
+			want: domain.MusicVideoInfo{Artist: "Nirvana", Title: "Mtv Unplugged In New York", Concert: true},
+		},
+		{
+			path: "/videos/Untitled.mp4",
+			want: domain.MusicVideoInfo{Title: "Untitled"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.want, domain.ParseMusicVideo("/videos", tt.path))
+		})
+	}
+}
+
+func TestTrackArtist(t *testing.T) {
+	assert.Equal(t, "Björk", domain.TrackArtist("/music", "/music/Björk/Homogenic/01 Hunter.flac"))
+	assert.Equal(t, "Björk", domain.TrackArtist("/music", "/music/Björk/Jóga.flac"))
+	assert.Empty(t, domain.TrackArtist("/music", "/music/Loose Track.mp3"))
+	assert.Empty(t, domain.TrackArtist("/music", "/elsewhere/Artist/Track.mp3"))
+}
+
+func TestDefaultTranscodePolicies(t *testing.T) {
+	library := &domain.Library{ID: uuid.New(), Type: string(models.MediaTypeMusicVideo)}
+	policies := domain.DefaultTranscodePolicies(library)
+	require.Len(t, policies, 2)
+	for _, policy := range policies {
+		assert.Equal(t, library.ID, policy.LibraryID)
+		assert.True(t, policy.Enabled)
+		assert.NoError(t, policy.Validate())
+	}
+
+	assert.Empty(t, domain.DefaultTranscodePolicies(&domain.Library{Type: string(models.MediaTypeMovie)}))
+}
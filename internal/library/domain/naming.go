@@ -0,0 +1,289 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Default naming formats, used when a library sets none.
+const (
+	DefaultMovieFormat   = "{Title} ({Year})/{Title} ({Year}) [{Quality}]"
+	DefaultEpisodeFormat = "{Series}/Season {season:00}/{Series} - S{season:00}E{episode:00} - {Title} [{Quality}]"
+)
+
+// NamingRules are the formats files of a library are renamed to. Formats
+// are paths relative to the library, with "/" separating directories, made
+// of text and {Token} placeholders. Numeric tokens take a zero padding, as
+// in {season:00}. The file extension is kept.
+//
+// Tokens are Title, Year, Quality, Resolution and Codec for every file, and
+// Series, season, episode and absolute for episodes; names are not case
+// sensitive. Empty formats use the defaults.
+type NamingRules struct {
+	MovieFormat   string
+	EpisodeFormat string
+}
+
+// Validate checks that both formats parse.
+func (r NamingRules) Validate() error {
+	if _, err := ParseNamingTemplate(r.movieFormat()); err != nil {
+		return fmt.Errorf("movie format: %w", err)
+	}
+	if _, err := ParseNamingTemplate(r.episodeFormat()); err != nil {
+		return fmt.Errorf("episode format: %w", err)
+	}
+	return nil
+}
+
+// MovieTemplate returns the parsed movie format.
+func (r NamingRules) MovieTemplate() (*NamingTemplate, error) {
+	return ParseNamingTemplate(r.movieFormat())
+}
+
+// EpisodeTemplate returns the parsed episode format.
+func (r NamingRules) EpisodeTemplate() (*NamingTemplate, error) {
+	return ParseNamingTemplate(r.episodeFormat())
+}
+
+func (r NamingRules) movieFormat() string {
+	if r.MovieFormat == "" {
+		return DefaultMovieFormat
+	}
+	return r.MovieFormat
+}
+
+func (r NamingRules) episodeFormat() string {
+	if r.EpisodeFormat == "" {
+		return DefaultEpisodeFormat
+	}
+	return r.EpisodeFormat
+}
+
+// NamingValues are the values the tokens of a naming format render.
+type NamingValues struct {
+	Title      string
+	Year       int
+	Quality    string
+	Resolution string
+	Codec      string
+
+	Series string
+	Season int
+	// Episodes are the episode numbers of the file; files holding several
+	// episodes render the first and last, as in 02-03.
+	Episodes []int
+	Absolute int
+}
+
+type namingToken struct {
+	numeric bool
+	value   func(v NamingValues) (string, []int)
+}
+
+var namingTokens = map[string]namingToken{
+	"title":      {value: func(v NamingValues) (string, []int) { return v.Title, nil }},
+	"quality":    {value: func(v NamingValues) (string, []int) { return v.Quality, nil }},
+	"resolution": {value: func(v NamingValues) (string, []int) { return v.Resolution, nil }},
+	"codec":      {value: func(v NamingValues) (string, []int) { return v.Codec, nil }},
+	"series":     {value: func(v NamingValues) (string, []int) { return v.Series, nil }},
+	"year":       {numeric: true, value: func(v NamingValues) (string, []int) { return "", nonZero(v.Year) }},
+	"season":     {numeric: true, value: func(v NamingValues) (string, []int) { return "", []int{v.Season} }},
+	"episode":    {numeric: true, value: func(v NamingValues) (string, []int) { return "", v.Episodes }},
+	"absolute":   {numeric: true, value: func(v NamingValues) (string, []int) { return "", nonZero(v.Absolute) }},
+}
+
+func nonZero(n int) []int {
+	if n == 0 {
+		return nil
+	}
+	return []int{n}
+}
+
+// namingPart is literal text, or a token if name is set.
+type namingPart struct {
+	text  string
+	name  string
+	width int
+}
+
+// NamingTemplate is a parsed naming format.
+type NamingTemplate struct {
+	parts []namingPart
+}
+
+var namingPlaceholder = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// ParseNamingTemplate parses a naming format.
+func ParseNamingTemplate(format string) (*NamingTemplate, error) {
+	if strings.TrimSpace(format) == "" {
+		return nil, errors.New("format is empty")
+	}
+	if strings.HasPrefix(format, "/") || strings.Contains(format, `\`) {
+		return nil, errors.New("format must be a relative path separated by /")
+	}
+
+	t := &NamingTemplate{}
+	last := 0
+	for _, m := range namingPlaceholder.FindAllStringSubmatchIndex(format, -1) {
+		if err := t.addText(format[last:m[0]]); err != nil {
+			return nil, err
+		}
+		last = m[1]
+
+		name, pad, padded := strings.Cut(format[m[2]:m[3]], ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+		token, ok := namingTokens[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown token {%s}", format[m[2]:m[3]])
+		}
+		part := namingPart{name: name}
+		if padded {
+			if !token.numeric || pad == "" || strings.Trim(pad, "0") != "" {
+				return nil, fmt.Errorf("invalid padding in {%s}", format[m[2]:m[3]])
+			}
+			part.width = len(pad)
+		}
+		t.parts = append(t.parts, part)
+	}
+	if err := t.addText(format[last:]); err != nil {
+		return nil, err
+	}
+
+	for _, element := range strings.Split(format, "/") {
+		if strings.TrimSpace(element) == "" || element == "." || element == ".." {
+			return nil, errors.New("format has an empty or relative path element")
+		}
+	}
+	return t, nil
+}
+
+func (t *NamingTemplate) addText(text string) error {
+	if strings.ContainsAny(text, "{}") {
+		return errors.New("unbalanced braces")
+	}
+	if text != "" {
+		t.parts = append(t.parts, namingPart{text: text})
+	}
+	return nil
+}
+
+// Render returns the path relative to the library a file with the given
+// values and extension is named. Tokens without a value render nothing,
+// and brackets and separators left empty around them are dropped.
+// Characters not allowed in file names are removed from values.
+func (t *NamingTemplate) Render(values NamingValues, ext string) (string, error) {
+	var b strings.Builder
+	for _, part := range t.parts {
+		if part.name == "" {
+			b.WriteString(part.text)
+			continue
+		}
+		text, numbers := namingTokens[part.name].value(values)
+		if numbers != nil {
+			text = formatNamingNumbers(numbers, part.width)
+		}
+		// Values never add directories
+		b.WriteString(strings.ReplaceAll(text, "/", " "))
+	}
+
+	elements := strings.Split(b.String(), "/")
+	for i, element := range elements {
+		element = cleanNamingElement(element)
+		if element == "" {
+			return "", errors.New("format renders an empty path element")
+		}
+		elements[i] = element
+	}
+	return strings.Join(elements, "/") + ext, nil
+}
+
+func formatNamingNumbers(numbers []int, width int) string {
+	pad := func(n int) string {
+		s := strconv.Itoa(n)
+		if len(s) < width {
+			s = strings.Repeat("0", width-len(s)) + s
+		}
+		return s
+	}
+	switch len(numbers) {
+	case 0:
+		return ""
+	case 1:
+		return pad(numbers[0])
+	default:
+		return pad(numbers[0]) + "-" + pad(numbers[len(numbers)-1])
+	}
+}
+
+var (
+	namingIllegal     = regexp.MustCompile(`[<>"\\|?*\x00-\x1f]`)
+	namingEmptyGroups = regexp.MustCompile(`\(\s*\)|\[\s*\]`)
+	namingSeparators  = regexp.MustCompile(`(\s+-)+(\s+-)`)
+	namingSpaces      = regexp.MustCompile(`\s+`)
+)
+
+// cleanNamingElement makes a rendered path element a valid file name.
+func cleanNamingElement(element string) string {
+	element = strings.ReplaceAll(element, ":", " -")
+	element = namingIllegal.ReplaceAllString(element, "")
+	element = namingEmptyGroups.ReplaceAllString(element, "")
+	element = namingSpaces.ReplaceAllString(element, " ")
+	element = namingSeparators.ReplaceAllString(element, "$2")
+	return strings.Trim(element, " .-")
+}
+
+// RenamedFile is a file whose path a rename changes.
+type RenamedFile struct {
+	LibraryFile
+	NewPath string
+	// Conflict is why the file cannot be renamed, such as another file
+	// already using the new path; empty if it can.
+	Conflict string
+}
+
+// Rename renames the files of media to the naming formats of their
+// libraries.
+type Rename struct {
+	// Files are the files whose path changes. Files holding several
+	// episodes are listed once per episode.
+	Files []RenamedFile
+	// Conflicts is the number of files that cannot be renamed.
+	Conflicts int
+	// Applied reports whether the files were renamed, as opposed to a
+	// preview.
+	Applied bool
+
+	// newPaths maps the new paths of the files to their current ones.
+	newPaths map[string]string
+}
+
+// RenamePath returns the path a file is renamed to in a library at root,
+// keeping its extension.
+func RenamePath(root string, template *NamingTemplate, values NamingValues, path string) (string, error) {
+	rel, err := template.Render(values, filepath.Ext(path))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, filepath.FromSlash(rel)), nil
+}
+
+// AddRenamedFile adds a file to the rename, with a conflict if another file
+// is already renamed to the same path.
+func (r *Rename) AddRenamedFile(file RenamedFile) {
+	if r.newPaths == nil {
+		r.newPaths = make(map[string]string)
+	}
+	if path, ok := r.newPaths[file.NewPath]; ok && path != file.Path && file.Conflict == "" {
+		file.Conflict = "another file is renamed to the same path"
+	}
+	if file.Conflict == "" {
+		r.newPaths[file.NewPath] = file.Path
+	} else {
+		r.Conflicts++
+	}
+	r.Files = append(r.Files, file)
+}
@@ -0,0 +1,106 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+)
+
+func TestNamingTemplateRender(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		values domain.NamingValues
+		want   string
+	}{
+		{
+			name:   "default movie",
+			format: domain.DefaultMovieFormat,
+			values: domain.NamingValues{Title: "Heat", Year: 1995, Quality: "1080p"},
+			want:   "Heat (1995)/Heat (1995) [1080p].mkv",
+		},
+		{
+			name:   "empty tokens drop their brackets",
+			format: domain.DefaultMovieFormat,
+			values: domain.NamingValues{Title: "Heat"},
+			want:   "Heat/Heat.mkv",
+		},
+		{
+			name:   "default episode",
+			format: domain.DefaultEpisodeFormat,
+			values: domain.NamingValues{Series: "Show", Season: 1, Episodes: []int{2}, Title: "Pilot", Quality: "720p"},
+			want:   "Show/Season 01/Show - S01E02 - Pilot [720p].mkv",
+		},
+		{
+			name:   "multi-episode file without a title",
+			format: domain.DefaultEpisodeFormat,
+			values: domain.NamingValues{Series: "Show", Season: 2, Episodes: []int{5, 6}},
+			want:   "Show/Season 02/Show - S02E05-06.mkv",
+		},
+		{
+			name:   "illegal characters and directories in values",
+			format: "{Title}",
+			values: domain.NamingValues{Title: "Mission: Impossible / Fallout?"},
+			want:   "Mission - Impossible Fallout.mkv",
+		},
+		{
+			name:   "padding and case-insensitive tokens",
+			format: "{series} - {ABSOLUTE:000}",
+			values: domain.NamingValues{Series: "Show", Absolute: 7},
+			want:   "Show - 007.mkv",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template, err := domain.ParseNamingTemplate(tt.format)
+			require.NoError(t, err)
+			got, err := template.Render(tt.values, ".mkv")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	template, err := domain.ParseNamingTemplate("{Title}/{Quality}")
+	require.NoError(t, err)
+	_, err = template.Render(domain.NamingValues{Title: "Heat"}, ".mkv")
+	assert.Error(t, err, "empty path element")
+}
+
+func TestParseNamingTemplate_Invalid(t *testing.T) {
+	for _, format := range []string{
+		"",
+		"/movies/{Title}",
+		"{Title",
+		"Title}",
+		"{Director}",
+		"{Title:00}",
+		"{season:0a}",
+		"{Series}//{Title}",
+		"../{Title}",
+	} {
+		_, err := domain.ParseNamingTemplate(format)
+		assert.Error(t, err, format)
+	}
+}
+
+func TestNamingRulesValidate(t *testing.T) {
+	assert.NoError(t, domain.NamingRules{}.Validate())
+	assert.NoError(t, domain.NamingRules{MovieFormat: "{Title} ({Year})"}.Validate())
+	assert.ErrorContains(t, domain.NamingRules{EpisodeFormat: "{Nope}"}.Validate(), "episode format")
+}
+
+func TestRenameAddRenamedFile(t *testing.T) {
+	var rename domain.Rename
+	rename.AddRenamedFile(domain.RenamedFile{LibraryFile: domain.LibraryFile{Path: "/a.mkv"}, NewPath: "/x.mkv"})
+	// Episodes sharing a file share the new path
+	rename.AddRenamedFile(domain.RenamedFile{LibraryFile: domain.LibraryFile{Path: "/a.mkv"}, NewPath: "/x.mkv"})
+	rename.AddRenamedFile(domain.RenamedFile{LibraryFile: domain.LibraryFile{Path: "/b.mkv"}, NewPath: "/x.mkv"})
+
+	require.Len(t, rename.Files, 3)
+	assert.Empty(t, rename.Files[1].Conflict)
+	assert.NotEmpty(t, rename.Files[2].Conflict)
+	assert.Equal(t, 1, rename.Conflicts)
+}
@@ -0,0 +1,176 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PlaybackIssueKind is the kind of problem a client reports while playing
+// media.
+type PlaybackIssueKind string
+
+const (
+	// PlaybackIssueStall is playback that stopped to rebuffer.
+	PlaybackIssueStall PlaybackIssueKind = "stall"
+	// PlaybackIssueDecodeError is media the client failed to decode.
+	PlaybackIssueDecodeError PlaybackIssueKind = "decode_error"
+	// PlaybackIssueBitrateSwitch is a change of the rendition played.
+	// Clients report the rendition playback starts with as a switch from
+	// zero, so sessions without errors are counted as well.
+	PlaybackIssueBitrateSwitch PlaybackIssueKind = "bitrate_switch"
+)
+
+// ParsePlaybackIssueKind parses the kind of a playback issue.
+func ParsePlaybackIssueKind(s string) (PlaybackIssueKind, error) {
+	switch kind := PlaybackIssueKind(s); kind {
+	case PlaybackIssueStall, PlaybackIssueDecodeError, PlaybackIssueBitrateSwitch:
+		return kind, nil
+	}
+	return "", fmt.Errorf("unknown playback issue kind %q", s)
+}
+
+// IsError reports whether issues of the kind count as playback errors.
+func (k PlaybackIssueKind) IsError() bool {
+	return k == PlaybackIssueStall || k == PlaybackIssueDecodeError
+}
+
+// PlaybackIssue is a problem a client ran into while playing media, with
+// the context of its playback session.
+type PlaybackIssue struct {
+	ID        uuid.UUID
+	MediaID   uuid.UUID
+	UserID    string
+	SessionID string
+	Kind      PlaybackIssueKind
+	// Position is where in the media the issue happened.
+	Position time.Duration
+	// StallDuration is how long a stall lasted.
+	StallDuration time.Duration
+	// FromBitrate and ToBitrate are the bitrates of a switch, in bits per
+	// second.
+	FromBitrate int64
+	ToBitrate   int64
+	// Error is the error message of a decode error.
+	Error string
+	// Client names the player and device.
+	Client     string
+	ReportedAt time.Time
+}
+
+// Validate checks the issue has the fields its kind needs.
+func (i *PlaybackIssue) Validate() error {
+	if i.MediaID == uuid.Nil {
+		return errors.New("media ID is required")
+	}
+	if i.SessionID == "" {
+		return errors.New("session ID is required")
+	}
+	if i.Position < 0 || i.StallDuration < 0 || i.FromBitrate < 0 || i.ToBitrate < 0 {
+		return errors.New("position, stall duration and bitrates cannot be negative")
+	}
+	switch i.Kind {
+	case PlaybackIssueBitrateSwitch:
+		if i.ToBitrate == 0 {
+			return errors.New("bitrate switches need the bitrate switched to")
+		}
+	case PlaybackIssueStall, PlaybackIssueDecodeError:
+	default:
+		return fmt.Errorf("unknown playback issue kind %q", i.Kind)
+	}
+	return nil
+}
+
+// PlaybackFlagReason is what media flagged for its playback errors needs.
+type PlaybackFlagReason string
+
+const (
+	// PlaybackFlagVerify is media failing to decode, whose file may be
+	// corrupt.
+	PlaybackFlagVerify PlaybackFlagReason = "verify"
+	// PlaybackFlagRetranscode is media stalling, whose renditions may be
+	// too demanding for its clients.
+	PlaybackFlagRetranscode PlaybackFlagReason = "retranscode"
+)
+
+// PlaybackFlag marks media whose playback error rate exceeded the
+// threshold.
+type PlaybackFlag struct {
+	MediaID   uuid.UUID
+	Reason    PlaybackFlagReason
+	ErrorRate float64
+	FlaggedAt time.Time
+}
+
+// PlaybackIssueStats aggregates the issues reported for media.
+type PlaybackIssueStats struct {
+	MediaID uuid.UUID
+	// Sessions is the number of playback sessions that reported issues.
+	Sessions int64
+	// ErrorSessions and DecodeErrorSessions are the number of sessions
+	// that reported errors, and decode errors in particular.
+	ErrorSessions       int64
+	DecodeErrorSessions int64
+
+	Stalls          int64
+	StallTime       time.Duration
+	DecodeErrors    int64
+	BitrateSwitches int64
+	LastReportedAt  time.Time
+
+	// Flag is set if the media is flagged.
+	Flag *PlaybackFlag
+}
+
+// ErrorRate returns the share of sessions that reported errors.
+func (s *PlaybackIssueStats) ErrorRate() float64 {
+	if s.Sessions == 0 {
+		return 0
+	}
+	return float64(s.ErrorSessions) / float64(s.Sessions)
+}
+
+// DecodeErrorRate returns the share of sessions that reported decode
+// errors.
+func (s *PlaybackIssueStats) DecodeErrorRate() float64 {
+	if s.Sessions == 0 {
+		return 0
+	}
+	return float64(s.DecodeErrorSessions) / float64(s.Sessions)
+}
+
+// PlaybackIssueFilter selects the media playback issues are reported for.
+type PlaybackIssueFilter struct {
+	// LibraryID limits the media to a library, if set.
+	LibraryID *uuid.UUID
+	// Since ignores issues reported before it.
+	Since time.Time
+	// FlaggedOnly limits the media to flagged media.
+	FlaggedOnly bool
+}
+
+// PlaybackFlagPolicy decides which media is flagged for its playback
+// errors.
+type PlaybackFlagPolicy struct {
+	// ErrorRate is the share of sessions with errors above which media is
+	// flagged. Zero disables flagging.
+	ErrorRate float64
+	// MinSessions is the number of sessions media needs before it is
+	// flagged, so that a single bad session does not flag it.
+	MinSessions int64
+}
+
+// Evaluate reports whether media with the stats is flagged and why. Media
+// failing to decode is flagged for verification; media that only stalls is
+// flagged to be transcoded again.
+func (p PlaybackFlagPolicy) Evaluate(stats *PlaybackIssueStats) (PlaybackFlagReason, bool) {
+	if p.ErrorRate <= 0 || stats.Sessions < p.MinSessions || stats.ErrorRate() <= p.ErrorRate {
+		return "", false
+	}
+	if stats.DecodeErrorRate() > p.ErrorRate {
+		return PlaybackFlagVerify, true
+	}
+	return PlaybackFlagRetranscode, true
+}
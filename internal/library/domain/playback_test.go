@@ -0,0 +1,57 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+)
+
+func TestPlaybackIssue_Validate(t *testing.T) {
+	issue := &domain.PlaybackIssue{
+		MediaID:   uuid.New(),
+		SessionID: "session-1",
+		Kind:      domain.PlaybackIssueBitrateSwitch,
+		ToBitrate: 4_000_000,
+	}
+	assert.NoError(t, issue.Validate())
+
+	issue.ToBitrate = 0
+	assert.Error(t, issue.Validate(), "switches need a bitrate")
+	issue.Kind = domain.PlaybackIssueStall
+	issue.StallDuration = -time.Second
+	assert.Error(t, issue.Validate())
+	issue.StallDuration = time.Second
+	issue.SessionID = ""
+	assert.Error(t, issue.Validate())
+
+	_, err := domain.ParsePlaybackIssueKind("buffering")
+	assert.Error(t, err)
+}
+
+func TestPlaybackFlagPolicy_Evaluate(t *testing.T) {
+	policy := domain.PlaybackFlagPolicy{ErrorRate: 0.25, MinSessions: 4}
+
+	stats := &domain.PlaybackIssueStats{Sessions: 3, ErrorSessions: 3}
+	_, flagged := policy.Evaluate(stats)
+	assert.False(t, flagged, "too few sessions")
+
+	stats = &domain.PlaybackIssueStats{Sessions: 8, ErrorSessions: 2}
+	_, flagged = policy.Evaluate(stats)
+	assert.False(t, flagged, "a rate at the threshold is not flagged")
+
+	stats.ErrorSessions = 4
+	reason, flagged := policy.Evaluate(stats)
+	assert.True(t, flagged)
+	assert.Equal(t, domain.PlaybackFlagRetranscode, reason)
+
+	stats.DecodeErrorSessions = 3
+	reason, _ = policy.Evaluate(stats)
+	assert.Equal(t, domain.PlaybackFlagVerify, reason)
+
+	_, flagged = domain.PlaybackFlagPolicy{}.Evaluate(stats)
+	assert.False(t, flagged, "a zero rate disables flagging")
+}
@@ -0,0 +1,257 @@
+package domain
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// PruneReason is why a title is suggested for deletion.
+type PruneReason string
+
+const (
+	// PruneUnwatched titles were not watched within the unwatched period,
+	// or never since they were added.
+	PruneUnwatched PruneReason = "unwatched"
+	// PruneDuplicate titles are a copy of a title kept in equal quality.
+	PruneDuplicate PruneReason = "duplicate"
+	// PruneSuperseded titles are a copy of a title kept in better quality.
+	PruneSuperseded PruneReason = "superseded"
+)
+
+// pruneWeights weigh reasons by how little deleting loses: a superseded
+// copy nothing, an unwatched title a title someone may still want.
+var pruneWeights = map[PruneReason]float64{
+	PruneSuperseded: 3,
+	PruneDuplicate:  2,
+	PruneUnwatched:  1,
+}
+
+// diskPressureBoost multiplies the scores of candidates on disks short of
+// free space, so they are freed first.
+const diskPressureBoost = 2
+
+// PrunePolicy decides which titles are suggested for deletion. Titles not
+// watched for UnwatchedFor are suggested, as are the copies of titles a
+// library has more than once; zero UnwatchedFor only suggests copies.
+// Libraries whose disk has less than MinFreeShare of its space free are
+// under disk pressure; zero disables it.
+type PrunePolicy struct {
+	UnwatchedFor time.Duration
+	MinFreeShare float64
+}
+
+// PruneItem is a title with a file that may be suggested for deletion.
+type PruneItem struct {
+	Media *models.Media
+	// LastViewedAt is when the title was last watched by anyone; nil if
+	// never.
+	LastViewedAt *time.Time
+}
+
+// DiskSpace is the size and free space of the disk of a library, in bytes.
+type DiskSpace struct {
+	Total int64
+	Free  int64
+}
+
+// FreeShare returns the share of the disk that is free, from 0 to 1.
+func (d DiskSpace) FreeShare() float64 {
+	if d.Total <= 0 {
+		return 1
+	}
+	return float64(d.Free) / float64(d.Total)
+}
+
+// PruneCandidate is a title suggested for deletion.
+type PruneCandidate struct {
+	MediaID   uuid.UUID
+	LibraryID uuid.UUID
+	Title     string
+	Year      int
+	MediaType models.MediaType
+	Path      string
+	// Size is the space deleting the title frees, in bytes.
+	Size    int64
+	Quality string
+	Reasons []PruneReason
+	// KeptID is the copy kept of duplicate and superseded titles.
+	KeptID       *uuid.UUID
+	LastViewedAt *time.Time
+	// DiskPressure is set when the disk of the title's library is short of
+	// free space.
+	DiskPressure bool
+	// Score ranks candidates: weighted reasons times the gigabytes freed,
+	// boosted under disk pressure.
+	Score float64
+}
+
+// PrunePlan is the ranked list of titles suggested for deletion.
+type PrunePlan struct {
+	// Candidates are ranked by score, highest first.
+	Candidates []*PruneCandidate
+	// Savings is the space deleting every candidate frees, in bytes.
+	Savings int64
+	// Pressured are the libraries whose disk is short of free space.
+	Pressured []uuid.UUID
+}
+
+// LibrarySavings returns the number of candidates of a library and the
+// space deleting them frees.
+func (p *PrunePlan) LibrarySavings(libraryID uuid.UUID) (int, int64) {
+	count, savings := 0, int64(0)
+	for _, c := range p.Candidates {
+		if c.LibraryID == libraryID {
+			count++
+			savings += c.Size
+		}
+	}
+	return count, savings
+}
+
+// Plan ranks the titles of items worth deleting. Copies of a title are
+// grouped by provider ID, or by title and year; the best copy, by quality,
+// then bitrate, then size, is kept and the others suggested. disks holds
+// the disk space of each library; libraries missing from it are not under
+// pressure.
+func (p PrunePolicy) Plan(items []PruneItem, disks map[uuid.UUID]DiskSpace, now time.Time) *PrunePlan {
+	plan := &PrunePlan{Candidates: []*PruneCandidate{}}
+	for id, disk := range disks {
+		if p.MinFreeShare > 0 && disk.Total > 0 && disk.FreeShare() < p.MinFreeShare {
+			plan.Pressured = append(plan.Pressured, id)
+		}
+	}
+	sort.Slice(plan.Pressured, func(i, j int) bool {
+		return plan.Pressured[i].String() < plan.Pressured[j].String()
+	})
+
+	candidates := make(map[uuid.UUID]*PruneCandidate)
+	candidate := func(item PruneItem) *PruneCandidate {
+		c, ok := candidates[item.Media.ID]
+		if !ok {
+			c = newPruneCandidate(item)
+			candidates[item.Media.ID] = c
+		}
+		return c
+	}
+
+	groups := make(map[string][]PruneItem)
+	var keys []string
+	for _, item := range items {
+		if item.Media.FilePath == "" || item.Media.ParentID != nil {
+			continue
+		}
+		key := copyKey(item.Media)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], item)
+
+		if p.UnwatchedFor > 0 {
+			last := item.Media.CreatedAt
+			if item.LastViewedAt != nil {
+				last = *item.LastViewedAt
+			}
+			if now.Sub(last) >= p.UnwatchedFor {
+				c := candidate(item)
+				c.Reasons = append(c.Reasons, PruneUnwatched)
+			}
+		}
+	}
+
+	for _, key := range keys {
+		copies := groups[key]
+		if len(copies) < 2 {
+			continue
+		}
+		sort.SliceStable(copies, func(i, j int) bool {
+			return betterCopy(copies[i].Media, copies[j].Media)
+		})
+		kept := copies[0].Media
+		keptRank := QualityRank(FilePropertiesOf(kept).Quality)
+		for _, item := range copies[1:] {
+			c := candidate(item)
+			reason := PruneDuplicate
+			if QualityRank(c.Quality) < keptRank {
+				reason = PruneSuperseded
+			}
+			c.Reasons = append([]PruneReason{reason}, c.Reasons...)
+			c.KeptID = &kept.ID
+		}
+	}
+
+	pressured := make(map[uuid.UUID]bool, len(plan.Pressured))
+	for _, id := range plan.Pressured {
+		pressured[id] = true
+	}
+	for _, c := range candidates {
+		weight := 0.0
+		for _, r := range c.Reasons {
+			weight += pruneWeights[r]
+		}
+		c.Score = weight * float64(c.Size) / (1 << 30)
+		if pressured[c.LibraryID] {
+			c.DiskPressure = true
+			c.Score *= diskPressureBoost
+		}
+		plan.Candidates = append(plan.Candidates, c)
+		plan.Savings += c.Size
+	}
+	sort.Slice(plan.Candidates, func(i, j int) bool {
+		a, b := plan.Candidates[i], plan.Candidates[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+		if a.Title != b.Title {
+			return a.Title < b.Title
+		}
+		return a.MediaID.String() < b.MediaID.String()
+	})
+	return plan
+}
+
+func newPruneCandidate(item PruneItem) *PruneCandidate {
+	m := item.Media
+	return &PruneCandidate{
+		MediaID:      m.ID,
+		LibraryID:    m.LibraryID,
+		Title:        m.Title,
+		Year:         m.Year,
+		MediaType:    m.Type,
+		Path:         m.FilePath,
+		Size:         m.FileSize,
+		Quality:      FilePropertiesOf(m).Quality,
+		LastViewedAt: item.LastViewedAt,
+	}
+}
+
+// copyKey identifies the title a media item is a copy of.
+func copyKey(m *models.Media) string {
+	switch {
+	case m.TMDBID > 0:
+		return fmt.Sprintf("%s|tmdb|%d", m.Type, m.TMDBID)
+	case m.IMDBID != "":
+		return fmt.Sprintf("%s|imdb|%s", m.Type, m.IMDBID)
+	}
+	return fmt.Sprintf("%s|%s|%s|%d", m.Type, strings.ToLower(m.Artist), strings.ToLower(strings.TrimSpace(m.Title)), m.Year)
+}
+
+// betterCopy reports whether a is a better copy of a title than b.
+func betterCopy(a, b *models.Media) bool {
+	fa, fb := FilePropertiesOf(a), FilePropertiesOf(b)
+	if ra, rb := QualityRank(fa.Quality), QualityRank(fb.Quality); ra != rb {
+		return ra > rb
+	}
+	if fa.Bitrate != fb.Bitrate {
+		return fa.Bitrate > fb.Bitrate
+	}
+	return a.FileSize > b.FileSize
+}
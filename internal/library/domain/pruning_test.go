@@ -0,0 +1,74 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+func TestPrunePolicyPlan(t *testing.T) {
+	now := time.Now()
+	full, roomy := uuid.New(), uuid.New()
+	media := func(library uuid.UUID, title, path string, size int64, added time.Time) *models.Media {
+		return &models.Media{
+			ID: uuid.New(), LibraryID: library, Title: title, Year: 1995, Type: models.MediaTypeMovie,
+			FilePath: path, FileSize: size, CreatedAt: added,
+		}
+	}
+	const gib = 1 << 30
+	old := now.Add(-400 * 24 * time.Hour)
+
+	best := media(roomy, "Heat", "/m/Heat (1995) 2160p.mkv", 40*gib, old)
+	worse := media(roomy, "Heat", "/m/Heat (1995) 720p.mkv", 4*gib, old)
+	same := media(full, "heat ", "/n/Heat (1995) 2160p.mkv", 30*gib, old)
+	stale := media(full, "Dud", "/n/Dud (2001).mkv", 2*gib, old)
+	fresh := media(full, "New", "/n/New (2024).mkv", 2*gib, now.Add(-time.Hour))
+	watched := media(roomy, "Loved", "/m/Loved (1999).mkv", 8*gib, old)
+	extra := media(roomy, "Trailer", "/m/trailer.mkv", gib, old)
+	extra.ParentID = &watched.ID
+	recently := now.Add(-24 * time.Hour)
+
+	plan := domain.PrunePolicy{UnwatchedFor: 180 * 24 * time.Hour, MinFreeShare: 0.1}.Plan(
+		[]domain.PruneItem{
+			{Media: best, LastViewedAt: &recently},
+			{Media: worse},
+			{Media: same},
+			{Media: stale},
+			{Media: fresh},
+			{Media: watched, LastViewedAt: &recently},
+			{Media: extra},
+		},
+		map[uuid.UUID]domain.DiskSpace{full: {Total: 100, Free: 5}, roomy: {Total: 100, Free: 50}},
+		now,
+	)
+
+	require.Len(t, plan.Candidates, 3, "watched, fresh, kept and extras are not suggested")
+	assert.Equal(t, []uuid.UUID{full}, plan.Pressured)
+	assert.Equal(t, int64(36*gib), plan.Savings)
+
+	// The equal-quality copy on the full disk frees the most
+	first := plan.Candidates[0]
+	assert.Equal(t, same.ID, first.MediaID)
+	assert.Equal(t, []domain.PruneReason{domain.PruneDuplicate, domain.PruneUnwatched}, first.Reasons)
+	assert.Equal(t, best.ID, *first.KeptID)
+	assert.True(t, first.DiskPressure)
+
+	second := plan.Candidates[1]
+	assert.Equal(t, worse.ID, second.MediaID)
+	assert.Equal(t, []domain.PruneReason{domain.PruneSuperseded, domain.PruneUnwatched}, second.Reasons)
+	assert.Equal(t, "720p", second.Quality)
+	assert.InDelta(t, 16, second.Score, 0.001)
+
+	assert.Equal(t, stale.ID, plan.Candidates[2].MediaID)
+	assert.InDelta(t, 4, plan.Candidates[2].Score, 0.001, "disk pressure doubles the score")
+
+	count, savings := plan.LibrarySavings(full)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, int64(32*gib), savings)
+}
@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// LibraryFile is a file a media item, or an episode of one, points to.
+type LibraryFile struct {
+	MediaID   uuid.UUID
+	EpisodeID *uuid.UUID
+	Path      string
+}
+
+// RelocatedFile is a file whose path a relocation rewrites.
+type RelocatedFile struct {
+	LibraryFile
+	NewPath string
+	// Exists reports whether a file was found at the new path.
+	Exists bool
+}
+
+// Relocation rewrites the paths of a library and its files from one prefix
+// to another, after the files were moved to another disk or mount point.
+type Relocation struct {
+	LibraryID uuid.UUID
+	From      string
+	To        string
+	// LibraryPath is the path of the library after the relocation.
+	LibraryPath string
+	Files       []RelocatedFile
+	// Missing is the number of files not found at their new path.
+	Missing int
+	// Applied reports whether the paths were rewritten, as opposed to a dry
+	// run.
+	Applied bool
+}
+
+// ValidateRelocationPrefixes checks that both prefixes are absolute and
+// differ.
+func ValidateRelocationPrefixes(from, to string) error {
+	if !filepath.IsAbs(from) || !filepath.IsAbs(to) {
+		return errors.New("relocation prefixes must be absolute paths")
+	}
+	if filepath.Clean(from) == filepath.Clean(to) {
+		return errors.New("relocation prefixes must differ")
+	}
+	return nil
+}
+
+// RelocatePath replaces the from prefix of path with to. Only whole path
+// elements match, so /media/tv does not relocate /media/tv2/show.mkv.
+func RelocatePath(path, from, to string) (string, bool) {
+	from = filepath.Clean(from)
+	to = filepath.Clean(to)
+
+	if path == from {
+		return to, true
+	}
+	rest, ok := strings.CutPrefix(path, strings.TrimSuffix(from, "/")+"/")
+	if !ok {
+		return "", false
+	}
+	return filepath.Join(to, rest), true
+}
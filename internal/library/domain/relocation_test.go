@@ -0,0 +1,36 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+)
+
+func TestRelocatePath(t *testing.T) {
+	tests := []struct {
+		path, from, to string
+		want           string
+		ok             bool
+	}{
+		{"/mnt/old/movies/a.mkv", "/mnt/old", "/mnt/new", "/mnt/new/movies/a.mkv", true},
+		{"/mnt/old/movies/a.mkv", "/mnt/old/", "/mnt/new/", "/mnt/new/movies/a.mkv", true},
+		{"/mnt/old", "/mnt/old", "/mnt/new", "/mnt/new", true},
+		// Only whole path elements match
+		{"/mnt/old2/a.mkv", "/mnt/old", "/mnt/new", "", false},
+		{"/srv/a.mkv", "/mnt/old", "/mnt/new", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := domain.RelocatePath(tt.path, tt.from, tt.to)
+		assert.Equal(t, tt.ok, ok, tt.path)
+		assert.Equal(t, tt.want, got, tt.path)
+	}
+}
+
+func TestValidateRelocationPrefixes(t *testing.T) {
+	assert.NoError(t, domain.ValidateRelocationPrefixes("/mnt/old", "/mnt/new"))
+	assert.Error(t, domain.ValidateRelocationPrefixes("mnt/old", "/mnt/new"))
+	assert.Error(t, domain.ValidateRelocationPrefixes("/mnt/old", "/mnt/old/"))
+}
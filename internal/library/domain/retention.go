@@ -0,0 +1,47 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/pkg/saga"
+)
+
+// RetentionPolicy decides how long finished workflows stay in the workflow
+// table before they are archived. A workflow is archived once it is older
+// than MaxAge and is not one of the KeepPerMedia most recent finished
+// workflows of its media item. Zero disables either limit.
+type RetentionPolicy struct {
+	MaxAge       time.Duration
+	KeepPerMedia int
+}
+
+// Enabled reports whether the policy archives anything.
+func (p RetentionPolicy) Enabled() bool {
+	return p.MaxAge > 0 || p.KeepPerMedia > 0
+}
+
+// Cutoff returns the time workflows must have finished before to be
+// archived.
+func (p RetentionPolicy) Cutoff(now time.Time) time.Time {
+	return now.Add(-p.MaxAge)
+}
+
+// FinishedWorkflowStatuses are the statuses of workflows that no longer
+// change and can be archived.
+var FinishedWorkflowStatuses = []saga.WorkflowStatus{
+	saga.WorkflowStatusCompleted,
+	saga.WorkflowStatusCompensated,
+	saga.WorkflowStatusFailed,
+	saga.WorkflowStatusParked,
+}
+
+// WorkflowHistoryFilter selects archived workflows. Nil fields match all.
+type WorkflowHistoryFilter struct {
+	MediaID *uuid.UUID
+	Status  *saga.WorkflowStatus
+	// FinishedAfter and FinishedBefore bound when the workflows finished.
+	FinishedAfter  *time.Time
+	FinishedBefore *time.Time
+}
@@ -0,0 +1,24 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+)
+
+func TestRetentionPolicy(t *testing.T) {
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+
+	assert.False(t, domain.RetentionPolicy{}.Enabled())
+	assert.True(t, domain.RetentionPolicy{KeepPerMedia: 3}.Enabled())
+
+	policy := domain.RetentionPolicy{MaxAge: 30 * 24 * time.Hour}
+	assert.True(t, policy.Enabled())
+	assert.Equal(t, time.Date(2024, 5, 31, 12, 0, 0, 0, time.UTC), policy.Cutoff(now))
+
+	// Without a maximum age only the per-media limit applies
+	assert.Equal(t, now, domain.RetentionPolicy{KeepPerMedia: 3}.Cutoff(now))
+}
@@ -0,0 +1,109 @@
+package domain
+
+import (
+	"path/filepath"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// ScanChangeKind is what a scan would do with a file.
+type ScanChangeKind string
+
+const (
+	// ScanChangeAdded files have no media item yet.
+	ScanChangeAdded ScanChangeKind = "added"
+	// ScanChangeUpdated files changed since their media item was written.
+	ScanChangeUpdated ScanChangeKind = "updated"
+	// ScanChangeRemoved files are known to the library but were not found.
+	ScanChangeRemoved ScanChangeKind = "removed"
+)
+
+// Reasons a scan updates the media item of a file.
+const (
+	ScanUpdateModified   = "modified"
+	ScanUpdateReappeared = "reappeared"
+	ScanUpdateAttached   = "attached to parent"
+)
+
+// ScanChange is a change a scan would make, as reported by a dry run.
+type ScanChange struct {
+	Kind ScanChangeKind
+	Path string
+	// MediaID is the media item the file belongs to, unless it is added.
+	MediaID uuid.UUID
+	// EpisodeID is set for removed episode files.
+	EpisodeID *uuid.UUID
+	// Reasons are why an updated file's media item changes.
+	Reasons []string
+
+	// Title and Year are parsed from the file name of added and updated
+	// files, as the scan would title new media.
+	Title string
+	Year  int
+	// Episode holds the episode numbers parsed from the name of files in
+	// series libraries, if any.
+	Episode *EpisodeNumbers
+	Extra   ExtraType
+	// Candidates are the library items an added file may be a file of,
+	// best first.
+	Candidates []ImportCandidate
+}
+
+// NewScanChange describes a scanned file with the title, year and episode
+// numbers parsed from its name, or from its folder's name in movie folder
+// libraries.
+func NewScanChange(library *Library, kind ScanChangeKind, file *MediaFile) *ScanChange {
+	titlePath := library.TitlePath(file.Path)
+	change := &ScanChange{
+		Kind:  kind,
+		Path:  file.Path,
+		Title: ExtractTitle(titlePath),
+		Year:  ExtractYear(titlePath),
+		Extra: file.Extra,
+	}
+	switch models.MediaType(library.Type) {
+	case models.MediaTypeSeries, models.MediaTypeTV:
+		if numbers, ok := ParseEpisodeNumbers(filepath.Base(file.Path), library.Anime); ok {
+			change.Episode = &numbers
+		}
+	case models.MediaTypeMusicVideo:
+		info := ParseMusicVideo(library.Path, file.Path)
+		change.Title = info.Title
+		change.Year = info.Year
+	}
+	return change
+}
+
+// ScanPreview summarizes a dry run.
+type ScanPreview struct {
+	FilesFound int
+	Added      int
+	Updated    int
+	Removed    int
+
+	// LayoutMismatches are the first files found out of place for the
+	// library's folder profile; LayoutMismatchCount counts all of them.
+	LayoutMismatches    []LayoutMismatch
+	LayoutMismatchCount int
+}
+
+// SetLayoutMismatches records the layout mismatches of the files found,
+// keeping at most MaxLayoutMismatches of them.
+func (p *ScanPreview) SetLayoutMismatches(mismatches []LayoutMismatch) {
+	p.LayoutMismatchCount = len(mismatches)
+	p.LayoutMismatches = mismatches[:min(len(mismatches), MaxLayoutMismatches)]
+}
+
+// Count adds a change to the summary.
+func (p *ScanPreview) Count(change *ScanChange) {
+	switch change.Kind {
+	case ScanChangeAdded:
+		p.Added++
+	case ScanChangeUpdated:
+		p.Updated++
+	case ScanChangeRemoved:
+		p.Removed++
+	}
+}
@@ -0,0 +1,50 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+func TestNewScanChange(t *testing.T) {
+	movies := &domain.Library{Type: string(models.MediaTypeMovie)}
+	change := domain.NewScanChange(movies, domain.ScanChangeAdded,
+		&domain.MediaFile{Path: "/movies/The Matrix (1999).mkv"})
+	assert.Equal(t, domain.ScanChangeAdded, change.Kind)
+	assert.Equal(t, "/movies/The Matrix (1999).mkv", change.Path)
+	assert.Equal(t, 1999, change.Year)
+	assert.Equal(t, "The Matrix", change.Title)
+	assert.Nil(t, change.Episode)
+
+	series := &domain.Library{Type: string(models.MediaTypeSeries)}
+	change = domain.NewScanChange(series, domain.ScanChangeAdded,
+		&domain.MediaFile{Path: "/tv/Show/Show.S01E02.mkv"})
+	if assert.NotNil(t, change.Episode) {
+		assert.Equal(t, domain.EpisodeNumbers{Season: 1, Episodes: []int{2}}, *change.Episode)
+	}
+
+	anime := &domain.Library{Type: string(models.MediaTypeSeries), Anime: true}
+	change = domain.NewScanChange(anime, domain.ScanChangeAdded,
+		&domain.MediaFile{Path: "/anime/[Group] Show - 12 [1080p].mkv"})
+	if assert.NotNil(t, change.Episode) {
+		assert.Equal(t, []int{12}, change.Episode.Absolute)
+	}
+
+	// Episode numbers are only parsed in series libraries
+	change = domain.NewScanChange(movies, domain.ScanChangeAdded,
+		&domain.MediaFile{Path: "/movies/Show.S01E02.mkv"})
+	assert.Nil(t, change.Episode)
+}
+
+func TestScanPreviewCount(t *testing.T) {
+	var preview domain.ScanPreview
+	for _, kind := range []domain.ScanChangeKind{
+		domain.ScanChangeAdded, domain.ScanChangeAdded, domain.ScanChangeUpdated, domain.ScanChangeRemoved,
+	} {
+		preview.Count(&domain.ScanChange{Kind: kind})
+	}
+	assert.Equal(t, domain.ScanPreview{Added: 2, Updated: 1, Removed: 1}, preview)
+}
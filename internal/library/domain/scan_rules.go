@@ -0,0 +1,212 @@
+package domain
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ExtraType classifies media that accompanies a main feature.
+type ExtraType string
+
+const (
+	ExtraTypeSample          ExtraType = "sample"
+	ExtraTypeTrailer         ExtraType = "trailer"
+	ExtraTypeFeaturette      ExtraType = "featurette"
+	ExtraTypeBehindTheScenes ExtraType = "behind_the_scenes"
+	ExtraTypeDeletedScene    ExtraType = "deleted_scene"
+	ExtraTypeInterview       ExtraType = "interview"
+	ExtraTypeScene           ExtraType = "scene"
+	ExtraTypeShort           ExtraType = "short"
+	ExtraTypeOther           ExtraType = "other"
+)
+
+// regexPatternPrefix marks an exclusion pattern as a regular expression.
+const regexPatternPrefix = "re:"
+
+// extraDirectories maps the folder names that hold extras to their type.
+var extraDirectories = map[string]ExtraType{
+	"extras":            ExtraTypeOther,
+	"other":             ExtraTypeOther,
+	"sample":            ExtraTypeSample,
+	"samples":           ExtraTypeSample,
+	"trailers":          ExtraTypeTrailer,
+	"featurettes":       ExtraTypeFeaturette,
+	"behind the scenes": ExtraTypeBehindTheScenes,
+	"deleted scenes":    ExtraTypeDeletedScene,
+	"interviews":        ExtraTypeInterview,
+	"scenes":            ExtraTypeScene,
+	"shorts":            ExtraTypeShort,
+}
+
+// File name suffixes that mark extras, such as "Movie-trailer.mkv". Samples
+// and trailers also accept ".", "_" and " " separators.
+var (
+	extraSuffixPattern = regexp.MustCompile(
+		`(?i)(?:-(featurette|behindthescenes|deleted|interview|scene|short|other)|[-._ ](sample|trailer))$`,
+	)
+	extraSuffixes = map[string]ExtraType{
+		"sample":          ExtraTypeSample,
+		"trailer":         ExtraTypeTrailer,
+		"featurette":      ExtraTypeFeaturette,
+		"behindthescenes": ExtraTypeBehindTheScenes,
+		"deleted":         ExtraTypeDeletedScene,
+		"interview":       ExtraTypeInterview,
+		"scene":           ExtraTypeScene,
+		"short":           ExtraTypeShort,
+		"other":           ExtraTypeOther,
+	}
+)
+
+// episodeTagPattern matches episode tags such as "S01E02".
+var episodeTagPattern = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])s(\d{1,2})e(\d{1,3})(?:\D|$)`)
+
+// partialFileSuffixes are the suffixes download clients give incomplete files.
+var partialFileSuffixes = []string{".part", ".partial", ".!qb", ".!ut", ".crdownload", ".download"}
+
+// ScanRules decides which files a library scan picks up.
+type ScanRules struct {
+	globs      []string
+	regexes    []*regexp.Regexp
+	extrasMode ExtrasMode
+	// ignoreExtrasFolders skips extras folders without walking them
+	ignoreExtrasFolders bool
+}
+
+// NewScanRules compiles a library's exclusion patterns. Globs are matched
+// against both the file name and the path relative to the library root;
+// patterns prefixed with "re:" are regular expressions matched against the
+// relative path.
+func NewScanRules(library *Library) (*ScanRules, error) {
+	rules := &ScanRules{
+		extrasMode:          library.ExtrasMode,
+		ignoreExtrasFolders: library.IgnoreExtrasFolders,
+	}
+
+	switch library.ExtrasMode {
+	case "":
+		rules.extrasMode = ExtrasModeSkip
+	case ExtrasModeSkip, ExtrasModeAttach:
+	default:
+		return nil, fmt.Errorf("unknown extras mode %q", library.ExtrasMode)
+	}
+
+	for _, pattern := range library.ExcludePatterns {
+		if expr, ok := strings.CutPrefix(pattern, regexPatternPrefix); ok {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+			}
+			rules.regexes = append(rules.regexes, re)
+			continue
+		}
+
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+		}
+		rules.globs = append(rules.globs, pattern)
+	}
+
+	return rules, nil
+}
+
+// Excluded reports whether a path relative to the library root matches an
+// exclusion pattern.
+func (r *ScanRules) Excluded(relPath string) bool {
+	if r == nil {
+		return false
+	}
+
+	relPath = filepath.ToSlash(relPath)
+	name := filepath.Base(relPath)
+	for _, glob := range r.globs {
+		if ok, _ := filepath.Match(glob, name); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(glob, relPath); ok {
+			return true
+		}
+	}
+	for _, re := range r.regexes {
+		if re.MatchString(relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// AttachExtras reports whether extras are added to the library.
+func (r *ScanRules) AttachExtras() bool {
+	return r != nil && r.extrasMode == ExtrasModeAttach
+}
+
+// IgnoresFolder reports whether a folder, given by its name, is left out of
+// scans as an extras folder. Extras named by their file names are still
+// handled by the extras mode.
+func (r *ScanRules) IgnoresFolder(name string) bool {
+	if r == nil || !r.ignoreExtrasFolders {
+		return false
+	}
+	_, ok := extraDirectories[strings.ToLower(name)]
+	return ok
+}
+
+// IsHidden reports whether a file or directory name is hidden.
+func IsHidden(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+// IsPartialFile reports whether a file is an incomplete download.
+func IsPartialFile(name string) bool {
+	name = strings.ToLower(name)
+	for _, suffix := range partialFileSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectExtra classifies a file, given by its path relative to the library
+// root, as an extra. It returns the extra type and the directory, relative to
+// the root, that holds the parent media; the type is empty for main media.
+// Files inside an extras folder belong to the media next to that folder.
+func DetectExtra(relPath string) (ExtraType, string) {
+	dirs := strings.Split(filepath.ToSlash(filepath.Dir(relPath)), "/")
+	for i, dir := range dirs {
+		if extra, ok := extraDirectories[strings.ToLower(dir)]; ok {
+			parent := strings.Join(dirs[:i], "/")
+			if parent == "" {
+				parent = "."
+			}
+			return extra, filepath.FromSlash(parent)
+		}
+	}
+
+	name := strings.TrimSuffix(filepath.Base(relPath), filepath.Ext(relPath))
+	if match := extraSuffixPattern.FindStringSubmatch(name); match != nil {
+		suffix := match[1] + match[2]
+		return extraSuffixes[strings.ToLower(suffix)], filepath.Dir(relPath)
+	}
+	// A file named just "sample" has no separator
+	if strings.EqualFold(name, "sample") {
+		return ExtraTypeSample, filepath.Dir(relPath)
+	}
+
+	return "", ""
+}
+
+// ParseEpisodeTag returns the season and episode numbers of an "S01E02"
+// style tag in a file name.
+func ParseEpisodeTag(name string) (int, int, bool) {
+	match := episodeTagPattern.FindStringSubmatch(name)
+	if match == nil {
+		return 0, 0, false
+	}
+
+	season, _ := strconv.Atoi(match[1])
+	episode, _ := strconv.Atoi(match[2])
+	return season, episode, true
+}
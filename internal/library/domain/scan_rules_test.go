@@ -0,0 +1,142 @@
+package domain_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/logger"
+)
+
+type ScanRulesTestSuite struct {
+	suite.Suite
+}
+
+func (suite *ScanRulesTestSuite) TestNewScanRules_Validation() {
+	_, err := domain.NewScanRules(&domain.Library{ExcludePatterns: []string{"[unclosed"}})
+	suite.Error(err)
+
+	_, err = domain.NewScanRules(&domain.Library{ExcludePatterns: []string{"re:(unclosed"}})
+	suite.Error(err)
+
+	_, err = domain.NewScanRules(&domain.Library{ExtrasMode: "keep"})
+	suite.Error(err)
+
+	rules, err := domain.NewScanRules(&domain.Library{})
+	suite.Require().NoError(err)
+	suite.False(rules.AttachExtras())
+}
+
+func (suite *ScanRulesTestSuite) TestExcluded() {
+	rules, err := domain.NewScanRules(&domain.Library{
+		ExcludePatterns: []string{"*.iso", "Movies/Unsorted", `re:(?i)\bcam\b`},
+	})
+	suite.Require().NoError(err)
+
+	suite.True(rules.Excluded("Movies/Heat (1995)/heat.iso"))
+	suite.True(rules.Excluded("Movies/Unsorted"))
+	suite.True(rules.Excluded("Movies/Heat CAM.mkv"))
+	suite.False(rules.Excluded("Movies/Heat (1995)/heat.mkv"))
+	suite.False(rules.Excluded("Movies/Camera Obscura.mkv"))
+}
+
+func (suite *ScanRulesTestSuite) TestDetectExtra() {
+	tests := []struct {
+		path   string
+		extra  domain.ExtraType
+		parent string
+	}{
+		{"Heat (1995)/Heat (1995).mkv", "", ""},
+		{"Heat (1995)/Heat-trailer.mkv", domain.ExtraTypeTrailer, "Heat (1995)"},
+		{"Heat (1995)/heat.sample.mkv", domain.ExtraTypeSample, "Heat (1995)"},
+		{"Heat (1995)/Sample/heat.mkv", domain.ExtraTypeSample, "Heat (1995)"},
+		{"Heat (1995)/Featurettes/Making Of.mkv", domain.ExtraTypeFeaturette, "Heat (1995)"},
+		{"Heat (1995)/Behind The Scenes/Part 1.mkv", domain.ExtraTypeBehindTheScenes, "Heat (1995)"},
+		{"Extras/Interview.mkv", domain.ExtraTypeOther, "."},
+		{"The Other Guys (2010)/The Other Guys.mkv", "", ""},
+	}
+
+	for _, tt := range tests {
+		extra, parent := domain.DetectExtra(filepath.FromSlash(tt.path))
+		suite.Equal(tt.extra, extra, tt.path)
+		suite.Equal(filepath.FromSlash(tt.parent), parent, tt.path)
+	}
+}
+
+func (suite *ScanRulesTestSuite) TestParseEpisodeTag() {
+	season, episode, ok := domain.ParseEpisodeTag("Show.S01E02-deleted.mkv")
+	suite.True(ok)
+	suite.Equal(1, season)
+	suite.Equal(2, episode)
+
+	season, episode, ok = domain.ParseEpisodeTag("show_s10e103_trailer.mkv")
+	suite.True(ok)
+	suite.Equal(10, season)
+	suite.Equal(103, episode)
+
+	_, _, ok = domain.ParseEpisodeTag("Heat-trailer.mkv")
+	suite.False(ok)
+}
+
+func (suite *ScanRulesTestSuite) TestScanDirectoryIncremental_Rules() {
+	root := suite.T().TempDir()
+	for _, name := range []string{
+		"Heat (1995)/Heat (1995).mkv",
+		"Heat (1995)/Heat-trailer.mkv",
+		"Heat (1995)/Sample/heat.mkv",
+		"Heat (1995)/Heat (1995).mkv.part",
+		"Heat (1995)/.hidden.mkv",
+		".trash/Old.mkv",
+		"Unsorted/Clip.mkv",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		suite.Require().NoError(os.MkdirAll(filepath.Dir(path), 0o755))
+		suite.Require().NoError(os.WriteFile(path, []byte("fake video content"), 0o644))
+	}
+	scanner := domain.NewScanner(logger.NewNoopLogger())
+
+	// Extras are skipped by default
+	rules, err := domain.NewScanRules(&domain.Library{ExcludePatterns: []string{"Unsorted"}})
+	suite.Require().NoError(err)
+	scan, err := scanner.ScanDirectoryIncremental(root, "movie", rules, nil)
+	suite.Require().NoError(err)
+	suite.Require().Len(scan.Files, 1)
+	suite.Equal(filepath.Join(root, "Heat (1995)", "Heat (1995).mkv"), scan.Files[0].Path)
+
+	// Attached extras point at the directory of their parent media
+	rules, err = domain.NewScanRules(&domain.Library{
+		ExcludePatterns: []string{"Unsorted"},
+		ExtrasMode:      domain.ExtrasModeAttach,
+	})
+	suite.Require().NoError(err)
+	scan, err = scanner.ScanDirectoryIncremental(root, "movie", rules, nil)
+	suite.Require().NoError(err)
+	suite.Require().Len(scan.Files, 3)
+	for _, file := range scan.Files {
+		if file.Extra != "" {
+			suite.Equal(filepath.Join(root, "Heat (1995)"), file.ParentDir)
+		}
+	}
+
+	// Ignored extras folders are not walked, but extras named by their file
+	// names are still attached
+	rules, err = domain.NewScanRules(&domain.Library{
+		ExcludePatterns:     []string{"Unsorted"},
+		ExtrasMode:          domain.ExtrasModeAttach,
+		IgnoreExtrasFolders: true,
+	})
+	suite.Require().NoError(err)
+	suite.True(rules.IgnoresFolder("Sample"))
+	suite.False(rules.IgnoresFolder("Heat (1995)"))
+	scan, err = scanner.ScanDirectoryIncremental(root, "movie", rules, nil)
+	suite.Require().NoError(err)
+	suite.Require().Len(scan.Files, 2)
+	suite.NotContains(scan.Manifest, filepath.Join(root, "Heat (1995)", "Sample"))
+}
+
+func TestScanRulesTestSuite(t *testing.T) {
+	suite.Run(t, new(ScanRulesTestSuite))
+}
@@ -2,6 +2,7 @@ package domain
 
 import (
 	"context"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -20,6 +21,11 @@ type MediaFile struct {
 	Path     string
 	Size     int64
 	Modified time.Time
+
+	// Extra is set for samples, trailers and other extras, whose parent
+	// media is in ParentDir.
+	Extra     ExtraType
+	ParentDir string
 }
 
 // Scanner handles directory scanning for media files.
@@ -89,10 +95,126 @@ func (s *Scanner) ScanDirectory(path string, mediaType string) ([]*MediaFile, er
 	return files, err
 }
 
+// IncrementalScan is the result of an incremental directory scan.
+type IncrementalScan struct {
+	// Files are the media files in new or changed directories.
+	Files []*MediaFile
+	// Manifest is the state of every directory, to be used by the next scan.
+	Manifest ScanManifest
+	// SkippedDirs is the number of directories unchanged since the previous scan.
+	SkippedDirs int
+}
+
+// ScanDirectoryIncremental scans a directory for media files, skipping the
+// files of directories whose mtime matches the previous manifest. A
+// directory's mtime changes when entries are added, removed or renamed in it,
+// so unchanged directories hold no new files and their files are not
+// stat'ed. Subdirectories are still visited because their changes do not
+// propagate upward. Files rewritten in place keep their directory's mtime;
+// pass a nil manifest to scan every file.
+//
+// Hidden files and directories, partial downloads and paths excluded by the
+// rules are skipped. Extras are skipped unless the rules attach them, and
+// extras folders are not walked when the rules ignore them.
+func (s *Scanner) ScanDirectoryIncremental(
+	path string,
+	mediaType string,
+	rules *ScanRules,
+	previous ScanManifest,
+) (*IncrementalScan, error) {
+	extensions := getMediaExtensions(models.MediaType(mediaType))
+	scan := &IncrementalScan{Manifest: make(ScanManifest)}
+	unchanged := make(map[string]bool)
+
+	err := filepath.WalkDir(path, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			s.logger.Warn("Error accessing path",
+				interfaces.String("path", filePath),
+				interfaces.Error(err))
+			return nil // Continue scanning
+		}
+
+		relPath, err := filepath.Rel(path, filePath)
+		if err != nil {
+			return nil
+		}
+
+		if d.IsDir() {
+			if filePath != path && (IsHidden(d.Name()) || rules.Excluded(relPath) || rules.IgnoresFolder(d.Name())) {
+				return filepath.SkipDir
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				s.logger.Warn("Error accessing path",
+					interfaces.String("path", filePath),
+					interfaces.Error(err))
+				return nil
+			}
+
+			// Manifests are persisted with microsecond precision
+			modTime := info.ModTime().UTC().Truncate(time.Microsecond)
+			if state, ok := previous[filePath]; ok && state.ModTime.Equal(modTime) {
+				scan.Manifest[filePath] = state
+				unchanged[filePath] = true
+				scan.SkippedDirs++
+				return nil
+			}
+
+			scan.Manifest[filePath] = DirectoryState{Path: filePath, ModTime: modTime}
+			return nil
+		}
+
+		// Skip files of unchanged directories
+		dir := filepath.Dir(filePath)
+		if unchanged[dir] {
+			return nil
+		}
+
+		if IsHidden(d.Name()) || IsPartialFile(d.Name()) || rules.Excluded(relPath) {
+			return nil
+		}
+
+		// Check if file has a valid media extension
+		if !contains(extensions, strings.ToLower(filepath.Ext(filePath))) {
+			return nil
+		}
+
+		file := &MediaFile{Path: filePath}
+		if extra, parentDir := DetectExtra(relPath); extra != "" {
+			if !rules.AttachExtras() {
+				return nil
+			}
+			file.Extra = extra
+			file.ParentDir = filepath.Join(path, parentDir)
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			s.logger.Warn("Error accessing path",
+				interfaces.String("path", filePath),
+				interfaces.Error(err))
+			return nil
+		}
+		file.Size = info.Size()
+		file.Modified = info.ModTime()
+		scan.Files = append(scan.Files, file)
+
+		state := scan.Manifest[dir]
+		state.Size += info.Size()
+		state.Files++
+		scan.Manifest[dir] = state
+
+		return nil
+	})
+
+	return scan, err
+}
+
 // getMediaExtensions returns valid file extensions for a media type.
 func getMediaExtensions(mediaType models.MediaType) []string {
 	switch mediaType {
-	case models.MediaTypeMovie, models.MediaTypeSeries, models.MediaTypeTV:
+	case models.MediaTypeMovie, models.MediaTypeSeries, models.MediaTypeTV, models.MediaTypeMusicVideo:
 		return []string{
 			".mp4", ".mkv", ".avi", ".mov", ".wmv", ".flv", ".webm",
 			".m4v", ".mpg", ".mpeg", ".3gp", ".ogv", ".ts", ".vob",
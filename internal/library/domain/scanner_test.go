@@ -13,6 +13,7 @@ import (
 
 	"github.com/narwhalmedia/narwhal/internal/library/domain"
 	"github.com/narwhalmedia/narwhal/pkg/logger"
+	"github.com/narwhalmedia/narwhal/test/testutil"
 )
 
 type ScannerTestSuite struct {
@@ -278,6 +279,59 @@ func (suite *ScannerTestSuite) TestConcurrentScanning() {
 	suite.Equal(1, result2.FilesFound)
 }
 
+func (suite *ScannerTestSuite) TestScanDirectoryIncremental() {
+	// Arrange
+	seasonDir := suite.createTestDir("show/season1")
+	suite.createTestFile("movie1.mp4", "fake video content")
+	suite.createTestFile("show/season1/episode1.mkv", "fake video content")
+
+	first, err := suite.scanner.ScanDirectoryIncremental(suite.tempDir, "movie", nil, nil)
+	suite.Require().NoError(err)
+	suite.Len(first.Files, 2)
+	suite.Zero(first.SkippedDirs)
+	suite.Equal(1, first.Manifest[seasonDir].Files)
+
+	// Act: only the season directory gains a file
+	past := time.Now().Add(-time.Hour)
+	for _, dir := range []string{suite.tempDir, filepath.Join(suite.tempDir, "show")} {
+		suite.Require().NoError(os.Chtimes(dir, past, past))
+	}
+	first, err = suite.scanner.ScanDirectoryIncremental(suite.tempDir, "movie", nil, nil)
+	suite.Require().NoError(err)
+	suite.createTestFile("show/season1/episode2.mkv", "fake video content")
+
+	second, err := suite.scanner.ScanDirectoryIncremental(suite.tempDir, "movie", nil, first.Manifest)
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Equal(2, second.SkippedDirs)
+	suite.Len(second.Files, 2)
+	for _, file := range second.Files {
+		suite.Equal(seasonDir, filepath.Dir(file.Path))
+	}
+	suite.Equal(first.Manifest[suite.tempDir], second.Manifest[suite.tempDir])
+	suite.Equal(2, second.Manifest[seasonDir].Files)
+}
+
+func (suite *ScannerTestSuite) TestScanDirectory_MediaTree() {
+	// Arrange
+	tree := testutil.NewMediaTree(suite.T())
+	movie := tree.Movie("Heat", 1995)
+	tree.File("Movies/Heat (1995)/Heat (1995).en.srt", []byte("1\n00:00:01,000 --> 00:00:02,000\nHi\n"))
+	episodes := tree.Show("Dark", 2, 3)
+
+	// Act
+	movies, err := suite.scanner.ScanDirectory(tree.MoviesPath(), "movie")
+	suite.Require().NoError(err)
+	shows, err := suite.scanner.ScanDirectory(tree.TVPath(), "series")
+	suite.Require().NoError(err)
+
+	// Assert
+	suite.Require().Len(movies, 1)
+	suite.Equal(movie, movies[0].Path)
+	suite.Len(shows, len(episodes))
+}
+
 func TestScannerTestSuite(t *testing.T) {
 	suite.Run(t, new(ScannerTestSuite))
 }
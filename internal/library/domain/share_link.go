@@ -0,0 +1,129 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ShareLinkStatus describes whether a share link can still be played.
+type ShareLinkStatus string
+
+// Share link statuses.
+const (
+	ShareLinkActive    ShareLinkStatus = "active"
+	ShareLinkRevoked   ShareLinkStatus = "revoked"
+	ShareLinkExpired   ShareLinkStatus = "expired"
+	ShareLinkExhausted ShareLinkStatus = "exhausted"
+)
+
+// ShareLink lets a guest without an account stream one media item until it
+// expires, is revoked or has been played MaxViews times. Only a hash of its
+// token is stored.
+type ShareLink struct {
+	ID        uuid.UUID
+	TenantID  uuid.UUID
+	MediaID   uuid.UUID
+	CreatedBy uuid.UUID
+	TokenHash string
+	// MaxBitrate is the highest bitrate guests stream at, in kbps.
+	MaxBitrate int
+	// MaxViews is the number of plays allowed; zero is unlimited.
+	MaxViews  int
+	Views     int
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+// Status returns the status of the link at the given time.
+func (l *ShareLink) Status(now time.Time) ShareLinkStatus {
+	switch {
+	case l.RevokedAt != nil:
+		return ShareLinkRevoked
+	case !now.Before(l.ExpiresAt):
+		return ShareLinkExpired
+	case l.MaxViews > 0 && l.Views >= l.MaxViews:
+		return ShareLinkExhausted
+	default:
+		return ShareLinkActive
+	}
+}
+
+// ShareLinkPlay records a guest playing a share link.
+type ShareLinkPlay struct {
+	ID          uuid.UUID
+	ShareLinkID uuid.UUID
+	MediaID     uuid.UUID
+	IPAddress   string
+	UserAgent   string
+	PlayedAt    time.Time
+}
+
+// ShareLinkFilter narrows the share links listed.
+type ShareLinkFilter struct {
+	// CreatedBy limits the links to those a user created.
+	CreatedBy *uuid.UUID
+	// MediaID limits the links to those of a media item.
+	MediaID *uuid.UUID
+}
+
+// ShareLinkPolicy bounds the share links users create.
+type ShareLinkPolicy struct {
+	// MaxTTL is the longest a link may stay valid.
+	MaxTTL time.Duration
+	// MaxBitrate is the highest bitrate a link may allow, in kbps.
+	MaxBitrate int
+	// StreamTTL is how long the stream token of a play stays valid. It
+	// also bounds how long a play outlasts the revocation of its link.
+	StreamTTL time.Duration
+}
+
+// Apply sets the expiry and limits of a new link. A zero ttl gives the
+// longest validity allowed and a zero bitrate the highest bitrate allowed.
+func (p ShareLinkPolicy) Apply(link *ShareLink, ttl time.Duration, maxViews, maxBitrate int) error {
+	if ttl < 0 || maxViews < 0 || maxBitrate < 0 {
+		return errors.New("expiry, views and bitrate cannot be negative")
+	}
+	if ttl > p.MaxTTL {
+		return errors.New("share links cannot be valid that long")
+	}
+	if ttl == 0 {
+		ttl = p.MaxTTL
+	}
+	if maxBitrate == 0 || maxBitrate > p.MaxBitrate {
+		maxBitrate = p.MaxBitrate
+	}
+
+	link.ExpiresAt = link.CreatedAt.Add(ttl)
+	link.MaxViews = maxViews
+	link.MaxBitrate = maxBitrate
+	return nil
+}
+
+// StreamExpiry returns when the stream token of a play starting at now
+// expires: after the stream TTL, but not after the link.
+func (p ShareLinkPolicy) StreamExpiry(link *ShareLink, now time.Time) time.Time {
+	expiry := now.Add(p.StreamTTL)
+	if link.ExpiresAt.Before(expiry) {
+		return link.ExpiresAt
+	}
+	return expiry
+}
+
+// ShareGrant is what a guest gets for playing a share link: the token to
+// stream the shared media with, until it expires.
+type ShareGrant struct {
+	Link        *ShareLink
+	StreamToken string
+	ExpiresAt   time.Time
+}
+
+// HashShareToken returns the stored representation of a share link token.
+func HashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
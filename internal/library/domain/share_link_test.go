@@ -0,0 +1,46 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+)
+
+func TestShareLinkPolicyApply(t *testing.T) {
+	policy := domain.ShareLinkPolicy{MaxTTL: 24 * time.Hour, MaxBitrate: 4000, StreamTTL: time.Hour}
+	now := time.Now()
+
+	link := &domain.ShareLink{CreatedAt: now}
+	require.NoError(t, policy.Apply(link, 0, 3, 0))
+	assert.Equal(t, now.Add(24*time.Hour), link.ExpiresAt, "links default to the longest validity")
+	assert.Equal(t, 4000, link.MaxBitrate, "links default to the highest bitrate")
+	assert.Equal(t, 3, link.MaxViews)
+
+	require.NoError(t, policy.Apply(link, time.Hour, 0, 8000))
+	assert.Equal(t, 4000, link.MaxBitrate, "bitrates are capped")
+	require.NoError(t, policy.Apply(link, time.Hour, 0, 1500))
+	assert.Equal(t, 1500, link.MaxBitrate)
+
+	assert.Error(t, policy.Apply(link, 48*time.Hour, 0, 0))
+	assert.Error(t, policy.Apply(link, time.Hour, -1, 0))
+}
+
+func TestShareLinkStatus(t *testing.T) {
+	policy := domain.ShareLinkPolicy{StreamTTL: time.Hour}
+	now := time.Now()
+	link := &domain.ShareLink{ExpiresAt: now.Add(30 * time.Minute), MaxViews: 2, Views: 1}
+
+	assert.Equal(t, domain.ShareLinkActive, link.Status(now))
+	assert.Equal(t, domain.ShareLinkExpired, link.Status(now.Add(time.Hour)))
+	assert.Equal(t, link.ExpiresAt, policy.StreamExpiry(link, now), "streams end with their link")
+
+	link.Views = 2
+	assert.Equal(t, domain.ShareLinkExhausted, link.Status(now))
+
+	link.RevokedAt = &now
+	assert.Equal(t, domain.ShareLinkRevoked, link.Status(now))
+}
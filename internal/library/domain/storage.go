@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ResolutionUnknown is the resolution storage usage is reported under for
+// files whose resolution has not been probed.
+const ResolutionUnknown = "unknown"
+
+// StorageUsage is the disk space taken by the files of one media type and
+// resolution in a library.
+type StorageUsage struct {
+	LibraryID  uuid.UUID
+	TenantID   uuid.UUID
+	MediaType  string
+	Resolution string
+	FileCount  int64
+	TotalBytes int64
+	UpdatedAt  time.Time
+}
+
+// StorageTotals sums storage usage along one dimension, such as by media
+// type across every library.
+type StorageTotals map[string]*StorageUsage
+
+// Add counts a usage row under key.
+func (t StorageTotals) Add(key string, usage *StorageUsage) {
+	total, ok := t[key]
+	if !ok {
+		total = &StorageUsage{}
+		t[key] = total
+	}
+	total.FileCount += usage.FileCount
+	total.TotalBytes += usage.TotalBytes
+	if usage.UpdatedAt.After(total.UpdatedAt) {
+		total.UpdatedAt = usage.UpdatedAt
+	}
+}
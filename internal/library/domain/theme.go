@@ -0,0 +1,116 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// ThemeFileName is the name of theme music sidecar files.
+const ThemeFileName = "theme.mp3"
+
+// maxThemeSearchDepth is how many directories above a media file are
+// searched for a theme sidecar, covering "Show/Season 01/episode.mkv".
+const maxThemeSearchDepth = 2
+
+// ThemeProvider downloads theme music for series from an external source.
+type ThemeProvider interface {
+	GetName() string
+	// GetTheme returns the MP3 theme of a series, or ErrThemeNotFound.
+	// Themes larger than maxBytes are rejected.
+	GetTheme(ctx context.Context, media *models.Media, maxBytes int) ([]byte, error)
+}
+
+// FindThemeSidecar looks for a theme.mp3 next to a media file and in the
+// directory above it, without leaving the library root. Sidecars in the
+// root itself are ignored, as they would apply to every series.
+func FindThemeSidecar(libraryRoot, mediaPath string) (string, bool) {
+	root := filepath.Clean(libraryRoot)
+	dir := filepath.Dir(filepath.Clean(mediaPath))
+
+	for range maxThemeSearchDepth {
+		rel, err := filepath.Rel(root, dir)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			return "", false
+		}
+
+		path := filepath.Join(dir, ThemeFileName)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path, true
+		}
+		dir = filepath.Dir(dir)
+	}
+	return "", false
+}
+
+// IsMP3 reports whether data starts like an MP3 file: with an ID3v2 tag or
+// an MPEG audio frame header.
+func IsMP3(data []byte) bool {
+	if len(data) >= 3 && string(data[:3]) == "ID3" {
+		return true
+	}
+	return len(data) >= 2 && data[0] == 0xFF && data[1]&0xE0 == 0xE0
+}
+
+// URLThemeProvider downloads themes from a URL template in which {tvdb_id}
+// is replaced with the series' TVDB ID, such as
+// "https://tvthemes.plexapp.com/{tvdb_id}.mp3".
+type URLThemeProvider struct {
+	template string
+	client   *http.Client
+}
+
+// NewURLThemeProvider creates a provider for the URL template.
+func NewURLThemeProvider(template string, client *http.Client) *URLThemeProvider {
+	return &URLThemeProvider{
+		template: template,
+		client:   client,
+	}
+}
+
+// GetName returns the provider name.
+func (p *URLThemeProvider) GetName() string {
+	return "url"
+}
+
+// GetTheme downloads the theme of a series with a TVDB ID.
+func (p *URLThemeProvider) GetTheme(ctx context.Context, media *models.Media, maxBytes int) ([]byte, error) {
+	if media.TVDBID == 0 {
+		return nil, ErrThemeNotFound
+	}
+
+	url := strings.ReplaceAll(p.template, "{tvdb_id}", strconv.Itoa(media.TVDBID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create theme request: %w", err)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download theme: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrThemeNotFound
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("failed to download theme: unexpected status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(maxBytes)+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download theme: %w", err)
+	}
+	if len(data) > maxBytes {
+		return nil, fmt.Errorf("theme exceeds %d bytes", maxBytes)
+	}
+	return data, nil
+}
@@ -0,0 +1,78 @@
+package domain_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+type ThemeTestSuite struct {
+	suite.Suite
+}
+
+func (suite *ThemeTestSuite) TestFindThemeSidecar() {
+	root := suite.T().TempDir()
+	show := filepath.Join(root, "Show")
+	season := filepath.Join(show, "Season 01")
+	suite.Require().NoError(os.MkdirAll(season, 0o755))
+	suite.Require().NoError(os.WriteFile(filepath.Join(show, domain.ThemeFileName), []byte("ID3"), 0o644))
+	suite.Require().NoError(os.WriteFile(filepath.Join(root, domain.ThemeFileName), []byte("ID3"), 0o644))
+
+	// Episodes in a season folder find the theme of their series
+	path, ok := domain.FindThemeSidecar(root, filepath.Join(season, "Show S01E01.mkv"))
+	suite.True(ok)
+	suite.Equal(filepath.Join(show, domain.ThemeFileName), path)
+
+	// The library root's own theme is ignored
+	_, ok = domain.FindThemeSidecar(root, filepath.Join(root, "Other S01E01.mkv"))
+	suite.False(ok)
+
+	_, ok = domain.FindThemeSidecar(root, filepath.Join(suite.T().TempDir(), "Show", "Show S01E01.mkv"))
+	suite.False(ok)
+}
+
+func (suite *ThemeTestSuite) TestIsMP3() {
+	suite.True(domain.IsMP3([]byte("ID3\x04\x00")))
+	suite.True(domain.IsMP3([]byte{0xFF, 0xFB, 0x90}))
+	suite.False(domain.IsMP3([]byte("RIFF")))
+	suite.False(domain.IsMP3(nil))
+}
+
+func (suite *ThemeTestSuite) TestURLThemeProvider() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/121361.mp3" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("ID3 theme"))
+	}))
+	defer server.Close()
+
+	provider := domain.NewURLThemeProvider(server.URL+"/{tvdb_id}.mp3", server.Client())
+	ctx := context.Background()
+
+	data, err := provider.GetTheme(ctx, &models.Media{TVDBID: 121361}, 1024)
+	suite.Require().NoError(err)
+	suite.Equal("ID3 theme", string(data))
+
+	_, err = provider.GetTheme(ctx, &models.Media{TVDBID: 1}, 1024)
+	suite.ErrorIs(err, domain.ErrThemeNotFound)
+
+	_, err = provider.GetTheme(ctx, &models.Media{}, 1024)
+	suite.ErrorIs(err, domain.ErrThemeNotFound)
+
+	_, err = provider.GetTheme(ctx, &models.Media{TVDBID: 121361}, 4)
+	suite.Error(err)
+}
+
+func TestThemeTestSuite(t *testing.T) {
+	suite.Run(t, new(ThemeTestSuite))
+}
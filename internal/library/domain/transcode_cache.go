@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/pkg/loudness"
+)
+
+// sourceHashSample is the number of bytes read from each end of a source
+// file to hash it. Reading whole files would take minutes for a film, and
+// the start, end and size of a file tell files apart in practice.
+const sourceHashSample = 4 << 20
+
+// TranscodeOutput is a completed transcode, kept so that transcoding the
+// same source content with the same profile again links the output instead
+// of re-encoding. Outputs are keyed by the hash of the source content, so
+// copies of a file share them, and a changed file no longer matches.
+type TranscodeOutput struct {
+	SourceHash  string
+	ProfileHash string
+	// MediaID is the media item whose transcode produced the output.
+	MediaID     uuid.UUID
+	Path        string
+	Size        int64
+	CompletedAt time.Time
+}
+
+// HashTranscodeSource returns the content hash of a source file: a SHA-256
+// of its size and of up to sourceHashSample bytes from its start and end.
+func HashTranscodeSource(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open source: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to stat source: %w", err)
+	}
+	size := info.Size()
+
+	h := sha256.New()
+	_ = binary.Write(h, binary.BigEndian, size)
+	if _, err := io.CopyN(h, f, min(size, sourceHashSample)); err != nil {
+		return "", fmt.Errorf("failed to read source: %w", err)
+	}
+	if tail := size - sourceHashSample; tail > 0 {
+		if _, err := f.Seek(max(tail, sourceHashSample), io.SeekStart); err != nil {
+			return "", fmt.Errorf("failed to read source: %w", err)
+		}
+		if _, err := io.Copy(h, f); err != nil {
+			return "", fmt.Errorf("failed to read source: %w", err)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// TranscodeProfileHash identifies the output a resolved policy asks for:
+// its format, profile, which names the encoding settings or ladder of the
+// transcoding service, and audio normalization. Policies asking for the
+// same output share it.
+func TranscodeProfileHash(policy *TranscodePolicy) string {
+	sum := sha256.Sum256([]byte(policy.Format + "\x00" + policy.outputProfile()))
+	return hex.EncodeToString(sum[:16])
+}
+
+// LoudnessMeasurement is the loudness of a source, measured by the first
+// pass of a normalized transcode. It is kept by source hash, so later
+// normalized transcodes of the source, with any profile, skip the first
+// pass.
+type LoudnessMeasurement struct {
+	SourceHash string
+	Loudness   loudness.Measurement
+	MeasuredAt time.Time
+}
@@ -0,0 +1,53 @@
+package domain_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+)
+
+func TestHashTranscodeSource(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+		return path
+	}
+	hash := func(path string) string {
+		h, err := domain.HashTranscodeSource(path)
+		require.NoError(t, err)
+		return h
+	}
+
+	large := bytes.Repeat([]byte("narwhal"), 2<<20)
+	original := hash(write("original.mkv", large))
+
+	// Copies share a hash whatever their name
+	assert.Equal(t, original, hash(write("copy.mkv", large)))
+
+	// Changing the end of a file changes its hash
+	changed := bytes.Clone(large)
+	changed[len(changed)-1] = 'x'
+	assert.NotEqual(t, original, hash(write("changed.mkv", changed)))
+
+	// Small files are hashed whole
+	assert.NotEqual(t, hash(write("a.mkv", []byte("a"))), hash(write("b.mkv", []byte("b"))))
+
+	_, err := domain.HashTranscodeSource(filepath.Join(dir, "missing.mkv"))
+	assert.Error(t, err)
+}
+
+func TestTranscodeProfileHash(t *testing.T) {
+	policy := &domain.TranscodePolicy{Profile: "480p", Format: domain.TranscodeFormatMP4}
+	other := &domain.TranscodePolicy{Name: "Other", Profile: "480p", Format: domain.TranscodeFormatMP4}
+	assert.Equal(t, domain.TranscodeProfileHash(policy), domain.TranscodeProfileHash(other))
+
+	other.Format = domain.TranscodeFormatHLS
+	assert.NotEqual(t, domain.TranscodeProfileHash(policy), domain.TranscodeProfileHash(other))
+}
@@ -0,0 +1,123 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// Transcode output formats.
+const (
+	TranscodeFormatHLS = "hls"
+	TranscodeFormatMP4 = "mp4"
+)
+
+// TranscodePolicy asks for every available media item of a library to be
+// transcoded with a profile, such as an HLS ladder or a 480p MP4.
+type TranscodePolicy struct {
+	ID        uuid.UUID
+	LibraryID uuid.UUID
+	Name      string
+	Profile   string // transcoding profile name, such as "720p" or "ladder"
+	Format    string // hls or mp4
+	Enabled   bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	// AudioNormalization levels the audio of the transcodes; empty leaves
+	// it to the library.
+	AudioNormalization AudioNormalization
+}
+
+// Validate checks that the policy is complete.
+func (p *TranscodePolicy) Validate() error {
+	if p.Name == "" || p.Profile == "" {
+		return errors.New("policy name and profile are required")
+	}
+	switch p.Format {
+	case TranscodeFormatHLS, TranscodeFormatMP4:
+	default:
+		return fmt.Errorf("unsupported transcode format %q", p.Format)
+	}
+	return p.AudioNormalization.Validate()
+}
+
+// Resolve returns the policy with the audio normalization its library
+// defaults to when it has none, as its transcodes are requested.
+func (p *TranscodePolicy) Resolve(library *Library) *TranscodePolicy {
+	resolved := *p
+	if resolved.AudioNormalization == AudioNormalizationDefault {
+		resolved.AudioNormalization = library.AudioNormalization
+	}
+	if resolved.AudioNormalization == AudioNormalizationDefault {
+		resolved.AudioNormalization = AudioNormalizationOff
+	}
+	return &resolved
+}
+
+// Normalizes reports whether the transcodes of a resolved policy normalize
+// their audio loudness.
+func (p *TranscodePolicy) Normalizes() bool {
+	return p.AudioNormalization == AudioNormalizationLoudnorm
+}
+
+// outputProfile names the encoding settings of the transcodes of the
+// policy: its profile, and the normalization of a resolved policy.
+// Transcodes without normalization keep the bare profile name, so their
+// keys and cached outputs from before normalization existed still match.
+func (p *TranscodePolicy) outputProfile() string {
+	if p.Normalizes() {
+		return p.Profile + "+" + string(AudioNormalizationLoudnorm)
+	}
+	return p.Profile
+}
+
+// AudioNormalization is how the audio loudness of transcodes is leveled.
+type AudioNormalization string
+
+const (
+	// AudioNormalizationDefault leaves the normalization of a policy to
+	// its library, and is off for libraries.
+	AudioNormalizationDefault AudioNormalization = ""
+	// AudioNormalizationOff keeps the loudness of the source.
+	AudioNormalizationOff AudioNormalization = "off"
+	// AudioNormalizationLoudnorm normalizes to EBU R128 with two passes of
+	// ffmpeg's loudnorm filter: one measuring the source, which is cached
+	// per source, and one encoding it.
+	AudioNormalizationLoudnorm AudioNormalization = "loudnorm"
+)
+
+// Validate checks that the normalization is known.
+func (n AudioNormalization) Validate() error {
+	switch n {
+	case AudioNormalizationDefault, AudioNormalizationOff, AudioNormalizationLoudnorm:
+		return nil
+	default:
+		return fmt.Errorf("unknown audio normalization %q", n)
+	}
+}
+
+// AppliesTo reports whether the policy transcodes the media: it must be
+// available, and extras are left alone.
+func (p *TranscodePolicy) AppliesTo(media *models.Media) bool {
+	return p.Enabled &&
+		media.LibraryID == p.LibraryID &&
+		models.MediaStatus(media.Status) == models.MediaStatusAvailable &&
+		media.ExtraType == ""
+}
+
+// TranscodeKey identifies a transcode of a version of a media file with a
+// resolved policy. Two policies asking for the same output share a key, and
+// a replaced file gets a new one, so each output is requested once per
+// file.
+func TranscodeKey(media *models.Media, policy *TranscodePolicy) string {
+	var modified int64
+	if media.FileModifiedAt != nil {
+		modified = media.FileModifiedAt.Unix()
+	}
+	return fmt.Sprintf("%s/%s/%d-%d", policy.Format, policy.outputProfile(), media.FileSize, modified)
+}
@@ -0,0 +1,108 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+type TranscodePolicyTestSuite struct {
+	suite.Suite
+
+	policy *domain.TranscodePolicy
+	media  *models.Media
+}
+
+func (suite *TranscodePolicyTestSuite) SetupTest() {
+	libraryID := uuid.New()
+	modified := time.Unix(1700000000, 0)
+	suite.policy = &domain.TranscodePolicy{
+		ID:        uuid.New(),
+		LibraryID: libraryID,
+		Name:      "Mobile",
+		Profile:   "480p",
+		Format:    domain.TranscodeFormatMP4,
+		Enabled:   true,
+	}
+	suite.media = &models.Media{
+		ID:             uuid.New(),
+		LibraryID:      libraryID,
+		Status:         string(models.MediaStatusAvailable),
+		FileSize:       1024,
+		FileModifiedAt: &modified,
+	}
+}
+
+func (suite *TranscodePolicyTestSuite) TestValidate() {
+	suite.NoError(suite.policy.Validate())
+
+	suite.policy.Format = "webm"
+	suite.Error(suite.policy.Validate())
+
+	suite.policy.Format = domain.TranscodeFormatHLS
+	suite.policy.Profile = ""
+	suite.Error(suite.policy.Validate())
+}
+
+func (suite *TranscodePolicyTestSuite) TestAppliesTo() {
+	suite.True(suite.policy.AppliesTo(suite.media))
+
+	suite.media.Status = string(models.MediaStatusPending)
+	suite.False(suite.policy.AppliesTo(suite.media))
+
+	suite.media.Status = string(models.MediaStatusAvailable)
+	suite.media.ExtraType = "trailer"
+	suite.False(suite.policy.AppliesTo(suite.media))
+
+	suite.media.ExtraType = ""
+	suite.policy.Enabled = false
+	suite.False(suite.policy.AppliesTo(suite.media))
+
+	suite.policy.Enabled = true
+	suite.media.LibraryID = uuid.New()
+	suite.False(suite.policy.AppliesTo(suite.media))
+}
+
+func (suite *TranscodePolicyTestSuite) TestTranscodeKey() {
+	key := domain.TranscodeKey(suite.media, suite.policy)
+	suite.Equal("mp4/480p/1024-1700000000", key)
+
+	// Policies asking for the same output share a key
+	other := *suite.policy
+	other.ID = uuid.New()
+	suite.Equal(key, domain.TranscodeKey(suite.media, &other))
+
+	// A replaced file gets a new key
+	suite.media.FileSize = 2048
+	suite.NotEqual(key, domain.TranscodeKey(suite.media, suite.policy))
+}
+
+func (suite *TranscodePolicyTestSuite) TestResolveAudioNormalization() {
+	library := &domain.Library{ID: suite.policy.LibraryID}
+	suite.Equal(domain.AudioNormalizationOff, suite.policy.Resolve(library).AudioNormalization)
+	key := domain.TranscodeKey(suite.media, suite.policy.Resolve(library))
+	suite.Equal("mp4/480p/1024-1700000000", key, "transcodes without normalization keep their key")
+
+	// Policies default to their library
+	library.AudioNormalization = domain.AudioNormalizationLoudnorm
+	resolved := suite.policy.Resolve(library)
+	suite.True(resolved.Normalizes())
+	suite.Empty(suite.policy.AudioNormalization, "the policy itself is left alone")
+	suite.Equal("mp4/480p+loudnorm/1024-1700000000", domain.TranscodeKey(suite.media, resolved))
+	suite.NotEqual(domain.TranscodeProfileHash(suite.policy), domain.TranscodeProfileHash(resolved))
+
+	suite.policy.AudioNormalization = domain.AudioNormalizationOff
+	suite.False(suite.policy.Resolve(library).Normalizes())
+
+	suite.policy.AudioNormalization = "louder"
+	suite.Error(suite.policy.Validate())
+}
+
+func TestTranscodePolicyTestSuite(t *testing.T) {
+	suite.Run(t, new(TranscodePolicyTestSuite))
+}
@@ -0,0 +1,93 @@
+package domain
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TranscodePriority is the priority of a requested transcode in the
+// transcoding queue. The values match the job priorities of the transcoding
+// service.
+type TranscodePriority string
+
+const (
+	TranscodePriorityLow    TranscodePriority = "low"
+	TranscodePriorityNormal TranscodePriority = "normal"
+	TranscodePriorityHigh   TranscodePriority = "high"
+	TranscodePriorityUrgent TranscodePriority = "urgent"
+)
+
+// TranscodeRequest is a transcode a policy requested, with the priority it
+// was last given.
+type TranscodeRequest struct {
+	MediaID   uuid.UUID
+	PolicyID  uuid.UUID
+	Key       string
+	Priority  TranscodePriority
+	CreatedAt time.Time
+}
+
+// TranscodePrioritySignals is what hints at media being watched soon.
+type TranscodePrioritySignals struct {
+	MediaID uuid.UUID
+	AddedAt time.Time
+	Genres  []string
+	// Watchlisted is the number of users with the media on their watchlist.
+	Watchlisted int64
+	// Watching is the number of users who watched episodes of the show
+	// within the window, whose next episodes are likely to follow.
+	Watching int64
+	// Plays is the number of users who watched the media within the window.
+	Plays int64
+}
+
+// TranscodePriorityPolicy decides the priority of transcodes from how
+// likely their media is to be watched.
+type TranscodePriorityPolicy struct {
+	// Window is how recently media must have been added or watched to
+	// count as new or popular.
+	Window time.Duration
+	// BackCatalogAge is how long ago media must have been added to be back
+	// catalog. Back catalog nobody watched within the window is demoted.
+	BackCatalogAge time.Duration
+	// PopularGenres is the number of most watched genres within the window
+	// whose new media is bumped.
+	PopularGenres int
+}
+
+// Prioritize returns the priority of transcodes of media: urgent for the
+// next episodes of shows in progress, high for watchlisted media and media
+// recently added in a popular genre, and low for back catalog nobody
+// watched lately.
+func (p TranscodePriorityPolicy) Prioritize(
+	signals *TranscodePrioritySignals,
+	popularGenres []string,
+	now time.Time,
+) TranscodePriority {
+	switch {
+	case signals.Watching > 0:
+		return TranscodePriorityUrgent
+	case signals.Watchlisted > 0:
+		return TranscodePriorityHigh
+	case now.Sub(signals.AddedAt) <= p.Window && anyGenre(signals.Genres, popularGenres):
+		return TranscodePriorityHigh
+	case p.BackCatalogAge > 0 && now.Sub(signals.AddedAt) >= p.BackCatalogAge && signals.Plays == 0:
+		return TranscodePriorityLow
+	default:
+		return TranscodePriorityNormal
+	}
+}
+
+// anyGenre reports whether genres include one of wanted, ignoring case.
+func anyGenre(genres, wanted []string) bool {
+	for _, genre := range genres {
+		for _, w := range wanted {
+			if strings.EqualFold(genre, w) {
+				return true
+			}
+		}
+	}
+	return false
+}
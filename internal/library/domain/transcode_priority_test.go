@@ -0,0 +1,36 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+)
+
+func TestTranscodePriorityPolicy_Prioritize(t *testing.T) {
+	policy := domain.TranscodePriorityPolicy{Window: 14 * 24 * time.Hour, BackCatalogAge: 365 * 24 * time.Hour, PopularGenres: 3}
+	now := time.Now()
+	popular := []string{"Drama", "Sci-Fi"}
+	recent := now.Add(-24 * time.Hour)
+	old := now.AddDate(-2, 0, 0)
+
+	tests := []struct {
+		name    string
+		signals domain.TranscodePrioritySignals
+		want    domain.TranscodePriority
+	}{
+		{"show in progress", domain.TranscodePrioritySignals{AddedAt: old, Watching: 1}, domain.TranscodePriorityUrgent},
+		{"watchlisted", domain.TranscodePrioritySignals{AddedAt: old, Watchlisted: 2}, domain.TranscodePriorityHigh},
+		{"new in a popular genre", domain.TranscodePrioritySignals{AddedAt: recent, Genres: []string{"sci-fi"}}, domain.TranscodePriorityHigh},
+		{"new in another genre", domain.TranscodePrioritySignals{AddedAt: recent, Genres: []string{"Western"}}, domain.TranscodePriorityNormal},
+		{"back catalog nobody watches", domain.TranscodePrioritySignals{AddedAt: old, Genres: []string{"Drama"}}, domain.TranscodePriorityLow},
+		{"back catalog still watched", domain.TranscodePrioritySignals{AddedAt: old, Plays: 1}, domain.TranscodePriorityNormal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, policy.Prioritize(&tt.signals, popular, now))
+		})
+	}
+}
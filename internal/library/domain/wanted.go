@@ -0,0 +1,200 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// QualityRank orders the feed qualities from worst to best. Unknown
+// qualities rank 0.
+func QualityRank(quality string) int {
+	switch quality {
+	case FeedQualitySD:
+		return 1
+	case FeedQuality720p:
+		return 2
+	case FeedQuality1080p:
+		return 3
+	case FeedQuality2160p:
+		return 4
+	default:
+		return 0
+	}
+}
+
+// ValidateQualityCutoff checks a library quality cutoff. An empty cutoff
+// is valid and means files of any quality are good enough.
+func ValidateQualityCutoff(cutoff string) error {
+	if cutoff != "" && QualityRank(cutoff) == 0 {
+		return fmt.Errorf("unsupported quality cutoff %q", cutoff)
+	}
+	return nil
+}
+
+// ResolutionQuality returns the quality of a probed resolution such as
+// "1920x1080" or "1080p", or an empty string if it is unknown. Widths
+// count as much as heights, so cropped widescreen video keeps its quality.
+func ResolutionQuality(resolution string) string {
+	w, h, ok := strings.Cut(strings.ToLower(resolution), "x")
+	if !ok {
+		return ParseFeedQuality(resolution)
+	}
+	width, err := strconv.Atoi(strings.TrimSpace(w))
+	if err != nil {
+		return ""
+	}
+	height, err := strconv.Atoi(strings.TrimSpace(h))
+	if err != nil {
+		return ""
+	}
+
+	switch {
+	case width >= 3200 || height >= 1800:
+		return FeedQuality2160p
+	case width >= 1800 || height >= 1000:
+		return FeedQuality1080p
+	case width >= 1200 || height >= 700:
+		return FeedQuality720p
+	case width > 0 && height > 0:
+		return FeedQualitySD
+	default:
+		return ""
+	}
+}
+
+// WantedReason is why a movie or episode is wanted.
+type WantedReason string
+
+const (
+	// WantedMissing is a monitored movie or aired episode without a file.
+	WantedMissing WantedReason = "missing"
+	// WantedCutoffUnmet is a monitored movie or episode whose file is below
+	// the quality cutoff of its library.
+	WantedCutoffUnmet WantedReason = "cutoff_unmet"
+)
+
+// WantedItem is a movie or episode to search releases for.
+type WantedItem struct {
+	Reason    WantedReason
+	MediaID   uuid.UUID
+	LibraryID uuid.UUID
+	// Title is the title of the movie or series.
+	Title  string
+	IMDBID string
+	TVDBID int
+	// EpisodeID, SeasonNumber, EpisodeNumber and EpisodeTitle are set for
+	// episodes only.
+	EpisodeID     *uuid.UUID
+	SeasonNumber  int
+	EpisodeNumber int
+	EpisodeTitle  string
+	// Date is the air date of episodes and the release date of movies.
+	Date *time.Time
+	// Quality is the quality of the current file, if any, and Cutoff the
+	// quality cutoff of the library.
+	Quality string
+	Cutoff  string
+}
+
+// BelowCutoff reports whether the file of the item is below the quality
+// cutoff of its library. Files of unknown quality are not, as there is no
+// telling.
+func (w *WantedItem) BelowCutoff() bool {
+	current := QualityRank(w.Quality)
+	return w.Cutoff != "" && current > 0 && current < QualityRank(w.Cutoff)
+}
+
+// SortWanted orders wanted items newest first, then by title and episode.
+func SortWanted(items []*WantedItem) {
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		switch {
+		case a.Date != nil && b.Date != nil && !a.Date.Equal(*b.Date):
+			return a.Date.After(*b.Date)
+		case (a.Date == nil) != (b.Date == nil):
+			return a.Date != nil
+		case a.Title != b.Title:
+			return a.Title < b.Title
+		case a.SeasonNumber != b.SeasonNumber:
+			return a.SeasonNumber < b.SeasonNumber
+		default:
+			return a.EpisodeNumber < b.EpisodeNumber
+		}
+	})
+}
+
+// ReleaseQuery is what indexers are searched for.
+type ReleaseQuery struct {
+	Query   string
+	IMDBID  string
+	TVDBID  string
+	Season  int // 0 for movies
+	Episode int
+}
+
+// Release is a download offered by an indexer, scored for a wanted item.
+type Release struct {
+	Indexer     string
+	ID          string
+	Title       string
+	DownloadURL string
+	Size        int64
+	Protocol    string // torrent or usenet
+	Seeders     int
+	Leechers    int
+	PublishedAt time.Time
+
+	Quality string
+	Score   int
+	// Rejections say why the release would not be grabbed automatically.
+	// Users can still grab rejected releases, unless they are blocklisted.
+	Rejections []string
+}
+
+// Indexer searches an index of releases.
+type Indexer interface {
+	Name() string
+	Search(ctx context.Context, query ReleaseQuery) ([]*Release, error)
+}
+
+// ScoreRelease sets the quality, score and rejections of a release for a
+// wanted item. Better qualities score higher, up to the cutoff of the
+// library; better seeded torrents break ties.
+func ScoreRelease(release *Release, item *WantedItem) {
+	release.Quality = ParseFeedQuality(release.Title)
+	release.Rejections = nil
+
+	release.Score = qualityScore(release.Quality, item.Cutoff)
+	if release.Protocol != "usenet" {
+		release.Score += min(release.Seeders, 99)
+	}
+
+	if release.DownloadURL == "" {
+		release.Rejections = append(release.Rejections, "no download link")
+	}
+	if release.Quality == "" {
+		release.Rejections = append(release.Rejections, "quality unknown")
+	} else if current := QualityRank(item.Quality); current > 0 && QualityRank(release.Quality) <= current {
+		release.Rejections = append(release.Rejections, "not an upgrade of "+item.Quality)
+	}
+	if release.Protocol != "usenet" && release.Seeders == 0 {
+		release.Rejections = append(release.Rejections, "no seeders")
+	}
+}
+
+// SortReleases orders releases that would be grabbed first, then by score.
+func SortReleases(releases []*Release) {
+	sort.SliceStable(releases, func(i, j int) bool {
+		a, b := releases[i], releases[j]
+		if (len(a.Rejections) == 0) != (len(b.Rejections) == 0) {
+			return len(a.Rejections) == 0
+		}
+		return a.Score > b.Score
+	})
+}
@@ -0,0 +1,67 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+)
+
+func TestResolutionQuality(t *testing.T) {
+	assert.Equal(t, domain.FeedQuality2160p, domain.ResolutionQuality("3840x2160"))
+	assert.Equal(t, domain.FeedQuality1080p, domain.ResolutionQuality("1920x1080"))
+	assert.Equal(t, domain.FeedQuality1080p, domain.ResolutionQuality("1920x800"), "cropped widescreen")
+	assert.Equal(t, domain.FeedQuality720p, domain.ResolutionQuality("1280x720"))
+	assert.Equal(t, domain.FeedQualitySD, domain.ResolutionQuality("720x576"))
+	assert.Equal(t, domain.FeedQuality1080p, domain.ResolutionQuality("1080p"))
+	assert.Empty(t, domain.ResolutionQuality(""))
+	assert.Empty(t, domain.ResolutionQuality("widexhigh"))
+}
+
+func TestWantedItemBelowCutoff(t *testing.T) {
+	assert.True(t, (&domain.WantedItem{Quality: domain.FeedQuality720p, Cutoff: domain.FeedQuality1080p}).BelowCutoff())
+	assert.False(t, (&domain.WantedItem{Quality: domain.FeedQuality1080p, Cutoff: domain.FeedQuality1080p}).BelowCutoff())
+	assert.False(t, (&domain.WantedItem{Quality: "", Cutoff: domain.FeedQuality1080p}).BelowCutoff(), "unknown quality")
+	assert.False(t, (&domain.WantedItem{Quality: domain.FeedQualitySD}).BelowCutoff(), "no cutoff")
+}
+
+func TestSortWanted(t *testing.T) {
+	older, newer := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	items := []*domain.WantedItem{
+		{Title: "Undated"},
+		{Title: "Old", Date: &older},
+		{Title: "Show", Date: &newer, EpisodeNumber: 2},
+		{Title: "Show", Date: &newer, EpisodeNumber: 1},
+	}
+
+	domain.SortWanted(items)
+
+	assert.Equal(t, 1, items[0].EpisodeNumber)
+	assert.Equal(t, 2, items[1].EpisodeNumber)
+	assert.Equal(t, "Old", items[2].Title)
+	assert.Equal(t, "Undated", items[3].Title)
+}
+
+func TestScoreRelease(t *testing.T) {
+	item := &domain.WantedItem{Quality: domain.FeedQuality720p, Cutoff: domain.FeedQuality1080p}
+	releases := []*domain.Release{
+		{Title: "Movie.2024.720p.WEB", DownloadURL: "magnet:?a", Seeders: 50},
+		{Title: "Movie.2024.2160p.WEB", DownloadURL: "magnet:?b", Seeders: 5},
+		{Title: "Movie.2024.1080p.WEB", DownloadURL: "magnet:?c", Seeders: 10},
+		{Title: "Movie.2024.1080p.BluRay", DownloadURL: "magnet:?d"},
+		{Title: "Movie.2024.1080p.NZB", DownloadURL: "https://indexer.example/nzb", Protocol: "usenet"},
+	}
+	for _, release := range releases {
+		domain.ScoreRelease(release, item)
+	}
+	domain.SortReleases(releases)
+
+	assert.Equal(t, "Movie.2024.1080p.WEB", releases[0].Title, "qualities above the cutoff are not preferred")
+	assert.Equal(t, "Movie.2024.2160p.WEB", releases[1].Title)
+	assert.Equal(t, "Movie.2024.1080p.NZB", releases[2].Title)
+	assert.Empty(t, releases[2].Rejections, "usenet releases have no seeders")
+	assert.Equal(t, []string{"no seeders"}, releases[3].Rejections)
+	assert.Equal(t, []string{"not an upgrade of 720p"}, releases[4].Rejections)
+}
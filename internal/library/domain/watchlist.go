@@ -0,0 +1,14 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WatchlistEntry is media a user wants to watch.
+type WatchlistEntry struct {
+	UserID  uuid.UUID
+	MediaID uuid.UUID
+	AddedAt time.Time
+}
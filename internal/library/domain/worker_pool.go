@@ -0,0 +1,34 @@
+package domain
+
+import "fmt"
+
+// Names of the worker pools that can be resized at runtime.
+const (
+	// WorkerPoolScans is the number of libraries scanned at once.
+	WorkerPoolScans = "scans"
+	// WorkerPoolScanWorkers is the number of files processed in parallel
+	// per scan.
+	WorkerPoolScanWorkers = "scan_workers"
+)
+
+// MaxWorkerPoolSize bounds the size of worker pools, so a typo cannot start
+// thousands of goroutines against the database.
+const MaxWorkerPoolSize = 64
+
+// WorkerPool is the state of a resizable worker pool.
+type WorkerPool struct {
+	Name string
+	// Size is the number of workers the pool runs.
+	Size int
+	// Active is the number of workers busy. It exceeds the size while
+	// excess workers of a shrunk pool finish their work.
+	Active int
+}
+
+// ValidateWorkerPoolSize checks a size a pool can be resized to.
+func ValidateWorkerPoolSize(size int) error {
+	if size < 1 || size > MaxWorkerPoolSize {
+		return fmt.Errorf("worker pool size must be between 1 and %d", MaxWorkerPoolSize)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
+)
+
+// ListTitleAnalytics lists the viewing stats of titles, least watched
+// first by default.
+func (h *GRPCHandler) ListTitleAnalytics(
+	ctx context.Context,
+	req *librarypb.ListTitleAnalyticsRequest,
+) (*librarypb.ListTitleAnalyticsResponse, error) {
+	if h.analytics == nil {
+		return nil, status.Error(codes.Unimplemented, "analytics are not enabled")
+	}
+	limit, offset, err := h.shareLinkPage(req.GetPagination())
+	if err != nil {
+		return nil, err
+	}
+	filter := domain.AnalyticsFilter{
+		Since: analyticsSince(req.GetSince()),
+		Sort:  convertAnalyticsSortFromProto(req.GetSort()),
+	}
+	if req.GetLibraryId() != "" {
+		libraryID, err := uuid.Parse(req.GetLibraryId())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid library ID")
+		}
+		filter.LibraryID = &libraryID
+	}
+
+	stats, total, err := h.analytics.ListTitleStats(ctx, filter, limit, offset)
+	if err != nil {
+		return nil, h.analyticsError(err)
+	}
+
+	resp := &librarypb.ListTitleAnalyticsResponse{
+		Stats:      make([]*librarypb.TitleStats, len(stats)),
+		Pagination: h.shareLinkNextPage(offset, limit, len(stats), total),
+	}
+	for i, s := range stats {
+		resp.Stats[i] = convertTitleStatsToProto(s)
+	}
+	return resp, nil
+}
+
+// GetTitleAnalytics returns the stats of a title with its retention curve
+// and drop-off points.
+func (h *GRPCHandler) GetTitleAnalytics(
+	ctx context.Context,
+	req *librarypb.GetTitleAnalyticsRequest,
+) (*librarypb.GetTitleAnalyticsResponse, error) {
+	if h.analytics == nil {
+		return nil, status.Error(codes.Unimplemented, "analytics are not enabled")
+	}
+	mediaID, err := uuid.Parse(req.GetMediaId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid media ID")
+	}
+	var episodeID *uuid.UUID
+	if req.GetEpisodeId() != "" {
+		id, err := uuid.Parse(req.GetEpisodeId())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid episode ID")
+		}
+		episodeID = &id
+	}
+
+	analytics, err := h.analytics.GetTitleAnalytics(ctx, mediaID, episodeID, analyticsSince(req.GetSince()))
+	if err != nil {
+		return nil, h.analyticsError(err)
+	}
+
+	resp := &librarypb.GetTitleAnalyticsResponse{
+		Stats:     convertTitleStatsToProto(&analytics.TitleStats),
+		Retention: analytics.Retention,
+		DropOffs:  make([]*librarypb.DropOff, len(analytics.DropOffs)),
+	}
+	for i, d := range analytics.DropOffs {
+		resp.DropOffs[i] = &librarypb.DropOff{Position: d.Position, Share: d.Share}
+	}
+	return resp, nil
+}
+
+func (h *GRPCHandler) analyticsError(err error) error {
+	switch {
+	case errors.IsNotFound(err):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.IsBadRequest(err):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	h.logger.Error("Analytics request failed", interfaces.Error(err))
+	return status.Error(codes.Internal, "failed to compute analytics")
+}
+
+// analyticsSince returns the start of an analytics window; unset covers
+// every viewing.
+func analyticsSince(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
+
+func convertAnalyticsSortFromProto(sort librarypb.TitleAnalyticsSort) domain.AnalyticsSort {
+	switch sort {
+	case librarypb.TitleAnalyticsSort_TITLE_ANALYTICS_SORT_MOST_WATCHED:
+		return domain.AnalyticsMostWatched
+	case librarypb.TitleAnalyticsSort_TITLE_ANALYTICS_SORT_LOWEST_COMPLETION:
+		return domain.AnalyticsLowestCompletion
+	}
+	return domain.AnalyticsLeastWatched
+}
+
+func convertTitleStatsToProto(s *domain.TitleStats) *librarypb.TitleStats {
+	proto := &librarypb.TitleStats{
+		MediaId:        s.MediaID.String(),
+		Title:          s.Title,
+		Viewings:       s.Viewings,
+		Viewers:        s.Viewers,
+		Completions:    s.Completions,
+		CompletionRate: s.CompletionRate(),
+		Rewatches:      s.Rewatches,
+		AverageWatched: s.AverageWatched,
+	}
+	if s.LastViewedAt != nil {
+		proto.LastViewedAt = timestamppb.New(*s.LastViewedAt)
+	}
+	return proto
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
+)
+
+// GetArtist gets an artist with their music tracks and music videos.
+func (h *GRPCHandler) GetArtist(
+	ctx context.Context,
+	req *librarypb.GetArtistRequest,
+) (*librarypb.GetArtistResponse, error) {
+	artist, err := h.libraryService.GetArtist(ctx, req.GetName())
+	if err != nil {
+		switch {
+		case errors.IsBadRequest(err):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.IsNotFound(err):
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		h.logger.Error("Failed to get artist", interfaces.Error(err))
+		return nil, status.Error(codes.Internal, "failed to get artist")
+	}
+
+	resp := &librarypb.GetArtistResponse{
+		Name:        artist.Name,
+		Tracks:      make([]*librarypb.Media, len(artist.Tracks)),
+		MusicVideos: make([]*librarypb.Media, len(artist.MusicVideos)),
+	}
+	for i, track := range artist.Tracks {
+		resp.Tracks[i] = convertMediaToProto(track, false, false)
+	}
+	for i, video := range artist.MusicVideos {
+		resp.MusicVideos[i] = convertMediaToProto(video, false, false)
+	}
+	return resp, nil
+}
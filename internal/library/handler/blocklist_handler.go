@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/internal/library/constants"
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	commonpb "github.com/narwhalmedia/narwhal/pkg/common/v1"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
+	"github.com/narwhalmedia/narwhal/pkg/pagination"
+)
+
+// ListBlocklist lists the releases that are never grabbed again.
+func (h *GRPCHandler) ListBlocklist(
+	ctx context.Context,
+	req *librarypb.ListBlocklistRequest,
+) (*librarypb.ListBlocklistResponse, error) {
+	if h.blocklist == nil {
+		return nil, status.Error(codes.Unimplemented, "blocklist is not enabled")
+	}
+
+	limit := int(constants.DefaultPageSize)
+	offset := 0
+	if req.GetPagination() != nil {
+		if size := int(req.GetPagination().GetPageSize()); size > 0 {
+			limit = min(size, constants.MaxPageSize)
+		}
+		if req.GetPagination().GetPageToken() != "" && h.paginationEncoder != nil {
+			calculatedOffset, err := pagination.CalculateOffset(
+				h.paginationEncoder,
+				req.GetPagination().GetPageToken(),
+				0,
+			)
+			if err != nil {
+				return nil, status.Error(codes.InvalidArgument, "invalid page token")
+			}
+			offset = calculatedOffset
+		}
+	}
+
+	entries, total, err := h.blocklist.ListBlocklist(ctx, limit, offset)
+	if err != nil {
+		return nil, h.blocklistError(err)
+	}
+
+	resp := &librarypb.ListBlocklistResponse{
+		Entries:    make([]*librarypb.BlocklistEntry, len(entries)),
+		Pagination: &commonpb.PaginationResponse{TotalItems: int32(total)},
+	}
+	for i, entry := range entries {
+		resp.Entries[i] = convertBlocklistEntryToProto(entry)
+	}
+
+	if h.paginationEncoder != nil && int64(offset+len(entries)) < total {
+		token, err := pagination.GenerateNextPageToken(h.paginationEncoder, offset, limit, int(total))
+		if err != nil {
+			h.logger.Error("Failed to generate next page token", interfaces.Error(err))
+		} else {
+			resp.Pagination.NextPageToken = token
+		}
+	}
+
+	return resp, nil
+}
+
+// AddToBlocklist blocklists a release.
+func (h *GRPCHandler) AddToBlocklist(
+	ctx context.Context,
+	req *librarypb.AddToBlocklistRequest,
+) (*librarypb.AddToBlocklistResponse, error) {
+	if h.blocklist == nil {
+		return nil, status.Error(codes.Unimplemented, "blocklist is not enabled")
+	}
+
+	entry := &domain.BlocklistEntry{
+		ReleaseIdentity: domain.ReleaseIdentity{
+			InfoHash: req.GetInfoHash(),
+			GUID:     req.GetGuid(),
+			Title:    req.GetTitle(),
+			Indexer:  req.GetIndexer(),
+		},
+		Reason: req.GetReason(),
+	}
+	if req.GetMediaId() != "" {
+		mediaID, err := uuid.Parse(req.GetMediaId())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid media ID")
+		}
+		entry.MediaID = &mediaID
+	}
+
+	if err := h.blocklist.AddToBlocklist(ctx, entry); err != nil {
+		return nil, h.blocklistError(err)
+	}
+	return &librarypb.AddToBlocklistResponse{Entry: convertBlocklistEntryToProto(entry)}, nil
+}
+
+// RemoveFromBlocklist removes a release from the blocklist.
+func (h *GRPCHandler) RemoveFromBlocklist(
+	ctx context.Context,
+	req *librarypb.RemoveFromBlocklistRequest,
+) (*librarypb.RemoveFromBlocklistResponse, error) {
+	if h.blocklist == nil {
+		return nil, status.Error(codes.Unimplemented, "blocklist is not enabled")
+	}
+
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid blocklist entry ID")
+	}
+
+	if err := h.blocklist.RemoveFromBlocklist(ctx, id); err != nil {
+		return nil, h.blocklistError(err)
+	}
+	return &librarypb.RemoveFromBlocklistResponse{}, nil
+}
+
+func (h *GRPCHandler) blocklistError(err error) error {
+	switch {
+	case errors.IsNotFound(err):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.IsBadRequest(err):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	h.logger.Error("Blocklist request failed", interfaces.Error(err))
+	return status.Error(codes.Internal, "failed to process blocklist request")
+}
+
+func convertBlocklistEntryToProto(entry *domain.BlocklistEntry) *librarypb.BlocklistEntry {
+	proto := &librarypb.BlocklistEntry{
+		Id:        entry.ID.String(),
+		InfoHash:  entry.InfoHash,
+		Guid:      entry.GUID,
+		Title:     entry.Title,
+		Indexer:   entry.Indexer,
+		Source:    string(entry.Source),
+		Reason:    entry.Reason,
+		CreatedAt: timestamppb.New(entry.CreatedAt),
+	}
+	if entry.MediaID != nil {
+		proto.MediaId = entry.MediaID.String()
+	}
+	return proto
+}
@@ -0,0 +1,314 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/internal/library/service"
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
+	"github.com/narwhalmedia/narwhal/pkg/tenant"
+)
+
+// CalendarFeedPath is the path the iCalendar export is served at.
+const CalendarFeedPath = "/calendar.ics"
+
+// Days of the iCalendar export around today, unless the request says
+// otherwise.
+const (
+	defaultCalendarFeedPastDays   = 14
+	defaultCalendarFeedFutureDays = 90
+)
+
+// GetCalendar lists the episode air dates and movie release dates of
+// monitored media in a date range.
+func (h *GRPCHandler) GetCalendar(
+	ctx context.Context,
+	req *librarypb.GetCalendarRequest,
+) (*librarypb.GetCalendarResponse, error) {
+	if _, err := h.checkAuth(ctx); err != nil {
+		return nil, err
+	}
+
+	var libraryID *uuid.UUID
+	if req.GetLibraryId() != "" {
+		id, err := uuid.Parse(req.GetLibraryId())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid library ID")
+		}
+		libraryID = &id
+	}
+
+	var start, end time.Time
+	if req.GetStart() != nil {
+		start = req.GetStart().AsTime()
+	}
+	if req.GetEnd() != nil {
+		end = req.GetEnd().AsTime()
+	}
+
+	entries, err := h.libraryService.GetCalendar(ctx, start, end, libraryID)
+	if err != nil {
+		return nil, h.calendarError(err)
+	}
+
+	resp := &librarypb.GetCalendarResponse{
+		Entries: make([]*librarypb.CalendarEntry, len(entries)),
+	}
+	for i, entry := range entries {
+		resp.Entries[i] = convertCalendarEntryToProto(entry)
+	}
+	if h.calendarFeed != nil {
+		userID, err := calendarUser(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if resp.FeedToken, err = h.calendarFeed.Token(ctx, userID); err != nil {
+			return nil, h.calendarError(err)
+		}
+	}
+	return resp, nil
+}
+
+// RotateCalendarFeedToken issues the caller a new iCalendar feed token,
+// revoking the previous one.
+func (h *GRPCHandler) RotateCalendarFeedToken(
+	ctx context.Context,
+	_ *librarypb.RotateCalendarFeedTokenRequest,
+) (*librarypb.RotateCalendarFeedTokenResponse, error) {
+	if h.calendarFeed == nil {
+		return nil, status.Error(codes.Unimplemented, "the iCalendar export is disabled")
+	}
+	userID, err := calendarUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := h.calendarFeed.Rotate(ctx, userID)
+	if err != nil {
+		return nil, h.calendarError(err)
+	}
+	return &librarypb.RotateCalendarFeedTokenResponse{FeedToken: token}, nil
+}
+
+// calendarUser returns the caller, whose feed token is used.
+func calendarUser(ctx context.Context) (uuid.UUID, error) {
+	id, _ := auth.GetUserIDFromContext(ctx)
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, status.Error(codes.Unauthenticated, "user not authenticated")
+	}
+	return userID, nil
+}
+
+func (h *GRPCHandler) calendarError(err error) error {
+	switch {
+	case errors.IsNotFound(err):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.IsBadRequest(err):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	h.logger.Error("Calendar request failed", interfaces.Error(err))
+	return status.Error(codes.Internal, "failed to get calendar")
+}
+
+func convertCalendarEntryToProto(entry *domain.CalendarEntry) *librarypb.CalendarEntry {
+	proto := &librarypb.CalendarEntry{
+		Type:          string(entry.Type),
+		MediaId:       entry.MediaID.String(),
+		LibraryId:     entry.LibraryID.String(),
+		Title:         entry.Title,
+		SeasonNumber:  int32(entry.SeasonNumber),
+		EpisodeNumber: int32(entry.EpisodeNumber),
+		EpisodeTitle:  entry.EpisodeTitle,
+		Date:          timestamppb.New(entry.Date),
+		Available:     entry.Available,
+	}
+	if entry.EpisodeID != nil {
+		proto.EpisodeId = entry.EpisodeID.String()
+	}
+	return proto
+}
+
+// CalendarFeed serves the calendar as an iCalendar document calendar apps
+// subscribe to. Calendar apps cannot send access tokens, so requests carry
+// the feed token GetCalendar hands out in the token query parameter. Feed
+// tokens are signed with secret and the feed key of their user; changing
+// secret revokes every token, and rotating the key those of the user.
+// Requests read the calendar of the tenant of the user, as long as the
+// user could log in.
+type CalendarFeed struct {
+	libraryService service.LibraryServiceInterface
+	accounts       auth.AccountStore
+	secret         []byte
+	logger         interfaces.Logger
+}
+
+// NewCalendarFeed creates the iCalendar export. The users feed tokens are
+// issued to are looked up in accounts.
+func NewCalendarFeed(
+	libraryService service.LibraryServiceInterface,
+	accounts auth.AccountStore,
+	secret []byte,
+	logger interfaces.Logger,
+) *CalendarFeed {
+	return &CalendarFeed{
+		libraryService: libraryService,
+		accounts:       accounts,
+		secret:         secret,
+		logger:         logger,
+	}
+}
+
+// Token returns the feed token of a user, issuing the user a feed key on
+// first use.
+func (f *CalendarFeed) Token(ctx context.Context, userID uuid.UUID) (string, error) {
+	key, err := f.libraryService.GetCalendarFeedKey(ctx, userID)
+	if errors.IsNotFound(err) {
+		return f.Rotate(ctx, userID)
+	}
+	if err != nil {
+		return "", err
+	}
+	return domain.CalendarFeedToken(f.secret, userID.String(), key), nil
+}
+
+// Rotate issues a user a new feed token, revoking the previous one.
+func (f *CalendarFeed) Rotate(ctx context.Context, userID uuid.UUID) (string, error) {
+	key, err := f.libraryService.RotateCalendarFeedKey(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return domain.CalendarFeedToken(f.secret, userID.String(), key), nil
+}
+
+// authenticate returns the context a feed token reads the calendar in,
+// scoped to the tenant of its user. It fails with unauthorized if the
+// token is invalid or revoked, and with forbidden if the user can no
+// longer log in.
+func (f *CalendarFeed) authenticate(ctx context.Context, token string) (context.Context, error) {
+	id, ok := domain.CalendarFeedTokenUser(token)
+	if !ok {
+		return nil, errors.Unauthorized("invalid feed token")
+	}
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errors.Unauthorized("invalid feed token")
+	}
+	user, err := f.accounts.GetUser(ctx, userID)
+	if errors.IsNotFound(err) {
+		return nil, errors.Unauthorized("invalid feed token")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := auth.CheckCanLogin(ctx, f.accounts, user); err != nil {
+		return nil, err
+	}
+
+	ctx = tenant.WithTenantID(ctx, user.TenantID)
+	key, err := f.libraryService.GetCalendarFeedKey(ctx, userID)
+	if errors.IsNotFound(err) {
+		return nil, errors.Unauthorized("invalid feed token")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !domain.VerifyCalendarFeedToken(f.secret, token, key) {
+		return nil, errors.Unauthorized("invalid feed token")
+	}
+	return ctx, nil
+}
+
+// ServeHTTP writes the calendar from past_days before today to future_days
+// after it, of the library in library_id or of every library.
+func (f *CalendarFeed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	ctx, err := f.authenticate(r.Context(), query.Get("token"))
+	if err != nil {
+		switch {
+		case errors.IsUnauthorized(err):
+			http.Error(w, "invalid feed token", http.StatusUnauthorized)
+		case errors.IsForbidden(err):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		default:
+			f.logger.Error("Failed to verify feed token", interfaces.Error(err))
+			http.Error(w, "failed to export calendar", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var libraryID *uuid.UUID
+	if v := query.Get("library_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			http.Error(w, "invalid library ID", http.StatusBadRequest)
+			return
+		}
+		libraryID = &id
+	}
+	pastDays, err := queryDays(query.Get("past_days"), defaultCalendarFeedPastDays)
+	if err != nil {
+		http.Error(w, "invalid past_days", http.StatusBadRequest)
+		return
+	}
+	futureDays, err := queryDays(query.Get("future_days"), defaultCalendarFeedFutureDays)
+	if err != nil {
+		http.Error(w, "invalid future_days", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	today := now.UTC().Truncate(24 * time.Hour)
+	entries, err := f.libraryService.GetCalendar(ctx,
+		today.AddDate(0, 0, -pastDays), today.AddDate(0, 0, futureDays+1), libraryID)
+	if err != nil {
+		switch {
+		case errors.IsBadRequest(err):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.IsNotFound(err):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			f.logger.Error("Failed to export calendar", interfaces.Error(err))
+			http.Error(w, "failed to export calendar", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := domain.WriteICal(&buf, "Narwhal", entries, now); err != nil {
+		f.logger.Error("Failed to write calendar", interfaces.Error(err))
+		http.Error(w, "failed to export calendar", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="narwhal.ics"`)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// queryDays parses a non-negative day count, or returns def if s is empty.
+func queryDays(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	days, err := strconv.Atoi(s)
+	if err != nil || days < 0 {
+		return 0, errors.BadRequest("invalid day count")
+	}
+	return days, nil
+}
@@ -0,0 +1,332 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	commonpb "github.com/narwhalmedia/narwhal/pkg/common/v1"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// SearchRequestableContent searches the metadata providers for movies or
+// series to request.
+func (h *GRPCHandler) SearchRequestableContent(
+	ctx context.Context,
+	req *librarypb.SearchRequestableContentRequest,
+) (*librarypb.SearchRequestableContentResponse, error) {
+	if _, err := h.contentRequestUser(ctx); err != nil {
+		return nil, err
+	}
+
+	titles, err := h.requests.Search(ctx, requestMediaType(req.GetType()), req.GetQuery(), int(req.GetYear()))
+	if err != nil {
+		return nil, h.contentRequestError(err)
+	}
+
+	resp := &librarypb.SearchRequestableContentResponse{
+		Titles: make([]*librarypb.RequestableTitle, len(titles)),
+	}
+	for i, title := range titles {
+		resp.Titles[i] = &librarypb.RequestableTitle{
+			Provider:   title.ProviderName,
+			ProviderId: title.ProviderID,
+			Title:      title.Title,
+			Year:       int32(title.Year),
+			Overview:   title.Overview,
+			PosterUrl:  title.PosterURL,
+		}
+		if title.Request != nil {
+			resp.Titles[i].Request = convertContentRequestToProto(title.Request)
+		}
+	}
+	return resp, nil
+}
+
+// CreateContentRequest requests a movie or series for the caller.
+func (h *GRPCHandler) CreateContentRequest(
+	ctx context.Context,
+	req *librarypb.CreateContentRequestRequest,
+) (*librarypb.CreateContentRequestResponse, error) {
+	userID, err := h.contentRequestUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	seasons := make([]int, len(req.GetSeasons()))
+	for i, season := range req.GetSeasons() {
+		seasons[i] = int(season)
+	}
+	roles, _ := auth.GetRolesFromContext(ctx)
+
+	request, err := h.requests.Submit(ctx, roles, &domain.ContentRequest{
+		UserID:     userID,
+		MediaType:  requestMediaType(req.GetType()),
+		Provider:   req.GetProvider(),
+		ProviderID: req.GetProviderId(),
+		Seasons:    seasons,
+		Quality:    req.GetQuality(),
+	})
+	if err != nil {
+		return nil, h.contentRequestError(err)
+	}
+	return &librarypb.CreateContentRequestResponse{Request: convertContentRequestToProto(request)}, nil
+}
+
+// ListContentRequests lists the caller's content requests, or every
+// user's for admins, newest first.
+func (h *GRPCHandler) ListContentRequests(
+	ctx context.Context,
+	req *librarypb.ListContentRequestsRequest,
+) (*librarypb.ListContentRequestsResponse, error) {
+	userID, err := h.contentRequestUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	limit, offset, err := h.shareLinkPage(req.GetPagination())
+	if err != nil {
+		return nil, err
+	}
+
+	requests, total, err := h.requests.List(ctx, userID, auth.IsAdmin(ctx),
+		convertContentRequestStatusFromProto(req.GetStatus()), limit, offset)
+	if err != nil {
+		return nil, h.contentRequestError(err)
+	}
+
+	resp := &librarypb.ListContentRequestsResponse{
+		Requests:   make([]*librarypb.ContentRequest, len(requests)),
+		Pagination: h.shareLinkNextPage(offset, limit, len(requests), total),
+	}
+	for i, request := range requests {
+		resp.Requests[i] = convertContentRequestToProto(request)
+	}
+	return resp, nil
+}
+
+// ApproveContentRequest approves a pending content request.
+func (h *GRPCHandler) ApproveContentRequest(
+	ctx context.Context,
+	req *librarypb.ApproveContentRequestRequest,
+) (*librarypb.ApproveContentRequestResponse, error) {
+	adminID, err := h.contentRequestUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid content request ID")
+	}
+	var libraryID *uuid.UUID
+	if req.GetLibraryId() != "" {
+		lid, err := uuid.Parse(req.GetLibraryId())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid library ID")
+		}
+		libraryID = &lid
+	}
+
+	request, err := h.requests.Approve(ctx, adminID, id, libraryID)
+	if err != nil {
+		return nil, h.contentRequestError(err)
+	}
+	return &librarypb.ApproveContentRequestResponse{Request: convertContentRequestToProto(request)}, nil
+}
+
+// DenyContentRequest denies a pending content request.
+func (h *GRPCHandler) DenyContentRequest(
+	ctx context.Context,
+	req *librarypb.DenyContentRequestRequest,
+) (*librarypb.DenyContentRequestResponse, error) {
+	adminID, err := h.contentRequestUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid content request ID")
+	}
+
+	request, err := h.requests.Deny(ctx, adminID, id, req.GetReason())
+	if err != nil {
+		return nil, h.contentRequestError(err)
+	}
+	return &librarypb.DenyContentRequestResponse{Request: convertContentRequestToProto(request)}, nil
+}
+
+// GetRequestQuota returns the caller's request quota and how much of it
+// is left.
+func (h *GRPCHandler) GetRequestQuota(
+	ctx context.Context,
+	_ *librarypb.GetRequestQuotaRequest,
+) (*librarypb.GetRequestQuotaResponse, error) {
+	userID, err := h.contentRequestUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	roles, _ := auth.GetRolesFromContext(ctx)
+
+	state, err := h.requests.QuotaState(ctx, userID, roles)
+	if err != nil {
+		return nil, h.contentRequestError(err)
+	}
+	quota := &librarypb.RequestQuota{
+		MovieLimit:       int32(state.Quota.Movies),
+		SeasonLimit:      int32(state.Quota.Seasons),
+		MoviesUsed:       int32(state.Movies),
+		SeasonsUsed:      int32(state.Seasons),
+		MoviesRemaining:  int32(state.MoviesRemaining()),
+		SeasonsRemaining: int32(state.SeasonsRemaining()),
+		Period:           durationpb.New(state.Period),
+		Overridden:       state.Overridden,
+	}
+	if state.ResetsAt != nil {
+		quota.ResetsAt = timestamppb.New(*state.ResetsAt)
+	}
+	return &librarypb.GetRequestQuotaResponse{Quota: quota}, nil
+}
+
+// SetRequestQuotaOverride sets the request quota of a user in place of the
+// quota of their roles, or clears it.
+func (h *GRPCHandler) SetRequestQuotaOverride(
+	ctx context.Context,
+	req *librarypb.SetRequestQuotaOverrideRequest,
+) (*librarypb.SetRequestQuotaOverrideResponse, error) {
+	adminID, err := h.contentRequestUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	userID, err := uuid.Parse(req.GetUserId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user ID")
+	}
+
+	if req.GetClear() {
+		err = h.requests.ClearQuotaOverride(ctx, adminID, userID)
+	} else {
+		_, err = h.requests.SetQuotaOverride(ctx, adminID, userID, domain.RequestQuota{
+			Movies:  int(req.GetMovieLimit()),
+			Seasons: int(req.GetSeasonLimit()),
+		})
+	}
+	if err != nil {
+		return nil, h.contentRequestError(err)
+	}
+	return &librarypb.SetRequestQuotaOverrideResponse{}, nil
+}
+
+// contentRequestUser returns the caller of a content request RPC.
+func (h *GRPCHandler) contentRequestUser(ctx context.Context) (uuid.UUID, error) {
+	if h.requests == nil {
+		return uuid.Nil, status.Error(codes.Unimplemented, "content requests are not enabled")
+	}
+	id, _ := auth.GetUserIDFromContext(ctx)
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, status.Error(codes.Unauthenticated, "user not authenticated")
+	}
+	return userID, nil
+}
+
+func (h *GRPCHandler) contentRequestError(err error) error {
+	switch {
+	case errors.IsNotFound(err):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.IsBadRequest(err):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.IsConflict(err):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.IsForbidden(err):
+		// Requests are forbidden only beyond the quota
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	h.logger.Error("Content request failed", interfaces.Error(err))
+	return status.Error(codes.Internal, "failed to process content request")
+}
+
+// requestMediaType returns the media type of a request, or an empty one
+// for media that cannot be requested.
+func requestMediaType(t commonpb.MediaType) models.MediaType {
+	switch t {
+	case commonpb.MediaType_MEDIA_TYPE_MOVIE:
+		return models.MediaTypeMovie
+	case commonpb.MediaType_MEDIA_TYPE_SERIES:
+		return models.MediaTypeSeries
+	}
+	return ""
+}
+
+func convertContentRequestStatusFromProto(st librarypb.ContentRequestStatus) domain.ContentRequestStatus {
+	switch st {
+	case librarypb.ContentRequestStatus_CONTENT_REQUEST_STATUS_PENDING:
+		return domain.ContentRequestPending
+	case librarypb.ContentRequestStatus_CONTENT_REQUEST_STATUS_APPROVED:
+		return domain.ContentRequestApproved
+	case librarypb.ContentRequestStatus_CONTENT_REQUEST_STATUS_DENIED:
+		return domain.ContentRequestDenied
+	case librarypb.ContentRequestStatus_CONTENT_REQUEST_STATUS_AVAILABLE:
+		return domain.ContentRequestAvailable
+	}
+	return ""
+}
+
+func convertContentRequestStatusToProto(st domain.ContentRequestStatus) librarypb.ContentRequestStatus {
+	switch st {
+	case domain.ContentRequestPending:
+		return librarypb.ContentRequestStatus_CONTENT_REQUEST_STATUS_PENDING
+	case domain.ContentRequestApproved:
+		return librarypb.ContentRequestStatus_CONTENT_REQUEST_STATUS_APPROVED
+	case domain.ContentRequestDenied:
+		return librarypb.ContentRequestStatus_CONTENT_REQUEST_STATUS_DENIED
+	case domain.ContentRequestAvailable:
+		return librarypb.ContentRequestStatus_CONTENT_REQUEST_STATUS_AVAILABLE
+	}
+	return librarypb.ContentRequestStatus_CONTENT_REQUEST_STATUS_UNSPECIFIED
+}
+
+func convertContentRequestToProto(request *domain.ContentRequest) *librarypb.ContentRequest {
+	proto := &librarypb.ContentRequest{
+		Id:           request.ID.String(),
+		UserId:       request.UserID.String(),
+		Type:         convertMediaTypeToProtoFromMediaType(request.MediaType),
+		Provider:     request.Provider,
+		ProviderId:   request.ProviderID,
+		Title:        request.Title,
+		Year:         int32(request.Year),
+		Overview:     request.Overview,
+		PosterUrl:    request.PosterURL,
+		Status:       convertContentRequestStatusToProto(request.Status),
+		AutoApproved: request.AutoApproved,
+		Reason:       request.Reason,
+		CreatedAt:    timestamppb.New(request.CreatedAt),
+		Quality:      request.Quality,
+	}
+	for _, season := range request.Seasons {
+		proto.Seasons = append(proto.Seasons, int32(season))
+	}
+	if request.LibraryID != nil {
+		proto.LibraryId = request.LibraryID.String()
+	}
+	if request.MediaID != nil {
+		proto.MediaId = request.MediaID.String()
+	}
+	if request.DecidedBy != nil {
+		proto.DecidedBy = request.DecidedBy.String()
+	}
+	if request.DecidedAt != nil {
+		proto.DecidedAt = timestamppb.New(*request.DecidedAt)
+	}
+	if request.AvailableAt != nil {
+		proto.AvailableAt = timestamppb.New(*request.AvailableAt)
+	}
+	return proto
+}
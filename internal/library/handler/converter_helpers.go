@@ -3,13 +3,16 @@ package handler
 import (
 	"time"
 
+	"github.com/google/uuid"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/narwhalmedia/narwhal/internal/library/constants"
 	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/internal/library/service"
 	commonpb "github.com/narwhalmedia/narwhal/pkg/common/v1"
 	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
 	"github.com/narwhalmedia/narwhal/pkg/models"
+	"github.com/narwhalmedia/narwhal/pkg/saga"
 )
 
 // convertMediaType converts proto media type to string.
@@ -21,6 +24,8 @@ func convertMediaType(t commonpb.MediaType) string {
 		return "tv_show"
 	case commonpb.MediaType_MEDIA_TYPE_MUSIC:
 		return "music"
+	case commonpb.MediaType_MEDIA_TYPE_MUSIC_VIDEO:
+		return "music_video"
 	default:
 		return "movie"
 	}
@@ -35,6 +40,8 @@ func convertMediaTypeToProto(t string) commonpb.MediaType {
 		return commonpb.MediaType_MEDIA_TYPE_SERIES
 	case "music":
 		return commonpb.MediaType_MEDIA_TYPE_MUSIC
+	case "music_video":
+		return commonpb.MediaType_MEDIA_TYPE_MUSIC_VIDEO
 	default:
 		return commonpb.MediaType_MEDIA_TYPE_UNSPECIFIED
 	}
@@ -51,6 +58,18 @@ func convertLibraryToProto(lib *domain.Library) *librarypb.Library {
 		ScanIntervalMinutes: int32(lib.ScanInterval / constants.SecondsToMinutes), // Convert from seconds to minutes
 		Created:             timestamppb.New(lib.CreatedAt),
 		Updated:             timestamppb.New(lib.UpdatedAt),
+		ExcludePatterns:     lib.ExcludePatterns,
+		ExtrasMode:          convertExtrasModeToProto(lib.ExtrasMode),
+		QualityCutoff:       lib.QualityCutoff,
+		MetadataLanguage:    lib.MetadataPreferences.Language,
+		MetadataRegion:      lib.MetadataPreferences.Region,
+		TitleStyle:          convertTitleStyleToProto(lib.MetadataPreferences.TitleStyle),
+		Anime:               lib.Anime,
+		MovieFormat:         lib.Naming.MovieFormat,
+		EpisodeFormat:       lib.Naming.EpisodeFormat,
+		FolderProfile:       convertFolderProfileToProto(lib.FolderProfile),
+		AudioNormalization:  convertAudioNormalizationToProto(lib.AudioNormalization),
+		IgnoreExtrasFolders: lib.IgnoreExtrasFolders,
 	}
 
 	if lib.LastScanAt != nil {
@@ -65,6 +84,7 @@ func convertMediaToProto(media *models.Media, includeMetadata, includeEpisodes b
 	protoMedia := &librarypb.Media{
 		Id:              media.ID.String(),
 		Title:           media.Title,
+		Artist:          media.Artist,
 		Type:            convertMediaTypeToProtoFromMediaType(media.Type),
 		Path:            media.Path,
 		SizeBytes:       media.Size,
@@ -75,6 +95,29 @@ func convertMediaToProto(media *models.Media, includeMetadata, includeEpisodes b
 		Added:           timestamppb.New(media.Added),
 		Modified:        timestamppb.New(media.Modified),
 		LastScanned:     timestamppb.New(media.LastScanned),
+		ExtraType:       media.ExtraType,
+		ThemeUrl:        media.ThemeURL,
+		Monitored:       media.Monitored,
+	}
+
+	if media.DigitalReleaseDate != nil {
+		protoMedia.DigitalReleaseDate = timestamppb.New(*media.DigitalReleaseDate)
+	}
+	if media.PhysicalReleaseDate != nil {
+		protoMedia.PhysicalReleaseDate = timestamppb.New(*media.PhysicalReleaseDate)
+	}
+	if media.ParentID != nil {
+		protoMedia.ParentId = media.ParentID.String()
+	}
+	if media.EpisodeID != nil {
+		protoMedia.EpisodeId = media.EpisodeID.String()
+	}
+
+	if len(media.Extras) > 0 {
+		protoMedia.Extras = make([]*librarypb.Media, len(media.Extras))
+		for i, extra := range media.Extras {
+			protoMedia.Extras[i] = convertMediaToProto(extra, false, false)
+		}
 	}
 
 	if includeMetadata && media.Metadata != nil {
@@ -100,6 +143,8 @@ func convertMediaTypeToProtoFromMediaType(t models.MediaType) commonpb.MediaType
 		return commonpb.MediaType_MEDIA_TYPE_SERIES
 	case models.MediaTypeMusic:
 		return commonpb.MediaType_MEDIA_TYPE_MUSIC
+	case models.MediaTypeMusicVideo:
+		return commonpb.MediaType_MEDIA_TYPE_MUSIC_VIDEO
 	default:
 		return commonpb.MediaType_MEDIA_TYPE_UNSPECIFIED
 	}
@@ -108,25 +153,30 @@ func convertMediaTypeToProtoFromMediaType(t models.MediaType) commonpb.MediaType
 // convertMetadataToProto converts domain metadata to proto metadata.
 func convertMetadataToProto(metadata *models.Metadata) *librarypb.Metadata {
 	proto := &librarypb.Metadata{
-		Id:          metadata.ID.String(),
-		MediaId:     metadata.MediaID.String(),
-		ImdbId:      metadata.IMDBID,
-		TmdbId:      metadata.TMDBID,
-		TvdbId:      metadata.TVDBID,
-		Description: metadata.Description,
-		Rating:      metadata.Rating,
-		Genres:      metadata.Genres,
-		Cast:        metadata.Cast,
-		Directors:   metadata.Directors,
-		PosterUrl:   metadata.PosterURL,
-		BackdropUrl: metadata.BackdropURL,
-		TrailerUrl:  metadata.TrailerURL,
+		Id:            metadata.ID.String(),
+		MediaId:       metadata.MediaID.String(),
+		ImdbId:        metadata.IMDBID,
+		TmdbId:        metadata.TMDBID,
+		TvdbId:        metadata.TVDBID,
+		Description:   metadata.Description,
+		Rating:        metadata.Rating,
+		Genres:        metadata.Genres,
+		Cast:          metadata.Cast,
+		Directors:     metadata.Directors,
+		PosterUrl:     metadata.PosterURL,
+		BackdropUrl:   metadata.BackdropURL,
+		TrailerUrl:    metadata.TrailerURL,
+		Certification: metadata.Certification,
+		AnilistId:     metadata.AniListID,
+		ImvdbId:       metadata.IMVDbID,
+		AudiodbId:     metadata.AudioDBID,
+		Artist:        metadata.Artist,
 	}
 
 	// Parse ReleaseDate string to time.Time if not empty
 	if metadata.ReleaseDate != "" {
-		// Try common date formats
-		for _, format := range []string{"2006-01-02", "2006-01-02T15:04:05Z", "2006-01-02T15:04:05-07:00"} {
+		// Try common date formats; music video providers only know the year
+		for _, format := range []string{"2006-01-02", "2006-01-02T15:04:05Z", "2006-01-02T15:04:05-07:00", "2006"} {
 			if t, err := time.Parse(format, metadata.ReleaseDate); err == nil {
 				proto.ReleaseDate = timestamppb.New(t)
 				break
@@ -144,6 +194,7 @@ func convertEpisodeToProto(episode *models.Episode) *librarypb.Episode {
 		MediaId:         episode.MediaID.String(),
 		SeasonNumber:    int32(episode.SeasonNumber),
 		EpisodeNumber:   int32(episode.EpisodeNumber),
+		AbsoluteNumber:  int32(episode.AbsoluteNumber),
 		Title:           episode.Title,
 		Path:            episode.Path,
 		DurationSeconds: int32(episode.Duration),
@@ -156,3 +207,238 @@ func convertEpisodeToProto(episode *models.Episode) *librarypb.Episode {
 
 	return proto
 }
+
+// optionalTime converts an optional proto timestamp; unset timestamps clear
+// the time.
+func optionalTime(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
+
+// convertExportFormat converts proto export format to domain export format.
+func convertExportFormat(f librarypb.ExportFormat) domain.ExportFormat {
+	if f == librarypb.ExportFormat_EXPORT_FORMAT_CSV {
+		return domain.ExportFormatCSV
+	}
+	return domain.ExportFormatJSON
+}
+
+// convertConflictStrategy converts proto conflict strategy to domain conflict strategy.
+func convertConflictStrategy(s librarypb.ConflictStrategy) domain.ConflictStrategy {
+	switch s {
+	case librarypb.ConflictStrategy_CONFLICT_STRATEGY_OVERWRITE:
+		return domain.ConflictOverwrite
+	case librarypb.ConflictStrategy_CONFLICT_STRATEGY_MERGE:
+		return domain.ConflictMerge
+	default:
+		return domain.ConflictSkip
+	}
+}
+
+// convertExtrasMode converts proto extras mode to domain extras mode. The
+// mode is empty when unspecified.
+func convertExtrasMode(m librarypb.ExtrasMode) domain.ExtrasMode {
+	switch m {
+	case librarypb.ExtrasMode_EXTRAS_MODE_SKIP:
+		return domain.ExtrasModeSkip
+	case librarypb.ExtrasMode_EXTRAS_MODE_ATTACH:
+		return domain.ExtrasModeAttach
+	default:
+		return ""
+	}
+}
+
+// convertFolderProfile converts proto folder profile to domain folder
+// profile. The profile is empty when unspecified.
+func convertFolderProfile(p librarypb.FolderProfile) domain.FolderProfile {
+	switch p {
+	case librarypb.FolderProfile_FOLDER_PROFILE_FLAT:
+		return domain.FolderProfileFlat
+	case librarypb.FolderProfile_FOLDER_PROFILE_MOVIE_FOLDERS:
+		return domain.FolderProfileMovieFolders
+	case librarypb.FolderProfile_FOLDER_PROFILE_SEASON_FOLDERS:
+		return domain.FolderProfileSeasonFolders
+	case librarypb.FolderProfile_FOLDER_PROFILE_SERIES_FOLDERS:
+		return domain.FolderProfileSeriesFolders
+	default:
+		return domain.FolderProfileAuto
+	}
+}
+
+// convertFolderProfileToProto converts domain folder profile to proto
+// folder profile.
+func convertFolderProfileToProto(p domain.FolderProfile) librarypb.FolderProfile {
+	switch p {
+	case domain.FolderProfileFlat:
+		return librarypb.FolderProfile_FOLDER_PROFILE_FLAT
+	case domain.FolderProfileMovieFolders:
+		return librarypb.FolderProfile_FOLDER_PROFILE_MOVIE_FOLDERS
+	case domain.FolderProfileSeasonFolders:
+		return librarypb.FolderProfile_FOLDER_PROFILE_SEASON_FOLDERS
+	case domain.FolderProfileSeriesFolders:
+		return librarypb.FolderProfile_FOLDER_PROFILE_SERIES_FOLDERS
+	default:
+		return librarypb.FolderProfile_FOLDER_PROFILE_UNSPECIFIED
+	}
+}
+
+// convertExtrasModeToProto converts domain extras mode to proto extras mode.
+func convertExtrasModeToProto(m domain.ExtrasMode) librarypb.ExtrasMode {
+	switch m {
+	case domain.ExtrasModeSkip:
+		return librarypb.ExtrasMode_EXTRAS_MODE_SKIP
+	case domain.ExtrasModeAttach:
+		return librarypb.ExtrasMode_EXTRAS_MODE_ATTACH
+	default:
+		return librarypb.ExtrasMode_EXTRAS_MODE_UNSPECIFIED
+	}
+}
+
+// convertTitleStyle converts proto title style to domain title style. The
+// style is empty when unspecified.
+func convertTitleStyle(s librarypb.TitleStyle) domain.TitleStyle {
+	switch s {
+	case librarypb.TitleStyle_TITLE_STYLE_TRANSLATED:
+		return domain.TitleStyleTranslated
+	case librarypb.TitleStyle_TITLE_STYLE_ORIGINAL:
+		return domain.TitleStyleOriginal
+	default:
+		return ""
+	}
+}
+
+// convertTitleStyleToProto converts domain title style to proto title style.
+func convertTitleStyleToProto(s domain.TitleStyle) librarypb.TitleStyle {
+	switch s {
+	case domain.TitleStyleTranslated:
+		return librarypb.TitleStyle_TITLE_STYLE_TRANSLATED
+	case domain.TitleStyleOriginal:
+		return librarypb.TitleStyle_TITLE_STYLE_ORIGINAL
+	default:
+		return librarypb.TitleStyle_TITLE_STYLE_UNSPECIFIED
+	}
+}
+
+// convertAudioNormalization converts proto audio normalization to domain
+// audio normalization. The normalization is empty when unspecified.
+func convertAudioNormalization(n librarypb.AudioNormalization) domain.AudioNormalization {
+	switch n {
+	case librarypb.AudioNormalization_AUDIO_NORMALIZATION_OFF:
+		return domain.AudioNormalizationOff
+	case librarypb.AudioNormalization_AUDIO_NORMALIZATION_LOUDNORM:
+		return domain.AudioNormalizationLoudnorm
+	default:
+		return domain.AudioNormalizationDefault
+	}
+}
+
+// convertAudioNormalizationToProto converts domain audio normalization to
+// proto audio normalization.
+func convertAudioNormalizationToProto(n domain.AudioNormalization) librarypb.AudioNormalization {
+	switch n {
+	case domain.AudioNormalizationOff:
+		return librarypb.AudioNormalization_AUDIO_NORMALIZATION_OFF
+	case domain.AudioNormalizationLoudnorm:
+		return librarypb.AudioNormalization_AUDIO_NORMALIZATION_LOUDNORM
+	default:
+		return librarypb.AudioNormalization_AUDIO_NORMALIZATION_UNSPECIFIED
+	}
+}
+
+var workflowStatusToProto = map[saga.WorkflowStatus]librarypb.WorkflowStatus{
+	saga.WorkflowStatusRunning:      librarypb.WorkflowStatus_WORKFLOW_STATUS_RUNNING,
+	saga.WorkflowStatusCompleted:    librarypb.WorkflowStatus_WORKFLOW_STATUS_COMPLETED,
+	saga.WorkflowStatusCompensating: librarypb.WorkflowStatus_WORKFLOW_STATUS_COMPENSATING,
+	saga.WorkflowStatusCompensated:  librarypb.WorkflowStatus_WORKFLOW_STATUS_COMPENSATED,
+	saga.WorkflowStatusFailed:       librarypb.WorkflowStatus_WORKFLOW_STATUS_FAILED,
+	saga.WorkflowStatusParked:       librarypb.WorkflowStatus_WORKFLOW_STATUS_PARKED,
+}
+
+var workflowStepStatusToProto = map[saga.StepStatus]librarypb.WorkflowStepStatus{
+	saga.StepStatusPending:            librarypb.WorkflowStepStatus_WORKFLOW_STEP_STATUS_PENDING,
+	saga.StepStatusRunning:            librarypb.WorkflowStepStatus_WORKFLOW_STEP_STATUS_RUNNING,
+	saga.StepStatusCompleted:          librarypb.WorkflowStepStatus_WORKFLOW_STEP_STATUS_COMPLETED,
+	saga.StepStatusFailed:             librarypb.WorkflowStepStatus_WORKFLOW_STEP_STATUS_FAILED,
+	saga.StepStatusCompensated:        librarypb.WorkflowStepStatus_WORKFLOW_STEP_STATUS_COMPENSATED,
+	saga.StepStatusCompensationFailed: librarypb.WorkflowStepStatus_WORKFLOW_STEP_STATUS_COMPENSATION_FAILED,
+	saga.StepStatusParked:             librarypb.WorkflowStepStatus_WORKFLOW_STEP_STATUS_PARKED,
+}
+
+// convertWorkflowToProto converts a workflow to its proto timeline.
+func convertWorkflowToProto(wf *saga.Workflow) *librarypb.Workflow {
+	proto := &librarypb.Workflow{
+		Id:              wf.ID.String(),
+		MediaId:         wf.MediaID.String(),
+		Status:          workflowStatusToProto[wf.Status],
+		Error:           wf.Error,
+		CreatedAt:       timestamppb.New(wf.CreatedAt),
+		UpdatedAt:       timestamppb.New(wf.UpdatedAt),
+		MalwareVerdict:  wf.Data[service.WorkflowDataMalwareVerdict],
+		MalwareThreat:   wf.Data[service.WorkflowDataMalwareThreat],
+		QuarantinedPath: wf.Data[service.WorkflowDataQuarantinedPath],
+	}
+
+	for _, step := range wf.Steps {
+		protoStep := &librarypb.WorkflowStep{
+			Name:     step.Name,
+			Status:   workflowStepStatusToProto[step.Status],
+			Attempts: int32(step.Attempts),
+			Error:    step.Error,
+		}
+		if step.StartedAt != nil {
+			protoStep.StartedAt = timestamppb.New(*step.StartedAt)
+		}
+		if step.CompletedAt != nil {
+			protoStep.CompletedAt = timestamppb.New(*step.CompletedAt)
+		}
+		proto.Steps = append(proto.Steps, protoStep)
+	}
+
+	return proto
+}
+
+var scanChangeKindToProto = map[domain.ScanChangeKind]librarypb.ScanChange_Kind{
+	domain.ScanChangeAdded:   librarypb.ScanChange_KIND_ADDED,
+	domain.ScanChangeUpdated: librarypb.ScanChange_KIND_UPDATED,
+	domain.ScanChangeRemoved: librarypb.ScanChange_KIND_REMOVED,
+}
+
+// convertScanChangeToProto converts a previewed scan change to proto.
+func convertScanChangeToProto(change *domain.ScanChange) *librarypb.ScanChange {
+	proto := &librarypb.ScanChange{
+		Kind:       scanChangeKindToProto[change.Kind],
+		Path:       change.Path,
+		Reasons:    change.Reasons,
+		Title:      change.Title,
+		Year:       int32(change.Year),
+		ExtraType:  string(change.Extra),
+		Candidates: make([]*librarypb.ImportCandidate, len(change.Candidates)),
+	}
+	if change.MediaID != uuid.Nil {
+		proto.MediaId = change.MediaID.String()
+	}
+	if change.EpisodeID != nil {
+		proto.EpisodeId = change.EpisodeID.String()
+	}
+	if change.Episode != nil {
+		proto.SeasonNumber = int32(change.Episode.Season)
+		for _, n := range change.Episode.Episodes {
+			proto.EpisodeNumbers = append(proto.EpisodeNumbers, int32(n))
+		}
+		for _, n := range change.Episode.Absolute {
+			proto.AbsoluteNumbers = append(proto.AbsoluteNumbers, int32(n))
+		}
+	}
+	for i, candidate := range change.Candidates {
+		proto.Candidates[i] = &librarypb.ImportCandidate{
+			MediaId: candidate.MediaID.String(),
+			Title:   candidate.Title,
+			Year:    int32(candidate.Year),
+			Score:   candidate.Score,
+		}
+	}
+	return proto
+}
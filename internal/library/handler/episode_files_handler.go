@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// ListEpisodeFiles lists the files of the episodes of a series.
+func (h *GRPCHandler) ListEpisodeFiles(
+	ctx context.Context,
+	req *librarypb.ListEpisodeFilesRequest,
+) (*librarypb.ListEpisodeFilesResponse, error) {
+	mediaID, err := uuid.Parse(req.GetMediaId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid media ID")
+	}
+
+	files, err := h.libraryService.ListEpisodeFiles(ctx, mediaID)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		h.logger.Error("Failed to list episode files", interfaces.Error(err))
+		return nil, status.Error(codes.Internal, "failed to list episode files")
+	}
+
+	resp := &librarypb.ListEpisodeFilesResponse{
+		Files: make([]*librarypb.EpisodeFile, len(files)),
+	}
+	for i, file := range files {
+		resp.Files[i] = &librarypb.EpisodeFile{
+			EpisodeId:       file.EpisodeID.String(),
+			MediaId:         file.MediaID.String(),
+			Path:            file.Path,
+			Part:            int32(file.Part),
+			DurationSeconds: int32(file.Duration),
+		}
+	}
+	return resp, nil
+}
+
+// RecordWatchProgress records the caller's watch progress of a media item
+// or episode.
+func (h *GRPCHandler) RecordWatchProgress(
+	ctx context.Context,
+	req *librarypb.RecordWatchProgressRequest,
+) (*librarypb.RecordWatchProgressResponse, error) {
+	userID, err := watchlistUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mediaID, err := uuid.Parse(req.GetMediaId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid media ID")
+	}
+	var episodeID *uuid.UUID
+	if req.GetEpisodeId() != "" {
+		id, err := uuid.Parse(req.GetEpisodeId())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid episode ID")
+		}
+		episodeID = &id
+	}
+
+	states, err := h.libraryService.RecordWatchProgress(ctx, userID, mediaID, episodeID, int(req.GetPositionSeconds()))
+	if err != nil {
+		switch {
+		case errors.IsNotFound(err):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.IsBadRequest(err):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		h.logger.Error("Failed to record watch progress", interfaces.Error(err))
+		return nil, status.Error(codes.Internal, "failed to record watch progress")
+	}
+
+	resp := &librarypb.RecordWatchProgressResponse{
+		Progress: make([]*librarypb.WatchProgress, len(states)),
+	}
+	for i, state := range states {
+		resp.Progress[i] = convertWatchProgressToProto(state)
+	}
+	return resp, nil
+}
+
+func convertWatchProgressToProto(state *models.WatchHistory) *librarypb.WatchProgress {
+	progress := &librarypb.WatchProgress{
+		MediaId:         state.MediaID.String(),
+		PositionSeconds: int32(state.Position),
+		DurationSeconds: int32(state.Duration),
+		Completed:       state.Completed,
+	}
+	if state.EpisodeID != nil {
+		progress.EpisodeId = state.EpisodeID.String()
+	}
+	return progress
+}
@@ -0,0 +1,219 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
+)
+
+// CreateFeed adds an RSS feed to a library.
+func (h *GRPCHandler) CreateFeed(
+	ctx context.Context,
+	req *librarypb.CreateFeedRequest,
+) (*librarypb.CreateFeedResponse, error) {
+	if h.feeds == nil {
+		return nil, status.Error(codes.Unimplemented, "feeds are not enabled")
+	}
+
+	libraryID, err := uuid.Parse(req.GetFeed().GetLibraryId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid library ID")
+	}
+
+	feed := convertFeedFromProto(req.GetFeed())
+	feed.LibraryID = libraryID
+	if err := h.feeds.CreateFeed(ctx, feed); err != nil {
+		return nil, h.feedError(err)
+	}
+
+	return &librarypb.CreateFeedResponse{
+		Feed: convertFeedToProto(feed),
+	}, nil
+}
+
+// ListFeeds lists the feeds of a library, or of every library.
+func (h *GRPCHandler) ListFeeds(
+	ctx context.Context,
+	req *librarypb.ListFeedsRequest,
+) (*librarypb.ListFeedsResponse, error) {
+	if h.feeds == nil {
+		return nil, status.Error(codes.Unimplemented, "feeds are not enabled")
+	}
+
+	var libraryID *uuid.UUID
+	if req.GetLibraryId() != "" {
+		id, err := uuid.Parse(req.GetLibraryId())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid library ID")
+		}
+		libraryID = &id
+	}
+
+	feeds, err := h.feeds.ListFeeds(ctx, libraryID)
+	if err != nil {
+		return nil, h.feedError(err)
+	}
+
+	resp := &librarypb.ListFeedsResponse{
+		Feeds: make([]*librarypb.Feed, len(feeds)),
+	}
+	for i, feed := range feeds {
+		resp.Feeds[i] = convertFeedToProto(feed)
+	}
+	return resp, nil
+}
+
+// UpdateFeed updates the settings of a feed.
+func (h *GRPCHandler) UpdateFeed(
+	ctx context.Context,
+	req *librarypb.UpdateFeedRequest,
+) (*librarypb.UpdateFeedResponse, error) {
+	if h.feeds == nil {
+		return nil, status.Error(codes.Unimplemented, "feeds are not enabled")
+	}
+
+	feedID, err := uuid.Parse(req.GetFeed().GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid feed ID")
+	}
+
+	feed := convertFeedFromProto(req.GetFeed())
+	feed.ID = feedID
+	updated, err := h.feeds.UpdateFeed(ctx, feed)
+	if err != nil {
+		return nil, h.feedError(err)
+	}
+
+	return &librarypb.UpdateFeedResponse{
+		Feed: convertFeedToProto(updated),
+	}, nil
+}
+
+// DeleteFeed deletes a feed.
+func (h *GRPCHandler) DeleteFeed(
+	ctx context.Context,
+	req *librarypb.DeleteFeedRequest,
+) (*librarypb.DeleteFeedResponse, error) {
+	if h.feeds == nil {
+		return nil, status.Error(codes.Unimplemented, "feeds are not enabled")
+	}
+
+	feedID, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid feed ID")
+	}
+
+	if err := h.feeds.DeleteFeed(ctx, feedID); err != nil {
+		return nil, h.feedError(err)
+	}
+	return &librarypb.DeleteFeedResponse{}, nil
+}
+
+// TestFeed fetches a saved or unsaved feed and reports which of its items
+// a poll would grab.
+func (h *GRPCHandler) TestFeed(
+	ctx context.Context,
+	req *librarypb.TestFeedRequest,
+) (*librarypb.TestFeedResponse, error) {
+	if h.feeds == nil {
+		return nil, status.Error(codes.Unimplemented, "feeds are not enabled")
+	}
+
+	var feed *domain.Feed
+	switch target := req.GetTarget().(type) {
+	case *librarypb.TestFeedRequest_Id:
+		feedID, err := uuid.Parse(target.Id)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid feed ID")
+		}
+		feed, err = h.feeds.GetFeed(ctx, feedID)
+		if err != nil {
+			return nil, h.feedError(err)
+		}
+	case *librarypb.TestFeedRequest_Feed:
+		feed = convertFeedFromProto(target.Feed)
+	default:
+		return nil, status.Error(codes.InvalidArgument, "feed ID or feed is required")
+	}
+
+	preview, err := h.feeds.PreviewFeed(ctx, feed)
+	if err != nil {
+		return nil, h.feedError(err)
+	}
+
+	resp := &librarypb.TestFeedResponse{
+		Items: make([]*librarypb.FeedPreviewItem, len(preview)),
+	}
+	for i, p := range preview {
+		item := &librarypb.FeedPreviewItem{
+			Title:       p.Item.Title,
+			DownloadUrl: p.Item.DownloadURL,
+			InfoHash:    p.Item.InfoHash,
+			Size:        p.Item.Size,
+			Quality:     p.Quality,
+			Matched:     p.Matched,
+			Reason:      p.Reason,
+			Grabbed:     p.Grabbed,
+		}
+		if !p.Item.PublishedAt.IsZero() {
+			item.PublishedAt = timestamppb.New(p.Item.PublishedAt)
+		}
+		resp.Items[i] = item
+	}
+	return resp, nil
+}
+
+func (h *GRPCHandler) feedError(err error) error {
+	switch {
+	case errors.IsNotFound(err):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.IsBadRequest(err):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	h.logger.Error("Feed request failed", interfaces.Error(err))
+	return status.Error(codes.Internal, "failed to process feed request")
+}
+
+func convertFeedFromProto(feed *librarypb.Feed) *domain.Feed {
+	return &domain.Feed{
+		Name:           feed.GetName(),
+		URL:            feed.GetUrl(),
+		Include:        feed.GetInclude(),
+		Exclude:        feed.GetExclude(),
+		Qualities:      feed.GetQualities(),
+		DownloadClient: feed.GetDownloadClient(),
+		Enabled:        feed.GetEnabled(),
+	}
+}
+
+// convertFeedToProto converts a feed for clients, which never see the
+// credentials in its URL.
+func convertFeedToProto(feed *domain.Feed) *librarypb.Feed {
+	feed = feed.Redacted()
+	proto := &librarypb.Feed{
+		Id:             feed.ID.String(),
+		LibraryId:      feed.LibraryID.String(),
+		Name:           feed.Name,
+		Url:            feed.URL,
+		Include:        feed.Include,
+		Exclude:        feed.Exclude,
+		Qualities:      feed.Qualities,
+		DownloadClient: feed.DownloadClient,
+		Enabled:        feed.Enabled,
+		LastError:      feed.LastError,
+		CreatedAt:      timestamppb.New(feed.CreatedAt),
+		UpdatedAt:      timestamppb.New(feed.UpdatedAt),
+	}
+	if feed.LastPolledAt != nil {
+		proto.LastPolledAt = timestamppb.New(*feed.LastPolledAt)
+	}
+	return proto
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"os"
@@ -21,6 +22,7 @@ import (
 	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
 	"github.com/narwhalmedia/narwhal/pkg/models"
 	"github.com/narwhalmedia/narwhal/pkg/pagination"
+	"github.com/narwhalmedia/narwhal/pkg/plugin"
 )
 
 // GRPCHandler implements the LibraryService gRPC server.
@@ -28,6 +30,24 @@ type GRPCHandler struct {
 	librarypb.UnimplementedLibraryServiceServer
 
 	libraryService    service.LibraryServiceInterface
+	themeService      *service.ThemeService
+	policyService     *service.TranscodePolicyService
+	searchIndex       *service.SearchIndexService
+	storage           *service.StorageService
+	hooks             *service.HookService
+	plugins           *plugin.Manager
+	feeds             *service.FeedService
+	calendarFeed      *CalendarFeed
+	wanted            *service.WantedService
+	blocklist         *service.BlocklistService
+	health            *service.HealthService
+	playback          *service.PlaybackIssueService
+	watchlist         *service.WatchlistService
+	shares            *service.ShareLinkService
+	requests          *service.ContentRequestService
+	issues            *service.MediaIssueService
+	kiosks            *service.KioskService
+	analytics         *service.AnalyticsService
 	logger            interfaces.Logger
 	paginationEncoder *pagination.CursorEncoder
 }
@@ -45,6 +65,115 @@ func NewGRPCHandler(
 	}
 }
 
+// WithThemeService enables the theme music methods.
+func (h *GRPCHandler) WithThemeService(themeService *service.ThemeService) *GRPCHandler {
+	h.themeService = themeService
+	return h
+}
+
+// WithTranscodePolicyService enables the transcode policy methods.
+func (h *GRPCHandler) WithTranscodePolicyService(policyService *service.TranscodePolicyService) *GRPCHandler {
+	h.policyService = policyService
+	return h
+}
+
+// WithSearchIndexService enables rebuilding the search index.
+func (h *GRPCHandler) WithSearchIndexService(searchIndex *service.SearchIndexService) *GRPCHandler {
+	h.searchIndex = searchIndex
+	return h
+}
+
+// WithStorageService enables storage usage reporting.
+func (h *GRPCHandler) WithStorageService(storage *service.StorageService) *GRPCHandler {
+	h.storage = storage
+	return h
+}
+
+// WithHookService enables managing hook scripts.
+func (h *GRPCHandler) WithHookService(hooks *service.HookService) *GRPCHandler {
+	h.hooks = hooks
+	return h
+}
+
+// WithPluginManager enables listing the plugin registry.
+func (h *GRPCHandler) WithPluginManager(plugins *plugin.Manager) *GRPCHandler {
+	h.plugins = plugins
+	return h
+}
+
+// WithFeedService enables managing RSS feeds.
+func (h *GRPCHandler) WithFeedService(feeds *service.FeedService) *GRPCHandler {
+	h.feeds = feeds
+	return h
+}
+
+// WithCalendarFeed returns the feed tokens of the iCalendar export with
+// calendars.
+func (h *GRPCHandler) WithCalendarFeed(feed *CalendarFeed) *GRPCHandler {
+	h.calendarFeed = feed
+	return h
+}
+
+// WithWantedService enables the wanted report and interactive search.
+func (h *GRPCHandler) WithWantedService(wanted *service.WantedService) *GRPCHandler {
+	h.wanted = wanted
+	return h
+}
+
+// WithBlocklistService enables the release blocklist RPCs.
+func (h *GRPCHandler) WithBlocklistService(blocklist *service.BlocklistService) *GRPCHandler {
+	h.blocklist = blocklist
+	return h
+}
+
+// WithHealthService enables the indexer and download client health RPC.
+func (h *GRPCHandler) WithHealthService(health *service.HealthService) *GRPCHandler {
+	h.health = health
+	return h
+}
+
+// WithPlaybackIssueService enables the playback issue RPCs.
+func (h *GRPCHandler) WithPlaybackIssueService(playback *service.PlaybackIssueService) *GRPCHandler {
+	h.playback = playback
+	return h
+}
+
+// WithWatchlistService enables the watchlist RPCs.
+func (h *GRPCHandler) WithWatchlistService(watchlist *service.WatchlistService) *GRPCHandler {
+	h.watchlist = watchlist
+	return h
+}
+
+// WithShareLinkService enables the share link RPCs.
+func (h *GRPCHandler) WithShareLinkService(shares *service.ShareLinkService) *GRPCHandler {
+	h.shares = shares
+	return h
+}
+
+// WithContentRequestService enables the content request RPCs.
+func (h *GRPCHandler) WithContentRequestService(requests *service.ContentRequestService) *GRPCHandler {
+	h.requests = requests
+	return h
+}
+
+// WithMediaIssueService enables the media issue RPCs.
+func (h *GRPCHandler) WithMediaIssueService(issues *service.MediaIssueService) *GRPCHandler {
+	h.issues = issues
+	return h
+}
+
+// WithKioskService enables the kiosk RPCs.
+func (h *GRPCHandler) WithKioskService(kiosks *service.KioskService) *GRPCHandler {
+	h.kiosks = kiosks
+	return h
+}
+
+// WithAnalyticsService enables the analytics RPCs.
+func (h *GRPCHandler) WithAnalyticsService(analytics *service.AnalyticsService) *GRPCHandler {
+	h.analytics = analytics
+	return h
+}
+
 // checkAuth validates that the user is authenticated by checking for user context
 // Returns roles from context.
 func (h *GRPCHandler) checkAuth(ctx context.Context) ([]string, error) {
@@ -81,9 +210,31 @@ func (h *GRPCHandler) CreateLibrary(
 		ScanInterval: int(req.GetScanIntervalMinutes()) * constants.SecondsToMinutes, // Convert minutes to seconds
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
+
+		ExcludePatterns: req.GetExcludePatterns(),
+		ExtrasMode:      convertExtrasMode(req.GetExtrasMode()),
+		QualityCutoff:   req.GetQualityCutoff(),
+
+		IgnoreExtrasFolders: req.GetIgnoreExtrasFolders(),
+		FolderProfile:       convertFolderProfile(req.GetFolderProfile()),
+		AudioNormalization:  convertAudioNormalization(req.GetAudioNormalization()),
+
+		MetadataPreferences: domain.MetadataPreferences{
+			Language:   req.GetMetadataLanguage(),
+			Region:     req.GetMetadataRegion(),
+			TitleStyle: convertTitleStyle(req.GetTitleStyle()),
+		},
+		Anime: req.GetAnime(),
+		Naming: domain.NamingRules{
+			MovieFormat:   req.GetMovieFormat(),
+			EpisodeFormat: req.GetEpisodeFormat(),
+		},
 	}
 
 	if err := h.libraryService.CreateLibrary(ctx, library); err != nil {
+		if errors.IsBadRequest(err) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		h.logger.Error("Failed to create library", interfaces.Error(err))
 		return nil, status.Errorf(codes.Internal, "failed to create library: %v", err)
 	}
@@ -273,6 +424,34 @@ func (h *GRPCHandler) UpdateLibrary(
 						req.GetLibrary().GetScanIntervalMinutes(),
 					) * constants.SecondsToMinutes
 				}
+			case "exclude_patterns":
+				updates["exclude_patterns"] = req.GetLibrary().GetExcludePatterns()
+			case "extras_mode":
+				if mode := convertExtrasMode(req.GetLibrary().GetExtrasMode()); mode != "" {
+					updates["extras_mode"] = string(mode)
+				}
+			case "quality_cutoff":
+				updates["quality_cutoff"] = req.GetLibrary().GetQualityCutoff()
+			case "metadata_language":
+				updates["metadata_language"] = req.GetLibrary().GetMetadataLanguage()
+			case "metadata_region":
+				updates["metadata_region"] = req.GetLibrary().GetMetadataRegion()
+			case "title_style":
+				if style := convertTitleStyle(req.GetLibrary().GetTitleStyle()); style != "" {
+					updates["title_style"] = string(style)
+				}
+			case "anime":
+				updates["anime"] = req.GetLibrary().GetAnime()
+			case "movie_format":
+				updates["movie_format"] = req.GetLibrary().GetMovieFormat()
+			case "episode_format":
+				updates["episode_format"] = req.GetLibrary().GetEpisodeFormat()
+			case "folder_profile":
+				updates["folder_profile"] = string(convertFolderProfile(req.GetLibrary().GetFolderProfile()))
+			case "ignore_extras_folders":
+				updates["ignore_extras_folders"] = req.GetLibrary().GetIgnoreExtrasFolders()
+			case "audio_normalization":
+				updates["audio_normalization"] = string(convertAudioNormalization(req.GetLibrary().GetAudioNormalization()))
 			}
 		}
 	} else {
@@ -287,6 +466,38 @@ func (h *GRPCHandler) UpdateLibrary(
 		if req.GetLibrary().GetScanIntervalMinutes() > 0 {
 			updates["scan_interval"] = int(req.GetLibrary().GetScanIntervalMinutes()) * constants.SecondsToMinutes
 		}
+		if len(req.GetLibrary().GetExcludePatterns()) > 0 {
+			updates["exclude_patterns"] = req.GetLibrary().GetExcludePatterns()
+		}
+		if mode := convertExtrasMode(req.GetLibrary().GetExtrasMode()); mode != "" {
+			updates["extras_mode"] = string(mode)
+		}
+		if req.GetLibrary().GetQualityCutoff() != "" {
+			updates["quality_cutoff"] = req.GetLibrary().GetQualityCutoff()
+		}
+		if req.GetLibrary().GetMetadataLanguage() != "" {
+			updates["metadata_language"] = req.GetLibrary().GetMetadataLanguage()
+		}
+		if req.GetLibrary().GetMetadataRegion() != "" {
+			updates["metadata_region"] = req.GetLibrary().GetMetadataRegion()
+		}
+		if style := convertTitleStyle(req.GetLibrary().GetTitleStyle()); style != "" {
+			updates["title_style"] = string(style)
+		}
+		updates["anime"] = req.GetLibrary().GetAnime()
+		if req.GetLibrary().GetMovieFormat() != "" {
+			updates["movie_format"] = req.GetLibrary().GetMovieFormat()
+		}
+		if req.GetLibrary().GetEpisodeFormat() != "" {
+			updates["episode_format"] = req.GetLibrary().GetEpisodeFormat()
+		}
+		if profile := convertFolderProfile(req.GetLibrary().GetFolderProfile()); profile != "" {
+			updates["folder_profile"] = string(profile)
+		}
+		updates["ignore_extras_folders"] = req.GetLibrary().GetIgnoreExtrasFolders()
+		if normalization := convertAudioNormalization(req.GetLibrary().GetAudioNormalization()); normalization != "" {
+			updates["audio_normalization"] = string(normalization)
+		}
 	}
 
 	// Update library
@@ -295,6 +506,9 @@ func (h *GRPCHandler) UpdateLibrary(
 		if errors.IsNotFound(err) {
 			return nil, status.Error(codes.NotFound, "library not found")
 		}
+		if errors.IsBadRequest(err) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		h.logger.Error("Failed to update library",
 			interfaces.Error(err),
 			interfaces.String("library_id", req.GetId()))
@@ -350,7 +564,8 @@ func (h *GRPCHandler) ScanLibrary(
 		return nil, status.Error(codes.InvalidArgument, "invalid library ID")
 	}
 
-	if err := h.libraryService.ScanLibrary(ctx, id); err != nil {
+	scan, err := h.libraryService.ScanLibrary(ctx, id, req.GetFull())
+	if err != nil {
 		if errors.IsNotFound(err) {
 			return nil, status.Error(codes.NotFound, "library not found")
 		}
@@ -368,9 +583,200 @@ func (h *GRPCHandler) ScanLibrary(
 		ScanId:  req.GetId(),
 		Status:  librarypb.ScanLibraryResponse_STATUS_STARTED,
 		Message: "scan started successfully",
+		TaskId:  scan.ID.String(),
 	}, nil
 }
 
+// PreviewScan streams the changes a scan of a library would make, followed
+// by a summary, without writing anything.
+func (h *GRPCHandler) PreviewScan(
+	req *librarypb.PreviewScanRequest,
+	stream librarypb.LibraryService_PreviewScanServer,
+) error {
+	ctx := stream.Context()
+
+	if _, err := h.checkAuth(ctx); err != nil {
+		return err
+	}
+
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "invalid library ID")
+	}
+
+	preview, err := h.libraryService.PreviewScan(ctx, id, func(change *domain.ScanChange) error {
+		return stream.Send(&librarypb.PreviewScanResponse{
+			Result: &librarypb.PreviewScanResponse_Change{Change: convertScanChangeToProto(change)},
+		})
+	})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return status.Error(codes.NotFound, "library not found")
+		}
+		h.logger.Error("Failed to preview scan",
+			interfaces.Error(err),
+			interfaces.String("library_id", req.GetId()))
+		return status.Error(codes.Internal, "failed to preview scan")
+	}
+
+	summary := &librarypb.ScanPreviewSummary{
+		FilesFound:          int32(preview.FilesFound),
+		Added:               int32(preview.Added),
+		Updated:             int32(preview.Updated),
+		Removed:             int32(preview.Removed),
+		LayoutMismatchCount: int32(preview.LayoutMismatchCount),
+	}
+	for _, mismatch := range preview.LayoutMismatches {
+		summary.LayoutMismatches = append(summary.LayoutMismatches, &librarypb.LayoutMismatch{
+			Path:   mismatch.Path,
+			Reason: mismatch.Reason,
+		})
+	}
+	return stream.Send(&librarypb.PreviewScanResponse{
+		Result: &librarypb.PreviewScanResponse_Summary{Summary: summary},
+	})
+}
+
+// ExportLibrary exports a library as a portable document.
+func (h *GRPCHandler) ExportLibrary(
+	ctx context.Context,
+	req *librarypb.ExportLibraryRequest,
+) (*librarypb.ExportLibraryResponse, error) {
+	if _, err := h.checkAuth(ctx); err != nil {
+		return nil, err
+	}
+
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid library ID")
+	}
+
+	export, err := h.libraryService.ExportLibrary(ctx, id)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, status.Error(codes.NotFound, "library not found")
+		}
+		h.logger.Error("Failed to export library",
+			interfaces.Error(err),
+			interfaces.String("library_id", req.GetId()))
+		return nil, status.Errorf(codes.Internal, "failed to export library: %v", err)
+	}
+
+	format := convertExportFormat(req.GetFormat())
+	var buf bytes.Buffer
+	if err := domain.EncodeLibraryExport(&buf, export, format); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to encode export: %v", err)
+	}
+
+	respFormat := librarypb.ExportFormat_EXPORT_FORMAT_JSON
+	if format == domain.ExportFormatCSV {
+		respFormat = librarypb.ExportFormat_EXPORT_FORMAT_CSV
+	}
+
+	return &librarypb.ExportLibraryResponse{
+		Format:     respFormat,
+		Data:       buf.Bytes(),
+		MediaCount: int32(len(export.Media)),
+	}, nil
+}
+
+// ImportLibrary imports a portable document into a library.
+func (h *GRPCHandler) ImportLibrary(
+	ctx context.Context,
+	req *librarypb.ImportLibraryRequest,
+) (*librarypb.ImportLibraryResponse, error) {
+	if _, err := h.checkAuth(ctx); err != nil {
+		return nil, err
+	}
+
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid library ID")
+	}
+
+	if len(req.GetData()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "import data is required")
+	}
+
+	data, err := domain.DecodeLibraryExport(bytes.NewReader(req.GetData()), convertExportFormat(req.GetFormat()))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid import data: %v", err)
+	}
+
+	result, err := h.libraryService.ImportLibrary(ctx, id, data, convertConflictStrategy(req.GetConflictStrategy()))
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, status.Error(codes.NotFound, "library not found")
+		}
+		if errors.IsBadRequest(err) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		h.logger.Error("Failed to import library",
+			interfaces.Error(err),
+			interfaces.String("library_id", req.GetId()))
+		return nil, status.Errorf(codes.Internal, "failed to import library: %v", err)
+	}
+
+	return &librarypb.ImportLibraryResponse{
+		Created: int32(result.Created),
+		Updated: int32(result.Updated),
+		Skipped: int32(result.Skipped),
+		Failed:  int32(result.Failed),
+		Errors:  result.Errors,
+	}, nil
+}
+
+// RelocateLibrary rewrites the path prefix of a library and its files after
+// they were moved.
+func (h *GRPCHandler) RelocateLibrary(
+	ctx context.Context,
+	req *librarypb.RelocateLibraryRequest,
+) (*librarypb.RelocateLibraryResponse, error) {
+	if _, err := h.checkAuth(ctx); err != nil {
+		return nil, err
+	}
+
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid library ID")
+	}
+
+	relocation, err := h.libraryService.RelocateLibrary(ctx, id, req.GetFrom(), req.GetTo(), req.GetDryRun())
+	if err != nil {
+		switch {
+		case errors.IsNotFound(err):
+			return nil, status.Error(codes.NotFound, "library not found")
+		case errors.IsBadRequest(err):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.IsConflict(err):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		h.logger.Error("Failed to relocate library",
+			interfaces.Error(err),
+			interfaces.String("library_id", req.GetId()))
+		return nil, status.Errorf(codes.Internal, "failed to relocate library: %v", err)
+	}
+
+	resp := &librarypb.RelocateLibraryResponse{
+		LibraryPath: relocation.LibraryPath,
+		Files:       make([]*librarypb.RelocatedFile, len(relocation.Files)),
+		Missing:     int32(relocation.Missing),
+		Applied:     relocation.Applied,
+	}
+	for i, file := range relocation.Files {
+		resp.Files[i] = &librarypb.RelocatedFile{
+			MediaId: file.MediaID.String(),
+			Path:    file.Path,
+			NewPath: file.NewPath,
+			Exists:  file.Exists,
+		}
+		if file.EpisodeID != nil {
+			resp.Files[i].EpisodeId = file.EpisodeID.String()
+		}
+	}
+	return resp, nil
+}
+
 // GetMedia retrieves a media item.
 func (h *GRPCHandler) GetMedia(
 	ctx context.Context,
@@ -389,6 +795,29 @@ func (h *GRPCHandler) GetMedia(
 		return nil, status.Errorf(codes.Internal, "failed to get media: %v", err)
 	}
 
+	if req.GetIncludeExtras() {
+		extras, err := h.libraryService.ListExtras(ctx, id)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to list extras: %v", err)
+		}
+
+		// Copy so the cached media is not modified
+		withExtras := *media
+		withExtras.Extras = extras
+		media = &withExtras
+	}
+
+	if req.GetIncludeEpisodes() {
+		episodes, err := h.libraryService.ListEpisodes(ctx, id)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to list episodes: %v", err)
+		}
+
+		withEpisodes := *media
+		withEpisodes.Episodes = episodes
+		media = &withEpisodes
+	}
+
 	return &librarypb.GetMediaResponse{
 		Media: convertMediaToProto(media, req.GetIncludeMetadata(), req.GetIncludeEpisodes()),
 	}, nil
@@ -585,6 +1014,12 @@ func (h *GRPCHandler) UpdateMedia(
 				if req.GetMedia().GetMetadata() != nil && req.GetMedia().GetMetadata().GetRating() > 0 {
 					updates["rating"] = req.GetMedia().GetMetadata().GetRating()
 				}
+			case "monitored":
+				updates["monitored"] = req.GetMedia().GetMonitored()
+			case "digital_release_date":
+				updates["digital_release_date"] = optionalTime(req.GetMedia().GetDigitalReleaseDate())
+			case "physical_release_date":
+				updates["physical_release_date"] = optionalTime(req.GetMedia().GetPhysicalReleaseDate())
 			}
 		}
 	} else {
@@ -677,6 +1112,261 @@ func (h *GRPCHandler) DeleteMedia(
 	return &librarypb.DeleteMediaResponse{}, nil
 }
 
+// MoveFile moves the file of a media item to another path inside its
+// library.
+func (h *GRPCHandler) MoveFile(
+	ctx context.Context,
+	req *librarypb.MoveFileRequest,
+) (*librarypb.MoveFileResponse, error) {
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid media ID")
+	}
+
+	media, err := h.libraryService.MoveFile(ctx, id, req.GetPath())
+	if err != nil {
+		switch {
+		case errors.IsNotFound(err):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.IsBadRequest(err):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.IsConflict(err):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		h.logger.Error("Failed to move media file",
+			interfaces.Error(err),
+			interfaces.String("media_id", req.GetId()))
+		return nil, status.Errorf(codes.Internal, "failed to move media file: %v", err)
+	}
+
+	return &librarypb.MoveFileResponse{
+		Media: convertMediaToProto(media, false, false),
+	}, nil
+}
+
+// PreviewRename lists the files of media whose path changes when renamed
+// to the naming formats of their libraries.
+func (h *GRPCHandler) PreviewRename(
+	ctx context.Context,
+	req *librarypb.PreviewRenameRequest,
+) (*librarypb.PreviewRenameResponse, error) {
+	ids, err := parseMediaIDs(req.GetMediaIds())
+	if err != nil {
+		return nil, err
+	}
+
+	rename, err := h.libraryService.PreviewRename(ctx, ids)
+	if err != nil {
+		switch {
+		case errors.IsNotFound(err):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.IsBadRequest(err):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		h.logger.Error("Failed to preview rename", interfaces.Error(err))
+		return nil, status.Errorf(codes.Internal, "failed to preview rename: %v", err)
+	}
+
+	resp := &librarypb.PreviewRenameResponse{
+		Files:     make([]*librarypb.RenamedFile, len(rename.Files)),
+		Conflicts: int32(rename.Conflicts),
+	}
+	for i, file := range rename.Files {
+		resp.Files[i] = &librarypb.RenamedFile{
+			MediaId:  file.MediaID.String(),
+			Path:     file.Path,
+			NewPath:  file.NewPath,
+			Conflict: file.Conflict,
+		}
+		if file.EpisodeID != nil {
+			resp.Files[i].EpisodeId = file.EpisodeID.String()
+		}
+	}
+	return resp, nil
+}
+
+// ApplyRename starts a task renaming the files of media to the naming
+// formats of their libraries.
+func (h *GRPCHandler) ApplyRename(
+	ctx context.Context,
+	req *librarypb.ApplyRenameRequest,
+) (*librarypb.ApplyRenameResponse, error) {
+	ids, err := parseMediaIDs(req.GetMediaIds())
+	if err != nil {
+		return nil, err
+	}
+
+	renameTask, err := h.libraryService.ApplyRename(ctx, ids)
+	if err != nil {
+		switch {
+		case errors.IsNotFound(err):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.IsBadRequest(err):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.IsConflict(err):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		h.logger.Error("Failed to start rename", interfaces.Error(err))
+		return nil, status.Errorf(codes.Internal, "failed to start rename: %v", err)
+	}
+
+	return &librarypb.ApplyRenameResponse{TaskId: renameTask.ID.String()}, nil
+}
+
+// parseMediaIDs parses the media IDs of a request.
+func parseMediaIDs(values []string) ([]uuid.UUID, error) {
+	ids := make([]uuid.UUID, len(values))
+	for i, value := range values {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid media ID")
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// ReplaceFile replaces the file of a media item with another, or only
+// compares them in a dry run.
+func (h *GRPCHandler) ReplaceFile(
+	ctx context.Context,
+	req *librarypb.ReplaceFileRequest,
+) (*librarypb.ReplaceFileResponse, error) {
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid media ID")
+	}
+
+	var media *models.Media
+	var comparison *domain.FileComparison
+	if req.GetDryRun() {
+		comparison, err = h.libraryService.CompareFile(ctx, id, req.GetPath())
+	} else {
+		media, comparison, err = h.libraryService.ReplaceFile(ctx, id, req.GetPath(), req.GetDownloadClient())
+	}
+	if err != nil {
+		switch {
+		case errors.IsNotFound(err):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.IsBadRequest(err):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.IsConflict(err):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		h.logger.Error("Failed to replace media file",
+			interfaces.Error(err),
+			interfaces.String("media_id", req.GetId()))
+		return nil, status.Errorf(codes.Internal, "failed to replace media file: %v", err)
+	}
+
+	resp := &librarypb.ReplaceFileResponse{Comparison: convertFileComparisonToProto(comparison)}
+	if media != nil {
+		resp.Media = convertMediaToProto(media, false, false)
+	}
+	return resp, nil
+}
+
+// GetWorkflow returns the step timeline of a media item's latest workflow.
+func (h *GRPCHandler) GetWorkflow(
+	ctx context.Context,
+	req *librarypb.GetWorkflowRequest,
+) (*librarypb.GetWorkflowResponse, error) {
+	mediaID, err := uuid.Parse(req.GetMediaId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid media ID")
+	}
+
+	wf, err := h.libraryService.GetWorkflow(ctx, mediaID)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, status.Error(codes.NotFound, "workflow not found")
+		}
+		return nil, status.Errorf(codes.Internal, "failed to get workflow: %v", err)
+	}
+
+	return &librarypb.GetWorkflowResponse{
+		Workflow: convertWorkflowToProto(wf),
+	}, nil
+}
+
+// ListWorkflowHistory lists archived workflows.
+func (h *GRPCHandler) ListWorkflowHistory(
+	ctx context.Context,
+	req *librarypb.ListWorkflowHistoryRequest,
+) (*librarypb.ListWorkflowHistoryResponse, error) {
+	var filter domain.WorkflowHistoryFilter
+	if req.GetMediaId() != "" {
+		mediaID, err := uuid.Parse(req.GetMediaId())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid media ID")
+		}
+		filter.MediaID = &mediaID
+	}
+	if req.GetStatus() != librarypb.WorkflowStatus_WORKFLOW_STATUS_UNSPECIFIED {
+		for wfStatus, protoStatus := range workflowStatusToProto {
+			if protoStatus == req.GetStatus() {
+				filter.Status = &wfStatus
+				break
+			}
+		}
+		if filter.Status == nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid workflow status")
+		}
+	}
+	if req.GetFinishedAfter() != nil {
+		after := req.GetFinishedAfter().AsTime()
+		filter.FinishedAfter = &after
+	}
+	if req.GetFinishedBefore() != nil {
+		before := req.GetFinishedBefore().AsTime()
+		filter.FinishedBefore = &before
+	}
+
+	limit := int(constants.DefaultPageSize)
+	offset := 0
+	if req.GetPagination() != nil {
+		if size := int(req.GetPagination().GetPageSize()); size > 0 {
+			limit = min(size, constants.MaxPageSize)
+		}
+		if req.GetPagination().GetPageToken() != "" && h.paginationEncoder != nil {
+			calculatedOffset, err := pagination.CalculateOffset(
+				h.paginationEncoder,
+				req.GetPagination().GetPageToken(),
+				0,
+			)
+			if err != nil {
+				return nil, status.Error(codes.InvalidArgument, "invalid page token")
+			}
+			offset = calculatedOffset
+		}
+	}
+
+	workflows, err := h.libraryService.ListWorkflowHistory(ctx, filter, limit, offset)
+	if err != nil {
+		h.logger.Error("Failed to list workflow history", interfaces.Error(err))
+		return nil, status.Error(codes.Internal, "failed to list workflow history")
+	}
+
+	resp := &librarypb.ListWorkflowHistoryResponse{
+		Workflows:  make([]*librarypb.Workflow, len(workflows)),
+		Pagination: &commonpb.PaginationResponse{TotalItems: int32(len(workflows))},
+	}
+	for i, wf := range workflows {
+		resp.Workflows[i] = convertWorkflowToProto(wf)
+	}
+
+	if h.paginationEncoder != nil && len(workflows) == limit {
+		token, err := pagination.GenerateNextPageToken(h.paginationEncoder, offset, limit, offset+limit+1)
+		if err != nil {
+			h.logger.Error("Failed to generate next page token", interfaces.Error(err))
+		} else {
+			resp.Pagination.NextPageToken = token
+		}
+	}
+
+	return resp, nil
+}
+
 // GetMetadata gets metadata for a media item.
 func (h *GRPCHandler) GetMetadata(
 	ctx context.Context,
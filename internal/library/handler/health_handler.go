@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
+)
+
+// ListComponentHealth lists the health of indexers and download clients.
+func (h *GRPCHandler) ListComponentHealth(
+	_ context.Context,
+	_ *librarypb.ListComponentHealthRequest,
+) (*librarypb.ListComponentHealthResponse, error) {
+	if h.health == nil {
+		return nil, status.Error(codes.Unimplemented, "component health is not enabled")
+	}
+
+	components := h.health.Status()
+	resp := &librarypb.ListComponentHealthResponse{
+		Components: make([]*librarypb.ComponentHealth, len(components)),
+	}
+	for i, health := range components {
+		resp.Components[i] = convertComponentHealthToProto(health)
+	}
+	return resp, nil
+}
+
+func convertComponentHealthToProto(health *domain.ComponentHealth) *librarypb.ComponentHealth {
+	proto := &librarypb.ComponentHealth{
+		Kind:                string(health.Kind),
+		Name:                health.Name,
+		Critical:            health.Critical,
+		Successes:           health.Successes,
+		Failures:            health.Failures,
+		SuccessRate:         health.SuccessRate(),
+		ConsecutiveFailures: int32(health.ConsecutiveFailures),
+		ResponseTime:        durationpb.New(health.ResponseTime),
+		LastError:           health.LastError,
+		Disabled:            health.Disabled(),
+	}
+	if health.LastSuccessAt != nil {
+		proto.LastSuccessAt = timestamppb.New(*health.LastSuccessAt)
+	}
+	if health.LastFailureAt != nil {
+		proto.LastFailureAt = timestamppb.New(*health.LastFailureAt)
+	}
+	if health.DisabledAt != nil {
+		proto.DisabledAt = timestamppb.New(*health.DisabledAt)
+		proto.RetestAt = timestamppb.New(health.RetestAt)
+	}
+	return proto
+}
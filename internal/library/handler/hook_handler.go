@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
+)
+
+const (
+	defaultHookRunLimit = 50
+	maxHookRunLimit     = 500
+)
+
+// ListHooks lists the configured hook scripts.
+func (h *GRPCHandler) ListHooks(
+	ctx context.Context,
+	req *librarypb.ListHooksRequest,
+) (*librarypb.ListHooksResponse, error) {
+	if h.hooks == nil {
+		return nil, status.Error(codes.Unimplemented, "hooks are not enabled")
+	}
+
+	hooks := h.hooks.Hooks()
+	resp := &librarypb.ListHooksResponse{
+		Hooks: make([]*librarypb.Hook, len(hooks)),
+	}
+	for i, hook := range hooks {
+		resp.Hooks[i] = convertHookToProto(hook)
+	}
+	return resp, nil
+}
+
+// SetHookEnabled enables or disables a hook script.
+func (h *GRPCHandler) SetHookEnabled(
+	ctx context.Context,
+	req *librarypb.SetHookEnabledRequest,
+) (*librarypb.SetHookEnabledResponse, error) {
+	if h.hooks == nil {
+		return nil, status.Error(codes.Unimplemented, "hooks are not enabled")
+	}
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "hook name is required")
+	}
+
+	hook, err := h.hooks.SetEnabled(ctx, req.GetName(), req.GetEnabled())
+	if err != nil {
+		return nil, h.hookError(err)
+	}
+	return &librarypb.SetHookEnabledResponse{Hook: convertHookToProto(hook)}, nil
+}
+
+// ListHookRuns lists the most recent runs of hook scripts with their
+// captured output.
+func (h *GRPCHandler) ListHookRuns(
+	ctx context.Context,
+	req *librarypb.ListHookRunsRequest,
+) (*librarypb.ListHookRunsResponse, error) {
+	if h.hooks == nil {
+		return nil, status.Error(codes.Unimplemented, "hooks are not enabled")
+	}
+
+	limit := int(req.GetLimit())
+	if limit <= 0 {
+		limit = defaultHookRunLimit
+	} else if limit > maxHookRunLimit {
+		limit = maxHookRunLimit
+	}
+
+	runs, err := h.hooks.Runs(ctx, req.GetName(), limit)
+	if err != nil {
+		return nil, h.hookError(err)
+	}
+
+	resp := &librarypb.ListHookRunsResponse{
+		Runs: make([]*librarypb.HookRun, len(runs)),
+	}
+	for i, run := range runs {
+		resp.Runs[i] = convertHookRunToProto(run)
+	}
+	return resp, nil
+}
+
+func (h *GRPCHandler) hookError(err error) error {
+	if errors.IsNotFound(err) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	h.logger.Error("Hook request failed", interfaces.Error(err))
+	return status.Error(codes.Internal, "failed to process hook request")
+}
+
+func convertHookToProto(hook *domain.Hook) *librarypb.Hook {
+	proto := &librarypb.Hook{
+		Name:           hook.Name,
+		Point:          string(hook.Point),
+		Command:        hook.Command,
+		Args:           hook.Args,
+		MaxMemoryBytes: hook.MaxMemory,
+		Enabled:        hook.Enabled,
+	}
+	if hook.Timeout > 0 {
+		proto.Timeout = durationpb.New(hook.Timeout)
+	}
+	if hook.MaxCPU > 0 {
+		proto.MaxCpu = durationpb.New(hook.MaxCPU)
+	}
+	return proto
+}
+
+func convertHookRunToProto(run *domain.HookRun) *librarypb.HookRun {
+	return &librarypb.HookRun{
+		Id:        run.ID.String(),
+		Hook:      run.Hook,
+		Point:     string(run.Point),
+		EventType: run.EventType,
+		EntityId:  run.EntityID,
+		ExitCode:  int32(run.ExitCode),
+		TimedOut:  run.TimedOut,
+		Output:    run.Output,
+		Error:     run.Error,
+		StartedAt: timestamppb.New(run.StartedAt),
+		Duration:  durationpb.New(run.Duration),
+	}
+}
@@ -0,0 +1,312 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/internal/library/service"
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
+)
+
+// KioskEventsPath is the path displays watch for changes at.
+const KioskEventsPath = "/kiosk/events"
+
+// kioskKeepAlive is how often idle event streams send a comment, so
+// proxies do not close them.
+const kioskKeepAlive = 30 * time.Second
+
+// CreateKiosk creates a kiosk for a lobby display or dashboard.
+func (h *GRPCHandler) CreateKiosk(
+	ctx context.Context,
+	req *librarypb.CreateKioskRequest,
+) (*librarypb.CreateKioskResponse, error) {
+	adminID, err := h.kioskAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	libraryIDs := make([]uuid.UUID, len(req.GetLibraryIds()))
+	for i, id := range req.GetLibraryIds() {
+		libraryIDs[i], err = uuid.Parse(id)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid library ID")
+		}
+	}
+
+	kiosk, key, err := h.kiosks.Create(ctx, adminID, req.GetName(), libraryIDs)
+	if err != nil {
+		return nil, kioskError(h.logger, err)
+	}
+	return &librarypb.CreateKioskResponse{Kiosk: convertKioskToProto(kiosk), Key: key}, nil
+}
+
+// ListKiosks lists the kiosks, newest first.
+func (h *GRPCHandler) ListKiosks(
+	ctx context.Context,
+	_ *librarypb.ListKiosksRequest,
+) (*librarypb.ListKiosksResponse, error) {
+	if _, err := h.kioskAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	kiosks, err := h.kiosks.List(ctx)
+	if err != nil {
+		return nil, kioskError(h.logger, err)
+	}
+	resp := &librarypb.ListKiosksResponse{Kiosks: make([]*librarypb.Kiosk, len(kiosks))}
+	for i, kiosk := range kiosks {
+		resp.Kiosks[i] = convertKioskToProto(kiosk)
+	}
+	return resp, nil
+}
+
+// RevokeKiosk revokes a kiosk.
+func (h *GRPCHandler) RevokeKiosk(
+	ctx context.Context,
+	req *librarypb.RevokeKioskRequest,
+) (*librarypb.RevokeKioskResponse, error) {
+	adminID, err := h.kioskAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid kiosk ID")
+	}
+
+	kiosk, err := h.kiosks.Revoke(ctx, adminID, id)
+	if err != nil {
+		return nil, kioskError(h.logger, err)
+	}
+	return &librarypb.RevokeKioskResponse{Kiosk: convertKioskToProto(kiosk)}, nil
+}
+
+// kioskAdmin returns the admin calling a kiosk RPC.
+func (h *GRPCHandler) kioskAdmin(ctx context.Context) (uuid.UUID, error) {
+	if h.kiosks == nil {
+		return uuid.Nil, status.Error(codes.Unimplemented, "kiosks are not enabled")
+	}
+	id, _ := auth.GetUserIDFromContext(ctx)
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, status.Error(codes.Unauthenticated, "user not authenticated")
+	}
+	return userID, nil
+}
+
+// KioskHandler implements the KioskService gRPC server, the read-only
+// surface of kiosk and display clients.
+type KioskHandler struct {
+	librarypb.UnimplementedKioskServiceServer
+
+	kiosks *service.KioskService
+	logger interfaces.Logger
+}
+
+// NewKioskHandler creates the kiosk gRPC handler.
+func NewKioskHandler(kiosks *service.KioskService, logger interfaces.Logger) *KioskHandler {
+	return &KioskHandler{kiosks: kiosks, logger: logger}
+}
+
+// RedeemKioskKey exchanges the key of a kiosk for a kiosk token. It is
+// callable without a token.
+func (h *KioskHandler) RedeemKioskKey(
+	ctx context.Context,
+	req *librarypb.RedeemKioskKeyRequest,
+) (*librarypb.RedeemKioskKeyResponse, error) {
+	token, expiresAt, err := h.kiosks.Redeem(ctx, req.GetKey())
+	if err != nil {
+		return nil, kioskError(h.logger, err)
+	}
+	return &librarypb.RedeemKioskKeyResponse{Token: token, ExpiresAt: timestamppb.New(expiresAt)}, nil
+}
+
+// GetDisplay returns what the calling kiosk shows.
+func (h *KioskHandler) GetDisplay(
+	ctx context.Context,
+	_ *librarypb.GetDisplayRequest,
+) (*librarypb.GetDisplayResponse, error) {
+	claims, _ := auth.GetClaimsFromContext(ctx)
+	kiosk, err := h.kiosks.Authorize(ctx, claims)
+	if err != nil {
+		return nil, kioskError(h.logger, err)
+	}
+
+	snapshot, err := h.kiosks.Display(ctx, kiosk)
+	if err != nil {
+		return nil, kioskError(h.logger, err)
+	}
+	return convertDisplayToProto(snapshot), nil
+}
+
+// KioskTokenValidator validates the tokens of display clients.
+type KioskTokenValidator interface {
+	ValidateAccessToken(token string) (*auth.CustomClaims, error)
+}
+
+// KioskEvents streams the display of a kiosk as server-sent events, so
+// displays are pushed changes instead of polling. Requests carry a kiosk
+// token in the Authorization header, or in the token query parameter for
+// EventSource clients, which cannot set headers. Each event is a display
+// snapshot in JSON; the stream ends when the token expires or the kiosk
+// is revoked, and clients reconnect with a new token.
+type KioskEvents struct {
+	kiosks    *service.KioskService
+	validator KioskTokenValidator
+	logger    interfaces.Logger
+}
+
+// NewKioskEvents creates the display event stream.
+func NewKioskEvents(
+	kiosks *service.KioskService,
+	validator KioskTokenValidator,
+	logger interfaces.Logger,
+) *KioskEvents {
+	return &KioskEvents{
+		kiosks:    kiosks,
+		validator: validator,
+		logger:    logger,
+	}
+}
+
+// ServeHTTP streams display snapshots until the client goes away, the
+// token expires or the kiosk is revoked.
+func (e *KioskEvents) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	claims, err := e.validator.ValidateAccessToken(token)
+	if err != nil {
+		http.Error(w, "invalid kiosk token", http.StatusUnauthorized)
+		return
+	}
+	kiosk, err := e.kiosks.Authorize(r.Context(), claims)
+	if err != nil {
+		if errors.IsForbidden(err) || errors.IsNotFound(err) {
+			http.Error(w, "kiosk token not allowed", http.StatusForbidden)
+			return
+		}
+		e.logger.Error("Failed to authorize kiosk", interfaces.Error(err))
+		http.Error(w, "failed to authorize kiosk", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithDeadline(r.Context(), claims.ExpiresAt.Time)
+	defer cancel()
+	snapshots, err := e.kiosks.Watch(ctx, kiosk)
+	if err != nil {
+		e.logger.Error("Failed to watch kiosk display",
+			interfaces.String("kiosk_id", kiosk.ID.String()),
+			interfaces.Error(err))
+		http.Error(w, "failed to watch display", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(kioskKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case snapshot, ok := <-snapshots:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(snapshot)
+			if err != nil {
+				e.logger.Error("Failed to encode kiosk display", interfaces.Error(err))
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: display\ndata: %s\n\n", data); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func kioskError(logger interfaces.Logger, err error) error {
+	switch {
+	case errors.IsNotFound(err):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.IsBadRequest(err):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.IsForbidden(err):
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	logger.Error("Kiosk request failed", interfaces.Error(err))
+	return status.Error(codes.Internal, "failed to process kiosk request")
+}
+
+func convertKioskToProto(kiosk *domain.Kiosk) *librarypb.Kiosk {
+	proto := &librarypb.Kiosk{
+		Id:         kiosk.ID.String(),
+		Name:       kiosk.Name,
+		LibraryIds: make([]string, len(kiosk.LibraryIDs)),
+		CreatedBy:  kiosk.CreatedBy.String(),
+		CreatedAt:  timestamppb.New(kiosk.CreatedAt),
+	}
+	for i, id := range kiosk.LibraryIDs {
+		proto.LibraryIds[i] = id.String()
+	}
+	if kiosk.RevokedAt != nil {
+		proto.RevokedAt = timestamppb.New(*kiosk.RevokedAt)
+	}
+	return proto
+}
+
+func convertDisplayToProto(snapshot *domain.DisplaySnapshot) *librarypb.GetDisplayResponse {
+	resp := &librarypb.GetDisplayResponse{
+		NowPlaying:    make([]*librarypb.DisplayItem, len(snapshot.NowPlaying)),
+		RecentlyAdded: make([]*librarypb.DisplayItem, len(snapshot.RecentlyAdded)),
+	}
+	for i, item := range snapshot.NowPlaying {
+		resp.NowPlaying[i] = convertDisplayItemToProto(item)
+	}
+	for i, item := range snapshot.RecentlyAdded {
+		resp.RecentlyAdded[i] = convertDisplayItemToProto(item)
+	}
+	return resp
+}
+
+func convertDisplayItemToProto(item domain.DisplayItem) *librarypb.DisplayItem {
+	return &librarypb.DisplayItem{
+		MediaId:  item.MediaID.String(),
+		Title:    item.Title,
+		Year:     int32(item.Year),
+		Type:     convertMediaTypeToProtoFromMediaType(item.MediaType),
+		Progress: item.Progress,
+		At:       timestamppb.New(item.At),
+	}
+}
@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/internal/library/constants"
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	commonpb "github.com/narwhalmedia/narwhal/pkg/common/v1"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
+	"github.com/narwhalmedia/narwhal/pkg/pagination"
+)
+
+var manualImportStatusToProto = map[domain.ManualImportStatus]librarypb.ManualImportStatus{
+	domain.ManualImportPending:  librarypb.ManualImportStatus_MANUAL_IMPORT_STATUS_PENDING,
+	domain.ManualImportImported: librarypb.ManualImportStatus_MANUAL_IMPORT_STATUS_IMPORTED,
+	domain.ManualImportRejected: librarypb.ManualImportStatus_MANUAL_IMPORT_STATUS_REJECTED,
+}
+
+// ListManualImports lists completed downloads parked for manual matching.
+func (h *GRPCHandler) ListManualImports(
+	ctx context.Context,
+	req *librarypb.ListManualImportsRequest,
+) (*librarypb.ListManualImportsResponse, error) {
+	var filter *domain.ManualImportStatus
+	if req.GetStatus() != librarypb.ManualImportStatus_MANUAL_IMPORT_STATUS_UNSPECIFIED {
+		for miStatus, protoStatus := range manualImportStatusToProto {
+			if protoStatus == req.GetStatus() {
+				filter = &miStatus
+				break
+			}
+		}
+		if filter == nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid manual import status")
+		}
+	}
+
+	limit := int(constants.DefaultPageSize)
+	offset := 0
+	if req.GetPagination() != nil {
+		if size := int(req.GetPagination().GetPageSize()); size > 0 {
+			limit = min(size, constants.MaxPageSize)
+		}
+		if req.GetPagination().GetPageToken() != "" && h.paginationEncoder != nil {
+			calculatedOffset, err := pagination.CalculateOffset(
+				h.paginationEncoder,
+				req.GetPagination().GetPageToken(),
+				0,
+			)
+			if err != nil {
+				return nil, status.Error(codes.InvalidArgument, "invalid page token")
+			}
+			offset = calculatedOffset
+		}
+	}
+
+	imports, total, err := h.libraryService.ListManualImports(ctx, filter, limit, offset)
+	if err != nil {
+		h.logger.Error("Failed to list manual imports", interfaces.Error(err))
+		return nil, status.Error(codes.Internal, "failed to list manual imports")
+	}
+
+	resp := &librarypb.ListManualImportsResponse{
+		Imports:    make([]*librarypb.ManualImport, len(imports)),
+		Pagination: &commonpb.PaginationResponse{TotalItems: int32(total)},
+	}
+	for i, mi := range imports {
+		resp.Imports[i] = convertManualImportToProto(mi)
+	}
+
+	if h.paginationEncoder != nil && int64(offset+len(imports)) < total {
+		token, err := pagination.GenerateNextPageToken(h.paginationEncoder, offset, limit, int(total))
+		if err != nil {
+			h.logger.Error("Failed to generate next page token", interfaces.Error(err))
+		} else {
+			resp.Pagination.NextPageToken = token
+		}
+	}
+
+	return resp, nil
+}
+
+// ResolveManualImport imports a parked download into a library item, as a
+// new item, or rejects it.
+func (h *GRPCHandler) ResolveManualImport(
+	ctx context.Context,
+	req *librarypb.ResolveManualImportRequest,
+) (*librarypb.ResolveManualImportResponse, error) {
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid manual import ID")
+	}
+
+	var mi *domain.ManualImport
+	switch resolution := req.GetResolution().(type) {
+	case *librarypb.ResolveManualImportRequest_MediaId:
+		mediaID, parseErr := uuid.Parse(resolution.MediaId)
+		if parseErr != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid media ID")
+		}
+		mi, err = h.libraryService.ResolveManualImport(ctx, id, &mediaID)
+	case *librarypb.ResolveManualImportRequest_ImportAsNew:
+		mi, err = h.libraryService.ResolveManualImport(ctx, id, nil)
+	case *librarypb.ResolveManualImportRequest_Reject:
+		mi, err = h.libraryService.RejectManualImport(ctx, id)
+	default:
+		return nil, status.Error(codes.InvalidArgument, "a media ID, import as new or reject is required")
+	}
+	if err != nil {
+		switch {
+		case errors.IsNotFound(err):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.IsBadRequest(err):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.IsConflict(err):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		h.logger.Error("Failed to resolve manual import", interfaces.Error(err))
+		return nil, status.Error(codes.Internal, "failed to resolve manual import")
+	}
+
+	return &librarypb.ResolveManualImportResponse{ManualImport: convertManualImportToProto(mi)}, nil
+}
+
+func convertManualImportToProto(mi *domain.ManualImport) *librarypb.ManualImport {
+	proto := &librarypb.ManualImport{
+		Id:             mi.ID.String(),
+		LibraryId:      mi.LibraryID.String(),
+		WorkflowId:     mi.WorkflowID.String(),
+		Path:           mi.Path,
+		DownloadClient: mi.DownloadClient,
+		ReleaseTitle:   mi.Release.Title,
+		Title:          mi.Title,
+		Year:           int32(mi.Year),
+		Candidates:     make([]*librarypb.ImportCandidate, len(mi.Candidates)),
+		Status:         manualImportStatusToProto[mi.Status],
+		CreatedAt:      timestamppb.New(mi.CreatedAt),
+	}
+	for i, candidate := range mi.Candidates {
+		proto.Candidates[i] = &librarypb.ImportCandidate{
+			MediaId: candidate.MediaID.String(),
+			Title:   candidate.Title,
+			Year:    int32(candidate.Year),
+			Score:   candidate.Score,
+		}
+	}
+	if mi.ImportedMediaID != nil {
+		proto.ImportedMediaId = mi.ImportedMediaID.String()
+	}
+	if mi.ResolvedAt != nil {
+		proto.ResolvedAt = timestamppb.New(*mi.ResolvedAt)
+	}
+	if mi.Replacement != nil {
+		proto.Replacement = convertFileComparisonToProto(mi.Replacement)
+	}
+	return proto
+}
+
+func convertFileComparisonToProto(c *domain.FileComparison) *librarypb.FileComparison {
+	return &librarypb.FileComparison{
+		Existing:   convertFilePropertiesToProto(c.Existing),
+		Candidate:  convertFilePropertiesToProto(c.Candidate),
+		Resolution: int32(c.Resolution),
+		Codec:      int32(c.Codec),
+		Bitrate:    int32(c.Bitrate),
+		SizeRatio:  c.SizeRatio,
+		ScoreGain:  int32(c.ScoreGain),
+		Replace:    c.Replace,
+		Reason:     c.Reason,
+	}
+}
+
+func convertFilePropertiesToProto(file domain.FileProperties) *librarypb.MediaFileProperties {
+	return &librarypb.MediaFileProperties{
+		Path:    file.Path,
+		Size:    file.Size,
+		Quality: file.Quality,
+		Codec:   file.Codec,
+		Bitrate: int32(file.Bitrate),
+	}
+}
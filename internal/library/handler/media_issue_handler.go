@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
+)
+
+// ReportMediaIssue reports a problem with a media item for the caller.
+func (h *GRPCHandler) ReportMediaIssue(
+	ctx context.Context,
+	req *librarypb.ReportMediaIssueRequest,
+) (*librarypb.ReportMediaIssueResponse, error) {
+	userID, err := h.mediaIssueUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mediaID, err := uuid.Parse(req.GetMediaId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid media ID")
+	}
+	issue := &domain.MediaIssue{
+		MediaID:  mediaID,
+		UserID:   userID,
+		Category: convertIssueCategoryFromProto(req.GetCategory()),
+		Comment:  req.GetComment(),
+	}
+	if req.GetEpisodeId() != "" {
+		episodeID, err := uuid.Parse(req.GetEpisodeId())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid episode ID")
+		}
+		issue.EpisodeID = &episodeID
+	}
+
+	issue, err = h.issues.Report(ctx, issue)
+	if err != nil {
+		return nil, h.mediaIssueError(err)
+	}
+	return &librarypb.ReportMediaIssueResponse{Issue: convertMediaIssueToProto(issue)}, nil
+}
+
+// ListMediaIssues lists the caller's media issues, or every user's for
+// admins, newest first.
+func (h *GRPCHandler) ListMediaIssues(
+	ctx context.Context,
+	req *librarypb.ListMediaIssuesRequest,
+) (*librarypb.ListMediaIssuesResponse, error) {
+	userID, err := h.mediaIssueUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	limit, offset, err := h.shareLinkPage(req.GetPagination())
+	if err != nil {
+		return nil, err
+	}
+	filter := domain.MediaIssueFilter{Status: convertIssueStatusFromProto(req.GetStatus())}
+	if req.GetMediaId() != "" {
+		mediaID, err := uuid.Parse(req.GetMediaId())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid media ID")
+		}
+		filter.MediaID = &mediaID
+	}
+
+	issues, total, err := h.issues.List(ctx, userID, auth.IsAdmin(ctx), filter, limit, offset)
+	if err != nil {
+		return nil, h.mediaIssueError(err)
+	}
+
+	resp := &librarypb.ListMediaIssuesResponse{
+		Issues:     make([]*librarypb.MediaIssue, len(issues)),
+		Pagination: h.shareLinkNextPage(offset, limit, len(issues), total),
+	}
+	for i, issue := range issues {
+		resp.Issues[i] = convertMediaIssueToProto(issue)
+	}
+	return resp, nil
+}
+
+// ResolveMediaIssue resolves an open media issue, acting on its media.
+func (h *GRPCHandler) ResolveMediaIssue(
+	ctx context.Context,
+	req *librarypb.ResolveMediaIssueRequest,
+) (*librarypb.ResolveMediaIssueResponse, error) {
+	adminID, err := h.mediaIssueUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid media issue ID")
+	}
+
+	issue, err := h.issues.Resolve(ctx, adminID, id, convertIssueActionFromProto(req.GetAction()), req.GetResolution())
+	if err != nil {
+		return nil, h.mediaIssueError(err)
+	}
+	return &librarypb.ResolveMediaIssueResponse{Issue: convertMediaIssueToProto(issue)}, nil
+}
+
+// mediaIssueUser returns the caller of a media issue RPC.
+func (h *GRPCHandler) mediaIssueUser(ctx context.Context) (uuid.UUID, error) {
+	if h.issues == nil {
+		return uuid.Nil, status.Error(codes.Unimplemented, "media issues are not enabled")
+	}
+	id, _ := auth.GetUserIDFromContext(ctx)
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, status.Error(codes.Unauthenticated, "user not authenticated")
+	}
+	return userID, nil
+}
+
+func (h *GRPCHandler) mediaIssueError(err error) error {
+	switch {
+	case errors.IsNotFound(err):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.IsBadRequest(err):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.IsConflict(err):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	h.logger.Error("Media issue failed", interfaces.Error(err))
+	return status.Error(codes.Internal, "failed to process media issue")
+}
+
+func convertIssueCategoryFromProto(c librarypb.MediaIssueCategory) domain.IssueCategory {
+	switch c {
+	case librarypb.MediaIssueCategory_MEDIA_ISSUE_CATEGORY_WRONG_AUDIO:
+		return domain.IssueWrongAudio
+	case librarypb.MediaIssueCategory_MEDIA_ISSUE_CATEGORY_BAD_QUALITY:
+		return domain.IssueBadQuality
+	case librarypb.MediaIssueCategory_MEDIA_ISSUE_CATEGORY_MISSING_SUBTITLES:
+		return domain.IssueMissingSubtitles
+	case librarypb.MediaIssueCategory_MEDIA_ISSUE_CATEGORY_WRONG_METADATA:
+		return domain.IssueWrongMetadata
+	case librarypb.MediaIssueCategory_MEDIA_ISSUE_CATEGORY_OTHER:
+		return domain.IssueOther
+	}
+	return ""
+}
+
+func convertIssueCategoryToProto(c domain.IssueCategory) librarypb.MediaIssueCategory {
+	switch c {
+	case domain.IssueWrongAudio:
+		return librarypb.MediaIssueCategory_MEDIA_ISSUE_CATEGORY_WRONG_AUDIO
+	case domain.IssueBadQuality:
+		return librarypb.MediaIssueCategory_MEDIA_ISSUE_CATEGORY_BAD_QUALITY
+	case domain.IssueMissingSubtitles:
+		return librarypb.MediaIssueCategory_MEDIA_ISSUE_CATEGORY_MISSING_SUBTITLES
+	case domain.IssueWrongMetadata:
+		return librarypb.MediaIssueCategory_MEDIA_ISSUE_CATEGORY_WRONG_METADATA
+	case domain.IssueOther:
+		return librarypb.MediaIssueCategory_MEDIA_ISSUE_CATEGORY_OTHER
+	}
+	return librarypb.MediaIssueCategory_MEDIA_ISSUE_CATEGORY_UNSPECIFIED
+}
+
+func convertIssueStatusFromProto(st librarypb.MediaIssueStatus) domain.IssueStatus {
+	switch st {
+	case librarypb.MediaIssueStatus_MEDIA_ISSUE_STATUS_OPEN:
+		return domain.IssueOpen
+	case librarypb.MediaIssueStatus_MEDIA_ISSUE_STATUS_RESOLVED:
+		return domain.IssueResolved
+	}
+	return ""
+}
+
+func convertIssueStatusToProto(st domain.IssueStatus) librarypb.MediaIssueStatus {
+	switch st {
+	case domain.IssueOpen:
+		return librarypb.MediaIssueStatus_MEDIA_ISSUE_STATUS_OPEN
+	case domain.IssueResolved:
+		return librarypb.MediaIssueStatus_MEDIA_ISSUE_STATUS_RESOLVED
+	}
+	return librarypb.MediaIssueStatus_MEDIA_ISSUE_STATUS_UNSPECIFIED
+}
+
+func convertIssueActionFromProto(a librarypb.MediaIssueAction) domain.IssueAction {
+	switch a {
+	case librarypb.MediaIssueAction_MEDIA_ISSUE_ACTION_REDOWNLOAD:
+		return domain.IssueActionRedownload
+	case librarypb.MediaIssueAction_MEDIA_ISSUE_ACTION_RETRANSCODE:
+		return domain.IssueActionRetranscode
+	case librarypb.MediaIssueAction_MEDIA_ISSUE_ACTION_REFRESH_METADATA:
+		return domain.IssueActionRefreshMetadata
+	}
+	return domain.IssueActionNone
+}
+
+func convertIssueActionToProto(a domain.IssueAction) librarypb.MediaIssueAction {
+	switch a {
+	case domain.IssueActionRedownload:
+		return librarypb.MediaIssueAction_MEDIA_ISSUE_ACTION_REDOWNLOAD
+	case domain.IssueActionRetranscode:
+		return librarypb.MediaIssueAction_MEDIA_ISSUE_ACTION_RETRANSCODE
+	case domain.IssueActionRefreshMetadata:
+		return librarypb.MediaIssueAction_MEDIA_ISSUE_ACTION_REFRESH_METADATA
+	}
+	return librarypb.MediaIssueAction_MEDIA_ISSUE_ACTION_UNSPECIFIED
+}
+
+func convertMediaIssueToProto(issue *domain.MediaIssue) *librarypb.MediaIssue {
+	proto := &librarypb.MediaIssue{
+		Id:         issue.ID.String(),
+		MediaId:    issue.MediaID.String(),
+		UserId:     issue.UserID.String(),
+		Category:   convertIssueCategoryToProto(issue.Category),
+		Comment:    issue.Comment,
+		Status:     convertIssueStatusToProto(issue.Status),
+		Action:     convertIssueActionToProto(issue.Action),
+		Resolution: issue.Resolution,
+		CreatedAt:  timestamppb.New(issue.CreatedAt),
+	}
+	if issue.EpisodeID != nil {
+		proto.EpisodeId = issue.EpisodeID.String()
+	}
+	if issue.ResolvedBy != nil {
+		proto.ResolvedBy = issue.ResolvedBy.String()
+	}
+	if issue.ResolvedAt != nil {
+		proto.ResolvedAt = timestamppb.New(*issue.ResolvedAt)
+	}
+	return proto
+}
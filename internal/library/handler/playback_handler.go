@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/internal/library/constants"
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	commonpb "github.com/narwhalmedia/narwhal/pkg/common/v1"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
+	"github.com/narwhalmedia/narwhal/pkg/pagination"
+)
+
+// ReportPlaybackIssue records a stall, decode error or bitrate switch a
+// client ran into while playing media.
+func (h *GRPCHandler) ReportPlaybackIssue(
+	ctx context.Context,
+	req *librarypb.ReportPlaybackIssueRequest,
+) (*librarypb.ReportPlaybackIssueResponse, error) {
+	if h.playback == nil {
+		return nil, status.Error(codes.Unimplemented, "playback issue reporting is not enabled")
+	}
+
+	mediaID, err := uuid.Parse(req.GetMediaId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid media ID")
+	}
+	kind, err := domain.ParsePlaybackIssueKind(req.GetKind())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	userID, _ := auth.GetUserIDFromContext(ctx)
+
+	issue := &domain.PlaybackIssue{
+		MediaID:       mediaID,
+		UserID:        userID,
+		SessionID:     req.GetSessionId(),
+		Kind:          kind,
+		Position:      req.GetPosition().AsDuration(),
+		StallDuration: req.GetStallDuration().AsDuration(),
+		FromBitrate:   req.GetFromBitrate(),
+		ToBitrate:     req.GetToBitrate(),
+		Error:         req.GetError(),
+		Client:        req.GetClient(),
+	}
+	if err := h.playback.ReportIssue(ctx, issue); err != nil {
+		return nil, h.playbackError(err)
+	}
+	return &librarypb.ReportPlaybackIssueResponse{}, nil
+}
+
+// ListPlaybackIssueStats lists the playback issues reported per media,
+// highest error rate first.
+func (h *GRPCHandler) ListPlaybackIssueStats(
+	ctx context.Context,
+	req *librarypb.ListPlaybackIssueStatsRequest,
+) (*librarypb.ListPlaybackIssueStatsResponse, error) {
+	if h.playback == nil {
+		return nil, status.Error(codes.Unimplemented, "playback issue reporting is not enabled")
+	}
+
+	var libraryID *uuid.UUID
+	if req.GetLibraryId() != "" {
+		id, err := uuid.Parse(req.GetLibraryId())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid library ID")
+		}
+		libraryID = &id
+	}
+
+	limit := int(constants.DefaultPageSize)
+	offset := 0
+	if req.GetPagination() != nil {
+		if size := int(req.GetPagination().GetPageSize()); size > 0 {
+			limit = min(size, constants.MaxPageSize)
+		}
+		if req.GetPagination().GetPageToken() != "" && h.paginationEncoder != nil {
+			calculatedOffset, err := pagination.CalculateOffset(
+				h.paginationEncoder,
+				req.GetPagination().GetPageToken(),
+				0,
+			)
+			if err != nil {
+				return nil, status.Error(codes.InvalidArgument, "invalid page token")
+			}
+			offset = calculatedOffset
+		}
+	}
+
+	stats, total, err := h.playback.ListIssueStats(ctx, libraryID, req.GetFlaggedOnly(), limit, offset)
+	if err != nil {
+		return nil, h.playbackError(err)
+	}
+
+	resp := &librarypb.ListPlaybackIssueStatsResponse{
+		Stats:      make([]*librarypb.PlaybackIssueStats, len(stats)),
+		Pagination: &commonpb.PaginationResponse{TotalItems: int32(total)},
+	}
+	for i, s := range stats {
+		resp.Stats[i] = convertPlaybackIssueStatsToProto(s)
+	}
+
+	if h.paginationEncoder != nil && int64(offset+len(stats)) < total {
+		token, err := pagination.GenerateNextPageToken(h.paginationEncoder, offset, limit, int(total))
+		if err != nil {
+			h.logger.Error("Failed to generate next page token", interfaces.Error(err))
+		} else {
+			resp.Pagination.NextPageToken = token
+		}
+	}
+
+	return resp, nil
+}
+
+// ClearPlaybackIssues removes the flag of media and the issues reported
+// for it.
+func (h *GRPCHandler) ClearPlaybackIssues(
+	ctx context.Context,
+	req *librarypb.ClearPlaybackIssuesRequest,
+) (*librarypb.ClearPlaybackIssuesResponse, error) {
+	if h.playback == nil {
+		return nil, status.Error(codes.Unimplemented, "playback issue reporting is not enabled")
+	}
+
+	mediaID, err := uuid.Parse(req.GetMediaId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid media ID")
+	}
+	if err := h.playback.ClearIssues(ctx, mediaID); err != nil {
+		return nil, h.playbackError(err)
+	}
+	return &librarypb.ClearPlaybackIssuesResponse{}, nil
+}
+
+func (h *GRPCHandler) playbackError(err error) error {
+	switch {
+	case errors.IsNotFound(err):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.IsBadRequest(err):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	h.logger.Error("Playback issue request failed", interfaces.Error(err))
+	return status.Error(codes.Internal, "failed to process playback issue request")
+}
+
+func convertPlaybackIssueStatsToProto(stats *domain.PlaybackIssueStats) *librarypb.PlaybackIssueStats {
+	proto := &librarypb.PlaybackIssueStats{
+		MediaId:         stats.MediaID.String(),
+		Sessions:        stats.Sessions,
+		ErrorSessions:   stats.ErrorSessions,
+		ErrorRate:       stats.ErrorRate(),
+		Stalls:          stats.Stalls,
+		StallTime:       durationpb.New(stats.StallTime),
+		DecodeErrors:    stats.DecodeErrors,
+		BitrateSwitches: stats.BitrateSwitches,
+		LastReportedAt:  timestamppb.New(stats.LastReportedAt),
+	}
+	if stats.Flag != nil {
+		proto.Flagged = true
+		proto.FlagReason = string(stats.Flag.Reason)
+		proto.FlaggedAt = timestamppb.New(stats.Flag.FlaggedAt)
+	}
+	return proto
+}
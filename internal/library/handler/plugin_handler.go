@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
+	"github.com/narwhalmedia/narwhal/pkg/plugin"
+)
+
+// ListPlugins lists the sidecar plugins with their state and the
+// capabilities negotiated with them.
+func (h *GRPCHandler) ListPlugins(
+	ctx context.Context,
+	req *librarypb.ListPluginsRequest,
+) (*librarypb.ListPluginsResponse, error) {
+	if h.plugins == nil {
+		return nil, status.Error(codes.Unimplemented, "plugins are not enabled")
+	}
+
+	statuses := h.plugins.Plugins()
+	resp := &librarypb.ListPluginsResponse{
+		Plugins: make([]*librarypb.Plugin, len(statuses)),
+	}
+	for i, s := range statuses {
+		resp.Plugins[i] = convertPluginToProto(s)
+	}
+	return resp, nil
+}
+
+func convertPluginToProto(s plugin.Status) *librarypb.Plugin {
+	proto := &librarypb.Plugin{
+		Name:            s.Name,
+		Command:         s.Command,
+		Version:         s.Info.Version,
+		ProtocolVersion: s.Info.ProtocolVersion,
+		State:           string(s.State),
+		Error:           s.Error,
+		Capabilities:    make([]*librarypb.PluginCapability, len(s.Capabilities)),
+	}
+	if !s.StartedAt.IsZero() {
+		proto.StartedAt = timestamppb.New(s.StartedAt)
+	}
+	for i, capability := range s.Capabilities {
+		proto.Capabilities[i] = &librarypb.PluginCapability{
+			Kind:     string(capability.Kind),
+			Name:     capability.Name,
+			Features: capability.Features,
+		}
+	}
+	return proto
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
+)
+
+// ListPruneCandidates ranks the titles worth deleting, with the space
+// deleting them frees.
+func (h *GRPCHandler) ListPruneCandidates(
+	ctx context.Context,
+	req *librarypb.ListPruneCandidatesRequest,
+) (*librarypb.ListPruneCandidatesResponse, error) {
+	var libraryID *uuid.UUID
+	if req.GetLibraryId() != "" {
+		id, err := uuid.Parse(req.GetLibraryId())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid library ID")
+		}
+		libraryID = &id
+	}
+
+	plan, err := h.libraryService.PlanPrune(ctx, libraryID)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, status.Error(codes.NotFound, "library not found")
+		}
+		h.logger.Error("Failed to plan pruning", interfaces.Error(err))
+		return nil, status.Error(codes.Internal, "failed to plan pruning")
+	}
+
+	resp := &librarypb.ListPruneCandidatesResponse{
+		Candidates:          make([]*librarypb.PruneCandidate, len(plan.Candidates)),
+		Savings:             plan.Savings,
+		PressuredLibraryIds: make([]string, len(plan.Pressured)),
+	}
+	for i, c := range plan.Candidates {
+		resp.Candidates[i] = convertPruneCandidateToProto(c)
+	}
+	for i, id := range plan.Pressured {
+		resp.PressuredLibraryIds[i] = id.String()
+	}
+	return resp, nil
+}
+
+// ApplyPrune starts a task deleting media and their files, or moving the
+// files to the recycle bin.
+func (h *GRPCHandler) ApplyPrune(
+	ctx context.Context,
+	req *librarypb.ApplyPruneRequest,
+) (*librarypb.ApplyPruneResponse, error) {
+	ids, err := parseMediaIDs(req.GetMediaIds())
+	if err != nil {
+		return nil, err
+	}
+
+	pruneTask, err := h.libraryService.ApplyPrune(ctx, ids, req.GetRecycle())
+	if err != nil {
+		switch {
+		case errors.IsNotFound(err):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.IsBadRequest(err):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.IsConflict(err):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		h.logger.Error("Failed to start pruning", interfaces.Error(err))
+		return nil, status.Errorf(codes.Internal, "failed to start pruning: %v", err)
+	}
+
+	return &librarypb.ApplyPruneResponse{TaskId: pruneTask.ID.String()}, nil
+}
+
+func convertPruneReasonToProto(reason domain.PruneReason) librarypb.PruneReason {
+	switch reason {
+	case domain.PruneUnwatched:
+		return librarypb.PruneReason_PRUNE_REASON_UNWATCHED
+	case domain.PruneDuplicate:
+		return librarypb.PruneReason_PRUNE_REASON_DUPLICATE
+	case domain.PruneSuperseded:
+		return librarypb.PruneReason_PRUNE_REASON_SUPERSEDED
+	}
+	return librarypb.PruneReason_PRUNE_REASON_UNSPECIFIED
+}
+
+func convertPruneCandidateToProto(c *domain.PruneCandidate) *librarypb.PruneCandidate {
+	proto := &librarypb.PruneCandidate{
+		MediaId:      c.MediaID.String(),
+		LibraryId:    c.LibraryID.String(),
+		Title:        c.Title,
+		Year:         int32(c.Year),
+		Type:         convertMediaTypeToProtoFromMediaType(c.MediaType),
+		Path:         c.Path,
+		Size:         c.Size,
+		Quality:      c.Quality,
+		Reasons:      make([]librarypb.PruneReason, len(c.Reasons)),
+		DiskPressure: c.DiskPressure,
+		Score:        c.Score,
+	}
+	for i, reason := range c.Reasons {
+		proto.Reasons[i] = convertPruneReasonToProto(reason)
+	}
+	if c.KeptID != nil {
+		proto.KeptMediaId = c.KeptID.String()
+	}
+	if c.LastViewedAt != nil {
+		proto.LastViewedAt = timestamppb.New(*c.LastViewedAt)
+	}
+	return proto
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
+)
+
+// RebuildSearchIndex starts a task reindexing all media for search.
+func (h *GRPCHandler) RebuildSearchIndex(
+	ctx context.Context,
+	_ *librarypb.RebuildSearchIndexRequest,
+) (*librarypb.RebuildSearchIndexResponse, error) {
+	if h.searchIndex == nil {
+		return nil, status.Error(codes.Unimplemented, "search index is not enabled")
+	}
+
+	rebuild, err := h.searchIndex.RebuildSearchIndex(ctx)
+	if err != nil {
+		if errors.IsConflict(err) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		h.logger.Error("Failed to start search index rebuild", interfaces.Error(err))
+		return nil, status.Error(codes.Internal, "failed to start search index rebuild")
+	}
+
+	return &librarypb.RebuildSearchIndexResponse{
+		TaskId: rebuild.ID.String(),
+	}, nil
+}
@@ -0,0 +1,260 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/internal/library/constants"
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/clientip"
+	commonpb "github.com/narwhalmedia/narwhal/pkg/common/v1"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
+	"github.com/narwhalmedia/narwhal/pkg/pagination"
+)
+
+// CreateShareLink creates a link that lets a guest stream a media item.
+func (h *GRPCHandler) CreateShareLink(
+	ctx context.Context,
+	req *librarypb.CreateShareLinkRequest,
+) (*librarypb.CreateShareLinkResponse, error) {
+	userID, err := h.shareLinkUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mediaID, err := uuid.Parse(req.GetMediaId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid media ID")
+	}
+
+	link, token, err := h.shares.Create(ctx, userID, mediaID,
+		req.GetTtl().AsDuration(), int(req.GetMaxViews()), int(req.GetMaxBitrate()))
+	if err != nil {
+		return nil, h.shareLinkError(err)
+	}
+	return &librarypb.CreateShareLinkResponse{Link: convertShareLinkToProto(link), Token: token}, nil
+}
+
+// ListShareLinks lists the caller's share links, or every user's for
+// admins, newest first.
+func (h *GRPCHandler) ListShareLinks(
+	ctx context.Context,
+	req *librarypb.ListShareLinksRequest,
+) (*librarypb.ListShareLinksResponse, error) {
+	userID, err := h.shareLinkUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var mediaID *uuid.UUID
+	if req.GetMediaId() != "" {
+		id, err := uuid.Parse(req.GetMediaId())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid media ID")
+		}
+		mediaID = &id
+	}
+	limit, offset, err := h.shareLinkPage(req.GetPagination())
+	if err != nil {
+		return nil, err
+	}
+
+	links, total, err := h.shares.List(ctx, userID, auth.IsAdmin(ctx), mediaID, limit, offset)
+	if err != nil {
+		return nil, h.shareLinkError(err)
+	}
+
+	resp := &librarypb.ListShareLinksResponse{
+		Links:      make([]*librarypb.ShareLink, len(links)),
+		Pagination: h.shareLinkNextPage(offset, limit, len(links), total),
+	}
+	for i, link := range links {
+		resp.Links[i] = convertShareLinkToProto(link)
+	}
+	return resp, nil
+}
+
+// RevokeShareLink revokes a share link.
+func (h *GRPCHandler) RevokeShareLink(
+	ctx context.Context,
+	req *librarypb.RevokeShareLinkRequest,
+) (*librarypb.RevokeShareLinkResponse, error) {
+	userID, err := h.shareLinkUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid share link ID")
+	}
+
+	link, err := h.shares.Revoke(ctx, userID, auth.IsAdmin(ctx), id)
+	if err != nil {
+		return nil, h.shareLinkError(err)
+	}
+	return &librarypb.RevokeShareLinkResponse{Link: convertShareLinkToProto(link)}, nil
+}
+
+// ListShareLinkPlays lists the plays of a share link, newest first.
+func (h *GRPCHandler) ListShareLinkPlays(
+	ctx context.Context,
+	req *librarypb.ListShareLinkPlaysRequest,
+) (*librarypb.ListShareLinkPlaysResponse, error) {
+	userID, err := h.shareLinkUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid share link ID")
+	}
+	limit, offset, err := h.shareLinkPage(req.GetPagination())
+	if err != nil {
+		return nil, err
+	}
+
+	plays, total, err := h.shares.ListPlays(ctx, userID, auth.IsAdmin(ctx), id, limit, offset)
+	if err != nil {
+		return nil, h.shareLinkError(err)
+	}
+
+	resp := &librarypb.ListShareLinkPlaysResponse{
+		Plays:      make([]*librarypb.ShareLinkPlay, len(plays)),
+		Pagination: h.shareLinkNextPage(offset, limit, len(plays), total),
+	}
+	for i, play := range plays {
+		resp.Plays[i] = &librarypb.ShareLinkPlay{
+			Id:        play.ID.String(),
+			IpAddress: play.IPAddress,
+			UserAgent: play.UserAgent,
+			PlayedAt:  timestamppb.New(play.PlayedAt),
+		}
+	}
+	return resp, nil
+}
+
+// RedeemShareLink plays a share link for a guest. It is callable without
+// a token.
+func (h *GRPCHandler) RedeemShareLink(
+	ctx context.Context,
+	req *librarypb.RedeemShareLinkRequest,
+) (*librarypb.RedeemShareLinkResponse, error) {
+	if h.shares == nil {
+		return nil, status.Error(codes.Unimplemented, "share links are not enabled")
+	}
+
+	var userAgent string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("user-agent"); len(values) > 0 {
+			userAgent = values[0]
+		}
+	}
+	grant, err := h.shares.Redeem(ctx, req.GetToken(), clientip.FromContext(ctx), userAgent)
+	if err != nil {
+		return nil, h.shareLinkError(err)
+	}
+	return &librarypb.RedeemShareLinkResponse{
+		MediaId:     grant.Link.MediaID.String(),
+		StreamToken: grant.StreamToken,
+		ExpiresAt:   timestamppb.New(grant.ExpiresAt),
+		MaxBitrate:  int32(grant.Link.MaxBitrate),
+	}, nil
+}
+
+// shareLinkUser returns the caller, who manages their share links.
+func (h *GRPCHandler) shareLinkUser(ctx context.Context) (uuid.UUID, error) {
+	if h.shares == nil {
+		return uuid.Nil, status.Error(codes.Unimplemented, "share links are not enabled")
+	}
+	id, _ := auth.GetUserIDFromContext(ctx)
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, status.Error(codes.Unauthenticated, "user not authenticated")
+	}
+	return userID, nil
+}
+
+// shareLinkPage returns the limit and offset of a page request.
+func (h *GRPCHandler) shareLinkPage(page *commonpb.PaginationRequest) (int, int, error) {
+	limit := int(constants.DefaultPageSize)
+	offset := 0
+	if page != nil {
+		if size := int(page.GetPageSize()); size > 0 {
+			limit = min(size, constants.MaxPageSize)
+		}
+		if page.GetPageToken() != "" && h.paginationEncoder != nil {
+			calculatedOffset, err := pagination.CalculateOffset(h.paginationEncoder, page.GetPageToken(), 0)
+			if err != nil {
+				return 0, 0, status.Error(codes.InvalidArgument, "invalid page token")
+			}
+			offset = calculatedOffset
+		}
+	}
+	return limit, offset, nil
+}
+
+// shareLinkNextPage returns the pagination of a page of count items.
+func (h *GRPCHandler) shareLinkNextPage(offset, limit, count int, total int64) *commonpb.PaginationResponse {
+	resp := &commonpb.PaginationResponse{TotalItems: int32(total)}
+	if h.paginationEncoder != nil && int64(offset+count) < total {
+		token, err := pagination.GenerateNextPageToken(h.paginationEncoder, offset, limit, int(total))
+		if err != nil {
+			h.logger.Error("Failed to generate next page token", interfaces.Error(err))
+		} else {
+			resp.NextPageToken = token
+		}
+	}
+	return resp
+}
+
+func (h *GRPCHandler) shareLinkError(err error) error {
+	switch {
+	case errors.IsNotFound(err):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.IsBadRequest(err):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.IsForbidden(err):
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	h.logger.Error("Share link request failed", interfaces.Error(err))
+	return status.Error(codes.Internal, "failed to process share link request")
+}
+
+func convertShareLinkStatusToProto(st domain.ShareLinkStatus) librarypb.ShareLinkStatus {
+	switch st {
+	case domain.ShareLinkActive:
+		return librarypb.ShareLinkStatus_SHARE_LINK_STATUS_ACTIVE
+	case domain.ShareLinkRevoked:
+		return librarypb.ShareLinkStatus_SHARE_LINK_STATUS_REVOKED
+	case domain.ShareLinkExpired:
+		return librarypb.ShareLinkStatus_SHARE_LINK_STATUS_EXPIRED
+	case domain.ShareLinkExhausted:
+		return librarypb.ShareLinkStatus_SHARE_LINK_STATUS_EXHAUSTED
+	}
+	return librarypb.ShareLinkStatus_SHARE_LINK_STATUS_UNSPECIFIED
+}
+
+func convertShareLinkToProto(link *domain.ShareLink) *librarypb.ShareLink {
+	proto := &librarypb.ShareLink{
+		Id:         link.ID.String(),
+		MediaId:    link.MediaID.String(),
+		CreatedBy:  link.CreatedBy.String(),
+		MaxBitrate: int32(link.MaxBitrate),
+		MaxViews:   int32(link.MaxViews),
+		Views:      int32(link.Views),
+		Status:     convertShareLinkStatusToProto(link.Status(time.Now())),
+		ExpiresAt:  timestamppb.New(link.ExpiresAt),
+		CreatedAt:  timestamppb.New(link.CreatedAt),
+	}
+	if link.RevokedAt != nil {
+		proto.RevokedAt = timestamppb.New(*link.RevokedAt)
+	}
+	return proto
+}
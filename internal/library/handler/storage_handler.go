@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"context"
+	"sort"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
+)
+
+// GetStorageUsage reports the disk space taken by media files, per library,
+// media type and resolution, with totals along each.
+func (h *GRPCHandler) GetStorageUsage(
+	ctx context.Context,
+	req *librarypb.GetStorageUsageRequest,
+) (*librarypb.GetStorageUsageResponse, error) {
+	if h.storage == nil {
+		return nil, status.Error(codes.Unimplemented, "storage usage reporting is not enabled")
+	}
+
+	var libraryID *uuid.UUID
+	if req.GetLibraryId() != "" {
+		id, err := uuid.Parse(req.GetLibraryId())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid library ID")
+		}
+		libraryID = &id
+	}
+
+	usage, err := h.storage.Usage(ctx, libraryID)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, status.Error(codes.NotFound, "library not found")
+		}
+		h.logger.Error("Failed to get storage usage", interfaces.Error(err))
+		return nil, status.Error(codes.Internal, "failed to get storage usage")
+	}
+
+	total := domain.StorageTotals{}
+	byLibrary := domain.StorageTotals{}
+	byType := domain.StorageTotals{}
+	byResolution := domain.StorageTotals{}
+	resp := &librarypb.GetStorageUsageResponse{
+		Usage: make([]*librarypb.StorageUsage, len(usage)),
+	}
+	for i, u := range usage {
+		resp.Usage[i] = convertStorageUsageToProto(u)
+		total.Add("", u)
+		byLibrary.Add(u.LibraryID.String(), u)
+		byType.Add(u.MediaType, u)
+		byResolution.Add(u.Resolution, u)
+	}
+
+	resp.ByLibrary = convertStorageTotalsToProto(byLibrary, func(p *librarypb.StorageUsage, key string) { p.LibraryId = key })
+	resp.ByMediaType = convertStorageTotalsToProto(byType, func(p *librarypb.StorageUsage, key string) { p.MediaType = key })
+	resp.ByResolution = convertStorageTotalsToProto(byResolution, func(p *librarypb.StorageUsage, key string) { p.Resolution = key })
+	if t, ok := total[""]; ok {
+		resp.Total = convertStorageUsageToProto(t)
+	} else {
+		resp.Total = &librarypb.StorageUsage{}
+	}
+	return resp, nil
+}
+
+func convertStorageUsageToProto(usage *domain.StorageUsage) *librarypb.StorageUsage {
+	proto := &librarypb.StorageUsage{
+		MediaType:  usage.MediaType,
+		Resolution: usage.Resolution,
+		FileCount:  usage.FileCount,
+		TotalBytes: usage.TotalBytes,
+	}
+	if usage.LibraryID != uuid.Nil {
+		proto.LibraryId = usage.LibraryID.String()
+	}
+	if !usage.UpdatedAt.IsZero() {
+		proto.Updated = timestamppb.New(usage.UpdatedAt)
+	}
+	return proto
+}
+
+// convertStorageTotalsToProto converts totals sorted by key; setKey fills in
+// the dimension they are totals of.
+func convertStorageTotalsToProto(
+	totals domain.StorageTotals,
+	setKey func(p *librarypb.StorageUsage, key string),
+) []*librarypb.StorageUsage {
+	keys := make([]string, 0, len(totals))
+	for key := range totals {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	protos := make([]*librarypb.StorageUsage, len(keys))
+	for i, key := range keys {
+		protos[i] = convertStorageUsageToProto(totals[key])
+		setKey(protos[i], key)
+	}
+	return protos
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
+)
+
+// RefreshThemeMusic finds and stores the theme music of a series.
+func (h *GRPCHandler) RefreshThemeMusic(
+	ctx context.Context,
+	req *librarypb.RefreshThemeMusicRequest,
+) (*librarypb.RefreshThemeMusicResponse, error) {
+	if h.themeService == nil {
+		return nil, status.Error(codes.Unimplemented, "theme music is not enabled")
+	}
+
+	mediaID, err := uuid.Parse(req.GetMediaId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid media ID")
+	}
+
+	media, err := h.themeService.RefreshTheme(ctx, mediaID)
+	if err != nil {
+		return nil, h.themeError(err, mediaID)
+	}
+
+	return &librarypb.RefreshThemeMusicResponse{
+		Media: convertMediaToProto(media, false, false),
+	}, nil
+}
+
+// DeleteThemeMusic clears the theme music of a series.
+func (h *GRPCHandler) DeleteThemeMusic(
+	ctx context.Context,
+	req *librarypb.DeleteThemeMusicRequest,
+) (*librarypb.DeleteThemeMusicResponse, error) {
+	if h.themeService == nil {
+		return nil, status.Error(codes.Unimplemented, "theme music is not enabled")
+	}
+
+	mediaID, err := uuid.Parse(req.GetMediaId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid media ID")
+	}
+
+	media, err := h.themeService.DeleteTheme(ctx, mediaID)
+	if err != nil {
+		return nil, h.themeError(err, mediaID)
+	}
+
+	return &librarypb.DeleteThemeMusicResponse{
+		Media: convertMediaToProto(media, false, false),
+	}, nil
+}
+
+func (h *GRPCHandler) themeError(err error, mediaID uuid.UUID) error {
+	switch {
+	case errors.IsNotFound(err):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.IsBadRequest(err):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	h.logger.Error("Failed to update theme music",
+		interfaces.String("media_id", mediaID.String()),
+		interfaces.Error(err))
+	return status.Error(codes.Internal, "failed to update theme music")
+}
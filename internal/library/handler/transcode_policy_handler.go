@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
+)
+
+// CreateTranscodePolicy adds a transcode policy to a library.
+func (h *GRPCHandler) CreateTranscodePolicy(
+	ctx context.Context,
+	req *librarypb.CreateTranscodePolicyRequest,
+) (*librarypb.CreateTranscodePolicyResponse, error) {
+	if h.policyService == nil {
+		return nil, status.Error(codes.Unimplemented, "transcode policies are not enabled")
+	}
+
+	libraryID, err := uuid.Parse(req.GetPolicy().GetLibraryId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid library ID")
+	}
+
+	policy := convertTranscodePolicyFromProto(req.GetPolicy())
+	policy.LibraryID = libraryID
+	if err := h.policyService.CreatePolicy(ctx, policy); err != nil {
+		return nil, h.transcodePolicyError(err)
+	}
+
+	return &librarypb.CreateTranscodePolicyResponse{
+		Policy: convertTranscodePolicyToProto(policy),
+	}, nil
+}
+
+// ListTranscodePolicies lists the transcode policies of a library.
+func (h *GRPCHandler) ListTranscodePolicies(
+	ctx context.Context,
+	req *librarypb.ListTranscodePoliciesRequest,
+) (*librarypb.ListTranscodePoliciesResponse, error) {
+	if h.policyService == nil {
+		return nil, status.Error(codes.Unimplemented, "transcode policies are not enabled")
+	}
+
+	libraryID, err := uuid.Parse(req.GetLibraryId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid library ID")
+	}
+
+	policies, err := h.policyService.ListPolicies(ctx, libraryID)
+	if err != nil {
+		return nil, h.transcodePolicyError(err)
+	}
+
+	resp := &librarypb.ListTranscodePoliciesResponse{
+		Policies: make([]*librarypb.TranscodePolicy, len(policies)),
+	}
+	for i, policy := range policies {
+		resp.Policies[i] = convertTranscodePolicyToProto(policy)
+	}
+	return resp, nil
+}
+
+// UpdateTranscodePolicy updates the settings of a transcode policy.
+func (h *GRPCHandler) UpdateTranscodePolicy(
+	ctx context.Context,
+	req *librarypb.UpdateTranscodePolicyRequest,
+) (*librarypb.UpdateTranscodePolicyResponse, error) {
+	if h.policyService == nil {
+		return nil, status.Error(codes.Unimplemented, "transcode policies are not enabled")
+	}
+
+	policyID, err := uuid.Parse(req.GetPolicy().GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid policy ID")
+	}
+
+	policy := convertTranscodePolicyFromProto(req.GetPolicy())
+	policy.ID = policyID
+	updated, err := h.policyService.UpdatePolicy(ctx, policy)
+	if err != nil {
+		return nil, h.transcodePolicyError(err)
+	}
+
+	return &librarypb.UpdateTranscodePolicyResponse{
+		Policy: convertTranscodePolicyToProto(updated),
+	}, nil
+}
+
+// DeleteTranscodePolicy deletes a transcode policy.
+func (h *GRPCHandler) DeleteTranscodePolicy(
+	ctx context.Context,
+	req *librarypb.DeleteTranscodePolicyRequest,
+) (*librarypb.DeleteTranscodePolicyResponse, error) {
+	if h.policyService == nil {
+		return nil, status.Error(codes.Unimplemented, "transcode policies are not enabled")
+	}
+
+	policyID, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid policy ID")
+	}
+
+	if err := h.policyService.DeletePolicy(ctx, policyID); err != nil {
+		return nil, h.transcodePolicyError(err)
+	}
+	return &librarypb.DeleteTranscodePolicyResponse{}, nil
+}
+
+// ApplyTranscodePolicies requests the transcodes the policies of a library
+// ask for, for a media item or the whole library.
+func (h *GRPCHandler) ApplyTranscodePolicies(
+	ctx context.Context,
+	req *librarypb.ApplyTranscodePoliciesRequest,
+) (*librarypb.ApplyTranscodePoliciesResponse, error) {
+	if h.policyService == nil {
+		return nil, status.Error(codes.Unimplemented, "transcode policies are not enabled")
+	}
+
+	var requested int
+	switch target := req.GetTarget().(type) {
+	case *librarypb.ApplyTranscodePoliciesRequest_LibraryId:
+		libraryID, err := uuid.Parse(target.LibraryId)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid library ID")
+		}
+		requested, err = h.policyService.ApplyToLibrary(ctx, libraryID)
+		if err != nil {
+			return nil, h.transcodePolicyError(err)
+		}
+	case *librarypb.ApplyTranscodePoliciesRequest_MediaId:
+		mediaID, err := uuid.Parse(target.MediaId)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid media ID")
+		}
+		requested, err = h.policyService.ApplyToMedia(ctx, mediaID)
+		if err != nil {
+			return nil, h.transcodePolicyError(err)
+		}
+	default:
+		return nil, status.Error(codes.InvalidArgument, "library ID or media ID is required")
+	}
+
+	return &librarypb.ApplyTranscodePoliciesResponse{Requested: int32(requested)}, nil
+}
+
+func (h *GRPCHandler) transcodePolicyError(err error) error {
+	switch {
+	case errors.IsNotFound(err):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.IsBadRequest(err):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	h.logger.Error("Transcode policy request failed", interfaces.Error(err))
+	return status.Error(codes.Internal, "failed to process transcode policy request")
+}
+
+func convertTranscodePolicyFromProto(policy *librarypb.TranscodePolicy) *domain.TranscodePolicy {
+	return &domain.TranscodePolicy{
+		Name:    policy.GetName(),
+		Profile: policy.GetProfile(),
+		Format:  policy.GetFormat(),
+		Enabled: policy.GetEnabled(),
+
+		AudioNormalization: convertAudioNormalization(policy.GetAudioNormalization()),
+	}
+}
+
+func convertTranscodePolicyToProto(policy *domain.TranscodePolicy) *librarypb.TranscodePolicy {
+	return &librarypb.TranscodePolicy{
+		Id:        policy.ID.String(),
+		LibraryId: policy.LibraryID.String(),
+		Name:      policy.Name,
+		Profile:   policy.Profile,
+		Format:    policy.Format,
+		Enabled:   policy.Enabled,
+		CreatedAt: timestamppb.New(policy.CreatedAt),
+		UpdatedAt: timestamppb.New(policy.UpdatedAt),
+
+		AudioNormalization: convertAudioNormalizationToProto(policy.AudioNormalization),
+	}
+}
@@ -0,0 +1,218 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/internal/library/constants"
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	commonpb "github.com/narwhalmedia/narwhal/pkg/common/v1"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
+	"github.com/narwhalmedia/narwhal/pkg/pagination"
+)
+
+// ListWanted lists monitored movies and episodes that are missing or below
+// the quality cutoff of their library.
+func (h *GRPCHandler) ListWanted(
+	ctx context.Context,
+	req *librarypb.ListWantedRequest,
+) (*librarypb.ListWantedResponse, error) {
+	if h.wanted == nil {
+		return nil, status.Error(codes.Unimplemented, "wanted is not enabled")
+	}
+
+	var libraryID *uuid.UUID
+	if req.GetLibraryId() != "" {
+		id, err := uuid.Parse(req.GetLibraryId())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid library ID")
+		}
+		libraryID = &id
+	}
+
+	limit := int(constants.DefaultPageSize)
+	offset := 0
+	if req.GetPagination() != nil {
+		if size := int(req.GetPagination().GetPageSize()); size > 0 {
+			limit = min(size, constants.MaxPageSize)
+		}
+		if req.GetPagination().GetPageToken() != "" && h.paginationEncoder != nil {
+			calculatedOffset, err := pagination.CalculateOffset(
+				h.paginationEncoder,
+				req.GetPagination().GetPageToken(),
+				0,
+			)
+			if err != nil {
+				return nil, status.Error(codes.InvalidArgument, "invalid page token")
+			}
+			offset = calculatedOffset
+		}
+	}
+
+	items, total, err := h.wanted.ListWanted(ctx, domain.WantedReason(req.GetReason()), libraryID, limit, offset)
+	if err != nil {
+		return nil, h.wantedError(err)
+	}
+
+	resp := &librarypb.ListWantedResponse{
+		Items:      make([]*librarypb.WantedItem, len(items)),
+		Pagination: &commonpb.PaginationResponse{TotalItems: int32(total)},
+	}
+	for i, item := range items {
+		resp.Items[i] = convertWantedItemToProto(item)
+	}
+
+	if h.paginationEncoder != nil && offset+len(items) < total {
+		token, err := pagination.GenerateNextPageToken(h.paginationEncoder, offset, limit, total)
+		if err != nil {
+			h.logger.Error("Failed to generate next page token", interfaces.Error(err))
+		} else {
+			resp.Pagination.NextPageToken = token
+		}
+	}
+
+	return resp, nil
+}
+
+// SearchReleases searches the indexers for releases of a movie or episode.
+func (h *GRPCHandler) SearchReleases(
+	ctx context.Context,
+	req *librarypb.SearchReleasesRequest,
+) (*librarypb.SearchReleasesResponse, error) {
+	if h.wanted == nil {
+		return nil, status.Error(codes.Unimplemented, "wanted is not enabled")
+	}
+
+	mediaID, episodeID, err := parseWantedTarget(req.GetMediaId(), req.GetEpisodeId())
+	if err != nil {
+		return nil, err
+	}
+
+	releases, err := h.wanted.SearchReleases(ctx, mediaID, episodeID)
+	if err != nil {
+		return nil, h.wantedError(err)
+	}
+
+	resp := &librarypb.SearchReleasesResponse{
+		Releases: make([]*librarypb.Release, len(releases)),
+	}
+	for i, release := range releases {
+		resp.Releases[i] = convertReleaseToProto(release)
+	}
+	return resp, nil
+}
+
+// GrabRelease hands a release picked from a search to a download client.
+func (h *GRPCHandler) GrabRelease(
+	ctx context.Context,
+	req *librarypb.GrabReleaseRequest,
+) (*librarypb.GrabReleaseResponse, error) {
+	if h.wanted == nil {
+		return nil, status.Error(codes.Unimplemented, "wanted is not enabled")
+	}
+
+	mediaID, episodeID, err := parseWantedTarget(req.GetMediaId(), req.GetEpisodeId())
+	if err != nil {
+		return nil, err
+	}
+	if req.GetRelease() == nil {
+		return nil, status.Error(codes.InvalidArgument, "release is required")
+	}
+
+	downloadID, err := h.wanted.GrabRelease(ctx, mediaID, episodeID,
+		convertReleaseFromProto(req.GetRelease()), req.GetDownloadClient())
+	if err != nil {
+		return nil, h.wantedError(err)
+	}
+	return &librarypb.GrabReleaseResponse{DownloadId: downloadID}, nil
+}
+
+func parseWantedTarget(media, episode string) (uuid.UUID, *uuid.UUID, error) {
+	mediaID, err := uuid.Parse(media)
+	if err != nil {
+		return uuid.Nil, nil, status.Error(codes.InvalidArgument, "invalid media ID")
+	}
+	if episode == "" {
+		return mediaID, nil, nil
+	}
+	episodeID, err := uuid.Parse(episode)
+	if err != nil {
+		return uuid.Nil, nil, status.Error(codes.InvalidArgument, "invalid episode ID")
+	}
+	return mediaID, &episodeID, nil
+}
+
+func (h *GRPCHandler) wantedError(err error) error {
+	switch {
+	case errors.IsNotFound(err):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.IsBadRequest(err):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	h.logger.Error("Wanted request failed", interfaces.Error(err))
+	return status.Error(codes.Internal, "failed to process wanted request")
+}
+
+func convertWantedItemToProto(item *domain.WantedItem) *librarypb.WantedItem {
+	proto := &librarypb.WantedItem{
+		Reason:        string(item.Reason),
+		MediaId:       item.MediaID.String(),
+		LibraryId:     item.LibraryID.String(),
+		Title:         item.Title,
+		SeasonNumber:  int32(item.SeasonNumber),
+		EpisodeNumber: int32(item.EpisodeNumber),
+		EpisodeTitle:  item.EpisodeTitle,
+		Quality:       item.Quality,
+		QualityCutoff: item.Cutoff,
+	}
+	if item.EpisodeID != nil {
+		proto.EpisodeId = item.EpisodeID.String()
+	}
+	if item.Date != nil {
+		proto.Date = timestamppb.New(*item.Date)
+	}
+	return proto
+}
+
+func convertReleaseToProto(release *domain.Release) *librarypb.Release {
+	proto := &librarypb.Release{
+		Indexer:     release.Indexer,
+		Id:          release.ID,
+		Title:       release.Title,
+		DownloadUrl: release.DownloadURL,
+		Size:        release.Size,
+		Protocol:    release.Protocol,
+		Seeders:     int32(release.Seeders),
+		Leechers:    int32(release.Leechers),
+		Quality:     release.Quality,
+		Score:       int32(release.Score),
+		Rejections:  release.Rejections,
+	}
+	if !release.PublishedAt.IsZero() {
+		proto.PublishedAt = timestamppb.New(release.PublishedAt)
+	}
+	return proto
+}
+
+func convertReleaseFromProto(release *librarypb.Release) *domain.Release {
+	converted := &domain.Release{
+		Indexer:     release.GetIndexer(),
+		ID:          release.GetId(),
+		Title:       release.GetTitle(),
+		DownloadURL: release.GetDownloadUrl(),
+		Size:        release.GetSize(),
+		Protocol:    release.GetProtocol(),
+		Seeders:     int(release.GetSeeders()),
+		Leechers:    int(release.GetLeechers()),
+	}
+	if release.GetPublishedAt() != nil {
+		converted.PublishedAt = release.GetPublishedAt().AsTime()
+	}
+	return converted
+}
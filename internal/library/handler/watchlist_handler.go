@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
+)
+
+// AddToWatchlist adds media to the caller's watchlist.
+func (h *GRPCHandler) AddToWatchlist(
+	ctx context.Context,
+	req *librarypb.AddToWatchlistRequest,
+) (*librarypb.AddToWatchlistResponse, error) {
+	userID, mediaID, err := h.watchlistRequest(ctx, req.GetMediaId())
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := h.watchlist.Add(ctx, userID, mediaID)
+	if err != nil {
+		return nil, h.watchlistError(err)
+	}
+	return &librarypb.AddToWatchlistResponse{Entry: convertWatchlistEntryToProto(entry)}, nil
+}
+
+// RemoveFromWatchlist removes media from the caller's watchlist.
+func (h *GRPCHandler) RemoveFromWatchlist(
+	ctx context.Context,
+	req *librarypb.RemoveFromWatchlistRequest,
+) (*librarypb.RemoveFromWatchlistResponse, error) {
+	userID, mediaID, err := h.watchlistRequest(ctx, req.GetMediaId())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.watchlist.Remove(ctx, userID, mediaID); err != nil {
+		return nil, h.watchlistError(err)
+	}
+	return &librarypb.RemoveFromWatchlistResponse{}, nil
+}
+
+// ListWatchlist lists the caller's watchlist.
+func (h *GRPCHandler) ListWatchlist(
+	ctx context.Context,
+	_ *librarypb.ListWatchlistRequest,
+) (*librarypb.ListWatchlistResponse, error) {
+	if h.watchlist == nil {
+		return nil, status.Error(codes.Unimplemented, "watchlists are not enabled")
+	}
+	userID, err := watchlistUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := h.watchlist.List(ctx, userID)
+	if err != nil {
+		return nil, h.watchlistError(err)
+	}
+
+	resp := &librarypb.ListWatchlistResponse{
+		Entries: make([]*librarypb.WatchlistEntry, len(entries)),
+	}
+	for i, entry := range entries {
+		resp.Entries[i] = convertWatchlistEntryToProto(entry)
+	}
+	return resp, nil
+}
+
+// watchlistRequest returns the caller and the media of a watchlist change.
+func (h *GRPCHandler) watchlistRequest(ctx context.Context, id string) (uuid.UUID, uuid.UUID, error) {
+	if h.watchlist == nil {
+		return uuid.Nil, uuid.Nil, status.Error(codes.Unimplemented, "watchlists are not enabled")
+	}
+	userID, err := watchlistUser(ctx)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+	mediaID, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, status.Error(codes.InvalidArgument, "invalid media ID")
+	}
+	return userID, mediaID, nil
+}
+
+// watchlistUser returns the caller, whose watchlist is used.
+func watchlistUser(ctx context.Context) (uuid.UUID, error) {
+	id, _ := auth.GetUserIDFromContext(ctx)
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, status.Error(codes.Unauthenticated, "user not authenticated")
+	}
+	return userID, nil
+}
+
+func (h *GRPCHandler) watchlistError(err error) error {
+	if errors.IsNotFound(err) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	h.logger.Error("Watchlist request failed", interfaces.Error(err))
+	return status.Error(codes.Internal, "failed to process watchlist request")
+}
+
+func convertWatchlistEntryToProto(entry *domain.WatchlistEntry) *librarypb.WatchlistEntry {
+	return &librarypb.WatchlistEntry{
+		MediaId: entry.MediaID.String(),
+		AddedAt: timestamppb.New(entry.AddedAt),
+	}
+}
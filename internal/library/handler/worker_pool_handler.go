@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
+)
+
+// ListWorkerPools lists the worker pools that can be resized at runtime.
+func (h *GRPCHandler) ListWorkerPools(
+	ctx context.Context,
+	req *librarypb.ListWorkerPoolsRequest,
+) (*librarypb.ListWorkerPoolsResponse, error) {
+	pools := h.libraryService.WorkerPools()
+	resp := &librarypb.ListWorkerPoolsResponse{
+		Pools: make([]*librarypb.WorkerPool, len(pools)),
+	}
+	for i, pool := range pools {
+		resp.Pools[i] = convertWorkerPoolToProto(pool)
+	}
+	return resp, nil
+}
+
+// ResizeWorkerPool resizes a worker pool without a restart.
+func (h *GRPCHandler) ResizeWorkerPool(
+	ctx context.Context,
+	req *librarypb.ResizeWorkerPoolRequest,
+) (*librarypb.ResizeWorkerPoolResponse, error) {
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "worker pool name is required")
+	}
+
+	pool, err := h.libraryService.ResizeWorkerPool(ctx, req.GetName(), int(req.GetSize()))
+	if err != nil {
+		switch {
+		case errors.IsBadRequest(err):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.IsNotFound(err):
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		h.logger.Error("Failed to resize worker pool", interfaces.Error(err))
+		return nil, status.Error(codes.Internal, "failed to resize worker pool")
+	}
+	return &librarypb.ResizeWorkerPoolResponse{Pool: convertWorkerPoolToProto(pool)}, nil
+}
+
+func convertWorkerPoolToProto(pool *domain.WorkerPool) *librarypb.WorkerPool {
+	return &librarypb.WorkerPool{
+		Name:   pool.Name,
+		Size:   int32(pool.Size),
+		Active: int32(pool.Active),
+	}
+}
@@ -0,0 +1,45 @@
+// Package plugins connects the library service to sidecar plugins: it runs
+// the plugin handshake and adapts plugin capabilities to the library's
+// extension points.
+package plugins
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	"github.com/narwhalmedia/narwhal/pkg/plugin"
+	pluginpb "github.com/narwhalmedia/narwhal/pkg/plugin/v1"
+)
+
+// Handshake asks a plugin what it is and offers over PluginService. It is
+// the plugin.HandshakeFunc of the library's plugin manager.
+func Handshake(ctx context.Context, conn *grpc.ClientConn, kinds []plugin.Kind) (*plugin.Info, error) {
+	req := &pluginpb.HandshakeRequest{
+		ProtocolVersion: plugin.ProtocolVersion,
+		Kinds:           make([]string, len(kinds)),
+	}
+	for i, kind := range kinds {
+		req.Kinds[i] = string(kind)
+	}
+
+	resp, err := pluginpb.NewPluginServiceClient(conn).Handshake(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &plugin.Info{
+		Name:            resp.GetName(),
+		Version:         resp.GetVersion(),
+		ProtocolVersion: resp.GetProtocolVersion(),
+		Capabilities:    make([]plugin.Capability, len(resp.GetCapabilities())),
+	}
+	for i, capability := range resp.GetCapabilities() {
+		info.Capabilities[i] = plugin.Capability{
+			Kind:     plugin.Kind(capability.GetKind()),
+			Name:     capability.GetName(),
+			Features: capability.GetFeatures(),
+		}
+	}
+	return info, nil
+}
@@ -0,0 +1,73 @@
+package plugins
+
+import (
+	"context"
+	"time"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/plugin"
+	pluginpb "github.com/narwhalmedia/narwhal/pkg/plugin/v1"
+)
+
+// Indexer is an indexer served by a plugin.
+type Indexer struct {
+	capability plugin.Capability
+	client     pluginpb.IndexerServiceClient
+}
+
+var _ domain.Indexer = (*Indexer)(nil)
+
+// NewIndexer creates an indexer for an indexer capability of a running
+// plugin.
+func NewIndexer(provider plugin.Provider) *Indexer {
+	return &Indexer{
+		capability: provider.Capability,
+		client:     pluginpb.NewIndexerServiceClient(provider.Conn),
+	}
+}
+
+// Indexers returns the indexers offered by the running plugins of a
+// manager.
+func Indexers(manager *plugin.Manager) []domain.Indexer {
+	var indexers []domain.Indexer
+	for _, provider := range manager.Providers(plugin.KindIndexer) {
+		indexers = append(indexers, NewIndexer(provider))
+	}
+	return indexers
+}
+
+func (i *Indexer) Name() string {
+	return i.capability.Name
+}
+
+func (i *Indexer) Search(ctx context.Context, query domain.ReleaseQuery) ([]*domain.Release, error) {
+	resp, err := i.client.SearchReleases(ctx, &pluginpb.SearchReleasesRequest{
+		Capability: i.capability.Name,
+		Query:      query.Query,
+		ImdbId:     query.IMDBID,
+		TvdbId:     query.TVDBID,
+		Season:     int32(query.Season),
+		Episode:    int32(query.Episode),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	releases := make([]*domain.Release, len(resp.GetReleases()))
+	for j, r := range resp.GetReleases() {
+		releases[j] = &domain.Release{
+			Indexer:     i.capability.Name,
+			ID:          r.GetId(),
+			Title:       r.GetTitle(),
+			DownloadURL: r.GetDownloadUrl(),
+			Size:        r.GetSize(),
+			Protocol:    r.GetProtocol(),
+			Seeders:     int(r.GetSeeders()),
+			Leechers:    int(r.GetLeechers()),
+		}
+		if r.GetPublished() > 0 {
+			releases[j].PublishedAt = time.Unix(r.GetPublished(), 0)
+		}
+	}
+	return releases, nil
+}
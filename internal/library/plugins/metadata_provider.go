@@ -0,0 +1,201 @@
+package plugins
+
+import (
+	"context"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+	"github.com/narwhalmedia/narwhal/pkg/plugin"
+	pluginpb "github.com/narwhalmedia/narwhal/pkg/plugin/v1"
+)
+
+// MetadataProvider is a metadata provider served by a plugin.
+type MetadataProvider struct {
+	capability plugin.Capability
+	client     pluginpb.MetadataProviderServiceClient
+}
+
+var _ domain.MetadataProvider = (*MetadataProvider)(nil)
+
+// NewMetadataProvider creates a metadata provider for a metadata_provider
+// capability of a running plugin.
+func NewMetadataProvider(provider plugin.Provider) *MetadataProvider {
+	return &MetadataProvider{
+		capability: provider.Capability,
+		client:     pluginpb.NewMetadataProviderServiceClient(provider.Conn),
+	}
+}
+
+// MetadataProviders returns the metadata providers offered by the running
+// plugins of a manager.
+func MetadataProviders(manager *plugin.Manager) []domain.MetadataProvider {
+	var providers []domain.MetadataProvider
+	for _, provider := range manager.Providers(plugin.KindMetadataProvider) {
+		providers = append(providers, NewMetadataProvider(provider))
+	}
+	return providers
+}
+
+func (p *MetadataProvider) GetName() string {
+	return p.capability.Name
+}
+
+// GetType returns the media the provider covers from the tv and movie
+// features of its capability. Providers listing neither cover both.
+func (p *MetadataProvider) GetType() string {
+	tv, movie := p.capability.HasFeature("tv"), p.capability.HasFeature("movie")
+	switch {
+	case tv && !movie:
+		return "tv"
+	case movie && !tv:
+		return "movie"
+	default:
+		return "all"
+	}
+}
+
+func (p *MetadataProvider) SearchMovie(
+	ctx context.Context,
+	query string,
+	year int,
+	prefs domain.MetadataPreferences,
+) ([]models.SearchResult, error) {
+	resp, err := p.client.SearchMovie(ctx, &pluginpb.SearchRequest{
+		Capability: p.capability.Name,
+		Query:      query,
+		Year:       int32(year),
+		Language:   prefs.Language,
+		Region:     prefs.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p.convertSearchResults(resp.GetResults()), nil
+}
+
+func (p *MetadataProvider) SearchTV(
+	ctx context.Context,
+	query string,
+	year int,
+	prefs domain.MetadataPreferences,
+) ([]models.SearchResult, error) {
+	resp, err := p.client.SearchTV(ctx, &pluginpb.SearchRequest{
+		Capability: p.capability.Name,
+		Query:      query,
+		Year:       int32(year),
+		Language:   prefs.Language,
+		Region:     prefs.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p.convertSearchResults(resp.GetResults()), nil
+}
+
+func (p *MetadataProvider) GetMovieDetails(
+	ctx context.Context,
+	providerID string,
+	prefs domain.MetadataPreferences,
+) (*models.Metadata, error) {
+	resp, err := p.client.GetMovieDetails(ctx, &pluginpb.GetDetailsRequest{
+		Capability: p.capability.Name,
+		ProviderId: providerID,
+		Language:   prefs.Language,
+		Region:     prefs.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return convertMetadata(resp.GetMetadata()), nil
+}
+
+func (p *MetadataProvider) GetTVDetails(
+	ctx context.Context,
+	providerID string,
+	prefs domain.MetadataPreferences,
+) (*models.Metadata, error) {
+	resp, err := p.client.GetTVDetails(ctx, &pluginpb.GetDetailsRequest{
+		Capability: p.capability.Name,
+		ProviderId: providerID,
+		Language:   prefs.Language,
+		Region:     prefs.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return convertMetadata(resp.GetMetadata()), nil
+}
+
+func (p *MetadataProvider) GetEpisodeDetails(
+	ctx context.Context,
+	providerID string,
+	season, episode int,
+	prefs domain.MetadataPreferences,
+) (*models.EpisodeMetadata, error) {
+	resp, err := p.client.GetEpisodeDetails(ctx, &pluginpb.GetEpisodeDetailsRequest{
+		Capability: p.capability.Name,
+		ProviderId: providerID,
+		Season:     int32(season),
+		Episode:    int32(episode),
+		Language:   prefs.Language,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	e := resp.GetEpisode()
+	if e == nil {
+		return nil, nil
+	}
+	return &models.EpisodeMetadata{
+		Title:         e.GetTitle(),
+		Description:   e.GetDescription(),
+		AirDate:       e.GetAirDate(),
+		SeasonNumber:  int(e.GetSeasonNumber()),
+		EpisodeNumber: int(e.GetEpisodeNumber()),
+		Rating:        e.GetRating(),
+		GuestStars:    e.GetGuestStars(),
+		Directors:     e.GetDirectors(),
+		Writers:       e.GetWriters(),
+		StillURL:      e.GetStillUrl(),
+	}, nil
+}
+
+func (p *MetadataProvider) convertSearchResults(results []*pluginpb.SearchResult) []models.SearchResult {
+	converted := make([]models.SearchResult, len(results))
+	for i, r := range results {
+		converted[i] = models.SearchResult{
+			ProviderID:   r.GetProviderId(),
+			ProviderName: p.capability.Name,
+			Title:        r.GetTitle(),
+			Year:         int(r.GetYear()),
+			Type:         r.GetType(),
+			PosterURL:    r.GetPosterUrl(),
+			Overview:     r.GetOverview(),
+		}
+	}
+	return converted
+}
+
+func convertMetadata(m *pluginpb.Metadata) *models.Metadata {
+	if m == nil {
+		return nil
+	}
+	return &models.Metadata{
+		Title:         m.GetTitle(),
+		OriginalTitle: m.GetOriginalTitle(),
+		IMDBID:        m.GetImdbId(),
+		TMDBID:        m.GetTmdbId(),
+		TVDBID:        m.GetTvdbId(),
+		Description:   m.GetDescription(),
+		ReleaseDate:   m.GetReleaseDate(),
+		Certification: m.GetCertification(),
+		Rating:        m.GetRating(),
+		Genres:        m.GetGenres(),
+		Cast:          m.GetCast(),
+		Directors:     m.GetDirectors(),
+		PosterURL:     m.GetPosterUrl(),
+		BackdropURL:   m.GetBackdropUrl(),
+		TrailerURL:    m.GetTrailerUrl(),
+	}
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// AccessResolver resolves the attributes used by conditional method
+// policies in the library service.
+type AccessResolver struct {
+	db *gorm.DB
+}
+
+// NewAccessResolver creates a new access resolver.
+func NewAccessResolver(db *gorm.DB) *AccessResolver {
+	return &AccessResolver{db: db}
+}
+
+// ResourceOwner returns the user ID owning the given resource. The library
+// service does not track ownership of any resource yet.
+func (r *AccessResolver) ResourceOwner(_ context.Context, resource, _ string) (string, error) {
+	return "", fmt.Errorf("ownership of %s is not tracked by the library service", resource)
+}
+
+// IsLibraryMember reports whether the user has been granted access to the
+// library.
+func (r *AccessResolver) IsLibraryMember(ctx context.Context, userID, libraryID string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Table("library_grants").
+		Where("user_id = ? AND library_id = ?", userID, libraryID).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to check library grant: %w", err)
+	}
+
+	return count > 0, nil
+}
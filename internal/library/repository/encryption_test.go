@@ -10,6 +10,7 @@ import (
 
 	"github.com/narwhalmedia/narwhal/internal/library/domain"
 	"github.com/narwhalmedia/narwhal/internal/library/repository"
+	"github.com/narwhalmedia/narwhal/pkg/encryption"
 	"github.com/narwhalmedia/narwhal/test/testutil"
 )
 
@@ -38,6 +39,7 @@ func (suite *EncryptionTestSuite) SetupSuite() {
 		&repository.Episode{},
 		&repository.MetadataProvider{},
 		&repository.ScanHistory{},
+		&repository.Feed{},
 	)
 	suite.Require().NoError(err)
 }
@@ -177,3 +179,40 @@ func (suite *EncryptionTestSuite) TestListProvidersDecryption() {
 		suite.NotEmpty(providers[i].ID)
 	}
 }
+
+func (suite *EncryptionTestSuite) TestRotateSecrets() {
+	old, err := encryption.NewEncryptor("test-encryption-key-for-testing")
+	suite.Require().NoError(err)
+	gormRepo, err := repository.NewGormRepository(suite.container.DB)
+	suite.Require().NoError(err)
+	gormRepo.WithEncryptor(old)
+
+	provider := &domain.MetadataProviderConfig{
+		Name:         "TMDB",
+		ProviderType: "tmdb",
+		APIKey:       "sk-rotated-key",
+		Enabled:      true,
+	}
+	suite.Require().NoError(gormRepo.CreateProvider(suite.ctx, provider))
+
+	rotated, err := encryption.NewEncryptor("new-encryption-key", "test-encryption-key-for-testing")
+	suite.Require().NoError(err)
+	gormRepo.WithEncryptor(rotated)
+
+	count, err := gormRepo.RotateSecrets(suite.ctx)
+	suite.Require().NoError(err)
+	suite.Equal(1, count)
+
+	// Only the new key is needed once secrets are rotated
+	current, err := encryption.NewEncryptor("new-encryption-key")
+	suite.Require().NoError(err)
+	gormRepo.WithEncryptor(current)
+
+	retrieved, err := gormRepo.GetProvider(suite.ctx, provider.ID)
+	suite.Require().NoError(err)
+	suite.Equal("sk-rotated-key", retrieved.APIKey)
+
+	count, err = gormRepo.RotateSecrets(suite.ctx)
+	suite.Require().NoError(err)
+	suite.Zero(count)
+}
@@ -1,19 +1,30 @@
 package repository
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/narwhalmedia/narwhal/internal/library/constants"
 	"github.com/narwhalmedia/narwhal/internal/library/domain"
 	"github.com/narwhalmedia/narwhal/pkg/encryption"
 	pkgerrors "github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/loudness"
 	"github.com/narwhalmedia/narwhal/pkg/models"
+	"github.com/narwhalmedia/narwhal/pkg/saga"
+	"github.com/narwhalmedia/narwhal/pkg/task"
 )
 
 // GormRepository implements the repository interfaces using GORM.
@@ -22,7 +33,9 @@ type GormRepository struct {
 	encryptor *encryption.Encryptor
 }
 
-// NewGormRepository creates a new GORM repository.
+// NewGormRepository creates a new GORM repository. Secrets are encrypted
+// with the key in NARWHAL_ENCRYPTION_KEY, or a development key, until
+// WithEncryptor sets the configured one.
 func NewGormRepository(db *gorm.DB) (*GormRepository, error) {
 	// Get encryption key from environment variable
 	encryptionKey := os.Getenv("NARWHAL_ENCRYPTION_KEY")
@@ -42,14 +55,95 @@ func NewGormRepository(db *gorm.DB) (*GormRepository, error) {
 	}, nil
 }
 
+// WithEncryptor sets the encryptor provider API keys and feed URLs, which
+// carry indexer passkeys, are encrypted with.
+func (r *GormRepository) WithEncryptor(encryptor *encryption.Encryptor) *GormRepository {
+	r.encryptor = encryptor
+	return r
+}
+
+// RotateSecrets re-encrypts the stored secrets that are not encrypted with
+// the primary key, after a key rotation or for values stored before their
+// column was encrypted, and returns how many were.
+func (r *GormRepository) RotateSecrets(ctx context.Context) (int, error) {
+	rotated := 0
+
+	var providers []MetadataProvider
+	if err := r.db.WithContext(ctx).Select("id", "api_key").Find(&providers).Error; err != nil {
+		return rotated, fmt.Errorf("failed to list providers: %w", err)
+	}
+	for _, p := range providers {
+		if !r.encryptor.NeedsRotation(p.APIKey) {
+			continue
+		}
+		apiKey, err := r.encryptor.Rotate(p.APIKey)
+		if err != nil {
+			return rotated, fmt.Errorf("failed to re-encrypt API key of provider %s: %w", p.ID, err)
+		}
+		if err := r.db.WithContext(ctx).Model(&MetadataProvider{}).Where("id = ?", p.ID).
+			UpdateColumn("api_key", apiKey).Error; err != nil {
+			return rotated, fmt.Errorf("failed to update provider: %w", err)
+		}
+		rotated++
+	}
+
+	var feeds []Feed
+	if err := r.db.WithContext(ctx).Select("id", "url").Find(&feeds).Error; err != nil {
+		return rotated, fmt.Errorf("failed to list feeds: %w", err)
+	}
+	for _, f := range feeds {
+		if !r.encryptor.NeedsRotation(f.URL) {
+			continue
+		}
+		feedURL, err := r.openFeedURL(f.URL)
+		if err != nil {
+			return rotated, fmt.Errorf("failed to decrypt URL of feed %s: %w", f.ID, err)
+		}
+		if feedURL, err = r.encryptor.Encrypt(feedURL); err != nil {
+			return rotated, fmt.Errorf("failed to encrypt feed URL: %w", err)
+		}
+		if err := r.db.WithContext(ctx).Model(&Feed{}).Where("id = ?", f.ID).
+			UpdateColumn("url", feedURL).Error; err != nil {
+			return rotated, fmt.Errorf("failed to update feed: %w", err)
+		}
+		rotated++
+	}
+
+	return rotated, nil
+}
+
 // CreateLibrary creates a new library.
 func (r *GormRepository) CreateLibrary(ctx context.Context, library *domain.Library) error {
 	model := &Library{
-		Name:         library.Name,
-		Path:         library.Path,
-		MediaType:    library.Type,
-		Enabled:      library.Enabled,
-		ScanInterval: library.ScanInterval,
+		TenantID:        library.TenantID,
+		Name:            library.Name,
+		Path:            library.Path,
+		MediaType:       library.Type,
+		Enabled:         library.Enabled,
+		ScanInterval:    library.ScanInterval,
+		ExcludePatterns: library.ExcludePatterns,
+		ExtrasMode:      string(library.ExtrasMode),
+		QualityCutoff:   library.QualityCutoff,
+
+		MetadataLanguage: library.MetadataPreferences.Language,
+		MetadataRegion:   library.MetadataPreferences.Region,
+		TitleStyle:       string(library.MetadataPreferences.TitleStyle),
+
+		Anime: library.Anime,
+
+		IgnoreExtrasFolders: library.IgnoreExtrasFolders,
+		FolderProfile:       string(library.FolderProfile),
+
+		MovieFormat:   library.Naming.MovieFormat,
+		EpisodeFormat: library.Naming.EpisodeFormat,
+
+		AudioNormalization: string(library.AudioNormalization),
+	}
+	if model.ExtrasMode == "" {
+		model.ExtrasMode = string(domain.ExtrasModeSkip)
+	}
+	if model.TitleStyle == "" {
+		model.TitleStyle = string(domain.TitleStyleTranslated)
 	}
 
 	if err := r.db.WithContext(ctx).Create(model).Error; err != nil {
@@ -57,6 +151,7 @@ func (r *GormRepository) CreateLibrary(ctx context.Context, library *domain.Libr
 	}
 
 	library.ID = model.ID
+	library.TenantID = model.TenantID
 	library.CreatedAt = model.CreatedAt
 	library.UpdatedAt = model.UpdatedAt
 	return nil
@@ -91,10 +186,32 @@ func (r *GormRepository) GetLibraryByPath(ctx context.Context, path string) (*do
 // UpdateLibrary updates a library.
 func (r *GormRepository) UpdateLibrary(ctx context.Context, library *domain.Library) error {
 	updates := map[string]interface{}{
-		"name":          library.Name,
-		"path":          library.Path,
-		"enabled":       library.Enabled,
-		"scan_interval": library.ScanInterval,
+		"name":             library.Name,
+		"path":             library.Path,
+		"enabled":          library.Enabled,
+		"scan_interval":    library.ScanInterval,
+		"exclude_patterns": library.ExcludePatterns,
+		"quality_cutoff":   library.QualityCutoff,
+
+		"metadata_language": library.MetadataPreferences.Language,
+		"metadata_region":   library.MetadataPreferences.Region,
+
+		"anime": library.Anime,
+
+		"ignore_extras_folders": library.IgnoreExtrasFolders,
+		"folder_profile":        string(library.FolderProfile),
+
+		"movie_format":   library.Naming.MovieFormat,
+		"episode_format": library.Naming.EpisodeFormat,
+
+		"audio_normalization": string(library.AudioNormalization),
+	}
+
+	if library.ExtrasMode != "" {
+		updates["extras_mode"] = string(library.ExtrasMode)
+	}
+	if library.MetadataPreferences.TitleStyle != "" {
+		updates["title_style"] = string(library.MetadataPreferences.TitleStyle)
 	}
 
 	if library.LastScanAt != nil && !library.LastScanAt.IsZero() {
@@ -127,6 +244,154 @@ func (r *GormRepository) DeleteLibrary(ctx context.Context, id uuid.UUID) error
 	return nil
 }
 
+// ListLibraryFiles lists the files the media and episodes of a library
+// point to.
+func (r *GormRepository) ListLibraryFiles(ctx context.Context, libraryID uuid.UUID) ([]*domain.LibraryFile, error) {
+	var rows []struct {
+		MediaID   uuid.UUID
+		EpisodeID *uuid.UUID
+		Path      string
+	}
+	err := r.db.WithContext(ctx).Raw(`
+		SELECT id AS media_id, NULL::uuid AS episode_id, file_path AS path
+		FROM media_items
+		WHERE library_id = ? AND file_path <> '' AND deleted_at IS NULL
+		UNION ALL
+		SELECT e.media_id, e.id, e.file_path
+		FROM episodes e JOIN media_items m ON m.id = e.media_id
+		WHERE m.library_id = ? AND e.file_path <> '' AND e.deleted_at IS NULL AND m.deleted_at IS NULL
+		UNION ALL
+		SELECT f.media_id, f.episode_id, f.file_path
+		FROM episode_files f
+			JOIN episodes e ON e.id = f.episode_id
+			JOIN media_items m ON m.id = f.media_id
+		WHERE m.library_id = ? AND f.file_path <> e.file_path AND e.deleted_at IS NULL AND m.deleted_at IS NULL
+		ORDER BY path
+	`, libraryID, libraryID, libraryID).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list library files: %w", err)
+	}
+
+	files := make([]*domain.LibraryFile, len(rows))
+	for i, row := range rows {
+		files[i] = &domain.LibraryFile{MediaID: row.MediaID, EpisodeID: row.EpisodeID, Path: row.Path}
+	}
+
+	return files, nil
+}
+
+// RelocateLibrary rewrites the from prefix of the paths of a library, its
+// media, episodes, episode files and scan manifest to to, in one
+// transaction.
+func (r *GormRepository) RelocateLibrary(ctx context.Context, libraryID uuid.UUID, from, to string) (int, error) {
+	from = filepath.Clean(from)
+	to = filepath.Clean(to)
+	fromPrefix := strings.TrimSuffix(from, "/") + "/"
+	toPrefix := strings.TrimSuffix(to, "/") + "/"
+	like := escapeLike(fromPrefix) + "%"
+
+	// rewrite returns the SQL relocating column, for rows whose column is
+	// from itself or below it.
+	rewrite := func(column string) (string, []interface{}) {
+		return fmt.Sprintf("CASE WHEN %[1]s = ? THEN ? ELSE ? || substr(%[1]s, ?) END", column),
+			[]interface{}{from, to, toPrefix, len(fromPrefix) + 1}
+	}
+
+	relocated := 0
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		expr, args := rewrite("path")
+		result := tx.Model(&Library{}).Where("id = ?", libraryID).
+			Updates(map[string]interface{}{"path": gorm.Expr(expr, args...), "updated_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return pkgerrors.NotFound("library not found")
+		}
+
+		expr, args = rewrite("file_path")
+		result = tx.Model(&MediaItem{}).
+			Where("library_id = ? AND (file_path = ? OR file_path LIKE ?)", libraryID, from, like).
+			Update("file_path", gorm.Expr(expr, args...))
+		if result.Error != nil {
+			return result.Error
+		}
+		relocated += int(result.RowsAffected)
+
+		result = tx.Model(&Episode{}).
+			Where("media_id IN (?)", tx.Model(&MediaItem{}).Select("id").Where("library_id = ?", libraryID)).
+			Where("file_path = ? OR file_path LIKE ?", from, like).
+			Update("file_path", gorm.Expr(expr, args...))
+		if result.Error != nil {
+			return result.Error
+		}
+		relocated += int(result.RowsAffected)
+
+		result = tx.Model(&EpisodeFile{}).
+			Where("media_id IN (?)", tx.Model(&MediaItem{}).Select("id").Where("library_id = ?", libraryID)).
+			Where("file_path = ? OR file_path LIKE ?", from, like).
+			Update("file_path", gorm.Expr(expr, args...))
+		if result.Error != nil {
+			return result.Error
+		}
+
+		expr, args = rewrite("path")
+		return tx.Model(&ScanManifestEntry{}).
+			Where("library_id = ? AND (path = ? OR path LIKE ?)", libraryID, from, like).
+			Update("path", gorm.Expr(expr, args...)).Error
+	})
+	if err != nil {
+		if pkgerrors.IsNotFound(err) {
+			return 0, err
+		}
+		return 0, fmt.Errorf("failed to relocate library: %w", err)
+	}
+
+	return relocated, nil
+}
+
+// RenameFiles points the media and episodes of renamed files at their new
+// paths, in one transaction.
+func (r *GormRepository) RenameFiles(ctx context.Context, files []domain.RenamedFile) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, file := range files {
+			var result *gorm.DB
+			if file.EpisodeID != nil {
+				result = tx.Model(&Episode{}).
+					Where("id = ? AND media_id = ? AND file_path = ?", *file.EpisodeID, file.MediaID, file.Path).
+					Update("file_path", file.NewPath)
+			} else {
+				result = tx.Model(&MediaItem{}).
+					Where("id = ? AND file_path = ?", file.MediaID, file.Path).
+					Update("file_path", file.NewPath)
+			}
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return pkgerrors.NotFound("renamed file " + file.Path + " not found")
+			}
+			if file.EpisodeID != nil {
+				err := tx.Model(&EpisodeFile{}).
+					Where("episode_id = ? AND file_path = ?", *file.EpisodeID, file.Path).
+					Update("file_path", file.NewPath).Error
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if pkgerrors.IsNotFound(err) {
+			return err
+		}
+		return fmt.Errorf("failed to rename files: %w", err)
+	}
+
+	return nil
+}
+
 // ListLibraries lists all libraries.
 func (r *GormRepository) ListLibraries(ctx context.Context, enabled *bool) ([]*domain.Library, error) {
 	query := r.db.WithContext(ctx)
@@ -149,38 +414,72 @@ func (r *GormRepository) ListLibraries(ctx context.Context, enabled *bool) ([]*d
 
 // CreateMedia creates a new media item.
 func (r *GormRepository) CreateMedia(ctx context.Context, media *models.Media) error {
-	model := &MediaItem{
-		LibraryID:      media.LibraryID,
-		Title:          media.Title,
-		MediaType:      string(media.Type),
-		Status:         media.Status,
-		FilePath:       media.FilePath,
-		FileSize:       media.FileSize,
-		FileModifiedAt: media.FileModifiedAt,
-		Description:    media.Description,
-		ReleaseDate:    &media.ReleaseDate,
-		Runtime:        media.Duration / constants.SecondsToMinutes, // Convert seconds to minutes
-		Genres:         media.Genres,
-		Tags:           media.Tags,
-		TMDBID:         media.TMDBID,
-		IMDBID:         media.IMDBID,
-		TVDBID:         media.TVDBID,
-		VideoCodec:     media.Codec,
-		AudioCodec:     "", // Not available in models.Media
-		Resolution:     media.Resolution,
-		Bitrate:        media.Bitrate,
-	}
-
+	model := toMediaModel(media)
 	if err := r.db.WithContext(ctx).Create(model).Error; err != nil {
 		return fmt.Errorf("failed to create media: %w", err)
 	}
 
-	media.ID = model.ID
-	media.CreatedAt = model.CreatedAt
-	media.UpdatedAt = model.UpdatedAt
+	copyCreatedMedia(media, model)
+	return nil
+}
+
+// CreateMediaBatch creates several media items in a single insert.
+func (r *GormRepository) CreateMediaBatch(ctx context.Context, media []*models.Media) error {
+	if len(media) == 0 {
+		return nil
+	}
+
+	items := make([]*MediaItem, len(media))
+	for i, m := range media {
+		items[i] = toMediaModel(m)
+	}
+
+	if err := r.db.WithContext(ctx).Create(&items).Error; err != nil {
+		return fmt.Errorf("failed to create media batch: %w", err)
+	}
+
+	for i, m := range media {
+		copyCreatedMedia(m, items[i])
+	}
 	return nil
 }
 
+// UpsertMediaBatch creates or updates media items by file path. Rows are
+// written in chunks of mediaUpsertChunkSize, each committed in its own
+// transaction, so a large import does not hold one long transaction. It
+// returns the number of rows written, which is less than len(media) when a
+// chunk fails.
+func (r *GormRepository) UpsertMediaBatch(ctx context.Context, media []*models.Media) (int, error) {
+	written := 0
+	for start := 0; start < len(media); start += mediaUpsertChunkSize {
+		chunk := media[start:min(start+mediaUpsertChunkSize, len(media))]
+
+		items := make([]*MediaItem, len(chunk))
+		for i, m := range chunk {
+			items[i] = toMediaModel(m)
+		}
+
+		err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return tx.Clauses(clause.OnConflict{
+				Columns:     []clause.Column{{Name: "file_path"}},
+				TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: mediaPathUniqueWhere}}},
+				DoUpdates:   clause.AssignmentColumns(mediaUpsertColumns),
+			}).Create(&items).Error
+		})
+		if err != nil {
+			return written, fmt.Errorf("failed to upsert media batch: %w", err)
+		}
+
+		// Conflicting rows keep their ID, which RETURNING copies back
+		for i, m := range chunk {
+			copyCreatedMedia(m, items[i])
+		}
+		written += len(chunk)
+	}
+
+	return written, nil
+}
+
 // GetMedia retrieves a media item by ID.
 func (r *GormRepository) GetMedia(ctx context.Context, id uuid.UUID) (*models.Media, error) {
 	var model MediaItem
@@ -207,6 +506,72 @@ func (r *GormRepository) GetMediaByPath(ctx context.Context, path string) (*mode
 	return r.toDomainMedia(&model), nil
 }
 
+// GetMediaByPaths retrieves the media items at the given file paths, keyed
+// by path. Paths without media are left out.
+func (r *GormRepository) GetMediaByPaths(ctx context.Context, paths []string) (map[string]*models.Media, error) {
+	media := make(map[string]*models.Media, len(paths))
+	if len(paths) == 0 {
+		return media, nil
+	}
+
+	var items []MediaItem
+	if err := r.db.WithContext(ctx).Where("file_path IN ?", paths).Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to get media by paths: %w", err)
+	}
+
+	for i := range items {
+		media[items[i].FilePath] = r.toDomainMedia(&items[i])
+	}
+	return media, nil
+}
+
+// GetMainMediaInDirectory gets the largest media item, other than extras,
+// whose file is directly inside dir. A non-empty nameContains further
+// requires the file name to contain it, ignoring case.
+func (r *GormRepository) GetMainMediaInDirectory(
+	ctx context.Context,
+	libraryID uuid.UUID,
+	dir string,
+	nameContains string,
+) (*models.Media, error) {
+	prefix := escapeLike(strings.TrimSuffix(dir, "/") + "/")
+
+	q := r.db.WithContext(ctx).
+		Where("library_id = ? AND parent_id IS NULL AND extra_type = ''", libraryID).
+		Where("file_path LIKE ? AND file_path NOT LIKE ?", prefix+"%", prefix+"%/%")
+	if nameContains != "" {
+		q = q.Where("file_path ILIKE ?", prefix+"%"+escapeLike(nameContains)+"%")
+	}
+
+	var model MediaItem
+	err := q.Order("file_size DESC").First(&model).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("media not found")
+		}
+		return nil, fmt.Errorf("failed to get media in directory: %w", err)
+	}
+
+	return r.toDomainMedia(&model), nil
+}
+
+// ListExtras lists the extras attached to a media item.
+func (r *GormRepository) ListExtras(ctx context.Context, parentID uuid.UUID) ([]*models.Media, error) {
+	var items []MediaItem
+	if err := r.db.WithContext(ctx).
+		Where("parent_id = ?", parentID).
+		Order("extra_type, title").
+		Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to list extras: %w", err)
+	}
+
+	extras := make([]*models.Media, len(items))
+	for i := range items {
+		extras[i] = r.toDomainMedia(&items[i])
+	}
+	return extras, nil
+}
+
 // SearchMedia searches for media items.
 func (r *GormRepository) SearchMedia(
 	ctx context.Context,
@@ -216,11 +581,18 @@ func (r *GormRepository) SearchMedia(
 	libraryID *uuid.UUID,
 	limit, offset int,
 ) ([]*models.Media, error) {
-	q := r.db.WithContext(ctx).Model(&MediaItem{})
+	// Attached extras are listed with their parent media
+	q := r.db.WithContext(ctx).Model(&MediaItem{}).Where("parent_id IS NULL")
 
-	// Search in title and original title
+	// Search in title and original title, and in the words of the search
+	// index, which also covers descriptions, genres and tags
 	if query != "" {
-		q = q.Where("title ILIKE ? OR original_title ILIKE ?", "%"+query+"%", "%"+query+"%")
+		q = q.Where(
+			"title ILIKE ? OR original_title ILIKE ? OR id IN (?)",
+			"%"+query+"%", "%"+query+"%",
+			r.db.Model(&SearchDocument{}).Select("media_id").
+				Where("document @@ plainto_tsquery('simple', ?)", query),
+		)
 	}
 
 	// Filter by media type
@@ -258,25 +630,7 @@ func (r *GormRepository) SearchMedia(
 
 // UpdateMedia updates a media item.
 func (r *GormRepository) UpdateMedia(ctx context.Context, media *models.Media) error {
-	updates := map[string]interface{}{
-		"title":            media.Title,
-		"status":           media.Status,
-		"file_path":        media.FilePath,
-		"file_size":        media.FileSize,
-		"file_modified_at": media.FileModifiedAt,
-		"description":      media.Description,
-		"release_date":     media.ReleaseDate,
-		"runtime":          media.Duration / constants.SecondsToMinutes, // Convert seconds to minutes
-		"genres":           media.Genres,
-		"tags":             media.Tags,
-		"tmdb_id":          media.TMDBID,
-		"imdb_id":          media.IMDBID,
-		"tvdb_id":          media.TVDBID,
-		"video_codec":      media.Codec,
-		"resolution":       media.Resolution,
-		"bitrate":          media.Bitrate,
-	}
-
+	updates := mediaUpdates(media)
 	result := r.db.WithContext(ctx).Model(&MediaItem{}).Where("id = ?", media.ID).Updates(updates)
 	if result.Error != nil {
 		return fmt.Errorf("failed to update media: %w", result.Error)
@@ -289,6 +643,27 @@ func (r *GormRepository) UpdateMedia(ctx context.Context, media *models.Media) e
 	return nil
 }
 
+// UpdateMediaBatch updates several media items in one transaction.
+func (r *GormRepository) UpdateMediaBatch(ctx context.Context, media []*models.Media) error {
+	if len(media) == 0 {
+		return nil
+	}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, m := range media {
+			if err := tx.Model(&MediaItem{}).Where("id = ?", m.ID).Updates(mediaUpdates(m)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update media batch: %w", err)
+	}
+
+	return nil
+}
+
 // DeleteMedia deletes a media item.
 func (r *GormRepository) DeleteMedia(ctx context.Context, id uuid.UUID) error {
 	result := r.db.WithContext(ctx).Delete(&MediaItem{}, "id = ?", id)
@@ -310,7 +685,8 @@ func (r *GormRepository) ListMediaByLibrary(
 	status *string,
 	limit, offset int,
 ) ([]*models.Media, error) {
-	q := r.db.WithContext(ctx).Model(&MediaItem{}).Where("library_id = ?", libraryID)
+	// Attached extras are listed with their parent media
+	q := r.db.WithContext(ctx).Model(&MediaItem{}).Where("library_id = ? AND parent_id IS NULL", libraryID)
 
 	if status != nil && *status != "" {
 		q = q.Where("status = ?", *status)
@@ -329,6 +705,47 @@ func (r *GormRepository) ListMediaByLibrary(
 	return media, nil
 }
 
+// ListMediaByArtist lists the media of an artist across libraries.
+func (r *GormRepository) ListMediaByArtist(ctx context.Context, artist string) ([]*models.Media, error) {
+	var items []MediaItem
+	if err := r.db.WithContext(ctx).
+		Where("LOWER(artist) = LOWER(?) AND parent_id IS NULL", artist).
+		Order("title").
+		Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to list media by artist: %w", err)
+	}
+
+	media := make([]*models.Media, len(items))
+	for i := range items {
+		media[i] = r.toDomainMedia(&items[i])
+	}
+	return media, nil
+}
+
+func (r *GormRepository) ListMediaAddedSince(
+	ctx context.Context,
+	since time.Time,
+	libraryIDs []uuid.UUID,
+	limit int,
+) ([]*models.Media, error) {
+	q := r.db.WithContext(ctx).
+		Where("created_at > ? AND status = ? AND parent_id IS NULL", since, string(models.MediaStatusAvailable))
+	if len(libraryIDs) > 0 {
+		q = q.Where("library_id IN ?", libraryIDs)
+	}
+
+	var items []MediaItem
+	if err := q.Order("created_at DESC").Limit(limit).Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to list added media: %w", err)
+	}
+
+	media := make([]*models.Media, len(items))
+	for i := range items {
+		media[i] = r.toDomainMedia(&items[i])
+	}
+	return media, nil
+}
+
 // CreateScanHistory creates a new scan history record.
 func (r *GormRepository) CreateScanHistory(ctx context.Context, scan *domain.ScanResult) error {
 	model := &ScanHistory{
@@ -369,6 +786,21 @@ func (r *GormRepository) UpdateScanHistory(ctx context.Context, scan *domain.Sca
 	return nil
 }
 
+// InterruptScans completes every scan that never completed.
+func (r *GormRepository) InterruptScans(ctx context.Context, reason string) (int, error) {
+	result := r.db.WithContext(ctx).Model(&ScanHistory{}).
+		Where("completed_at IS NULL").
+		Updates(map[string]interface{}{
+			"completed_at":  time.Now(),
+			"error_message": reason,
+		})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to interrupt scans: %w", result.Error)
+	}
+
+	return int(result.RowsAffected), nil
+}
+
 // GetLatestScan gets the latest scan for a library.
 func (r *GormRepository) GetLatestScan(ctx context.Context, libraryID uuid.UUID) (*domain.ScanResult, error) {
 	var model ScanHistory
@@ -382,17 +814,77 @@ func (r *GormRepository) GetLatestScan(ctx context.Context, libraryID uuid.UUID)
 	return r.toDomainScanResult(&model), nil
 }
 
-// CreateEpisode creates a new episode.
+// GetScanManifest gets the directory manifest of a library's last scan.
+func (r *GormRepository) GetScanManifest(ctx context.Context, libraryID uuid.UUID) (domain.ScanManifest, error) {
+	var entries []ScanManifestEntry
+	if err := r.db.WithContext(ctx).Where("library_id = ?", libraryID).Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("failed to get scan manifest: %w", err)
+	}
+
+	manifest := make(domain.ScanManifest, len(entries))
+	for _, entry := range entries {
+		manifest[entry.Path] = domain.DirectoryState{
+			Path:    entry.Path,
+			ModTime: entry.ModTime,
+			Size:    entry.Size,
+			Files:   entry.Files,
+		}
+	}
+
+	return manifest, nil
+}
+
+// SaveScanManifest replaces the directory manifest of a library.
+func (r *GormRepository) SaveScanManifest(
+	ctx context.Context,
+	libraryID uuid.UUID,
+	manifest domain.ScanManifest,
+) error {
+	entries := make([]ScanManifestEntry, 0, len(manifest))
+	for _, state := range manifest {
+		entries = append(entries, ScanManifestEntry{
+			LibraryID: libraryID,
+			Path:      state.Path,
+			ModTime:   state.ModTime,
+			Size:      state.Size,
+			Files:     state.Files,
+		})
+	}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("library_id = ?", libraryID).Delete(&ScanManifestEntry{}).Error; err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(entries, 500).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save scan manifest: %w", err)
+	}
+
+	return nil
+}
+
+// CreateEpisode creates a new episode, in the tenant of its media.
 func (r *GormRepository) CreateEpisode(ctx context.Context, episode *models.Episode) error {
+	tenantID, err := r.mediaTenant(ctx, episode.MediaID)
+	if err != nil {
+		return err
+	}
+
 	model := &Episode{
-		MediaID:       episode.MediaID,
-		SeasonNumber:  episode.SeasonNumber,
-		EpisodeNumber: episode.EpisodeNumber,
-		Title:         episode.Title,
-		AirDate:       &episode.AirDate,
-		Runtime:       episode.Duration / constants.SecondsToMinutes, // Convert seconds to minutes
-		FilePath:      episode.Path,
-		Status:        "available", // Default status
+		TenantID:       tenantID,
+		MediaID:        episode.MediaID,
+		SeasonNumber:   episode.SeasonNumber,
+		EpisodeNumber:  episode.EpisodeNumber,
+		AbsoluteNumber: episode.AbsoluteNumber,
+		Title:          episode.Title,
+		AirDate:        &episode.AirDate,
+		Runtime:        episode.Duration / constants.SecondsToMinutes, // Convert seconds to minutes
+		FilePath:       episode.Path,
+		Status:         "available", // Default status
 	}
 
 	if err := r.db.WithContext(ctx).Create(model).Error; err != nil {
@@ -471,11 +963,12 @@ func (r *GormRepository) ListEpisodesBySeason(
 // UpdateEpisode updates an episode.
 func (r *GormRepository) UpdateEpisode(ctx context.Context, episode *models.Episode) error {
 	updates := map[string]interface{}{
-		"title":     episode.Title,
-		"air_date":  episode.AirDate,
-		"runtime":   episode.Duration / constants.SecondsToMinutes, // Convert seconds to minutes
-		"file_path": episode.Path,
-		"status":    "available", // Default status
+		"title":           episode.Title,
+		"absolute_number": episode.AbsoluteNumber,
+		"air_date":        episode.AirDate,
+		"runtime":         episode.Duration / constants.SecondsToMinutes, // Convert seconds to minutes
+		"file_path":       episode.Path,
+		"status":          "available", // Default status
 	}
 
 	result := r.db.WithContext(ctx).Model(&Episode{}).Where("id = ?", episode.ID).Updates(updates)
@@ -504,6 +997,97 @@ func (r *GormRepository) DeleteEpisode(ctx context.Context, id uuid.UUID) error
 	return nil
 }
 
+// ListEpisodeFiles lists the files of the episodes of a media item, by path
+// and part.
+func (r *GormRepository) ListEpisodeFiles(ctx context.Context, mediaID uuid.UUID) ([]*models.EpisodeFile, error) {
+	var rows []struct {
+		ID        *uuid.UUID
+		EpisodeID uuid.UUID
+		MediaID   uuid.UUID
+		FilePath  string
+		Part      int
+		Duration  int
+	}
+	err := r.db.WithContext(ctx).Raw(`
+		SELECT f.id, f.episode_id, f.media_id, f.file_path, f.part, f.duration
+		FROM episode_files f JOIN episodes e ON e.id = f.episode_id
+		WHERE f.media_id = ? AND e.deleted_at IS NULL
+		UNION ALL
+		SELECT NULL::uuid, e.id, e.media_id, e.file_path, 0, 0
+		FROM episodes e
+		WHERE e.media_id = ? AND e.file_path <> '' AND e.deleted_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM episode_files f WHERE f.episode_id = e.id)
+		ORDER BY file_path, part
+	`, mediaID, mediaID).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list episode files: %w", err)
+	}
+
+	files := make([]*models.EpisodeFile, len(rows))
+	for i, row := range rows {
+		files[i] = &models.EpisodeFile{
+			EpisodeID: row.EpisodeID,
+			MediaID:   row.MediaID,
+			Path:      row.FilePath,
+			Part:      row.Part,
+			Duration:  row.Duration,
+		}
+		if row.ID != nil {
+			files[i].ID = *row.ID
+		}
+	}
+
+	return files, nil
+}
+
+// SetEpisodeFiles replaces the files of an episode and points the episode at
+// the first, in one transaction.
+func (r *GormRepository) SetEpisodeFiles(ctx context.Context, episodeID uuid.UUID, files []*models.EpisodeFile) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var episode Episode
+		if err := tx.First(&episode, "id = ?", episodeID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return pkgerrors.NotFound("episode not found")
+			}
+			return err
+		}
+
+		if err := tx.Where("episode_id = ?", episodeID).Delete(&EpisodeFile{}).Error; err != nil {
+			return err
+		}
+
+		path := ""
+		for _, file := range files {
+			model := &EpisodeFile{
+				EpisodeID: episodeID,
+				MediaID:   episode.MediaID,
+				FilePath:  file.Path,
+				Part:      file.Part,
+				Duration:  file.Duration,
+			}
+			if err := tx.Create(model).Error; err != nil {
+				return err
+			}
+			file.ID = model.ID
+			file.EpisodeID = episodeID
+			file.MediaID = episode.MediaID
+			if path == "" {
+				path = file.Path
+			}
+		}
+
+		return tx.Model(&Episode{}).Where("id = ?", episodeID).Update("file_path", path).Error
+	})
+	if err != nil {
+		if pkgerrors.IsNotFound(err) {
+			return err
+		}
+		return fmt.Errorf("failed to set episode files: %w", err)
+	}
+
+	return nil
+}
+
 // CreateProvider creates a new metadata provider.
 func (r *GormRepository) CreateProvider(ctx context.Context, provider *domain.MetadataProviderConfig) error {
 	// Encrypt the API key before storing
@@ -627,129 +1211,3222 @@ func (r *GormRepository) DeleteProvider(ctx context.Context, id uuid.UUID) error
 	return nil
 }
 
-// Transaction support.
-func (r *GormRepository) BeginTx(ctx context.Context) (Repository, error) {
-	tx := r.db.WithContext(ctx).Begin()
-	if tx.Error != nil {
-		return nil, fmt.Errorf("failed to begin transaction: %w", tx.Error)
+// ListWatchStatesByMedia lists all users' watch states for a media item.
+func (r *GormRepository) ListWatchStatesByMedia(ctx context.Context, mediaID uuid.UUID) ([]*models.WatchHistory, error) {
+	var items []WatchState
+	if err := r.db.WithContext(ctx).Where("media_id = ?", mediaID).Order("last_watched DESC").Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to list watch states: %w", err)
 	}
 
-	return &GormRepository{db: tx}, nil
-}
+	states := make([]*models.WatchHistory, len(items))
+	for i := range items {
+		states[i] = r.toDomainWatchState(&items[i])
+	}
 
-func (r *GormRepository) Commit() error {
-	return r.db.Commit().Error
+	return states, nil
+}
+
+// ListWatchStatesByUser lists a user's watch states, most recent first.
+func (r *GormRepository) ListWatchStatesByUser(ctx context.Context, userID uuid.UUID) ([]*models.WatchHistory, error) {
+	var items []WatchState
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("last_watched DESC").Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to list watch states: %w", err)
+	}
+
+	states := make([]*models.WatchHistory, len(items))
+	for i := range items {
+		states[i] = r.toDomainWatchState(&items[i])
+	}
+
+	return states, nil
+}
+
+// ListWatchStatesSince lists up to limit watch states of every user that
+// are not completed and were updated after since, most recent first.
+func (r *GormRepository) ListWatchStatesSince(ctx context.Context, since time.Time, limit int) ([]*models.WatchHistory, error) {
+	var items []WatchState
+	if err := r.db.WithContext(ctx).
+		Where("completed = ? AND last_watched > ?", false, since).
+		Order("last_watched DESC").Limit(limit).
+		Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to list watch states: %w", err)
+	}
+
+	states := make([]*models.WatchHistory, len(items))
+	for i := range items {
+		states[i] = r.toDomainWatchState(&items[i])
+	}
+
+	return states, nil
+}
+
+// AnonymizeWatchStates moves a user's watch states to a new random user ID.
+func (r *GormRepository) AnonymizeWatchStates(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result := r.db.WithContext(ctx).Model(&WatchState{}).
+		Where("user_id = ?", userID).
+		Update("user_id", uuid.New())
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to anonymize watch states: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// AddToWatchlist adds media to a user's watchlist. Adding media that is on
+// it already does nothing.
+func (r *GormRepository) AddToWatchlist(ctx context.Context, entry *domain.WatchlistEntry) error {
+	model := &WatchlistEntry{UserID: entry.UserID, MediaID: entry.MediaID}
+	if err := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(model).Error; err != nil {
+		return fmt.Errorf("failed to add to watchlist: %w", err)
+	}
+
+	entry.AddedAt = model.CreatedAt
+	return nil
+}
+
+// RemoveFromWatchlist removes media from a user's watchlist.
+func (r *GormRepository) RemoveFromWatchlist(ctx context.Context, userID, mediaID uuid.UUID) error {
+	result := r.db.WithContext(ctx).Delete(&WatchlistEntry{}, "user_id = ? AND media_id = ?", userID, mediaID)
+	if result.Error != nil {
+		return fmt.Errorf("failed to remove from watchlist: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return pkgerrors.NotFound("media is not on the watchlist")
+	}
+
+	return nil
+}
+
+// ListWatchlist lists a user's watchlist, most recently added first.
+func (r *GormRepository) ListWatchlist(ctx context.Context, userID uuid.UUID) ([]*domain.WatchlistEntry, error) {
+	var items []WatchlistEntry
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to list watchlist: %w", err)
+	}
+
+	entries := make([]*domain.WatchlistEntry, len(items))
+	for i, item := range items {
+		entries[i] = &domain.WatchlistEntry{UserID: item.UserID, MediaID: item.MediaID, AddedAt: item.CreatedAt}
+	}
+	return entries, nil
+}
+
+// DeleteWatchlist empties a user's watchlist.
+func (r *GormRepository) DeleteWatchlist(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result := r.db.WithContext(ctx).Delete(&WatchlistEntry{}, "user_id = ?", userID)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete watchlist: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// UpsertWatchState creates or updates the watch state for a user and media item.
+func (r *GormRepository) UpsertWatchState(ctx context.Context, state *models.WatchHistory) error {
+	q := r.db.WithContext(ctx).Where("user_id = ? AND media_id = ?", state.UserID, state.MediaID)
+	if state.EpisodeID != nil {
+		q = q.Where("episode_id = ?", *state.EpisodeID)
+	} else {
+		q = q.Where("episode_id IS NULL")
+	}
+
+	var model WatchState
+	err := q.First(&model).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to get watch state: %w", err)
+	}
+
+	if model.ID == uuid.Nil {
+		if model.TenantID, err = r.mediaTenant(ctx, state.MediaID); err != nil {
+			return err
+		}
+	}
+	model.UserID = state.UserID
+	model.MediaID = state.MediaID
+	model.EpisodeID = state.EpisodeID
+	model.Position = state.Position
+	model.Duration = state.Duration
+	model.Completed = state.Completed
+	model.LastWatched = state.LastWatched
+
+	if err := r.db.WithContext(ctx).Save(&model).Error; err != nil {
+		return fmt.Errorf("failed to save watch state: %w", err)
+	}
+
+	state.ID = model.ID
+	return nil
+}
+
+// mediaTenant returns the tenant of a media item, which the rows that
+// belong to it, such as episodes and watch states, are created in. Rows
+// created by background jobs have no tenant in their context to take.
+func (r *GormRepository) mediaTenant(ctx context.Context, mediaID uuid.UUID) (uuid.UUID, error) {
+	var media MediaItem
+	if err := r.db.WithContext(ctx).Select("tenant_id").First(&media, "id = ?", mediaID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return uuid.Nil, pkgerrors.NotFound("media not found")
+		}
+		return uuid.Nil, fmt.Errorf("failed to get media tenant: %w", err)
+	}
+	return media.TenantID, nil
+}
+
+// CreateWorkflow creates a new workflow record.
+func (r *GormRepository) CreateWorkflow(ctx context.Context, wf *saga.Workflow) error {
+	if err := r.db.WithContext(ctx).Create(toWorkflowModel(wf)).Error; err != nil {
+		return fmt.Errorf("failed to create workflow: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateWorkflow saves the progress of a workflow.
+func (r *GormRepository) UpdateWorkflow(ctx context.Context, wf *saga.Workflow) error {
+	if err := r.db.WithContext(ctx).Save(toWorkflowModel(wf)).Error; err != nil {
+		return fmt.Errorf("failed to update workflow: %w", err)
+	}
+
+	return nil
+}
+
+// GetLatestWorkflow gets the most recent workflow of a media item.
+func (r *GormRepository) GetLatestWorkflow(ctx context.Context, mediaID uuid.UUID) (*saga.Workflow, error) {
+	var model Workflow
+	if err := r.db.WithContext(ctx).Where("media_id = ?", mediaID).Order("created_at DESC").First(&model).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("workflow not found")
+		}
+		return nil, fmt.Errorf("failed to get workflow: %w", err)
+	}
+
+	return r.toDomainWorkflow(&model), nil
+}
+
+// InterruptWorkflows fails every running or compensating workflow. Steps
+// that were interrupted keep their status, so the timeline shows where the
+// workflow stopped.
+func (r *GormRepository) InterruptWorkflows(ctx context.Context, reason string) (int, error) {
+	statuses := []string{string(saga.WorkflowStatusRunning), string(saga.WorkflowStatusCompensating)}
+	result := r.db.WithContext(ctx).Model(&Workflow{}).
+		Where("status IN ?", statuses).
+		Updates(map[string]interface{}{
+			"status":     string(saga.WorkflowStatusFailed),
+			"error":      reason,
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to interrupt workflows: %w", result.Error)
+	}
+
+	return int(result.RowsAffected), nil
+}
+
+// ArchiveWorkflows moves finished workflows the retention policy no longer
+// keeps to the workflow history.
+func (r *GormRepository) ArchiveWorkflows(
+	ctx context.Context,
+	finishedBefore time.Time,
+	keepPerMedia, limit int,
+) (int, error) {
+	statuses := make([]string, len(domain.FinishedWorkflowStatuses))
+	for i, status := range domain.FinishedWorkflowStatuses {
+		statuses[i] = string(status)
+	}
+
+	archived := 0
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var expired []Workflow
+		if err := tx.Raw(`
+			SELECT * FROM (
+				SELECT *, ROW_NUMBER() OVER (PARTITION BY media_id ORDER BY created_at DESC) AS position
+				FROM workflows
+				WHERE status IN ?
+			) ranked
+			WHERE position > ? AND updated_at < ?
+			ORDER BY updated_at
+			LIMIT ?`,
+			statuses, keepPerMedia, finishedBefore, limit,
+		).Scan(&expired).Error; err != nil {
+			return fmt.Errorf("failed to find expired workflows: %w", err)
+		}
+		if len(expired) == 0 {
+			return nil
+		}
+
+		now := time.Now()
+		history := make([]*WorkflowHistory, len(expired))
+		ids := make([]uuid.UUID, len(expired))
+		for i := range expired {
+			entry, err := toWorkflowHistoryModel(&expired[i], now)
+			if err != nil {
+				return err
+			}
+			history[i] = entry
+			ids[i] = expired[i].ID
+		}
+
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(history).Error; err != nil {
+			return fmt.Errorf("failed to archive workflows: %w", err)
+		}
+		if err := tx.Where("id IN ?", ids).Delete(&Workflow{}).Error; err != nil {
+			return fmt.Errorf("failed to delete archived workflows: %w", err)
+		}
+
+		archived = len(expired)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return archived, nil
+}
+
+// ListWorkflowHistory lists archived workflows, most recently finished first.
+func (r *GormRepository) ListWorkflowHistory(
+	ctx context.Context,
+	filter domain.WorkflowHistoryFilter,
+	limit, offset int,
+) ([]*saga.Workflow, error) {
+	query := r.db.WithContext(ctx).Model(&WorkflowHistory{})
+	if filter.MediaID != nil {
+		query = query.Where("media_id = ?", *filter.MediaID)
+	}
+	if filter.Status != nil {
+		query = query.Where("status = ?", string(*filter.Status))
+	}
+	if filter.FinishedAfter != nil {
+		query = query.Where("finished_at >= ?", *filter.FinishedAfter)
+	}
+	if filter.FinishedBefore != nil {
+		query = query.Where("finished_at < ?", *filter.FinishedBefore)
+	}
+
+	var entries []WorkflowHistory
+	if err := query.Order("finished_at DESC").Limit(limit).Offset(offset).Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("failed to list workflow history: %w", err)
+	}
+
+	workflows := make([]*saga.Workflow, len(entries))
+	for i := range entries {
+		wf, err := toDomainWorkflowHistory(&entries[i])
+		if err != nil {
+			return nil, err
+		}
+		workflows[i] = wf
+	}
+
+	return workflows, nil
+}
+
+// CreateTranscodePolicy creates a transcode policy.
+func (r *GormRepository) CreateTranscodePolicy(ctx context.Context, policy *domain.TranscodePolicy) error {
+	model := &TranscodePolicy{
+		LibraryID: policy.LibraryID,
+		Name:      policy.Name,
+		Profile:   policy.Profile,
+		Format:    policy.Format,
+		Enabled:   policy.Enabled,
+
+		AudioNormalization: string(policy.AudioNormalization),
+	}
+
+	if err := r.db.WithContext(ctx).Create(model).Error; err != nil {
+		return fmt.Errorf("failed to create transcode policy: %w", err)
+	}
+
+	policy.ID = model.ID
+	policy.CreatedAt = model.CreatedAt
+	policy.UpdatedAt = model.UpdatedAt
+	return nil
+}
+
+// GetTranscodePolicy retrieves a transcode policy by ID.
+func (r *GormRepository) GetTranscodePolicy(ctx context.Context, id uuid.UUID) (*domain.TranscodePolicy, error) {
+	var model TranscodePolicy
+	if err := r.db.WithContext(ctx).First(&model, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("transcode policy not found")
+		}
+		return nil, fmt.Errorf("failed to get transcode policy: %w", err)
+	}
+
+	return toDomainTranscodePolicy(&model), nil
+}
+
+// ListTranscodePolicies lists the transcode policies of a library.
+func (r *GormRepository) ListTranscodePolicies(
+	ctx context.Context,
+	libraryID uuid.UUID,
+) ([]*domain.TranscodePolicy, error) {
+	var items []TranscodePolicy
+	if err := r.db.WithContext(ctx).Where("library_id = ?", libraryID).Order("created_at").Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to list transcode policies: %w", err)
+	}
+
+	policies := make([]*domain.TranscodePolicy, len(items))
+	for i := range items {
+		policies[i] = toDomainTranscodePolicy(&items[i])
+	}
+
+	return policies, nil
+}
+
+// UpdateTranscodePolicy updates a transcode policy.
+func (r *GormRepository) UpdateTranscodePolicy(ctx context.Context, policy *domain.TranscodePolicy) error {
+	updates := map[string]interface{}{
+		"name":    policy.Name,
+		"profile": policy.Profile,
+		"format":  policy.Format,
+		"enabled": policy.Enabled,
+
+		"audio_normalization": string(policy.AudioNormalization),
+	}
+
+	result := r.db.WithContext(ctx).Model(&TranscodePolicy{}).Where("id = ?", policy.ID).Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update transcode policy: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return pkgerrors.NotFound("transcode policy not found")
+	}
+
+	return nil
+}
+
+// DeleteTranscodePolicy deletes a transcode policy. Its requests are kept,
+// so recreating the policy does not request the same transcodes again.
+func (r *GormRepository) DeleteTranscodePolicy(ctx context.Context, id uuid.UUID) error {
+	result := r.db.WithContext(ctx).Delete(&TranscodePolicy{}, "id = ?", id)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete transcode policy: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return pkgerrors.NotFound("transcode policy not found")
+	}
+
+	return nil
+}
+
+// ClaimTranscode records a transcode of a media item. Concurrent claims of
+// the same transcode race on the primary key, so only one of them wins.
+func (r *GormRepository) ClaimTranscode(
+	ctx context.Context,
+	mediaID, policyID uuid.UUID,
+	key string,
+	priority domain.TranscodePriority,
+) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&TranscodeRequest{MediaID: mediaID, Key: key, PolicyID: policyID, Priority: string(priority)})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to claim transcode: %w", result.Error)
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+// ListTranscodeRequests lists a page of the requested transcodes, most
+// recent first.
+func (r *GormRepository) ListTranscodeRequests(ctx context.Context, limit, offset int) ([]*domain.TranscodeRequest, error) {
+	var items []TranscodeRequest
+	if err := r.db.WithContext(ctx).
+		Order("created_at DESC, media_id, key").
+		Limit(limit).Offset(offset).
+		Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to list transcode requests: %w", err)
+	}
+
+	requests := make([]*domain.TranscodeRequest, len(items))
+	for i, item := range items {
+		requests[i] = &domain.TranscodeRequest{
+			MediaID:   item.MediaID,
+			PolicyID:  item.PolicyID,
+			Key:       item.Key,
+			Priority:  domain.TranscodePriority(item.Priority),
+			CreatedAt: item.CreatedAt,
+		}
+	}
+	return requests, nil
+}
+
+// SetTranscodePriority records the priority a requested transcode was
+// given.
+func (r *GormRepository) SetTranscodePriority(
+	ctx context.Context,
+	mediaID uuid.UUID,
+	key string,
+	priority domain.TranscodePriority,
+) error {
+	result := r.db.WithContext(ctx).Model(&TranscodeRequest{}).
+		Where("media_id = ? AND key = ?", mediaID, key).
+		Update("priority", string(priority))
+	if result.Error != nil {
+		return fmt.Errorf("failed to set transcode priority: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return pkgerrors.NotFound("transcode request not found")
+	}
+
+	return nil
+}
+
+// transcodePrioritySignals is a row of the transcode priority signals
+// query.
+type transcodePrioritySignals struct {
+	MediaID     uuid.UUID
+	AddedAt     time.Time
+	Genres      []string `gorm:"type:text[]"`
+	Watchlisted int64
+	Watching    int64
+	Plays       int64
+}
+
+// GetTranscodePrioritySignals returns what hints at each of the media being
+// watched soon. Watching counts the users who watched episodes since since;
+// plays counts every user who watched the media since since.
+func (r *GormRepository) GetTranscodePrioritySignals(
+	ctx context.Context,
+	mediaIDs []uuid.UUID,
+	since time.Time,
+) ([]*domain.TranscodePrioritySignals, error) {
+	if len(mediaIDs) == 0 {
+		return nil, nil
+	}
+
+	var rows []transcodePrioritySignals
+	if err := r.db.WithContext(ctx).Table("media_items m").
+		Select(`m.id AS media_id, m.created_at AS added_at, m.genres,
+			(SELECT COUNT(*) FROM watchlist_entries l WHERE l.media_id = m.id) AS watchlisted,
+			(SELECT COUNT(DISTINCT w.user_id) FROM watch_states w
+				WHERE w.media_id = m.id AND w.episode_id IS NOT NULL AND w.last_watched >= ?) AS watching,
+			(SELECT COUNT(DISTINCT w.user_id) FROM watch_states w
+				WHERE w.media_id = m.id AND w.last_watched >= ?) AS plays`, since, since).
+		Where("m.id IN ? AND m.deleted_at IS NULL", mediaIDs).
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to get transcode priority signals: %w", err)
+	}
+
+	signals := make([]*domain.TranscodePrioritySignals, len(rows))
+	for i, row := range rows {
+		signals[i] = &domain.TranscodePrioritySignals{
+			MediaID:     row.MediaID,
+			AddedAt:     row.AddedAt,
+			Genres:      row.Genres,
+			Watchlisted: row.Watchlisted,
+			Watching:    row.Watching,
+			Plays:       row.Plays,
+		}
+	}
+	return signals, nil
+}
+
+// ListPopularGenres lists the genres of the media most users watched since
+// since, most watched first.
+func (r *GormRepository) ListPopularGenres(ctx context.Context, since time.Time, limit int) ([]string, error) {
+	var genres []string
+	if err := r.db.WithContext(ctx).Table("watch_states w").
+		Select("g.genre").
+		Joins("JOIN media_items m ON m.id = w.media_id AND m.deleted_at IS NULL").
+		Joins("CROSS JOIN LATERAL unnest(m.genres) AS g(genre)").
+		Where("w.last_watched >= ?", since).
+		Group("g.genre").
+		Order("COUNT(DISTINCT w.user_id) DESC, g.genre").
+		Limit(limit).
+		Pluck("g.genre", &genres).Error; err != nil {
+		return nil, fmt.Errorf("failed to list popular genres: %w", err)
+	}
+
+	return genres, nil
+}
+
+// GetTranscodeOutput retrieves the completed transcode of a source with a
+// profile.
+func (r *GormRepository) GetTranscodeOutput(
+	ctx context.Context,
+	sourceHash, profileHash string,
+) (*domain.TranscodeOutput, error) {
+	var model TranscodeOutput
+	if err := r.db.WithContext(ctx).
+		First(&model, "source_hash = ? AND profile_hash = ?", sourceHash, profileHash).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("transcode output not found")
+		}
+		return nil, fmt.Errorf("failed to get transcode output: %w", err)
+	}
+
+	return &domain.TranscodeOutput{
+		SourceHash:  model.SourceHash,
+		ProfileHash: model.ProfileHash,
+		MediaID:     model.MediaID,
+		Path:        model.Path,
+		Size:        model.Size,
+		CompletedAt: model.CompletedAt,
+	}, nil
+}
+
+// SaveTranscodeOutput records a completed transcode, replacing the one of
+// the same source and profile.
+func (r *GormRepository) SaveTranscodeOutput(ctx context.Context, output *domain.TranscodeOutput) error {
+	model := &TranscodeOutput{
+		SourceHash:  output.SourceHash,
+		ProfileHash: output.ProfileHash,
+		MediaID:     output.MediaID,
+		Path:        output.Path,
+		Size:        output.Size,
+		CompletedAt: output.CompletedAt,
+	}
+	if err := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(model).Error; err != nil {
+		return fmt.Errorf("failed to save transcode output: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteTranscodeOutput deletes the completed transcode of a source with a
+// profile.
+func (r *GormRepository) DeleteTranscodeOutput(ctx context.Context, sourceHash, profileHash string) error {
+	if err := r.db.WithContext(ctx).
+		Delete(&TranscodeOutput{}, "source_hash = ? AND profile_hash = ?", sourceHash, profileHash).Error; err != nil {
+		return fmt.Errorf("failed to delete transcode output: %w", err)
+	}
+
+	return nil
+}
+
+// InvalidateTranscodeOutputs deletes the transcodes of a media item made
+// from a source other than keepSourceHash; empty deletes them all.
+func (r *GormRepository) InvalidateTranscodeOutputs(
+	ctx context.Context,
+	mediaID uuid.UUID,
+	keepSourceHash string,
+) (int, error) {
+	result := r.db.WithContext(ctx).
+		Where("media_id = ? AND source_hash <> ?", mediaID, keepSourceHash).
+		Delete(&TranscodeOutput{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to invalidate transcode outputs: %w", result.Error)
+	}
+
+	return int(result.RowsAffected), nil
+}
+
+// GetLoudnessMeasurement retrieves the measured loudness of a source.
+func (r *GormRepository) GetLoudnessMeasurement(
+	ctx context.Context,
+	sourceHash string,
+) (*domain.LoudnessMeasurement, error) {
+	var model LoudnessMeasurement
+	if err := r.db.WithContext(ctx).First(&model, "source_hash = ?", sourceHash).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("loudness measurement not found")
+		}
+		return nil, fmt.Errorf("failed to get loudness measurement: %w", err)
+	}
+
+	return &domain.LoudnessMeasurement{
+		SourceHash: model.SourceHash,
+		Loudness: loudness.Measurement{
+			Integrated:   model.Integrated,
+			TruePeak:     model.TruePeak,
+			Range:        model.Range,
+			Threshold:    model.Threshold,
+			TargetOffset: model.TargetOffset,
+		},
+		MeasuredAt: model.MeasuredAt,
+	}, nil
+}
+
+// SaveLoudnessMeasurement records the measured loudness of a source,
+// replacing the one measured before.
+func (r *GormRepository) SaveLoudnessMeasurement(ctx context.Context, measurement *domain.LoudnessMeasurement) error {
+	model := &LoudnessMeasurement{
+		SourceHash:   measurement.SourceHash,
+		Integrated:   measurement.Loudness.Integrated,
+		TruePeak:     measurement.Loudness.TruePeak,
+		Range:        measurement.Loudness.Range,
+		Threshold:    measurement.Loudness.Threshold,
+		TargetOffset: measurement.Loudness.TargetOffset,
+		MeasuredAt:   measurement.MeasuredAt,
+	}
+	if err := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(model).Error; err != nil {
+		return fmt.Errorf("failed to save loudness measurement: %w", err)
+	}
+
+	return nil
+}
+
+// CreateTask records a new task.
+func (r *GormRepository) CreateTask(ctx context.Context, t *task.Task) error {
+	if err := r.db.WithContext(ctx).Create(toTaskModel(t)).Error; err != nil {
+		return fmt.Errorf("failed to create task: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateTask saves the progress of a task.
+func (r *GormRepository) UpdateTask(ctx context.Context, t *task.Task) error {
+	if err := r.db.WithContext(ctx).Save(toTaskModel(t)).Error; err != nil {
+		return fmt.Errorf("failed to update task: %w", err)
+	}
+
+	return nil
+}
+
+// GetTask gets a task by ID.
+func (r *GormRepository) GetTask(ctx context.Context, id uuid.UUID) (*task.Task, error) {
+	var model Task
+	if err := r.db.WithContext(ctx).First(&model, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("task not found")
+		}
+		return nil, fmt.Errorf("failed to get task: %w", err)
+	}
+
+	return toDomainTask(&model), nil
+}
+
+// ListTasks lists tasks, newest first.
+func (r *GormRepository) ListTasks(
+	ctx context.Context,
+	filter task.Filter,
+	limit, offset int,
+) ([]*task.Task, error) {
+	query := r.db.WithContext(ctx).Model(&Task{})
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", string(filter.Status))
+	}
+
+	var entries []Task
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("failed to list tasks: %w", err)
+	}
+
+	tasks := make([]*task.Task, len(entries))
+	for i := range entries {
+		tasks[i] = toDomainTask(&entries[i])
+	}
+
+	return tasks, nil
+}
+
+// InterruptTasks fails every task that is still pending or running.
+func (r *GormRepository) InterruptTasks(ctx context.Context, reason string) (int, error) {
+	now := time.Now()
+	result := r.db.WithContext(ctx).Model(&Task{}).
+		Where("status IN ?", []string{string(task.StatusPending), string(task.StatusRunning)}).
+		Updates(map[string]interface{}{
+			"status":       string(task.StatusFailed),
+			"error":        reason,
+			"completed_at": now,
+			"updated_at":   now,
+		})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to interrupt tasks: %w", result.Error)
+	}
+
+	return int(result.RowsAffected), nil
+}
+
+// Transaction support.
+func (r *GormRepository) BeginTx(ctx context.Context) (Repository, error) {
+	tx := r.db.WithContext(ctx).Begin()
+	if tx.Error != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", tx.Error)
+	}
+
+	return &GormRepository{db: tx}, nil
+}
+
+func (r *GormRepository) Commit() error {
+	return r.db.Commit().Error
 }
 
 func (r *GormRepository) Rollback() error {
 	return r.db.Rollback().Error
 }
 
-// Helper methods to convert between database and domain models.
-func (r *GormRepository) toDomainLibrary(model *Library) *domain.Library {
-	lib := &domain.Library{
-		ID:           model.ID,
-		Name:         model.Name,
-		Path:         model.Path,
-		Type:         model.MediaType,
-		Enabled:      model.Enabled,
-		ScanInterval: model.ScanInterval,
-		CreatedAt:    model.CreatedAt,
-		UpdatedAt:    model.UpdatedAt,
+// likeEscaper escapes the LIKE wildcards in a literal pattern prefix.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+func toMediaModel(media *models.Media) *MediaItem {
+	return &MediaItem{
+		ID:             media.ID,
+		TenantID:       media.TenantID,
+		LibraryID:      media.LibraryID,
+		Title:          media.Title,
+		Artist:         media.Artist,
+		MediaType:      string(media.Type),
+		Status:         media.Status,
+		FilePath:       media.FilePath,
+		FileSize:       media.FileSize,
+		FileModifiedAt: media.FileModifiedAt,
+		ParentID:       media.ParentID,
+		EpisodeID:      media.EpisodeID,
+		ExtraType:      media.ExtraType,
+		ThemeKey:       media.ThemeKey,
+		ThemeURL:       media.ThemeURL,
+		Description:    media.Description,
+		ReleaseDate:    &media.ReleaseDate,
+		Runtime:        media.Duration / constants.SecondsToMinutes, // Convert seconds to minutes
+		Genres:         media.Genres,
+		Tags:           media.Tags,
+		TMDBID:         media.TMDBID,
+		IMDBID:         media.IMDBID,
+		TVDBID:         media.TVDBID,
+		VideoCodec:     media.Codec,
+		AudioCodec:     "", // Not available in models.Media
+		Resolution:     media.Resolution,
+		Bitrate:        media.Bitrate,
+		// Monitored is left to the column default: new media are monitored
+		DigitalReleaseDate:  media.DigitalReleaseDate,
+		PhysicalReleaseDate: media.PhysicalReleaseDate,
+	}
+}
+
+// copyCreatedMedia copies the database-assigned fields of a created row
+// back onto the media item.
+func copyCreatedMedia(media *models.Media, model *MediaItem) {
+	media.ID = model.ID
+	media.TenantID = model.TenantID
+	media.CreatedAt = model.CreatedAt
+	media.UpdatedAt = model.UpdatedAt
+	media.Monitored = model.Monitored
+}
+
+// mediaUpsertChunkSize is the number of rows UpsertMediaBatch writes per
+// statement and transaction.
+const mediaUpsertChunkSize = 500
+
+// mediaPathUniqueWhere is the predicate of the unique index on media file
+// paths. ON CONFLICT must repeat it to infer the index.
+const mediaPathUniqueWhere = "file_path <> '' AND deleted_at IS NULL"
+
+// mediaUpsertColumns are the columns UpsertMediaBatch overwrites when a row
+// with the same file path exists. They match mediaUpdates, less the calendar
+// columns scans know nothing about.
+var mediaUpsertColumns = []string{
+	"title", "artist", "status", "file_size", "file_modified_at", "parent_id", "episode_id",
+	"extra_type", "theme_key", "theme_url", "description", "release_date", "runtime",
+	"genres", "tags", "tmdb_id", "imdb_id", "tvdb_id", "video_codec", "resolution",
+	"bitrate", "updated_at",
+}
+
+func mediaUpdates(media *models.Media) map[string]interface{} {
+	return map[string]interface{}{
+		"title":            media.Title,
+		"artist":           media.Artist,
+		"status":           media.Status,
+		"file_path":        media.FilePath,
+		"file_size":        media.FileSize,
+		"file_modified_at": media.FileModifiedAt,
+		"parent_id":        media.ParentID,
+		"episode_id":       media.EpisodeID,
+		"extra_type":       media.ExtraType,
+		"theme_key":        media.ThemeKey,
+		"theme_url":        media.ThemeURL,
+		"description":      media.Description,
+		"release_date":     media.ReleaseDate,
+		"runtime":          media.Duration / constants.SecondsToMinutes, // Convert seconds to minutes
+		"genres":           media.Genres,
+		"tags":             media.Tags,
+		"tmdb_id":          media.TMDBID,
+		"imdb_id":          media.IMDBID,
+		"tvdb_id":          media.TVDBID,
+		"video_codec":      media.Codec,
+		"resolution":       media.Resolution,
+		"bitrate":          media.Bitrate,
+
+		"monitored":             media.Monitored,
+		"digital_release_date":  media.DigitalReleaseDate,
+		"physical_release_date": media.PhysicalReleaseDate,
+	}
+}
+
+// Helper methods to convert between database and domain models.
+func (r *GormRepository) toDomainLibrary(model *Library) *domain.Library {
+	lib := &domain.Library{
+		ID:           model.ID,
+		TenantID:     model.TenantID,
+		Name:         model.Name,
+		Path:         model.Path,
+		Type:         model.MediaType,
+		Enabled:      model.Enabled,
+		ScanInterval: model.ScanInterval,
+		CreatedAt:    model.CreatedAt,
+		UpdatedAt:    model.UpdatedAt,
+
+		ExcludePatterns: model.ExcludePatterns,
+		ExtrasMode:      domain.ExtrasMode(model.ExtrasMode),
+		QualityCutoff:   model.QualityCutoff,
+
+		MetadataPreferences: domain.MetadataPreferences{
+			Language:   model.MetadataLanguage,
+			Region:     model.MetadataRegion,
+			TitleStyle: domain.TitleStyle(model.TitleStyle),
+		},
+
+		Anime: model.Anime,
+
+		IgnoreExtrasFolders: model.IgnoreExtrasFolders,
+		FolderProfile:       domain.FolderProfile(model.FolderProfile),
+
+		Naming: domain.NamingRules{
+			MovieFormat:   model.MovieFormat,
+			EpisodeFormat: model.EpisodeFormat,
+		},
+
+		AudioNormalization: domain.AudioNormalization(model.AudioNormalization),
+	}
+
+	if model.LastScanAt != nil {
+		lib.LastScanAt = model.LastScanAt
+	}
+
+	return lib
+}
+
+func (r *GormRepository) toDomainMedia(model *MediaItem) *models.Media {
+	media := &models.Media{
+		ID:             model.ID,
+		TenantID:       model.TenantID,
+		LibraryID:      model.LibraryID,
+		Title:          model.Title,
+		Artist:         model.Artist,
+		Type:           models.MediaType(model.MediaType),
+		Path:           model.FilePath,
+		Size:           model.FileSize,
+		Duration:       model.Runtime * constants.SecondsToMinutes, // Convert minutes to seconds
+		Resolution:     model.Resolution,
+		Codec:          model.VideoCodec,
+		Bitrate:        model.Bitrate,
+		Added:          model.CreatedAt,
+		Modified:       model.UpdatedAt,
+		LastScanned:    model.UpdatedAt,
+		Status:         model.Status,
+		FilePath:       model.FilePath,
+		FileSize:       model.FileSize,
+		FileModifiedAt: model.FileModifiedAt,
+		ParentID:       model.ParentID,
+		EpisodeID:      model.EpisodeID,
+		ExtraType:      model.ExtraType,
+		ThemeKey:       model.ThemeKey,
+		ThemeURL:       model.ThemeURL,
+		Description:    model.Description,
+		Genres:         model.Genres,
+		Tags:           model.Tags,
+		TMDBID:         model.TMDBID,
+		IMDBID:         model.IMDBID,
+		TVDBID:         model.TVDBID,
+		CreatedAt:      model.CreatedAt,
+		UpdatedAt:      model.UpdatedAt,
+	}
+
+	if model.ReleaseDate != nil {
+		media.ReleaseDate = *model.ReleaseDate
+	}
+	media.Monitored = model.Monitored
+	media.DigitalReleaseDate = model.DigitalReleaseDate
+	media.PhysicalReleaseDate = model.PhysicalReleaseDate
+
+	return media
+}
+
+func (r *GormRepository) toDomainScanResult(model *ScanHistory) *domain.ScanResult {
+	return &domain.ScanResult{
+		ID:           model.ID,
+		LibraryID:    model.LibraryID,
+		StartedAt:    model.StartedAt,
+		CompletedAt:  model.CompletedAt,
+		FilesScanned: model.FilesScanned,
+		FilesAdded:   model.FilesAdded,
+		FilesUpdated: model.FilesUpdated,
+		FilesDeleted: model.FilesDeleted,
+		ErrorMessage: model.ErrorMessage,
+	}
+}
+
+func (r *GormRepository) toDomainEpisode(model *Episode) *models.Episode {
+	ep := &models.Episode{
+		ID:             model.ID,
+		MediaID:        model.MediaID,
+		SeasonNumber:   model.SeasonNumber,
+		EpisodeNumber:  model.EpisodeNumber,
+		AbsoluteNumber: model.AbsoluteNumber,
+		Title:          model.Title,
+		Path:           model.FilePath,
+		Duration:       model.Runtime * constants.SecondsToMinutes, // Convert minutes to seconds
+		Added:          model.CreatedAt,
+	}
+
+	if model.AirDate != nil {
+		ep.AirDate = *model.AirDate
+	}
+
+	return ep
+}
+
+func (r *GormRepository) toDomainProvider(model *MetadataProvider) *domain.MetadataProviderConfig {
+	// Decrypt the API key before returning
+	decryptedKey, err := r.encryptor.Decrypt(model.APIKey)
+	if err != nil {
+		// Log error but don't fail - return empty key
+		decryptedKey = ""
+	}
+
+	return &domain.MetadataProviderConfig{
+		ID:           model.ID,
+		Name:         model.Name,
+		ProviderType: model.ProviderType,
+		APIKey:       decryptedKey,
+		Enabled:      model.Enabled,
+		Priority:     model.Priority,
+		CreatedAt:    model.CreatedAt,
+		UpdatedAt:    model.UpdatedAt,
+	}
+}
+
+func toDomainTranscodePolicy(model *TranscodePolicy) *domain.TranscodePolicy {
+	return &domain.TranscodePolicy{
+		ID:        model.ID,
+		LibraryID: model.LibraryID,
+		Name:      model.Name,
+		Profile:   model.Profile,
+		Format:    model.Format,
+		Enabled:   model.Enabled,
+		CreatedAt: model.CreatedAt,
+		UpdatedAt: model.UpdatedAt,
+
+		AudioNormalization: domain.AudioNormalization(model.AudioNormalization),
+	}
+}
+
+func (r *GormRepository) toDomainWorkflow(model *Workflow) *saga.Workflow {
+	return &saga.Workflow{
+		ID:        model.ID,
+		MediaID:   model.MediaID,
+		Status:    saga.WorkflowStatus(model.Status),
+		Steps:     model.Steps,
+		Data:      model.Data,
+		Error:     model.Error,
+		CreatedAt: model.CreatedAt,
+		UpdatedAt: model.UpdatedAt,
+	}
+}
+
+func toWorkflowModel(wf *saga.Workflow) *Workflow {
+	return &Workflow{
+		ID:        wf.ID,
+		MediaID:   wf.MediaID,
+		Status:    string(wf.Status),
+		Steps:     wf.Steps,
+		Data:      wf.Data,
+		Error:     wf.Error,
+		CreatedAt: wf.CreatedAt,
+		UpdatedAt: wf.UpdatedAt,
+	}
+}
+
+func toDomainTask(model *Task) *task.Task {
+	return &task.Task{
+		ID:          model.ID,
+		Type:        model.Type,
+		Payload:     model.Payload,
+		Status:      task.Status(model.Status),
+		Progress:    model.Progress,
+		Message:     model.Message,
+		Logs:        model.Logs,
+		Error:       model.Error,
+		CreatedAt:   model.CreatedAt,
+		StartedAt:   model.StartedAt,
+		CompletedAt: model.CompletedAt,
+		UpdatedAt:   model.UpdatedAt,
+	}
+}
+
+func toTaskModel(t *task.Task) *Task {
+	return &Task{
+		ID:          t.ID,
+		Type:        t.Type,
+		Payload:     t.Payload,
+		Status:      string(t.Status),
+		Progress:    t.Progress,
+		Message:     t.Message,
+		Logs:        t.Logs,
+		Error:       t.Error,
+		CreatedAt:   t.CreatedAt,
+		StartedAt:   t.StartedAt,
+		CompletedAt: t.CompletedAt,
+		UpdatedAt:   t.UpdatedAt,
+	}
+}
+
+// workflowHistoryPayload is the compressed part of an archived workflow.
+type workflowHistoryPayload struct {
+	Steps []saga.StepRecord `json:"steps"`
+	Data  map[string]string `json:"data,omitempty"`
+	Error string            `json:"error,omitempty"`
+}
+
+func toWorkflowHistoryModel(model *Workflow, archivedAt time.Time) (*WorkflowHistory, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(workflowHistoryPayload{
+		Steps: model.Steps,
+		Data:  model.Data,
+		Error: model.Error,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to encode workflow %s: %w", model.ID, err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress workflow %s: %w", model.ID, err)
+	}
+
+	return &WorkflowHistory{
+		ID:         model.ID,
+		MediaID:    model.MediaID,
+		Status:     model.Status,
+		Payload:    buf.Bytes(),
+		CreatedAt:  model.CreatedAt,
+		FinishedAt: model.UpdatedAt,
+		ArchivedAt: archivedAt,
+	}, nil
+}
+
+func toDomainWorkflowHistory(model *WorkflowHistory) (*saga.Workflow, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(model.Payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress workflow %s: %w", model.ID, err)
+	}
+	defer zr.Close()
+
+	var payload workflowHistoryPayload
+	if err := json.NewDecoder(zr).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("failed to decode workflow %s: %w", model.ID, err)
+	}
+
+	return &saga.Workflow{
+		ID:        model.ID,
+		MediaID:   model.MediaID,
+		Status:    saga.WorkflowStatus(model.Status),
+		Steps:     payload.Steps,
+		Data:      payload.Data,
+		Error:     payload.Error,
+		CreatedAt: model.CreatedAt,
+		UpdatedAt: model.FinishedAt,
+	}, nil
+}
+
+func (r *GormRepository) toDomainWatchState(model *WatchState) *models.WatchHistory {
+	return &models.WatchHistory{
+		ID:          model.ID,
+		UserID:      model.UserID,
+		MediaID:     model.MediaID,
+		EpisodeID:   model.EpisodeID,
+		Position:    model.Position,
+		Duration:    model.Duration,
+		Completed:   model.Completed,
+		LastWatched: model.LastWatched,
+	}
+}
+
+// IndexMedia creates or replaces the search documents of media items.
+func (r *GormRepository) IndexMedia(ctx context.Context, media []*models.Media) error {
+	if len(media) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	rows := make([]map[string]interface{}, len(media))
+	for i, m := range media {
+		rows[i] = map[string]interface{}{
+			"media_id":   m.ID,
+			"library_id": m.LibraryID,
+			"document":   gorm.Expr("to_tsvector('simple', ?)", searchText(m)),
+			"updated_at": now,
+		}
+	}
+
+	err := r.db.WithContext(ctx).Model(&SearchDocument{}).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "media_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"library_id", "document", "updated_at"}),
+		}).
+		Create(rows).Error
+	if err != nil {
+		return fmt.Errorf("failed to index media: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveFromSearchIndex removes the search document of a media item.
+func (r *GormRepository) RemoveFromSearchIndex(ctx context.Context, mediaID uuid.UUID) error {
+	if err := r.db.WithContext(ctx).Delete(&SearchDocument{}, "media_id = ?", mediaID).Error; err != nil {
+		return fmt.Errorf("failed to remove media from search index: %w", err)
+	}
+
+	return nil
+}
+
+// PruneSearchIndex removes the search documents last indexed before the
+// given time.
+func (r *GormRepository) PruneSearchIndex(ctx context.Context, before time.Time) (int, error) {
+	result := r.db.WithContext(ctx).Delete(&SearchDocument{}, "updated_at < ?", before)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to prune search index: %w", result.Error)
+	}
+
+	return int(result.RowsAffected), nil
+}
+
+// searchText is the text a media item is found by.
+func searchText(media *models.Media) string {
+	parts := []string{media.Title, media.Description}
+	parts = append(parts, media.Genres...)
+	parts = append(parts, media.Tags...)
+	return strings.Join(parts, " ")
+}
+
+// RefreshStorageUsage replaces the storage usage of a library with totals
+// computed from its media files.
+func (r *GormRepository) RefreshStorageUsage(ctx context.Context, libraryID uuid.UUID) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&StorageUsage{}, "library_id = ?", libraryID).Error; err != nil {
+			return err
+		}
+		// Raw statements bypass the tenant scope, so the tenant is taken
+		// from the library
+		return tx.Exec(`
+			INSERT INTO storage_usage (library_id, tenant_id, media_type, resolution, file_count, total_bytes, updated_at)
+			SELECT m.library_id, l.tenant_id, m.media_type, COALESCE(NULLIF(m.resolution, ''), ?), COUNT(*),
+				COALESCE(SUM(m.file_size), 0), ?
+			FROM media_items m
+			JOIN libraries l ON l.id = m.library_id
+			WHERE m.library_id = ? AND m.deleted_at IS NULL AND m.file_path <> ''
+			GROUP BY m.library_id, l.tenant_id, m.media_type, COALESCE(NULLIF(m.resolution, ''), ?)
+		`, domain.ResolutionUnknown, time.Now(), libraryID, domain.ResolutionUnknown).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to refresh storage usage: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteStorageUsage removes the storage usage of a library.
+func (r *GormRepository) DeleteStorageUsage(ctx context.Context, libraryID uuid.UUID) error {
+	if err := r.db.WithContext(ctx).Delete(&StorageUsage{}, "library_id = ?", libraryID).Error; err != nil {
+		return fmt.Errorf("failed to delete storage usage: %w", err)
+	}
+
+	return nil
+}
+
+// ListStorageUsage returns the storage usage of a library, or of every
+// library if libraryID is nil.
+func (r *GormRepository) ListStorageUsage(ctx context.Context, libraryID *uuid.UUID) ([]*domain.StorageUsage, error) {
+	q := r.db.WithContext(ctx).Model(&StorageUsage{})
+	if libraryID != nil {
+		q = q.Where("library_id = ?", *libraryID)
+	}
+
+	var items []StorageUsage
+	if err := q.Order("library_id, media_type, resolution").Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to list storage usage: %w", err)
+	}
+
+	usage := make([]*domain.StorageUsage, len(items))
+	for i, item := range items {
+		usage[i] = &domain.StorageUsage{
+			LibraryID:  item.LibraryID,
+			TenantID:   item.TenantID,
+			MediaType:  item.MediaType,
+			Resolution: item.Resolution,
+			FileCount:  item.FileCount,
+			TotalBytes: item.TotalBytes,
+			UpdatedAt:  item.UpdatedAt,
+		}
+	}
+
+	return usage, nil
+}
+
+// pruneItem is a media item with when anyone last watched it.
+type pruneItem struct {
+	MediaItem
+	LastViewedAt *time.Time
+}
+
+// ListPruneItems lists the media items with a file of a library, or of
+// every library if libraryID is nil, except extras, with when anyone last
+// watched them.
+func (r *GormRepository) ListPruneItems(ctx context.Context, libraryID *uuid.UUID) ([]domain.PruneItem, error) {
+	q := r.db.WithContext(ctx).Table("media_items AS m").
+		Select(`m.*, GREATEST(
+			(SELECT MAX(v.last_heartbeat) FROM viewings v WHERE v.media_id = m.id),
+			(SELECT MAX(w.last_watched) FROM watch_states w WHERE w.media_id = m.id)) AS last_viewed_at`).
+		Where("m.deleted_at IS NULL AND m.parent_id IS NULL AND m.file_path <> ''")
+	if libraryID != nil {
+		q = q.Where("m.library_id = ?", *libraryID)
+	}
+
+	var rows []pruneItem
+	if err := q.Order("m.title, m.id").Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to list prune items: %w", err)
+	}
+
+	items := make([]domain.PruneItem, len(rows))
+	for i := range rows {
+		items[i] = domain.PruneItem{
+			Media:        r.toDomainMedia(&rows[i].MediaItem),
+			LastViewedAt: rows[i].LastViewedAt,
+		}
+	}
+	return items, nil
+}
+
+// ListHookStates returns whether each hook that was enabled or disabled
+// through the API is enabled, by hook name.
+func (r *GormRepository) ListHookStates(ctx context.Context) (map[string]bool, error) {
+	var items []HookState
+	if err := r.db.WithContext(ctx).Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to list hook states: %w", err)
+	}
+
+	states := make(map[string]bool, len(items))
+	for _, item := range items {
+		states[item.Name] = item.Enabled
+	}
+	return states, nil
+}
+
+// SetHookEnabled enables or disables a hook.
+func (r *GormRepository) SetHookEnabled(ctx context.Context, name string, enabled bool) error {
+	err := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "name"}},
+			DoUpdates: clause.AssignmentColumns([]string{"enabled", "updated_at"}),
+		}).
+		Create(&HookState{Name: name, Enabled: enabled}).Error
+	if err != nil {
+		return fmt.Errorf("failed to set hook state: %w", err)
+	}
+
+	return nil
+}
+
+// CreateHookRun records a run of a hook.
+func (r *GormRepository) CreateHookRun(ctx context.Context, run *domain.HookRun) error {
+	if run.ID == uuid.Nil {
+		run.ID = uuid.New()
+	}
+	model := &HookRun{
+		ID:         run.ID,
+		Hook:       run.Hook,
+		Point:      string(run.Point),
+		EventType:  run.EventType,
+		EntityID:   run.EntityID,
+		ExitCode:   run.ExitCode,
+		TimedOut:   run.TimedOut,
+		Output:     run.Output,
+		Error:      run.Error,
+		StartedAt:  run.StartedAt,
+		DurationMs: run.Duration.Milliseconds(),
+	}
+	if err := r.db.WithContext(ctx).Create(model).Error; err != nil {
+		return fmt.Errorf("failed to create hook run: %w", err)
+	}
+
+	return nil
+}
+
+// ListHookRuns lists the most recent runs of a hook, or of every hook if
+// name is empty, newest first.
+func (r *GormRepository) ListHookRuns(ctx context.Context, name string, limit int) ([]*domain.HookRun, error) {
+	q := r.db.WithContext(ctx).Model(&HookRun{})
+	if name != "" {
+		q = q.Where("hook = ?", name)
+	}
+
+	var items []HookRun
+	if err := q.Order("started_at DESC").Limit(limit).Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to list hook runs: %w", err)
+	}
+
+	runs := make([]*domain.HookRun, len(items))
+	for i, item := range items {
+		runs[i] = &domain.HookRun{
+			ID:        item.ID,
+			Hook:      item.Hook,
+			Point:     domain.HookPoint(item.Point),
+			EventType: item.EventType,
+			EntityID:  item.EntityID,
+			ExitCode:  item.ExitCode,
+			TimedOut:  item.TimedOut,
+			Output:    item.Output,
+			Error:     item.Error,
+			StartedAt: item.StartedAt,
+			Duration:  time.Duration(item.DurationMs) * time.Millisecond,
+		}
+	}
+
+	return runs, nil
+}
+
+// DeleteHookRunsBefore deletes hook runs started before a time. It returns
+// the number of runs deleted.
+func (r *GormRepository) DeleteHookRunsBefore(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Delete(&HookRun{}, "started_at < ?", before)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete hook runs: %w", result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
+
+// ListWorkerPoolSizes returns the size of each worker pool that was resized
+// through the API, by pool name.
+func (r *GormRepository) ListWorkerPoolSizes(ctx context.Context) (map[string]int, error) {
+	var items []WorkerPoolSize
+	if err := r.db.WithContext(ctx).Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to list worker pool sizes: %w", err)
+	}
+
+	sizes := make(map[string]int, len(items))
+	for _, item := range items {
+		sizes[item.Name] = item.Size
+	}
+	return sizes, nil
+}
+
+// SetWorkerPoolSize records the size of a worker pool.
+func (r *GormRepository) SetWorkerPoolSize(ctx context.Context, name string, size int) error {
+	err := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "name"}},
+			DoUpdates: clause.AssignmentColumns([]string{"size", "updated_at"}),
+		}).
+		Create(&WorkerPoolSize{Name: name, Size: size}).Error
+	if err != nil {
+		return fmt.Errorf("failed to set worker pool size: %w", err)
+	}
+
+	return nil
+}
+
+// CreateFeed creates a feed.
+func (r *GormRepository) CreateFeed(ctx context.Context, feed *domain.Feed) error {
+	// Feed URLs usually carry an indexer passkey
+	encryptedURL, err := r.encryptor.Encrypt(feed.URL)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt feed URL: %w", err)
+	}
+
+	model := &Feed{
+		LibraryID:      feed.LibraryID,
+		Name:           feed.Name,
+		URL:            encryptedURL,
+		Include:        feed.Include,
+		Exclude:        feed.Exclude,
+		Qualities:      feed.Qualities,
+		DownloadClient: feed.DownloadClient,
+		Enabled:        feed.Enabled,
+	}
+
+	if err := r.db.WithContext(ctx).Create(model).Error; err != nil {
+		return fmt.Errorf("failed to create feed: %w", err)
+	}
+
+	feed.ID = model.ID
+	feed.CreatedAt = model.CreatedAt
+	feed.UpdatedAt = model.UpdatedAt
+	return nil
+}
+
+// GetFeed retrieves a feed by ID.
+func (r *GormRepository) GetFeed(ctx context.Context, id uuid.UUID) (*domain.Feed, error) {
+	var model Feed
+	if err := r.db.WithContext(ctx).First(&model, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("feed not found")
+		}
+		return nil, fmt.Errorf("failed to get feed: %w", err)
+	}
+
+	return r.toDomainFeed(&model)
+}
+
+// ListFeeds lists the feeds of a library, or of every library if libraryID
+// is nil.
+func (r *GormRepository) ListFeeds(ctx context.Context, libraryID *uuid.UUID) ([]*domain.Feed, error) {
+	q := r.db.WithContext(ctx).Model(&Feed{})
+	if libraryID != nil {
+		q = q.Where("library_id = ?", *libraryID)
+	}
+
+	var items []Feed
+	if err := q.Order("created_at").Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to list feeds: %w", err)
+	}
+
+	feeds := make([]*domain.Feed, len(items))
+	for i := range items {
+		feed, err := r.toDomainFeed(&items[i])
+		if err != nil {
+			return nil, err
+		}
+		feeds[i] = feed
+	}
+
+	return feeds, nil
+}
+
+// UpdateFeed updates the settings of a feed.
+func (r *GormRepository) UpdateFeed(ctx context.Context, feed *domain.Feed) error {
+	encryptedURL, err := r.encryptor.Encrypt(feed.URL)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt feed URL: %w", err)
+	}
+
+	updates := map[string]interface{}{
+		"name":            feed.Name,
+		"url":             encryptedURL,
+		"include":         feed.Include,
+		"exclude":         feed.Exclude,
+		"qualities":       feed.Qualities,
+		"download_client": feed.DownloadClient,
+		"enabled":         feed.Enabled,
+	}
+
+	result := r.db.WithContext(ctx).Model(&Feed{ID: feed.ID}).Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update feed: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return pkgerrors.NotFound("feed not found")
+	}
+
+	return nil
+}
+
+// DeleteFeed deletes a feed. Its grabs are kept, so recreating the feed
+// does not grab the same releases again.
+func (r *GormRepository) DeleteFeed(ctx context.Context, id uuid.UUID) error {
+	result := r.db.WithContext(ctx).Delete(&Feed{}, "id = ?", id)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete feed: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return pkgerrors.NotFound("feed not found")
+	}
+
+	return nil
+}
+
+// SetFeedPolled records a poll of a feed and its error, if any.
+func (r *GormRepository) SetFeedPolled(ctx context.Context, id uuid.UUID, polledAt time.Time, lastError string) error {
+	err := r.db.WithContext(ctx).Model(&Feed{}).Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{"last_polled_at": polledAt, "last_error": lastError}).Error
+	if err != nil {
+		return fmt.Errorf("failed to record feed poll: %w", err)
+	}
+
+	return nil
+}
+
+// ClaimFeedItem records a grab unless its release was grabbed before.
+// Concurrent claims of the same release race on the primary key, so only
+// one of them wins.
+func (r *GormRepository) ClaimFeedItem(ctx context.Context, grab *domain.FeedGrab) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&FeedGrab{
+			Key:       grab.Key,
+			FeedID:    grab.FeedID,
+			Title:     grab.Title,
+			GrabbedAt: grab.GrabbedAt,
+		})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to claim feed item: %w", result.Error)
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+// UpdateFeedGrab records the download client and download of a grab.
+func (r *GormRepository) UpdateFeedGrab(ctx context.Context, grab *domain.FeedGrab) error {
+	err := r.db.WithContext(ctx).Model(&FeedGrab{}).Where("key = ?", grab.Key).
+		Updates(map[string]interface{}{
+			"download_client": grab.DownloadClient,
+			"download_id":     grab.DownloadID,
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update feed grab: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseFeedItem forgets a grab, so its release is grabbed again.
+func (r *GormRepository) ReleaseFeedItem(ctx context.Context, key string) error {
+	if err := r.db.WithContext(ctx).Delete(&FeedGrab{}, "key = ?", key).Error; err != nil {
+		return fmt.Errorf("failed to release feed item: %w", err)
+	}
+
+	return nil
+}
+
+// GrabbedFeedItems returns which of the keys were grabbed.
+func (r *GormRepository) GrabbedFeedItems(ctx context.Context, keys []string) (map[string]bool, error) {
+	grabbed := make(map[string]bool)
+	if len(keys) == 0 {
+		return grabbed, nil
+	}
+
+	var found []string
+	if err := r.db.WithContext(ctx).Model(&FeedGrab{}).Where("key IN ?", keys).Pluck("key", &found).Error; err != nil {
+		return nil, fmt.Errorf("failed to look up feed grabs: %w", err)
+	}
+
+	for _, key := range found {
+		grabbed[key] = true
+	}
+	return grabbed, nil
+}
+
+func (r *GormRepository) toDomainFeed(model *Feed) (*domain.Feed, error) {
+	feedURL, err := r.openFeedURL(model.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt URL of feed %s: %w", model.ID, err)
+	}
+
+	return &domain.Feed{
+		ID:             model.ID,
+		TenantID:       model.TenantID,
+		LibraryID:      model.LibraryID,
+		Name:           model.Name,
+		URL:            feedURL,
+		Include:        model.Include,
+		Exclude:        model.Exclude,
+		Qualities:      model.Qualities,
+		DownloadClient: model.DownloadClient,
+		Enabled:        model.Enabled,
+		LastPolledAt:   model.LastPolledAt,
+		LastError:      model.LastError,
+		CreatedAt:      model.CreatedAt,
+		UpdatedAt:      model.UpdatedAt,
+	}, nil
+}
+
+// openFeedURL decrypts a stored feed URL. URLs stored before feed URLs
+// were encrypted are plaintext until RotateSecrets encrypts them.
+func (r *GormRepository) openFeedURL(stored string) (string, error) {
+	if !encryption.IsEncrypted(stored) {
+		return stored, nil
+	}
+	return r.encryptor.Decrypt(stored)
+}
+
+// ListCalendar lists the episode air dates and movie release dates of
+// monitored media in [start, end), ordered by date.
+func (r *GormRepository) ListCalendar(
+	ctx context.Context,
+	start, end time.Time,
+	libraryID *uuid.UUID,
+) ([]*domain.CalendarEntry, error) {
+	var episodes []struct {
+		ID            uuid.UUID
+		MediaID       uuid.UUID
+		LibraryID     uuid.UUID
+		Title         string
+		SeasonNumber  int
+		EpisodeNumber int
+		EpisodeTitle  string
+		AirDate       time.Time
+		FilePath      string
+	}
+	q := r.db.WithContext(ctx).Table("episodes").
+		Select("episodes.id, episodes.media_id, media_items.library_id, media_items.title, "+
+			"episodes.season_number, episodes.episode_number, episodes.title AS episode_title, "+
+			"episodes.air_date, episodes.file_path").
+		Joins("JOIN media_items ON media_items.id = episodes.media_id AND media_items.deleted_at IS NULL").
+		Where("episodes.deleted_at IS NULL AND media_items.monitored").
+		Where("episodes.air_date >= ? AND episodes.air_date < ?", start, end)
+	if libraryID != nil {
+		q = q.Where("media_items.library_id = ?", *libraryID)
+	}
+	if err := q.Scan(&episodes).Error; err != nil {
+		return nil, fmt.Errorf("failed to list calendar episodes: %w", err)
+	}
+
+	entries := make([]*domain.CalendarEntry, 0, len(episodes))
+	for i := range episodes {
+		ep := &episodes[i]
+		entries = append(entries, &domain.CalendarEntry{
+			Type:          domain.CalendarEntryEpisode,
+			MediaID:       ep.MediaID,
+			LibraryID:     ep.LibraryID,
+			Title:         ep.Title,
+			EpisodeID:     &ep.ID,
+			SeasonNumber:  ep.SeasonNumber,
+			EpisodeNumber: ep.EpisodeNumber,
+			EpisodeTitle:  ep.EpisodeTitle,
+			Date:          ep.AirDate,
+			Available:     ep.FilePath != "",
+		})
+	}
+
+	var movies []MediaItem
+	q = r.db.WithContext(ctx).
+		Where("media_type = ? AND parent_id IS NULL AND monitored", string(models.MediaTypeMovie)).
+		Where("(release_date >= ? AND release_date < ?) OR "+
+			"(digital_release_date >= ? AND digital_release_date < ?) OR "+
+			"(physical_release_date >= ? AND physical_release_date < ?)",
+			start, end, start, end, start, end)
+	if libraryID != nil {
+		q = q.Where("library_id = ?", *libraryID)
+	}
+	if err := q.Find(&movies).Error; err != nil {
+		return nil, fmt.Errorf("failed to list calendar movies: %w", err)
+	}
+
+	for i := range movies {
+		movie := &movies[i]
+		releases := []struct {
+			entryType domain.CalendarEntryType
+			date      *time.Time
+		}{
+			{domain.CalendarEntryCinemaRelease, movie.ReleaseDate},
+			{domain.CalendarEntryDigitalRelease, movie.DigitalReleaseDate},
+			{domain.CalendarEntryPhysicalRelease, movie.PhysicalReleaseDate},
+		}
+		for _, release := range releases {
+			if release.date == nil || release.date.Before(start) || !release.date.Before(end) {
+				continue
+			}
+			entries = append(entries, &domain.CalendarEntry{
+				Type:      release.entryType,
+				MediaID:   movie.ID,
+				LibraryID: movie.LibraryID,
+				Title:     movie.Title,
+				Date:      *release.date,
+				Available: movie.Status == string(models.MediaStatusAvailable),
+			})
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].Date.Equal(entries[j].Date) {
+			return entries[i].Date.Before(entries[j].Date)
+		}
+		return entries[i].Title < entries[j].Title
+	})
+	return entries, nil
+}
+
+// GetCalendarFeedKey returns the calendar feed key of a user.
+func (r *GormRepository) GetCalendarFeedKey(ctx context.Context, userID uuid.UUID) (*domain.CalendarFeedKey, error) {
+	var model CalendarFeedKey
+	if err := r.db.WithContext(ctx).First(&model, "user_id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("calendar feed key not found")
+		}
+		return nil, fmt.Errorf("failed to get calendar feed key: %w", err)
+	}
+	return &domain.CalendarFeedKey{
+		UserID:    model.UserID,
+		TenantID:  model.TenantID,
+		Key:       model.Key,
+		CreatedAt: model.CreatedAt,
+	}, nil
+}
+
+// SetCalendarFeedKey sets the calendar feed key of a user, replacing any
+// set before.
+func (r *GormRepository) SetCalendarFeedKey(ctx context.Context, key *domain.CalendarFeedKey) error {
+	model := &CalendarFeedKey{
+		UserID:    key.UserID,
+		TenantID:  key.TenantID,
+		Key:       key.Key,
+		CreatedAt: key.CreatedAt,
+	}
+	if err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"key", "created_at"}),
+	}).Create(model).Error; err != nil {
+		return fmt.Errorf("failed to set calendar feed key: %w", err)
+	}
+	return nil
+}
+
+// wantedEpisode is an episode of a wanted query, with its series and the
+// cutoff of its library.
+type wantedEpisode struct {
+	ID            uuid.UUID
+	MediaID       uuid.UUID
+	LibraryID     uuid.UUID
+	Title         string
+	IMDBID        string
+	TVDBID        int
+	SeasonNumber  int
+	EpisodeNumber int
+	EpisodeTitle  string
+	AirDate       *time.Time
+	FilePath      string
+	Resolution    string
+	QualityCutoff string
+}
+
+// wantedMovie is a movie of a wanted query, with the cutoff of its library.
+type wantedMovie struct {
+	ID            uuid.UUID
+	LibraryID     uuid.UUID
+	Title         string
+	IMDBID        string
+	TVDBID        int
+	Status        string
+	ReleaseDate   *time.Time
+	Resolution    string
+	QualityCutoff string
+}
+
+// wantedEpisodes selects the episodes of monitored series.
+func (r *GormRepository) wantedEpisodes(ctx context.Context, libraryID *uuid.UUID) *gorm.DB {
+	q := r.db.WithContext(ctx).Table("episodes").
+		Select("episodes.id, episodes.media_id, media_items.library_id, media_items.title, " +
+			"media_items.imdb_id, media_items.tvdb_id, episodes.season_number, episodes.episode_number, " +
+			"episodes.title AS episode_title, episodes.air_date, episodes.file_path, episodes.resolution, " +
+			"libraries.quality_cutoff").
+		Joins("JOIN media_items ON media_items.id = episodes.media_id AND media_items.deleted_at IS NULL").
+		Joins("JOIN libraries ON libraries.id = media_items.library_id AND libraries.deleted_at IS NULL").
+		Where("episodes.deleted_at IS NULL AND media_items.monitored")
+	if libraryID != nil {
+		q = q.Where("media_items.library_id = ?", *libraryID)
+	}
+	return q
+}
+
+// wantedMovies selects monitored movies.
+func (r *GormRepository) wantedMovies(ctx context.Context, libraryID *uuid.UUID) *gorm.DB {
+	q := r.db.WithContext(ctx).Table("media_items").
+		Select("media_items.id, media_items.library_id, media_items.title, media_items.imdb_id, "+
+			"media_items.tvdb_id, media_items.status, media_items.release_date, media_items.resolution, "+
+			"libraries.quality_cutoff").
+		Joins("JOIN libraries ON libraries.id = media_items.library_id AND libraries.deleted_at IS NULL").
+		Where("media_items.deleted_at IS NULL AND media_items.monitored").
+		Where("media_items.media_type = ? AND media_items.parent_id IS NULL", string(models.MediaTypeMovie))
+	if libraryID != nil {
+		q = q.Where("media_items.library_id = ?", *libraryID)
+	}
+	return q
+}
+
+// ListMissing lists monitored movies and aired episodes without a file.
+func (r *GormRepository) ListMissing(
+	ctx context.Context,
+	libraryID *uuid.UUID,
+	airedBefore time.Time,
+) ([]*domain.WantedItem, error) {
+	var episodes []wantedEpisode
+	// Episodes without a known air date have a zero one
+	if err := r.wantedEpisodes(ctx, libraryID).
+		Where("episodes.file_path = '' AND episodes.air_date > ? AND episodes.air_date < ?", time.Time{}, airedBefore).
+		Scan(&episodes).Error; err != nil {
+		return nil, fmt.Errorf("failed to list missing episodes: %w", err)
+	}
+
+	var movies []wantedMovie
+	if err := r.wantedMovies(ctx, libraryID).
+		Where("media_items.status = ?", string(models.MediaStatusMissing)).
+		Scan(&movies).Error; err != nil {
+		return nil, fmt.Errorf("failed to list missing movies: %w", err)
+	}
+
+	return toWantedItems(episodes, movies), nil
+}
+
+// ListUpgradeCandidates lists monitored movies and episodes with a file in
+// libraries with a quality cutoff.
+func (r *GormRepository) ListUpgradeCandidates(
+	ctx context.Context,
+	libraryID *uuid.UUID,
+) ([]*domain.WantedItem, error) {
+	var episodes []wantedEpisode
+	if err := r.wantedEpisodes(ctx, libraryID).
+		Where("episodes.file_path <> '' AND libraries.quality_cutoff <> ''").
+		Scan(&episodes).Error; err != nil {
+		return nil, fmt.Errorf("failed to list upgradable episodes: %w", err)
+	}
+
+	var movies []wantedMovie
+	if err := r.wantedMovies(ctx, libraryID).
+		Where("media_items.status = ? AND libraries.quality_cutoff <> ''", string(models.MediaStatusAvailable)).
+		Scan(&movies).Error; err != nil {
+		return nil, fmt.Errorf("failed to list upgradable movies: %w", err)
+	}
+
+	return toWantedItems(episodes, movies), nil
+}
+
+// GetWantedItem returns a movie or an episode with the quality of its file.
+func (r *GormRepository) GetWantedItem(
+	ctx context.Context,
+	mediaID uuid.UUID,
+	episodeID *uuid.UUID,
+) (*domain.WantedItem, error) {
+	var items []*domain.WantedItem
+	if episodeID != nil {
+		var episodes []wantedEpisode
+		if err := r.wantedEpisodes(ctx, nil).
+			Where("episodes.id = ? AND episodes.media_id = ?", *episodeID, mediaID).
+			Scan(&episodes).Error; err != nil {
+			return nil, fmt.Errorf("failed to get episode: %w", err)
+		}
+		items = toWantedItems(episodes, nil)
+	} else {
+		var movies []wantedMovie
+		if err := r.wantedMovies(ctx, nil).
+			Where("media_items.id = ?", mediaID).
+			Scan(&movies).Error; err != nil {
+			return nil, fmt.Errorf("failed to get movie: %w", err)
+		}
+		items = toWantedItems(nil, movies)
+	}
+
+	if len(items) == 0 {
+		return nil, pkgerrors.NotFound("monitored movie or episode not found")
+	}
+	return items[0], nil
+}
+
+func toWantedItems(episodes []wantedEpisode, movies []wantedMovie) []*domain.WantedItem {
+	items := make([]*domain.WantedItem, 0, len(episodes)+len(movies))
+	for i := range episodes {
+		ep := &episodes[i]
+		item := &domain.WantedItem{
+			MediaID:       ep.MediaID,
+			LibraryID:     ep.LibraryID,
+			Title:         ep.Title,
+			IMDBID:        ep.IMDBID,
+			TVDBID:        ep.TVDBID,
+			EpisodeID:     &ep.ID,
+			SeasonNumber:  ep.SeasonNumber,
+			EpisodeNumber: ep.EpisodeNumber,
+			EpisodeTitle:  ep.EpisodeTitle,
+			Cutoff:        ep.QualityCutoff,
+		}
+		if ep.AirDate != nil && !ep.AirDate.IsZero() {
+			item.Date = ep.AirDate
+		}
+		if ep.FilePath != "" {
+			item.Quality = domain.ResolutionQuality(ep.Resolution)
+		}
+		items = append(items, item)
+	}
+	for i := range movies {
+		movie := &movies[i]
+		item := &domain.WantedItem{
+			MediaID:   movie.ID,
+			LibraryID: movie.LibraryID,
+			Title:     movie.Title,
+			IMDBID:    movie.IMDBID,
+			TVDBID:    movie.TVDBID,
+			Cutoff:    movie.QualityCutoff,
+		}
+		if movie.ReleaseDate != nil && !movie.ReleaseDate.IsZero() {
+			item.Date = movie.ReleaseDate
+		}
+		if movie.Status == string(models.MediaStatusAvailable) {
+			item.Quality = domain.ResolutionQuality(movie.Resolution)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// AddBlocklistEntry blocklists a release.
+func (r *GormRepository) AddBlocklistEntry(ctx context.Context, entry *domain.BlocklistEntry) error {
+	model := &BlocklistEntry{
+		ID:        entry.ID,
+		InfoHash:  entry.InfoHash,
+		GUID:      entry.GUID,
+		Title:     entry.Title,
+		Indexer:   entry.Indexer,
+		MediaID:   entry.MediaID,
+		Source:    string(entry.Source),
+		Reason:    entry.Reason,
+		CreatedAt: entry.CreatedAt,
+	}
+	if model.ID == uuid.Nil {
+		model.ID = uuid.New()
+	}
+
+	if err := r.db.WithContext(ctx).Create(model).Error; err != nil {
+		return fmt.Errorf("failed to add blocklist entry: %w", err)
+	}
+
+	entry.ID = model.ID
+	entry.CreatedAt = model.CreatedAt
+	return nil
+}
+
+// ListBlocklist lists a page of blocklist entries, newest first, and the
+// number of entries in all pages.
+func (r *GormRepository) ListBlocklist(
+	ctx context.Context,
+	limit, offset int,
+) ([]*domain.BlocklistEntry, int64, error) {
+	var total int64
+	if err := r.db.WithContext(ctx).Model(&BlocklistEntry{}).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count blocklist entries: %w", err)
+	}
+
+	var items []BlocklistEntry
+	if err := r.db.WithContext(ctx).Order("created_at DESC").Limit(limit).Offset(offset).
+		Find(&items).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list blocklist entries: %w", err)
+	}
+
+	entries := make([]*domain.BlocklistEntry, len(items))
+	for i := range items {
+		entries[i] = toDomainBlocklistEntry(&items[i])
+	}
+	return entries, total, nil
+}
+
+// DeleteBlocklistEntry removes a release from the blocklist, so it can be
+// grabbed again.
+func (r *GormRepository) DeleteBlocklistEntry(ctx context.Context, id uuid.UUID) error {
+	result := r.db.WithContext(ctx).Delete(&BlocklistEntry{}, "id = ?", id)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete blocklist entry: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return pkgerrors.NotFound("blocklist entry not found")
+	}
+
+	return nil
+}
+
+// FindBlocklisted returns the blocklist entries sharing an info hash, a
+// GUID or a title with any of the releases.
+func (r *GormRepository) FindBlocklisted(
+	ctx context.Context,
+	releases []domain.ReleaseIdentity,
+) ([]*domain.BlocklistEntry, error) {
+	var hashes, guids, titles []string
+	for _, release := range releases {
+		if release.InfoHash != "" {
+			hashes = append(hashes, release.InfoHash)
+		}
+		if release.GUID != "" {
+			guids = append(guids, release.GUID)
+		}
+		if release.Title != "" {
+			titles = append(titles, strings.ToLower(release.Title))
+		}
+	}
+	if len(hashes) == 0 && len(guids) == 0 && len(titles) == 0 {
+		return nil, nil
+	}
+
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	if len(hashes) > 0 {
+		conditions = append(conditions, "info_hash IN ?")
+		args = append(args, hashes)
+	}
+	if len(guids) > 0 {
+		conditions = append(conditions, "guid IN ?")
+		args = append(args, guids)
+	}
+	if len(titles) > 0 {
+		conditions = append(conditions, "LOWER(title) IN ?")
+		args = append(args, titles)
+	}
+
+	var items []BlocklistEntry
+	if err := r.db.WithContext(ctx).Where(strings.Join(conditions, " OR "), args...).
+		Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to look up blocklist: %w", err)
+	}
+
+	entries := make([]*domain.BlocklistEntry, len(items))
+	for i := range items {
+		entries[i] = toDomainBlocklistEntry(&items[i])
+	}
+	return entries, nil
+}
+
+func toDomainBlocklistEntry(model *BlocklistEntry) *domain.BlocklistEntry {
+	return &domain.BlocklistEntry{
+		ID: model.ID,
+		ReleaseIdentity: domain.ReleaseIdentity{
+			InfoHash: model.InfoHash,
+			GUID:     model.GUID,
+			Title:    model.Title,
+			Indexer:  model.Indexer,
+		},
+		MediaID:   model.MediaID,
+		Source:    domain.BlocklistSource(model.Source),
+		Reason:    model.Reason,
+		CreatedAt: model.CreatedAt,
+	}
+}
+
+// CreateManualImport parks a download for an admin to match.
+func (r *GormRepository) CreateManualImport(ctx context.Context, mi *domain.ManualImport) error {
+	model := &ManualImport{
+		ID:              mi.ID,
+		LibraryID:       mi.LibraryID,
+		WorkflowID:      mi.WorkflowID,
+		MediaID:         mi.MediaID,
+		Path:            mi.Path,
+		DownloadClient:  mi.DownloadClient,
+		ReleaseInfoHash: mi.Release.InfoHash,
+		ReleaseGUID:     mi.Release.GUID,
+		ReleaseTitle:    mi.Release.Title,
+		ReleaseIndexer:  mi.Release.Indexer,
+		Title:           mi.Title,
+		Year:            mi.Year,
+		Candidates:      mi.Candidates,
+		Replacement:     mi.Replacement,
+		Status:          string(mi.Status),
+		CreatedAt:       mi.CreatedAt,
+	}
+	if model.ID == uuid.Nil {
+		model.ID = uuid.New()
+	}
+
+	if err := r.db.WithContext(ctx).Create(model).Error; err != nil {
+		return fmt.Errorf("failed to create manual import: %w", err)
+	}
+
+	mi.ID = model.ID
+	mi.CreatedAt = model.CreatedAt
+	return nil
+}
+
+// GetManualImport returns a parked download.
+func (r *GormRepository) GetManualImport(ctx context.Context, id uuid.UUID) (*domain.ManualImport, error) {
+	var model ManualImport
+	if err := r.db.WithContext(ctx).First(&model, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("manual import not found")
+		}
+		return nil, fmt.Errorf("failed to get manual import: %w", err)
+	}
+
+	return toDomainManualImport(&model), nil
+}
+
+// ListManualImports lists a page of parked downloads, oldest first, and the
+// number of downloads in all pages.
+func (r *GormRepository) ListManualImports(
+	ctx context.Context,
+	status *domain.ManualImportStatus,
+	limit, offset int,
+) ([]*domain.ManualImport, int64, error) {
+	q := r.db.WithContext(ctx).Model(&ManualImport{})
+	if status != nil {
+		q = q.Where("status = ?", string(*status))
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count manual imports: %w", err)
+	}
+
+	var items []ManualImport
+	if err := q.Order("created_at").Limit(limit).Offset(offset).Find(&items).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list manual imports: %w", err)
+	}
+
+	imports := make([]*domain.ManualImport, len(items))
+	for i := range items {
+		imports[i] = toDomainManualImport(&items[i])
+	}
+	return imports, total, nil
+}
+
+// ResolveManualImport records the resolution of a pending import. Only one
+// of concurrent resolutions wins.
+func (r *GormRepository) ResolveManualImport(ctx context.Context, mi *domain.ManualImport) error {
+	result := r.db.WithContext(ctx).Model(&ManualImport{}).
+		Where("id = ? AND status = ?", mi.ID, string(domain.ManualImportPending)).
+		Updates(map[string]interface{}{
+			"status":            string(mi.Status),
+			"imported_media_id": mi.ImportedMediaID,
+			"resolved_at":       mi.ResolvedAt,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to resolve manual import: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return pkgerrors.Conflict("manual import was resolved already")
+	}
+
+	return nil
+}
+
+func toDomainManualImport(model *ManualImport) *domain.ManualImport {
+	return &domain.ManualImport{
+		ID:             model.ID,
+		LibraryID:      model.LibraryID,
+		WorkflowID:     model.WorkflowID,
+		MediaID:        model.MediaID,
+		Path:           model.Path,
+		DownloadClient: model.DownloadClient,
+		Release: domain.ReleaseIdentity{
+			InfoHash: model.ReleaseInfoHash,
+			GUID:     model.ReleaseGUID,
+			Title:    model.ReleaseTitle,
+			Indexer:  model.ReleaseIndexer,
+		},
+		Title:           model.Title,
+		Year:            model.Year,
+		Candidates:      model.Candidates,
+		Replacement:     model.Replacement,
+		Status:          domain.ManualImportStatus(model.Status),
+		ImportedMediaID: model.ImportedMediaID,
+		CreatedAt:       model.CreatedAt,
+		ResolvedAt:      model.ResolvedAt,
+	}
+}
+
+// CreatePlaybackIssue records a playback issue.
+func (r *GormRepository) CreatePlaybackIssue(ctx context.Context, issue *domain.PlaybackIssue) error {
+	model := &PlaybackIssue{
+		MediaID:     issue.MediaID,
+		UserID:      issue.UserID,
+		SessionID:   issue.SessionID,
+		Kind:        string(issue.Kind),
+		PositionMs:  issue.Position.Milliseconds(),
+		StallMs:     issue.StallDuration.Milliseconds(),
+		FromBitrate: issue.FromBitrate,
+		ToBitrate:   issue.ToBitrate,
+		Error:       issue.Error,
+		Client:      issue.Client,
+		ReportedAt:  issue.ReportedAt,
+	}
+	if err := r.db.WithContext(ctx).Create(model).Error; err != nil {
+		return fmt.Errorf("failed to create playback issue: %w", err)
+	}
+
+	issue.ID = model.ID
+	return nil
+}
+
+// playbackIssueStats is a row of the playback issues aggregated per media,
+// with the flag of the media, if any.
+type playbackIssueStats struct {
+	MediaID             uuid.UUID
+	Sessions            int64
+	ErrorSessions       int64
+	DecodeErrorSessions int64
+	Stalls              int64
+	StallMs             int64
+	DecodeErrors        int64
+	BitrateSwitches     int64
+	LastReportedAt      time.Time
+	FlagReason          *string
+	FlagErrorRate       *float64
+	FlaggedAt           *time.Time
+}
+
+// playbackIssueStatsQuery aggregates the playback issues reported since
+// the given time per media.
+func (r *GormRepository) playbackIssueStatsQuery(ctx context.Context, since time.Time) *gorm.DB {
+	return r.db.WithContext(ctx).Table("playback_issues AS i").
+		Select(`i.media_id,
+			COUNT(DISTINCT i.session_id) AS sessions,
+			COUNT(DISTINCT i.session_id) FILTER (WHERE i.kind IN ('stall', 'decode_error')) AS error_sessions,
+			COUNT(DISTINCT i.session_id) FILTER (WHERE i.kind = 'decode_error') AS decode_error_sessions,
+			COUNT(*) FILTER (WHERE i.kind = 'stall') AS stalls,
+			COALESCE(SUM(i.stall_ms), 0) AS stall_ms,
+			COUNT(*) FILTER (WHERE i.kind = 'decode_error') AS decode_errors,
+			COUNT(*) FILTER (WHERE i.kind = 'bitrate_switch') AS bitrate_switches,
+			MAX(i.reported_at) AS last_reported_at,
+			f.reason AS flag_reason,
+			f.error_rate AS flag_error_rate,
+			f.flagged_at AS flagged_at`).
+		Joins("LEFT JOIN playback_flags f ON f.media_id = i.media_id").
+		Where("i.reported_at >= ?", since).
+		Group("i.media_id, f.reason, f.error_rate, f.flagged_at")
+}
+
+// GetPlaybackIssueStats aggregates the issues reported for media since the
+// given time, with its flag, if any.
+func (r *GormRepository) GetPlaybackIssueStats(
+	ctx context.Context,
+	mediaID uuid.UUID,
+	since time.Time,
+) (*domain.PlaybackIssueStats, error) {
+	var rows []playbackIssueStats
+	if err := r.playbackIssueStatsQuery(ctx, since).Where("i.media_id = ?", mediaID).
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to get playback issue stats: %w", err)
+	}
+
+	if len(rows) == 0 {
+		return &domain.PlaybackIssueStats{MediaID: mediaID}, nil
+	}
+	return toDomainPlaybackIssueStats(&rows[0]), nil
+}
+
+// ListPlaybackIssueStats aggregates the issues reported per media matching
+// the filter, highest error rate first, and returns a page of them and the
+// number of media in all pages.
+func (r *GormRepository) ListPlaybackIssueStats(
+	ctx context.Context,
+	filter domain.PlaybackIssueFilter,
+	limit, offset int,
+) ([]*domain.PlaybackIssueStats, int64, error) {
+	q := r.playbackIssueStatsQuery(ctx, filter.Since).
+		Joins("JOIN media_items m ON m.id = i.media_id AND m.deleted_at IS NULL")
+	if filter.LibraryID != nil {
+		q = q.Where("m.library_id = ?", *filter.LibraryID)
+	}
+	if filter.FlaggedOnly {
+		q = q.Where("f.media_id IS NOT NULL")
+	}
+
+	var total int64
+	if err := r.db.WithContext(ctx).Table("(?) AS s", q).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count playback issue stats: %w", err)
+	}
+
+	var rows []playbackIssueStats
+	if err := r.db.WithContext(ctx).Table("(?) AS s", q).
+		Order("s.error_sessions::float8 / s.sessions DESC, s.sessions DESC, s.media_id").
+		Limit(limit).Offset(offset).
+		Scan(&rows).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list playback issue stats: %w", err)
+	}
+
+	stats := make([]*domain.PlaybackIssueStats, len(rows))
+	for i := range rows {
+		stats[i] = toDomainPlaybackIssueStats(&rows[i])
+	}
+	return stats, total, nil
+}
+
+// FlagPlayback flags media unless it is flagged already. It reports whether
+// the media was flagged.
+func (r *GormRepository) FlagPlayback(ctx context.Context, flag *domain.PlaybackFlag) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&PlaybackFlag{
+			MediaID:   flag.MediaID,
+			Reason:    string(flag.Reason),
+			ErrorRate: flag.ErrorRate,
+			FlaggedAt: flag.FlaggedAt,
+		})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to flag media playback: %w", result.Error)
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+// ClearPlaybackIssues removes the flag of media and the issues reported for
+// it, such as once its file was replaced.
+func (r *GormRepository) ClearPlaybackIssues(ctx context.Context, mediaID uuid.UUID) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&PlaybackFlag{}, "media_id = ?", mediaID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&PlaybackIssue{}, "media_id = ?", mediaID).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to clear playback issues: %w", err)
+	}
+
+	return nil
+}
+
+func toDomainPlaybackIssueStats(row *playbackIssueStats) *domain.PlaybackIssueStats {
+	stats := &domain.PlaybackIssueStats{
+		MediaID:             row.MediaID,
+		Sessions:            row.Sessions,
+		ErrorSessions:       row.ErrorSessions,
+		DecodeErrorSessions: row.DecodeErrorSessions,
+		Stalls:              row.Stalls,
+		StallTime:           time.Duration(row.StallMs) * time.Millisecond,
+		DecodeErrors:        row.DecodeErrors,
+		BitrateSwitches:     row.BitrateSwitches,
+		LastReportedAt:      row.LastReportedAt,
+	}
+	if row.FlaggedAt != nil {
+		stats.Flag = &domain.PlaybackFlag{
+			MediaID:   row.MediaID,
+			Reason:    domain.PlaybackFlagReason(*row.FlagReason),
+			ErrorRate: *row.FlagErrorRate,
+			FlaggedAt: *row.FlaggedAt,
+		}
+	}
+	return stats
+}
+
+// CreateShareLink creates a share link.
+func (r *GormRepository) CreateShareLink(ctx context.Context, link *domain.ShareLink) error {
+	model := &ShareLink{
+		TenantID:   link.TenantID,
+		MediaID:    link.MediaID,
+		CreatedBy:  link.CreatedBy,
+		TokenHash:  link.TokenHash,
+		MaxBitrate: link.MaxBitrate,
+		MaxViews:   link.MaxViews,
+		ExpiresAt:  link.ExpiresAt,
+		CreatedAt:  link.CreatedAt,
+	}
+	if err := r.db.WithContext(ctx).Create(model).Error; err != nil {
+		return fmt.Errorf("failed to create share link: %w", err)
+	}
+
+	link.ID = model.ID
+	link.TenantID = model.TenantID
+	return nil
+}
+
+// GetShareLink retrieves a share link by ID.
+func (r *GormRepository) GetShareLink(ctx context.Context, id uuid.UUID) (*domain.ShareLink, error) {
+	var model ShareLink
+	if err := r.db.WithContext(ctx).First(&model, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("share link not found")
+		}
+		return nil, fmt.Errorf("failed to get share link: %w", err)
+	}
+
+	return toDomainShareLink(&model), nil
+}
+
+// GetShareLinkByTokenHash retrieves the share link of a token.
+func (r *GormRepository) GetShareLinkByTokenHash(ctx context.Context, tokenHash string) (*domain.ShareLink, error) {
+	var model ShareLink
+	if err := r.db.WithContext(ctx).First(&model, "token_hash = ?", tokenHash).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("share link not found")
+		}
+		return nil, fmt.Errorf("failed to get share link: %w", err)
+	}
+
+	return toDomainShareLink(&model), nil
+}
+
+// ListShareLinks returns a page of the share links matching the filter,
+// newest first, and the number of links in all pages.
+func (r *GormRepository) ListShareLinks(
+	ctx context.Context,
+	filter domain.ShareLinkFilter,
+	limit, offset int,
+) ([]*domain.ShareLink, int64, error) {
+	q := r.db.WithContext(ctx).Model(&ShareLink{})
+	if filter.CreatedBy != nil {
+		q = q.Where("created_by = ?", *filter.CreatedBy)
+	}
+	if filter.MediaID != nil {
+		q = q.Where("media_id = ?", *filter.MediaID)
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count share links: %w", err)
+	}
+
+	var models []ShareLink
+	if err := q.Order("created_at DESC, id").Limit(limit).Offset(offset).
+		Find(&models).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list share links: %w", err)
+	}
+
+	links := make([]*domain.ShareLink, len(models))
+	for i := range models {
+		links[i] = toDomainShareLink(&models[i])
+	}
+	return links, total, nil
+}
+
+// RevokeShareLink revokes a share link. Revoking a revoked link does
+// nothing.
+func (r *GormRepository) RevokeShareLink(ctx context.Context, id uuid.UUID, at time.Time) error {
+	result := r.db.WithContext(ctx).Model(&ShareLink{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", at)
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke share link: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		if _, err := r.GetShareLink(ctx, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RecordShareLinkPlay counts a play of a share link and records it, unless
+// the link is no longer active at the time of the play.
+func (r *GormRepository) RecordShareLinkPlay(ctx context.Context, play *domain.ShareLinkPlay) (*domain.ShareLink, error) {
+	var model ShareLink
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&ShareLink{}).
+			Where("id = ? AND revoked_at IS NULL AND expires_at > ?", play.ShareLinkID, play.PlayedAt).
+			Where("max_views = 0 OR views < max_views").
+			Update("views", gorm.Expr("views + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return pkgerrors.Conflict("share link is no longer active")
+		}
+
+		playModel := &ShareLinkPlay{
+			ShareLinkID: play.ShareLinkID,
+			MediaID:     play.MediaID,
+			IPAddress:   play.IPAddress,
+			UserAgent:   play.UserAgent,
+			PlayedAt:    play.PlayedAt,
+		}
+		if err := tx.Create(playModel).Error; err != nil {
+			return err
+		}
+		play.ID = playModel.ID
+
+		return tx.First(&model, "id = ?", play.ShareLinkID).Error
+	})
+	if err != nil {
+		if pkgerrors.IsConflict(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to record share link play: %w", err)
+	}
+
+	return toDomainShareLink(&model), nil
+}
+
+// ListShareLinkPlays returns a page of the plays of a share link, newest
+// first, and the number of plays in all pages.
+func (r *GormRepository) ListShareLinkPlays(
+	ctx context.Context,
+	linkID uuid.UUID,
+	limit, offset int,
+) ([]*domain.ShareLinkPlay, int64, error) {
+	q := r.db.WithContext(ctx).Model(&ShareLinkPlay{}).Where("share_link_id = ?", linkID)
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count share link plays: %w", err)
+	}
+
+	var models []ShareLinkPlay
+	if err := q.Order("played_at DESC, id").Limit(limit).Offset(offset).
+		Find(&models).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list share link plays: %w", err)
+	}
+
+	plays := make([]*domain.ShareLinkPlay, len(models))
+	for i, model := range models {
+		plays[i] = &domain.ShareLinkPlay{
+			ID:          model.ID,
+			ShareLinkID: model.ShareLinkID,
+			MediaID:     model.MediaID,
+			IPAddress:   model.IPAddress,
+			UserAgent:   model.UserAgent,
+			PlayedAt:    model.PlayedAt,
+		}
+	}
+	return plays, total, nil
+}
+
+func toDomainShareLink(model *ShareLink) *domain.ShareLink {
+	return &domain.ShareLink{
+		ID:         model.ID,
+		TenantID:   model.TenantID,
+		MediaID:    model.MediaID,
+		CreatedBy:  model.CreatedBy,
+		TokenHash:  model.TokenHash,
+		MaxBitrate: model.MaxBitrate,
+		MaxViews:   model.MaxViews,
+		Views:      model.Views,
+		ExpiresAt:  model.ExpiresAt,
+		RevokedAt:  model.RevokedAt,
+		CreatedAt:  model.CreatedAt,
+	}
+}
+
+// CreateContentRequest stores a pending content request. It fails with a
+// conflict if the title has a request that was not denied.
+func (r *GormRepository) CreateContentRequest(ctx context.Context, request *domain.ContentRequest) error {
+	model := &ContentRequest{
+		TenantID:   request.TenantID,
+		UserID:     request.UserID,
+		MediaType:  string(request.MediaType),
+		Provider:   request.Provider,
+		ProviderID: request.ProviderID,
+		Title:      request.Title,
+		Year:       request.Year,
+		Overview:   request.Overview,
+		PosterURL:  request.PosterURL,
+		Seasons:    request.Seasons,
+		Quality:    request.Quality,
+		Status:     string(request.Status),
+		CreatedAt:  request.CreatedAt,
+	}
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var open int64
+		if err := tx.Model(&ContentRequest{}).
+			Where("provider = ? AND provider_id = ? AND status <> ?",
+				request.Provider, request.ProviderID, string(domain.ContentRequestDenied)).
+			Count(&open).Error; err != nil {
+			return err
+		}
+		if open > 0 {
+			return pkgerrors.Conflict("title has been requested already")
+		}
+		return tx.Create(model).Error
+	})
+	if err != nil {
+		if pkgerrors.IsConflict(err) {
+			return err
+		}
+		return fmt.Errorf("failed to create content request: %w", err)
+	}
+
+	request.ID = model.ID
+	request.TenantID = model.TenantID
+	return nil
+}
+
+// GetContentRequest retrieves a content request by ID.
+func (r *GormRepository) GetContentRequest(ctx context.Context, id uuid.UUID) (*domain.ContentRequest, error) {
+	var model ContentRequest
+	if err := r.db.WithContext(ctx).First(&model, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("content request not found")
+		}
+		return nil, fmt.Errorf("failed to get content request: %w", err)
 	}
 
-	if model.LastScanAt != nil {
-		lib.LastScanAt = model.LastScanAt
+	return toDomainContentRequest(&model), nil
+}
+
+// GetContentRequestsByProviderIDs returns the requests that were not denied
+// of titles of a provider, by provider ID.
+func (r *GormRepository) GetContentRequestsByProviderIDs(
+	ctx context.Context,
+	provider string,
+	providerIDs []string,
+) (map[string]*domain.ContentRequest, error) {
+	requests := make(map[string]*domain.ContentRequest)
+	if len(providerIDs) == 0 {
+		return requests, nil
 	}
 
-	return lib
+	var models []ContentRequest
+	if err := r.db.WithContext(ctx).
+		Where("provider = ? AND provider_id IN ? AND status <> ?",
+			provider, providerIDs, string(domain.ContentRequestDenied)).
+		Find(&models).Error; err != nil {
+		return nil, fmt.Errorf("failed to get content requests: %w", err)
+	}
+
+	for i := range models {
+		requests[models[i].ProviderID] = toDomainContentRequest(&models[i])
+	}
+	return requests, nil
 }
 
-func (r *GormRepository) toDomainMedia(model *MediaItem) *models.Media {
-	media := &models.Media{
-		ID:             model.ID,
-		LibraryID:      model.LibraryID,
-		Title:          model.Title,
-		Type:           models.MediaType(model.MediaType),
-		Path:           model.FilePath,
-		Size:           model.FileSize,
-		Duration:       model.Runtime * constants.SecondsToMinutes, // Convert minutes to seconds
-		Resolution:     model.Resolution,
-		Codec:          model.VideoCodec,
-		Bitrate:        model.Bitrate,
-		Added:          model.CreatedAt,
-		Modified:       model.UpdatedAt,
-		LastScanned:    model.UpdatedAt,
-		Status:         model.Status,
-		FilePath:       model.FilePath,
-		FileSize:       model.FileSize,
-		FileModifiedAt: model.FileModifiedAt,
-		Description:    model.Description,
-		Genres:         model.Genres,
-		Tags:           model.Tags,
-		TMDBID:         model.TMDBID,
-		IMDBID:         model.IMDBID,
-		TVDBID:         model.TVDBID,
-		CreatedAt:      model.CreatedAt,
-		UpdatedAt:      model.UpdatedAt,
+// ListContentRequests returns a page of the content requests matching the
+// filter, newest first, and the number of requests in all pages.
+func (r *GormRepository) ListContentRequests(
+	ctx context.Context,
+	filter domain.ContentRequestFilter,
+	limit, offset int,
+) ([]*domain.ContentRequest, int64, error) {
+	q := r.db.WithContext(ctx).Model(&ContentRequest{})
+	if filter.UserID != nil {
+		q = q.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.Status != "" {
+		q = q.Where("status = ?", string(filter.Status))
 	}
 
-	if model.ReleaseDate != nil {
-		media.ReleaseDate = *model.ReleaseDate
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count content requests: %w", err)
 	}
 
-	return media
+	var models []ContentRequest
+	if err := q.Order("created_at DESC, id").Limit(limit).Offset(offset).
+		Find(&models).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list content requests: %w", err)
+	}
+
+	requests := make([]*domain.ContentRequest, len(models))
+	for i := range models {
+		requests[i] = toDomainContentRequest(&models[i])
+	}
+	return requests, total, nil
 }
 
-func (r *GormRepository) toDomainScanResult(model *ScanHistory) *domain.ScanResult {
-	return &domain.ScanResult{
-		ID:           model.ID,
-		LibraryID:    model.LibraryID,
-		StartedAt:    model.StartedAt,
-		CompletedAt:  model.CompletedAt,
-		FilesScanned: model.FilesScanned,
-		FilesAdded:   model.FilesAdded,
-		FilesUpdated: model.FilesUpdated,
-		FilesDeleted: model.FilesDeleted,
-		ErrorMessage: model.ErrorMessage,
+// ListContentRequestsSince returns the content requests a user made since
+// a time, oldest first.
+func (r *GormRepository) ListContentRequestsSince(
+	ctx context.Context,
+	userID uuid.UUID,
+	since time.Time,
+) ([]*domain.ContentRequest, error) {
+	var models []ContentRequest
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ? AND created_at >= ?", userID, since).
+		Order("created_at, id").
+		Find(&models).Error; err != nil {
+		return nil, fmt.Errorf("failed to list content requests: %w", err)
+	}
+
+	requests := make([]*domain.ContentRequest, len(models))
+	for i := range models {
+		requests[i] = toDomainContentRequest(&models[i])
 	}
+	return requests, nil
 }
 
-func (r *GormRepository) toDomainEpisode(model *Episode) *models.Episode {
-	ep := &models.Episode{
-		ID:            model.ID,
-		MediaID:       model.MediaID,
-		SeasonNumber:  model.SeasonNumber,
-		EpisodeNumber: model.EpisodeNumber,
-		Title:         model.Title,
-		Path:          model.FilePath,
-		Duration:      model.Runtime * constants.SecondsToMinutes, // Convert minutes to seconds
-		Added:         model.CreatedAt,
+// DecideContentRequest saves the approval or denial of a content request,
+// unless it is no longer pending.
+func (r *GormRepository) DecideContentRequest(ctx context.Context, request *domain.ContentRequest) error {
+	result := r.db.WithContext(ctx).Model(&ContentRequest{}).
+		Where("id = ? AND status = ?", request.ID, string(domain.ContentRequestPending)).
+		Updates(map[string]interface{}{
+			"status":        string(request.Status),
+			"library_id":    request.LibraryID,
+			"media_id":      request.MediaID,
+			"decided_by":    request.DecidedBy,
+			"auto_approved": request.AutoApproved,
+			"reason":        request.Reason,
+			"decided_at":    request.DecidedAt,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to decide content request: %w", result.Error)
 	}
 
-	if model.AirDate != nil {
-		ep.AirDate = *model.AirDate
+	if result.RowsAffected == 0 {
+		if _, err := r.GetContentRequest(ctx, request.ID); err != nil {
+			return err
+		}
+		return pkgerrors.Conflict("content request was decided already")
 	}
 
-	return ep
+	return nil
 }
 
-func (r *GormRepository) toDomainProvider(model *MetadataProvider) *domain.MetadataProviderConfig {
-	// Decrypt the API key before returning
-	decryptedKey, err := r.encryptor.Decrypt(model.APIKey)
-	if err != nil {
-		// Log error but don't fail - return empty key
-		decryptedKey = ""
+// MarkContentRequestsAvailable marks the approved content requests of a
+// media item available and returns them.
+func (r *GormRepository) MarkContentRequestsAvailable(
+	ctx context.Context,
+	mediaID uuid.UUID,
+	at time.Time,
+) ([]*domain.ContentRequest, error) {
+	var models []ContentRequest
+	result := r.db.WithContext(ctx).Model(&models).
+		Clauses(clause.Returning{}).
+		Where("media_id = ? AND status = ?", mediaID, string(domain.ContentRequestApproved)).
+		Updates(map[string]interface{}{
+			"status":       string(domain.ContentRequestAvailable),
+			"available_at": at,
+		})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to mark content requests available: %w", result.Error)
 	}
 
-	return &domain.MetadataProviderConfig{
+	requests := make([]*domain.ContentRequest, len(models))
+	for i := range models {
+		requests[i] = toDomainContentRequest(&models[i])
+	}
+	return requests, nil
+}
+
+// GetRequestQuotaOverride returns the content request quota an admin set
+// for a user.
+func (r *GormRepository) GetRequestQuotaOverride(
+	ctx context.Context,
+	userID uuid.UUID,
+) (*domain.RequestQuotaOverride, error) {
+	var model RequestQuotaOverride
+	if err := r.db.WithContext(ctx).First(&model, "user_id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("request quota override not found")
+		}
+		return nil, fmt.Errorf("failed to get request quota override: %w", err)
+	}
+
+	return &domain.RequestQuotaOverride{
+		TenantID:  model.TenantID,
+		UserID:    model.UserID,
+		Quota:     domain.RequestQuota{Movies: model.Movies, Seasons: model.Seasons},
+		SetBy:     model.SetBy,
+		UpdatedAt: model.UpdatedAt,
+	}, nil
+}
+
+// SetRequestQuotaOverride sets the content request quota of a user,
+// replacing any set before.
+func (r *GormRepository) SetRequestQuotaOverride(ctx context.Context, override *domain.RequestQuotaOverride) error {
+	model := &RequestQuotaOverride{
+		UserID:    override.UserID,
+		TenantID:  override.TenantID,
+		Movies:    override.Quota.Movies,
+		Seasons:   override.Quota.Seasons,
+		SetBy:     override.SetBy,
+		UpdatedAt: override.UpdatedAt,
+	}
+	if err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"movies", "seasons", "set_by", "updated_at"}),
+	}).Create(model).Error; err != nil {
+		return fmt.Errorf("failed to set request quota override: %w", err)
+	}
+	return nil
+}
+
+// DeleteRequestQuotaOverride returns a user to the content request quota
+// of their roles.
+func (r *GormRepository) DeleteRequestQuotaOverride(ctx context.Context, userID uuid.UUID) error {
+	if err := r.db.WithContext(ctx).Delete(&RequestQuotaOverride{}, "user_id = ?", userID).Error; err != nil {
+		return fmt.Errorf("failed to delete request quota override: %w", err)
+	}
+	return nil
+}
+
+func toDomainContentRequest(model *ContentRequest) *domain.ContentRequest {
+	return &domain.ContentRequest{
 		ID:           model.ID,
-		Name:         model.Name,
-		ProviderType: model.ProviderType,
-		APIKey:       decryptedKey,
-		Enabled:      model.Enabled,
-		Priority:     model.Priority,
+		TenantID:     model.TenantID,
+		UserID:       model.UserID,
+		MediaType:    models.MediaType(model.MediaType),
+		Provider:     model.Provider,
+		ProviderID:   model.ProviderID,
+		Title:        model.Title,
+		Year:         model.Year,
+		Overview:     model.Overview,
+		PosterURL:    model.PosterURL,
+		Seasons:      model.Seasons,
+		Quality:      model.Quality,
+		Status:       domain.ContentRequestStatus(model.Status),
+		LibraryID:    model.LibraryID,
+		MediaID:      model.MediaID,
+		DecidedBy:    model.DecidedBy,
+		AutoApproved: model.AutoApproved,
+		Reason:       model.Reason,
 		CreatedAt:    model.CreatedAt,
-		UpdatedAt:    model.UpdatedAt,
+		DecidedAt:    model.DecidedAt,
+		AvailableAt:  model.AvailableAt,
+	}
+}
+
+// CreateMediaIssue stores a media issue.
+func (r *GormRepository) CreateMediaIssue(ctx context.Context, issue *domain.MediaIssue) error {
+	model := &MediaIssue{
+		TenantID:  issue.TenantID,
+		MediaID:   issue.MediaID,
+		EpisodeID: issue.EpisodeID,
+		UserID:    issue.UserID,
+		Category:  string(issue.Category),
+		Comment:   issue.Comment,
+		Status:    string(issue.Status),
+		CreatedAt: issue.CreatedAt,
+	}
+	if err := r.db.WithContext(ctx).Create(model).Error; err != nil {
+		return fmt.Errorf("failed to create media issue: %w", err)
+	}
+
+	issue.ID = model.ID
+	issue.TenantID = model.TenantID
+	return nil
+}
+
+// GetMediaIssue retrieves a media issue by ID.
+func (r *GormRepository) GetMediaIssue(ctx context.Context, id uuid.UUID) (*domain.MediaIssue, error) {
+	var model MediaIssue
+	if err := r.db.WithContext(ctx).First(&model, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("media issue not found")
+		}
+		return nil, fmt.Errorf("failed to get media issue: %w", err)
+	}
+
+	return toDomainMediaIssue(&model), nil
+}
+
+// ListMediaIssues returns a page of the media issues matching the filter,
+// newest first, and the number of issues in all pages.
+func (r *GormRepository) ListMediaIssues(
+	ctx context.Context,
+	filter domain.MediaIssueFilter,
+	limit, offset int,
+) ([]*domain.MediaIssue, int64, error) {
+	q := r.db.WithContext(ctx).Model(&MediaIssue{})
+	if filter.UserID != nil {
+		q = q.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.MediaID != nil {
+		q = q.Where("media_id = ?", *filter.MediaID)
+	}
+	if filter.Status != "" {
+		q = q.Where("status = ?", string(filter.Status))
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count media issues: %w", err)
+	}
+
+	var models []MediaIssue
+	if err := q.Order("created_at DESC, id").Limit(limit).Offset(offset).
+		Find(&models).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list media issues: %w", err)
+	}
+
+	issues := make([]*domain.MediaIssue, len(models))
+	for i := range models {
+		issues[i] = toDomainMediaIssue(&models[i])
+	}
+	return issues, total, nil
+}
+
+// ResolveMediaIssue saves the resolution of a media issue, unless it is no
+// longer open.
+func (r *GormRepository) ResolveMediaIssue(ctx context.Context, issue *domain.MediaIssue) error {
+	result := r.db.WithContext(ctx).Model(&MediaIssue{}).
+		Where("id = ? AND status = ?", issue.ID, string(domain.IssueOpen)).
+		Updates(map[string]interface{}{
+			"status":      string(issue.Status),
+			"action":      string(issue.Action),
+			"resolution":  issue.Resolution,
+			"resolved_by": issue.ResolvedBy,
+			"resolved_at": issue.ResolvedAt,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to resolve media issue: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		if _, err := r.GetMediaIssue(ctx, issue.ID); err != nil {
+			return err
+		}
+		return pkgerrors.Conflict("media issue was resolved already")
+	}
+	return nil
+}
+
+func toDomainMediaIssue(model *MediaIssue) *domain.MediaIssue {
+	return &domain.MediaIssue{
+		ID:         model.ID,
+		TenantID:   model.TenantID,
+		MediaID:    model.MediaID,
+		EpisodeID:  model.EpisodeID,
+		UserID:     model.UserID,
+		Category:   domain.IssueCategory(model.Category),
+		Comment:    model.Comment,
+		Status:     domain.IssueStatus(model.Status),
+		Action:     domain.IssueAction(model.Action),
+		Resolution: model.Resolution,
+		ResolvedBy: model.ResolvedBy,
+		CreatedAt:  model.CreatedAt,
+		ResolvedAt: model.ResolvedAt,
+	}
+}
+
+// CreateKiosk creates a kiosk.
+func (r *GormRepository) CreateKiosk(ctx context.Context, kiosk *domain.Kiosk) error {
+	model := &Kiosk{
+		TenantID:   kiosk.TenantID,
+		Name:       kiosk.Name,
+		LibraryIDs: kiosk.LibraryIDs,
+		KeyHash:    kiosk.KeyHash,
+		CreatedBy:  kiosk.CreatedBy,
+		CreatedAt:  kiosk.CreatedAt,
+	}
+	if err := r.db.WithContext(ctx).Create(model).Error; err != nil {
+		return fmt.Errorf("failed to create kiosk: %w", err)
+	}
+
+	kiosk.ID = model.ID
+	kiosk.TenantID = model.TenantID
+	return nil
+}
+
+// GetKiosk retrieves a kiosk by ID.
+func (r *GormRepository) GetKiosk(ctx context.Context, id uuid.UUID) (*domain.Kiosk, error) {
+	var model Kiosk
+	if err := r.db.WithContext(ctx).First(&model, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("kiosk not found")
+		}
+		return nil, fmt.Errorf("failed to get kiosk: %w", err)
+	}
+
+	return toDomainKiosk(&model), nil
+}
+
+// GetKioskByKeyHash retrieves the kiosk of a key.
+func (r *GormRepository) GetKioskByKeyHash(ctx context.Context, keyHash string) (*domain.Kiosk, error) {
+	var model Kiosk
+	if err := r.db.WithContext(ctx).First(&model, "key_hash = ?", keyHash).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("kiosk not found")
+		}
+		return nil, fmt.Errorf("failed to get kiosk: %w", err)
+	}
+
+	return toDomainKiosk(&model), nil
+}
+
+// ListKiosks lists the kiosks, newest first.
+func (r *GormRepository) ListKiosks(ctx context.Context) ([]*domain.Kiosk, error) {
+	var models []Kiosk
+	if err := r.db.WithContext(ctx).Order("created_at DESC, id").Find(&models).Error; err != nil {
+		return nil, fmt.Errorf("failed to list kiosks: %w", err)
+	}
+
+	kiosks := make([]*domain.Kiosk, len(models))
+	for i := range models {
+		kiosks[i] = toDomainKiosk(&models[i])
+	}
+	return kiosks, nil
+}
+
+// RevokeKiosk revokes a kiosk. Revoking a revoked kiosk does nothing.
+func (r *GormRepository) RevokeKiosk(ctx context.Context, id uuid.UUID, at time.Time) error {
+	result := r.db.WithContext(ctx).Model(&Kiosk{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", at)
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke kiosk: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		if _, err := r.GetKiosk(ctx, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func toDomainKiosk(model *Kiosk) *domain.Kiosk {
+	return &domain.Kiosk{
+		ID:         model.ID,
+		TenantID:   model.TenantID,
+		Name:       model.Name,
+		LibraryIDs: model.LibraryIDs,
+		KeyHash:    model.KeyHash,
+		CreatedBy:  model.CreatedBy,
+		CreatedAt:  model.CreatedAt,
+		RevokedAt:  model.RevokedAt,
+	}
+}
+
+// LatestViewing retrieves the last viewing of a user of a media item, or of
+// an episode of it.
+func (r *GormRepository) LatestViewing(
+	ctx context.Context,
+	userID, mediaID uuid.UUID,
+	episodeID *uuid.UUID,
+) (*domain.Viewing, error) {
+	q := r.db.WithContext(ctx).Where("user_id = ? AND media_id = ?", userID, mediaID)
+	if episodeID != nil {
+		q = q.Where("episode_id = ?", *episodeID)
+	} else {
+		q = q.Where("episode_id IS NULL")
+	}
+
+	var model Viewing
+	if err := q.Order("started_at DESC").First(&model).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("viewing not found")
+		}
+		return nil, fmt.Errorf("failed to get viewing: %w", err)
+	}
+
+	return toDomainViewing(&model), nil
+}
+
+// SaveViewing creates a viewing without an ID, or updates it.
+func (r *GormRepository) SaveViewing(ctx context.Context, viewing *domain.Viewing) error {
+	model := &Viewing{
+		ID:            viewing.ID,
+		MediaID:       viewing.MediaID,
+		EpisodeID:     viewing.EpisodeID,
+		UserID:        viewing.UserID,
+		Furthest:      viewing.Furthest,
+		Duration:      viewing.Duration,
+		Completed:     viewing.Completed,
+		Rewatch:       viewing.Rewatch,
+		StartedAt:     viewing.StartedAt,
+		LastHeartbeat: viewing.LastHeartbeat,
+	}
+	if viewing.ID == uuid.Nil {
+		if err := r.db.WithContext(ctx).Create(model).Error; err != nil {
+			return fmt.Errorf("failed to create viewing: %w", err)
+		}
+		viewing.ID = model.ID
+		return nil
+	}
+
+	if err := r.db.WithContext(ctx).Model(model).Select("furthest", "duration", "completed", "last_heartbeat").
+		Updates(model).Error; err != nil {
+		return fmt.Errorf("failed to update viewing: %w", err)
+	}
+	return nil
+}
+
+// ListViewings lists the viewings of a media item and its episodes started
+// after since.
+func (r *GormRepository) ListViewings(ctx context.Context, mediaID uuid.UUID, since time.Time) ([]*domain.Viewing, error) {
+	var models []Viewing
+	if err := r.db.WithContext(ctx).
+		Where("media_id = ? AND started_at >= ?", mediaID, since).
+		Order("started_at").
+		Find(&models).Error; err != nil {
+		return nil, fmt.Errorf("failed to list viewings: %w", err)
+	}
+
+	viewings := make([]*domain.Viewing, len(models))
+	for i := range models {
+		viewings[i] = toDomainViewing(&models[i])
+	}
+	return viewings, nil
+}
+
+// titleStats is a row of the viewings aggregated per title.
+type titleStats struct {
+	MediaID        uuid.UUID
+	Title          string
+	Viewings       int64
+	Viewers        int64
+	Completions    int64
+	Rewatches      int64
+	AverageWatched float64
+	LastViewedAt   *time.Time
+}
+
+// ListTitleStats aggregates the viewings started since the filter's time
+// per title, including titles nobody watched, and returns a page of them
+// in the order of the filter and the number of titles in all pages.
+// Extras are left out.
+func (r *GormRepository) ListTitleStats(
+	ctx context.Context,
+	filter domain.AnalyticsFilter,
+	limit, offset int,
+) ([]*domain.TitleStats, int64, error) {
+	q := r.db.WithContext(ctx).Table("media_items AS m").
+		Select(`m.id AS media_id, m.title,
+			COUNT(v.id) AS viewings,
+			COUNT(DISTINCT v.user_id) AS viewers,
+			COUNT(v.id) FILTER (WHERE v.completed) AS completions,
+			COUNT(v.id) FILTER (WHERE v.rewatch) AS rewatches,
+			COALESCE(AVG(CASE
+				WHEN v.completed THEN 1
+				WHEN v.duration > 0 THEN LEAST(v.furthest::float8 / v.duration, 1)
+				ELSE 0 END) FILTER (WHERE v.id IS NOT NULL), 0) AS average_watched,
+			MAX(v.last_heartbeat) AS last_viewed_at`).
+		Joins("LEFT JOIN viewings v ON v.media_id = m.id AND v.started_at >= ?", filter.Since).
+		Where("m.deleted_at IS NULL AND m.parent_id IS NULL").
+		Group("m.id, m.title")
+	if filter.LibraryID != nil {
+		q = q.Where("m.library_id = ?", *filter.LibraryID)
+	}
+	if filter.Sort == domain.AnalyticsLowestCompletion {
+		q = q.Having("COUNT(v.id) > 0")
+	}
+
+	var total int64
+	if err := r.db.WithContext(ctx).Table("(?) AS s", q).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count title stats: %w", err)
+	}
+
+	order := "s.viewings, s.last_viewed_at NULLS FIRST, s.title, s.media_id"
+	switch filter.Sort {
+	case domain.AnalyticsMostWatched:
+		order = "s.viewings DESC, s.completions DESC, s.title, s.media_id"
+	case domain.AnalyticsLowestCompletion:
+		order = "s.completions::float8 / s.viewings, s.viewings DESC, s.title, s.media_id"
+	}
+
+	var rows []titleStats
+	if err := r.db.WithContext(ctx).Table("(?) AS s", q).
+		Order(order).Limit(limit).Offset(offset).
+		Scan(&rows).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list title stats: %w", err)
+	}
+
+	stats := make([]*domain.TitleStats, len(rows))
+	for i, row := range rows {
+		stats[i] = &domain.TitleStats{
+			MediaID:        row.MediaID,
+			Title:          row.Title,
+			Viewings:       row.Viewings,
+			Viewers:        row.Viewers,
+			Completions:    row.Completions,
+			Rewatches:      row.Rewatches,
+			AverageWatched: row.AverageWatched,
+			LastViewedAt:   row.LastViewedAt,
+		}
+	}
+	return stats, total, nil
+}
+
+// AnonymizeViewings moves a user's viewings to a new random user ID.
+func (r *GormRepository) AnonymizeViewings(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result := r.db.WithContext(ctx).Model(&Viewing{}).
+		Where("user_id = ?", userID).
+		Update("user_id", uuid.New())
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to anonymize viewings: %w", result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
+
+func toDomainViewing(model *Viewing) *domain.Viewing {
+	return &domain.Viewing{
+		ID:            model.ID,
+		MediaID:       model.MediaID,
+		EpisodeID:     model.EpisodeID,
+		UserID:        model.UserID,
+		Furthest:      model.Furthest,
+		Duration:      model.Duration,
+		Completed:     model.Completed,
+		Rewatch:       model.Rewatch,
+		StartedAt:     model.StartedAt,
+		LastHeartbeat: model.LastHeartbeat,
 	}
 }
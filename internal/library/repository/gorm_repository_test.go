@@ -34,6 +34,7 @@ func (suite *LibraryRepositoryTestSuite) SetupSuite() {
 		&repository.Episode{},
 		&repository.MetadataProvider{},
 		&repository.ScanHistory{},
+		&repository.StorageUsage{},
 	)
 	suite.Require().NoError(err)
 }
@@ -45,7 +46,7 @@ func (suite *LibraryRepositoryTestSuite) SetupTest() {
 	suite.Require().NoError(err)
 
 	// Clean tables before each test
-	suite.container.TruncateTables("episodes", "media_items", "scan_histories", "metadata_providers", "libraries")
+	suite.container.TruncateTables("storage_usage", "episodes", "media_items", "scan_histories", "metadata_providers", "libraries")
 }
 
 func (suite *LibraryRepositoryTestSuite) TestCreateLibrary() {
@@ -74,6 +75,25 @@ func (suite *LibraryRepositoryTestSuite) TestCreateLibrary() {
 	suite.Equal(library.Path, retrieved.Path)
 }
 
+func (suite *LibraryRepositoryTestSuite) TestCreateLibrary_NameUniquePerTenant() {
+	newLibrary := func(tenantID uuid.UUID, path string) *domain.Library {
+		return &domain.Library{
+			ID:           uuid.New(),
+			TenantID:     tenantID,
+			Name:         "Movies",
+			Path:         path,
+			Type:         "movie",
+			Enabled:      true,
+			ScanInterval: 3600,
+		}
+	}
+	tenantA, tenantB := uuid.New(), uuid.New()
+
+	suite.Require().NoError(suite.repo.CreateLibrary(suite.ctx, newLibrary(tenantA, "/a/movies")))
+	suite.Require().NoError(suite.repo.CreateLibrary(suite.ctx, newLibrary(tenantB, "/b/movies")))
+	suite.Error(suite.repo.CreateLibrary(suite.ctx, newLibrary(tenantA, "/a/more-movies")))
+}
+
 func (suite *LibraryRepositoryTestSuite) TestGetLibraryByPath() {
 	// Arrange
 	library := &domain.Library{
@@ -247,6 +267,76 @@ func (suite *LibraryRepositoryTestSuite) TestMediaOperations() {
 	suite.Require().NoError(err)
 }
 
+func (suite *LibraryRepositoryTestSuite) TestUpsertMediaBatch() {
+	// The unique path index is created by a migration, not by AutoMigrate
+	suite.Require().NoError(suite.container.DB.Exec(`
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_media_items_file_path_unique
+		ON media_items (file_path) WHERE file_path <> '' AND deleted_at IS NULL
+	`).Error)
+
+	library := &domain.Library{ID: uuid.New(), Name: "Movies", Path: "/movies", Type: "movie", Enabled: true}
+	suite.Require().NoError(suite.repo.CreateLibrary(suite.ctx, library))
+
+	newMedia := func(path, title string) *models.Media {
+		return &models.Media{
+			ID:        uuid.New(),
+			LibraryID: library.ID,
+			Title:     title,
+			Type:      models.MediaTypeMovie,
+			Status:    "available",
+			FilePath:  path,
+		}
+	}
+
+	first := newMedia("/movies/a.mkv", "A")
+	written, err := suite.repo.UpsertMediaBatch(suite.ctx, []*models.Media{first, newMedia("/movies/b.mkv", "B")})
+	suite.Require().NoError(err)
+	suite.Equal(2, written)
+
+	// A row with a known path updates the existing media and keeps its ID
+	again := newMedia("/movies/a.mkv", "A (2001)")
+	written, err = suite.repo.UpsertMediaBatch(suite.ctx, []*models.Media{again})
+	suite.Require().NoError(err)
+	suite.Equal(1, written)
+	suite.Equal(first.ID, again.ID)
+
+	byPath, err := suite.repo.GetMediaByPath(suite.ctx, "/movies/a.mkv")
+	suite.Require().NoError(err)
+	suite.Equal("A (2001)", byPath.Title)
+
+	mediaList, err := suite.repo.ListMediaByLibrary(suite.ctx, library.ID, nil, 10, 0)
+	suite.Require().NoError(err)
+	suite.Len(mediaList, 2)
+}
+
+func (suite *LibraryRepositoryTestSuite) TestRefreshStorageUsage_StampsTenant() {
+	tenantID := uuid.New()
+	library := &domain.Library{
+		ID: uuid.New(), TenantID: tenantID, Name: "Movies", Path: "/movies", Type: "movie", Enabled: true,
+	}
+	suite.Require().NoError(suite.repo.CreateLibrary(suite.ctx, library))
+	suite.Require().NoError(suite.repo.CreateMedia(suite.ctx, &models.Media{
+		ID:         uuid.New(),
+		TenantID:   tenantID,
+		LibraryID:  library.ID,
+		Title:      "A",
+		Type:       models.MediaTypeMovie,
+		Status:     "available",
+		Resolution: "1080p",
+		FilePath:   "/movies/a.mkv",
+		FileSize:   1024,
+	}))
+
+	// Refreshes run in the background, without a tenant
+	suite.Require().NoError(suite.repo.RefreshStorageUsage(suite.ctx, library.ID))
+
+	usage, err := suite.repo.ListStorageUsage(suite.ctx, &library.ID)
+	suite.Require().NoError(err)
+	suite.Require().Len(usage, 1)
+	suite.Equal(tenantID, usage[0].TenantID)
+	suite.Equal(int64(1024), usage[0].TotalBytes)
+}
+
 func (suite *LibraryRepositoryTestSuite) TestEpisodeOperations() {
 	// Create library and series
 	library := &domain.Library{
@@ -2,11 +2,14 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/narwhalmedia/narwhal/internal/library/domain"
 	"github.com/narwhalmedia/narwhal/pkg/models"
+	"github.com/narwhalmedia/narwhal/pkg/saga"
+	"github.com/narwhalmedia/narwhal/pkg/task"
 )
 
 // LibraryRepository defines the interface for library data access.
@@ -17,6 +20,16 @@ type LibraryRepository interface {
 	UpdateLibrary(ctx context.Context, library *domain.Library) error
 	DeleteLibrary(ctx context.Context, id uuid.UUID) error
 	ListLibraries(ctx context.Context, enabled *bool) ([]*domain.Library, error)
+	// ListLibraryFiles lists the files the media and episodes of a library
+	// point to.
+	ListLibraryFiles(ctx context.Context, libraryID uuid.UUID) ([]*domain.LibraryFile, error)
+	// RelocateLibrary rewrites the from prefix of the paths of a library,
+	// its media, episodes and scan manifest to to, in one transaction. It
+	// returns the number of media and episode paths rewritten.
+	RelocateLibrary(ctx context.Context, libraryID uuid.UUID, from, to string) (int, error)
+	// RenameFiles points the media and episodes of renamed files at their
+	// new paths, in one transaction.
+	RenameFiles(ctx context.Context, files []domain.RenamedFile) error
 }
 
 // MediaRepository defines the interface for media data access.
@@ -24,6 +37,12 @@ type MediaRepository interface {
 	CreateMedia(ctx context.Context, media *models.Media) error
 	GetMedia(ctx context.Context, id uuid.UUID) (*models.Media, error)
 	GetMediaByPath(ctx context.Context, path string) (*models.Media, error)
+	GetMediaByPaths(ctx context.Context, paths []string) (map[string]*models.Media, error)
+	GetMainMediaInDirectory(ctx context.Context, libraryID uuid.UUID, dir, nameContains string) (*models.Media, error)
+	ListExtras(ctx context.Context, parentID uuid.UUID) ([]*models.Media, error)
+	CreateMediaBatch(ctx context.Context, media []*models.Media) error
+	UpdateMediaBatch(ctx context.Context, media []*models.Media) error
+	UpsertMediaBatch(ctx context.Context, media []*models.Media) (int, error)
 	SearchMedia(
 		ctx context.Context,
 		query string,
@@ -40,6 +59,13 @@ type MediaRepository interface {
 		status *string,
 		limit, offset int,
 	) ([]*models.Media, error)
+	// ListMediaByArtist lists the media of an artist across libraries,
+	// matching the name case-insensitively. Extras are left out.
+	ListMediaByArtist(ctx context.Context, artist string) ([]*models.Media, error)
+	// ListMediaAddedSince lists up to limit available media added after
+	// since to the given libraries, or to every library if libraryIDs is
+	// empty, newest first. Extras are left out.
+	ListMediaAddedSince(ctx context.Context, since time.Time, libraryIDs []uuid.UUID, limit int) ([]*models.Media, error)
 }
 
 // EpisodeRepository defines the interface for episode data access.
@@ -51,6 +77,13 @@ type EpisodeRepository interface {
 	ListEpisodesBySeason(ctx context.Context, mediaID uuid.UUID, season int) ([]*models.Episode, error)
 	UpdateEpisode(ctx context.Context, episode *models.Episode) error
 	DeleteEpisode(ctx context.Context, id uuid.UUID) error
+	// ListEpisodeFiles lists the files of the episodes of a media item, by
+	// path and part. Episodes pointing to a file without episode files are
+	// listed with that file as a whole.
+	ListEpisodeFiles(ctx context.Context, mediaID uuid.UUID) ([]*models.EpisodeFile, error)
+	// SetEpisodeFiles replaces the files of an episode and points the
+	// episode at the first, in one transaction.
+	SetEpisodeFiles(ctx context.Context, episodeID uuid.UUID, files []*models.EpisodeFile) error
 }
 
 // ScanRepository defines the interface for scan history data access.
@@ -58,6 +91,11 @@ type ScanRepository interface {
 	CreateScanHistory(ctx context.Context, scan *domain.ScanResult) error
 	UpdateScanHistory(ctx context.Context, scan *domain.ScanResult) error
 	GetLatestScan(ctx context.Context, libraryID uuid.UUID) (*domain.ScanResult, error)
+	GetScanManifest(ctx context.Context, libraryID uuid.UUID) (domain.ScanManifest, error)
+	SaveScanManifest(ctx context.Context, libraryID uuid.UUID, manifest domain.ScanManifest) error
+	// InterruptScans completes every scan that never completed, recording
+	// reason as its error. It returns the number of scans changed.
+	InterruptScans(ctx context.Context, reason string) (int, error)
 }
 
 // MetadataProviderRepository defines the interface for metadata provider data access.
@@ -70,6 +108,364 @@ type MetadataProviderRepository interface {
 	DeleteProvider(ctx context.Context, id uuid.UUID) error
 }
 
+// WatchStateRepository defines the interface for per-user watch state data access.
+type WatchStateRepository interface {
+	ListWatchStatesByMedia(ctx context.Context, mediaID uuid.UUID) ([]*models.WatchHistory, error)
+	UpsertWatchState(ctx context.Context, state *models.WatchHistory) error
+	ListWatchStatesByUser(ctx context.Context, userID uuid.UUID) ([]*models.WatchHistory, error)
+	// ListWatchStatesSince lists up to limit watch states of every user
+	// that are not completed and were updated after since, most recent
+	// first.
+	ListWatchStatesSince(ctx context.Context, since time.Time, limit int) ([]*models.WatchHistory, error)
+	// AnonymizeWatchStates moves a user's watch states to a new random user
+	// ID, keeping them for statistics. It returns the number of rows moved.
+	AnonymizeWatchStates(ctx context.Context, userID uuid.UUID) (int64, error)
+	// AddToWatchlist adds media to a user's watchlist. Adding media that is
+	// on it already does nothing.
+	AddToWatchlist(ctx context.Context, entry *domain.WatchlistEntry) error
+	RemoveFromWatchlist(ctx context.Context, userID, mediaID uuid.UUID) error
+	// ListWatchlist lists a user's watchlist, most recently added first.
+	ListWatchlist(ctx context.Context, userID uuid.UUID) ([]*domain.WatchlistEntry, error)
+	// DeleteWatchlist empties a user's watchlist. It returns the number of
+	// entries removed.
+	DeleteWatchlist(ctx context.Context, userID uuid.UUID) (int64, error)
+}
+
+// WorkflowRepository defines the interface for media workflow data access.
+type WorkflowRepository interface {
+	CreateWorkflow(ctx context.Context, wf *saga.Workflow) error
+	UpdateWorkflow(ctx context.Context, wf *saga.Workflow) error
+	GetLatestWorkflow(ctx context.Context, mediaID uuid.UUID) (*saga.Workflow, error)
+	// InterruptWorkflows fails every running or compensating workflow,
+	// recording reason as its error. It returns the number of workflows
+	// changed.
+	InterruptWorkflows(ctx context.Context, reason string) (int, error)
+	// ArchiveWorkflows moves up to limit finished workflows to the workflow
+	// history: those that finished before finishedBefore and are not among
+	// the keepPerMedia most recent finished workflows of their media item.
+	// It returns the number of workflows moved.
+	ArchiveWorkflows(ctx context.Context, finishedBefore time.Time, keepPerMedia, limit int) (int, error)
+	ListWorkflowHistory(
+		ctx context.Context,
+		filter domain.WorkflowHistoryFilter,
+		limit, offset int,
+	) ([]*saga.Workflow, error)
+}
+
+// TranscodePolicyRepository defines the interface for transcode policy data access.
+type TranscodePolicyRepository interface {
+	CreateTranscodePolicy(ctx context.Context, policy *domain.TranscodePolicy) error
+	GetTranscodePolicy(ctx context.Context, id uuid.UUID) (*domain.TranscodePolicy, error)
+	ListTranscodePolicies(ctx context.Context, libraryID uuid.UUID) ([]*domain.TranscodePolicy, error)
+	UpdateTranscodePolicy(ctx context.Context, policy *domain.TranscodePolicy) error
+	DeleteTranscodePolicy(ctx context.Context, id uuid.UUID) error
+	// ClaimTranscode records a transcode of a media item. It reports false
+	// if the transcode was requested before.
+	ClaimTranscode(
+		ctx context.Context,
+		mediaID, policyID uuid.UUID,
+		key string,
+		priority domain.TranscodePriority,
+	) (bool, error)
+	// ListTranscodeRequests lists a page of the requested transcodes, most
+	// recent first.
+	ListTranscodeRequests(ctx context.Context, limit, offset int) ([]*domain.TranscodeRequest, error)
+	SetTranscodePriority(ctx context.Context, mediaID uuid.UUID, key string, priority domain.TranscodePriority) error
+	// GetTranscodePrioritySignals returns what hints at each of the media
+	// being watched soon, counting watches since since.
+	GetTranscodePrioritySignals(
+		ctx context.Context,
+		mediaIDs []uuid.UUID,
+		since time.Time,
+	) ([]*domain.TranscodePrioritySignals, error)
+	// ListPopularGenres lists the genres of the media most users watched
+	// since since, most watched first.
+	ListPopularGenres(ctx context.Context, since time.Time, limit int) ([]string, error)
+	// GetTranscodeOutput retrieves the completed transcode of a source with
+	// a profile.
+	GetTranscodeOutput(ctx context.Context, sourceHash, profileHash string) (*domain.TranscodeOutput, error)
+	// SaveTranscodeOutput records a completed transcode, replacing the one
+	// of the same source and profile.
+	SaveTranscodeOutput(ctx context.Context, output *domain.TranscodeOutput) error
+	DeleteTranscodeOutput(ctx context.Context, sourceHash, profileHash string) error
+	// InvalidateTranscodeOutputs deletes the transcodes of a media item
+	// made from a source other than keepSourceHash; empty deletes them all.
+	// It returns the number of outputs deleted.
+	InvalidateTranscodeOutputs(ctx context.Context, mediaID uuid.UUID, keepSourceHash string) (int, error)
+	// GetLoudnessMeasurement retrieves the measured loudness of a source.
+	GetLoudnessMeasurement(ctx context.Context, sourceHash string) (*domain.LoudnessMeasurement, error)
+	// SaveLoudnessMeasurement records the measured loudness of a source,
+	// replacing the one measured before.
+	SaveLoudnessMeasurement(ctx context.Context, measurement *domain.LoudnessMeasurement) error
+}
+
+// TaskRepository defines the interface for background task data access.
+type TaskRepository interface {
+	CreateTask(ctx context.Context, t *task.Task) error
+	UpdateTask(ctx context.Context, t *task.Task) error
+	GetTask(ctx context.Context, id uuid.UUID) (*task.Task, error)
+	ListTasks(ctx context.Context, filter task.Filter, limit, offset int) ([]*task.Task, error)
+	InterruptTasks(ctx context.Context, reason string) (int, error)
+}
+
+// SearchIndexRepository defines the interface for full-text search index
+// data access.
+type SearchIndexRepository interface {
+	// IndexMedia creates or replaces the search documents of media items.
+	IndexMedia(ctx context.Context, media []*models.Media) error
+	RemoveFromSearchIndex(ctx context.Context, mediaID uuid.UUID) error
+	// PruneSearchIndex removes the documents last indexed before the given
+	// time and returns the number removed.
+	PruneSearchIndex(ctx context.Context, before time.Time) (int, error)
+}
+
+// StorageRepository defines the interface for storage usage data access.
+type StorageRepository interface {
+	// RefreshStorageUsage recomputes the storage usage of a library from
+	// its media.
+	RefreshStorageUsage(ctx context.Context, libraryID uuid.UUID) error
+	DeleteStorageUsage(ctx context.Context, libraryID uuid.UUID) error
+	// ListStorageUsage returns the storage usage of a library, or of every
+	// library if libraryID is nil.
+	ListStorageUsage(ctx context.Context, libraryID *uuid.UUID) ([]*domain.StorageUsage, error)
+	// ListPruneItems lists the media items with a file of a library, or of
+	// every library if libraryID is nil, except extras, with when anyone
+	// last watched them.
+	ListPruneItems(ctx context.Context, libraryID *uuid.UUID) ([]domain.PruneItem, error)
+}
+
+// HookRepository defines the interface for hook state and run data access.
+type HookRepository interface {
+	// ListHookStates returns whether each hook that was enabled or disabled
+	// through the API is enabled, by hook name.
+	ListHookStates(ctx context.Context) (map[string]bool, error)
+	SetHookEnabled(ctx context.Context, name string, enabled bool) error
+	CreateHookRun(ctx context.Context, run *domain.HookRun) error
+	// ListHookRuns lists the most recent runs of a hook, or of every hook
+	// if name is empty, newest first.
+	ListHookRuns(ctx context.Context, name string, limit int) ([]*domain.HookRun, error)
+	DeleteHookRunsBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// WorkerPoolRepository defines the interface for the worker pool sizes set
+// at runtime.
+type WorkerPoolRepository interface {
+	// ListWorkerPoolSizes returns the size of each worker pool that was
+	// resized through the API, by pool name.
+	ListWorkerPoolSizes(ctx context.Context) (map[string]int, error)
+	SetWorkerPoolSize(ctx context.Context, name string, size int) error
+}
+
+// FeedRepository defines the interface for feed and grab data access.
+type FeedRepository interface {
+	CreateFeed(ctx context.Context, feed *domain.Feed) error
+	GetFeed(ctx context.Context, id uuid.UUID) (*domain.Feed, error)
+	// ListFeeds lists the feeds of a library, or of every library if
+	// libraryID is nil.
+	ListFeeds(ctx context.Context, libraryID *uuid.UUID) ([]*domain.Feed, error)
+	UpdateFeed(ctx context.Context, feed *domain.Feed) error
+	DeleteFeed(ctx context.Context, id uuid.UUID) error
+	// SetFeedPolled records a poll of a feed and its error, if any.
+	SetFeedPolled(ctx context.Context, id uuid.UUID, polledAt time.Time, lastError string) error
+	// ClaimFeedItem records a grab unless its release was grabbed before.
+	// It reports whether the grab was recorded.
+	ClaimFeedItem(ctx context.Context, grab *domain.FeedGrab) (bool, error)
+	UpdateFeedGrab(ctx context.Context, grab *domain.FeedGrab) error
+	// ReleaseFeedItem forgets a grab, so its release is grabbed again.
+	ReleaseFeedItem(ctx context.Context, key string) error
+	// GrabbedFeedItems returns which of the keys were grabbed.
+	GrabbedFeedItems(ctx context.Context, keys []string) (map[string]bool, error)
+}
+
+// CalendarRepository defines the interface for calendar data access.
+type CalendarRepository interface {
+	// ListCalendar lists the episode air dates and movie release dates of
+	// monitored media in [start, end), of a library or of every library if
+	// libraryID is nil, ordered by date.
+	ListCalendar(ctx context.Context, start, end time.Time, libraryID *uuid.UUID) ([]*domain.CalendarEntry, error)
+	// GetCalendarFeedKey returns the calendar feed key of a user.
+	GetCalendarFeedKey(ctx context.Context, userID uuid.UUID) (*domain.CalendarFeedKey, error)
+	// SetCalendarFeedKey sets the calendar feed key of a user, replacing
+	// any set before.
+	SetCalendarFeedKey(ctx context.Context, key *domain.CalendarFeedKey) error
+}
+
+// WantedRepository defines the interface for wanted media data access.
+type WantedRepository interface {
+	// ListMissing lists the monitored movies whose file is missing and the
+	// episodes of monitored series that aired before airedBefore without a
+	// file, of a library or of every library if libraryID is nil.
+	ListMissing(ctx context.Context, libraryID *uuid.UUID, airedBefore time.Time) ([]*domain.WantedItem, error)
+	// ListUpgradeCandidates lists the monitored movies and episodes with a
+	// file in libraries with a quality cutoff, with the quality of the file.
+	ListUpgradeCandidates(ctx context.Context, libraryID *uuid.UUID) ([]*domain.WantedItem, error)
+	// GetWantedItem returns a movie, or an episode of a series, with the
+	// quality of its file, if any, and the cutoff of its library.
+	GetWantedItem(ctx context.Context, mediaID uuid.UUID, episodeID *uuid.UUID) (*domain.WantedItem, error)
+}
+
+// BlocklistRepository defines the interface for release blocklist data
+// access.
+type BlocklistRepository interface {
+	AddBlocklistEntry(ctx context.Context, entry *domain.BlocklistEntry) error
+	// ListBlocklist lists a page of entries, newest first, and the number
+	// of entries in all pages.
+	ListBlocklist(ctx context.Context, limit, offset int) ([]*domain.BlocklistEntry, int64, error)
+	DeleteBlocklistEntry(ctx context.Context, id uuid.UUID) error
+	// FindBlocklisted returns the entries that may block any of the
+	// releases; callers match them with domain.MatchBlocklist.
+	FindBlocklisted(ctx context.Context, releases []domain.ReleaseIdentity) ([]*domain.BlocklistEntry, error)
+}
+
+// ManualImportRepository defines the interface for parked import data
+// access.
+type ManualImportRepository interface {
+	CreateManualImport(ctx context.Context, mi *domain.ManualImport) error
+	GetManualImport(ctx context.Context, id uuid.UUID) (*domain.ManualImport, error)
+	// ListManualImports lists a page of imports with a status, or of every
+	// status if status is nil, oldest first, and the number of imports in
+	// all pages.
+	ListManualImports(
+		ctx context.Context,
+		status *domain.ManualImportStatus,
+		limit, offset int,
+	) ([]*domain.ManualImport, int64, error)
+	// ResolveManualImport records the resolution of a pending import. It
+	// fails with a conflict if the import was resolved already.
+	ResolveManualImport(ctx context.Context, mi *domain.ManualImport) error
+}
+
+// PlaybackIssueRepository defines the interface for playback issue data
+// access.
+type PlaybackIssueRepository interface {
+	CreatePlaybackIssue(ctx context.Context, issue *domain.PlaybackIssue) error
+	// GetPlaybackIssueStats aggregates the issues reported for media since
+	// the given time, with its flag, if any.
+	GetPlaybackIssueStats(ctx context.Context, mediaID uuid.UUID, since time.Time) (*domain.PlaybackIssueStats, error)
+	// ListPlaybackIssueStats aggregates the issues reported per media
+	// matching the filter, highest error rate first, and returns a page of
+	// them and the number of media in all pages.
+	ListPlaybackIssueStats(
+		ctx context.Context,
+		filter domain.PlaybackIssueFilter,
+		limit, offset int,
+	) ([]*domain.PlaybackIssueStats, int64, error)
+	// FlagPlayback flags media unless it is flagged already. It reports
+	// whether the media was flagged.
+	FlagPlayback(ctx context.Context, flag *domain.PlaybackFlag) (bool, error)
+	// ClearPlaybackIssues removes the flag of media and the issues reported
+	// for it.
+	ClearPlaybackIssues(ctx context.Context, mediaID uuid.UUID) error
+}
+
+// ShareLinkRepository defines the interface for share link data access.
+type ShareLinkRepository interface {
+	CreateShareLink(ctx context.Context, link *domain.ShareLink) error
+	GetShareLink(ctx context.Context, id uuid.UUID) (*domain.ShareLink, error)
+	// GetShareLinkByTokenHash returns the link of a token, across tenants.
+	GetShareLinkByTokenHash(ctx context.Context, tokenHash string) (*domain.ShareLink, error)
+	// ListShareLinks returns a page of the links matching the filter, newest
+	// first, and the number of links in all pages.
+	ListShareLinks(ctx context.Context, filter domain.ShareLinkFilter, limit, offset int) ([]*domain.ShareLink, int64, error)
+	// RevokeShareLink revokes a link. Revoking a revoked link does nothing.
+	RevokeShareLink(ctx context.Context, id uuid.UUID, at time.Time) error
+	// RecordShareLinkPlay counts a play of a link and records it, unless the
+	// link is no longer active at the time of the play, in which case it
+	// fails with a conflict. It returns the link as of the play.
+	RecordShareLinkPlay(ctx context.Context, play *domain.ShareLinkPlay) (*domain.ShareLink, error)
+	// ListShareLinkPlays returns a page of the plays of a link, newest
+	// first, and the number of plays in all pages.
+	ListShareLinkPlays(ctx context.Context, linkID uuid.UUID, limit, offset int) ([]*domain.ShareLinkPlay, int64, error)
+}
+
+// ContentRequestRepository stores the content users request.
+type ContentRequestRepository interface {
+	// CreateContentRequest stores a pending request. It fails with a
+	// conflict if the title has a request that was not denied.
+	CreateContentRequest(ctx context.Context, request *domain.ContentRequest) error
+	GetContentRequest(ctx context.Context, id uuid.UUID) (*domain.ContentRequest, error)
+	// GetContentRequestsByProviderIDs returns the requests that were not
+	// denied of titles of a provider, by provider ID.
+	GetContentRequestsByProviderIDs(
+		ctx context.Context,
+		provider string,
+		providerIDs []string,
+	) (map[string]*domain.ContentRequest, error)
+	// ListContentRequests returns a page of the requests matching the
+	// filter, newest first, and the number of requests in all pages.
+	ListContentRequests(
+		ctx context.Context,
+		filter domain.ContentRequestFilter,
+		limit, offset int,
+	) ([]*domain.ContentRequest, int64, error)
+	// ListContentRequestsSince returns the requests a user made since a
+	// time, oldest first.
+	ListContentRequestsSince(ctx context.Context, userID uuid.UUID, since time.Time) ([]*domain.ContentRequest, error)
+	// DecideContentRequest saves the approval or denial of a request. It
+	// fails with a conflict if the request is no longer pending.
+	DecideContentRequest(ctx context.Context, request *domain.ContentRequest) error
+	// MarkContentRequestsAvailable marks the approved requests of a media
+	// item available and returns them.
+	MarkContentRequestsAvailable(ctx context.Context, mediaID uuid.UUID, at time.Time) ([]*domain.ContentRequest, error)
+	// GetRequestQuotaOverride returns the quota an admin set for a user. It
+	// fails with a not found error if none is set.
+	GetRequestQuotaOverride(ctx context.Context, userID uuid.UUID) (*domain.RequestQuotaOverride, error)
+	// SetRequestQuotaOverride sets the quota of a user, replacing any set
+	// before.
+	SetRequestQuotaOverride(ctx context.Context, override *domain.RequestQuotaOverride) error
+	// DeleteRequestQuotaOverride returns a user to the quota of their
+	// roles. Deleting a missing override is not an error.
+	DeleteRequestQuotaOverride(ctx context.Context, userID uuid.UUID) error
+}
+
+// MediaIssueRepository stores the issues users report with media.
+type MediaIssueRepository interface {
+	CreateMediaIssue(ctx context.Context, issue *domain.MediaIssue) error
+	GetMediaIssue(ctx context.Context, id uuid.UUID) (*domain.MediaIssue, error)
+	// ListMediaIssues returns a page of the issues matching the filter,
+	// newest first, and the number of issues in all pages.
+	ListMediaIssues(
+		ctx context.Context,
+		filter domain.MediaIssueFilter,
+		limit, offset int,
+	) ([]*domain.MediaIssue, int64, error)
+	// ResolveMediaIssue saves the resolution of an issue. It fails with a
+	// conflict if the issue is no longer open.
+	ResolveMediaIssue(ctx context.Context, issue *domain.MediaIssue) error
+}
+
+// KioskRepository defines the interface for kiosk data access.
+type KioskRepository interface {
+	CreateKiosk(ctx context.Context, kiosk *domain.Kiosk) error
+	GetKiosk(ctx context.Context, id uuid.UUID) (*domain.Kiosk, error)
+	// GetKioskByKeyHash returns the kiosk of a key, across tenants.
+	GetKioskByKeyHash(ctx context.Context, keyHash string) (*domain.Kiosk, error)
+	// ListKiosks lists the kiosks, newest first.
+	ListKiosks(ctx context.Context) ([]*domain.Kiosk, error)
+	// RevokeKiosk revokes a kiosk. Revoking a revoked kiosk does nothing.
+	RevokeKiosk(ctx context.Context, id uuid.UUID, at time.Time) error
+}
+
+// ViewingRepository defines the interface for viewing analytics data
+// access.
+type ViewingRepository interface {
+	// LatestViewing returns the last viewing of a user of a media item, or
+	// of an episode of it if episodeID is set.
+	LatestViewing(ctx context.Context, userID, mediaID uuid.UUID, episodeID *uuid.UUID) (*domain.Viewing, error)
+	// SaveViewing creates a viewing without an ID, or updates it.
+	SaveViewing(ctx context.Context, viewing *domain.Viewing) error
+	// ListViewings lists the viewings of a media item and its episodes
+	// started after since.
+	ListViewings(ctx context.Context, mediaID uuid.UUID, since time.Time) ([]*domain.Viewing, error)
+	// ListTitleStats aggregates the viewings per title matching the
+	// filter, including titles nobody watched, and returns a page of them
+	// in the order of the filter and the number of titles in all pages.
+	ListTitleStats(ctx context.Context, filter domain.AnalyticsFilter, limit, offset int) ([]*domain.TitleStats, int64, error)
+	// AnonymizeViewings moves a user's viewings to a new random user ID,
+	// keeping them for analytics. It returns the number of rows moved.
+	AnonymizeViewings(ctx context.Context, userID uuid.UUID) (int64, error)
+}
+
 // Repository aggregates all repository interfaces.
 type Repository interface {
 	LibraryRepository
@@ -77,6 +473,25 @@ type Repository interface {
 	EpisodeRepository
 	ScanRepository
 	MetadataProviderRepository
+	WatchStateRepository
+	WorkflowRepository
+	TranscodePolicyRepository
+	TaskRepository
+	SearchIndexRepository
+	StorageRepository
+	HookRepository
+	WorkerPoolRepository
+	FeedRepository
+	CalendarRepository
+	WantedRepository
+	BlocklistRepository
+	ManualImportRepository
+	PlaybackIssueRepository
+	ShareLinkRepository
+	ContentRequestRepository
+	MediaIssueRepository
+	KioskRepository
+	ViewingRepository
 
 	// Transaction support
 	BeginTx(ctx context.Context) (Repository, error)
@@ -5,12 +5,17 @@ import (
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/saga"
+	"github.com/narwhalmedia/narwhal/pkg/task"
 )
 
 // Library represents a media library in the database.
 type Library struct {
 	ID           uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
-	Name         string    `gorm:"uniqueIndex;not null"`
+	TenantID     uuid.UUID `gorm:"type:uuid;not null;default:'00000000-0000-0000-0000-000000000000';index;uniqueIndex:idx_libraries_tenant_name"`
+	Name         string    `gorm:"not null;uniqueIndex:idx_libraries_tenant_name"`
 	Path         string    `gorm:"uniqueIndex;not null"`
 	MediaType    string    `gorm:"type:varchar(50);not null"`
 	Enabled      bool      `gorm:"default:true"`
@@ -20,6 +25,33 @@ type Library struct {
 	UpdatedAt    time.Time
 	DeletedAt    gorm.DeletedAt `gorm:"index"`
 
+	// Scan rules
+	ExcludePatterns []string `gorm:"type:text[]"`
+	ExtrasMode      string   `gorm:"type:varchar(20);not null;default:'skip'"`
+
+	IgnoreExtrasFolders bool `gorm:"not null;default:false"`
+
+	// Folder structure profile; empty for no expectations
+	FolderProfile string `gorm:"type:varchar(20);not null;default:''"`
+
+	// Quality
+	QualityCutoff string `gorm:"type:varchar(10);not null;default:''"`
+
+	// Metadata preferences
+	MetadataLanguage string `gorm:"type:varchar(35);not null;default:''"`
+	MetadataRegion   string `gorm:"type:varchar(2);not null;default:''"`
+	TitleStyle       string `gorm:"type:varchar(20);not null;default:'translated'"`
+
+	// Anime libraries parse absolute episode numbers
+	Anime bool `gorm:"not null;default:false"`
+
+	// Naming formats; empty for the defaults
+	MovieFormat   string `gorm:"type:varchar(255);not null;default:''"`
+	EpisodeFormat string `gorm:"type:varchar(255);not null;default:''"`
+
+	// Audio normalization of transcodes; empty for off
+	AudioNormalization string `gorm:"type:varchar(20);not null;default:''"`
+
 	// Relationships
 	MediaItems  []MediaItem   `gorm:"foreignKey:LibraryID;constraint:OnDelete:CASCADE"`
 	ScanHistory []ScanHistory `gorm:"foreignKey:LibraryID;constraint:OnDelete:CASCADE"`
@@ -28,15 +60,22 @@ type Library struct {
 // MediaItem represents a media file in the database.
 type MediaItem struct {
 	ID             uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	TenantID       uuid.UUID `gorm:"type:uuid;not null;default:'00000000-0000-0000-0000-000000000000';index"`
 	LibraryID      uuid.UUID `gorm:"type:uuid;not null;index"`
 	Title          string    `gorm:"not null;index"`
 	OriginalTitle  string
+	Artist         string `gorm:"not null;default:'';index"`
 	MediaType      string `gorm:"type:varchar(50);not null;index"`
 	Status         string `gorm:"type:varchar(50);not null;default:'pending';index"`
 	FilePath       string `gorm:"index"`
 	FileSize       int64
 	FileModifiedAt *time.Time
 
+	// Extras
+	ParentID  *uuid.UUID `gorm:"type:uuid;index"`
+	EpisodeID *uuid.UUID `gorm:"type:uuid;index"`
+	ExtraType string     `gorm:"type:varchar(50);not null;default:''"`
+
 	// Metadata
 	Description string `gorm:"type:text"`
 	ReleaseDate *time.Time
@@ -60,6 +99,15 @@ type MediaItem struct {
 	PosterPath   string
 	BackdropPath string
 
+	// Theme music
+	ThemeKey string `gorm:"type:varchar(255);not null;default:''"`
+	ThemeURL string `gorm:"type:text;not null;default:''"`
+
+	// Calendar
+	Monitored           bool `gorm:"not null;default:true"`
+	DigitalReleaseDate  *time.Time
+	PhysicalReleaseDate *time.Time
+
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt gorm.DeletedAt `gorm:"index"`
@@ -71,17 +119,19 @@ type MediaItem struct {
 
 // Episode represents a TV show episode.
 type Episode struct {
-	ID            uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
-	MediaID       uuid.UUID `gorm:"type:uuid;not null;index"`
-	SeasonNumber  int       `gorm:"not null;index"`
-	EpisodeNumber int       `gorm:"not null;index"`
-	Title         string
-	Description   string `gorm:"type:text"`
-	AirDate       *time.Time
-	Runtime       int // minutes
-	FilePath      string
-	FileSize      int64
-	Status        string `gorm:"type:varchar(50);not null;default:'missing';index"`
+	ID             uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	TenantID       uuid.UUID `gorm:"type:uuid;not null;default:'00000000-0000-0000-0000-000000000000';index"`
+	MediaID        uuid.UUID `gorm:"type:uuid;not null;index"`
+	SeasonNumber   int       `gorm:"not null;index"`
+	EpisodeNumber  int       `gorm:"not null;index"`
+	AbsoluteNumber int       `gorm:"not null;default:0"` // across seasons, for anime; 0 if unknown
+	Title          string
+	Description    string `gorm:"type:text"`
+	AirDate        *time.Time
+	Runtime        int // minutes
+	FilePath       string
+	FileSize       int64
+	Status         string `gorm:"type:varchar(50);not null;default:'missing';index"`
 
 	// Media info
 	VideoCodec string `gorm:"type:varchar(50)"`
@@ -97,12 +147,28 @@ type Episode struct {
 	Media MediaItem `gorm:"foreignKey:MediaID"`
 }
 
+// EpisodeFile is a file holding an episode, or one part of an episode split
+// across files.
+type EpisodeFile struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	EpisodeID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_episode_files_part"`
+	MediaID   uuid.UUID `gorm:"type:uuid;not null;index"`
+	FilePath  string    `gorm:"type:text;not null;index"`
+	Part      int       `gorm:"not null;default:0;uniqueIndex:idx_episode_files_part"` // 1-based; 0 for whole episodes
+	Duration  int       // seconds
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	// Relationships
+	Episode Episode `gorm:"foreignKey:EpisodeID;constraint:OnDelete:CASCADE"`
+}
+
 // MetadataProvider represents a metadata provider configuration.
 type MetadataProvider struct {
 	ID           uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
 	Name         string    `gorm:"uniqueIndex;not null"`
 	ProviderType string    `gorm:"type:varchar(50);not null"` // tmdb, tvdb, musicbrainz
-	APIKey       string    `gorm:"type:text"`                 // Should be encrypted
+	APIKey       string    `gorm:"type:text"`                 // Encrypted
 	Enabled      bool      `gorm:"default:true"`
 	Priority     int       `gorm:"default:0"`
 	CreatedAt    time.Time
@@ -126,6 +192,424 @@ type ScanHistory struct {
 	Library Library `gorm:"foreignKey:LibraryID"`
 }
 
+// ScanManifestEntry records the state of a library directory at its last
+// scan, so incremental scans can skip unchanged directories.
+type ScanManifestEntry struct {
+	LibraryID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Path      string    `gorm:"type:text;primaryKey"`
+	ModTime   time.Time `gorm:"not null"`
+	Size      int64     `gorm:"default:0"`
+	Files     int       `gorm:"default:0"`
+
+	// Relationships
+	Library Library `gorm:"foreignKey:LibraryID;constraint:OnDelete:CASCADE"`
+}
+
+// WatchState represents a user's playback progress on a media item or episode.
+type WatchState struct {
+	ID          uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	TenantID    uuid.UUID  `gorm:"type:uuid;not null;default:'00000000-0000-0000-0000-000000000000';index"`
+	UserID      uuid.UUID  `gorm:"type:uuid;not null;index"`
+	MediaID     uuid.UUID  `gorm:"type:uuid;not null;index"`
+	EpisodeID   *uuid.UUID `gorm:"type:uuid;index"`
+	Position    int        `gorm:"default:0"` // seconds
+	Duration    int        `gorm:"default:0"` // seconds
+	Completed   bool       `gorm:"default:false"`
+	LastWatched time.Time  `gorm:"not null;index"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Workflow represents the progress of a multi-step media workflow.
+type Workflow struct {
+	ID        uuid.UUID         `gorm:"type:uuid;primaryKey"`
+	MediaID   uuid.UUID         `gorm:"type:uuid;not null;index"`
+	Status    string            `gorm:"type:varchar(50);not null;index"`
+	Steps     []saga.StepRecord `gorm:"type:jsonb;serializer:json"`
+	Data      map[string]string `gorm:"type:jsonb;serializer:json"`
+	Error     string            `gorm:"type:text"`
+	CreatedAt time.Time         `gorm:"index"`
+	UpdatedAt time.Time
+}
+
+// WorkflowHistory is a finished workflow moved out of the workflow table.
+// Its steps, data and error are kept as gzip-compressed JSON in Payload;
+// only the columns history is queried by are stored as is.
+type WorkflowHistory struct {
+	ID         uuid.UUID `gorm:"type:uuid;primaryKey"`
+	MediaID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	Status     string    `gorm:"type:varchar(50);not null;index"`
+	Payload    []byte    `gorm:"type:bytea"`
+	CreatedAt  time.Time
+	FinishedAt time.Time `gorm:"not null;index"`
+	ArchivedAt time.Time `gorm:"not null"`
+}
+
+// TranscodePolicy asks for the media of a library to be transcoded
+// automatically.
+type TranscodePolicy struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	LibraryID uuid.UUID `gorm:"type:uuid;not null;index"`
+	Name      string    `gorm:"type:varchar(255);not null"`
+	Profile   string    `gorm:"type:varchar(100);not null"`
+	Format    string    `gorm:"type:varchar(20);not null"`
+	Enabled   bool      `gorm:"not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	// Audio normalization; empty for the library default
+	AudioNormalization string `gorm:"type:varchar(20);not null;default:''"`
+
+	// Relationships
+	Library Library `gorm:"foreignKey:LibraryID;constraint:OnDelete:CASCADE"`
+}
+
+// TranscodeRequest records that a transcode of a media item was requested,
+// so re-scans and overlapping policies do not request it again.
+type TranscodeRequest struct {
+	MediaID   uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Key       string    `gorm:"type:varchar(255);primaryKey"`
+	PolicyID  uuid.UUID `gorm:"type:uuid;index"`
+	Priority  string    `gorm:"type:varchar(10);not null;default:'normal'"`
+	CreatedAt time.Time `gorm:"index"`
+
+	// Relationships
+	Media MediaItem `gorm:"foreignKey:MediaID;constraint:OnDelete:CASCADE"`
+}
+
+// TranscodeOutput is a completed transcode of a source with a profile.
+type TranscodeOutput struct {
+	SourceHash  string    `gorm:"type:varchar(64);primaryKey"`
+	ProfileHash string    `gorm:"type:varchar(32);primaryKey"`
+	MediaID     uuid.UUID `gorm:"type:uuid;not null;index"`
+	Path        string    `gorm:"type:text;not null"`
+	Size        int64     `gorm:"not null;default:0"`
+	CompletedAt time.Time `gorm:"not null"`
+
+	// Relationships
+	Media MediaItem `gorm:"foreignKey:MediaID;constraint:OnDelete:CASCADE"`
+}
+
+// LoudnessMeasurement is the measured loudness of a source, by the hash of
+// its content.
+type LoudnessMeasurement struct {
+	SourceHash   string    `gorm:"type:varchar(64);primaryKey"`
+	Integrated   float64   `gorm:"not null"`
+	TruePeak     float64   `gorm:"not null"`
+	Range        float64   `gorm:"not null"`
+	Threshold    float64   `gorm:"not null"`
+	TargetOffset float64   `gorm:"not null"`
+	MeasuredAt   time.Time `gorm:"not null"`
+}
+
+// Task records a background operation and its progress.
+type Task struct {
+	ID          uuid.UUID         `gorm:"type:uuid;primaryKey"`
+	Type        string            `gorm:"type:varchar(100);not null;index"`
+	Payload     map[string]string `gorm:"type:jsonb;serializer:json"`
+	Status      string            `gorm:"type:varchar(50);not null;index"`
+	Progress    float64
+	Message     string         `gorm:"type:text"`
+	Logs        []task.LogLine `gorm:"type:jsonb;serializer:json"`
+	Error       string         `gorm:"type:text"`
+	CreatedAt   time.Time      `gorm:"index"`
+	StartedAt   *time.Time
+	CompletedAt *time.Time
+	UpdatedAt   time.Time
+}
+
+// SearchDocument is the full-text search entry of a media item.
+type SearchDocument struct {
+	MediaID   uuid.UUID `gorm:"type:uuid;primaryKey"`
+	LibraryID uuid.UUID `gorm:"type:uuid;not null;index"`
+	Document  string    `gorm:"type:tsvector;not null"`
+	UpdatedAt time.Time `gorm:"index"`
+}
+
+// StorageUsage is the disk space taken by the files of one media type and
+// resolution in a library.
+type StorageUsage struct {
+	LibraryID  uuid.UUID `gorm:"type:uuid;primaryKey"`
+	TenantID   uuid.UUID `gorm:"type:uuid;not null;default:'00000000-0000-0000-0000-000000000000';index"`
+	MediaType  string    `gorm:"type:varchar(50);primaryKey"`
+	Resolution string    `gorm:"type:varchar(20);primaryKey"`
+	FileCount  int64     `gorm:"not null"`
+	TotalBytes int64     `gorm:"not null"`
+	UpdatedAt  time.Time
+}
+
+// HookState overrides whether a configured hook is enabled.
+type HookState struct {
+	Name      string `gorm:"type:varchar(100);primaryKey"`
+	Enabled   bool   `gorm:"not null"`
+	UpdatedAt time.Time
+}
+
+// WorkerPoolSize overrides the configured size of a worker pool.
+type WorkerPoolSize struct {
+	Name      string `gorm:"type:varchar(50);primaryKey"`
+	Size      int    `gorm:"not null"`
+	UpdatedAt time.Time
+}
+
+// HookRun records one run of a hook script and its captured output.
+type HookRun struct {
+	ID         uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Hook       string    `gorm:"type:varchar(100);not null;index:idx_hook_runs_hook_started"`
+	Point      string    `gorm:"type:varchar(50);not null"`
+	EventType  string    `gorm:"type:varchar(100)"`
+	EntityID   string    `gorm:"type:varchar(100)"`
+	ExitCode   int       `gorm:"not null"`
+	TimedOut   bool      `gorm:"not null"`
+	Output     string    `gorm:"type:text"`
+	Error      string    `gorm:"type:text"`
+	StartedAt  time.Time `gorm:"not null;index:idx_hook_runs_hook_started"`
+	DurationMs int64     `gorm:"not null"`
+}
+
+// Feed is an RSS feed polled for releases to grab into a library.
+type Feed struct {
+	ID             uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	TenantID       uuid.UUID `gorm:"type:uuid;not null;default:'00000000-0000-0000-0000-000000000000';index"`
+	LibraryID      uuid.UUID `gorm:"type:uuid;not null;index"`
+	Name           string    `gorm:"type:varchar(255);not null"`
+	URL            string    `gorm:"type:text;not null"` // Encrypted, as it carries passkeys
+	Include        string    `gorm:"type:text"`
+	Exclude        string    `gorm:"type:text"`
+	Qualities      []string  `gorm:"type:jsonb;serializer:json"`
+	DownloadClient string    `gorm:"type:varchar(100)"`
+	Enabled        bool      `gorm:"not null"`
+	LastPolledAt   *time.Time
+	LastError      string `gorm:"type:text"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+
+	// Relationships
+	Library Library `gorm:"foreignKey:LibraryID;constraint:OnDelete:CASCADE"`
+}
+
+// FeedGrab records a release grabbed from a feed, so it is not grabbed
+// again from the same or another feed of the tenant.
+type FeedGrab struct {
+	TenantID       uuid.UUID `gorm:"type:uuid;primaryKey;default:'00000000-0000-0000-0000-000000000000'"`
+	Key            string    `gorm:"type:varchar(512);primaryKey"`
+	FeedID         uuid.UUID `gorm:"type:uuid;index"`
+	Title          string    `gorm:"type:text"`
+	DownloadClient string    `gorm:"type:varchar(100)"`
+	DownloadID     string    `gorm:"type:varchar(100)"`
+	GrabbedAt      time.Time `gorm:"not null"`
+}
+
+// BlocklistEntry is a release that is never grabbed again.
+type BlocklistEntry struct {
+	ID        uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	InfoHash  string     `gorm:"type:varchar(40);index"`
+	GUID      string     `gorm:"type:varchar(512);index"`
+	Title     string     `gorm:"type:text"`
+	Indexer   string     `gorm:"type:varchar(255)"`
+	MediaID   *uuid.UUID `gorm:"type:uuid"`
+	Source    string     `gorm:"type:varchar(20);not null"`
+	Reason    string     `gorm:"type:text"`
+	CreatedAt time.Time  `gorm:"index"`
+}
+
+// PlaybackIssue is a problem a client reported while playing media.
+type PlaybackIssue struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	MediaID     uuid.UUID `gorm:"type:uuid;not null;index:idx_playback_issues_media_reported,priority:1"`
+	UserID      string    `gorm:"type:varchar(100)"`
+	SessionID   string    `gorm:"type:varchar(100);not null"`
+	Kind        string    `gorm:"type:varchar(20);not null"`
+	PositionMs  int64     `gorm:"not null"`
+	StallMs     int64     `gorm:"not null"`
+	FromBitrate int64     `gorm:"not null"`
+	ToBitrate   int64     `gorm:"not null"`
+	Error       string    `gorm:"type:text"`
+	Client      string    `gorm:"type:varchar(255)"`
+	ReportedAt  time.Time `gorm:"not null;index:idx_playback_issues_media_reported,priority:2"`
+
+	// Relationships
+	Media MediaItem `gorm:"foreignKey:MediaID;constraint:OnDelete:CASCADE"`
+}
+
+// PlaybackFlag marks media whose playback error rate exceeded the
+// threshold.
+type PlaybackFlag struct {
+	MediaID   uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Reason    string    `gorm:"type:varchar(20);not null"`
+	ErrorRate float64   `gorm:"not null"`
+	FlaggedAt time.Time `gorm:"not null"`
+
+	// Relationships
+	Media MediaItem `gorm:"foreignKey:MediaID;constraint:OnDelete:CASCADE"`
+}
+
+// ShareLink lets a guest stream one media item. Only a hash of its token is
+// stored.
+type ShareLink struct {
+	ID         uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	TenantID   uuid.UUID `gorm:"type:uuid;not null;default:'00000000-0000-0000-0000-000000000000';index"`
+	MediaID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	CreatedBy  uuid.UUID `gorm:"type:uuid;not null;index"`
+	TokenHash  string    `gorm:"type:varchar(64);not null;uniqueIndex"`
+	MaxBitrate int       `gorm:"not null"` // kbps
+	MaxViews   int       `gorm:"not null;default:0"`
+	Views      int       `gorm:"not null;default:0"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	RevokedAt  *time.Time
+	CreatedAt  time.Time `gorm:"index"`
+
+	// Relationships
+	Media MediaItem `gorm:"foreignKey:MediaID;constraint:OnDelete:CASCADE"`
+}
+
+// ShareLinkPlay is a guest playing a share link.
+type ShareLinkPlay struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	ShareLinkID uuid.UUID `gorm:"type:uuid;not null;index:idx_share_link_plays_link_played,priority:1"`
+	MediaID     uuid.UUID `gorm:"type:uuid;not null"`
+	IPAddress   string    `gorm:"type:varchar(45)"`
+	UserAgent   string    `gorm:"type:text"`
+	PlayedAt    time.Time `gorm:"not null;index:idx_share_link_plays_link_played,priority:2"`
+
+	// Relationships
+	ShareLink ShareLink `gorm:"foreignKey:ShareLinkID;constraint:OnDelete:CASCADE"`
+}
+
+// ContentRequest is a user asking for a movie or series that is not in the
+// libraries. Each title has at most one request that was not denied.
+type ContentRequest struct {
+	ID           uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	TenantID     uuid.UUID `gorm:"type:uuid;not null;default:'00000000-0000-0000-0000-000000000000';index"`
+	UserID       uuid.UUID `gorm:"type:uuid;not null;index:idx_content_requests_user_created,priority:1"`
+	MediaType    string    `gorm:"type:varchar(50);not null"`
+	Provider     string    `gorm:"type:varchar(50);not null"`
+	ProviderID   string    `gorm:"type:varchar(100);not null"`
+	Title        string    `gorm:"not null"`
+	Year         int
+	Overview     string `gorm:"type:text"`
+	PosterURL    string
+	Seasons      []int      `gorm:"type:jsonb;serializer:json"`
+	Quality      string     `gorm:"type:varchar(20)"`
+	Status       string     `gorm:"type:varchar(20);not null;default:'pending';index"`
+	LibraryID    *uuid.UUID `gorm:"type:uuid"`
+	MediaID      *uuid.UUID `gorm:"type:uuid;index"`
+	DecidedBy    *uuid.UUID `gorm:"type:uuid"`
+	AutoApproved bool       `gorm:"not null;default:false"`
+	Reason       string     `gorm:"type:text"`
+	CreatedAt    time.Time  `gorm:"index:idx_content_requests_user_created,priority:2"`
+	DecidedAt    *time.Time
+	AvailableAt  *time.Time
+}
+
+// RequestQuotaOverride is the content request quota an admin set for a
+// user.
+type RequestQuotaOverride struct {
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	TenantID  uuid.UUID `gorm:"type:uuid;not null;default:'00000000-0000-0000-0000-000000000000';index"`
+	Movies    int       `gorm:"not null;default:0"`
+	Seasons   int       `gorm:"not null;default:0"`
+	SetBy     uuid.UUID `gorm:"type:uuid;not null"`
+	UpdatedAt time.Time
+}
+
+// MediaIssue is a problem a user reported with a media item.
+type MediaIssue struct {
+	ID         uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	TenantID   uuid.UUID  `gorm:"type:uuid;not null;default:'00000000-0000-0000-0000-000000000000';index"`
+	MediaID    uuid.UUID  `gorm:"type:uuid;not null;index"`
+	EpisodeID  *uuid.UUID `gorm:"type:uuid"`
+	UserID     uuid.UUID  `gorm:"type:uuid;not null;index"`
+	Category   string     `gorm:"type:varchar(30);not null"`
+	Comment    string     `gorm:"type:text"`
+	Status     string     `gorm:"type:varchar(20);not null;default:'open';index"`
+	Action     string     `gorm:"type:varchar(30)"`
+	Resolution string     `gorm:"type:text"`
+	ResolvedBy *uuid.UUID `gorm:"type:uuid"`
+	CreatedAt  time.Time  `gorm:"index"`
+	ResolvedAt *time.Time
+
+	// Relationships
+	Media MediaItem `gorm:"foreignKey:MediaID;constraint:OnDelete:CASCADE"`
+}
+
+// Kiosk is a display client that reads what is playing and what was added
+// without a user account.
+type Kiosk struct {
+	ID         uuid.UUID   `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	TenantID   uuid.UUID   `gorm:"type:uuid;not null;default:'00000000-0000-0000-0000-000000000000';index"`
+	Name       string      `gorm:"not null"`
+	LibraryIDs []uuid.UUID `gorm:"type:jsonb;serializer:json"`
+	KeyHash    string      `gorm:"type:varchar(64);not null;uniqueIndex"`
+	CreatedBy  uuid.UUID   `gorm:"type:uuid;not null"`
+	CreatedAt  time.Time   `gorm:"index"`
+	RevokedAt  *time.Time
+}
+
+// CalendarFeedKey is the key the calendar feed tokens of a user are
+// derived from.
+type CalendarFeedKey struct {
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	TenantID  uuid.UUID `gorm:"type:uuid;not null;default:'00000000-0000-0000-0000-000000000000';index"`
+	Key       string    `gorm:"type:varchar(64);not null"`
+	CreatedAt time.Time
+}
+
+// Viewing is one user watching a title or episode, from the first progress
+// heartbeat to the last.
+type Viewing struct {
+	ID            uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	TenantID      uuid.UUID  `gorm:"type:uuid;not null;default:'00000000-0000-0000-0000-000000000000';index"`
+	MediaID       uuid.UUID  `gorm:"type:uuid;not null;index:idx_viewings_media_started,priority:1"`
+	EpisodeID     *uuid.UUID `gorm:"type:uuid"`
+	UserID        uuid.UUID  `gorm:"type:uuid;not null;index"`
+	Furthest      int        `gorm:"not null;default:0"` // seconds
+	Duration      int        `gorm:"not null;default:0"` // seconds
+	Completed     bool       `gorm:"not null;default:false"`
+	Rewatch       bool       `gorm:"not null;default:false"`
+	StartedAt     time.Time  `gorm:"not null;index:idx_viewings_media_started,priority:2"`
+	LastHeartbeat time.Time  `gorm:"not null"`
+
+	// Relationships
+	Media MediaItem `gorm:"foreignKey:MediaID;constraint:OnDelete:CASCADE"`
+}
+
+// WatchlistEntry is media a user wants to watch.
+type WatchlistEntry struct {
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	MediaID   uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	CreatedAt time.Time
+
+	// Relationships
+	Media MediaItem `gorm:"foreignKey:MediaID;constraint:OnDelete:CASCADE"`
+}
+
+// ManualImport is a completed download waiting for an admin to match it to
+// a library item.
+type ManualImport struct {
+	ID              uuid.UUID                `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	LibraryID       uuid.UUID                `gorm:"type:uuid;not null;index"`
+	WorkflowID      uuid.UUID                `gorm:"type:uuid;not null"`
+	MediaID         uuid.UUID                `gorm:"type:uuid;not null"`
+	Path            string                   `gorm:"type:text;not null"`
+	DownloadClient  string                   `gorm:"type:varchar(100)"`
+	ReleaseInfoHash string                   `gorm:"type:varchar(40)"`
+	ReleaseGUID     string                   `gorm:"type:varchar(512)"`
+	ReleaseTitle    string                   `gorm:"type:text"`
+	ReleaseIndexer  string                   `gorm:"type:varchar(255)"`
+	Title           string                   `gorm:"type:varchar(500)"`
+	Year            int                      `gorm:"type:integer"`
+	Candidates      []domain.ImportCandidate `gorm:"type:jsonb;serializer:json"`
+	Replacement     *domain.FileComparison   `gorm:"type:jsonb;serializer:json"`
+	Status          string                   `gorm:"type:varchar(20);not null;index"`
+	ImportedMediaID *uuid.UUID               `gorm:"type:uuid"`
+	CreatedAt       time.Time                `gorm:"index"`
+	ResolvedAt      *time.Time
+
+	// Relationships
+	Library Library `gorm:"foreignKey:LibraryID;constraint:OnDelete:CASCADE"`
+}
+
 // BeforeCreate hook for Episode to ensure unique constraint.
 func (e *Episode) BeforeCreate(tx *gorm.DB) error {
 	// GORM doesn't support composite unique indexes well, so we'll handle it in the migration
@@ -145,6 +629,10 @@ func (Episode) TableName() string {
 	return "episodes"
 }
 
+func (EpisodeFile) TableName() string {
+	return "episode_files"
+}
+
 func (MetadataProvider) TableName() string {
 	return "metadata_providers"
 }
@@ -152,3 +640,99 @@ func (MetadataProvider) TableName() string {
 func (ScanHistory) TableName() string {
 	return "scan_history"
 }
+
+func (ScanManifestEntry) TableName() string {
+	return "scan_manifest_entries"
+}
+
+func (WatchState) TableName() string {
+	return "watch_states"
+}
+
+func (Workflow) TableName() string {
+	return "workflows"
+}
+
+func (WorkflowHistory) TableName() string {
+	return "workflow_history"
+}
+
+func (TranscodePolicy) TableName() string {
+	return "transcode_policies"
+}
+
+func (TranscodeRequest) TableName() string {
+	return "transcode_requests"
+}
+
+func (Task) TableName() string {
+	return "tasks"
+}
+
+func (SearchDocument) TableName() string {
+	return "search_documents"
+}
+
+func (StorageUsage) TableName() string {
+	return "storage_usage"
+}
+
+func (HookState) TableName() string {
+	return "hook_states"
+}
+
+func (WorkerPoolSize) TableName() string {
+	return "worker_pool_sizes"
+}
+
+func (HookRun) TableName() string {
+	return "hook_runs"
+}
+
+func (Feed) TableName() string {
+	return "feeds"
+}
+
+func (FeedGrab) TableName() string {
+	return "feed_grabs"
+}
+
+func (BlocklistEntry) TableName() string {
+	return "blocklist"
+}
+
+func (ManualImport) TableName() string {
+	return "manual_imports"
+}
+
+func (PlaybackIssue) TableName() string {
+	return "playback_issues"
+}
+
+func (PlaybackFlag) TableName() string {
+	return "playback_flags"
+}
+
+func (ShareLink) TableName() string {
+	return "share_links"
+}
+
+func (ShareLinkPlay) TableName() string {
+	return "share_link_plays"
+}
+
+func (Kiosk) TableName() string {
+	return "kiosks"
+}
+
+func (Viewing) TableName() string {
+	return "viewings"
+}
+
+func (ContentRequest) TableName() string {
+	return "content_requests"
+}
+
+func (WatchlistEntry) TableName() string {
+	return "watchlist_entries"
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/internal/library/repository"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// AnalyticsService reports which titles are actually watched, from the
+// viewings progress heartbeats are aggregated into: completion rates,
+// rewatches, retention curves and the points where viewers stop watching.
+// Admins use it to find titles nobody finishes or watches at all.
+type AnalyticsService struct {
+	repo   repository.Repository
+	logger interfaces.Logger
+}
+
+// NewAnalyticsService creates a new analytics service.
+func NewAnalyticsService(repo repository.Repository, logger interfaces.Logger) *AnalyticsService {
+	return &AnalyticsService{repo: repo, logger: logger}
+}
+
+// ListTitleStats lists a page of the stats of the titles matching the
+// filter, in its order, and the number of titles in all pages.
+func (s *AnalyticsService) ListTitleStats(
+	ctx context.Context,
+	filter domain.AnalyticsFilter,
+	limit, offset int,
+) ([]*domain.TitleStats, int64, error) {
+	switch filter.Sort {
+	case "":
+		filter.Sort = domain.AnalyticsLeastWatched
+	case domain.AnalyticsLeastWatched, domain.AnalyticsMostWatched, domain.AnalyticsLowestCompletion:
+	default:
+		return nil, 0, errors.BadRequest("unknown analytics sort " + string(filter.Sort))
+	}
+	return s.repo.ListTitleStats(ctx, filter, limit, offset)
+}
+
+// GetTitleAnalytics returns the analytics of a title from the viewings
+// started since the given time, of one episode if episodeID is set.
+func (s *AnalyticsService) GetTitleAnalytics(
+	ctx context.Context,
+	mediaID uuid.UUID,
+	episodeID *uuid.UUID,
+	since time.Time,
+) (*domain.TitleAnalytics, error) {
+	media, err := s.repo.GetMedia(ctx, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	viewings, err := s.repo.ListViewings(ctx, mediaID, since)
+	if err != nil {
+		return nil, err
+	}
+	if episodeID != nil {
+		kept := viewings[:0]
+		for _, v := range viewings {
+			if v.EpisodeID != nil && *v.EpisodeID == *episodeID {
+				kept = append(kept, v)
+			}
+		}
+		viewings = kept
+	}
+
+	analytics := domain.NewTitleAnalytics(mediaID, viewings)
+	analytics.Title = media.Title
+	return analytics, nil
+}
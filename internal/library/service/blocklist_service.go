@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/internal/library/repository"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// BlocklistService manages the releases that are never grabbed again.
+// Feeds skip blocklisted releases, interactive searches reject them, and
+// releases whose download fails to import are added automatically.
+type BlocklistService struct {
+	repo   repository.Repository
+	logger interfaces.Logger
+}
+
+// NewBlocklistService creates a new blocklist service.
+func NewBlocklistService(repo repository.Repository, logger interfaces.Logger) *BlocklistService {
+	return &BlocklistService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// ListBlocklist lists a page of blocklisted releases, newest first, and the
+// number of entries in all pages.
+func (s *BlocklistService) ListBlocklist(
+	ctx context.Context,
+	limit, offset int,
+) ([]*domain.BlocklistEntry, int64, error) {
+	return s.repo.ListBlocklist(ctx, limit, offset)
+}
+
+// AddToBlocklist blocklists a release by hand, such as a fake.
+func (s *BlocklistService) AddToBlocklist(ctx context.Context, entry *domain.BlocklistEntry) error {
+	entry.InfoHash = strings.ToLower(entry.InfoHash)
+	if err := entry.Validate(); err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	entry.Source = domain.BlocklistSourceManual
+	entry.CreatedAt = time.Now()
+
+	if err := s.repo.AddBlocklistEntry(ctx, entry); err != nil {
+		return err
+	}
+
+	s.logger.Info("Release blocklisted",
+		interfaces.String("entry_id", entry.ID.String()),
+		interfaces.String("title", entry.Title))
+	return nil
+}
+
+// RemoveFromBlocklist removes a release from the blocklist, so it can be
+// grabbed again.
+func (s *BlocklistService) RemoveFromBlocklist(ctx context.Context, id uuid.UUID) error {
+	return s.repo.DeleteBlocklistEntry(ctx, id)
+}
+
+// matchBlocklist returns the entry blocking each release, or nil for
+// releases that are not blocklisted.
+func matchBlocklist(
+	ctx context.Context,
+	repo repository.BlocklistRepository,
+	releases []domain.ReleaseIdentity,
+) ([]*domain.BlocklistEntry, error) {
+	entries, err := repo.FindBlocklisted(ctx, releases)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]*domain.BlocklistEntry, len(releases))
+	for i, release := range releases {
+		matches[i] = domain.MatchBlocklist(entries, release)
+	}
+	return matches, nil
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/narwhalmedia/narwhal/pkg/cdn"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// CDNService invalidates the stream segments edges cache for media that
+// is deleted, so that they are no longer served.
+type CDNService struct {
+	invalidator cdn.Invalidator
+	eventBus    interfaces.EventBus
+	logger      interfaces.Logger
+}
+
+// NewCDNService creates a new CDN service.
+func NewCDNService(invalidator cdn.Invalidator, eventBus interfaces.EventBus, logger interfaces.Logger) *CDNService {
+	return &CDNService{
+		invalidator: invalidator,
+		eventBus:    eventBus,
+		logger:      logger,
+	}
+}
+
+// Start subscribes the service to deleted media.
+func (s *CDNService) Start() error {
+	invalidate := events.NewConsumer("library.cdn", 1, s.handleMediaDeleted)
+	if err := s.eventBus.Subscribe("media.deleted", invalidate); err != nil {
+		return fmt.Errorf("failed to subscribe to media.deleted: %w", err)
+	}
+	return nil
+}
+
+// handleMediaDeleted invalidates the segments of deleted media. Failed
+// invalidations are retried by the event bus.
+func (s *CDNService) handleMediaDeleted(ctx context.Context, env *events.Envelope) error {
+	mediaID, ok := eventMediaID(env)
+	if !ok {
+		return nil
+	}
+	if err := s.invalidator.InvalidateMedia(ctx, mediaID.String()); err != nil {
+		return err
+	}
+
+	s.logger.Info("Invalidated CDN cache of deleted media", interfaces.String("media_id", mediaID.String()))
+	return nil
+}
@@ -0,0 +1,449 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/internal/library/repository"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+	"github.com/narwhalmedia/narwhal/pkg/tenant"
+)
+
+// TitleSearcher looks up movies and series at the metadata providers.
+type TitleSearcher interface {
+	SearchTitles(
+		ctx context.Context,
+		mediaType models.MediaType,
+		query string,
+		year int,
+		prefs domain.MetadataPreferences,
+	) ([]models.SearchResult, error)
+	TitleDetails(
+		ctx context.Context,
+		providerName, providerID string,
+		mediaType models.MediaType,
+		prefs domain.MetadataPreferences,
+	) (*models.Metadata, error)
+}
+
+// ContentRequestService lets users request movies and series that are not
+// in the libraries, within the quota of their roles or the one an admin
+// set for them. Admins approve or deny requests; requests matching an
+// auto-approval rule are approved right away. An approved request adds its
+// title to a library as monitored missing media, which the wanted searches
+// acquire, and becomes available once the media is.
+type ContentRequestService struct {
+	repo     repository.Repository
+	titles   TitleSearcher
+	policy   domain.RequestPolicy
+	eventBus interfaces.EventBus
+	logger   interfaces.Logger
+}
+
+// NewContentRequestService creates a new content request service.
+func NewContentRequestService(
+	repo repository.Repository,
+	titles TitleSearcher,
+	policy domain.RequestPolicy,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+) *ContentRequestService {
+	return &ContentRequestService{
+		repo:     repo,
+		titles:   titles,
+		policy:   policy,
+		eventBus: eventBus,
+		logger:   logger,
+	}
+}
+
+// Start subscribes the service to media becoming available, which fulfils
+// the requests it was added for.
+func (s *ContentRequestService) Start() error {
+	consumer := events.NewConsumer("library.content_requests", 1, s.handleMediaStatusChanged)
+	if err := s.eventBus.Subscribe("media.status_changed", consumer); err != nil {
+		return fmt.Errorf("failed to subscribe to media.status_changed: %w", err)
+	}
+	return nil
+}
+
+// Search searches the metadata providers for movies or series, with the
+// request of each title, if any.
+func (s *ContentRequestService) Search(
+	ctx context.Context,
+	mediaType models.MediaType,
+	query string,
+	year int,
+) ([]*domain.RequestableTitle, error) {
+	if query == "" {
+		return nil, errors.BadRequest("search query is required")
+	}
+	if mediaType != models.MediaTypeMovie && mediaType != models.MediaTypeSeries {
+		return nil, errors.BadRequest("only movies and series can be requested")
+	}
+
+	results, err := s.titles.SearchTitles(ctx, mediaType, query, year, domain.MetadataPreferences{})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string][]string)
+	for _, result := range results {
+		ids[result.ProviderName] = append(ids[result.ProviderName], result.ProviderID)
+	}
+	requests := make(map[string]map[string]*domain.ContentRequest, len(ids))
+	for provider, providerIDs := range ids {
+		if requests[provider], err = s.repo.GetContentRequestsByProviderIDs(ctx, provider, providerIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	titles := make([]*domain.RequestableTitle, len(results))
+	for i, result := range results {
+		titles[i] = &domain.RequestableTitle{
+			SearchResult: result,
+			Request:      requests[result.ProviderName][result.ProviderID],
+		}
+	}
+	return titles, nil
+}
+
+// Submit requests the title of a request for its user, who holds the
+// given roles: its media type, provider and provider ID, and optionally
+// its seasons and quality. The request must fit in the quota of the user.
+// It is approved right away if an auto-approval rule matches and a
+// library holds its media type.
+func (s *ContentRequestService) Submit(
+	ctx context.Context,
+	roles []string,
+	request *domain.ContentRequest,
+) (*domain.ContentRequest, error) {
+	tenantID, _ := tenant.FromContext(ctx)
+	request.TenantID = tenantID
+	request.Status = domain.ContentRequestPending
+	request.CreatedAt = time.Now()
+	if err := request.Validate(); err != nil {
+		return nil, errors.BadRequest(err.Error())
+	}
+
+	quota, err := s.QuotaState(ctx, request.UserID, roles)
+	if err != nil {
+		return nil, err
+	}
+	if err := quota.Admits(request); err != nil {
+		return nil, errors.Forbidden(err.Error())
+	}
+
+	details, err := s.titles.TitleDetails(ctx, request.Provider, request.ProviderID, request.MediaType,
+		domain.MetadataPreferences{})
+	if err != nil {
+		return nil, errors.BadRequest(fmt.Sprintf("failed to look up title: %v", err))
+	}
+	request.Title = details.Title
+	request.Year = releaseYear(details.ReleaseDate)
+	request.Overview = details.Description
+	request.PosterURL = details.PosterURL
+
+	if err := s.repo.CreateContentRequest(ctx, request); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Content requested",
+		interfaces.String("request_id", request.ID.String()),
+		interfaces.String("title", request.Title),
+		interfaces.String("user_id", request.UserID.String()))
+	s.eventBus.PublishAsync(ctx, domain.NewContentRequestCreatedEvent(*request))
+
+	if s.policy.AutoApproves(roles, request) {
+		if err := s.approve(ctx, request, nil, nil, details); err != nil {
+			// The request waits for an admin instead
+			s.logger.Warn("Failed to approve content request automatically",
+				interfaces.String("request_id", request.ID.String()),
+				interfaces.Error(err))
+		}
+	}
+	return request, nil
+}
+
+// QuotaState returns how much of their quota a user with the given roles
+// used within the current period.
+func (s *ContentRequestService) QuotaState(
+	ctx context.Context,
+	userID uuid.UUID,
+	roles []string,
+) (*domain.RequestQuotaState, error) {
+	quota := s.policy.QuotaFor(roles)
+	override, err := s.repo.GetRequestQuotaOverride(ctx, userID)
+	switch {
+	case err == nil:
+		quota = override.Quota
+	case !errors.IsNotFound(err):
+		return nil, err
+	}
+
+	requests, err := s.repo.ListContentRequestsSince(ctx, userID, time.Now().Add(-s.policy.Period))
+	if err != nil {
+		return nil, err
+	}
+	state := domain.NewRequestQuotaState(quota, s.policy.Period, requests)
+	state.Overridden = override != nil
+	return state, nil
+}
+
+// SetQuotaOverride replaces the role quota of a user with one set by an
+// admin.
+func (s *ContentRequestService) SetQuotaOverride(
+	ctx context.Context,
+	adminID, userID uuid.UUID,
+	quota domain.RequestQuota,
+) (*domain.RequestQuotaOverride, error) {
+	if quota.Movies < 0 || quota.Seasons < 0 {
+		return nil, errors.BadRequest("request quota cannot be negative")
+	}
+	tenantID, _ := tenant.FromContext(ctx)
+	override := &domain.RequestQuotaOverride{
+		TenantID:  tenantID,
+		UserID:    userID,
+		Quota:     quota,
+		SetBy:     adminID,
+		UpdatedAt: time.Now(),
+	}
+	if err := s.repo.SetRequestQuotaOverride(ctx, override); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Request quota overridden",
+		interfaces.String("user_id", userID.String()),
+		interfaces.String("admin_id", adminID.String()),
+		interfaces.Int("movies", quota.Movies),
+		interfaces.Int("seasons", quota.Seasons))
+	return override, nil
+}
+
+// ClearQuotaOverride returns a user to the quota of their roles.
+func (s *ContentRequestService) ClearQuotaOverride(ctx context.Context, adminID, userID uuid.UUID) error {
+	if err := s.repo.DeleteRequestQuotaOverride(ctx, userID); err != nil {
+		return err
+	}
+
+	s.logger.Info("Request quota override cleared",
+		interfaces.String("user_id", userID.String()),
+		interfaces.String("admin_id", adminID.String()))
+	return nil
+}
+
+// List lists a page of the requests of a user, or of every user for
+// admins, of a status if one is set, newest first, and the number of
+// requests in all pages.
+func (s *ContentRequestService) List(
+	ctx context.Context,
+	userID uuid.UUID,
+	admin bool,
+	status domain.ContentRequestStatus,
+	limit, offset int,
+) ([]*domain.ContentRequest, int64, error) {
+	filter := domain.ContentRequestFilter{Status: status}
+	if !admin {
+		filter.UserID = &userID
+	}
+	return s.repo.ListContentRequests(ctx, filter, limit, offset)
+}
+
+// Approve approves a pending request and adds its title to a library: the
+// given one, or the first enabled library of its media type.
+func (s *ContentRequestService) Approve(
+	ctx context.Context,
+	adminID, id uuid.UUID,
+	libraryID *uuid.UUID,
+) (*domain.ContentRequest, error) {
+	request, err := s.pendingRequest(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	details, err := s.titles.TitleDetails(ctx, request.Provider, request.ProviderID, request.MediaType,
+		domain.MetadataPreferences{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up requested title: %w", err)
+	}
+	if err := s.approve(ctx, request, &adminID, libraryID, details); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// Deny denies a pending request, telling the requester why.
+func (s *ContentRequestService) Deny(
+	ctx context.Context,
+	adminID, id uuid.UUID,
+	reason string,
+) (*domain.ContentRequest, error) {
+	request, err := s.pendingRequest(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := request.Deny(adminID, reason, time.Now()); err != nil {
+		return nil, errors.Conflict(err.Error())
+	}
+	if err := s.repo.DecideContentRequest(ctx, request); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Content request denied",
+		interfaces.String("request_id", request.ID.String()),
+		interfaces.String("admin_id", adminID.String()))
+	s.eventBus.PublishAsync(ctx, domain.NewContentRequestUpdatedEvent(*request))
+	return request, nil
+}
+
+// approve adds the title of a request to a library as monitored missing
+// media and records the approval. decidedBy is nil for automatic
+// approvals.
+func (s *ContentRequestService) approve(
+	ctx context.Context,
+	request *domain.ContentRequest,
+	decidedBy, libraryID *uuid.UUID,
+	details *models.Metadata,
+) error {
+	library, err := s.requestLibrary(ctx, request.MediaType, libraryID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	media := &models.Media{
+		ID:          uuid.New(),
+		TenantID:    library.TenantID,
+		LibraryID:   library.ID,
+		Title:       request.Title,
+		Type:        models.MediaType(library.Type),
+		Status:      string(models.MediaStatusMissing),
+		Monitored:   true,
+		Description: details.Description,
+		Genres:      details.Genres,
+		Year:        request.Year,
+		IMDBID:      details.IMDBID,
+		Added:       now,
+	}
+	media.TMDBID, _ = strconv.Atoi(details.TMDBID)
+	media.TVDBID, _ = strconv.Atoi(details.TVDBID)
+	if released, err := time.Parse(time.DateOnly, details.ReleaseDate); err == nil {
+		media.ReleaseDate = released
+	}
+
+	// The request stays pending if the approval fails
+	approved := *request
+	if err := approved.Approve(decidedBy, library.ID, media.ID, now); err != nil {
+		return errors.Conflict(err.Error())
+	}
+	if err := s.repo.CreateMedia(ctx, media); err != nil {
+		return err
+	}
+	if err := s.repo.DecideContentRequest(ctx, &approved); err != nil {
+		// Another admin decided first; the media goes again
+		if delErr := s.repo.DeleteMedia(ctx, media.ID); delErr != nil {
+			s.logger.Error("Failed to remove media of content request",
+				interfaces.String("media_id", media.ID.String()),
+				interfaces.Error(delErr))
+		}
+		return err
+	}
+	*request = approved
+
+	fields := []interfaces.Field{
+		interfaces.String("request_id", request.ID.String()),
+		interfaces.String("media_id", media.ID.String()),
+		interfaces.String("library_id", library.ID.String()),
+	}
+	if decidedBy != nil {
+		fields = append(fields, interfaces.String("admin_id", decidedBy.String()))
+	}
+	s.logger.Info("Content request approved", fields...)
+	s.eventBus.PublishAsync(ctx, domain.NewMediaAddedEvent(media))
+	s.eventBus.PublishAsync(ctx, domain.NewContentRequestUpdatedEvent(*request))
+	return nil
+}
+
+// requestLibrary returns the library approved requests of a media type are
+// added to.
+func (s *ContentRequestService) requestLibrary(
+	ctx context.Context,
+	mediaType models.MediaType,
+	libraryID *uuid.UUID,
+) (*domain.Library, error) {
+	if libraryID != nil {
+		library, err := s.repo.GetLibrary(ctx, *libraryID)
+		if err != nil {
+			return nil, err
+		}
+		if domain.LibraryFor([]*domain.Library{library}, mediaType) == nil {
+			return nil, errors.BadRequest(fmt.Sprintf("library %s does not hold enabled %s media", library.Name, mediaType))
+		}
+		return library, nil
+	}
+
+	enabled := true
+	libraries, err := s.repo.ListLibraries(ctx, &enabled)
+	if err != nil {
+		return nil, err
+	}
+	library := domain.LibraryFor(libraries, mediaType)
+	if library == nil {
+		return nil, errors.BadRequest(fmt.Sprintf("no enabled library holds %s media", mediaType))
+	}
+	return library, nil
+}
+
+func (s *ContentRequestService) pendingRequest(ctx context.Context, id uuid.UUID) (*domain.ContentRequest, error) {
+	request, err := s.repo.GetContentRequest(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if request.Status != domain.ContentRequestPending {
+		return nil, errors.Conflict(fmt.Sprintf("content request is %s already", request.Status))
+	}
+	return request, nil
+}
+
+// handleMediaStatusChanged marks the requests of media that became
+// available available.
+func (s *ContentRequestService) handleMediaStatusChanged(ctx context.Context, env *events.Envelope) error {
+	if to, _ := env.Payload()["to"].(string); to != string(models.MediaStatusAvailable) {
+		return nil
+	}
+	id, _ := env.Payload()["entity_id"].(string)
+	mediaID, err := uuid.Parse(id)
+	if err != nil {
+		return nil
+	}
+
+	requests, err := s.repo.MarkContentRequestsAvailable(ctx, mediaID, time.Now())
+	if err != nil {
+		return err
+	}
+	for _, request := range requests {
+		s.logger.Info("Requested content available",
+			interfaces.String("request_id", request.ID.String()),
+			interfaces.String("media_id", mediaID.String()))
+		s.eventBus.PublishAsync(ctx, domain.NewContentRequestUpdatedEvent(*request))
+	}
+	return nil
+}
+
+// releaseYear returns the year of a release date such as "2024-03-01", or
+// zero.
+func releaseYear(date string) int {
+	if len(date) < 4 {
+		return 0
+	}
+	year, _ := strconv.Atoi(date[:4])
+	return year
+}
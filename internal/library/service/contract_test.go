@@ -0,0 +1,75 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/internal/library/service"
+	"github.com/narwhalmedia/narwhal/pkg/contract"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/logger"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+	"github.com/narwhalmedia/narwhal/pkg/testing/fake"
+)
+
+func loadContracts(t *testing.T, match func(*contract.Contract) bool) []*contract.Contract {
+	t.Helper()
+	dir, err := contract.Dir()
+	require.NoError(t, err)
+	contracts, err := contract.LoadDir(dir)
+	require.NoError(t, err)
+	return contract.Select(contracts, match)
+}
+
+// TestContracts_Consumer replays the events the library consumes from
+// other services through its handlers.
+func TestContracts_Consumer(t *testing.T) {
+	repo := fake.NewLibraryRepository()
+	bus := contract.NewBus()
+	require.NoError(t, service.NewUserDataService(repo, bus, logger.NewNoopLogger()).Start())
+	require.NoError(t, service.NewDigestService(repo, bus, logger.NewNoopLogger()).Start())
+
+	require.NoError(t, contract.ReplayEvents(context.Background(), loadContracts(t, contract.ByConsumer("library")), bus))
+}
+
+// TestContracts_Provider checks the events the library publishes against
+// the expectations of their consumers.
+func TestContracts_Provider(t *testing.T) {
+	repo := fake.NewLibraryRepository()
+	bus := contract.NewBus()
+	require.NoError(t, service.NewUserDataService(repo, bus, logger.NewNoopLogger()).Start())
+	require.NoError(t, service.NewDigestService(repo, bus, logger.NewNoopLogger()).Start())
+	ctx := context.Background()
+
+	userID := uuid.New()
+	require.NoError(t, repo.UpsertWatchState(ctx, &models.WatchHistory{
+		UserID: userID, MediaID: uuid.New(), Position: 90, Completed: true, LastWatched: time.Now(),
+	}))
+	require.NoError(t, bus.Publish(ctx, events.NewEvent("user.data_export_requested",
+		map[string]interface{}{"export_id": uuid.NewString(), "user_id": userID.String()})))
+
+	// An automatically approved request is updated
+	require.NoError(t, repo.CreateLibrary(ctx, &domain.Library{Name: "Movies", Path: t.TempDir(), Type: "movie", Enabled: true}))
+	requests := service.NewContentRequestService(repo, stubTitles{"438631": {Title: "Dune", ReleaseDate: "2021-09-15"}},
+		domain.RequestPolicy{Period: time.Hour, AutoApprove: []domain.AutoApproveRule{{Role: "user"}}},
+		bus, logger.NewNoopLogger())
+	_, err := requests.Submit(ctx, []string{"user"},
+		&domain.ContentRequest{UserID: userID, MediaType: models.MediaTypeMovie, Provider: "tmdb", ProviderID: "438631"})
+	require.NoError(t, err)
+
+	// The digest lists the request
+	now := time.Now()
+	require.NoError(t, bus.Publish(ctx, events.NewEvent("user.digest_requested", map[string]interface{}{
+		"user_id":     userID.String(),
+		"since":       now.Add(-time.Hour).Format(time.RFC3339),
+		"until":       now.Add(time.Minute).Format(time.RFC3339),
+		"library_ids": []string{},
+	})))
+
+	require.NoError(t, contract.VerifyEvents(loadContracts(t, contract.ByProvider("library")), bus.Published()))
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/internal/library/repository"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// DigestService composes the library part of the email digests of users.
+// The user service asks for a digest with a user.digest_requested event,
+// naming the libraries the user can access, and emails the
+// user.digest_composed reply.
+type DigestService struct {
+	repo     repository.Repository
+	eventBus interfaces.EventBus
+	logger   interfaces.Logger
+}
+
+// NewDigestService creates a new digest service.
+func NewDigestService(
+	repo repository.Repository,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+) *DigestService {
+	return &DigestService{
+		repo:     repo,
+		eventBus: eventBus,
+		logger:   logger,
+	}
+}
+
+// Start subscribes the service to digest requests.
+func (s *DigestService) Start() error {
+	compose := events.NewConsumer("library.digest", 1, s.handleDigestRequested)
+	if err := s.eventBus.Subscribe("user.digest_requested", compose); err != nil {
+		return fmt.Errorf("failed to subscribe to user.digest_requested: %w", err)
+	}
+	return nil
+}
+
+// Compose composes the digest of a user for the period [since, until):
+// the titles added to the given libraries, or to every library if
+// libraryIDs is empty, the episodes of watchlisted series airing in the
+// period after until, and the content requests of the user that are
+// pending or changed.
+func (s *DigestService) Compose(
+	ctx context.Context,
+	userID uuid.UUID,
+	since, until time.Time,
+	libraryIDs []uuid.UUID,
+) (*domain.Digest, error) {
+	digest := &domain.Digest{}
+
+	added, err := s.repo.ListMediaAddedSince(ctx, since, libraryIDs, domain.MaxDigestItems)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range added {
+		if m.CreatedAt.After(until) {
+			continue
+		}
+		digest.Added = append(digest.Added, domain.DigestTitle{
+			MediaID: m.ID, Title: m.Title, Year: m.Year, MediaType: m.Type,
+		})
+	}
+
+	upcoming, err := s.upcoming(ctx, userID, until, until.Add(until.Sub(since)), libraryIDs)
+	if err != nil {
+		return nil, err
+	}
+	digest.Upcoming = upcoming
+
+	requests, _, err := s.repo.ListContentRequests(ctx, domain.ContentRequestFilter{UserID: &userID},
+		domain.MaxDigestItems, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range requests {
+		if r.InDigest(since) {
+			digest.Requests = append(digest.Requests, domain.DigestRequest{
+				RequestID: r.ID, Title: r.Title, Year: r.Year, Status: r.Status,
+			})
+		}
+	}
+	return digest, nil
+}
+
+// upcoming lists the episodes of the series on a user's watchlist airing
+// in [start, end).
+func (s *DigestService) upcoming(
+	ctx context.Context,
+	userID uuid.UUID,
+	start, end time.Time,
+	libraryIDs []uuid.UUID,
+) ([]domain.DigestEpisode, error) {
+	watchlist, err := s.repo.ListWatchlist(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(watchlist) == 0 {
+		return nil, nil
+	}
+	followed := make(map[uuid.UUID]bool, len(watchlist))
+	for _, entry := range watchlist {
+		followed[entry.MediaID] = true
+	}
+
+	entries, err := s.repo.ListCalendar(ctx, start, end, nil)
+	if err != nil {
+		return nil, err
+	}
+	var episodes []domain.DigestEpisode
+	for _, e := range entries {
+		if e.Type != domain.CalendarEntryEpisode || !followed[e.MediaID] {
+			continue
+		}
+		if len(libraryIDs) > 0 && !slices.Contains(libraryIDs, e.LibraryID) {
+			continue
+		}
+		episodes = append(episodes, domain.DigestEpisode{
+			MediaID:       e.MediaID,
+			Series:        e.Title,
+			SeasonNumber:  e.SeasonNumber,
+			EpisodeNumber: e.EpisodeNumber,
+			Title:         e.EpisodeTitle,
+			AirDate:       e.Date.Format(time.DateOnly),
+		})
+		if len(episodes) == domain.MaxDigestItems {
+			break
+		}
+	}
+	return episodes, nil
+}
+
+// handleDigestRequested replies with the digest of the user.
+func (s *DigestService) handleDigestRequested(ctx context.Context, env *events.Envelope) error {
+	userID, ok := eventUserID(env)
+	if !ok {
+		return nil
+	}
+	payload := env.Payload()
+	since, err := time.Parse(time.RFC3339, fmt.Sprint(payload["since"]))
+	if err != nil {
+		return nil
+	}
+	until, err := time.Parse(time.RFC3339, fmt.Sprint(payload["until"]))
+	if err != nil {
+		return nil
+	}
+	libraryIDs := payloadUUIDs(payload["library_ids"])
+
+	digest, err := s.Compose(ctx, userID, since, until, libraryIDs)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(digest)
+	if err != nil {
+		return fmt.Errorf("failed to encode digest: %w", err)
+	}
+
+	return s.eventBus.Publish(ctx, events.NewAggregateEvent("user.digest_composed", userID.String(), map[string]interface{}{
+		"user_id": userID.String(),
+		"since":   since.Format(time.RFC3339),
+		"until":   until.Format(time.RFC3339),
+		"digest":  string(data),
+	}))
+}
+
+// payloadUUIDs returns the IDs of a list in an event payload, skipping
+// invalid ones.
+func payloadUUIDs(v interface{}) []uuid.UUID {
+	var values []string
+	switch list := v.(type) {
+	case []string:
+		values = list
+	case []interface{}:
+		for _, item := range list {
+			values = append(values, fmt.Sprint(item))
+		}
+	}
+	ids := make([]uuid.UUID, 0, len(values))
+	for _, value := range values {
+		if id, err := uuid.Parse(value); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
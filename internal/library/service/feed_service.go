@@ -0,0 +1,323 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/internal/library/repository"
+	"github.com/narwhalmedia/narwhal/pkg/downloadclient"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/tenant"
+)
+
+// maxFeedSize bounds the feeds read from indexers.
+const maxFeedSize = 10 << 20
+
+// FeedService manages the RSS feeds of libraries and grabs the releases
+// they list. Matching items are handed to a download client once per
+// release: items carried by several feeds, or relisted, are grabbed once.
+type FeedService struct {
+	repo       repository.Repository
+	clients    *downloadclient.Clients
+	httpClient *http.Client
+	eventBus   interfaces.EventBus
+	logger     interfaces.Logger
+}
+
+// NewFeedService creates a new feed service grabbing into clients.
+func NewFeedService(
+	repo repository.Repository,
+	clients *downloadclient.Clients,
+	httpClient *http.Client,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+) *FeedService {
+	return &FeedService{
+		repo:       repo,
+		clients:    clients,
+		httpClient: httpClient,
+		eventBus:   eventBus,
+		logger:     logger,
+	}
+}
+
+// CreateFeed adds a feed to a library. Enabled feeds are polled from the
+// next poll on.
+func (s *FeedService) CreateFeed(ctx context.Context, feed *domain.Feed) error {
+	if err := s.validate(feed); err != nil {
+		return err
+	}
+	if _, err := s.repo.GetLibrary(ctx, feed.LibraryID); err != nil {
+		return err
+	}
+
+	if err := s.repo.CreateFeed(ctx, feed); err != nil {
+		return err
+	}
+
+	s.logger.Info("Feed created",
+		interfaces.String("feed_id", feed.ID.String()),
+		interfaces.String("library_id", feed.LibraryID.String()))
+	return nil
+}
+
+// GetFeed returns a feed.
+func (s *FeedService) GetFeed(ctx context.Context, id uuid.UUID) (*domain.Feed, error) {
+	return s.repo.GetFeed(ctx, id)
+}
+
+// ListFeeds lists the feeds of a library, or of every library if libraryID
+// is nil.
+func (s *FeedService) ListFeeds(ctx context.Context, libraryID *uuid.UUID) ([]*domain.Feed, error) {
+	return s.repo.ListFeeds(ctx, libraryID)
+}
+
+// UpdateFeed updates the settings of a feed. Its library cannot change.
+func (s *FeedService) UpdateFeed(ctx context.Context, feed *domain.Feed) (*domain.Feed, error) {
+	existing, err := s.repo.GetFeed(ctx, feed.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Clients only see feed URLs redacted, and send them back unchanged
+	if feed.URL == existing.Redacted().URL {
+		feed.URL = existing.URL
+	}
+	feed.LibraryID = existing.LibraryID
+	feed.LastPolledAt = existing.LastPolledAt
+	feed.LastError = existing.LastError
+	feed.CreatedAt = existing.CreatedAt
+	if err := s.validate(feed); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateFeed(ctx, feed); err != nil {
+		return nil, err
+	}
+	return feed, nil
+}
+
+// DeleteFeed deletes a feed. Downloads it started are left alone.
+func (s *FeedService) DeleteFeed(ctx context.Context, id uuid.UUID) error {
+	return s.repo.DeleteFeed(ctx, id)
+}
+
+// PreviewFeed fetches a feed, which need not be saved, and reports what a
+// poll would do with each of its items. Nothing is grabbed.
+func (s *FeedService) PreviewFeed(ctx context.Context, feed *domain.Feed) ([]*domain.FeedPreviewItem, error) {
+	if err := feed.Validate(); err != nil {
+		return nil, errors.BadRequest(err.Error())
+	}
+
+	items, err := s.fetch(ctx, feed.URL)
+	if err != nil {
+		return nil, errors.BadRequest(err.Error())
+	}
+
+	keys := make([]string, len(items))
+	for i, item := range items {
+		keys[i] = item.DedupeKey()
+	}
+	grabbed, err := s.repo.GrabbedFeedItems(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	blocked, err := s.blocklisted(ctx, feed, items)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := make([]*domain.FeedPreviewItem, len(items))
+	for i, item := range items {
+		matched, reason := feed.Match(item)
+		if matched && blocked[i] != nil {
+			matched, reason = false, "blocklisted: "+blocked[i].Reason
+		}
+		preview[i] = &domain.FeedPreviewItem{
+			Item:    item,
+			Quality: domain.ParseFeedQuality(item.Title),
+			Matched: matched,
+			Reason:  reason,
+			Grabbed: grabbed[keys[i]],
+		}
+	}
+	return preview, nil
+}
+
+// Poll polls every enabled feed once. Failures are recorded with their
+// feed and logged.
+func (s *FeedService) Poll(ctx context.Context) {
+	feeds, err := s.repo.ListFeeds(ctx, nil)
+	if err != nil {
+		s.logger.Error("Failed to list feeds", interfaces.Error(err))
+		return
+	}
+
+	for _, feed := range feeds {
+		if !feed.Enabled {
+			continue
+		}
+		grabbed, err := s.PollFeed(tenant.WithTenantID(ctx, feed.TenantID), feed)
+		if err != nil {
+			s.logger.Warn("Failed to poll feed",
+				interfaces.String("feed_id", feed.ID.String()),
+				interfaces.String("name", feed.Name),
+				interfaces.Error(err))
+		}
+		if grabbed > 0 {
+			s.logger.Info("Grabbed feed items",
+				interfaces.String("feed_id", feed.ID.String()),
+				interfaces.Int("count", grabbed))
+		}
+	}
+}
+
+// PollFeed fetches a feed and grabs its matching items that were not
+// grabbed before and are not blocklisted. It returns the number of items grabbed.
+func (s *FeedService) PollFeed(ctx context.Context, feed *domain.Feed) (int, error) {
+	grabbed, err := s.poll(ctx, feed)
+
+	var lastError string
+	if err != nil {
+		lastError = err.Error()
+	}
+	if recordErr := s.repo.SetFeedPolled(ctx, feed.ID, time.Now(), lastError); recordErr != nil {
+		s.logger.Warn("Failed to record feed poll", interfaces.Error(recordErr))
+	}
+	return grabbed, err
+}
+
+func (s *FeedService) poll(ctx context.Context, feed *domain.Feed) (int, error) {
+	items, err := s.fetch(ctx, feed.URL)
+	if err != nil {
+		return 0, err
+	}
+
+	var matched []*domain.FeedItem
+	for _, item := range items {
+		if ok, _ := feed.Match(item); ok {
+			matched = append(matched, item)
+		}
+	}
+	blocked, err := s.blocklisted(ctx, feed, matched)
+	if err != nil {
+		return 0, err
+	}
+
+	grabbed := 0
+	for i, item := range matched {
+		if blocked[i] != nil {
+			continue
+		}
+		ok, err := s.grab(ctx, feed, item)
+		if err != nil {
+			return grabbed, err
+		}
+		if ok {
+			grabbed++
+		}
+	}
+	return grabbed, nil
+}
+
+// grab hands an item to the feed's download client unless its release was
+// grabbed before. Items that fail to be handed over are released, so the
+// next poll tries again.
+func (s *FeedService) grab(ctx context.Context, feed *domain.Feed, item *domain.FeedItem) (bool, error) {
+	grab := &domain.FeedGrab{
+		FeedID:    feed.ID,
+		Key:       item.DedupeKey(),
+		Title:     item.Title,
+		GrabbedAt: time.Now(),
+	}
+	claimed, err := s.repo.ClaimFeedItem(ctx, grab)
+	if err != nil || !claimed {
+		return false, err
+	}
+
+	client, err := s.clients.For(feed.DownloadClient)
+	if err == nil {
+		grab.DownloadID, err = client.Add(ctx, downloadclient.AddRequest{URL: item.DownloadURL})
+	}
+	if err != nil {
+		if releaseErr := s.repo.ReleaseFeedItem(ctx, grab.Key); releaseErr != nil {
+			s.logger.Warn("Failed to release feed item", interfaces.Error(releaseErr))
+		}
+		return false, fmt.Errorf("failed to grab %s: %w", item.Title, err)
+	}
+
+	grab.DownloadClient = client.Name()
+	if err := s.repo.UpdateFeedGrab(ctx, grab); err != nil {
+		s.logger.Warn("Failed to record feed grab", interfaces.Error(err))
+	}
+
+	s.eventBus.PublishAsync(ctx, domain.NewFeedItemGrabbedEvent(feed, item, grab))
+	return true, nil
+}
+
+// blocklisted returns the blocklist entry blocking each item of a feed, or
+// nil for items that are not blocklisted. Feed names stand in for indexers.
+func (s *FeedService) blocklisted(
+	ctx context.Context,
+	feed *domain.Feed,
+	items []*domain.FeedItem,
+) ([]*domain.BlocklistEntry, error) {
+	releases := make([]domain.ReleaseIdentity, len(items))
+	for i, item := range items {
+		releases[i] = item.Identity(feed.Name)
+	}
+	return matchBlocklist(ctx, s.repo, releases)
+}
+
+// fetch reads the items of a feed.
+func (s *FeedService) fetch(ctx context.Context, url string) ([]*domain.FeedItem, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch feed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch feed: status %d", resp.StatusCode)
+	}
+	return domain.ParseFeed(io.LimitReader(resp.Body, maxFeedSize))
+}
+
+// validate checks a feed and the download client it names.
+func (s *FeedService) validate(feed *domain.Feed) error {
+	if err := feed.Validate(); err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	if feed.DownloadClient != "" {
+		if _, err := s.clients.For(feed.DownloadClient); err != nil {
+			return errors.BadRequest(err.Error())
+		}
+	}
+	return nil
+}
+
+// Run polls the feeds every interval until ctx is done.
+func (s *FeedService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Poll(ctx)
+		}
+	}
+}
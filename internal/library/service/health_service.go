@@ -0,0 +1,284 @@
+package service
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/downloadclient"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// ErrComponentDisabled is returned for calls to indexers and download
+// clients that are disabled for failing.
+var ErrComponentDisabled = stderrors.New("component is disabled after repeated failures")
+
+// HealthService tracks how often indexers and download clients fail and
+// how fast they answer. Components failing too often in a row are
+// disabled and re-tested with exponential backoff; critical ones publish an
+// alert when they go down. Components are tracked by wrapping them, so
+// callers use them as before.
+type HealthService struct {
+	policy   domain.HealthPolicy
+	critical map[string]bool
+	eventBus interfaces.EventBus
+	logger   interfaces.Logger
+	now      func() time.Time
+
+	mu         sync.Mutex
+	components map[string]*domain.ComponentHealth // kind + name
+	clients    []downloadclient.Client
+}
+
+// NewHealthService creates a new health service. critical names the
+// indexers and download clients that alert when they go down.
+func NewHealthService(
+	policy domain.HealthPolicy,
+	critical []string,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+) *HealthService {
+	s := &HealthService{
+		policy:     policy,
+		critical:   make(map[string]bool, len(critical)),
+		eventBus:   eventBus,
+		logger:     logger,
+		now:        time.Now,
+		components: make(map[string]*domain.ComponentHealth),
+	}
+	for _, name := range critical {
+		s.critical[name] = true
+	}
+	return s
+}
+
+// Status returns the health of every component seen so far, by kind and
+// name.
+func (s *HealthService) Status() []*domain.ComponentHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := make([]*domain.ComponentHealth, 0, len(s.components))
+	for _, health := range s.components {
+		h := *health
+		status = append(status, &h)
+	}
+	sort.Slice(status, func(i, j int) bool {
+		if status[i].Kind != status[j].Kind {
+			return status[i].Kind < status[j].Kind
+		}
+		return status[i].Name < status[j].Name
+	})
+	return status
+}
+
+// Indexers returns the indexers calls are let through to, tracked. Disabled
+// indexers are left out until their re-test is due.
+func (s *HealthService) Indexers(indexers []domain.Indexer) []domain.Indexer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	tracked := make([]domain.Indexer, 0, len(indexers))
+	for _, indexer := range indexers {
+		if s.component(domain.ComponentIndexer, indexer.Name()).Available(now) {
+			tracked = append(tracked, &healthCheckedIndexer{Indexer: indexer, health: s})
+		}
+	}
+	return tracked
+}
+
+// Clients returns the download clients tracked. Calls to disabled clients
+// fail with ErrComponentDisabled until their re-test is due; Run re-tests
+// them without waiting for a call.
+func (s *HealthService) Clients(clients []downloadclient.Client) []downloadclient.Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tracked := make([]downloadclient.Client, len(clients))
+	for i, client := range clients {
+		s.component(domain.ComponentDownloadClient, client.Name())
+		tracked[i] = &healthCheckedClient{Client: client, health: s}
+	}
+	s.clients = append(s.clients, tracked...)
+	return tracked
+}
+
+// Retest lists the downloads of every disabled download client whose
+// re-test is due.
+func (s *HealthService) Retest(ctx context.Context) {
+	s.mu.Lock()
+	now := s.now()
+	var due []downloadclient.Client
+	for _, client := range s.clients {
+		health := s.component(domain.ComponentDownloadClient, client.Name())
+		if health.Disabled() && health.Available(now) {
+			due = append(due, client)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, client := range due {
+		if _, err := client.List(ctx, ""); err != nil {
+			s.logger.Debug("Download client re-test failed",
+				interfaces.String("client", client.Name()),
+				interfaces.Error(err))
+		}
+	}
+}
+
+// Run re-tests disabled download clients every interval until ctx is done.
+func (s *HealthService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Retest(ctx)
+		}
+	}
+}
+
+// call runs a call to a component if it is available and records how it
+// went.
+func (s *HealthService) call(ctx context.Context, kind domain.ComponentKind, name string, fn func() error) error {
+	s.mu.Lock()
+	allowed := s.component(kind, name).Allow(s.now())
+	s.mu.Unlock()
+	if !allowed {
+		return fmt.Errorf("%s %s: %w", kind, name, ErrComponentDisabled)
+	}
+
+	start := s.now()
+	err := fn()
+	s.record(ctx, kind, name, s.now().Sub(start), err)
+	return err
+}
+
+// record records the outcome of a call. Downloads a client does not know
+// and calls the caller gave up on say nothing about the component.
+func (s *HealthService) record(ctx context.Context, kind domain.ComponentKind, name string, elapsed time.Duration, err error) {
+	if stderrors.Is(err, downloadclient.ErrNotFound) ||
+		stderrors.Is(err, context.Canceled) ||
+		(stderrors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil) {
+		err = nil
+	}
+
+	s.mu.Lock()
+	health := s.component(kind, name)
+	var disabled, enabled bool
+	if err != nil {
+		disabled = health.RecordFailure(err, elapsed, s.now(), s.policy)
+	} else {
+		enabled = health.RecordSuccess(elapsed, s.now())
+	}
+	snapshot := *health
+	s.mu.Unlock()
+
+	switch {
+	case disabled:
+		log := s.logger.Warn
+		if snapshot.Critical {
+			log = s.logger.Error
+		}
+		log("Component disabled after repeated failures",
+			interfaces.String("kind", string(kind)),
+			interfaces.String("name", name),
+			interfaces.Int("failures", snapshot.ConsecutiveFailures),
+			interfaces.String("retest_in", snapshot.RetestInterval.String()),
+			interfaces.Error(err))
+		s.eventBus.PublishAsync(ctx, domain.NewComponentDisabledEvent(snapshot))
+	case enabled:
+		s.logger.Info("Component enabled after passing its re-test",
+			interfaces.String("kind", string(kind)),
+			interfaces.String("name", name))
+		s.eventBus.PublishAsync(ctx, domain.NewComponentEnabledEvent(snapshot))
+	}
+}
+
+// component returns the health of a component, starting to track it if it
+// is new. The caller holds mu.
+func (s *HealthService) component(kind domain.ComponentKind, name string) *domain.ComponentHealth {
+	key := string(kind) + "/" + name
+	health, ok := s.components[key]
+	if !ok {
+		health = &domain.ComponentHealth{Kind: kind, Name: name, Critical: s.critical[name]}
+		s.components[key] = health
+	}
+	return health
+}
+
+// healthCheckedIndexer records the searches of an indexer.
+type healthCheckedIndexer struct {
+	domain.Indexer
+	health *HealthService
+}
+
+func (i *healthCheckedIndexer) Search(ctx context.Context, query domain.ReleaseQuery) ([]*domain.Release, error) {
+	var releases []*domain.Release
+	err := i.health.call(ctx, domain.ComponentIndexer, i.Name(), func() error {
+		var err error
+		releases, err = i.Indexer.Search(ctx, query)
+		return err
+	})
+	return releases, err
+}
+
+// healthCheckedClient records the calls to a download client.
+type healthCheckedClient struct {
+	downloadclient.Client
+	health *HealthService
+}
+
+func (c *healthCheckedClient) Add(ctx context.Context, req downloadclient.AddRequest) (string, error) {
+	var id string
+	err := c.call(ctx, func() error {
+		var err error
+		id, err = c.Client.Add(ctx, req)
+		return err
+	})
+	return id, err
+}
+
+func (c *healthCheckedClient) Get(ctx context.Context, id string) (*downloadclient.Status, error) {
+	var status *downloadclient.Status
+	err := c.call(ctx, func() error {
+		var err error
+		status, err = c.Client.Get(ctx, id)
+		return err
+	})
+	return status, err
+}
+
+func (c *healthCheckedClient) List(ctx context.Context, category string) ([]*downloadclient.Status, error) {
+	var statuses []*downloadclient.Status
+	err := c.call(ctx, func() error {
+		var err error
+		statuses, err = c.Client.List(ctx, category)
+		return err
+	})
+	return statuses, err
+}
+
+func (c *healthCheckedClient) SetCategory(ctx context.Context, id, category string) error {
+	return c.call(ctx, func() error {
+		return c.Client.SetCategory(ctx, id, category)
+	})
+}
+
+func (c *healthCheckedClient) Remove(ctx context.Context, id string, deleteFiles bool) error {
+	return c.call(ctx, func() error {
+		return c.Client.Remove(ctx, id, deleteFiles)
+	})
+}
+
+func (c *healthCheckedClient) call(ctx context.Context, fn func() error) error {
+	return c.health.call(ctx, domain.ComponentDownloadClient, c.Name(), fn)
+}
@@ -0,0 +1,382 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/internal/library/repository"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+const (
+	// defaultHookTimeout bounds hooks configured without a timeout.
+	defaultHookTimeout = 5 * time.Minute
+	// hookKillGrace is how long the output of a killed script is waited for,
+	// in case a process it started still holds its pipes open.
+	hookKillGrace = 5 * time.Second
+	// hookShell applies the resource limits of a hook before running it.
+	hookShell = "/bin/sh"
+)
+
+// HookService runs user scripts on library events: when media is imported,
+// when a transcode completes, when media is deleted and when a critical
+// indexer or download client goes down. Each script gets the
+// event as JSON on stdin and runs in its own process group with a timeout
+// and resource limits. Its output is captured and kept with the run.
+type HookService struct {
+	repo     repository.Repository
+	eventBus interfaces.EventBus
+	logger   interfaces.Logger
+
+	runRetention time.Duration
+
+	mu    sync.RWMutex
+	hooks []*domain.Hook
+}
+
+// NewHookService creates a new hook service running the configured hooks.
+func NewHookService(
+	repo repository.Repository,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+	hooks []*domain.Hook,
+) *HookService {
+	return &HookService{
+		repo:     repo,
+		eventBus: eventBus,
+		logger:   logger,
+		hooks:    hooks,
+	}
+}
+
+// WithRunRetention sets how long hook runs are kept. Zero keeps them
+// forever.
+func (s *HookService) WithRunRetention(retention time.Duration) *HookService {
+	s.runRetention = retention
+	return s
+}
+
+// Start applies the enabled state hooks were given through the API and
+// subscribes the service to the events hooks run on.
+func (s *HookService) Start(ctx context.Context) error {
+	states, err := s.repo.ListHookStates(ctx)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	for _, hook := range s.hooks {
+		if enabled, ok := states[hook.Name]; ok {
+			hook.Enabled = enabled
+		}
+	}
+	s.mu.Unlock()
+
+	for eventType, handle := range map[string]func(context.Context, *events.Envelope) error{
+		"media.added":                  s.handleMediaAdded,
+		"transcode_job.status_changed": s.handleTranscodeJobStatusChanged,
+		"media.deleted":                s.handleMediaDeleted,
+		"component.disabled":           s.handleComponentDisabled,
+		"download.quarantined":         s.handleDownloadQuarantined,
+	} {
+		consumer := events.NewConsumer("library.hooks", 1, handle)
+		if err := s.eventBus.Subscribe(eventType, consumer); err != nil {
+			return fmt.Errorf("failed to subscribe to %s: %w", eventType, err)
+		}
+	}
+	return nil
+}
+
+// Hooks lists the configured hooks.
+func (s *HookService) Hooks() []*domain.Hook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hooks := make([]*domain.Hook, len(s.hooks))
+	for i, hook := range s.hooks {
+		h := *hook
+		hooks[i] = &h
+	}
+	return hooks
+}
+
+// SetEnabled enables or disables a hook. The state is kept across restarts.
+func (s *HookService) SetEnabled(ctx context.Context, name string, enabled bool) (*domain.Hook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, hook := range s.hooks {
+		if hook.Name != name {
+			continue
+		}
+		if err := s.repo.SetHookEnabled(ctx, name, enabled); err != nil {
+			return nil, err
+		}
+		hook.Enabled = enabled
+
+		s.logger.Info("Hook state changed",
+			interfaces.String("hook", name),
+			interfaces.Bool("enabled", enabled))
+		h := *hook
+		return &h, nil
+	}
+	return nil, errors.NotFound(fmt.Sprintf("hook %s not found", name))
+}
+
+// Runs lists the most recent runs of a hook, or of every hook if name is
+// empty.
+func (s *HookService) Runs(ctx context.Context, name string, limit int) ([]*domain.HookRun, error) {
+	if name != "" && !s.exists(name) {
+		return nil, errors.NotFound(fmt.Sprintf("hook %s not found", name))
+	}
+	return s.repo.ListHookRuns(ctx, name, limit)
+}
+
+func (s *HookService) exists(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, hook := range s.hooks {
+		if hook.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// enabledHooks returns the enabled hooks of a hook point.
+func (s *HookService) enabledHooks(point domain.HookPoint) []*domain.Hook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var hooks []*domain.Hook
+	for _, hook := range s.hooks {
+		if hook.Point == point && hook.Enabled {
+			h := *hook
+			hooks = append(hooks, &h)
+		}
+	}
+	return hooks
+}
+
+func (s *HookService) handleMediaAdded(ctx context.Context, env *events.Envelope) error {
+	id, _ := env.Payload()["media_id"].(string)
+	s.runHooks(ctx, domain.HookPointImport, env, id)
+	return nil
+}
+
+// handleTranscodeJobStatusChanged runs the transcode hooks for jobs that
+// completed.
+func (s *HookService) handleTranscodeJobStatusChanged(ctx context.Context, env *events.Envelope) error {
+	if to, _ := env.Payload()["to"].(string); to != string(models.TranscodeJobStatusCompleted) {
+		return nil
+	}
+	id, _ := env.Payload()["entity_id"].(string)
+	s.runHooks(ctx, domain.HookPointTranscodeComplete, env, id)
+	return nil
+}
+
+func (s *HookService) handleMediaDeleted(ctx context.Context, env *events.Envelope) error {
+	id, _ := env.Payload()["media_id"].(string)
+	s.runHooks(ctx, domain.HookPointDelete, env, id)
+	return nil
+}
+
+// handleComponentDisabled runs the component down hooks for critical
+// components.
+func (s *HookService) handleComponentDisabled(ctx context.Context, env *events.Envelope) error {
+	if critical, _ := env.Payload()["critical"].(bool); !critical {
+		return nil
+	}
+	s.runHooks(ctx, domain.HookPointComponentDown, env, env.AggregateID())
+	return nil
+}
+
+func (s *HookService) handleDownloadQuarantined(ctx context.Context, env *events.Envelope) error {
+	s.runHooks(ctx, domain.HookPointMalwareDetected, env, env.AggregateID())
+	return nil
+}
+
+// hookPayload is the JSON document a hook script gets on stdin.
+type hookPayload struct {
+	Hook      string                 `json:"hook"`
+	Point     domain.HookPoint       `json:"point"`
+	Event     string                 `json:"event"`
+	EventID   string                 `json:"event_id"`
+	Timestamp time.Time              `json:"timestamp"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// runHooks runs the enabled hooks of a point one after another and records
+// their runs. A failing script does not fail the event; its run records the
+// failure.
+func (s *HookService) runHooks(ctx context.Context, point domain.HookPoint, env *events.Envelope, entityID string) {
+	for _, hook := range s.enabledHooks(point) {
+		payload, err := json.Marshal(hookPayload{
+			Hook:      hook.Name,
+			Point:     point,
+			Event:     env.EventType(),
+			EventID:   env.ID,
+			Timestamp: env.OccurredAt.UTC(),
+			Data:      env.Payload(),
+		})
+		if err != nil {
+			s.logger.Error("Failed to encode hook payload",
+				interfaces.String("hook", hook.Name),
+				interfaces.Error(err))
+			continue
+		}
+
+		run := s.execute(ctx, hook, payload)
+		run.EventType = env.EventType()
+		run.EntityID = entityID
+		s.record(ctx, run)
+	}
+}
+
+// execute runs the script of a hook with payload on stdin. The script runs
+// in its own process group, which is killed as a whole on timeout.
+func (s *HookService) execute(ctx context.Context, hook *domain.Hook, payload []byte) *domain.HookRun {
+	run := &domain.HookRun{
+		ID:        uuid.New(),
+		Hook:      hook.Name,
+		Point:     hook.Point,
+		StartedAt: time.Now(),
+	}
+
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// The shell sets the limits and replaces itself with the script, so the
+	// limits apply to the script and everything it starts
+	args := append([]string{"-c", hookLimits(hook) + `exec "$@"`, hook.Name, hook.Command}, hook.Args...)
+	cmd := exec.CommandContext(ctx, hookShell, args...)
+	cmd.Stdin = bytes.NewReader(payload)
+	output := &cappedBuffer{max: domain.MaxHookOutput}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.Env = []string{
+		"PATH=" + os.Getenv("PATH"),
+		"NARWHAL_HOOK=" + hook.Name,
+		"NARWHAL_HOOK_POINT=" + string(hook.Point),
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = hookKillGrace
+
+	err := cmd.Run()
+	run.Duration = time.Since(run.StartedAt)
+	run.Output = output.String()
+
+	var exitErr *exec.ExitError
+	switch {
+	case stderrors.Is(ctx.Err(), context.DeadlineExceeded):
+		run.TimedOut = true
+		run.ExitCode = -1
+		run.Error = fmt.Sprintf("timed out after %s", timeout)
+	case stderrors.As(err, &exitErr):
+		run.ExitCode = exitErr.ExitCode()
+	case err != nil:
+		run.ExitCode = -1
+		run.Error = err.Error()
+	}
+	return run
+}
+
+// record stores a hook run and drops runs past the retention.
+func (s *HookService) record(ctx context.Context, run *domain.HookRun) {
+	if run.Succeeded() {
+		s.logger.Info("Hook ran",
+			interfaces.String("hook", run.Hook),
+			interfaces.String("entity_id", run.EntityID),
+			interfaces.String("duration", run.Duration.String()))
+	} else {
+		s.logger.Warn("Hook failed",
+			interfaces.String("hook", run.Hook),
+			interfaces.String("entity_id", run.EntityID),
+			interfaces.Int("exit_code", run.ExitCode),
+			interfaces.String("error", run.Error))
+	}
+
+	if err := s.repo.CreateHookRun(ctx, run); err != nil {
+		s.logger.Error("Failed to record hook run",
+			interfaces.String("hook", run.Hook),
+			interfaces.Error(err))
+		return
+	}
+
+	if s.runRetention > 0 {
+		if _, err := s.repo.DeleteHookRunsBefore(ctx, time.Now().Add(-s.runRetention)); err != nil {
+			s.logger.Warn("Failed to delete old hook runs", interfaces.Error(err))
+		}
+	}
+}
+
+// hookLimits returns the shell commands that set the resource limits of a
+// hook.
+func hookLimits(hook *domain.Hook) string {
+	var limits strings.Builder
+	if hook.MaxCPU > 0 {
+		seconds := int64((hook.MaxCPU + time.Second - 1) / time.Second)
+		limits.WriteString("ulimit -t " + strconv.FormatInt(seconds, 10) + " || exit 126; ")
+	}
+	if hook.MaxMemory > 0 {
+		kib := (hook.MaxMemory + 1023) / 1024
+		limits.WriteString("ulimit -v " + strconv.FormatInt(kib, 10) + " || exit 126; ")
+	}
+	return limits.String()
+}
+
+// cappedBuffer keeps the first max bytes written to it and discards the
+// rest, so a chatty script cannot fill the run log.
+type cappedBuffer struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if room := b.max - b.buf.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *cappedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.truncated {
+		return b.buf.String() + "\n[output truncated]"
+	}
+	return b.buf.String()
+}
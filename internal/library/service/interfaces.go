@@ -2,11 +2,14 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/narwhalmedia/narwhal/internal/library/domain"
 	"github.com/narwhalmedia/narwhal/pkg/models"
+	"github.com/narwhalmedia/narwhal/pkg/saga"
+	"github.com/narwhalmedia/narwhal/pkg/task"
 )
 
 // LibraryServiceInterface defines the interface for library service operations.
@@ -17,10 +20,33 @@ type LibraryServiceInterface interface {
 	ListLibraries(ctx context.Context, enabled *bool) ([]*domain.Library, error)
 	UpdateLibrary(ctx context.Context, id uuid.UUID, updates map[string]interface{}) (*domain.Library, error)
 	DeleteLibrary(ctx context.Context, id uuid.UUID) error
-	ScanLibrary(ctx context.Context, id uuid.UUID) error
+	ScanLibrary(ctx context.Context, id uuid.UUID, full bool) (*task.Task, error)
+	PreviewScan(
+		ctx context.Context,
+		id uuid.UUID,
+		emit func(*domain.ScanChange) error,
+	) (*domain.ScanPreview, error)
+	ExportLibrary(ctx context.Context, id uuid.UUID) (*domain.LibraryExport, error)
+	ImportLibrary(
+		ctx context.Context,
+		id uuid.UUID,
+		data *domain.LibraryExport,
+		strategy domain.ConflictStrategy,
+	) (*domain.ImportResult, error)
+	RelocateLibrary(ctx context.Context, id uuid.UUID, from, to string, dryRun bool) (*domain.Relocation, error)
 
 	// Media operations
 	GetMedia(ctx context.Context, id uuid.UUID) (*models.Media, error)
+	ListExtras(ctx context.Context, mediaID uuid.UUID) ([]*models.Media, error)
+	ListEpisodes(ctx context.Context, mediaID uuid.UUID) ([]*models.Episode, error)
+	ListEpisodeFiles(ctx context.Context, mediaID uuid.UUID) ([]*models.EpisodeFile, error)
+	GetArtist(ctx context.Context, name string) (*domain.Artist, error)
+	RecordWatchProgress(
+		ctx context.Context,
+		userID, mediaID uuid.UUID,
+		episodeID *uuid.UUID,
+		position int,
+	) ([]*models.WatchHistory, error)
 	SearchMedia(
 		ctx context.Context,
 		query string,
@@ -31,6 +57,15 @@ type LibraryServiceInterface interface {
 	) ([]*models.Media, error)
 	UpdateMedia(ctx context.Context, id uuid.UUID, updates map[string]interface{}) (*models.Media, error)
 	DeleteMedia(ctx context.Context, id uuid.UUID) error
+	MoveFile(ctx context.Context, id uuid.UUID, newPath string) (*models.Media, error)
+	PreviewRename(ctx context.Context, mediaIDs []uuid.UUID) (*domain.Rename, error)
+	ApplyRename(ctx context.Context, mediaIDs []uuid.UUID) (*task.Task, error)
+	CompareFile(ctx context.Context, mediaID uuid.UUID, source string) (*domain.FileComparison, error)
+	ReplaceFile(
+		ctx context.Context,
+		mediaID uuid.UUID,
+		source, downloadClient string,
+	) (*models.Media, *domain.FileComparison, error)
 	ListMediaByLibrary(
 		ctx context.Context,
 		libraryID uuid.UUID,
@@ -38,8 +73,34 @@ type LibraryServiceInterface interface {
 		limit, offset int,
 	) ([]*models.Media, error)
 
+	// Calendar operations
+	GetCalendar(ctx context.Context, start, end time.Time, libraryID *uuid.UUID) ([]*domain.CalendarEntry, error)
+	GetCalendarFeedKey(ctx context.Context, userID uuid.UUID) (string, error)
+	RotateCalendarFeedKey(ctx context.Context, userID uuid.UUID) (string, error)
+
 	// Scan operations
 	GetLatestScan(ctx context.Context, libraryID uuid.UUID) (*domain.ScanResult, error)
+
+	// Worker pool operations
+	WorkerPools() []*domain.WorkerPool
+	ResizeWorkerPool(ctx context.Context, name string, size int) (*domain.WorkerPool, error)
+
+	// Workflow operations
+	GetWorkflow(ctx context.Context, mediaID uuid.UUID) (*saga.Workflow, error)
+	ListWorkflowHistory(
+		ctx context.Context,
+		filter domain.WorkflowHistoryFilter,
+		limit, offset int,
+	) ([]*saga.Workflow, error)
+
+	// Manual import operations
+	ListManualImports(
+		ctx context.Context,
+		status *domain.ManualImportStatus,
+		limit, offset int,
+	) ([]*domain.ManualImport, int64, error)
+	ResolveManualImport(ctx context.Context, id uuid.UUID, mediaID *uuid.UUID) (*domain.ManualImport, error)
+	RejectManualImport(ctx context.Context, id uuid.UUID) (*domain.ManualImport, error)
 }
 
 // Ensure LibraryService implements the interface.
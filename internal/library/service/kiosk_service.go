@@ -0,0 +1,325 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/internal/library/repository"
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+	"github.com/narwhalmedia/narwhal/pkg/tenant"
+)
+
+// kioskEvents are the events that change what displays show right away.
+// What is playing changes with every progress report, so it is recomputed
+// on the refresh interval instead.
+var kioskEvents = []string{"media.added", "media.deleted"}
+
+// KioskTokenIssuer issues the tokens kiosk and display clients read the
+// display with.
+type KioskTokenIssuer interface {
+	GenerateKioskToken(tenantID uuid.UUID, grant auth.KioskGrant, ttl time.Duration) (string, time.Time, error)
+}
+
+// KioskService manages the kiosks admins set up for lobby displays and
+// dashboards, and computes what they show: the titles playing and the
+// titles added last, of the libraries of the kiosk. Kiosks redeem their
+// key for short-lived tokens that only read the display, and watch it for
+// changes instead of polling.
+type KioskService struct {
+	repo     repository.Repository
+	issuer   KioskTokenIssuer
+	tokenTTL time.Duration
+	refresh  time.Duration
+	eventBus interfaces.EventBus
+	logger   interfaces.Logger
+}
+
+// NewKioskService creates a new kiosk service. Tokens are valid for
+// tokenTTL, and watched displays are recomputed every refresh.
+func NewKioskService(
+	repo repository.Repository,
+	issuer KioskTokenIssuer,
+	tokenTTL, refresh time.Duration,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+) *KioskService {
+	return &KioskService{
+		repo:     repo,
+		issuer:   issuer,
+		tokenTTL: tokenTTL,
+		refresh:  refresh,
+		eventBus: eventBus,
+		logger:   logger,
+	}
+}
+
+// Create creates a kiosk showing the given libraries, or every library.
+// It returns the kiosk and its key, which is not stored and cannot be
+// retrieved later.
+func (s *KioskService) Create(
+	ctx context.Context,
+	userID uuid.UUID,
+	name string,
+	libraryIDs []uuid.UUID,
+) (*domain.Kiosk, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", errors.BadRequest("kiosk name is required")
+	}
+	for _, id := range libraryIDs {
+		if _, err := s.repo.GetLibrary(ctx, id); err != nil {
+			return nil, "", err
+		}
+	}
+
+	key, err := newShareToken()
+	if err != nil {
+		return nil, "", err
+	}
+	tenantID, _ := tenant.FromContext(ctx)
+	kiosk := &domain.Kiosk{
+		TenantID:   tenantID,
+		Name:       name,
+		LibraryIDs: libraryIDs,
+		KeyHash:    domain.HashKioskKey(key),
+		CreatedBy:  userID,
+		CreatedAt:  time.Now(),
+	}
+	if err := s.repo.CreateKiosk(ctx, kiosk); err != nil {
+		return nil, "", err
+	}
+
+	s.logger.Info("Kiosk created",
+		interfaces.String("kiosk_id", kiosk.ID.String()),
+		interfaces.String("name", name),
+		interfaces.String("user_id", userID.String()))
+	return kiosk, key, nil
+}
+
+// List lists the kiosks, newest first.
+func (s *KioskService) List(ctx context.Context) ([]*domain.Kiosk, error) {
+	return s.repo.ListKiosks(ctx)
+}
+
+// Revoke revokes a kiosk so its key can no longer be redeemed and its
+// tokens no longer read the display.
+func (s *KioskService) Revoke(ctx context.Context, userID, id uuid.UUID) (*domain.Kiosk, error) {
+	kiosk, err := s.repo.GetKiosk(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if kiosk.RevokedAt == nil {
+		now := time.Now()
+		if err := s.repo.RevokeKiosk(ctx, id, now); err != nil {
+			return nil, err
+		}
+		kiosk.RevokedAt = &now
+
+		s.logger.Info("Kiosk revoked",
+			interfaces.String("kiosk_id", id.String()),
+			interfaces.String("user_id", userID.String()))
+	}
+	return kiosk, nil
+}
+
+// Redeem exchanges the key of a kiosk for a token that reads its display,
+// and returns when the token expires. The kiosk's tenant is taken from the
+// kiosk, since kiosks have none.
+func (s *KioskService) Redeem(ctx context.Context, key string) (string, time.Time, error) {
+	if key == "" {
+		return "", time.Time{}, errors.BadRequest("kiosk key is required")
+	}
+	kiosk, err := s.repo.GetKioskByKeyHash(ctx, domain.HashKioskKey(key))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if kiosk.RevokedAt != nil {
+		return "", time.Time{}, errors.Forbidden("kiosk is revoked")
+	}
+
+	grant := auth.KioskGrant{KioskID: kiosk.ID.String()}
+	for _, id := range kiosk.LibraryIDs {
+		grant.LibraryIDs = append(grant.LibraryIDs, id.String())
+	}
+	token, expiresAt, err := s.issuer.GenerateKioskToken(kiosk.TenantID, grant, s.tokenTTL)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	s.logger.Info("Kiosk key redeemed", interfaces.String("kiosk_id", kiosk.ID.String()))
+	return token, expiresAt, nil
+}
+
+// Authorize returns the kiosk a kiosk token was issued to, unless it was
+// revoked since.
+func (s *KioskService) Authorize(ctx context.Context, claims *auth.CustomClaims) (*domain.Kiosk, error) {
+	if claims == nil || !claims.IsKiosk() {
+		return nil, errors.Forbidden("only kiosk tokens read the display")
+	}
+	id, err := uuid.Parse(claims.Kiosk.KioskID)
+	if err != nil {
+		return nil, errors.Forbidden("invalid kiosk token")
+	}
+	kiosk, err := s.repo.GetKiosk(tenant.WithTenantID(ctx, claims.TenantUUID()), id)
+	if err != nil {
+		return nil, err
+	}
+	if kiosk.RevokedAt != nil {
+		return nil, errors.Forbidden("kiosk is revoked")
+	}
+	return kiosk, nil
+}
+
+// Display returns what a kiosk shows: the titles of its libraries played
+// within domain.NowPlayingWindow and the titles added to them last.
+func (s *KioskService) Display(ctx context.Context, kiosk *domain.Kiosk) (*domain.DisplaySnapshot, error) {
+	ctx = tenant.WithTenantID(ctx, kiosk.TenantID)
+	snapshot := &domain.DisplaySnapshot{
+		NowPlaying:    []domain.DisplayItem{},
+		RecentlyAdded: []domain.DisplayItem{},
+	}
+
+	// Several users may watch the same title, and titles of other
+	// libraries are left out, so more states are read than shown.
+	states, err := s.repo.ListWatchStatesSince(ctx, time.Now().Add(-domain.NowPlayingWindow), 4*domain.MaxDisplayItems)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[uuid.UUID]bool, len(states))
+	for _, state := range states {
+		if len(snapshot.NowPlaying) == domain.MaxDisplayItems {
+			break
+		}
+		if seen[state.MediaID] {
+			continue
+		}
+		seen[state.MediaID] = true
+
+		media, err := s.repo.GetMedia(ctx, state.MediaID)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		if !kiosk.Shows(media.LibraryID) {
+			continue
+		}
+		item := displayItem(media, state.LastWatched)
+		if state.Duration > 0 {
+			item.Progress = min(float64(state.Position)/float64(state.Duration), 1)
+		}
+		snapshot.NowPlaying = append(snapshot.NowPlaying, item)
+	}
+
+	added, err := s.repo.ListMediaAddedSince(ctx, time.Time{}, kiosk.LibraryIDs, domain.MaxDisplayItems)
+	if err != nil {
+		return nil, err
+	}
+	for _, media := range added {
+		snapshot.RecentlyAdded = append(snapshot.RecentlyAdded, displayItem(media, media.CreatedAt))
+	}
+	return snapshot, nil
+}
+
+// Watch streams the display of a kiosk: the current snapshot, then every
+// snapshot that differs from the one before. Media added or deleted is
+// pushed right away; what is playing is recomputed every refresh interval.
+// The channel is closed when ctx is done or the kiosk is revoked.
+func (s *KioskService) Watch(ctx context.Context, kiosk *domain.Kiosk) (<-chan *domain.DisplaySnapshot, error) {
+	first, err := s.Display(ctx, kiosk)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &kioskWatcher{changed: make(chan struct{}, 1)}
+	for _, eventType := range kioskEvents {
+		if err := s.eventBus.Subscribe(eventType, w); err != nil {
+			s.unsubscribe(w)
+			return nil, fmt.Errorf("failed to watch display: %w", err)
+		}
+	}
+
+	snapshots := make(chan *domain.DisplaySnapshot, 1)
+	snapshots <- first
+	go func() {
+		defer close(snapshots)
+		defer s.unsubscribe(w)
+
+		ticker := time.NewTicker(s.refresh)
+		defer ticker.Stop()
+		last := first
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				current, err := s.repo.GetKiosk(tenant.WithTenantID(ctx, kiosk.TenantID), kiosk.ID)
+				if err != nil || current.RevokedAt != nil {
+					return
+				}
+			case <-w.changed:
+			}
+
+			snapshot, err := s.Display(ctx, kiosk)
+			if err != nil {
+				s.logger.Warn("Failed to refresh kiosk display",
+					interfaces.String("kiosk_id", kiosk.ID.String()),
+					interfaces.Error(err))
+				continue
+			}
+			if snapshot.Equal(last) {
+				continue
+			}
+			select {
+			case snapshots <- snapshot:
+				last = snapshot
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return snapshots, nil
+}
+
+func (s *KioskService) unsubscribe(w *kioskWatcher) {
+	for _, eventType := range kioskEvents {
+		_ = s.eventBus.Unsubscribe(eventType, w)
+	}
+}
+
+func displayItem(media *models.Media, at time.Time) domain.DisplayItem {
+	return domain.DisplayItem{
+		MediaID:   media.ID,
+		Title:     media.Title,
+		Year:      media.Year,
+		MediaType: media.Type,
+		At:        at,
+	}
+}
+
+// kioskWatcher signals a watched display to recompute.
+type kioskWatcher struct {
+	changed chan struct{}
+}
+
+func (w *kioskWatcher) Handle(context.Context, interfaces.Event) error {
+	// A pending signal covers every change until the display recomputes
+	select {
+	case w.changed <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (w *kioskWatcher) EventType() string {
+	return "kiosk.watcher"
+}
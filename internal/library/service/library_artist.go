@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// GetArtist returns an artist with their music tracks and music videos,
+// linked by the artist name across the libraries of the tenant.
+func (s *LibraryService) GetArtist(ctx context.Context, name string) (*domain.Artist, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.BadRequest("artist name is required")
+	}
+
+	media, err := s.repo.ListMediaByArtist(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	artist := &domain.Artist{Name: name}
+	for _, item := range media {
+		switch item.Type {
+		case models.MediaTypeMusic:
+			artist.Tracks = append(artist.Tracks, item)
+		case models.MediaTypeMusicVideo:
+			artist.MusicVideos = append(artist.MusicVideos, item)
+		}
+	}
+	if len(artist.Tracks)+len(artist.MusicVideos) == 0 {
+		return nil, errors.NotFound("artist not found")
+	}
+	// The name as the music library spells it
+	if len(artist.Tracks) > 0 {
+		artist.Name = artist.Tracks[0].Artist
+	} else {
+		artist.Name = artist.MusicVideos[0].Artist
+	}
+	return artist, nil
+}
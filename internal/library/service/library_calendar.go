@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/tenant"
+)
+
+// GetCalendar lists the episode air dates and movie release dates of
+// monitored media in [start, end), of a library or of every library if
+// libraryID is nil. A zero start is the beginning of today, UTC, and a zero
+// end is DefaultCalendarRange after start.
+func (s *LibraryService) GetCalendar(
+	ctx context.Context,
+	start, end time.Time,
+	libraryID *uuid.UUID,
+) ([]*domain.CalendarEntry, error) {
+	if start.IsZero() {
+		start = time.Now().UTC().Truncate(24 * time.Hour)
+	}
+	if end.IsZero() {
+		end = start.Add(domain.DefaultCalendarRange)
+	}
+	if !end.After(start) {
+		return nil, errors.BadRequest("calendar end must be after start")
+	}
+	if end.Sub(start) > domain.MaxCalendarRange {
+		return nil, errors.BadRequest("calendar range must not exceed a year")
+	}
+
+	if libraryID != nil {
+		if _, err := s.repo.GetLibrary(ctx, *libraryID); err != nil {
+			return nil, err
+		}
+	}
+	return s.repo.ListCalendar(ctx, start, end, libraryID)
+}
+
+// GetCalendarFeedKey returns the key the calendar feed tokens of a user are
+// derived from. It fails with not found until the first key is issued by
+// RotateCalendarFeedKey.
+func (s *LibraryService) GetCalendarFeedKey(ctx context.Context, userID uuid.UUID) (string, error) {
+	key, err := s.repo.GetCalendarFeedKey(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return key.Key, nil
+}
+
+// RotateCalendarFeedKey issues a new calendar feed key to a user, revoking
+// every feed token derived from the previous one.
+func (s *LibraryService) RotateCalendarFeedKey(ctx context.Context, userID uuid.UUID) (string, error) {
+	key, err := newShareToken()
+	if err != nil {
+		return "", err
+	}
+	tenantID, _ := tenant.FromContext(ctx)
+	if err := s.repo.SetCalendarFeedKey(ctx, &domain.CalendarFeedKey{
+		UserID:    userID,
+		TenantID:  tenantID,
+		Key:       key,
+		CreatedAt: time.Now(),
+	}); err != nil {
+		return "", err
+	}
+	return key, nil
+}
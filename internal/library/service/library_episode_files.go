@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// ListEpisodeFiles lists the files of the episodes of a media item, by path
+// and part. Files holding several episodes are listed once per episode;
+// episodes split across files once per part.
+func (s *LibraryService) ListEpisodeFiles(ctx context.Context, mediaID uuid.UUID) ([]*models.EpisodeFile, error) {
+	if _, err := s.repo.GetMedia(ctx, mediaID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListEpisodeFiles(ctx, mediaID)
+}
+
+// RecordWatchProgress records how far a user has watched a media item or
+// one of its episodes, position seconds in. The position of an episode is
+// attributed as domain.AttributeProgress describes: watching into the
+// second episode of a file holding two completes the first. It returns the
+// watch states written.
+func (s *LibraryService) RecordWatchProgress(
+	ctx context.Context,
+	userID, mediaID uuid.UUID,
+	episodeID *uuid.UUID,
+	position int,
+) ([]*models.WatchHistory, error) {
+	if position < 0 {
+		return nil, errors.BadRequest("position must not be negative")
+	}
+	media, err := s.repo.GetMedia(ctx, mediaID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if episodeID == nil {
+		state := &models.WatchHistory{
+			UserID:      userID,
+			MediaID:     media.ID,
+			Position:    position,
+			Duration:    media.Duration,
+			Completed:   media.Duration > 0 && float64(position) >= domain.WatchedFraction*float64(media.Duration),
+			LastWatched: now,
+		}
+		if err := s.repo.UpsertWatchState(ctx, state); err != nil {
+			return nil, err
+		}
+		s.recordViewing(ctx, state, position)
+		return []*models.WatchHistory{state}, nil
+	}
+
+	episodes, err := s.repo.ListEpisodesByMedia(ctx, media.ID)
+	if err != nil {
+		return nil, err
+	}
+	files, err := s.repo.ListEpisodeFiles(ctx, media.ID)
+	if err != nil {
+		return nil, err
+	}
+	progress := domain.AttributeProgress(episodes, files, *episodeID, position)
+	if len(progress) == 0 {
+		return nil, errors.NotFound("episode not found")
+	}
+
+	states := make([]*models.WatchHistory, 0, len(progress))
+	for _, p := range progress {
+		state := &models.WatchHistory{
+			UserID:      userID,
+			MediaID:     media.ID,
+			EpisodeID:   &p.EpisodeID,
+			Position:    p.Position,
+			Duration:    p.Duration,
+			Completed:   p.Completed,
+			LastWatched: now,
+		}
+		if err := s.repo.UpsertWatchState(ctx, state); err != nil {
+			return nil, err
+		}
+		s.recordViewing(ctx, state, p.Position)
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// recordViewing applies a progress heartbeat to the viewing it belongs to,
+// starting a new viewing if there is none or the user starts over after
+// completing the last one. Analytics are best effort: failing to record the
+// viewing does not fail the heartbeat.
+func (s *LibraryService) recordViewing(ctx context.Context, state *models.WatchHistory, position int) {
+	viewing, err := s.repo.LatestViewing(ctx, state.UserID, state.MediaID, state.EpisodeID)
+	if err != nil && !errors.IsNotFound(err) {
+		s.logger.Warn("Failed to get viewing", interfaces.Error(err))
+		return
+	}
+	if viewing == nil || !viewing.Continues(position) {
+		viewing = &domain.Viewing{
+			MediaID:   state.MediaID,
+			EpisodeID: state.EpisodeID,
+			UserID:    state.UserID,
+			Rewatch:   viewing != nil,
+			StartedAt: state.LastWatched,
+		}
+	}
+	viewing.Record(position, state.Duration, state.Completed, state.LastWatched)
+	if err := s.repo.SaveViewing(ctx, viewing); err != nil {
+		s.logger.Warn("Failed to record viewing",
+			interfaces.String("media_id", state.MediaID.String()),
+			interfaces.Error(err))
+	}
+}
+
+// linkEpisodeFile points the episodes of a series a file holds at it,
+// keeping the other parts of episodes split across files. It reports
+// whether the file name named any known episode.
+func (s *LibraryService) linkEpisodeFile(
+	ctx context.Context,
+	library *domain.Library,
+	media *models.Media,
+	path string,
+) (bool, error) {
+	switch models.MediaType(library.Type) {
+	case models.MediaTypeSeries, models.MediaTypeTV:
+	default:
+		return false, nil
+	}
+	numbers, ok := domain.ParseEpisodeNumbers(filepath.Base(path), library.Anime)
+	if !ok {
+		return false, nil
+	}
+	episodes, err := s.repo.ListEpisodesByMedia(ctx, media.ID)
+	if err != nil || len(episodes) == 0 {
+		return false, err
+	}
+	matched := domain.NewEpisodeMap(episodes).Resolve(numbers)
+	if len(matched) == 0 {
+		return false, nil
+	}
+
+	files, err := s.repo.ListEpisodeFiles(ctx, media.ID)
+	if err != nil {
+		return false, err
+	}
+	for _, ep := range matched {
+		// A whole file replaces every part; a part replaces the same part
+		var kept []*models.EpisodeFile
+		if numbers.Part > 0 {
+			for _, file := range files {
+				if file.EpisodeID == ep.ID && file.Part > 0 && file.Part != numbers.Part {
+					kept = append(kept, file)
+				}
+			}
+		}
+		kept = append(kept, &models.EpisodeFile{Path: path, Part: numbers.Part})
+		sort.SliceStable(kept, func(i, j int) bool { return kept[i].Part < kept[j].Part })
+
+		if err := s.repo.SetEpisodeFiles(ctx, ep.ID, kept); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,417 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/constants"
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// ExportLibrary builds a portable export of a library's media, episodes and watch states.
+func (s *LibraryService) ExportLibrary(ctx context.Context, id uuid.UUID) (*domain.LibraryExport, error) {
+	library, err := s.repo.GetLibrary(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	export := domain.NewLibraryExport(library)
+
+	for offset := 0; ; offset += constants.MaxPageSize {
+		batch, err := s.repo.ListMediaByLibrary(ctx, id, nil, constants.MaxPageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, media := range batch {
+			episodes, err := s.repo.ListEpisodesByMedia(ctx, media.ID)
+			if err != nil {
+				return nil, err
+			}
+			media.Episodes = episodes
+
+			states, err := s.repo.ListWatchStatesByMedia(ctx, media.ID)
+			if err != nil {
+				return nil, err
+			}
+
+			export.Media = append(export.Media, domain.ExportedMedia{
+				Media:       media,
+				WatchStates: states,
+			})
+		}
+
+		if len(batch) < constants.MaxPageSize {
+			break
+		}
+	}
+
+	s.logger.Info("Library exported",
+		interfaces.String("library_id", id.String()),
+		interfaces.Int("media", len(export.Media)))
+
+	return export, nil
+}
+
+// importBatchSize is the number of exported media ImportLibrary looks up
+// and writes per database round trip.
+const importBatchSize = constants.DefaultScanBatchSize
+
+// ImportLibrary imports an export into an existing library.
+// Media is matched by path after rebasing onto the target library's root.
+func (s *LibraryService) ImportLibrary(
+	ctx context.Context,
+	id uuid.UUID,
+	data *domain.LibraryExport,
+	strategy domain.ConflictStrategy,
+) (*domain.ImportResult, error) {
+	if data == nil {
+		return nil, errors.BadRequest("import data is required")
+	}
+	if data.SchemaVersion > domain.ExportSchemaVersion {
+		return nil, errors.BadRequest(fmt.Sprintf("unsupported export schema version %d", data.SchemaVersion))
+	}
+
+	library, err := s.repo.GetLibrary(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &domain.ImportResult{}
+
+	started := time.Now()
+	written := 0
+	for start := 0; start < len(data.Media); start += importBatchSize {
+		batch := data.Media[start:min(start+importBatchSize, len(data.Media))]
+		written += s.importMediaBatch(ctx, library, data, batch, strategy, result)
+	}
+	rowsPerSecond := 0.0
+	if elapsed := time.Since(started); elapsed > 0 {
+		rowsPerSecond = float64(written) / elapsed.Seconds()
+	}
+
+	s.importFailures.Add(int64(result.Failed))
+	s.eventBus.PublishAsync(ctx, domain.NewLibraryImportedEvent(id, result))
+
+	s.logger.Info("Library imported",
+		interfaces.String("library_id", id.String()),
+		interfaces.String("strategy", string(strategy)),
+		interfaces.Int("created", result.Created),
+		interfaces.Int("updated", result.Updated),
+		interfaces.Int("skipped", result.Skipped),
+		interfaces.Int("failed", result.Failed),
+		interfaces.Any("rows_per_second", rowsPerSecond))
+
+	return result, nil
+}
+
+// ImportFailures returns the number of media that failed to import since
+// the service started.
+func (s *LibraryService) ImportFailures() int64 {
+	return s.importFailures.Load()
+}
+
+// mediaImport is an exported media item matched to its media in the target
+// library.
+type mediaImport struct {
+	item    domain.ExportedMedia
+	target  *models.Media
+	created bool
+}
+
+// importMediaBatch reconciles a batch of exported media with the target
+// library. The media of the batch are looked up and written in one round
+// trip each; episodes and watch states follow per item. It returns the
+// number of media rows written.
+func (s *LibraryService) importMediaBatch(
+	ctx context.Context,
+	library *domain.Library,
+	data *domain.LibraryExport,
+	batch []domain.ExportedMedia,
+	strategy domain.ConflictStrategy,
+	result *domain.ImportResult,
+) int {
+	// Paths outside the exported root would land outside the library
+	rebased := make([]string, len(batch))
+	paths := make([]string, 0, len(batch))
+	for i, item := range batch {
+		if item.Media == nil || item.Media.Path == "" {
+			continue
+		}
+		if path, ok := data.RebasePath(item.Media.Path, library.Path); ok {
+			rebased[i] = path
+			paths = append(paths, path)
+		}
+	}
+
+	existing, err := s.repo.GetMediaByPaths(ctx, paths)
+	if err != nil {
+		for _, item := range batch {
+			s.importFailed(result, item, err)
+		}
+		return 0
+	}
+
+	var (
+		imports []mediaImport
+		rows    []*models.Media
+		queued  = make(map[string]bool, len(batch))
+	)
+	for i, item := range batch {
+		if item.Media == nil || item.Media.Path == "" {
+			s.importFailed(result, item, nil)
+			continue
+		}
+		path := rebased[i]
+		if path == "" {
+			s.importFailed(result, item, errors.BadRequest("path is outside the exported library"))
+			continue
+		}
+
+		incoming := item.Media
+		target, created := existing[path], false
+		switch {
+		case target == nil:
+			target = newImportedMedia(library, path, incoming)
+			created = true
+			// Later entries with the same path update this media
+			existing[path] = target
+		case target.LibraryID != library.ID:
+			// Paths are looked up across libraries; media of other
+			// libraries are never touched
+			s.importFailed(result, item, errors.Conflict("path belongs to another library"))
+			continue
+		case strategy == domain.ConflictSkip:
+			result.Skipped++
+			continue
+		case strategy == domain.ConflictOverwrite:
+			domain.OverwriteMedia(target, incoming)
+		default:
+			domain.MergeMedia(target, incoming)
+		}
+
+		imports = append(imports, mediaImport{item: item, target: target, created: created})
+		if !queued[path] {
+			queued[path] = true
+			rows = append(rows, target)
+		}
+	}
+
+	if len(rows) == 0 {
+		return 0
+	}
+	if _, err := s.repo.UpsertMediaBatch(ctx, rows); err != nil {
+		for _, imp := range imports {
+			s.importFailed(result, imp.item, err)
+		}
+		return 0
+	}
+
+	for _, imp := range imports {
+		if imp.created {
+			s.eventBus.PublishAsync(ctx, domain.NewMediaAddedEvent(imp.target))
+			result.Created++
+		} else {
+			_ = s.cache.Delete(ctx, "media:"+imp.target.ID.String())
+			s.eventBus.PublishAsync(ctx, domain.NewMediaUpdatedEvent(imp.target))
+			result.Updated++
+		}
+
+		if err := s.importMediaChildren(ctx, library, data, imp, strategy); err != nil {
+			s.importFailed(result, imp.item, err)
+		}
+	}
+
+	return len(rows)
+}
+
+// importMediaChildren imports the episodes and watch states of an imported
+// media item.
+func (s *LibraryService) importMediaChildren(
+	ctx context.Context,
+	library *domain.Library,
+	data *domain.LibraryExport,
+	imp mediaImport,
+	strategy domain.ConflictStrategy,
+) error {
+	episodeIDs, err := s.importEpisodes(ctx, library, data, imp.target, imp.item.Media.Episodes, strategy)
+	if err != nil {
+		return err
+	}
+
+	return s.importWatchStates(ctx, imp.target, imp.item.WatchStates, episodeIDs, strategy)
+}
+
+// importFailed records an exported media item that failed to import.
+func (s *LibraryService) importFailed(result *domain.ImportResult, item domain.ExportedMedia, err error) {
+	result.Failed++
+	if item.Media == nil || item.Media.Path == "" {
+		result.Errors = append(result.Errors, "media entry without path")
+		return
+	}
+
+	result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", item.Media.Path, err))
+	s.logger.Warn("Failed to import media",
+		interfaces.String("path", item.Media.Path),
+		interfaces.Error(err))
+}
+
+// newImportedMedia creates the media of an exported media item that is not
+// in the target library yet.
+func newImportedMedia(library *domain.Library, path string, incoming *models.Media) *models.Media {
+	media := &models.Media{
+		ID:          uuid.New(),
+		TenantID:    library.TenantID,
+		LibraryID:   library.ID,
+		Type:        incoming.Type,
+		Path:        path,
+		FilePath:    path,
+		Size:        incoming.Size,
+		FileSize:    incoming.Size,
+		Duration:    incoming.Duration,
+		Resolution:  incoming.Resolution,
+		Codec:       incoming.Codec,
+		Bitrate:     incoming.Bitrate,
+		Status:      string(models.MediaStatusPending),
+		Added:       time.Now(),
+		Modified:    incoming.Modified,
+		LastScanned: incoming.LastScanned,
+	}
+	if media.Type == "" {
+		media.Type = models.MediaType(library.Type)
+	}
+	domain.OverwriteMedia(media, incoming)
+	return media
+}
+
+// importEpisodes imports episodes for a media item and returns a mapping of
+// exported episode IDs to their IDs in this library.
+func (s *LibraryService) importEpisodes(
+	ctx context.Context,
+	library *domain.Library,
+	data *domain.LibraryExport,
+	media *models.Media,
+	episodes []*models.Episode,
+	strategy domain.ConflictStrategy,
+) (map[uuid.UUID]uuid.UUID, error) {
+	ids := make(map[uuid.UUID]uuid.UUID, len(episodes))
+
+	for _, incoming := range episodes {
+		var path string
+		if incoming.Path != "" {
+			var ok bool
+			if path, ok = data.RebasePath(incoming.Path, library.Path); !ok {
+				return nil, errors.BadRequest(fmt.Sprintf("episode path %s is outside the exported library", incoming.Path))
+			}
+		}
+
+		existing, err := s.repo.GetEpisodeByNumber(ctx, media.ID, incoming.SeasonNumber, incoming.EpisodeNumber)
+		if err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		}
+
+		if existing == nil {
+			episode := &models.Episode{
+				MediaID:        media.ID,
+				SeasonNumber:   incoming.SeasonNumber,
+				EpisodeNumber:  incoming.EpisodeNumber,
+				AbsoluteNumber: incoming.AbsoluteNumber,
+				Title:          incoming.Title,
+				Path:           path,
+				Duration:       incoming.Duration,
+				AirDate:        incoming.AirDate,
+			}
+			if err := s.repo.CreateEpisode(ctx, episode); err != nil {
+				return nil, err
+			}
+			ids[incoming.ID] = episode.ID
+			continue
+		}
+
+		ids[incoming.ID] = existing.ID
+
+		switch strategy {
+		case domain.ConflictOverwrite:
+			existing.Title = incoming.Title
+			existing.AirDate = incoming.AirDate
+		case domain.ConflictMerge:
+			if existing.Title == "" {
+				existing.Title = incoming.Title
+			}
+			if existing.AirDate.IsZero() {
+				existing.AirDate = incoming.AirDate
+			}
+		default:
+			continue
+		}
+
+		if err := s.repo.UpdateEpisode(ctx, existing); err != nil {
+			return nil, err
+		}
+	}
+
+	return ids, nil
+}
+
+// importWatchStates restores watch states for a media item. With the merge
+// strategy the most recently watched state wins.
+func (s *LibraryService) importWatchStates(
+	ctx context.Context,
+	media *models.Media,
+	states []*models.WatchHistory,
+	episodeIDs map[uuid.UUID]uuid.UUID,
+	strategy domain.ConflictStrategy,
+) error {
+	if len(states) == 0 {
+		return nil
+	}
+
+	current := make(map[string]*models.WatchHistory)
+	if strategy == domain.ConflictMerge {
+		existing, err := s.repo.ListWatchStatesByMedia(ctx, media.ID)
+		if err != nil {
+			return err
+		}
+		for _, state := range existing {
+			current[watchStateKey(state.UserID, state.EpisodeID)] = state
+		}
+	}
+
+	for _, incoming := range states {
+		state := *incoming
+		state.ID = uuid.Nil
+		state.MediaID = media.ID
+
+		if incoming.EpisodeID != nil {
+			episodeID, ok := episodeIDs[*incoming.EpisodeID]
+			if !ok {
+				continue
+			}
+			state.EpisodeID = &episodeID
+		}
+
+		if prev, ok := current[watchStateKey(state.UserID, state.EpisodeID)]; ok &&
+			!prev.LastWatched.Before(state.LastWatched) {
+			continue
+		}
+
+		if err := s.repo.UpsertWatchState(ctx, &state); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func watchStateKey(userID uuid.UUID, episodeID *uuid.UUID) string {
+	if episodeID == nil {
+		return userID.String()
+	}
+	return userID.String() + ":" + episodeID.String()
+}
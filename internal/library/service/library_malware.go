@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/saga"
+)
+
+// WorkflowStepMalwareScan is the name of the malware scan step.
+const WorkflowStepMalwareScan = "malware_scan"
+
+// WithMalwareScanner sets the scanner completed downloads are checked with
+// before they are imported, and the directory infected files are moved to.
+// An empty directory quarantines them in a hidden directory next to the
+// download. Without a scanner, downloads are not scanned.
+func (s *LibraryService) WithMalwareScanner(scanner domain.MalwareScanner, quarantineDir string) *LibraryService {
+	s.malwareScanner = scanner
+	s.quarantineDir = quarantineDir
+	return s
+}
+
+// MalwareScanStep scans the downloaded file at the workflow's path for
+// malware, and goes before ImportStep. Infected files are quarantined, the
+// release is blocklisted and a security notification is published; the
+// step then fails without being retried so the workflow is compensated.
+// The verdict is recorded on the workflow either way. Scans that fail are
+// retried, and downloads pass unscanned when no scanner is configured.
+func (s *LibraryService) MalwareScanStep() saga.Step {
+	return saga.Step{
+		Name:    WorkflowStepMalwareScan,
+		Execute: s.scanWorkflowDownload,
+	}
+}
+
+func (s *LibraryService) scanWorkflowDownload(ctx context.Context, wf *saga.Workflow) error {
+	if s.malwareScanner == nil {
+		return nil
+	}
+	if wf.Data[WorkflowDataMalwareVerdict] == string(domain.MalwareVerdictInfected) {
+		return saga.Permanent(fmt.Errorf("download quarantined: %s", wf.Data[WorkflowDataMalwareThreat]))
+	}
+	path := wf.Data[WorkflowDataPath]
+	if path == "" {
+		return errors.BadRequest("workflow has no file path")
+	}
+
+	scan, err := s.malwareScanner.Scan(ctx, path)
+	if err != nil {
+		return fmt.Errorf("malware scan failed: %w", err)
+	}
+	wf.Data[WorkflowDataMalwareVerdict] = string(scan.Verdict)
+	if scan.Verdict != domain.MalwareVerdictInfected {
+		return nil
+	}
+	wf.Data[WorkflowDataMalwareThreat] = scan.Threat
+
+	s.logger.Warn("Malware found in download",
+		interfaces.String("workflow_id", wf.ID.String()),
+		interfaces.String("path", scan.Path),
+		interfaces.String("threat", scan.Threat),
+		interfaces.String("scanner", scan.Scanner))
+
+	quarantined, err := s.quarantineFile(wf, scan.Path)
+	if err != nil {
+		// The file is left where it is; the import is still refused
+		s.logger.Error("Failed to quarantine infected file",
+			interfaces.String("workflow_id", wf.ID.String()),
+			interfaces.String("path", scan.Path),
+			interfaces.Error(err))
+	}
+	wf.Data[WorkflowDataQuarantinedPath] = quarantined
+
+	release := workflowRelease(wf)
+	s.blocklistMalware(ctx, wf, release, scan)
+	s.eventBus.PublishAsync(ctx, domain.NewDownloadQuarantinedEvent(
+		wf.ID, wf.MediaID, *scan, quarantined, release, wf.Data[WorkflowDataDownloadClient]))
+
+	return saga.Permanent(fmt.Errorf("download quarantined: %s", scan.Threat))
+}
+
+// quarantineFile moves an infected file to the quarantine directory and
+// makes it read only, returning where it went.
+func (s *LibraryService) quarantineFile(wf *saga.Workflow, path string) (string, error) {
+	quarantined := domain.QuarantinePath(s.quarantineDir, wf.ID, path)
+	if err := os.MkdirAll(filepath.Dir(quarantined), 0o700); err != nil {
+		return "", fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+	if err := moveFile(path, quarantined); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(quarantined, 0o400); err != nil {
+		return quarantined, fmt.Errorf("failed to restrict quarantined file: %w", err)
+	}
+	return quarantined, nil
+}
+
+// blocklistMalware blocklists a release flagged as malware so it is not
+// grabbed again. Failures are logged, as the download is refused anyway.
+func (s *LibraryService) blocklistMalware(
+	ctx context.Context,
+	wf *saga.Workflow,
+	release domain.ReleaseIdentity,
+	scan *domain.MalwareScan,
+) {
+	if release.Validate() != nil {
+		return
+	}
+
+	mediaID := wf.MediaID
+	entry := &domain.BlocklistEntry{
+		ReleaseIdentity: release,
+		MediaID:         &mediaID,
+		Source:          domain.BlocklistSourceMalware,
+		Reason:          fmt.Sprintf("%s found by %s", scan.Threat, scan.Scanner),
+		CreatedAt:       time.Now(),
+	}
+	if err := s.repo.AddBlocklistEntry(ctx, entry); err != nil {
+		s.logger.Error("Failed to blocklist release",
+			interfaces.String("workflow_id", wf.ID.String()),
+			interfaces.Error(err))
+	}
+}
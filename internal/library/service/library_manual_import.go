@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// ListManualImports lists a page of downloads parked for manual matching,
+// oldest first, and the number of downloads in all pages. A nil status
+// lists every status.
+func (s *LibraryService) ListManualImports(
+	ctx context.Context,
+	status *domain.ManualImportStatus,
+	limit, offset int,
+) ([]*domain.ManualImport, int64, error) {
+	return s.repo.ListManualImports(ctx, status, limit, offset)
+}
+
+// ResolveManualImport imports a parked download into an item of its
+// library, or as a new item if mediaID is nil. Any item of the library can
+// be picked, not only the candidates. The file replaces the file the item
+// has, which is moved to the recycle bin.
+func (s *LibraryService) ResolveManualImport(
+	ctx context.Context,
+	id uuid.UUID,
+	mediaID *uuid.UUID,
+) (*domain.ManualImport, error) {
+	mi, err := s.pendingManualImport(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	library, err := s.repo.GetLibrary(ctx, mi.LibraryID)
+	if err != nil {
+		return nil, err
+	}
+
+	var media *models.Media
+	if mediaID != nil {
+		media, err = s.repo.GetMedia(ctx, *mediaID)
+		if err != nil {
+			return nil, err
+		}
+		if media.LibraryID != mi.LibraryID {
+			return nil, errors.BadRequest("media item is not in the library of the download")
+		}
+	}
+
+	var path, method string
+	place := func() (string, error) {
+		var err error
+		path, method, err = s.placeDownload(mi.Path, mi.DownloadClient, library)
+		return path, err
+	}
+	if media != nil && hasOtherFile(media, mi.Path) {
+		err = s.importReplacing(ctx, library, media, mi.Path, place, "replaced manually")
+	} else if _, err = place(); err == nil {
+		err = s.applyImport(ctx, library, mi.MediaID, media, path, "imported manually")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	imported := mi.MediaID
+	if media != nil {
+		imported = media.ID
+	}
+	now := time.Now()
+	mi.Status = domain.ManualImportImported
+	mi.ImportedMediaID = &imported
+	mi.ResolvedAt = &now
+	if err := s.repo.ResolveManualImport(ctx, mi); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Manual import resolved",
+		interfaces.String("manual_import_id", mi.ID.String()),
+		interfaces.String("media_id", imported.String()),
+		interfaces.String("path", path),
+		interfaces.String("method", method))
+	return mi, nil
+}
+
+// RejectManualImport rejects a parked download. The file is left with its
+// download client, and its release, if known, is blocklisted.
+func (s *LibraryService) RejectManualImport(ctx context.Context, id uuid.UUID) (*domain.ManualImport, error) {
+	mi, err := s.pendingManualImport(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	mi.Status = domain.ManualImportRejected
+	mi.ResolvedAt = &now
+	if err := s.repo.ResolveManualImport(ctx, mi); err != nil {
+		return nil, err
+	}
+
+	if mi.Release.Validate() == nil {
+		entry := &domain.BlocklistEntry{
+			ReleaseIdentity: mi.Release,
+			Source:          domain.BlocklistSourceManual,
+			Reason:          "rejected in manual import",
+			CreatedAt:       now,
+		}
+		if err := s.repo.AddBlocklistEntry(ctx, entry); err != nil {
+			s.logger.Error("Failed to blocklist rejected release",
+				interfaces.String("manual_import_id", mi.ID.String()),
+				interfaces.Error(err))
+		}
+	}
+
+	s.logger.Info("Manual import rejected",
+		interfaces.String("manual_import_id", mi.ID.String()),
+		interfaces.String("path", mi.Path))
+	return mi, nil
+}
+
+func (s *LibraryService) pendingManualImport(ctx context.Context, id uuid.UUID) (*domain.ManualImport, error) {
+	mi, err := s.repo.GetManualImport(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if mi.Status != domain.ManualImportPending {
+		return nil, errors.Conflict("manual import was resolved already")
+	}
+	return mi, nil
+}
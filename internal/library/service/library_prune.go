@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+	"github.com/narwhalmedia/narwhal/pkg/task"
+	"github.com/narwhalmedia/narwhal/pkg/tenant"
+)
+
+// WithPrunePolicy sets the policy deciding which titles are suggested for
+// deletion. Without one, only the copies of titles are suggested.
+func (s *LibraryService) WithPrunePolicy(policy domain.PrunePolicy) *LibraryService {
+	s.prunePolicy = policy
+	return s
+}
+
+// PlanPrune ranks the titles of a library, or of every library if
+// libraryID is nil, worth deleting: titles nobody watched within the
+// unwatched period and copies of titles kept in equal or better quality.
+// Titles on disks short of free space rank higher.
+func (s *LibraryService) PlanPrune(ctx context.Context, libraryID *uuid.UUID) (*domain.PrunePlan, error) {
+	var libraries []*domain.Library
+	if libraryID != nil {
+		library, err := s.repo.GetLibrary(ctx, *libraryID)
+		if err != nil {
+			return nil, err
+		}
+		libraries = []*domain.Library{library}
+	} else {
+		var err error
+		if libraries, err = s.repo.ListLibraries(ctx, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	items, err := s.repo.ListPruneItems(ctx, libraryID)
+	if err != nil {
+		return nil, err
+	}
+
+	disks := make(map[uuid.UUID]domain.DiskSpace, len(libraries))
+	for _, library := range libraries {
+		space, err := diskSpace(library.Path)
+		if err != nil {
+			s.logger.Warn("Failed to read disk space of library",
+				interfaces.String("library_id", library.ID.String()),
+				interfaces.Error(err))
+			continue
+		}
+		disks[library.ID] = space
+	}
+	return s.prunePolicy.Plan(items, disks, time.Now()), nil
+}
+
+// ApplyPrune starts a task deleting the files of media, moving them to the
+// recycle bin instead if recycle is set, and the media with them. Files of
+// their extras go with them. Media that cannot be pruned are skipped and
+// fail the task once the others are done.
+func (s *LibraryService) ApplyPrune(ctx context.Context, mediaIDs []uuid.UUID, recycle bool) (*task.Task, error) {
+	if len(mediaIDs) == 0 {
+		return nil, errors.BadRequest("no media selected")
+	}
+
+	var media []*models.Media
+	libraries := make(map[uuid.UUID]*domain.Library)
+	seen := make(map[uuid.UUID]bool, len(mediaIDs))
+	var size int64
+	for _, id := range mediaIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		m, err := s.repo.GetMedia(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if m.FilePath == "" || m.ParentID != nil {
+			return nil, errors.BadRequest(fmt.Sprintf("media %s has no file to prune", id))
+		}
+		if _, ok := libraries[m.LibraryID]; !ok {
+			library, err := s.repo.GetLibrary(ctx, m.LibraryID)
+			if err != nil {
+				return nil, err
+			}
+			if s.scanner.IsScanning(library.ID.String()) {
+				return nil, errors.Conflict("scan in progress")
+			}
+			libraries[library.ID] = library
+		}
+		media = append(media, m)
+		size += m.FileSize
+	}
+
+	ids := make([]string, len(media))
+	for i, m := range media {
+		ids[i] = m.ID.String()
+	}
+	payload := map[string]string{
+		"media_ids": strings.Join(ids, ","),
+		"recycle":   strconv.FormatBool(recycle),
+		"bytes":     strconv.FormatInt(size, 10),
+	}
+	var tenantID uuid.UUID
+	for _, library := range libraries {
+		tenantID = library.TenantID
+	}
+	return s.tasks.Submit(
+		tenant.WithTenantID(ctx, tenantID),
+		TaskTypeMediaPrune,
+		payload,
+		func(ctx context.Context) error {
+			return s.applyPrune(ctx, media, libraries, recycle)
+		},
+	)
+}
+
+func (s *LibraryService) applyPrune(
+	ctx context.Context,
+	media []*models.Media,
+	libraries map[uuid.UUID]*domain.Library,
+	recycle bool,
+) error {
+	failed := 0
+	var freed int64
+	for i, m := range media {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		task.SetProgress(ctx, float64(i)/float64(len(media)), "Pruning "+m.Title)
+
+		if err := s.pruneMedia(ctx, libraries[m.LibraryID], m, recycle); err != nil {
+			failed++
+			task.Log(ctx, fmt.Sprintf("Failed to prune %s: %v", m.Title, err))
+			s.logger.Error("Failed to prune media",
+				interfaces.String("media_id", m.ID.String()),
+				interfaces.Error(err))
+			continue
+		}
+		freed += m.FileSize
+	}
+
+	task.Log(ctx, fmt.Sprintf("Pruned %d titles, freeing %d bytes", len(media)-failed, freed))
+	s.logger.Info("Media pruned",
+		interfaces.Int("count", len(media)-failed),
+		interfaces.Any("bytes", freed),
+		interfaces.Bool("recycled", recycle))
+	if failed > 0 {
+		return fmt.Errorf("%d of %d titles could not be pruned", failed, len(media))
+	}
+	return nil
+}
+
+// pruneMedia disposes of the files of a media item and its extras and
+// deletes them.
+func (s *LibraryService) pruneMedia(ctx context.Context, library *domain.Library, media *models.Media, recycle bool) error {
+	extras, err := s.repo.ListExtras(ctx, media.ID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, m := range append(extras, media) {
+		if m.FilePath == "" {
+			continue
+		}
+		if err := s.disposeFile(library, m.FilePath, recycle, now); err != nil {
+			return err
+		}
+	}
+	return s.DeleteMedia(ctx, media.ID)
+}
+
+// disposeFile deletes a file, or moves it to the recycle bin if recycle is
+// set. Files already gone are left alone.
+func (s *LibraryService) disposeFile(library *domain.Library, path string, recycle bool, now time.Time) error {
+	if !pathExists(path) {
+		return nil
+	}
+	if !recycle {
+		return os.Remove(path)
+	}
+
+	recycled := domain.RecyclePath(s.recycleBin, library, path, now)
+	if err := os.MkdirAll(filepath.Dir(recycled), 0o755); err != nil {
+		return fmt.Errorf("failed to create recycle bin: %w", err)
+	}
+	return moveFile(path, recycled)
+}
+
+// RunPruneAdvisor plans pruning every interval until ctx is cancelled,
+// publishing suggestions for the libraries whose disk is short of free
+// space. Each pass runs as a task.
+func (s *LibraryService) RunPruneAdvisor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = s.tasks.Run(ctx, TaskTypePruneAdvice, nil, func(ctx context.Context) error {
+				err := s.advisePrune(ctx)
+				if err != nil {
+					s.logger.Error("Prune advice failed", interfaces.Error(err))
+				}
+				return err
+			})
+		}
+	}
+}
+
+func (s *LibraryService) advisePrune(ctx context.Context) error {
+	plan, err := s.PlanPrune(ctx, nil)
+	if err != nil {
+		return err
+	}
+	task.Log(ctx, fmt.Sprintf("%d titles suggested for pruning would free %d bytes", len(plan.Candidates), plan.Savings))
+
+	for _, libraryID := range plan.Pressured {
+		count, savings := plan.LibrarySavings(libraryID)
+		if count == 0 {
+			continue
+		}
+		s.eventBus.PublishAsync(ctx, domain.NewPruneSuggestedEvent(libraryID, count, savings))
+		s.logger.Warn("Library disk is short of free space",
+			interfaces.String("library_id", libraryID.String()),
+			interfaces.Int("candidates", count),
+			interfaces.Any("savings", savings))
+	}
+	return nil
+}
+
+// diskSpace returns the size and free space of the disk holding path.
+func diskSpace(path string) (domain.DiskSpace, error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return domain.DiskSpace{}, fmt.Errorf("failed to stat disk of %s: %w", path, err)
+	}
+	blockSize := int64(fs.Bsize) // not int64 on every platform
+	return domain.DiskSpace{
+		Total: int64(fs.Blocks) * blockSize,
+		Free:  int64(fs.Bavail) * blockSize,
+	}, nil
+}
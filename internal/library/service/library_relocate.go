@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// RelocateLibrary rewrites the paths of a library and its files from one
+// prefix to another after they were moved, such as to another disk. The
+// library path must be under from. Every file under from must be found at
+// its new path; with dryRun set nothing is written, and the result lists
+// the paths that would change and the files that are missing.
+func (s *LibraryService) RelocateLibrary(
+	ctx context.Context,
+	id uuid.UUID,
+	from, to string,
+	dryRun bool,
+) (*domain.Relocation, error) {
+	if err := domain.ValidateRelocationPrefixes(from, to); err != nil {
+		return nil, errors.BadRequest(err.Error())
+	}
+
+	library, err := s.repo.GetLibrary(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	libraryPath, ok := domain.RelocatePath(library.Path, from, to)
+	if !ok {
+		return nil, errors.BadRequest(fmt.Sprintf("library path %s is not under %s", library.Path, from))
+	}
+	if other, err := s.repo.GetLibraryByPath(ctx, libraryPath); err == nil && other.ID != id {
+		return nil, errors.Conflict(fmt.Sprintf("library %s already uses %s", other.Name, libraryPath))
+	}
+
+	files, err := s.repo.ListLibraryFiles(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	relocation := &domain.Relocation{
+		LibraryID:   id,
+		From:        from,
+		To:          to,
+		LibraryPath: libraryPath,
+	}
+	for _, file := range files {
+		newPath, ok := domain.RelocatePath(file.Path, from, to)
+		if !ok {
+			continue
+		}
+		exists := pathExists(newPath)
+		if !exists {
+			relocation.Missing++
+		}
+		relocation.Files = append(relocation.Files, domain.RelocatedFile{
+			LibraryFile: *file,
+			NewPath:     newPath,
+			Exists:      exists,
+		})
+	}
+
+	if dryRun {
+		return relocation, nil
+	}
+
+	if info, err := os.Stat(libraryPath); err != nil || !info.IsDir() {
+		return nil, errors.BadRequest(fmt.Sprintf("library directory %s not found", libraryPath))
+	}
+	if relocation.Missing > 0 {
+		return nil, errors.BadRequest(fmt.Sprintf("%d files were not found at their new location", relocation.Missing))
+	}
+	if s.scanner.IsScanning(id.String()) {
+		return nil, errors.Conflict("scan in progress")
+	}
+
+	relocated, err := s.repo.RelocateLibrary(ctx, id, from, to)
+	if err != nil {
+		return nil, err
+	}
+	relocation.Applied = true
+
+	// Invalidate cache
+	_ = s.cache.Delete(ctx, "library:"+id.String())
+	for _, file := range relocation.Files {
+		_ = s.cache.Delete(ctx, "media:"+file.MediaID.String())
+	}
+
+	// Publish event
+	s.eventBus.PublishAsync(ctx, domain.NewLibraryRelocatedEvent(relocation, relocated))
+
+	s.logger.Info("Library relocated",
+		interfaces.String("id", id.String()),
+		interfaces.String("from", from),
+		interfaces.String("to", to),
+		interfaces.Int("files", relocated))
+
+	return relocation, nil
+}
+
+// MoveFile moves the file of a media item to another path inside its
+// library and points the media item at it. Moves across file systems copy
+// the file and remove the original.
+func (s *LibraryService) MoveFile(ctx context.Context, id uuid.UUID, newPath string) (*models.Media, error) {
+	if !filepath.IsAbs(newPath) {
+		return nil, errors.BadRequest("destination must be an absolute path")
+	}
+	newPath = filepath.Clean(newPath)
+
+	media, err := s.repo.GetMedia(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if media.FilePath == "" {
+		return nil, errors.BadRequest("media has no file")
+	}
+	if media.FilePath == newPath {
+		return media, nil
+	}
+	info, err := os.Stat(media.FilePath)
+	if err != nil {
+		return nil, errors.NotFound("media file not found")
+	}
+	if !info.Mode().IsRegular() {
+		return nil, errors.BadRequest("only single files can be moved")
+	}
+
+	library, err := s.repo.GetLibrary(ctx, media.LibraryID)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := domain.RelocatePath(newPath, library.Path, library.Path); !ok || newPath == filepath.Clean(library.Path) {
+		return nil, errors.BadRequest("destination must be inside the library")
+	}
+	if s.scanner.IsScanning(library.ID.String()) {
+		return nil, errors.Conflict("scan in progress")
+	}
+	if _, err := os.Lstat(newPath); err == nil {
+		return nil, errors.Conflict("a file already exists at the destination")
+	}
+	if _, err := s.repo.GetMediaByPath(ctx, newPath); err == nil {
+		return nil, errors.Conflict("another media item uses the destination")
+	}
+
+	oldPath := media.FilePath
+	if err := os.MkdirAll(filepath.Dir(newPath), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create destination directory: %w", err)
+	}
+	if err := moveFile(oldPath, newPath); err != nil {
+		return nil, err
+	}
+
+	media.Path = newPath
+	media.FilePath = newPath
+	if err := s.repo.UpdateMedia(ctx, media); err != nil {
+		// Put the file back so the media item still points at it
+		if moveErr := moveFile(newPath, oldPath); moveErr != nil {
+			s.logger.Error("Failed to move file back after failed update",
+				interfaces.String("id", id.String()),
+				interfaces.String("path", newPath),
+				interfaces.Error(moveErr))
+		}
+		return nil, err
+	}
+
+	// Invalidate cache
+	_ = s.cache.Delete(ctx, "media:"+id.String())
+
+	// Publish event
+	s.eventBus.PublishAsync(ctx, domain.NewMediaUpdatedEvent(media))
+
+	s.logger.Info("Media file moved",
+		interfaces.String("id", id.String()),
+		interfaces.String("from", oldPath),
+		interfaces.String("to", newPath))
+
+	return media, nil
+}
+
+// moveFile renames src to dst, copying it when they are on different file
+// systems.
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+	if !stderrors.Is(err, syscall.EXDEV) {
+		return fmt.Errorf("failed to move file: %w", err)
+	}
+
+	if err := copyFile(src, dst); err != nil {
+		_ = os.Remove(dst)
+		return fmt.Errorf("failed to copy file: %w", err)
+	}
+	if err := os.Remove(src); err != nil {
+		return fmt.Errorf("failed to remove original file: %w", err)
+	}
+	return nil
+}
+
+// copyFile copies src to a new file dst, keeping its permissions and
+// modification time.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// pathExists reports whether a file or directory exists at path.
+func pathExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,373 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+	"github.com/narwhalmedia/narwhal/pkg/task"
+	"github.com/narwhalmedia/narwhal/pkg/tenant"
+)
+
+// PreviewRename lists the files of media whose path would change when
+// renamed to the naming formats of their libraries, and the files that
+// cannot be renamed. Media with episodes are renamed to the episode format,
+// one file per episode; other media to the movie format. Extras, and
+// episodes split across several files, are left where they are.
+func (s *LibraryService) PreviewRename(ctx context.Context, mediaIDs []uuid.UUID) (*domain.Rename, error) {
+	rename, _, err := s.planRename(ctx, mediaIDs)
+	return rename, err
+}
+
+// ApplyRename starts a task renaming the files of media as PreviewRename
+// lists them. Files that cannot be renamed are skipped. The files are
+// moved on disk and their media and episodes updated together: if a move
+// or the update fails, the files already moved are moved back.
+func (s *LibraryService) ApplyRename(ctx context.Context, mediaIDs []uuid.UUID) (*task.Task, error) {
+	rename, libraries, err := s.planRename(ctx, mediaIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var tenantID uuid.UUID
+	for _, library := range libraries {
+		if s.scanner.IsScanning(library.ID.String()) {
+			return nil, errors.Conflict("scan in progress")
+		}
+		tenantID = library.TenantID
+	}
+
+	ids := make([]string, len(mediaIDs))
+	for i, id := range mediaIDs {
+		ids[i] = id.String()
+	}
+	payload := map[string]string{
+		"media_ids": strings.Join(ids, ","),
+		"files":     strconv.Itoa(len(rename.Files) - rename.Conflicts),
+	}
+	return s.tasks.Submit(
+		tenant.WithTenantID(ctx, tenantID),
+		TaskTypeMediaRename,
+		payload,
+		func(ctx context.Context) error {
+			return s.applyRename(ctx, rename, libraries)
+		},
+	)
+}
+
+// planRename works out the new paths of the files of media and returns
+// them with the libraries of the media.
+func (s *LibraryService) planRename(
+	ctx context.Context,
+	mediaIDs []uuid.UUID,
+) (*domain.Rename, map[uuid.UUID]*domain.Library, error) {
+	if len(mediaIDs) == 0 {
+		return nil, nil, errors.BadRequest("no media selected")
+	}
+
+	rename := &domain.Rename{}
+	libraries := make(map[uuid.UUID]*domain.Library)
+	seen := make(map[uuid.UUID]bool, len(mediaIDs))
+	for _, id := range mediaIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		media, err := s.repo.GetMedia(ctx, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		if media.ParentID != nil {
+			continue
+		}
+
+		library, ok := libraries[media.LibraryID]
+		if !ok {
+			if library, err = s.repo.GetLibrary(ctx, media.LibraryID); err != nil {
+				return nil, nil, err
+			}
+			libraries[library.ID] = library
+		}
+
+		episodes, err := s.repo.ListEpisodesByMedia(ctx, media.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := s.planMediaRename(ctx, rename, library, media, episodes); err != nil {
+			return nil, nil, err
+		}
+	}
+	return rename, libraries, nil
+}
+
+// planMediaRename adds the files of a media item to a rename.
+func (s *LibraryService) planMediaRename(
+	ctx context.Context,
+	rename *domain.Rename,
+	library *domain.Library,
+	media *models.Media,
+	episodes []*models.Episode,
+) error {
+	// Episodes sharing a file are renamed together, after all of them
+	byPath := make(map[string][]*models.Episode)
+	var paths []string
+	for _, ep := range episodes {
+		if ep.Path == "" {
+			continue
+		}
+		if _, ok := byPath[ep.Path]; !ok {
+			paths = append(paths, ep.Path)
+		}
+		byPath[ep.Path] = append(byPath[ep.Path], ep)
+	}
+
+	if len(paths) == 0 {
+		if media.FilePath == "" {
+			return nil
+		}
+		template, err := library.NamingRules().MovieTemplate()
+		if err != nil {
+			return errors.BadRequest(fmt.Sprintf("library %s: %v", library.Name, err))
+		}
+		values := domain.NamingValues{
+			Title:      media.Title,
+			Year:       media.Year,
+			Quality:    fileQuality(media.FilePath, media.Resolution),
+			Resolution: media.Resolution,
+			Codec:      media.Codec,
+		}
+		file := domain.LibraryFile{MediaID: media.ID, Path: media.FilePath}
+		return s.addRenamedFile(ctx, rename, library, template, values, file)
+	}
+
+	template, err := library.NamingRules().EpisodeTemplate()
+	if err != nil {
+		return errors.BadRequest(fmt.Sprintf("library %s: %v", library.Name, err))
+	}
+
+	// Formats name one file per episode, so split episodes are left alone
+	files, err := s.repo.ListEpisodeFiles(ctx, media.ID)
+	if err != nil {
+		return err
+	}
+	parts := make(map[uuid.UUID]int)
+	for _, file := range files {
+		parts[file.EpisodeID]++
+	}
+
+	sort.Strings(paths)
+	for _, path := range paths {
+		eps := byPath[path]
+		sort.SliceStable(eps, func(i, j int) bool { return eps[i].EpisodeNumber < eps[j].EpisodeNumber })
+
+		values := domain.NamingValues{
+			Title:    eps[0].Title,
+			Year:     media.Year,
+			Quality:  fileQuality(path, ""),
+			Series:   media.Title,
+			Season:   eps[0].SeasonNumber,
+			Absolute: eps[0].AbsoluteNumber,
+		}
+		for _, ep := range eps {
+			values.Episodes = append(values.Episodes, ep.EpisodeNumber)
+		}
+		for _, ep := range eps {
+			file := domain.LibraryFile{MediaID: media.ID, EpisodeID: &ep.ID, Path: path}
+			if parts[ep.ID] > 1 {
+				rename.AddRenamedFile(domain.RenamedFile{LibraryFile: file, Conflict: "episode is split across several files"})
+				continue
+			}
+			if err := s.addRenamedFile(ctx, rename, library, template, values, file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addRenamedFile adds a file to a rename unless its path does not change,
+// with a conflict if it cannot be renamed.
+func (s *LibraryService) addRenamedFile(
+	ctx context.Context,
+	rename *domain.Rename,
+	library *domain.Library,
+	template *domain.NamingTemplate,
+	values domain.NamingValues,
+	file domain.LibraryFile,
+) error {
+	renamed := domain.RenamedFile{LibraryFile: file}
+	newPath, err := domain.RenamePath(library.Path, template, values, file.Path)
+	if err != nil {
+		renamed.Conflict = err.Error()
+		rename.AddRenamedFile(renamed)
+		return nil
+	}
+	if newPath == file.Path {
+		return nil
+	}
+	renamed.NewPath = newPath
+
+	switch info, err := os.Stat(file.Path); {
+	case err != nil:
+		renamed.Conflict = "file not found"
+	default:
+		// Renames that only change case find the file itself
+		if existing, err := os.Lstat(newPath); err == nil && !os.SameFile(info, existing) {
+			renamed.Conflict = "a file already exists at the new path"
+		} else if other, err := s.repo.GetMediaByPath(ctx, newPath); err == nil && other.ID != file.MediaID {
+			renamed.Conflict = "another media item uses the new path"
+		} else if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	rename.AddRenamedFile(renamed)
+	return nil
+}
+
+// fileQuality returns the quality of a file from its probed resolution,
+// or else from its name.
+func fileQuality(path, resolution string) string {
+	if quality := domain.ResolutionQuality(resolution); quality != "" {
+		return quality
+	}
+	return domain.ParseFeedQuality(filepath.Base(path))
+}
+
+// renamedMove is a file moved by a rename.
+type renamedMove struct {
+	from, to string
+}
+
+// applyRename moves the files of a rename and points their media and
+// episodes at the new paths, moving the files back if either fails.
+func (s *LibraryService) applyRename(
+	ctx context.Context,
+	rename *domain.Rename,
+	libraries map[uuid.UUID]*domain.Library,
+) error {
+	var files []domain.RenamedFile
+	var moves []renamedMove
+	moving := make(map[string]bool)
+	for _, file := range rename.Files {
+		if file.Conflict != "" {
+			continue
+		}
+		files = append(files, file)
+		if !moving[file.Path] {
+			moving[file.Path] = true
+			moves = append(moves, renamedMove{from: file.Path, to: file.NewPath})
+		}
+	}
+	if len(files) == 0 {
+		task.Log(ctx, fmt.Sprintf("Nothing to rename, skipped %d files", rename.Conflicts))
+		return nil
+	}
+
+	var moved []renamedMove
+	for i, move := range moves {
+		if err := ctx.Err(); err != nil {
+			s.undoRenameMoves(moved)
+			task.Log(ctx, "Rename cancelled, moved files back")
+			return nil
+		}
+		if err := s.renameMove(move); err != nil {
+			s.undoRenameMoves(moved)
+			return err
+		}
+		moved = append(moved, move)
+		task.SetProgress(ctx, float64(i+1)/float64(len(moves)), fmt.Sprintf("Renamed %s", filepath.Base(move.to)))
+	}
+
+	// Bookkeeping must complete once the files are moved
+	ctx = context.WithoutCancel(ctx)
+
+	if err := s.repo.RenameFiles(ctx, files); err != nil {
+		s.undoRenameMoves(moved)
+		return err
+	}
+	rename.Applied = true
+
+	for _, move := range moved {
+		removeEmptyDirs(filepath.Dir(move.from), libraryRoot(libraries, move.from))
+	}
+
+	// Invalidate cache and publish events
+	updated := make(map[uuid.UUID]bool)
+	for _, file := range files {
+		if updated[file.MediaID] {
+			continue
+		}
+		updated[file.MediaID] = true
+		_ = s.cache.Delete(ctx, "media:"+file.MediaID.String())
+		if media, err := s.repo.GetMedia(ctx, file.MediaID); err == nil {
+			s.eventBus.PublishAsync(ctx, domain.NewMediaUpdatedEvent(media))
+		}
+	}
+
+	s.logger.Info("Media files renamed",
+		interfaces.Int("files", len(moved)),
+		interfaces.Int("media", len(updated)),
+		interfaces.Int("skipped", rename.Conflicts))
+	task.Log(ctx, fmt.Sprintf("Renamed %d files, skipped %d", len(moved), rename.Conflicts))
+	return nil
+}
+
+// renameMove moves a file to its new path, refusing to overwrite another
+// file.
+func (s *LibraryService) renameMove(move renamedMove) error {
+	if err := os.MkdirAll(filepath.Dir(move.to), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", move.to, err)
+	}
+	info, err := os.Stat(move.from)
+	if err != nil {
+		return fmt.Errorf("failed to rename %s: %w", move.from, err)
+	}
+	if existing, err := os.Lstat(move.to); err == nil && !os.SameFile(info, existing) {
+		return errors.Conflict("a file already exists at " + move.to)
+	}
+	return moveFile(move.from, move.to)
+}
+
+// undoRenameMoves moves renamed files back, latest first.
+func (s *LibraryService) undoRenameMoves(moved []renamedMove) {
+	for i := len(moved) - 1; i >= 0; i-- {
+		if err := moveFile(moved[i].to, moved[i].from); err != nil {
+			s.logger.Error("Failed to move file back after failed rename",
+				interfaces.String("path", moved[i].to),
+				interfaces.String("original", moved[i].from),
+				interfaces.Error(err))
+		}
+	}
+}
+
+// libraryRoot returns the path of the library holding path.
+func libraryRoot(libraries map[uuid.UUID]*domain.Library, path string) string {
+	for _, library := range libraries {
+		if _, ok := domain.RelocatePath(path, library.Path, library.Path); ok {
+			return filepath.Clean(library.Path)
+		}
+	}
+	return ""
+}
+
+// removeEmptyDirs removes dir and its parents while they are empty, up to
+// but not including root.
+func removeEmptyDirs(dir, root string) {
+	for root != "" && dir != root && strings.HasPrefix(dir, root+"/") {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// WithReplaceRules sets whether imports replace the file of an item that
+// has one, and the recycle bin replaced files are moved to. An empty bin
+// keeps them in a hidden directory of their library.
+func (s *LibraryService) WithReplaceRules(rules domain.ReplaceRules, recycleBin string) *LibraryService {
+	s.replaceRules = rules
+	s.recycleBin = recycleBin
+	return s
+}
+
+// CompareFile compares a file with the file a media item has, and says
+// whether the replace rules would replace it.
+func (s *LibraryService) CompareFile(
+	ctx context.Context,
+	mediaID uuid.UUID,
+	source string,
+) (*domain.FileComparison, error) {
+	media, library, err := s.replaceTarget(ctx, mediaID, source)
+	if err != nil {
+		return nil, err
+	}
+	return s.compareFile(library, media, source)
+}
+
+// ReplaceFile replaces the file of a media item with another, whatever
+// the replace rules say. The file is placed in the library with the import
+// mode of its download client, and the old file is moved to the recycle
+// bin. The item keeps its ID, so its watch state is kept.
+func (s *LibraryService) ReplaceFile(
+	ctx context.Context,
+	mediaID uuid.UUID,
+	source, downloadClient string,
+) (*models.Media, *domain.FileComparison, error) {
+	media, library, err := s.replaceTarget(ctx, mediaID, source)
+	if err != nil {
+		return nil, nil, err
+	}
+	comparison, err := s.compareFile(library, media, source)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	place := func() (string, error) {
+		path, _, err := s.placeDownload(source, downloadClient, library)
+		return path, err
+	}
+	if err := s.importReplacing(ctx, library, media, source, place, "file replaced"); err != nil {
+		return nil, nil, err
+	}
+	return media, comparison, nil
+}
+
+func (s *LibraryService) replaceTarget(
+	ctx context.Context,
+	mediaID uuid.UUID,
+	source string,
+) (*models.Media, *domain.Library, error) {
+	if source == "" {
+		return nil, nil, errors.BadRequest("file path is required")
+	}
+	if !filepath.IsAbs(source) {
+		return nil, nil, errors.BadRequest("file path must be absolute")
+	}
+	if !pathExists(source) {
+		return nil, nil, errors.NotFound(fmt.Sprintf("%s does not exist", source))
+	}
+
+	media, err := s.repo.GetMedia(ctx, mediaID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if media.FilePath == source {
+		return nil, nil, errors.BadRequest("file is the current file of the media item")
+	}
+	library, err := s.repo.GetLibrary(ctx, media.LibraryID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return media, library, nil
+}
+
+// compareFile compares a file with the file of a media item in a library.
+func (s *LibraryService) compareFile(
+	library *domain.Library,
+	media *models.Media,
+	source string,
+) (*domain.FileComparison, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	comparison := s.replaceRules.Compare(
+		domain.FilePropertiesOf(media),
+		domain.ParseFileProperties(source, info.Size()),
+		library.QualityCutoff,
+	)
+	return &comparison, nil
+}
+
+// hasOtherFile reports whether a media item has a file on disk other than
+// the given paths of a file being imported for it.
+func hasOtherFile(media *models.Media, paths ...string) bool {
+	if media.FilePath == "" {
+		return false
+	}
+	for _, path := range paths {
+		if media.FilePath == path {
+			return false
+		}
+	}
+	return pathExists(media.FilePath)
+}
+
+// importReplacing imports a file for a media item that has one. The old
+// file is moved to the recycle bin, the new one placed with place, and the
+// item pointed at it; an old file that is the target of the new one is
+// thus out of the way. If the new file cannot be placed, the old one is
+// put back.
+func (s *LibraryService) importReplacing(
+	ctx context.Context,
+	library *domain.Library,
+	media *models.Media,
+	source string,
+	place func() (string, error),
+	reason string,
+) error {
+	previous := media.FilePath
+	recycled := domain.RecyclePath(s.recycleBin, library, previous, time.Now())
+	if err := os.MkdirAll(filepath.Dir(recycled), 0o755); err != nil {
+		return fmt.Errorf("failed to create recycle bin: %w", err)
+	}
+	if err := moveFile(previous, recycled); err != nil {
+		return err
+	}
+
+	path, err := place()
+	if err != nil {
+		if restoreErr := moveFile(recycled, previous); restoreErr != nil {
+			s.logger.Error("Failed to restore replaced file",
+				interfaces.String("media_id", media.ID.String()),
+				interfaces.String("path", previous),
+				interfaces.String("recycled_path", recycled),
+				interfaces.Error(restoreErr))
+		}
+		return err
+	}
+
+	// Probed properties described the old file
+	file := domain.ParseFileProperties(source, 0)
+	media.Resolution = file.Quality
+	media.Codec = file.Codec
+	media.Bitrate = 0
+	if err := s.applyImport(ctx, library, media.ID, media, path, reason); err != nil {
+		return err
+	}
+
+	s.eventBus.PublishAsync(ctx, domain.NewMediaFileReplacedEvent(media, previous, recycled))
+	s.logger.Info("Media file replaced",
+		interfaces.String("media_id", media.ID.String()),
+		interfaces.String("path", path),
+		interfaces.String("previous_path", previous),
+		interfaces.String("recycled_path", recycled))
+	return nil
+}
@@ -0,0 +1,511 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/constants"
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+	"github.com/narwhalmedia/narwhal/pkg/task"
+	"github.com/narwhalmedia/narwhal/pkg/workerpool"
+)
+
+// Types of the tasks the library service runs.
+const (
+	TaskTypeLibraryScan     = "library.scan"
+	TaskTypeWorkflowArchive = "workflow.archive"
+	TaskTypeMediaRename     = "media.rename"
+	TaskTypeMediaPrune      = "media.prune"
+	TaskTypePruneAdvice     = "library.prune_advice"
+)
+
+// ScanLimits bounds the resources library scans may use.
+type ScanLimits struct {
+	// MaxConcurrentScans is the number of libraries scanned at once. Further
+	// scans wait for a free slot.
+	MaxConcurrentScans int
+	// Workers is the number of goroutines processing files per scan.
+	Workers int
+	// BatchSize is the number of files read and written per database round trip.
+	BatchSize int
+}
+
+// DefaultScanLimits returns the default scan limits.
+func DefaultScanLimits() ScanLimits {
+	return ScanLimits{
+		MaxConcurrentScans: constants.DefaultMaxConcurrentScans,
+		Workers:            constants.DefaultScanWorkers,
+		BatchSize:          constants.DefaultScanBatchSize,
+	}
+}
+
+// WithScanLimits sets the scan limits. Non-positive values fall back to the
+// defaults. It must be called before any scan is started; afterwards, use
+// ResizeWorkerPool.
+func (s *LibraryService) WithScanLimits(limits ScanLimits) *LibraryService {
+	defaults := DefaultScanLimits()
+	if limits.MaxConcurrentScans <= 0 {
+		limits.MaxConcurrentScans = defaults.MaxConcurrentScans
+	}
+	if limits.Workers <= 0 {
+		limits.Workers = defaults.Workers
+	}
+	if limits.BatchSize <= 0 {
+		limits.BatchSize = defaults.BatchSize
+	}
+
+	s.scanLimits = limits
+	s.scanSlots = workerpool.NewLimiter(limits.MaxConcurrentScans)
+	s.scanWorkers.Store(int32(limits.Workers))
+	return s
+}
+
+// Stop cancels running scans and other tasks and waits for them to finish.
+func (s *LibraryService) Stop() {
+	s.tasks.Stop()
+}
+
+// Tasks returns the manager running the service's background work.
+func (s *LibraryService) Tasks() *task.Manager {
+	return s.tasks
+}
+
+// ScanMetrics returns the metrics of the latest scan of each library.
+func (s *LibraryService) ScanMetrics() []domain.ScanMetrics {
+	s.metricsMu.RLock()
+	defer s.metricsMu.RUnlock()
+
+	metrics := make([]domain.ScanMetrics, 0, len(s.scanMetrics))
+	for _, m := range s.scanMetrics {
+		metrics = append(metrics, m)
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].LibraryID.String() < metrics[j].LibraryID.String()
+	})
+	return metrics
+}
+
+// recordScanMetrics records the metrics of a scan. processing is the time
+// spent processing the files the scan found, which is when media rows are
+// written.
+func (s *LibraryService) recordScanMetrics(
+	result *domain.ScanResult,
+	duration, processing time.Duration,
+	cancelled bool,
+) {
+	metrics := domain.ScanMetrics{
+		LibraryID:    result.LibraryID,
+		FilesScanned: result.FilesScanned,
+		Errors:       result.Errors,
+		Duration:     duration,
+		RowsWritten:  result.RowsWritten,
+		Cancelled:    cancelled,
+		CompletedAt:  time.Now(),
+	}
+	if duration > 0 {
+		metrics.FilesPerSecond = float64(result.FilesScanned) / duration.Seconds()
+	}
+	if processing > 0 {
+		metrics.RowsPerSecond = float64(result.RowsWritten) / processing.Seconds()
+	}
+
+	s.metricsMu.Lock()
+	s.scanMetrics[result.LibraryID] = metrics
+	s.metricsMu.Unlock()
+}
+
+// scanLibraryFiles lists the media files of a library under its scan rules.
+func (s *LibraryService) scanLibraryFiles(
+	library *domain.Library,
+	previous domain.ScanManifest,
+) (*domain.IncrementalScan, error) {
+	rules, err := domain.NewScanRules(library)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.scanner.ScanDirectoryIncremental(library.Path, library.Type, rules, previous)
+}
+
+// processScanFiles processes the main media files, then the extras, which
+// need their parent media to exist.
+func (s *LibraryService) processScanFiles(
+	ctx context.Context,
+	library *domain.Library,
+	files []*domain.MediaFile,
+	result *domain.ScanResult,
+) {
+	main, extras := splitExtras(files)
+	s.processScanBatches(ctx, library, main, nil, result)
+	if len(extras) == 0 || ctx.Err() != nil {
+		return
+	}
+
+	s.processScanBatches(ctx, library, extras, s.resolveExtraParents(ctx, library, extras), result)
+}
+
+// splitExtras separates the main media files from the extras.
+func splitExtras(files []*domain.MediaFile) (main, extras []*domain.MediaFile) {
+	for _, file := range files {
+		if file.Extra != "" {
+			extras = append(extras, file)
+		} else {
+			main = append(main, file)
+		}
+	}
+	return main, extras
+}
+
+// extraParentKey identifies the parent of an extra: the directory of the
+// parent media and, for episode extras, the episode tag or, in anime
+// libraries, the absolute episode number.
+type extraParentKey struct {
+	dir      string
+	season   int
+	episode  int
+	absolute int
+}
+
+// extraParent is the media, and episode, an extra is attached to.
+type extraParent struct {
+	mediaID   uuid.UUID
+	episodeID *uuid.UUID
+}
+
+// newExtraParentKey returns the parent key of an extra. Extras of files
+// holding two episodes belong to the first.
+func newExtraParentKey(library *domain.Library, file *domain.MediaFile) extraParentKey {
+	key := extraParentKey{dir: file.ParentDir}
+	numbers, ok := domain.ParseEpisodeNumbers(filepath.Base(file.Path), library.Anime)
+	switch {
+	case !ok:
+	case len(numbers.Episodes) > 0:
+		key.season, key.episode = numbers.Season, numbers.Episodes[0]
+	default:
+		key.absolute = numbers.Absolute[0]
+	}
+	return key
+}
+
+// resolveExtraParents finds the parent media of extras. Extras tagged with
+// an episode, such as "S01E02-deleted.mkv", belong to the media file of that
+// episode, or to the episode of a series; extras with an absolute number in
+// anime libraries belong to the episode of a series with that number. Other
+// extras belong to the main media of their parent directory. Extras without
+// a parent are added unattached.
+func (s *LibraryService) resolveExtraParents(
+	ctx context.Context,
+	library *domain.Library,
+	extras []*domain.MediaFile,
+) map[extraParentKey]extraParent {
+	parents := make(map[extraParentKey]extraParent)
+	for _, file := range extras {
+		key := newExtraParentKey(library, file)
+		if _, ok := parents[key]; ok {
+			continue
+		}
+
+		parent, err := s.findExtraParent(ctx, library, key)
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				s.logger.Warn("Failed to find parent media of extras",
+					interfaces.String("dir", file.ParentDir),
+					interfaces.Error(err))
+			}
+			parents[key] = extraParent{}
+			continue
+		}
+		parents[key] = parent
+	}
+
+	return parents
+}
+
+func (s *LibraryService) findExtraParent(
+	ctx context.Context,
+	library *domain.Library,
+	key extraParentKey,
+) (extraParent, error) {
+	if key.season == 0 && key.episode == 0 && key.absolute == 0 {
+		media, err := s.repo.GetMainMediaInDirectory(ctx, library.ID, key.dir, "")
+		if err != nil {
+			return extraParent{}, err
+		}
+		return extraParent{mediaID: media.ID}, nil
+	}
+
+	// The episode's own media file
+	if key.absolute == 0 {
+		tag := fmt.Sprintf("S%02dE%02d", key.season, key.episode)
+		media, err := s.repo.GetMainMediaInDirectory(ctx, library.ID, key.dir, tag)
+		if err == nil {
+			return extraParent{mediaID: media.ID}, nil
+		}
+		if !errors.IsNotFound(err) {
+			return extraParent{}, err
+		}
+	}
+
+	// The episode of the series in the directory
+	media, err := s.repo.GetMainMediaInDirectory(ctx, library.ID, key.dir, "")
+	if err != nil {
+		return extraParent{}, err
+	}
+	parent := extraParent{mediaID: media.ID}
+	episode, err := s.findParentEpisode(ctx, media.ID, key)
+	if err == nil {
+		parent.episodeID = &episode.ID
+	} else if !errors.IsNotFound(err) {
+		return extraParent{}, err
+	}
+	return parent, nil
+}
+
+// findParentEpisode finds the episode of a series an extra belongs to.
+// Absolute numbers are mapped to the season numbering of the series.
+func (s *LibraryService) findParentEpisode(
+	ctx context.Context,
+	mediaID uuid.UUID,
+	key extraParentKey,
+) (*models.Episode, error) {
+	if key.absolute == 0 {
+		return s.repo.GetEpisodeByNumber(ctx, mediaID, key.season, key.episode)
+	}
+
+	episodes, err := s.repo.ListEpisodesByMedia(ctx, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	episode, ok := domain.NewEpisodeMap(episodes).Episode(key.absolute)
+	if !ok {
+		return nil, errors.NotFound("episode not found")
+	}
+	return episode, nil
+}
+
+// processScanBatches fans batches of files out to the scan workers. Batches
+// are handed over unbuffered, so the directory listing is only consumed as
+// fast as the workers can write to the database. Workers are added when
+// the pool grows, and leave after their current batch when it shrinks.
+// Processing stops when ctx is cancelled.
+func (s *LibraryService) processScanBatches(
+	ctx context.Context,
+	library *domain.Library,
+	files []*domain.MediaFile,
+	parents map[extraParentKey]extraParent,
+	result *domain.ScanResult,
+) {
+	batches := make(chan []*domain.MediaFile)
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		workers atomic.Int32
+	)
+
+	work := func() {
+		defer wg.Done()
+		defer s.activeScanWorkers.Add(-1)
+		for batch := range batches {
+			added, updated, failed := s.processScanBatch(ctx, library, batch, parents)
+
+			mu.Lock()
+			result.FilesAdded += added
+			result.FilesUpdated += updated
+			result.RowsWritten += added + updated
+			result.Errors += failed
+			result.FilesScanned += len(batch)
+			if result.FilesFound > 0 {
+				task.SetProgress(ctx, float64(result.FilesScanned)/float64(result.FilesFound),
+					fmt.Sprintf("Scanned %d of %d files", result.FilesScanned, result.FilesFound))
+			}
+			mu.Unlock()
+
+			// Leave if the pool shrank below the workers of this scan
+			for {
+				n := workers.Load()
+				if n <= s.scanWorkers.Load() {
+					break
+				}
+				if workers.CompareAndSwap(n, n-1) {
+					return
+				}
+			}
+		}
+	}
+
+feed:
+	for start := 0; start < len(files); start += s.scanLimits.BatchSize {
+		for workers.Load() < s.scanWorkers.Load() {
+			workers.Add(1)
+			s.activeScanWorkers.Add(1)
+			wg.Add(1)
+			go work()
+		}
+
+		end := min(start+s.scanLimits.BatchSize, len(files))
+		select {
+		case batches <- files[start:end]:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(batches)
+	wg.Wait()
+}
+
+// processScanBatch creates media for new files and updates media whose file
+// changed or reappeared. Extras are attached to their parent media. It
+// returns the number of added, updated and failed files.
+func (s *LibraryService) processScanBatch(
+	ctx context.Context,
+	library *domain.Library,
+	files []*domain.MediaFile,
+	parents map[extraParentKey]extraParent,
+) (int, int, int) {
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = file.Path
+	}
+
+	existing, err := s.repo.GetMediaByPaths(ctx, paths)
+	if err != nil {
+		s.logger.Error("Failed to look up scanned media",
+			interfaces.String("library_id", library.ID.String()),
+			interfaces.Error(err))
+		return 0, 0, len(files)
+	}
+
+	var created, updated []*models.Media
+	for _, file := range files {
+		parent := parents[newExtraParentKey(library, file)]
+
+		media, ok := existing[file.Path]
+		if !ok {
+			created = append(created, newScannedMedia(library, file, parent))
+			continue
+		}
+
+		changed := false
+		for _, reason := range scanUpdates(media, file, parent) {
+			switch reason {
+			case domain.ScanUpdateAttached:
+				attachExtra(media, file, parent)
+				changed = true
+			case domain.ScanUpdateReappeared:
+				if s.transitionMedia(ctx, media, models.MediaStatusAvailable, "file found during scan") == nil {
+					changed = true
+				}
+			case domain.ScanUpdateModified:
+				modified := file.Modified
+				media.Size = file.Size
+				media.Modified = modified
+				media.FileSize = file.Size
+				media.FileModifiedAt = &modified
+				media.LastScanned = time.Now()
+				changed = true
+			}
+		}
+
+		if changed {
+			updated = append(updated, media)
+		}
+	}
+
+	// New and changed media are written in one round trip
+	if len(created)+len(updated) > 0 {
+		rows := make([]*models.Media, 0, len(created)+len(updated))
+		rows = append(rows, created...)
+		rows = append(rows, updated...)
+		if _, err := s.repo.UpsertMediaBatch(ctx, rows); err != nil {
+			s.logger.Error("Failed to write media",
+				interfaces.String("library_id", library.ID.String()),
+				interfaces.Int("count", len(rows)),
+				interfaces.Error(err))
+			return 0, 0, len(rows)
+		}
+	}
+
+	// Publish media added events
+	for _, media := range created {
+		s.eventBus.PublishAsync(ctx, domain.NewMediaAddedEvent(media))
+	}
+	for _, media := range updated {
+		_ = s.cache.Delete(ctx, "media:"+media.ID.String())
+	}
+
+	return len(created), len(updated), 0
+}
+
+// scanUpdates returns why a scan updates the media item of a file, in the
+// order the updates are applied. Extras found before their parent media
+// are attached once it exists, files that reappear are available again and
+// modified files are stat'ed again.
+func scanUpdates(media *models.Media, file *domain.MediaFile, parent extraParent) []string {
+	var reasons []string
+	if file.Extra != "" && parent.mediaID != uuid.Nil && media.ParentID == nil {
+		reasons = append(reasons, domain.ScanUpdateAttached)
+	}
+	if models.MediaStatus(media.Status) == models.MediaStatusMissing {
+		reasons = append(reasons, domain.ScanUpdateReappeared)
+	}
+	if file.Modified.After(media.Modified) {
+		reasons = append(reasons, domain.ScanUpdateModified)
+	}
+	return reasons
+}
+
+// attachExtra marks media as an extra of its parent.
+func attachExtra(media *models.Media, file *domain.MediaFile, parent extraParent) {
+	media.ExtraType = string(file.Extra)
+	if parent.mediaID != uuid.Nil {
+		media.ParentID = &parent.mediaID
+		media.EpisodeID = parent.episodeID
+	}
+}
+
+func newScannedMedia(library *domain.Library, file *domain.MediaFile, parent extraParent) *models.Media {
+	now := time.Now()
+	modified := file.Modified
+	media := &models.Media{
+		ID:             uuid.New(),
+		TenantID:       library.TenantID,
+		LibraryID:      library.ID,
+		Title:          domain.ExtractTitle(library.TitlePath(file.Path)),
+		Type:           models.MediaType(library.Type),
+		Path:           file.Path,
+		Size:           file.Size,
+		Added:          now,
+		Modified:       modified,
+		LastScanned:    now,
+		Status:         string(models.MediaStatusPending),
+		FilePath:       file.Path,
+		FileSize:       file.Size,
+		FileModifiedAt: &modified,
+	}
+	switch models.MediaType(library.Type) {
+	case models.MediaTypeMusicVideo:
+		info := domain.ParseMusicVideo(library.Path, file.Path)
+		media.Title = info.Title
+		media.Year = info.Year
+		media.Artist = info.Artist
+		if info.Concert {
+			media.Tags = []string{domain.MusicVideoTagConcert}
+		}
+	case models.MediaTypeMusic:
+		media.Artist = domain.TrackArtist(library.Path, file.Path)
+	}
+	if file.Extra != "" {
+		attachExtra(media, file, parent)
+	}
+	return media
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// PreviewScan walks a library like a full scan and reports the media a scan
+// would add and update, and the known files it no longer finds, without
+// writing anything. Added files come with the title parsed from their name
+// and the library items they may be a file of, so naming and parser
+// settings can be checked before scanning. Files out of place for the
+// library's folder profile are reported in the summary.
+//
+// Changes are passed to emit as they are found; an error from emit stops
+// the preview and is returned. Extras of media the scan would add are
+// reported without their parent, which does not exist yet.
+func (s *LibraryService) PreviewScan(
+	ctx context.Context,
+	id uuid.UUID,
+	emit func(*domain.ScanChange) error,
+) (*domain.ScanPreview, error) {
+	library, err := s.repo.GetLibrary(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Previews walk the file system like scans, so they share their slots
+	if err := s.scanSlots.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer s.scanSlots.Release()
+
+	scan, err := s.scanLibraryFiles(library, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &domain.ScanPreview{FilesFound: len(scan.Files)}
+	preview.SetLayoutMismatches(library.CheckLayout(scan.Files))
+	report := func(change *domain.ScanChange) error {
+		preview.Count(change)
+		return emit(change)
+	}
+
+	main, extras := splitExtras(scan.Files)
+	if err := s.previewScanFiles(ctx, library, main, nil, report); err != nil {
+		return nil, err
+	}
+	if len(extras) > 0 {
+		parents := s.resolveExtraParents(ctx, library, extras)
+		if err := s.previewScanFiles(ctx, library, extras, parents, report); err != nil {
+			return nil, err
+		}
+	}
+
+	// Files the walk did not find, such as deleted files or files the scan
+	// rules now exclude
+	found := make(map[string]bool, len(scan.Files))
+	for _, file := range scan.Files {
+		found[file.Path] = true
+	}
+	known, err := s.repo.ListLibraryFiles(ctx, library.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range known {
+		if found[file.Path] {
+			continue
+		}
+		if err := report(&domain.ScanChange{
+			Kind:      domain.ScanChangeRemoved,
+			Path:      file.Path,
+			MediaID:   file.MediaID,
+			EpisodeID: file.EpisodeID,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	s.logger.Info("Library scan previewed",
+		interfaces.String("library_id", library.ID.String()),
+		interfaces.Int("files_found", preview.FilesFound),
+		interfaces.Int("added", preview.Added),
+		interfaces.Int("updated", preview.Updated),
+		interfaces.Int("removed", preview.Removed),
+		interfaces.Int("layout_mismatches", preview.LayoutMismatchCount))
+
+	return preview, nil
+}
+
+// previewScanFiles reports the changes a scan would make for files, looking
+// their media up in batches like the scan does.
+func (s *LibraryService) previewScanFiles(
+	ctx context.Context,
+	library *domain.Library,
+	files []*domain.MediaFile,
+	parents map[extraParentKey]extraParent,
+	report func(*domain.ScanChange) error,
+) error {
+	for start := 0; start < len(files); start += s.scanLimits.BatchSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		batch := files[start:min(start+s.scanLimits.BatchSize, len(files))]
+		paths := make([]string, len(batch))
+		for i, file := range batch {
+			paths[i] = file.Path
+		}
+		existing, err := s.repo.GetMediaByPaths(ctx, paths)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range batch {
+			var change *domain.ScanChange
+			if media, ok := existing[file.Path]; ok {
+				reasons := scanUpdates(media, file, parents[newExtraParentKey(library, file)])
+				if len(reasons) == 0 {
+					continue
+				}
+				change = domain.NewScanChange(library, domain.ScanChangeUpdated, file)
+				change.MediaID = media.ID
+				change.Reasons = reasons
+			} else {
+				change = domain.NewScanChange(library, domain.ScanChangeAdded, file)
+				if file.Extra == "" {
+					change.Candidates, err = s.importCandidates(ctx, library, change.Title, change.Year)
+					if err != nil {
+						return err
+					}
+				}
+			}
+
+			if err := report(change); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -2,6 +2,10 @@ package service
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,6 +16,10 @@ import (
 	"github.com/narwhalmedia/narwhal/pkg/errors"
 	"github.com/narwhalmedia/narwhal/pkg/interfaces"
 	"github.com/narwhalmedia/narwhal/pkg/models"
+	"github.com/narwhalmedia/narwhal/pkg/statemachine"
+	"github.com/narwhalmedia/narwhal/pkg/task"
+	"github.com/narwhalmedia/narwhal/pkg/tenant"
+	"github.com/narwhalmedia/narwhal/pkg/workerpool"
 )
 
 // LibraryService handles library business logic.
@@ -21,6 +29,41 @@ type LibraryService struct {
 	cache    interfaces.Cache
 	logger   interfaces.Logger
 	scanner  *domain.Scanner
+
+	mediaStatus *statemachine.Machine[models.MediaStatus]
+
+	scanLimits ScanLimits
+	scanSlots  *workerpool.Limiter
+	// scanWorkers is the number of workers per scan, and activeScanWorkers
+	// the number running across scans
+	scanWorkers       atomic.Int32
+	activeScanWorkers atomic.Int32
+	scanMetrics       map[uuid.UUID]domain.ScanMetrics
+	metricsMu         sync.RWMutex
+
+	// importFailures counts media that failed to import
+	importFailures atomic.Int64
+
+	// importModes picks how workflow imports place files in libraries, and
+	// importSpaceSaved counts the bytes their hardlinks did not duplicate
+	importModes      domain.ImportModes
+	importSpaceSaved atomic.Int64
+
+	// replaceRules decide whether imports replace the file of an item that
+	// has one, and recycleBin is where replaced files are kept
+	replaceRules domain.ReplaceRules
+	recycleBin   string
+
+	// malwareScanner checks downloads before they are imported, and
+	// quarantineDir is where infected files are moved to
+	malwareScanner domain.MalwareScanner
+	quarantineDir  string
+
+	// prunePolicy decides which titles are suggested for deletion
+	prunePolicy domain.PrunePolicy
+
+	// tasks runs scans and other background work
+	tasks *task.Manager
 }
 
 // NewLibraryService creates a new library service.
@@ -30,13 +73,17 @@ func NewLibraryService(
 	cache interfaces.Cache,
 	logger interfaces.Logger,
 ) *LibraryService {
-	return &LibraryService{
+	s := &LibraryService{
 		repo:     repo,
 		eventBus: eventBus,
 		cache:    cache,
 		logger:   logger,
 		scanner:  domain.NewScanner(logger),
 	}
+	s.mediaStatus = statemachine.New("media", models.MediaTransitions, eventBus, logger)
+	s.tasks = task.NewManager(repo, logger)
+	s.scanMetrics = make(map[uuid.UUID]domain.ScanMetrics)
+	return s.WithScanLimits(DefaultScanLimits())
 }
 
 // CreateLibrary creates a new media library.
@@ -45,6 +92,29 @@ func (s *LibraryService) CreateLibrary(ctx context.Context, library *domain.Libr
 	if library.Name == "" || library.Path == "" {
 		return errors.BadRequest("library name and path are required")
 	}
+	if library.ExtrasMode == "" {
+		library.ExtrasMode = domain.ExtrasModeSkip
+	}
+	if _, err := domain.NewScanRules(library); err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	if err := domain.ValidateQualityCutoff(library.QualityCutoff); err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	if err := library.Naming.Validate(); err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	if err := library.FolderProfile.Validate(library.Type); err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	if err := library.AudioNormalization.Validate(); err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	prefs, err := library.MetadataPreferences.Normalize()
+	if err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	library.MetadataPreferences = prefs
 
 	// Check if path already exists
 	existing, _ := s.repo.GetLibraryByPath(ctx, library.Path)
@@ -63,6 +133,17 @@ func (s *LibraryService) CreateLibrary(ctx context.Context, library *domain.Libr
 		return err
 	}
 
+	// Libraries of some types start with transcode policies, which can be
+	// changed or removed like any other
+	for _, policy := range domain.DefaultTranscodePolicies(library) {
+		if err := s.repo.CreateTranscodePolicy(ctx, policy); err != nil {
+			s.logger.Error("Failed to create default transcode policy",
+				interfaces.String("library_id", library.ID.String()),
+				interfaces.String("policy", policy.Name),
+				interfaces.Error(err))
+		}
+	}
+
 	// Publish event
 	s.eventBus.PublishAsync(ctx, domain.NewLibraryCreatedEvent(library))
 
@@ -126,11 +207,81 @@ func (s *LibraryService) UpdateLibrary(
 		library.ScanInterval = scanInterval
 	}
 
+	// Apply scan rule updates
+	rulesChanged := false
+	if patterns, ok := updates["exclude_patterns"].([]string); ok {
+		library.ExcludePatterns = patterns
+		rulesChanged = true
+	}
+	if mode, ok := updates["extras_mode"].(string); ok && mode != "" {
+		rulesChanged = rulesChanged || domain.ExtrasMode(mode) != library.ExtrasMode
+		library.ExtrasMode = domain.ExtrasMode(mode)
+	}
+	if ignore, ok := updates["ignore_extras_folders"].(bool); ok {
+		rulesChanged = rulesChanged || ignore != library.IgnoreExtrasFolders
+		library.IgnoreExtrasFolders = ignore
+	}
+	if _, err := domain.NewScanRules(library); err != nil {
+		return nil, errors.BadRequest(err.Error())
+	}
+	if cutoff, ok := updates["quality_cutoff"].(string); ok {
+		library.QualityCutoff = cutoff
+	}
+	if err := domain.ValidateQualityCutoff(library.QualityCutoff); err != nil {
+		return nil, errors.BadRequest(err.Error())
+	}
+	if language, ok := updates["metadata_language"].(string); ok {
+		library.MetadataPreferences.Language = language
+	}
+	if region, ok := updates["metadata_region"].(string); ok {
+		library.MetadataPreferences.Region = region
+	}
+	if style, ok := updates["title_style"].(string); ok && style != "" {
+		library.MetadataPreferences.TitleStyle = domain.TitleStyle(style)
+	}
+	if library.MetadataPreferences, err = library.MetadataPreferences.Normalize(); err != nil {
+		return nil, errors.BadRequest(err.Error())
+	}
+	if anime, ok := updates["anime"].(bool); ok {
+		library.Anime = anime
+	}
+	if format, ok := updates["movie_format"].(string); ok {
+		library.Naming.MovieFormat = format
+	}
+	if format, ok := updates["episode_format"].(string); ok {
+		library.Naming.EpisodeFormat = format
+	}
+	if err := library.Naming.Validate(); err != nil {
+		return nil, errors.BadRequest(err.Error())
+	}
+	if profile, ok := updates["folder_profile"].(string); ok {
+		library.FolderProfile = domain.FolderProfile(profile)
+	}
+	if err := library.FolderProfile.Validate(library.Type); err != nil {
+		return nil, errors.BadRequest(err.Error())
+	}
+	if normalization, ok := updates["audio_normalization"].(string); ok {
+		library.AudioNormalization = domain.AudioNormalization(normalization)
+	}
+	if err := library.AudioNormalization.Validate(); err != nil {
+		return nil, errors.BadRequest(err.Error())
+	}
+
 	// Update in repository
 	if err := s.repo.UpdateLibrary(ctx, library); err != nil {
 		return nil, err
 	}
 
+	// Unchanged directories may hold files the new rules pick up, so the
+	// next scan must not skip them
+	if rulesChanged {
+		if err := s.repo.SaveScanManifest(ctx, id, nil); err != nil {
+			s.logger.Warn("Failed to reset scan manifest",
+				interfaces.String("library_id", id.String()),
+				interfaces.Error(err))
+		}
+	}
+
 	// Invalidate cache
 	_ = s.cache.Delete(ctx, "library:"+id.String())
 
@@ -166,30 +317,48 @@ func (s *LibraryService) DeleteLibrary(ctx context.Context, id uuid.UUID) error
 	return nil
 }
 
-// ScanLibrary starts a library scan.
-func (s *LibraryService) ScanLibrary(ctx context.Context, id uuid.UUID) error {
+// ScanLibrary starts a library scan and returns the task running it. Scans
+// are incremental unless full is set: directories unchanged since the
+// previous scan are skipped.
+func (s *LibraryService) ScanLibrary(ctx context.Context, id uuid.UUID, full bool) (*task.Task, error) {
 	library, err := s.repo.GetLibrary(ctx, id)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Check if scan is already in progress
 	if s.scanner.IsScanning(id.String()) {
-		return errors.Conflict("scan already in progress")
-	}
-
-	// Start scan asynchronously
-	go s.performScan(context.Background(), library)
-
-	return nil
+		return nil, errors.Conflict("scan already in progress")
+	}
+
+	// Start scan asynchronously, scoped to the library's tenant. Scans are
+	// cancelled when the task is cancelled or the service stops.
+	payload := map[string]string{
+		"library_id": library.ID.String(),
+		"full":       strconv.FormatBool(full),
+	}
+	return s.tasks.Submit(
+		tenant.WithTenantID(ctx, library.TenantID),
+		TaskTypeLibraryScan,
+		payload,
+		func(ctx context.Context) error {
+			return s.performScan(ctx, library, full)
+		},
+	)
 }
 
 // performScan performs the actual library scan.
-func (s *LibraryService) performScan(ctx context.Context, library *domain.Library) {
+func (s *LibraryService) performScan(ctx context.Context, library *domain.Library, full bool) error {
 	// Mark library as scanning
 	s.scanner.SetScanning(library.ID.String(), true)
 	defer s.scanner.SetScanning(library.ID.String(), false)
 
+	// Wait for a scan slot
+	if err := s.scanSlots.Acquire(ctx); err != nil {
+		return nil
+	}
+	defer s.scanSlots.Release()
+
 	scanResult := &domain.ScanResult{
 		LibraryID: library.ID,
 		StartedAt: time.Now(),
@@ -198,15 +367,29 @@ func (s *LibraryService) performScan(ctx context.Context, library *domain.Librar
 	// Create scan history record
 	if err := s.repo.CreateScanHistory(ctx, scanResult); err != nil {
 		s.logger.Error("Failed to create scan history", interfaces.Error(err))
-		return
+		return err
 	}
 
 	s.logger.Info("Starting library scan",
 		interfaces.String("library_id", library.ID.String()),
-		interfaces.String("path", library.Path))
+		interfaces.String("path", library.Path),
+		interfaces.Bool("full", full),
+		interfaces.Int("workers", int(s.scanWorkers.Load())))
+
+	// Incremental scans skip directories unchanged since the previous scan
+	var previous domain.ScanManifest
+	if !full {
+		manifest, err := s.repo.GetScanManifest(ctx, library.ID)
+		if err != nil {
+			s.logger.Warn("Failed to load scan manifest, scanning all files",
+				interfaces.String("library_id", library.ID.String()),
+				interfaces.Error(err))
+		}
+		previous = manifest
+	}
 
 	// Scan for media files
-	files, err := s.scanner.ScanDirectory(library.Path, library.Type)
+	scan, err := s.scanLibraryFiles(library, previous)
 	if err != nil {
 		s.logger.Error("Library scan failed",
 			interfaces.String("library_id", library.ID.String()),
@@ -215,76 +398,72 @@ func (s *LibraryService) performScan(ctx context.Context, library *domain.Librar
 		scanResult.CompletedAt = timePtr(time.Now())
 		scanResult.ErrorMessage = err.Error()
 		_ = s.repo.UpdateScanHistory(ctx, scanResult)
-		return
-	}
-
-	// Process found files
-	for _, file := range files {
-		existing, _ := s.repo.GetMediaByPath(ctx, file.Path)
-
-		if existing != nil {
-			// Update existing media if file was modified
-			if file.Modified.After(existing.Modified) {
-				existing.Size = file.Size
-				existing.Modified = file.Modified
-				existing.LastScanned = time.Now()
-
-				if err := s.repo.UpdateMedia(ctx, existing); err != nil {
-					s.logger.Error("Failed to update media",
-						interfaces.String("path", file.Path),
-						interfaces.Error(err))
-					continue
-				}
-				scanResult.FilesUpdated++
-			}
-		} else {
-			// Create new media entry
-			media := &models.Media{
-				ID:          uuid.New(),
-				Title:       domain.ExtractTitle(file.Path),
-				Type:        models.MediaType(library.Type),
-				Path:        file.Path,
-				Size:        file.Size,
-				Added:       time.Now(),
-				Modified:    file.Modified,
-				LastScanned: time.Now(),
-			}
-
-			// Add library-specific fields
-			media.LibraryID = library.ID
-			media.Status = "pending"
-			media.FilePath = file.Path
-			media.FileSize = file.Size
-			media.FileModifiedAt = &file.Modified
+		return err
+	}
+	scanResult.FilesFound = len(scan.Files)
+	task.Log(ctx, fmt.Sprintf("Found %d files, skipped %d unchanged directories", len(scan.Files), scan.SkippedDirs))
 
-			if err := s.repo.CreateMedia(ctx, media); err != nil {
-				s.logger.Error("Failed to create media",
-					interfaces.String("path", file.Path),
+	// Files out of place for the folder profile are still scanned, but may
+	// be titled or renamed unexpectedly
+	if mismatches := library.CheckLayout(scan.Files); len(mismatches) > 0 {
+		s.logger.Warn("Library layout does not match its folder profile",
+			interfaces.String("library_id", library.ID.String()),
+			interfaces.String("folder_profile", string(library.FolderProfile)),
+			interfaces.Int("mismatches", len(mismatches)),
+			interfaces.String("example", mismatches[0].Path))
+		task.Log(ctx, fmt.Sprintf("%d files do not match the %s folder profile, such as %s: %s",
+			len(mismatches), library.FolderProfile, mismatches[0].Path, mismatches[0].Reason))
+	}
+
+	processStarted := time.Now()
+	s.processScanFiles(ctx, library, scan.Files, scanResult)
+	processing := time.Since(processStarted)
+
+	// Bookkeeping must complete even if the scan was cancelled
+	cancelled := ctx.Err() != nil
+	ctx = context.WithoutCancel(ctx)
+
+	if cancelled {
+		scanResult.ErrorMessage = "scan cancelled"
+	} else {
+		// Update library last scan time
+		now := time.Now()
+		library.LastScanAt = &now
+		_ = s.repo.UpdateLibrary(ctx, library)
+
+		// Files that failed to process must be seen again by the next scan,
+		// so the manifest is only kept when every file was processed
+		if scanResult.Errors == 0 {
+			if err := s.repo.SaveScanManifest(ctx, library.ID, scan.Manifest); err != nil {
+				s.logger.Error("Failed to save scan manifest",
+					interfaces.String("library_id", library.ID.String()),
 					interfaces.Error(err))
-				continue
 			}
-
-			// Publish media added event
-			s.eventBus.PublishAsync(ctx, domain.NewMediaAddedEvent(media))
-			scanResult.FilesAdded++
 		}
-
-		scanResult.FilesScanned++
 	}
 
-	// Update library last scan time
-	now := time.Now()
-	library.LastScanAt = &now
-	_ = s.repo.UpdateLibrary(ctx, library)
 	// Complete scan history
 	scanResult.CompletedAt = timePtr(time.Now())
+	duration := scanResult.CompletedAt.Sub(scanResult.StartedAt)
+	scanResult.Duration = duration.Milliseconds()
 	_ = s.repo.UpdateScanHistory(ctx, scanResult)
-	duration := time.Since(scanResult.StartedAt)
+	s.recordScanMetrics(scanResult, duration, processing, cancelled)
+
+	if cancelled {
+		s.logger.Warn("Library scan cancelled",
+			interfaces.String("library_id", library.ID.String()),
+			interfaces.Int("files_scanned", scanResult.FilesScanned),
+			interfaces.Int("files_found", scanResult.FilesFound))
+		return nil
+	}
+
 	s.logger.Info("Library scan completed",
 		interfaces.String("library_id", library.ID.String()),
 		interfaces.Int("files_scanned", scanResult.FilesScanned),
 		interfaces.Int("files_added", scanResult.FilesAdded),
 		interfaces.Int("files_updated", scanResult.FilesUpdated),
+		interfaces.Int("errors", scanResult.Errors),
+		interfaces.Int("skipped_dirs", scan.SkippedDirs),
 		interfaces.Any("duration", duration))
 
 	// Publish scan completed event
@@ -292,6 +471,9 @@ func (s *LibraryService) performScan(ctx context.Context, library *domain.Librar
 		ctx,
 		domain.NewLibraryScanCompletedEvent(library, scanResult.FilesAdded, scanResult.FilesUpdated),
 	)
+	task.Log(ctx, fmt.Sprintf("Added %d, updated %d, failed %d",
+		scanResult.FilesAdded, scanResult.FilesUpdated, scanResult.Errors))
+	return nil
 }
 
 // GetMedia retrieves a media item by ID.
@@ -315,6 +497,36 @@ func (s *LibraryService) GetMedia(ctx context.Context, id uuid.UUID) (*models.Me
 	return media, nil
 }
 
+// ListExtras lists the extras attached to a media item.
+func (s *LibraryService) ListExtras(ctx context.Context, mediaID uuid.UUID) ([]*models.Media, error) {
+	return s.repo.ListExtras(ctx, mediaID)
+}
+
+// ListEpisodes lists the episodes of a series. Episodes in anime libraries
+// are given their absolute numbers.
+func (s *LibraryService) ListEpisodes(ctx context.Context, mediaID uuid.UUID) ([]*models.Episode, error) {
+	media, err := s.GetMedia(ctx, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	library, err := s.GetLibrary(ctx, media.LibraryID)
+	if err != nil {
+		return nil, err
+	}
+
+	episodes, err := s.repo.ListEpisodesByMedia(ctx, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	if library.Anime {
+		numbering := domain.NewEpisodeMap(episodes)
+		for _, ep := range episodes {
+			ep.AbsoluteNumber = numbering.Absolute(ep.SeasonNumber, ep.EpisodeNumber)
+		}
+	}
+	return episodes, nil
+}
+
 // SearchMedia searches for media items.
 func (s *LibraryService) SearchMedia(
 	ctx context.Context,
@@ -356,6 +568,15 @@ func (s *LibraryService) UpdateMedia(
 	if releaseDate, ok := updates["release_date"].(time.Time); ok {
 		media.ReleaseDate = releaseDate
 	}
+	if digital, ok := updates["digital_release_date"].(*time.Time); ok {
+		media.DigitalReleaseDate = digital
+	}
+	if physical, ok := updates["physical_release_date"].(*time.Time); ok {
+		media.PhysicalReleaseDate = physical
+	}
+	if monitored, ok := updates["monitored"].(bool); ok {
+		media.Monitored = monitored
+	}
 	if genres, ok := updates["genres"].([]string); ok {
 		media.Genres = genres
 	}
@@ -377,6 +598,49 @@ func (s *LibraryService) UpdateMedia(
 	return media, nil
 }
 
+// SetMediaStatus moves a media item to a new status. Transitions the media
+// state machine does not allow are rejected with a conflict error.
+func (s *LibraryService) SetMediaStatus(
+	ctx context.Context,
+	id uuid.UUID,
+	status models.MediaStatus,
+	reason string,
+) (*models.Media, error) {
+	media, err := s.repo.GetMedia(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.transitionMedia(ctx, media, status, reason); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpdateMedia(ctx, media); err != nil {
+		return nil, err
+	}
+
+	// Invalidate cache
+	_ = s.cache.Delete(ctx, "media:"+id.String())
+
+	return media, nil
+}
+
+// transitionMedia applies a status change to media through the media state
+// machine. The caller persists the result.
+func (s *LibraryService) transitionMedia(
+	ctx context.Context,
+	media *models.Media,
+	to models.MediaStatus,
+	reason string,
+) error {
+	current := models.MediaStatus(media.Status)
+	if err := s.mediaStatus.Transition(ctx, media.ID.String(), &current, to, reason); err != nil {
+		return err
+	}
+	media.Status = string(current)
+	return nil
+}
+
 // DeleteMedia deletes a media item.
 func (s *LibraryService) DeleteMedia(ctx context.Context, id uuid.UUID) error {
 	// Check if media exists
@@ -385,6 +649,18 @@ func (s *LibraryService) DeleteMedia(ctx context.Context, id uuid.UUID) error {
 		return err
 	}
 
+	// Extras go with their parent media
+	extras, err := s.repo.ListExtras(ctx, id)
+	if err != nil {
+		return err
+	}
+	for _, extra := range extras {
+		if err := s.repo.DeleteMedia(ctx, extra.ID); err != nil {
+			return err
+		}
+		_ = s.cache.Delete(ctx, "media:"+extra.ID.String())
+	}
+
 	// Delete media
 	if err := s.repo.DeleteMedia(ctx, id); err != nil {
 		return err
@@ -394,7 +670,7 @@ func (s *LibraryService) DeleteMedia(ctx context.Context, id uuid.UUID) error {
 	_ = s.cache.Delete(ctx, "media:"+id.String())
 
 	// Publish event
-	s.eventBus.PublishAsync(ctx, domain.NewMediaDeletedEvent(id.String()))
+	s.eventBus.PublishAsync(ctx, domain.NewMediaDeletedEvent(id.String(), media.LibraryID))
 
 	s.logger.Info("Media deleted",
 		interfaces.String("id", id.String()),
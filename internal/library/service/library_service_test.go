@@ -2,6 +2,11 @@ package service_test
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -12,10 +17,16 @@ import (
 	"github.com/narwhalmedia/narwhal/internal/library/domain"
 	"github.com/narwhalmedia/narwhal/internal/library/repository"
 	"github.com/narwhalmedia/narwhal/internal/library/service"
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/downloadclient"
 	"github.com/narwhalmedia/narwhal/pkg/errors"
 	"github.com/narwhalmedia/narwhal/pkg/events"
 	"github.com/narwhalmedia/narwhal/pkg/logger"
 	"github.com/narwhalmedia/narwhal/pkg/models"
+	"github.com/narwhalmedia/narwhal/pkg/saga"
+	"github.com/narwhalmedia/narwhal/pkg/task"
+	"github.com/narwhalmedia/narwhal/pkg/tenant"
+	"github.com/narwhalmedia/narwhal/pkg/testing/fake"
 	"github.com/narwhalmedia/narwhal/pkg/utils"
 	"github.com/narwhalmedia/narwhal/test/testutil"
 )
@@ -85,6 +96,49 @@ func (m *MockLibraryRepository) GetMediaByPath(ctx context.Context, path string)
 	return args.Get(0).(*models.Media), args.Error(1)
 }
 
+func (m *MockLibraryRepository) GetMediaByPaths(ctx context.Context, paths []string) (map[string]*models.Media, error) {
+	args := m.Called(ctx, paths)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]*models.Media), args.Error(1)
+}
+
+func (m *MockLibraryRepository) GetMainMediaInDirectory(
+	ctx context.Context,
+	libraryID uuid.UUID,
+	dir, nameContains string,
+) (*models.Media, error) {
+	args := m.Called(ctx, libraryID, dir, nameContains)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Media), args.Error(1)
+}
+
+func (m *MockLibraryRepository) ListExtras(ctx context.Context, parentID uuid.UUID) ([]*models.Media, error) {
+	args := m.Called(ctx, parentID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Media), args.Error(1)
+}
+
+func (m *MockLibraryRepository) CreateMediaBatch(ctx context.Context, media []*models.Media) error {
+	args := m.Called(ctx, media)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) UpdateMediaBatch(ctx context.Context, media []*models.Media) error {
+	args := m.Called(ctx, media)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) UpsertMediaBatch(ctx context.Context, media []*models.Media) (int, error) {
+	args := m.Called(ctx, media)
+	return args.Int(0), args.Error(1)
+}
+
 func (m *MockLibraryRepository) UpdateMedia(ctx context.Context, media *models.Media) error {
 	args := m.Called(ctx, media)
 	return args.Error(0)
@@ -108,6 +162,27 @@ func (m *MockLibraryRepository) ListMediaByLibrary(
 	return args.Get(0).([]*models.Media), args.Error(1)
 }
 
+func (m *MockLibraryRepository) ListMediaAddedSince(
+	ctx context.Context,
+	since time.Time,
+	libraryIDs []uuid.UUID,
+	limit int,
+) ([]*models.Media, error) {
+	args := m.Called(ctx, since, libraryIDs, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Media), args.Error(1)
+}
+
+func (m *MockLibraryRepository) ListMediaByArtist(ctx context.Context, artist string) ([]*models.Media, error) {
+	args := m.Called(ctx, artist)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Media), args.Error(1)
+}
+
 func (m *MockLibraryRepository) SearchMedia(
 	ctx context.Context,
 	query string,
@@ -141,6 +216,23 @@ func (m *MockLibraryRepository) GetLatestScan(ctx context.Context, libraryID uui
 	return args.Get(0).(*domain.ScanResult), args.Error(1)
 }
 
+func (m *MockLibraryRepository) GetScanManifest(ctx context.Context, libraryID uuid.UUID) (domain.ScanManifest, error) {
+	args := m.Called(ctx, libraryID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(domain.ScanManifest), args.Error(1)
+}
+
+func (m *MockLibraryRepository) SaveScanManifest(
+	ctx context.Context,
+	libraryID uuid.UUID,
+	manifest domain.ScanManifest,
+) error {
+	args := m.Called(ctx, libraryID, manifest)
+	return args.Error(0)
+}
+
 // Episode methods.
 func (m *MockLibraryRepository) CreateEpisode(ctx context.Context, episode *models.Episode) error {
 	args := m.Called(ctx, episode)
@@ -197,6 +289,23 @@ func (m *MockLibraryRepository) DeleteEpisode(ctx context.Context, id uuid.UUID)
 	return args.Error(0)
 }
 
+func (m *MockLibraryRepository) ListEpisodeFiles(ctx context.Context, mediaID uuid.UUID) ([]*models.EpisodeFile, error) {
+	args := m.Called(ctx, mediaID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.EpisodeFile), args.Error(1)
+}
+
+func (m *MockLibraryRepository) SetEpisodeFiles(
+	ctx context.Context,
+	episodeID uuid.UUID,
+	files []*models.EpisodeFile,
+) error {
+	args := m.Called(ctx, episodeID, files)
+	return args.Error(0)
+}
+
 // MetadataProvider methods.
 func (m *MockLibraryRepository) CreateProvider(ctx context.Context, provider *domain.MetadataProviderConfig) error {
 	args := m.Called(ctx, provider)
@@ -244,344 +353,3493 @@ func (m *MockLibraryRepository) DeleteProvider(ctx context.Context, id uuid.UUID
 	return args.Error(0)
 }
 
-// Implement other required methods...
-func (m *MockLibraryRepository) BeginTx(ctx context.Context) (repository.Repository, error) {
-	args := m.Called(ctx)
+func (m *MockLibraryRepository) ListWatchStatesByMedia(
+	ctx context.Context,
+	mediaID uuid.UUID,
+) ([]*models.WatchHistory, error) {
+	args := m.Called(ctx, mediaID)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).(repository.Repository), args.Error(1)
+	return args.Get(0).([]*models.WatchHistory), args.Error(1)
 }
 
-func (m *MockLibraryRepository) Commit() error {
-	args := m.Called()
+func (m *MockLibraryRepository) UpsertWatchState(ctx context.Context, state *models.WatchHistory) error {
+	args := m.Called(ctx, state)
 	return args.Error(0)
 }
 
-func (m *MockLibraryRepository) Rollback() error {
-	args := m.Called()
+func (m *MockLibraryRepository) ListWatchStatesByUser(
+	ctx context.Context,
+	userID uuid.UUID,
+) ([]*models.WatchHistory, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.WatchHistory), args.Error(1)
+}
+
+func (m *MockLibraryRepository) AnonymizeWatchStates(ctx context.Context, userID uuid.UUID) (int64, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockLibraryRepository) AddToWatchlist(ctx context.Context, entry *domain.WatchlistEntry) error {
+	args := m.Called(ctx, entry)
 	return args.Error(0)
 }
 
-type LibraryServiceTestSuite struct {
-	suite.Suite
+func (m *MockLibraryRepository) RemoveFromWatchlist(ctx context.Context, userID, mediaID uuid.UUID) error {
+	args := m.Called(ctx, userID, mediaID)
+	return args.Error(0)
+}
 
-	ctx            context.Context
-	mockRepo       *MockLibraryRepository
-	libraryService *service.LibraryService
-	cache          *utils.InMemoryCache
-	eventBus       *events.LocalEventBus
+func (m *MockLibraryRepository) ListWatchlist(ctx context.Context, userID uuid.UUID) ([]*domain.WatchlistEntry, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.WatchlistEntry), args.Error(1)
 }
 
-func (suite *LibraryServiceTestSuite) SetupTest() {
-	suite.ctx = context.Background()
-	suite.mockRepo = new(MockLibraryRepository)
-	suite.cache = utils.NewInMemoryCache()
-	suite.eventBus = events.NewLocalEventBus(logger.NewNoopLogger())
+func (m *MockLibraryRepository) DeleteWatchlist(ctx context.Context, userID uuid.UUID) (int64, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(int64), args.Error(1)
+}
 
-	suite.libraryService = service.NewLibraryService(
-		suite.mockRepo,
-		suite.eventBus,
-		suite.cache,
-		logger.NewNoopLogger(),
-	)
+func (m *MockLibraryRepository) CreateWorkflow(ctx context.Context, wf *saga.Workflow) error {
+	args := m.Called(ctx, wf)
+	return args.Error(0)
 }
 
-func (suite *LibraryServiceTestSuite) TearDownTest() {
-	// Give time for any async operations to complete
-	time.Sleep(50 * time.Millisecond)
-	suite.mockRepo.AssertExpectations(suite.T())
+func (m *MockLibraryRepository) UpdateWorkflow(ctx context.Context, wf *saga.Workflow) error {
+	args := m.Called(ctx, wf)
+	return args.Error(0)
 }
 
-func (suite *LibraryServiceTestSuite) TestCreateLibrary_Success() {
-	// Arrange
-	library := &domain.Library{
-		Name:         "Test Library",
-		Path:         "/test/path",
-		Type:         "movie",
-		Enabled:      true,
-		ScanInterval: 3600,
+func (m *MockLibraryRepository) GetLatestWorkflow(ctx context.Context, mediaID uuid.UUID) (*saga.Workflow, error) {
+	args := m.Called(ctx, mediaID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
 	}
+	return args.Get(0).(*saga.Workflow), args.Error(1)
+}
 
-	suite.mockRepo.On("GetLibraryByPath", suite.ctx, "/test/path").Return(nil, errors.NotFound("not found"))
-	suite.mockRepo.On("CreateLibrary", suite.ctx, mock.AnythingOfType("*domain.Library")).Return(nil)
+func (m *MockLibraryRepository) InterruptWorkflows(ctx context.Context, reason string) (int, error) {
+	args := m.Called(ctx, reason)
+	return args.Int(0), args.Error(1)
+}
 
-	// Act
-	err := suite.libraryService.CreateLibrary(suite.ctx, library)
+func (m *MockLibraryRepository) InterruptScans(ctx context.Context, reason string) (int, error) {
+	args := m.Called(ctx, reason)
+	return args.Int(0), args.Error(1)
+}
 
-	// Assert
-	suite.Require().NoError(err)
-	suite.NotEqual(uuid.Nil, library.ID)
+func (m *MockLibraryRepository) ArchiveWorkflows(
+	ctx context.Context,
+	finishedBefore time.Time,
+	keepPerMedia, limit int,
+) (int, error) {
+	args := m.Called(ctx, finishedBefore, keepPerMedia, limit)
+	return args.Int(0), args.Error(1)
 }
 
-func (suite *LibraryServiceTestSuite) TestCreateLibrary_PathExists() {
-	// Arrange
-	existingLibrary := &domain.Library{
-		ID:   uuid.New(),
-		Path: "/test/path",
+func (m *MockLibraryRepository) ListWorkflowHistory(
+	ctx context.Context,
+	filter domain.WorkflowHistoryFilter,
+	limit, offset int,
+) ([]*saga.Workflow, error) {
+	args := m.Called(ctx, filter, limit, offset)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
 	}
+	return args.Get(0).([]*saga.Workflow), args.Error(1)
+}
 
-	library := &domain.Library{
-		Name: "Test Library",
-		Path: "/test/path",
+func (m *MockLibraryRepository) CreateTranscodePolicy(ctx context.Context, policy *domain.TranscodePolicy) error {
+	args := m.Called(ctx, policy)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) GetTranscodePolicy(ctx context.Context, id uuid.UUID) (*domain.TranscodePolicy, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
 	}
+	return args.Get(0).(*domain.TranscodePolicy), args.Error(1)
+}
 
-	suite.mockRepo.On("GetLibraryByPath", suite.ctx, "/test/path").Return(existingLibrary, nil)
+func (m *MockLibraryRepository) ListTranscodePolicies(
+	ctx context.Context,
+	libraryID uuid.UUID,
+) ([]*domain.TranscodePolicy, error) {
+	args := m.Called(ctx, libraryID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.TranscodePolicy), args.Error(1)
+}
 
-	// Act
-	err := suite.libraryService.CreateLibrary(suite.ctx, library)
+func (m *MockLibraryRepository) UpdateTranscodePolicy(ctx context.Context, policy *domain.TranscodePolicy) error {
+	args := m.Called(ctx, policy)
+	return args.Error(0)
+}
 
-	// Assert
-	suite.Require().Error(err)
-	suite.True(errors.IsConflict(err))
+func (m *MockLibraryRepository) DeleteTranscodePolicy(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
 }
 
-func (suite *LibraryServiceTestSuite) TestCreateLibrary_MissingFields() {
-	// Arrange
-	library := &domain.Library{
-		Name: "", // Missing name
-		Path: "/test/path",
+func (m *MockLibraryRepository) ClaimTranscode(
+	ctx context.Context,
+	mediaID, policyID uuid.UUID,
+	key string,
+	priority domain.TranscodePriority,
+) (bool, error) {
+	args := m.Called(ctx, mediaID, policyID, key, priority)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockLibraryRepository) ListTranscodeRequests(
+	ctx context.Context,
+	limit, offset int,
+) ([]*domain.TranscodeRequest, error) {
+	args := m.Called(ctx, limit, offset)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
 	}
+	return args.Get(0).([]*domain.TranscodeRequest), args.Error(1)
+}
 
-	// Act
-	err := suite.libraryService.CreateLibrary(suite.ctx, library)
+func (m *MockLibraryRepository) SetTranscodePriority(
+	ctx context.Context,
+	mediaID uuid.UUID,
+	key string,
+	priority domain.TranscodePriority,
+) error {
+	args := m.Called(ctx, mediaID, key, priority)
+	return args.Error(0)
+}
 
-	// Assert
-	suite.Require().Error(err)
-	suite.True(errors.IsBadRequest(err))
+func (m *MockLibraryRepository) GetTranscodePrioritySignals(
+	ctx context.Context,
+	mediaIDs []uuid.UUID,
+	since time.Time,
+) ([]*domain.TranscodePrioritySignals, error) {
+	args := m.Called(ctx, mediaIDs, since)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.TranscodePrioritySignals), args.Error(1)
 }
 
-func (suite *LibraryServiceTestSuite) TestGetLibrary_Success() {
-	// Arrange
-	libraryID := uuid.New()
-	expectedLibrary := &domain.Library{
-		ID:   libraryID,
-		Name: "Test Library",
+func (m *MockLibraryRepository) ListPopularGenres(ctx context.Context, since time.Time, limit int) ([]string, error) {
+	args := m.Called(ctx, since, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
 	}
+	return args.Get(0).([]string), args.Error(1)
+}
 
-	suite.mockRepo.On("GetLibrary", suite.ctx, libraryID).Return(expectedLibrary, nil)
+func (m *MockLibraryRepository) GetTranscodeOutput(
+	ctx context.Context,
+	sourceHash, profileHash string,
+) (*domain.TranscodeOutput, error) {
+	args := m.Called(ctx, sourceHash, profileHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.TranscodeOutput), args.Error(1)
+}
 
-	// Act
-	library, err := suite.libraryService.GetLibrary(suite.ctx, libraryID)
+func (m *MockLibraryRepository) SaveTranscodeOutput(ctx context.Context, output *domain.TranscodeOutput) error {
+	args := m.Called(ctx, output)
+	return args.Error(0)
+}
 
-	// Assert
-	suite.Require().NoError(err)
-	suite.Equal(expectedLibrary, library)
+func (m *MockLibraryRepository) DeleteTranscodeOutput(ctx context.Context, sourceHash, profileHash string) error {
+	args := m.Called(ctx, sourceHash, profileHash)
+	return args.Error(0)
 }
 
-func (suite *LibraryServiceTestSuite) TestGetLibrary_Cached() {
-	// Arrange
-	libraryID := uuid.New()
-	expectedLibrary := &domain.Library{
-		ID:   libraryID,
-		Name: "Test Library",
-	}
+func (m *MockLibraryRepository) InvalidateTranscodeOutputs(
+	ctx context.Context,
+	mediaID uuid.UUID,
+	keepSourceHash string,
+) (int, error) {
+	args := m.Called(ctx, mediaID, keepSourceHash)
+	return args.Int(0), args.Error(1)
+}
 
-	// First call - from repository
-	suite.mockRepo.On("GetLibrary", suite.ctx, libraryID).Return(expectedLibrary, nil).Once()
+func (m *MockLibraryRepository) GetLoudnessMeasurement(
+	ctx context.Context,
+	sourceHash string,
+) (*domain.LoudnessMeasurement, error) {
+	args := m.Called(ctx, sourceHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.LoudnessMeasurement), args.Error(1)
+}
 
-	// Act - First call
-	library1, err1 := suite.libraryService.GetLibrary(suite.ctx, libraryID)
+func (m *MockLibraryRepository) SaveLoudnessMeasurement(ctx context.Context, measurement *domain.LoudnessMeasurement) error {
+	args := m.Called(ctx, measurement)
+	return args.Error(0)
+}
 
-	// Act - Second call (should use cache)
-	library2, err2 := suite.libraryService.GetLibrary(suite.ctx, libraryID)
+func (m *MockLibraryRepository) CreateTask(ctx context.Context, t *task.Task) error {
+	args := m.Called(ctx, t)
+	return args.Error(0)
+}
 
-	// Assert
-	suite.Require().NoError(err1)
-	suite.Require().NoError(err2)
-	suite.Equal(library1, library2)
-	// Verify repo was only called once
-	suite.mockRepo.AssertNumberOfCalls(suite.T(), "GetLibrary", 1)
+func (m *MockLibraryRepository) UpdateTask(ctx context.Context, t *task.Task) error {
+	args := m.Called(ctx, t)
+	return args.Error(0)
 }
 
-func (suite *LibraryServiceTestSuite) TestUpdateLibrary_Success() {
-	// Arrange
+func (m *MockLibraryRepository) GetTask(ctx context.Context, id uuid.UUID) (*task.Task, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*task.Task), args.Error(1)
+}
+
+func (m *MockLibraryRepository) ListTasks(
+	ctx context.Context,
+	filter task.Filter,
+	limit, offset int,
+) ([]*task.Task, error) {
+	args := m.Called(ctx, filter, limit, offset)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*task.Task), args.Error(1)
+}
+
+func (m *MockLibraryRepository) InterruptTasks(ctx context.Context, reason string) (int, error) {
+	args := m.Called(ctx, reason)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockLibraryRepository) IndexMedia(ctx context.Context, media []*models.Media) error {
+	args := m.Called(ctx, media)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) RemoveFromSearchIndex(ctx context.Context, mediaID uuid.UUID) error {
+	args := m.Called(ctx, mediaID)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) PruneSearchIndex(ctx context.Context, before time.Time) (int, error) {
+	args := m.Called(ctx, before)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockLibraryRepository) ListLibraryFiles(ctx context.Context, libraryID uuid.UUID) ([]*domain.LibraryFile, error) {
+	args := m.Called(ctx, libraryID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.LibraryFile), args.Error(1)
+}
+
+func (m *MockLibraryRepository) RelocateLibrary(ctx context.Context, libraryID uuid.UUID, from, to string) (int, error) {
+	args := m.Called(ctx, libraryID, from, to)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockLibraryRepository) RenameFiles(ctx context.Context, files []domain.RenamedFile) error {
+	args := m.Called(ctx, files)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) RefreshStorageUsage(ctx context.Context, libraryID uuid.UUID) error {
+	args := m.Called(ctx, libraryID)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) DeleteStorageUsage(ctx context.Context, libraryID uuid.UUID) error {
+	args := m.Called(ctx, libraryID)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) ListStorageUsage(ctx context.Context, libraryID *uuid.UUID) ([]*domain.StorageUsage, error) {
+	args := m.Called(ctx, libraryID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.StorageUsage), args.Error(1)
+}
+
+func (m *MockLibraryRepository) ListHookStates(ctx context.Context) (map[string]bool, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]bool), args.Error(1)
+}
+
+func (m *MockLibraryRepository) SetHookEnabled(ctx context.Context, name string, enabled bool) error {
+	args := m.Called(ctx, name, enabled)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) CreateHookRun(ctx context.Context, run *domain.HookRun) error {
+	args := m.Called(ctx, run)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) ListHookRuns(ctx context.Context, name string, limit int) ([]*domain.HookRun, error) {
+	args := m.Called(ctx, name, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.HookRun), args.Error(1)
+}
+
+func (m *MockLibraryRepository) DeleteHookRunsBefore(ctx context.Context, before time.Time) (int64, error) {
+	args := m.Called(ctx, before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockLibraryRepository) ListWorkerPoolSizes(ctx context.Context) (map[string]int, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]int), args.Error(1)
+}
+
+func (m *MockLibraryRepository) SetWorkerPoolSize(ctx context.Context, name string, size int) error {
+	args := m.Called(ctx, name, size)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) CreateFeed(ctx context.Context, feed *domain.Feed) error {
+	args := m.Called(ctx, feed)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) GetFeed(ctx context.Context, id uuid.UUID) (*domain.Feed, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Feed), args.Error(1)
+}
+
+func (m *MockLibraryRepository) ListFeeds(ctx context.Context, libraryID *uuid.UUID) ([]*domain.Feed, error) {
+	args := m.Called(ctx, libraryID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Feed), args.Error(1)
+}
+
+func (m *MockLibraryRepository) UpdateFeed(ctx context.Context, feed *domain.Feed) error {
+	args := m.Called(ctx, feed)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) DeleteFeed(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) SetFeedPolled(ctx context.Context, id uuid.UUID, polledAt time.Time, lastError string) error {
+	args := m.Called(ctx, id, polledAt, lastError)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) ClaimFeedItem(ctx context.Context, grab *domain.FeedGrab) (bool, error) {
+	args := m.Called(ctx, grab)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockLibraryRepository) UpdateFeedGrab(ctx context.Context, grab *domain.FeedGrab) error {
+	args := m.Called(ctx, grab)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) ReleaseFeedItem(ctx context.Context, key string) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) GrabbedFeedItems(ctx context.Context, keys []string) (map[string]bool, error) {
+	args := m.Called(ctx, keys)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]bool), args.Error(1)
+}
+
+func (m *MockLibraryRepository) ListCalendar(
+	ctx context.Context,
+	start, end time.Time,
+	libraryID *uuid.UUID,
+) ([]*domain.CalendarEntry, error) {
+	args := m.Called(ctx, start, end, libraryID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.CalendarEntry), args.Error(1)
+}
+
+func (m *MockLibraryRepository) GetCalendarFeedKey(ctx context.Context, userID uuid.UUID) (*domain.CalendarFeedKey, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.CalendarFeedKey), args.Error(1)
+}
+
+func (m *MockLibraryRepository) SetCalendarFeedKey(ctx context.Context, key *domain.CalendarFeedKey) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) ListMissing(
+	ctx context.Context,
+	libraryID *uuid.UUID,
+	airedBefore time.Time,
+) ([]*domain.WantedItem, error) {
+	args := m.Called(ctx, libraryID, airedBefore)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.WantedItem), args.Error(1)
+}
+
+func (m *MockLibraryRepository) ListUpgradeCandidates(
+	ctx context.Context,
+	libraryID *uuid.UUID,
+) ([]*domain.WantedItem, error) {
+	args := m.Called(ctx, libraryID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.WantedItem), args.Error(1)
+}
+
+func (m *MockLibraryRepository) GetWantedItem(
+	ctx context.Context,
+	mediaID uuid.UUID,
+	episodeID *uuid.UUID,
+) (*domain.WantedItem, error) {
+	args := m.Called(ctx, mediaID, episodeID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.WantedItem), args.Error(1)
+}
+
+func (m *MockLibraryRepository) AddBlocklistEntry(ctx context.Context, entry *domain.BlocklistEntry) error {
+	args := m.Called(ctx, entry)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) ListBlocklist(
+	ctx context.Context,
+	limit, offset int,
+) ([]*domain.BlocklistEntry, int64, error) {
+	args := m.Called(ctx, limit, offset)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).([]*domain.BlocklistEntry), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockLibraryRepository) DeleteBlocklistEntry(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) FindBlocklisted(
+	ctx context.Context,
+	releases []domain.ReleaseIdentity,
+) ([]*domain.BlocklistEntry, error) {
+	args := m.Called(ctx, releases)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.BlocklistEntry), args.Error(1)
+}
+
+func (m *MockLibraryRepository) CreateManualImport(ctx context.Context, mi *domain.ManualImport) error {
+	args := m.Called(ctx, mi)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) GetManualImport(ctx context.Context, id uuid.UUID) (*domain.ManualImport, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.ManualImport), args.Error(1)
+}
+
+func (m *MockLibraryRepository) ListManualImports(
+	ctx context.Context,
+	status *domain.ManualImportStatus,
+	limit, offset int,
+) ([]*domain.ManualImport, int64, error) {
+	args := m.Called(ctx, status, limit, offset)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).([]*domain.ManualImport), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockLibraryRepository) ResolveManualImport(ctx context.Context, mi *domain.ManualImport) error {
+	args := m.Called(ctx, mi)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) CreatePlaybackIssue(ctx context.Context, issue *domain.PlaybackIssue) error {
+	args := m.Called(ctx, issue)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) GetPlaybackIssueStats(
+	ctx context.Context,
+	mediaID uuid.UUID,
+	since time.Time,
+) (*domain.PlaybackIssueStats, error) {
+	args := m.Called(ctx, mediaID, since)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.PlaybackIssueStats), args.Error(1)
+}
+
+func (m *MockLibraryRepository) ListPlaybackIssueStats(
+	ctx context.Context,
+	filter domain.PlaybackIssueFilter,
+	limit, offset int,
+) ([]*domain.PlaybackIssueStats, int64, error) {
+	args := m.Called(ctx, filter, limit, offset)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).([]*domain.PlaybackIssueStats), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockLibraryRepository) FlagPlayback(ctx context.Context, flag *domain.PlaybackFlag) (bool, error) {
+	args := m.Called(ctx, flag)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockLibraryRepository) ClearPlaybackIssues(ctx context.Context, mediaID uuid.UUID) error {
+	args := m.Called(ctx, mediaID)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) CreateShareLink(ctx context.Context, link *domain.ShareLink) error {
+	args := m.Called(ctx, link)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) GetShareLink(ctx context.Context, id uuid.UUID) (*domain.ShareLink, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.ShareLink), args.Error(1)
+}
+
+func (m *MockLibraryRepository) GetShareLinkByTokenHash(ctx context.Context, tokenHash string) (*domain.ShareLink, error) {
+	args := m.Called(ctx, tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.ShareLink), args.Error(1)
+}
+
+func (m *MockLibraryRepository) ListShareLinks(
+	ctx context.Context,
+	filter domain.ShareLinkFilter,
+	limit, offset int,
+) ([]*domain.ShareLink, int64, error) {
+	args := m.Called(ctx, filter, limit, offset)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).([]*domain.ShareLink), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockLibraryRepository) RevokeShareLink(ctx context.Context, id uuid.UUID, at time.Time) error {
+	args := m.Called(ctx, id, at)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) RecordShareLinkPlay(ctx context.Context, play *domain.ShareLinkPlay) (*domain.ShareLink, error) {
+	args := m.Called(ctx, play)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.ShareLink), args.Error(1)
+}
+
+func (m *MockLibraryRepository) ListShareLinkPlays(
+	ctx context.Context,
+	linkID uuid.UUID,
+	limit, offset int,
+) ([]*domain.ShareLinkPlay, int64, error) {
+	args := m.Called(ctx, linkID, limit, offset)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).([]*domain.ShareLinkPlay), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockLibraryRepository) CreateContentRequest(ctx context.Context, request *domain.ContentRequest) error {
+	args := m.Called(ctx, request)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) GetContentRequest(ctx context.Context, id uuid.UUID) (*domain.ContentRequest, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.ContentRequest), args.Error(1)
+}
+
+func (m *MockLibraryRepository) GetContentRequestsByProviderIDs(
+	ctx context.Context,
+	provider string,
+	providerIDs []string,
+) (map[string]*domain.ContentRequest, error) {
+	args := m.Called(ctx, provider, providerIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]*domain.ContentRequest), args.Error(1)
+}
+
+func (m *MockLibraryRepository) ListContentRequests(
+	ctx context.Context,
+	filter domain.ContentRequestFilter,
+	limit, offset int,
+) ([]*domain.ContentRequest, int64, error) {
+	args := m.Called(ctx, filter, limit, offset)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).([]*domain.ContentRequest), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockLibraryRepository) ListContentRequestsSince(
+	ctx context.Context,
+	userID uuid.UUID,
+	since time.Time,
+) ([]*domain.ContentRequest, error) {
+	args := m.Called(ctx, userID, since)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.ContentRequest), args.Error(1)
+}
+
+func (m *MockLibraryRepository) DecideContentRequest(ctx context.Context, request *domain.ContentRequest) error {
+	args := m.Called(ctx, request)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) MarkContentRequestsAvailable(
+	ctx context.Context,
+	mediaID uuid.UUID,
+	at time.Time,
+) ([]*domain.ContentRequest, error) {
+	args := m.Called(ctx, mediaID, at)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.ContentRequest), args.Error(1)
+}
+
+func (m *MockLibraryRepository) GetRequestQuotaOverride(
+	ctx context.Context,
+	userID uuid.UUID,
+) (*domain.RequestQuotaOverride, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.RequestQuotaOverride), args.Error(1)
+}
+
+func (m *MockLibraryRepository) SetRequestQuotaOverride(ctx context.Context, override *domain.RequestQuotaOverride) error {
+	args := m.Called(ctx, override)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) DeleteRequestQuotaOverride(ctx context.Context, userID uuid.UUID) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) CreateMediaIssue(ctx context.Context, issue *domain.MediaIssue) error {
+	args := m.Called(ctx, issue)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) GetMediaIssue(ctx context.Context, id uuid.UUID) (*domain.MediaIssue, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.MediaIssue), args.Error(1)
+}
+
+func (m *MockLibraryRepository) ListMediaIssues(
+	ctx context.Context,
+	filter domain.MediaIssueFilter,
+	limit, offset int,
+) ([]*domain.MediaIssue, int64, error) {
+	args := m.Called(ctx, filter, limit, offset)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).([]*domain.MediaIssue), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockLibraryRepository) ResolveMediaIssue(ctx context.Context, issue *domain.MediaIssue) error {
+	args := m.Called(ctx, issue)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) ListWatchStatesSince(
+	ctx context.Context,
+	since time.Time,
+	limit int,
+) ([]*models.WatchHistory, error) {
+	args := m.Called(ctx, since, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.WatchHistory), args.Error(1)
+}
+
+func (m *MockLibraryRepository) CreateKiosk(ctx context.Context, kiosk *domain.Kiosk) error {
+	args := m.Called(ctx, kiosk)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) GetKiosk(ctx context.Context, id uuid.UUID) (*domain.Kiosk, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Kiosk), args.Error(1)
+}
+
+func (m *MockLibraryRepository) GetKioskByKeyHash(ctx context.Context, keyHash string) (*domain.Kiosk, error) {
+	args := m.Called(ctx, keyHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Kiosk), args.Error(1)
+}
+
+func (m *MockLibraryRepository) ListKiosks(ctx context.Context) ([]*domain.Kiosk, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Kiosk), args.Error(1)
+}
+
+func (m *MockLibraryRepository) RevokeKiosk(ctx context.Context, id uuid.UUID, at time.Time) error {
+	args := m.Called(ctx, id, at)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) LatestViewing(
+	ctx context.Context,
+	userID, mediaID uuid.UUID,
+	episodeID *uuid.UUID,
+) (*domain.Viewing, error) {
+	args := m.Called(ctx, userID, mediaID, episodeID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Viewing), args.Error(1)
+}
+
+func (m *MockLibraryRepository) SaveViewing(ctx context.Context, viewing *domain.Viewing) error {
+	args := m.Called(ctx, viewing)
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) ListViewings(
+	ctx context.Context,
+	mediaID uuid.UUID,
+	since time.Time,
+) ([]*domain.Viewing, error) {
+	args := m.Called(ctx, mediaID, since)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Viewing), args.Error(1)
+}
+
+func (m *MockLibraryRepository) ListTitleStats(
+	ctx context.Context,
+	filter domain.AnalyticsFilter,
+	limit, offset int,
+) ([]*domain.TitleStats, int64, error) {
+	args := m.Called(ctx, filter, limit, offset)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).([]*domain.TitleStats), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockLibraryRepository) AnonymizeViewings(ctx context.Context, userID uuid.UUID) (int64, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockLibraryRepository) ListPruneItems(ctx context.Context, libraryID *uuid.UUID) ([]domain.PruneItem, error) {
+	args := m.Called(ctx, libraryID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.PruneItem), args.Error(1)
+}
+
+// Implement other required methods...
+func (m *MockLibraryRepository) BeginTx(ctx context.Context) (repository.Repository, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(repository.Repository), args.Error(1)
+}
+
+func (m *MockLibraryRepository) Commit() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *MockLibraryRepository) Rollback() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+type LibraryServiceTestSuite struct {
+	suite.Suite
+
+	ctx            context.Context
+	mockRepo       *MockLibraryRepository
+	libraryService *service.LibraryService
+	cache          *utils.InMemoryCache
+	eventBus       *events.LocalEventBus
+}
+
+func (suite *LibraryServiceTestSuite) SetupTest() {
+	suite.ctx = context.Background()
+	suite.mockRepo = new(MockLibraryRepository)
+	suite.cache = utils.NewInMemoryCache()
+	suite.eventBus = events.NewLocalEventBus(logger.NewNoopLogger())
+
+	suite.libraryService = service.NewLibraryService(
+		suite.mockRepo,
+		suite.eventBus,
+		suite.cache,
+		logger.NewNoopLogger(),
+	)
+}
+
+func (suite *LibraryServiceTestSuite) TearDownTest() {
+	// Give time for any async operations to complete
+	time.Sleep(50 * time.Millisecond)
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+func (suite *LibraryServiceTestSuite) TestCreateLibrary_Success() {
+	// Arrange
+	library := &domain.Library{
+		Name:         "Test Library",
+		Path:         "/test/path",
+		Type:         "movie",
+		Enabled:      true,
+		ScanInterval: 3600,
+	}
+
+	suite.mockRepo.On("GetLibraryByPath", suite.ctx, "/test/path").Return(nil, errors.NotFound("not found"))
+	suite.mockRepo.On("CreateLibrary", suite.ctx, mock.AnythingOfType("*domain.Library")).Return(nil)
+
+	// Act
+	err := suite.libraryService.CreateLibrary(suite.ctx, library)
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.NotEqual(uuid.Nil, library.ID)
+}
+
+func (suite *LibraryServiceTestSuite) TestCreateLibrary_PathExists() {
+	// Arrange
+	existingLibrary := &domain.Library{
+		ID:   uuid.New(),
+		Path: "/test/path",
+	}
+
+	library := &domain.Library{
+		Name: "Test Library",
+		Path: "/test/path",
+	}
+
+	suite.mockRepo.On("GetLibraryByPath", suite.ctx, "/test/path").Return(existingLibrary, nil)
+
+	// Act
+	err := suite.libraryService.CreateLibrary(suite.ctx, library)
+
+	// Assert
+	suite.Require().Error(err)
+	suite.True(errors.IsConflict(err))
+}
+
+func (suite *LibraryServiceTestSuite) TestCreateLibrary_MissingFields() {
+	// Arrange
+	library := &domain.Library{
+		Name: "", // Missing name
+		Path: "/test/path",
+	}
+
+	// Act
+	err := suite.libraryService.CreateLibrary(suite.ctx, library)
+
+	// Assert
+	suite.Require().Error(err)
+	suite.True(errors.IsBadRequest(err))
+}
+
+func (suite *LibraryServiceTestSuite) TestGetLibrary_Success() {
+	// Arrange
+	libraryID := uuid.New()
+	expectedLibrary := &domain.Library{
+		ID:   libraryID,
+		Name: "Test Library",
+	}
+
+	suite.mockRepo.On("GetLibrary", suite.ctx, libraryID).Return(expectedLibrary, nil)
+
+	// Act
+	library, err := suite.libraryService.GetLibrary(suite.ctx, libraryID)
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Equal(expectedLibrary, library)
+}
+
+func (suite *LibraryServiceTestSuite) TestGetLibrary_Cached() {
+	// Arrange
+	libraryID := uuid.New()
+	expectedLibrary := &domain.Library{
+		ID:   libraryID,
+		Name: "Test Library",
+	}
+
+	// First call - from repository
+	suite.mockRepo.On("GetLibrary", suite.ctx, libraryID).Return(expectedLibrary, nil).Once()
+
+	// Act - First call
+	library1, err1 := suite.libraryService.GetLibrary(suite.ctx, libraryID)
+
+	// Act - Second call (should use cache)
+	library2, err2 := suite.libraryService.GetLibrary(suite.ctx, libraryID)
+
+	// Assert
+	suite.Require().NoError(err1)
+	suite.Require().NoError(err2)
+	suite.Equal(library1, library2)
+	// Verify repo was only called once
+	suite.mockRepo.AssertNumberOfCalls(suite.T(), "GetLibrary", 1)
+}
+
+func (suite *LibraryServiceTestSuite) TestUpdateLibrary_Success() {
+	// Arrange
+	libraryID := uuid.New()
+	existingLibrary := &domain.Library{
+		ID:           libraryID,
+		Name:         "Original Name",
+		Path:         "/original/path",
+		Enabled:      true,
+		ScanInterval: 3600,
+	}
+
+	updates := map[string]interface{}{
+		"name":          "Updated Name",
+		"enabled":       false,
+		"scan_interval": 7200,
+	}
+
+	suite.mockRepo.On("GetLibrary", suite.ctx, libraryID).Return(existingLibrary, nil)
+	suite.mockRepo.On("UpdateLibrary", suite.ctx, mock.AnythingOfType("*domain.Library")).Return(nil)
+
+	// Act
+	updatedLibrary, err := suite.libraryService.UpdateLibrary(suite.ctx, libraryID, updates)
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Equal("Updated Name", updatedLibrary.Name)
+	suite.False(updatedLibrary.Enabled)
+	suite.Equal(7200, updatedLibrary.ScanInterval)
+}
+
+func (suite *LibraryServiceTestSuite) TestUpdateLibrary_MetadataPreferences() {
+	// Arrange
+	libraryID := uuid.New()
+	existingLibrary := &domain.Library{
+		ID:   libraryID,
+		Name: "Anime",
+		Path: "/anime",
+	}
+
+	suite.mockRepo.On("GetLibrary", suite.ctx, libraryID).Return(existingLibrary, nil)
+	suite.mockRepo.On("UpdateLibrary", suite.ctx, mock.AnythingOfType("*domain.Library")).Return(nil).Once()
+
+	// Act
+	updatedLibrary, err := suite.libraryService.UpdateLibrary(suite.ctx, libraryID, map[string]interface{}{
+		"metadata_language": "ja",
+		"metadata_region":   "jp",
+		"title_style":       "original",
+	})
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Equal(domain.MetadataPreferences{
+		Language:   "ja",
+		Region:     "JP",
+		TitleStyle: domain.TitleStyleOriginal,
+	}, updatedLibrary.MetadataPreferences)
+
+	_, err = suite.libraryService.UpdateLibrary(suite.ctx, libraryID, map[string]interface{}{
+		"metadata_region": "Europe",
+	})
+	suite.True(errors.IsBadRequest(err))
+}
+
+func (suite *LibraryServiceTestSuite) TestDeleteLibrary_Success() {
+	// Arrange
+	libraryID := uuid.New()
+	library := &domain.Library{
+		ID:   libraryID,
+		Name: "To Delete",
+	}
+
+	suite.mockRepo.On("GetLibrary", suite.ctx, libraryID).Return(library, nil)
+	suite.mockRepo.On("DeleteLibrary", suite.ctx, libraryID).Return(nil)
+
+	// Act
+	err := suite.libraryService.DeleteLibrary(suite.ctx, libraryID)
+
+	// Assert
+	suite.Require().NoError(err)
+}
+
+func (suite *LibraryServiceTestSuite) TestScanLibrary_Success() {
+	// Arrange
+	libraryID := uuid.New()
+	library := &domain.Library{
+		ID:      libraryID,
+		Name:    "Test Library",
+		Path:    "/test/path",
+		Type:    "movie",
+		Enabled: true,
+	}
+
+	suite.mockRepo.On("GetLibrary", suite.ctx, libraryID).Return(library, nil)
+	suite.mockRepo.On("CreateScanHistory", mock.Anything, mock.AnythingOfType("*domain.ScanResult")).Return(nil).Maybe()
+	suite.mockRepo.On("UpdateLibrary", mock.Anything, mock.AnythingOfType("*domain.Library")).Return(nil).Maybe()
+	suite.mockRepo.On("UpdateScanHistory", mock.Anything, mock.AnythingOfType("*domain.ScanResult")).Return(nil).Maybe()
+	suite.mockRepo.On("GetScanManifest", mock.Anything, libraryID).Return(domain.ScanManifest{}, nil).Maybe()
+	suite.mockRepo.On("SaveScanManifest", mock.Anything, libraryID, mock.AnythingOfType("domain.ScanManifest")).
+		Return(nil).
+		Maybe()
+	suite.mockRepo.On("GetMediaByPaths", mock.Anything, mock.Anything).
+		Return(map[string]*models.Media{}, nil).
+		Maybe()
+	suite.mockRepo.On("CreateTask", mock.Anything, mock.AnythingOfType("*task.Task")).Return(nil)
+	suite.mockRepo.On("UpdateTask", mock.Anything, mock.AnythingOfType("*task.Task")).Return(nil).Maybe()
+
+	// Act
+	scan, err := suite.libraryService.ScanLibrary(suite.ctx, libraryID, false)
+
+	// Assert
+	suite.Require().NoError(err)
+	// Scan runs asynchronously, so we just verify it started
+	suite.Equal(service.TaskTypeLibraryScan, scan.Type)
+	suite.Equal(libraryID.String(), scan.Payload["library_id"])
+	suite.libraryService.Stop()
+}
+
+// TestScanLibrary_AlreadyScanning - Commenting out due to race condition in test
+// This test is flaky because the scan completes too quickly when scanning a non-existent path
+// func (suite *LibraryServiceTestSuite) TestScanLibrary_AlreadyScanning() { //nolint:funlen
+// 	// Arrange
+// 	libraryID := uuid.New()
+// 	library := &domain.Library{
+// 		ID:      libraryID,
+// 		Name:    "Test Library",
+// 		Path:    "/test/path",
+// 		Type:    "movie",
+// 		Enabled: true,
+// 	}
+//
+// 	suite.mockRepo.On("GetLibrary", suite.ctx, libraryID).Return(library, nil).Twice()
+// 	suite.mockRepo.On("CreateScanHistory", mock.Anything, mock.AnythingOfType("*domain.ScanResult")).Return(nil).Maybe()
+// 	suite.mockRepo.On("UpdateLibrary", mock.Anything, mock.AnythingOfType("*domain.Library")).Return(nil).Maybe()
+// 	suite.mockRepo.On("UpdateScanHistory", mock.Anything, mock.AnythingOfType("*domain.ScanResult")).Return(nil).Maybe()
+// 	suite.mockRepo.On("GetMediaByPath", mock.Anything, mock.AnythingOfType("string")).Return(nil, errors.NotFound("not found")).Maybe()
+//
+// 	// Start first scan
+// 	err := suite.libraryService.ScanLibrary(suite.ctx, libraryID, false)
+// 	require.NoError(suite.T(), err)
+//
+// 	// Sleep briefly to ensure the goroutine starts
+// 	time.Sleep(50 * time.Millisecond)
+//
+// 	// Act - Try to start another scan
+// 	err = suite.libraryService.ScanLibrary(suite.ctx, libraryID, false)
+//
+// 	// Assert
+// 	require.Error(suite.T(), err)
+// 	assert.True(suite.T(), errors.IsConflict(err))
+// }
+
+func (suite *LibraryServiceTestSuite) TestGetMedia_Success() {
+	// Arrange
+	mediaID := uuid.New()
+	expectedMedia := testutil.CreateTestMedia(uuid.New(), "Test Movie", models.MediaTypeMovie)
+	expectedMedia.ID = mediaID
+
+	suite.mockRepo.On("GetMedia", suite.ctx, mediaID).Return(expectedMedia, nil)
+
+	// Act
+	media, err := suite.libraryService.GetMedia(suite.ctx, mediaID)
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Equal(expectedMedia, media)
+}
+
+func (suite *LibraryServiceTestSuite) TestListEpisodes_AnimeAbsoluteNumbers() {
+	// Arrange
+	library := &domain.Library{ID: uuid.New(), Name: "Anime", Anime: true}
+	series := testutil.CreateTestMedia(library.ID, "Frieren", models.MediaTypeSeries)
+	episodes := []*models.Episode{
+		{MediaID: series.ID, SeasonNumber: 0, EpisodeNumber: 1},
+		{MediaID: series.ID, SeasonNumber: 1, EpisodeNumber: 1},
+		{MediaID: series.ID, SeasonNumber: 1, EpisodeNumber: 2},
+		{MediaID: series.ID, SeasonNumber: 2, EpisodeNumber: 1},
+	}
+
+	suite.mockRepo.On("GetMedia", suite.ctx, series.ID).Return(series, nil)
+	suite.mockRepo.On("GetLibrary", suite.ctx, library.ID).Return(library, nil)
+	suite.mockRepo.On("ListEpisodesByMedia", suite.ctx, series.ID).Return(episodes, nil)
+
+	// Act
+	listed, err := suite.libraryService.ListEpisodes(suite.ctx, series.ID)
+
+	// Assert
+	suite.Require().NoError(err)
+	absolute := make([]int, len(listed))
+	for i, ep := range listed {
+		absolute[i] = ep.AbsoluteNumber
+	}
+	suite.Equal([]int{0, 1, 2, 3}, absolute)
+}
+
+func (suite *LibraryServiceTestSuite) TestSearchMedia_Success() {
+	// Arrange
+	libraryID := uuid.New()
+	mediaType := string(models.MediaTypeMovie)
+	status := "available"
+
+	expectedMedia := []*models.Media{
+		testutil.CreateTestMedia(libraryID, "Movie 1", models.MediaTypeMovie),
+		testutil.CreateTestMedia(libraryID, "Movie 2", models.MediaTypeMovie),
+	}
+
+	suite.mockRepo.On("SearchMedia", suite.ctx, "test", &mediaType, &status, &libraryID, 50, 0).
+		Return(expectedMedia, nil)
+
+	// Act
+	results, err := suite.libraryService.SearchMedia(suite.ctx, "test", &mediaType, &status, &libraryID, 50, 0)
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Len(results, 2)
+}
+
+func (suite *LibraryServiceTestSuite) TestUpdateMedia_Success() {
+	// Arrange
+	mediaID := uuid.New()
+	existingMedia := testutil.CreateTestMedia(uuid.New(), "Original Title", models.MediaTypeMovie)
+	existingMedia.ID = mediaID
+
+	updates := map[string]interface{}{
+		"title":       "Updated Title",
+		"description": "New description",
+		"tags":        []string{"action", "drama"},
+	}
+
+	suite.mockRepo.On("GetMedia", suite.ctx, mediaID).Return(existingMedia, nil)
+	suite.mockRepo.On("UpdateMedia", suite.ctx, mock.AnythingOfType("*models.Media")).Return(nil)
+
+	// Act
+	updatedMedia, err := suite.libraryService.UpdateMedia(suite.ctx, mediaID, updates)
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Equal("Updated Title", updatedMedia.Title)
+	suite.Equal("New description", updatedMedia.Description)
+	suite.Equal([]string{"action", "drama"}, updatedMedia.Tags)
+}
+
+func (suite *LibraryServiceTestSuite) TestDeleteMedia_Success() {
+	// Arrange
+	mediaID := uuid.New()
+	media := testutil.CreateTestMedia(uuid.New(), "To Delete", models.MediaTypeMovie)
+	media.ID = mediaID
+
+	suite.mockRepo.On("GetMedia", suite.ctx, mediaID).Return(media, nil)
+	suite.mockRepo.On("ListExtras", suite.ctx, mediaID).Return([]*models.Media{}, nil)
+	suite.mockRepo.On("DeleteMedia", suite.ctx, mediaID).Return(nil)
+
+	// Act
+	err := suite.libraryService.DeleteMedia(suite.ctx, mediaID)
+
+	// Assert
+	suite.Require().NoError(err)
+}
+
+func (suite *LibraryServiceTestSuite) TestExportLibrary_Success() {
+	// Arrange
+	libraryID := uuid.New()
+	library := &domain.Library{ID: libraryID, Name: "Movies", Path: "/test/media", Type: "movie"}
+	media := testutil.CreateTestMedia(libraryID, "Movie 1", models.MediaTypeMovie)
+	state := &models.WatchHistory{UserID: uuid.New(), MediaID: media.ID, Position: 120}
+
+	suite.mockRepo.On("GetLibrary", suite.ctx, libraryID).Return(library, nil)
+	suite.mockRepo.On("ListMediaByLibrary", suite.ctx, libraryID, (*string)(nil), 200, 0).
+		Return([]*models.Media{media}, nil)
+	suite.mockRepo.On("ListEpisodesByMedia", suite.ctx, media.ID).Return([]*models.Episode{}, nil)
+	suite.mockRepo.On("ListWatchStatesByMedia", suite.ctx, media.ID).
+		Return([]*models.WatchHistory{state}, nil)
+
+	// Act
+	export, err := suite.libraryService.ExportLibrary(suite.ctx, libraryID)
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Equal(domain.ExportSchemaVersion, export.SchemaVersion)
+	suite.Equal("/test/media", export.Library.Path)
+	suite.Require().Len(export.Media, 1)
+	suite.Equal(media, export.Media[0].Media)
+	suite.Len(export.Media[0].WatchStates, 1)
+}
+
+func (suite *LibraryServiceTestSuite) TestImportLibrary_SkipExisting() {
+	// Arrange
+	libraryID := uuid.New()
+	library := &domain.Library{ID: libraryID, Name: "Movies", Path: "/new/root", Type: "movie"}
+	existing := testutil.CreateTestMedia(libraryID, "Existing", models.MediaTypeMovie)
+	incomingNew := testutil.CreateTestMedia(uuid.New(), "New", models.MediaTypeMovie)
+	incomingNew.Path = "/old/root/New.mp4"
+	incomingDup := testutil.CreateTestMedia(uuid.New(), "Existing", models.MediaTypeMovie)
+	incomingDup.Path = "/old/root/Existing.mp4"
+
+	data := &domain.LibraryExport{
+		SchemaVersion: domain.ExportSchemaVersion,
+		Library:       domain.ExportedLibrary{Path: "/old/root"},
+		Media: []domain.ExportedMedia{
+			{Media: incomingNew},
+			{Media: incomingDup},
+		},
+	}
+
+	suite.mockRepo.On("GetLibrary", suite.ctx, libraryID).Return(library, nil)
+	suite.mockRepo.On("GetMediaByPaths", suite.ctx, []string{"/new/root/New.mp4", "/new/root/Existing.mp4"}).
+		Return(map[string]*models.Media{"/new/root/Existing.mp4": existing}, nil)
+	suite.mockRepo.On("UpsertMediaBatch", suite.ctx, mock.MatchedBy(func(media []*models.Media) bool {
+		return len(media) == 1 && media[0].Path == "/new/root/New.mp4" && media[0].LibraryID == libraryID
+	})).Return(1, nil)
+
+	// Act
+	result, err := suite.libraryService.ImportLibrary(suite.ctx, libraryID, data, domain.ConflictSkip)
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Equal(1, result.Created)
+	suite.Equal(1, result.Skipped)
+	suite.Equal(0, result.Updated)
+}
+
+func (suite *LibraryServiceTestSuite) TestImportLibrary_MergeExisting() {
+	// Arrange
+	libraryID := uuid.New()
+	library := &domain.Library{ID: libraryID, Name: "Movies", Path: "/media", Type: "movie"}
+	existing := testutil.CreateTestMedia(libraryID, "Movie", models.MediaTypeMovie)
+	existing.Path = "/media/Movie.mp4"
+	existing.Tags = []string{"favorite"}
+	incoming := testutil.CreateTestMedia(uuid.New(), "Movie", models.MediaTypeMovie)
+	incoming.Path = "/media/Movie.mp4"
+	incoming.Description = "Imported description"
+	incoming.Tags = []string{"favorite", "4k"}
+
+	data := &domain.LibraryExport{
+		SchemaVersion: domain.ExportSchemaVersion,
+		Library:       domain.ExportedLibrary{Path: "/media"},
+		Media:         []domain.ExportedMedia{{Media: incoming}},
+	}
+
+	suite.mockRepo.On("GetLibrary", suite.ctx, libraryID).Return(library, nil)
+	suite.mockRepo.On("GetMediaByPaths", suite.ctx, []string{"/media/Movie.mp4"}).
+		Return(map[string]*models.Media{"/media/Movie.mp4": existing}, nil)
+	suite.mockRepo.On("UpsertMediaBatch", suite.ctx, []*models.Media{existing}).Return(1, nil)
+
+	// Act
+	result, err := suite.libraryService.ImportLibrary(suite.ctx, libraryID, data, domain.ConflictMerge)
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Equal(1, result.Updated)
+	suite.Equal("Imported description", existing.Description)
+	suite.Equal([]string{"favorite", "4k"}, existing.Tags)
+}
+
+func (suite *LibraryServiceTestSuite) TestImportLibrary_RejectsForeignPaths() {
+	// Arrange
+	libraryID := uuid.New()
+	library := &domain.Library{ID: libraryID, Name: "Movies", Path: "/media", Type: "movie"}
+	other := testutil.CreateTestMedia(uuid.New(), "Other", models.MediaTypeMovie)
+	other.Path = "/media/Other.mp4"
+	incomingOther := testutil.CreateTestMedia(uuid.New(), "Imported", models.MediaTypeMovie)
+	incomingOther.Path = "/export/Other.mp4"
+	incomingOutside := testutil.CreateTestMedia(uuid.New(), "Outside", models.MediaTypeMovie)
+	incomingOutside.Path = "/export/../etc/Outside.mp4"
+
+	data := &domain.LibraryExport{
+		SchemaVersion: domain.ExportSchemaVersion,
+		Library:       domain.ExportedLibrary{Path: "/export"},
+		Media:         []domain.ExportedMedia{{Media: incomingOther}, {Media: incomingOutside}},
+	}
+
+	suite.mockRepo.On("GetLibrary", suite.ctx, libraryID).Return(library, nil)
+	suite.mockRepo.On("GetMediaByPaths", suite.ctx, []string{"/media/Other.mp4"}).
+		Return(map[string]*models.Media{"/media/Other.mp4": other}, nil)
+
+	// Act
+	result, err := suite.libraryService.ImportLibrary(suite.ctx, libraryID, data, domain.ConflictOverwrite)
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Equal(2, result.Failed)
+	suite.Equal(0, result.Updated)
+	suite.Equal("Other", other.Title, "media of other libraries are not modified")
+	suite.mockRepo.AssertNotCalled(suite.T(), "UpsertMediaBatch", mock.Anything, mock.Anything)
+}
+
+func (suite *LibraryServiceTestSuite) TestArchiveWorkflows_Batches() {
+	// Arrange
+	policy := domain.RetentionPolicy{MaxAge: 30 * 24 * time.Hour, KeepPerMedia: 2}
+	before := time.Now().Add(-policy.MaxAge)
+
+	suite.mockRepo.On("ArchiveWorkflows", suite.ctx, mock.AnythingOfType("time.Time"), 2, 500).
+		Return(500, nil).Once()
+	suite.mockRepo.On("ArchiveWorkflows", suite.ctx, mock.AnythingOfType("time.Time"), 2, 500).
+		Return(12, nil).Once()
+
+	// Act
+	archived, err := suite.libraryService.ArchiveWorkflows(suite.ctx, policy)
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Equal(512, archived)
+	cutoff := suite.mockRepo.Calls[0].Arguments.Get(1).(time.Time)
+	suite.WithinDuration(before, cutoff, time.Minute)
+}
+
+func (suite *LibraryServiceTestSuite) TestArchiveWorkflows_Disabled() {
+	// Act
+	archived, err := suite.libraryService.ArchiveWorkflows(suite.ctx, domain.RetentionPolicy{})
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Zero(archived)
+	suite.mockRepo.AssertNotCalled(suite.T(), "ArchiveWorkflows")
+}
+
+func (suite *LibraryServiceTestSuite) TestReconcile() {
+	// Arrange
+	suite.mockRepo.On("InterruptTasks", suite.ctx, "interrupted by restart").Return(1, nil)
+	suite.mockRepo.On("InterruptScans", suite.ctx, "interrupted by restart").Return(2, nil)
+	suite.mockRepo.On("InterruptWorkflows", suite.ctx, "interrupted by restart").
+		Return(0, errors.Internal("database unavailable"))
+
+	// Act
+	report := suite.libraryService.Reconcile(suite.ctx)
+
+	// Assert
+	suite.Equal(3, report.Recovered())
+	suite.True(report.Failed())
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+func (suite *LibraryServiceTestSuite) TestSearchIndex_FollowsMediaEvents() {
+	// Arrange
+	searchIndex := service.NewSearchIndexService(
+		suite.mockRepo,
+		suite.libraryService.Tasks(),
+		suite.eventBus,
+		logger.NewNoopLogger(),
+	)
+	suite.Require().NoError(searchIndex.Start())
+
+	media := testutil.CreateTestMedia(uuid.New(), "Movie", models.MediaTypeMovie)
+	suite.mockRepo.On("GetMedia", mock.Anything, media.ID).Return(media, nil)
+	suite.mockRepo.On("IndexMedia", mock.Anything, []*models.Media{media}).Return(nil).Once()
+	suite.mockRepo.On("RemoveFromSearchIndex", mock.Anything, media.ID).Return(nil).Once()
+
+	// Act
+	suite.Require().NoError(suite.eventBus.Publish(suite.ctx, domain.NewMediaUpdatedEvent(media)))
+	suite.Require().NoError(suite.eventBus.Publish(suite.ctx, domain.NewMediaDeletedEvent(media.ID.String(), media.LibraryID)))
+
+	// Assert
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+func (suite *LibraryServiceTestSuite) TestRebuildSearchIndex() {
+	// Arrange
+	searchIndex := service.NewSearchIndexService(
+		suite.mockRepo,
+		suite.libraryService.Tasks(),
+		suite.eventBus,
+		logger.NewNoopLogger(),
+	)
+	library := &domain.Library{ID: uuid.New(), Name: "Movies", Path: "/media", Type: "movie"}
+	media := []*models.Media{
+		testutil.CreateTestMedia(library.ID, "First", models.MediaTypeMovie),
+		testutil.CreateTestMedia(library.ID, "Second", models.MediaTypeMovie),
+	}
+	pruned := make(chan struct{})
+
+	suite.mockRepo.On("ListTasks", suite.ctx, mock.AnythingOfType("task.Filter"), 1, 0).Return([]*task.Task{}, nil)
+	suite.mockRepo.On("CreateTask", mock.Anything, mock.AnythingOfType("*task.Task")).Return(nil)
+	suite.mockRepo.On("UpdateTask", mock.Anything, mock.AnythingOfType("*task.Task")).Return(nil).Maybe()
+	suite.mockRepo.On("ListLibraries", mock.Anything, (*bool)(nil)).Return([]*domain.Library{library}, nil)
+	suite.mockRepo.On("ListMediaByLibrary", mock.Anything, library.ID, (*string)(nil), 200, 0).Return(media, nil)
+	suite.mockRepo.On("IndexMedia", mock.Anything, media).Return(nil)
+	suite.mockRepo.On("PruneSearchIndex", mock.Anything, mock.AnythingOfType("time.Time")).
+		Return(1, nil).
+		Run(func(mock.Arguments) { close(pruned) })
+
+	// Act
+	rebuild, err := searchIndex.RebuildSearchIndex(suite.ctx)
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Equal(service.TaskTypeSearchReindex, rebuild.Type)
+	<-pruned
+	suite.libraryService.Stop()
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+func (suite *LibraryServiceTestSuite) TestResizeWorkerPool() {
+	// Arrange
+	suite.mockRepo.On("SetWorkerPoolSize", suite.ctx, domain.WorkerPoolScanWorkers, 8).Return(nil)
+
+	// Act
+	pool, err := suite.libraryService.ResizeWorkerPool(suite.ctx, domain.WorkerPoolScanWorkers, 8)
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Equal(8, pool.Size)
+	suite.Contains(suite.libraryService.WorkerPools(), &domain.WorkerPool{Name: domain.WorkerPoolScanWorkers, Size: 8})
+
+	_, err = suite.libraryService.ResizeWorkerPool(suite.ctx, domain.WorkerPoolScans, 0)
+	suite.True(errors.IsBadRequest(err))
+	_, err = suite.libraryService.ResizeWorkerPool(suite.ctx, "transcodes", 2)
+	suite.True(errors.IsNotFound(err))
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+func (suite *LibraryServiceTestSuite) TestLoadWorkerPoolSizes() {
+	// Arrange
+	suite.mockRepo.On("ListWorkerPoolSizes", suite.ctx).Return(map[string]int{
+		domain.WorkerPoolScans: 5,
+		"removed":              3,
+	}, nil)
+
+	// Act
+	err := suite.libraryService.LoadWorkerPoolSizes(suite.ctx)
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Equal(5, suite.libraryService.WorkerPools()[0].Size)
+}
+
+func TestLibraryServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(LibraryServiceTestSuite))
+}
+
+func (suite *LibraryServiceTestSuite) TestUserData_ExportsAndAnonymizesWatchHistory() {
+	// Arrange
+	userData := service.NewUserDataService(suite.mockRepo, suite.eventBus, logger.NewNoopLogger())
+	suite.Require().NoError(userData.Start())
+
+	userID := uuid.New()
+	state := &models.WatchHistory{UserID: userID, MediaID: uuid.New(), Position: 90, Completed: true}
+	var sections []map[string]interface{}
+	suite.Require().NoError(suite.eventBus.Subscribe("user.data_export_section",
+		events.NewConsumer("test.sections", 1, func(_ context.Context, env *events.Envelope) error {
+			sections = append(sections, env.Payload())
+			return nil
+		})))
+
+	suite.mockRepo.On("ListWatchStatesByUser", mock.Anything, userID).Return([]*models.WatchHistory{state}, nil)
+	suite.mockRepo.On("AnonymizeWatchStates", mock.Anything, userID).Return(int64(1), nil).Once()
+	suite.mockRepo.On("AnonymizeViewings", mock.Anything, userID).Return(int64(1), nil).Once()
+	suite.mockRepo.On("DeleteWatchlist", mock.Anything, userID).Return(int64(2), nil).Once()
+
+	// Act
+	suite.Require().NoError(suite.eventBus.Publish(suite.ctx, events.NewEvent("user.data_export_requested",
+		map[string]interface{}{"export_id": "export-1", "user_id": userID.String()})))
+	suite.Require().NoError(suite.eventBus.Publish(suite.ctx, events.NewEvent("user.deleted",
+		map[string]interface{}{"user_id": userID.String(), "username": "gone"})))
+
+	// Assert
+	suite.Require().Len(sections, 1)
+	suite.Equal("export-1", sections[0]["export_id"])
+	suite.Equal("watch_history", sections[0]["section"])
+	suite.Contains(sections[0]["data"], userID.String())
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+func (suite *LibraryServiceTestSuite) TestStorage_RefreshesLibraryOnChanges() {
+	// Arrange
+	storage := service.NewStorageService(suite.mockRepo, suite.eventBus, logger.NewNoopLogger())
+	suite.Require().NoError(storage.Start())
+
+	library := &domain.Library{ID: uuid.New(), Name: "Movies"}
+	media := testutil.CreateTestMedia(library.ID, "Movie", models.MediaTypeMovie)
+	scanned := domain.NewMediaAddedEvent(media)
+	suite.mockRepo.On("RefreshStorageUsage", mock.Anything, library.ID).Return(nil).Twice()
+	suite.mockRepo.On("DeleteStorageUsage", mock.Anything, library.ID).Return(nil).Once()
+
+	// Act
+	suite.Require().NoError(suite.eventBus.Publish(suite.ctx, domain.NewLibraryScanCompletedEvent(library, 1, 0)))
+	// Added during the scan, so already accounted for
+	suite.Require().NoError(suite.eventBus.Publish(suite.ctx, scanned))
+	suite.Require().NoError(suite.eventBus.Publish(suite.ctx, domain.NewMediaDeletedEvent(media.ID.String(), library.ID)))
+	suite.Require().NoError(suite.eventBus.Publish(suite.ctx, domain.NewLibraryDeletedEvent(library.ID)))
+
+	// Assert
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+// recordingInvalidator records the media it invalidates.
+type recordingInvalidator struct {
+	mediaIDs []string
+}
+
+func (i *recordingInvalidator) InvalidateMedia(_ context.Context, mediaID string) error {
+	i.mediaIDs = append(i.mediaIDs, mediaID)
+	return nil
+}
+
+func (suite *LibraryServiceTestSuite) TestCDN_InvalidatesDeletedMedia() {
+	// Arrange
+	invalidator := &recordingInvalidator{}
+	cdn := service.NewCDNService(invalidator, suite.eventBus, logger.NewNoopLogger())
+	suite.Require().NoError(cdn.Start())
+	mediaID := uuid.New()
+
+	// Act
+	suite.Require().NoError(suite.eventBus.Publish(suite.ctx, domain.NewMediaDeletedEvent(mediaID.String(), uuid.New())))
+
+	// Assert
+	suite.Equal([]string{mediaID.String()}, invalidator.mediaIDs)
+}
+
+func (suite *LibraryServiceTestSuite) TestHooks_RunScriptsOnDelete() {
+	// Arrange
+	dir := suite.T().TempDir()
+	writeScript := func(name, body string) string {
+		path := filepath.Join(dir, name)
+		suite.Require().NoError(os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0o755))
+		return path
+	}
+	payloadPath := filepath.Join(dir, "payload.json")
+	hooks := []*domain.Hook{
+		{
+			Name:    "notify",
+			Point:   domain.HookPointDelete,
+			Command: writeScript("notify.sh", `cat > "$1"; echo "notified $NARWHAL_HOOK"`),
+			Args:    []string{payloadPath},
+			Enabled: true,
+		},
+		{
+			Name:    "slow",
+			Point:   domain.HookPointDelete,
+			Command: writeScript("slow.sh", "sleep 10"),
+			Timeout: 100 * time.Millisecond,
+			Enabled: true,
+		},
+		// Disabled through the API
+		{
+			Name:    "cleanup",
+			Point:   domain.HookPointDelete,
+			Command: writeScript("cleanup.sh", "touch "+filepath.Join(dir, "cleaned")),
+			Enabled: true,
+		},
+	}
+	suite.mockRepo.On("ListHookStates", mock.Anything).Return(map[string]bool{"cleanup": false}, nil)
+	var runs []*domain.HookRun
+	suite.mockRepo.On("CreateHookRun", mock.Anything, mock.AnythingOfType("*domain.HookRun")).
+		Run(func(args mock.Arguments) { runs = append(runs, args.Get(1).(*domain.HookRun)) }).
+		Return(nil)
+
+	hookService := service.NewHookService(suite.mockRepo, suite.eventBus, logger.NewNoopLogger(), hooks)
+	suite.Require().NoError(hookService.Start(suite.ctx))
+
+	mediaID, libraryID := uuid.New(), uuid.New()
+
+	// Act
+	suite.Require().NoError(suite.eventBus.Publish(suite.ctx, domain.NewMediaDeletedEvent(mediaID.String(), libraryID)))
+
+	// Assert
+	suite.Require().Len(runs, 2)
+	suite.True(runs[0].Succeeded())
+	suite.Equal("notified notify\n", runs[0].Output)
+	suite.Equal(mediaID.String(), runs[0].EntityID)
+	suite.True(runs[1].TimedOut)
+	suite.NoFileExists(filepath.Join(dir, "cleaned"))
+
+	payload, err := os.ReadFile(payloadPath)
+	suite.Require().NoError(err)
+	suite.Contains(string(payload), `"point":"delete"`)
+	suite.Contains(string(payload), `"media_id":"`+mediaID.String()+`"`)
+}
+
+func (suite *LibraryServiceTestSuite) TestRelocateLibrary() {
+	// Arrange
+	oldRoot, newRoot := suite.T().TempDir(), suite.T().TempDir()
+	library := &domain.Library{ID: uuid.New(), Name: "Movies", Path: filepath.Join(oldRoot, "movies")}
+	newLibraryPath := filepath.Join(newRoot, "movies")
+	suite.Require().NoError(os.MkdirAll(newLibraryPath, 0o755))
+	suite.Require().NoError(os.WriteFile(filepath.Join(newLibraryPath, "a.mkv"), []byte("a"), 0o644))
+
+	files := []*domain.LibraryFile{
+		{MediaID: uuid.New(), Path: filepath.Join(library.Path, "a.mkv")},
+		{MediaID: uuid.New(), Path: filepath.Join(library.Path, "b.mkv")},
+		// Outside the relocated prefix, so left alone
+		{MediaID: uuid.New(), Path: "/elsewhere/c.mkv"},
+	}
+	suite.mockRepo.On("GetLibrary", suite.ctx, library.ID).Return(library, nil)
+	suite.mockRepo.On("GetLibraryByPath", suite.ctx, newLibraryPath).Return(nil, errors.NotFound("not found"))
+	suite.mockRepo.On("ListLibraryFiles", suite.ctx, library.ID).Return(files, nil)
+
+	// Act
+	preview, err := suite.libraryService.RelocateLibrary(suite.ctx, library.ID, oldRoot, newRoot, true)
+	suite.Require().NoError(err)
+	_, applyErr := suite.libraryService.RelocateLibrary(suite.ctx, library.ID, oldRoot, newRoot, false)
+
+	suite.Require().NoError(os.WriteFile(filepath.Join(newLibraryPath, "b.mkv"), []byte("b"), 0o644))
+	suite.mockRepo.On("RelocateLibrary", suite.ctx, library.ID, oldRoot, newRoot).Return(2, nil).Once()
+	applied, err := suite.libraryService.RelocateLibrary(suite.ctx, library.ID, oldRoot, newRoot, false)
+
+	// Assert
+	suite.False(preview.Applied)
+	suite.Equal(newLibraryPath, preview.LibraryPath)
+	suite.Require().Len(preview.Files, 2)
+	suite.Equal(filepath.Join(newLibraryPath, "a.mkv"), preview.Files[0].NewPath)
+	suite.True(preview.Files[0].Exists)
+	suite.False(preview.Files[1].Exists)
+	suite.Equal(1, preview.Missing)
+
+	suite.True(errors.IsBadRequest(applyErr))
+
+	suite.Require().NoError(err)
+	suite.True(applied.Applied)
+	suite.Zero(applied.Missing)
+}
+
+func (suite *LibraryServiceTestSuite) TestRelocateLibrary_OutsidePrefix() {
+	// Arrange
+	library := &domain.Library{ID: uuid.New(), Name: "Movies", Path: "/srv/movies"}
+	suite.mockRepo.On("GetLibrary", suite.ctx, library.ID).Return(library, nil)
+
+	// Act
+	_, err := suite.libraryService.RelocateLibrary(suite.ctx, library.ID, "/mnt/old", "/mnt/new", true)
+
+	// Assert
+	suite.True(errors.IsBadRequest(err))
+}
+
+func (suite *LibraryServiceTestSuite) TestGetCalendar() {
+	// Arrange
 	libraryID := uuid.New()
-	existingLibrary := &domain.Library{
-		ID:           libraryID,
-		Name:         "Original Name",
-		Path:         "/original/path",
-		Enabled:      true,
-		ScanInterval: 3600,
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	entries := []*domain.CalendarEntry{
+		{Type: domain.CalendarEntryDigitalRelease, MediaID: uuid.New(), Title: "Movie", Date: start},
+	}
+	suite.mockRepo.On("GetLibrary", suite.ctx, libraryID).Return(&domain.Library{ID: libraryID}, nil)
+	suite.mockRepo.On("ListCalendar", suite.ctx, start, start.Add(domain.DefaultCalendarRange), &libraryID).
+		Return(entries, nil)
+
+	// Act
+	got, err := suite.libraryService.GetCalendar(suite.ctx, start, time.Time{}, &libraryID)
+	_, backwardsErr := suite.libraryService.GetCalendar(suite.ctx, start, start.AddDate(0, 0, -1), nil)
+	_, tooLongErr := suite.libraryService.GetCalendar(suite.ctx, start, start.AddDate(2, 0, 0), nil)
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Equal(entries, got)
+	suite.True(errors.IsBadRequest(backwardsErr))
+	suite.True(errors.IsBadRequest(tooLongErr))
+}
+
+func (suite *LibraryServiceTestSuite) TestRotateCalendarFeedKey() {
+	// Arrange
+	userID := uuid.New()
+	tenantID := uuid.New()
+	ctx := tenant.WithTenantID(suite.ctx, tenantID)
+	var saved *domain.CalendarFeedKey
+	suite.mockRepo.On("SetCalendarFeedKey", ctx, mock.AnythingOfType("*domain.CalendarFeedKey")).
+		Run(func(args mock.Arguments) { saved = args.Get(1).(*domain.CalendarFeedKey) }).
+		Return(nil)
+
+	// Act
+	first, err := suite.libraryService.RotateCalendarFeedKey(ctx, userID)
+	suite.Require().NoError(err)
+	second, err := suite.libraryService.RotateCalendarFeedKey(ctx, userID)
+	suite.Require().NoError(err)
+
+	// Assert
+	suite.NotEmpty(first)
+	suite.NotEqual(first, second, "rotating issues a new key")
+	suite.Equal(userID, saved.UserID)
+	suite.Equal(tenantID, saved.TenantID)
+	suite.Equal(second, saved.Key)
+}
+
+func (suite *LibraryServiceTestSuite) TestMoveFile() {
+	// Arrange
+	root := suite.T().TempDir()
+	library := &domain.Library{ID: uuid.New(), Name: "Movies", Path: root}
+	oldPath := filepath.Join(root, "Movie.mkv")
+	newPath := filepath.Join(root, "Movie (2020)", "Movie.mkv")
+	suite.Require().NoError(os.WriteFile(oldPath, []byte("movie"), 0o644))
+
+	media := testutil.CreateTestMedia(library.ID, "Movie", models.MediaTypeMovie)
+	media.FilePath = oldPath
+	suite.mockRepo.On("GetMedia", suite.ctx, media.ID).Return(media, nil)
+	suite.mockRepo.On("GetLibrary", suite.ctx, library.ID).Return(library, nil)
+	suite.mockRepo.On("GetMediaByPath", suite.ctx, newPath).Return(nil, errors.NotFound("not found"))
+	suite.mockRepo.On("UpdateMedia", suite.ctx, mock.MatchedBy(func(m *models.Media) bool {
+		return m.FilePath == newPath
+	})).Return(nil).Once()
+
+	// Act
+	moved, err := suite.libraryService.MoveFile(suite.ctx, media.ID, newPath)
+	_, outsideErr := suite.libraryService.MoveFile(suite.ctx, media.ID, "/elsewhere/Movie.mkv")
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Equal(newPath, moved.FilePath)
+	suite.FileExists(newPath)
+	suite.NoFileExists(oldPath)
+	suite.True(errors.IsBadRequest(outsideErr))
+}
+
+func (suite *LibraryServiceTestSuite) TestImportStep_LinksDownloadIntoLibrary() {
+	// Arrange
+	downloads, root := suite.T().TempDir(), suite.T().TempDir()
+	source := filepath.Join(downloads, "Movie.2020.mkv")
+	suite.Require().NoError(os.WriteFile(source, []byte("movie"), 0o644))
+
+	library := &domain.Library{ID: uuid.New(), Name: "Movies", Path: root, Type: string(models.MediaTypeMovie)}
+	wf := &saga.Workflow{MediaID: uuid.New(), Data: map[string]string{
+		service.WorkflowDataLibraryID:      library.ID.String(),
+		service.WorkflowDataPath:           source,
+		service.WorkflowDataDownloadClient: "qbittorrent",
+	}}
+	suite.libraryService.WithImportModes(domain.ImportModes{
+		Default:  domain.ImportModeMove,
+		ByClient: map[string]domain.ImportMode{"qbittorrent": domain.ImportModeLink},
+	})
+	suite.mockRepo.On("GetLibrary", mock.Anything, library.ID).Return(library, nil)
+	suite.mockRepo.On("GetMedia", mock.Anything, wf.MediaID).Return(nil, errors.NotFound("media not found")).Once()
+	suite.mockRepo.On("SearchMedia", mock.Anything, "Movie", mock.Anything, (*string)(nil), &library.ID, 20, 0).
+		Return([]*models.Media{}, nil)
+	suite.mockRepo.On("CreateMedia", mock.Anything, mock.MatchedBy(func(m *models.Media) bool {
+		return m.FilePath == filepath.Join(root, "Movie.2020.mkv")
+	})).Return(nil).Once()
+
+	// Act
+	err := suite.libraryService.ImportStep().Execute(suite.ctx, wf)
+
+	// Assert
+	suite.Require().NoError(err)
+	imported := wf.Data[service.WorkflowDataImportedPath]
+	suite.Equal(domain.ImportMethodLinked, wf.Data[service.WorkflowDataImportMethod])
+	sourceInfo, err := os.Stat(source)
+	suite.Require().NoError(err)
+	importedInfo, err := os.Stat(imported)
+	suite.Require().NoError(err)
+	suite.True(os.SameFile(sourceInfo, importedInfo))
+	suite.Equal(int64(5), suite.libraryService.ImportSpaceSaved())
+}
+
+func (suite *LibraryServiceTestSuite) TestImportStep_CompensationKeepsSeedingDownload() {
+	// Arrange
+	downloads, root := suite.T().TempDir(), suite.T().TempDir()
+	source := filepath.Join(downloads, "Movie.mkv")
+	imported := filepath.Join(root, "Movie.mkv")
+	suite.Require().NoError(os.WriteFile(source, []byte("movie"), 0o644))
+	suite.Require().NoError(os.Link(source, imported))
+
+	wf := &saga.Workflow{MediaID: uuid.New(), Data: map[string]string{
+		service.WorkflowDataPath:         source,
+		service.WorkflowDataImportedPath: imported,
+	}}
+	suite.mockRepo.On("GetMedia", mock.Anything, wf.MediaID).Return(nil, errors.NotFound("media not found"))
+
+	// Act
+	err := suite.libraryService.ImportStep().Compensate(suite.ctx, wf)
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.FileExists(source)
+	suite.NoFileExists(imported)
+}
+
+// recordingDownloadClient is a download client that records the downloads
+// added to it.
+type recordingDownloadClient struct {
+	added []string
+}
+
+func (c *recordingDownloadClient) Name() string { return "qbit" }
+
+func (c *recordingDownloadClient) Add(_ context.Context, req downloadclient.AddRequest) (string, error) {
+	c.added = append(c.added, req.URL)
+	return "hash", nil
+}
+
+func (c *recordingDownloadClient) Get(context.Context, string) (*downloadclient.Status, error) {
+	return nil, downloadclient.ErrNotFound
+}
+
+func (c *recordingDownloadClient) List(context.Context, string) ([]*downloadclient.Status, error) {
+	return nil, nil
+}
+
+func (c *recordingDownloadClient) SetCategory(context.Context, string, string) error { return nil }
+
+func (c *recordingDownloadClient) Remove(context.Context, string, bool) error { return nil }
+
+func (suite *LibraryServiceTestSuite) TestFeeds_PollGrabsMatchingItemsOnce() {
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<rss version="2.0"><channel>
+<item><title>Show.S01E01.1080p.WEB</title><link>magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567</link></item>
+<item><title>Show.S01E01.720p.WEB</title><link>magnet:?xt=urn:btih:1123456789abcdef0123456789abcdef01234567</link></item>
+<item><title>Show.S01E02.1080p.WEB</title><link>magnet:?xt=urn:btih:2123456789abcdef0123456789abcdef01234567</link></item>
+<item><title>Show.S01E03.1080p.WEB</title><link>magnet:?xt=urn:btih:3123456789abcdef0123456789abcdef01234567</link></item>
+</channel></rss>`))
+	}))
+	defer server.Close()
+
+	client := &recordingDownloadClient{}
+	clients, err := downloadclient.NewClients("", client)
+	suite.Require().NoError(err)
+	feedService := service.NewFeedService(suite.mockRepo, clients, server.Client(), suite.eventBus, logger.NewNoopLogger())
+
+	feed := &domain.Feed{
+		ID:        uuid.New(),
+		LibraryID: uuid.New(),
+		Name:      "Show",
+		URL:       server.URL,
+		Include:   `^show\.`,
+		Qualities: []string{domain.FeedQuality1080p},
+		Enabled:   true,
+	}
+	// The second episode was grabbed by an earlier poll
+	grabbedKey := "btih:2123456789abcdef0123456789abcdef01234567"
+	suite.mockRepo.On("ClaimFeedItem", mock.Anything, mock.MatchedBy(func(g *domain.FeedGrab) bool {
+		return g.Key != grabbedKey
+	})).Return(true, nil)
+	suite.mockRepo.On("ClaimFeedItem", mock.Anything, mock.MatchedBy(func(g *domain.FeedGrab) bool {
+		return g.Key == grabbedKey
+	})).Return(false, nil)
+	var grabs []*domain.FeedGrab
+	suite.mockRepo.On("UpdateFeedGrab", mock.Anything, mock.AnythingOfType("*domain.FeedGrab")).
+		Run(func(args mock.Arguments) { grabs = append(grabs, args.Get(1).(*domain.FeedGrab)) }).
+		Return(nil)
+	suite.mockRepo.On("SetFeedPolled", mock.Anything, feed.ID, mock.Anything, "").Return(nil)
+	// The third episode turned out fake
+	suite.mockRepo.On("FindBlocklisted", mock.Anything, mock.AnythingOfType("[]domain.ReleaseIdentity")).
+		Return([]*domain.BlocklistEntry{{ReleaseIdentity: domain.ReleaseIdentity{
+			InfoHash: "3123456789abcdef0123456789abcdef01234567",
+		}, Reason: "fake"}}, nil)
+
+	// Act
+	grabbed, err := feedService.PollFeed(suite.ctx, feed)
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Equal(1, grabbed)
+	suite.Equal([]string{"magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567"}, client.added)
+	suite.Require().Len(grabs, 1)
+	suite.Equal("qbit", grabs[0].DownloadClient)
+	suite.Equal("hash", grabs[0].DownloadID)
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+// staticIndexer is an indexer returning fixed releases, or failing.
+type staticIndexer struct {
+	name     string
+	releases []*domain.Release
+	err      error
+	queries  []domain.ReleaseQuery
+}
+
+func (i *staticIndexer) Name() string { return i.name }
+
+func (i *staticIndexer) Search(_ context.Context, query domain.ReleaseQuery) ([]*domain.Release, error) {
+	i.queries = append(i.queries, query)
+	return i.releases, i.err
+}
+
+func (suite *LibraryServiceTestSuite) TestWanted_ListsMissingAndCutoffUnmet() {
+	// Arrange
+	wantedService := service.NewWantedService(suite.mockRepo, nil, nil, suite.eventBus, logger.NewNoopLogger())
+	older, newer := time.Now().AddDate(0, 0, -7), time.Now().AddDate(0, 0, -1)
+	missing := &domain.WantedItem{MediaID: uuid.New(), Title: "Show", Date: &newer}
+	upgradable := &domain.WantedItem{MediaID: uuid.New(), Title: "Movie", Date: &older,
+		Quality: domain.FeedQuality720p, Cutoff: domain.FeedQuality1080p}
+	goodEnough := &domain.WantedItem{MediaID: uuid.New(), Title: "Other",
+		Quality: domain.FeedQuality1080p, Cutoff: domain.FeedQuality1080p}
+	suite.mockRepo.On("ListMissing", suite.ctx, (*uuid.UUID)(nil), mock.AnythingOfType("time.Time")).
+		Return([]*domain.WantedItem{missing}, nil)
+	suite.mockRepo.On("ListUpgradeCandidates", suite.ctx, (*uuid.UUID)(nil)).
+		Return([]*domain.WantedItem{upgradable, goodEnough}, nil)
+
+	// Act
+	items, total, err := wantedService.ListWanted(suite.ctx, "", nil, 1, 0)
+	cutoff, _, cutoffErr := wantedService.ListWanted(suite.ctx, domain.WantedCutoffUnmet, nil, 10, 0)
+	_, _, reasonErr := wantedService.ListWanted(suite.ctx, "upgrades", nil, 10, 0)
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Equal(2, total)
+	suite.Require().Len(items, 1)
+	suite.Equal(domain.WantedMissing, items[0].Reason, "newest first")
+
+	suite.Require().NoError(cutoffErr)
+	suite.Require().Len(cutoff, 1)
+	suite.Equal(upgradable.MediaID, cutoff[0].MediaID)
+	suite.Equal(domain.WantedCutoffUnmet, cutoff[0].Reason)
+
+	suite.True(errors.IsBadRequest(reasonErr))
+}
+
+func (suite *LibraryServiceTestSuite) TestWanted_SearchAndGrabRelease() {
+	// Arrange
+	episodeID := uuid.New()
+	item := &domain.WantedItem{MediaID: uuid.New(), Title: "Show", TVDBID: 42,
+		EpisodeID: &episodeID, SeasonNumber: 1, EpisodeNumber: 2}
+	indexer := &staticIndexer{name: "torznab", releases: []*domain.Release{
+		{Title: "Show.S01E02.720p.WEB", DownloadURL: "magnet:?xt=a", Seeders: 3},
+		{Title: "Show.S01E02.1080p.WEB", DownloadURL: "magnet:?xt=b", Seeders: 1},
+		{Title: "Show.S01E02.2160p.WEB", DownloadURL: "magnet:?xt=c", Seeders: 9},
+	}}
+	broken := &staticIndexer{name: "broken", err: errors.Internal("down")}
+	client := &recordingDownloadClient{}
+	clients, err := downloadclient.NewClients("", client)
+	suite.Require().NoError(err)
+	wantedService := service.NewWantedService(suite.mockRepo,
+		func() []domain.Indexer { return []domain.Indexer{broken, indexer} },
+		clients, suite.eventBus, logger.NewNoopLogger())
+	suite.mockRepo.On("GetWantedItem", suite.ctx, item.MediaID, &episodeID).Return(item, nil)
+	suite.mockRepo.On("FindBlocklisted", suite.ctx, mock.AnythingOfType("[]domain.ReleaseIdentity")).
+		Return([]*domain.BlocklistEntry{{ReleaseIdentity: domain.ReleaseIdentity{
+			Title: "Show.S01E02.2160p.WEB", Indexer: "torznab",
+		}, Reason: "fake"}}, nil)
+
+	// Act
+	releases, err := wantedService.SearchReleases(suite.ctx, item.MediaID, &episodeID)
+	suite.Require().NoError(err)
+	downloadID, grabErr := wantedService.GrabRelease(suite.ctx, item.MediaID, &episodeID, releases[0], "")
+	_, badURLErr := wantedService.GrabRelease(suite.ctx, item.MediaID, &episodeID,
+		&domain.Release{DownloadURL: "file:///etc/passwd"}, "")
+	_, blockedErr := wantedService.GrabRelease(suite.ctx, item.MediaID, &episodeID, releases[2], "")
+
+	// Assert
+	suite.Require().Len(releases, 3)
+	suite.Equal("Show.S01E02.1080p.WEB", releases[0].Title)
+	suite.Equal([]string{"blocklisted: fake"}, releases[2].Rejections)
+	suite.Equal(domain.ReleaseQuery{Query: "Show", TVDBID: "42", Season: 1, Episode: 2}, indexer.queries[0])
+
+	suite.Require().NoError(grabErr)
+	suite.Equal("hash", downloadID)
+	suite.Equal([]string{"magnet:?xt=b"}, client.added)
+	suite.True(errors.IsBadRequest(badURLErr))
+	suite.True(errors.IsBadRequest(blockedErr))
+}
+
+// failingDownloadClient is a download client that fails until it is fixed.
+type failingDownloadClient struct {
+	recordingDownloadClient
+	fixed bool
+}
+
+func (c *failingDownloadClient) Add(ctx context.Context, req downloadclient.AddRequest) (string, error) {
+	if !c.fixed {
+		return "", errors.Internal("connection refused")
+	}
+	return c.recordingDownloadClient.Add(ctx, req)
+}
+
+func (c *failingDownloadClient) List(context.Context, string) ([]*downloadclient.Status, error) {
+	if !c.fixed {
+		return nil, errors.Internal("connection refused")
+	}
+	return nil, nil
+}
+
+func (suite *LibraryServiceTestSuite) TestHealth_DisablesFailingComponentsAndRetests() {
+	// Arrange
+	health := service.NewHealthService(domain.HealthPolicy{
+		FailureThreshold:  2,
+		RetestInterval:    50 * time.Millisecond,
+		MaxRetestInterval: time.Second,
+	}, []string{"qbit"}, suite.eventBus, logger.NewNoopLogger())
+	disabled := make(chan map[string]interface{}, 2)
+	suite.Require().NoError(suite.eventBus.Subscribe("component.disabled",
+		events.NewConsumer("test", 1, func(_ context.Context, env *events.Envelope) error {
+			disabled <- env.Payload()
+			return nil
+		})))
+
+	broken := &staticIndexer{name: "broken", err: errors.Internal("down")}
+	working := &staticIndexer{name: "torznab"}
+	client := &failingDownloadClient{}
+	clients := health.Clients([]downloadclient.Client{client})
+
+	// Act
+	for range 2 {
+		for _, indexer := range health.Indexers([]domain.Indexer{broken, working}) {
+			_, _ = indexer.Search(suite.ctx, domain.ReleaseQuery{Query: "Show"})
+		}
+		_, _ = clients[0].Add(suite.ctx, downloadclient.AddRequest{URL: "magnet:?xt=a"})
+	}
+	indexers := health.Indexers([]domain.Indexer{broken, working})
+	_, refusedErr := clients[0].Add(suite.ctx, downloadclient.AddRequest{URL: "magnet:?xt=a"})
+
+	time.Sleep(60 * time.Millisecond)
+	client.fixed = true
+	health.Retest(suite.ctx)
+
+	// Assert
+	suite.Require().Len(indexers, 1)
+	suite.Equal("torznab", indexers[0].Name())
+	suite.ErrorIs(refusedErr, service.ErrComponentDisabled)
+	suite.Len(broken.queries, 2, "no calls once disabled")
+
+	var payloads []map[string]interface{}
+	for range 2 {
+		select {
+		case payload := <-disabled:
+			payloads = append(payloads, payload)
+		case <-time.After(time.Second):
+			suite.FailNow("component.disabled not published")
+		}
+	}
+	critical := map[string]bool{}
+	for _, payload := range payloads {
+		critical[payload["name"].(string)] = payload["critical"].(bool)
+	}
+	suite.Equal(map[string]bool{"broken": false, "qbit": true}, critical)
+
+	status := health.Status()
+	suite.Require().Len(status, 3)
+	suite.Equal("qbit", status[0].Name)
+	suite.False(status[0].Disabled(), "re-test passed")
+	suite.Equal(int64(1), status[0].Successes)
+	suite.Equal("broken", status[1].Name)
+	suite.True(status[1].Disabled())
+	suite.Equal(0.0, status[1].SuccessRate())
+	suite.Equal(1.0, status[2].SuccessRate())
+}
+
+func (suite *LibraryServiceTestSuite) TestPlaybackIssues_FlagMediaFailingToDecode() {
+	// Arrange
+	playback := service.NewPlaybackIssueService(suite.mockRepo,
+		domain.PlaybackFlagPolicy{ErrorRate: 0.2, MinSessions: 5}, 24*time.Hour,
+		suite.eventBus, logger.NewNoopLogger())
+	flagged := make(chan map[string]interface{}, 1)
+	suite.Require().NoError(suite.eventBus.Subscribe("media.playback_flagged",
+		events.NewConsumer("test", 1, func(_ context.Context, env *events.Envelope) error {
+			flagged <- env.Payload()
+			return nil
+		})))
+
+	media := testutil.CreateTestMedia(uuid.New(), "Movie", models.MediaTypeMovie)
+	stats := &domain.PlaybackIssueStats{MediaID: media.ID, Sessions: 10, ErrorSessions: 4, DecodeErrorSessions: 3}
+	suite.mockRepo.On("GetMedia", mock.Anything, media.ID).Return(media, nil)
+	suite.mockRepo.On("CreatePlaybackIssue", mock.Anything, mock.Anything).Return(nil).Twice()
+	suite.mockRepo.On("GetPlaybackIssueStats", mock.Anything, media.ID, mock.Anything).Return(stats, nil).Once()
+	suite.mockRepo.On("FlagPlayback", mock.Anything, mock.MatchedBy(func(flag *domain.PlaybackFlag) bool {
+		return flag.Reason == domain.PlaybackFlagVerify && flag.ErrorRate == 0.4
+	})).Return(true, nil).Once()
+
+	// Act
+	switchErr := playback.ReportIssue(suite.ctx, &domain.PlaybackIssue{
+		MediaID: media.ID, SessionID: "s1", Kind: domain.PlaybackIssueBitrateSwitch, ToBitrate: 8_000_000,
+	})
+	decodeErr := playback.ReportIssue(suite.ctx, &domain.PlaybackIssue{
+		MediaID: media.ID, SessionID: "s1", Kind: domain.PlaybackIssueDecodeError, Error: "corrupt macroblock",
+	})
+	invalidErr := playback.ReportIssue(suite.ctx, &domain.PlaybackIssue{MediaID: media.ID, Kind: domain.PlaybackIssueStall})
+
+	// Assert
+	suite.NoError(switchErr)
+	suite.NoError(decodeErr)
+	suite.True(errors.IsBadRequest(invalidErr), "issues need a session")
+	select {
+	case payload := <-flagged:
+		suite.Equal(media.ID.String(), payload["media_id"])
+		suite.Equal("verify", payload["reason"])
+	case <-time.After(time.Second):
+		suite.FailNow("media.playback_flagged not published")
+	}
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+func (suite *LibraryServiceTestSuite) TestTranscodePolicies_PrioritizeMediaLikelyToBeWatched() {
+	// Arrange
+	policies := service.NewTranscodePolicyService(suite.mockRepo, suite.eventBus, logger.NewNoopLogger()).
+		WithPriorities(domain.TranscodePriorityPolicy{Window: 14 * 24 * time.Hour, BackCatalogAge: 365 * 24 * time.Hour, PopularGenres: 3})
+	reprioritized := make(chan map[string]interface{}, 2)
+	suite.Require().NoError(suite.eventBus.Subscribe("transcode.reprioritized",
+		events.NewConsumer("test", 1, func(_ context.Context, env *events.Envelope) error {
+			reprioritized <- env.Payload()
+			return nil
+		})))
+
+	show, backCatalog, movie := uuid.New(), uuid.New(), uuid.New()
+	requests := []*domain.TranscodeRequest{
+		{MediaID: show, Key: "hls/ladder/1-1", Priority: domain.TranscodePriorityNormal},
+		{MediaID: backCatalog, Key: "hls/ladder/2-2", Priority: domain.TranscodePriorityLow},
+		{MediaID: movie, Key: "hls/ladder/3-3", Priority: domain.TranscodePriorityNormal},
+	}
+	old := time.Now().AddDate(-2, 0, 0)
+	suite.mockRepo.On("ListPopularGenres", mock.Anything, mock.Anything, 3).Return([]string{"Drama"}, nil).Once()
+	suite.mockRepo.On("ListTranscodeRequests", mock.Anything, 100, 0).Return(requests, nil).Once()
+	suite.mockRepo.On("GetTranscodePrioritySignals", mock.Anything, []uuid.UUID{show, backCatalog, movie}, mock.Anything).
+		Return([]*domain.TranscodePrioritySignals{
+			{MediaID: show, AddedAt: old, Watching: 1},
+			{MediaID: backCatalog, AddedAt: old},
+			{MediaID: movie, AddedAt: time.Now(), Genres: []string{"drama"}},
+		}, nil).Once()
+	suite.mockRepo.On("SetTranscodePriority", mock.Anything, show, "hls/ladder/1-1", domain.TranscodePriorityUrgent).
+		Return(nil).Once()
+	suite.mockRepo.On("SetTranscodePriority", mock.Anything, movie, "hls/ladder/3-3", domain.TranscodePriorityHigh).
+		Return(nil).Once()
+
+	// Act
+	changed, err := policies.Reprioritize(suite.ctx)
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Equal(2, changed, "demoted back catalog is left alone")
+	priorities := make(map[string]string)
+	for range 2 {
+		select {
+		case payload := <-reprioritized:
+			priorities[payload["media_id"].(string)] = payload["priority"].(string)
+		case <-time.After(time.Second):
+			suite.FailNow("transcode.reprioritized not published")
+		}
+	}
+	suite.Equal(map[string]string{show.String(): "urgent", movie.String(): "high"}, priorities)
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+func (suite *LibraryServiceTestSuite) TestImportStep_CompensationBlocklistsFailedRelease() {
+	// Arrange
+	wf := &saga.Workflow{
+		MediaID: uuid.New(),
+		Steps: []saga.StepRecord{
+			{Name: "download", Status: saga.StepStatusCompleted},
+			{Name: service.WorkflowStepImport, Status: saga.StepStatusFailed, Error: "not a video file"},
+		},
+		Data: map[string]string{
+			service.WorkflowDataReleaseTitle:    "Movie.2020.1080p",
+			service.WorkflowDataReleaseIndexer:  "torznab",
+			service.WorkflowDataReleaseInfoHash: "0123456789ABCDEF0123456789abcdef01234567",
+		},
+	}
+	suite.mockRepo.On("GetMedia", mock.Anything, wf.MediaID).Return(nil, errors.NotFound("media not found"))
+	var blocked *domain.BlocklistEntry
+	suite.mockRepo.On("AddBlocklistEntry", mock.Anything, mock.AnythingOfType("*domain.BlocklistEntry")).
+		Run(func(args mock.Arguments) { blocked = args.Get(1).(*domain.BlocklistEntry) }).
+		Return(nil).Once()
+
+	// Act
+	err := suite.libraryService.ImportStep().Compensate(suite.ctx, wf)
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Require().NotNil(blocked)
+	suite.Equal("0123456789abcdef0123456789abcdef01234567", blocked.InfoHash)
+	suite.Equal(domain.BlocklistSourceImportFailed, blocked.Source)
+	suite.Equal("not a video file", blocked.Reason)
+	suite.Equal(wf.MediaID, *blocked.MediaID)
+}
+
+func (suite *LibraryServiceTestSuite) TestImportStep_ParksAmbiguousDownload() {
+	// Arrange
+	downloads, root := suite.T().TempDir(), suite.T().TempDir()
+	source := filepath.Join(downloads, "Dune.BluRay.mkv")
+	suite.Require().NoError(os.WriteFile(source, []byte("movie"), 0o644))
+
+	library := &domain.Library{ID: uuid.New(), Name: "Movies", Path: root, Type: string(models.MediaTypeMovie)}
+	dune1984 := &models.Media{ID: uuid.New(), LibraryID: library.ID, Title: "Dune", Year: 1984}
+	dune2021 := &models.Media{ID: uuid.New(), LibraryID: library.ID, Title: "Dune", Year: 2021}
+	wf := &saga.Workflow{ID: uuid.New(), MediaID: uuid.New(), Data: map[string]string{
+		service.WorkflowDataLibraryID:      library.ID.String(),
+		service.WorkflowDataPath:           source,
+		service.WorkflowDataDownloadClient: "qbittorrent",
+	}}
+	suite.mockRepo.On("GetLibrary", mock.Anything, library.ID).Return(library, nil)
+	suite.mockRepo.On("GetMedia", mock.Anything, wf.MediaID).Return(nil, errors.NotFound("media not found"))
+	suite.mockRepo.On("SearchMedia", mock.Anything, "Dune", mock.Anything, (*string)(nil), &library.ID, 20, 0).
+		Return([]*models.Media{dune1984, dune2021}, nil)
+	var parked *domain.ManualImport
+	suite.mockRepo.On("CreateManualImport", mock.Anything, mock.AnythingOfType("*domain.ManualImport")).
+		Run(func(args mock.Arguments) {
+			parked = args.Get(1).(*domain.ManualImport)
+			parked.ID = uuid.New()
+		}).
+		Return(nil).Once()
+
+	// Act
+	err := suite.libraryService.ImportStep().Execute(suite.ctx, wf)
+
+	// Assert
+	suite.Require().ErrorIs(err, saga.ErrParked)
+	suite.Require().NotNil(parked)
+	suite.Equal(wf.ID, parked.WorkflowID)
+	suite.Equal(domain.ManualImportPending, parked.Status)
+	suite.Len(parked.Candidates, 2)
+	suite.Equal(parked.ID.String(), wf.Data[service.WorkflowDataManualImportID])
+	suite.Empty(wf.Data[service.WorkflowDataImportedPath], "nothing is placed in the library")
+	suite.mockRepo.AssertNotCalled(suite.T(), "CreateMedia", mock.Anything, mock.Anything)
+}
+
+func (suite *LibraryServiceTestSuite) TestImportStep_ReplacesWorseFile() {
+	// Arrange
+	downloads, root := suite.T().TempDir(), suite.T().TempDir()
+	source := filepath.Join(downloads, "Dune.2021.1080p.x265.mkv")
+	suite.Require().NoError(os.WriteFile(source, []byte("new movie"), 0o644))
+	existing := filepath.Join(root, "Dune (2021)", "Dune.2021.720p.mkv")
+	suite.Require().NoError(os.MkdirAll(filepath.Dir(existing), 0o755))
+	suite.Require().NoError(os.WriteFile(existing, []byte("old movie"), 0o644))
+
+	library := &domain.Library{ID: uuid.New(), Name: "Movies", Path: root, Type: string(models.MediaTypeMovie)}
+	dune := &models.Media{ID: uuid.New(), LibraryID: library.ID, Title: "Dune", Year: 2021,
+		FilePath: existing, Resolution: "1280x720", Status: string(models.MediaStatusAvailable)}
+	wf := &saga.Workflow{ID: uuid.New(), MediaID: uuid.New(), Data: map[string]string{
+		service.WorkflowDataLibraryID:      library.ID.String(),
+		service.WorkflowDataPath:           source,
+		service.WorkflowDataMatchedMediaID: dune.ID.String(),
+	}}
+	suite.libraryService.WithReplaceRules(domain.ReplaceRules{Auto: true}, "")
+	suite.mockRepo.On("GetLibrary", mock.Anything, library.ID).Return(library, nil)
+	suite.mockRepo.On("GetMedia", mock.Anything, wf.MediaID).Return(nil, errors.NotFound("media not found"))
+	suite.mockRepo.On("GetMedia", mock.Anything, dune.ID).Return(dune, nil)
+	suite.mockRepo.On("UpdateMedia", mock.Anything, dune).Return(nil).Once()
+
+	// Act
+	err := suite.libraryService.ImportStep().Execute(suite.ctx, wf)
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Equal(filepath.Join(root, "Dune.2021.1080p.x265.mkv"), dune.FilePath)
+	suite.Equal(domain.FeedQuality1080p, dune.Resolution)
+	suite.FileExists(dune.FilePath)
+	suite.NoFileExists(existing)
+	recycled, err := filepath.Glob(filepath.Join(root, domain.RecycleBinDir, "*", "Dune (2021)", "Dune.2021.720p.mkv"))
+	suite.Require().NoError(err)
+	suite.Len(recycled, 1, "the old file is kept in the recycle bin")
+}
+
+func (suite *LibraryServiceTestSuite) TestImportStep_ParksFileNotBetter() {
+	// Arrange
+	downloads, root := suite.T().TempDir(), suite.T().TempDir()
+	source := filepath.Join(downloads, "Dune.2021.720p.mkv")
+	suite.Require().NoError(os.WriteFile(source, []byte("new movie"), 0o644))
+	existing := filepath.Join(root, "Dune.2021.1080p.mkv")
+	suite.Require().NoError(os.WriteFile(existing, []byte("old movie"), 0o644))
+
+	library := &domain.Library{ID: uuid.New(), Name: "Movies", Path: root, Type: string(models.MediaTypeMovie)}
+	dune := &models.Media{ID: uuid.New(), LibraryID: library.ID, Title: "Dune", Year: 2021, FilePath: existing}
+	wf := &saga.Workflow{ID: uuid.New(), MediaID: uuid.New(), Data: map[string]string{
+		service.WorkflowDataLibraryID:      library.ID.String(),
+		service.WorkflowDataPath:           source,
+		service.WorkflowDataMatchedMediaID: dune.ID.String(),
+	}}
+	suite.libraryService.WithReplaceRules(domain.ReplaceRules{Auto: true}, "")
+	suite.mockRepo.On("GetLibrary", mock.Anything, library.ID).Return(library, nil)
+	suite.mockRepo.On("GetMedia", mock.Anything, wf.MediaID).Return(nil, errors.NotFound("media not found"))
+	suite.mockRepo.On("GetMedia", mock.Anything, dune.ID).Return(dune, nil)
+	var parked *domain.ManualImport
+	suite.mockRepo.On("CreateManualImport", mock.Anything, mock.AnythingOfType("*domain.ManualImport")).
+		Run(func(args mock.Arguments) {
+			parked = args.Get(1).(*domain.ManualImport)
+			parked.ID = uuid.New()
+		}).
+		Return(nil).Once()
+
+	// Act
+	err := suite.libraryService.ImportStep().Execute(suite.ctx, wf)
+
+	// Assert
+	suite.Require().ErrorIs(err, saga.ErrParked)
+	suite.Require().NotNil(parked)
+	suite.Require().NotNil(parked.Replacement)
+	suite.False(parked.Replacement.Replace)
+	suite.Equal(-1, parked.Replacement.Resolution)
+	suite.Equal([]domain.ImportCandidate{{MediaID: dune.ID, Title: "Dune", Year: 2021, Score: 1}}, parked.Candidates)
+	suite.FileExists(existing)
+	suite.Empty(wf.Data[service.WorkflowDataImportedPath], "nothing is placed in the library")
+}
+
+func (suite *LibraryServiceTestSuite) TestReplaceFile_RecyclesOldFile() {
+	// Arrange
+	downloads, root, bin := suite.T().TempDir(), suite.T().TempDir(), suite.T().TempDir()
+	source := filepath.Join(downloads, "Movie.2020.720p.mkv")
+	suite.Require().NoError(os.WriteFile(source, []byte("new movie"), 0o644))
+	existing := filepath.Join(root, "Movie.2020.1080p.mkv")
+	suite.Require().NoError(os.WriteFile(existing, []byte("old movie"), 0o644))
+
+	library := &domain.Library{ID: uuid.New(), Name: "Movies", Path: root}
+	media := &models.Media{ID: uuid.New(), LibraryID: library.ID, Title: "Movie", FilePath: existing,
+		Status: string(models.MediaStatusAvailable)}
+	suite.libraryService.WithReplaceRules(domain.ReplaceRules{}, bin)
+	suite.mockRepo.On("GetMedia", mock.Anything, media.ID).Return(media, nil)
+	suite.mockRepo.On("GetLibrary", mock.Anything, library.ID).Return(library, nil)
+	suite.mockRepo.On("UpdateMedia", mock.Anything, media).Return(nil).Once()
+
+	// Act
+	comparison, err := suite.libraryService.CompareFile(suite.ctx, media.ID, source)
+	suite.Require().NoError(err)
+	suite.False(comparison.Replace)
+	replaced, comparison, err := suite.libraryService.ReplaceFile(suite.ctx, media.ID, source, "")
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Equal("lower quality than the existing file", comparison.Reason)
+	suite.Equal(media.ID, replaced.ID, "the item keeps its ID and watch state")
+	suite.Equal(filepath.Join(root, "Movie.2020.720p.mkv"), replaced.FilePath)
+	suite.NoFileExists(existing)
+	recycled, err := filepath.Glob(filepath.Join(bin, library.ID.String(), "*", "Movie.2020.1080p.mkv"))
+	suite.Require().NoError(err)
+	suite.Len(recycled, 1)
+
+	_, _, err = suite.libraryService.ReplaceFile(suite.ctx, media.ID, "relative.mkv", "")
+	suite.True(errors.IsBadRequest(err))
+}
+
+func (suite *LibraryServiceTestSuite) TestResolveManualImport_ImportsIntoChosenItem() {
+	// Arrange
+	downloads, root := suite.T().TempDir(), suite.T().TempDir()
+	source := filepath.Join(downloads, "Dune.BluRay.mkv")
+	suite.Require().NoError(os.WriteFile(source, []byte("movie"), 0o644))
+
+	library := &domain.Library{ID: uuid.New(), Name: "Movies", Path: root, Type: string(models.MediaTypeMovie)}
+	dune := &models.Media{ID: uuid.New(), LibraryID: library.ID, Title: "Dune", Year: 2021,
+		Status: string(models.MediaStatusMissing)}
+	mi := &domain.ManualImport{ID: uuid.New(), LibraryID: library.ID, MediaID: uuid.New(), Path: source,
+		Status: domain.ManualImportPending}
+	suite.mockRepo.On("GetManualImport", mock.Anything, mi.ID).Return(mi, nil)
+	suite.mockRepo.On("GetLibrary", mock.Anything, library.ID).Return(library, nil)
+	suite.mockRepo.On("GetMedia", mock.Anything, dune.ID).Return(dune, nil)
+	suite.mockRepo.On("UpdateMedia", mock.Anything, dune).Return(nil).Once()
+	suite.mockRepo.On("ResolveManualImport", mock.Anything, mi).Return(nil).Once()
+
+	// Act
+	resolved, err := suite.libraryService.ResolveManualImport(suite.ctx, mi.ID, &dune.ID)
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Equal(domain.ManualImportImported, resolved.Status)
+	suite.Equal(dune.ID, *resolved.ImportedMediaID)
+	suite.Equal(filepath.Join(root, "Dune.BluRay.mkv"), dune.FilePath)
+	suite.Equal(string(models.MediaStatusAvailable), dune.Status)
+	suite.FileExists(dune.FilePath)
+
+	// Resolved imports cannot be resolved again
+	_, err = suite.libraryService.RejectManualImport(suite.ctx, mi.ID)
+	suite.True(errors.IsConflict(err))
+}
+
+func (suite *LibraryServiceTestSuite) TestPreviewScan() {
+	// Arrange
+	root := suite.T().TempDir()
+	repo := fake.NewLibraryRepository()
+	libraryService := service.NewLibraryService(repo, suite.eventBus, suite.cache, logger.NewNoopLogger())
+
+	library := &domain.Library{ID: uuid.New(), Name: "Movies", Path: root, Type: "movie", Enabled: true}
+	suite.Require().NoError(repo.CreateLibrary(suite.ctx, library))
+
+	writeFile := func(name string) string {
+		path := filepath.Join(root, name)
+		suite.Require().NoError(os.WriteFile(path, []byte("video"), 0o644))
+		return path
+	}
+	added := writeFile("The Matrix (1999).mkv")
+	modified := writeFile("Heat.1995.mkv")
+	unchanged := writeFile("Alien.1979.mkv")
+	removed := filepath.Join(root, "Gone.2001.mkv")
+
+	lastWeek := time.Now().Add(-7 * 24 * time.Hour)
+	for _, media := range []*models.Media{
+		// Known to the library without a file, so a match for the new file
+		{ID: uuid.New(), LibraryID: library.ID, Title: "The Matrix", Year: 1999, Type: models.MediaTypeMovie, Status: "wanted"},
+		{ID: uuid.New(), LibraryID: library.ID, Title: "Heat", Type: models.MediaTypeMovie, FilePath: modified, UpdatedAt: lastWeek},
+		{ID: uuid.New(), LibraryID: library.ID, Title: "Alien", Type: models.MediaTypeMovie, FilePath: unchanged},
+		{ID: uuid.New(), LibraryID: library.ID, Title: "Gone", Type: models.MediaTypeMovie, FilePath: removed},
+	} {
+		suite.Require().NoError(repo.CreateMedia(suite.ctx, media))
 	}
 
-	updates := map[string]interface{}{
-		"name":          "Updated Name",
-		"enabled":       false,
-		"scan_interval": 7200,
+	// Act
+	changes := make(map[string]*domain.ScanChange)
+	preview, err := libraryService.PreviewScan(suite.ctx, library.ID, func(change *domain.ScanChange) error {
+		changes[change.Path] = change
+		return nil
+	})
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Equal(&domain.ScanPreview{FilesFound: 3, Added: 1, Updated: 1, Removed: 1}, preview)
+	suite.Len(changes, 3)
+
+	suite.Require().Contains(changes, added)
+	suite.Equal(domain.ScanChangeAdded, changes[added].Kind)
+	suite.Equal(1999, changes[added].Year)
+	suite.Require().NotEmpty(changes[added].Candidates)
+	suite.Equal("The Matrix", changes[added].Candidates[0].Title)
+
+	suite.Require().Contains(changes, modified)
+	suite.Equal(domain.ScanChangeUpdated, changes[modified].Kind)
+	suite.Equal([]string{domain.ScanUpdateModified}, changes[modified].Reasons)
+
+	suite.Require().Contains(changes, removed)
+	suite.Equal(domain.ScanChangeRemoved, changes[removed].Kind)
+
+	// Nothing was written
+	media, err := repo.GetMediaByPaths(suite.ctx, []string{added})
+	suite.Require().NoError(err)
+	suite.Empty(media)
+}
+
+func (suite *LibraryServiceTestSuite) TestRename() {
+	// Arrange
+	root := suite.T().TempDir()
+	repo := fake.NewLibraryRepository()
+	libraryService := service.NewLibraryService(repo, suite.eventBus, suite.cache, logger.NewNoopLogger())
+
+	library := &domain.Library{ID: uuid.New(), Name: "Mixed", Path: root, Type: "movie", Enabled: true}
+	suite.Require().NoError(repo.CreateLibrary(suite.ctx, library))
+
+	writeFile := func(name string) string {
+		path := filepath.Join(root, name)
+		suite.Require().NoError(os.MkdirAll(filepath.Dir(path), 0o755))
+		suite.Require().NoError(os.WriteFile(path, []byte(name), 0o644))
+		return path
 	}
+	moviePath := writeFile("downloads/heat.1995.1080p.mkv")
+	episodePath := writeFile("Show.S01E01E02.mkv")
+	blockedPath := writeFile("alien.mkv")
+	writeFile("Alien (1979)/Alien (1979).mkv")
+
+	movie := &models.Media{ID: uuid.New(), LibraryID: library.ID, Title: "Heat", Year: 1995,
+		Type: models.MediaTypeMovie, FilePath: moviePath}
+	blocked := &models.Media{ID: uuid.New(), LibraryID: library.ID, Title: "Alien", Year: 1979,
+		Type: models.MediaTypeMovie, FilePath: blockedPath}
+	series := &models.Media{ID: uuid.New(), LibraryID: library.ID, Title: "Show", Type: models.MediaTypeSeries}
+	for _, media := range []*models.Media{movie, blocked, series} {
+		suite.Require().NoError(repo.CreateMedia(suite.ctx, media))
+	}
+	for _, number := range []int{2, 1} {
+		suite.Require().NoError(repo.CreateEpisode(suite.ctx, &models.Episode{
+			MediaID: series.ID, SeasonNumber: 1, EpisodeNumber: number, Title: "Pilot", Path: episodePath,
+		}))
+	}
+	ids := []uuid.UUID{movie.ID, blocked.ID, series.ID}
 
-	suite.mockRepo.On("GetLibrary", suite.ctx, libraryID).Return(existingLibrary, nil)
-	suite.mockRepo.On("UpdateLibrary", suite.ctx, mock.AnythingOfType("*domain.Library")).Return(nil)
+	// Act
+	preview, err := libraryService.PreviewRename(suite.ctx, ids)
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Require().Len(preview.Files, 4)
+	suite.Equal(1, preview.Conflicts)
+	newPaths := make(map[string]string)
+	for _, file := range preview.Files {
+		newPaths[file.Path] = file.NewPath
+		if file.Path == blockedPath {
+			suite.Equal("a file already exists at the new path", file.Conflict)
+		}
+	}
+	suite.Equal(filepath.Join(root, "Heat (1995)/Heat (1995) [1080p].mkv"), newPaths[moviePath])
+	suite.Equal(filepath.Join(root, "Show/Season 01/Show - S01E01-02 - Pilot.mkv"), newPaths[episodePath])
+	suite.FileExists(moviePath, "previews do not rename")
 
 	// Act
-	updatedLibrary, err := suite.libraryService.UpdateLibrary(suite.ctx, libraryID, updates)
+	renameTask, err := libraryService.ApplyRename(suite.ctx, ids)
+	suite.Require().NoError(err)
+	suite.Eventually(func() bool {
+		t, err := libraryService.Tasks().Get(suite.ctx, renameTask.ID)
+		return err == nil && t.Status.Finished()
+	}, 5*time.Second, 10*time.Millisecond)
 
 	// Assert
+	t, err := libraryService.Tasks().Get(suite.ctx, renameTask.ID)
 	suite.Require().NoError(err)
-	suite.Equal("Updated Name", updatedLibrary.Name)
-	suite.False(updatedLibrary.Enabled)
-	suite.Equal(7200, updatedLibrary.ScanInterval)
+	suite.Equal(task.StatusCompleted, t.Status)
+
+	suite.NoFileExists(moviePath)
+	suite.NoDirExists(filepath.Join(root, "downloads"), "emptied directories are removed")
+	suite.FileExists(newPaths[moviePath])
+	suite.FileExists(newPaths[episodePath])
+	suite.FileExists(blockedPath, "conflicting files are skipped")
+
+	renamed, err := repo.GetMedia(suite.ctx, movie.ID)
+	suite.Require().NoError(err)
+	suite.Equal(newPaths[moviePath], renamed.FilePath)
+	episodes, err := repo.ListEpisodesByMedia(suite.ctx, series.ID)
+	suite.Require().NoError(err)
+	for _, ep := range episodes {
+		suite.Equal(newPaths[episodePath], ep.Path)
+	}
+
+	_, err = libraryService.PreviewRename(suite.ctx, nil)
+	suite.True(errors.IsBadRequest(err))
 }
 
-func (suite *LibraryServiceTestSuite) TestDeleteLibrary_Success() {
+func (suite *LibraryServiceTestSuite) TestEpisodeFiles() {
 	// Arrange
-	libraryID := uuid.New()
-	library := &domain.Library{
-		ID:   libraryID,
-		Name: "To Delete",
+	downloads, root := suite.T().TempDir(), suite.T().TempDir()
+	repo := fake.NewLibraryRepository()
+	libraryService := service.NewLibraryService(repo, suite.eventBus, suite.cache, logger.NewNoopLogger())
+
+	library := &domain.Library{ID: uuid.New(), Name: "TV", Path: root, Type: string(models.MediaTypeSeries)}
+	suite.Require().NoError(repo.CreateLibrary(suite.ctx, library))
+	series := &models.Media{ID: uuid.New(), LibraryID: library.ID, Title: "Show", Type: models.MediaTypeSeries,
+		Status: string(models.MediaStatusMissing)}
+	suite.Require().NoError(repo.CreateMedia(suite.ctx, series))
+	episodes := make(map[int]*models.Episode)
+	for number, duration := range map[int]int{1: 1200, 2: 1500, 3: 2400} {
+		ep := &models.Episode{MediaID: series.ID, SeasonNumber: 1, EpisodeNumber: number, Duration: duration}
+		suite.Require().NoError(repo.CreateEpisode(suite.ctx, ep))
+		episodes[number] = ep
 	}
 
-	suite.mockRepo.On("GetLibrary", suite.ctx, libraryID).Return(library, nil)
-	suite.mockRepo.On("DeleteLibrary", suite.ctx, libraryID).Return(nil)
+	importFile := func(name string) string {
+		source := filepath.Join(downloads, name)
+		suite.Require().NoError(os.WriteFile(source, []byte(name), 0o644))
+		mi := &domain.ManualImport{ID: uuid.New(), LibraryID: library.ID, MediaID: uuid.New(), Path: source,
+			Status: domain.ManualImportPending}
+		suite.Require().NoError(repo.CreateManualImport(suite.ctx, mi))
+		_, err := libraryService.ResolveManualImport(suite.ctx, mi.ID, &series.ID)
+		suite.Require().NoError(err)
+		return filepath.Join(root, name)
+	}
 
 	// Act
-	err := suite.libraryService.DeleteLibrary(suite.ctx, libraryID)
+	double := importFile("Show.S01E01-E02.mkv")
+	part2 := importFile("Show.S01E03.Part.2.mkv")
+	part1 := importFile("Show.S01E03.Part.1.mkv")
+
+	// Assert
+	files, err := libraryService.ListEpisodeFiles(suite.ctx, series.ID)
+	suite.Require().NoError(err)
+	suite.Require().Len(files, 4)
+	parts := make(map[uuid.UUID][]string)
+	for _, file := range files {
+		parts[file.EpisodeID] = append(parts[file.EpisodeID], file.Path)
+	}
+	suite.Equal([]string{double}, parts[episodes[1].ID])
+	suite.Equal([]string{double}, parts[episodes[2].ID])
+	suite.Equal([]string{part1, part2}, parts[episodes[3].ID], "parts are kept in order")
+
+	ep3, err := repo.GetEpisode(suite.ctx, episodes[3].ID)
+	suite.Require().NoError(err)
+	suite.Equal(part1, ep3.Path, "episodes point at their first part")
+	media, err := repo.GetMedia(suite.ctx, series.ID)
+	suite.Require().NoError(err)
+	suite.Empty(media.FilePath, "episode files are not the file of the series")
+	suite.Equal(string(models.MediaStatusAvailable), media.Status)
+
+	// Act: watch into the second episode of the double episode file
+	userID := uuid.New()
+	states, err := libraryService.RecordWatchProgress(suite.ctx, userID, series.ID, &episodes[1].ID, 1200+300)
 
 	// Assert
 	suite.Require().NoError(err)
+	suite.Require().Len(states, 2)
+	suite.Equal(episodes[1].ID, *states[0].EpisodeID)
+	suite.True(states[0].Completed)
+	suite.Equal(episodes[2].ID, *states[1].EpisodeID)
+	suite.Equal(300, states[1].Position)
+	suite.False(states[1].Completed)
+
+	recorded, err := repo.ListWatchStatesByUser(suite.ctx, userID)
+	suite.Require().NoError(err)
+	suite.Len(recorded, 2)
+
+	_, err = libraryService.RecordWatchProgress(suite.ctx, userID, series.ID, &episodes[1].ID, -1)
+	suite.True(errors.IsBadRequest(err))
+
+	// Split episodes are not renamed
+	rename, err := libraryService.PreviewRename(suite.ctx, []uuid.UUID{series.ID})
+	suite.Require().NoError(err)
+	for _, file := range rename.Files {
+		if *file.EpisodeID == episodes[3].ID {
+			suite.Equal("episode is split across several files", file.Conflict)
+		}
+	}
 }
 
-func (suite *LibraryServiceTestSuite) TestScanLibrary_Success() {
+func (suite *LibraryServiceTestSuite) TestMusicVideos() {
 	// Arrange
-	libraryID := uuid.New()
-	library := &domain.Library{
-		ID:      libraryID,
-		Name:    "Test Library",
-		Path:    "/test/path",
-		Type:    "movie",
-		Enabled: true,
+	videoRoot, musicRoot := suite.T().TempDir(), suite.T().TempDir()
+	repo := fake.NewLibraryRepository()
+	libraryService := service.NewLibraryService(repo, suite.eventBus, suite.cache, logger.NewNoopLogger())
+
+	videos := &domain.Library{Name: "Music Videos", Path: videoRoot, Type: string(models.MediaTypeMusicVideo)}
+	suite.Require().NoError(libraryService.CreateLibrary(suite.ctx, videos))
+	music := &domain.Library{Name: "Music", Path: musicRoot, Type: string(models.MediaTypeMusic)}
+	suite.Require().NoError(libraryService.CreateLibrary(suite.ctx, music))
+
+	writeFile := func(root, name string) string {
+		path := filepath.Join(root, name)
+		suite.Require().NoError(os.MkdirAll(filepath.Dir(path), 0o755))
+		suite.Require().NoError(os.WriteFile(path, []byte(name), 0o644))
+		return path
 	}
-
-	suite.mockRepo.On("GetLibrary", suite.ctx, libraryID).Return(library, nil)
-	suite.mockRepo.On("CreateScanHistory", mock.Anything, mock.AnythingOfType("*domain.ScanResult")).Return(nil).Maybe()
-	suite.mockRepo.On("UpdateLibrary", mock.Anything, mock.AnythingOfType("*domain.Library")).Return(nil).Maybe()
-	suite.mockRepo.On("UpdateScanHistory", mock.Anything, mock.AnythingOfType("*domain.ScanResult")).Return(nil).Maybe()
-	suite.mockRepo.On("GetMediaByPath", mock.Anything, mock.AnythingOfType("string")).
-		Return(nil, errors.NotFound("not found")).
-		Maybe()
+	video := writeFile(videoRoot, "Nirvana - Smells Like Teen Spirit (1991).mp4")
+	concert := writeFile(videoRoot, "Concerts/Nirvana - Live at Reading (1992).mkv")
+	track := writeFile(musicRoot, "Nirvana/Nevermind/01 Smells Like Teen Spirit.flac")
 
 	// Act
-	err := suite.libraryService.ScanLibrary(suite.ctx, libraryID)
+	for _, library := range []*domain.Library{videos, music} {
+		_, err := libraryService.ScanLibrary(suite.ctx, library.ID, true)
+		suite.Require().NoError(err)
+	}
+	suite.Require().Eventually(func() bool {
+		media, err := repo.GetMediaByPaths(suite.ctx, []string{video, concert, track})
+		return err == nil && len(media) == 3
+	}, 5*time.Second, 10*time.Millisecond)
 
 	// Assert
+	policies, err := repo.ListTranscodePolicies(suite.ctx, videos.ID)
 	suite.Require().NoError(err)
-	// Scan runs asynchronously, so we just verify it started
+	suite.Len(policies, 2)
+	policies, err = repo.ListTranscodePolicies(suite.ctx, music.ID)
+	suite.Require().NoError(err)
+	suite.Empty(policies)
+
+	artist, err := libraryService.GetArtist(suite.ctx, "nirvana")
+	suite.Require().NoError(err)
+	suite.Equal("Nirvana", artist.Name)
+	suite.Require().Len(artist.Tracks, 1)
+	suite.Equal(track, artist.Tracks[0].FilePath)
+	suite.Require().Len(artist.MusicVideos, 2)
+	suite.Equal("Live At Reading", artist.MusicVideos[0].Title)
+	suite.Equal([]string{domain.MusicVideoTagConcert}, artist.MusicVideos[0].Tags)
+	suite.Equal("Smells Like Teen Spirit", artist.MusicVideos[1].Title)
+	suite.Equal(1991, artist.MusicVideos[1].Year)
+	suite.Empty(artist.MusicVideos[1].Tags)
+
+	_, err = libraryService.GetArtist(suite.ctx, "Pearl Jam")
+	suite.True(errors.IsNotFound(err))
 }
 
-// TestScanLibrary_AlreadyScanning - Commenting out due to race condition in test
-// This test is flaky because the scan completes too quickly when scanning a non-existent path
-// func (suite *LibraryServiceTestSuite) TestScanLibrary_AlreadyScanning() { //nolint:funlen
-// 	// Arrange
-// 	libraryID := uuid.New()
-// 	library := &domain.Library{
-// 		ID:      libraryID,
-// 		Name:    "Test Library",
-// 		Path:    "/test/path",
-// 		Type:    "movie",
-// 		Enabled: true,
-// 	}
-//
-// 	suite.mockRepo.On("GetLibrary", suite.ctx, libraryID).Return(library, nil).Twice()
-// 	suite.mockRepo.On("CreateScanHistory", mock.Anything, mock.AnythingOfType("*domain.ScanResult")).Return(nil).Maybe()
-// 	suite.mockRepo.On("UpdateLibrary", mock.Anything, mock.AnythingOfType("*domain.Library")).Return(nil).Maybe()
-// 	suite.mockRepo.On("UpdateScanHistory", mock.Anything, mock.AnythingOfType("*domain.ScanResult")).Return(nil).Maybe()
-// 	suite.mockRepo.On("GetMediaByPath", mock.Anything, mock.AnythingOfType("string")).Return(nil, errors.NotFound("not found")).Maybe()
-//
-// 	// Start first scan
-// 	err := suite.libraryService.ScanLibrary(suite.ctx, libraryID)
-// 	require.NoError(suite.T(), err)
-//
-// 	// Sleep briefly to ensure the goroutine starts
-// 	time.Sleep(50 * time.Millisecond)
-//
-// 	// Act - Try to start another scan
-// 	err = suite.libraryService.ScanLibrary(suite.ctx, libraryID)
-//
-// 	// Assert
-// 	require.Error(suite.T(), err)
-// 	assert.True(suite.T(), errors.IsConflict(err))
-// }
+// stubMalwareScanner flags files whose name contains a marker.
+type stubMalwareScanner struct {
+	marker string
+}
 
-func (suite *LibraryServiceTestSuite) TestGetMedia_Success() {
+func (s stubMalwareScanner) Name() string {
+	return "stub"
+}
+
+func (s stubMalwareScanner) Scan(_ context.Context, path string) (*domain.MalwareScan, error) {
+	if strings.Contains(filepath.Base(path), s.marker) {
+		return &domain.MalwareScan{Scanner: "stub", Verdict: domain.MalwareVerdictInfected,
+			Threat: "Win.Trojan.Agent", Path: path}, nil
+	}
+	return &domain.MalwareScan{Scanner: "stub", Verdict: domain.MalwareVerdictClean}, nil
+}
+
+func (suite *LibraryServiceTestSuite) TestMalwareScanStep_QuarantinesInfectedDownload() {
 	// Arrange
-	mediaID := uuid.New()
-	expectedMedia := testutil.CreateTestMedia(uuid.New(), "Test Movie", models.MediaTypeMovie)
-	expectedMedia.ID = mediaID
+	downloads, root, quarantine := suite.T().TempDir(), suite.T().TempDir(), suite.T().TempDir()
+	source := filepath.Join(downloads, "Dune.2021.1080p.mkv.exe")
+	suite.Require().NoError(os.WriteFile(source, []byte("payload"), 0o755))
+
+	repo := fake.NewLibraryRepository()
+	libraryService := service.NewLibraryService(repo, suite.eventBus, suite.cache, logger.NewNoopLogger()).
+		WithMalwareScanner(stubMalwareScanner{marker: ".exe"}, quarantine)
+	library := &domain.Library{Name: "Movies", Path: root, Type: string(models.MediaTypeMovie)}
+	suite.Require().NoError(libraryService.CreateLibrary(suite.ctx, library))
+
+	notified := make(chan map[string]interface{}, 1)
+	suite.Require().NoError(suite.eventBus.Subscribe("download.quarantined",
+		events.NewConsumer("test.quarantined", 1, func(_ context.Context, env *events.Envelope) error {
+			notified <- env.Payload()
+			return nil
+		})))
 
-	suite.mockRepo.On("GetMedia", suite.ctx, mediaID).Return(expectedMedia, nil)
+	// Act
+	wf, err := libraryService.RunMediaWorkflow(suite.ctx, uuid.New(), map[string]string{
+		service.WorkflowDataLibraryID:      library.ID.String(),
+		service.WorkflowDataPath:           source,
+		service.WorkflowDataReleaseTitle:   "Dune.2021.1080p.WEB",
+		service.WorkflowDataReleaseIndexer: "nyaa",
+	}, libraryService.MalwareScanStep(), libraryService.ImportStep())
+
+	// Assert
+	suite.Require().Error(err)
+	suite.Equal(1, wf.Steps[0].Attempts, "infected downloads are not rescanned")
+	suite.Equal(saga.StepStatusPending, wf.Steps[1].Status, "infected downloads are not imported")
+	suite.Equal(string(domain.MalwareVerdictInfected), wf.Data[service.WorkflowDataMalwareVerdict])
+	suite.Equal("Win.Trojan.Agent", wf.Data[service.WorkflowDataMalwareThreat])
+
+	quarantined := filepath.Join(quarantine, wf.ID.String(), "Dune.2021.1080p.mkv.exe")
+	suite.Equal(quarantined, wf.Data[service.WorkflowDataQuarantinedPath])
+	suite.NoFileExists(source)
+	info, err := os.Stat(quarantined)
+	suite.Require().NoError(err)
+	suite.Equal(os.FileMode(0o400), info.Mode().Perm())
+
+	entries, _, err := repo.ListBlocklist(suite.ctx, 10, 0)
+	suite.Require().NoError(err)
+	suite.Require().Len(entries, 1)
+	suite.Equal(domain.BlocklistSourceMalware, entries[0].Source)
+	suite.Equal("Dune.2021.1080p.WEB", entries[0].Title)
+
+	select {
+	case payload := <-notified:
+		suite.Equal("Win.Trojan.Agent", payload["threat"])
+		suite.Equal(quarantined, payload["quarantined_path"])
+	case <-time.After(5 * time.Second):
+		suite.Fail("no security notification was published")
+	}
+}
+
+func (suite *LibraryServiceTestSuite) TestMalwareScanStep_PassesCleanDownload() {
+	// Arrange
+	source := filepath.Join(suite.T().TempDir(), "Dune.2021.1080p.mkv")
+	suite.Require().NoError(os.WriteFile(source, []byte("movie"), 0o644))
+	suite.libraryService.WithMalwareScanner(stubMalwareScanner{marker: ".exe"}, "")
+	wf := &saga.Workflow{ID: uuid.New(), MediaID: uuid.New(), Data: map[string]string{
+		service.WorkflowDataPath: source,
+	}}
 
 	// Act
-	media, err := suite.libraryService.GetMedia(suite.ctx, mediaID)
+	err := suite.libraryService.MalwareScanStep().Execute(suite.ctx, wf)
 
 	// Assert
 	suite.Require().NoError(err)
-	suite.Equal(expectedMedia, media)
+	suite.Equal(string(domain.MalwareVerdictClean), wf.Data[service.WorkflowDataMalwareVerdict])
+	suite.FileExists(source)
 }
 
-func (suite *LibraryServiceTestSuite) TestSearchMedia_Success() {
+func (suite *LibraryServiceTestSuite) TestShareLinks_LimitViewsAndRevoke() {
 	// Arrange
-	libraryID := uuid.New()
-	mediaType := string(models.MediaTypeMovie)
-	status := "available"
+	repo := fake.NewLibraryRepository()
+	jwtManager := auth.NewJWTManager("access", "refresh", "narwhal", time.Hour, time.Hour)
+	shares := service.NewShareLinkService(repo, jwtManager, domain.ShareLinkPolicy{
+		MaxTTL: 24 * time.Hour, MaxBitrate: 4000, StreamTTL: time.Hour,
+	}, suite.eventBus, logger.NewNoopLogger())
+	media := testutil.CreateTestMedia(uuid.New(), "Movie", models.MediaTypeMovie)
+	suite.Require().NoError(repo.CreateMedia(suite.ctx, media))
+	owner, other := uuid.New(), uuid.New()
 
-	expectedMedia := []*models.Media{
-		testutil.CreateTestMedia(libraryID, "Movie 1", models.MediaTypeMovie),
-		testutil.CreateTestMedia(libraryID, "Movie 2", models.MediaTypeMovie),
-	}
+	// Act
+	link, token, err := shares.Create(suite.ctx, owner, media.ID, 2*time.Hour, 1, 20000)
+	suite.Require().NoError(err)
+	grant, redeemErr := shares.Redeem(suite.ctx, token, "203.0.113.7", "curl/8")
+	_, exhaustedErr := shares.Redeem(suite.ctx, token, "203.0.113.7", "curl/8")
+	_, _, tooLongErr := shares.Create(suite.ctx, owner, media.ID, 48*time.Hour, 0, 0)
+	_, foreignErr := shares.Revoke(suite.ctx, other, false, link.ID)
+	revoked, revokeErr := shares.Revoke(suite.ctx, owner, false, link.ID)
+	plays, total, playsErr := shares.ListPlays(suite.ctx, owner, false, link.ID, 10, 0)
 
-	suite.mockRepo.On("SearchMedia", suite.ctx, "test", &mediaType, &status, &libraryID, 50, 0).
-		Return(expectedMedia, nil)
+	// Assert
+	suite.Equal(4000, link.MaxBitrate, "bitrates are capped")
+	suite.Require().NoError(redeemErr)
+	suite.Equal(1, grant.Link.Views)
+	claims, err := jwtManager.ValidateAccessToken(grant.StreamToken)
+	suite.Require().NoError(err)
+	suite.True(claims.IsShare())
+	suite.Equal(media.ID.String(), claims.Share.MediaID)
+	suite.Equal(4000, claims.Share.MaxBitrate)
+	suite.WithinDuration(time.Now().Add(time.Hour), grant.ExpiresAt, time.Minute)
+
+	suite.True(errors.IsForbidden(exhaustedErr), "links stop after their views")
+	suite.True(errors.IsBadRequest(tooLongErr))
+	suite.True(errors.IsNotFound(foreignErr), "users only revoke their own links")
+	suite.Require().NoError(revokeErr)
+	suite.Equal(domain.ShareLinkRevoked, revoked.Status(time.Now()))
+	suite.Require().NoError(playsErr)
+	suite.Equal(int64(1), total)
+	suite.Equal("203.0.113.7", plays[0].IPAddress)
+}
+
+func (suite *LibraryServiceTestSuite) TestKiosks_DisplayAndWatchLibraries() {
+	// Arrange
+	repo := fake.NewLibraryRepository()
+	jwtManager := auth.NewJWTManager("access", "refresh", "narwhal", time.Hour, time.Hour)
+	kiosks := service.NewKioskService(repo, jwtManager, time.Hour, time.Hour, suite.eventBus, logger.NewNoopLogger())
+	lobby := &domain.Library{Name: "Lobby", Path: "/lobby", Type: "movie", Enabled: true}
+	private := &domain.Library{Name: "Private", Path: "/private", Type: "movie", Enabled: true}
+	suite.Require().NoError(repo.CreateLibrary(suite.ctx, lobby))
+	suite.Require().NoError(repo.CreateLibrary(suite.ctx, private))
+
+	playing := testutil.CreateTestMedia(lobby.ID, "Heat", models.MediaTypeMovie)
+	hidden := testutil.CreateTestMedia(private.ID, "Home Videos", models.MediaTypeMovie)
+	for _, m := range []*models.Media{playing, hidden} {
+		suite.Require().NoError(repo.CreateMedia(suite.ctx, m))
+		suite.Require().NoError(repo.UpsertWatchState(suite.ctx, &models.WatchHistory{
+			UserID: uuid.New(), MediaID: m.ID, Position: 600, Duration: 1200, LastWatched: time.Now(),
+		}))
+	}
+	adminID := uuid.New()
 
 	// Act
-	results, err := suite.libraryService.SearchMedia(suite.ctx, "test", &mediaType, &status, &libraryID, 50, 0)
+	_, _, unnamedErr := kiosks.Create(suite.ctx, adminID, " ", nil)
+	kiosk, key, err := kiosks.Create(suite.ctx, adminID, "Lobby screen", []uuid.UUID{lobby.ID})
+	suite.Require().NoError(err)
+	token, _, redeemErr := kiosks.Redeem(suite.ctx, key)
+	suite.Require().NoError(redeemErr)
+	claims, err := jwtManager.ValidateAccessToken(token)
+	suite.Require().NoError(err)
+	authorized, authorizeErr := kiosks.Authorize(suite.ctx, claims)
+	suite.Require().NoError(authorizeErr)
+	snapshot, displayErr := kiosks.Display(suite.ctx, authorized)
+
+	ctx, cancel := context.WithCancel(suite.ctx)
+	defer cancel()
+	snapshots, watchErr := kiosks.Watch(ctx, authorized)
+	suite.Require().NoError(watchErr)
+	first := <-snapshots
+	added := testutil.CreateTestMedia(lobby.ID, "Collateral", models.MediaTypeMovie)
+	suite.Require().NoError(repo.CreateMedia(suite.ctx, added))
+	suite.Require().NoError(suite.eventBus.Publish(suite.ctx, domain.NewMediaAddedEvent(added)))
 
 	// Assert
+	suite.True(errors.IsBadRequest(unnamedErr))
+	suite.True(claims.IsKiosk())
+	suite.Equal([]string{lobby.ID.String()}, claims.Kiosk.LibraryIDs)
+	suite.Equal(kiosk.ID, authorized.ID)
+
+	suite.Require().NoError(displayErr)
+	suite.Require().Len(snapshot.NowPlaying, 1, "only the kiosk's libraries are shown")
+	suite.Equal("Heat", snapshot.NowPlaying[0].Title)
+	suite.InDelta(0.5, snapshot.NowPlaying[0].Progress, 0.001)
+	suite.Require().Len(snapshot.RecentlyAdded, 1)
+	suite.True(first.Equal(snapshot))
+
+	select {
+	case pushed := <-snapshots:
+		suite.Require().Len(pushed.RecentlyAdded, 2, "new media is pushed right away")
+		suite.Equal("Collateral", pushed.RecentlyAdded[0].Title)
+	case <-time.After(time.Second):
+		suite.Fail("new media was not pushed")
+	}
+
+	_, err = kiosks.Revoke(suite.ctx, adminID, kiosk.ID)
 	suite.Require().NoError(err)
-	suite.Len(results, 2)
+	_, _, revokedErr := kiosks.Redeem(suite.ctx, key)
+	suite.True(errors.IsForbidden(revokedErr), "revoked kiosks cannot redeem their key")
+	_, staleErr := kiosks.Authorize(suite.ctx, claims)
+	suite.True(errors.IsForbidden(staleErr), "tokens of revoked kiosks stop reading the display")
 }
 
-func (suite *LibraryServiceTestSuite) TestUpdateMedia_Success() {
+func (suite *LibraryServiceTestSuite) TestAnalytics_CompletionRetentionAndRewatches() {
 	// Arrange
-	mediaID := uuid.New()
-	existingMedia := testutil.CreateTestMedia(uuid.New(), "Original Title", models.MediaTypeMovie)
-	existingMedia.ID = mediaID
+	repo := fake.NewLibraryRepository()
+	libraryService := service.NewLibraryService(repo, suite.eventBus, suite.cache, logger.NewNoopLogger())
+	analytics := service.NewAnalyticsService(repo, logger.NewNoopLogger())
+	library := &domain.Library{Name: "Movies", Path: "/movies", Type: "movie", Enabled: true}
+	suite.Require().NoError(repo.CreateLibrary(suite.ctx, library))
+
+	watched := testutil.CreateTestMedia(library.ID, "Heat", models.MediaTypeMovie)
+	unwatched := testutil.CreateTestMedia(library.ID, "Dud", models.MediaTypeMovie)
+	for _, m := range []*models.Media{watched, unwatched} {
+		suite.Require().NoError(repo.CreateMedia(suite.ctx, m))
+	}
+	finisher, quitter := uuid.New(), uuid.New()
+
+	// Act: one user finishes the hour-long title and starts it again, the
+	// other stops a quarter in
+	for _, heartbeat := range []struct {
+		userID   uuid.UUID
+		position int
+	}{
+		{finisher, 600}, {finisher, 1800}, {finisher, 3300}, {finisher, 3400}, {finisher, 120},
+		{quitter, 300}, {quitter, 900},
+	} {
+		_, err := libraryService.RecordWatchProgress(suite.ctx, heartbeat.userID, watched.ID, nil, heartbeat.position)
+		suite.Require().NoError(err)
+	}
 
-	updates := map[string]interface{}{
-		"title":       "Updated Title",
-		"description": "New description",
-		"tags":        []string{"action", "drama"},
+	stats, total, listErr := analytics.ListTitleStats(suite.ctx, domain.AnalyticsFilter{}, 10, 0)
+	title, getErr := analytics.GetTitleAnalytics(suite.ctx, watched.ID, nil, time.Time{})
+	_, _, sortErr := analytics.ListTitleStats(suite.ctx, domain.AnalyticsFilter{Sort: "alphabetical"}, 10, 0)
+
+	// Assert
+	suite.Require().NoError(listErr)
+	suite.Equal(int64(2), total)
+	suite.Require().Len(stats, 2)
+	suite.Equal(unwatched.ID, stats[0].MediaID, "titles nobody watched lead")
+	suite.Zero(stats[0].Viewings)
+
+	suite.Require().NoError(getErr)
+	suite.Equal("Heat", title.Title)
+	suite.Equal(int64(3), title.Viewings, "credits do not start a viewing, going back to the start does")
+	suite.Equal(int64(2), title.Viewers)
+	suite.Equal(int64(1), title.Completions)
+	suite.Equal(int64(1), title.Rewatches)
+	suite.InDelta(1.0/3, title.CompletionRate(), 0.001)
+	suite.InDelta((1+120.0/3600+0.25)/3, title.AverageWatched, 0.001)
+	suite.InDelta(1, title.Retention[0], 0.001)
+	suite.InDelta(1.0/3, title.Retention[domain.RetentionBuckets-1], 0.001)
+	suite.Require().Len(title.DropOffs, 2)
+	suite.InDelta(0.25, title.DropOffs[1].Position, 0.001)
+
+	suite.True(errors.IsBadRequest(sortErr))
+}
+
+func (suite *LibraryServiceTestSuite) TestPrune_SuggestsCopiesAndRecyclesThem() {
+	// Arrange
+	root, bin := suite.T().TempDir(), suite.T().TempDir()
+	repo := fake.NewLibraryRepository()
+	libraryService := service.NewLibraryService(repo, suite.eventBus, suite.cache, logger.NewNoopLogger()).
+		WithReplaceRules(domain.ReplaceRules{}, bin).
+		WithPrunePolicy(domain.PrunePolicy{UnwatchedFor: 90 * 24 * time.Hour})
+	library := &domain.Library{Name: "Movies", Path: root, Type: "movie", Enabled: true}
+	suite.Require().NoError(repo.CreateLibrary(suite.ctx, library))
+
+	movie := func(title, name string, size int64, added time.Time) *models.Media {
+		m := testutil.CreateTestMedia(library.ID, title, models.MediaTypeMovie)
+		m.FilePath = filepath.Join(root, name)
+		m.FileSize = size
+		m.Resolution = "" // quality is parsed from the name
+		m.CreatedAt = added
+		suite.Require().NoError(os.WriteFile(m.FilePath, []byte(name), 0o644))
+		suite.Require().NoError(repo.CreateMedia(suite.ctx, m))
+		return m
 	}
+	longAgo := time.Now().Add(-365 * 24 * time.Hour)
+	best := movie("Heat", "Heat (1995) 1080p.mkv", 8<<30, time.Now())
+	worse := movie("Heat", "Heat (1995) 720p.mkv", 4<<30, time.Now())
+	stale := movie("Dud", "Dud (2001).mkv", 2<<30, longAgo)
+	loved := movie("Loved", "Loved (1999).mkv", 6<<30, longAgo)
+	_, err := libraryService.RecordWatchProgress(suite.ctx, uuid.New(), loved.ID, nil, 600)
+	suite.Require().NoError(err)
 
-	suite.mockRepo.On("GetMedia", suite.ctx, mediaID).Return(existingMedia, nil)
-	suite.mockRepo.On("UpdateMedia", suite.ctx, mock.AnythingOfType("*models.Media")).Return(nil)
+	// Act
+	plan, planErr := libraryService.PlanPrune(suite.ctx, &library.ID)
+	_, emptyErr := libraryService.ApplyPrune(suite.ctx, nil, true)
+	pruneTask, err := libraryService.ApplyPrune(suite.ctx, []uuid.UUID{worse.ID, stale.ID}, true)
+	suite.Require().NoError(err)
+	suite.Eventually(func() bool {
+		t, err := libraryService.Tasks().Get(suite.ctx, pruneTask.ID)
+		return err == nil && t.Status.Finished()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Assert
+	suite.Require().NoError(planErr)
+	suite.Require().Len(plan.Candidates, 2, "the kept copy and watched titles are not suggested")
+	suite.Equal(worse.ID, plan.Candidates[0].MediaID)
+	suite.Equal([]domain.PruneReason{domain.PruneSuperseded}, plan.Candidates[0].Reasons)
+	suite.Equal(best.ID, *plan.Candidates[0].KeptID)
+	suite.Equal(stale.ID, plan.Candidates[1].MediaID)
+	suite.Equal([]domain.PruneReason{domain.PruneUnwatched}, plan.Candidates[1].Reasons)
+	suite.Equal(int64(6<<30), plan.Savings)
+	suite.True(errors.IsBadRequest(emptyErr))
+
+	t, err := libraryService.Tasks().Get(suite.ctx, pruneTask.ID)
+	suite.Require().NoError(err)
+	suite.Equal(task.StatusCompleted, t.Status)
+	for _, m := range []*models.Media{worse, stale} {
+		suite.NoFileExists(m.FilePath)
+		_, err := repo.GetMedia(suite.ctx, m.ID)
+		suite.True(errors.IsNotFound(err), "pruned media are deleted")
+	}
+	recycled, err := filepath.Glob(filepath.Join(bin, library.ID.String(), "*", "*.mkv"))
+	suite.Require().NoError(err)
+	suite.Len(recycled, 2, "files are moved to the recycle bin")
+	suite.FileExists(best.FilePath)
+}
+
+// stubTitles finds the titles it holds, by provider ID.
+type stubTitles map[string]*models.Metadata
+
+func (s stubTitles) SearchTitles(
+	_ context.Context,
+	mediaType models.MediaType,
+	query string,
+	_ int,
+	_ domain.MetadataPreferences,
+) ([]models.SearchResult, error) {
+	var results []models.SearchResult
+	for id, m := range s {
+		if strings.Contains(m.Title, query) {
+			results = append(results, models.SearchResult{
+				ProviderID: id, ProviderName: "tmdb", Title: m.Title, Type: string(mediaType),
+			})
+		}
+	}
+	return results, nil
+}
+
+func (s stubTitles) TitleDetails(
+	_ context.Context,
+	_, providerID string,
+	_ models.MediaType,
+	_ domain.MetadataPreferences,
+) (*models.Metadata, error) {
+	if m, ok := s[providerID]; ok {
+		return m, nil
+	}
+	return nil, errors.NotFound("title not found")
+}
+
+func (suite *LibraryServiceTestSuite) TestTranscodePolicies_LinkOutputsOfSourcesTranscodedBefore() {
+	// Arrange
+	root, outputs := suite.T().TempDir(), suite.T().TempDir()
+	repo := fake.NewLibraryRepository()
+	policies := service.NewTranscodePolicyService(repo, suite.eventBus, logger.NewNoopLogger())
+	suite.Require().NoError(policies.Start())
+	library := &domain.Library{ID: uuid.New(), Name: "Movies", Path: root, Type: "movie", Enabled: true}
+	suite.Require().NoError(repo.CreateLibrary(suite.ctx, library))
+	policy := &domain.TranscodePolicy{LibraryID: library.ID, Name: "Mobile", Profile: "480p", Format: domain.TranscodeFormatMP4, Enabled: true}
+	suite.Require().NoError(policies.CreatePolicy(suite.ctx, policy))
+
+	movie := func(name, content string) *models.Media {
+		m := testutil.CreateTestMedia(library.ID, "Heat", models.MediaTypeMovie)
+		m.Status = string(models.MediaStatusAvailable)
+		m.FilePath = filepath.Join(root, name)
+		suite.Require().NoError(os.WriteFile(m.FilePath, []byte(content), 0o644))
+		suite.Require().NoError(repo.CreateMedia(suite.ctx, m))
+		return m
+	}
+	original := movie("Heat (1995).mkv", "heat")
+	copied := movie("Heat (1995) copy.mkv", "heat")
+	other := movie("Heat (1995) remaster.mkv", "heat remastered")
+
+	requested := make(chan string, 4)
+	reused := make(chan map[string]interface{}, 4)
+	suite.Require().NoError(suite.eventBus.Subscribe("transcode.requested",
+		events.NewConsumer("test", 1, func(_ context.Context, env *events.Envelope) error {
+			requested <- env.Payload()["media_id"].(string)
+			return nil
+		})))
+	suite.Require().NoError(suite.eventBus.Subscribe("transcode.reused",
+		events.NewConsumer("test", 1, func(_ context.Context, env *events.Envelope) error {
+			reused <- env.Payload()
+			return nil
+		})))
+	complete := func(media *models.Media) string {
+		output := filepath.Join(outputs, media.ID.String()+".mp4")
+		suite.Require().NoError(os.WriteFile(output, []byte("encoded"), 0o644))
+		suite.Require().NoError(suite.eventBus.Publish(suite.ctx, events.NewEvent("transcode.completed", map[string]interface{}{
+			"media_id":    media.ID.String(),
+			"policy_id":   policy.ID.String(),
+			"dedupe_key":  domain.TranscodeKey(media, policy),
+			"output_path": output,
+		})))
+		return output
+	}
+	apply := func(media *models.Media) int {
+		n, err := policies.ApplyToMedia(suite.ctx, media.ID)
+		suite.Require().NoError(err)
+		return n
+	}
+	next := func(ch <-chan string) string {
+		select {
+		case id := <-ch:
+			return id
+		case <-time.After(time.Second):
+			suite.FailNow("transcode.requested not published")
+			return ""
+		}
+	}
 
 	// Act
-	updatedMedia, err := suite.libraryService.UpdateMedia(suite.ctx, mediaID, updates)
+	suite.Equal(1, apply(original))
+	suite.Equal(original.ID.String(), next(requested))
+	output := complete(original)
+	suite.Equal(1, apply(copied))
+	suite.Equal(1, apply(other))
+	suite.Equal(other.ID.String(), next(requested), "other content is transcoded")
+
+	// The original's file changes, so its outputs no longer match its copy
+	modified := time.Now().Add(time.Hour)
+	original.FileModifiedAt = &modified
+	suite.Require().NoError(os.WriteFile(original.FilePath, []byte("heat, recut"), 0o644))
+	suite.Require().NoError(repo.UpdateMedia(suite.ctx, original))
+	suite.Equal(1, apply(original))
 
 	// Assert
+	select {
+	case payload := <-reused:
+		suite.Equal(copied.ID.String(), payload["media_id"])
+		suite.Equal(original.ID.String(), payload["source_media_id"])
+		suite.Equal(output, payload["output_path"])
+	case <-time.After(time.Second):
+		suite.FailNow("transcode.reused not published")
+	}
+	suite.Equal(original.ID.String(), next(requested), "the changed file is transcoded again")
+	suite.Empty(reused)
+
+	source, err := domain.HashTranscodeSource(copied.FilePath)
 	suite.Require().NoError(err)
-	suite.Equal("Updated Title", updatedMedia.Title)
-	suite.Equal("New description", updatedMedia.Description)
-	suite.Equal([]string{"action", "drama"}, updatedMedia.Tags)
+	_, err = repo.GetTranscodeOutput(suite.ctx, source, domain.TranscodeProfileHash(policy))
+	suite.True(errors.IsNotFound(err), "outputs of the changed file are dropped")
 }
 
-func (suite *LibraryServiceTestSuite) TestDeleteMedia_Success() {
+func (suite *LibraryServiceTestSuite) TestContentRequests_QuotaApprovalAndAvailability() {
 	// Arrange
-	mediaID := uuid.New()
-	media := testutil.CreateTestMedia(uuid.New(), "To Delete", models.MediaTypeMovie)
-	media.ID = mediaID
+	repo := fake.NewLibraryRepository()
+	library := &domain.Library{ID: uuid.New(), Name: "Movies", Path: suite.T().TempDir(), Type: "movie", Enabled: true}
+	suite.Require().NoError(repo.CreateLibrary(suite.ctx, library))
+	requests := service.NewContentRequestService(repo, stubTitles{
+		"438631": {Title: "Dune", TMDBID: "438631", IMDBID: "tt1160419", ReleaseDate: "2021-09-15"},
+		"693134": {Title: "Dune: Part Two", TMDBID: "693134", ReleaseDate: "2024-02-27"},
+		"841":    {Title: "Dune", TMDBID: "841", ReleaseDate: "1984-12-14"},
+	}, domain.RequestPolicy{
+		Period:      24 * time.Hour,
+		Quotas:      map[string]domain.RequestQuota{"user": {Movies: 2}},
+		AutoApprove: []domain.AutoApproveRule{{Role: "user", MaxQuality: domain.FeedQuality1080p}},
+	}, suite.eventBus, logger.NewNoopLogger())
+	suite.Require().NoError(requests.Start())
+	user, other, admin := uuid.New(), uuid.New(), uuid.New()
+	roles := []string{"user"}
+	movie := func(userID uuid.UUID, providerID, quality string) *domain.ContentRequest {
+		return &domain.ContentRequest{
+			UserID: userID, MediaType: models.MediaTypeMovie, Provider: "tmdb", ProviderID: providerID, Quality: quality,
+		}
+	}
 
-	suite.mockRepo.On("GetMedia", suite.ctx, mediaID).Return(media, nil)
-	suite.mockRepo.On("DeleteMedia", suite.ctx, mediaID).Return(nil)
+	// Act
+	first, firstErr := requests.Submit(suite.ctx, roles, movie(user, "438631", ""))
+	second, secondErr := requests.Submit(suite.ctx, roles, movie(user, "693134", domain.FeedQuality2160p))
+	_, exhaustedErr := requests.Submit(suite.ctx, roles, movie(user, "841", ""))
+	quota, quotaErr := requests.QuotaState(suite.ctx, user, roles)
+	_, duplicateErr := requests.Submit(suite.ctx, roles, movie(other, "438631", ""))
+	_, unknownErr := requests.Submit(suite.ctx, roles, movie(other, "1", ""))
+	titles, searchErr := requests.Search(suite.ctx, models.MediaTypeMovie, "Dune", 0)
+	denied, denyErr := requests.Deny(suite.ctx, admin, second.ID, "Not yet released here")
+	_, decidedErr := requests.Approve(suite.ctx, admin, second.ID, nil)
+	own, ownTotal, ownErr := requests.List(suite.ctx, other, false, "", 10, 0)
+	all, allTotal, allErr := requests.List(suite.ctx, admin, true, "", 10, 0)
+
+	_, overrideErr := requests.SetQuotaOverride(suite.ctx, admin, user, domain.RequestQuota{Movies: 1})
+	overridden, overriddenErr := requests.QuotaState(suite.ctx, user, roles)
+
+	suite.Require().NoError(firstErr)
+	suite.Require().NotNil(first.MediaID)
+	suite.Require().NoError(suite.eventBus.Publish(suite.ctx, events.NewAggregateEvent("media.status_changed",
+		first.MediaID.String(), map[string]interface{}{
+			"entity_id": first.MediaID.String(),
+			"from":      string(models.MediaStatusMissing),
+			"to":        string(models.MediaStatusAvailable),
+		})))
+	fulfilled, fulfilledErr := repo.GetContentRequest(suite.ctx, first.ID)
+
+	// Assert
+	suite.Equal(domain.ContentRequestApproved, first.Status, "requests matching a rule are approved")
+	suite.True(first.AutoApproved)
+	suite.Equal(2021, first.Year)
+	media, err := repo.GetMedia(suite.ctx, *first.MediaID)
+	suite.Require().NoError(err)
+	suite.Equal(library.ID, media.LibraryID)
+	suite.Equal(string(models.MediaStatusMissing), media.Status)
+	suite.True(media.Monitored, "approved titles are wanted")
+	suite.Equal(438631, media.TMDBID)
+	suite.Equal("tt1160419", media.IMDBID)
+
+	suite.Require().NoError(secondErr)
+	suite.Equal(domain.ContentRequestPending, second.Status, "qualities above the rule wait for an admin")
+	suite.True(errors.IsForbidden(exhaustedErr), "requests beyond the quota are refused")
+	suite.Require().NoError(quotaErr)
+	suite.Equal(2, quota.Movies)
+	suite.Zero(quota.MoviesRemaining())
+	suite.False(quota.Overridden)
+	suite.True(errors.IsConflict(duplicateErr), "titles are requested once")
+	suite.True(errors.IsBadRequest(unknownErr))
+
+	suite.Require().NoError(searchErr)
+	suite.Len(titles, 3)
+	requested := 0
+	for _, title := range titles {
+		if title.Request != nil {
+			requested++
+		}
+	}
+	suite.Equal(2, requested, "the refused request was not stored")
+
+	suite.Require().NoError(denyErr)
+	suite.Equal(domain.ContentRequestDenied, denied.Status)
+	suite.Equal("Not yet released here", denied.Reason)
+	suite.True(errors.IsConflict(decidedErr))
+
+	suite.Require().NoError(ownErr)
+	suite.Zero(ownTotal)
+	suite.Empty(own)
+	suite.Require().NoError(allErr)
+	suite.Equal(int64(2), allTotal)
+	suite.Len(all, 2)
+
+	suite.Require().NoError(overrideErr)
+	suite.Require().NoError(overriddenErr)
+	suite.True(overridden.Overridden)
+	suite.Equal(1, overridden.Movies, "denied requests do not count")
+	suite.Zero(overridden.MoviesRemaining())
+
+	suite.Require().NoError(fulfilledErr)
+	suite.Equal(domain.ContentRequestAvailable, fulfilled.Status)
+	suite.NotNil(fulfilled.AvailableAt)
+}
+
+// stubMetadata fetches the same metadata for all media.
+type stubMetadata models.Metadata
+
+func (s *stubMetadata) FetchMetadata(
+	context.Context,
+	*models.Media,
+	*domain.Library,
+) (*models.Metadata, error) {
+	m := models.Metadata(*s)
+	return &m, nil
+}
+
+func (suite *LibraryServiceTestSuite) TestMediaIssues_ReportAndResolve() {
+	// Arrange
+	repo := fake.NewLibraryRepository()
+	library := &domain.Library{ID: uuid.New(), Name: "Movies", Path: suite.T().TempDir(), Type: "movie", Enabled: true}
+	suite.Require().NoError(repo.CreateLibrary(suite.ctx, library))
+	movie := testutil.CreateTestMedia(library.ID, "Dun", models.MediaTypeMovie)
+	movie.Status = string(models.MediaStatusAvailable)
+	suite.Require().NoError(repo.CreateMedia(suite.ctx, movie))
+	issues := service.NewMediaIssueService(repo,
+		service.NewTranscodePolicyService(repo, suite.eventBus, logger.NewNoopLogger()),
+		&stubMetadata{Title: "Dune", TMDBID: "438631", ReleaseDate: "2021-09-15"},
+		suite.eventBus, logger.NewNoopLogger())
+	user, other, admin := uuid.New(), uuid.New(), uuid.New()
+	report := func(userID uuid.UUID, category domain.IssueCategory) (*domain.MediaIssue, error) {
+		return issues.Report(suite.ctx, &domain.MediaIssue{MediaID: movie.ID, UserID: userID, Category: category})
+	}
 
 	// Act
-	err := suite.libraryService.DeleteMedia(suite.ctx, mediaID)
+	audio, audioErr := report(user, domain.IssueWrongAudio)
+	metadata, metadataErr := report(other, domain.IssueWrongMetadata)
+	_, invalidErr := report(user, "broken")
+	own, ownTotal, ownErr := issues.List(suite.ctx, user, false, domain.MediaIssueFilter{}, 10, 0)
+	redownloaded, redownloadErr := issues.Resolve(suite.ctx, admin, audio.ID, domain.IssueActionRedownload, "Grabbing another release")
+	_, resolvedErr := issues.Resolve(suite.ctx, admin, audio.ID, domain.IssueActionNone, "")
+	_, retranscodeErr := issues.Resolve(suite.ctx, admin, metadata.ID, domain.IssueActionRetranscode, "")
+	refreshed, refreshErr := issues.Resolve(suite.ctx, admin, metadata.ID, domain.IssueActionRefreshMetadata, "")
+	open, openTotal, openErr := issues.List(suite.ctx, admin, true, domain.MediaIssueFilter{Status: domain.IssueOpen}, 10, 0)
 
 	// Assert
+	suite.Require().NoError(audioErr)
+	suite.Equal(domain.IssueOpen, audio.Status)
+	suite.Require().NoError(metadataErr)
+	suite.True(errors.IsBadRequest(invalidErr))
+	suite.Require().NoError(ownErr)
+	suite.Equal(int64(1), ownTotal, "users list their own issues")
+	suite.Equal(audio.ID, own[0].ID)
+
+	suite.Require().NoError(redownloadErr)
+	suite.Equal(domain.IssueResolved, redownloaded.Status)
+	suite.Equal(domain.IssueActionRedownload, redownloaded.Action)
+	suite.Equal(admin, *redownloaded.ResolvedBy)
+	suite.True(errors.IsConflict(resolvedErr), "issues are resolved once")
+	suite.True(errors.IsBadRequest(retranscodeErr), "no transcode policy applies")
+
+	suite.Require().NoError(refreshErr)
+	suite.Equal(domain.IssueActionRefreshMetadata, refreshed.Action)
+	media, err := repo.GetMedia(suite.ctx, movie.ID)
 	suite.Require().NoError(err)
+	suite.Equal(string(models.MediaStatusMissing), media.Status, "movies are downloaded again")
+	suite.True(media.Monitored)
+	suite.Equal("Dune", media.Title)
+	suite.Equal(438631, media.TMDBID)
+	suite.Equal(2021, media.ReleaseDate.Year())
+
+	suite.Require().NoError(openErr)
+	suite.Zero(openTotal)
+	suite.Empty(open)
 }
 
-func TestLibraryServiceTestSuite(t *testing.T) {
-	suite.Run(t, new(LibraryServiceTestSuite))
+func (suite *LibraryServiceTestSuite) TestDigest_ComposesAccessibleAdditionsWatchlistAndRequests() {
+	// Arrange
+	repo := fake.NewLibraryRepository()
+	digests := service.NewDigestService(repo, suite.eventBus, logger.NewNoopLogger())
+	movies, shows := uuid.New(), uuid.New()
+	since := time.Now().Add(-time.Hour)
+	until := time.Now().Add(time.Minute)
+	userID := uuid.New()
+
+	movie := testutil.CreateTestMedia(movies, "Dune", models.MediaTypeMovie)
+	restricted := testutil.CreateTestMedia(shows, "Severance", models.MediaTypeSeries)
+	restricted.Monitored = true
+	wanted := testutil.CreateTestMedia(movies, "Arrival", models.MediaTypeMovie)
+	wanted.Status = string(models.MediaStatusMissing)
+	for _, m := range []*models.Media{movie, restricted, wanted} {
+		suite.Require().NoError(repo.CreateMedia(suite.ctx, m))
+	}
+	next := testutil.CreateTestEpisode(restricted.ID, 2, 1, "Hello, Ms. Cobel")
+	next.AirDate = until.Add(30 * time.Minute)
+	suite.Require().NoError(repo.CreateEpisode(suite.ctx, next))
+	suite.Require().NoError(repo.AddToWatchlist(suite.ctx, &domain.WatchlistEntry{UserID: userID, MediaID: restricted.ID}))
+	suite.Require().NoError(repo.CreateContentRequest(suite.ctx, &domain.ContentRequest{
+		ID: uuid.New(), UserID: userID, MediaType: models.MediaTypeMovie, Provider: "tmdb", ProviderID: "329865",
+		Title: "Arrival", Year: 2016, Status: domain.ContentRequestPending, CreatedAt: time.Now(),
+	}))
+
+	// Act
+	all, allErr := digests.Compose(suite.ctx, userID, since, until, nil)
+	granted, grantedErr := digests.Compose(suite.ctx, userID, since, until, []uuid.UUID{movies})
+
+	// Assert
+	suite.Require().NoError(allErr)
+	suite.Len(all.Added, 2, "wanted media is not added yet")
+	suite.Require().Len(all.Upcoming, 1)
+	suite.Equal("Severance", all.Upcoming[0].Series)
+	suite.Equal(2, all.Upcoming[0].SeasonNumber)
+	suite.Require().Len(all.Requests, 1)
+	suite.Equal(domain.ContentRequestPending, all.Requests[0].Status)
+
+	suite.Require().NoError(grantedErr)
+	suite.Require().Len(granted.Added, 1, "only accessible libraries are included")
+	suite.Equal("Dune", granted.Added[0].Title)
+	suite.Empty(granted.Upcoming)
+	suite.Len(granted.Requests, 1)
+}
+
+func (suite *LibraryServiceTestSuite) TestTranscodePolicies_ReuseMeasuredLoudness() {
+	// Arrange
+	root := suite.T().TempDir()
+	repo := fake.NewLibraryRepository()
+	policies := service.NewTranscodePolicyService(repo, suite.eventBus, logger.NewNoopLogger())
+	suite.Require().NoError(policies.Start())
+	library := &domain.Library{
+		ID: uuid.New(), Name: "Shows", Path: root, Type: "tv_show", Enabled: true,
+		AudioNormalization: domain.AudioNormalizationLoudnorm,
+	}
+	suite.Require().NoError(repo.CreateLibrary(suite.ctx, library))
+	mobile := &domain.TranscodePolicy{LibraryID: library.ID, Name: "Mobile", Profile: "480p", Format: domain.TranscodeFormatMP4, Enabled: true}
+	suite.Require().NoError(policies.CreatePolicy(suite.ctx, mobile))
+	ladder := &domain.TranscodePolicy{
+		LibraryID: library.ID, Name: "Ladder", Profile: "ladder", Format: domain.TranscodeFormatHLS, Enabled: true,
+		AudioNormalization: domain.AudioNormalizationOff,
+	}
+	suite.Require().NoError(policies.CreatePolicy(suite.ctx, ladder))
+	suite.True(errors.IsBadRequest(policies.CreatePolicy(suite.ctx, &domain.TranscodePolicy{
+		LibraryID: library.ID, Name: "Loud", Profile: "480p", Format: domain.TranscodeFormatMP4,
+		AudioNormalization: "louder",
+	})))
+
+	episode := testutil.CreateTestMedia(library.ID, "Pilot", models.MediaTypeSeries)
+	episode.Status = string(models.MediaStatusAvailable)
+	episode.FilePath = filepath.Join(root, "Pilot.mkv")
+	suite.Require().NoError(os.WriteFile(episode.FilePath, []byte("pilot"), 0o644))
+	suite.Require().NoError(repo.CreateMedia(suite.ctx, episode))
+
+	requested := make(chan map[string]interface{}, 4)
+	suite.Require().NoError(suite.eventBus.Subscribe("transcode.requested",
+		events.NewConsumer("test", 1, func(_ context.Context, env *events.Envelope) error {
+			requested <- env.Payload()
+			return nil
+		})))
+	next := func() map[string]interface{} {
+		select {
+		case payload := <-requested:
+			return payload
+		case <-time.After(time.Second):
+			suite.FailNow("transcode.requested not published")
+			return nil
+		}
+	}
+	byPolicy := func(n int) map[string]map[string]interface{} {
+		payloads := make(map[string]map[string]interface{})
+		for range n {
+			payload := next()
+			payloads[payload["policy_id"].(string)] = payload
+		}
+		return payloads
+	}
+
+	// Act
+	n, err := policies.ApplyToMedia(suite.ctx, episode.ID)
+	suite.Require().NoError(err)
+	first := byPolicy(n)
+
+	key := first[mobile.ID.String()]["dedupe_key"].(string)
+	suite.Require().NoError(suite.eventBus.Publish(suite.ctx, events.NewEvent("transcode.completed", map[string]interface{}{
+		"media_id":        episode.ID.String(),
+		"policy_id":       mobile.ID.String(),
+		"dedupe_key":      key,
+		"output_path":     episode.FilePath,
+		"measured_i":      -27.61,
+		"measured_tp":     -4.47,
+		"measured_lra":    18.06,
+		"measured_thresh": -39.2,
+		"target_offset":   0.55,
+	})))
+	source, err := domain.HashTranscodeSource(episode.FilePath)
+	suite.Require().NoError(err)
+	suite.Eventually(func() bool {
+		_, err := repo.GetLoudnessMeasurement(suite.ctx, source)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	n, err = policies.Retranscode(suite.ctx, episode.ID, "2")
+	suite.Require().NoError(err)
+	retried := byPolicy(n)
+
+	// Assert
+	suite.Require().Len(first, 2)
+	suite.Equal("loudnorm", first[mobile.ID.String()]["audio_normalization"], "policies default to their library")
+	suite.Contains(key, "480p+loudnorm")
+	suite.NotContains(first[mobile.ID.String()], "measured_i", "the first transcode measures the source")
+	suite.Equal("off", first[ladder.ID.String()]["audio_normalization"])
+
+	suite.Require().Len(retried, 2)
+	suite.InDelta(-27.61, retried[mobile.ID.String()]["measured_i"], 1e-9, "the measurement is reused")
+	suite.InDelta(0.55, retried[mobile.ID.String()]["target_offset"], 1e-9)
+	suite.NotContains(retried[ladder.ID.String()], "measured_i")
 }
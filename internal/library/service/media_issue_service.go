@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/internal/library/repository"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+	"github.com/narwhalmedia/narwhal/pkg/statemachine"
+	"github.com/narwhalmedia/narwhal/pkg/tenant"
+)
+
+// MetadataSource fetches the metadata of media with the preferences of its
+// library.
+type MetadataSource interface {
+	FetchMetadata(ctx context.Context, media *models.Media, library *domain.Library) (*models.Metadata, error)
+}
+
+// MediaIssueService lets users report problems with media, such as wrong
+// audio or missing subtitles, and admins resolve them, acting on the media
+// right from the issue: downloading a movie again, transcoding it again or
+// refreshing its metadata. Admins are told of new issues and reporters of
+// resolved ones through events.
+type MediaIssueService struct {
+	repo        repository.Repository
+	transcodes  *TranscodePolicyService
+	metadata    MetadataSource
+	mediaStatus *statemachine.Machine[models.MediaStatus]
+	eventBus    interfaces.EventBus
+	logger      interfaces.Logger
+}
+
+// NewMediaIssueService creates a new media issue service.
+func NewMediaIssueService(
+	repo repository.Repository,
+	transcodes *TranscodePolicyService,
+	metadata MetadataSource,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+) *MediaIssueService {
+	return &MediaIssueService{
+		repo:        repo,
+		transcodes:  transcodes,
+		metadata:    metadata,
+		mediaStatus: statemachine.New("media", models.MediaTransitions, eventBus, logger),
+		eventBus:    eventBus,
+		logger:      logger,
+	}
+}
+
+// Report files an issue of a user with a media item, or an episode of it.
+func (s *MediaIssueService) Report(ctx context.Context, issue *domain.MediaIssue) (*domain.MediaIssue, error) {
+	if err := issue.Validate(); err != nil {
+		return nil, errors.BadRequest(err.Error())
+	}
+	media, err := s.repo.GetMedia(ctx, issue.MediaID)
+	if err != nil {
+		return nil, err
+	}
+	if issue.EpisodeID != nil {
+		episode, err := s.repo.GetEpisode(ctx, *issue.EpisodeID)
+		if err != nil {
+			return nil, err
+		}
+		if episode.MediaID != media.ID {
+			return nil, errors.BadRequest("episode does not belong to the media")
+		}
+	}
+
+	issue.TenantID, _ = tenant.FromContext(ctx)
+	issue.Status = domain.IssueOpen
+	issue.CreatedAt = time.Now()
+	if err := s.repo.CreateMediaIssue(ctx, issue); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Media issue reported",
+		interfaces.String("issue_id", issue.ID.String()),
+		interfaces.String("media_id", media.ID.String()),
+		interfaces.String("category", string(issue.Category)),
+		interfaces.String("user_id", issue.UserID.String()))
+	s.eventBus.PublishAsync(ctx, domain.NewMediaIssueReportedEvent(*issue, media.Title))
+	return issue, nil
+}
+
+// List lists a page of the issues a user reported, or the issues of every
+// user for admins, narrowed by the filter, newest first, and the number of
+// issues in all pages.
+func (s *MediaIssueService) List(
+	ctx context.Context,
+	userID uuid.UUID,
+	admin bool,
+	filter domain.MediaIssueFilter,
+	limit, offset int,
+) ([]*domain.MediaIssue, int64, error) {
+	if !admin {
+		filter.UserID = &userID
+	}
+	return s.repo.ListMediaIssues(ctx, filter, limit, offset)
+}
+
+// Resolve carries out an action on the media of an open issue and records
+// the resolution. The issue stays open if the action fails.
+func (s *MediaIssueService) Resolve(
+	ctx context.Context,
+	adminID, id uuid.UUID,
+	action domain.IssueAction,
+	resolution string,
+) (*domain.MediaIssue, error) {
+	issue, err := s.repo.GetMediaIssue(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if issue.Status != domain.IssueOpen {
+		return nil, errors.Conflict(fmt.Sprintf("media issue is %s already", issue.Status))
+	}
+	media, err := s.repo.GetMedia(ctx, issue.MediaID)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := *issue
+	if err := resolved.Resolve(adminID, action, resolution, time.Now()); err != nil {
+		return nil, errors.Conflict(err.Error())
+	}
+	if err := s.act(ctx, issue, media, action); err != nil {
+		return nil, err
+	}
+	if err := s.repo.ResolveMediaIssue(ctx, &resolved); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Media issue resolved",
+		interfaces.String("issue_id", issue.ID.String()),
+		interfaces.String("media_id", media.ID.String()),
+		interfaces.String("action", string(action)),
+		interfaces.String("admin_id", adminID.String()))
+	s.eventBus.PublishAsync(ctx, domain.NewMediaIssueResolvedEvent(resolved, media.Title))
+	return &resolved, nil
+}
+
+// act carries out the action an issue is resolved with.
+func (s *MediaIssueService) act(
+	ctx context.Context,
+	issue *domain.MediaIssue,
+	media *models.Media,
+	action domain.IssueAction,
+) error {
+	switch action {
+	case domain.IssueActionNone:
+		return nil
+	case domain.IssueActionRedownload:
+		return s.redownload(ctx, issue, media)
+	case domain.IssueActionRetranscode:
+		requested, err := s.transcodes.Retranscode(ctx, media.ID, "issue-"+issue.ID.String())
+		if err != nil {
+			return err
+		}
+		if requested == 0 {
+			return errors.BadRequest("no transcode policy applies to the media")
+		}
+		return nil
+	case domain.IssueActionRefreshMetadata:
+		return s.refreshMetadata(ctx, media)
+	default:
+		return errors.BadRequest(fmt.Sprintf("unknown issue action %q", action))
+	}
+}
+
+// redownload marks a movie missing and monitored, so the wanted searches
+// acquire it again. Its current file stays until a new one is imported.
+func (s *MediaIssueService) redownload(ctx context.Context, issue *domain.MediaIssue, media *models.Media) error {
+	if media.Type != models.MediaTypeMovie {
+		return errors.BadRequest("only movies can be downloaded again")
+	}
+
+	current := models.MediaStatus(media.Status)
+	if current != models.MediaStatusMissing {
+		reason := fmt.Sprintf("issue %s: %s", issue.ID, issue.Category)
+		if err := s.mediaStatus.Transition(ctx, media.ID.String(), &current, models.MediaStatusMissing, reason); err != nil {
+			return err
+		}
+	}
+	media.Status = string(current)
+	media.Monitored = true
+	return s.repo.UpdateMedia(ctx, media)
+}
+
+// refreshMetadata fetches the metadata of media again and applies it.
+func (s *MediaIssueService) refreshMetadata(ctx context.Context, media *models.Media) error {
+	library, err := s.repo.GetLibrary(ctx, media.LibraryID)
+	if err != nil {
+		return err
+	}
+	metadata, err := s.metadata.FetchMetadata(ctx, media, library)
+	if err != nil {
+		return fmt.Errorf("failed to refresh metadata: %w", err)
+	}
+
+	if metadata.Title != "" {
+		media.Title = metadata.Title
+	}
+	media.Description = metadata.Description
+	media.Genres = metadata.Genres
+	if metadata.IMDBID != "" {
+		media.IMDBID = metadata.IMDBID
+	}
+	if id, err := strconv.Atoi(metadata.TMDBID); err == nil {
+		media.TMDBID = id
+	}
+	if id, err := strconv.Atoi(metadata.TVDBID); err == nil {
+		media.TVDBID = id
+	}
+	if released, err := time.Parse(time.DateOnly, metadata.ReleaseDate); err == nil {
+		media.ReleaseDate = released
+		media.Year = released.Year()
+	}
+	media.Metadata = metadata
+	if err := s.repo.UpdateMedia(ctx, media); err != nil {
+		return err
+	}
+
+	s.eventBus.PublishAsync(ctx, domain.NewMediaUpdatedEvent(media))
+	return nil
+}
@@ -0,0 +1,521 @@
+package service
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+	"github.com/narwhalmedia/narwhal/pkg/saga"
+)
+
+// Workflow data keys shared between the steps of a media workflow.
+const (
+	WorkflowDataLibraryID = "library_id"
+	WorkflowDataPath      = "path"
+	// WorkflowDataDownloadClient names the download client that fetched the
+	// file, which picks its import mode.
+	WorkflowDataDownloadClient = "download_client"
+	// WorkflowDataImportedPath and WorkflowDataImportMethod record where the
+	// import step placed the file and how.
+	WorkflowDataImportedPath = "imported_path"
+	WorkflowDataImportMethod = "import_method"
+	// WorkflowDataReleaseTitle, WorkflowDataReleaseGUID,
+	// WorkflowDataReleaseInfoHash and WorkflowDataReleaseIndexer identify
+	// the release that was downloaded, so it is blocklisted if it fails to
+	// import.
+	WorkflowDataReleaseTitle    = "release_title"
+	WorkflowDataReleaseGUID     = "release_guid"
+	WorkflowDataReleaseInfoHash = "release_info_hash"
+	WorkflowDataReleaseIndexer  = "release_indexer"
+	// WorkflowDataMatchedMediaID is the existing library item the import
+	// step matched the download to, if it did not create one.
+	WorkflowDataMatchedMediaID = "matched_media_id"
+	// WorkflowDataManualImportID is the manual import a parked workflow
+	// waits on.
+	WorkflowDataManualImportID = "manual_import_id"
+	// WorkflowDataMalwareVerdict records what the malware scan step found,
+	// WorkflowDataMalwareThreat what an infected download was flagged as,
+	// and WorkflowDataQuarantinedPath where its file was moved to.
+	WorkflowDataMalwareVerdict  = "malware_verdict"
+	WorkflowDataMalwareThreat   = "malware_threat"
+	WorkflowDataQuarantinedPath = "quarantined_path"
+)
+
+// maxImportCandidates bounds the library items a download is matched
+// against.
+const maxImportCandidates = 20
+
+// WorkflowStepImport is the name of the library import step.
+const WorkflowStepImport = "import"
+
+// RunMediaWorkflow runs the acquire→download→import→transcode workflow for a
+// media item. The acquisition, download and transcode steps are supplied by
+// their services; MalwareScanStep and ImportStep provide the library's part. Each step is
+// retried, and a workflow that cannot complete is compensated step by step.
+// Workflows parked for a manual import return an error wrapping
+// saga.ErrParked.
+func (s *LibraryService) RunMediaWorkflow(
+	ctx context.Context,
+	mediaID uuid.UUID,
+	data map[string]string,
+	steps ...saga.Step,
+) (*saga.Workflow, error) {
+	wf, err := saga.NewOrchestrator(s.repo, s.logger, steps...).Run(ctx, mediaID, data)
+	if stderrors.Is(err, saga.ErrParked) {
+		s.logger.Info("Media workflow parked",
+			interfaces.String("media_id", mediaID.String()),
+			interfaces.String("workflow_id", wf.ID.String()),
+			interfaces.Error(err))
+		return wf, err
+	}
+	if err != nil {
+		s.logger.Error("Media workflow failed",
+			interfaces.String("media_id", mediaID.String()),
+			interfaces.Error(err))
+		return wf, err
+	}
+
+	s.logger.Info("Media workflow completed",
+		interfaces.String("media_id", mediaID.String()),
+		interfaces.String("workflow_id", wf.ID.String()))
+
+	return wf, nil
+}
+
+// GetWorkflow returns the latest workflow of a media item.
+func (s *LibraryService) GetWorkflow(ctx context.Context, mediaID uuid.UUID) (*saga.Workflow, error) {
+	return s.repo.GetLatestWorkflow(ctx, mediaID)
+}
+
+// WithImportModes sets how downloaded files are placed in libraries, per
+// download client. Files are hardlinked by default.
+func (s *LibraryService) WithImportModes(modes domain.ImportModes) *LibraryService {
+	s.importModes = modes
+	return s
+}
+
+// ImportSpaceSaved returns the bytes not duplicated on disk since the
+// service started, thanks to imports hardlinking instead of copying.
+func (s *LibraryService) ImportSpaceSaved() int64 {
+	return s.importSpaceSaved.Load()
+}
+
+// ImportStep adds the downloaded file at the workflow's path to the
+// workflow's library, linking, copying or moving it into the library with
+// the import mode of its download client. Compensation marks the media item
+// as errored and deletes the imported file so failed workflows do not leave
+// partial files behind; downloads are only deleted when they were to be
+// moved, as the download client may still be seeding them otherwise. When
+// the import itself failed, the release is blocklisted so it is not
+// grabbed again. Downloads that cannot be matched to a library item with
+// confidence park the workflow as a manual import.
+func (s *LibraryService) ImportStep() saga.Step {
+	return saga.Step{
+		Name:       WorkflowStepImport,
+		Execute:    s.importWorkflowMedia,
+		Compensate: s.revertWorkflowImport,
+	}
+}
+
+func (s *LibraryService) importWorkflowMedia(ctx context.Context, wf *saga.Workflow) error {
+	libraryID, err := uuid.Parse(wf.Data[WorkflowDataLibraryID])
+	if err != nil {
+		return errors.BadRequest("workflow has no valid library ID")
+	}
+	if wf.Data[WorkflowDataPath] == "" {
+		return errors.BadRequest("workflow has no file path")
+	}
+
+	library, err := s.repo.GetLibrary(ctx, libraryID)
+	if err != nil {
+		return err
+	}
+
+	media, err := s.workflowImportTarget(ctx, wf, library)
+	if err != nil {
+		return err
+	}
+
+	source := wf.Data[WorkflowDataPath]
+	if media != nil && hasOtherFile(media, source, wf.Data[WorkflowDataImportedPath]) {
+		if err := s.checkWorkflowReplacement(ctx, wf, library, media); err != nil {
+			return err
+		}
+		place := func() (string, error) { return s.placeImport(wf, library) }
+		return s.importReplacing(ctx, library, media, source, place, "replaced by workflow")
+	}
+
+	path, err := s.placeImport(wf, library)
+	if err != nil {
+		return err
+	}
+
+	return s.applyImport(ctx, library, wf.MediaID, media, path, "imported by workflow")
+}
+
+// workflowImportTarget returns the media item the download of a workflow
+// is a file of, or nil if it is a new item. Downloads matching several
+// library items, or matching one without confidence, park the workflow
+// with a manual import for an admin to resolve.
+func (s *LibraryService) workflowImportTarget(
+	ctx context.Context,
+	wf *saga.Workflow,
+	library *domain.Library,
+) (*models.Media, error) {
+	// A retried import may already have created or matched the media item
+	media, err := s.repo.GetMedia(ctx, wf.MediaID)
+	if err == nil {
+		return media, nil
+	}
+	if !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if matched := wf.Data[WorkflowDataMatchedMediaID]; matched != "" {
+		id, err := uuid.Parse(matched)
+		if err != nil {
+			return nil, errors.BadRequest("workflow has no valid matched media ID")
+		}
+		return s.repo.GetMedia(ctx, id)
+	}
+
+	source := wf.Data[WorkflowDataPath]
+	title, year := domain.ExtractTitle(source), domain.ExtractYear(source)
+	candidates, err := s.importCandidates(ctx, library, title, year)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	if match := domain.ConfidentMatch(candidates); match != nil {
+		wf.Data[WorkflowDataMatchedMediaID] = match.MediaID.String()
+		return s.repo.GetMedia(ctx, match.MediaID)
+	}
+
+	if err := s.parkManualImport(ctx, wf, library, candidates, nil); err != nil {
+		return nil, err
+	}
+	return nil, saga.Park(fmt.Sprintf("%q matches %d library items without confidence", title, len(candidates)))
+}
+
+// checkWorkflowReplacement compares the download of a workflow with the
+// file the media item it matched already has. Unless the replace rules
+// replace it automatically, the workflow is parked with a manual import
+// for an admin to decide.
+func (s *LibraryService) checkWorkflowReplacement(
+	ctx context.Context,
+	wf *saga.Workflow,
+	library *domain.Library,
+	media *models.Media,
+) error {
+	comparison, err := s.compareFile(library, media, wf.Data[WorkflowDataPath])
+	if err != nil {
+		return err
+	}
+	if s.replaceRules.Auto && comparison.Replace {
+		s.logger.Info("Replacing media file",
+			interfaces.String("workflow_id", wf.ID.String()),
+			interfaces.String("media_id", media.ID.String()),
+			interfaces.String("reason", comparison.Reason))
+		return nil
+	}
+
+	candidates := []domain.ImportCandidate{{MediaID: media.ID, Title: media.Title, Year: media.Year, Score: 1}}
+	if err := s.parkManualImport(ctx, wf, library, candidates, comparison); err != nil {
+		return err
+	}
+	return saga.Park(fmt.Sprintf("%q already has a file: %s", media.Title, comparison.Reason))
+}
+
+// parkManualImport records the download of a workflow as a manual import,
+// for an admin to pick one of its candidates or decide on the replacement
+// of an existing file.
+func (s *LibraryService) parkManualImport(
+	ctx context.Context,
+	wf *saga.Workflow,
+	library *domain.Library,
+	candidates []domain.ImportCandidate,
+	replacement *domain.FileComparison,
+) error {
+	source := wf.Data[WorkflowDataPath]
+	mi := &domain.ManualImport{
+		LibraryID:      library.ID,
+		WorkflowID:     wf.ID,
+		MediaID:        wf.MediaID,
+		Path:           source,
+		DownloadClient: wf.Data[WorkflowDataDownloadClient],
+		Release:        workflowRelease(wf),
+		Title:          domain.ExtractTitle(source),
+		Year:           domain.ExtractYear(source),
+		Candidates:     candidates,
+		Replacement:    replacement,
+		Status:         domain.ManualImportPending,
+		CreatedAt:      time.Now(),
+	}
+	if err := s.repo.CreateManualImport(ctx, mi); err != nil {
+		return err
+	}
+	wf.Data[WorkflowDataManualImportID] = mi.ID.String()
+
+	s.logger.Info("Import parked for manual matching",
+		interfaces.String("workflow_id", wf.ID.String()),
+		interfaces.String("manual_import_id", mi.ID.String()),
+		interfaces.Int("candidates", len(candidates)))
+	return nil
+}
+
+// importCandidates returns the items of a library a download titled title
+// may be a file of, best first.
+func (s *LibraryService) importCandidates(
+	ctx context.Context,
+	library *domain.Library,
+	title string,
+	year int,
+) ([]domain.ImportCandidate, error) {
+	if title == "" {
+		return nil, nil
+	}
+
+	mediaType := library.Type
+	media, err := s.repo.SearchMedia(ctx, title, &mediaType, nil, &library.ID, maxImportCandidates, 0)
+	if err != nil {
+		return nil, err
+	}
+	return domain.MatchImportCandidates(title, year, media), nil
+}
+
+// applyImport points a media item at a file imported into a library and
+// makes it available. A nil media creates a new item with the given ID.
+// Files of series naming known episodes, as in "S01E01-E02" or "S01E03
+// Part 2", are linked to those episodes instead of the series itself.
+func (s *LibraryService) applyImport(
+	ctx context.Context,
+	library *domain.Library,
+	id uuid.UUID,
+	media *models.Media,
+	path string,
+	reason string,
+) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat imported file: %w", err)
+	}
+
+	modified := info.ModTime()
+	created := media == nil
+	if created {
+		media = &models.Media{
+			ID:        id,
+			TenantID:  library.TenantID,
+			LibraryID: library.ID,
+			Title:     domain.ExtractTitle(path),
+			Type:      models.MediaType(library.Type),
+			Added:     time.Now(),
+			Status:    string(models.MediaStatusPending),
+		}
+	}
+
+	// Files of series episodes are linked to the episodes they hold
+	linked := false
+	if !created {
+		if linked, err = s.linkEpisodeFile(ctx, library, media, path); err != nil {
+			return err
+		}
+	}
+	if !linked {
+		media.Path = path
+		media.Size = info.Size()
+		media.Modified = modified
+		media.FilePath = path
+		media.FileSize = info.Size()
+		media.FileModifiedAt = &modified
+	}
+	media.LastScanned = time.Now()
+
+	if err := s.transitionMedia(ctx, media, models.MediaStatusAvailable, reason); err != nil {
+		return err
+	}
+
+	if created {
+		if err := s.repo.CreateMedia(ctx, media); err != nil {
+			return err
+		}
+		s.eventBus.PublishAsync(ctx, domain.NewMediaAddedEvent(media))
+		return nil
+	}
+
+	if err := s.repo.UpdateMedia(ctx, media); err != nil {
+		return err
+	}
+	_ = s.cache.Delete(ctx, "media:"+media.ID.String())
+	return nil
+}
+
+func (s *LibraryService) revertWorkflowImport(ctx context.Context, wf *saga.Workflow) error {
+	s.blocklistFailedImport(ctx, wf)
+
+	mediaID := wf.MediaID
+	if matched, err := uuid.Parse(wf.Data[WorkflowDataMatchedMediaID]); err == nil {
+		mediaID = matched
+	}
+	if _, err := s.SetMediaStatus(ctx, mediaID, models.MediaStatusError, "workflow compensated"); err != nil &&
+		!errors.IsNotFound(err) {
+		return err
+	}
+
+	paths := []string{wf.Data[WorkflowDataImportedPath]}
+	if s.importModes.For(wf.Data[WorkflowDataDownloadClient]) == domain.ImportModeMove {
+		paths = append(paths, wf.Data[WorkflowDataPath])
+	}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove imported file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// blocklistFailedImport blocklists the release of a workflow whose import
+// step failed. Workflows compensated for a later step imported fine, and
+// workflows that do not name their release have nothing to blocklist.
+// Failures are logged so the rest of the compensation still runs.
+func (s *LibraryService) blocklistFailedImport(ctx context.Context, wf *saga.Workflow) {
+	var failure string
+	for _, step := range wf.Steps {
+		if step.Name == WorkflowStepImport && step.Status == saga.StepStatusFailed {
+			failure = step.Error
+		}
+	}
+	if failure == "" {
+		return
+	}
+
+	release := workflowRelease(wf)
+	if release.Validate() != nil {
+		return
+	}
+
+	mediaID := wf.MediaID
+	entry := &domain.BlocklistEntry{
+		ReleaseIdentity: release,
+		MediaID:         &mediaID,
+		Source:          domain.BlocklistSourceImportFailed,
+		Reason:          failure,
+		CreatedAt:       time.Now(),
+	}
+	if err := s.repo.AddBlocklistEntry(ctx, entry); err != nil {
+		s.logger.Error("Failed to blocklist release",
+			interfaces.String("workflow_id", wf.ID.String()),
+			interfaces.Error(err))
+		return
+	}
+
+	s.logger.Info("Release blocklisted after failed import",
+		interfaces.String("workflow_id", wf.ID.String()),
+		interfaces.String("title", release.Title))
+}
+
+// workflowRelease returns the release a workflow downloaded, as far as
+// its data names it.
+func workflowRelease(wf *saga.Workflow) domain.ReleaseIdentity {
+	return domain.ReleaseIdentity{
+		InfoHash: strings.ToLower(wf.Data[WorkflowDataReleaseInfoHash]),
+		GUID:     wf.Data[WorkflowDataReleaseGUID],
+		Title:    wf.Data[WorkflowDataReleaseTitle],
+		Indexer:  wf.Data[WorkflowDataReleaseIndexer],
+	}
+}
+
+// placeImport puts the downloaded file of a workflow into the library and
+// returns its path there. A retried import reuses the file placed before.
+func (s *LibraryService) placeImport(wf *saga.Workflow, library *domain.Library) (string, error) {
+	if imported := wf.Data[WorkflowDataImportedPath]; imported != "" && pathExists(imported) {
+		return imported, nil
+	}
+
+	target, method, err := s.placeDownload(wf.Data[WorkflowDataPath], wf.Data[WorkflowDataDownloadClient], library)
+	if err != nil {
+		return "", err
+	}
+	wf.Data[WorkflowDataImportedPath] = target
+	wf.Data[WorkflowDataImportMethod] = method
+
+	s.logger.Info("Imported file placed in library",
+		interfaces.String("media_id", wf.MediaID.String()),
+		interfaces.String("path", target),
+		interfaces.String("method", method))
+
+	return target, nil
+}
+
+// placeDownload puts a file downloaded by a download client into a library
+// with the client's import mode, and returns its path there and how it got
+// there. Files already in the library stay in place.
+func (s *LibraryService) placeDownload(
+	source, downloadClient string,
+	library *domain.Library,
+) (string, string, error) {
+	target, outside := domain.ImportPath(library, source)
+	if !outside {
+		return target, domain.ImportMethodInPlace, nil
+	}
+
+	info, err := os.Stat(source)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to stat downloaded file: %w", err)
+	}
+
+	mode := s.importModes.For(downloadClient)
+	method, err := placeFile(source, target, mode)
+	if err != nil {
+		return "", "", err
+	}
+	if method == domain.ImportMethodLinked {
+		s.importSpaceSaved.Add(info.Size())
+	}
+	if mode == domain.ImportModeLink && method != domain.ImportMethodLinked {
+		s.logger.Warn("Imported file copied as it could not be hardlinked, such as across file systems",
+			interfaces.String("source", source),
+			interfaces.String("path", target))
+	}
+	return target, method, nil
+}
+
+// placeFile links, copies or moves src to dst and returns how it got there.
+// Hardlinks that fail, as they do across file systems, fall back to a copy.
+func placeFile(src, dst string, mode domain.ImportMode) (string, error) {
+	if _, err := os.Lstat(dst); err == nil {
+		return "", errors.Conflict(fmt.Sprintf("%s already exists in the library", dst))
+	}
+
+	switch mode {
+	case domain.ImportModeMove:
+		if err := moveFile(src, dst); err != nil {
+			return "", err
+		}
+		return domain.ImportMethodMoved, nil
+	case domain.ImportModeLink:
+		if err := os.Link(src, dst); err == nil {
+			return domain.ImportMethodLinked, nil
+		}
+	}
+
+	if err := copyFile(src, dst); err != nil {
+		_ = os.Remove(dst)
+		return "", fmt.Errorf("failed to copy file: %w", err)
+	}
+	return domain.ImportMethodCopied, nil
+}
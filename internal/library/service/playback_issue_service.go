@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/internal/library/repository"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// PlaybackIssueService records the stalls, decode errors and bitrate
+// switches clients report while playing media, and flags media whose
+// sessions fail too often for verification or re-transcoding.
+type PlaybackIssueService struct {
+	repo     repository.Repository
+	policy   domain.PlaybackFlagPolicy
+	window   time.Duration
+	eventBus interfaces.EventBus
+	logger   interfaces.Logger
+}
+
+// NewPlaybackIssueService creates a new playback issue service. Issues
+// reported longer than window ago no longer count.
+func NewPlaybackIssueService(
+	repo repository.Repository,
+	policy domain.PlaybackFlagPolicy,
+	window time.Duration,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+) *PlaybackIssueService {
+	return &PlaybackIssueService{
+		repo:     repo,
+		policy:   policy,
+		window:   window,
+		eventBus: eventBus,
+		logger:   logger,
+	}
+}
+
+// ReportIssue records an issue of a playback session. Errors may flag the
+// media; failing to evaluate the flag does not fail the report.
+func (s *PlaybackIssueService) ReportIssue(ctx context.Context, issue *domain.PlaybackIssue) error {
+	if err := issue.Validate(); err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	if _, err := s.repo.GetMedia(ctx, issue.MediaID); err != nil {
+		return err
+	}
+
+	issue.ReportedAt = time.Now()
+	if err := s.repo.CreatePlaybackIssue(ctx, issue); err != nil {
+		return err
+	}
+
+	if issue.Kind.IsError() {
+		if err := s.evaluate(ctx, issue.MediaID); err != nil {
+			s.logger.Error("Failed to evaluate playback issues",
+				interfaces.String("media_id", issue.MediaID.String()),
+				interfaces.Error(err))
+		}
+	}
+	return nil
+}
+
+// ListIssueStats lists a page of the issues reported per media, of a
+// library or of every library if libraryID is nil, highest error rate
+// first, and the number of media in all pages.
+func (s *PlaybackIssueService) ListIssueStats(
+	ctx context.Context,
+	libraryID *uuid.UUID,
+	flaggedOnly bool,
+	limit, offset int,
+) ([]*domain.PlaybackIssueStats, int64, error) {
+	return s.repo.ListPlaybackIssueStats(ctx, domain.PlaybackIssueFilter{
+		LibraryID:   libraryID,
+		Since:       s.since(),
+		FlaggedOnly: flaggedOnly,
+	}, limit, offset)
+}
+
+// ClearIssues removes the flag of media and the issues reported for it,
+// once its file was verified or transcoded again.
+func (s *PlaybackIssueService) ClearIssues(ctx context.Context, mediaID uuid.UUID) error {
+	if _, err := s.repo.GetMedia(ctx, mediaID); err != nil {
+		return err
+	}
+	return s.repo.ClearPlaybackIssues(ctx, mediaID)
+}
+
+// evaluate flags media whose error rate exceeds the policy, once.
+func (s *PlaybackIssueService) evaluate(ctx context.Context, mediaID uuid.UUID) error {
+	stats, err := s.repo.GetPlaybackIssueStats(ctx, mediaID, s.since())
+	if err != nil {
+		return err
+	}
+	if stats.Flag != nil {
+		return nil
+	}
+	reason, flag := s.policy.Evaluate(stats)
+	if !flag {
+		return nil
+	}
+
+	flagged := &domain.PlaybackFlag{
+		MediaID:   mediaID,
+		Reason:    reason,
+		ErrorRate: stats.ErrorRate(),
+		FlaggedAt: time.Now(),
+	}
+	claimed, err := s.repo.FlagPlayback(ctx, flagged)
+	if err != nil || !claimed {
+		return err
+	}
+
+	s.logger.Warn("Media flagged for playback errors",
+		interfaces.String("media_id", mediaID.String()),
+		interfaces.String("reason", string(reason)),
+		interfaces.Any("error_rate", flagged.ErrorRate),
+		interfaces.Any("sessions", stats.Sessions))
+	s.eventBus.PublishAsync(ctx, domain.NewMediaPlaybackFlaggedEvent(*flagged, *stats))
+	return nil
+}
+
+// since returns when the issues that count were reported from.
+func (s *PlaybackIssueService) since() time.Time {
+	return time.Now().Add(-s.window)
+}
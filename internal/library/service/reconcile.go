@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+
+	"github.com/narwhalmedia/narwhal/pkg/recovery"
+)
+
+// interruptedReason is recorded on work a previous process left unfinished.
+const interruptedReason = "interrupted by restart"
+
+// Reconcile fails the tasks, scans and workflows a previous process left
+// in progress and returns a report of what it found. Scans and workflows
+// are not resumed: a scan can simply be started again, and an interrupted
+// workflow step may have had side effects that need a look first. It must
+// run before the service starts new work.
+func (s *LibraryService) Reconcile(ctx context.Context) *recovery.Report {
+	return recovery.Run(ctx, "library", s.logger,
+		recovery.Step{Name: "tasks", Action: recovery.ActionFailed, Run: s.tasks.Recover},
+		recovery.Step{
+			Name:   "scans",
+			Action: recovery.ActionFailed,
+			Run: func(ctx context.Context) (int, error) {
+				return s.repo.InterruptScans(ctx, interruptedReason)
+			},
+		},
+		recovery.Step{
+			Name:   "workflows",
+			Action: recovery.ActionFailed,
+			Run: func(ctx context.Context) (int, error) {
+				return s.repo.InterruptWorkflows(ctx, interruptedReason)
+			},
+		},
+	)
+}
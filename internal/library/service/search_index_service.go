@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/constants"
+	"github.com/narwhalmedia/narwhal/internal/library/repository"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+	"github.com/narwhalmedia/narwhal/pkg/task"
+)
+
+// TaskTypeSearchReindex is the type of the task rebuilding the search index.
+const TaskTypeSearchReindex = "search.reindex"
+
+// SearchIndexService keeps the full-text search index in sync with the
+// media. Media events update the index incrementally; RebuildSearchIndex
+// reindexes everything.
+type SearchIndexService struct {
+	repo     repository.Repository
+	tasks    *task.Manager
+	eventBus interfaces.EventBus
+	logger   interfaces.Logger
+}
+
+// NewSearchIndexService creates a new search index service. Rebuilds run
+// as tasks of the given manager.
+func NewSearchIndexService(
+	repo repository.Repository,
+	tasks *task.Manager,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+) *SearchIndexService {
+	return &SearchIndexService{
+		repo:     repo,
+		tasks:    tasks,
+		eventBus: eventBus,
+		logger:   logger,
+	}
+}
+
+// Start subscribes the index updater to added, updated and deleted media.
+func (s *SearchIndexService) Start() error {
+	index := events.NewConsumer("library.search_index", 1, s.handleMediaChanged)
+	for _, eventType := range []string{"media.added", "media.updated"} {
+		if err := s.eventBus.Subscribe(eventType, index); err != nil {
+			return fmt.Errorf("failed to subscribe to %s: %w", eventType, err)
+		}
+	}
+
+	remove := events.NewConsumer("library.search_index", 1, s.handleMediaDeleted)
+	if err := s.eventBus.Subscribe("media.deleted", remove); err != nil {
+		return fmt.Errorf("failed to subscribe to media.deleted: %w", err)
+	}
+	return nil
+}
+
+// RebuildSearchIndex starts a task reindexing all media. Documents of media
+// that no longer exist are removed once every media item is indexed.
+func (s *SearchIndexService) RebuildSearchIndex(ctx context.Context) (*task.Task, error) {
+	running, err := s.tasks.List(ctx, task.Filter{Type: TaskTypeSearchReindex, Status: task.StatusRunning}, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(running) > 0 {
+		return nil, errors.Conflict("search index rebuild already in progress")
+	}
+
+	return s.tasks.Submit(ctx, TaskTypeSearchReindex, nil, s.rebuild)
+}
+
+func (s *SearchIndexService) rebuild(ctx context.Context) error {
+	started := time.Now()
+
+	libraries, err := s.repo.ListLibraries(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	indexed := 0
+	for i, library := range libraries {
+		for offset := 0; ; offset += constants.MaxPageSize {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			batch, err := s.repo.ListMediaByLibrary(ctx, library.ID, nil, constants.MaxPageSize, offset)
+			if err != nil {
+				return err
+			}
+			if err := s.repo.IndexMedia(ctx, batch); err != nil {
+				return err
+			}
+			indexed += len(batch)
+			task.SetProgress(ctx, float64(i)/float64(len(libraries)),
+				fmt.Sprintf("Indexed %d media in %d of %d libraries", indexed, i, len(libraries)))
+
+			if len(batch) < constants.MaxPageSize {
+				break
+			}
+		}
+		task.Log(ctx, fmt.Sprintf("Indexed library %s", library.Name))
+	}
+
+	// Documents the rebuild did not refresh belong to deleted media
+	pruned, err := s.repo.PruneSearchIndex(ctx, started)
+	if err != nil {
+		return err
+	}
+	task.Log(ctx, fmt.Sprintf("Indexed %d media, removed %d stale documents", indexed, pruned))
+
+	s.logger.Info("Search index rebuilt",
+		interfaces.Int("indexed", indexed),
+		interfaces.Int("pruned", pruned),
+		interfaces.Any("duration", time.Since(started)))
+	return nil
+}
+
+// handleMediaChanged indexes added and updated media. The media is read
+// back, so redelivered or reordered events index its current state.
+func (s *SearchIndexService) handleMediaChanged(ctx context.Context, env *events.Envelope) error {
+	mediaID, ok := eventMediaID(env)
+	if !ok {
+		return nil
+	}
+
+	media, err := s.repo.GetMedia(ctx, mediaID)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return s.repo.RemoveFromSearchIndex(ctx, mediaID)
+		}
+		return err
+	}
+	return s.repo.IndexMedia(ctx, []*models.Media{media})
+}
+
+// handleMediaDeleted removes deleted media from the index.
+func (s *SearchIndexService) handleMediaDeleted(ctx context.Context, env *events.Envelope) error {
+	mediaID, ok := eventMediaID(env)
+	if !ok {
+		return nil
+	}
+	return s.repo.RemoveFromSearchIndex(ctx, mediaID)
+}
+
+// eventMediaID returns the media ID of a media event.
+func eventMediaID(env *events.Envelope) (uuid.UUID, bool) {
+	id, ok := env.Payload()["media_id"].(string)
+	if !ok {
+		return uuid.Nil, false
+	}
+	mediaID, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return mediaID, true
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/internal/library/repository"
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/tenant"
+)
+
+// shareTokenSize is the number of random bytes in a share link token.
+const shareTokenSize = 32
+
+// ShareTokenIssuer issues the tokens guests stream shared media with.
+type ShareTokenIssuer interface {
+	GenerateShareToken(tenantID uuid.UUID, grant auth.ShareGrant, ttl time.Duration) (string, time.Time, error)
+}
+
+// ShareLinkService manages the links users create to let guests without an
+// account stream a media item. Playing a link counts a view, is audited and
+// issues a short-lived token that only streams the shared item, at the
+// bitrate of the link.
+type ShareLinkService struct {
+	repo     repository.Repository
+	issuer   ShareTokenIssuer
+	policy   domain.ShareLinkPolicy
+	eventBus interfaces.EventBus
+	logger   interfaces.Logger
+}
+
+// NewShareLinkService creates a new share link service.
+func NewShareLinkService(
+	repo repository.Repository,
+	issuer ShareTokenIssuer,
+	policy domain.ShareLinkPolicy,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+) *ShareLinkService {
+	return &ShareLinkService{
+		repo:     repo,
+		issuer:   issuer,
+		policy:   policy,
+		eventBus: eventBus,
+		logger:   logger,
+	}
+}
+
+// Create creates a link to media for a user. It returns the link and its
+// token, which is not stored and cannot be retrieved later.
+func (s *ShareLinkService) Create(
+	ctx context.Context,
+	userID, mediaID uuid.UUID,
+	ttl time.Duration,
+	maxViews, maxBitrate int,
+) (*domain.ShareLink, string, error) {
+	if _, err := s.repo.GetMedia(ctx, mediaID); err != nil {
+		return nil, "", err
+	}
+
+	token, err := newShareToken()
+	if err != nil {
+		return nil, "", err
+	}
+	tenantID, _ := tenant.FromContext(ctx)
+	link := &domain.ShareLink{
+		TenantID:  tenantID,
+		MediaID:   mediaID,
+		CreatedBy: userID,
+		TokenHash: domain.HashShareToken(token),
+		CreatedAt: time.Now(),
+	}
+	if err := s.policy.Apply(link, ttl, maxViews, maxBitrate); err != nil {
+		return nil, "", errors.BadRequest(err.Error())
+	}
+	if err := s.repo.CreateShareLink(ctx, link); err != nil {
+		return nil, "", err
+	}
+
+	s.logger.Info("Media shared",
+		interfaces.String("share_link_id", link.ID.String()),
+		interfaces.String("media_id", mediaID.String()),
+		interfaces.String("user_id", userID.String()))
+	s.eventBus.PublishAsync(ctx, domain.NewMediaSharedEvent(*link))
+	return link, token, nil
+}
+
+// List lists a page of the links of a user, or of every user for admins,
+// of one media item if mediaID is set, newest first, and the number of
+// links in all pages.
+func (s *ShareLinkService) List(
+	ctx context.Context,
+	userID uuid.UUID,
+	admin bool,
+	mediaID *uuid.UUID,
+	limit, offset int,
+) ([]*domain.ShareLink, int64, error) {
+	filter := domain.ShareLinkFilter{MediaID: mediaID}
+	if !admin {
+		filter.CreatedBy = &userID
+	}
+	return s.repo.ListShareLinks(ctx, filter, limit, offset)
+}
+
+// Revoke revokes a link so it can no longer be played. Streams started
+// before stop when their token expires. Users may only revoke their own
+// links; admins may revoke any.
+func (s *ShareLinkService) Revoke(ctx context.Context, userID uuid.UUID, admin bool, id uuid.UUID) (*domain.ShareLink, error) {
+	link, err := s.ownedLink(ctx, userID, admin, id)
+	if err != nil {
+		return nil, err
+	}
+	if link.RevokedAt == nil {
+		now := time.Now()
+		if err := s.repo.RevokeShareLink(ctx, id, now); err != nil {
+			return nil, err
+		}
+		link.RevokedAt = &now
+
+		s.logger.Info("Share link revoked",
+			interfaces.String("share_link_id", id.String()),
+			interfaces.String("user_id", userID.String()))
+	}
+	return link, nil
+}
+
+// ListPlays lists a page of the plays of a link, newest first, and the
+// number of plays in all pages. Users may only audit their own links;
+// admins may audit any.
+func (s *ShareLinkService) ListPlays(
+	ctx context.Context,
+	userID uuid.UUID,
+	admin bool,
+	id uuid.UUID,
+	limit, offset int,
+) ([]*domain.ShareLinkPlay, int64, error) {
+	if _, err := s.ownedLink(ctx, userID, admin, id); err != nil {
+		return nil, 0, err
+	}
+	return s.repo.ListShareLinkPlays(ctx, id, limit, offset)
+}
+
+// Redeem plays a link for a guest: it counts a view, records the play and
+// issues the token to stream the shared media with. The link's tenant is
+// taken from the link, since guests have none.
+func (s *ShareLinkService) Redeem(ctx context.Context, token, ipAddress, userAgent string) (*domain.ShareGrant, error) {
+	if token == "" {
+		return nil, errors.BadRequest("share token is required")
+	}
+	link, err := s.repo.GetShareLinkByTokenHash(ctx, domain.HashShareToken(token))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if st := link.Status(now); st != domain.ShareLinkActive {
+		return nil, errors.Forbidden(fmt.Sprintf("share link is %s", st))
+	}
+
+	ctx = tenant.WithTenantID(ctx, link.TenantID)
+	if _, err := s.repo.GetMedia(ctx, link.MediaID); err != nil {
+		return nil, err
+	}
+
+	play := &domain.ShareLinkPlay{
+		ShareLinkID: link.ID,
+		MediaID:     link.MediaID,
+		IPAddress:   ipAddress,
+		UserAgent:   userAgent,
+		PlayedAt:    now,
+	}
+	link, err = s.repo.RecordShareLinkPlay(ctx, play)
+	if err != nil {
+		if errors.IsConflict(err) {
+			return nil, errors.Forbidden(err.Error())
+		}
+		return nil, err
+	}
+
+	streamToken, expiresAt, err := s.issuer.GenerateShareToken(link.TenantID, auth.ShareGrant{
+		LinkID:     link.ID.String(),
+		MediaID:    link.MediaID.String(),
+		MaxBitrate: link.MaxBitrate,
+	}, s.policy.StreamExpiry(link, now).Sub(now))
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Share link played",
+		interfaces.String("share_link_id", link.ID.String()),
+		interfaces.String("media_id", link.MediaID.String()),
+		interfaces.String("ip_address", ipAddress),
+		interfaces.Int("views", link.Views))
+	s.eventBus.PublishAsync(ctx, domain.NewShareLinkPlayedEvent(*link, *play))
+	return &domain.ShareGrant{Link: link, StreamToken: streamToken, ExpiresAt: expiresAt}, nil
+}
+
+// ownedLink returns a link the user may manage. Links of other users are
+// reported as not found to users who are not admins.
+func (s *ShareLinkService) ownedLink(ctx context.Context, userID uuid.UUID, admin bool, id uuid.UUID) (*domain.ShareLink, error) {
+	link, err := s.repo.GetShareLink(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !admin && link.CreatedBy != userID {
+		return nil, errors.NotFound("share link not found")
+	}
+	return link, nil
+}
+
+func newShareToken() (string, error) {
+	b := make([]byte, shareTokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate share token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/internal/library/repository"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// storageSnapshotTimeout bounds the query behind the storage usage served
+// on the debug vars endpoint.
+const storageSnapshotTimeout = 5 * time.Second
+
+// StorageService accounts for the disk space taken by media files, per
+// library, media type and resolution. The usage of a library is recomputed
+// whenever a scan, import or media change touches it.
+type StorageService struct {
+	repo     repository.Repository
+	eventBus interfaces.EventBus
+	logger   interfaces.Logger
+
+	mu sync.Mutex
+	// refreshed holds when the last refresh of each library started. Events
+	// older than that are already accounted for, which keeps a scan's media
+	// events from refreshing the library once per file.
+	refreshed map[uuid.UUID]int64
+}
+
+// NewStorageService creates a new storage service.
+func NewStorageService(
+	repo repository.Repository,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+) *StorageService {
+	return &StorageService{
+		repo:      repo,
+		eventBus:  eventBus,
+		logger:    logger,
+		refreshed: make(map[uuid.UUID]int64),
+	}
+}
+
+// Start subscribes the service to the events that change what is stored in
+// a library.
+func (s *StorageService) Start() error {
+	refresh := events.NewConsumer("library.storage", 1, s.handleLibraryChanged)
+	for _, eventType := range []string{
+		"library.scan.completed",
+		"library.imported",
+		"media.added",
+		"media.updated",
+		"media.deleted",
+	} {
+		if err := s.eventBus.Subscribe(eventType, refresh); err != nil {
+			return fmt.Errorf("failed to subscribe to %s: %w", eventType, err)
+		}
+	}
+
+	remove := events.NewConsumer("library.storage", 1, s.handleLibraryDeleted)
+	if err := s.eventBus.Subscribe("library.deleted", remove); err != nil {
+		return fmt.Errorf("failed to subscribe to library.deleted: %w", err)
+	}
+	return nil
+}
+
+// Usage returns the storage usage of a library, or of every library if
+// libraryID is nil.
+func (s *StorageService) Usage(ctx context.Context, libraryID *uuid.UUID) ([]*domain.StorageUsage, error) {
+	if libraryID != nil {
+		if _, err := s.repo.GetLibrary(ctx, *libraryID); err != nil {
+			return nil, err
+		}
+	}
+	return s.repo.ListStorageUsage(ctx, libraryID)
+}
+
+// RefreshAll recomputes the storage usage of every library.
+func (s *StorageService) RefreshAll(ctx context.Context) error {
+	libraries, err := s.repo.ListLibraries(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, library := range libraries {
+		if err := s.refresh(ctx, library.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Snapshot returns the storage totals by library, media type and
+// resolution. It is published on the debug vars endpoint.
+func (s *StorageService) Snapshot() interface{} {
+	ctx, cancel := context.WithTimeout(context.Background(), storageSnapshotTimeout)
+	defer cancel()
+
+	usage, err := s.repo.ListStorageUsage(ctx, nil)
+	if err != nil {
+		return map[string]interface{}{"error": err.Error()}
+	}
+
+	total := domain.StorageTotals{}
+	byLibrary := domain.StorageTotals{}
+	byType := domain.StorageTotals{}
+	byResolution := domain.StorageTotals{}
+	for _, u := range usage {
+		total.Add("", u)
+		byLibrary.Add(u.LibraryID.String(), u)
+		byType.Add(u.MediaType, u)
+		byResolution.Add(u.Resolution, u)
+	}
+
+	return map[string]interface{}{
+		"total":         total[""],
+		"by_library":    byLibrary,
+		"by_media_type": byType,
+		"by_resolution": byResolution,
+	}
+}
+
+func (s *StorageService) refresh(ctx context.Context, libraryID uuid.UUID) error {
+	started := time.Now().UnixNano()
+	if err := s.repo.RefreshStorageUsage(ctx, libraryID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.refreshed[libraryID] = started
+	s.mu.Unlock()
+	return nil
+}
+
+// handleLibraryChanged recomputes the usage of the library an event is
+// about, unless a refresh has run since the event.
+func (s *StorageService) handleLibraryChanged(ctx context.Context, env *events.Envelope) error {
+	libraryID, ok := eventLibraryID(env)
+	if !ok {
+		return nil
+	}
+
+	s.mu.Lock()
+	refreshed := s.refreshed[libraryID]
+	s.mu.Unlock()
+	if env.Timestamp() < refreshed {
+		return nil
+	}
+
+	return s.refresh(ctx, libraryID)
+}
+
+// handleLibraryDeleted drops the usage of a deleted library.
+func (s *StorageService) handleLibraryDeleted(ctx context.Context, env *events.Envelope) error {
+	libraryID, ok := eventLibraryID(env)
+	if !ok {
+		return nil
+	}
+
+	s.mu.Lock()
+	delete(s.refreshed, libraryID)
+	s.mu.Unlock()
+	return s.repo.DeleteStorageUsage(ctx, libraryID)
+}
+
+// eventLibraryID returns the library ID of a library or media event.
+func eventLibraryID(env *events.Envelope) (uuid.UUID, bool) {
+	id, ok := env.Payload()["library_id"].(string)
+	if !ok {
+		return uuid.Nil, false
+	}
+	libraryID, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return libraryID, true
+}
@@ -0,0 +1,272 @@
+package service
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"os"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/internal/library/repository"
+	"github.com/narwhalmedia/narwhal/pkg/assets"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// ThemeService finds and stores the theme music of series. Themes are kept
+// in the asset store, so the episodes of a series share one object.
+type ThemeService struct {
+	repo      repository.Repository
+	assets    *assets.Store
+	cache     interfaces.Cache
+	eventBus  interfaces.EventBus
+	logger    interfaces.Logger
+	providers []domain.ThemeProvider
+	maxBytes  int
+}
+
+// NewThemeService creates a new theme service. Themes larger than maxBytes
+// are rejected.
+func NewThemeService(
+	repo repository.Repository,
+	assetStore *assets.Store,
+	cache interfaces.Cache,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+	maxBytes int,
+) *ThemeService {
+	return &ThemeService{
+		repo:     repo,
+		assets:   assetStore,
+		cache:    cache,
+		eventBus: eventBus,
+		logger:   logger,
+		maxBytes: maxBytes,
+	}
+}
+
+// WithProviders sets the providers themes are downloaded from, in order of
+// preference.
+func (s *ThemeService) WithProviders(providers ...domain.ThemeProvider) *ThemeService {
+	s.providers = providers
+	return s
+}
+
+// Start subscribes the service to added media, whose theme sidecars are
+// picked up automatically, and to deleted media, whose themes are released.
+func (s *ThemeService) Start() error {
+	consumer := events.NewConsumer("library.themes", 1, s.handleMediaAdded)
+	if err := s.eventBus.Subscribe("media.added", consumer); err != nil {
+		return fmt.Errorf("failed to subscribe to media.added: %w", err)
+	}
+
+	release := events.NewConsumer("library.themes", 1, s.handleMediaDeleted)
+	if err := s.eventBus.Subscribe("media.deleted", release); err != nil {
+		return fmt.Errorf("failed to subscribe to media.deleted: %w", err)
+	}
+	return nil
+}
+
+// RefreshTheme looks for the theme of a series, first in a theme.mp3 sidecar
+// and then at the providers, and stores it.
+func (s *ThemeService) RefreshTheme(ctx context.Context, mediaID uuid.UUID) (*models.Media, error) {
+	media, err := s.repo.GetMedia(ctx, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	if !hasTheme(media) {
+		return nil, errors.BadRequest("theme music is only supported for series")
+	}
+
+	library, err := s.repo.GetLibrary(ctx, media.LibraryID)
+	if err != nil {
+		return nil, err
+	}
+
+	if path, ok := domain.FindThemeSidecar(library.Path, media.Path); ok {
+		data, err := s.readSidecar(path)
+		if err != nil {
+			return nil, err
+		}
+		return media, s.setTheme(ctx, media, data)
+	}
+
+	for _, provider := range s.providers {
+		data, err := provider.GetTheme(ctx, media, s.maxBytes)
+		if err != nil {
+			if !stderrors.Is(err, domain.ErrThemeNotFound) {
+				s.logger.Warn("Failed to download theme",
+					interfaces.String("provider", provider.GetName()),
+					interfaces.String("media_id", mediaID.String()),
+					interfaces.Error(err))
+			}
+			continue
+		}
+		if !domain.IsMP3(data) {
+			s.logger.Warn("Provider returned a theme that is not an MP3",
+				interfaces.String("provider", provider.GetName()),
+				interfaces.String("media_id", mediaID.String()))
+			continue
+		}
+		return media, s.setTheme(ctx, media, data)
+	}
+
+	return nil, errors.NotFound("theme music not found")
+}
+
+// DeleteTheme clears the theme of a series.
+func (s *ThemeService) DeleteTheme(ctx context.Context, mediaID uuid.UUID) (*models.Media, error) {
+	media, err := s.repo.GetMedia(ctx, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	if media.ThemeKey == "" && media.ThemeURL == "" {
+		return media, nil
+	}
+
+	media.ThemeKey = ""
+	media.ThemeURL = ""
+	if err := s.repo.UpdateMedia(ctx, media); err != nil {
+		return nil, err
+	}
+	s.release(ctx, themeRef(mediaID), "")
+
+	_ = s.cache.Delete(ctx, "media:"+mediaID.String())
+	s.eventBus.PublishAsync(ctx, domain.NewMediaUpdatedEvent(media))
+	return media, nil
+}
+
+// handleMediaAdded stores the sidecar theme of newly added series media.
+func (s *ThemeService) handleMediaAdded(ctx context.Context, env *events.Envelope) error {
+	id, ok := env.Payload()["media_id"].(string)
+	if !ok {
+		return nil
+	}
+	mediaID, err := uuid.Parse(id)
+	if err != nil {
+		return nil
+	}
+
+	media, err := s.repo.GetMedia(ctx, mediaID)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if !hasTheme(media) || media.ThemeKey != "" {
+		return nil
+	}
+
+	library, err := s.repo.GetLibrary(ctx, media.LibraryID)
+	if err != nil {
+		return err
+	}
+	path, ok := domain.FindThemeSidecar(library.Path, media.Path)
+	if !ok {
+		return nil
+	}
+
+	data, err := s.readSidecar(path)
+	if err != nil {
+		// A broken sidecar will not fix itself on redelivery
+		s.logger.Warn("Ignoring theme sidecar",
+			interfaces.String("path", path),
+			interfaces.Error(err))
+		return nil
+	}
+	return s.setTheme(ctx, media, data)
+}
+
+// handleMediaDeleted releases the theme of deleted media.
+func (s *ThemeService) handleMediaDeleted(ctx context.Context, env *events.Envelope) error {
+	id, ok := env.Payload()["media_id"].(string)
+	if !ok {
+		return nil
+	}
+	mediaID, err := uuid.Parse(id)
+	if err != nil {
+		return nil
+	}
+	return s.assets.Release(ctx, themeRef(mediaID), "")
+}
+
+// readSidecar reads and validates a theme sidecar file.
+func (s *ThemeService) readSidecar(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read theme: %w", err)
+	}
+	if info.Size() > int64(s.maxBytes) {
+		return nil, errors.BadRequest(fmt.Sprintf("theme %s exceeds %d bytes", path, s.maxBytes))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read theme: %w", err)
+	}
+	if !domain.IsMP3(data) {
+		return nil, errors.BadRequest(fmt.Sprintf("theme %s is not an MP3 file", path))
+	}
+	return data, nil
+}
+
+// setTheme stores a theme and points the media at it, releasing the theme
+// it replaces.
+func (s *ThemeService) setTheme(ctx context.Context, media *models.Media, data []byte) error {
+	ref := themeRef(media.ID)
+	oldKey := media.ThemeKey
+	asset, err := s.assets.Put(ctx, ref, data, ".mp3")
+	if err != nil {
+		s.release(ctx, ref, oldKey)
+		return err
+	}
+	if asset.Key == oldKey {
+		return nil
+	}
+
+	media.ThemeKey = asset.Key
+	media.ThemeURL = asset.URL
+	if err := s.repo.UpdateMedia(ctx, media); err != nil {
+		s.release(ctx, ref, oldKey)
+		return err
+	}
+	s.release(ctx, ref, asset.Key)
+
+	_ = s.cache.Delete(ctx, "media:"+media.ID.String())
+	s.eventBus.PublishAsync(ctx, domain.NewMediaUpdatedEvent(media))
+
+	s.logger.Info("Theme music stored",
+		interfaces.String("media_id", media.ID.String()),
+		interfaces.Int("bytes", len(data)))
+	return nil
+}
+
+// release drops the media's themes other than keep. Failures only delay
+// garbage collection, so they are logged.
+func (s *ThemeService) release(ctx context.Context, ref assets.Ref, keep string) {
+	if err := s.assets.Release(ctx, ref, keep); err != nil {
+		s.logger.Warn("Failed to release replaced theme",
+			interfaces.String("media_id", ref.OwnerID.String()),
+			interfaces.Error(err))
+	}
+}
+
+func themeRef(mediaID uuid.UUID) assets.Ref {
+	return assets.Ref{OwnerType: assets.OwnerMedia, OwnerID: mediaID, Role: assets.RoleTheme}
+}
+
+// hasTheme reports whether media can have theme music: series, but not
+// their extras.
+func hasTheme(media *models.Media) bool {
+	switch media.Type {
+	case models.MediaTypeSeries, models.MediaTypeTV:
+		return media.ExtraType == ""
+	default:
+		return false
+	}
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/loudness"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// transcodeSource is the content hash of the file of media, computed once
+// per apply and only when a transcode is claimed.
+type transcodeSource struct {
+	hash   string
+	hashed bool
+}
+
+// sourceHash returns the content hash of the media's file, or empty if it
+// cannot be hashed. Hashing the source drops the outputs made from an
+// earlier version of the file.
+func (s *TranscodePolicyService) sourceHash(ctx context.Context, media *models.Media, source *transcodeSource) string {
+	if source.hashed {
+		return source.hash
+	}
+	source.hashed = true
+	if media.FilePath == "" {
+		return ""
+	}
+	hash, err := domain.HashTranscodeSource(media.FilePath)
+	if err != nil {
+		s.logger.Warn("Failed to hash transcode source",
+			interfaces.String("media_id", media.ID.String()),
+			interfaces.Error(err))
+		return ""
+	}
+	source.hash = hash
+	if _, err := s.repo.InvalidateTranscodeOutputs(ctx, media.ID, hash); err != nil {
+		s.logger.Warn("Failed to invalidate transcode outputs",
+			interfaces.String("media_id", media.ID.String()),
+			interfaces.Error(err))
+	}
+	return hash
+}
+
+// cachedOutput returns the completed transcode of the media's source with
+// the policy's profile, or nil if there is none. Outputs whose file is gone
+// are dropped.
+func (s *TranscodePolicyService) cachedOutput(
+	ctx context.Context,
+	media *models.Media,
+	policy *domain.TranscodePolicy,
+	source *transcodeSource,
+) *domain.TranscodeOutput {
+	if s.sourceHash(ctx, media, source) == "" {
+		return nil
+	}
+
+	profile := domain.TranscodeProfileHash(policy)
+	output, err := s.repo.GetTranscodeOutput(ctx, source.hash, profile)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			s.logger.Warn("Failed to look up transcode output",
+				interfaces.String("media_id", media.ID.String()),
+				interfaces.Error(err))
+		}
+		return nil
+	}
+	if !pathExists(output.Path) {
+		if err := s.repo.DeleteTranscodeOutput(ctx, source.hash, profile); err != nil {
+			s.logger.Warn("Failed to drop missing transcode output",
+				interfaces.String("path", output.Path),
+				interfaces.Error(err))
+		}
+		return nil
+	}
+	return output
+}
+
+// measuredLoudness returns the loudness measured before of the media's
+// source, for transcodes of a policy that normalizes their audio, or nil.
+func (s *TranscodePolicyService) measuredLoudness(
+	ctx context.Context,
+	media *models.Media,
+	policy *domain.TranscodePolicy,
+	source *transcodeSource,
+) *domain.LoudnessMeasurement {
+	if !policy.Normalizes() {
+		return nil
+	}
+	hash := s.sourceHash(ctx, media, source)
+	if hash == "" {
+		return nil
+	}
+	measured, err := s.repo.GetLoudnessMeasurement(ctx, hash)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			s.logger.Warn("Failed to look up loudness measurement",
+				interfaces.String("media_id", media.ID.String()),
+				interfaces.Error(err))
+		}
+		return nil
+	}
+	return measured
+}
+
+// handleTranscodeCompleted records the output of a completed transcode, so
+// later transcodes of the same source and profile link it, and the loudness
+// its first pass measured, so later normalized transcodes of the source
+// skip it. Outputs of a file that changed since the transcode was requested
+// are not recorded.
+func (s *TranscodePolicyService) handleTranscodeCompleted(ctx context.Context, env *events.Envelope) error {
+	payload := env.Payload()
+	id, _ := payload["media_id"].(string)
+	mediaID, err := uuid.Parse(id)
+	if err != nil {
+		return nil
+	}
+	id, _ = payload["policy_id"].(string)
+	policyID, err := uuid.Parse(id)
+	if err != nil {
+		return nil
+	}
+	key, _ := payload["dedupe_key"].(string)
+	path, _ := payload["output_path"].(string)
+	if path == "" {
+		return nil
+	}
+
+	media, err := s.repo.GetMedia(ctx, mediaID)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	policy, err := s.repo.GetTranscodePolicy(ctx, policyID)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	library, err := s.repo.GetLibrary(ctx, policy.LibraryID)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	policy = policy.Resolve(library)
+	// Retranscodes add an attempt to the key of the file
+	if current := domain.TranscodeKey(media, policy); key != current && !strings.HasPrefix(key, current+"/") {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil || media.FilePath == "" {
+		return nil
+	}
+	source, err := domain.HashTranscodeSource(media.FilePath)
+	if err != nil {
+		s.logger.Warn("Failed to hash transcode source",
+			interfaces.String("media_id", media.ID.String()),
+			interfaces.Error(err))
+		return nil
+	}
+	if measured, ok := loudnessFromPayload(payload); ok && policy.Normalizes() {
+		err := s.repo.SaveLoudnessMeasurement(ctx, &domain.LoudnessMeasurement{
+			SourceHash: source,
+			Loudness:   measured,
+			MeasuredAt: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	output := &domain.TranscodeOutput{
+		SourceHash:  source,
+		ProfileHash: domain.TranscodeProfileHash(policy),
+		MediaID:     media.ID,
+		Path:        path,
+		Size:        info.Size(),
+		CompletedAt: time.Now(),
+	}
+	if err := s.repo.SaveTranscodeOutput(ctx, output); err != nil {
+		return err
+	}
+
+	s.logger.Debug("Transcode output recorded",
+		interfaces.String("media_id", media.ID.String()),
+		interfaces.String("path", path))
+	return nil
+}
+
+// loudnessFromPayload reads the loudness the first pass of a transcode
+// measured from its completion event. Transcodes given a measurement, or
+// not normalizing their audio, report none.
+func loudnessFromPayload(payload map[string]interface{}) (loudness.Measurement, bool) {
+	var m loudness.Measurement
+	for key, to := range map[string]*float64{
+		"measured_i":      &m.Integrated,
+		"measured_tp":     &m.TruePeak,
+		"measured_lra":    &m.Range,
+		"measured_thresh": &m.Threshold,
+		"target_offset":   &m.TargetOffset,
+	} {
+		value, ok := payload[key].(float64)
+		if !ok {
+			return loudness.Measurement{}, false
+		}
+		*to = value
+	}
+	return m, true
+}
+
+// handleFileReplaced drops the outputs made from a replaced file.
+func (s *TranscodePolicyService) handleFileReplaced(ctx context.Context, env *events.Envelope) error {
+	id, _ := env.Payload()["media_id"].(string)
+	mediaID, err := uuid.Parse(id)
+	if err != nil {
+		return nil
+	}
+	_, err = s.repo.InvalidateTranscodeOutputs(ctx, mediaID, "")
+	return err
+}
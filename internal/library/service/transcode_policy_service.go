@@ -0,0 +1,441 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/internal/library/repository"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// policyBatchSize is the number of media items a library-wide policy run
+// loads at a time.
+const policyBatchSize = 100
+
+// TranscodePolicyService manages the transcode policies of libraries and
+// requests the transcodes they ask for. Each transcode is requested once
+// per file, so re-scans and overlapping policies do not duplicate work, and
+// sources transcoded with the same profile before link the earlier output
+// instead of being encoded again, and normalized transcodes of sources
+// whose loudness was measured before skip measuring it again. With
+// priorities, transcodes of media likely to be watched soon are put ahead in
+// the transcoding queue.
+type TranscodePolicyService struct {
+	repo       repository.Repository
+	eventBus   interfaces.EventBus
+	logger     interfaces.Logger
+	priorities *domain.TranscodePriorityPolicy
+
+	mu            sync.RWMutex
+	popularGenres []string
+}
+
+// NewTranscodePolicyService creates a new transcode policy service.
+func NewTranscodePolicyService(
+	repo repository.Repository,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+) *TranscodePolicyService {
+	return &TranscodePolicyService{
+		repo:     repo,
+		eventBus: eventBus,
+		logger:   logger,
+	}
+}
+
+// WithPriorities prioritizes requested transcodes by how likely their media
+// is to be watched soon.
+func (s *TranscodePolicyService) WithPriorities(policy domain.TranscodePriorityPolicy) *TranscodePolicyService {
+	s.priorities = &policy
+	return s
+}
+
+// Start subscribes the service to media becoming available, whether added
+// by an import or moved to available by a scan, to transcodes completing
+// and to files being replaced.
+func (s *TranscodePolicyService) Start() error {
+	for eventType, handle := range map[string]func(context.Context, *events.Envelope) error{
+		"media.status_changed": s.handleMediaStatusChanged,
+		"media.added":          s.handleMediaAdded,
+		"transcode.completed":  s.handleTranscodeCompleted,
+		"media.file_replaced":  s.handleFileReplaced,
+	} {
+		consumer := events.NewConsumer("library.transcode_policies", 1, handle)
+		if err := s.eventBus.Subscribe(eventType, consumer); err != nil {
+			return fmt.Errorf("failed to subscribe to %s: %w", eventType, err)
+		}
+	}
+	return nil
+}
+
+// CreatePolicy adds a transcode policy to a library. Enabled policies apply
+// to media that becomes available from now on; ApplyToLibrary applies them
+// to existing media.
+func (s *TranscodePolicyService) CreatePolicy(ctx context.Context, policy *domain.TranscodePolicy) error {
+	if err := policy.Validate(); err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	if _, err := s.repo.GetLibrary(ctx, policy.LibraryID); err != nil {
+		return err
+	}
+
+	if err := s.repo.CreateTranscodePolicy(ctx, policy); err != nil {
+		return err
+	}
+
+	s.logger.Info("Transcode policy created",
+		interfaces.String("policy_id", policy.ID.String()),
+		interfaces.String("library_id", policy.LibraryID.String()))
+	return nil
+}
+
+// ListPolicies lists the transcode policies of a library.
+func (s *TranscodePolicyService) ListPolicies(ctx context.Context, libraryID uuid.UUID) ([]*domain.TranscodePolicy, error) {
+	return s.repo.ListTranscodePolicies(ctx, libraryID)
+}
+
+// UpdatePolicy updates the settings of a transcode policy. Its library
+// cannot change.
+func (s *TranscodePolicyService) UpdatePolicy(ctx context.Context, policy *domain.TranscodePolicy) (*domain.TranscodePolicy, error) {
+	existing, err := s.repo.GetTranscodePolicy(ctx, policy.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	policy.LibraryID = existing.LibraryID
+	policy.CreatedAt = existing.CreatedAt
+	if err := policy.Validate(); err != nil {
+		return nil, errors.BadRequest(err.Error())
+	}
+	if err := s.repo.UpdateTranscodePolicy(ctx, policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// DeletePolicy deletes a transcode policy. Transcodes it requested are
+// left alone.
+func (s *TranscodePolicyService) DeletePolicy(ctx context.Context, id uuid.UUID) error {
+	return s.repo.DeleteTranscodePolicy(ctx, id)
+}
+
+// ApplyToMedia requests the transcodes the policies of the media's library
+// ask for. It returns the number of transcodes requested or linked.
+func (s *TranscodePolicyService) ApplyToMedia(ctx context.Context, mediaID uuid.UUID) (int, error) {
+	media, err := s.repo.GetMedia(ctx, mediaID)
+	if err != nil {
+		return 0, err
+	}
+
+	policies, err := s.resolvedPolicies(ctx, media.LibraryID)
+	if err != nil {
+		return 0, err
+	}
+	return s.apply(ctx, media, policies)
+}
+
+// Retranscode requests the transcodes the policies of the media's library
+// ask for again, at high priority, such as when a rendition turned out
+// broken. The outputs made from the media are dropped rather than linked.
+// attempt tells the new transcodes apart from those requested before. It
+// returns the number of transcodes requested.
+func (s *TranscodePolicyService) Retranscode(ctx context.Context, mediaID uuid.UUID, attempt string) (int, error) {
+	media, err := s.repo.GetMedia(ctx, mediaID)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.repo.InvalidateTranscodeOutputs(ctx, media.ID, ""); err != nil {
+		return 0, err
+	}
+	policies, err := s.resolvedPolicies(ctx, media.LibraryID)
+	if err != nil {
+		return 0, err
+	}
+
+	requested := 0
+	source := &transcodeSource{}
+	for _, policy := range policies {
+		if !policy.AppliesTo(media) {
+			continue
+		}
+		key := domain.TranscodeKey(media, policy) + "/" + attempt
+		claimed, err := s.repo.ClaimTranscode(ctx, media.ID, policy.ID, key, domain.TranscodePriorityHigh)
+		if err != nil {
+			return requested, err
+		}
+		if !claimed {
+			continue
+		}
+
+		measured := s.measuredLoudness(ctx, media, policy, source)
+		s.eventBus.PublishAsync(ctx, domain.NewTranscodeRequestedEvent(media, policy, key, domain.TranscodePriorityHigh, measured))
+		requested++
+	}
+	return requested, nil
+}
+
+// ApplyToLibrary requests the transcodes the policies of a library ask for
+// across all of its available media. It returns the number of transcodes
+// requested or linked.
+func (s *TranscodePolicyService) ApplyToLibrary(ctx context.Context, libraryID uuid.UUID) (int, error) {
+	policies, err := s.resolvedPolicies(ctx, libraryID)
+	if err != nil {
+		return 0, err
+	}
+
+	available := string(models.MediaStatusAvailable)
+	requested := 0
+	for offset := 0; ; offset += policyBatchSize {
+		batch, err := s.repo.ListMediaByLibrary(ctx, libraryID, &available, policyBatchSize, offset)
+		if err != nil {
+			return requested, err
+		}
+		for _, media := range batch {
+			n, err := s.apply(ctx, media, policies)
+			requested += n
+			if err != nil {
+				return requested, err
+			}
+		}
+		if len(batch) < policyBatchSize {
+			break
+		}
+	}
+
+	s.logger.Info("Transcode policies applied",
+		interfaces.String("library_id", libraryID.String()),
+		interfaces.Int("requested", requested))
+	return requested, nil
+}
+
+// resolvedPolicies lists the transcode policies of a library, with the
+// audio normalization the library defaults to.
+func (s *TranscodePolicyService) resolvedPolicies(ctx context.Context, libraryID uuid.UUID) ([]*domain.TranscodePolicy, error) {
+	library, err := s.repo.GetLibrary(ctx, libraryID)
+	if err != nil {
+		return nil, err
+	}
+	policies, err := s.repo.ListTranscodePolicies(ctx, libraryID)
+	if err != nil {
+		return nil, err
+	}
+	for i, policy := range policies {
+		policies[i] = policy.Resolve(library)
+	}
+	return policies, nil
+}
+
+// apply requests the transcodes of media that policies ask for and that
+// have not been requested before, linking the outputs of those made from
+// the same source before.
+func (s *TranscodePolicyService) apply(
+	ctx context.Context,
+	media *models.Media,
+	policies []*domain.TranscodePolicy,
+) (int, error) {
+	requested := 0
+	var priority domain.TranscodePriority
+	source := &transcodeSource{}
+	for _, policy := range policies {
+		if !policy.AppliesTo(media) {
+			continue
+		}
+
+		if priority == "" {
+			priority = s.priority(ctx, media)
+		}
+		key := domain.TranscodeKey(media, policy)
+		claimed, err := s.repo.ClaimTranscode(ctx, media.ID, policy.ID, key, priority)
+		if err != nil {
+			return requested, err
+		}
+		if !claimed {
+			continue
+		}
+
+		if output := s.cachedOutput(ctx, media, policy, source); output != nil {
+			s.eventBus.PublishAsync(ctx, domain.NewTranscodeReusedEvent(media, policy, key, output))
+			requested++
+			continue
+		}
+		measured := s.measuredLoudness(ctx, media, policy, source)
+		s.eventBus.PublishAsync(ctx, domain.NewTranscodeRequestedEvent(media, policy, key, priority, measured))
+		requested++
+	}
+	return requested, nil
+}
+
+// priority returns the priority of new transcodes of media. Failing to
+// find out how likely it is to be watched leaves it at normal.
+func (s *TranscodePolicyService) priority(ctx context.Context, media *models.Media) domain.TranscodePriority {
+	if s.priorities == nil {
+		return domain.TranscodePriorityNormal
+	}
+
+	now := time.Now()
+	signals, err := s.repo.GetTranscodePrioritySignals(ctx, []uuid.UUID{media.ID}, now.Add(-s.priorities.Window))
+	if err != nil || len(signals) == 0 {
+		if err != nil {
+			s.logger.Warn("Failed to prioritize transcodes",
+				interfaces.String("media_id", media.ID.String()),
+				interfaces.Error(err))
+		}
+		return domain.TranscodePriorityNormal
+	}
+
+	s.mu.RLock()
+	popular := s.popularGenres
+	s.mu.RUnlock()
+	return s.priorities.Prioritize(signals[0], popular, now)
+}
+
+// Run re-prioritizes the requested transcodes now and every interval until
+// ctx is done.
+func (s *TranscodePolicyService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Reprioritize(ctx); err != nil {
+			s.logger.Error("Failed to reprioritize transcodes", interfaces.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reprioritize refreshes the popular genres and gives every requested
+// transcode the priority its media now warrants: watchlisted media and the
+// next episodes of shows in progress are bumped, back catalog nobody
+// watches is demoted. The transcode service moves the jobs still pending.
+// It returns the number of transcodes whose priority changed.
+func (s *TranscodePolicyService) Reprioritize(ctx context.Context) (int, error) {
+	if s.priorities == nil {
+		return 0, nil
+	}
+
+	now := time.Now()
+	since := now.Add(-s.priorities.Window)
+	var popular []string
+	if s.priorities.PopularGenres > 0 {
+		var err error
+		if popular, err = s.repo.ListPopularGenres(ctx, since, s.priorities.PopularGenres); err != nil {
+			return 0, err
+		}
+	}
+	s.mu.Lock()
+	s.popularGenres = popular
+	s.mu.Unlock()
+
+	changed := 0
+	for offset := 0; ; offset += policyBatchSize {
+		batch, err := s.repo.ListTranscodeRequests(ctx, policyBatchSize, offset)
+		if err != nil {
+			return changed, err
+		}
+
+		mediaIDs := make([]uuid.UUID, 0, len(batch))
+		seen := make(map[uuid.UUID]bool, len(batch))
+		for _, request := range batch {
+			if !seen[request.MediaID] {
+				seen[request.MediaID] = true
+				mediaIDs = append(mediaIDs, request.MediaID)
+			}
+		}
+		signals, err := s.repo.GetTranscodePrioritySignals(ctx, mediaIDs, since)
+		if err != nil {
+			return changed, err
+		}
+		byMedia := make(map[uuid.UUID]*domain.TranscodePrioritySignals, len(signals))
+		for _, signal := range signals {
+			byMedia[signal.MediaID] = signal
+		}
+
+		for _, request := range batch {
+			signal, ok := byMedia[request.MediaID]
+			if !ok {
+				continue
+			}
+			priority := s.priorities.Prioritize(signal, popular, now)
+			if priority == request.Priority {
+				continue
+			}
+
+			if err := s.repo.SetTranscodePriority(ctx, request.MediaID, request.Key, priority); err != nil {
+				return changed, err
+			}
+			from := request.Priority
+			request.Priority = priority
+			s.eventBus.PublishAsync(ctx, domain.NewTranscodeReprioritizedEvent(*request, from))
+			changed++
+		}
+
+		if len(batch) < policyBatchSize {
+			break
+		}
+	}
+
+	if changed > 0 {
+		s.logger.Info("Transcodes reprioritized", interfaces.Int("count", changed))
+	}
+	return changed, nil
+}
+
+// handleMediaStatusChanged applies policies to media that became available.
+func (s *TranscodePolicyService) handleMediaStatusChanged(ctx context.Context, env *events.Envelope) error {
+	if to, _ := env.Payload()["to"].(string); to != string(models.MediaStatusAvailable) {
+		return nil
+	}
+	id, _ := env.Payload()["entity_id"].(string)
+	return s.handleMedia(ctx, id, true)
+}
+
+// handleMediaAdded applies policies to media that was added as available.
+func (s *TranscodePolicyService) handleMediaAdded(ctx context.Context, env *events.Envelope) error {
+	id, _ := env.Payload()["media_id"].(string)
+	return s.handleMedia(ctx, id, false)
+}
+
+// handleMedia applies policies to media. The status change event can
+// overtake the save of the new status, so available overrides the stored
+// status. New media is saved after its status changes and may not be found;
+// media.added follows for it.
+func (s *TranscodePolicyService) handleMedia(ctx context.Context, id string, available bool) error {
+	mediaID, err := uuid.Parse(id)
+	if err != nil {
+		return nil
+	}
+
+	media, err := s.repo.GetMedia(ctx, mediaID)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if available {
+		media.Status = string(models.MediaStatusAvailable)
+	}
+
+	policies, err := s.resolvedPolicies(ctx, media.LibraryID)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	_, err = s.apply(ctx, media, policies)
+	return err
+}
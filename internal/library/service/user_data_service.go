@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/repository"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// watchHistorySection is the data export section holding watch states.
+const watchHistorySection = "watch_history"
+
+// UserDataService handles the data protection requests of users for the
+// data the library holds about them: it contributes their watch history
+// to data exports and anonymizes it when their account is deleted. Watch
+// states are kept under a random user ID rather than deleted, so play
+// counts and completion statistics stay intact; watchlists are deleted.
+type UserDataService struct {
+	repo     repository.Repository
+	eventBus interfaces.EventBus
+	logger   interfaces.Logger
+}
+
+// NewUserDataService creates a new user data service.
+func NewUserDataService(
+	repo repository.Repository,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+) *UserDataService {
+	return &UserDataService{
+		repo:     repo,
+		eventBus: eventBus,
+		logger:   logger,
+	}
+}
+
+// Start subscribes the service to data export requests and deleted users.
+func (s *UserDataService) Start() error {
+	export := events.NewConsumer("library.user_data", 1, s.handleExportRequested)
+	if err := s.eventBus.Subscribe("user.data_export_requested", export); err != nil {
+		return fmt.Errorf("failed to subscribe to user.data_export_requested: %w", err)
+	}
+
+	anonymize := events.NewConsumer("library.user_data", 1, s.handleUserDeleted)
+	if err := s.eventBus.Subscribe("user.deleted", anonymize); err != nil {
+		return fmt.Errorf("failed to subscribe to user.deleted: %w", err)
+	}
+	return nil
+}
+
+// handleExportRequested replies with the user's watch history.
+func (s *UserDataService) handleExportRequested(ctx context.Context, env *events.Envelope) error {
+	userID, ok := eventUserID(env)
+	if !ok {
+		return nil
+	}
+	exportID, _ := env.Payload()["export_id"].(string)
+
+	states, err := s.repo.ListWatchStatesByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode watch history: %w", err)
+	}
+
+	return s.eventBus.Publish(ctx, events.NewAggregateEvent("user.data_export_section", userID.String(), map[string]interface{}{
+		"export_id": exportID,
+		"user_id":   userID.String(),
+		"section":   watchHistorySection,
+		"data":      string(data),
+	}))
+}
+
+// handleUserDeleted anonymizes the watch states and viewings of a deleted
+// user and empties their watchlist.
+func (s *UserDataService) handleUserDeleted(ctx context.Context, env *events.Envelope) error {
+	userID, ok := eventUserID(env)
+	if !ok {
+		return nil
+	}
+
+	anonymized, err := s.repo.AnonymizeWatchStates(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if anonymized > 0 {
+		s.logger.Info("Watch states of deleted user anonymized",
+			interfaces.String("user_id", userID.String()),
+			interfaces.Int("count", int(anonymized)))
+	}
+
+	if _, err := s.repo.AnonymizeViewings(ctx, userID); err != nil {
+		return err
+	}
+
+	_, err = s.repo.DeleteWatchlist(ctx, userID)
+	return err
+}
+
+// eventUserID returns the user an event is about.
+func eventUserID(env *events.Envelope) (uuid.UUID, bool) {
+	switch id := env.Payload()["user_id"].(type) {
+	case uuid.UUID:
+		return id, true
+	case string:
+		parsed, err := uuid.Parse(id)
+		return parsed, err == nil
+	default:
+		return uuid.Nil, false
+	}
+}
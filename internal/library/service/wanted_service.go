@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/internal/library/repository"
+	"github.com/narwhalmedia/narwhal/pkg/downloadclient"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// WantedService reports the monitored movies and episodes that are missing
+// or below the quality cutoff of their library, and searches indexers for
+// releases of them that users pick from to grab.
+type WantedService struct {
+	repo     repository.Repository
+	indexers func() []domain.Indexer
+	clients  *downloadclient.Clients
+	eventBus interfaces.EventBus
+	logger   interfaces.Logger
+}
+
+// NewWantedService creates a new wanted service. indexers returns the
+// indexers to search; plugins serving them come and go, so it is called on
+// every search.
+func NewWantedService(
+	repo repository.Repository,
+	indexers func() []domain.Indexer,
+	clients *downloadclient.Clients,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+) *WantedService {
+	return &WantedService{
+		repo:     repo,
+		indexers: indexers,
+		clients:  clients,
+		eventBus: eventBus,
+		logger:   logger,
+	}
+}
+
+// ListWanted lists the wanted movies and episodes of a library, or of every
+// library if libraryID is nil, newest first. An empty reason lists both
+// missing items and items below their cutoff. It returns a page of items
+// and the number of items in all pages.
+func (s *WantedService) ListWanted(
+	ctx context.Context,
+	reason domain.WantedReason,
+	libraryID *uuid.UUID,
+	limit, offset int,
+) ([]*domain.WantedItem, int, error) {
+	if reason != "" && reason != domain.WantedMissing && reason != domain.WantedCutoffUnmet {
+		return nil, 0, errors.BadRequest(fmt.Sprintf("unknown wanted reason %q", reason))
+	}
+	if libraryID != nil {
+		if _, err := s.repo.GetLibrary(ctx, *libraryID); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var items []*domain.WantedItem
+	if reason == "" || reason == domain.WantedMissing {
+		missing, err := s.repo.ListMissing(ctx, libraryID, time.Now())
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, item := range missing {
+			item.Reason = domain.WantedMissing
+		}
+		items = append(items, missing...)
+	}
+	if reason == "" || reason == domain.WantedCutoffUnmet {
+		candidates, err := s.repo.ListUpgradeCandidates(ctx, libraryID)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, item := range candidates {
+			if item.BelowCutoff() {
+				item.Reason = domain.WantedCutoffUnmet
+				items = append(items, item)
+			}
+		}
+	}
+	domain.SortWanted(items)
+	total := len(items)
+	if offset >= total {
+		return []*domain.WantedItem{}, total, nil
+	}
+	return items[offset:min(offset+limit, total)], total, nil
+}
+
+// SearchReleases searches every indexer for releases of a movie, or of an
+// episode if episodeID is set, scored best first. Indexers that fail are
+// logged and skipped unless all of them fail.
+func (s *WantedService) SearchReleases(
+	ctx context.Context,
+	mediaID uuid.UUID,
+	episodeID *uuid.UUID,
+) ([]*domain.Release, error) {
+	item, err := s.repo.GetWantedItem(ctx, mediaID, episodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	indexers := s.indexers()
+	if len(indexers) == 0 {
+		return nil, errors.BadRequest("no indexers are available")
+	}
+
+	query := releaseQuery(item)
+	var (
+		releases []*domain.Release
+		lastErr  error
+		failed   int
+	)
+	for _, indexer := range indexers {
+		found, err := indexer.Search(ctx, query)
+		if err != nil {
+			s.logger.Warn("Indexer search failed",
+				interfaces.String("indexer", indexer.Name()),
+				interfaces.Error(err))
+			failed++
+			lastErr = err
+			continue
+		}
+		for _, release := range found {
+			if release.Indexer == "" {
+				release.Indexer = indexer.Name()
+			}
+		}
+		releases = append(releases, found...)
+	}
+	if failed == len(indexers) {
+		return nil, fmt.Errorf("every indexer failed: %w", lastErr)
+	}
+
+	identities := make([]domain.ReleaseIdentity, len(releases))
+	for i, release := range releases {
+		identities[i] = release.Identity()
+	}
+	blocked, err := matchBlocklist(ctx, s.repo, identities)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, release := range releases {
+		domain.ScoreRelease(release, item)
+		if blocked[i] != nil {
+			release.Rejections = append(release.Rejections, "blocklisted: "+blocked[i].Reason)
+		}
+	}
+	domain.SortReleases(releases)
+	return releases, nil
+}
+
+// GrabRelease hands a release a user picked for a movie, or an episode if
+// episodeID is set, to a download client. An empty client name uses the
+// default client. Blocklisted releases are refused. It returns the ID of
+// the download at the client.
+func (s *WantedService) GrabRelease(
+	ctx context.Context,
+	mediaID uuid.UUID,
+	episodeID *uuid.UUID,
+	release *domain.Release,
+	downloadClient string,
+) (string, error) {
+	u, err := url.Parse(release.DownloadURL)
+	if err != nil || (u.Scheme != "magnet" && u.Scheme != "http" && u.Scheme != "https") {
+		return "", errors.BadRequest("release download url must be a magnet link or an http or https url")
+	}
+
+	item, err := s.repo.GetWantedItem(ctx, mediaID, episodeID)
+	if err != nil {
+		return "", err
+	}
+	blocked, err := matchBlocklist(ctx, s.repo, []domain.ReleaseIdentity{release.Identity()})
+	if err != nil {
+		return "", err
+	}
+	if blocked[0] != nil {
+		return "", errors.BadRequest("release is blocklisted: " + blocked[0].Reason)
+	}
+	client, err := s.clients.For(downloadClient)
+	if err != nil {
+		return "", errors.BadRequest(err.Error())
+	}
+
+	downloadID, err := client.Add(ctx, downloadclient.AddRequest{URL: release.DownloadURL})
+	if err != nil {
+		return "", fmt.Errorf("failed to grab %s: %w", release.Title, err)
+	}
+
+	s.logger.Info("Release grabbed",
+		interfaces.String("media_id", mediaID.String()),
+		interfaces.String("title", release.Title),
+		interfaces.String("download_client", client.Name()))
+	s.eventBus.PublishAsync(ctx, domain.NewReleaseGrabbedEvent(item, release, client.Name(), downloadID))
+	return downloadID, nil
+}
+
+// releaseQuery builds the indexer query for a wanted item.
+func releaseQuery(item *domain.WantedItem) domain.ReleaseQuery {
+	query := domain.ReleaseQuery{
+		Query:  item.Title,
+		IMDBID: item.IMDBID,
+	}
+	if item.TVDBID > 0 {
+		query.TVDBID = strconv.Itoa(item.TVDBID)
+	}
+	if item.EpisodeID != nil {
+		query.Season = item.SeasonNumber
+		query.Episode = item.EpisodeNumber
+	} else if item.Date != nil {
+		query.Query += " " + strconv.Itoa(item.Date.Year())
+	}
+	return query
+}
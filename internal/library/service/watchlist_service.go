@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/internal/library/repository"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// WatchlistService manages the media users want to watch. Transcodes of
+// watchlisted media are prioritized.
+type WatchlistService struct {
+	repo   repository.Repository
+	logger interfaces.Logger
+}
+
+// NewWatchlistService creates a new watchlist service.
+func NewWatchlistService(repo repository.Repository, logger interfaces.Logger) *WatchlistService {
+	return &WatchlistService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Add adds media to a user's watchlist.
+func (s *WatchlistService) Add(ctx context.Context, userID, mediaID uuid.UUID) (*domain.WatchlistEntry, error) {
+	if _, err := s.repo.GetMedia(ctx, mediaID); err != nil {
+		return nil, err
+	}
+
+	entry := &domain.WatchlistEntry{UserID: userID, MediaID: mediaID}
+	if err := s.repo.AddToWatchlist(ctx, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Remove removes media from a user's watchlist.
+func (s *WatchlistService) Remove(ctx context.Context, userID, mediaID uuid.UUID) error {
+	return s.repo.RemoveFromWatchlist(ctx, userID, mediaID)
+}
+
+// List lists a user's watchlist, most recently added first.
+func (s *WatchlistService) List(ctx context.Context, userID uuid.UUID) ([]*domain.WatchlistEntry, error) {
+	return s.repo.ListWatchlist(ctx, userID)
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// LoadWorkerPoolSizes applies the worker pool sizes set through the API,
+// which take precedence over the configured scan limits.
+func (s *LibraryService) LoadWorkerPoolSizes(ctx context.Context) error {
+	sizes, err := s.repo.ListWorkerPoolSizes(ctx)
+	if err != nil {
+		return err
+	}
+	for name, size := range sizes {
+		if err := s.resizeWorkerPool(name, size); err != nil {
+			s.logger.Warn("Ignoring stored worker pool size",
+				interfaces.String("pool", name),
+				interfaces.Error(err))
+		}
+	}
+	return nil
+}
+
+// WorkerPools lists the worker pools that can be resized at runtime.
+func (s *LibraryService) WorkerPools() []*domain.WorkerPool {
+	return []*domain.WorkerPool{
+		{Name: domain.WorkerPoolScans, Size: s.scanSlots.Limit(), Active: s.scanSlots.InUse()},
+		{Name: domain.WorkerPoolScanWorkers, Size: int(s.scanWorkers.Load()), Active: int(s.activeScanWorkers.Load())},
+	}
+}
+
+// ResizeWorkerPool changes the size of a worker pool without a restart. The
+// size is kept across restarts. Growing a pool takes effect at once;
+// shrinking it lets excess workers finish their current work before they
+// stop.
+func (s *LibraryService) ResizeWorkerPool(ctx context.Context, name string, size int) (*domain.WorkerPool, error) {
+	if err := domain.ValidateWorkerPoolSize(size); err != nil {
+		return nil, errors.BadRequest(err.Error())
+	}
+	if !isWorkerPool(name) {
+		return nil, errors.NotFound(fmt.Sprintf("worker pool %s not found", name))
+	}
+	if err := s.repo.SetWorkerPoolSize(ctx, name, size); err != nil {
+		return nil, err
+	}
+	if err := s.resizeWorkerPool(name, size); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Worker pool resized",
+		interfaces.String("pool", name),
+		interfaces.Int("size", size))
+	for _, pool := range s.WorkerPools() {
+		if pool.Name == name {
+			return pool, nil
+		}
+	}
+	return nil, errors.NotFound(fmt.Sprintf("worker pool %s not found", name))
+}
+
+func (s *LibraryService) resizeWorkerPool(name string, size int) error {
+	if err := domain.ValidateWorkerPoolSize(size); err != nil {
+		return err
+	}
+	switch name {
+	case domain.WorkerPoolScans:
+		s.scanSlots.SetLimit(size)
+	case domain.WorkerPoolScanWorkers:
+		s.scanWorkers.Store(int32(size))
+	default:
+		return fmt.Errorf("unknown worker pool %s", name)
+	}
+	return nil
+}
+
+func isWorkerPool(name string) bool {
+	return name == domain.WorkerPoolScans || name == domain.WorkerPoolScanWorkers
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/saga"
+	"github.com/narwhalmedia/narwhal/pkg/task"
+)
+
+// workflowArchiveBatchSize is the number of workflows archived per
+// transaction.
+const workflowArchiveBatchSize = 500
+
+// ArchiveWorkflows moves the finished workflows the retention policy no
+// longer keeps to the workflow history. It returns the number moved.
+func (s *LibraryService) ArchiveWorkflows(ctx context.Context, policy domain.RetentionPolicy) (int, error) {
+	if !policy.Enabled() {
+		return 0, nil
+	}
+
+	cutoff := policy.Cutoff(time.Now())
+	archived := 0
+	for {
+		n, err := s.repo.ArchiveWorkflows(ctx, cutoff, policy.KeepPerMedia, workflowArchiveBatchSize)
+		archived += n
+		if err != nil {
+			return archived, err
+		}
+		if n < workflowArchiveBatchSize {
+			return archived, nil
+		}
+	}
+}
+
+// RunWorkflowArchiver archives workflows every interval until ctx is
+// cancelled. Each pass runs as a task.
+func (s *LibraryService) RunWorkflowArchiver(ctx context.Context, interval time.Duration, policy domain.RetentionPolicy) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = s.tasks.Run(ctx, TaskTypeWorkflowArchive, nil, func(ctx context.Context) error {
+				n, err := s.ArchiveWorkflows(ctx, policy)
+				if n > 0 {
+					s.logger.Info("Archived workflows", interfaces.Int("count", n))
+					task.Log(ctx, fmt.Sprintf("Archived %d workflows", n))
+				}
+				if err != nil {
+					s.logger.Error("Workflow archival failed", interfaces.Error(err))
+				}
+				return err
+			})
+		}
+	}
+}
+
+// ListWorkflowHistory lists archived workflows, most recently finished
+// first.
+func (s *LibraryService) ListWorkflowHistory(
+	ctx context.Context,
+	filter domain.WorkflowHistoryFilter,
+	limit, offset int,
+) ([]*saga.Workflow, error) {
+	return s.repo.ListWorkflowHistory(ctx, filter, limit, offset)
+}
@@ -0,0 +1,199 @@
+// Package fileserver serves original media files for direct play. It
+// supports range requests and conditional requests, so players can seek and
+// revalidate, and paces each connection to a bitrate cap when one applies.
+package fileserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// throttleBurst is how much of a capped file is sent at full speed before
+// pacing starts, so players can fill their buffer quickly.
+const throttleBurst = 10 * time.Second
+
+// throttleChunk is the largest write made between pacing checks.
+const throttleChunk = 32 * 1024
+
+// File is a media file to serve.
+type File struct {
+	// Path is the location of the file on disk.
+	Path string
+	// Name is used to detect the content type.
+	Name string
+}
+
+// Resolver maps a request to the file it asks for. It returns a not found
+// error for unknown files and a bad request error for malformed requests.
+type Resolver interface {
+	Resolve(r *http.Request) (*File, error)
+}
+
+// BitrateCap returns the bitrate, in bits per second, a file may be sent at
+// to the client of a request. Zero means uncapped.
+type BitrateCap func(r *http.Request, file *File) int64
+
+// Handler serves media files over HTTP.
+type Handler struct {
+	resolver   Resolver
+	bitrateCap BitrateCap
+	logger     interfaces.Logger
+}
+
+// NewHandler creates a file serving handler.
+func NewHandler(resolver Resolver, logger interfaces.Logger) *Handler {
+	return &Handler{
+		resolver: resolver,
+		logger:   logger,
+	}
+}
+
+// WithBitrateCap sets the cap connections are paced to.
+func (h *Handler) WithBitrateCap(bitrateCap BitrateCap) *Handler {
+	h.bitrateCap = bitrateCap
+	return h
+}
+
+// ServeHTTP serves the requested file. Range, If-Range, If-Match,
+// If-None-Match, If-Modified-Since and If-Unmodified-Since are handled by
+// http.ServeContent. Uncapped responses are written straight from the file,
+// which lets the kernel send them with sendfile.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	file, err := h.resolver.Resolve(r)
+	if err != nil {
+		h.error(w, r, err)
+		return
+	}
+
+	f, err := os.Open(file.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = errors.NotFound("file not found")
+		}
+		h.error(w, r, err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		h.error(w, r, err)
+		return
+	}
+	if info.IsDir() {
+		h.error(w, r, errors.NotFound("file not found"))
+		return
+	}
+
+	w.Header().Set("ETag", etag(info))
+	w.Header().Set("Accept-Ranges", "bytes")
+
+	if h.bitrateCap != nil {
+		if bitrate := h.bitrateCap(r, file); bitrate > 0 {
+			w = newThrottledWriter(r.Context(), w, bitrate/8)
+		}
+	}
+
+	name := file.Name
+	if name == "" {
+		name = info.Name()
+	}
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+func (h *Handler) error(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.IsNotFound(err):
+		http.Error(w, "file not found", http.StatusNotFound)
+	case errors.IsBadRequest(err):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.IsForbidden(err):
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	default:
+		h.logger.Error("Failed to serve file",
+			interfaces.String("path", r.URL.Path),
+			interfaces.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// etag derives a strong validator from the file's size and modification
+// time. It has to be strong for If-Range to be honoured.
+func etag(info os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+}
+
+// throttledWriter paces writes to a rate after an initial burst.
+type throttledWriter struct {
+	http.ResponseWriter
+
+	ctx   context.Context
+	rate  int64 // bytes per second
+	burst int64
+	start time.Time
+	sent  int64
+}
+
+func newThrottledWriter(ctx context.Context, w http.ResponseWriter, rate int64) *throttledWriter {
+	return &throttledWriter{
+		ResponseWriter: w,
+		ctx:            ctx,
+		rate:           rate,
+		burst:          rate * int64(throttleBurst/time.Second),
+		start:          time.Now(),
+	}
+}
+
+func (w *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), throttleChunk)]
+		if err := w.wait(int64(len(chunk))); err != nil {
+			return written, err
+		}
+
+		n, err := w.ResponseWriter.Write(chunk)
+		written += n
+		w.sent += int64(n)
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// wait blocks until n more bytes fit in the budget.
+func (w *throttledWriter) wait(n int64) error {
+	allowed := w.burst + int64(time.Since(w.start).Seconds()*float64(w.rate))
+	excess := w.sent + n - allowed
+	if excess <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(time.Duration(float64(excess) / float64(w.rate) * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-w.ctx.Done():
+		return w.ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (w *throttledWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
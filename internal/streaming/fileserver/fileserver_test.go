@@ -0,0 +1,142 @@
+package fileserver_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/narwhalmedia/narwhal/internal/streaming/fileserver"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/logger"
+)
+
+// dirResolver serves files from a directory by name.
+type dirResolver struct {
+	dir string
+}
+
+func (r dirResolver) Resolve(req *http.Request) (*fileserver.File, error) {
+	name := strings.TrimPrefix(req.URL.Path, "/")
+	if name == "" || strings.Contains(name, "/") {
+		return nil, errors.BadRequest("invalid file name")
+	}
+	return &fileserver.File{Path: filepath.Join(r.dir, name), Name: name}, nil
+}
+
+type HandlerTestSuite struct {
+	suite.Suite
+
+	handler *fileserver.Handler
+	content string
+}
+
+func (suite *HandlerTestSuite) SetupTest() {
+	dir := suite.T().TempDir()
+	suite.content = "0123456789abcdefghij"
+	suite.Require().NoError(os.WriteFile(filepath.Join(dir, "movie.mp4"), []byte(suite.content), 0o644))
+	suite.handler = fileserver.NewHandler(dirResolver{dir: dir}, logger.NewNoopLogger())
+}
+
+func (suite *HandlerTestSuite) serve(method, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	rec := httptest.NewRecorder()
+	suite.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func (suite *HandlerTestSuite) TestServe_Range() {
+	rec := suite.serve(http.MethodGet, "/movie.mp4", http.Header{"Range": {"bytes=5-9"}})
+
+	suite.Equal(http.StatusPartialContent, rec.Code)
+	suite.Equal("56789", rec.Body.String())
+	suite.Equal("bytes 5-9/20", rec.Header().Get("Content-Range"))
+	suite.Equal("bytes", rec.Header().Get("Accept-Ranges"))
+}
+
+func (suite *HandlerTestSuite) TestServe_ConditionalRequests() {
+	full := suite.serve(http.MethodGet, "/movie.mp4", nil)
+	suite.Require().Equal(http.StatusOK, full.Code)
+	etag := full.Header().Get("ETag")
+	suite.Require().NotEmpty(etag)
+	suite.NotEmpty(full.Header().Get("Last-Modified"))
+
+	rec := suite.serve(http.MethodGet, "/movie.mp4", http.Header{"If-None-Match": {etag}})
+	suite.Equal(http.StatusNotModified, rec.Code)
+
+	// A stale If-Range validator gets the whole file instead of the range
+	rec = suite.serve(http.MethodGet, "/movie.mp4", http.Header{"Range": {"bytes=0-1"}, "If-Range": {`"stale"`}})
+	suite.Equal(http.StatusOK, rec.Code)
+	suite.Equal(suite.content, rec.Body.String())
+
+	rec = suite.serve(http.MethodGet, "/movie.mp4", http.Header{"Range": {"bytes=0-1"}, "If-Range": {etag}})
+	suite.Equal(http.StatusPartialContent, rec.Code)
+	suite.Equal("01", rec.Body.String())
+}
+
+func (suite *HandlerTestSuite) TestServe_Errors() {
+	suite.Equal(http.StatusNotFound, suite.serve(http.MethodGet, "/missing.mp4", nil).Code)
+	suite.Equal(http.StatusBadRequest, suite.serve(http.MethodGet, "/", nil).Code)
+	suite.Equal(http.StatusMethodNotAllowed, suite.serve(http.MethodPost, "/movie.mp4", nil).Code)
+}
+
+func (suite *HandlerTestSuite) TestServe_ThrottlesToBitrateCap() {
+	dir := suite.T().TempDir()
+	data := make([]byte, 10_300)
+	suite.Require().NoError(os.WriteFile(filepath.Join(dir, "capped.mp4"), data, 0o644))
+
+	// 1000 bytes per second after a 10 second burst: the last 300 bytes are
+	// paced
+	suite.handler = fileserver.NewHandler(dirResolver{dir: dir}, logger.NewNoopLogger()).
+		WithBitrateCap(func(*http.Request, *fileserver.File) int64 { return 8000 })
+
+	start := time.Now()
+	rec := suite.serve(http.MethodGet, "/capped.mp4", nil)
+	suite.Equal(len(data), rec.Body.Len())
+	suite.GreaterOrEqual(time.Since(start), 250*time.Millisecond)
+
+	// Pacing stops when the client goes away
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	rec = httptest.NewRecorder()
+	suite.handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/capped.mp4", nil).WithContext(ctx))
+	suite.Less(rec.Body.Len(), len(data))
+}
+
+func TestHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(HandlerTestSuite))
+}
+
+func BenchmarkServe_Range(b *testing.B) {
+	dir := b.TempDir()
+	const size = 64 << 20
+	if err := os.WriteFile(filepath.Join(dir, "movie.mp4"), make([]byte, size), 0o644); err != nil {
+		b.Fatal(err)
+	}
+	handler := fileserver.NewHandler(dirResolver{dir: dir}, logger.NewNoopLogger())
+
+	const chunk = 1 << 20
+	b.SetBytes(chunk)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Seek through the file as a player does
+		start := (i * 7 * chunk) % (size - chunk)
+		req := httptest.NewRequest(http.MethodGet, "/movie.mp4", nil)
+		req.Header.Set("Range", "bytes="+strconv.Itoa(start)+"-"+strconv.Itoa(start+chunk-1))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusPartialContent {
+			b.Fatalf("status %d", rec.Code)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// Package handler implements the StreamingService gRPC server.
+package handler
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	streamingpb "github.com/narwhalmedia/narwhal/api/proto/streaming/v1"
+	"github.com/narwhalmedia/narwhal/internal/streaming/playback"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+)
+
+// GRPCHandler implements the StreamingService gRPC server. Stream and
+// session methods answer Unimplemented until the stream service is
+// implemented.
+type GRPCHandler struct {
+	streamingpb.UnimplementedStreamingServiceServer
+}
+
+// NewGRPCHandler creates a new streaming handler.
+func NewGRPCHandler() *GRPCHandler {
+	return &GRPCHandler{}
+}
+
+// GetDeviceProfile returns the server's profile of a kind of device, for
+// clients to check what they are assumed to play.
+func (h *GRPCHandler) GetDeviceProfile(
+	_ context.Context,
+	req *streamingpb.GetDeviceProfileRequest,
+) (*streamingpb.GetDeviceProfileResponse, error) {
+	if req.GetDeviceType() == "" {
+		return nil, status.Error(codes.InvalidArgument, "device type is required")
+	}
+	profile, err := playback.LookupDeviceProfile(req.GetDeviceType())
+	if errors.IsNotFound(err) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to get device profile")
+	}
+	return &streamingpb.GetDeviceProfileResponse{Profile: convertDeviceProfileToProto(profile)}, nil
+}
+
+func convertDeviceProfileToProto(profile playback.DeviceProfile) *streamingpb.DeviceProfile {
+	proto := &streamingpb.DeviceProfile{
+		DeviceType:             profile.Type,
+		Name:                   profile.Name,
+		Containers:             profile.Containers,
+		VideoCodecs:            make([]*streamingpb.VideoSupport, len(profile.VideoCodecs)),
+		AudioCodecs:            profile.AudioCodecs,
+		MaxAudioChannels:       int32(profile.MaxAudioChannels),
+		SupportsTextSubtitles:  profile.TextSubtitles,
+		SupportsImageSubtitles: profile.ImageSubtitles,
+	}
+	for i, video := range profile.VideoCodecs {
+		proto.VideoCodecs[i] = &streamingpb.VideoSupport{
+			Codec:    video.Codec,
+			Profiles: video.Profiles,
+			MaxLevel: int32(video.MaxLevel),
+		}
+	}
+	return proto
+}
@@ -0,0 +1,200 @@
+package hls
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Encryption methods.
+const (
+	MethodAES128    = "AES-128"
+	MethodSampleAES = "SAMPLE-AES"
+)
+
+// KeySize is the size of an HLS content key.
+const KeySize = 16
+
+// Stream token errors.
+var (
+	ErrInvalidToken = errors.New("invalid stream token")
+	ErrTokenExpired = errors.New("stream token has expired")
+)
+
+// Encryption describes how the segments of a playlist are encrypted. Keys
+// are rotated every RotateEvery segments; without an explicit IV, the IV of
+// a segment and its parts is its media sequence number.
+type Encryption struct {
+	Method      string
+	RotateEvery int
+	// KeyURI returns the URI of a key, given its index.
+	KeyURI func(keyIndex int) string
+}
+
+// KeyIndex returns the index of the key segment msn is encrypted with.
+func (e *Encryption) KeyIndex(msn int) int {
+	return msn / e.RotateEvery
+}
+
+// KeyManager derives per-session content keys and issues the stream tokens
+// that authorize fetching them. Keys are derived from a secret rather than
+// stored, so any replica of the stream service can serve them.
+type KeyManager struct {
+	secret      []byte
+	method      string
+	rotateEvery int
+	keyBaseURL  string
+}
+
+// NewKeyManager creates a key manager. Key URIs are built below keyBaseURL,
+// which the KeyHandler must be mounted at.
+func NewKeyManager(secret []byte, method string, rotateEvery int, keyBaseURL string) (*KeyManager, error) {
+	if len(secret) < 32 {
+		return nil, errors.New("key secret must be at least 32 bytes")
+	}
+	if method != MethodAES128 && method != MethodSampleAES {
+		return nil, fmt.Errorf("unsupported encryption method %q", method)
+	}
+	if rotateEvery < 1 {
+		return nil, errors.New("keys must be rotated at least every segment")
+	}
+
+	return &KeyManager{
+		secret:      secret,
+		method:      method,
+		rotateEvery: rotateEvery,
+		keyBaseURL:  strings.TrimSuffix(keyBaseURL, "/"),
+	}, nil
+}
+
+// Key returns the content key of a session with the given index.
+func (m *KeyManager) Key(sessionID string, keyIndex int) []byte {
+	return m.mac("key", sessionID, strconv.Itoa(keyIndex))[:KeySize]
+}
+
+// Encryption returns the encryption of a session's playlists. Key URIs
+// carry the session's stream token.
+func (m *KeyManager) Encryption(sessionID, token string) *Encryption {
+	return &Encryption{
+		Method:      m.method,
+		RotateEvery: m.rotateEvery,
+		KeyURI: func(keyIndex int) string {
+			return fmt.Sprintf("%s/%s/%d.key?token=%s", m.keyBaseURL, sessionID, keyIndex, token)
+		},
+	}
+}
+
+// EncryptSegment encrypts a segment, or a part of segment msn, for a
+// session with AES-128. SAMPLE-AES only encrypts media samples and has to
+// be applied by the transcoder.
+func (m *KeyManager) EncryptSegment(sessionID string, msn int, data []byte) ([]byte, error) {
+	if m.method != MethodAES128 {
+		return nil, fmt.Errorf("%s segments cannot be encrypted on the fly", m.method)
+	}
+
+	block, err := aes.NewCipher(m.Key(sessionID, msn/m.rotateEvery))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt segment: %w", err)
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(iv[8:], uint64(msn))
+
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+	out := make([]byte, len(data)+padding)
+	copy(out, data)
+	copy(out[len(data):], bytes.Repeat([]byte{byte(padding)}, padding))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, out)
+	return out, nil
+}
+
+// StreamToken issues a token authorizing the session's key requests until
+// expires.
+func (m *KeyManager) StreamToken(sessionID string, expires time.Time) string {
+	payload := sessionID + "\n" + strconv.FormatInt(expires.Unix(), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(m.mac("token", payload))
+}
+
+// VerifyStreamToken checks a stream token and returns its session.
+func (m *KeyManager) VerifyStreamToken(token string) (string, error) {
+	encodedPayload, encodedMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(mac, m.mac("token", string(payload))) {
+		return "", ErrInvalidToken
+	}
+
+	sessionID, expiry, ok := strings.Cut(string(payload), "\n")
+	if !ok {
+		return "", ErrInvalidToken
+	}
+	expires, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	if time.Now().Unix() >= expires {
+		return "", ErrTokenExpired
+	}
+	return sessionID, nil
+}
+
+// KeyHandler serves content keys at {keyBaseURL}/{session}/{index}.key to
+// holders of the session's stream token.
+func (m *KeyManager) KeyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if len(parts) < 2 {
+			http.NotFound(w, r)
+			return
+		}
+		sessionID := parts[len(parts)-2]
+		keyIndex, err := strconv.Atoi(strings.TrimSuffix(parts[len(parts)-1], ".key"))
+		if err != nil || keyIndex < 0 {
+			http.NotFound(w, r)
+			return
+		}
+
+		tokenSession, err := m.VerifyStreamToken(r.URL.Query().Get("token"))
+		if err != nil || tokenSession != sessionID {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write(m.Key(sessionID, keyIndex))
+	})
+}
+
+func (m *KeyManager) mac(purpose string, values ...string) []byte {
+	h := hmac.New(sha256.New, m.secret)
+	h.Write([]byte(purpose))
+	for _, value := range values {
+		h.Write([]byte{0})
+		h.Write([]byte(value))
+	}
+	return h.Sum(nil)
+}
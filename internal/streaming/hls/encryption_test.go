@@ -0,0 +1,98 @@
+package hls_test
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/narwhalmedia/narwhal/internal/streaming/hls"
+)
+
+type EncryptionTestSuite struct {
+	suite.Suite
+
+	keys *hls.KeyManager
+}
+
+func (suite *EncryptionTestSuite) SetupTest() {
+	keys, err := hls.NewKeyManager([]byte(strings.Repeat("s", 32)), hls.MethodAES128, 2, "https://stream.test/keys/")
+	suite.Require().NoError(err)
+	suite.keys = keys
+}
+
+func (suite *EncryptionTestSuite) TestKey_PerSessionAndRotated() {
+	suite.Len(suite.keys.Key("a", 0), hls.KeySize)
+	suite.Equal(suite.keys.Key("a", 0), suite.keys.Key("a", 0))
+	suite.NotEqual(suite.keys.Key("a", 0), suite.keys.Key("b", 0))
+	suite.NotEqual(suite.keys.Key("a", 0), suite.keys.Key("a", 1))
+}
+
+func (suite *EncryptionTestSuite) TestEncryptSegment_DecryptsWithSequenceIV() {
+	data := []byte("segment data that spans more than one block")
+	encrypted, err := suite.keys.EncryptSegment("a", 5, data)
+	suite.Require().NoError(err)
+	suite.Zero(len(encrypted) % aes.BlockSize)
+
+	// Segment 5 uses key 2 with rotation every two segments
+	block, err := aes.NewCipher(suite.keys.Key("a", 2))
+	suite.Require().NoError(err)
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(iv[8:], 5)
+	decrypted := make([]byte, len(encrypted))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, encrypted)
+
+	padding := int(decrypted[len(decrypted)-1])
+	suite.Equal(data, decrypted[:len(decrypted)-padding])
+}
+
+func (suite *EncryptionTestSuite) TestStreamToken() {
+	token := suite.keys.StreamToken("a", time.Now().Add(time.Minute))
+	session, err := suite.keys.VerifyStreamToken(token)
+	suite.Require().NoError(err)
+	suite.Equal("a", session)
+
+	_, err = suite.keys.VerifyStreamToken(suite.keys.StreamToken("a", time.Now().Add(-time.Minute)))
+	suite.ErrorIs(err, hls.ErrTokenExpired)
+	_, err = suite.keys.VerifyStreamToken(token + "x")
+	suite.ErrorIs(err, hls.ErrInvalidToken)
+}
+
+func (suite *EncryptionTestSuite) TestKeyHandler_RequiresSessionToken() {
+	handler := suite.keys.KeyHandler()
+	token := suite.keys.StreamToken("a", time.Now().Add(time.Minute))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/keys/a/3.key?token="+token, nil))
+	suite.Equal(http.StatusOK, rec.Code)
+	suite.Equal(suite.keys.Key("a", 3), rec.Body.Bytes())
+	suite.Equal("no-store", rec.Header().Get("Cache-Control"))
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/keys/b/3.key?token="+token, nil))
+	suite.Equal(http.StatusForbidden, rec.Code)
+}
+
+func (suite *EncryptionTestSuite) TestRenderEncrypted_RotatesKeys() {
+	playlist, err := hls.NewLivePlaylist(hls.Config{TargetDuration: 4 * time.Second, WindowSize: 10})
+	suite.Require().NoError(err)
+	for _, uri := range []string{"seg0.ts", "seg1.ts", "seg2.ts"} {
+		suite.Require().NoError(playlist.CompleteSegment(uri, 4*time.Second))
+	}
+
+	rendered := string(playlist.RenderEncrypted(suite.keys.Encryption("a", "tok")))
+	suite.Equal(2, strings.Count(rendered, "#EXT-X-KEY:"))
+	suite.Contains(rendered, "#EXT-X-KEY:METHOD=AES-128,URI=\"https://stream.test/keys/a/0.key?token=tok\"\n#EXTINF:4.000,\nseg0.ts\n")
+	suite.Contains(rendered, "#EXT-X-KEY:METHOD=AES-128,URI=\"https://stream.test/keys/a/1.key?token=tok\"\n#EXTINF:4.000,\nseg2.ts\n")
+	suite.NotContains(string(playlist.Render()), "#EXT-X-KEY")
+}
+
+func TestEncryptionTestSuite(t *testing.T) {
+	suite.Run(t, new(EncryptionTestSuite))
+}
@@ -0,0 +1,80 @@
+package hls
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// blockingTimeout is how many target durations a blocking reload may wait
+// before the server gives up, as the LL-HLS specification requires.
+const blockingTimeout = 3
+
+// ServeHTTP serves the playlist. Requests with _HLS_msn, and optionally
+// _HLS_part, block until the playlist contains that segment or part.
+func (p *LivePlaylist) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.serve(w, r, nil)
+}
+
+// EncryptedHandler serves the playlist like ServeHTTP, with the key tags of
+// enc.
+func (p *LivePlaylist) EncryptedHandler(enc *Encryption) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.serve(w, r, enc)
+	})
+}
+
+func (p *LivePlaylist) serve(w http.ResponseWriter, r *http.Request, enc *Encryption) {
+	msn, part, blocking, err := parseBlockingReload(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if blocking {
+		ctx, cancel := context.WithTimeout(r.Context(), blockingTimeout*p.config.TargetDuration)
+		defer cancel()
+
+		err := p.Wait(ctx, msn, part)
+		switch {
+		case errors.Is(err, ErrTooFarAhead):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, context.DeadlineExceeded):
+			http.Error(w, "playlist update timed out", http.StatusServiceUnavailable)
+			return
+		case err != nil:
+			// The client went away
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = w.Write(p.render(enc))
+}
+
+// parseBlockingReload reads the delivery directives of a blocking reload.
+func parseBlockingReload(r *http.Request) (msn, part int, blocking bool, err error) {
+	query := r.URL.Query()
+	part = -1
+
+	if query.Has("_HLS_msn") {
+		msn, err = strconv.Atoi(query.Get("_HLS_msn"))
+		if err != nil || msn < 0 {
+			return 0, 0, false, errors.New("invalid _HLS_msn")
+		}
+		blocking = true
+	}
+	if query.Has("_HLS_part") {
+		if !blocking {
+			return 0, 0, false, errors.New("_HLS_part requires _HLS_msn")
+		}
+		part, err = strconv.Atoi(query.Get("_HLS_part"))
+		if err != nil || part < 0 {
+			return 0, 0, false, errors.New("invalid _HLS_part")
+		}
+	}
+	return msn, part, blocking, nil
+}
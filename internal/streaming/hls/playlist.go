@@ -0,0 +1,316 @@
+// Package hls builds live HLS media playlists, including the Low-Latency
+// HLS extensions: partial segments, preload hints and blocking playlist
+// reloads, and VOD playlists stitching files together.
+package hls
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrTooFarAhead is returned by Wait for segments more than two ahead of
+// the playlist, which clients must not block on.
+var ErrTooFarAhead = errors.New("requested segment is too far ahead of the playlist")
+
+// partRetention is how many target durations from the end of the playlist
+// the parts of completed segments are listed for.
+const partRetention = 3
+
+// Part is a partial segment.
+type Part struct {
+	URI      string
+	Duration time.Duration
+	// Independent reports whether the part starts with an independent frame.
+	Independent bool
+}
+
+// Segment is a media segment. The parts of a completed segment cover the
+// same media as the segment itself.
+type Segment struct {
+	URI      string
+	Duration time.Duration
+	Parts    []Part
+}
+
+// Config configures a live playlist.
+type Config struct {
+	// TargetDuration is the maximum segment duration.
+	TargetDuration time.Duration
+	// PartDuration is the target duration of partial segments. Zero
+	// disables Low-Latency HLS.
+	PartDuration time.Duration
+	// WindowSize is the number of segments listed; older ones slide out.
+	// Zero keeps every segment, as for event playlists and JIT playlists
+	// without a retention window.
+	WindowSize int
+	// PartURI returns the URI of a part, for preload hints.
+	PartURI func(msn, part int) string
+	// URI maps the URIs of segments and parts to those the playlist lists,
+	// such as signed CDN URLs. It is applied on every render, so tokens in
+	// the URIs stay fresh. Nil lists the URIs as they are.
+	URI func(uri string) string
+}
+
+// LivePlaylist is a media playlist that grows while a stream is produced.
+// It is safe for concurrent use.
+type LivePlaylist struct {
+	config Config
+
+	mu       sync.Mutex
+	firstMSN int
+	segments []Segment
+	parts    []Part // parts of the segment being produced
+	ended    bool
+	// dropped reports whether segments were removed to save disk space,
+	// which event playlists must not do.
+	dropped bool
+	changed chan struct{}
+}
+
+// NewLivePlaylist creates an empty live playlist.
+func NewLivePlaylist(config Config) (*LivePlaylist, error) {
+	if config.TargetDuration <= 0 {
+		return nil, errors.New("target duration must be positive")
+	}
+	if config.PartDuration < 0 || config.PartDuration > config.TargetDuration {
+		return nil, errors.New("part duration must be between zero and the target duration")
+	}
+	if config.PartDuration > 0 && config.PartURI == nil {
+		return nil, errors.New("low-latency playlists need a part URI function")
+	}
+
+	return &LivePlaylist{
+		config:  config,
+		changed: make(chan struct{}),
+	}, nil
+}
+
+// LowLatency reports whether the playlist lists partial segments.
+func (p *LivePlaylist) LowLatency() bool {
+	return p.config.PartDuration > 0
+}
+
+// AddPart appends a part to the segment being produced.
+func (p *LivePlaylist) AddPart(part Part) error {
+	if !p.LowLatency() {
+		return errors.New("playlist does not use partial segments")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.ended {
+		return errors.New("playlist has ended")
+	}
+	p.parts = append(p.parts, part)
+	p.notify()
+	return nil
+}
+
+// CompleteSegment completes the segment being produced, made up of the
+// parts added since the previous segment.
+func (p *LivePlaylist) CompleteSegment(uri string, duration time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.ended {
+		return errors.New("playlist has ended")
+	}
+
+	p.segments = append(p.segments, Segment{URI: uri, Duration: duration, Parts: p.parts})
+	p.parts = nil
+	if p.config.WindowSize > 0 && len(p.segments) > p.config.WindowSize {
+		drop := len(p.segments) - p.config.WindowSize
+		p.segments = append([]Segment(nil), p.segments[drop:]...)
+		p.firstMSN += drop
+	}
+	p.notify()
+	return nil
+}
+
+// dropOldest removes up to n of the oldest segments. The playlist is no
+// longer an event playlist once segments are removed.
+func (p *LivePlaylist) dropOldest(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n = min(n, len(p.segments))
+	if n == 0 {
+		return
+	}
+	p.segments = append([]Segment(nil), p.segments[n:]...)
+	p.firstMSN += n
+	p.dropped = true
+	p.notify()
+}
+
+// firstSequence returns the media sequence number of the first segment
+// listed.
+func (p *LivePlaylist) firstSequence() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.firstMSN
+}
+
+// End marks the stream as complete. Parts added since the last segment are
+// discarded.
+func (p *LivePlaylist) End() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.ended {
+		return
+	}
+	p.ended = true
+	p.parts = nil
+	p.notify()
+}
+
+// Wait blocks until the playlist contains segment msn or, when part is not
+// negative, part of segment msn. It returns early once the playlist ends.
+func (p *LivePlaylist) Wait(ctx context.Context, msn, part int) error {
+	for {
+		p.mu.Lock()
+		if p.ended || p.contains(msn, part) {
+			p.mu.Unlock()
+			return nil
+		}
+		if msn > p.nextMSN()+2 {
+			p.mu.Unlock()
+			return ErrTooFarAhead
+		}
+		changed := p.changed
+		p.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Render returns the playlist in M3U8 format.
+func (p *LivePlaylist) Render() []byte {
+	return p.render(nil)
+}
+
+// RenderEncrypted returns the playlist in M3U8 format, with EXT-X-KEY tags
+// for segments encrypted as described by enc.
+func (p *LivePlaylist) RenderEncrypted(enc *Encryption) []byte {
+	return p.render(enc)
+}
+
+func (p *LivePlaylist) render(enc *Encryption) []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var b bytes.Buffer
+	b.WriteString("#EXTM3U\n")
+	b.WriteString("#EXT-X-VERSION:6\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(p.config.TargetDuration.Seconds())))
+	if p.LowLatency() {
+		fmt.Fprintf(&b, "#EXT-X-PART-INF:PART-TARGET=%s\n", seconds(p.config.PartDuration))
+		fmt.Fprintf(&b, "#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=%s\n",
+			seconds(3*p.config.PartDuration))
+	} else {
+		b.WriteString("#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES\n")
+	}
+	if p.config.WindowSize == 0 && !p.dropped {
+		b.WriteString("#EXT-X-PLAYLIST-TYPE:EVENT\n")
+	}
+	fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", p.firstMSN)
+
+	// Parts are listed for segments near the end of the playlist only
+	partsFrom := len(p.segments)
+	var recent time.Duration
+	for partsFrom > 0 && recent < partRetention*p.config.TargetDuration {
+		partsFrom--
+		recent += p.segments[partsFrom].Duration
+	}
+
+	keys := keyWriter{enc: enc, last: -1}
+	for i, segment := range p.segments {
+		keys.write(&b, p.firstMSN+i)
+		if p.LowLatency() && i >= partsFrom {
+			p.writeParts(&b, segment.Parts)
+		}
+		fmt.Fprintf(&b, "#EXTINF:%s,\n%s\n", seconds(segment.Duration), p.uri(segment.URI))
+	}
+
+	if p.ended {
+		b.WriteString("#EXT-X-ENDLIST\n")
+		return b.Bytes()
+	}
+	if p.LowLatency() {
+		keys.write(&b, p.nextMSN())
+		p.writeParts(&b, p.parts)
+		fmt.Fprintf(&b, "#EXT-X-PRELOAD-HINT:TYPE=PART,URI=%q\n", p.uri(p.config.PartURI(p.nextMSN(), len(p.parts))))
+	}
+	return b.Bytes()
+}
+
+// contains reports whether segment msn, or its given part, is listed.
+func (p *LivePlaylist) contains(msn, part int) bool {
+	next := p.nextMSN()
+	if msn < next {
+		return true
+	}
+	return msn == next && part >= 0 && part < len(p.parts)
+}
+
+// nextMSN returns the media sequence number of the segment being produced.
+func (p *LivePlaylist) nextMSN() int {
+	return p.firstMSN + len(p.segments)
+}
+
+// uri returns the URI a segment or part is listed under.
+func (p *LivePlaylist) uri(uri string) string {
+	if p.config.URI == nil {
+		return uri
+	}
+	return p.config.URI(uri)
+}
+
+// notify wakes up blocked reloads.
+func (p *LivePlaylist) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// keyWriter writes an EXT-X-KEY tag whenever the key changes.
+type keyWriter struct {
+	enc  *Encryption
+	last int
+}
+
+func (k *keyWriter) write(b *bytes.Buffer, msn int) {
+	if k.enc == nil {
+		return
+	}
+	index := k.enc.KeyIndex(msn)
+	if index == k.last {
+		return
+	}
+	k.last = index
+	fmt.Fprintf(b, "#EXT-X-KEY:METHOD=%s,URI=%q\n", k.enc.Method, k.enc.KeyURI(index))
+}
+
+func (p *LivePlaylist) writeParts(b *bytes.Buffer, parts []Part) {
+	for _, part := range parts {
+		fmt.Fprintf(b, "#EXT-X-PART:DURATION=%s,URI=%q", seconds(part.Duration), p.uri(part.URI))
+		if part.Independent {
+			b.WriteString(",INDEPENDENT=YES")
+		}
+		b.WriteString("\n")
+	}
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
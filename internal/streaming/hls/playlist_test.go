@@ -0,0 +1,128 @@
+package hls_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/narwhalmedia/narwhal/internal/streaming/hls"
+)
+
+type PlaylistTestSuite struct {
+	suite.Suite
+
+	playlist *hls.LivePlaylist
+}
+
+func (suite *PlaylistTestSuite) SetupTest() {
+	playlist, err := hls.NewLivePlaylist(hls.Config{
+		TargetDuration: 4 * time.Second,
+		PartDuration:   time.Second,
+		WindowSize:     6,
+		PartURI: func(msn, part int) string {
+			return fmt.Sprintf("seg%d.part%d.m4s", msn, part)
+		},
+	})
+	suite.Require().NoError(err)
+	suite.playlist = playlist
+}
+
+// produce adds four one second parts and completes the segment.
+func (suite *PlaylistTestSuite) produce(msn int) {
+	for i := 0; i < 4; i++ {
+		suite.Require().NoError(suite.playlist.AddPart(hls.Part{
+			URI:         fmt.Sprintf("seg%d.part%d.m4s", msn, i),
+			Duration:    time.Second,
+			Independent: i == 0,
+		}))
+	}
+	suite.Require().NoError(suite.playlist.CompleteSegment(fmt.Sprintf("seg%d.m4s", msn), 4*time.Second))
+}
+
+func (suite *PlaylistTestSuite) TestRender_LowLatency() {
+	suite.produce(0)
+	suite.Require().NoError(suite.playlist.AddPart(hls.Part{URI: "seg1.part0.m4s", Duration: time.Second, Independent: true}))
+
+	rendered := string(suite.playlist.Render())
+	suite.Contains(rendered, "#EXT-X-PART-INF:PART-TARGET=1.000\n")
+	suite.Contains(rendered, "#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=3.000\n")
+	suite.Contains(rendered, "#EXT-X-PART:DURATION=1.000,URI=\"seg0.part0.m4s\",INDEPENDENT=YES\n")
+	suite.Contains(rendered, "#EXTINF:4.000,\nseg0.m4s\n")
+	suite.Contains(rendered, "#EXT-X-PART:DURATION=1.000,URI=\"seg1.part0.m4s\",INDEPENDENT=YES\n")
+	suite.True(strings.HasSuffix(rendered, "#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"seg1.part1.m4s\"\n"))
+}
+
+func (suite *PlaylistTestSuite) TestRender_SlidingWindowDropsOldParts() {
+	for msn := 0; msn < 8; msn++ {
+		suite.produce(msn)
+	}
+
+	rendered := string(suite.playlist.Render())
+	suite.Contains(rendered, "#EXT-X-MEDIA-SEQUENCE:2\n")
+	suite.NotContains(rendered, "seg1.m4s")
+	// Parts are kept for the last three target durations only
+	suite.NotContains(rendered, "seg4.part0.m4s")
+	suite.Contains(rendered, "seg5.part0.m4s")
+}
+
+func (suite *PlaylistTestSuite) TestRender_Ended() {
+	suite.produce(0)
+	suite.playlist.End()
+
+	rendered := string(suite.playlist.Render())
+	suite.True(strings.HasSuffix(rendered, "#EXT-X-ENDLIST\n"))
+	suite.NotContains(rendered, "PRELOAD-HINT")
+}
+
+func (suite *PlaylistTestSuite) TestWait_BlocksUntilPartIsAdded() {
+	done := make(chan error, 1)
+	go func() {
+		done <- suite.playlist.Wait(context.Background(), 0, 1)
+	}()
+
+	suite.Require().NoError(suite.playlist.AddPart(hls.Part{URI: "seg0.part0.m4s", Duration: time.Second}))
+	select {
+	case <-done:
+		suite.Fail("wait returned before the part was added")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	suite.Require().NoError(suite.playlist.AddPart(hls.Part{URI: "seg0.part1.m4s", Duration: time.Second}))
+	select {
+	case err := <-done:
+		suite.NoError(err)
+	case <-time.After(time.Second):
+		suite.Fail("wait did not return after the part was added")
+	}
+}
+
+func (suite *PlaylistTestSuite) TestWait_TooFarAhead() {
+	suite.ErrorIs(suite.playlist.Wait(context.Background(), 3, -1), hls.ErrTooFarAhead)
+}
+
+func (suite *PlaylistTestSuite) TestServeHTTP_BlockingReload() {
+	suite.produce(0)
+
+	rec := httptest.NewRecorder()
+	suite.playlist.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/live.m3u8?_HLS_msn=0&_HLS_part=2", nil))
+	suite.Equal(http.StatusOK, rec.Code)
+	suite.Equal("application/vnd.apple.mpegurl", rec.Header().Get("Content-Type"))
+
+	rec = httptest.NewRecorder()
+	suite.playlist.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/live.m3u8?_HLS_part=2", nil))
+	suite.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	suite.playlist.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/live.m3u8?_HLS_msn=9", nil))
+	suite.Equal(http.StatusBadRequest, rec.Code)
+}
+
+func TestPlaylistTestSuite(t *testing.T) {
+	suite.Run(t, new(PlaylistTestSuite))
+}
@@ -0,0 +1,47 @@
+package hls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// StorePublisher publishes the files of sessions to an object store, such
+// as the origin bucket of a CDN.
+type StorePublisher struct {
+	store interfaces.ObjectStore
+	key   func(session *Session, name string) string
+}
+
+// NewStorePublisher creates a publisher storing the file name of a session
+// under the object key key returns.
+func NewStorePublisher(store interfaces.ObjectStore, key func(session *Session, name string) string) *StorePublisher {
+	return &StorePublisher{store: store, key: key}
+}
+
+// Publish uploads a file of the session.
+func (p *StorePublisher) Publish(ctx context.Context, session *Session, name string) error {
+	data, err := os.ReadFile(filepath.Join(session.Dir(), name))
+	if err != nil {
+		return err
+	}
+	return p.store.Put(ctx, p.key(session, name), data)
+}
+
+// Unpublish deletes files of the session from the store.
+func (p *StorePublisher) Unpublish(ctx context.Context, session *Session, names []string) error {
+	var errs []error
+	for _, name := range names {
+		if err := p.store.Delete(ctx, p.key(session, name)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("failed to unpublish segments: %w", err)
+	}
+	return nil
+}
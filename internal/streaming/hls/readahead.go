@@ -0,0 +1,173 @@
+package hls
+
+import (
+	"sync"
+	"time"
+)
+
+// ReadaheadPolicy bounds how far the JIT transcoder of a session encodes
+// ahead of the player.
+type ReadaheadPolicy struct {
+	// Buffer is the media duration encoded ahead of the playhead at full
+	// speed. Zero disables readahead control, so sessions encode at full
+	// speed to the end.
+	Buffer time.Duration
+	// MaxAhead is the media duration ahead of the playhead past which the
+	// transcoder pauses. Between Buffer and MaxAhead it encodes at
+	// playback speed, keeping the buffer without spending more CPU.
+	MaxAhead time.Duration
+}
+
+// Pace is how fast the transcoder of a session encodes.
+type Pace int
+
+const (
+	// PaceFull encodes as fast as possible, to fill the buffer.
+	PaceFull Pace = iota
+	// PaceRealtime encodes at playback speed, such as with ffmpeg -re.
+	PaceRealtime
+	// PacePaused stops encoding until the player catches up.
+	PacePaused
+)
+
+// String returns the name of the pace.
+func (p Pace) String() string {
+	switch p {
+	case PaceRealtime:
+		return "realtime"
+	case PacePaused:
+		return "paused"
+	default:
+		return "full"
+	}
+}
+
+// ReadaheadState is what the transcoder of a session should do.
+type ReadaheadState struct {
+	Pace Pace
+	// Start is the segment the transcoder encodes from. It moves when the
+	// player seeks out of the encoded range.
+	Start int
+	// Restarts counts the seeks that moved Start. The transcoder restarts
+	// ffmpeg at Start whenever it changes.
+	Restarts int
+	// Ahead is the media duration encoded ahead of the playhead.
+	Ahead time.Duration
+}
+
+// Readahead steers the JIT transcoder of a session by the positions its
+// player reports. The transcoder encodes from Start at the current Pace and
+// reports each segment it completes; the player's heartbeats move the
+// playhead. Seeks out of the encoded range restart the transcoder at the
+// segment of the new position, which starts on a keyframe as JIT segments
+// are cut on keyframes. It is safe for concurrent use.
+type Readahead struct {
+	policy  ReadaheadPolicy
+	segment time.Duration
+
+	mu       sync.Mutex
+	start    int // first segment of the encoded range
+	next     int // segment the transcoder encodes next
+	playhead time.Duration
+	restarts int
+	// changed is closed and replaced whenever the pace or start changes
+	changed chan struct{}
+}
+
+// NewReadahead creates the readahead of a session cut into segments of
+// segmentDuration, encoding from the start of the media.
+func NewReadahead(policy ReadaheadPolicy, segmentDuration time.Duration) *Readahead {
+	return &Readahead{
+		policy:  policy,
+		segment: segmentDuration,
+		changed: make(chan struct{}),
+	}
+}
+
+// Heartbeat moves the playhead to position and returns the new state. A
+// position outside the encoded range restarts the transcoder at its
+// segment.
+func (r *Readahead) Heartbeat(position time.Duration) ReadaheadState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	before := r.state()
+	r.playhead = max(position, 0)
+	if r.segment > 0 {
+		// Segments between the encoded range and the playhead would stall
+		// the player until they are encoded, so skip them
+		if at := int(r.playhead / r.segment); at < r.start || at > r.next {
+			r.start = at
+			r.next = at
+			r.restarts++
+		}
+	}
+
+	state := r.state()
+	if state.Pace != before.Pace || state.Restarts != before.Restarts {
+		r.notify()
+	}
+	return state
+}
+
+// Encoded records that the transcoder completed segment. Segments other
+// than the next of the encoded range, such as those of a transcoder
+// restarted since, are ignored.
+func (r *Readahead) Encoded(segment int) ReadaheadState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	before := r.state()
+	if segment == r.next {
+		r.next++
+	}
+	state := r.state()
+	if state.Pace != before.Pace {
+		r.notify()
+	}
+	return state
+}
+
+// State returns what the transcoder should do.
+func (r *Readahead) State() ReadaheadState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state()
+}
+
+// Changed is closed when the pace or start of the transcoder changes, after
+// which State returns the new state.
+func (r *Readahead) Changed() <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.changed
+}
+
+// StartOffset returns the media position of the segment the transcoder
+// encodes from, to seek ffmpeg to.
+func (r *Readahead) StartOffset() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return time.Duration(r.start) * r.segment
+}
+
+// state returns the current state. The caller holds mu.
+func (r *Readahead) state() ReadaheadState {
+	ahead := max(time.Duration(r.next)*r.segment-r.playhead, 0)
+	state := ReadaheadState{Start: r.start, Restarts: r.restarts, Ahead: ahead}
+	switch {
+	case r.policy.Buffer <= 0 || ahead < r.policy.Buffer:
+		state.Pace = PaceFull
+	case ahead < r.policy.MaxAhead:
+		state.Pace = PaceRealtime
+	default:
+		state.Pace = PacePaused
+	}
+	return state
+}
+
+// notify wakes the transcoder waiting on Changed. The caller holds mu.
+func (r *Readahead) notify() {
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
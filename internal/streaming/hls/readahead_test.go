@@ -0,0 +1,106 @@
+package hls_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/streaming/hls"
+)
+
+func TestReadaheadPacesAndSeeks(t *testing.T) {
+	r := hls.NewReadahead(hls.ReadaheadPolicy{Buffer: 8 * time.Second, MaxAhead: 16 * time.Second}, 4*time.Second)
+
+	encode := func(from, to int) hls.ReadaheadState {
+		var state hls.ReadaheadState
+		for segment := from; segment < to; segment++ {
+			state = r.Encoded(segment)
+		}
+		return state
+	}
+
+	assert.Equal(t, hls.PaceFull, r.State().Pace)
+	assert.Equal(t, hls.PaceFull, encode(0, 1).Pace, "below the buffer")
+
+	changed := r.Changed()
+	state := encode(1, 2)
+	assert.Equal(t, hls.PaceRealtime, state.Pace, "the buffer is kept at playback speed")
+	assert.Equal(t, 8*time.Second, state.Ahead)
+	select {
+	case <-changed:
+	default:
+		t.Fatal("pace change not notified")
+	}
+
+	state = encode(2, 4)
+	assert.Equal(t, hls.PacePaused, state.Pace, "far ahead of the player")
+
+	// Playback catching up resumes encoding
+	changed = r.Changed()
+	state = r.Heartbeat(6 * time.Second)
+	assert.Equal(t, hls.PaceRealtime, state.Pace)
+	assert.Zero(t, state.Restarts)
+	assert.Equal(t, 10*time.Second, state.Ahead)
+	select {
+	case <-changed:
+	default:
+		t.Fatal("pace change not notified")
+	}
+
+	// Heartbeats that keep the pace wake nobody
+	changed = r.Changed()
+	r.Heartbeat(7 * time.Second)
+	select {
+	case <-changed:
+		t.Fatal("unchanged pace notified")
+	default:
+	}
+
+	// Seeking past the encoded range restarts at the segment of the
+	// position, skipping those between
+	state = r.Heartbeat(61 * time.Second)
+	assert.Equal(t, 15, state.Start)
+	assert.Equal(t, 1, state.Restarts)
+	assert.Equal(t, hls.PaceFull, state.Pace)
+	assert.Equal(t, 60*time.Second, r.StartOffset())
+
+	// Segments of the transcoder before the restart are ignored
+	assert.Zero(t, r.Encoded(4).Ahead)
+	assert.Equal(t, 3*time.Second, r.Encoded(15).Ahead)
+
+	// Seeking back within the encoded range keeps encoding
+	state = r.Heartbeat(60 * time.Second)
+	assert.Equal(t, 1, state.Restarts)
+
+	// Seeking back before it restarts there
+	state = r.Heartbeat(10 * time.Second)
+	assert.Equal(t, 2, state.Start)
+	assert.Equal(t, 2, state.Restarts)
+}
+
+func TestReadaheadWithoutBufferEncodesToTheEnd(t *testing.T) {
+	r := hls.NewReadahead(hls.ReadaheadPolicy{}, 4*time.Second)
+	for segment := range 100 {
+		r.Encoded(segment)
+	}
+	assert.Equal(t, hls.PaceFull, r.State().Pace)
+}
+
+func TestSessionReadahead(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "sessions")
+	manager, err := hls.NewSessionManager(root, hls.RetentionPolicy{})
+	require.NoError(t, err)
+
+	session, err := manager.Open("plain", "movie", hls.Config{TargetDuration: 4 * time.Second})
+	require.NoError(t, err)
+	assert.Nil(t, session.Readahead())
+
+	manager.WithReadahead(hls.ReadaheadPolicy{Buffer: 4 * time.Second, MaxAhead: 8 * time.Second})
+	session, err = manager.Open("steered", "movie", hls.Config{TargetDuration: 4 * time.Second})
+	require.NoError(t, err)
+	require.NotNil(t, session.Readahead())
+	assert.Equal(t, hls.PaceRealtime, session.Readahead().Encoded(0).Pace)
+}
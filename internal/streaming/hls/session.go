@@ -0,0 +1,445 @@
+package hls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrSessionExists is returned by Open for session IDs already in use.
+var ErrSessionExists = errors.New("session already exists")
+
+// RetentionPolicy bounds the segments JIT and live sessions keep on disk.
+type RetentionPolicy struct {
+	// Window is the media duration the playlist of a session lists, which
+	// players can seek back in; older segments slide out and are deleted.
+	// Zero keeps every segment, so the whole stream stays seekable.
+	Window time.Duration
+	// MaxDiskBytes bounds the segment files of a session. Past it the
+	// oldest segments are deleted and dropped from the playlist, even
+	// inside the window. Zero is unlimited.
+	MaxDiskBytes int64
+}
+
+// windowSize returns the number of segments of the target duration the
+// window covers, or zero to keep every segment.
+func (r RetentionPolicy) windowSize(target time.Duration) int {
+	if r.Window <= 0 {
+		return 0
+	}
+	return int((r.Window + target - 1) / target)
+}
+
+// Publisher copies the segment and part files of sessions to where players
+// fetch them from, such as the origin storage of a CDN.
+type Publisher interface {
+	// Publish copies a file written to the session directory.
+	Publish(ctx context.Context, session *Session, name string) error
+	// Unpublish removes files the session no longer keeps.
+	Unpublish(ctx context.Context, session *Session, names []string) error
+}
+
+// SessionStats are the active sessions of a SessionManager and the disk
+// space their segments take.
+type SessionStats struct {
+	Active    int
+	DiskBytes int64
+	// MaxSessionBytes is the disk space of the largest session.
+	MaxSessionBytes int64
+}
+
+// SessionManager keeps the segment directories of JIT and live transcode
+// sessions below a root directory, one directory per session, and applies
+// its retention policy to them. It is safe for concurrent use.
+type SessionManager struct {
+	root      string
+	policy    RetentionPolicy
+	readahead ReadaheadPolicy
+	publisher Publisher
+	urls      func(mediaID, sessionID string) func(uri string) string
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+// NewSessionManager creates a session manager below root. Session
+// directories left behind by a previous run are deleted.
+func NewSessionManager(root string, policy RetentionPolicy) (*SessionManager, error) {
+	if policy.Window < 0 || policy.MaxDiskBytes < 0 {
+		return nil, errors.New("retention policy cannot be negative")
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create session directory: %w", err)
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session directory: %w", err)
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(root, entry.Name())); err != nil {
+			return nil, fmt.Errorf("failed to delete stale session %s: %w", entry.Name(), err)
+		}
+	}
+
+	return &SessionManager{
+		root:     root,
+		policy:   policy,
+		sessions: make(map[string]*Session),
+	}, nil
+}
+
+// WithPublisher publishes the files of sessions with p before they are
+// listed in their playlists.
+func (m *SessionManager) WithPublisher(p Publisher) *SessionManager {
+	m.publisher = p
+	return m
+}
+
+// WithReadahead steers the transcoders of sessions by the positions their
+// players report, keeping them a buffer ahead of the playhead.
+func (m *SessionManager) WithReadahead(policy ReadaheadPolicy) *SessionManager {
+	m.readahead = policy
+	return m
+}
+
+// WithURLs lists the files of sessions in their playlists under the URIs
+// the function urls returns for a session, such as signed CDN URLs.
+func (m *SessionManager) WithURLs(urls func(mediaID, sessionID string) func(uri string) string) *SessionManager {
+	m.urls = urls
+	return m
+}
+
+// Open starts a session of media with an empty directory and playlist.
+// Unless the config sets a window size, the playlist slides by the
+// retention window.
+func (m *SessionManager) Open(id, mediaID string, config Config) (*Session, error) {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+		return nil, fmt.Errorf("invalid session ID %q", id)
+	}
+	if config.WindowSize == 0 && config.TargetDuration > 0 {
+		config.WindowSize = m.policy.windowSize(config.TargetDuration)
+	}
+	if config.URI == nil && m.urls != nil {
+		config.URI = m.urls(mediaID, id)
+	}
+	playlist, err := NewLivePlaylist(config)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.sessions[id]; ok {
+		return nil, ErrSessionExists
+	}
+	dir := filepath.Join(m.root, id)
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create session directory: %w", err)
+	}
+
+	session := &Session{
+		id:        id,
+		mediaID:   mediaID,
+		dir:       dir,
+		playlist:  playlist,
+		policy:    m.policy,
+		publisher: m.publisher,
+	}
+	if m.readahead.Buffer > 0 && config.TargetDuration > 0 {
+		session.readahead = NewReadahead(m.readahead, config.TargetDuration)
+	}
+	m.sessions[id] = session
+	return session, nil
+}
+
+// Get returns an open session, or nil.
+func (m *SessionManager) Get(id string) *Session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sessions[id]
+}
+
+// Close ends a session and deletes its directory.
+func (m *SessionManager) Close(id string) error {
+	m.mu.Lock()
+	session, ok := m.sessions[id]
+	delete(m.sessions, id)
+	m.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return session.teardown()
+}
+
+// CloseAll ends every session and deletes their directories.
+func (m *SessionManager) CloseAll() error {
+	m.mu.Lock()
+	sessions := m.sessions
+	m.sessions = make(map[string]*Session)
+	m.mu.Unlock()
+
+	var errs []error
+	for _, session := range sessions {
+		errs = append(errs, session.teardown())
+	}
+	return errors.Join(errs...)
+}
+
+// Stats returns the active sessions and their disk usage.
+func (m *SessionManager) Stats() SessionStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := SessionStats{Active: len(m.sessions)}
+	for _, session := range m.sessions {
+		bytes := session.DiskBytes()
+		stats.DiskBytes += bytes
+		stats.MaxSessionBytes = max(stats.MaxSessionBytes, bytes)
+	}
+	return stats
+}
+
+// FileHandler serves the segment and part files of open sessions at
+// /{sessionID}/{file}, for edges pulling them from the origin.
+func (m *SessionManager) FileHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, name, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		session := m.Get(id)
+		if session == nil {
+			http.NotFound(w, r)
+			return
+		}
+		if _, err := session.fileSize(name); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		// Files never change once written
+		w.Header().Set("Cache-Control", "public, max-age=86400, immutable")
+		http.ServeFile(w, r, filepath.Join(session.dir, name))
+	})
+}
+
+// sessionSegment is a segment of a session on disk: the segment file and
+// the files of its parts.
+type sessionSegment struct {
+	msn   int
+	files []string
+	bytes int64
+}
+
+// Session is a JIT or live transcode session. The transcoder writes
+// segment and part files into its directory and reports them, and the
+// session lists them in its playlist and deletes those its retention
+// policy no longer keeps.
+type Session struct {
+	id        string
+	mediaID   string
+	dir       string
+	playlist  *LivePlaylist
+	policy    RetentionPolicy
+	publisher Publisher
+	readahead *Readahead
+
+	mu           sync.Mutex
+	segments     []sessionSegment
+	pendingFiles []string // parts of the segment being produced
+	pendingBytes int64
+	nextMSN      int
+	diskBytes    atomic.Int64
+}
+
+// ID returns the ID of the session.
+func (s *Session) ID() string {
+	return s.id
+}
+
+// MediaID returns the ID of the media the session streams.
+func (s *Session) MediaID() string {
+	return s.mediaID
+}
+
+// Dir returns the directory segment files are written to.
+func (s *Session) Dir() string {
+	return s.dir
+}
+
+// Playlist returns the playlist of the session.
+func (s *Session) Playlist() *LivePlaylist {
+	return s.playlist
+}
+
+// Readahead returns the readahead steering the transcoder of the session,
+// or nil when the manager has none.
+func (s *Session) Readahead() *Readahead {
+	return s.readahead
+}
+
+// DiskBytes returns the size of the segment files the session keeps.
+func (s *Session) DiskBytes() int64 {
+	return s.diskBytes.Load()
+}
+
+// AddPart records a part file written to the session directory, named by
+// the URI of the part, publishes it and lists it in the playlist.
+func (s *Session) AddPart(part Part) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size, err := s.fileSize(part.URI)
+	if err != nil {
+		return err
+	}
+	if err := s.publish(part.URI); err != nil {
+		return err
+	}
+	if err := s.playlist.AddPart(part); err != nil {
+		return err
+	}
+	s.pendingFiles = append(s.pendingFiles, part.URI)
+	s.pendingBytes += size
+	s.diskBytes.Add(size)
+	return nil
+}
+
+// CompleteSegment records a segment file written to the session directory,
+// named by uri, publishes it and lists it in the playlist with the parts
+// added since the previous segment. Segments the retention policy no
+// longer keeps are then deleted; failing to delete them does not undo the
+// new segment.
+func (s *Session) CompleteSegment(uri string, duration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size, err := s.fileSize(uri)
+	if err != nil {
+		return err
+	}
+	if err := s.publish(uri); err != nil {
+		return err
+	}
+	if err := s.playlist.CompleteSegment(uri, duration); err != nil {
+		return err
+	}
+
+	s.segments = append(s.segments, sessionSegment{
+		msn:   s.nextMSN,
+		files: append(s.pendingFiles, uri),
+		bytes: s.pendingBytes + size,
+	})
+	s.nextMSN++
+	s.pendingFiles = nil
+	s.pendingBytes = 0
+	s.diskBytes.Add(size)
+	return s.applyRetention()
+}
+
+// applyRetention deletes the segments that slid out of the playlist, then
+// the oldest segments while the session is over its disk limit. The
+// newest segment is always kept. The caller holds mu.
+func (s *Session) applyRetention() error {
+	expired := 0
+	first := s.playlist.firstSequence()
+	for expired < len(s.segments) && s.segments[expired].msn < first {
+		expired++
+	}
+
+	if limit := s.policy.MaxDiskBytes; limit > 0 {
+		kept := s.diskBytes.Load()
+		for _, segment := range s.segments[:expired] {
+			kept -= segment.bytes
+		}
+		dropped := 0
+		for kept > limit && expired+dropped < len(s.segments)-1 {
+			kept -= s.segments[expired+dropped].bytes
+			dropped++
+		}
+		s.playlist.dropOldest(dropped)
+		expired += dropped
+	}
+
+	var (
+		errs  []error
+		names []string
+	)
+	for _, segment := range s.segments[:expired] {
+		for _, name := range segment.files {
+			if err := os.Remove(filepath.Join(s.dir, name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+		names = append(names, segment.files...)
+		s.diskBytes.Add(-segment.bytes)
+	}
+	s.segments = append([]sessionSegment(nil), s.segments[expired:]...)
+	errs = append(errs, s.unpublish(names))
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("failed to delete expired segments: %w", err)
+	}
+	return nil
+}
+
+// publish publishes a file of the session, if it has a publisher. The
+// caller holds mu.
+func (s *Session) publish(name string) error {
+	if s.publisher == nil {
+		return nil
+	}
+	if err := s.publisher.Publish(context.Background(), s, name); err != nil {
+		return fmt.Errorf("failed to publish %s: %w", name, err)
+	}
+	return nil
+}
+
+// unpublish removes published files of the session. The caller holds mu.
+func (s *Session) unpublish(names []string) error {
+	if s.publisher == nil || len(names) == 0 {
+		return nil
+	}
+	return s.publisher.Unpublish(context.Background(), s, names)
+}
+
+// fileSize returns the size of a file in the session directory.
+func (s *Session) fileSize(name string) (int64, error) {
+	if name == "" || filepath.Base(name) != name {
+		return 0, fmt.Errorf("segment file %q must be in the session directory", name)
+	}
+	info, err := os.Stat(filepath.Join(s.dir, name))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// teardown ends the playlist, unpublishes the files of the session and
+// deletes its directory.
+func (s *Session) teardown() error {
+	s.playlist.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := s.pendingFiles
+	for _, segment := range s.segments {
+		names = append(names, segment.files...)
+	}
+	unpublishErr := s.unpublish(names)
+
+	s.segments = nil
+	s.pendingFiles = nil
+	s.diskBytes.Store(0)
+	if err := os.RemoveAll(s.dir); err != nil {
+		return fmt.Errorf("failed to delete session %s: %w", s.id, err)
+	}
+	return unpublishErr
+}
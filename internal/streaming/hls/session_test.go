@@ -0,0 +1,174 @@
+package hls_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/narwhalmedia/narwhal/internal/streaming/hls"
+)
+
+type SessionTestSuite struct {
+	suite.Suite
+
+	root string
+}
+
+func (suite *SessionTestSuite) SetupTest() {
+	suite.root = filepath.Join(suite.T().TempDir(), "sessions")
+}
+
+// open starts a session with four second segments.
+func (suite *SessionTestSuite) open(manager *hls.SessionManager, id string) *hls.Session {
+	session, err := manager.Open(id, "movie", hls.Config{TargetDuration: 4 * time.Second})
+	suite.Require().NoError(err)
+	return session
+}
+
+// produce writes a segment file of size bytes and completes it.
+func (suite *SessionTestSuite) produce(session *hls.Session, msn, size int) {
+	name := fmt.Sprintf("seg%d.ts", msn)
+	suite.Require().NoError(os.WriteFile(filepath.Join(session.Dir(), name), make([]byte, size), 0o644))
+	suite.Require().NoError(session.CompleteSegment(name, 4*time.Second))
+}
+
+func (suite *SessionTestSuite) TestWindowDeletesSegmentsThatSlideOut() {
+	manager, err := hls.NewSessionManager(suite.root, hls.RetentionPolicy{Window: 10 * time.Second})
+	suite.Require().NoError(err)
+	session := suite.open(manager, "jit")
+
+	for msn := 0; msn < 5; msn++ {
+		suite.produce(session, msn, 100)
+	}
+
+	rendered := string(session.Playlist().Render())
+	suite.Contains(rendered, "#EXT-X-MEDIA-SEQUENCE:2\n", "three segments cover the window")
+	suite.NotContains(rendered, "PLAYLIST-TYPE:EVENT")
+	suite.NoFileExists(filepath.Join(session.Dir(), "seg1.ts"))
+	suite.FileExists(filepath.Join(session.Dir(), "seg2.ts"))
+	suite.Equal(int64(300), session.DiskBytes())
+}
+
+func (suite *SessionTestSuite) TestDiskLimitDropsOldestSegments() {
+	manager, err := hls.NewSessionManager(suite.root, hls.RetentionPolicy{MaxDiskBytes: 250})
+	suite.Require().NoError(err)
+	session := suite.open(manager, "jit")
+
+	suite.produce(session, 0, 100)
+	suite.Contains(string(session.Playlist().Render()), "#EXT-X-PLAYLIST-TYPE:EVENT\n")
+	suite.produce(session, 1, 100)
+	suite.produce(session, 2, 100)
+	// A segment larger than the limit is still kept
+	suite.produce(session, 3, 400)
+
+	rendered := string(session.Playlist().Render())
+	suite.Contains(rendered, "#EXT-X-MEDIA-SEQUENCE:3\n")
+	suite.NotContains(rendered, "PLAYLIST-TYPE:EVENT", "segments were removed")
+	suite.NoFileExists(filepath.Join(session.Dir(), "seg2.ts"))
+	suite.Equal(int64(400), session.DiskBytes())
+
+	stats := manager.Stats()
+	suite.Equal(1, stats.Active)
+	suite.Equal(int64(400), stats.DiskBytes)
+}
+
+func (suite *SessionTestSuite) TestCloseDeletesSessionDirectory() {
+	manager, err := hls.NewSessionManager(suite.root, hls.RetentionPolicy{})
+	suite.Require().NoError(err)
+	session := suite.open(manager, "jit")
+	suite.produce(session, 0, 100)
+
+	_, err = manager.Open("jit", "movie", hls.Config{TargetDuration: 4 * time.Second})
+	suite.ErrorIs(err, hls.ErrSessionExists)
+	_, err = manager.Open("../escape", "movie", hls.Config{TargetDuration: 4 * time.Second})
+	suite.Error(err)
+	suite.Error(session.CompleteSegment("../seg1.ts", 4*time.Second))
+
+	suite.Require().NoError(manager.Close("jit"))
+	suite.NoDirExists(session.Dir())
+	suite.Nil(manager.Get("jit"))
+	suite.Contains(string(session.Playlist().Render()), "#EXT-X-ENDLIST\n")
+	suite.Equal(hls.SessionStats{}, manager.Stats())
+}
+
+func (suite *SessionTestSuite) TestStaleSessionsAreDeletedOnStart() {
+	stale := filepath.Join(suite.root, "crashed")
+	suite.Require().NoError(os.MkdirAll(stale, 0o755))
+	suite.Require().NoError(os.WriteFile(filepath.Join(stale, "seg0.ts"), []byte("data"), 0o644))
+
+	_, err := hls.NewSessionManager(suite.root, hls.RetentionPolicy{})
+	suite.Require().NoError(err)
+	suite.NoDirExists(stale)
+}
+
+// memoryStore keeps objects in memory.
+type memoryStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *memoryStore) Put(_ context.Context, key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = data
+	return nil
+}
+
+func (s *memoryStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *memoryStore) URL(key string) string {
+	return "https://cdn.example.com/" + key
+}
+
+func (suite *SessionTestSuite) TestPublishedSessionsListSignedURLs() {
+	store := &memoryStore{objects: make(map[string][]byte)}
+	manager, err := hls.NewSessionManager(suite.root, hls.RetentionPolicy{Window: 10 * time.Second})
+	suite.Require().NoError(err)
+	manager.
+		WithPublisher(hls.NewStorePublisher(store, func(session *hls.Session, name string) string {
+			return session.MediaID() + "/" + session.ID() + "/" + name
+		})).
+		WithURLs(func(mediaID, sessionID string) func(string) string {
+			return func(uri string) string {
+				return store.URL(mediaID+"/"+sessionID+"/"+uri) + "?token=abc"
+			}
+		})
+	session := suite.open(manager, "jit")
+
+	for msn := 0; msn < 5; msn++ {
+		suite.produce(session, msn, 100)
+	}
+
+	suite.Contains(string(session.Playlist().Render()), "https://cdn.example.com/movie/jit/seg4.ts?token=abc\n")
+	suite.Len(store.objects, 3, "segments that slid out are unpublished")
+	suite.Contains(store.objects, "movie/jit/seg2.ts")
+
+	// Edges pulling from the origin get the files of open sessions
+	rec := httptest.NewRecorder()
+	manager.FileHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jit/seg4.ts", nil))
+	suite.Equal(http.StatusOK, rec.Code)
+	suite.Equal(100, rec.Body.Len())
+	rec = httptest.NewRecorder()
+	manager.FileHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jit/seg0.ts", nil))
+	suite.Equal(http.StatusNotFound, rec.Code)
+
+	suite.Require().NoError(manager.Close("jit"))
+	suite.Empty(store.objects)
+}
+
+func TestSessionTestSuite(t *testing.T) {
+	suite.Run(t, new(SessionTestSuite))
+}
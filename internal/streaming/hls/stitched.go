@@ -0,0 +1,54 @@
+package hls
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// RenderStitched returns a VOD media playlist playing the segments of
+// several files back to back, as for an episode split across files. Each
+// file after the first starts with a discontinuity, since its timestamps
+// and encoding parameters start over. uri maps the URIs of segments as
+// Config.URI does; nil lists them as they are.
+func RenderStitched(files [][]Segment, uri func(uri string) string) ([]byte, error) {
+	var target time.Duration
+	count := 0
+	for _, segments := range files {
+		for _, segment := range segments {
+			target = max(target, segment.Duration)
+			count++
+		}
+	}
+	if count == 0 {
+		return nil, errors.New("stitched playlist has no segments")
+	}
+	if uri == nil {
+		uri = func(uri string) string { return uri }
+	}
+
+	var b bytes.Buffer
+	b.WriteString("#EXTM3U\n")
+	b.WriteString("#EXT-X-VERSION:6\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(target.Seconds())))
+	b.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+	b.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n")
+
+	started := false
+	for _, segments := range files {
+		if len(segments) == 0 {
+			continue
+		}
+		if started {
+			b.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		started = true
+		for _, segment := range segments {
+			fmt.Fprintf(&b, "#EXTINF:%s,\n%s\n", seconds(segment.Duration), uri(segment.URI))
+		}
+	}
+	b.WriteString("#EXT-X-ENDLIST\n")
+	return b.Bytes(), nil
+}
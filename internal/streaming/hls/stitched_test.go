@@ -0,0 +1,40 @@
+package hls_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/streaming/hls"
+)
+
+func TestRenderStitched(t *testing.T) {
+	files := [][]hls.Segment{
+		{
+			{URI: "part1/seg0.ts", Duration: 6 * time.Second},
+			{URI: "part1/seg1.ts", Duration: 2500 * time.Millisecond},
+		},
+		{},
+		{
+			{URI: "part2/seg0.ts", Duration: 6500 * time.Millisecond},
+		},
+	}
+
+	rendered, err := hls.RenderStitched(files, func(uri string) string { return "/cdn/" + uri })
+	require.NoError(t, err)
+	assert.Equal(t, "#EXTM3U\n"+
+		"#EXT-X-VERSION:6\n"+
+		"#EXT-X-TARGETDURATION:7\n"+
+		"#EXT-X-PLAYLIST-TYPE:VOD\n"+
+		"#EXT-X-MEDIA-SEQUENCE:0\n"+
+		"#EXTINF:6.000,\n/cdn/part1/seg0.ts\n"+
+		"#EXTINF:2.500,\n/cdn/part1/seg1.ts\n"+
+		"#EXT-X-DISCONTINUITY\n"+
+		"#EXTINF:6.500,\n/cdn/part2/seg0.ts\n"+
+		"#EXT-X-ENDLIST\n", string(rendered))
+
+	_, err = hls.RenderStitched([][]hls.Segment{{}}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,289 @@
+package playback
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+)
+
+// VideoSupport is a video codec a device decodes. Codecs, profiles and
+// levels are named as FFmpeg reports them.
+type VideoSupport struct {
+	Codec string
+	// Profiles are the codec profiles decoded, such as "High" or
+	// "Main 10". Empty decodes every profile.
+	Profiles []string
+	// MaxLevel is the highest level decoded, as FFmpeg reports it: 41 for
+	// H.264 level 4.1, 153 for HEVC level 5.1. Zero decodes every level.
+	MaxLevel int
+}
+
+// DeviceProfile is what a kind of client device plays natively.
+type DeviceProfile struct {
+	// Type identifies the kind of device, such as "web-chrome" or
+	// "android-tv".
+	Type string
+	Name string
+	// Containers are the FFmpeg demuxer names of the containers played,
+	// such as "mp4" or "matroska".
+	Containers  []string
+	VideoCodecs []VideoSupport
+	AudioCodecs []string
+	// MaxAudioChannels is the most audio channels played. Zero plays any
+	// number.
+	MaxAudioChannels int
+	TextSubtitles    bool
+	ImageSubtitles   bool
+}
+
+// Client returns what the device renders.
+func (p DeviceProfile) Client() Client {
+	return Client{TextSubtitles: p.TextSubtitles, ImageSubtitles: p.ImageSubtitles}
+}
+
+// Codec support shared by the built-in profiles.
+var (
+	h264High = VideoSupport{
+		Codec:    "h264",
+		Profiles: []string{"Constrained Baseline", "Baseline", "Main", "High"},
+		MaxLevel: 52,
+	}
+	hevcMain = VideoSupport{Codec: "hevc", Profiles: []string{"Main", "Main 10"}, MaxLevel: 153}
+	vp9      = VideoSupport{Codec: "vp9"}
+	av1      = VideoSupport{Codec: "av1"}
+)
+
+// deviceProfiles are the built-in profiles, by type.
+var deviceProfiles = map[string]DeviceProfile{
+	"web-chrome": {
+		Name:          "Chrome",
+		Containers:    []string{"mp4", "mov", "webm"},
+		VideoCodecs:   []VideoSupport{h264High, vp9, av1},
+		AudioCodecs:   []string{"aac", "mp3", "opus", "vorbis", "flac"},
+		TextSubtitles: true,
+	},
+	"web-firefox": {
+		Name:             "Firefox",
+		Containers:       []string{"mp4", "webm"},
+		VideoCodecs:      []VideoSupport{h264High, vp9, av1},
+		AudioCodecs:      []string{"aac", "mp3", "opus", "vorbis", "flac"},
+		MaxAudioChannels: 2,
+		TextSubtitles:    true,
+	},
+	"web-safari": {
+		Name:             "Safari",
+		Containers:       []string{"mp4", "mov", "mpegts"},
+		VideoCodecs:      []VideoSupport{h264High, hevcMain},
+		AudioCodecs:      []string{"aac", "ac3", "eac3", "mp3", "alac", "flac"},
+		MaxAudioChannels: 6,
+		TextSubtitles:    true,
+	},
+	"ios": {
+		Name:             "iPhone and iPad",
+		Containers:       []string{"mp4", "mov", "mpegts"},
+		VideoCodecs:      []VideoSupport{h264High, hevcMain},
+		AudioCodecs:      []string{"aac", "ac3", "eac3", "mp3", "alac", "flac"},
+		MaxAudioChannels: 6,
+		TextSubtitles:    true,
+	},
+	"tvos": {
+		Name:             "Apple TV",
+		Containers:       []string{"mp4", "mov", "mpegts"},
+		VideoCodecs:      []VideoSupport{h264High, hevcMain},
+		AudioCodecs:      []string{"aac", "ac3", "eac3", "mp3", "alac", "flac"},
+		MaxAudioChannels: 8,
+		TextSubtitles:    true,
+	},
+	"android": {
+		Name:             "Android",
+		Containers:       []string{"mp4", "matroska", "webm", "mpegts"},
+		VideoCodecs:      []VideoSupport{h264High, {Codec: "hevc", Profiles: []string{"Main"}, MaxLevel: 150}, vp9},
+		AudioCodecs:      []string{"aac", "mp3", "opus", "vorbis", "flac"},
+		MaxAudioChannels: 2,
+		TextSubtitles:    true,
+	},
+	"android-tv": {
+		Name:           "Android TV",
+		Containers:     []string{"mp4", "matroska", "webm", "mpegts"},
+		VideoCodecs:    []VideoSupport{h264High, hevcMain, vp9, av1},
+		AudioCodecs:    []string{"aac", "ac3", "eac3", "mp3", "opus", "vorbis", "flac"},
+		TextSubtitles:  true,
+		ImageSubtitles: true,
+	},
+	"roku": {
+		Name:             "Roku",
+		Containers:       []string{"mp4", "mov", "matroska", "mpegts"},
+		VideoCodecs:      []VideoSupport{h264High, hevcMain, vp9},
+		AudioCodecs:      []string{"aac", "ac3", "eac3", "mp3", "flac"},
+		MaxAudioChannels: 6,
+		TextSubtitles:    true,
+	},
+}
+
+// genericProfile is what devices of an unknown type are assumed to play:
+// stereo AAC and H.264 up to level 4.1, which nearly every device does.
+var genericProfile = DeviceProfile{
+	Type:             "generic",
+	Name:             "Generic device",
+	Containers:       []string{"mp4", "mpegts"},
+	VideoCodecs:      []VideoSupport{{Codec: "h264", Profiles: h264High.Profiles, MaxLevel: 41}},
+	AudioCodecs:      []string{"aac", "mp3"},
+	MaxAudioChannels: 2,
+	TextSubtitles:    true,
+}
+
+// LookupDeviceProfile returns the built-in profile of a device type.
+func LookupDeviceProfile(deviceType string) (DeviceProfile, error) {
+	deviceType = strings.ToLower(strings.TrimSpace(deviceType))
+	profile, ok := deviceProfiles[deviceType]
+	if !ok {
+		return DeviceProfile{}, errors.NotFound(fmt.Sprintf("no profile for device type %q", deviceType))
+	}
+	profile.Type = deviceType
+	return profile, nil
+}
+
+// DeviceProfiles returns the built-in profiles, sorted by type.
+func DeviceProfiles() []DeviceProfile {
+	profiles := make([]DeviceProfile, 0, len(deviceProfiles))
+	for deviceType, profile := range deviceProfiles {
+		profile.Type = deviceType
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Type < profiles[j].Type })
+	return profiles
+}
+
+// ResolveDeviceProfile returns the profile playback is decided for. Clients
+// sending their capabilities are taken at their word; the others get the
+// built-in profile of their device type, or the generic profile if there
+// is none.
+func ResolveDeviceProfile(deviceType string, declared *DeviceProfile) DeviceProfile {
+	if declared != nil {
+		return *declared
+	}
+	if profile, err := LookupDeviceProfile(deviceType); err == nil {
+		return profile
+	}
+	return genericProfile
+}
+
+// MediaSource describes the streams of a media file, as FFmpeg reports
+// them.
+type MediaSource struct {
+	// Container is the demuxer name, which lists every format the demuxer
+	// handles, such as "mov,mp4,m4a,3gp,3g2,mj2".
+	Container     string
+	VideoCodec    string
+	VideoProfile  string
+	VideoLevel    int
+	AudioCodec    string
+	AudioChannels int
+}
+
+// PlaybackMethod is how media reaches the client.
+type PlaybackMethod string
+
+// Playback methods.
+const (
+	// PlaybackDirectPlay serves the file as is.
+	PlaybackDirectPlay PlaybackMethod = "direct_play"
+	// PlaybackDirectStream remuxes the streams into a container the
+	// client plays, without transcoding them.
+	PlaybackDirectStream PlaybackMethod = "direct_stream"
+	// PlaybackTranscode transcodes the streams the client cannot play.
+	PlaybackTranscode PlaybackMethod = "transcode"
+)
+
+// PlaybackDecision is how media is played on a device.
+type PlaybackDecision struct {
+	Method         PlaybackMethod
+	TranscodeVideo bool
+	TranscodeAudio bool
+	// Reasons explain why the file is not played directly.
+	Reasons []string
+}
+
+// DecidePlayback decides how a device plays a media file. Files are played
+// directly when the device plays their container and streams, remuxed when
+// it only lacks the container, and transcoded otherwise. Sources without a
+// video or audio stream leave it out of the decision.
+func DecidePlayback(source MediaSource, profile DeviceProfile) PlaybackDecision {
+	var decision PlaybackDecision
+
+	if source.VideoCodec != "" {
+		if reason := profile.videoUnsupported(source); reason != "" {
+			decision.TranscodeVideo = true
+			decision.Reasons = append(decision.Reasons, reason)
+		}
+	}
+	if source.AudioCodec != "" {
+		if reason := profile.audioUnsupported(source); reason != "" {
+			decision.TranscodeAudio = true
+			decision.Reasons = append(decision.Reasons, reason)
+		}
+	}
+	container := profile.playsContainer(source.Container)
+	if !container {
+		decision.Reasons = append(decision.Reasons, fmt.Sprintf("container %s not supported", source.Container))
+	}
+
+	switch {
+	case decision.TranscodeVideo || decision.TranscodeAudio:
+		decision.Method = PlaybackTranscode
+	case !container:
+		decision.Method = PlaybackDirectStream
+	default:
+		decision.Method = PlaybackDirectPlay
+	}
+	return decision
+}
+
+// playsContainer reports whether the device plays any of the formats of a
+// demuxer.
+func (p DeviceProfile) playsContainer(demuxer string) bool {
+	for _, format := range strings.Split(demuxer, ",") {
+		if containsFold(p.Containers, strings.TrimSpace(format)) {
+			return true
+		}
+	}
+	return false
+}
+
+// videoUnsupported returns why the device cannot decode the video of
+// source, or "" if it can.
+func (p DeviceProfile) videoUnsupported(source MediaSource) string {
+	idx := slices.IndexFunc(p.VideoCodecs, func(v VideoSupport) bool {
+		return strings.EqualFold(v.Codec, source.VideoCodec)
+	})
+	if idx < 0 {
+		return fmt.Sprintf("video codec %s not supported", source.VideoCodec)
+	}
+	support := p.VideoCodecs[idx]
+	if source.VideoProfile != "" && len(support.Profiles) > 0 && !containsFold(support.Profiles, source.VideoProfile) {
+		return fmt.Sprintf("%s profile %s not supported", source.VideoCodec, source.VideoProfile)
+	}
+	if support.MaxLevel > 0 && source.VideoLevel > support.MaxLevel {
+		return fmt.Sprintf("%s level %d above %d", source.VideoCodec, source.VideoLevel, support.MaxLevel)
+	}
+	return ""
+}
+
+// audioUnsupported returns why the device cannot play the audio of source,
+// or "" if it can.
+func (p DeviceProfile) audioUnsupported(source MediaSource) string {
+	if !containsFold(p.AudioCodecs, source.AudioCodec) {
+		return fmt.Sprintf("audio codec %s not supported", source.AudioCodec)
+	}
+	if p.MaxAudioChannels > 0 && source.AudioChannels > p.MaxAudioChannels {
+		return fmt.Sprintf("%d audio channels above %d", source.AudioChannels, p.MaxAudioChannels)
+	}
+	return ""
+}
+
+func containsFold(values []string, value string) bool {
+	return slices.ContainsFunc(values, func(v string) bool { return strings.EqualFold(v, value) })
+}
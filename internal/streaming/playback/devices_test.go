@@ -0,0 +1,104 @@
+package playback_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/streaming/playback"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+)
+
+func TestLookupDeviceProfile(t *testing.T) {
+	profile, err := playback.LookupDeviceProfile(" Android-TV ")
+	require.NoError(t, err)
+	assert.Equal(t, "android-tv", profile.Type)
+	assert.True(t, profile.Client().ImageSubtitles)
+
+	_, err = playback.LookupDeviceProfile("toaster")
+	assert.True(t, errors.IsNotFound(err))
+
+	profiles := playback.DeviceProfiles()
+	require.NotEmpty(t, profiles)
+	assert.IsIncreasing(t, func() []string {
+		types := make([]string, len(profiles))
+		for i, p := range profiles {
+			types[i] = p.Type
+		}
+		return types
+	}())
+}
+
+func TestResolveDeviceProfile(t *testing.T) {
+	declared := &playback.DeviceProfile{Type: "custom", AudioCodecs: []string{"flac"}}
+	assert.Equal(t, *declared, playback.ResolveDeviceProfile("ios", declared), "declared capabilities win")
+	assert.Equal(t, "ios", playback.ResolveDeviceProfile("ios", nil).Type)
+	assert.Equal(t, "generic", playback.ResolveDeviceProfile("toaster", nil).Type)
+}
+
+func TestDecidePlayback(t *testing.T) {
+	chrome, err := playback.LookupDeviceProfile("web-chrome")
+	require.NoError(t, err)
+	androidTV, err := playback.LookupDeviceProfile("android-tv")
+	require.NoError(t, err)
+
+	mp4 := playback.MediaSource{
+		Container:     "mov,mp4,m4a,3gp,3g2,mj2",
+		VideoCodec:    "h264",
+		VideoProfile:  "High",
+		VideoLevel:    41,
+		AudioCodec:    "aac",
+		AudioChannels: 2,
+	}
+	decision := playback.DecidePlayback(mp4, chrome)
+	assert.Equal(t, playback.PlaybackDirectPlay, decision.Method)
+	assert.Empty(t, decision.Reasons)
+
+	mkv := mp4
+	mkv.Container = "matroska,webm"
+	assert.Equal(t, playback.PlaybackDirectPlay, playback.DecidePlayback(mkv, androidTV).Method)
+
+	// Chrome plays WebM, but not every file its demuxer reads
+	mkv.AudioCodec = "ac3"
+	mkv.AudioChannels = 6
+	decision = playback.DecidePlayback(mkv, chrome)
+	assert.Equal(t, playback.PlaybackTranscode, decision.Method)
+	assert.False(t, decision.TranscodeVideo)
+	assert.True(t, decision.TranscodeAudio)
+	assert.Equal(t, []string{"audio codec ac3 not supported"}, decision.Reasons)
+
+	ts := mp4
+	ts.Container = "mpegts"
+	decision = playback.DecidePlayback(ts, chrome)
+	assert.Equal(t, playback.PlaybackDirectStream, decision.Method)
+	assert.Equal(t, []string{"container mpegts not supported"}, decision.Reasons)
+
+	hevc := mp4
+	hevc.VideoCodec = "hevc"
+	hevc.VideoProfile = "Main 10"
+	hevc.VideoLevel = 153
+	decision = playback.DecidePlayback(hevc, chrome)
+	assert.True(t, decision.TranscodeVideo)
+	assert.Equal(t, playback.PlaybackDirectPlay, playback.DecidePlayback(hevc, androidTV).Method)
+
+	high10 := mp4
+	high10.VideoProfile = "High 10"
+	assert.Equal(t, []string{"h264 profile High 10 not supported"}, playback.DecidePlayback(high10, chrome).Reasons)
+
+	level := mp4
+	level.VideoLevel = 62
+	assert.Equal(t, []string{"h264 level 62 above 52"}, playback.DecidePlayback(level, chrome).Reasons)
+
+	surround := mp4
+	surround.AudioChannels = 6
+	decision = playback.DecidePlayback(surround, playback.ResolveDeviceProfile("web-firefox", nil))
+	assert.Equal(t, playback.PlaybackTranscode, decision.Method)
+	assert.Equal(t, []string{"6 audio channels above 2"}, decision.Reasons)
+
+	// Audio-only files leave the video out
+	music := playback.MediaSource{Container: "flac", AudioCodec: "flac", AudioChannels: 2}
+	decision = playback.DecidePlayback(music, chrome)
+	assert.Equal(t, playback.PlaybackDirectStream, decision.Method)
+	assert.False(t, decision.TranscodeVideo)
+}
@@ -0,0 +1,214 @@
+// Package playback decides how media is delivered to a client: which
+// streams are shown and what has to be transcoded for the client to play
+// them.
+package playback
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/language"
+
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+)
+
+// SubtitleDelivery is how a subtitle reaches the client.
+type SubtitleDelivery string
+
+// Subtitle deliveries.
+const (
+	// SubtitleNone shows no subtitle.
+	SubtitleNone SubtitleDelivery = "none"
+	// SubtitleExternal delivers the subtitle as a separate track the
+	// client renders.
+	SubtitleExternal SubtitleDelivery = "external"
+	// SubtitleBurn renders the subtitle into the video, which forces a
+	// video transcode.
+	SubtitleBurn SubtitleDelivery = "burn"
+)
+
+// imageCodecs are subtitle codecs made of bitmaps rather than text.
+var imageCodecs = map[string]bool{
+	"hdmv_pgs_subtitle": true,
+	"pgssub":            true,
+	"dvd_subtitle":      true,
+	"dvdsub":            true,
+	"dvb_subtitle":      true,
+	"xsub":              true,
+}
+
+// SubtitleTrack is a subtitle stream of a media file.
+type SubtitleTrack struct {
+	// Index is the stream index in the file.
+	Index    int
+	Codec    string
+	Language string
+	Title    string
+	Forced   bool
+}
+
+// ImageBased reports whether the subtitle is made of bitmaps.
+func (t SubtitleTrack) ImageBased() bool {
+	return imageCodecs[strings.ToLower(t.Codec)]
+}
+
+// Client describes what a client can render.
+type Client struct {
+	TextSubtitles  bool
+	ImageSubtitles bool
+}
+
+func (c Client) renders(track SubtitleTrack) bool {
+	if track.ImageBased() {
+		return c.ImageSubtitles
+	}
+	return c.TextSubtitles
+}
+
+// SubtitleRequest is the subtitle a client asks for.
+type SubtitleRequest struct {
+	// StreamIndex selects a track. Nil shows forced subtitles only.
+	StreamIndex *int
+	// Burn burns the subtitle in even if the client can render it.
+	Burn bool
+	// Language is the user's preferred subtitle language.
+	Language string
+	// AudioLanguage is the language of the audio being played.
+	AudioLanguage string
+}
+
+// SubtitleDecision is the subtitle shown and how it is delivered.
+type SubtitleDecision struct {
+	Track    *SubtitleTrack
+	Delivery SubtitleDelivery
+	// Ordinal is the position of the track among the subtitle streams of
+	// the file, as used by FFmpeg's subtitle stream specifiers.
+	Ordinal int
+	// Forced reports that the track was picked for its forced flag.
+	Forced bool
+}
+
+// RequiresTranscode reports whether the decision needs the video to be
+// transcoded.
+func (d SubtitleDecision) RequiresTranscode() bool {
+	return d.Delivery == SubtitleBurn
+}
+
+// DecideSubtitles picks the subtitle to show and how. A requested track is
+// burned in when the client asks for it or cannot render the track. Without
+// a requested track, a forced track in the preferred or audio language is
+// shown, so foreign-language parts are translated.
+func DecideSubtitles(tracks []SubtitleTrack, req SubtitleRequest, client Client) (SubtitleDecision, error) {
+	ordinal := -1
+	forced := false
+
+	if req.StreamIndex != nil {
+		for i, track := range tracks {
+			if track.Index == *req.StreamIndex {
+				ordinal = i
+				break
+			}
+		}
+		if ordinal < 0 {
+			return SubtitleDecision{}, errors.BadRequest(fmt.Sprintf("subtitle stream %d not found", *req.StreamIndex))
+		}
+	} else {
+		ordinal = findForced(tracks, req.Language, req.AudioLanguage)
+		forced = true
+	}
+
+	if ordinal < 0 {
+		return SubtitleDecision{Delivery: SubtitleNone, Ordinal: -1}, nil
+	}
+
+	track := tracks[ordinal]
+	delivery := SubtitleExternal
+	if req.Burn || !client.renders(track) {
+		delivery = SubtitleBurn
+	}
+	return SubtitleDecision{
+		Track:    &track,
+		Delivery: delivery,
+		Ordinal:  ordinal,
+		Forced:   forced,
+	}, nil
+}
+
+// findForced returns the ordinal of the forced track to show, preferring
+// the given languages in order and then a track without a language.
+func findForced(tracks []SubtitleTrack, languages ...string) int {
+	for _, lang := range languages {
+		if lang == "" {
+			continue
+		}
+		for i, track := range tracks {
+			if track.Forced && sameLanguage(track.Language, lang) {
+				return i
+			}
+		}
+	}
+	for i, track := range tracks {
+		if track.Forced && (track.Language == "" || track.Language == "und") {
+			return i
+		}
+	}
+	return -1
+}
+
+// bibliographicCodes maps the ISO 639-2/B codes that differ from their
+// terminology counterparts, which is all language.ParseBase understands.
+var bibliographicCodes = map[string]string{
+	"alb": "sqi", "arm": "hye", "baq": "eus", "bur": "mya", "chi": "zho",
+	"cze": "ces", "dut": "nld", "fre": "fra", "geo": "kat", "ger": "deu",
+	"gre": "ell", "ice": "isl", "mac": "mkd", "mao": "mri", "may": "msa",
+	"per": "fas", "rum": "ron", "slo": "slk", "tib": "bod", "wel": "cym",
+}
+
+// sameLanguage compares language codes, treating the ISO 639-1 and 639-2
+// codes of a language as equal.
+func sameLanguage(a, b string) bool {
+	if strings.EqualFold(a, b) {
+		return true
+	}
+	baseA, errA := parseLanguage(a)
+	baseB, errB := parseLanguage(b)
+	return errA == nil && errB == nil && baseA == baseB
+}
+
+func parseLanguage(code string) (language.Base, error) {
+	code = strings.ToLower(code)
+	if terminology, ok := bibliographicCodes[code]; ok {
+		code = terminology
+	}
+	return language.ParseBase(code)
+}
+
+// BurnInFilter returns the FFmpeg filtergraph that burns the decided
+// subtitle of input into the first video stream, labelled [v]. Text
+// subtitles are rendered with libass; image subtitles are overlaid.
+func BurnInFilter(input string, decision SubtitleDecision) (string, error) {
+	if decision.Delivery != SubtitleBurn || decision.Track == nil {
+		return "", errors.BadRequest("subtitle is not burned in")
+	}
+
+	if decision.Track.ImageBased() {
+		return fmt.Sprintf("[0:v:0][0:s:%d]overlay=eof_action=pass[v]", decision.Ordinal), nil
+	}
+	return fmt.Sprintf("[0:v:0]subtitles=filename=%s:si=%d[v]", escapeFilterValue(input), decision.Ordinal), nil
+}
+
+// filterEscaper escapes a value for a filter option and then for the
+// filtergraph around it.
+var filterEscaper = strings.NewReplacer(
+	`\`, `\\\\`,
+	`'`, `\\\'`,
+	`:`, `\\:`,
+	`[`, `\[`,
+	`]`, `\]`,
+	`,`, `\,`,
+	`;`, `\;`,
+)
+
+func escapeFilterValue(value string) string {
+	return filterEscaper.Replace(value)
+}
@@ -0,0 +1,95 @@
+package playback_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/narwhalmedia/narwhal/internal/streaming/playback"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+)
+
+type SubtitlesTestSuite struct {
+	suite.Suite
+
+	tracks []playback.SubtitleTrack
+	text   playback.Client
+}
+
+func (suite *SubtitlesTestSuite) SetupTest() {
+	suite.tracks = []playback.SubtitleTrack{
+		{Index: 3, Codec: "subrip", Language: "eng"},
+		{Index: 4, Codec: "subrip", Language: "eng", Forced: true},
+		{Index: 5, Codec: "hdmv_pgs_subtitle", Language: "fre"},
+		{Index: 6, Codec: "hdmv_pgs_subtitle", Language: "fre", Forced: true},
+	}
+	suite.text = playback.Client{TextSubtitles: true}
+}
+
+func (suite *SubtitlesTestSuite) TestDecide_RequestedTrack() {
+	index := 3
+	decision, err := playback.DecideSubtitles(suite.tracks, playback.SubtitleRequest{StreamIndex: &index}, suite.text)
+	suite.Require().NoError(err)
+	suite.Equal(playback.SubtitleExternal, decision.Delivery)
+	suite.Equal(0, decision.Ordinal)
+	suite.False(decision.RequiresTranscode())
+
+	decision, err = playback.DecideSubtitles(suite.tracks, playback.SubtitleRequest{StreamIndex: &index, Burn: true}, suite.text)
+	suite.Require().NoError(err)
+	suite.Equal(playback.SubtitleBurn, decision.Delivery)
+	suite.True(decision.RequiresTranscode())
+}
+
+func (suite *SubtitlesTestSuite) TestDecide_BurnsSubtitlesTheClientCannotRender() {
+	index := 5
+	decision, err := playback.DecideSubtitles(suite.tracks, playback.SubtitleRequest{StreamIndex: &index}, suite.text)
+	suite.Require().NoError(err)
+	suite.Equal(playback.SubtitleBurn, decision.Delivery)
+	suite.Equal(2, decision.Ordinal)
+}
+
+func (suite *SubtitlesTestSuite) TestDecide_UnknownTrack() {
+	index := 9
+	_, err := playback.DecideSubtitles(suite.tracks, playback.SubtitleRequest{StreamIndex: &index}, suite.text)
+	suite.True(errors.IsBadRequest(err))
+}
+
+func (suite *SubtitlesTestSuite) TestDecide_ForcedSubtitles() {
+	// ISO 639-1 preferences match ISO 639-2 track languages
+	decision, err := playback.DecideSubtitles(suite.tracks, playback.SubtitleRequest{Language: "en", AudioLanguage: "fr"}, suite.text)
+	suite.Require().NoError(err)
+	suite.Equal(4, decision.Track.Index)
+	suite.True(decision.Forced)
+	suite.Equal(playback.SubtitleExternal, decision.Delivery)
+
+	// Falls back to the audio language, burning in what the client cannot render
+	decision, err = playback.DecideSubtitles(suite.tracks, playback.SubtitleRequest{Language: "de", AudioLanguage: "fr"}, suite.text)
+	suite.Require().NoError(err)
+	suite.Equal(6, decision.Track.Index)
+	suite.Equal(playback.SubtitleBurn, decision.Delivery)
+
+	decision, err = playback.DecideSubtitles(suite.tracks, playback.SubtitleRequest{Language: "de", AudioLanguage: "de"}, suite.text)
+	suite.Require().NoError(err)
+	suite.Nil(decision.Track)
+	suite.Equal(playback.SubtitleNone, decision.Delivery)
+}
+
+func (suite *SubtitlesTestSuite) TestBurnInFilter() {
+	index := 3
+	decision, err := playback.DecideSubtitles(suite.tracks, playback.SubtitleRequest{StreamIndex: &index, Burn: true}, suite.text)
+	suite.Require().NoError(err)
+	filter, err := playback.BurnInFilter("/media/It's: a [test].mkv", decision)
+	suite.Require().NoError(err)
+	suite.Equal(`[0:v:0]subtitles=filename=/media/It\\\'s\\: a \[test\].mkv:si=0[v]`, filter)
+
+	index = 5
+	decision, err = playback.DecideSubtitles(suite.tracks, playback.SubtitleRequest{StreamIndex: &index}, suite.text)
+	suite.Require().NoError(err)
+	filter, err = playback.BurnInFilter("/media/movie.mkv", decision)
+	suite.Require().NoError(err)
+	suite.Equal("[0:v:0][0:s:2]overlay=eof_action=pass[v]", filter)
+}
+
+func TestSubtitlesTestSuite(t *testing.T) {
+	suite.Run(t, new(SubtitlesTestSuite))
+}
@@ -0,0 +1,491 @@
+// Package segmentcache caches stream segments in front of a slower origin,
+// such as transcoder output in S3. Segments are kept in a memory tier and an
+// optional disk tier, each bounded by size and evicted least recently used
+// first, and the segments following a requested one are fetched ahead of
+// the player.
+package segmentcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// ErrSegmentNotFound is returned by an Origin for segments that do not
+// exist, such as those past the end of a stream.
+var ErrSegmentNotFound = errors.New("segment not found")
+
+// prewarmWorkers bounds the number of concurrent background fetches.
+const prewarmWorkers = 4
+
+// segmentExt is the extension of segment files in the disk tier.
+const segmentExt = ".seg"
+
+// tempPrefix starts the names of segment files still being written.
+const tempPrefix = ".segment-"
+
+// Key identifies a segment of a stream.
+type Key struct {
+	StreamID string
+	Profile  string
+	Index    int
+}
+
+// String returns the key as a relative path.
+func (k Key) String() string {
+	return fmt.Sprintf("%s/%s/%d%s", k.StreamID, k.Profile, k.Index, segmentExt)
+}
+
+func (k Key) validate() error {
+	for _, part := range []string{k.StreamID, k.Profile} {
+		if part == "" || part == "." || part == ".." || strings.ContainsAny(part, `/\`) {
+			return fmt.Errorf("invalid segment key %q", k.String())
+		}
+	}
+	if k.Index < 0 {
+		return fmt.Errorf("invalid segment index %d", k.Index)
+	}
+	return nil
+}
+
+// Origin is where segments are fetched from on a cache miss.
+type Origin interface {
+	FetchSegment(ctx context.Context, key Key) ([]byte, error)
+}
+
+// Config configures a Cache.
+type Config struct {
+	// MemoryBytes bounds the memory tier. Zero disables it.
+	MemoryBytes int64
+	// DiskPath is the directory of the disk tier. Empty disables it.
+	DiskPath string
+	// DiskBytes bounds the disk tier.
+	DiskBytes int64
+	// TTL is how long a segment is served from the cache.
+	TTL time.Duration
+	// Prewarm is the number of segments fetched ahead of each request.
+	Prewarm int
+}
+
+// Stats are the counters of a Cache.
+type Stats struct {
+	MemoryHits  uint64
+	DiskHits    uint64
+	Misses      uint64
+	Evictions   uint64
+	Prewarmed   uint64
+	MemoryBytes int64
+	DiskBytes   int64
+}
+
+// HitRate returns the fraction of requests served from either tier.
+func (s Stats) HitRate() float64 {
+	hits := s.MemoryHits + s.DiskHits
+	if hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+s.Misses)
+}
+
+// fetch is an origin fetch shared by every request for the segment.
+type fetch struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// Cache is a two tier segment cache. It is safe for concurrent use.
+type Cache struct {
+	origin Origin
+	config Config
+	logger interfaces.Logger
+	now    func() time.Time
+
+	mu       sync.Mutex
+	memory   *lru
+	disk     *lru
+	inflight map[string]*fetch
+
+	memoryHits atomic.Uint64
+	diskHits   atomic.Uint64
+	misses     atomic.Uint64
+	evictions  atomic.Uint64
+	prewarmed  atomic.Uint64
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers chan struct{}
+	wg      sync.WaitGroup
+}
+
+// New creates a cache in front of origin. Segments already in the disk
+// tier are indexed, so they survive restarts.
+func New(origin Origin, config Config, logger interfaces.Logger) (*Cache, error) {
+	if config.TTL <= 0 {
+		return nil, errors.New("segment cache TTL must be positive")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Cache{
+		origin:   origin,
+		config:   config,
+		logger:   logger,
+		now:      time.Now,
+		memory:   newLRU(config.MemoryBytes),
+		inflight: make(map[string]*fetch),
+		ctx:      ctx,
+		cancel:   cancel,
+		workers:  make(chan struct{}, prewarmWorkers),
+	}
+
+	if config.DiskPath != "" {
+		c.disk = newLRU(config.DiskBytes)
+		if err := c.loadDisk(); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Get returns a segment, from the cache if possible, and fetches the
+// segments that follow it in the background. The returned slice is shared
+// and must not be modified.
+func (c *Cache) Get(ctx context.Context, key Key) ([]byte, error) {
+	if err := key.validate(); err != nil {
+		return nil, err
+	}
+
+	data, err := c.get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	c.prewarm(key)
+	return data, nil
+}
+
+// Stats returns a snapshot of the cache's counters.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	memoryBytes := c.memory.bytes
+	var diskBytes int64
+	if c.disk != nil {
+		diskBytes = c.disk.bytes
+	}
+	c.mu.Unlock()
+
+	return Stats{
+		MemoryHits:  c.memoryHits.Load(),
+		DiskHits:    c.diskHits.Load(),
+		Misses:      c.misses.Load(),
+		Evictions:   c.evictions.Load(),
+		Prewarmed:   c.prewarmed.Load(),
+		MemoryBytes: memoryBytes,
+		DiskBytes:   diskBytes,
+	}
+}
+
+// Close cancels background fetches and waits for them to finish.
+func (c *Cache) Close() {
+	c.cancel()
+	c.wg.Wait()
+}
+
+func (c *Cache) get(ctx context.Context, key Key) ([]byte, error) {
+	name := key.String()
+	now := c.now()
+
+	c.mu.Lock()
+	e, expired := c.memory.get(name, now)
+	if e != nil {
+		c.mu.Unlock()
+		c.memoryHits.Add(1)
+		return e.data, nil
+	}
+	if expired != nil {
+		c.evictions.Add(1)
+	}
+
+	var onDisk bool
+	if c.disk != nil {
+		e, expired := c.disk.get(name, now)
+		if expired != nil {
+			c.evictions.Add(1)
+			c.removeFile(expired.key)
+		}
+		onDisk = e != nil
+	}
+	c.mu.Unlock()
+
+	if onDisk {
+		data, err := os.ReadFile(c.diskPath(name))
+		if err == nil {
+			c.diskHits.Add(1)
+			c.storeMemory(name, data, now)
+			return data, nil
+		}
+		c.logger.Warn("Dropping unreadable cached segment",
+			interfaces.String("segment", name),
+			interfaces.Error(err))
+		c.mu.Lock()
+		c.disk.remove(name)
+		c.mu.Unlock()
+	}
+
+	c.misses.Add(1)
+	return c.fetch(ctx, key)
+}
+
+// fetch fetches a segment from the origin and stores it in both tiers.
+// Concurrent fetches of a segment share one origin request.
+func (c *Cache) fetch(ctx context.Context, key Key) ([]byte, error) {
+	name := key.String()
+
+	c.mu.Lock()
+	if f, ok := c.inflight[name]; ok {
+		c.mu.Unlock()
+		select {
+		case <-f.done:
+			return f.data, f.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	f := &fetch{done: make(chan struct{})}
+	c.inflight[name] = f
+	c.mu.Unlock()
+
+	f.data, f.err = c.origin.FetchSegment(ctx, key)
+	if f.err == nil {
+		now := c.now()
+		c.storeMemory(name, f.data, now)
+		c.storeDisk(name, f.data, now)
+	}
+
+	c.mu.Lock()
+	delete(c.inflight, name)
+	c.mu.Unlock()
+	close(f.done)
+
+	return f.data, f.err
+}
+
+// prewarm fetches the segments following key that are not cached yet.
+// When every worker is busy the remaining segments are left to later
+// requests, so prewarming never queues up behind a slow origin.
+func (c *Cache) prewarm(key Key) {
+	for i := 1; i <= c.config.Prewarm; i++ {
+		next := key
+		next.Index += i
+		if c.cached(next.String()) {
+			continue
+		}
+
+		select {
+		case c.workers <- struct{}{}:
+		default:
+			return
+		}
+
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			defer func() { <-c.workers }()
+
+			if c.ctx.Err() != nil {
+				return
+			}
+			_, err := c.fetch(c.ctx, next)
+			switch {
+			case err == nil:
+				c.prewarmed.Add(1)
+			case errors.Is(err, ErrSegmentNotFound), errors.Is(err, context.Canceled):
+			default:
+				c.logger.Debug("Failed to prewarm segment",
+					interfaces.String("segment", next.String()),
+					interfaces.Error(err))
+			}
+		}()
+	}
+}
+
+// cached reports whether a segment is in either tier or being fetched.
+func (c *Cache) cached(name string) bool {
+	now := c.now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.inflight[name]; ok {
+		return true
+	}
+	if c.memory.contains(name, now) {
+		return true
+	}
+	return c.disk != nil && c.disk.contains(name, now)
+}
+
+func (c *Cache) storeMemory(name string, data []byte, now time.Time) {
+	c.mu.Lock()
+	evicted := c.memory.add(&entry{
+		key:     name,
+		size:    int64(len(data)),
+		expires: now.Add(c.config.TTL),
+		data:    data,
+	})
+	c.mu.Unlock()
+
+	c.evictions.Add(uint64(len(evicted)))
+}
+
+func (c *Cache) storeDisk(name string, data []byte, now time.Time) {
+	if c.disk == nil || int64(len(data)) > c.config.DiskBytes {
+		return
+	}
+
+	if err := writeFile(c.diskPath(name), data); err != nil {
+		c.logger.Warn("Failed to cache segment on disk",
+			interfaces.String("segment", name),
+			interfaces.Error(err))
+		return
+	}
+
+	c.mu.Lock()
+	evicted := c.disk.add(&entry{
+		key:     name,
+		size:    int64(len(data)),
+		expires: now.Add(c.config.TTL),
+	})
+	for _, e := range evicted {
+		c.removeFile(e.key)
+	}
+	c.mu.Unlock()
+
+	c.evictions.Add(uint64(len(evicted)))
+}
+
+// loadDisk indexes the segments in the disk tier, least recently written
+// first, and removes expired ones and partial writes of a previous process.
+func (c *Cache) loadDisk() error {
+	if err := os.MkdirAll(c.config.DiskPath, 0o755); err != nil {
+		return fmt.Errorf("failed to create segment cache directory: %w", err)
+	}
+
+	var entries []*entry
+	partial := 0
+	now := c.now()
+	err := filepath.WalkDir(c.config.DiskPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasPrefix(d.Name(), tempPrefix) {
+			if err := os.Remove(path); err == nil {
+				partial++
+			}
+			return nil
+		}
+		if d.IsDir() || filepath.Ext(path) != segmentExt {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(c.config.DiskPath, path)
+		if err != nil {
+			return err
+		}
+		if !validName(filepath.ToSlash(rel)) {
+			return nil
+		}
+
+		expires := info.ModTime().Add(c.config.TTL)
+		if !now.Before(expires) {
+			_ = os.Remove(path)
+			return nil
+		}
+		entries = append(entries, &entry{key: filepath.ToSlash(rel), size: info.Size(), expires: expires})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to index segment cache: %w", err)
+	}
+	if partial > 0 {
+		c.logger.Warn("Removed partially written segments",
+			interfaces.String("path", c.config.DiskPath),
+			interfaces.Int("count", partial))
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].expires.Before(entries[j].expires)
+	})
+	for _, e := range entries {
+		if e.size > c.disk.maxBytes {
+			c.removeFile(e.key)
+			continue
+		}
+		for _, evicted := range c.disk.add(e) {
+			c.removeFile(evicted.key)
+		}
+	}
+	return nil
+}
+
+// removeFile deletes a segment from the disk tier.
+func (c *Cache) removeFile(name string) {
+	if err := os.Remove(c.diskPath(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		c.logger.Warn("Failed to remove cached segment",
+			interfaces.String("segment", name),
+			interfaces.Error(err))
+	}
+}
+
+func (c *Cache) diskPath(name string) string {
+	return filepath.Join(c.config.DiskPath, filepath.FromSlash(name))
+}
+
+// validName reports whether a file in the disk tier was written by the
+// cache, as stream/profile/index.seg.
+func validName(name string) bool {
+	parts := strings.Split(name, "/")
+	if len(parts) != 3 {
+		return false
+	}
+	_, err := strconv.Atoi(strings.TrimSuffix(parts[2], segmentExt))
+	return err == nil
+}
+
+// writeFile writes a file atomically, so readers never see a partial
+// segment.
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), tempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,208 @@
+package segmentcache_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/narwhalmedia/narwhal/internal/streaming/segmentcache"
+	"github.com/narwhalmedia/narwhal/pkg/logger"
+)
+
+// memoryOrigin serves segments of a fixed size and counts fetches.
+type memoryOrigin struct {
+	mu       sync.Mutex
+	segments int
+	size     int
+	fetches  map[segmentcache.Key]int
+}
+
+func (o *memoryOrigin) FetchSegment(_ context.Context, key segmentcache.Key) ([]byte, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if key.Index >= o.segments {
+		return nil, segmentcache.ErrSegmentNotFound
+	}
+	o.fetches[key]++
+	data := make([]byte, o.size)
+	copy(data, fmt.Sprintf("segment %d", key.Index))
+	return data, nil
+}
+
+func (o *memoryOrigin) count(key segmentcache.Key) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.fetches[key]
+}
+
+type CacheTestSuite struct {
+	suite.Suite
+
+	ctx    context.Context
+	origin *memoryOrigin
+}
+
+func (suite *CacheTestSuite) SetupTest() {
+	suite.ctx = context.Background()
+	suite.origin = &memoryOrigin{segments: 10, size: 100, fetches: make(map[segmentcache.Key]int)}
+}
+
+func (suite *CacheTestSuite) newCache(config segmentcache.Config) *segmentcache.Cache {
+	if config.TTL == 0 {
+		config.TTL = time.Hour
+	}
+	cache, err := segmentcache.New(suite.origin, config, logger.NewNoopLogger())
+	suite.Require().NoError(err)
+	suite.T().Cleanup(cache.Close)
+	return cache
+}
+
+func key(index int) segmentcache.Key {
+	return segmentcache.Key{StreamID: "stream", Profile: "720p", Index: index}
+}
+
+func (suite *CacheTestSuite) TestGet_ServesFromMemory() {
+	cache := suite.newCache(segmentcache.Config{MemoryBytes: 1000})
+
+	first, err := cache.Get(suite.ctx, key(0))
+	suite.Require().NoError(err)
+	second, err := cache.Get(suite.ctx, key(0))
+	suite.Require().NoError(err)
+
+	suite.Equal(first, second)
+	suite.Equal(1, suite.origin.count(key(0)))
+	stats := cache.Stats()
+	suite.Equal(uint64(1), stats.MemoryHits)
+	suite.Equal(uint64(1), stats.Misses)
+	suite.InDelta(0.5, stats.HitRate(), 0.001)
+}
+
+func (suite *CacheTestSuite) TestGet_EvictsLeastRecentlyUsed() {
+	cache := suite.newCache(segmentcache.Config{MemoryBytes: 200})
+
+	for _, index := range []int{0, 1, 0, 2} {
+		_, err := cache.Get(suite.ctx, key(index))
+		suite.Require().NoError(err)
+	}
+
+	// Segment 1 was evicted to make room for 2, segment 0 was kept
+	_, err := cache.Get(suite.ctx, key(0))
+	suite.Require().NoError(err)
+	_, err = cache.Get(suite.ctx, key(1))
+	suite.Require().NoError(err)
+
+	suite.Equal(1, suite.origin.count(key(0)))
+	suite.Equal(2, suite.origin.count(key(1)))
+	suite.Equal(int64(200), cache.Stats().MemoryBytes)
+}
+
+func (suite *CacheTestSuite) TestGet_ExpiresSegments() {
+	cache := suite.newCache(segmentcache.Config{MemoryBytes: 1000, TTL: 50 * time.Millisecond})
+
+	_, err := cache.Get(suite.ctx, key(0))
+	suite.Require().NoError(err)
+	time.Sleep(60 * time.Millisecond)
+	_, err = cache.Get(suite.ctx, key(0))
+	suite.Require().NoError(err)
+
+	suite.Equal(2, suite.origin.count(key(0)))
+}
+
+func (suite *CacheTestSuite) TestGet_DiskTierSurvivesRestart() {
+	config := segmentcache.Config{MemoryBytes: 1000, DiskPath: suite.T().TempDir(), DiskBytes: 1000}
+
+	cache := suite.newCache(config)
+	_, err := cache.Get(suite.ctx, key(0))
+	suite.Require().NoError(err)
+	cache.Close()
+
+	restarted := suite.newCache(config)
+	data, err := restarted.Get(suite.ctx, key(0))
+	suite.Require().NoError(err)
+
+	suite.Len(data, 100)
+	suite.Equal(1, suite.origin.count(key(0)))
+	suite.Equal(uint64(1), restarted.Stats().DiskHits)
+	suite.Equal(int64(100), restarted.Stats().DiskBytes)
+}
+
+func (suite *CacheTestSuite) TestNew_RemovesPartialWrites() {
+	dir := suite.T().TempDir()
+	partial := filepath.Join(dir, "stream", ".segment-123")
+	suite.Require().NoError(os.MkdirAll(filepath.Dir(partial), 0o755))
+	suite.Require().NoError(os.WriteFile(partial, []byte("half a segm"), 0o644))
+
+	suite.newCache(segmentcache.Config{MemoryBytes: 1000, DiskPath: dir, DiskBytes: 1000})
+
+	suite.NoFileExists(partial)
+}
+
+func (suite *CacheTestSuite) TestGet_PrewarmsFollowingSegments() {
+	cache := suite.newCache(segmentcache.Config{MemoryBytes: 2000, Prewarm: 3})
+
+	_, err := cache.Get(suite.ctx, key(8))
+	suite.Require().NoError(err)
+	suite.Eventually(func() bool {
+		return cache.Stats().Prewarmed == 1
+	}, time.Second, 5*time.Millisecond)
+
+	// Segment 9 was fetched ahead; 10 and 11 are past the end
+	_, err = cache.Get(suite.ctx, key(9))
+	suite.Require().NoError(err)
+	suite.Equal(1, suite.origin.count(key(9)))
+	suite.Equal(uint64(1), cache.Stats().MemoryHits)
+}
+
+func (suite *CacheTestSuite) TestGet_RejectsInvalidKeys() {
+	cache := suite.newCache(segmentcache.Config{MemoryBytes: 1000})
+
+	_, err := cache.Get(suite.ctx, segmentcache.Key{StreamID: "..", Profile: "720p"})
+	suite.Error(err)
+	_, err = cache.Get(suite.ctx, segmentcache.Key{StreamID: "stream", Profile: "a/b"})
+	suite.Error(err)
+}
+
+func TestCacheTestSuite(t *testing.T) {
+	suite.Run(t, new(CacheTestSuite))
+}
+
+func BenchmarkGet(b *testing.B) {
+	origin := &memoryOrigin{segments: 1000, size: 512 << 10, fetches: make(map[segmentcache.Key]int)}
+	for _, tier := range []struct {
+		name   string
+		config segmentcache.Config
+	}{
+		{"memory", segmentcache.Config{MemoryBytes: 1 << 30, TTL: time.Hour}},
+		{"disk", segmentcache.Config{DiskPath: b.TempDir(), DiskBytes: 1 << 30, TTL: time.Hour}},
+	} {
+		b.Run(tier.name, func(b *testing.B) {
+			cache, err := segmentcache.New(origin, tier.config, logger.NewNoopLogger())
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer cache.Close()
+
+			// Sessions watching the first segments of a popular stream
+			ctx := context.Background()
+			b.SetBytes(int64(origin.size))
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					if _, err := cache.Get(ctx, key(i%100)); err != nil {
+						b.Error(err)
+						return
+					}
+					i++
+				}
+			})
+		})
+	}
+}
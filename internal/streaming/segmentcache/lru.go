@@ -0,0 +1,95 @@
+package segmentcache
+
+import (
+	"container/list"
+	"time"
+)
+
+// entry is a cached segment. Memory tier entries hold the segment data;
+// disk tier entries only track the file.
+type entry struct {
+	key     string
+	size    int64
+	expires time.Time
+	data    []byte
+}
+
+// lru is a least-recently-used index bounded by the total size of its
+// entries. It is not safe for concurrent use.
+type lru struct {
+	maxBytes int64
+	bytes    int64
+	order    *list.List // front is most recently used
+	items    map[string]*list.Element
+}
+
+func newLRU(maxBytes int64) *lru {
+	return &lru{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// get returns the entry for key and marks it used. Expired entries are
+// removed and returned as the second result so their storage can be freed.
+func (l *lru) get(key string, now time.Time) (*entry, *entry) {
+	elem, ok := l.items[key]
+	if !ok {
+		return nil, nil
+	}
+
+	e := elem.Value.(*entry)
+	if !now.Before(e.expires) {
+		l.removeElement(elem)
+		return nil, e
+	}
+	l.order.MoveToFront(elem)
+	return e, nil
+}
+
+// contains reports whether an unexpired entry for key exists, without
+// marking it used.
+func (l *lru) contains(key string, now time.Time) bool {
+	elem, ok := l.items[key]
+	return ok && now.Before(elem.Value.(*entry).expires)
+}
+
+// add inserts or replaces an entry and returns the entries evicted to make
+// room for it. Entries larger than the whole cache are not added.
+func (l *lru) add(e *entry) []*entry {
+	if e.size > l.maxBytes {
+		return nil
+	}
+	if elem, ok := l.items[e.key]; ok {
+		l.removeElement(elem)
+	}
+
+	var evicted []*entry
+	for l.bytes+e.size > l.maxBytes {
+		oldest := l.order.Back()
+		evicted = append(evicted, oldest.Value.(*entry))
+		l.removeElement(oldest)
+	}
+
+	l.items[e.key] = l.order.PushFront(e)
+	l.bytes += e.size
+	return evicted
+}
+
+// remove deletes the entry for key and returns it, if present.
+func (l *lru) remove(key string) *entry {
+	elem, ok := l.items[key]
+	if !ok {
+		return nil
+	}
+	l.removeElement(elem)
+	return elem.Value.(*entry)
+}
+
+func (l *lru) removeElement(elem *list.Element) {
+	e := elem.Value.(*entry)
+	l.order.Remove(elem)
+	delete(l.items, e.key)
+	l.bytes -= e.size
+}
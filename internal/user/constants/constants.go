@@ -8,4 +8,31 @@ const (
 
 	// Cache constants.
 	CacheTTL = 5 * time.Minute
+
+	// Permission constants.
+	MaxBulkPermissionChecks = 100
+
+	// Invite constants.
+	DefaultInviteTTL = 7 * 24 * time.Hour
+	MaxInviteTTL     = 30 * 24 * time.Hour
+
+	// Registration constants.
+	EmailVerificationTTL   = 48 * time.Hour
+	RegistrationRateWindow = time.Hour
+
+	// Sign-in protection constants.
+	LoginChallengeTTL = 15 * time.Minute
+	LoginHistorySize  = 50
+
+	// Two-factor authentication constants.
+	RecoveryCodeCount = 10
+
+	// API key constants.
+	MaxAPIKeysPerUser = 25
+
+	// Privacy constants.
+	AccountDeletionGracePeriod = 30 * 24 * time.Hour
+	DataExportTimeout          = 15 * time.Minute
+	DataExportTTL              = 7 * 24 * time.Hour
+	MaxExportedAuditEntries    = 1000
 )
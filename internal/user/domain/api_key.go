@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIKeyPrefix starts every API key, so leaked keys are easy to recognize.
+const APIKeyPrefix = "nwk_"
+
+// APIKey lets scripts and integrations call the API as a user without the
+// interactive login flow. Only a hash of the key is stored.
+type APIKey struct {
+	ID       uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	TenantID uuid.UUID `gorm:"type:uuid;not null;default:'00000000-0000-0000-0000-000000000000';index"`
+	UserID   uuid.UUID `gorm:"type:uuid;not null;index"`
+	Name     string    `gorm:"not null"`
+	KeyHash  string    `gorm:"uniqueIndex;not null"`
+	// Hint is the start of the key, to tell keys apart in listings.
+	Hint string `gorm:"not null"`
+	// ExpiresAt is when the key stops working; keys without one work until
+	// they are revoked.
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+// IsActive reports whether the key works at the given time.
+func (k *APIKey) IsActive(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// APIKeyHint returns the hint of a key: its prefix and the first
+// characters after it.
+func APIKeyHint(key string) string {
+	n := len(APIKeyPrefix) + 4
+	if len(key) < n {
+		return key
+	}
+	return key[:n]
+}
@@ -0,0 +1,49 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Kinds of documents users consent to.
+const (
+	ConsentKindTerms   = "terms"
+	ConsentKindPrivacy = "privacy"
+)
+
+// ValidConsentKind reports whether kind is a known document kind.
+func ValidConsentKind(kind string) bool {
+	return kind == ConsentKindTerms || kind == ConsentKindPrivacy
+}
+
+// ConsentDocument is a published version of the terms of service or the
+// privacy policy. The latest version of each kind is the one users must
+// have accepted.
+type ConsentDocument struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	Kind        string    `gorm:"not null;uniqueIndex:idx_consent_documents_kind_version"`
+	Version     string    `gorm:"not null;uniqueIndex:idx_consent_documents_kind_version"`
+	URL         string    `gorm:"not null"`
+	PublishedAt time.Time `gorm:"not null;index"`
+	CreatedAt   time.Time
+}
+
+// Consent records a user accepting a document version.
+type Consent struct {
+	ID         uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	UserID     uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_consents_user_document"`
+	DocumentID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_consents_user_document;index"`
+	AcceptedAt time.Time `gorm:"not null"`
+	IPAddress  string
+}
+
+// ConsentStatus is how many users have accepted a document version.
+type ConsentStatus struct {
+	Document *ConsentDocument
+	Accepted int64
+	Pending  int64
+	// UserAccepted reports whether the user the status was asked for has
+	// accepted the document.
+	UserAccepted bool
+}
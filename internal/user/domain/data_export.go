@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Data export statuses.
+const (
+	DataExportStatusPending = "pending"
+	DataExportStatusReady   = "ready"
+)
+
+// Sections of a data export. Each is a JSON file in the archive.
+const (
+	DataExportSectionProfile      = "profile"
+	DataExportSectionPreferences  = "preferences"
+	DataExportSectionSessions     = "sessions"
+	DataExportSectionSignIns      = "sign_ins"
+	DataExportSectionDevices      = "devices"
+	DataExportSectionConsents     = "consents"
+	DataExportSectionAudit        = "audit"
+	DataExportSectionWatchHistory = "watch_history"
+)
+
+// ExternalDataExportSections are the sections other services contribute to
+// a data export in reply to a user.data_export_requested event.
+var ExternalDataExportSections = []string{DataExportSectionWatchHistory}
+
+// DataExport is an archive of everything stored about a user, assembled
+// once every section has arrived.
+type DataExport struct {
+	ID     uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	UserID uuid.UUID `gorm:"type:uuid;not null;index"`
+	Status string    `gorm:"not null;default:'pending'"`
+	// PendingSections are the external sections not received yet.
+	PendingSections []string `gorm:"type:text[]"`
+	// MissingSections are the sections that had not arrived when the
+	// archive was assembled.
+	MissingSections []string `gorm:"type:text[]"`
+	// Archive is the zip archive, once ready.
+	Archive     []byte `gorm:"type:bytea"`
+	CreatedAt   time.Time
+	CompletedAt *time.Time
+	ExpiresAt   time.Time `gorm:"not null;index"`
+}
+
+// IsReady reports whether the archive can be downloaded.
+func (e *DataExport) IsReady() bool {
+	return e.Status == DataExportStatusReady
+}
+
+// DataExportSection is a section of a data export waiting to be archived.
+type DataExportSection struct {
+	ExportID  uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Name      string    `gorm:"primaryKey"`
+	Data      []byte    `gorm:"type:bytea;not null"`
+	CreatedAt time.Time
+}
@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Device is a client installation a user has signed in from. Devices outlive
+// individual sessions so their settings survive sign-out and token refresh.
+type Device struct {
+	ID       uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	TenantID uuid.UUID `gorm:"type:uuid;not null;default:'00000000-0000-0000-0000-000000000000';index"`
+	UserID   uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_devices_user_client"`
+	// ClientID is the stable identifier the client generates on install.
+	ClientID   string `gorm:"not null;uniqueIndex:idx_devices_user_client"`
+	Name       string
+	Platform   string
+	AppVersion string
+	LastSeenAt time.Time
+	LastIP     string
+
+	// Per-device settings
+	DefaultQuality string `gorm:"default:'auto'"`
+	AllowDownloads bool   `gorm:"default:true"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// DeviceRegistration is what a client reports about itself when signing in.
+type DeviceRegistration struct {
+	ClientID   string
+	Name       string
+	Platform   string
+	AppVersion string
+	IPAddress  string
+}
+
+// NewDevice creates a device for a user from a registration.
+func NewDevice(userID, tenantID uuid.UUID, reg DeviceRegistration) *Device {
+	d := &Device{
+		ID:             uuid.New(),
+		TenantID:       tenantID,
+		UserID:         userID,
+		ClientID:       reg.ClientID,
+		DefaultQuality: "auto",
+		AllowDownloads: true,
+	}
+	d.Touch(reg)
+	return d
+}
+
+// Touch records that the device was seen with the reported details.
+// The name is only set if the user has not named the device yet.
+func (d *Device) Touch(reg DeviceRegistration) {
+	if d.Name == "" {
+		d.Name = reg.Name
+	}
+	if reg.Platform != "" {
+		d.Platform = reg.Platform
+	}
+	if reg.AppVersion != "" {
+		d.AppVersion = reg.AppVersion
+	}
+	if reg.IPAddress != "" {
+		d.LastIP = reg.IPAddress
+	}
+	d.LastSeenAt = time.Now()
+}
@@ -0,0 +1,66 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Digest frequencies, the values of the digest_frequency preference.
+const (
+	DigestOff    = "off"
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// DigestPeriod returns the period a digest of the given frequency covers,
+// or zero if digests are off.
+func DigestPeriod(frequency string) time.Duration {
+	switch frequency {
+	case DigestDaily:
+		return 24 * time.Hour
+	case DigestWeekly:
+		return 7 * 24 * time.Hour
+	default:
+		return 0
+	}
+}
+
+// DigestDelivery records when the last digest of a user was requested, so
+// the next one covers the time since.
+type DigestDelivery struct {
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	TenantID  uuid.UUID `gorm:"type:uuid;not null;default:'00000000-0000-0000-0000-000000000000';index"`
+	SentAt    time.Time `gorm:"not null"`
+	UpdatedAt time.Time
+}
+
+// Due reports whether the next digest of the given period is due at now.
+func (d *DigestDelivery) Due(period time.Duration, now time.Time) bool {
+	return !now.Before(d.SentAt.Add(period))
+}
+
+// Digest is the content of an email digest, as composed by the library
+// in reply to a user.digest_requested event.
+type Digest struct {
+	Added []struct {
+		Title string `json:"title"`
+		Year  int    `json:"year"`
+	} `json:"added"`
+	Upcoming []struct {
+		Series        string `json:"series"`
+		SeasonNumber  int    `json:"season_number"`
+		EpisodeNumber int    `json:"episode_number"`
+		AirDate       string `json:"air_date"`
+	} `json:"upcoming"`
+	Requests []struct {
+		Title  string `json:"title"`
+		Year   int    `json:"year"`
+		Status string `json:"status"`
+	} `json:"requests"`
+}
+
+// Empty reports whether the digest has nothing to tell.
+func (d *Digest) Empty() bool {
+	return len(d.Added) == 0 && len(d.Upcoming) == 0 && len(d.Requests) == 0
+}
@@ -0,0 +1,22 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+)
+
+func TestDigestDeliveryDue(t *testing.T) {
+	now := time.Now()
+	week := domain.DigestPeriod(domain.DigestWeekly)
+	delivery := &domain.DigestDelivery{SentAt: now.Add(-6 * 24 * time.Hour)}
+
+	assert.Equal(t, 7*24*time.Hour, week)
+	assert.Zero(t, domain.DigestPeriod(domain.DigestOff))
+	assert.False(t, delivery.Due(week, now))
+	assert.True(t, delivery.Due(domain.DigestPeriod(domain.DigestDaily), now))
+	assert.True(t, delivery.Due(week, now.Add(24*time.Hour)))
+}
@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"hash/fnv"
+	"regexp"
+	"slices"
+	"time"
+)
+
+// Feature flag keys used by the services.
+const (
+	FlagJITTranscoding = "jit_transcoding"
+	FlagSearchEngineV2 = "search_engine_v2"
+)
+
+// Reasons a feature flag evaluated the way it did.
+const (
+	FlagReasonDisabled = "disabled"
+	FlagReasonUser     = "user"
+	FlagReasonRollout  = "rollout"
+	FlagReasonDefault  = "default"
+	FlagReasonUnknown  = "unknown"
+)
+
+var featureFlagKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_.]{1,63}$`)
+
+// FeatureFlag gates a feature so it can be rolled out gradually. A flag is
+// on for the users it lists and for a stable percentage of everyone else.
+type FeatureFlag struct {
+	Key         string `gorm:"primaryKey"`
+	Description string
+	// Enabled switches the flag off for everyone when false.
+	Enabled bool `gorm:"not null;default:false"`
+	// Percentage of users the flag is on for, 0 to 100.
+	Percentage int      `gorm:"not null;default:0"`
+	UserIDs    []string `gorm:"type:text[]"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// ValidFeatureFlagKey reports whether key is a valid flag key: lowercase
+// letters, digits, dots and underscores, starting with a letter.
+func ValidFeatureFlagKey(key string) bool {
+	return featureFlagKeyPattern.MatchString(key)
+}
+
+// Evaluate reports whether the flag is on for the user and why. Users are
+// bucketed by a hash of the flag key and user ID, so raising the percentage
+// only ever adds users and each flag rolls out to a different set of them.
+func (f *FeatureFlag) Evaluate(userID string) (bool, string) {
+	if !f.Enabled {
+		return false, FlagReasonDisabled
+	}
+	if userID != "" && slices.Contains(f.UserIDs, userID) {
+		return true, FlagReasonUser
+	}
+	if f.Percentage >= 100 {
+		return true, FlagReasonRollout
+	}
+	if f.Percentage > 0 && userID != "" && f.bucket(userID) < f.Percentage {
+		return true, FlagReasonRollout
+	}
+	return false, FlagReasonDefault
+}
+
+func (f *FeatureFlag) bucket(userID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(f.Key + ":" + userID))
+	return int(h.Sum32() % 100)
+}
@@ -0,0 +1,66 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+)
+
+func TestFeatureFlag_Evaluate(t *testing.T) {
+	listed := uuid.NewString()
+	flag := &domain.FeatureFlag{
+		Key:     domain.FlagJITTranscoding,
+		UserIDs: []string{listed},
+	}
+
+	on, reason := flag.Evaluate(listed)
+	assert.False(t, on)
+	assert.Equal(t, domain.FlagReasonDisabled, reason)
+
+	flag.Enabled = true
+	on, reason = flag.Evaluate(listed)
+	assert.True(t, on)
+	assert.Equal(t, domain.FlagReasonUser, reason)
+
+	on, reason = flag.Evaluate(uuid.NewString())
+	assert.False(t, on)
+	assert.Equal(t, domain.FlagReasonDefault, reason)
+
+	flag.Percentage = 100
+	on, reason = flag.Evaluate("")
+	assert.True(t, on)
+	assert.Equal(t, domain.FlagReasonRollout, reason)
+}
+
+func TestFeatureFlag_EvaluateRollout(t *testing.T) {
+	flag := &domain.FeatureFlag{Key: domain.FlagSearchEngineV2, Enabled: true, Percentage: 25}
+
+	users := make([]string, 2000)
+	enabled := make(map[string]bool)
+	for i := range users {
+		users[i] = uuid.NewString()
+		if on, _ := flag.Evaluate(users[i]); on {
+			enabled[users[i]] = true
+		}
+	}
+	assert.InDelta(t, 500, len(enabled), 100)
+
+	// Evaluation is stable, and raising the percentage keeps everyone who
+	// already had the feature
+	flag.Percentage = 50
+	for user := range enabled {
+		on, _ := flag.Evaluate(user)
+		assert.True(t, on)
+	}
+}
+
+func TestValidFeatureFlagKey(t *testing.T) {
+	assert.True(t, domain.ValidFeatureFlagKey("jit_transcoding"))
+	assert.True(t, domain.ValidFeatureFlagKey("search.v2"))
+	assert.False(t, domain.ValidFeatureFlagKey("Search"))
+	assert.False(t, domain.ValidFeatureFlagKey("x"))
+	assert.False(t, domain.ValidFeatureFlagKey("1st"))
+}
@@ -0,0 +1,81 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserIdentity links a user to their account at an external identity
+// provider, which identifies the account by its subject.
+type UserIdentity struct {
+	ID       uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	TenantID uuid.UUID `gorm:"type:uuid;not null;default:'00000000-0000-0000-0000-000000000000';index"`
+	UserID   uuid.UUID `gorm:"type:uuid;not null;index"`
+	Provider string    `gorm:"not null;uniqueIndex:idx_user_identities_subject"`
+	Subject  string    `gorm:"not null;uniqueIndex:idx_user_identities_subject"`
+	// Email is the email the provider asserted when the identity was
+	// linked.
+	Email     string
+	CreatedAt time.Time
+}
+
+// RoleMapping maps the groups or roles an identity provider asserts in a
+// claim of its ID tokens to roles.
+type RoleMapping struct {
+	// Claim is the claim holding the groups or roles, such as "groups".
+	// With a claim, the roles of users are synced on every login; without
+	// one, they are left to admins once the user exists.
+	Claim string
+	// Roles maps claim values to role names.
+	Roles map[string]string
+	// Default is the role of users no claim value maps to a role. Without
+	// a default, those users cannot log in.
+	Default string
+}
+
+// Map returns the roles of a user with the given claim values, sorted and
+// without duplicates. It returns nil if the user gets no role.
+func (m RoleMapping) Map(values []string) []string {
+	var roles []string
+	for _, value := range values {
+		if role, ok := m.Roles[value]; ok && !slices.Contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	if len(roles) == 0 && m.Default != "" {
+		return []string{m.Default}
+	}
+	slices.Sort(roles)
+	return roles
+}
+
+// usernameInvalid matches the characters left out of usernames derived
+// from identities.
+var usernameInvalid = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// IdentityUsername derives the username of a user provisioned from an
+// identity: the preferred username the provider asserted, else the local
+// part of their email. Accounts asserting neither are named after their
+// subject.
+func IdentityUsername(preferredUsername, email, subject string) string {
+	for _, candidate := range []string{preferredUsername, strings.SplitN(email, "@", 2)[0]} {
+		username := usernameInvalid.ReplaceAllString(strings.ToLower(strings.TrimSpace(candidate)), "")
+		if username != "" {
+			return username
+		}
+	}
+	return "user-" + IdentitySuffix(subject)
+}
+
+// IdentitySuffix returns a short suffix derived from the subject of an
+// identity, to tell apart users whose derived usernames collide.
+func IdentitySuffix(subject string) string {
+	sum := sha256.Sum256([]byte(subject))
+	return hex.EncodeToString(sum[:4])
+}
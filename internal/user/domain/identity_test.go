@@ -0,0 +1,35 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+)
+
+func TestRoleMapping_Map(t *testing.T) {
+	m := domain.RoleMapping{
+		Claim: "groups",
+		Roles: map[string]string{"media-admins": domain.RoleAdmin, "family": domain.RoleUser, "friends": domain.RoleUser},
+	}
+
+	assert.Equal(t, []string{domain.RoleAdmin, domain.RoleUser}, m.Map([]string{"family", "media-admins", "friends"}))
+	assert.Nil(t, m.Map([]string{"accounting"}), "unmapped users get no role without a default")
+
+	m.Default = domain.RoleGuest
+	assert.Equal(t, []string{domain.RoleGuest}, m.Map([]string{"accounting"}))
+	assert.Equal(t, []string{domain.RoleGuest}, m.Map(nil))
+	assert.Equal(t, []string{domain.RoleUser}, m.Map([]string{"family"}))
+}
+
+func TestIdentityUsername(t *testing.T) {
+	assert.Equal(t, "alice.smith", domain.IdentityUsername(" Alice.Smith ", "alice@example.com", "f3a1"))
+	assert.Equal(t, "bob", domain.IdentityUsername("", "Bob@example.com", "f3a1"))
+	assert.Equal(t, "bob", domain.IdentityUsername("ボブ", "bob@example.com", "f3a1"))
+
+	username := domain.IdentityUsername("", "", "f3a1")
+	assert.Equal(t, "user-"+domain.IdentitySuffix("f3a1"), username)
+	assert.Len(t, domain.IdentitySuffix("f3a1"), 8)
+	assert.NotEqual(t, domain.IdentitySuffix("f3a1"), domain.IdentitySuffix("f3a2"))
+}
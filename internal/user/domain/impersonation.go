@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Impersonation records an admin acting as another user. Its ID is carried
+// as the token ID of the impersonation token so requests made with it can be
+// traced back to the grant.
+type Impersonation struct {
+	ID             uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	TenantID       uuid.UUID `gorm:"type:uuid;not null;default:'00000000-0000-0000-0000-000000000000';index"`
+	ImpersonatorID uuid.UUID `gorm:"type:uuid;not null;index"`
+	TargetUserID   uuid.UUID `gorm:"type:uuid;not null;index"`
+	Reason         string    `gorm:"not null"`
+	IPAddress      string
+	ExpiresAt      time.Time `gorm:"not null"`
+	CreatedAt      time.Time
+}
+
+// IsActive reports whether the impersonation token is still valid.
+func (i *Impersonation) IsActive() bool {
+	return time.Now().Before(i.ExpiresAt)
+}
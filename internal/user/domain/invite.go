@@ -0,0 +1,72 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// InviteStatus describes where an invite is in its lifecycle.
+type InviteStatus string
+
+// Invite statuses.
+const (
+	InviteStatusPending  InviteStatus = "pending"
+	InviteStatusRedeemed InviteStatus = "redeemed"
+	InviteStatusRevoked  InviteStatus = "revoked"
+	InviteStatusExpired  InviteStatus = "expired"
+)
+
+// Invite is a single-use token that lets someone create their own account.
+// Only a hash of the token is stored.
+type Invite struct {
+	ID         uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	TenantID   uuid.UUID `gorm:"type:uuid;not null;default:'00000000-0000-0000-0000-000000000000';index"`
+	TokenHash  string    `gorm:"uniqueIndex;not null"`
+	Email      string    `gorm:"index"`
+	Role       string    `gorm:"not null"`
+	LibraryIDs []string  `gorm:"type:text[]"`
+	CreatedBy  uuid.UUID `gorm:"type:uuid;not null"`
+	ExpiresAt  time.Time `gorm:"not null;index"`
+	RedeemedAt *time.Time
+	RedeemedBy *uuid.UUID `gorm:"type:uuid"`
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// LibraryGrant gives a user access to a library.
+type LibraryGrant struct {
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	LibraryID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	TenantID  uuid.UUID `gorm:"type:uuid;not null;default:'00000000-0000-0000-0000-000000000000';index"`
+	GrantedBy uuid.UUID `gorm:"type:uuid"`
+	CreatedAt time.Time
+}
+
+// HashToken returns the stored representation of a single-use token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Status returns the invite's status at the given time.
+func (i *Invite) Status(now time.Time) InviteStatus {
+	switch {
+	case i.RevokedAt != nil:
+		return InviteStatusRevoked
+	case i.RedeemedAt != nil:
+		return InviteStatusRedeemed
+	case now.After(i.ExpiresAt):
+		return InviteStatusExpired
+	default:
+		return InviteStatusPending
+	}
+}
+
+// IsRedeemable checks if the invite can still be used.
+func (i *Invite) IsRedeemable() bool {
+	return i.Status(time.Now()) == InviteStatusPending
+}
@@ -0,0 +1,60 @@
+package domain
+
+import "github.com/google/uuid"
+
+// PermissionCheck is a resource-action pair to check against a user.
+type PermissionCheck struct {
+	Resource string
+	Action   string
+}
+
+// PermissionSnapshot is a flattened view of a user's permissions. It can be
+// cached and checked without walking the user's role tree.
+type PermissionSnapshot struct {
+	UserID      uuid.UUID
+	Roles       []string
+	Permissions []Permission
+
+	// rules holds each role's effective rules. Deny rules only narrow the
+	// role they belong to, matching Role.HasPermission.
+	rules [][]Permission
+}
+
+// NewPermissionSnapshot flattens the user's roles into a snapshot.
+func NewPermissionSnapshot(user *User) *PermissionSnapshot {
+	snapshot := &PermissionSnapshot{
+		UserID:      user.ID,
+		Roles:       make([]string, 0, len(user.Roles)),
+		Permissions: user.GetPermissions(),
+		rules:       make([][]Permission, 0, len(user.Roles)),
+	}
+
+	for i := range user.Roles {
+		snapshot.Roles = append(snapshot.Roles, user.Roles[i].Name)
+		snapshot.rules = append(snapshot.rules, user.Roles[i].EffectivePermissions())
+	}
+
+	return snapshot
+}
+
+// HasPermission checks the snapshot with the same semantics as
+// User.HasPermission.
+func (s *PermissionSnapshot) HasPermission(resource, action string) bool {
+	for _, rules := range s.rules {
+		allowed := false
+		for _, perm := range rules {
+			if !perm.Matches(resource, action) {
+				continue
+			}
+			if perm.IsDeny() {
+				allowed = false
+				break
+			}
+			allowed = true
+		}
+		if allowed {
+			return true
+		}
+	}
+	return false
+}
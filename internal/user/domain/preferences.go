@@ -0,0 +1,200 @@
+package domain
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PreferenceType is the value type of a preference.
+type PreferenceType string
+
+// Preference types.
+const (
+	PreferenceTypeString PreferenceType = "string"
+	PreferenceTypeBool   PreferenceType = "bool"
+	PreferenceTypeInt    PreferenceType = "int"
+	PreferenceTypeEnum   PreferenceType = "enum"
+)
+
+// PreferenceAccess controls who may change a preference.
+type PreferenceAccess string
+
+// Preference access levels.
+const (
+	// PreferenceAccessUser preferences may be changed by the user themselves.
+	PreferenceAccessUser PreferenceAccess = "user"
+	// PreferenceAccessAdmin preferences may only be changed by an admin,
+	// e.g. limits a parent sets on a child's account.
+	PreferenceAccessAdmin PreferenceAccess = "admin"
+)
+
+// Preference keys.
+const (
+	PrefLanguage            = "language"
+	PrefTheme               = "theme"
+	PrefTimeZone            = "time_zone"
+	PrefAutoPlayNext        = "auto_play_next"
+	PrefSubtitleLanguage    = "subtitle_language"
+	PrefAudioLanguage       = "audio_language"
+	PrefPreferredQuality    = "preferred_quality"
+	PrefEnableNotifications = "enable_notifications"
+	PrefItemsPerPage        = "items_per_page"
+	PrefMaxStreamQuality    = "max_stream_quality"
+	PrefMaxContentRating    = "max_content_rating"
+	PrefDigestFrequency     = "digest_frequency"
+)
+
+var qualityOptions = []string{"auto", "480p", "720p", "1080p", "2160p"}
+
+// PreferenceDefinition describes a preference key, its type and default.
+type PreferenceDefinition struct {
+	Key         string
+	Type        PreferenceType
+	Default     string
+	Options     []string // allowed values for enum preferences
+	Min, Max    int      // bounds for int preferences
+	Access      PreferenceAccess
+	Description string
+}
+
+var preferenceSchema = []PreferenceDefinition{
+	{Key: PrefLanguage, Type: PreferenceTypeString, Default: "en", Access: PreferenceAccessUser,
+		Description: "Interface language"},
+	{Key: PrefTheme, Type: PreferenceTypeEnum, Default: "dark", Options: []string{"dark", "light", "system"},
+		Access: PreferenceAccessUser, Description: "Interface theme"},
+	{Key: PrefTimeZone, Type: PreferenceTypeString, Default: "UTC", Access: PreferenceAccessUser,
+		Description: "Time zone used to display dates"},
+	{Key: PrefAutoPlayNext, Type: PreferenceTypeBool, Default: "true", Access: PreferenceAccessUser,
+		Description: "Play the next episode automatically"},
+	{Key: PrefSubtitleLanguage, Type: PreferenceTypeString, Default: "en", Access: PreferenceAccessUser,
+		Description: "Preferred subtitle language"},
+	{Key: PrefAudioLanguage, Type: PreferenceTypeString, Default: "en", Access: PreferenceAccessUser,
+		Description: "Preferred audio language"},
+	{Key: PrefPreferredQuality, Type: PreferenceTypeEnum, Default: "auto", Options: qualityOptions,
+		Access: PreferenceAccessUser, Description: "Default playback quality"},
+	{Key: PrefEnableNotifications, Type: PreferenceTypeBool, Default: "true", Access: PreferenceAccessUser,
+		Description: "Receive notifications"},
+	{Key: PrefItemsPerPage, Type: PreferenceTypeInt, Default: "50", Min: 10, Max: 200,
+		Access: PreferenceAccessUser, Description: "Items shown per page when browsing"},
+	{Key: PrefMaxStreamQuality, Type: PreferenceTypeEnum, Default: "auto", Options: qualityOptions,
+		Access: PreferenceAccessAdmin, Description: "Highest quality the user may stream"},
+	{Key: PrefMaxContentRating, Type: PreferenceTypeEnum, Default: "none",
+		Options: []string{"none", "G", "PG", "PG-13", "R", "NC-17"},
+		Access:  PreferenceAccessAdmin, Description: "Highest content rating the user may see; none for unrestricted"},
+	{Key: PrefDigestFrequency, Type: PreferenceTypeEnum, Default: DigestWeekly,
+		Options: []string{DigestOff, DigestDaily, DigestWeekly},
+		Access:  PreferenceAccessUser, Description: "How often to receive the email digest; off to opt out"},
+}
+
+// PreferenceSchema returns the definitions of all known preferences.
+func PreferenceSchema() []PreferenceDefinition {
+	return slices.Clone(preferenceSchema)
+}
+
+// LookupPreference returns the definition for key.
+func LookupPreference(key string) (PreferenceDefinition, bool) {
+	for _, def := range preferenceSchema {
+		if def.Key == key {
+			return def, true
+		}
+	}
+	return PreferenceDefinition{}, false
+}
+
+// Validate checks that value is acceptable for the preference and returns it
+// in canonical form.
+func (d PreferenceDefinition) Validate(value string) (string, error) {
+	switch d.Type {
+	case PreferenceTypeBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("%s must be true or false", d.Key)
+		}
+		return strconv.FormatBool(b), nil
+	case PreferenceTypeInt:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return "", fmt.Errorf("%s must be an integer", d.Key)
+		}
+		if n < d.Min || n > d.Max {
+			return "", fmt.Errorf("%s must be between %d and %d", d.Key, d.Min, d.Max)
+		}
+		return strconv.Itoa(n), nil
+	case PreferenceTypeEnum:
+		if !slices.Contains(d.Options, value) {
+			return "", fmt.Errorf("%s must be one of %v", d.Key, d.Options)
+		}
+		return value, nil
+	default:
+		if value == "" {
+			return "", fmt.Errorf("%s must not be empty", d.Key)
+		}
+		return value, nil
+	}
+}
+
+// UserPreference is a single stored preference value that overrides the default.
+type UserPreference struct {
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Key       string    `gorm:"primaryKey"`
+	TenantID  uuid.UUID `gorm:"type:uuid;not null;default:'00000000-0000-0000-0000-000000000000';index"`
+	Value     string    `gorm:"not null"`
+	UpdatedAt time.Time
+}
+
+// ResolvePreferences returns the effective value of every preference: the
+// stored value if any, else the legacy column value, else the default.
+func ResolvePreferences(legacy UserPreferences, stored []*UserPreference) map[string]string {
+	values := make(map[string]string, len(preferenceSchema))
+	for _, def := range preferenceSchema {
+		values[def.Key] = def.Default
+	}
+	for key, value := range legacy.values() {
+		if value != "" {
+			values[key] = value
+		}
+	}
+	for _, pref := range stored {
+		if _, ok := LookupPreference(pref.Key); ok {
+			values[pref.Key] = pref.Value
+		}
+	}
+	return values
+}
+
+// Apply mirrors a validated preference into the legacy columns, if it has one.
+func (p *UserPreferences) Apply(key, value string) {
+	switch key {
+	case PrefLanguage:
+		p.Language = value
+	case PrefTheme:
+		p.Theme = value
+	case PrefTimeZone:
+		p.TimeZone = value
+	case PrefAutoPlayNext:
+		p.AutoPlayNext = value == "true"
+	case PrefSubtitleLanguage:
+		p.SubtitleLanguage = value
+	case PrefPreferredQuality:
+		p.PreferredQuality = value
+	case PrefEnableNotifications:
+		p.EnableNotifications = value == "true"
+	}
+}
+
+// values returns the legacy columns keyed by preference key.
+func (p UserPreferences) values() map[string]string {
+	return map[string]string{
+		PrefLanguage:            p.Language,
+		PrefTheme:               p.Theme,
+		PrefTimeZone:            p.TimeZone,
+		PrefAutoPlayNext:        strconv.FormatBool(p.AutoPlayNext),
+		PrefSubtitleLanguage:    p.SubtitleLanguage,
+		PrefPreferredQuality:    p.PreferredQuality,
+		PrefEnableNotifications: strconv.FormatBool(p.EnableNotifications),
+	}
+}
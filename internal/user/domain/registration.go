@@ -0,0 +1,52 @@
+package domain
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EmailVerification is a single-use token proving ownership of a user's email.
+// Only a hash of the token is stored.
+type EmailVerification struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	TenantID  uuid.UUID `gorm:"type:uuid;not null;default:'00000000-0000-0000-0000-000000000000';index"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	TokenHash string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// IsUsable checks if the verification token can still be used.
+func (v *EmailVerification) IsUsable() bool {
+	return v.UsedAt == nil && time.Now().Before(v.ExpiresAt)
+}
+
+// IsDomainBlocked reports whether email belongs to one of the blocked domains
+// or any of their subdomains.
+func IsDomainBlocked(email string, blocked []string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	host := strings.ToLower(strings.TrimSpace(email[at+1:]))
+
+	for _, d := range blocked {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d == "" {
+			continue
+		}
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadyToActivate reports whether a self-registered account has cleared
+// both email verification and admin approval.
+func (u *User) ReadyToActivate() bool {
+	return u.IsVerified && !u.PendingApproval
+}
@@ -0,0 +1,324 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ClientFingerprint is what the user agent of a client tells about the
+// device it runs on.
+type ClientFingerprint struct {
+	Browser  string // or app name, for native clients
+	OS       string
+	Platform string // desktop, mobile, tablet, tv or unknown
+}
+
+// Client platforms.
+const (
+	PlatformDesktop = "desktop"
+	PlatformMobile  = "mobile"
+	PlatformTablet  = "tablet"
+	PlatformTV      = "tv"
+	PlatformUnknown = "unknown"
+)
+
+// userAgentBrowsers are matched in order, as most browsers also claim to
+// be the ones they derive from.
+var userAgentBrowsers = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"Edge", regexp.MustCompile(`\bEdg(?:e|A|iOS)?/`)},
+	{"Opera", regexp.MustCompile(`\bOPR/|\bOpera\b`)},
+	{"Samsung Internet", regexp.MustCompile(`\bSamsungBrowser/`)},
+	{"Firefox", regexp.MustCompile(`\bFirefox/|\bFxiOS/`)},
+	{"Chrome", regexp.MustCompile(`\bChrome/|\bCriOS/`)},
+	{"Safari", regexp.MustCompile(`\bSafari/`)},
+}
+
+var userAgentOSes = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"tvOS", regexp.MustCompile(`\bAppleTV|\btvOS\b`)},
+	{"Android TV", regexp.MustCompile(`\bAndroid\b.*\b(?:TV|AFT\w*|BRAVIA)\b`)},
+	{"webOS", regexp.MustCompile(`\bWeb0S\b|\bwebOS\b`)},
+	{"Tizen", regexp.MustCompile(`\bTizen\b`)},
+	{"iPadOS", regexp.MustCompile(`\biPad\b`)},
+	{"iOS", regexp.MustCompile(`\biPhone\b|\biPod\b|\biOS\b`)},
+	{"Android", regexp.MustCompile(`\bAndroid\b`)},
+	{"Windows", regexp.MustCompile(`\bWindows\b`)},
+	{"ChromeOS", regexp.MustCompile(`\bCrOS\b`)},
+	{"macOS", regexp.MustCompile(`\bMac OS X\b|\bMacintosh\b|\bDarwin\b`)},
+	{"Linux", regexp.MustCompile(`\bLinux\b`)},
+}
+
+// userAgentApp matches the leading "Name/version" product of native
+// clients, such as "Narwhal-Android/2.1".
+var userAgentApp = regexp.MustCompile(`^([A-Za-z][\w.-]*)/[\w.]+`)
+
+// ParseUserAgent derives a fingerprint from a User-Agent header. Parts it
+// cannot recognize are left empty.
+func ParseUserAgent(userAgent string) ClientFingerprint {
+	var f ClientFingerprint
+	for _, b := range userAgentBrowsers {
+		if b.pattern.MatchString(userAgent) {
+			f.Browser = b.name
+			break
+		}
+	}
+	if f.Browser == "" {
+		if m := userAgentApp.FindStringSubmatch(userAgent); m != nil && m[1] != "Mozilla" {
+			f.Browser = m[1]
+		}
+	}
+	for _, os := range userAgentOSes {
+		if os.pattern.MatchString(userAgent) {
+			f.OS = os.name
+			break
+		}
+	}
+
+	switch {
+	case f.OS == "tvOS" || f.OS == "Android TV" || f.OS == "webOS" || f.OS == "Tizen" ||
+		strings.Contains(userAgent, "SmartTV"):
+		f.Platform = PlatformTV
+	case f.OS == "iPadOS" || (f.OS == "Android" && !strings.Contains(userAgent, "Mobile")):
+		f.Platform = PlatformTablet
+	case f.OS == "iOS" || f.OS == "Android":
+		f.Platform = PlatformMobile
+	case f.OS != "":
+		f.Platform = PlatformDesktop
+	default:
+		f.Platform = PlatformUnknown
+	}
+	return f
+}
+
+// Key identifies the kind of device across sign-ins. Browser and OS
+// versions are left out so updates do not make a device new.
+func (f ClientFingerprint) Key() string {
+	return strings.ToLower(f.Browser + "|" + f.OS + "|" + f.Platform)
+}
+
+// GeoLocation is where an IP address is located.
+type GeoLocation struct {
+	Country   string // ISO 3166-1 alpha-2 code
+	Latitude  float64
+	Longitude float64
+}
+
+// GeoLocator locates IP addresses. Addresses it cannot locate, such as
+// private ones, return nil.
+type GeoLocator interface {
+	Locate(ctx context.Context, ip string) (*GeoLocation, error)
+}
+
+// LoginAnomaly is a reason a sign-in looks unlike the user's previous ones.
+type LoginAnomaly string
+
+const (
+	// LoginAnomalyNewDevice is a sign-in from a kind of device the user
+	// never signed in from.
+	LoginAnomalyNewDevice LoginAnomaly = "new_device"
+	// LoginAnomalyNewCountry is a sign-in from a country the user never
+	// signed in from.
+	LoginAnomalyNewCountry LoginAnomaly = "new_country"
+	// LoginAnomalyImpossibleTravel is a sign-in too far from the previous
+	// one to have traveled in between.
+	LoginAnomalyImpossibleTravel LoginAnomaly = "impossible_travel"
+)
+
+// SignIn is a successful sign-in, kept as the history new sign-ins are
+// compared with.
+type SignIn struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	TenantID  uuid.UUID `gorm:"type:uuid;not null;default:'00000000-0000-0000-0000-000000000000';index"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index:idx_sign_ins_user_created"`
+	SessionID uuid.UUID `gorm:"type:uuid"`
+	IPAddress string
+	Browser   string
+	OS        string
+	Platform  string
+	Country   string
+	Latitude  float64
+	Longitude float64
+	Located   bool
+	// Anomalies lists the LoginAnomaly values found, comma separated.
+	Anomalies string
+	CreatedAt time.Time `gorm:"index:idx_sign_ins_user_created"`
+}
+
+// Fingerprint returns the fingerprint of the device signed in from.
+func (s *SignIn) Fingerprint() ClientFingerprint {
+	return ClientFingerprint{Browser: s.Browser, OS: s.OS, Platform: s.Platform}
+}
+
+// SetLocation records where the sign-in came from.
+func (s *SignIn) SetLocation(location *GeoLocation) {
+	if location == nil {
+		return
+	}
+	s.Country = location.Country
+	s.Latitude = location.Latitude
+	s.Longitude = location.Longitude
+	s.Located = true
+}
+
+// MinTravelDistanceKm is the distance under which sign-ins are never
+// impossible travel, as IP geolocation is only accurate to a city or so.
+const MinTravelDistanceKm = 500
+
+// DetectLoginAnomalies compares a sign-in with the previous successful
+// sign-ins of the user, newest first. Travel faster than maxSpeedKmh
+// between the last located sign-in and this one is impossible. The first
+// sign-in of a user has nothing to compare with and is never anomalous.
+func DetectLoginAnomalies(history []*SignIn, attempt *SignIn, maxSpeedKmh float64) []LoginAnomaly {
+	if len(history) == 0 {
+		return nil
+	}
+
+	var anomalies []LoginAnomaly
+	key := attempt.Fingerprint().Key()
+	knownDevice, knownCountry, located := false, false, false
+	for _, previous := range history {
+		if previous.Fingerprint().Key() == key {
+			knownDevice = true
+		}
+		if previous.Located {
+			located = true
+			if previous.Country == attempt.Country {
+				knownCountry = true
+			}
+		}
+	}
+	if !knownDevice {
+		anomalies = append(anomalies, LoginAnomalyNewDevice)
+	}
+	// Countries are only compared once sign-ins have been located
+	if attempt.Located && located && !knownCountry {
+		anomalies = append(anomalies, LoginAnomalyNewCountry)
+	}
+
+	if attempt.Located && maxSpeedKmh > 0 {
+		for _, previous := range history {
+			if !previous.Located {
+				continue
+			}
+			distance := distanceKm(previous.Latitude, previous.Longitude, attempt.Latitude, attempt.Longitude)
+			hours := attempt.CreatedAt.Sub(previous.CreatedAt).Hours()
+			if distance >= MinTravelDistanceKm && (hours <= 0 || distance/hours > maxSpeedKmh) {
+				anomalies = append(anomalies, LoginAnomalyImpossibleTravel)
+			}
+			break
+		}
+	}
+	return anomalies
+}
+
+// FormatLoginAnomalies joins anomalies for storage.
+func FormatLoginAnomalies(anomalies []LoginAnomaly) string {
+	parts := make([]string, len(anomalies))
+	for i, a := range anomalies {
+		parts[i] = string(a)
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseLoginAnomalies splits stored anomalies.
+func ParseLoginAnomalies(s string) []LoginAnomaly {
+	if s == "" {
+		return nil
+	}
+	parts := strings.Split(s, ",")
+	anomalies := make([]LoginAnomaly, len(parts))
+	for i, part := range parts {
+		anomalies[i] = LoginAnomaly(part)
+	}
+	return anomalies
+}
+
+// earthRadiusKm is the mean radius of the Earth.
+const earthRadiusKm = 6371.0
+
+// distanceKm returns the great-circle distance between two points.
+func distanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat, dLon := rad(lat2-lat1), rad(lon2-lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(lat1))*math.Cos(rad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+// LoginChallenge holds a sign-in until the user confirms it: with a
+// one-time code sent to their email if it looked anomalous, or with a code
+// of their authenticator app if they enabled two-factor authentication.
+// Only a hash of emailed codes is stored.
+type LoginChallenge struct {
+	ID       uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	TenantID uuid.UUID `gorm:"type:uuid;not null;default:'00000000-0000-0000-0000-000000000000';index"`
+	UserID   uuid.UUID `gorm:"type:uuid;not null;index"`
+	// Factor is LoginFactorEmail or LoginFactorTOTP.
+	Factor     string `gorm:"not null;default:'email'"`
+	CodeHash   string `gorm:"not null"`
+	DeviceInfo string
+	IPAddress  string
+	UserAgent  string
+	Country    string
+	Latitude   float64
+	Longitude  float64
+	Located    bool
+	Anomalies  string
+	Attempts   int
+	ExpiresAt  time.Time `gorm:"not null;index"`
+	UsedAt     *time.Time
+	CreatedAt  time.Time
+}
+
+// MaxLoginChallengeAttempts is how many wrong codes a challenge takes
+// before it is void.
+const MaxLoginChallengeAttempts = 5
+
+// IsUsable checks if the challenge can still be answered.
+func (c *LoginChallenge) IsUsable() bool {
+	return c.UsedAt == nil && c.Attempts < MaxLoginChallengeAttempts && time.Now().Before(c.ExpiresAt)
+}
+
+// SignIn returns the sign-in the challenge holds.
+func (c *LoginChallenge) SignIn() *SignIn {
+	f := ParseUserAgent(c.UserAgent)
+	return &SignIn{
+		TenantID:  c.TenantID,
+		UserID:    c.UserID,
+		IPAddress: c.IPAddress,
+		Browser:   f.Browser,
+		OS:        f.OS,
+		Platform:  f.Platform,
+		Country:   c.Country,
+		Latitude:  c.Latitude,
+		Longitude: c.Longitude,
+		Located:   c.Located,
+		Anomalies: c.Anomalies,
+	}
+}
+
+// LoginVerificationRequiredError is returned by logins that must be
+// confirmed with a second factor: the code sent to the user if they look
+// anomalous, or a code of their authenticator app.
+type LoginVerificationRequiredError struct {
+	ChallengeID uuid.UUID
+	// Factor is the LoginFactorEmail or LoginFactorTOTP code the login is
+	// confirmed with.
+	Factor    string
+	Anomalies []LoginAnomaly
+}
+
+func (e *LoginVerificationRequiredError) Error() string {
+	return fmt.Sprintf("login verification required: %s", FormatLoginAnomalies(e.Anomalies))
+}
@@ -0,0 +1,98 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      domain.ClientFingerprint
+	}{
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			domain.ClientFingerprint{Browser: "Chrome", OS: "Windows", Platform: domain.PlatformDesktop},
+		},
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.0.0",
+			domain.ClientFingerprint{Browser: "Edge", OS: "Windows", Platform: domain.PlatformDesktop},
+		},
+		{
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Safari/605.1.15",
+			domain.ClientFingerprint{Browser: "Safari", OS: "macOS", Platform: domain.PlatformDesktop},
+		},
+		{
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1",
+			domain.ClientFingerprint{Browser: "Safari", OS: "iOS", Platform: domain.PlatformMobile},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			domain.ClientFingerprint{Browser: "Chrome", OS: "Android", Platform: domain.PlatformTablet},
+		},
+		{
+			"Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+			domain.ClientFingerprint{Browser: "Firefox", OS: "Linux", Platform: domain.PlatformDesktop},
+		},
+		{
+			"Narwhal-tvOS/2.1 (AppleTV11,1; tvOS 17.0)",
+			domain.ClientFingerprint{Browser: "Narwhal-tvOS", OS: "tvOS", Platform: domain.PlatformTV},
+		},
+		{
+			"",
+			domain.ClientFingerprint{Platform: domain.PlatformUnknown},
+		},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, domain.ParseUserAgent(tt.userAgent), tt.userAgent)
+	}
+}
+
+func TestDetectLoginAnomalies(t *testing.T) {
+	now := time.Now()
+	paris := &domain.GeoLocation{Country: "FR", Latitude: 48.86, Longitude: 2.35}
+	lyon := &domain.GeoLocation{Country: "FR", Latitude: 45.76, Longitude: 4.84}
+	newYork := &domain.GeoLocation{Country: "US", Latitude: 40.71, Longitude: -74.01}
+
+	signIn := func(browser string, location *domain.GeoLocation, at time.Time) *domain.SignIn {
+		s := &domain.SignIn{Browser: browser, OS: "Windows", Platform: domain.PlatformDesktop, CreatedAt: at}
+		s.SetLocation(location)
+		return s
+	}
+	history := []*domain.SignIn{signIn("Chrome", paris, now.Add(-2*time.Hour))}
+
+	// The first sign-in has nothing to compare with
+	assert.Empty(t, domain.DetectLoginAnomalies(nil, signIn("Chrome", newYork, now), 900))
+
+	assert.Empty(t, domain.DetectLoginAnomalies(history, signIn("Chrome", lyon, now), 900))
+	assert.Equal(t, []domain.LoginAnomaly{domain.LoginAnomalyNewDevice},
+		domain.DetectLoginAnomalies(history, signIn("Firefox", paris, now), 900))
+
+	// Paris to New York is 5,800 km: too far in two hours, not in a day
+	assert.Equal(t, []domain.LoginAnomaly{domain.LoginAnomalyNewCountry, domain.LoginAnomalyImpossibleTravel},
+		domain.DetectLoginAnomalies(history, signIn("Chrome", newYork, now), 900))
+	assert.Equal(t, []domain.LoginAnomaly{domain.LoginAnomalyNewCountry},
+		domain.DetectLoginAnomalies(history, signIn("Chrome", newYork, now.Add(22*time.Hour)), 900))
+
+	// Unlocated sign-ins are only compared by device
+	assert.Empty(t, domain.DetectLoginAnomalies(history, signIn("Chrome", nil, now), 900))
+}
+
+func TestLoginChallenge_IsUsable(t *testing.T) {
+	challenge := &domain.LoginChallenge{ExpiresAt: time.Now().Add(time.Minute)}
+	assert.True(t, challenge.IsUsable())
+
+	challenge.Attempts = domain.MaxLoginChallengeAttempts
+	assert.False(t, challenge.IsUsable())
+
+	now := time.Now()
+	challenge = &domain.LoginChallenge{ExpiresAt: now.Add(time.Minute), UsedAt: &now}
+	assert.False(t, challenge.IsUsable())
+
+	challenge = &domain.LoginChallenge{ExpiresAt: now.Add(-time.Minute)}
+	assert.False(t, challenge.IsUsable())
+}
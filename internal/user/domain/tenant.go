@@ -0,0 +1,21 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/pkg/tenant"
+)
+
+// Tenant represents an isolated household or customer space.
+type Tenant struct {
+	ID        uuid.UUID       `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	Name      string          `gorm:"not null"`
+	Slug      string          `gorm:"uniqueIndex;not null"`
+	IsActive  bool            `gorm:"default:true"`
+	Quotas    tenant.Quotas   `gorm:"embedded;embeddedPrefix:quota_"`
+	Settings  tenant.Settings `gorm:"embedded;embeddedPrefix:setting_"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
@@ -0,0 +1,40 @@
+package domain
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Factors login challenges are answered with.
+const (
+	// LoginFactorEmail challenges are answered with a code emailed to the
+	// user.
+	LoginFactorEmail = "email"
+	// LoginFactorTOTP challenges are answered with a code of the
+	// authenticator app of the user, or one of their recovery codes.
+	LoginFactorTOTP = "totp"
+)
+
+// RecoveryCode lets a user who lost their authenticator app log in, once.
+// Only a hash of the code is stored.
+type RecoveryCode struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	TenantID  uuid.UUID `gorm:"type:uuid;not null;default:'00000000-0000-0000-0000-000000000000';index"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	CodeHash  string    `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// NormalizeRecoveryCode returns a recovery code as it is hashed, so codes
+// are accepted however they are cased and grouped.
+func NormalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(code)))
+}
@@ -10,16 +10,34 @@ import (
 // User represents a user in the system.
 type User struct {
 	ID           uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	TenantID     uuid.UUID `gorm:"type:uuid;not null;default:'00000000-0000-0000-0000-000000000000';index"`
 	Username     string    `gorm:"uniqueIndex;not null"`
 	Email        string    `gorm:"uniqueIndex;not null"`
 	PasswordHash string    `gorm:"not null"`
 	DisplayName  string
 	Avatar       string
+	AvatarKey    string          // storage key of an uploaded avatar, empty for external URLs
 	Roles        []Role          `gorm:"many2many:user_roles;"`
 	Sessions     []Session       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
 	Preferences  UserPreferences `gorm:"embedded;embeddedPrefix:pref_"`
 	IsActive     bool            `gorm:"default:true"`
 	IsVerified   bool            `gorm:"default:false"`
+	// PendingApproval marks self-registered accounts awaiting an admin.
+	PendingApproval bool `gorm:"default:false;index"`
+	// ConsentRequired marks users who have not accepted the current terms
+	// or privacy policy. It is resolved when tokens are issued.
+	ConsentRequired bool `gorm:"-"`
+	// DeletionScheduledAt is when the account is deleted for good, if the
+	// user asked for it. It can be cancelled until then.
+	DeletionScheduledAt *time.Time `gorm:"index"`
+	// TOTPSecret is the encrypted secret of the authenticator app of the
+	// user, set once they start enrolling one. TOTPEnabledAt is when they
+	// confirmed it, and logins require its codes from then on.
+	TOTPSecret    string
+	TOTPEnabledAt *time.Time
+	// TOTPLastStep is the time step of the last code used, so codes cannot
+	// be used twice.
+	TOTPLastStep int64
 	LastLoginAt  *time.Time
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
@@ -31,15 +49,18 @@ type Role struct {
 	Name        string    `gorm:"uniqueIndex;not null"`
 	Description string
 	Permissions []Permission `gorm:"many2many:role_permissions;"`
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	// Parents are the roles this role inherits permissions and deny rules from.
+	Parents   []Role `gorm:"many2many:role_inheritance;joinForeignKey:RoleID;joinReferences:ParentID"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
 // Permission represents a system permission.
 type Permission struct {
 	ID          uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
-	Resource    string    `gorm:"not null"` // e.g., "library", "media", "user"
-	Action      string    `gorm:"not null"` // e.g., "read", "write", "delete"
+	Resource    string    `gorm:"not null"`                 // e.g., "library", "media", "user"
+	Action      string    `gorm:"not null"`                 // e.g., "read", "write", "delete"
+	Effect      string    `gorm:"not null;default:'allow'"` // allow or deny
 	Description string
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
@@ -47,15 +68,22 @@ type Permission struct {
 
 // Session represents an active user session.
 type Session struct {
-	ID           uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
-	UserID       uuid.UUID `gorm:"not null;index"`
-	RefreshToken string    `gorm:"uniqueIndex;not null"`
+	ID           uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	UserID       uuid.UUID  `gorm:"not null;index"`
+	RefreshToken string     `gorm:"uniqueIndex;not null"`
+	DeviceID     *uuid.UUID `gorm:"type:uuid;index"`
 	DeviceInfo   string
 	IPAddress    string
 	UserAgent    string
-	ExpiresAt    time.Time `gorm:"not null;index"`
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
+	// Browser, OS and Platform are parsed from the user agent, and Country
+	// located from the IP address when a locator is configured.
+	Browser   string
+	OS        string
+	Platform  string
+	Country   string
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
 // UserPreferences represents user-specific preferences.
@@ -85,6 +113,12 @@ func (u *User) CheckPassword(password string) bool {
 	return err == nil
 }
 
+// TOTPEnabled reports whether logins of the user require a code of their
+// authenticator app.
+func (u *User) TOTPEnabled() bool {
+	return u.TOTPEnabledAt != nil
+}
+
 // HasRole checks if the user has a specific role.
 func (u *User) HasRole(roleName string) bool {
 	for _, role := range u.Roles {
@@ -95,24 +129,28 @@ func (u *User) HasRole(roleName string) bool {
 	return false
 }
 
-// HasPermission checks if the user has a specific permission.
+// HasPermission checks if the user has a specific permission through any
+// of their roles.
 func (u *User) HasPermission(resource, action string) bool {
-	for _, role := range u.Roles {
-		for _, perm := range role.Permissions {
-			if perm.Matches(resource, action) {
-				return true
-			}
+	for i := range u.Roles {
+		if u.Roles[i].HasPermission(resource, action) {
+			return true
 		}
 	}
 	return false
 }
 
-// GetPermissions returns all unique permissions for the user.
+// GetPermissions returns all unique permissions the user is granted,
+// including those inherited through role parents. Deny rules are not
+// included.
 func (u *User) GetPermissions() []Permission {
 	permMap := make(map[string]Permission)
 
-	for _, role := range u.Roles {
-		for _, perm := range role.Permissions {
+	for i := range u.Roles {
+		for _, perm := range u.Roles[i].EffectivePermissions() {
+			if perm.IsDeny() || !u.HasPermission(perm.Resource, perm.Action) {
+				continue
+			}
 			key := perm.Resource + ":" + perm.Action
 			if _, exists := permMap[key]; !exists {
 				permMap[key] = perm
@@ -132,6 +170,8 @@ func (u *User) GetPermissions() []Permission {
 const (
 	TokenTypeAccess  = "access"
 	TokenTypeRefresh = "refresh"
+	// TokenTypeAPIKey marks the claims of requests made with an API key.
+	TokenTypeAPIKey = "api_key"
 )
 
 // TokenClaims represents JWT token claims.
@@ -139,6 +179,7 @@ type TokenClaims struct {
 	UserID    string   `json:"user_id"`
 	Username  string   `json:"username"`
 	Email     string   `json:"email"`
+	TenantID  string   `json:"tenant_id,omitempty"`
 	Roles     []string `json:"roles"`
 	TokenType string   `json:"token_type"`
 	SessionID string   `json:"session_id,omitempty"`
@@ -173,12 +214,20 @@ const (
 	ResourceSystem      = "system"
 )
 
+// Permission effects.
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
 // Action types for permissions.
 const (
 	ActionRead   = "read"
 	ActionWrite  = "write"
 	ActionDelete = "delete"
 	ActionAdmin  = "admin"
+	// ActionShare creates links that let guests stream media.
+	ActionShare = "share"
 )
 
 // IsExpired checks if the session has expired.
@@ -186,14 +235,49 @@ func (s *Session) IsExpired() bool {
 	return time.Now().After(s.ExpiresAt)
 }
 
-// HasPermission checks if the role has a specific permission.
+// HasPermission checks if the role has a specific permission. Deny rules
+// take precedence over allow rules anywhere in the role's inheritance chain.
 func (r *Role) HasPermission(resource, action string) bool {
-	for _, perm := range r.Permissions {
-		if perm.Matches(resource, action) {
-			return true
+	allowed := false
+	for _, perm := range r.EffectivePermissions() {
+		if !perm.Matches(resource, action) {
+			continue
 		}
+		if perm.IsDeny() {
+			return false
+		}
+		allowed = true
 	}
-	return false
+	return allowed
+}
+
+// EffectivePermissions returns the role's own rules followed by those of
+// every role it inherits from. Only loaded parents are visited, and each
+// role is visited once so inheritance cycles are harmless.
+func (r *Role) EffectivePermissions() []Permission {
+	var perms []Permission
+	visited := make(map[string]bool)
+
+	queue := []*Role{r}
+	for len(queue) > 0 {
+		role := queue[0]
+		queue = queue[1:]
+		if visited[role.Name] {
+			continue
+		}
+		visited[role.Name] = true
+
+		perms = append(perms, role.Permissions...)
+		for i := range role.Parents {
+			queue = append(queue, &role.Parents[i])
+		}
+	}
+	return perms
+}
+
+// IsDeny reports whether the permission is a deny rule.
+func (p *Permission) IsDeny() bool {
+	return p.Effect == EffectDeny
 }
 
 // Matches checks if the permission matches the given resource and action.
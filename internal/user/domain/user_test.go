@@ -201,6 +201,65 @@ func (suite *UserDomainTestSuite) TestRole_HasPermission() {
 	suite.True(role.HasPermission("media", "anything"))
 }
 
+func (suite *UserDomainTestSuite) TestRole_InheritanceAndDeny() {
+	guest := domain.Role{
+		Name:        domain.RoleGuest,
+		Permissions: []domain.Permission{{Resource: "media", Action: "read"}},
+	}
+	user := domain.Role{
+		Name:        domain.RoleUser,
+		Parents:     []domain.Role{guest},
+		Permissions: []domain.Permission{{Resource: "media", Action: "*"}},
+	}
+	restricted := domain.Role{
+		Name:    "restricted",
+		Parents: []domain.Role{user},
+		Permissions: []domain.Permission{
+			{Resource: "media", Action: "delete", Effect: domain.EffectDeny},
+		},
+	}
+
+	suite.True(user.HasPermission("media", "delete"))
+	suite.True(restricted.HasPermission("media", "read"))
+	suite.True(restricted.HasPermission("media", "write"))
+	suite.False(restricted.HasPermission("media", "delete"))
+	suite.False(guest.HasPermission("media", "write"))
+
+	account := &domain.User{Roles: []domain.Role{restricted}}
+	suite.False(account.HasPermission("media", "delete"))
+	for _, perm := range account.GetPermissions() {
+		suite.False(perm.IsDeny())
+	}
+}
+
+func (suite *UserDomainTestSuite) TestPermissionSnapshot_HasPermission() {
+	restricted := domain.Role{
+		Name: "restricted",
+		Permissions: []domain.Permission{
+			{Resource: "media", Action: "*"},
+			{Resource: "media", Action: "delete", Effect: domain.EffectDeny},
+		},
+	}
+	moderator := domain.Role{
+		Name:        domain.RoleModerator,
+		Permissions: []domain.Permission{{Resource: "media", Action: "delete"}},
+	}
+
+	account := &domain.User{ID: uuid.New(), Roles: []domain.Role{restricted}}
+	snapshot := domain.NewPermissionSnapshot(account)
+	suite.Equal(account.ID, snapshot.UserID)
+	suite.Equal([]string{"restricted"}, snapshot.Roles)
+	suite.True(snapshot.HasPermission("media", "write"))
+	suite.False(snapshot.HasPermission("media", "delete"))
+	suite.False(snapshot.HasPermission("user", "read"))
+
+	// A deny only narrows its own role, as with User.HasPermission
+	account.Roles = append(account.Roles, moderator)
+	snapshot = domain.NewPermissionSnapshot(account)
+	suite.Equal(account.HasPermission("media", "delete"), snapshot.HasPermission("media", "delete"))
+	suite.True(snapshot.HasPermission("media", "delete"))
+}
+
 func (suite *UserDomainTestSuite) TestPermission_Matches() {
 	// Test exact match
 	perm := domain.Permission{Resource: "users", Action: "read"}
@@ -228,6 +287,121 @@ func (suite *UserDomainTestSuite) TestPermission_Matches() {
 	suite.True(allAccess.Matches("anything", "anything"))
 }
 
+func (suite *UserDomainTestSuite) TestInvite_Status() {
+	now := time.Now()
+	invite := &domain.Invite{ExpiresAt: now.Add(time.Hour)}
+	suite.Equal(domain.InviteStatusPending, invite.Status(now))
+	suite.True(invite.IsRedeemable())
+
+	suite.Equal(domain.InviteStatusExpired, invite.Status(now.Add(2*time.Hour)))
+
+	invite.RedeemedAt = &now
+	suite.Equal(domain.InviteStatusRedeemed, invite.Status(now))
+	suite.False(invite.IsRedeemable())
+
+	invite.RevokedAt = &now
+	suite.Equal(domain.InviteStatusRevoked, invite.Status(now))
+}
+
+func (suite *UserDomainTestSuite) TestHashToken() {
+	hash := domain.HashToken("token")
+	suite.Len(hash, 64)
+	suite.Equal(hash, domain.HashToken("token"))
+	suite.NotEqual(hash, domain.HashToken("other"))
+}
+
+func (suite *UserDomainTestSuite) TestEmailVerification_IsUsable() {
+	verification := &domain.EmailVerification{ExpiresAt: time.Now().Add(time.Hour)}
+	suite.True(verification.IsUsable())
+
+	now := time.Now()
+	verification.UsedAt = &now
+	suite.False(verification.IsUsable())
+
+	expired := &domain.EmailVerification{ExpiresAt: time.Now().Add(-time.Minute)}
+	suite.False(expired.IsUsable())
+}
+
+func (suite *UserDomainTestSuite) TestIsDomainBlocked() {
+	blocked := []string{"mailinator.com", "Yopmail.com"}
+
+	suite.True(domain.IsDomainBlocked("someone@mailinator.com", blocked))
+	suite.True(domain.IsDomainBlocked("someone@MAILINATOR.COM", blocked))
+	suite.True(domain.IsDomainBlocked("someone@eu.mailinator.com", blocked))
+	suite.True(domain.IsDomainBlocked("someone@yopmail.com", blocked))
+	suite.False(domain.IsDomainBlocked("someone@notmailinator.com", blocked))
+	suite.False(domain.IsDomainBlocked("someone@example.com", blocked))
+	suite.False(domain.IsDomainBlocked("not-an-email", blocked))
+}
+
+func (suite *UserDomainTestSuite) TestUser_ReadyToActivate() {
+	user := &domain.User{PendingApproval: true}
+	suite.False(user.ReadyToActivate())
+
+	user.IsVerified = true
+	suite.False(user.ReadyToActivate())
+
+	user.PendingApproval = false
+	suite.True(user.ReadyToActivate())
+}
+
+func (suite *UserDomainTestSuite) TestPreferenceDefinition_Validate() {
+	theme, ok := domain.LookupPreference(domain.PrefTheme)
+	suite.Require().True(ok)
+	_, err := theme.Validate("light")
+	suite.NoError(err)
+	_, err = theme.Validate("purple")
+	suite.Error(err)
+
+	autoPlay, _ := domain.LookupPreference(domain.PrefAutoPlayNext)
+	value, err := autoPlay.Validate("1")
+	suite.Require().NoError(err)
+	suite.Equal("true", value)
+
+	perPage, _ := domain.LookupPreference(domain.PrefItemsPerPage)
+	_, err = perPage.Validate("5")
+	suite.Error(err)
+	_, err = perPage.Validate("many")
+	suite.Error(err)
+
+	_, ok = domain.LookupPreference("unknown")
+	suite.False(ok)
+}
+
+func (suite *UserDomainTestSuite) TestResolvePreferences() {
+	legacy := domain.UserPreferences{Language: "fr", Theme: "dark", AutoPlayNext: true}
+	stored := []*domain.UserPreference{
+		{Key: domain.PrefTheme, Value: "light"},
+		{Key: "removed_key", Value: "x"},
+	}
+
+	values := domain.ResolvePreferences(legacy, stored)
+	suite.Equal("fr", values[domain.PrefLanguage])
+	suite.Equal("light", values[domain.PrefTheme])
+	suite.Equal("50", values[domain.PrefItemsPerPage])
+	suite.NotContains(values, "removed_key")
+
+	legacy.Apply(domain.PrefAutoPlayNext, "false")
+	suite.False(legacy.AutoPlayNext)
+}
+
+func (suite *UserDomainTestSuite) TestDevice_Touch() {
+	device := domain.NewDevice(uuid.New(), uuid.Nil, domain.DeviceRegistration{
+		ClientID: "client-1",
+		Name:     "Living Room TV",
+		Platform: "tv",
+	})
+	suite.Equal("auto", device.DefaultQuality)
+	suite.True(device.AllowDownloads)
+	suite.False(device.LastSeenAt.IsZero())
+
+	device.Name = "Bedroom TV"
+	device.Touch(domain.DeviceRegistration{Name: "TV", AppVersion: "2.0.0"})
+	suite.Equal("Bedroom TV", device.Name)
+	suite.Equal("tv", device.Platform)
+	suite.Equal("2.0.0", device.AppVersion)
+}
+
 func TestUserDomainTestSuite(t *testing.T) {
 	suite.Run(t, new(UserDomainTestSuite))
 }
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	authpb "github.com/narwhalmedia/narwhal/pkg/auth/v1"
+)
+
+// CreateApiKey creates an API key for the caller. Keys cannot be created
+// with an API key, so a leaked key cannot be used to keep access after it
+// is revoked.
+func (h *GRPCHandler) CreateApiKey(
+	ctx context.Context,
+	req *authpb.CreateApiKeyRequest,
+) (*authpb.CreateApiKeyResponse, error) {
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "user not authenticated")
+	}
+	if claims := getClaimsFromContext(ctx); claims != nil && claims.IsAPIKey() {
+		return nil, status.Error(codes.PermissionDenied, "API keys cannot create API keys")
+	}
+	if req.GetExpiresInSeconds() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "expiry must not be negative")
+	}
+
+	key, plaintext, err := h.apiKeyService.CreateAPIKey(
+		ctx,
+		userID,
+		req.GetName(),
+		time.Duration(req.GetExpiresInSeconds())*time.Second,
+	)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.CreateApiKeyResponse{
+		ApiKey: domainAPIKeyToProto(key),
+		Key:    plaintext,
+	}, nil
+}
+
+// RevokeApiKey revokes an API key of a user.
+func (h *GRPCHandler) RevokeApiKey(
+	ctx context.Context,
+	req *authpb.RevokeApiKeyRequest,
+) (*authpb.RevokeApiKeyResponse, error) {
+	userID, err := h.resolveTargetUser(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+	keyID, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid API key ID")
+	}
+
+	key, err := h.apiKeyService.RevokeAPIKey(ctx, userID, keyID)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.RevokeApiKeyResponse{
+		ApiKey: domainAPIKeyToProto(key),
+	}, nil
+}
+
+// ListApiKeys lists a user's API keys.
+func (h *GRPCHandler) ListApiKeys(
+	ctx context.Context,
+	req *authpb.ListApiKeysRequest,
+) (*authpb.ListApiKeysResponse, error) {
+	userID, err := h.resolveTargetUser(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := h.apiKeyService.ListAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	protoKeys := make([]*authpb.ApiKey, len(keys))
+	for i, key := range keys {
+		protoKeys[i] = domainAPIKeyToProto(key)
+	}
+
+	return &authpb.ListApiKeysResponse{
+		ApiKeys: protoKeys,
+	}, nil
+}
+
+func domainAPIKeyToProto(key *domain.APIKey) *authpb.ApiKey {
+	proto := &authpb.ApiKey{
+		Id:        key.ID.String(),
+		Name:      key.Name,
+		Hint:      key.Hint,
+		CreatedAt: timestamppb.New(key.CreatedAt),
+	}
+	if key.ExpiresAt != nil {
+		proto.ExpiresAt = timestamppb.New(*key.ExpiresAt)
+	}
+	if key.LastUsedAt != nil {
+		proto.LastUsedAt = timestamppb.New(*key.LastUsedAt)
+	}
+	if key.RevokedAt != nil {
+		proto.RevokedAt = timestamppb.New(*key.RevokedAt)
+	}
+	return proto
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"context"
+
+	authpb "github.com/narwhalmedia/narwhal/pkg/auth/v1"
+)
+
+// UploadAvatar replaces a user's avatar with an uploaded image.
+func (h *GRPCHandler) UploadAvatar(
+	ctx context.Context,
+	req *authpb.UploadAvatarRequest,
+) (*authpb.UploadAvatarResponse, error) {
+	userID, err := h.resolveTargetUser(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := h.avatarService.UploadAvatar(ctx, userID, req.GetImage())
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.UploadAvatarResponse{
+		User: domainUserToProto(user),
+	}, nil
+}
+
+// DeleteAvatar removes a user's avatar.
+func (h *GRPCHandler) DeleteAvatar(
+	ctx context.Context,
+	req *authpb.DeleteAvatarRequest,
+) (*authpb.DeleteAvatarResponse, error) {
+	userID, err := h.resolveTargetUser(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := h.avatarService.DeleteAvatar(ctx, userID)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.DeleteAvatarResponse{
+		User: domainUserToProto(user),
+	}, nil
+}
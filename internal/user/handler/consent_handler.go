@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	authpb "github.com/narwhalmedia/narwhal/pkg/auth/v1"
+	"github.com/narwhalmedia/narwhal/pkg/clientip"
+)
+
+// PublishConsentDocument publishes a new terms or privacy policy version.
+func (h *GRPCHandler) PublishConsentDocument(
+	ctx context.Context,
+	req *authpb.PublishConsentDocumentRequest,
+) (*authpb.PublishConsentDocumentResponse, error) {
+	if err := h.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	document, err := h.consentService.PublishDocument(ctx, req.GetKind(), req.GetVersion(), req.GetUrl())
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.PublishConsentDocumentResponse{
+		Document: domainConsentDocumentToProto(document),
+	}, nil
+}
+
+// ListConsentDocuments lists published document versions.
+func (h *GRPCHandler) ListConsentDocuments(
+	ctx context.Context,
+	req *authpb.ListConsentDocumentsRequest,
+) (*authpb.ListConsentDocumentsResponse, error) {
+	documents, err := h.consentService.ListDocuments(ctx, req.GetKind())
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.ListConsentDocumentsResponse{
+		Documents: domainConsentDocumentsToProto(documents),
+	}, nil
+}
+
+// GetConsentStatus reports how many users have accepted document versions.
+func (h *GRPCHandler) GetConsentStatus(
+	ctx context.Context,
+	req *authpb.GetConsentStatusRequest,
+) (*authpb.GetConsentStatusResponse, error) {
+	if err := h.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	documentID, err := parseOptionalUUID(req.GetDocumentId(), "invalid document ID")
+	if err != nil {
+		return nil, err
+	}
+	userID, err := parseOptionalUUID(req.GetUserId(), "invalid user ID")
+	if err != nil {
+		return nil, err
+	}
+
+	statuses, err := h.consentService.Status(ctx, documentID, userID)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	protoStatuses := make([]*authpb.ConsentDocumentStatus, len(statuses))
+	for i, s := range statuses {
+		protoStatuses[i] = &authpb.ConsentDocumentStatus{
+			Document:      domainConsentDocumentToProto(s.Document),
+			AcceptedCount: s.Accepted,
+			PendingCount:  s.Pending,
+			UserAccepted:  s.UserAccepted,
+		}
+	}
+
+	return &authpb.GetConsentStatusResponse{
+		Statuses: protoStatuses,
+	}, nil
+}
+
+// ListPendingConsents lists the document versions the caller must accept.
+func (h *GRPCHandler) ListPendingConsents(
+	ctx context.Context,
+	_ *authpb.ListPendingConsentsRequest,
+) (*authpb.ListPendingConsentsResponse, error) {
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	documents, err := h.consentService.PendingDocuments(ctx, userID)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.ListPendingConsentsResponse{
+		Documents: domainConsentDocumentsToProto(documents),
+	}, nil
+}
+
+// AcceptConsents records the caller accepting document versions.
+func (h *GRPCHandler) AcceptConsents(
+	ctx context.Context,
+	req *authpb.AcceptConsentsRequest,
+) (*authpb.AcceptConsentsResponse, error) {
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	documentIDs := make([]uuid.UUID, len(req.GetDocumentIds()))
+	for i, rawID := range req.GetDocumentIds() {
+		if documentIDs[i], err = uuid.Parse(rawID); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid document ID")
+		}
+	}
+
+	ipAddress := clientip.FromContext(ctx)
+
+	if err := h.consentService.Accept(ctx, userID, documentIDs, ipAddress); err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	required, err := h.consentService.ConsentRequired(ctx, userID)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.AcceptConsentsResponse{
+		ConsentRequired: required,
+	}, nil
+}
+
+func parseOptionalUUID(rawID, message string) (uuid.UUID, error) {
+	if rawID == "" {
+		return uuid.Nil, nil
+	}
+	id, err := uuid.Parse(rawID)
+	if err != nil {
+		return uuid.Nil, status.Error(codes.InvalidArgument, message)
+	}
+	return id, nil
+}
+
+func domainConsentDocumentsToProto(documents []*domain.ConsentDocument) []*authpb.ConsentDocument {
+	protoDocuments := make([]*authpb.ConsentDocument, len(documents))
+	for i, document := range documents {
+		protoDocuments[i] = domainConsentDocumentToProto(document)
+	}
+	return protoDocuments
+}
+
+func domainConsentDocumentToProto(document *domain.ConsentDocument) *authpb.ConsentDocument {
+	return &authpb.ConsentDocument{
+		Id:        document.ID.String(),
+		Kind:      document.Kind,
+		Version:   document.Version,
+		Url:       document.URL,
+		Published: timestamppb.New(document.PublishedAt),
+	}
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	authpb "github.com/narwhalmedia/narwhal/pkg/auth/v1"
+)
+
+// ListDevices lists a user's registered devices.
+func (h *GRPCHandler) ListDevices(
+	ctx context.Context,
+	req *authpb.ListDevicesRequest,
+) (*authpb.ListDevicesResponse, error) {
+	userID, err := h.resolveTargetUser(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := h.deviceService.ListDevices(ctx, userID)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	protoDevices := make([]*authpb.Device, len(devices))
+	for i, device := range devices {
+		protoDevices[i] = domainDeviceToProto(device)
+	}
+
+	return &authpb.ListDevicesResponse{
+		Devices: protoDevices,
+	}, nil
+}
+
+// RenameDevice renames a device.
+func (h *GRPCHandler) RenameDevice(
+	ctx context.Context,
+	req *authpb.RenameDeviceRequest,
+) (*authpb.RenameDeviceResponse, error) {
+	userID, deviceID, err := h.resolveDevice(ctx, req.GetUserId(), req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	device, err := h.deviceService.RenameDevice(ctx, userID, deviceID, req.GetName())
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.RenameDeviceResponse{
+		Device: domainDeviceToProto(device),
+	}, nil
+}
+
+// UpdateDeviceSettings updates per-device settings.
+func (h *GRPCHandler) UpdateDeviceSettings(
+	ctx context.Context,
+	req *authpb.UpdateDeviceSettingsRequest,
+) (*authpb.UpdateDeviceSettingsResponse, error) {
+	userID, deviceID, err := h.resolveDevice(ctx, req.GetUserId(), req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	device, err := h.deviceService.UpdateDeviceSettings(
+		ctx,
+		userID,
+		deviceID,
+		req.DefaultQuality,
+		req.AllowDownloads,
+	)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.UpdateDeviceSettingsResponse{
+		Device: domainDeviceToProto(device),
+	}, nil
+}
+
+// RevokeDevice signs a device out and forgets it.
+func (h *GRPCHandler) RevokeDevice(
+	ctx context.Context,
+	req *authpb.RevokeDeviceRequest,
+) (*authpb.RevokeDeviceResponse, error) {
+	userID, deviceID, err := h.resolveDevice(ctx, req.GetUserId(), req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.deviceService.RevokeDevice(ctx, userID, deviceID); err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.RevokeDeviceResponse{}, nil
+}
+
+func (h *GRPCHandler) resolveDevice(ctx context.Context, rawUserID, rawDeviceID string) (uuid.UUID, uuid.UUID, error) {
+	userID, err := h.resolveTargetUser(ctx, rawUserID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+
+	deviceID, err := uuid.Parse(rawDeviceID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, status.Error(codes.InvalidArgument, "invalid device ID")
+	}
+
+	return userID, deviceID, nil
+}
+
+func domainDeviceToProto(device *domain.Device) *authpb.Device {
+	return &authpb.Device{
+		Id:             device.ID.String(),
+		ClientId:       device.ClientID,
+		Name:           device.Name,
+		Platform:       device.Platform,
+		AppVersion:     device.AppVersion,
+		LastSeen:       timestamppb.New(device.LastSeenAt),
+		LastIp:         device.LastIP,
+		DefaultQuality: device.DefaultQuality,
+		AllowDownloads: device.AllowDownloads,
+		Created:        timestamppb.New(device.CreatedAt),
+	}
+}
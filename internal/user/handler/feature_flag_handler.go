@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"context"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	authpb "github.com/narwhalmedia/narwhal/pkg/auth/v1"
+)
+
+// CreateFeatureFlag creates a new feature flag.
+func (h *GRPCHandler) CreateFeatureFlag(
+	ctx context.Context,
+	req *authpb.CreateFeatureFlagRequest,
+) (*authpb.CreateFeatureFlagResponse, error) {
+	if err := h.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	flag, err := h.featureFlagService.CreateFeatureFlag(
+		ctx,
+		req.GetKey(),
+		req.GetDescription(),
+		req.GetEnabled(),
+		int(req.GetPercentage()),
+		req.GetUserIds(),
+	)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.CreateFeatureFlagResponse{
+		Flag: domainFeatureFlagToProto(flag),
+	}, nil
+}
+
+// UpdateFeatureFlag updates a feature flag.
+func (h *GRPCHandler) UpdateFeatureFlag(
+	ctx context.Context,
+	req *authpb.UpdateFeatureFlagRequest,
+) (*authpb.UpdateFeatureFlagResponse, error) {
+	if err := h.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	// Prepare updates
+	updates := make(map[string]interface{})
+
+	if req.GetUpdateMask() != nil {
+		for _, path := range req.GetUpdateMask().GetPaths() {
+			switch path {
+			case "description":
+				updates["description"] = req.GetFlag().GetDescription()
+			case "enabled":
+				updates["enabled"] = req.GetFlag().GetEnabled()
+			case "percentage":
+				updates["percentage"] = int(req.GetFlag().GetPercentage())
+			case "user_ids":
+				updates["user_ids"] = req.GetFlag().GetUserIds()
+			}
+		}
+	}
+
+	flag, err := h.featureFlagService.UpdateFeatureFlag(ctx, req.GetKey(), updates)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.UpdateFeatureFlagResponse{
+		Flag: domainFeatureFlagToProto(flag),
+	}, nil
+}
+
+// DeleteFeatureFlag deletes a feature flag.
+func (h *GRPCHandler) DeleteFeatureFlag(
+	ctx context.Context,
+	req *authpb.DeleteFeatureFlagRequest,
+) (*authpb.DeleteFeatureFlagResponse, error) {
+	if err := h.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := h.featureFlagService.DeleteFeatureFlag(ctx, req.GetKey()); err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.DeleteFeatureFlagResponse{}, nil
+}
+
+// ListFeatureFlags lists all feature flags.
+func (h *GRPCHandler) ListFeatureFlags(
+	ctx context.Context,
+	_ *authpb.ListFeatureFlagsRequest,
+) (*authpb.ListFeatureFlagsResponse, error) {
+	if err := h.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	flags, err := h.featureFlagService.ListFeatureFlags(ctx)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	protoFlags := make([]*authpb.FeatureFlag, len(flags))
+	for i, flag := range flags {
+		protoFlags[i] = domainFeatureFlagToProto(flag)
+	}
+
+	return &authpb.ListFeatureFlagsResponse{
+		Flags: protoFlags,
+	}, nil
+}
+
+// EvaluateFeatureFlags evaluates feature flags for a user, so clients can
+// show or hide features that are being rolled out.
+func (h *GRPCHandler) EvaluateFeatureFlags(
+	ctx context.Context,
+	req *authpb.EvaluateFeatureFlagsRequest,
+) (*authpb.EvaluateFeatureFlagsResponse, error) {
+	userID, err := h.resolveTargetUser(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := h.featureFlagService.EvaluateAll(ctx, userID.String(), req.GetKeys())
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	evaluations := make([]*authpb.FeatureFlagEvaluation, len(results))
+	for i, result := range results {
+		evaluations[i] = &authpb.FeatureFlagEvaluation{
+			Key:     result.Key,
+			Enabled: result.Enabled,
+			Reason:  result.Reason,
+		}
+	}
+
+	return &authpb.EvaluateFeatureFlagsResponse{
+		Evaluations: evaluations,
+	}, nil
+}
+
+func domainFeatureFlagToProto(flag *domain.FeatureFlag) *authpb.FeatureFlag {
+	return &authpb.FeatureFlag{
+		Key:         flag.Key,
+		Description: flag.Description,
+		Enabled:     flag.Enabled,
+		Percentage:  int32(flag.Percentage),
+		UserIds:     flag.UserIDs,
+		Created:     timestamppb.New(flag.CreatedAt),
+		Updated:     timestamppb.New(flag.UpdatedAt),
+	}
+}
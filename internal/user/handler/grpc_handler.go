@@ -2,6 +2,8 @@ package handler
 
 import (
 	"context"
+	stderrors "errors"
+	"strconv"
 
 	"github.com/google/uuid"
 	"google.golang.org/grpc/codes"
@@ -13,6 +15,7 @@ import (
 	"github.com/narwhalmedia/narwhal/internal/user/service"
 	"github.com/narwhalmedia/narwhal/pkg/auth"
 	authpb "github.com/narwhalmedia/narwhal/pkg/auth/v1"
+	"github.com/narwhalmedia/narwhal/pkg/clientip"
 	commonpb "github.com/narwhalmedia/narwhal/pkg/common/v1"
 	"github.com/narwhalmedia/narwhal/pkg/errors"
 	"github.com/narwhalmedia/narwhal/pkg/interfaces"
@@ -22,21 +25,57 @@ import (
 type GRPCHandler struct {
 	authpb.UnimplementedAuthServiceServer
 
-	authService *service.AuthService
-	userService *service.UserService
-	logger      interfaces.Logger
+	authService          *service.AuthService
+	userService          *service.UserService
+	tenantService        *service.TenantService
+	inviteService        *service.InviteService
+	regService           *service.RegistrationService
+	avatarService        *service.AvatarService
+	prefService          *service.PreferenceService
+	deviceService        *service.DeviceService
+	impersonationService *service.ImpersonationService
+	permissionService    *service.PermissionService
+	featureFlagService   *service.FeatureFlagService
+	consentService       *service.ConsentService
+	privacyService       *service.PrivacyService
+	apiKeyService        *service.APIKeyService
+	logger               interfaces.Logger
 }
 
 // NewGRPCHandler creates a new gRPC handler.
 func NewGRPCHandler(
 	authService *service.AuthService,
 	userService *service.UserService,
+	tenantService *service.TenantService,
+	inviteService *service.InviteService,
+	regService *service.RegistrationService,
+	avatarService *service.AvatarService,
+	prefService *service.PreferenceService,
+	deviceService *service.DeviceService,
+	impersonationService *service.ImpersonationService,
+	permissionService *service.PermissionService,
+	featureFlagService *service.FeatureFlagService,
+	consentService *service.ConsentService,
+	privacyService *service.PrivacyService,
+	apiKeyService *service.APIKeyService,
 	logger interfaces.Logger,
 ) *GRPCHandler {
 	return &GRPCHandler{
-		authService: authService,
-		userService: userService,
-		logger:      logger,
+		authService:          authService,
+		userService:          userService,
+		tenantService:        tenantService,
+		inviteService:        inviteService,
+		regService:           regService,
+		avatarService:        avatarService,
+		prefService:          prefService,
+		deviceService:        deviceService,
+		impersonationService: impersonationService,
+		permissionService:    permissionService,
+		featureFlagService:   featureFlagService,
+		consentService:       consentService,
+		privacyService:       privacyService,
+		apiKeyService:        apiKeyService,
+		logger:               logger,
 	}
 }
 
@@ -44,7 +83,7 @@ func NewGRPCHandler(
 func (h *GRPCHandler) Login(ctx context.Context, req *authpb.LoginRequest) (*authpb.LoginResponse, error) {
 	// Extract client info from context
 	md, _ := metadata.FromIncomingContext(ctx)
-	ipAddress := extractMetadataValue(md, "x-forwarded-for", "x-real-ip")
+	ipAddress := clientip.FromContext(ctx)
 	userAgent := extractMetadataValue(md, "user-agent")
 
 	// Perform login
@@ -56,23 +95,118 @@ func (h *GRPCHandler) Login(ctx context.Context, req *authpb.LoginRequest) (*aut
 		ipAddress,
 		userAgent,
 	)
+	if resp, ok := verificationResponse(err); ok {
+		return resp, nil
+	}
 	if err != nil {
 		return nil, toGRPCError(err)
 	}
 
+	h.registerLoginDevice(ctx, tokens, req.GetDeviceId(), req.GetDeviceName(), req.GetPlatform(), req.GetAppVersion())
+
 	// Get user info
 	user, err := h.userService.GetUserByUsername(ctx, req.GetUsername())
 	if err != nil {
 		return nil, toGRPCError(err)
 	}
 
+	return loginResponse(tokens, user), nil
+}
+
+// ExchangeOIDCToken logs a user in with the ID token of an OpenID Connect
+// provider. It does not require authentication.
+func (h *GRPCHandler) ExchangeOIDCToken(
+	ctx context.Context,
+	req *authpb.ExchangeOIDCTokenRequest,
+) (*authpb.LoginResponse, error) {
+	if req.GetProvider() == "" || req.GetIdToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "provider and ID token are required")
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	tokens, user, err := h.authService.ExchangeOIDCToken(
+		ctx,
+		req.GetProvider(),
+		req.GetIdToken(),
+		req.GetDeviceName(),
+		clientip.FromContext(ctx),
+		extractMetadataValue(md, "user-agent"),
+	)
+	if resp, ok := verificationResponse(err); ok {
+		return resp, nil
+	}
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	h.registerLoginDevice(ctx, tokens, req.GetDeviceId(), req.GetDeviceName(), req.GetPlatform(), req.GetAppVersion())
+
+	return loginResponse(tokens, user), nil
+}
+
+// verificationResponse returns the response to a login that must be
+// verified first, if err requires verification.
+func verificationResponse(err error) (*authpb.LoginResponse, bool) {
+	var verification *domain.LoginVerificationRequiredError
+	if !stderrors.As(err, &verification) {
+		return nil, false
+	}
+	anomalies := make([]string, len(verification.Anomalies))
+	for i, a := range verification.Anomalies {
+		anomalies[i] = string(a)
+	}
+	return &authpb.LoginResponse{
+		VerificationRequired: true,
+		ChallengeId:          verification.ChallengeID.String(),
+		Anomalies:            anomalies,
+		VerificationFactor:   verification.Factor,
+	}, true
+}
+
+// VerifyLogin completes a login that required verification. It does not
+// require authentication.
+func (h *GRPCHandler) VerifyLogin(ctx context.Context, req *authpb.VerifyLoginRequest) (*authpb.LoginResponse, error) {
+	challengeID, err := uuid.Parse(req.GetChallengeId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid challenge ID")
+	}
+
+	tokens, user, err := h.authService.VerifyLogin(ctx, challengeID, req.GetCode())
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	h.registerLoginDevice(ctx, tokens, req.GetDeviceId(), req.GetDeviceName(), req.GetPlatform(), req.GetAppVersion())
+
+	return loginResponse(tokens, user), nil
+}
+
+// registerLoginDevice links the session of a login to the device it came
+// from. Device tracking is best-effort and never blocks sign-in.
+func (h *GRPCHandler) registerLoginDevice(
+	ctx context.Context,
+	tokens *domain.AuthTokens,
+	deviceID, deviceName, platform, appVersion string,
+) {
+	if _, err := h.deviceService.RegisterSessionDevice(ctx, tokens.RefreshToken, domain.DeviceRegistration{
+		ClientID:   deviceID,
+		Name:       deviceName,
+		Platform:   platform,
+		AppVersion: appVersion,
+		IPAddress:  clientip.FromContext(ctx),
+	}); err != nil {
+		h.logger.Warn("Failed to register device", interfaces.Error(err))
+	}
+}
+
+func loginResponse(tokens *domain.AuthTokens, user *domain.User) *authpb.LoginResponse {
 	return &authpb.LoginResponse{
 		AccessToken:  tokens.AccessToken,
 		RefreshToken: tokens.RefreshToken,
 		ExpiresIn:    int64(tokens.ExpiresIn),
 		TokenType:    tokens.TokenType,
 		User:         domainUserToProto(user),
-	}, nil
+	}
 }
 
 // Logout logs out a user.
@@ -109,6 +243,10 @@ func (h *GRPCHandler) RefreshToken(
 		return nil, toGRPCError(err)
 	}
 
+	if err := h.deviceService.TouchSessionDevice(ctx, tokens.RefreshToken, clientip.FromContext(ctx)); err != nil {
+		h.logger.Warn("Failed to update device activity", interfaces.Error(err))
+	}
+
 	return &authpb.RefreshTokenResponse{
 		AccessToken:  tokens.AccessToken,
 		RefreshToken: tokens.RefreshToken,
@@ -241,30 +379,34 @@ func (h *GRPCHandler) UpdateUser(
 
 	// Prepare updates
 	updates := make(map[string]interface{})
+	prefValues := make(map[string]string)
 
 	if req.GetUpdateMask() != nil {
 		for _, path := range req.GetUpdateMask().GetPaths() {
 			switch path {
 			case "preferences.language":
-				if req.GetUser().GetPreferences() != nil {
-					prefs := domain.UserPreferences{
-						Language: req.GetUser().GetPreferences().GetLanguage(),
-					}
-					updates["preferences"] = prefs
-				}
+				prefValues[domain.PrefLanguage] = req.GetUser().GetPreferences().GetLanguage()
 			case "preferences.theme":
-				if req.GetUser().GetPreferences() != nil {
-					prefs := domain.UserPreferences{
-						Theme: req.GetUser().GetPreferences().GetTheme(),
-					}
-					updates["preferences"] = prefs
-				}
+				prefValues[domain.PrefTheme] = req.GetUser().GetPreferences().GetTheme()
+			case "preferences.default_quality":
+				prefValues[domain.PrefPreferredQuality] = req.GetUser().GetPreferences().GetDefaultQuality()
+			case "preferences.subtitle_language":
+				prefValues[domain.PrefSubtitleLanguage] = req.GetUser().GetPreferences().GetSubtitleLanguage()
+			case "preferences.auto_play":
+				prefValues[domain.PrefAutoPlayNext] = strconv.FormatBool(req.GetUser().GetPreferences().GetAutoPlay())
 			case "email":
 				updates["email"] = req.GetUser().GetEmail()
 			}
 		}
 	}
 
+	// Preferences go through the typed preference store so they are validated
+	if len(prefValues) > 0 {
+		if _, err := h.prefService.UpdatePreferences(ctx, userID, prefValues, nil, h.isAdmin(ctx)); err != nil {
+			return nil, toGRPCError(err)
+		}
+	}
+
 	// Update user
 	user, err := h.userService.UpdateUser(ctx, userID, updates)
 	if err != nil {
@@ -316,6 +458,9 @@ func (h *GRPCHandler) ChangePassword(
 	if currentUserID != userID {
 		return nil, status.Error(codes.PermissionDenied, "can only change own password")
 	}
+	if claims := getClaimsFromContext(ctx); claims != nil && claims.IsImpersonated() {
+		return nil, status.Error(codes.PermissionDenied, "cannot change password while impersonating a user")
+	}
 
 	// Change password
 	if err := h.userService.ChangePassword(ctx, userID, req.GetCurrentPassword(), req.GetNewPassword()); err != nil {
@@ -336,15 +481,12 @@ func (h *GRPCHandler) CheckPermission(
 		return nil, status.Error(codes.InvalidArgument, "invalid user ID")
 	}
 
-	// Get user
-	user, err := h.userService.GetUser(ctx, userID)
+	// Check permission
+	allowed, err := h.permissionService.CheckPermission(ctx, userID, req.GetResource(), req.GetAction())
 	if err != nil {
 		return nil, toGRPCError(err)
 	}
 
-	// Check permission
-	allowed := user.HasPermission(req.GetResource(), req.GetAction())
-
 	response := &authpb.CheckPermissionResponse{
 		Allowed: allowed,
 	}
@@ -367,27 +509,18 @@ func (h *GRPCHandler) GetUserPermissions(
 		return nil, status.Error(codes.InvalidArgument, "invalid user ID")
 	}
 
-	// Get user
-	user, err := h.userService.GetUser(ctx, userID)
+	// Collect all permissions, including those inherited through role parents
+	userPerms, err := h.permissionService.GetPermissions(ctx, userID)
 	if err != nil {
 		return nil, toGRPCError(err)
 	}
 
-	// Collect all permissions
-	permissions := make([]*authpb.Permission, 0)
-	seen := make(map[string]bool)
-
-	for _, role := range user.Roles {
-		for _, perm := range role.Permissions {
-			key := perm.Resource + ":" + perm.Action
-			if !seen[key] {
-				seen[key] = true
-				permissions = append(permissions, &authpb.Permission{
-					Resource: perm.Resource,
-					Action:   perm.Action,
-				})
-			}
-		}
+	permissions := make([]*authpb.Permission, 0, len(userPerms))
+	for _, perm := range userPerms {
+		permissions = append(permissions, &authpb.Permission{
+			Resource: perm.Resource,
+			Action:   perm.Action,
+		})
 	}
 
 	return &authpb.GetUserPermissionsResponse{
@@ -395,8 +528,49 @@ func (h *GRPCHandler) GetUserPermissions(
 	}, nil
 }
 
+// BulkCheckPermissions checks several permissions for a user in one call.
+func (h *GRPCHandler) BulkCheckPermissions(
+	ctx context.Context,
+	req *authpb.BulkCheckPermissionsRequest,
+) (*authpb.BulkCheckPermissionsResponse, error) {
+	userID, err := h.resolveTargetUser(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	checks := make([]domain.PermissionCheck, len(req.GetChecks()))
+	for i, check := range req.GetChecks() {
+		checks[i] = domain.PermissionCheck{
+			Resource: check.GetResource(),
+			Action:   check.GetAction(),
+		}
+	}
+
+	allowed, err := h.permissionService.BulkCheckPermissions(ctx, userID, checks)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	results := make([]*authpb.PermissionCheckResult, len(checks))
+	for i, check := range checks {
+		results[i] = &authpb.PermissionCheckResult{
+			Resource: check.Resource,
+			Action:   check.Action,
+			Allowed:  allowed[i],
+		}
+	}
+
+	return &authpb.BulkCheckPermissionsResponse{
+		Results: results,
+	}, nil
+}
+
 // Helper functions
 
+func (h *GRPCHandler) isAdmin(ctx context.Context) bool {
+	return h.requireAdmin(ctx) == nil
+}
+
 func (h *GRPCHandler) requireAdmin(ctx context.Context) error {
 	claims := getClaimsFromContext(ctx)
 	if claims == nil {
@@ -412,6 +586,42 @@ func (h *GRPCHandler) requireAdmin(ctx context.Context) error {
 	return status.Error(codes.PermissionDenied, "admin access required")
 }
 
+// requirePlatformAdmin restricts an RPC to admins of the default tenant.
+// Admins of other tenants manage only their own tenant, not the others.
+func (h *GRPCHandler) requirePlatformAdmin(ctx context.Context) error {
+	claims := getClaimsFromContext(ctx)
+	if claims == nil {
+		return status.Error(codes.Unauthenticated, "user not authenticated")
+	}
+	if !claims.IsPlatformAdmin() {
+		return status.Error(codes.PermissionDenied, "platform admin access required")
+	}
+	return nil
+}
+
+// resolveTargetUser returns the user a self-service request acts on: the
+// caller when rawID is empty. Only admins may act on someone else.
+func (h *GRPCHandler) resolveTargetUser(ctx context.Context, rawID string) (uuid.UUID, error) {
+	currentUserID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		return uuid.Nil, status.Error(codes.Unauthenticated, "user not authenticated")
+	}
+	if rawID == "" {
+		return currentUserID, nil
+	}
+
+	userID, err := uuid.Parse(rawID)
+	if err != nil {
+		return uuid.Nil, status.Error(codes.InvalidArgument, "invalid user ID")
+	}
+	if userID != currentUserID {
+		if err := h.requireAdmin(ctx); err != nil {
+			return uuid.Nil, err
+		}
+	}
+	return userID, nil
+}
+
 func getUserIDFromContext(ctx context.Context) (uuid.UUID, error) {
 	claims := getClaimsFromContext(ctx)
 	if claims == nil {
@@ -447,24 +657,22 @@ func extractMetadataValue(md metadata.MD, keys ...string) string {
 
 func domainUserToProto(user *domain.User) *authpb.User {
 	proto := &authpb.User{
-		Id:       user.ID.String(),
-		Username: user.Username,
-		Email:    user.Email,
-		Active:   user.IsActive,
-		Created:  timestamppb.New(user.CreatedAt),
-		Updated:  timestamppb.New(user.UpdatedAt),
+		Id:               user.ID.String(),
+		Username:         user.Username,
+		Email:            user.Email,
+		Active:           user.IsActive,
+		TenantId:         user.TenantID.String(),
+		Verified:         user.IsVerified,
+		PendingApproval:  user.PendingApproval,
+		AvatarUrl:        user.Avatar,
+		TwoFactorEnabled: user.TOTPEnabled(),
+		Created:          timestamppb.New(user.CreatedAt),
+		Updated:          timestamppb.New(user.UpdatedAt),
 	}
 
 	// Set role
 	if len(user.Roles) > 0 {
-		switch user.Roles[0].Name {
-		case domain.RoleAdmin:
-			proto.Role = commonpb.UserRole_USER_ROLE_ADMIN
-		case domain.RoleUser:
-			proto.Role = commonpb.UserRole_USER_ROLE_USER
-		case domain.RoleGuest:
-			proto.Role = commonpb.UserRole_USER_ROLE_GUEST
-		}
+		proto.Role = roleNameToProto(user.Roles[0].Name)
 	}
 
 	// Set preferences
@@ -497,6 +705,19 @@ func protoRoleToString(role commonpb.UserRole) string {
 	}
 }
 
+func roleNameToProto(name string) commonpb.UserRole {
+	switch name {
+	case domain.RoleAdmin:
+		return commonpb.UserRole_USER_ROLE_ADMIN
+	case domain.RoleUser:
+		return commonpb.UserRole_USER_ROLE_USER
+	case domain.RoleGuest:
+		return commonpb.UserRole_USER_ROLE_GUEST
+	default:
+		return commonpb.UserRole_USER_ROLE_UNSPECIFIED
+	}
+}
+
 func toGRPCError(err error) error {
 	if err == nil {
 		return nil
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	authpb "github.com/narwhalmedia/narwhal/pkg/auth/v1"
+	"github.com/narwhalmedia/narwhal/pkg/clientip"
+)
+
+// Impersonate issues a short-lived token acting as another user.
+func (h *GRPCHandler) Impersonate(
+	ctx context.Context,
+	req *authpb.ImpersonateRequest,
+) (*authpb.ImpersonateResponse, error) {
+	if err := h.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	adminID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "user not authenticated")
+	}
+
+	targetID, err := uuid.Parse(req.GetUserId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user ID")
+	}
+
+	impersonation, tokens, err := h.impersonationService.Impersonate(
+		ctx,
+		adminID,
+		targetID,
+		req.GetReason(),
+		clientip.FromContext(ctx),
+	)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.ImpersonateResponse{
+		AccessToken:   tokens.AccessToken,
+		TokenType:     tokens.TokenType,
+		ExpiresIn:     int64(tokens.ExpiresIn),
+		Impersonation: domainImpersonationToProto(impersonation),
+	}, nil
+}
+
+// ListImpersonations lists the impersonation audit trail.
+func (h *GRPCHandler) ListImpersonations(
+	ctx context.Context,
+	req *authpb.ListImpersonationsRequest,
+) (*authpb.ListImpersonationsResponse, error) {
+	if err := h.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	var userID uuid.UUID
+	if req.GetUserId() != "" {
+		id, err := uuid.Parse(req.GetUserId())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid user ID")
+		}
+		userID = id
+	}
+
+	impersonations, err := h.impersonationService.ListImpersonations(
+		ctx,
+		userID,
+		int(req.GetLimit()),
+		int(req.GetOffset()),
+	)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	protoImpersonations := make([]*authpb.Impersonation, len(impersonations))
+	for i, impersonation := range impersonations {
+		protoImpersonations[i] = domainImpersonationToProto(impersonation)
+	}
+
+	return &authpb.ListImpersonationsResponse{
+		Impersonations: protoImpersonations,
+	}, nil
+}
+
+func domainImpersonationToProto(impersonation *domain.Impersonation) *authpb.Impersonation {
+	return &authpb.Impersonation{
+		Id:             impersonation.ID.String(),
+		ImpersonatorId: impersonation.ImpersonatorID.String(),
+		UserId:         impersonation.TargetUserID.String(),
+		Reason:         impersonation.Reason,
+		IpAddress:      impersonation.IPAddress,
+		Created:        timestamppb.New(impersonation.CreatedAt),
+		ExpiresAt:      timestamppb.New(impersonation.ExpiresAt),
+	}
+}
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	authpb "github.com/narwhalmedia/narwhal/pkg/auth/v1"
+)
+
+// CreateInvite creates an invite token for a new user.
+func (h *GRPCHandler) CreateInvite(
+	ctx context.Context,
+	req *authpb.CreateInviteRequest,
+) (*authpb.CreateInviteResponse, error) {
+	if err := h.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	createdBy, err := getUserIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	libraryIDs := make([]uuid.UUID, 0, len(req.GetLibraryIds()))
+	for _, raw := range req.GetLibraryIds() {
+		libraryID, err := uuid.Parse(raw)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid library ID")
+		}
+		libraryIDs = append(libraryIDs, libraryID)
+	}
+
+	invite, token, err := h.inviteService.CreateInvite(
+		ctx,
+		createdBy,
+		req.GetEmail(),
+		protoRoleToString(req.GetRole()),
+		libraryIDs,
+		time.Duration(req.GetExpiresInSeconds())*time.Second,
+	)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.CreateInviteResponse{
+		Invite: domainInviteToProto(invite),
+		Token:  token,
+	}, nil
+}
+
+// ListInvites lists invites.
+func (h *GRPCHandler) ListInvites(
+	ctx context.Context,
+	req *authpb.ListInvitesRequest,
+) (*authpb.ListInvitesResponse, error) {
+	if err := h.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	invites, err := h.inviteService.ListInvites(ctx, int(req.GetLimit()), int(req.GetOffset()))
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	protoInvites := make([]*authpb.Invite, len(invites))
+	for i, invite := range invites {
+		protoInvites[i] = domainInviteToProto(invite)
+	}
+
+	return &authpb.ListInvitesResponse{
+		Invites: protoInvites,
+	}, nil
+}
+
+// RevokeInvite revokes a pending invite.
+func (h *GRPCHandler) RevokeInvite(
+	ctx context.Context,
+	req *authpb.RevokeInviteRequest,
+) (*authpb.RevokeInviteResponse, error) {
+	if err := h.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	inviteID, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid invite ID")
+	}
+
+	if err := h.inviteService.RevokeInvite(ctx, inviteID); err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.RevokeInviteResponse{}, nil
+}
+
+// RedeemInvite creates an account from an invite token. It does not require authentication.
+func (h *GRPCHandler) RedeemInvite(
+	ctx context.Context,
+	req *authpb.RedeemInviteRequest,
+) (*authpb.RedeemInviteResponse, error) {
+	user, err := h.inviteService.RedeemInvite(
+		ctx,
+		req.GetToken(),
+		req.GetUsername(),
+		req.GetEmail(),
+		req.GetPassword(),
+		req.GetDisplayName(),
+	)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.RedeemInviteResponse{
+		User: domainUserToProto(user),
+	}, nil
+}
+
+func domainInviteToProto(invite *domain.Invite) *authpb.Invite {
+	proto := &authpb.Invite{
+		Id:         invite.ID.String(),
+		Email:      invite.Email,
+		Role:       roleNameToProto(invite.Role),
+		LibraryIds: invite.LibraryIDs,
+		CreatedBy:  invite.CreatedBy.String(),
+		ExpiresAt:  timestamppb.New(invite.ExpiresAt),
+		Created:    timestamppb.New(invite.CreatedAt),
+	}
+
+	switch invite.Status(time.Now()) {
+	case domain.InviteStatusPending:
+		proto.Status = authpb.InviteStatus_INVITE_STATUS_PENDING
+	case domain.InviteStatusRedeemed:
+		proto.Status = authpb.InviteStatus_INVITE_STATUS_REDEEMED
+	case domain.InviteStatusRevoked:
+		proto.Status = authpb.InviteStatus_INVITE_STATUS_REVOKED
+	case domain.InviteStatusExpired:
+		proto.Status = authpb.InviteStatus_INVITE_STATUS_EXPIRED
+	}
+
+	if invite.RedeemedAt != nil {
+		proto.RedeemedAt = timestamppb.New(*invite.RedeemedAt)
+	}
+	if invite.RedeemedBy != nil {
+		proto.RedeemedBy = invite.RedeemedBy.String()
+	}
+
+	return proto
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	authpb "github.com/narwhalmedia/narwhal/pkg/auth/v1"
+)
+
+// GetPreferences returns a user's effective preferences with their schema.
+func (h *GRPCHandler) GetPreferences(
+	ctx context.Context,
+	req *authpb.GetPreferencesRequest,
+) (*authpb.GetPreferencesResponse, error) {
+	userID, err := h.resolveTargetUser(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := h.prefService.GetPreferences(ctx, userID)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.GetPreferencesResponse{
+		Preferences: preferencesToProto(values, h.isAdmin(ctx)),
+	}, nil
+}
+
+// UpdatePreferences sets or resets a user's preferences.
+func (h *GRPCHandler) UpdatePreferences(
+	ctx context.Context,
+	req *authpb.UpdatePreferencesRequest,
+) (*authpb.UpdatePreferencesResponse, error) {
+	userID, err := h.resolveTargetUser(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	isAdmin := h.isAdmin(ctx)
+	values, err := h.prefService.UpdatePreferences(ctx, userID, req.GetValues(), req.GetResetKeys(), isAdmin)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.UpdatePreferencesResponse{
+		Preferences: preferencesToProto(values, isAdmin),
+	}, nil
+}
+
+// WatchPreferences streams the caller's preference changes until the client disconnects.
+func (h *GRPCHandler) WatchPreferences(
+	req *authpb.WatchPreferencesRequest,
+	stream authpb.AuthService_WatchPreferencesServer,
+) error {
+	ctx := stream.Context()
+
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		return status.Error(codes.Unauthenticated, "user not authenticated")
+	}
+
+	changes, err := h.prefService.WatchPreferences(ctx, userID)
+	if err != nil {
+		return toGRPCError(err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case values := <-changes:
+			if err := stream.Send(&authpb.PreferencesChangedEvent{
+				Values:    values,
+				ChangedAt: timestamppb.New(time.Now()),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func preferencesToProto(values map[string]string, isAdmin bool) []*authpb.Preference {
+	schema := domain.PreferenceSchema()
+	prefs := make([]*authpb.Preference, len(schema))
+	for i, def := range schema {
+		prefs[i] = &authpb.Preference{
+			Key:          def.Key,
+			Value:        values[def.Key],
+			Type:         preferenceTypeToProto(def.Type),
+			DefaultValue: def.Default,
+			Options:      def.Options,
+			Min:          int32(def.Min),
+			Max:          int32(def.Max),
+			Editable:     def.Access == domain.PreferenceAccessUser || isAdmin,
+			Description:  def.Description,
+		}
+	}
+	return prefs
+}
+
+func preferenceTypeToProto(t domain.PreferenceType) authpb.PreferenceType {
+	switch t {
+	case domain.PreferenceTypeString:
+		return authpb.PreferenceType_PREFERENCE_TYPE_STRING
+	case domain.PreferenceTypeBool:
+		return authpb.PreferenceType_PREFERENCE_TYPE_BOOL
+	case domain.PreferenceTypeInt:
+		return authpb.PreferenceType_PREFERENCE_TYPE_INT
+	case domain.PreferenceTypeEnum:
+		return authpb.PreferenceType_PREFERENCE_TYPE_ENUM
+	default:
+		return authpb.PreferenceType_PREFERENCE_TYPE_UNSPECIFIED
+	}
+}
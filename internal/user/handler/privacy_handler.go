@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	authpb "github.com/narwhalmedia/narwhal/pkg/auth/v1"
+)
+
+// RequestDataExport starts an export of everything stored about a user.
+func (h *GRPCHandler) RequestDataExport(
+	ctx context.Context,
+	req *authpb.RequestDataExportRequest,
+) (*authpb.RequestDataExportResponse, error) {
+	userID, err := h.resolveTargetUser(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	export, err := h.privacyService.RequestDataExport(ctx, userID)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.RequestDataExportResponse{
+		Export: domainDataExportToProto(export),
+	}, nil
+}
+
+// GetDataExport returns a data export and, once ready, its archive.
+func (h *GRPCHandler) GetDataExport(
+	ctx context.Context,
+	req *authpb.GetDataExportRequest,
+) (*authpb.GetDataExportResponse, error) {
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid export ID")
+	}
+
+	export, err := h.privacyService.GetDataExport(ctx, id)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+	if _, err := h.resolveTargetUser(ctx, export.UserID.String()); err != nil {
+		return nil, err
+	}
+
+	return &authpb.GetDataExportResponse{
+		Export:  domainDataExportToProto(export),
+		Archive: export.Archive,
+	}, nil
+}
+
+// DeleteAccount schedules a user's account for deletion. Users deleting
+// their own account confirm it with their password.
+func (h *GRPCHandler) DeleteAccount(
+	ctx context.Context,
+	req *authpb.DeleteAccountRequest,
+) (*authpb.DeleteAccountResponse, error) {
+	userID, err := h.resolveTargetUser(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	if currentUserID, _ := getUserIDFromContext(ctx); userID == currentUserID {
+		user, err := h.userService.GetUser(ctx, userID)
+		if err != nil {
+			return nil, toGRPCError(err)
+		}
+		if !user.CheckPassword(req.GetPassword()) {
+			return nil, status.Error(codes.Unauthenticated, "incorrect password")
+		}
+	}
+
+	user, err := h.privacyService.ScheduleAccountDeletion(ctx, userID)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.DeleteAccountResponse{
+		DeleteAt: timestamppb.New(*user.DeletionScheduledAt),
+	}, nil
+}
+
+// CancelAccountDeletion cancels a scheduled account deletion.
+func (h *GRPCHandler) CancelAccountDeletion(
+	ctx context.Context,
+	req *authpb.CancelAccountDeletionRequest,
+) (*authpb.CancelAccountDeletionResponse, error) {
+	userID, err := h.resolveTargetUser(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := h.privacyService.CancelAccountDeletion(ctx, userID); err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.CancelAccountDeletionResponse{}, nil
+}
+
+func domainDataExportToProto(export *domain.DataExport) *authpb.DataExport {
+	proto := &authpb.DataExport{
+		Id:              export.ID.String(),
+		UserId:          export.UserID.String(),
+		Status:          export.Status,
+		MissingSections: export.MissingSections,
+		Created:         timestamppb.New(export.CreatedAt),
+		Expires:         timestamppb.New(export.ExpiresAt),
+	}
+	if export.CompletedAt != nil {
+		proto.Completed = timestamppb.New(*export.CompletedAt)
+	}
+	return proto
+}
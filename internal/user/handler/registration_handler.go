@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	authpb "github.com/narwhalmedia/narwhal/pkg/auth/v1"
+	"github.com/narwhalmedia/narwhal/pkg/clientip"
+)
+
+// Register creates a self-service account. It does not require authentication.
+func (h *GRPCHandler) Register(ctx context.Context, req *authpb.RegisterRequest) (*authpb.RegisterResponse, error) {
+	user, err := h.regService.Register(
+		ctx,
+		req.GetUsername(),
+		req.GetEmail(),
+		req.GetPassword(),
+		req.GetDisplayName(),
+		clientip.FromContext(ctx),
+	)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.RegisterResponse{
+		User: domainUserToProto(user),
+	}, nil
+}
+
+// VerifyEmail verifies a registered email address. It does not require authentication.
+func (h *GRPCHandler) VerifyEmail(
+	ctx context.Context,
+	req *authpb.VerifyEmailRequest,
+) (*authpb.VerifyEmailResponse, error) {
+	user, err := h.regService.VerifyEmail(ctx, req.GetToken())
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.VerifyEmailResponse{
+		User: domainUserToProto(user),
+	}, nil
+}
+
+// ListPendingRegistrations lists registrations awaiting admin approval.
+func (h *GRPCHandler) ListPendingRegistrations(
+	ctx context.Context,
+	req *authpb.ListPendingRegistrationsRequest,
+) (*authpb.ListPendingRegistrationsResponse, error) {
+	if err := h.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	users, err := h.regService.ListPendingApprovals(ctx, int(req.GetLimit()), int(req.GetOffset()))
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	protoUsers := make([]*authpb.User, len(users))
+	for i, user := range users {
+		protoUsers[i] = domainUserToProto(user)
+	}
+
+	return &authpb.ListPendingRegistrationsResponse{
+		Users: protoUsers,
+	}, nil
+}
+
+// ApproveRegistration approves a pending registration.
+func (h *GRPCHandler) ApproveRegistration(
+	ctx context.Context,
+	req *authpb.ApproveRegistrationRequest,
+) (*authpb.ApproveRegistrationResponse, error) {
+	if err := h.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	userID, err := uuid.Parse(req.GetUserId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user ID")
+	}
+
+	user, err := h.regService.ApproveRegistration(ctx, userID)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.ApproveRegistrationResponse{
+		User: domainUserToProto(user),
+	}, nil
+}
+
+// RejectRegistration rejects and deletes a pending registration.
+func (h *GRPCHandler) RejectRegistration(
+	ctx context.Context,
+	req *authpb.RejectRegistrationRequest,
+) (*authpb.RejectRegistrationResponse, error) {
+	if err := h.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	userID, err := uuid.Parse(req.GetUserId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user ID")
+	}
+
+	if err := h.regService.RejectRegistration(ctx, userID); err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.RejectRegistrationResponse{}, nil
+}
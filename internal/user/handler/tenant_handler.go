@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	authpb "github.com/narwhalmedia/narwhal/pkg/auth/v1"
+	"github.com/narwhalmedia/narwhal/pkg/tenant"
+)
+
+// CreateTenant creates a new tenant.
+func (h *GRPCHandler) CreateTenant(
+	ctx context.Context,
+	req *authpb.CreateTenantRequest,
+) (*authpb.CreateTenantResponse, error) {
+	if err := h.requirePlatformAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	t, err := h.tenantService.CreateTenant(
+		ctx,
+		req.GetName(),
+		req.GetSlug(),
+		protoToTenantQuotas(req.GetQuotas()),
+		protoToTenantSettings(req.GetSettings()),
+	)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.CreateTenantResponse{
+		Tenant: domainTenantToProto(t),
+	}, nil
+}
+
+// GetTenant retrieves a tenant by ID.
+func (h *GRPCHandler) GetTenant(ctx context.Context, req *authpb.GetTenantRequest) (*authpb.GetTenantResponse, error) {
+	if err := h.requirePlatformAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	tenantID, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid tenant ID")
+	}
+
+	t, err := h.tenantService.GetTenant(ctx, tenantID)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.GetTenantResponse{
+		Tenant: domainTenantToProto(t),
+	}, nil
+}
+
+// ListTenants lists tenants.
+func (h *GRPCHandler) ListTenants(
+	ctx context.Context,
+	req *authpb.ListTenantsRequest,
+) (*authpb.ListTenantsResponse, error) {
+	if err := h.requirePlatformAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	tenants, err := h.tenantService.ListTenants(ctx, int(req.GetLimit()), int(req.GetOffset()))
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	protoTenants := make([]*authpb.Tenant, len(tenants))
+	for i, t := range tenants {
+		protoTenants[i] = domainTenantToProto(t)
+	}
+
+	return &authpb.ListTenantsResponse{
+		Tenants: protoTenants,
+	}, nil
+}
+
+// UpdateTenant updates a tenant.
+func (h *GRPCHandler) UpdateTenant(
+	ctx context.Context,
+	req *authpb.UpdateTenantRequest,
+) (*authpb.UpdateTenantResponse, error) {
+	if err := h.requirePlatformAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	tenantID, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid tenant ID")
+	}
+
+	// Prepare updates
+	updates := make(map[string]interface{})
+
+	if req.GetUpdateMask() != nil {
+		for _, path := range req.GetUpdateMask().GetPaths() {
+			switch path {
+			case "name":
+				updates["name"] = req.GetTenant().GetName()
+			case "active":
+				updates["is_active"] = req.GetTenant().GetActive()
+			case "quotas":
+				updates["quotas"] = protoToTenantQuotas(req.GetTenant().GetQuotas())
+			case "settings":
+				updates["settings"] = protoToTenantSettings(req.GetTenant().GetSettings())
+			}
+		}
+	}
+
+	t, err := h.tenantService.UpdateTenant(ctx, tenantID, updates)
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.UpdateTenantResponse{
+		Tenant: domainTenantToProto(t),
+	}, nil
+}
+
+func domainTenantToProto(t *domain.Tenant) *authpb.Tenant {
+	return &authpb.Tenant{
+		Id:     t.ID.String(),
+		Name:   t.Name,
+		Slug:   t.Slug,
+		Active: t.IsActive,
+		Quotas: &authpb.TenantQuotas{
+			MaxUsers:          int32(t.Quotas.MaxUsers),
+			MaxLibraries:      int32(t.Quotas.MaxLibraries),
+			MaxStorageBytes:   t.Quotas.MaxStorageBytes,
+			MaxActiveStreams:  int32(t.Quotas.MaxActiveStreams),
+			MaxDownloadsQueue: int32(t.Quotas.MaxDownloadsQueue),
+		},
+		Settings: &authpb.TenantSettings{
+			DefaultLanguage:   t.Settings.DefaultLanguage,
+			AllowRegistration: t.Settings.AllowRegistration,
+			MaxStreamQuality:  t.Settings.MaxStreamQuality,
+		},
+		Created: timestamppb.New(t.CreatedAt),
+		Updated: timestamppb.New(t.UpdatedAt),
+	}
+}
+
+func protoToTenantQuotas(q *authpb.TenantQuotas) tenant.Quotas {
+	return tenant.Quotas{
+		MaxUsers:          int(q.GetMaxUsers()),
+		MaxLibraries:      int(q.GetMaxLibraries()),
+		MaxStorageBytes:   q.GetMaxStorageBytes(),
+		MaxActiveStreams:  int(q.GetMaxActiveStreams()),
+		MaxDownloadsQueue: int(q.GetMaxDownloadsQueue()),
+	}
+}
+
+func protoToTenantSettings(s *authpb.TenantSettings) tenant.Settings {
+	return tenant.Settings{
+		DefaultLanguage:   s.GetDefaultLanguage(),
+		AllowRegistration: s.GetAllowRegistration(),
+		MaxStreamQuality:  s.GetMaxStreamQuality(),
+	}
+}
@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	authpb "github.com/narwhalmedia/narwhal/pkg/auth/v1"
+)
+
+func TestTenantRPCs_RequirePlatformAdmin(t *testing.T) {
+	h := &GRPCHandler{}
+	//nolint:staticcheck // the auth interceptor stores claims under this key
+	ctx := context.WithValue(context.Background(), "claims", &auth.CustomClaims{
+		UserID:   uuid.New().String(),
+		TenantID: uuid.New().String(),
+		Roles:    []string{domain.RoleAdmin},
+	})
+
+	_, err := h.CreateTenant(ctx, &authpb.CreateTenantRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = h.GetTenant(ctx, &authpb.GetTenantRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = h.ListTenants(ctx, &authpb.ListTenantsRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = h.UpdateTenant(ctx, &authpb.UpdateTenantRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
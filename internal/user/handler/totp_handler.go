@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	authpb "github.com/narwhalmedia/narwhal/pkg/auth/v1"
+)
+
+// EnableTOTP starts enrolling an authenticator app for the caller.
+func (h *GRPCHandler) EnableTOTP(
+	ctx context.Context,
+	req *authpb.EnableTOTPRequest,
+) (*authpb.EnableTOTPResponse, error) {
+	userID, err := twoFactorCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, uri, err := h.authService.EnableTOTP(ctx, userID, req.GetPassword())
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.EnableTOTPResponse{
+		Secret: secret,
+		Uri:    uri,
+	}, nil
+}
+
+// VerifyTOTP confirms the authenticator app of the caller, enabling
+// two-factor authentication.
+func (h *GRPCHandler) VerifyTOTP(
+	ctx context.Context,
+	req *authpb.VerifyTOTPRequest,
+) (*authpb.VerifyTOTPResponse, error) {
+	userID, err := twoFactorCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, err := h.authService.VerifyTOTP(ctx, userID, req.GetCode())
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.VerifyTOTPResponse{
+		RecoveryCodes: recoveryCodes,
+	}, nil
+}
+
+// DisableTOTP turns two-factor authentication off for the caller.
+func (h *GRPCHandler) DisableTOTP(
+	ctx context.Context,
+	req *authpb.DisableTOTPRequest,
+) (*authpb.DisableTOTPResponse, error) {
+	userID, err := twoFactorCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.authService.DisableTOTP(ctx, userID, req.GetCode()); err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.DisableTOTPResponse{}, nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the caller.
+func (h *GRPCHandler) RegenerateRecoveryCodes(
+	ctx context.Context,
+	req *authpb.RegenerateRecoveryCodesRequest,
+) (*authpb.RegenerateRecoveryCodesResponse, error) {
+	userID, err := twoFactorCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, err := h.authService.RegenerateRecoveryCodes(ctx, userID, req.GetCode())
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	return &authpb.RegenerateRecoveryCodesResponse{
+		RecoveryCodes: recoveryCodes,
+	}, nil
+}
+
+// twoFactorCaller returns the ID of the caller of a two-factor RPC. Only
+// users themselves manage their two-factor authentication, so API keys
+// cannot.
+func twoFactorCaller(ctx context.Context) (uuid.UUID, error) {
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		return uuid.Nil, status.Error(codes.Unauthenticated, "user not authenticated")
+	}
+	if claims := getClaimsFromContext(ctx); claims != nil && claims.IsAPIKey() {
+		return uuid.Nil, status.Error(codes.PermissionDenied, "API keys cannot manage two-factor authentication")
+	}
+	return userID, nil
+}
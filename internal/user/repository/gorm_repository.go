@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/narwhalmedia/narwhal/internal/user/domain"
 	pkgerrors "github.com/narwhalmedia/narwhal/pkg/errors"
@@ -61,6 +63,9 @@ func (r *GormRepository) GetUser(ctx context.Context, id uuid.UUID) (*domain.Use
 		}
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
+	if err := r.loadRoleParents(ctx, user.Roles); err != nil {
+		return nil, err
+	}
 	return &user, nil
 }
 
@@ -72,6 +77,9 @@ func (r *GormRepository) GetUserByUsername(ctx context.Context, username string)
 		}
 		return nil, fmt.Errorf("failed to get user by username: %w", err)
 	}
+	if err := r.loadRoleParents(ctx, user.Roles); err != nil {
+		return nil, err
+	}
 	return &user, nil
 }
 
@@ -83,6 +91,9 @@ func (r *GormRepository) GetUserByEmail(ctx context.Context, email string) (*dom
 		}
 		return nil, fmt.Errorf("failed to get user by email: %w", err)
 	}
+	if err := r.loadRoleParents(ctx, user.Roles); err != nil {
+		return nil, err
+	}
 	return &user, nil
 }
 
@@ -116,6 +127,19 @@ func (r *GormRepository) ListUsers(ctx context.Context, limit, offset int) ([]*d
 	return users, nil
 }
 
+func (r *GormRepository) ListUsersWithRole(ctx context.Context, role string) ([]*domain.User, error) {
+	var users []*domain.User
+	if err := r.db.WithContext(ctx).
+		Joins("JOIN user_roles ON user_roles.user_id = users.id").
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("roles.name = ?", role).
+		Preload("Roles").
+		Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to list users with role %s: %w", role, err)
+	}
+	return users, nil
+}
+
 func (r *GormRepository) CountUsers(ctx context.Context) (int64, error) {
 	var count int64
 	if err := r.db.WithContext(ctx).Model(&domain.User{}).Count(&count).Error; err != nil {
@@ -148,7 +172,10 @@ func (r *GormRepository) CreateRole(ctx context.Context, role *domain.Role) erro
 
 func (r *GormRepository) GetRole(ctx context.Context, id uuid.UUID) (*domain.Role, error) {
 	var role domain.Role
-	if err := r.db.WithContext(ctx).Preload("Permissions").First(&role, "id = ?", id).Error; err != nil {
+	if err := r.db.WithContext(ctx).
+		Preload("Permissions").
+		Preload("Parents").
+		First(&role, "id = ?", id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, pkgerrors.NotFound("role not found")
 		}
@@ -159,7 +186,10 @@ func (r *GormRepository) GetRole(ctx context.Context, id uuid.UUID) (*domain.Rol
 
 func (r *GormRepository) GetRoleByName(ctx context.Context, name string) (*domain.Role, error) {
 	var role domain.Role
-	if err := r.db.WithContext(ctx).Preload("Permissions").First(&role, "name = ?", name).Error; err != nil {
+	if err := r.db.WithContext(ctx).
+		Preload("Permissions").
+		Preload("Parents").
+		First(&role, "name = ?", name).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, pkgerrors.NotFound("role not found")
 		}
@@ -188,7 +218,7 @@ func (r *GormRepository) DeleteRole(ctx context.Context, id uuid.UUID) error {
 
 func (r *GormRepository) ListRoles(ctx context.Context) ([]*domain.Role, error) {
 	var roles []*domain.Role
-	if err := r.db.WithContext(ctx).Preload("Permissions").Find(&roles).Error; err != nil {
+	if err := r.db.WithContext(ctx).Preload("Permissions").Preload("Parents").Find(&roles).Error; err != nil {
 		return nil, fmt.Errorf("failed to list roles: %w", err)
 	}
 	return roles, nil
@@ -226,6 +256,68 @@ func (r *GormRepository) RemovePermissionsFromRole(
 	return nil
 }
 
+// SetRoleParents replaces the roles a role inherits from.
+func (r *GormRepository) SetRoleParents(ctx context.Context, roleID uuid.UUID, parentIDs []uuid.UUID) error {
+	var parents []domain.Role
+	if len(parentIDs) > 0 {
+		if err := r.db.WithContext(ctx).Find(&parents, "id IN ?", parentIDs).Error; err != nil {
+			return fmt.Errorf("failed to find parent roles: %w", err)
+		}
+	}
+
+	if err := r.db.WithContext(ctx).Model(&domain.Role{ID: roleID}).Association("Parents").Replace(&parents); err != nil {
+		return fmt.Errorf("failed to set role parents: %w", err)
+	}
+	return nil
+}
+
+// loadRoleParents attaches each role's full inheritance chain. There are few
+// roles, so the whole hierarchy is loaded in one query and linked in memory.
+func (r *GormRepository) loadRoleParents(ctx context.Context, roles []domain.Role) error {
+	if len(roles) == 0 {
+		return nil
+	}
+
+	var all []domain.Role
+	if err := r.db.WithContext(ctx).Preload("Permissions").Preload("Parents").Find(&all).Error; err != nil {
+		return fmt.Errorf("failed to load role hierarchy: %w", err)
+	}
+
+	byID := make(map[uuid.UUID]*domain.Role, len(all))
+	for i := range all {
+		byID[all[i].ID] = &all[i]
+	}
+
+	for i := range roles {
+		roles[i].Parents = resolveRoleParents(byID, roles[i].ID, map[uuid.UUID]bool{roles[i].ID: true})
+	}
+	return nil
+}
+
+// resolveRoleParents builds the parent tree of a role, skipping any parent
+// already on the current path so cycles terminate.
+func resolveRoleParents(byID map[uuid.UUID]*domain.Role, id uuid.UUID, path map[uuid.UUID]bool) []domain.Role {
+	role, ok := byID[id]
+	if !ok {
+		return nil
+	}
+
+	parents := make([]domain.Role, 0, len(role.Parents))
+	for _, p := range role.Parents {
+		parent, ok := byID[p.ID]
+		if !ok || path[p.ID] {
+			continue
+		}
+
+		resolved := *parent
+		path[p.ID] = true
+		resolved.Parents = resolveRoleParents(byID, p.ID, path)
+		delete(path, p.ID)
+		parents = append(parents, resolved)
+	}
+	return parents
+}
+
 // Permission operations
 
 func (r *GormRepository) CreatePermission(ctx context.Context, permission *domain.Permission) error {
@@ -251,7 +343,8 @@ func (r *GormRepository) GetPermissionByResourceAction(
 	resource, action string,
 ) (*domain.Permission, error) {
 	var permission domain.Permission
-	if err := r.db.WithContext(ctx).First(&permission, "resource = ? AND action = ?", resource, action).Error; err != nil {
+	if err := r.db.WithContext(ctx).
+		First(&permission, "resource = ? AND action = ? AND effect = ?", resource, action, domain.EffectAllow).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, pkgerrors.NotFound("permission not found")
 		}
@@ -342,6 +435,13 @@ func (r *GormRepository) DeleteUserSessions(ctx context.Context, userID uuid.UUI
 	return nil
 }
 
+func (r *GormRepository) DeleteDeviceSessions(ctx context.Context, deviceID uuid.UUID) error {
+	if err := r.db.WithContext(ctx).Delete(&domain.Session{}, "device_id = ?", deviceID).Error; err != nil {
+		return fmt.Errorf("failed to delete device sessions: %w", err)
+	}
+	return nil
+}
+
 func (r *GormRepository) DeleteExpiredSessions(ctx context.Context) error {
 	if err := r.db.WithContext(ctx).Delete(&domain.Session{}, "expires_at < NOW()").Error; err != nil {
 		return fmt.Errorf("failed to delete expired sessions: %w", err)
@@ -356,3 +456,845 @@ func (r *GormRepository) ListUserSessions(ctx context.Context, userID uuid.UUID)
 	}
 	return sessions, nil
 }
+
+// Tenant operations
+
+func (r *GormRepository) CreateTenant(ctx context.Context, tenant *domain.Tenant) error {
+	if err := r.db.WithContext(ctx).Create(tenant).Error; err != nil {
+		if pkgerrors.IsDuplicateError(err) {
+			return pkgerrors.Conflict("tenant slug already exists")
+		}
+		return fmt.Errorf("failed to create tenant: %w", err)
+	}
+	return nil
+}
+
+func (r *GormRepository) GetTenant(ctx context.Context, id uuid.UUID) (*domain.Tenant, error) {
+	var tenant domain.Tenant
+	if err := r.db.WithContext(ctx).First(&tenant, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("tenant not found")
+		}
+		return nil, fmt.Errorf("failed to get tenant: %w", err)
+	}
+	return &tenant, nil
+}
+
+func (r *GormRepository) GetTenantBySlug(ctx context.Context, slug string) (*domain.Tenant, error) {
+	var tenant domain.Tenant
+	if err := r.db.WithContext(ctx).First(&tenant, "slug = ?", slug).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("tenant not found")
+		}
+		return nil, fmt.Errorf("failed to get tenant by slug: %w", err)
+	}
+	return &tenant, nil
+}
+
+func (r *GormRepository) UpdateTenant(ctx context.Context, tenant *domain.Tenant) error {
+	if err := r.db.WithContext(ctx).Save(tenant).Error; err != nil {
+		return fmt.Errorf("failed to update tenant: %w", err)
+	}
+	return nil
+}
+
+func (r *GormRepository) ListTenants(ctx context.Context, limit, offset int) ([]*domain.Tenant, error) {
+	var tenants []*domain.Tenant
+	if err := r.db.WithContext(ctx).Order("name").Limit(limit).Offset(offset).Find(&tenants).Error; err != nil {
+		return nil, fmt.Errorf("failed to list tenants: %w", err)
+	}
+	return tenants, nil
+}
+
+// Invite operations
+
+func (r *GormRepository) CreateInvite(ctx context.Context, invite *domain.Invite) error {
+	if err := r.db.WithContext(ctx).Create(invite).Error; err != nil {
+		return fmt.Errorf("failed to create invite: %w", err)
+	}
+	return nil
+}
+
+func (r *GormRepository) GetInvite(ctx context.Context, id uuid.UUID) (*domain.Invite, error) {
+	var invite domain.Invite
+	if err := r.db.WithContext(ctx).First(&invite, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("invite not found")
+		}
+		return nil, fmt.Errorf("failed to get invite: %w", err)
+	}
+	return &invite, nil
+}
+
+func (r *GormRepository) GetInviteByTokenHash(ctx context.Context, tokenHash string) (*domain.Invite, error) {
+	var invite domain.Invite
+	if err := r.db.WithContext(ctx).First(&invite, "token_hash = ?", tokenHash).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("invite not found")
+		}
+		return nil, fmt.Errorf("failed to get invite by token: %w", err)
+	}
+	return &invite, nil
+}
+
+func (r *GormRepository) ListInvites(ctx context.Context, limit, offset int) ([]*domain.Invite, error) {
+	var invites []*domain.Invite
+	if err := r.db.WithContext(ctx).Order("created_at DESC").Limit(limit).Offset(offset).Find(&invites).Error; err != nil {
+		return nil, fmt.Errorf("failed to list invites: %w", err)
+	}
+	return invites, nil
+}
+
+func (r *GormRepository) RevokeInvite(ctx context.Context, id uuid.UUID) error {
+	result := r.db.WithContext(ctx).Model(&domain.Invite{}).
+		Where("id = ? AND redeemed_at IS NULL AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke invite: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return pkgerrors.Conflict("invite is no longer pending")
+	}
+	return nil
+}
+
+// MarkInviteRedeemed atomically claims a pending invite for a user.
+func (r *GormRepository) MarkInviteRedeemed(ctx context.Context, id, userID uuid.UUID) error {
+	result := r.db.WithContext(ctx).Model(&domain.Invite{}).
+		Where("id = ? AND redeemed_at IS NULL AND revoked_at IS NULL AND expires_at > ?", id, time.Now()).
+		Updates(map[string]interface{}{
+			"redeemed_at": time.Now(),
+			"redeemed_by": userID,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to redeem invite: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return pkgerrors.Conflict("invite is no longer valid")
+	}
+	return nil
+}
+
+// Library grant operations
+
+func (r *GormRepository) CreateLibraryGrants(ctx context.Context, grants []*domain.LibraryGrant) error {
+	if len(grants) == 0 {
+		return nil
+	}
+	if err := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&grants).Error; err != nil {
+		return fmt.Errorf("failed to create library grants: %w", err)
+	}
+	return nil
+}
+
+func (r *GormRepository) ListLibraryGrants(ctx context.Context, userID uuid.UUID) ([]*domain.LibraryGrant, error) {
+	var grants []*domain.LibraryGrant
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Find(&grants).Error; err != nil {
+		return nil, fmt.Errorf("failed to list library grants: %w", err)
+	}
+	return grants, nil
+}
+
+// Registration operations
+
+func (r *GormRepository) CreateEmailVerification(ctx context.Context, verification *domain.EmailVerification) error {
+	if err := r.db.WithContext(ctx).Create(verification).Error; err != nil {
+		return fmt.Errorf("failed to create email verification: %w", err)
+	}
+	return nil
+}
+
+func (r *GormRepository) GetEmailVerificationByTokenHash(
+	ctx context.Context,
+	tokenHash string,
+) (*domain.EmailVerification, error) {
+	var verification domain.EmailVerification
+	if err := r.db.WithContext(ctx).First(&verification, "token_hash = ?", tokenHash).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("email verification not found")
+		}
+		return nil, fmt.Errorf("failed to get email verification by token: %w", err)
+	}
+	return &verification, nil
+}
+
+// MarkEmailVerificationUsed atomically claims an unused verification token.
+func (r *GormRepository) MarkEmailVerificationUsed(ctx context.Context, id uuid.UUID) error {
+	result := r.db.WithContext(ctx).Model(&domain.EmailVerification{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", id, time.Now()).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to mark email verification used: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return pkgerrors.Conflict("verification token is no longer valid")
+	}
+	return nil
+}
+
+func (r *GormRepository) ListPendingApprovals(ctx context.Context, limit, offset int) ([]*domain.User, error) {
+	var users []*domain.User
+	if err := r.db.WithContext(ctx).
+		Where("pending_approval = ?", true).
+		Order("created_at ASC").
+		Limit(limit).
+		Offset(offset).
+		Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to list pending approvals: %w", err)
+	}
+	return users, nil
+}
+
+// Sign-in operations
+
+func (r *GormRepository) CreateSignIn(ctx context.Context, signIn *domain.SignIn) error {
+	if err := r.db.WithContext(ctx).Create(signIn).Error; err != nil {
+		return fmt.Errorf("failed to create sign-in: %w", err)
+	}
+	return nil
+}
+
+func (r *GormRepository) ListSignIns(ctx context.Context, userID uuid.UUID, limit int) ([]*domain.SignIn, error) {
+	var signIns []*domain.SignIn
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&signIns).Error; err != nil {
+		return nil, fmt.Errorf("failed to list sign-ins: %w", err)
+	}
+	return signIns, nil
+}
+
+func (r *GormRepository) CreateLoginChallenge(ctx context.Context, challenge *domain.LoginChallenge) error {
+	if err := r.db.WithContext(ctx).Create(challenge).Error; err != nil {
+		return fmt.Errorf("failed to create login challenge: %w", err)
+	}
+	return nil
+}
+
+func (r *GormRepository) GetLoginChallenge(ctx context.Context, id uuid.UUID) (*domain.LoginChallenge, error) {
+	var challenge domain.LoginChallenge
+	if err := r.db.WithContext(ctx).First(&challenge, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("login challenge not found")
+		}
+		return nil, fmt.Errorf("failed to get login challenge: %w", err)
+	}
+	return &challenge, nil
+}
+
+func (r *GormRepository) UpdateLoginChallenge(ctx context.Context, challenge *domain.LoginChallenge) error {
+	if err := r.db.WithContext(ctx).Save(challenge).Error; err != nil {
+		return fmt.Errorf("failed to update login challenge: %w", err)
+	}
+	return nil
+}
+
+// Identity operations
+
+func (r *GormRepository) CreateUserIdentity(ctx context.Context, identity *domain.UserIdentity) error {
+	if err := r.db.WithContext(ctx).Create(identity).Error; err != nil {
+		if pkgerrors.IsDuplicateError(err) {
+			return pkgerrors.Conflict("identity already linked")
+		}
+		return fmt.Errorf("failed to create user identity: %w", err)
+	}
+	return nil
+}
+
+func (r *GormRepository) GetUserIdentity(
+	ctx context.Context,
+	provider, subject string,
+) (*domain.UserIdentity, error) {
+	var identity domain.UserIdentity
+	if err := r.db.WithContext(ctx).
+		First(&identity, "provider = ? AND subject = ?", provider, subject).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("user identity not found")
+		}
+		return nil, fmt.Errorf("failed to get user identity: %w", err)
+	}
+	return &identity, nil
+}
+
+// API key operations
+
+func (r *GormRepository) CreateAPIKey(ctx context.Context, key *domain.APIKey) error {
+	if err := r.db.WithContext(ctx).Create(key).Error; err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+	return nil
+}
+
+func (r *GormRepository) GetAPIKey(ctx context.Context, id uuid.UUID) (*domain.APIKey, error) {
+	var key domain.APIKey
+	if err := r.db.WithContext(ctx).First(&key, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("API key not found")
+		}
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	return &key, nil
+}
+
+func (r *GormRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*domain.APIKey, error) {
+	var key domain.APIKey
+	if err := r.db.WithContext(ctx).First(&key, "key_hash = ?", keyHash).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("API key not found")
+		}
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	return &key, nil
+}
+
+func (r *GormRepository) ListUserAPIKeys(ctx context.Context, userID uuid.UUID) ([]*domain.APIKey, error) {
+	var keys []*domain.APIKey
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	return keys, nil
+}
+
+func (r *GormRepository) RevokeAPIKey(ctx context.Context, id uuid.UUID, at time.Time) error {
+	if err := r.db.WithContext(ctx).Model(&domain.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", at).Error; err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	return nil
+}
+
+func (r *GormRepository) TouchAPIKey(ctx context.Context, id uuid.UUID, at time.Time) error {
+	if err := r.db.WithContext(ctx).Model(&domain.APIKey{}).
+		Where("id = ?", id).
+		Update("last_used_at", at).Error; err != nil {
+		return fmt.Errorf("failed to touch API key: %w", err)
+	}
+	return nil
+}
+
+// Two-factor operations
+
+func (r *GormRepository) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codes []*domain.RecoveryCode) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&domain.RecoveryCode{}, "user_id = ?", userID).Error; err != nil {
+			return fmt.Errorf("failed to delete recovery codes: %w", err)
+		}
+		if len(codes) > 0 {
+			if err := tx.Create(&codes).Error; err != nil {
+				return fmt.Errorf("failed to create recovery codes: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *GormRepository) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string, at time.Time) error {
+	result := r.db.WithContext(ctx).Model(&domain.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", at)
+	if result.Error != nil {
+		return fmt.Errorf("failed to use recovery code: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return pkgerrors.NotFound("recovery code not found")
+	}
+	return nil
+}
+
+func (r *GormRepository) CountRecoveryCodes(ctx context.Context, userID uuid.UUID) (int, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&domain.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+	return int(count), nil
+}
+
+func (r *GormRepository) DeleteRecoveryCodes(ctx context.Context, userID uuid.UUID) error {
+	if err := r.db.WithContext(ctx).Delete(&domain.RecoveryCode{}, "user_id = ?", userID).Error; err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	return nil
+}
+
+// Preference operations
+
+func (r *GormRepository) ListUserPreferences(ctx context.Context, userID uuid.UUID) ([]*domain.UserPreference, error) {
+	var prefs []*domain.UserPreference
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Find(&prefs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list user preferences: %w", err)
+	}
+	return prefs, nil
+}
+
+func (r *GormRepository) GetDigestDelivery(ctx context.Context, userID uuid.UUID) (*domain.DigestDelivery, error) {
+	var delivery domain.DigestDelivery
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&delivery).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("digest delivery not found")
+		}
+		return nil, fmt.Errorf("failed to get digest delivery: %w", err)
+	}
+	return &delivery, nil
+}
+
+func (r *GormRepository) SaveDigestDelivery(ctx context.Context, delivery *domain.DigestDelivery) error {
+	if err := r.db.WithContext(ctx).Save(delivery).Error; err != nil {
+		return fmt.Errorf("failed to save digest delivery: %w", err)
+	}
+	return nil
+}
+
+func (r *GormRepository) SetUserPreferences(ctx context.Context, prefs []*domain.UserPreference) error {
+	if len(prefs) == 0 {
+		return nil
+	}
+	if err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(&prefs).Error; err != nil {
+		return fmt.Errorf("failed to set user preferences: %w", err)
+	}
+	return nil
+}
+
+func (r *GormRepository) DeleteUserPreferences(ctx context.Context, userID uuid.UUID, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ? AND key IN ?", userID, keys).
+		Delete(&domain.UserPreference{}).Error; err != nil {
+		return fmt.Errorf("failed to delete user preferences: %w", err)
+	}
+	return nil
+}
+
+// Device operations
+
+func (r *GormRepository) CreateDevice(ctx context.Context, device *domain.Device) error {
+	if err := r.db.WithContext(ctx).Create(device).Error; err != nil {
+		if pkgerrors.IsDuplicateError(err) {
+			return pkgerrors.Conflict("device already registered")
+		}
+		return fmt.Errorf("failed to create device: %w", err)
+	}
+	return nil
+}
+
+func (r *GormRepository) GetDevice(ctx context.Context, id uuid.UUID) (*domain.Device, error) {
+	var device domain.Device
+	if err := r.db.WithContext(ctx).First(&device, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("device not found")
+		}
+		return nil, fmt.Errorf("failed to get device: %w", err)
+	}
+	return &device, nil
+}
+
+func (r *GormRepository) GetDeviceByClientID(
+	ctx context.Context,
+	userID uuid.UUID,
+	clientID string,
+) (*domain.Device, error) {
+	var device domain.Device
+	if err := r.db.WithContext(ctx).
+		First(&device, "user_id = ? AND client_id = ?", userID, clientID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("device not found")
+		}
+		return nil, fmt.Errorf("failed to get device by client ID: %w", err)
+	}
+	return &device, nil
+}
+
+func (r *GormRepository) UpdateDevice(ctx context.Context, device *domain.Device) error {
+	if err := r.db.WithContext(ctx).Save(device).Error; err != nil {
+		return fmt.Errorf("failed to update device: %w", err)
+	}
+	return nil
+}
+
+func (r *GormRepository) DeleteDevice(ctx context.Context, id uuid.UUID) error {
+	result := r.db.WithContext(ctx).Delete(&domain.Device{}, "id = ?", id)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete device: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return pkgerrors.NotFound("device not found")
+	}
+	return nil
+}
+
+func (r *GormRepository) ListUserDevices(ctx context.Context, userID uuid.UUID) ([]*domain.Device, error) {
+	var devices []*domain.Device
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("last_seen_at DESC").
+		Find(&devices).Error; err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+	return devices, nil
+}
+
+// Impersonation operations
+
+func (r *GormRepository) CreateImpersonation(ctx context.Context, impersonation *domain.Impersonation) error {
+	if err := r.db.WithContext(ctx).Create(impersonation).Error; err != nil {
+		return fmt.Errorf("failed to create impersonation: %w", err)
+	}
+	return nil
+}
+
+// ListImpersonations lists impersonations newest first. A non-nil userID
+// limits the results to those where the user was the impersonator or target.
+func (r *GormRepository) ListImpersonations(
+	ctx context.Context,
+	userID uuid.UUID,
+	limit, offset int,
+) ([]*domain.Impersonation, error) {
+	query := r.db.WithContext(ctx).Order("created_at DESC").Limit(limit).Offset(offset)
+	if userID != uuid.Nil {
+		query = query.Where("impersonator_id = ? OR target_user_id = ?", userID, userID)
+	}
+
+	var impersonations []*domain.Impersonation
+	if err := query.Find(&impersonations).Error; err != nil {
+		return nil, fmt.Errorf("failed to list impersonations: %w", err)
+	}
+	return impersonations, nil
+}
+
+// Feature flag operations
+
+func (r *GormRepository) CreateFeatureFlag(ctx context.Context, flag *domain.FeatureFlag) error {
+	if err := r.db.WithContext(ctx).Create(flag).Error; err != nil {
+		if pkgerrors.IsDuplicateError(err) {
+			return pkgerrors.Conflict("feature flag already exists")
+		}
+		return fmt.Errorf("failed to create feature flag: %w", err)
+	}
+	return nil
+}
+
+func (r *GormRepository) GetFeatureFlag(ctx context.Context, key string) (*domain.FeatureFlag, error) {
+	var flag domain.FeatureFlag
+	if err := r.db.WithContext(ctx).First(&flag, "key = ?", key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("feature flag not found")
+		}
+		return nil, fmt.Errorf("failed to get feature flag: %w", err)
+	}
+	return &flag, nil
+}
+
+func (r *GormRepository) UpdateFeatureFlag(ctx context.Context, flag *domain.FeatureFlag) error {
+	if err := r.db.WithContext(ctx).Save(flag).Error; err != nil {
+		return fmt.Errorf("failed to update feature flag: %w", err)
+	}
+	return nil
+}
+
+func (r *GormRepository) DeleteFeatureFlag(ctx context.Context, key string) error {
+	result := r.db.WithContext(ctx).Delete(&domain.FeatureFlag{}, "key = ?", key)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete feature flag: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return pkgerrors.NotFound("feature flag not found")
+	}
+	return nil
+}
+
+func (r *GormRepository) ListFeatureFlags(ctx context.Context) ([]*domain.FeatureFlag, error) {
+	var flags []*domain.FeatureFlag
+	if err := r.db.WithContext(ctx).Order("key").Find(&flags).Error; err != nil {
+		return nil, fmt.Errorf("failed to list feature flags: %w", err)
+	}
+	return flags, nil
+}
+
+// Consent operations
+
+func (r *GormRepository) CreateConsentDocument(ctx context.Context, document *domain.ConsentDocument) error {
+	if err := r.db.WithContext(ctx).Create(document).Error; err != nil {
+		if pkgerrors.IsDuplicateError(err) {
+			return pkgerrors.Conflict("document version already exists")
+		}
+		return fmt.Errorf("failed to create consent document: %w", err)
+	}
+	return nil
+}
+
+func (r *GormRepository) GetConsentDocument(ctx context.Context, id uuid.UUID) (*domain.ConsentDocument, error) {
+	var document domain.ConsentDocument
+	if err := r.db.WithContext(ctx).First(&document, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("consent document not found")
+		}
+		return nil, fmt.Errorf("failed to get consent document: %w", err)
+	}
+	return &document, nil
+}
+
+// ListConsentDocuments lists document versions newest first. A non-empty
+// kind limits the results to that kind.
+func (r *GormRepository) ListConsentDocuments(ctx context.Context, kind string) ([]*domain.ConsentDocument, error) {
+	query := r.db.WithContext(ctx).Order("published_at DESC")
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+
+	var documents []*domain.ConsentDocument
+	if err := query.Find(&documents).Error; err != nil {
+		return nil, fmt.Errorf("failed to list consent documents: %w", err)
+	}
+	return documents, nil
+}
+
+// ListPendingConsentDocuments lists the latest version of each kind that
+// the user has not accepted.
+func (r *GormRepository) ListPendingConsentDocuments(
+	ctx context.Context,
+	userID uuid.UUID,
+) ([]*domain.ConsentDocument, error) {
+	var documents []*domain.ConsentDocument
+	if err := r.db.WithContext(ctx).Raw(`
+		SELECT d.* FROM (
+			SELECT DISTINCT ON (kind) * FROM consent_documents
+			ORDER BY kind, published_at DESC
+		) d
+		WHERE NOT EXISTS (
+			SELECT 1 FROM consents c WHERE c.document_id = d.id AND c.user_id = ?
+		)
+		ORDER BY d.kind
+	`, userID).Scan(&documents).Error; err != nil {
+		return nil, fmt.Errorf("failed to list pending consent documents: %w", err)
+	}
+	return documents, nil
+}
+
+// CreateConsents records acceptances. Documents the user already accepted
+// keep their original record.
+func (r *GormRepository) CreateConsents(ctx context.Context, consents []*domain.Consent) error {
+	if len(consents) == 0 {
+		return nil
+	}
+	if err := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&consents).Error; err != nil {
+		return fmt.Errorf("failed to create consents: %w", err)
+	}
+	return nil
+}
+
+func (r *GormRepository) CountConsents(ctx context.Context, documentID uuid.UUID) (int64, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&domain.Consent{}).
+		Where("document_id = ?", documentID).
+		Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to count consents: %w", err)
+	}
+	return count, nil
+}
+
+func (r *GormRepository) HasConsented(ctx context.Context, userID, documentID uuid.UUID) (bool, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&domain.Consent{}).
+		Where("user_id = ? AND document_id = ?", userID, documentID).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check consent: %w", err)
+	}
+	return count > 0, nil
+}
+
+func (r *GormRepository) ListUserConsents(ctx context.Context, userID uuid.UUID) ([]*domain.Consent, error) {
+	var consents []*domain.Consent
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("accepted_at").
+		Find(&consents).Error; err != nil {
+		return nil, fmt.Errorf("failed to list consents: %w", err)
+	}
+	return consents, nil
+}
+
+// Privacy operations
+
+// CreateDataExport creates an export together with the sections that are
+// already known.
+func (r *GormRepository) CreateDataExport(
+	ctx context.Context,
+	export *domain.DataExport,
+	sections []*domain.DataExportSection,
+) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(export).Error; err != nil {
+			return fmt.Errorf("failed to create data export: %w", err)
+		}
+		for _, section := range sections {
+			section.ExportID = export.ID
+		}
+		if len(sections) > 0 {
+			if err := tx.Create(&sections).Error; err != nil {
+				return fmt.Errorf("failed to create data export sections: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *GormRepository) GetDataExport(ctx context.Context, id uuid.UUID) (*domain.DataExport, error) {
+	var export domain.DataExport
+	if err := r.db.WithContext(ctx).First(&export, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("data export not found")
+		}
+		return nil, fmt.Errorf("failed to get data export: %w", err)
+	}
+	return &export, nil
+}
+
+// AddDataExportSection stores a section contributed by another service and
+// returns the export with the section no longer pending. A section that
+// arrives twice keeps its first copy.
+func (r *GormRepository) AddDataExportSection(
+	ctx context.Context,
+	section *domain.DataExportSection,
+) (*domain.DataExport, error) {
+	var export domain.DataExport
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(section).Error; err != nil {
+			return fmt.Errorf("failed to create data export section: %w", err)
+		}
+		if err := tx.Model(&domain.DataExport{}).
+			Where("id = ?", section.ExportID).
+			Update("pending_sections", gorm.Expr("array_remove(pending_sections, ?)", section.Name)).Error; err != nil {
+			return fmt.Errorf("failed to update data export: %w", err)
+		}
+		if err := tx.First(&export, "id = ?", section.ExportID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return pkgerrors.NotFound("data export not found")
+			}
+			return fmt.Errorf("failed to get data export: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func (r *GormRepository) ListDataExportSections(
+	ctx context.Context,
+	exportID uuid.UUID,
+) ([]*domain.DataExportSection, error) {
+	var sections []*domain.DataExportSection
+	if err := r.db.WithContext(ctx).
+		Where("export_id = ?", exportID).
+		Order("name").
+		Find(&sections).Error; err != nil {
+		return nil, fmt.Errorf("failed to list data export sections: %w", err)
+	}
+	return sections, nil
+}
+
+// CompleteDataExport saves an assembled export and drops its sections,
+// which the archive now holds.
+func (r *GormRepository) CompleteDataExport(ctx context.Context, export *domain.DataExport) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(export).Error; err != nil {
+			return fmt.Errorf("failed to save data export: %w", err)
+		}
+		if err := tx.Delete(&domain.DataExportSection{}, "export_id = ?", export.ID).Error; err != nil {
+			return fmt.Errorf("failed to delete data export sections: %w", err)
+		}
+		return nil
+	})
+}
+
+// DeleteExpiredDataExports deletes the exports that expired before the
+// given time, with their sections.
+func (r *GormRepository) DeleteExpiredDataExports(ctx context.Context, before time.Time) (int64, error) {
+	var deleted int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		expired := tx.Model(&domain.DataExport{}).Select("id").Where("expires_at < ?", before)
+		if err := tx.Delete(&domain.DataExportSection{}, "export_id IN (?)", expired).Error; err != nil {
+			return fmt.Errorf("failed to delete data export sections: %w", err)
+		}
+		result := tx.Delete(&domain.DataExport{}, "expires_at < ?", before)
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete data exports: %w", result.Error)
+		}
+		deleted = result.RowsAffected
+		return nil
+	})
+	return deleted, err
+}
+
+// ListUsersDueForDeletion lists users whose account deletion was scheduled
+// before the given time, oldest first.
+func (r *GormRepository) ListUsersDueForDeletion(
+	ctx context.Context,
+	before time.Time,
+	limit int,
+) ([]*domain.User, error) {
+	var users []*domain.User
+	if err := r.db.WithContext(ctx).
+		Where("deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", before).
+		Order("deletion_scheduled_at").
+		Limit(limit).
+		Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to list users due for deletion: %w", err)
+	}
+	return users, nil
+}
+
+// PurgeUserData deletes everything stored about a user other than the user
+// itself. The impersonation audit trail is kept, as it accounts for other
+// users too, but loses the IP addresses of impersonations the user made.
+func (r *GormRepository) PurgeUserData(ctx context.Context, userID uuid.UUID) error {
+	db := r.db.WithContext(ctx)
+
+	for _, model := range []interface{}{
+		&domain.Session{},
+		&domain.Device{},
+		&domain.UserPreference{},
+		&domain.Consent{},
+		&domain.EmailVerification{},
+		&domain.SignIn{},
+		&domain.LoginChallenge{},
+		&domain.UserIdentity{},
+		&domain.APIKey{},
+		&domain.RecoveryCode{},
+		&domain.LibraryGrant{},
+		&domain.DigestDelivery{},
+	} {
+		if err := db.Delete(model, "user_id = ?", userID).Error; err != nil {
+			return fmt.Errorf("failed to purge user data: %w", err)
+		}
+	}
+
+	exports := db.Model(&domain.DataExport{}).Select("id").Where("user_id = ?", userID)
+	if err := db.Delete(&domain.DataExportSection{}, "export_id IN (?)", exports).Error; err != nil {
+		return fmt.Errorf("failed to purge data export sections: %w", err)
+	}
+	if err := db.Delete(&domain.DataExport{}, "user_id = ?", userID).Error; err != nil {
+		return fmt.Errorf("failed to purge data exports: %w", err)
+	}
+
+	if err := db.Model(&domain.Impersonation{}).
+		Where("impersonator_id = ?", userID).
+		Update("ip_address", "").Error; err != nil {
+		return fmt.Errorf("failed to anonymize impersonations: %w", err)
+	}
+
+	return nil
+}
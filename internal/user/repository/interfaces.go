@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -17,6 +18,8 @@ type UserRepository interface {
 	UpdateUser(ctx context.Context, user *domain.User) error
 	DeleteUser(ctx context.Context, id uuid.UUID) error
 	ListUsers(ctx context.Context, limit, offset int) ([]*domain.User, error)
+	// ListUsersWithRole lists the users assigned a role.
+	ListUsersWithRole(ctx context.Context, role string) ([]*domain.User, error)
 	CountUsers(ctx context.Context) (int64, error)
 	UserExists(ctx context.Context, username, email string) (bool, error)
 }
@@ -31,6 +34,7 @@ type RoleRepository interface {
 	ListRoles(ctx context.Context) ([]*domain.Role, error)
 	AssignPermissionsToRole(ctx context.Context, roleID uuid.UUID, permissionIDs []uuid.UUID) error
 	RemovePermissionsFromRole(ctx context.Context, roleID uuid.UUID, permissionIDs []uuid.UUID) error
+	SetRoleParents(ctx context.Context, roleID uuid.UUID, parentIDs []uuid.UUID) error
 }
 
 // PermissionRepository defines methods for permission operations.
@@ -53,6 +57,147 @@ type SessionRepository interface {
 	DeleteUserSessions(ctx context.Context, userID uuid.UUID) error
 	DeleteExpiredSessions(ctx context.Context) error
 	ListUserSessions(ctx context.Context, userID uuid.UUID) ([]*domain.Session, error)
+	DeleteDeviceSessions(ctx context.Context, deviceID uuid.UUID) error
+}
+
+// DeviceRepository defines methods for registered client devices.
+type DeviceRepository interface {
+	CreateDevice(ctx context.Context, device *domain.Device) error
+	GetDevice(ctx context.Context, id uuid.UUID) (*domain.Device, error)
+	GetDeviceByClientID(ctx context.Context, userID uuid.UUID, clientID string) (*domain.Device, error)
+	UpdateDevice(ctx context.Context, device *domain.Device) error
+	DeleteDevice(ctx context.Context, id uuid.UUID) error
+	ListUserDevices(ctx context.Context, userID uuid.UUID) ([]*domain.Device, error)
+}
+
+// ImpersonationRepository defines methods for the impersonation audit trail.
+type ImpersonationRepository interface {
+	CreateImpersonation(ctx context.Context, impersonation *domain.Impersonation) error
+	ListImpersonations(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*domain.Impersonation, error)
+}
+
+// FeatureFlagRepository defines methods for feature flags.
+type FeatureFlagRepository interface {
+	CreateFeatureFlag(ctx context.Context, flag *domain.FeatureFlag) error
+	GetFeatureFlag(ctx context.Context, key string) (*domain.FeatureFlag, error)
+	UpdateFeatureFlag(ctx context.Context, flag *domain.FeatureFlag) error
+	DeleteFeatureFlag(ctx context.Context, key string) error
+	ListFeatureFlags(ctx context.Context) ([]*domain.FeatureFlag, error)
+}
+
+// ConsentRepository defines methods for consent documents and records.
+type ConsentRepository interface {
+	CreateConsentDocument(ctx context.Context, document *domain.ConsentDocument) error
+	GetConsentDocument(ctx context.Context, id uuid.UUID) (*domain.ConsentDocument, error)
+	ListConsentDocuments(ctx context.Context, kind string) ([]*domain.ConsentDocument, error)
+	ListPendingConsentDocuments(ctx context.Context, userID uuid.UUID) ([]*domain.ConsentDocument, error)
+	CreateConsents(ctx context.Context, consents []*domain.Consent) error
+	CountConsents(ctx context.Context, documentID uuid.UUID) (int64, error)
+	HasConsented(ctx context.Context, userID, documentID uuid.UUID) (bool, error)
+	ListUserConsents(ctx context.Context, userID uuid.UUID) ([]*domain.Consent, error)
+}
+
+// PrivacyRepository defines methods for data exports and account deletion.
+type PrivacyRepository interface {
+	CreateDataExport(ctx context.Context, export *domain.DataExport, sections []*domain.DataExportSection) error
+	GetDataExport(ctx context.Context, id uuid.UUID) (*domain.DataExport, error)
+	AddDataExportSection(ctx context.Context, section *domain.DataExportSection) (*domain.DataExport, error)
+	ListDataExportSections(ctx context.Context, exportID uuid.UUID) ([]*domain.DataExportSection, error)
+	CompleteDataExport(ctx context.Context, export *domain.DataExport) error
+	DeleteExpiredDataExports(ctx context.Context, before time.Time) (int64, error)
+	ListUsersDueForDeletion(ctx context.Context, before time.Time, limit int) ([]*domain.User, error)
+	PurgeUserData(ctx context.Context, userID uuid.UUID) error
+}
+
+// TenantRepository defines methods for tenant operations.
+type TenantRepository interface {
+	CreateTenant(ctx context.Context, tenant *domain.Tenant) error
+	GetTenant(ctx context.Context, id uuid.UUID) (*domain.Tenant, error)
+	GetTenantBySlug(ctx context.Context, slug string) (*domain.Tenant, error)
+	UpdateTenant(ctx context.Context, tenant *domain.Tenant) error
+	ListTenants(ctx context.Context, limit, offset int) ([]*domain.Tenant, error)
+}
+
+// InviteRepository defines methods for invite operations.
+type InviteRepository interface {
+	CreateInvite(ctx context.Context, invite *domain.Invite) error
+	GetInvite(ctx context.Context, id uuid.UUID) (*domain.Invite, error)
+	GetInviteByTokenHash(ctx context.Context, tokenHash string) (*domain.Invite, error)
+	ListInvites(ctx context.Context, limit, offset int) ([]*domain.Invite, error)
+	RevokeInvite(ctx context.Context, id uuid.UUID) error
+	MarkInviteRedeemed(ctx context.Context, id, userID uuid.UUID) error
+}
+
+// LibraryGrantRepository defines methods for library access grants.
+type LibraryGrantRepository interface {
+	CreateLibraryGrants(ctx context.Context, grants []*domain.LibraryGrant) error
+	ListLibraryGrants(ctx context.Context, userID uuid.UUID) ([]*domain.LibraryGrant, error)
+}
+
+// RegistrationRepository defines methods for self-service registration.
+type RegistrationRepository interface {
+	CreateEmailVerification(ctx context.Context, verification *domain.EmailVerification) error
+	GetEmailVerificationByTokenHash(ctx context.Context, tokenHash string) (*domain.EmailVerification, error)
+	MarkEmailVerificationUsed(ctx context.Context, id uuid.UUID) error
+	ListPendingApprovals(ctx context.Context, limit, offset int) ([]*domain.User, error)
+}
+
+// SignInRepository defines methods for sign-in history and the challenges
+// of anomalous sign-ins.
+type SignInRepository interface {
+	CreateSignIn(ctx context.Context, signIn *domain.SignIn) error
+	// ListSignIns returns the latest sign-ins of a user, newest first.
+	ListSignIns(ctx context.Context, userID uuid.UUID, limit int) ([]*domain.SignIn, error)
+	CreateLoginChallenge(ctx context.Context, challenge *domain.LoginChallenge) error
+	GetLoginChallenge(ctx context.Context, id uuid.UUID) (*domain.LoginChallenge, error)
+	UpdateLoginChallenge(ctx context.Context, challenge *domain.LoginChallenge) error
+}
+
+// IdentityRepository defines methods for the identities linking users to
+// external identity providers.
+type IdentityRepository interface {
+	CreateUserIdentity(ctx context.Context, identity *domain.UserIdentity) error
+	GetUserIdentity(ctx context.Context, provider, subject string) (*domain.UserIdentity, error)
+}
+
+// APIKeyRepository defines methods for the API keys scripts and
+// integrations authenticate with.
+type APIKeyRepository interface {
+	CreateAPIKey(ctx context.Context, key *domain.APIKey) error
+	GetAPIKey(ctx context.Context, id uuid.UUID) (*domain.APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*domain.APIKey, error)
+	ListUserAPIKeys(ctx context.Context, userID uuid.UUID) ([]*domain.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id uuid.UUID, at time.Time) error
+	// TouchAPIKey records when a key was last used.
+	TouchAPIKey(ctx context.Context, id uuid.UUID, at time.Time) error
+}
+
+// TwoFactorRepository defines methods for the recovery codes of users with
+// two-factor authentication.
+type TwoFactorRepository interface {
+	// ReplaceRecoveryCodes replaces the recovery codes of a user.
+	ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codes []*domain.RecoveryCode) error
+	// UseRecoveryCode marks an unused recovery code of a user as used. It
+	// fails with a not found error if the user has no such code.
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string, at time.Time) error
+	// CountRecoveryCodes counts the unused recovery codes of a user.
+	CountRecoveryCodes(ctx context.Context, userID uuid.UUID) (int, error)
+	DeleteRecoveryCodes(ctx context.Context, userID uuid.UUID) error
+}
+
+// PreferenceRepository defines methods for typed user preferences.
+type PreferenceRepository interface {
+	ListUserPreferences(ctx context.Context, userID uuid.UUID) ([]*domain.UserPreference, error)
+	SetUserPreferences(ctx context.Context, prefs []*domain.UserPreference) error
+	DeleteUserPreferences(ctx context.Context, userID uuid.UUID, keys []string) error
+}
+
+// DigestRepository defines methods for tracking email digests.
+type DigestRepository interface {
+	// GetDigestDelivery returns the last digest delivery of a user. It
+	// fails with a not found error if the user never got a digest.
+	GetDigestDelivery(ctx context.Context, userID uuid.UUID) (*domain.DigestDelivery, error)
+	SaveDigestDelivery(ctx context.Context, delivery *domain.DigestDelivery) error
 }
 
 // Repository aggregates all user-related repositories.
@@ -61,6 +206,21 @@ type Repository interface {
 	RoleRepository
 	PermissionRepository
 	SessionRepository
+	TenantRepository
+	InviteRepository
+	LibraryGrantRepository
+	RegistrationRepository
+	SignInRepository
+	IdentityRepository
+	APIKeyRepository
+	TwoFactorRepository
+	PreferenceRepository
+	DigestRepository
+	DeviceRepository
+	ImpersonationRepository
+	FeatureFlagRepository
+	ConsentRepository
+	PrivacyRepository
 
 	// Transaction support
 	BeginTx(ctx context.Context) (Repository, error)
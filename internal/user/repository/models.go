@@ -9,18 +9,27 @@ import (
 
 // User represents a user in the database.
 type User struct {
-	ID           uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
-	Username     string    `gorm:"uniqueIndex;not null"`
-	Email        string    `gorm:"uniqueIndex;not null"`
-	PasswordHash string    `gorm:"not null"`
-	DisplayName  string
-	Avatar       string
-	IsActive     bool `gorm:"default:true"`
-	IsVerified   bool `gorm:"default:false"`
-	LastLoginAt  *time.Time
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
-	DeletedAt    gorm.DeletedAt `gorm:"index"`
+	ID              uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	TenantID        uuid.UUID `gorm:"type:uuid;not null;default:'00000000-0000-0000-0000-000000000000';index"`
+	Username        string    `gorm:"uniqueIndex;not null"`
+	Email           string    `gorm:"uniqueIndex;not null"`
+	PasswordHash    string    `gorm:"not null"`
+	DisplayName     string
+	Avatar          string
+	AvatarKey       string
+	IsActive        bool `gorm:"default:true"`
+	IsVerified      bool `gorm:"default:false"`
+	PendingApproval bool `gorm:"default:false;index"`
+	// DeletionScheduledAt is when a requested account deletion happens.
+	DeletionScheduledAt *time.Time `gorm:"index"`
+	// TOTPSecret is encrypted; TOTPEnabledAt is set once it is confirmed.
+	TOTPSecret    string
+	TOTPEnabledAt *time.Time
+	TOTPLastStep  int64
+	LastLoginAt   *time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	DeletedAt     gorm.DeletedAt `gorm:"index"`
 
 	// Embedded preferences
 	PrefLanguage            string `gorm:"column:pref_language;default:'en'"`
@@ -47,6 +56,7 @@ type Role struct {
 	// Relationships
 	Permissions []Permission `gorm:"many2many:role_permissions;"`
 	Users       []User       `gorm:"many2many:user_roles;"`
+	Parents     []Role       `gorm:"many2many:role_inheritance;joinForeignKey:RoleID;joinReferences:ParentID"`
 }
 
 // Permission represents a system permission in the database.
@@ -54,6 +64,7 @@ type Permission struct {
 	ID          uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
 	Resource    string    `gorm:"not null;index:idx_permission_resource_action"` // e.g., "library", "media", "user"
 	Action      string    `gorm:"not null;index:idx_permission_resource_action"` // e.g., "read", "write", "delete"
+	Effect      string    `gorm:"not null;default:'allow'"`                      // allow or deny
 	Description string
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
@@ -64,15 +75,22 @@ type Permission struct {
 
 // Session represents an active user session in the database.
 type Session struct {
-	ID           uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
-	UserID       uuid.UUID `gorm:"not null;index"`
-	RefreshToken string    `gorm:"uniqueIndex;not null"`
+	ID           uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	UserID       uuid.UUID  `gorm:"not null;index"`
+	RefreshToken string     `gorm:"uniqueIndex;not null"`
+	DeviceID     *uuid.UUID `gorm:"type:uuid;index"`
 	DeviceInfo   string
 	IPAddress    string
 	UserAgent    string
-	ExpiresAt    time.Time `gorm:"not null;index"`
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
+	// Browser, OS and Platform are parsed from the user agent, and Country
+	// located from the IP address when a locator is configured.
+	Browser   string
+	OS        string
+	Platform  string
+	Country   string
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
 
 	// Relationships
 	User User `gorm:"foreignKey:UserID"`
@@ -92,6 +110,13 @@ type RolePermission struct {
 	CreatedAt    time.Time
 }
 
+// RoleInheritance represents a role inheriting from a parent role.
+type RoleInheritance struct {
+	RoleID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	ParentID  uuid.UUID `gorm:"type:uuid;primaryKey"`
+	CreatedAt time.Time
+}
+
 // TableName customizations.
 func (User) TableName() string {
 	return "users"
@@ -116,3 +141,7 @@ func (UserRole) TableName() string {
 func (RolePermission) TableName() string {
 	return "role_permissions"
 }
+
+func (RoleInheritance) TableName() string {
+	return "role_inheritance"
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/user/constants"
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/internal/user/repository"
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// APIKeyService manages the API keys scripts and integrations call the API
+// with, and validates them for the auth interceptors. A key acts as the
+// user who created it, with the roles the user has when it is used.
+type APIKeyService struct {
+	repo      repository.Repository
+	validator *auth.APIKeys
+	eventBus  interfaces.EventBus
+	logger    interfaces.Logger
+}
+
+// NewAPIKeyService creates a new API key service.
+func NewAPIKeyService(
+	repo repository.Repository,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+) *APIKeyService {
+	return &APIKeyService{
+		repo:      repo,
+		validator: auth.NewAPIKeys(repo, logger),
+		eventBus:  eventBus,
+		logger:    logger,
+	}
+}
+
+// CreateAPIKey creates an API key for a user, valid for ttl or until it is
+// revoked if ttl is zero. It returns the key record and the key, which is
+// not stored and cannot be retrieved later.
+func (s *APIKeyService) CreateAPIKey(
+	ctx context.Context,
+	userID uuid.UUID,
+	name string,
+	ttl time.Duration,
+) (*domain.APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", errors.BadRequest("API key name is required")
+	}
+	if ttl < 0 {
+		return nil, "", errors.BadRequest("API key expiry must not be negative")
+	}
+
+	user, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	keys, err := s.repo.ListUserAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	active := 0
+	now := time.Now()
+	for _, key := range keys {
+		if key.IsActive(now) {
+			active++
+		}
+	}
+	if active >= constants.MaxAPIKeysPerUser {
+		return nil, "", errors.Conflict("too many API keys")
+	}
+
+	secret, err := auth.GenerateRefreshToken()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	plaintext := domain.APIKeyPrefix + secret
+
+	key := &domain.APIKey{
+		ID:        uuid.New(),
+		TenantID:  user.TenantID,
+		UserID:    userID,
+		Name:      name,
+		KeyHash:   domain.HashToken(plaintext),
+		Hint:      domain.APIKeyHint(plaintext),
+		CreatedAt: now,
+	}
+	if ttl > 0 {
+		expiresAt := now.Add(ttl)
+		key.ExpiresAt = &expiresAt
+	}
+	if err := s.repo.CreateAPIKey(ctx, key); err != nil {
+		return nil, "", err
+	}
+
+	s.eventBus.PublishAsync(ctx, events.NewEvent("api_key.created", map[string]interface{}{
+		"api_key_id": key.ID,
+		"user_id":    userID,
+		"name":       name,
+	}))
+
+	s.logger.Info("API key created",
+		interfaces.String("api_key_id", key.ID.String()),
+		interfaces.String("user_id", userID.String()))
+
+	return key, plaintext, nil
+}
+
+// ListAPIKeys lists the API keys of a user, newest first, including
+// revoked and expired ones.
+func (s *APIKeyService) ListAPIKeys(ctx context.Context, userID uuid.UUID) ([]*domain.APIKey, error) {
+	return s.repo.ListUserAPIKeys(ctx, userID)
+}
+
+// RevokeAPIKey revokes an API key of a user so it no longer authenticates
+// requests. Revoking a revoked key does nothing.
+func (s *APIKeyService) RevokeAPIKey(ctx context.Context, userID, id uuid.UUID) (*domain.APIKey, error) {
+	key, err := s.repo.GetAPIKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if key.UserID != userID {
+		return nil, errors.NotFound("API key not found")
+	}
+	if key.RevokedAt != nil {
+		return key, nil
+	}
+
+	now := time.Now()
+	if err := s.repo.RevokeAPIKey(ctx, id, now); err != nil {
+		return nil, err
+	}
+	key.RevokedAt = &now
+
+	s.eventBus.PublishAsync(ctx, events.NewEvent("api_key.revoked", map[string]interface{}{
+		"api_key_id": key.ID,
+		"user_id":    userID,
+	}))
+
+	s.logger.Info("API key revoked",
+		interfaces.String("api_key_id", id.String()),
+		interfaces.String("user_id", userID.String()))
+
+	return key, nil
+}
+
+// ValidateAPIKey returns the claims of a request made with an API key. The
+// user of the key must still be allowed to log in.
+func (s *APIKeyService) ValidateAPIKey(ctx context.Context, plaintext string) (*auth.CustomClaims, error) {
+	return s.validator.ValidateAPIKey(ctx, plaintext)
+}
@@ -0,0 +1,81 @@
+package service_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/internal/user/service"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/logger"
+	"github.com/narwhalmedia/narwhal/pkg/testing/fake"
+)
+
+func TestAPIKeyService(t *testing.T) {
+	ctx := context.Background()
+	repo := fake.NewUserRepository()
+	require.NoError(t, repo.CreateRole(ctx, &domain.Role{Name: domain.RoleUser}))
+	role, err := repo.GetRoleByName(ctx, domain.RoleUser)
+	require.NoError(t, err)
+	sonarr := &domain.User{Username: "sonarr", Email: "sonarr@example.com", IsActive: true, Roles: []domain.Role{*role}}
+	require.NoError(t, sonarr.SetPassword("password123"))
+	require.NoError(t, repo.CreateUser(ctx, sonarr))
+
+	keys := service.NewAPIKeyService(repo, fake.NewEventBus(), logger.NewNoopLogger())
+
+	key, plaintext, err := keys.CreateAPIKey(ctx, sonarr.ID, " Sonarr ", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "Sonarr", key.Name)
+	assert.True(t, strings.HasPrefix(plaintext, domain.APIKeyPrefix))
+	assert.True(t, strings.HasPrefix(plaintext, key.Hint))
+	assert.Nil(t, key.ExpiresAt)
+	assert.NotEqual(t, plaintext, key.KeyHash, "only a hash is stored")
+
+	claims, err := keys.ValidateAPIKey(ctx, plaintext)
+	require.NoError(t, err)
+	assert.Equal(t, sonarr.ID.String(), claims.UserID)
+	assert.Equal(t, []string{domain.RoleUser}, claims.Roles)
+	assert.True(t, claims.IsAPIKey())
+	listed, err := keys.ListAPIKeys(ctx, sonarr.ID)
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.NotNil(t, listed[0].LastUsedAt)
+
+	for _, invalid := range []string{"", "not-a-key", domain.APIKeyPrefix + "forged"} {
+		_, err := keys.ValidateAPIKey(ctx, invalid)
+		assert.True(t, errors.IsUnauthorized(err), invalid)
+	}
+
+	// Keys stop working with their user
+	sonarr.IsActive = false
+	require.NoError(t, repo.UpdateUser(ctx, sonarr))
+	_, err = keys.ValidateAPIKey(ctx, plaintext)
+	assert.True(t, errors.IsForbidden(err))
+	sonarr.IsActive = true
+	require.NoError(t, repo.UpdateUser(ctx, sonarr))
+
+	// Only their owner revokes keys
+	_, err = keys.RevokeAPIKey(ctx, uuid.New(), key.ID)
+	assert.True(t, errors.IsNotFound(err))
+	revoked, err := keys.RevokeAPIKey(ctx, sonarr.ID, key.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, revoked.RevokedAt)
+	_, err = keys.ValidateAPIKey(ctx, plaintext)
+	assert.True(t, errors.IsUnauthorized(err))
+
+	// Expired keys do not work either
+	_, expiring, err := keys.CreateAPIKey(ctx, sonarr.ID, "Radarr", time.Nanosecond)
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond)
+	_, err = keys.ValidateAPIKey(ctx, expiring)
+	assert.True(t, errors.IsUnauthorized(err))
+
+	_, _, err = keys.CreateAPIKey(ctx, sonarr.ID, " ", 0)
+	assert.True(t, errors.IsBadRequest(err))
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/narwhalmedia/narwhal/internal/user/domain"
 	"github.com/narwhalmedia/narwhal/internal/user/repository"
 	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/encryption"
 	"github.com/narwhalmedia/narwhal/pkg/errors"
 	"github.com/narwhalmedia/narwhal/pkg/events"
 	"github.com/narwhalmedia/narwhal/pkg/interfaces"
@@ -21,6 +22,18 @@ type AuthService struct {
 	jwtManager *auth.JWTManager
 	eventBus   interfaces.EventBus
 	logger     interfaces.Logger
+
+	// Sign-in protection, see WithSignInProtection
+	protection *SignInProtection
+	locator    domain.GeoLocator
+	mailer     interfaces.Mailer
+
+	// OpenID Connect providers by name, see WithOIDCProviders
+	oidcProviders map[string]OIDCProvider
+
+	// Two-factor authentication, see WithTOTP
+	totpIssuer string
+	encryptor  *encryption.Encryptor
 }
 
 // NewAuthService creates a new authentication service.
@@ -53,9 +66,8 @@ func (s *AuthService) Login(
 		}
 	}
 
-	// Check if user is active
-	if !user.IsActive {
-		return nil, errors.Forbidden("account is disabled")
+	if err := auth.CheckCanLogin(ctx, s.repo, user); err != nil {
+		return nil, err
 	}
 
 	// Verify password
@@ -63,6 +75,23 @@ func (s *AuthService) Login(
 		return nil, errors.Unauthorized("invalid credentials")
 	}
 
+	signIn, err := s.checkSignIn(ctx, user, deviceInfo, ipAddress, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	return s.startSession(ctx, user, signIn, false, deviceInfo, ipAddress, userAgent)
+}
+
+// startSession creates a session for an authenticated user and returns its
+// tokens. The sign-in, if any, is recorded once the session exists;
+// verified tells whether it was confirmed with a login code.
+func (s *AuthService) startSession(
+	ctx context.Context,
+	user *domain.User,
+	signIn *domain.SignIn,
+	verified bool,
+	deviceInfo, ipAddress, userAgent string,
+) (*domain.AuthTokens, error) {
 	// Generate refresh token
 	refreshToken, err := auth.GenerateRefreshToken()
 	if err != nil {
@@ -70,6 +99,7 @@ func (s *AuthService) Login(
 	}
 
 	// Create session
+	f := domain.ParseUserAgent(userAgent)
 	session := &domain.Session{
 		ID:           uuid.New(),
 		UserID:       user.ID,
@@ -77,14 +107,24 @@ func (s *AuthService) Login(
 		DeviceInfo:   deviceInfo,
 		IPAddress:    ipAddress,
 		UserAgent:    userAgent,
+		Browser:      f.Browser,
+		OS:           f.OS,
+		Platform:     f.Platform,
 		ExpiresAt:    time.Now().Add(7 * 24 * time.Hour), // 7 days
 	}
+	if signIn != nil {
+		session.Country = signIn.Country
+	}
 
 	if err := s.repo.CreateSession(ctx, session); err != nil {
 		return nil, fmt.Errorf("failed to create session: %w", err)
 	}
 
 	// Generate JWT tokens
+	if err := resolveConsent(ctx, s.repo, user); err != nil {
+		_ = s.repo.DeleteSession(ctx, session.ID)
+		return nil, err
+	}
 	tokens, err := s.jwtManager.GenerateTokenPair(user, session.ID)
 	if err != nil {
 		// Rollback session creation
@@ -95,6 +135,11 @@ func (s *AuthService) Login(
 	// Update refresh token in response
 	tokens.RefreshToken = refreshToken
 
+	if signIn != nil {
+		signIn.SessionID = session.ID
+		s.recordSignIn(ctx, user, signIn, verified)
+	}
+
 	// Update last login
 	now := time.Now()
 	user.LastLoginAt = &now
@@ -140,7 +185,10 @@ func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string) (*d
 		return nil, errors.Forbidden("account is disabled")
 	}
 
-	// Generate new tokens
+	// Generate new tokens, picking up consents accepted since the last ones
+	if err := resolveConsent(ctx, s.repo, user); err != nil {
+		return nil, err
+	}
 	tokens, err := s.jwtManager.GenerateTokenPair(user, session.ID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate tokens: %w", err)
@@ -260,3 +308,14 @@ func (s *AuthService) CleanupExpiredSessions(ctx context.Context) error {
 	s.logger.Info("Cleaned up expired sessions")
 	return nil
 }
+
+// resolveConsent marks the user as requiring consent if there are current
+// terms or privacy policy versions they have not accepted.
+func resolveConsent(ctx context.Context, repo repository.Repository, user *domain.User) error {
+	pending, err := repo.ListPendingConsentDocuments(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to check consents: %w", err)
+	}
+	user.ConsentRequired = len(pending) > 0
+	return nil
+}
@@ -62,6 +62,7 @@ func (suite *AuthServiceTestSuite) TestLogin_Success() {
 
 	suite.mockRepo.On("GetUserByUsername", suite.ctx, "testuser").Return(user, nil)
 	suite.mockRepo.On("CreateSession", suite.ctx, mock.AnythingOfType("*domain.Session")).Return(nil)
+	suite.mockRepo.On("ListPendingConsentDocuments", suite.ctx, user.ID).Return([]*domain.ConsentDocument{}, nil)
 	suite.mockRepo.On("UpdateUser", suite.ctx, mock.AnythingOfType("*domain.User")).Return(nil)
 
 	// Act
@@ -76,6 +77,27 @@ func (suite *AuthServiceTestSuite) TestLogin_Success() {
 	suite.Positive(tokens.ExpiresIn)
 }
 
+func (suite *AuthServiceTestSuite) TestLogin_ConsentRequired() {
+	// Arrange
+	user := testutil.CreateTestUser("testuser", "test@example.com")
+	user.SetPassword("password123")
+	terms := &domain.ConsentDocument{ID: uuid.New(), Kind: domain.ConsentKindTerms, Version: "2024-06"}
+
+	suite.mockRepo.On("GetUserByUsername", suite.ctx, "testuser").Return(user, nil)
+	suite.mockRepo.On("CreateSession", suite.ctx, mock.AnythingOfType("*domain.Session")).Return(nil)
+	suite.mockRepo.On("ListPendingConsentDocuments", suite.ctx, user.ID).Return([]*domain.ConsentDocument{terms}, nil)
+	suite.mockRepo.On("UpdateUser", suite.ctx, mock.AnythingOfType("*domain.User")).Return(nil)
+
+	// Act
+	tokens, err := suite.authService.Login(suite.ctx, "testuser", "password123", "Test Device", "127.0.0.1", "Test/1.0")
+
+	// Assert
+	suite.Require().NoError(err)
+	claims, err := suite.jwtManager.ValidateAccessToken(tokens.AccessToken)
+	suite.Require().NoError(err)
+	suite.True(claims.ConsentRequired)
+}
+
 func (suite *AuthServiceTestSuite) TestLogin_InvalidCredentials() {
 	// Arrange
 	user := testutil.CreateTestUser("testuser", "test@example.com")
@@ -144,6 +166,7 @@ func (suite *AuthServiceTestSuite) TestRefreshToken_Success() {
 
 	suite.mockRepo.On("GetSessionByRefreshToken", suite.ctx, session.RefreshToken).Return(session, nil)
 	suite.mockRepo.On("GetUser", suite.ctx, user.ID).Return(user, nil)
+	suite.mockRepo.On("ListPendingConsentDocuments", suite.ctx, user.ID).Return([]*domain.ConsentDocument{}, nil)
 	suite.mockRepo.On("UpdateSession", suite.ctx, mock.AnythingOfType("*domain.Session")).Return(nil)
 
 	// Act
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/internal/user/repository"
+	"github.com/narwhalmedia/narwhal/pkg/assets"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/imaging"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// AvatarService handles avatar uploads and storage.
+type AvatarService struct {
+	repo     repository.Repository
+	assets   *assets.Store
+	cache    interfaces.Cache
+	eventBus interfaces.EventBus
+	logger   interfaces.Logger
+	maxBytes int
+	size     int
+}
+
+// NewAvatarService creates a new avatar service. Uploads larger than maxBytes
+// are rejected and stored avatars are size×size pixels.
+func NewAvatarService(
+	repo repository.Repository,
+	assetStore *assets.Store,
+	cache interfaces.Cache,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+	maxBytes, size int,
+) *AvatarService {
+	return &AvatarService{
+		repo:     repo,
+		assets:   assetStore,
+		cache:    cache,
+		eventBus: eventBus,
+		logger:   logger,
+		maxBytes: maxBytes,
+		size:     size,
+	}
+}
+
+// Start subscribes the service to deleted users, whose avatars are released.
+func (s *AvatarService) Start() error {
+	release := events.NewConsumer("avatars.releaser", 1, s.handleUserDeleted)
+	if err := s.eventBus.Subscribe("user.deleted", release); err != nil {
+		return fmt.Errorf("failed to subscribe to user.deleted: %w", err)
+	}
+	return nil
+}
+
+// UploadAvatar validates, resizes and stores a new avatar for the user,
+// releasing the one it replaces.
+func (s *AvatarService) UploadAvatar(ctx context.Context, userID uuid.UUID, data []byte) (*domain.User, error) {
+	if len(data) == 0 {
+		return nil, errors.BadRequest("avatar image is required")
+	}
+	if len(data) > s.maxBytes {
+		return nil, errors.BadRequest(fmt.Sprintf("avatar image exceeds %d bytes", s.maxBytes))
+	}
+
+	img, _, err := imaging.Decode(data)
+	if err != nil {
+		switch {
+		case stderrors.Is(err, imaging.ErrUnsupportedFormat):
+			return nil, errors.BadRequest("avatar must be a JPEG, PNG or GIF image")
+		case stderrors.Is(err, imaging.ErrTooLarge):
+			return nil, errors.BadRequest("avatar image dimensions are too large")
+		default:
+			return nil, errors.BadRequest("avatar image is corrupt")
+		}
+	}
+
+	encoded, err := imaging.EncodePNG(imaging.SquareThumbnail(img, s.size))
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys are content hashes, so clients never see a cached stale image
+	ref := avatarRef(userID)
+	oldKey := user.AvatarKey
+	asset, err := s.assets.Put(ctx, ref, encoded, ".png")
+	if err != nil {
+		s.release(ctx, ref, oldKey)
+		return nil, err
+	}
+
+	user.AvatarKey = asset.Key
+	user.Avatar = asset.URL
+
+	if err := s.repo.UpdateUser(ctx, user); err != nil {
+		s.release(ctx, ref, oldKey)
+		return nil, err
+	}
+
+	s.release(ctx, ref, asset.Key)
+	_ = s.cache.Delete(ctx, fmt.Sprintf("user:%s", userID.String()))
+
+	s.eventBus.PublishAsync(ctx, events.NewEvent("user.avatar_changed", map[string]interface{}{
+		"user_id": userID,
+		"avatar":  user.Avatar,
+	}))
+
+	s.logger.Info("User avatar uploaded",
+		interfaces.String("user_id", userID.String()),
+		interfaces.Int("bytes", len(encoded)))
+
+	return user, nil
+}
+
+// DeleteAvatar clears the user's avatar and removes any uploaded image.
+func (s *AvatarService) DeleteAvatar(ctx context.Context, userID uuid.UUID) (*domain.User, error) {
+	user, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Avatar == "" && user.AvatarKey == "" {
+		return user, nil
+	}
+
+	user.Avatar = ""
+	user.AvatarKey = ""
+
+	if err := s.repo.UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+
+	s.release(ctx, avatarRef(userID), "")
+	_ = s.cache.Delete(ctx, fmt.Sprintf("user:%s", userID.String()))
+
+	s.eventBus.PublishAsync(ctx, events.NewEvent("user.avatar_changed", map[string]interface{}{
+		"user_id": userID,
+		"avatar":  "",
+	}))
+
+	return user, nil
+}
+
+// handleUserDeleted releases the avatar of a deleted user.
+func (s *AvatarService) handleUserDeleted(ctx context.Context, env *events.Envelope) error {
+	var userID uuid.UUID
+	switch id := env.Payload()["user_id"].(type) {
+	case uuid.UUID:
+		userID = id
+	case string:
+		parsed, err := uuid.Parse(id)
+		if err != nil {
+			return nil
+		}
+		userID = parsed
+	default:
+		return nil
+	}
+	return s.assets.Release(ctx, avatarRef(userID), "")
+}
+
+// release drops the user's avatars other than keep. Failures only delay
+// garbage collection, so they are logged rather than failing the request.
+func (s *AvatarService) release(ctx context.Context, ref assets.Ref, keep string) {
+	if err := s.assets.Release(ctx, ref, keep); err != nil {
+		s.logger.Warn("Failed to release replaced avatar",
+			interfaces.String("user_id", ref.OwnerID.String()),
+			interfaces.Error(err))
+	}
+}
+
+func avatarRef(userID uuid.UUID) assets.Ref {
+	return assets.Ref{OwnerType: assets.OwnerUser, OwnerID: userID, Role: assets.RoleAvatar}
+}
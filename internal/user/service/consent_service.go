@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/internal/user/repository"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+const (
+	// EventConsentDocumentPublished is published when a new version of the
+	// terms or privacy policy is published.
+	EventConsentDocumentPublished = "consent.document_published"
+	// EventUserConsented is published when a user accepts document versions.
+	EventUserConsented = "user.consented"
+)
+
+// ConsentService manages the terms of service and privacy policy versions
+// of hosted deployments and records users accepting them. Once a version
+// is published, tokens issued to users who have not accepted it are marked
+// as requiring consent, and the auth interceptors reject their calls until
+// they accept and refresh their token.
+type ConsentService struct {
+	repo     repository.Repository
+	eventBus interfaces.EventBus
+	logger   interfaces.Logger
+}
+
+// NewConsentService creates a new consent service.
+func NewConsentService(
+	repo repository.Repository,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+) *ConsentService {
+	return &ConsentService{
+		repo:     repo,
+		eventBus: eventBus,
+		logger:   logger,
+	}
+}
+
+// PublishDocument publishes a new version of a document. It becomes the
+// version users must accept.
+func (s *ConsentService) PublishDocument(
+	ctx context.Context,
+	kind, version, documentURL string,
+) (*domain.ConsentDocument, error) {
+	if !domain.ValidConsentKind(kind) {
+		return nil, errors.BadRequest("document kind must be terms or privacy")
+	}
+	version = strings.TrimSpace(version)
+	if version == "" {
+		return nil, errors.BadRequest("document version is required")
+	}
+	if u, err := url.Parse(documentURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, errors.BadRequest("document URL must be absolute")
+	}
+
+	document := &domain.ConsentDocument{
+		Kind:        kind,
+		Version:     version,
+		URL:         documentURL,
+		PublishedAt: time.Now(),
+	}
+	if err := s.repo.CreateConsentDocument(ctx, document); err != nil {
+		return nil, err
+	}
+
+	s.eventBus.PublishAsync(ctx, events.NewAggregateEvent(
+		EventConsentDocumentPublished,
+		document.ID.String(),
+		map[string]interface{}{
+			"document_id": document.ID.String(),
+			"kind":        document.Kind,
+			"version":     document.Version,
+		},
+	))
+
+	s.logger.Info("Consent document published",
+		interfaces.String("document_id", document.ID.String()),
+		interfaces.String("kind", document.Kind),
+		interfaces.String("version", document.Version))
+
+	return document, nil
+}
+
+// ListDocuments lists published document versions newest first. A
+// non-empty kind limits the results to that kind.
+func (s *ConsentService) ListDocuments(ctx context.Context, kind string) ([]*domain.ConsentDocument, error) {
+	if kind != "" && !domain.ValidConsentKind(kind) {
+		return nil, errors.BadRequest("document kind must be terms or privacy")
+	}
+	return s.repo.ListConsentDocuments(ctx, kind)
+}
+
+// PendingDocuments lists the current document versions the user has not
+// accepted.
+func (s *ConsentService) PendingDocuments(ctx context.Context, userID uuid.UUID) ([]*domain.ConsentDocument, error) {
+	return s.repo.ListPendingConsentDocuments(ctx, userID)
+}
+
+// Accept records the user accepting document versions. Accepting a
+// version twice keeps the first acceptance.
+func (s *ConsentService) Accept(
+	ctx context.Context,
+	userID uuid.UUID,
+	documentIDs []uuid.UUID,
+	ipAddress string,
+) error {
+	if len(documentIDs) == 0 {
+		return errors.BadRequest("at least one document is required")
+	}
+
+	now := time.Now()
+	consents := make([]*domain.Consent, 0, len(documentIDs))
+	versions := make([]string, 0, len(documentIDs))
+	for _, id := range documentIDs {
+		document, err := s.repo.GetConsentDocument(ctx, id)
+		if err != nil {
+			return err
+		}
+		consents = append(consents, &domain.Consent{
+			UserID:     userID,
+			DocumentID: document.ID,
+			AcceptedAt: now,
+			IPAddress:  ipAddress,
+		})
+		versions = append(versions, document.Kind+":"+document.Version)
+	}
+
+	if err := s.repo.CreateConsents(ctx, consents); err != nil {
+		return err
+	}
+
+	s.eventBus.PublishAsync(ctx, events.NewAggregateEvent(EventUserConsented, userID.String(), map[string]interface{}{
+		"user_id":  userID.String(),
+		"versions": versions,
+	}))
+
+	s.logger.Info("User accepted consent documents",
+		interfaces.String("user_id", userID.String()),
+		interfaces.Any("versions", versions))
+
+	return nil
+}
+
+// ConsentRequired reports whether the user has current document versions
+// to accept.
+func (s *ConsentService) ConsentRequired(ctx context.Context, userID uuid.UUID) (bool, error) {
+	pending, err := s.repo.ListPendingConsentDocuments(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return len(pending) > 0, nil
+}
+
+// Status reports how many users have accepted a document version, or the
+// current version of each kind if documentID is nil. A non-nil userID also
+// reports whether that user accepted each version.
+func (s *ConsentService) Status(
+	ctx context.Context,
+	documentID, userID uuid.UUID,
+) ([]*domain.ConsentStatus, error) {
+	var documents []*domain.ConsentDocument
+	if documentID != uuid.Nil {
+		document, err := s.repo.GetConsentDocument(ctx, documentID)
+		if err != nil {
+			return nil, err
+		}
+		documents = []*domain.ConsentDocument{document}
+	} else {
+		all, err := s.repo.ListConsentDocuments(ctx, "")
+		if err != nil {
+			return nil, err
+		}
+		documents = currentDocuments(all)
+	}
+
+	users, err := s.repo.CountUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*domain.ConsentStatus, len(documents))
+	for i, document := range documents {
+		accepted, err := s.repo.CountConsents(ctx, document.ID)
+		if err != nil {
+			return nil, err
+		}
+		status := &domain.ConsentStatus{
+			Document: document,
+			Accepted: accepted,
+			Pending:  max(users-accepted, 0),
+		}
+		if userID != uuid.Nil {
+			if status.UserAccepted, err = s.repo.HasConsented(ctx, userID, document.ID); err != nil {
+				return nil, err
+			}
+		}
+		statuses[i] = status
+	}
+
+	return statuses, nil
+}
+
+// currentDocuments picks the latest version of each kind from documents
+// ordered newest first.
+func currentDocuments(documents []*domain.ConsentDocument) []*domain.ConsentDocument {
+	seen := make(map[string]bool)
+	var current []*domain.ConsentDocument
+	for _, document := range documents {
+		if !seen[document.Kind] {
+			seen[document.Kind] = true
+			current = append(current, document)
+		}
+	}
+	return current
+}
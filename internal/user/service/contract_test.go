@@ -0,0 +1,82 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/internal/user/service"
+	"github.com/narwhalmedia/narwhal/pkg/contract"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/logger"
+	"github.com/narwhalmedia/narwhal/pkg/mail"
+	"github.com/narwhalmedia/narwhal/pkg/utils"
+	"github.com/narwhalmedia/narwhal/test/mocks"
+	"github.com/narwhalmedia/narwhal/test/testutil"
+)
+
+func loadContracts(t *testing.T, match func(*contract.Contract) bool) []*contract.Contract {
+	t.Helper()
+	dir, err := contract.Dir()
+	require.NoError(t, err)
+	contracts, err := contract.LoadDir(dir)
+	require.NoError(t, err)
+	return contract.Select(contracts, match)
+}
+
+// TestContracts_Consumer replays the events the user service consumes
+// from other services through its handlers.
+func TestContracts_Consumer(t *testing.T) {
+	repo := new(mocks.MockRepository)
+	bus := contract.NewBus()
+	privacy := service.NewPrivacyService(repo, utils.NewInMemoryCache(), bus, logger.NewNoopLogger())
+	require.NoError(t, privacy.Start())
+	notifier := service.NewRequestNotifier(repo, mail.NewLogMailer(logger.NewNoopLogger()), bus, logger.NewNoopLogger())
+	require.NoError(t, notifier.Start())
+	digests := service.NewDigestService(repo, mail.NewLogMailer(logger.NewNoopLogger()), bus, logger.NewNoopLogger())
+	require.NoError(t, digests.Start())
+
+	requester := testutil.CreateTestUser("alice", "alice@example.com")
+	requester.Preferences.EnableNotifications = true
+	repo.On("GetUser", mock.Anything, mock.AnythingOfType("uuid.UUID")).Return(requester, nil)
+	repo.On("ListUserPreferences", mock.Anything, requester.ID).Return([]*domain.UserPreference{}, nil)
+
+	// Other sections are still pending, so the export is not assembled
+	repo.On("AddDataExportSection", mock.Anything, mock.AnythingOfType("*domain.DataExportSection")).
+		Return(&domain.DataExport{PendingSections: []string{"other"}}, nil)
+
+	require.NoError(t, contract.ReplayEvents(context.Background(), loadContracts(t, contract.ByConsumer("user")), bus))
+	repo.AssertExpectations(t)
+}
+
+// TestContracts_Provider checks the events the user service publishes
+// against the expectations of their consumers.
+func TestContracts_Provider(t *testing.T) {
+	repo := new(mocks.MockRepository)
+	bus := contract.NewBus()
+	users := service.NewUserService(repo, bus, utils.NewInMemoryCache(), logger.NewNoopLogger())
+	ctx := context.Background()
+
+	user := testutil.CreateTestUser("alice", "alice@example.com")
+	repo.On("GetUser", ctx, user.ID).Return(user, nil)
+	repo.On("DeleteUserSessions", ctx, user.ID).Return(nil)
+	repo.On("DeleteUser", ctx, user.ID).Return(nil)
+	require.NoError(t, users.DeleteUser(ctx, user.ID))
+
+	// The user is due their first digest
+	digests := service.NewDigestService(repo, mail.NewLogMailer(logger.NewNoopLogger()), bus, logger.NewNoopLogger())
+	user.Preferences.EnableNotifications = true
+	repo.On("ListUsers", ctx, 100, 0).Return([]*domain.User{user}, nil)
+	repo.On("ListUserPreferences", ctx, user.ID).Return([]*domain.UserPreference{}, nil)
+	repo.On("GetDigestDelivery", ctx, user.ID).Return(nil, errors.NotFound("digest delivery not found"))
+	repo.On("ListLibraryGrants", ctx, user.ID).Return([]*domain.LibraryGrant{}, nil)
+	repo.On("SaveDigestDelivery", ctx, mock.AnythingOfType("*domain.DigestDelivery")).Return(nil)
+	_, err := digests.RequestDue(ctx, time.Now())
+	require.NoError(t, err)
+
+	require.NoError(t, contract.VerifyEvents(loadContracts(t, contract.ByProvider("user")), bus.Published()))
+}
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/internal/user/repository"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// DeviceService handles registered client devices and their settings.
+type DeviceService struct {
+	repo     repository.Repository
+	eventBus interfaces.EventBus
+	logger   interfaces.Logger
+}
+
+// NewDeviceService creates a new device service.
+func NewDeviceService(
+	repo repository.Repository,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+) *DeviceService {
+	return &DeviceService{
+		repo:     repo,
+		eventBus: eventBus,
+		logger:   logger,
+	}
+}
+
+// RegisterSessionDevice registers or refreshes the device a session was
+// created from and links the session to it. Clients that do not report a
+// device ID are not tracked.
+func (s *DeviceService) RegisterSessionDevice(
+	ctx context.Context,
+	refreshToken string,
+	reg domain.DeviceRegistration,
+) (*domain.Device, error) {
+	if reg.ClientID == "" {
+		return nil, nil
+	}
+
+	session, err := s.repo.GetSessionByRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	device, err := s.repo.GetDeviceByClientID(ctx, session.UserID, reg.ClientID)
+	switch {
+	case err == nil:
+		device.Touch(reg)
+		if err := s.repo.UpdateDevice(ctx, device); err != nil {
+			return nil, err
+		}
+	case errors.IsNotFound(err):
+		user, err := s.repo.GetUser(ctx, session.UserID)
+		if err != nil {
+			return nil, err
+		}
+		device = domain.NewDevice(user.ID, user.TenantID, reg)
+		if err := s.repo.CreateDevice(ctx, device); err != nil {
+			return nil, err
+		}
+
+		s.eventBus.PublishAsync(ctx, events.NewEvent("device.registered", map[string]interface{}{
+			"device_id": device.ID,
+			"user_id":   device.UserID,
+			"platform":  device.Platform,
+		}))
+	default:
+		return nil, err
+	}
+
+	session.DeviceID = &device.ID
+	if err := s.repo.UpdateSession(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return device, nil
+}
+
+// TouchSessionDevice records activity for the device behind a session.
+func (s *DeviceService) TouchSessionDevice(ctx context.Context, refreshToken, ipAddress string) error {
+	session, err := s.repo.GetSessionByRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return err
+	}
+	if session.DeviceID == nil {
+		return nil
+	}
+
+	device, err := s.repo.GetDevice(ctx, *session.DeviceID)
+	if err != nil {
+		return err
+	}
+	device.Touch(domain.DeviceRegistration{IPAddress: ipAddress})
+	return s.repo.UpdateDevice(ctx, device)
+}
+
+// ListDevices lists a user's registered devices, most recently seen first.
+func (s *DeviceService) ListDevices(ctx context.Context, userID uuid.UUID) ([]*domain.Device, error) {
+	return s.repo.ListUserDevices(ctx, userID)
+}
+
+// RenameDevice changes a device's display name.
+func (s *DeviceService) RenameDevice(
+	ctx context.Context,
+	userID, deviceID uuid.UUID,
+	name string,
+) (*domain.Device, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.BadRequest("device name is required")
+	}
+
+	device, err := s.getOwnedDevice(ctx, userID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	device.Name = name
+	if err := s.repo.UpdateDevice(ctx, device); err != nil {
+		return nil, err
+	}
+
+	return device, nil
+}
+
+// UpdateDeviceSettings changes per-device settings. Nil values are left unchanged.
+func (s *DeviceService) UpdateDeviceSettings(
+	ctx context.Context,
+	userID, deviceID uuid.UUID,
+	defaultQuality *string,
+	allowDownloads *bool,
+) (*domain.Device, error) {
+	device, err := s.getOwnedDevice(ctx, userID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if defaultQuality != nil {
+		def, _ := domain.LookupPreference(domain.PrefPreferredQuality)
+		quality, err := def.Validate(*defaultQuality)
+		if err != nil {
+			return nil, errors.BadRequest(err.Error())
+		}
+		device.DefaultQuality = quality
+	}
+	if allowDownloads != nil {
+		device.AllowDownloads = *allowDownloads
+	}
+
+	if err := s.repo.UpdateDevice(ctx, device); err != nil {
+		return nil, err
+	}
+
+	s.eventBus.PublishAsync(ctx, events.NewEvent("device.settings_updated", map[string]interface{}{
+		"device_id":       device.ID,
+		"user_id":         device.UserID,
+		"default_quality": device.DefaultQuality,
+		"allow_downloads": device.AllowDownloads,
+	}))
+
+	return device, nil
+}
+
+// RevokeDevice signs a device out of all its sessions and forgets it.
+// Signing in again registers it as a new device.
+func (s *DeviceService) RevokeDevice(ctx context.Context, userID, deviceID uuid.UUID) error {
+	device, err := s.getOwnedDevice(ctx, userID, deviceID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := revokeDevice(ctx, tx, device.ID); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit device revocation: %w", err)
+	}
+
+	s.eventBus.PublishAsync(ctx, events.NewEvent("device.revoked", map[string]interface{}{
+		"device_id": device.ID,
+		"user_id":   device.UserID,
+	}))
+
+	s.logger.Info("Device revoked",
+		interfaces.String("device_id", device.ID.String()),
+		interfaces.String("user_id", device.UserID.String()))
+
+	return nil
+}
+
+// getOwnedDevice loads a device, hiding devices that belong to other users.
+func (s *DeviceService) getOwnedDevice(ctx context.Context, userID, deviceID uuid.UUID) (*domain.Device, error) {
+	device, err := s.repo.GetDevice(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device.UserID != userID {
+		return nil, errors.NotFound("device not found")
+	}
+	return device, nil
+}
+
+// revokeDevice deletes a device and its sessions within tx.
+func revokeDevice(ctx context.Context, tx repository.Repository, deviceID uuid.UUID) error {
+	if err := tx.DeleteDeviceSessions(ctx, deviceID); err != nil {
+		return err
+	}
+	return tx.DeleteDevice(ctx, deviceID)
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/internal/user/repository"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/i18n"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// Digest events.
+const (
+	// EventDigestRequested asks the library to compose the digest of a user.
+	EventDigestRequested = "user.digest_requested"
+	// EventDigestComposed carries the digest the library composed.
+	EventDigestComposed = "user.digest_composed"
+)
+
+// digestPageSize is the number of users checked for due digests at once.
+const digestPageSize = 100
+
+// DigestService emails users a digest of the titles added to the libraries
+// they can access, the upcoming episodes of the series on their watchlist
+// and the status of their content requests, daily or weekly as set in
+// their digest_frequency preference. The library composes the digests in
+// reply to user.digest_requested events. Users who turned digests or
+// notifications off are not emailed, nor are users with nothing to tell.
+type DigestService struct {
+	repo     repository.Repository
+	mailer   interfaces.Mailer
+	eventBus interfaces.EventBus
+	logger   interfaces.Logger
+}
+
+// NewDigestService creates a new digest service.
+func NewDigestService(
+	repo repository.Repository,
+	mailer interfaces.Mailer,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+) *DigestService {
+	return &DigestService{
+		repo:     repo,
+		mailer:   mailer,
+		eventBus: eventBus,
+		logger:   logger,
+	}
+}
+
+// Start subscribes the service to composed digests.
+func (s *DigestService) Start() error {
+	send := events.NewConsumer("users.digest", 1, s.handleDigestComposed)
+	if err := s.eventBus.Subscribe(EventDigestComposed, send); err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", EventDigestComposed, err)
+	}
+	return nil
+}
+
+// RequestDue requests the digests due at now and returns how many were
+// requested. A user's first digest covers one period; later ones cover
+// the time since the last.
+func (s *DigestService) RequestDue(ctx context.Context, now time.Time) (int, error) {
+	requested := 0
+	for offset := 0; ; offset += digestPageSize {
+		users, err := s.repo.ListUsers(ctx, digestPageSize, offset)
+		if err != nil {
+			return requested, err
+		}
+		for _, user := range users {
+			ok, err := s.requestDue(ctx, user, now)
+			if err != nil {
+				return requested, err
+			}
+			if ok {
+				requested++
+			}
+		}
+		if len(users) < digestPageSize {
+			return requested, nil
+		}
+	}
+}
+
+// requestDue requests the digest of a user if it is due.
+func (s *DigestService) requestDue(ctx context.Context, user *domain.User, now time.Time) (bool, error) {
+	if !user.IsActive || user.PendingApproval || !user.Preferences.EnableNotifications {
+		return false, nil
+	}
+	period, err := s.digestPeriod(ctx, user)
+	if err != nil || period == 0 {
+		return false, err
+	}
+
+	since := now.Add(-period)
+	delivery, err := s.repo.GetDigestDelivery(ctx, user.ID)
+	switch {
+	case errors.IsNotFound(err):
+		delivery = &domain.DigestDelivery{UserID: user.ID, TenantID: user.TenantID}
+	case err != nil:
+		return false, err
+	case !delivery.Due(period, now):
+		return false, nil
+	default:
+		since = delivery.SentAt
+	}
+
+	// Users without grants can access every library
+	grants, err := s.repo.ListLibraryGrants(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+	libraryIDs := make([]string, len(grants))
+	for i, grant := range grants {
+		libraryIDs[i] = grant.LibraryID.String()
+	}
+
+	delivery.SentAt = now
+	if err := s.repo.SaveDigestDelivery(ctx, delivery); err != nil {
+		return false, err
+	}
+	s.eventBus.PublishAsync(ctx, events.NewAggregateEvent(EventDigestRequested, user.ID.String(), map[string]interface{}{
+		"user_id":     user.ID.String(),
+		"since":       since.Format(time.RFC3339),
+		"until":       now.Format(time.RFC3339),
+		"library_ids": libraryIDs,
+	}))
+	return true, nil
+}
+
+// digestPeriod returns the period of a user's digests, or zero if they
+// turned digests off.
+func (s *DigestService) digestPeriod(ctx context.Context, user *domain.User) (time.Duration, error) {
+	stored, err := s.repo.ListUserPreferences(ctx, user.ID)
+	if err != nil {
+		return 0, err
+	}
+	frequency := domain.ResolvePreferences(user.Preferences, stored)[domain.PrefDigestFrequency]
+	return domain.DigestPeriod(frequency), nil
+}
+
+// handleDigestComposed emails a composed digest to its user.
+func (s *DigestService) handleDigestComposed(ctx context.Context, env *events.Envelope) error {
+	payload := env.Payload()
+	userID, err := uuid.Parse(fmt.Sprint(payload["user_id"]))
+	if err != nil {
+		return nil
+	}
+	var digest domain.Digest
+	data, _ := payload["digest"].(string)
+	if err := json.Unmarshal([]byte(data), &digest); err != nil {
+		s.logger.Warn("Dropping malformed digest",
+			interfaces.String("user_id", userID.String()),
+			interfaces.Error(err))
+		return nil
+	}
+	if digest.Empty() {
+		return nil
+	}
+
+	user, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	// Users may have opted out since the digest was requested
+	if !user.Preferences.EnableNotifications {
+		return nil
+	}
+	period, err := s.digestPeriod(ctx, user)
+	if err != nil || period == 0 {
+		return err
+	}
+
+	since, _ := time.Parse(time.RFC3339, fmt.Sprint(payload["since"]))
+	lang := userLanguage(ctx, user)
+	subject := i18n.T(lang, "email.digest.subject.weekly")
+	if period < domain.DigestPeriod(domain.DigestWeekly) {
+		subject = i18n.T(lang, "email.digest.subject.daily")
+	}
+	body := s.digestBody(lang, user, since, &digest)
+	if err := s.mailer.Send(ctx, user.Email, subject, body); err != nil {
+		// Digests are best effort
+		s.logger.Error("Failed to send digest",
+			interfaces.String("user_id", userID.String()),
+			interfaces.Error(err))
+	}
+	return nil
+}
+
+// digestBody renders a digest in the user's language, with dates in their
+// time zone.
+func (s *DigestService) digestBody(lang string, user *domain.User, since time.Time, digest *domain.Digest) string {
+	if loc, err := time.LoadLocation(user.Preferences.TimeZone); err == nil {
+		since = since.In(loc)
+	}
+
+	var b strings.Builder
+	b.WriteString(i18n.T(lang, "email.digest.greeting", user.Username, since.Format(time.DateOnly)))
+	if len(digest.Added) > 0 {
+		b.WriteString(i18n.T(lang, "email.digest.added"))
+		for _, t := range digest.Added {
+			b.WriteString(i18n.T(lang, "email.digest.title", titleWithYear(t.Title, t.Year)))
+		}
+	}
+	if len(digest.Upcoming) > 0 {
+		b.WriteString(i18n.T(lang, "email.digest.upcoming"))
+		for _, e := range digest.Upcoming {
+			b.WriteString(i18n.T(lang, "email.digest.episode", e.Series, e.SeasonNumber, e.EpisodeNumber, e.AirDate))
+		}
+	}
+	if len(digest.Requests) > 0 {
+		b.WriteString(i18n.T(lang, "email.digest.requests"))
+		for _, r := range digest.Requests {
+			b.WriteString(i18n.T(lang, "email.digest.request",
+				titleWithYear(r.Title, r.Year), i18n.T(lang, "email.digest.status."+r.Status)))
+		}
+	}
+	b.WriteString(i18n.T(lang, "email.digest.footer"))
+	return b.String()
+}
+
+func titleWithYear(title string, year int) string {
+	if year == 0 {
+		return title
+	}
+	return fmt.Sprintf("%s (%d)", title, year)
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/narwhalmedia/narwhal/internal/user/constants"
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/internal/user/repository"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+const (
+	// EventFeatureFlagChanged is published when a flag is created or updated.
+	EventFeatureFlagChanged = "feature_flag.changed"
+	// EventFeatureFlagDeleted is published when a flag is deleted.
+	EventFeatureFlagDeleted = "feature_flag.deleted"
+
+	featureFlagsCacheKey = "feature_flags"
+)
+
+// FlagEvaluation is the result of evaluating a flag for a user.
+type FlagEvaluation struct {
+	Key     string
+	Enabled bool
+	Reason  string
+}
+
+// FeatureFlagService manages feature flags and evaluates them for users.
+// All flags are cached together, and the cache is dropped whenever a flag
+// changes.
+type FeatureFlagService struct {
+	repo     repository.Repository
+	cache    interfaces.Cache
+	eventBus interfaces.EventBus
+	logger   interfaces.Logger
+}
+
+// NewFeatureFlagService creates a new feature flag service.
+func NewFeatureFlagService(
+	repo repository.Repository,
+	cache interfaces.Cache,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+) *FeatureFlagService {
+	return &FeatureFlagService{
+		repo:     repo,
+		cache:    cache,
+		eventBus: eventBus,
+		logger:   logger,
+	}
+}
+
+// Start subscribes the service to the events that invalidate cached flags.
+func (s *FeatureFlagService) Start() error {
+	invalidate := events.NewConsumer("feature_flags.invalidator", 1, func(ctx context.Context, _ *events.Envelope) error {
+		s.invalidate(ctx)
+		return nil
+	})
+	for _, eventType := range []string{EventFeatureFlagChanged, EventFeatureFlagDeleted} {
+		if err := s.eventBus.Subscribe(eventType, invalidate); err != nil {
+			return fmt.Errorf("failed to subscribe to %s: %w", eventType, err)
+		}
+	}
+	return nil
+}
+
+// CreateFeatureFlag creates a new flag.
+func (s *FeatureFlagService) CreateFeatureFlag(
+	ctx context.Context,
+	key, description string,
+	enabled bool,
+	percentage int,
+	userIDs []string,
+) (*domain.FeatureFlag, error) {
+	key = strings.TrimSpace(key)
+	if !domain.ValidFeatureFlagKey(key) {
+		return nil, errors.BadRequest("flag key must be lowercase letters, digits, dots and underscores")
+	}
+	if err := validatePercentage(percentage); err != nil {
+		return nil, err
+	}
+
+	flag := &domain.FeatureFlag{
+		Key:         key,
+		Description: description,
+		Enabled:     enabled,
+		Percentage:  percentage,
+		UserIDs:     userIDs,
+	}
+	if err := s.repo.CreateFeatureFlag(ctx, flag); err != nil {
+		return nil, err
+	}
+
+	s.flagChanged(ctx, flag)
+	return flag, nil
+}
+
+// UpdateFeatureFlag updates a flag's description, state, percentage or
+// users.
+func (s *FeatureFlagService) UpdateFeatureFlag(
+	ctx context.Context,
+	key string,
+	updates map[string]interface{},
+) (*domain.FeatureFlag, error) {
+	flag, err := s.repo.GetFeatureFlag(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if description, ok := updates["description"].(string); ok {
+		flag.Description = description
+	}
+	if enabled, ok := updates["enabled"].(bool); ok {
+		flag.Enabled = enabled
+	}
+	if percentage, ok := updates["percentage"].(int); ok {
+		if err := validatePercentage(percentage); err != nil {
+			return nil, err
+		}
+		flag.Percentage = percentage
+	}
+	if userIDs, ok := updates["user_ids"].([]string); ok {
+		flag.UserIDs = userIDs
+	}
+
+	if err := s.repo.UpdateFeatureFlag(ctx, flag); err != nil {
+		return nil, err
+	}
+
+	s.flagChanged(ctx, flag)
+	return flag, nil
+}
+
+// DeleteFeatureFlag deletes a flag. Deleted flags evaluate to off.
+func (s *FeatureFlagService) DeleteFeatureFlag(ctx context.Context, key string) error {
+	if err := s.repo.DeleteFeatureFlag(ctx, key); err != nil {
+		return err
+	}
+
+	s.invalidate(ctx)
+	s.eventBus.PublishAsync(ctx, events.NewAggregateEvent(EventFeatureFlagDeleted, key, map[string]interface{}{
+		"key": key,
+	}))
+
+	s.logger.Info("Feature flag deleted", interfaces.String("key", key))
+	return nil
+}
+
+// ListFeatureFlags lists all flags ordered by key.
+func (s *FeatureFlagService) ListFeatureFlags(ctx context.Context) ([]*domain.FeatureFlag, error) {
+	if cached, err := s.cache.Get(ctx, featureFlagsCacheKey); err == nil {
+		if flags, ok := cached.([]*domain.FeatureFlag); ok {
+			return flags, nil
+		}
+	}
+
+	flags, err := s.repo.ListFeatureFlags(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_ = s.cache.Set(ctx, featureFlagsCacheKey, flags, constants.CacheTTL)
+	return flags, nil
+}
+
+// Evaluate reports whether a flag is on for the user. Unknown flags are off.
+func (s *FeatureFlagService) Evaluate(ctx context.Context, key, userID string) (bool, error) {
+	results, err := s.EvaluateAll(ctx, userID, []string{key})
+	if err != nil {
+		return false, err
+	}
+	return results[0].Enabled, nil
+}
+
+// EvaluateAll evaluates flags for the user, in the order of keys. All flags
+// are evaluated if keys is empty.
+func (s *FeatureFlagService) EvaluateAll(
+	ctx context.Context,
+	userID string,
+	keys []string,
+) ([]FlagEvaluation, error) {
+	flags, err := s.ListFeatureFlags(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		results := make([]FlagEvaluation, len(flags))
+		for i, flag := range flags {
+			enabled, reason := flag.Evaluate(userID)
+			results[i] = FlagEvaluation{Key: flag.Key, Enabled: enabled, Reason: reason}
+		}
+		return results, nil
+	}
+
+	byKey := make(map[string]*domain.FeatureFlag, len(flags))
+	for _, flag := range flags {
+		byKey[flag.Key] = flag
+	}
+
+	results := make([]FlagEvaluation, len(keys))
+	for i, key := range keys {
+		results[i] = FlagEvaluation{Key: key, Reason: domain.FlagReasonUnknown}
+		if flag, ok := byKey[key]; ok {
+			results[i].Enabled, results[i].Reason = flag.Evaluate(userID)
+		}
+	}
+	return results, nil
+}
+
+func (s *FeatureFlagService) flagChanged(ctx context.Context, flag *domain.FeatureFlag) {
+	s.invalidate(ctx)
+	s.eventBus.PublishAsync(ctx, events.NewAggregateEvent(EventFeatureFlagChanged, flag.Key, map[string]interface{}{
+		"key":        flag.Key,
+		"enabled":    flag.Enabled,
+		"percentage": flag.Percentage,
+	}))
+
+	s.logger.Info("Feature flag changed",
+		interfaces.String("key", flag.Key),
+		interfaces.Bool("enabled", flag.Enabled),
+		interfaces.Int("percentage", flag.Percentage))
+}
+
+func (s *FeatureFlagService) invalidate(ctx context.Context) {
+	_ = s.cache.Delete(ctx, featureFlagsCacheKey)
+}
+
+func validatePercentage(percentage int) error {
+	if percentage < 0 || percentage > 100 {
+		return errors.BadRequest("percentage must be between 0 and 100")
+	}
+	return nil
+}
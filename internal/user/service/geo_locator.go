@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+)
+
+// HTTPGeoLocator locates IP addresses with a JSON geolocation API, such as
+// a self-hosted ipapi or echoip instance.
+type HTTPGeoLocator struct {
+	urlTemplate string
+	client      *http.Client
+}
+
+var _ domain.GeoLocator = (*HTTPGeoLocator)(nil)
+
+// NewHTTPGeoLocator creates a locator querying urlTemplate with "{ip}"
+// replaced by the address. Responses are JSON objects with the country
+// code in country_code or country_iso, and latitude and longitude.
+func NewHTTPGeoLocator(urlTemplate string, timeout time.Duration) *HTTPGeoLocator {
+	return &HTTPGeoLocator{
+		urlTemplate: urlTemplate,
+		client:      &http.Client{Timeout: timeout},
+	}
+}
+
+// Locate returns where an IP address is. Private, loopback and invalid
+// addresses are not located.
+func (l *HTTPGeoLocator) Locate(ctx context.Context, ip string) (*domain.GeoLocation, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsUnspecified() {
+		return nil, nil
+	}
+
+	target := strings.ReplaceAll(l.urlTemplate, "{ip}", url.PathEscape(addr.Unmap().String()))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create geolocation request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("geolocation request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("geolocation request failed with status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		CountryCode string   `json:"country_code"`
+		CountryISO  string   `json:"country_iso"`
+		Latitude    *float64 `json:"latitude"`
+		Longitude   *float64 `json:"longitude"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode geolocation: %w", err)
+	}
+	country := body.CountryCode
+	if country == "" {
+		country = body.CountryISO
+	}
+	if country == "" || body.Latitude == nil || body.Longitude == nil {
+		return nil, nil
+	}
+	return &domain.GeoLocation{
+		Country:   strings.ToUpper(country),
+		Latitude:  *body.Latitude,
+		Longitude: *body.Longitude,
+	}, nil
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/user/constants"
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/internal/user/repository"
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// ImpersonationService lets admins act as another user to reproduce issues.
+// Every impersonation is recorded before its token is issued.
+type ImpersonationService struct {
+	repo       repository.Repository
+	jwtManager *auth.JWTManager
+	eventBus   interfaces.EventBus
+	logger     interfaces.Logger
+	ttl        time.Duration
+}
+
+// NewImpersonationService creates a new impersonation service.
+func NewImpersonationService(
+	repo repository.Repository,
+	jwtManager *auth.JWTManager,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+	ttl time.Duration,
+) *ImpersonationService {
+	return &ImpersonationService{
+		repo:       repo,
+		jwtManager: jwtManager,
+		eventBus:   eventBus,
+		logger:     logger,
+		ttl:        ttl,
+	}
+}
+
+// Impersonate issues a short-lived access token acting as the target user.
+// Admins cannot impersonate themselves, other admins or disabled accounts.
+func (s *ImpersonationService) Impersonate(
+	ctx context.Context,
+	impersonatorID, targetID uuid.UUID,
+	reason, ipAddress string,
+) (*domain.Impersonation, *domain.AuthTokens, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, nil, errors.BadRequest("a reason is required to impersonate a user")
+	}
+	if impersonatorID == targetID {
+		return nil, nil, errors.BadRequest("cannot impersonate yourself")
+	}
+
+	target, err := s.repo.GetUser(ctx, targetID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if target.HasRole(domain.RoleAdmin) {
+		return nil, nil, errors.Forbidden("cannot impersonate an admin")
+	}
+	if !target.IsActive {
+		return nil, nil, errors.Forbidden("account is disabled")
+	}
+
+	impersonation := &domain.Impersonation{
+		ID:             uuid.New(),
+		TenantID:       target.TenantID,
+		ImpersonatorID: impersonatorID,
+		TargetUserID:   target.ID,
+		Reason:         reason,
+		IPAddress:      ipAddress,
+		ExpiresAt:      time.Now().Add(s.ttl),
+	}
+	if err := s.repo.CreateImpersonation(ctx, impersonation); err != nil {
+		return nil, nil, err
+	}
+
+	tokens, err := s.jwtManager.GenerateImpersonationToken(target, impersonatorID, impersonation.ID, s.ttl)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.eventBus.PublishAsync(ctx, events.NewEvent("user.impersonation_started", map[string]interface{}{
+		"impersonation_id": impersonation.ID,
+		"impersonator_id":  impersonatorID,
+		"user_id":          target.ID,
+		"reason":           reason,
+		"ip_address":       ipAddress,
+	}))
+
+	s.logger.Warn("Admin started impersonating user",
+		interfaces.String("impersonation_id", impersonation.ID.String()),
+		interfaces.String("impersonator_id", impersonatorID.String()),
+		interfaces.String("user_id", target.ID.String()),
+		interfaces.String("reason", reason))
+
+	return impersonation, tokens, nil
+}
+
+// ListImpersonations returns the impersonation audit trail, optionally
+// limited to impersonations involving userID.
+func (s *ImpersonationService) ListImpersonations(
+	ctx context.Context,
+	userID uuid.UUID,
+	limit, offset int,
+) ([]*domain.Impersonation, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > constants.MaxPageSize {
+		limit = constants.MaxPageSize
+	}
+
+	return s.repo.ListImpersonations(ctx, userID, limit, offset)
+}
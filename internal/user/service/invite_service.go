@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/user/constants"
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/internal/user/repository"
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/tenant"
+)
+
+// InviteService handles invitation-based onboarding.
+type InviteService struct {
+	repo     repository.Repository
+	eventBus interfaces.EventBus
+	logger   interfaces.Logger
+}
+
+// NewInviteService creates a new invite service.
+func NewInviteService(
+	repo repository.Repository,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+) *InviteService {
+	return &InviteService{
+		repo:     repo,
+		eventBus: eventBus,
+		logger:   logger,
+	}
+}
+
+// CreateInvite creates an invite and returns it with its plaintext token.
+// The token is only available at creation time.
+func (s *InviteService) CreateInvite(
+	ctx context.Context,
+	createdBy uuid.UUID,
+	email, role string,
+	libraryIDs []uuid.UUID,
+	ttl time.Duration,
+) (*domain.Invite, string, error) {
+	if ttl <= 0 {
+		ttl = constants.DefaultInviteTTL
+	}
+	if ttl > constants.MaxInviteTTL {
+		return nil, "", errors.BadRequest("invite expiry is too long")
+	}
+
+	if role == "" {
+		role = domain.RoleUser
+	}
+	if _, err := s.repo.GetRoleByName(ctx, role); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, "", errors.BadRequest("unknown role: " + role)
+		}
+		return nil, "", err
+	}
+
+	token, err := auth.GenerateRefreshToken()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate invite token: %w", err)
+	}
+
+	tenantID, _ := tenant.FromContext(ctx)
+
+	invite := &domain.Invite{
+		ID:         uuid.New(),
+		TenantID:   tenantID,
+		TokenHash:  domain.HashToken(token),
+		Email:      strings.ToLower(strings.TrimSpace(email)),
+		Role:       role,
+		LibraryIDs: make([]string, len(libraryIDs)),
+		CreatedBy:  createdBy,
+		ExpiresAt:  time.Now().Add(ttl),
+	}
+	for i, id := range libraryIDs {
+		invite.LibraryIDs[i] = id.String()
+	}
+
+	if err := s.repo.CreateInvite(ctx, invite); err != nil {
+		return nil, "", err
+	}
+
+	s.eventBus.PublishAsync(ctx, events.NewEvent("invite.created", map[string]interface{}{
+		"invite_id":  invite.ID,
+		"tenant_id":  invite.TenantID,
+		"created_by": createdBy,
+		"email":      invite.Email,
+	}))
+
+	s.logger.Info("Invite created",
+		interfaces.String("invite_id", invite.ID.String()),
+		interfaces.String("role", role))
+
+	return invite, token, nil
+}
+
+// ListInvites lists invites with pagination.
+func (s *InviteService) ListInvites(ctx context.Context, limit, offset int) ([]*domain.Invite, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > constants.MaxPageSize {
+		limit = constants.MaxPageSize
+	}
+
+	return s.repo.ListInvites(ctx, limit, offset)
+}
+
+// RevokeInvite revokes a pending invite.
+func (s *InviteService) RevokeInvite(ctx context.Context, id uuid.UUID) error {
+	if err := s.repo.RevokeInvite(ctx, id); err != nil {
+		return err
+	}
+
+	s.eventBus.PublishAsync(ctx, events.NewEvent("invite.revoked", map[string]interface{}{
+		"invite_id": id,
+	}))
+
+	s.logger.Info("Invite revoked", interfaces.String("invite_id", id.String()))
+
+	return nil
+}
+
+// RedeemInvite creates an account from an invite token. The invitee picks
+// their own credentials; role and library grants come from the invite.
+func (s *InviteService) RedeemInvite(
+	ctx context.Context,
+	token, username, email, password, displayName string,
+) (*domain.User, error) {
+	if token == "" {
+		return nil, errors.BadRequest("invite token is required")
+	}
+
+	invite, err := s.repo.GetInviteByTokenHash(ctx, domain.HashToken(token))
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, errors.BadRequest("invalid invite token")
+		}
+		return nil, err
+	}
+	if !invite.IsRedeemable() {
+		return nil, errors.BadRequest("invite is " + string(invite.Status(time.Now())))
+	}
+
+	email = strings.ToLower(strings.TrimSpace(email))
+	if invite.Email != "" {
+		if email != "" && email != invite.Email {
+			return nil, errors.BadRequest("email does not match invite")
+		}
+		email = invite.Email
+	}
+
+	// The invitee joins the tenant that issued the invite
+	ctx = tenant.WithTenantID(ctx, invite.TenantID)
+
+	user, err := newUser(ctx, s.repo, username, email, password, displayName)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := s.repo.GetRoleByName(ctx, invite.Role)
+	if err != nil {
+		return nil, err
+	}
+	user.Roles = []domain.Role{*role}
+
+	grants := make([]*domain.LibraryGrant, 0, len(invite.LibraryIDs))
+	for _, raw := range invite.LibraryIDs {
+		libraryID, err := uuid.Parse(raw)
+		if err != nil {
+			continue
+		}
+		grants = append(grants, &domain.LibraryGrant{
+			UserID:    user.ID,
+			LibraryID: libraryID,
+			TenantID:  invite.TenantID,
+			GrantedBy: invite.CreatedBy,
+		})
+	}
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := redeemInvite(ctx, tx, invite, user, grants); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit invite redemption: %w", err)
+	}
+
+	s.eventBus.PublishAsync(ctx, events.NewEvent("user.created", map[string]interface{}{
+		"user_id":   user.ID,
+		"tenant_id": user.TenantID,
+		"username":  user.Username,
+		"email":     user.Email,
+	}))
+	s.eventBus.PublishAsync(ctx, events.NewEvent("invite.redeemed", map[string]interface{}{
+		"invite_id": invite.ID,
+		"user_id":   user.ID,
+	}))
+
+	s.logger.Info("Invite redeemed",
+		interfaces.String("invite_id", invite.ID.String()),
+		interfaces.String("user_id", user.ID.String()))
+
+	return user, nil
+}
+
+// redeemInvite claims the invite and creates the user and grants within tx.
+func redeemInvite(
+	ctx context.Context,
+	tx repository.Repository,
+	invite *domain.Invite,
+	user *domain.User,
+	grants []*domain.LibraryGrant,
+) error {
+	if err := tx.MarkInviteRedeemed(ctx, invite.ID, user.ID); err != nil {
+		return err
+	}
+	if err := tx.CreateUser(ctx, user); err != nil {
+		return err
+	}
+	return tx.CreateLibraryGrants(ctx, grants)
+}
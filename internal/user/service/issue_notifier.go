@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/internal/user/repository"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/i18n"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// IssueNotifier emails admins when users report issues with media, and
+// reporters when their issues are resolved. Users who turned notifications
+// off are not emailed.
+type IssueNotifier struct {
+	repo     repository.Repository
+	mailer   interfaces.Mailer
+	eventBus interfaces.EventBus
+	logger   interfaces.Logger
+}
+
+// NewIssueNotifier creates a new issue notifier.
+func NewIssueNotifier(
+	repo repository.Repository,
+	mailer interfaces.Mailer,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+) *IssueNotifier {
+	return &IssueNotifier{
+		repo:     repo,
+		mailer:   mailer,
+		eventBus: eventBus,
+		logger:   logger,
+	}
+}
+
+// Start subscribes the notifier to reported and resolved media issues.
+func (n *IssueNotifier) Start() error {
+	reported := events.NewConsumer("users.issue_notifier_reported", 1, n.handleIssueReported)
+	if err := n.eventBus.Subscribe("media_issue.reported", reported); err != nil {
+		return fmt.Errorf("failed to subscribe to media_issue.reported: %w", err)
+	}
+	resolved := events.NewConsumer("users.issue_notifier_resolved", 1, n.handleIssueResolved)
+	if err := n.eventBus.Subscribe("media_issue.resolved", resolved); err != nil {
+		return fmt.Errorf("failed to subscribe to media_issue.resolved: %w", err)
+	}
+	return nil
+}
+
+// handleIssueReported emails the admins of the new issue.
+func (n *IssueNotifier) handleIssueReported(ctx context.Context, env *events.Envelope) error {
+	payload := env.Payload()
+	reporter := n.payloadUser(ctx, payload)
+	if reporter == nil {
+		return nil
+	}
+	admins, err := n.repo.ListUsersWithRole(ctx, domain.RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	title, _ := payload["media_title"].(string)
+	category, _ := payload["category"].(string)
+	comment, _ := payload["comment"].(string)
+	category = strings.ReplaceAll(category, "_", " ")
+	for _, admin := range admins {
+		if !admin.Preferences.EnableNotifications {
+			continue
+		}
+		lang := userLanguage(ctx, admin)
+		body := i18n.T(lang, "email.issue_reported.body", admin.Username, reporter.Username, title, category)
+		if comment != "" {
+			body += i18n.T(lang, "email.issue_reported.comment", comment)
+		}
+		if err := n.mailer.Send(ctx, admin.Email, i18n.T(lang, "email.issue_reported.subject", title), body); err != nil {
+			// Notifications are best effort
+			n.logger.Error("Failed to send media issue notification",
+				interfaces.String("user_id", admin.ID.String()),
+				interfaces.Error(err))
+		}
+	}
+	return nil
+}
+
+// handleIssueResolved emails the reporter the resolution of their issue.
+func (n *IssueNotifier) handleIssueResolved(ctx context.Context, env *events.Envelope) error {
+	payload := env.Payload()
+	user := n.payloadUser(ctx, payload)
+	if user == nil || !user.Preferences.EnableNotifications {
+		return nil
+	}
+
+	title, _ := payload["media_title"].(string)
+	resolution, _ := payload["resolution"].(string)
+	lang := userLanguage(ctx, user)
+	body := i18n.T(lang, "email.issue_resolved.body", user.Username, title)
+	if resolution != "" {
+		body += i18n.T(lang, "email.issue_resolved.resolution", resolution)
+	}
+	if err := n.mailer.Send(ctx, user.Email, i18n.T(lang, "email.issue_resolved.subject", title), body); err != nil {
+		// Notifications are best effort
+		n.logger.Error("Failed to send media issue resolution",
+			interfaces.String("user_id", user.ID.String()),
+			interfaces.Error(err))
+	}
+	return nil
+}
+
+// payloadUser returns the reporter of an issue event, or nil if they are
+// gone.
+func (n *IssueNotifier) payloadUser(ctx context.Context, payload map[string]any) *domain.User {
+	userID, err := uuid.Parse(fmt.Sprint(payload["user_id"]))
+	if err != nil {
+		return nil
+	}
+	user, err := n.repo.GetUser(ctx, userID)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			n.logger.Error("Failed to get media issue reporter",
+				interfaces.String("user_id", userID.String()),
+				interfaces.Error(err))
+		}
+		return nil
+	}
+	return user
+}
@@ -0,0 +1,269 @@
+package service
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/internal/user/repository"
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/oidc"
+)
+
+// OIDCVerifier verifies the ID tokens of an OpenID Connect provider. It is
+// implemented by oidc.Verifier.
+type OIDCVerifier interface {
+	Verify(ctx context.Context, rawIDToken string) (*oidc.Claims, error)
+}
+
+// OIDCProvider is an OpenID Connect provider users can log in with.
+type OIDCProvider struct {
+	Name     string
+	Verifier OIDCVerifier
+	Roles    domain.RoleMapping
+}
+
+// WithOIDCProviders lets users log in with the ID tokens of OpenID Connect
+// providers. Without providers, ExchangeOIDCToken rejects every token.
+func (s *AuthService) WithOIDCProviders(providers ...OIDCProvider) *AuthService {
+	s.oidcProviders = make(map[string]OIDCProvider, len(providers))
+	for _, provider := range providers {
+		s.oidcProviders[provider.Name] = provider
+	}
+	return s
+}
+
+// ExchangeOIDCToken logs a user in with an ID token of a provider and
+// returns their tokens. The user is the one the identity of the token is
+// linked to; identities not linked yet are linked to the user with the
+// same email, if the provider verified it, or to a new user. Logins are
+// checked as password logins are, so they may require verification too.
+func (s *AuthService) ExchangeOIDCToken(
+	ctx context.Context,
+	providerName, idToken, deviceInfo, ipAddress, userAgent string,
+) (*domain.AuthTokens, *domain.User, error) {
+	provider, ok := s.oidcProviders[providerName]
+	if !ok {
+		return nil, nil, errors.BadRequest("unknown identity provider")
+	}
+	claims, err := provider.Verifier.Verify(ctx, idToken)
+	if err != nil {
+		if stderrors.Is(err, oidc.ErrInvalidToken) {
+			return nil, nil, errors.Unauthorized("invalid ID token")
+		}
+		return nil, nil, fmt.Errorf("failed to verify ID token: %w", err)
+	}
+
+	user, err := s.identityUser(ctx, provider, claims)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := auth.CheckCanLogin(ctx, s.repo, user); err != nil {
+		return nil, nil, err
+	}
+
+	signIn, err := s.checkSignIn(ctx, user, deviceInfo, ipAddress, userAgent)
+	if err != nil {
+		return nil, nil, err
+	}
+	tokens, err := s.startSession(ctx, user, signIn, false, deviceInfo, ipAddress, userAgent)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tokens, user, nil
+}
+
+// identityUser returns the user the identity of claims is linked to,
+// linking it first if needed. Providers with a role claim replace the
+// roles of the user with those mapped from it.
+func (s *AuthService) identityUser(ctx context.Context, provider OIDCProvider, claims *oidc.Claims) (*domain.User, error) {
+	var values []string
+	if provider.Roles.Claim != "" {
+		values = claims.Strings(provider.Roles.Claim)
+	}
+	roles := provider.Roles.Map(values)
+	if provider.Roles.Claim != "" && len(roles) == 0 {
+		return nil, errors.Forbidden("no role granted by identity provider")
+	}
+
+	identity, err := s.repo.GetUserIdentity(ctx, provider.Name, claims.Subject)
+	if errors.IsNotFound(err) {
+		return s.linkIdentity(ctx, provider, claims, roles)
+	}
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.repo.GetUser(ctx, identity.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if provider.Roles.Claim != "" {
+		if err := s.syncRoles(ctx, user, roles); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// linkIdentity links an identity to the user with its verified email, or
+// to a new user with roles. New users are only created with a role.
+func (s *AuthService) linkIdentity(
+	ctx context.Context,
+	provider OIDCProvider,
+	claims *oidc.Claims,
+	roles []string,
+) (*domain.User, error) {
+	email := strings.ToLower(strings.TrimSpace(claims.Email))
+	identity := &domain.UserIdentity{
+		ID:       uuid.New(),
+		Provider: provider.Name,
+		Subject:  claims.Subject,
+		Email:    email,
+	}
+
+	// Unverified emails are not proof the account is the user's
+	if email != "" && claims.EmailVerified {
+		user, err := s.repo.GetUserByEmail(ctx, email)
+		if err == nil {
+			if provider.Roles.Claim != "" {
+				if err := s.syncRoles(ctx, user, roles); err != nil {
+					return nil, err
+				}
+			}
+			identity.TenantID = user.TenantID
+			identity.UserID = user.ID
+			if err := s.repo.CreateUserIdentity(ctx, identity); err != nil {
+				return nil, err
+			}
+			s.logger.Info("Identity linked to user",
+				interfaces.String("user_id", user.ID.String()),
+				interfaces.String("provider", provider.Name))
+			return user, nil
+		}
+		if !errors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+
+	if len(roles) == 0 {
+		return nil, errors.Forbidden("no role granted by identity provider")
+	}
+	if email == "" {
+		return nil, errors.BadRequest("ID token has no email")
+	}
+	return s.provisionUser(ctx, claims, identity, roles)
+}
+
+// provisionUser creates the user of an identity. Their password is random,
+// so they log in through the provider until they reset it.
+func (s *AuthService) provisionUser(
+	ctx context.Context,
+	claims *oidc.Claims,
+	identity *domain.UserIdentity,
+	roles []string,
+) (*domain.User, error) {
+	username := domain.IdentityUsername(claims.PreferredUsername, identity.Email, claims.Subject)
+	if _, err := s.repo.GetUserByUsername(ctx, username); err == nil {
+		username += "-" + domain.IdentitySuffix(claims.Subject)
+	}
+	password, err := auth.GenerateRefreshToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate password: %w", err)
+	}
+
+	user, err := newUser(ctx, s.repo, username, identity.Email, password, claims.Name)
+	if err != nil {
+		return nil, err
+	}
+	user.IsVerified = claims.EmailVerified
+	if user.Roles, err = s.resolveRoles(ctx, roles); err != nil {
+		return nil, err
+	}
+	identity.TenantID = user.TenantID
+	identity.UserID = user.ID
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := createIdentityUser(ctx, tx, user, identity); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit user: %w", err)
+	}
+
+	s.eventBus.PublishAsync(ctx, events.NewEvent("user.created", map[string]interface{}{
+		"user_id":   user.ID,
+		"tenant_id": user.TenantID,
+		"username":  user.Username,
+		"email":     user.Email,
+	}))
+
+	s.logger.Info("User provisioned from identity",
+		interfaces.String("user_id", user.ID.String()),
+		interfaces.String("provider", identity.Provider))
+
+	return user, nil
+}
+
+// createIdentityUser creates the user and its identity within tx.
+func createIdentityUser(
+	ctx context.Context,
+	tx repository.Repository,
+	user *domain.User,
+	identity *domain.UserIdentity,
+) error {
+	if err := tx.CreateUser(ctx, user); err != nil {
+		return err
+	}
+	return tx.CreateUserIdentity(ctx, identity)
+}
+
+// syncRoles replaces the roles of a user with roles, if they differ.
+func (s *AuthService) syncRoles(ctx context.Context, user *domain.User, roles []string) error {
+	current := make([]string, len(user.Roles))
+	for i, role := range user.Roles {
+		current[i] = role.Name
+	}
+	slices.Sort(current)
+	if slices.Equal(current, roles) {
+		return nil
+	}
+
+	resolved, err := s.resolveRoles(ctx, roles)
+	if err != nil {
+		return err
+	}
+	user.Roles = resolved
+	if err := s.repo.UpdateUser(ctx, user); err != nil {
+		return err
+	}
+
+	s.logger.Info("Roles synced from identity provider",
+		interfaces.String("user_id", user.ID.String()),
+		interfaces.String("roles", strings.Join(roles, ",")))
+	return nil
+}
+
+// resolveRoles looks up roles by name.
+func (s *AuthService) resolveRoles(ctx context.Context, names []string) ([]domain.Role, error) {
+	roles := make([]domain.Role, 0, len(names))
+	for _, name := range names {
+		role, err := s.repo.GetRoleByName(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve role %s: %w", name, err)
+		}
+		roles = append(roles, *role)
+	}
+	return roles, nil
+}
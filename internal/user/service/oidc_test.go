@@ -0,0 +1,147 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/internal/user/service"
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/logger"
+	"github.com/narwhalmedia/narwhal/pkg/oidc"
+	"github.com/narwhalmedia/narwhal/pkg/testing/fake"
+)
+
+// verifier accepts the tokens it knows the claims of.
+type verifier map[string]*oidc.Claims
+
+func (v verifier) Verify(_ context.Context, rawIDToken string) (*oidc.Claims, error) {
+	claims, ok := v[rawIDToken]
+	if !ok {
+		return nil, oidc.ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func groups(values ...any) map[string]any {
+	return map[string]any{"groups": values}
+}
+
+func TestExchangeOIDCToken(t *testing.T) {
+	ctx := context.Background()
+	repo := fake.NewUserRepository()
+	for _, name := range []string{domain.RoleAdmin, domain.RoleUser} {
+		require.NoError(t, repo.CreateRole(ctx, &domain.Role{Name: name}))
+	}
+	jwtManager := auth.NewJWTManager("access", "refresh", "narwhal", 15*time.Minute, time.Hour)
+	tokens := verifier{
+		"alice": {Subject: "a1", Email: "Alice@example.com", EmailVerified: true, PreferredUsername: "alice",
+			Raw: groups("family")},
+		"alice-promoted": {Subject: "a1", Email: "alice@example.com", EmailVerified: true,
+			Raw: groups("family", "media-admins")},
+		"bob":      {Subject: "b1", Email: "bob@example.com", EmailVerified: true, Raw: groups("family")},
+		"mallory":  {Subject: "m1", Email: "bob@example.com", Raw: groups("family")},
+		"stranger": {Subject: "s1", Email: "stranger@example.com", EmailVerified: true, Raw: groups("accounting")},
+	}
+	authService := service.NewAuthService(repo, jwtManager, fake.NewEventBus(), logger.NewNoopLogger()).
+		WithOIDCProviders(service.OIDCProvider{
+			Name:     "keycloak",
+			Verifier: tokens,
+			Roles: domain.RoleMapping{
+				Claim: "groups",
+				Roles: map[string]string{"family": domain.RoleUser, "media-admins": domain.RoleAdmin},
+			},
+		})
+
+	exchange := func(token string) (*domain.AuthTokens, *domain.User, error) {
+		return authService.ExchangeOIDCToken(ctx, "keycloak", token, "Phone", "127.0.0.1", "Test/1.0")
+	}
+	roles := func(accessToken string) []string {
+		claims, err := jwtManager.ValidateAccessToken(accessToken)
+		require.NoError(t, err)
+		return claims.Roles
+	}
+
+	// New identities are provisioned with their mapped roles
+	issued, user, err := exchange("alice")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", user.Username)
+	assert.Equal(t, "alice@example.com", user.Email)
+	assert.True(t, user.IsVerified)
+	assert.Equal(t, []string{domain.RoleUser}, roles(issued.AccessToken))
+
+	// and found by their subject later, syncing their roles
+	issued, again, err := exchange("alice-promoted")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, again.ID)
+	assert.ElementsMatch(t, []string{domain.RoleAdmin, domain.RoleUser}, roles(issued.AccessToken))
+	stored, err := repo.GetUser(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Len(t, stored.Roles, 2)
+
+	// Verified emails link existing users
+	bob := &domain.User{Username: "bob", Email: "bob@example.com", IsActive: true}
+	require.NoError(t, bob.SetPassword("password123"))
+	require.NoError(t, repo.CreateUser(ctx, bob))
+	_, linked, err := exchange("bob")
+	require.NoError(t, err)
+	assert.Equal(t, bob.ID, linked.ID)
+	identity, err := repo.GetUserIdentity(ctx, "keycloak", "b1")
+	require.NoError(t, err)
+	assert.Equal(t, bob.ID, identity.UserID)
+
+	// but unverified ones do not take over accounts
+	_, _, err = exchange("mallory")
+	assert.True(t, errors.IsConflict(err), "got %v", err)
+
+	_, _, err = exchange("stranger")
+	assert.True(t, errors.IsForbidden(err), "users without a mapped role are denied")
+	_, err = repo.GetUserByEmail(ctx, "stranger@example.com")
+	assert.True(t, errors.IsNotFound(err))
+
+	_, _, err = exchange("forged")
+	assert.True(t, errors.IsUnauthorized(err))
+	_, _, err = authService.ExchangeOIDCToken(ctx, "google", "alice", "", "", "")
+	assert.True(t, errors.IsBadRequest(err))
+}
+
+func TestExchangeOIDCToken_DefaultRole(t *testing.T) {
+	ctx := context.Background()
+	repo := fake.NewUserRepository()
+	require.NoError(t, repo.CreateRole(ctx, &domain.Role{Name: domain.RoleGuest}))
+	guest, err := repo.GetRoleByName(ctx, domain.RoleGuest)
+	require.NoError(t, err)
+
+	tokens := verifier{
+		"carol": {Subject: "c1", Email: "carol@example.com", EmailVerified: true, Name: "Carol"},
+		"dave":  {Subject: "d1", Email: "dave@example.com", EmailVerified: true},
+	}
+	provider := service.OIDCProvider{Name: "google", Verifier: tokens}
+	jwtManager := auth.NewJWTManager("access", "refresh", "narwhal", 15*time.Minute, time.Hour)
+	authService := service.NewAuthService(repo, jwtManager, fake.NewEventBus(), logger.NewNoopLogger()).
+		WithOIDCProviders(provider)
+
+	// Without a default role, only existing users log in
+	_, _, err = authService.ExchangeOIDCToken(ctx, "google", "carol", "", "", "")
+	assert.True(t, errors.IsForbidden(err))
+
+	dave := &domain.User{Username: "dave", Email: "dave@example.com", IsActive: true, Roles: []domain.Role{*guest}}
+	require.NoError(t, dave.SetPassword("password123"))
+	require.NoError(t, repo.CreateUser(ctx, dave))
+	_, user, err := authService.ExchangeOIDCToken(ctx, "google", "dave", "", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, dave.ID, user.ID)
+
+	provider.Roles.Default = domain.RoleGuest
+	authService.WithOIDCProviders(provider)
+	_, user, err = authService.ExchangeOIDCToken(ctx, "google", "carol", "", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "carol", user.Username)
+	assert.Equal(t, "Carol", user.DisplayName)
+	assert.True(t, user.HasRole(domain.RoleGuest))
+}
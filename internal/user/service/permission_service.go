@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/user/constants"
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/internal/user/repository"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+const (
+	// EventRoleChanged is published when a role's permissions or parents change.
+	EventRoleChanged = "role.changed"
+	// EventPermissionChanged is published when a permission is edited or removed.
+	EventPermissionChanged = "permission.changed"
+)
+
+// userPermissionEvents change the roles held by the user named in the event.
+var userPermissionEvents = []string{
+	"user.role_assigned",
+	"user.role_removed",
+	"user.deleted",
+}
+
+// PermissionService answers permission checks from cached per-user
+// snapshots. Snapshots are dropped when the user's roles change, and all of
+// them are dropped when any role or permission changes.
+type PermissionService struct {
+	repo       repository.Repository
+	cache      interfaces.Cache
+	eventBus   interfaces.EventBus
+	logger     interfaces.Logger
+	generation atomic.Uint64
+}
+
+// NewPermissionService creates a new permission service.
+func NewPermissionService(
+	repo repository.Repository,
+	cache interfaces.Cache,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+) *PermissionService {
+	return &PermissionService{
+		repo:     repo,
+		cache:    cache,
+		eventBus: eventBus,
+		logger:   logger,
+	}
+}
+
+// Start subscribes the service to the events that invalidate snapshots.
+func (s *PermissionService) Start() error {
+	invalidateUser := events.NewConsumer("permissions.invalidator", 1, s.handleUserEvent)
+	for _, eventType := range userPermissionEvents {
+		if err := s.eventBus.Subscribe(eventType, invalidateUser); err != nil {
+			return fmt.Errorf("failed to subscribe to %s: %w", eventType, err)
+		}
+	}
+
+	invalidateAll := events.NewConsumer("permissions.invalidator", 1, func(context.Context, *events.Envelope) error {
+		s.InvalidateAll()
+		return nil
+	})
+	for _, eventType := range []string{EventRoleChanged, EventPermissionChanged} {
+		if err := s.eventBus.Subscribe(eventType, invalidateAll); err != nil {
+			return fmt.Errorf("failed to subscribe to %s: %w", eventType, err)
+		}
+	}
+	return nil
+}
+
+// GetSnapshot returns the user's permission snapshot, loading it on a cache
+// miss.
+func (s *PermissionService) GetSnapshot(ctx context.Context, userID uuid.UUID) (*domain.PermissionSnapshot, error) {
+	cacheKey := s.cacheKey(userID)
+	if cached, err := s.cache.Get(ctx, cacheKey); err == nil {
+		if snapshot, ok := cached.(*domain.PermissionSnapshot); ok {
+			return snapshot, nil
+		}
+	}
+
+	user, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := domain.NewPermissionSnapshot(user)
+	_ = s.cache.Set(ctx, cacheKey, snapshot, constants.CacheTTL)
+	return snapshot, nil
+}
+
+// CheckPermission reports whether the user may perform action on resource.
+func (s *PermissionService) CheckPermission(
+	ctx context.Context,
+	userID uuid.UUID,
+	resource, action string,
+) (bool, error) {
+	snapshot, err := s.GetSnapshot(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return snapshot.HasPermission(resource, action), nil
+}
+
+// BulkCheckPermissions answers several checks against a single snapshot.
+// Results are returned in the order of checks.
+func (s *PermissionService) BulkCheckPermissions(
+	ctx context.Context,
+	userID uuid.UUID,
+	checks []domain.PermissionCheck,
+) ([]bool, error) {
+	if len(checks) == 0 {
+		return nil, errors.BadRequest("at least one permission check is required")
+	}
+	if len(checks) > constants.MaxBulkPermissionChecks {
+		return nil, errors.BadRequest(fmt.Sprintf(
+			"at most %d permission checks are allowed per request", constants.MaxBulkPermissionChecks))
+	}
+
+	snapshot, err := s.GetSnapshot(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]bool, len(checks))
+	for i, check := range checks {
+		results[i] = snapshot.HasPermission(check.Resource, check.Action)
+	}
+	return results, nil
+}
+
+// GetPermissions returns every permission the user is granted.
+func (s *PermissionService) GetPermissions(ctx context.Context, userID uuid.UUID) ([]domain.Permission, error) {
+	snapshot, err := s.GetSnapshot(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.Permissions, nil
+}
+
+// Invalidate drops the cached snapshot of a single user.
+func (s *PermissionService) Invalidate(ctx context.Context, userID uuid.UUID) {
+	_ = s.cache.Delete(ctx, s.cacheKey(userID))
+}
+
+// InvalidateAll drops every cached snapshot. Keys are versioned, so stale
+// entries are simply never read again and expire on their own.
+func (s *PermissionService) InvalidateAll() {
+	s.generation.Add(1)
+}
+
+func (s *PermissionService) cacheKey(userID uuid.UUID) string {
+	return fmt.Sprintf("permissions:%d:%s", s.generation.Load(), userID.String())
+}
+
+// handleUserEvent drops the snapshot of the user named in the event.
+func (s *PermissionService) handleUserEvent(ctx context.Context, env *events.Envelope) error {
+	switch userID := env.Payload()["user_id"].(type) {
+	case uuid.UUID:
+		s.Invalidate(ctx, userID)
+	case string:
+		if id, err := uuid.Parse(userID); err == nil {
+			s.Invalidate(ctx, id)
+		}
+	}
+	return nil
+}
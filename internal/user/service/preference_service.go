@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/internal/user/repository"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// EventPreferencesChanged is published whenever a user's preferences change.
+const EventPreferencesChanged = "user.preferences_changed"
+
+// PreferenceService handles typed per-user preferences.
+type PreferenceService struct {
+	repo     repository.Repository
+	cache    interfaces.Cache
+	eventBus interfaces.EventBus
+	logger   interfaces.Logger
+}
+
+// NewPreferenceService creates a new preference service.
+func NewPreferenceService(
+	repo repository.Repository,
+	cache interfaces.Cache,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+) *PreferenceService {
+	return &PreferenceService{
+		repo:     repo,
+		cache:    cache,
+		eventBus: eventBus,
+		logger:   logger,
+	}
+}
+
+// GetPreferences returns the effective value of every preference for a user.
+func (s *PreferenceService) GetPreferences(ctx context.Context, userID uuid.UUID) (map[string]string, error) {
+	user, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := s.repo.ListUserPreferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return domain.ResolvePreferences(user.Preferences, stored), nil
+}
+
+// UpdatePreferences sets and resets preferences for a user and returns the
+// resulting effective values. Admin-only preferences require asAdmin.
+// The update is all-or-nothing: any invalid value rejects the whole request.
+func (s *PreferenceService) UpdatePreferences(
+	ctx context.Context,
+	userID uuid.UUID,
+	values map[string]string,
+	resetKeys []string,
+	asAdmin bool,
+) (map[string]string, error) {
+	if len(values) == 0 && len(resetKeys) == 0 {
+		return s.GetPreferences(ctx, userID)
+	}
+
+	user, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make(map[string]string, len(values)+len(resetKeys))
+	prefs := make([]*domain.UserPreference, 0, len(values))
+	now := time.Now()
+
+	for key, value := range values {
+		def, err := s.writableDefinition(key, asAdmin)
+		if err != nil {
+			return nil, err
+		}
+		canonical, err := def.Validate(value)
+		if err != nil {
+			return nil, errors.BadRequest(err.Error())
+		}
+
+		prefs = append(prefs, &domain.UserPreference{
+			UserID:    userID,
+			Key:       key,
+			TenantID:  user.TenantID,
+			Value:     canonical,
+			UpdatedAt: now,
+		})
+		user.Preferences.Apply(key, canonical)
+		changed[key] = canonical
+	}
+
+	for _, key := range resetKeys {
+		def, err := s.writableDefinition(key, asAdmin)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := values[key]; ok {
+			return nil, errors.BadRequest("preference cannot be both set and reset: " + key)
+		}
+		user.Preferences.Apply(key, def.Default)
+		changed[key] = def.Default
+	}
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := savePreferences(ctx, tx, user, prefs, resetKeys); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit preferences: %w", err)
+	}
+
+	_ = s.cache.Delete(ctx, fmt.Sprintf("user:%s", userID.String()))
+
+	s.eventBus.PublishAsync(ctx, events.NewAggregateEvent(EventPreferencesChanged, userID.String(),
+		map[string]interface{}{
+			"user_id":     userID,
+			"preferences": changed,
+		}))
+
+	return s.GetPreferences(ctx, userID)
+}
+
+// WatchPreferences streams preference changes for a user until ctx is done.
+// Each value holds only the keys that changed.
+func (s *PreferenceService) WatchPreferences(ctx context.Context, userID uuid.UUID) (<-chan map[string]string, error) {
+	w := &preferenceWatcher{
+		userID:  userID.String(),
+		changes: make(chan map[string]string, 16),
+		done:    ctx.Done(),
+	}
+	if err := s.eventBus.Subscribe(EventPreferencesChanged, w); err != nil {
+		return nil, fmt.Errorf("failed to watch preferences: %w", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = s.eventBus.Unsubscribe(EventPreferencesChanged, w)
+	}()
+
+	return w.changes, nil
+}
+
+func (s *PreferenceService) writableDefinition(key string, asAdmin bool) (domain.PreferenceDefinition, error) {
+	def, ok := domain.LookupPreference(key)
+	if !ok {
+		return def, errors.BadRequest("unknown preference: " + key)
+	}
+	if def.Access == domain.PreferenceAccessAdmin && !asAdmin {
+		return def, errors.Forbidden("preference can only be changed by an admin: " + key)
+	}
+	return def, nil
+}
+
+// savePreferences stores preference rows and mirrors legacy columns within tx.
+func savePreferences(
+	ctx context.Context,
+	tx repository.Repository,
+	user *domain.User,
+	prefs []*domain.UserPreference,
+	resetKeys []string,
+) error {
+	if err := tx.SetUserPreferences(ctx, prefs); err != nil {
+		return err
+	}
+	if err := tx.DeleteUserPreferences(ctx, user.ID, resetKeys); err != nil {
+		return err
+	}
+	return tx.UpdateUser(ctx, user)
+}
+
+// preferenceWatcher forwards preference change events for one user.
+type preferenceWatcher struct {
+	userID  string
+	changes chan map[string]string
+	done    <-chan struct{}
+}
+
+func (w *preferenceWatcher) Handle(_ context.Context, event interfaces.Event) error {
+	if event.AggregateID() != w.userID {
+		return nil
+	}
+	changed, ok := events.PayloadOf(event)["preferences"].(map[string]string)
+	if !ok {
+		return nil
+	}
+
+	// Slow watchers drop updates rather than block the publisher
+	select {
+	case w.changes <- changed:
+	case <-w.done:
+	default:
+	}
+	return nil
+}
+
+func (w *preferenceWatcher) EventType() string {
+	return "preferences.watcher"
+}
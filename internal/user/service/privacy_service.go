@@ -0,0 +1,547 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/user/constants"
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/internal/user/repository"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+const (
+	// EventDataExportRequested asks every service holding data about a user
+	// to contribute it to an export with an EventDataExportSection.
+	EventDataExportRequested = "user.data_export_requested"
+	// EventDataExportSection carries a section of an export from the
+	// service that holds the data.
+	EventDataExportSection = "user.data_export_section"
+	// EventDeletionScheduled is published when a user asks for their
+	// account to be deleted.
+	EventDeletionScheduled = "user.deletion_scheduled"
+	// EventDeletionCancelled is published when a scheduled deletion is
+	// cancelled during the grace period.
+	EventDeletionCancelled = "user.deletion_cancelled"
+
+	// deletionBatchSize is the number of accounts deleted per sweep.
+	deletionBatchSize = 100
+)
+
+// PrivacyService handles the data protection requests of users: exporting
+// everything stored about them and deleting their account.
+//
+// An export collects this service's data right away and asks the other
+// services for theirs with a user.data_export_requested event. The archive
+// is assembled once every external section has arrived, or with what there
+// is once constants.DataExportTimeout has passed.
+//
+// Deleting an account only schedules it. Once the grace period is over,
+// PurgeDueAccounts removes the user's data and publishes user.deleted, on
+// which the other services clean up or anonymize theirs.
+type PrivacyService struct {
+	repo     repository.Repository
+	cache    interfaces.Cache
+	eventBus interfaces.EventBus
+	logger   interfaces.Logger
+}
+
+// NewPrivacyService creates a new privacy service.
+func NewPrivacyService(
+	repo repository.Repository,
+	cache interfaces.Cache,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+) *PrivacyService {
+	return &PrivacyService{
+		repo:     repo,
+		cache:    cache,
+		eventBus: eventBus,
+		logger:   logger,
+	}
+}
+
+// Start subscribes the service to the export sections of other services.
+func (s *PrivacyService) Start() error {
+	collect := events.NewConsumer("privacy.data_export", 1, s.handleExportSection)
+	if err := s.eventBus.Subscribe(EventDataExportSection, collect); err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", EventDataExportSection, err)
+	}
+	return nil
+}
+
+// RequestDataExport starts an export of the user's data.
+func (s *PrivacyService) RequestDataExport(ctx context.Context, userID uuid.UUID) (*domain.DataExport, error) {
+	user, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sections, err := s.collectSections(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	export := &domain.DataExport{
+		UserID:          user.ID,
+		Status:          domain.DataExportStatusPending,
+		PendingSections: slices.Clone(domain.ExternalDataExportSections),
+		ExpiresAt:       now.Add(constants.DataExportTTL),
+	}
+	if err := s.repo.CreateDataExport(ctx, export, sections); err != nil {
+		return nil, err
+	}
+
+	s.eventBus.PublishAsync(ctx, events.NewAggregateEvent(EventDataExportRequested, user.ID.String(), map[string]interface{}{
+		"export_id": export.ID.String(),
+		"user_id":   user.ID.String(),
+	}))
+
+	s.logger.Info("Data export requested",
+		interfaces.String("export_id", export.ID.String()),
+		interfaces.String("user_id", user.ID.String()))
+
+	return export, nil
+}
+
+// GetDataExport returns an export. An export still waiting for sections
+// after constants.DataExportTimeout is assembled without them.
+func (s *PrivacyService) GetDataExport(ctx context.Context, id uuid.UUID) (*domain.DataExport, error) {
+	export, err := s.repo.GetDataExport(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !export.IsReady() && time.Since(export.CreatedAt) > constants.DataExportTimeout {
+		if err := s.assemble(ctx, export); err != nil {
+			return nil, err
+		}
+	}
+	return export, nil
+}
+
+// CleanupExpiredDataExports deletes exports past their expiry.
+func (s *PrivacyService) CleanupExpiredDataExports(ctx context.Context) error {
+	deleted, err := s.repo.DeleteExpiredDataExports(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		s.logger.Info("Expired data exports deleted", interfaces.Int("count", int(deleted)))
+	}
+	return nil
+}
+
+// ScheduleAccountDeletion schedules the user's account to be deleted after
+// the grace period.
+func (s *PrivacyService) ScheduleAccountDeletion(ctx context.Context, userID uuid.UUID) (*domain.User, error) {
+	user, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletionScheduledAt != nil {
+		return user, nil
+	}
+
+	deleteAt := time.Now().Add(constants.AccountDeletionGracePeriod)
+	user.DeletionScheduledAt = &deleteAt
+	if err := s.repo.UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	_ = s.cache.Delete(ctx, fmt.Sprintf("user:%s", user.ID.String()))
+
+	s.eventBus.PublishAsync(ctx, events.NewAggregateEvent(EventDeletionScheduled, user.ID.String(), map[string]interface{}{
+		"user_id":   user.ID.String(),
+		"delete_at": deleteAt.Format(time.RFC3339),
+	}))
+
+	s.logger.Info("Account deletion scheduled",
+		interfaces.String("user_id", user.ID.String()),
+		interfaces.Any("delete_at", deleteAt))
+
+	return user, nil
+}
+
+// CancelAccountDeletion cancels a scheduled deletion.
+func (s *PrivacyService) CancelAccountDeletion(ctx context.Context, userID uuid.UUID) (*domain.User, error) {
+	user, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletionScheduledAt == nil {
+		return nil, errors.BadRequest("account deletion is not scheduled")
+	}
+
+	user.DeletionScheduledAt = nil
+	if err := s.repo.UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	_ = s.cache.Delete(ctx, fmt.Sprintf("user:%s", user.ID.String()))
+
+	s.eventBus.PublishAsync(ctx, events.NewAggregateEvent(EventDeletionCancelled, user.ID.String(), map[string]interface{}{
+		"user_id": user.ID.String(),
+	}))
+
+	s.logger.Info("Account deletion cancelled", interfaces.String("user_id", user.ID.String()))
+
+	return user, nil
+}
+
+// PurgeDueAccounts deletes the accounts whose grace period is over. It
+// returns the number of accounts deleted.
+func (s *PrivacyService) PurgeDueAccounts(ctx context.Context) (int, error) {
+	users, err := s.repo.ListUsersDueForDeletion(ctx, time.Now(), deletionBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, user := range users {
+		if err := s.purgeAccount(ctx, user); err != nil {
+			s.logger.Error("Failed to delete account",
+				interfaces.String("user_id", user.ID.String()),
+				interfaces.Error(err))
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// purgeAccount deletes a user and their data, then lets the other services
+// clean up theirs.
+func (s *PrivacyService) purgeAccount(ctx context.Context, user *domain.User) error {
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := tx.PurgeUserData(ctx, user.ID); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.DeleteUser(ctx, user.ID); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit account deletion: %w", err)
+	}
+
+	_ = s.cache.Delete(ctx, fmt.Sprintf("user:%s", user.ID.String()))
+
+	s.eventBus.PublishAsync(ctx, events.NewEvent("user.deleted", map[string]interface{}{
+		"user_id":  user.ID.String(),
+		"username": user.Username,
+		"reason":   "account_deleted",
+	}))
+
+	s.logger.Info("Account deleted", interfaces.String("user_id", user.ID.String()))
+	return nil
+}
+
+// handleExportSection stores a section contributed by another service and
+// assembles the export once none are pending.
+func (s *PrivacyService) handleExportSection(ctx context.Context, env *events.Envelope) error {
+	payload := env.Payload()
+	exportID, err := uuid.Parse(fmt.Sprint(payload["export_id"]))
+	if err != nil {
+		return nil
+	}
+	name, _ := payload["section"].(string)
+	data, _ := payload["data"].(string)
+	if !slices.Contains(domain.ExternalDataExportSections, name) {
+		return nil
+	}
+
+	export, err := s.repo.AddDataExportSection(ctx, &domain.DataExportSection{
+		ExportID: exportID,
+		Name:     name,
+		Data:     []byte(data),
+	})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	if export.IsReady() || len(export.PendingSections) > 0 {
+		return nil
+	}
+	return s.assemble(ctx, export)
+}
+
+// assemble zips the sections of an export. Sections still pending are
+// listed as missing in the manifest.
+func (s *PrivacyService) assemble(ctx context.Context, export *domain.DataExport) error {
+	sections, err := s.repo.ListDataExportSections(ctx, export.ID)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	names := make([]string, 0, len(sections))
+	for _, section := range sections {
+		w, err := archive.Create(section.Name + ".json")
+		if err != nil {
+			return fmt.Errorf("failed to add %s to data export: %w", section.Name, err)
+		}
+		if _, err := w.Write(section.Data); err != nil {
+			return fmt.Errorf("failed to add %s to data export: %w", section.Name, err)
+		}
+		names = append(names, section.Name)
+	}
+
+	now := time.Now()
+	manifest, err := json.MarshalIndent(exportManifest{
+		UserID:   export.UserID.String(),
+		Created:  now,
+		Sections: names,
+		Missing:  export.PendingSections,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode data export manifest: %w", err)
+	}
+	w, err := archive.Create("manifest.json")
+	if err != nil {
+		return fmt.Errorf("failed to add manifest to data export: %w", err)
+	}
+	if _, err := w.Write(manifest); err != nil {
+		return fmt.Errorf("failed to add manifest to data export: %w", err)
+	}
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failed to write data export: %w", err)
+	}
+
+	export.Status = domain.DataExportStatusReady
+	export.Archive = buf.Bytes()
+	export.MissingSections = export.PendingSections
+	export.PendingSections = nil
+	export.CompletedAt = &now
+	if err := s.repo.CompleteDataExport(ctx, export); err != nil {
+		return err
+	}
+
+	s.logger.Info("Data export ready",
+		interfaces.String("export_id", export.ID.String()),
+		interfaces.Int("bytes", buf.Len()),
+		interfaces.Any("missing_sections", export.MissingSections))
+	return nil
+}
+
+// collectSections encodes the data this service stores about the user.
+// Secrets such as password hashes and refresh tokens are left out.
+func (s *PrivacyService) collectSections(ctx context.Context, user *domain.User) ([]*domain.DataExportSection, error) {
+	prefs, err := s.repo.ListUserPreferences(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := s.repo.ListUserSessions(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	signIns, err := s.repo.ListSignIns(ctx, user.ID, constants.LoginHistorySize)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := s.repo.ListUserDevices(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	consents, err := s.repo.ListUserConsents(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	impersonations, err := s.repo.ListImpersonations(ctx, user.ID, constants.MaxExportedAuditEntries, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make([]string, len(user.Roles))
+	for i, role := range user.Roles {
+		roles[i] = role.Name
+	}
+
+	content := map[string]interface{}{
+		domain.DataExportSectionProfile: exportedProfile{
+			ID:          user.ID.String(),
+			Username:    user.Username,
+			Email:       user.Email,
+			DisplayName: user.DisplayName,
+			Avatar:      user.Avatar,
+			Roles:       roles,
+			IsVerified:  user.IsVerified,
+			LastLoginAt: user.LastLoginAt,
+			CreatedAt:   user.CreatedAt,
+			UpdatedAt:   user.UpdatedAt,
+		},
+		domain.DataExportSectionPreferences: domain.ResolvePreferences(user.Preferences, prefs),
+		domain.DataExportSectionSessions:    exportedSessions(sessions),
+		domain.DataExportSectionSignIns:     exportedSignIns(signIns),
+		domain.DataExportSectionDevices:     exportedDevices(devices),
+		domain.DataExportSectionConsents:    exportedConsents(consents),
+		domain.DataExportSectionAudit:       exportedImpersonations(impersonations),
+	}
+
+	sections := make([]*domain.DataExportSection, 0, len(content))
+	for name, value := range content {
+		data, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", name, err)
+		}
+		sections = append(sections, &domain.DataExportSection{Name: name, Data: data})
+	}
+	return sections, nil
+}
+
+type exportManifest struct {
+	UserID   string    `json:"user_id"`
+	Created  time.Time `json:"created"`
+	Sections []string  `json:"sections"`
+	Missing  []string  `json:"missing_sections,omitempty"`
+}
+
+type exportedProfile struct {
+	ID          string     `json:"id"`
+	Username    string     `json:"username"`
+	Email       string     `json:"email"`
+	DisplayName string     `json:"display_name,omitempty"`
+	Avatar      string     `json:"avatar,omitempty"`
+	Roles       []string   `json:"roles"`
+	IsVerified  bool       `json:"is_verified"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+type exportedSession struct {
+	ID         string    `json:"id"`
+	DeviceInfo string    `json:"device_info,omitempty"`
+	IPAddress  string    `json:"ip_address,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+func exportedSessions(sessions []*domain.Session) []exportedSession {
+	exported := make([]exportedSession, len(sessions))
+	for i, session := range sessions {
+		exported[i] = exportedSession{
+			ID:         session.ID.String(),
+			DeviceInfo: session.DeviceInfo,
+			IPAddress:  session.IPAddress,
+			UserAgent:  session.UserAgent,
+			CreatedAt:  session.CreatedAt,
+			ExpiresAt:  session.ExpiresAt,
+		}
+	}
+	return exported
+}
+
+type exportedSignIn struct {
+	IPAddress string    `json:"ip_address,omitempty"`
+	Browser   string    `json:"browser,omitempty"`
+	OS        string    `json:"os,omitempty"`
+	Platform  string    `json:"platform,omitempty"`
+	Country   string    `json:"country,omitempty"`
+	Anomalies []string  `json:"anomalies,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func exportedSignIns(signIns []*domain.SignIn) []exportedSignIn {
+	exported := make([]exportedSignIn, len(signIns))
+	for i, signIn := range signIns {
+		var anomalies []string
+		for _, a := range domain.ParseLoginAnomalies(signIn.Anomalies) {
+			anomalies = append(anomalies, string(a))
+		}
+		exported[i] = exportedSignIn{
+			IPAddress: signIn.IPAddress,
+			Browser:   signIn.Browser,
+			OS:        signIn.OS,
+			Platform:  signIn.Platform,
+			Country:   signIn.Country,
+			Anomalies: anomalies,
+			CreatedAt: signIn.CreatedAt,
+		}
+	}
+	return exported
+}
+
+type exportedDevice struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name,omitempty"`
+	Platform   string    `json:"platform,omitempty"`
+	AppVersion string    `json:"app_version,omitempty"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	LastIP     string    `json:"last_ip,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func exportedDevices(devices []*domain.Device) []exportedDevice {
+	exported := make([]exportedDevice, len(devices))
+	for i, device := range devices {
+		exported[i] = exportedDevice{
+			ID:         device.ID.String(),
+			Name:       device.Name,
+			Platform:   device.Platform,
+			AppVersion: device.AppVersion,
+			LastSeenAt: device.LastSeenAt,
+			LastIP:     device.LastIP,
+			CreatedAt:  device.CreatedAt,
+		}
+	}
+	return exported
+}
+
+type exportedConsent struct {
+	DocumentID string    `json:"document_id"`
+	AcceptedAt time.Time `json:"accepted_at"`
+	IPAddress  string    `json:"ip_address,omitempty"`
+}
+
+func exportedConsents(consents []*domain.Consent) []exportedConsent {
+	exported := make([]exportedConsent, len(consents))
+	for i, consent := range consents {
+		exported[i] = exportedConsent{
+			DocumentID: consent.DocumentID.String(),
+			AcceptedAt: consent.AcceptedAt,
+			IPAddress:  consent.IPAddress,
+		}
+	}
+	return exported
+}
+
+type exportedImpersonation struct {
+	ID             string    `json:"id"`
+	ImpersonatorID string    `json:"impersonator_id"`
+	TargetUserID   string    `json:"target_user_id"`
+	Reason         string    `json:"reason"`
+	CreatedAt      time.Time `json:"created_at"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+func exportedImpersonations(impersonations []*domain.Impersonation) []exportedImpersonation {
+	exported := make([]exportedImpersonation, len(impersonations))
+	for i, impersonation := range impersonations {
+		exported[i] = exportedImpersonation{
+			ID:             impersonation.ID.String(),
+			ImpersonatorID: impersonation.ImpersonatorID.String(),
+			TargetUserID:   impersonation.TargetUserID.String(),
+			Reason:         impersonation.Reason,
+			CreatedAt:      impersonation.CreatedAt,
+			ExpiresAt:      impersonation.ExpiresAt,
+		}
+	}
+	return exported
+}
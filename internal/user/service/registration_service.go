@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/user/constants"
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/internal/user/repository"
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/i18n"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/utils"
+)
+
+// RegistrationConfig controls self-service registration.
+type RegistrationConfig struct {
+	Enabled         bool
+	RequireApproval bool
+	// RateLimit is the number of registrations allowed per client IP per hour.
+	RateLimit      int
+	BlockedDomains []string
+	// VerifyURL is the page that accepts the verification token as a query parameter.
+	VerifyURL string
+}
+
+// RegistrationService handles self-service account registration.
+type RegistrationService struct {
+	repo     repository.Repository
+	mailer   interfaces.Mailer
+	eventBus interfaces.EventBus
+	logger   interfaces.Logger
+	cfg      RegistrationConfig
+	limiter  *utils.RateLimiter
+}
+
+// NewRegistrationService creates a new registration service.
+func NewRegistrationService(
+	repo repository.Repository,
+	mailer interfaces.Mailer,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+	cfg RegistrationConfig,
+) *RegistrationService {
+	return &RegistrationService{
+		repo:     repo,
+		mailer:   mailer,
+		eventBus: eventBus,
+		logger:   logger,
+		cfg:      cfg,
+		limiter:  utils.NewRateLimiter(cfg.RateLimit, constants.RegistrationRateWindow),
+	}
+}
+
+// Register creates an inactive account and sends a verification email.
+// The account is activated once the email is verified and, if approval is
+// required, an admin has approved it.
+func (s *RegistrationService) Register(
+	ctx context.Context,
+	username, email, password, displayName, clientIP string,
+) (*domain.User, error) {
+	if !s.cfg.Enabled {
+		return nil, errors.Forbidden("registration is disabled")
+	}
+
+	if !s.limiter.Allow(clientIP) {
+		s.logger.Warn("Registration rate limit exceeded", interfaces.String("ip", clientIP))
+		return nil, errors.Forbidden("too many registration attempts, try again later")
+	}
+
+	if !strings.Contains(email, "@") {
+		return nil, errors.BadRequest("invalid email address")
+	}
+	if domain.IsDomainBlocked(email, s.cfg.BlockedDomains) {
+		return nil, errors.BadRequest("email domain is not allowed")
+	}
+
+	user, err := newUser(ctx, s.repo, username, email, password, displayName)
+	if err != nil {
+		return nil, err
+	}
+	user.IsActive = false
+	user.PendingApproval = s.cfg.RequireApproval
+
+	role, err := s.repo.GetRoleByName(ctx, domain.RoleUser)
+	if err != nil {
+		return nil, err
+	}
+	user.Roles = []domain.Role{*role}
+
+	token, err := auth.GenerateRefreshToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate verification token: %w", err)
+	}
+
+	verification := &domain.EmailVerification{
+		ID:        uuid.New(),
+		TenantID:  user.TenantID,
+		UserID:    user.ID,
+		TokenHash: domain.HashToken(token),
+		ExpiresAt: time.Now().Add(constants.EmailVerificationTTL),
+	}
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := createRegistration(ctx, tx, user, verification); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit registration: %w", err)
+	}
+
+	// Registration still succeeds if the email cannot be sent
+	if err := s.sendVerificationEmail(ctx, user, token); err != nil {
+		s.logger.Error("Failed to send verification email",
+			interfaces.String("user_id", user.ID.String()),
+			interfaces.Error(err))
+	}
+
+	s.eventBus.PublishAsync(ctx, events.NewEvent("user.registered", map[string]interface{}{
+		"user_id":          user.ID,
+		"tenant_id":        user.TenantID,
+		"username":         user.Username,
+		"email":            user.Email,
+		"pending_approval": user.PendingApproval,
+	}))
+
+	s.logger.Info("User registered",
+		interfaces.String("user_id", user.ID.String()),
+		interfaces.Bool("pending_approval", user.PendingApproval))
+
+	return user, nil
+}
+
+// VerifyEmail consumes a verification token and marks the user's email as
+// verified, activating the account if it needs no further approval.
+func (s *RegistrationService) VerifyEmail(ctx context.Context, token string) (*domain.User, error) {
+	if token == "" {
+		return nil, errors.BadRequest("verification token is required")
+	}
+
+	verification, err := s.repo.GetEmailVerificationByTokenHash(ctx, domain.HashToken(token))
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, errors.BadRequest("invalid verification token")
+		}
+		return nil, err
+	}
+	if !verification.IsUsable() {
+		return nil, errors.BadRequest("verification token has expired or was already used")
+	}
+
+	user, err := s.repo.GetUser(ctx, verification.UserID)
+	if err != nil {
+		return nil, err
+	}
+	user.IsVerified = true
+	user.IsActive = user.ReadyToActivate()
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := verifyEmail(ctx, tx, verification, user); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit email verification: %w", err)
+	}
+
+	s.eventBus.PublishAsync(ctx, events.NewEvent("user.email_verified", map[string]interface{}{
+		"user_id": user.ID,
+	}))
+	if user.IsActive {
+		s.eventBus.PublishAsync(ctx, events.NewEvent("user.activated", map[string]interface{}{
+			"user_id": user.ID,
+		}))
+	}
+
+	s.logger.Info("User email verified",
+		interfaces.String("user_id", user.ID.String()),
+		interfaces.Bool("active", user.IsActive))
+
+	return user, nil
+}
+
+// ListPendingApprovals lists self-registered users awaiting admin approval.
+func (s *RegistrationService) ListPendingApprovals(ctx context.Context, limit, offset int) ([]*domain.User, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > constants.MaxPageSize {
+		limit = constants.MaxPageSize
+	}
+
+	return s.repo.ListPendingApprovals(ctx, limit, offset)
+}
+
+// ApproveRegistration approves a pending account. It is activated immediately
+// if its email is already verified, otherwise on verification.
+func (s *RegistrationService) ApproveRegistration(ctx context.Context, userID uuid.UUID) (*domain.User, error) {
+	user, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.PendingApproval {
+		return nil, errors.Conflict("user is not awaiting approval")
+	}
+
+	user.PendingApproval = false
+	user.IsActive = user.ReadyToActivate()
+
+	if err := s.repo.UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+
+	s.eventBus.PublishAsync(ctx, events.NewEvent("user.registration_approved", map[string]interface{}{
+		"user_id": user.ID,
+	}))
+	if user.IsActive {
+		s.eventBus.PublishAsync(ctx, events.NewEvent("user.activated", map[string]interface{}{
+			"user_id": user.ID,
+		}))
+	}
+
+	s.logger.Info("User registration approved",
+		interfaces.String("user_id", user.ID.String()),
+		interfaces.Bool("active", user.IsActive))
+
+	return user, nil
+}
+
+// RejectRegistration rejects a pending account and deletes it.
+func (s *RegistrationService) RejectRegistration(ctx context.Context, userID uuid.UUID) error {
+	user, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.PendingApproval {
+		return errors.Conflict("user is not awaiting approval")
+	}
+
+	if err := s.repo.DeleteUser(ctx, userID); err != nil {
+		return err
+	}
+
+	s.eventBus.PublishAsync(ctx, events.NewEvent("user.registration_rejected", map[string]interface{}{
+		"user_id":  user.ID,
+		"username": user.Username,
+	}))
+
+	s.logger.Info("User registration rejected",
+		interfaces.String("user_id", user.ID.String()),
+		interfaces.String("username", user.Username))
+
+	return nil
+}
+
+func (s *RegistrationService) sendVerificationEmail(ctx context.Context, user *domain.User, token string) error {
+	link := s.cfg.VerifyURL + "?token=" + token
+
+	// New accounts have no preference yet, so they get the language the
+	// registration request asked for
+	lang := user.Preferences.Language
+	if lang == "" {
+		lang = i18n.FromContext(ctx)
+	}
+
+	body := i18n.T(lang, "email.verify.body", user.Username, link, constants.EmailVerificationTTL)
+	if user.PendingApproval {
+		body += i18n.T(lang, "email.verify.approval")
+	}
+
+	return s.mailer.Send(ctx, user.Email, i18n.T(lang, "email.verify.subject"), body)
+}
+
+// createRegistration creates the user and its verification token within tx.
+func createRegistration(
+	ctx context.Context,
+	tx repository.Repository,
+	user *domain.User,
+	verification *domain.EmailVerification,
+) error {
+	if err := tx.CreateUser(ctx, user); err != nil {
+		return err
+	}
+	return tx.CreateEmailVerification(ctx, verification)
+}
+
+// verifyEmail claims the verification token and updates the user within tx.
+func verifyEmail(
+	ctx context.Context,
+	tx repository.Repository,
+	verification *domain.EmailVerification,
+	user *domain.User,
+) error {
+	if err := tx.MarkEmailVerificationUsed(ctx, verification.ID); err != nil {
+		return err
+	}
+	return tx.UpdateUser(ctx, user)
+}
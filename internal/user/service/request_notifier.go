@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/user/repository"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/i18n"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// RequestNotifier emails users when the content they requested is
+// approved, denied or becomes available. Users who turned notifications
+// off are not emailed.
+type RequestNotifier struct {
+	repo     repository.Repository
+	mailer   interfaces.Mailer
+	eventBus interfaces.EventBus
+	logger   interfaces.Logger
+}
+
+// NewRequestNotifier creates a new request notifier.
+func NewRequestNotifier(
+	repo repository.Repository,
+	mailer interfaces.Mailer,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+) *RequestNotifier {
+	return &RequestNotifier{
+		repo:     repo,
+		mailer:   mailer,
+		eventBus: eventBus,
+		logger:   logger,
+	}
+}
+
+// Start subscribes the notifier to updated content requests.
+func (n *RequestNotifier) Start() error {
+	notify := events.NewConsumer("users.request_notifier", 1, n.handleRequestUpdated)
+	if err := n.eventBus.Subscribe("content_request.updated", notify); err != nil {
+		return fmt.Errorf("failed to subscribe to content_request.updated: %w", err)
+	}
+	return nil
+}
+
+// handleRequestUpdated emails the requester the new status of their
+// request.
+func (n *RequestNotifier) handleRequestUpdated(ctx context.Context, env *events.Envelope) error {
+	payload := env.Payload()
+	status, _ := payload["status"].(string)
+	switch status {
+	case "approved", "denied", "available":
+	default:
+		return nil
+	}
+	userID, err := uuid.Parse(fmt.Sprint(payload["user_id"]))
+	if err != nil {
+		return nil
+	}
+
+	user, err := n.repo.GetUser(ctx, userID)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if !user.Preferences.EnableNotifications {
+		return nil
+	}
+
+	title, _ := payload["title"].(string)
+	reason, _ := payload["reason"].(string)
+	lang := userLanguage(ctx, user)
+	key := "email.request_" + status
+	body := i18n.T(lang, key+".body", user.Username, title)
+	if status == "denied" && reason != "" {
+		body += i18n.T(lang, "email.request_denied.reason", reason)
+	}
+	if err := n.mailer.Send(ctx, user.Email, i18n.T(lang, key+".subject", title), body); err != nil {
+		// Notifications are best effort
+		n.logger.Error("Failed to send content request notification",
+			interfaces.String("user_id", userID.String()),
+			interfaces.String("status", status),
+			interfaces.Error(err))
+	}
+	return nil
+}
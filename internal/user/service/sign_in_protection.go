@@ -0,0 +1,310 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/user/constants"
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/i18n"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// SignInProtection controls how logins unlike the previous ones of a user
+// are handled.
+type SignInProtection struct {
+	// RequireVerification holds anomalous logins until the user enters a
+	// code sent to their email. Otherwise the user is only notified.
+	RequireVerification bool
+	// MaxTravelSpeed is the speed in km/h above which travel between two
+	// sign-ins is impossible. Zero disables the check.
+	MaxTravelSpeed float64
+	// ChallengeTTL is how long verification codes are valid.
+	ChallengeTTL time.Duration
+}
+
+// WithSignInProtection records the sign-ins of users, with the device they
+// came from and where the locator puts their IP address, and checks logins
+// against them. The locator may be nil, leaving countries and travel
+// unchecked. Users are emailed codes and notifications through the mailer.
+// Without sign-in protection, logins are not checked.
+func (s *AuthService) WithSignInProtection(
+	cfg SignInProtection,
+	locator domain.GeoLocator,
+	mailer interfaces.Mailer,
+) *AuthService {
+	if cfg.ChallengeTTL <= 0 {
+		cfg.ChallengeTTL = constants.LoginChallengeTTL
+	}
+	s.protection = &cfg
+	s.locator = locator
+	s.mailer = mailer
+	return s
+}
+
+// checkSignIn compares a login with the sign-in history of the user. It
+// returns the sign-in to record, or a LoginVerificationRequiredError when
+// the login must be confirmed first: with a code of the authenticator app
+// of users with two-factor authentication, which confirms anomalous logins
+// too, or else with a code emailed if the login looks anomalous.
+func (s *AuthService) checkSignIn(
+	ctx context.Context,
+	user *domain.User,
+	deviceInfo, ipAddress, userAgent string,
+) (*domain.SignIn, error) {
+	if s.protection == nil {
+		if user.TOTPEnabled() {
+			return nil, s.challengeTOTP(ctx, user, nil, nil, deviceInfo, ipAddress, userAgent)
+		}
+		return nil, nil
+	}
+
+	f := domain.ParseUserAgent(userAgent)
+	signIn := &domain.SignIn{
+		TenantID:  user.TenantID,
+		UserID:    user.ID,
+		IPAddress: ipAddress,
+		Browser:   f.Browser,
+		OS:        f.OS,
+		Platform:  f.Platform,
+		CreatedAt: time.Now(),
+	}
+	if s.locator != nil && ipAddress != "" {
+		location, err := s.locator.Locate(ctx, ipAddress)
+		if err != nil {
+			// The login is still checked against the known devices
+			s.logger.Warn("Failed to locate sign-in",
+				interfaces.String("user_id", user.ID.String()),
+				interfaces.Error(err))
+		}
+		signIn.SetLocation(location)
+	}
+
+	history, err := s.repo.ListSignIns(ctx, user.ID, constants.LoginHistorySize)
+	if err != nil {
+		return nil, err
+	}
+	anomalies := domain.DetectLoginAnomalies(history, signIn, s.protection.MaxTravelSpeed)
+	signIn.Anomalies = domain.FormatLoginAnomalies(anomalies)
+	if user.TOTPEnabled() {
+		return nil, s.challengeTOTP(ctx, user, signIn, anomalies, deviceInfo, ipAddress, userAgent)
+	}
+	if len(anomalies) == 0 || !s.protection.RequireVerification {
+		return signIn, nil
+	}
+
+	challengeID, err := s.challengeSignIn(ctx, user, signIn, deviceInfo, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Warn("Login held for verification",
+		interfaces.String("user_id", user.ID.String()),
+		interfaces.String("anomalies", signIn.Anomalies))
+	return nil, &domain.LoginVerificationRequiredError{
+		ChallengeID: challengeID,
+		Factor:      domain.LoginFactorEmail,
+		Anomalies:   anomalies,
+	}
+}
+
+// challengeSignIn holds a sign-in and emails the user the code that
+// releases it.
+func (s *AuthService) challengeSignIn(
+	ctx context.Context,
+	user *domain.User,
+	signIn *domain.SignIn,
+	deviceInfo, userAgent string,
+) (uuid.UUID, error) {
+	code, err := generateLoginCode()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	challenge := &domain.LoginChallenge{
+		ID:         uuid.New(),
+		TenantID:   user.TenantID,
+		UserID:     user.ID,
+		Factor:     domain.LoginFactorEmail,
+		CodeHash:   domain.HashToken(code),
+		DeviceInfo: deviceInfo,
+		IPAddress:  signIn.IPAddress,
+		UserAgent:  userAgent,
+		Country:    signIn.Country,
+		Latitude:   signIn.Latitude,
+		Longitude:  signIn.Longitude,
+		Located:    signIn.Located,
+		Anomalies:  signIn.Anomalies,
+		ExpiresAt:  time.Now().Add(s.protection.ChallengeTTL),
+	}
+	if err := s.repo.CreateLoginChallenge(ctx, challenge); err != nil {
+		return uuid.Nil, err
+	}
+
+	// Without the code the login cannot go on, so failing to send it fails
+	// the login
+	lang := userLanguage(ctx, user)
+	body := i18n.T(lang, "email.login_code.body", user.Username, code, describeSignIn(signIn), s.protection.ChallengeTTL)
+	if err := s.mailer.Send(ctx, user.Email, i18n.T(lang, "email.login_code.subject"), body); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to send login code: %w", err)
+	}
+	return challenge.ID, nil
+}
+
+// VerifyLogin completes a login held by a LoginVerificationRequiredError
+// with the code emailed to the user, or for two-factor challenges a code
+// of their authenticator app or a recovery code, returning the tokens and
+// the user signed in.
+func (s *AuthService) VerifyLogin(
+	ctx context.Context,
+	challengeID uuid.UUID,
+	code string,
+) (*domain.AuthTokens, *domain.User, error) {
+	challenge, err := s.repo.GetLoginChallenge(ctx, challengeID)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil, errors.Unauthorized("invalid verification code")
+		}
+		return nil, nil, err
+	}
+	if !challenge.IsUsable() {
+		return nil, nil, errors.Unauthorized("verification code expired")
+	}
+
+	valid, err := s.checkChallengeCode(ctx, challenge, code)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !valid {
+		challenge.Attempts++
+		if err := s.repo.UpdateLoginChallenge(ctx, challenge); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, errors.Unauthorized("invalid verification code")
+	}
+	now := time.Now()
+	challenge.UsedAt = &now
+	if err := s.repo.UpdateLoginChallenge(ctx, challenge); err != nil {
+		return nil, nil, err
+	}
+
+	// The account may have changed since the password was checked
+	user, err := s.repo.GetUser(ctx, challenge.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := auth.CheckCanLogin(ctx, s.repo, user); err != nil {
+		return nil, nil, err
+	}
+
+	// Two-factor challenges are made without sign-in protection too, and
+	// then have no sign-in to record
+	var signIn *domain.SignIn
+	if s.protection != nil {
+		signIn = challenge.SignIn()
+		signIn.CreatedAt = now
+	}
+	tokens, err := s.startSession(ctx, user, signIn, true, challenge.DeviceInfo, challenge.IPAddress, challenge.UserAgent)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tokens, user, nil
+}
+
+// checkChallengeCode checks the code a login challenge is answered with.
+func (s *AuthService) checkChallengeCode(ctx context.Context, challenge *domain.LoginChallenge, code string) (bool, error) {
+	if challenge.Factor != domain.LoginFactorTOTP {
+		return subtle.ConstantTimeCompare([]byte(domain.HashToken(code)), []byte(challenge.CodeHash)) == 1, nil
+	}
+	user, err := s.repo.GetUser(ctx, challenge.UserID)
+	if err != nil {
+		return false, err
+	}
+	// Users who turned two-factor authentication off since have no codes
+	if !user.TOTPEnabled() {
+		return false, nil
+	}
+	return s.checkSecondFactor(ctx, user, code)
+}
+
+// recordSignIn adds a sign-in to the history of the user, and tells them
+// about it when it was unlike the previous ones.
+func (s *AuthService) recordSignIn(ctx context.Context, user *domain.User, signIn *domain.SignIn, verified bool) {
+	if err := s.repo.CreateSignIn(ctx, signIn); err != nil {
+		s.logger.Error("Failed to record sign-in",
+			interfaces.String("user_id", user.ID.String()),
+			interfaces.Error(err))
+	}
+	anomalies := domain.ParseLoginAnomalies(signIn.Anomalies)
+	if len(anomalies) == 0 {
+		return
+	}
+
+	lang := userLanguage(ctx, user)
+	body := i18n.T(lang, "email.new_sign_in.body",
+		user.Username, describeSignIn(signIn), signIn.CreatedAt.UTC().Format(time.RFC1123))
+	if err := s.mailer.Send(ctx, user.Email, i18n.T(lang, "email.new_sign_in.subject"), body); err != nil {
+		s.logger.Error("Failed to send new sign-in notification",
+			interfaces.String("user_id", user.ID.String()),
+			interfaces.Error(err))
+	}
+
+	names := make([]string, len(anomalies))
+	for i, a := range anomalies {
+		names[i] = string(a)
+	}
+	s.eventBus.PublishAsync(ctx, events.NewEvent("user.new_sign_in", map[string]interface{}{
+		"user_id":    user.ID,
+		"session_id": signIn.SessionID,
+		"ip_address": signIn.IPAddress,
+		"browser":    signIn.Browser,
+		"os":         signIn.OS,
+		"platform":   signIn.Platform,
+		"country":    signIn.Country,
+		"anomalies":  names,
+		"verified":   verified,
+	}))
+}
+
+// describeSignIn names the device and place of a sign-in for emails.
+func describeSignIn(signIn *domain.SignIn) string {
+	device := signIn.Browser
+	if signIn.OS != "" {
+		if device != "" {
+			device += " on "
+		}
+		device += signIn.OS
+	}
+	if device == "" {
+		device = signIn.Platform
+	}
+	desc := fmt.Sprintf("%s (%s", device, signIn.IPAddress)
+	if signIn.Country != "" {
+		desc += ", " + signIn.Country
+	}
+	return desc + ")"
+}
+
+// userLanguage is the language emails to a user are written in.
+func userLanguage(ctx context.Context, user *domain.User) string {
+	if user.Preferences.Language != "" {
+		return user.Preferences.Language
+	}
+	return i18n.FromContext(ctx)
+}
+
+// generateLoginCode returns a random six digit code.
+func generateLoginCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate login code: %w", err)
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/user/constants"
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/internal/user/repository"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/tenant"
+)
+
+var tenantSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,62}$`)
+
+// TenantService handles tenant management operations.
+type TenantService struct {
+	repo     repository.Repository
+	eventBus interfaces.EventBus
+	logger   interfaces.Logger
+}
+
+// NewTenantService creates a new tenant service.
+func NewTenantService(
+	repo repository.Repository,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+) *TenantService {
+	return &TenantService{
+		repo:     repo,
+		eventBus: eventBus,
+		logger:   logger,
+	}
+}
+
+// CreateTenant creates a new tenant.
+func (s *TenantService) CreateTenant(
+	ctx context.Context,
+	name, slug string,
+	quotas tenant.Quotas,
+	settings tenant.Settings,
+) (*domain.Tenant, error) {
+	name = strings.TrimSpace(name)
+	slug = strings.ToLower(strings.TrimSpace(slug))
+	if name == "" || slug == "" {
+		return nil, errors.BadRequest("tenant name and slug are required")
+	}
+	if !tenantSlugPattern.MatchString(slug) {
+		return nil, errors.BadRequest("tenant slug must be lowercase letters, digits and dashes")
+	}
+
+	t := &domain.Tenant{
+		ID:       uuid.New(),
+		Name:     name,
+		Slug:     slug,
+		IsActive: true,
+		Quotas:   quotas,
+		Settings: settings,
+	}
+
+	if err := s.repo.CreateTenant(ctx, t); err != nil {
+		return nil, err
+	}
+
+	s.eventBus.PublishAsync(ctx, events.NewEvent("tenant.created", map[string]interface{}{
+		"tenant_id": t.ID,
+		"slug":      t.Slug,
+	}))
+
+	s.logger.Info("Tenant created",
+		interfaces.String("tenant_id", t.ID.String()),
+		interfaces.String("slug", t.Slug))
+
+	return t, nil
+}
+
+// GetTenant retrieves a tenant by ID.
+func (s *TenantService) GetTenant(ctx context.Context, id uuid.UUID) (*domain.Tenant, error) {
+	return s.repo.GetTenant(ctx, id)
+}
+
+// ListTenants lists tenants with pagination.
+func (s *TenantService) ListTenants(ctx context.Context, limit, offset int) ([]*domain.Tenant, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > constants.MaxPageSize {
+		limit = constants.MaxPageSize
+	}
+
+	return s.repo.ListTenants(ctx, limit, offset)
+}
+
+// UpdateTenant updates a tenant's name, status, quotas or settings.
+func (s *TenantService) UpdateTenant(
+	ctx context.Context,
+	id uuid.UUID,
+	updates map[string]interface{},
+) (*domain.Tenant, error) {
+	t, err := s.repo.GetTenant(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if name, ok := updates["name"].(string); ok && name != "" {
+		t.Name = name
+	}
+	if active, ok := updates["is_active"].(bool); ok {
+		t.IsActive = active
+	}
+	if quotas, ok := updates["quotas"].(tenant.Quotas); ok {
+		t.Quotas = quotas
+	}
+	if settings, ok := updates["settings"].(tenant.Settings); ok {
+		t.Settings = settings
+	}
+
+	if err := s.repo.UpdateTenant(ctx, t); err != nil {
+		return nil, err
+	}
+
+	s.eventBus.PublishAsync(ctx, events.NewEvent("tenant.updated", map[string]interface{}{
+		"tenant_id": t.ID,
+	}))
+
+	return t, nil
+}
+
+// checkUserQuota returns an error if the tenant has reached its user limit.
+// The default tenant has no row and is never limited.
+func checkUserQuota(ctx context.Context, repo repository.Repository, tenantID uuid.UUID) error {
+	if tenantID == tenant.DefaultID {
+		return nil
+	}
+
+	t, err := repo.GetTenant(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	if !t.IsActive {
+		return errors.Forbidden("tenant is disabled")
+	}
+	if t.Quotas.MaxUsers <= 0 {
+		return nil
+	}
+
+	count, err := repo.CountUsers(ctx)
+	if err != nil {
+		return err
+	}
+	if !t.Quotas.AllowsUsers(count) {
+		return errors.Forbidden("tenant user quota exceeded")
+	}
+
+	return nil
+}
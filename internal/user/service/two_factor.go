@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/user/constants"
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/encryption"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// WithTOTP lets users enable two-factor authentication with an
+// authenticator app. Their secrets are stored encrypted with encryptor,
+// and apps list them under issuer. Without it, EnableTOTP fails, but users
+// who enabled it still cannot log in without a code.
+func (s *AuthService) WithTOTP(issuer string, encryptor *encryption.Encryptor) *AuthService {
+	s.totpIssuer = issuer
+	s.encryptor = encryptor
+	return s
+}
+
+// EnableTOTP starts enrolling an authenticator app for a user, who
+// confirms their password. It returns the secret and the otpauth URI apps
+// enroll it with; logins require its codes once VerifyTOTP confirmed it.
+// Enrolling again before then replaces the secret.
+func (s *AuthService) EnableTOTP(ctx context.Context, userID uuid.UUID, password string) (string, string, error) {
+	if s.encryptor == nil {
+		return "", "", errors.Forbidden("two-factor authentication is not available")
+	}
+	user, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return "", "", err
+	}
+	if user.TOTPEnabled() {
+		return "", "", errors.Conflict("two-factor authentication is already enabled")
+	}
+	if !user.CheckPassword(password) {
+		return "", "", errors.Unauthorized("invalid password")
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate TOTP secret: %w", err)
+	}
+	encrypted, err := s.encryptor.Encrypt(secret)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encrypt TOTP secret: %w", err)
+	}
+	user.TOTPSecret = encrypted
+	user.TOTPLastStep = 0
+	if err := s.repo.UpdateUser(ctx, user); err != nil {
+		return "", "", err
+	}
+	return secret, auth.TOTPURI(s.totpIssuer, user.Username, secret), nil
+}
+
+// VerifyTOTP confirms the authenticator app enrolled by EnableTOTP with one
+// of its codes, enabling two-factor authentication. It returns the
+// recovery codes the user logs in with if they lose the app, which are
+// not stored and cannot be retrieved later.
+func (s *AuthService) VerifyTOTP(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	user, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled() {
+		return nil, errors.Conflict("two-factor authentication is already enabled")
+	}
+	if user.TOTPSecret == "" {
+		return nil, errors.BadRequest("two-factor authentication setup not started")
+	}
+	secret, err := s.totpSecret(user)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := auth.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return nil, errors.BadRequest("invalid two-factor code")
+	}
+
+	codes, err := s.replaceRecoveryCodes(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	user.TOTPEnabledAt = &now
+	user.TOTPLastStep = step
+	if err := s.repo.UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+
+	s.eventBus.PublishAsync(ctx, events.NewEvent("user.totp_enabled", map[string]interface{}{
+		"user_id": user.ID,
+	}))
+
+	s.logger.Info("Two-factor authentication enabled",
+		interfaces.String("user_id", user.ID.String()))
+
+	return codes, nil
+}
+
+// DisableTOTP turns two-factor authentication off for a user, who confirms
+// it with a code of their authenticator app or a recovery code.
+func (s *AuthService) DisableTOTP(ctx context.Context, userID uuid.UUID, code string) error {
+	user, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled() {
+		return errors.BadRequest("two-factor authentication is not enabled")
+	}
+	ok, err := s.checkSecondFactor(ctx, user, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.BadRequest("invalid two-factor code")
+	}
+
+	user.TOTPSecret = ""
+	user.TOTPEnabledAt = nil
+	user.TOTPLastStep = 0
+	if err := s.repo.UpdateUser(ctx, user); err != nil {
+		return err
+	}
+	if err := s.repo.DeleteRecoveryCodes(ctx, user.ID); err != nil {
+		return err
+	}
+
+	s.eventBus.PublishAsync(ctx, events.NewEvent("user.totp_disabled", map[string]interface{}{
+		"user_id": user.ID,
+	}))
+
+	s.logger.Info("Two-factor authentication disabled",
+		interfaces.String("user_id", user.ID.String()))
+
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of a user, who
+// confirms it with a code of their authenticator app, and returns the new
+// ones.
+func (s *AuthService) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	user, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TOTPEnabled() {
+		return nil, errors.BadRequest("two-factor authentication is not enabled")
+	}
+	secret, err := s.totpSecret(user)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := auth.ValidateTOTP(secret, code, time.Now())
+	if ok {
+		ok, err = s.useTOTPStep(ctx, user, secret, step)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !ok {
+		return nil, errors.BadRequest("invalid two-factor code")
+	}
+	return s.replaceRecoveryCodes(ctx, user)
+}
+
+// challengeTOTP holds a login of a user with two-factor authentication
+// until they enter a code of their authenticator app. The sign-in, if
+// sign-in protection recorded one, is released with the login.
+func (s *AuthService) challengeTOTP(
+	ctx context.Context,
+	user *domain.User,
+	signIn *domain.SignIn,
+	anomalies []domain.LoginAnomaly,
+	deviceInfo, ipAddress, userAgent string,
+) error {
+	ttl := constants.LoginChallengeTTL
+	if s.protection != nil {
+		ttl = s.protection.ChallengeTTL
+	}
+	challenge := &domain.LoginChallenge{
+		ID:         uuid.New(),
+		TenantID:   user.TenantID,
+		UserID:     user.ID,
+		Factor:     domain.LoginFactorTOTP,
+		DeviceInfo: deviceInfo,
+		IPAddress:  ipAddress,
+		UserAgent:  userAgent,
+		ExpiresAt:  time.Now().Add(ttl),
+	}
+	if signIn != nil {
+		challenge.Country = signIn.Country
+		challenge.Latitude = signIn.Latitude
+		challenge.Longitude = signIn.Longitude
+		challenge.Located = signIn.Located
+		challenge.Anomalies = signIn.Anomalies
+	}
+	if err := s.repo.CreateLoginChallenge(ctx, challenge); err != nil {
+		return err
+	}
+	return &domain.LoginVerificationRequiredError{
+		ChallengeID: challenge.ID,
+		Factor:      domain.LoginFactorTOTP,
+		Anomalies:   anomalies,
+	}
+}
+
+// checkSecondFactor checks a code of the authenticator app of a user, or
+// one of their recovery codes, and uses it up. Recovery codes still work
+// if the secret cannot be decrypted, such as after losing the key.
+func (s *AuthService) checkSecondFactor(ctx context.Context, user *domain.User, code string) (bool, error) {
+	secret, secretErr := s.totpSecret(user)
+	if secretErr == nil {
+		if step, ok := auth.ValidateTOTP(secret, code, time.Now()); ok {
+			return s.useTOTPStep(ctx, user, secret, step)
+		}
+	}
+
+	hash := domain.HashToken(domain.NormalizeRecoveryCode(code))
+	if err := s.repo.UseRecoveryCode(ctx, user.ID, hash, time.Now()); err != nil {
+		if errors.IsNotFound(err) {
+			return false, secretErr
+		}
+		return false, err
+	}
+	s.logger.Warn("Recovery code used",
+		interfaces.String("user_id", user.ID.String()))
+	return true, nil
+}
+
+// useTOTPStep records the time step of a code of the authenticator app of
+// a user as used, unless it already is.
+func (s *AuthService) useTOTPStep(ctx context.Context, user *domain.User, secret string, step int64) (bool, error) {
+	// Codes stay valid for a while, so they are replayed easily
+	if step <= user.TOTPLastStep {
+		return false, nil
+	}
+	user.TOTPLastStep = step
+	// Secrets left under a previous key are re-encrypted with the current
+	// one
+	if s.encryptor.NeedsRotation(user.TOTPSecret) {
+		encrypted, err := s.encryptor.Encrypt(secret)
+		if err != nil {
+			return false, fmt.Errorf("failed to encrypt TOTP secret: %w", err)
+		}
+		user.TOTPSecret = encrypted
+	}
+	if err := s.repo.UpdateUser(ctx, user); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// totpSecret decrypts the TOTP secret of a user.
+func (s *AuthService) totpSecret(user *domain.User) (string, error) {
+	if s.encryptor == nil {
+		return "", fmt.Errorf("no encryption key to decrypt TOTP secret of user %s", user.ID)
+	}
+	secret, err := s.encryptor.Decrypt(user.TOTPSecret)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt TOTP secret: %w", err)
+	}
+	return secret, nil
+}
+
+// replaceRecoveryCodes gives a user new recovery codes and returns them.
+func (s *AuthService) replaceRecoveryCodes(ctx context.Context, user *domain.User) ([]string, error) {
+	codes := make([]string, constants.RecoveryCodeCount)
+	records := make([]*domain.RecoveryCode, len(codes))
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		records[i] = &domain.RecoveryCode{
+			ID:       uuid.New(),
+			TenantID: user.TenantID,
+			UserID:   user.ID,
+			CodeHash: domain.HashToken(domain.NormalizeRecoveryCode(code)),
+		}
+	}
+	if err := s.repo.ReplaceRecoveryCodes(ctx, user.ID, records); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateRecoveryCode returns a random recovery code of ten characters,
+// grouped by five to make it easier to copy.
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %w", err)
+	}
+	code := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
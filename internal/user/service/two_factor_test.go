@@ -0,0 +1,110 @@
+package service_test
+
+import (
+	"context"
+	stderrors "errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/internal/user/service"
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/encryption"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/logger"
+	"github.com/narwhalmedia/narwhal/pkg/testing/fake"
+)
+
+func TestTwoFactorAuthentication(t *testing.T) {
+	ctx := context.Background()
+	repo := fake.NewUserRepository()
+	require.NoError(t, repo.CreateRole(ctx, &domain.Role{Name: domain.RoleUser}))
+	role, err := repo.GetRoleByName(ctx, domain.RoleUser)
+	require.NoError(t, err)
+	alice := &domain.User{Username: "alice", Email: "alice@example.com", IsActive: true, Roles: []domain.Role{*role}}
+	require.NoError(t, alice.SetPassword("password123"))
+	require.NoError(t, repo.CreateUser(ctx, alice))
+
+	jwtManager := auth.NewJWTManager("access", "refresh", "narwhal", 15*time.Minute, time.Hour)
+	authService := service.NewAuthService(repo, jwtManager, fake.NewEventBus(), logger.NewNoopLogger())
+	_, _, err = authService.EnableTOTP(ctx, alice.ID, "password123")
+	assert.True(t, errors.IsForbidden(err), "unavailable without an encryption key")
+
+	encryptor, err := encryption.NewEncryptor("test-key")
+	require.NoError(t, err)
+	authService.WithTOTP("Narwhal", encryptor)
+
+	login := func() (*domain.AuthTokens, *domain.LoginVerificationRequiredError) {
+		tokens, err := authService.Login(ctx, "alice", "password123", "Phone", "127.0.0.1", "Test/1.0")
+		var verification *domain.LoginVerificationRequiredError
+		if stderrors.As(err, &verification) {
+			return nil, verification
+		}
+		require.NoError(t, err)
+		return tokens, nil
+	}
+	code := func(secret string, offset int64) string {
+		c, err := auth.TOTPCode(secret, auth.TOTPStep(time.Now())+offset)
+		require.NoError(t, err)
+		return c
+	}
+
+	_, _, err = authService.EnableTOTP(ctx, alice.ID, "wrong")
+	assert.True(t, errors.IsUnauthorized(err))
+	secret, uri, err := authService.EnableTOTP(ctx, alice.ID, "password123")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Narwhal:alice?"), uri)
+	stored, err := repo.GetUser(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.NotContains(t, stored.TOTPSecret, secret, "secrets are stored encrypted")
+
+	// Logins need no code until the app is confirmed
+	tokens, _ := login()
+	assert.NotNil(t, tokens)
+
+	_, err = authService.VerifyTOTP(ctx, alice.ID, "000000")
+	assert.True(t, errors.IsBadRequest(err))
+	recoveryCodes, err := authService.VerifyTOTP(ctx, alice.ID, code(secret, 0))
+	require.NoError(t, err)
+	assert.Len(t, recoveryCodes, 10)
+	_, _, err = authService.EnableTOTP(ctx, alice.ID, "password123")
+	assert.True(t, errors.IsConflict(err))
+
+	_, verification := login()
+	require.NotNil(t, verification)
+	assert.Equal(t, domain.LoginFactorTOTP, verification.Factor)
+
+	_, _, err = authService.VerifyLogin(ctx, verification.ChallengeID, code(secret, 0))
+	assert.True(t, errors.IsUnauthorized(err), "codes cannot be used twice")
+	tokens, user, err := authService.VerifyLogin(ctx, verification.ChallengeID, code(secret, 1))
+	require.NoError(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.Equal(t, alice.ID, user.ID)
+
+	// Recovery codes work once, however they are typed
+	_, verification = login()
+	require.NotNil(t, verification)
+	_, _, err = authService.VerifyLogin(ctx, verification.ChallengeID, strings.ToUpper(recoveryCodes[0]))
+	require.NoError(t, err)
+	_, verification = login()
+	require.NotNil(t, verification)
+	_, _, err = authService.VerifyLogin(ctx, verification.ChallengeID, recoveryCodes[0])
+	assert.True(t, errors.IsUnauthorized(err))
+
+	assert.True(t, errors.IsBadRequest(authService.DisableTOTP(ctx, alice.ID, recoveryCodes[0])))
+	require.NoError(t, authService.DisableTOTP(ctx, alice.ID, recoveryCodes[1]))
+	stored, err = repo.GetUser(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.False(t, stored.TOTPEnabled())
+	assert.Empty(t, stored.TOTPSecret)
+	remaining, err := repo.CountRecoveryCodes(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.Zero(t, remaining)
+
+	tokens, _ = login()
+	assert.NotNil(t, tokens)
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/narwhalmedia/narwhal/pkg/errors"
 	"github.com/narwhalmedia/narwhal/pkg/events"
 	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/tenant"
 )
 
 // UserService handles user management operations.
@@ -43,38 +44,10 @@ func (s *UserService) CreateUser(
 	ctx context.Context,
 	username, email, password, displayName string,
 ) (*domain.User, error) {
-	// Validate input
-	if username == "" || email == "" || password == "" {
-		return nil, errors.BadRequest("username, email, and password are required")
-	}
-
-	// Normalize username and email
-	username = strings.ToLower(strings.TrimSpace(username))
-	email = strings.ToLower(strings.TrimSpace(email))
-
-	// Check if user exists
-	exists, err := s.repo.UserExists(ctx, username, email)
+	user, err := newUser(ctx, s.repo, username, email, password, displayName)
 	if err != nil {
 		return nil, err
 	}
-	if exists {
-		return nil, errors.Conflict("username or email already exists")
-	}
-
-	// Create user
-	user := &domain.User{
-		ID:          uuid.New(),
-		Username:    username,
-		Email:       email,
-		DisplayName: displayName,
-		IsActive:    true,
-		IsVerified:  false,
-	}
-
-	// Hash password
-	if err := user.SetPassword(password); err != nil {
-		return nil, fmt.Errorf("failed to hash password: %w", err)
-	}
 
 	// Assign default user role
 	defaultRole, err := s.repo.GetRoleByName(ctx, domain.RoleUser)
@@ -98,9 +71,10 @@ func (s *UserService) CreateUser(
 
 	// Publish event
 	s.eventBus.PublishAsync(ctx, events.NewEvent("user.created", map[string]interface{}{
-		"user_id":  user.ID,
-		"username": user.Username,
-		"email":    user.Email,
+		"user_id":   user.ID,
+		"tenant_id": user.TenantID,
+		"username":  user.Username,
+		"email":     user.Email,
 	}))
 
 	s.logger.Info("User created",
@@ -394,3 +368,52 @@ func (s *UserService) SetUserActive(ctx context.Context, userID uuid.UUID, activ
 
 	return nil
 }
+
+// newUser validates and builds a user in the caller's tenant without persisting it.
+func newUser(
+	ctx context.Context,
+	repo repository.Repository,
+	username, email, password, displayName string,
+) (*domain.User, error) {
+	// Validate input
+	if username == "" || email == "" || password == "" {
+		return nil, errors.BadRequest("username, email, and password are required")
+	}
+
+	// Normalize username and email
+	username = strings.ToLower(strings.TrimSpace(username))
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	// Check if user exists
+	exists, err := repo.UserExists(ctx, username, email)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, errors.Conflict("username or email already exists")
+	}
+
+	// New users join the caller's tenant, subject to its quota
+	tenantID, _ := tenant.FromContext(ctx)
+	if err := checkUserQuota(ctx, repo, tenantID); err != nil {
+		return nil, err
+	}
+
+	// Create user
+	user := &domain.User{
+		ID:          uuid.New(),
+		TenantID:    tenantID,
+		Username:    username,
+		Email:       email,
+		DisplayName: displayName,
+		IsActive:    true,
+		IsVerified:  false,
+	}
+
+	// Hash password
+	if err := user.SetPassword(password); err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	return user, nil
+}
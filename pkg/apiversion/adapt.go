@@ -0,0 +1,31 @@
+package apiversion
+
+import (
+	"context"
+)
+
+// Adapt implements a method of an old API version with its counterpart in
+// the new version: the request is upgraded to the new version, handled by
+// call, and the response downgraded to the old version. Errors of upgrade
+// and downgrade are returned as they are, so they should be gRPC status
+// errors, such as InvalidArgument for requests the new version cannot
+// express.
+func Adapt[OldReq, NewReq, NewResp, OldResp any](
+	upgrade func(OldReq) (NewReq, error),
+	call func(context.Context, NewReq) (NewResp, error),
+	downgrade func(NewResp) (OldResp, error),
+) func(context.Context, OldReq) (OldResp, error) {
+	return func(ctx context.Context, req OldReq) (OldResp, error) {
+		var zero OldResp
+
+		newReq, err := upgrade(req)
+		if err != nil {
+			return zero, err
+		}
+		newResp, err := call(ctx, newReq)
+		if err != nil {
+			return zero, err
+		}
+		return downgrade(newResp)
+	}
+}
@@ -0,0 +1,271 @@
+// Package apiversion implements the API versioning policy of the services.
+//
+// A breaking change to a service adds a new version of its proto package,
+// such as narwhal.library.v2, which is served next to the old one. The old
+// version is reimplemented on top of the new with Adapt, and deprecated in
+// the Policy: its responses then carry Deprecation and Sunset metadata, and
+// the calls to each version are counted, so it can be removed once clients
+// stopped calling it.
+package apiversion
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/metrics"
+)
+
+// Metadata keys of the responses of deprecated methods. Deprecation and
+// Sunset follow the HTTP headers of RFC 9745 and RFC 8594, which gateways
+// forward to HTTP clients.
+const (
+	DeprecationKey = "deprecation"
+	SunsetKey      = "sunset"
+	// ReplacementKey names the method replacing a deprecated one.
+	ReplacementKey = "x-narwhal-replacement"
+)
+
+// Method is a gRPC method split into the parts of its full name, such as
+// "/narwhal.library.v1.LibraryService/ListMedia".
+type Method struct {
+	Package string // narwhal.library
+	Version string // v1; empty if the package is not versioned
+	Service string // LibraryService
+	Name    string // ListMedia
+}
+
+var versionPattern = regexp.MustCompile(`^v\d+((alpha|beta)\d*)?$`)
+
+// ParseMethod splits a full method name.
+func ParseMethod(fullMethod string) Method {
+	service, name, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	var m Method
+	m.Name = name
+	if i := strings.LastIndex(service, "."); i >= 0 {
+		m.Package, m.Service = service[:i], service[i+1:]
+	} else {
+		m.Service = service
+	}
+	if i := strings.LastIndex(m.Package, "."); i >= 0 && versionPattern.MatchString(m.Package[i+1:]) {
+		m.Package, m.Version = m.Package[:i], m.Package[i+1:]
+	}
+	return m
+}
+
+// FullService returns the full name of the service of a method, such as
+// "narwhal.library.v1.LibraryService".
+func (m Method) FullService() string {
+	parts := make([]string, 0, 3)
+	for _, part := range []string{m.Package, m.Version, m.Service} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// Deprecation describes a deprecated service or method.
+type Deprecation struct {
+	// Since is when it was deprecated.
+	Since time.Time
+	// Sunset is when it is to be removed; zero if not yet planned.
+	Sunset time.Time
+	// Replacement is the full name of the service or method replacing it,
+	// such as "narwhal.library.v2.LibraryService".
+	Replacement string
+}
+
+// Policy knows the deprecated services and methods, and counts the calls
+// to each API version.
+type Policy struct {
+	deprecations map[string]Deprecation
+	// enforceSunset rejects calls after the sunset of their method.
+	enforceSunset bool
+	logger        interfaces.Logger
+
+	mu     sync.Mutex
+	usage  map[usageKey]uint64
+	warned map[string]bool
+}
+
+type usageKey struct {
+	service, version, method string
+	deprecated               bool
+}
+
+// NewPolicy creates a policy without deprecations.
+func NewPolicy(logger interfaces.Logger) *Policy {
+	return &Policy{
+		deprecations: make(map[string]Deprecation),
+		logger:       logger,
+		usage:        make(map[usageKey]uint64),
+		warned:       make(map[string]bool),
+	}
+}
+
+// Deprecate deprecates a service, by its full name such as
+// "narwhal.library.v1.LibraryService", or a single method, by its full
+// method name. The deprecation of a method wins over that of its service.
+func (p *Policy) Deprecate(target string, d Deprecation) *Policy {
+	p.deprecations[strings.TrimPrefix(target, "/")] = d
+	return p
+}
+
+// EnforceSunset rejects calls to methods past their sunset as
+// unimplemented, rather than only warning about them.
+func (p *Policy) EnforceSunset(enforce bool) *Policy {
+	p.enforceSunset = enforce
+	return p
+}
+
+// Deprecation returns the deprecation of a method, if it is deprecated.
+func (p *Policy) Deprecation(fullMethod string) (Deprecation, bool) {
+	if d, ok := p.deprecations[strings.TrimPrefix(fullMethod, "/")]; ok {
+		return d, true
+	}
+	d, ok := p.deprecations[ParseMethod(fullMethod).FullService()]
+	return d, ok
+}
+
+// Usage is the number of calls to a method of an API version.
+type Usage struct {
+	Service    string // the service without its version, such as narwhal.library.LibraryService
+	Version    string
+	Method     string
+	Deprecated bool
+	Calls      uint64
+}
+
+// Usage returns the number of calls to each method called since the
+// policy was created, by service, version and method.
+func (p *Policy) Usage() []Usage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	usage := make([]Usage, 0, len(p.usage))
+	for key, calls := range p.usage {
+		usage = append(usage, Usage{
+			Service:    key.service,
+			Version:    key.version,
+			Method:     key.method,
+			Deprecated: key.deprecated,
+			Calls:      calls,
+		})
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		a, b := usage[i], usage[j]
+		if a.Service != b.Service {
+			return a.Service < b.Service
+		}
+		if a.Version != b.Version {
+			return a.Version < b.Version
+		}
+		return a.Method < b.Method
+	})
+	return usage
+}
+
+// WriteMetrics writes the calls to each API version.
+func (p *Policy) WriteMetrics(w *metrics.Writer) {
+	for _, u := range p.Usage() {
+		w.Counter(metrics.APIRequestsTotal, "Calls to each method of each API version.",
+			float64(u.Calls),
+			"service", u.Service,
+			"version", u.Version,
+			"method", u.Method,
+			"deprecated", fmt.Sprint(u.Deprecated))
+	}
+}
+
+// UnaryServerInterceptor counts the calls to each API version, and adds
+// the deprecation metadata to the responses of deprecated methods.
+func (p *Policy) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := p.check(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of
+// UnaryServerInterceptor.
+func (p *Policy) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := p.check(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// check counts a call and, if its method is deprecated, sets the
+// deprecation metadata of its response. Calls past the sunset fail when it
+// is enforced.
+func (p *Policy) check(ctx context.Context, fullMethod string) error {
+	method := ParseMethod(fullMethod)
+	d, deprecated := p.Deprecation(fullMethod)
+
+	p.mu.Lock()
+	p.usage[usageKey{
+		service:    Method{Package: method.Package, Service: method.Service}.FullService(),
+		version:    method.Version,
+		method:     method.Name,
+		deprecated: deprecated,
+	}]++
+	warn := deprecated && !p.warned[fullMethod]
+	if warn {
+		p.warned[fullMethod] = true
+	}
+	p.mu.Unlock()
+
+	if !deprecated {
+		return nil
+	}
+
+	if p.enforceSunset && !d.Sunset.IsZero() && time.Now().After(d.Sunset) {
+		msg := fmt.Sprintf("%s was removed on %s", fullMethod, d.Sunset.Format(time.DateOnly))
+		if d.Replacement != "" {
+			msg += "; use " + d.Replacement
+		}
+		return status.Error(codes.Unimplemented, msg)
+	}
+
+	if warn && p.logger != nil {
+		p.logger.Warn("Deprecated API method called",
+			interfaces.String("method", fullMethod),
+			interfaces.String("replacement", d.Replacement))
+	}
+	// SetHeader only fails outside a gRPC server
+	_ = grpc.SetHeader(ctx, deprecationMetadata(d))
+	return nil
+}
+
+// deprecationMetadata returns the response metadata of a deprecated
+// method.
+func deprecationMetadata(d Deprecation) metadata.MD {
+	md := metadata.Pairs(DeprecationKey, "true")
+	if !d.Since.IsZero() {
+		// RFC 9745 dates are structured field dates: @ and Unix seconds
+		md.Set(DeprecationKey, fmt.Sprintf("@%d", d.Since.Unix()))
+	}
+	if !d.Sunset.IsZero() {
+		md.Set(SunsetKey, d.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if d.Replacement != "" {
+		md.Set(ReplacementKey, d.Replacement)
+	}
+	return md
+}
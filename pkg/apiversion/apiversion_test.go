@@ -0,0 +1,108 @@
+package apiversion_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/narwhalmedia/narwhal/pkg/apiversion"
+	"github.com/narwhalmedia/narwhal/pkg/metrics"
+)
+
+func TestParseMethod(t *testing.T) {
+	m := apiversion.ParseMethod("/narwhal.library.v2beta1.LibraryService/ListMedia")
+	assert.Equal(t, apiversion.Method{
+		Package: "narwhal.library",
+		Version: "v2beta1",
+		Service: "LibraryService",
+		Name:    "ListMedia",
+	}, m)
+	assert.Equal(t, "narwhal.library.v2beta1.LibraryService", m.FullService())
+
+	m = apiversion.ParseMethod("/grpc.health.HealthService/Check")
+	assert.Equal(t, "grpc.health", m.Package)
+	assert.Empty(t, m.Version)
+}
+
+func TestPolicy(t *testing.T) {
+	sunset := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := apiversion.NewPolicy(nil).
+		Deprecate("narwhal.library.v1.LibraryService", apiversion.Deprecation{
+			Sunset:      sunset,
+			Replacement: "narwhal.library.v2.LibraryService",
+		}).
+		Deprecate("/narwhal.library.v1.LibraryService/ListMedia", apiversion.Deprecation{
+			Replacement: "/narwhal.library.v2.LibraryService/ListItems",
+		})
+
+	d, ok := p.Deprecation("/narwhal.library.v1.LibraryService/GetMedia")
+	require.True(t, ok)
+	assert.Equal(t, "narwhal.library.v2.LibraryService", d.Replacement)
+	d, ok = p.Deprecation("/narwhal.library.v1.LibraryService/ListMedia")
+	require.True(t, ok)
+	assert.Equal(t, "/narwhal.library.v2.LibraryService/ListItems", d.Replacement)
+	_, ok = p.Deprecation("/narwhal.library.v2.LibraryService/GetMedia")
+	assert.False(t, ok)
+
+	call := func(method string) error {
+		_, err := p.UnaryServerInterceptor()(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method},
+			func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil })
+		return err
+	}
+	require.NoError(t, call("/narwhal.library.v1.LibraryService/GetMedia"))
+	require.NoError(t, call("/narwhal.library.v1.LibraryService/GetMedia"))
+	require.NoError(t, call("/narwhal.library.v2.LibraryService/GetMedia"))
+
+	assert.Equal(t, []apiversion.Usage{
+		{Service: "narwhal.library.LibraryService", Version: "v1", Method: "GetMedia", Deprecated: true, Calls: 2},
+		{Service: "narwhal.library.LibraryService", Version: "v2", Method: "GetMedia", Calls: 1},
+	}, p.Usage())
+
+	var buf bytes.Buffer
+	p.WriteMetrics(metrics.NewWriter(&buf))
+	assert.Contains(t, buf.String(),
+		`narwhal_api_requests_total{service="narwhal.library.LibraryService",version="v1",method="GetMedia",deprecated="true"} 2`)
+
+	// Past the sunset, enforced policies reject calls
+	p.EnforceSunset(true)
+	err := call("/narwhal.library.v1.LibraryService/GetMedia")
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+	assert.Contains(t, err.Error(), "use narwhal.library.v2.LibraryService")
+	require.NoError(t, call("/narwhal.library.v1.LibraryService/ListMedia"))
+}
+
+func TestAdapt(t *testing.T) {
+	type v1Request struct{ Name string }
+	type v2Request struct{ Title string }
+	type v2Response struct{ Count int }
+	type v1Response struct{ Total int32 }
+
+	handler := apiversion.Adapt(
+		func(req v1Request) (v2Request, error) {
+			if req.Name == "" {
+				return v2Request{}, status.Error(codes.InvalidArgument, "name is required")
+			}
+			return v2Request{Title: req.Name}, nil
+		},
+		func(ctx context.Context, req v2Request) (v2Response, error) {
+			return v2Response{Count: len(req.Title)}, nil
+		},
+		func(resp v2Response) (v1Response, error) {
+			return v1Response{Total: int32(resp.Count)}, nil
+		},
+	)
+
+	resp, err := handler(context.Background(), v1Request{Name: "narwhal"})
+	require.NoError(t, err)
+	assert.Equal(t, v1Response{Total: 7}, resp)
+
+	_, err = handler(context.Background(), v1Request{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,22 @@
+package apiversion
+
+import (
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// Deprecations are the deprecated services and methods of every service,
+// by full service or method name. A version is deprecated when its
+// successor ships, with a sunset at least two minor releases later, and
+// removed once its calls in narwhal_api_requests_total drop to none.
+//
+// No API version has been deprecated yet.
+var Deprecations = map[string]Deprecation{}
+
+// DefaultPolicy creates a policy with the Deprecations.
+func DefaultPolicy(logger interfaces.Logger) *Policy {
+	p := NewPolicy(logger)
+	for target, d := range Deprecations {
+		p.Deprecate(target, d)
+	}
+	return p
+}
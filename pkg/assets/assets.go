@@ -0,0 +1,170 @@
+// Package assets stores binary assets such as artwork, theme music and
+// subtitles by content. Identical content is stored once and shared by
+// every owner that references it; objects no owner references are garbage
+// collected.
+package assets
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// Owner types.
+const (
+	OwnerUser  = "user"
+	OwnerMedia = "media"
+)
+
+// Roles an asset plays for its owner. Roles are free-form, so owners with
+// several assets of a kind use one role each, such as "subtitle:en".
+const (
+	RoleAvatar = "avatar"
+	RoleTheme  = "theme"
+)
+
+// gcBatchSize is the number of orphans collected per transaction.
+const gcBatchSize = 100
+
+// Ref identifies what an asset is used for: the owner and its role.
+type Ref struct {
+	OwnerType string
+	OwnerID   uuid.UUID
+	Role      string
+}
+
+// Asset is a stored object, identified by the hash of its content.
+type Asset struct {
+	Key  string
+	Hash string
+	Size int64
+	URL  string
+}
+
+// Repository persists assets and the references to them.
+type Repository interface {
+	// Acquire records that ref uses the asset, creating the asset if it is
+	// new. It reports whether the asset's object has been stored.
+	Acquire(ctx context.Context, ref Ref, asset *Asset) (bool, error)
+	// MarkStored records that the asset's object has been stored.
+	MarkStored(ctx context.Context, key string) error
+	// Release drops the owner's references to assets other than keep. An
+	// empty role releases every role of the owner; an empty keep releases
+	// every asset.
+	Release(ctx context.Context, ref Ref, keep string) error
+	// CollectOrphans deletes up to limit assets that have not been
+	// referenced since before cutoff, calling remove for each first. It
+	// returns the number of assets deleted.
+	CollectOrphans(ctx context.Context, cutoff time.Time, limit int, remove func(key string) error) (int, error)
+}
+
+// Store is a content-addressed, reference counted asset store.
+type Store struct {
+	repo    Repository
+	objects interfaces.ObjectStore
+	logger  interfaces.Logger
+}
+
+// NewStore creates an asset store keeping objects in objects.
+func NewStore(repo Repository, objects interfaces.ObjectStore, logger interfaces.Logger) *Store {
+	return &Store{
+		repo:    repo,
+		objects: objects,
+		logger:  logger,
+	}
+}
+
+// Put stores data for ref and adds a reference to it. Content that is
+// already stored is not written again. ext is the file extension of the
+// object, such as ".png".
+//
+// Put does not drop the references ref held before: once the new asset is
+// in use, callers release the old ones with Release(ctx, ref, asset.Key).
+func (s *Store) Put(ctx context.Context, ref Ref, data []byte, ext string) (*Asset, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	asset := &Asset{
+		Key:  fmt.Sprintf("%s/%s%s", hash[:2], hash, ext),
+		Hash: hash,
+		Size: int64(len(data)),
+	}
+	asset.URL = s.objects.URL(asset.Key)
+
+	stored, err := s.repo.Acquire(ctx, ref, asset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire asset: %w", err)
+	}
+	if stored {
+		return asset, nil
+	}
+
+	if err := s.objects.Put(ctx, asset.Key, data); err != nil {
+		return nil, fmt.Errorf("failed to store asset: %w", err)
+	}
+	if err := s.repo.MarkStored(ctx, asset.Key); err != nil {
+		return nil, fmt.Errorf("failed to store asset: %w", err)
+	}
+	return asset, nil
+}
+
+// Release drops the references of ref to assets other than keep. An empty
+// role releases every role of the owner; an empty keep releases every asset.
+func (s *Store) Release(ctx context.Context, ref Ref, keep string) error {
+	if err := s.repo.Release(ctx, ref, keep); err != nil {
+		return fmt.Errorf("failed to release assets: %w", err)
+	}
+	return nil
+}
+
+// URL returns the public URL of the asset stored under key.
+func (s *Store) URL(key string) string {
+	return s.objects.URL(key)
+}
+
+// CollectGarbage deletes the objects of assets that have been unreferenced
+// for longer than grace. It returns the number of assets deleted.
+func (s *Store) CollectGarbage(ctx context.Context, grace time.Duration) (int, error) {
+	cutoff := time.Now().Add(-grace)
+	remove := func(key string) error {
+		return s.objects.Delete(ctx, key)
+	}
+
+	total := 0
+	for {
+		n, err := s.repo.CollectOrphans(ctx, cutoff, gcBatchSize, remove)
+		total += n
+		if err != nil {
+			return total, fmt.Errorf("failed to collect orphaned assets: %w", err)
+		}
+		if n < gcBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// RunGarbageCollector collects garbage every interval until ctx is done.
+func (s *Store) RunGarbageCollector(ctx context.Context, interval, grace time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.CollectGarbage(ctx, grace)
+			if err != nil {
+				s.logger.Error("Asset garbage collection failed", interfaces.Error(err))
+			}
+			if n > 0 {
+				s.logger.Info("Collected orphaned assets", interfaces.Int("count", n))
+			}
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package assets_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/narwhalmedia/narwhal/pkg/assets"
+	"github.com/narwhalmedia/narwhal/pkg/logger"
+)
+
+// memoryRepository keeps assets and references in memory.
+type memoryRepository struct {
+	mu      sync.Mutex
+	stored  map[string]bool
+	touched map[string]time.Time
+	refs    map[assets.Ref]map[string]bool
+}
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{
+		stored:  make(map[string]bool),
+		touched: make(map[string]time.Time),
+		refs:    make(map[assets.Ref]map[string]bool),
+	}
+}
+
+func (r *memoryRepository) Acquire(_ context.Context, ref assets.Ref, asset *assets.Asset) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.stored[asset.Key]; !ok {
+		r.stored[asset.Key] = false
+	}
+	r.touched[asset.Key] = time.Now()
+	if r.refs[ref] == nil {
+		r.refs[ref] = make(map[string]bool)
+	}
+	r.refs[ref][asset.Key] = true
+	return r.stored[asset.Key], nil
+}
+
+func (r *memoryRepository) MarkStored(_ context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stored[key] = true
+	return nil
+}
+
+func (r *memoryRepository) Release(_ context.Context, ref assets.Ref, keep string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for held, keys := range r.refs {
+		if held.OwnerType != ref.OwnerType || held.OwnerID != ref.OwnerID {
+			continue
+		}
+		if ref.Role != "" && held.Role != ref.Role {
+			continue
+		}
+		for key := range keys {
+			if key != keep {
+				delete(keys, key)
+				r.touched[key] = time.Now()
+			}
+		}
+	}
+	return nil
+}
+
+func (r *memoryRepository) CollectOrphans(
+	_ context.Context,
+	cutoff time.Time,
+	limit int,
+	remove func(key string) error,
+) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deleted := 0
+	for key := range r.stored {
+		if deleted == limit || r.referenced(key) || !r.touched[key].Before(cutoff) {
+			continue
+		}
+		if err := remove(key); err != nil {
+			return deleted, err
+		}
+		delete(r.stored, key)
+		delete(r.touched, key)
+		deleted++
+	}
+	return deleted, nil
+}
+
+func (r *memoryRepository) referenced(key string) bool {
+	for _, keys := range r.refs {
+		if keys[key] {
+			return true
+		}
+	}
+	return false
+}
+
+// memoryObjects is an object store that counts writes.
+type memoryObjects struct {
+	objects map[string][]byte
+	puts    int
+}
+
+func (o *memoryObjects) Put(_ context.Context, key string, data []byte) error {
+	o.objects[key] = data
+	o.puts++
+	return nil
+}
+
+func (o *memoryObjects) Delete(_ context.Context, key string) error {
+	delete(o.objects, key)
+	return nil
+}
+
+func (o *memoryObjects) URL(key string) string {
+	return "http://assets.test/" + key
+}
+
+type StoreTestSuite struct {
+	suite.Suite
+
+	ctx     context.Context
+	objects *memoryObjects
+	store   *assets.Store
+}
+
+func (suite *StoreTestSuite) SetupTest() {
+	suite.ctx = context.Background()
+	suite.objects = &memoryObjects{objects: make(map[string][]byte)}
+	suite.store = assets.NewStore(newMemoryRepository(), suite.objects, logger.NewNoopLogger())
+}
+
+func (suite *StoreTestSuite) TestPut_DeduplicatesContent() {
+	first := assets.Ref{OwnerType: assets.OwnerMedia, OwnerID: uuid.New(), Role: assets.RoleTheme}
+	second := assets.Ref{OwnerType: assets.OwnerMedia, OwnerID: uuid.New(), Role: assets.RoleTheme}
+
+	a, err := suite.store.Put(suite.ctx, first, []byte("theme"), ".mp3")
+	suite.Require().NoError(err)
+	b, err := suite.store.Put(suite.ctx, second, []byte("theme"), ".mp3")
+	suite.Require().NoError(err)
+
+	suite.Equal(a.Key, b.Key)
+	suite.Equal("http://assets.test/"+a.Key, a.URL)
+	suite.Equal(1, suite.objects.puts)
+	suite.Len(a.Key, len("xx/")+64+len(".mp3"))
+}
+
+func (suite *StoreTestSuite) TestCollectGarbage_KeepsReferencedAssets() {
+	owner := assets.Ref{OwnerType: assets.OwnerUser, OwnerID: uuid.New(), Role: assets.RoleAvatar}
+	other := assets.Ref{OwnerType: assets.OwnerUser, OwnerID: uuid.New(), Role: assets.RoleAvatar}
+
+	old, err := suite.store.Put(suite.ctx, owner, []byte("old"), ".png")
+	suite.Require().NoError(err)
+	shared, err := suite.store.Put(suite.ctx, other, []byte("new"), ".png")
+	suite.Require().NoError(err)
+	current, err := suite.store.Put(suite.ctx, owner, []byte("new"), ".png")
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.store.Release(suite.ctx, owner, current.Key))
+
+	// Released assets survive the grace period
+	n, err := suite.store.CollectGarbage(suite.ctx, time.Hour)
+	suite.Require().NoError(err)
+	suite.Zero(n)
+
+	n, err = suite.store.CollectGarbage(suite.ctx, -time.Second)
+	suite.Require().NoError(err)
+	suite.Equal(1, n)
+	suite.NotContains(suite.objects.objects, old.Key)
+	suite.Contains(suite.objects.objects, shared.Key)
+
+	// The shared asset is collected once its last owner releases it
+	suite.Require().NoError(suite.store.Release(suite.ctx, owner, ""))
+	suite.Require().NoError(suite.store.Release(suite.ctx, assets.Ref{OwnerType: assets.OwnerUser, OwnerID: other.OwnerID}, ""))
+	n, err = suite.store.CollectGarbage(suite.ctx, -time.Second)
+	suite.Require().NoError(err)
+	suite.Equal(1, n)
+	suite.Empty(suite.objects.objects)
+}
+
+func (suite *StoreTestSuite) TestPut_RewritesCollectedContent() {
+	owner := assets.Ref{OwnerType: assets.OwnerMedia, OwnerID: uuid.New(), Role: assets.RoleTheme}
+
+	asset, err := suite.store.Put(suite.ctx, owner, []byte("theme"), ".mp3")
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.store.Release(suite.ctx, owner, ""))
+	_, err = suite.store.CollectGarbage(suite.ctx, -time.Second)
+	suite.Require().NoError(err)
+
+	_, err = suite.store.Put(suite.ctx, owner, []byte("theme"), ".mp3")
+	suite.Require().NoError(err)
+	suite.Contains(suite.objects.objects, asset.Key)
+	suite.Equal(2, suite.objects.puts)
+}
+
+func TestStoreTestSuite(t *testing.T) {
+	suite.Run(t, new(StoreTestSuite))
+}
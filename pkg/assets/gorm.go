@@ -0,0 +1,171 @@
+package assets
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AssetModel is a stored asset. UpdatedAt is bumped whenever the asset is
+// referenced or released, and orphans are collected relative to it.
+type AssetModel struct {
+	Key       string `gorm:"primaryKey;type:varchar(255)"`
+	Hash      string `gorm:"type:char(64);not null;index"`
+	Size      int64  `gorm:"not null"`
+	Stored    bool   `gorm:"not null;default:false"`
+	CreatedAt time.Time
+	UpdatedAt time.Time `gorm:"index"`
+}
+
+// TableName specifies the table name for AssetModel.
+func (AssetModel) TableName() string {
+	return "assets"
+}
+
+// AssetRefModel is a reference from an owner to an asset.
+type AssetRefModel struct {
+	OwnerType string    `gorm:"primaryKey;type:varchar(50)"`
+	OwnerID   uuid.UUID `gorm:"primaryKey;type:uuid"`
+	Role      string    `gorm:"primaryKey;type:varchar(100)"`
+	AssetKey  string    `gorm:"primaryKey;type:varchar(255);index"`
+	CreatedAt time.Time
+
+	Asset AssetModel `gorm:"foreignKey:AssetKey;references:Key;constraint:OnDelete:RESTRICT"`
+}
+
+// TableName specifies the table name for AssetRefModel.
+func (AssetRefModel) TableName() string {
+	return "asset_refs"
+}
+
+// GormRepository implements Repository using GORM.
+type GormRepository struct {
+	db *gorm.DB
+}
+
+// NewGormRepository creates a new GORM asset repository.
+func NewGormRepository(db *gorm.DB) *GormRepository {
+	return &GormRepository{db: db}
+}
+
+// Acquire records that ref uses the asset. Inserting or touching the asset
+// row locks it until the transaction commits, so it cannot be collected
+// while the reference is added.
+func (r *GormRepository) Acquire(ctx context.Context, ref Ref, asset *Asset) (bool, error) {
+	var stored bool
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		model := &AssetModel{Key: asset.Key, Hash: asset.Hash, Size: asset.Size}
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "key"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"updated_at": gorm.Expr("NOW()")}),
+		}).Create(model).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&AssetRefModel{
+			OwnerType: ref.OwnerType,
+			OwnerID:   ref.OwnerID,
+			Role:      ref.Role,
+			AssetKey:  asset.Key,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&AssetModel{}).Select("stored").Where("key = ?", asset.Key).Scan(&stored).Error
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire asset: %w", err)
+	}
+	return stored, nil
+}
+
+// MarkStored records that the asset's object has been stored.
+func (r *GormRepository) MarkStored(ctx context.Context, key string) error {
+	err := r.db.WithContext(ctx).Model(&AssetModel{}).Where("key = ?", key).Update("stored", true).Error
+	if err != nil {
+		return fmt.Errorf("failed to mark asset stored: %w", err)
+	}
+	return nil
+}
+
+// Release drops the owner's references to assets other than keep. The
+// released assets are touched, so the grace period of the collector counts
+// from their release.
+func (r *GormRepository) Release(ctx context.Context, ref Ref, keep string) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		q := tx.Where("owner_type = ? AND owner_id = ?", ref.OwnerType, ref.OwnerID)
+		if ref.Role != "" {
+			q = q.Where("role = ?", ref.Role)
+		}
+		if keep != "" {
+			q = q.Where("asset_key <> ?", keep)
+		}
+
+		var released []AssetRefModel
+		if err := q.Clauses(clause.Returning{Columns: []clause.Column{{Name: "asset_key"}}}).
+			Delete(&released).Error; err != nil {
+			return err
+		}
+		if len(released) == 0 {
+			return nil
+		}
+
+		keys := make([]string, len(released))
+		for i, ref := range released {
+			keys[i] = ref.AssetKey
+		}
+		return tx.Model(&AssetModel{}).Where("key IN ?", keys).Update("updated_at", gorm.Expr("NOW()")).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to release assets: %w", err)
+	}
+	return nil
+}
+
+// CollectOrphans deletes unreferenced assets. Candidates are locked and
+// rows locked by a concurrent Acquire are skipped, so an asset is never
+// deleted while a reference to it is being added.
+func (r *GormRepository) CollectOrphans(
+	ctx context.Context,
+	cutoff time.Time,
+	limit int,
+	remove func(key string) error,
+) (int, error) {
+	deleted := 0
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var orphans []AssetModel
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("updated_at < ?", cutoff).
+			Where("NOT EXISTS (SELECT 1 FROM asset_refs WHERE asset_refs.asset_key = assets.key)").
+			Limit(limit).
+			Find(&orphans).Error
+		if err != nil {
+			return err
+		}
+
+		for _, orphan := range orphans {
+			if err := remove(orphan.Key); err != nil {
+				return err
+			}
+			if err := tx.Delete(&AssetModel{}, "key = ?", orphan.Key).Error; err != nil {
+				return err
+			}
+			deleted++
+		}
+		return nil
+	})
+	if err != nil {
+		// Objects removed before the failure are removed again next time
+		return 0, fmt.Errorf("failed to collect orphaned assets: %w", err)
+	}
+	return deleted, nil
+}
+
+// Ensure GormRepository implements Repository.
+var _ Repository = (*GormRepository)(nil)
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	pkgerrors "github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/tenant"
+)
+
+// AccountStore looks up the users requests act as. Services other than the
+// user service authenticate with it, since they share the user tables but
+// not the user service.
+type AccountStore interface {
+	GetUser(ctx context.Context, id uuid.UUID) (*domain.User, error)
+	GetTenant(ctx context.Context, id uuid.UUID) (*domain.Tenant, error)
+}
+
+// APIKeyStore looks up API keys and the users they act as.
+type APIKeyStore interface {
+	AccountStore
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*domain.APIKey, error)
+	TouchAPIKey(ctx context.Context, id uuid.UUID, at time.Time) error
+	ListPendingConsentDocuments(ctx context.Context, userID uuid.UUID) ([]*domain.ConsentDocument, error)
+}
+
+// CheckCanLogin checks that the account and its tenant are enabled.
+func CheckCanLogin(ctx context.Context, accounts AccountStore, user *domain.User) error {
+	if user.PendingApproval {
+		return pkgerrors.Forbidden("account is awaiting approval")
+	}
+	if !user.IsActive {
+		return pkgerrors.Forbidden("account is disabled")
+	}
+
+	// Check if the user's tenant is active
+	if user.TenantID != tenant.DefaultID {
+		t, err := accounts.GetTenant(ctx, user.TenantID)
+		if err != nil || !t.IsActive {
+			return pkgerrors.Forbidden("tenant is disabled")
+		}
+	}
+	return nil
+}
+
+// GormAccountStore implements APIKeyStore over the user tables using GORM.
+// It only covers what authenticating requests needs.
+type GormAccountStore struct {
+	db *gorm.DB
+}
+
+// NewGormAccountStore creates a new GORM account store.
+func NewGormAccountStore(db *gorm.DB) *GormAccountStore {
+	return &GormAccountStore{db: db}
+}
+
+// GetUser returns a user with their roles.
+func (s *GormAccountStore) GetUser(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	var user domain.User
+	if err := s.db.WithContext(ctx).Preload("Roles").First(&user, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("user not found")
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return &user, nil
+}
+
+// GetTenant returns a tenant.
+func (s *GormAccountStore) GetTenant(ctx context.Context, id uuid.UUID) (*domain.Tenant, error) {
+	var t domain.Tenant
+	if err := s.db.WithContext(ctx).First(&t, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("tenant not found")
+		}
+		return nil, fmt.Errorf("failed to get tenant: %w", err)
+	}
+	return &t, nil
+}
+
+// GetAPIKeyByHash returns the API key with a key hash.
+func (s *GormAccountStore) GetAPIKeyByHash(ctx context.Context, keyHash string) (*domain.APIKey, error) {
+	var key domain.APIKey
+	if err := s.db.WithContext(ctx).First(&key, "key_hash = ?", keyHash).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerrors.NotFound("API key not found")
+		}
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	return &key, nil
+}
+
+// TouchAPIKey records when an API key was last used.
+func (s *GormAccountStore) TouchAPIKey(ctx context.Context, id uuid.UUID, at time.Time) error {
+	if err := s.db.WithContext(ctx).Model(&domain.APIKey{}).
+		Where("id = ?", id).
+		Update("last_used_at", at).Error; err != nil {
+		return fmt.Errorf("failed to touch API key: %w", err)
+	}
+	return nil
+}
+
+// ListPendingConsentDocuments lists the current consent documents a user
+// has not accepted.
+func (s *GormAccountStore) ListPendingConsentDocuments(
+	ctx context.Context,
+	userID uuid.UUID,
+) ([]*domain.ConsentDocument, error) {
+	var documents []*domain.ConsentDocument
+	if err := s.db.WithContext(ctx).Raw(`
+		SELECT d.* FROM (
+			SELECT DISTINCT ON (kind) * FROM consent_documents
+			ORDER BY kind, published_at DESC
+		) d
+		WHERE NOT EXISTS (
+			SELECT 1 FROM consents c WHERE c.document_id = d.id AND c.user_id = ?
+		)
+		ORDER BY d.kind
+	`, userID).Scan(&documents).Error; err != nil {
+		return nil, fmt.Errorf("failed to list pending consent documents: %w", err)
+	}
+	return documents, nil
+}
@@ -0,0 +1,58 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/tenant"
+)
+
+// accounts knows a set of tenants.
+type accounts map[uuid.UUID]*domain.Tenant
+
+func (a accounts) GetUser(context.Context, uuid.UUID) (*domain.User, error) {
+	return nil, errors.NotFound("user not found")
+}
+
+func (a accounts) GetTenant(_ context.Context, id uuid.UUID) (*domain.Tenant, error) {
+	t, ok := a[id]
+	if !ok {
+		return nil, errors.NotFound("tenant not found")
+	}
+	return t, nil
+}
+
+func TestCheckCanLogin(t *testing.T) {
+	active := &domain.Tenant{ID: uuid.New(), IsActive: true}
+	disabled := &domain.Tenant{ID: uuid.New()}
+	store := accounts{active.ID: active, disabled.ID: disabled}
+
+	tests := []struct {
+		name    string
+		user    *domain.User
+		allowed bool
+	}{
+		{"active user of the default tenant", &domain.User{IsActive: true, TenantID: tenant.DefaultID}, true},
+		{"active user of an active tenant", &domain.User{IsActive: true, TenantID: active.ID}, true},
+		{"awaiting approval", &domain.User{IsActive: true, PendingApproval: true}, false},
+		{"disabled user", &domain.User{}, false},
+		{"disabled tenant", &domain.User{IsActive: true, TenantID: disabled.ID}, false},
+		{"unknown tenant", &domain.User{IsActive: true, TenantID: uuid.New()}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := auth.CheckCanLogin(context.Background(), store, tt.user)
+			if tt.allowed {
+				assert.NoError(t, err)
+			} else {
+				assert.True(t, errors.IsForbidden(err), "got %v", err)
+			}
+		})
+	}
+}
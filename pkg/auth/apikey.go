@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// APIKeyHeader is the metadata header scripts and integrations send their
+// API key in, instead of an authorization header.
+const APIKeyHeader = "x-api-key"
+
+// APIKeyValidator validates API keys and returns the claims of the user a
+// key acts as. Unknown, revoked and expired keys fail with an unauthorized
+// error; keys of disabled users with a forbidden error.
+type APIKeyValidator interface {
+	ValidateAPIKey(ctx context.Context, key string) (*CustomClaims, error)
+}
+
+// APIKeys validates API keys against the stored keys and the users they act
+// as. The user of a key must still be allowed to log in. When a key was
+// last used is recorded to APIKeyUsageResolution.
+type APIKeys struct {
+	store  APIKeyStore
+	logger interfaces.Logger
+}
+
+// NewAPIKeys creates an API key validator over store.
+func NewAPIKeys(store APIKeyStore, logger interfaces.Logger) *APIKeys {
+	return &APIKeys{store: store, logger: logger}
+}
+
+// ValidateAPIKey returns the claims of a request made with an API key.
+func (k *APIKeys) ValidateAPIKey(ctx context.Context, plaintext string) (*CustomClaims, error) {
+	if !strings.HasPrefix(plaintext, domain.APIKeyPrefix) {
+		return nil, errors.Unauthorized("malformed API key")
+	}
+	key, err := k.store.GetAPIKeyByHash(ctx, domain.HashToken(plaintext))
+	if errors.IsNotFound(err) {
+		return nil, errors.Unauthorized("unknown API key")
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if !key.IsActive(now) {
+		return nil, errors.Unauthorized("API key is revoked or expired")
+	}
+
+	user, err := k.store.GetUser(ctx, key.UserID)
+	if errors.IsNotFound(err) {
+		return nil, errors.Unauthorized("unknown API key")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckCanLogin(ctx, k.store, user); err != nil {
+		return nil, err
+	}
+	pending, err := k.store.ListPendingConsentDocuments(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check consents: %w", err)
+	}
+	user.ConsentRequired = len(pending) > 0
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= APIKeyUsageResolution {
+		if err := k.store.TouchAPIKey(ctx, key.ID, now); err != nil {
+			k.logger.Warn("Failed to record API key use",
+				interfaces.String("api_key_id", key.ID.String()),
+				interfaces.Error(err))
+		}
+	}
+
+	return APIKeyClaims(user, key.ID), nil
+}
+
+// WithAPIKeyValidator accepts API keys as an alternative to access tokens.
+// Without a validator, requests with an API key are rejected.
+func (a *AuthInterceptor) WithAPIKeyValidator(validator APIKeyValidator) *AuthInterceptor {
+	a.apiKeys = validator
+	return a
+}
+
+// IsAPIKey reports whether the claims are those of a request made with an
+// API key.
+func (c *CustomClaims) IsAPIKey() bool {
+	return c.TokenType == domain.TokenTypeAPIKey
+}
+
+// APIKeyClaims returns the claims of a request made with an API key of
+// user. They carry the roles the user has now, so role changes apply to
+// their keys right away.
+func APIKeyClaims(user *domain.User, keyID uuid.UUID) *CustomClaims {
+	roles := make([]string, len(user.Roles))
+	for i, role := range user.Roles {
+		roles[i] = role.Name
+	}
+	return &CustomClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: user.ID.String(),
+			ID:      keyID.String(),
+		},
+		UserID:          user.ID.String(),
+		Username:        user.Username,
+		Email:           user.Email,
+		TenantID:        user.TenantID.String(),
+		Roles:           roles,
+		TokenType:       domain.TokenTypeAPIKey,
+		Language:        user.Preferences.Language,
+		ConsentRequired: user.ConsentRequired,
+	}
+}
+
+// APIKeyFromContext returns the API key an incoming request was made with,
+// if any.
+func APIKeyFromContext(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	values := md.Get(APIKeyHeader)
+	if len(values) == 0 || values[0] == "" {
+		return "", false
+	}
+	return values[0], true
+}
+
+// AuthenticateAPIKey validates an API key with validator, which may be nil
+// for services that do not accept API keys, and returns its claims.
+func AuthenticateAPIKey(ctx context.Context, validator APIKeyValidator, key string) (*CustomClaims, error) {
+	if validator == nil {
+		return nil, status.Error(codes.Unauthenticated, "API keys are not accepted")
+	}
+	claims, err := validator.ValidateAPIKey(ctx, key)
+	switch {
+	case err == nil:
+		return claims, nil
+	case errors.IsUnauthorized(err):
+		return nil, status.Errorf(codes.Unauthenticated, "invalid API key: %v", err)
+	case errors.IsForbidden(err):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	return nil, status.Error(codes.Internal, "failed to validate API key")
+}
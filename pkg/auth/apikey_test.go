@@ -0,0 +1,77 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+)
+
+// apiKeys accepts the keys of the users it knows.
+type apiKeys map[string]*domain.User
+
+func (k apiKeys) ValidateAPIKey(_ context.Context, key string) (*auth.CustomClaims, error) {
+	user, ok := k[key]
+	if !ok {
+		return nil, errors.Unauthorized("unknown API key")
+	}
+	if !user.IsActive {
+		return nil, errors.Forbidden("account is disabled")
+	}
+	return auth.APIKeyClaims(user, uuid.New()), nil
+}
+
+func TestAuthInterceptor_APIKey(t *testing.T) {
+	jwtManager := auth.NewJWTManager("access", "refresh", "test", 15*time.Minute, time.Hour)
+	admin := userWithRole(domain.RoleAdmin)
+	admin.IsActive = true
+	disabled := userWithRole(domain.RoleAdmin)
+	disabled.IsActive = false
+	keys := apiKeys{"nwk_admin": admin, "nwk_disabled": disabled}
+
+	call := func(interceptor *auth.AuthInterceptor, md metadata.MD) (*auth.CustomClaims, error) {
+		var claims *auth.CustomClaims
+		handler := func(ctx context.Context, _ interface{}) (interface{}, error) {
+			claims, _ = auth.GetClaimsFromContext(ctx)
+			return "ok", nil
+		}
+		ctx := metadata.NewIncomingContext(context.Background(), md)
+		_, err := interceptor.UnaryServerInterceptor()(ctx, nil,
+			&grpc.UnaryServerInfo{FullMethod: getLibraryMethod}, handler)
+		return claims, err
+	}
+
+	interceptor := auth.NewAuthInterceptor(jwtManager, auth.NewRBAC()).WithAPIKeyValidator(keys)
+	claims, err := call(interceptor, metadata.Pairs(auth.APIKeyHeader, "nwk_admin"))
+	require.NoError(t, err)
+	assert.True(t, claims.IsAPIKey())
+	assert.Equal(t, admin.ID.String(), claims.UserID)
+	assert.Equal(t, []string{domain.RoleAdmin}, claims.Roles)
+
+	_, err = call(interceptor, metadata.Pairs(auth.APIKeyHeader, "nwk_forged"))
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = call(interceptor, metadata.Pairs(auth.APIKeyHeader, "nwk_disabled"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// Access tokens keep working alongside keys
+	tokens, err := jwtManager.GenerateTokenPair(admin, uuid.New())
+	require.NoError(t, err)
+	claims, err = call(interceptor, metadata.Pairs("authorization", "Bearer "+tokens.AccessToken))
+	require.NoError(t, err)
+	assert.False(t, claims.IsAPIKey())
+
+	// Services without a validator reject keys
+	_, err = call(auth.NewAuthInterceptor(jwtManager, auth.NewRBAC()), metadata.Pairs(auth.APIKeyHeader, "nwk_admin"))
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
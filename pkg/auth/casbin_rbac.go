@@ -3,6 +3,7 @@ package auth
 import (
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"sync"
 
@@ -13,11 +14,38 @@ import (
 	"github.com/narwhalmedia/narwhal/pkg/interfaces"
 )
 
+// Policy effects for models with an eft policy field.
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// DefaultCasbinModel is the Casbin model used when no model file is
+// configured. Roles inherit through g, resources and actions accept the "*"
+// wildcard, and deny policies override allow policies.
+const DefaultCasbinModel = `[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act, eft
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[matchers]
+m = g(r.sub, p.sub) && (p.obj == "*" || r.obj == p.obj) && (p.act == "*" || r.act == p.act)`
+
 // CasbinRBAC provides Casbin-based role-based access control.
 type CasbinRBAC struct {
 	enforcer *casbin.Enforcer
 	logger   interfaces.Logger
 	mu       sync.RWMutex
+	// hasEffect is set when the model's policies carry an eft field, which
+	// is required for deny rules.
+	hasEffect bool
 }
 
 // NewCasbinRBAC creates a new Casbin-based RBAC instance.
@@ -38,8 +66,9 @@ func NewCasbinRBAC(modelPath, policyPath string, logger interfaces.Logger) (*Cas
 	enforcer.EnableAutoSave(true)
 
 	return &CasbinRBAC{
-		enforcer: enforcer,
-		logger:   logger,
+		enforcer:  enforcer,
+		logger:    logger,
+		hasEffect: modelHasEffect(m),
 	}, nil
 }
 
@@ -57,6 +86,12 @@ func NewCasbinRBACFromString(modelText, policyText string, logger interfaces.Log
 		return nil, fmt.Errorf("failed to create enforcer: %w", err)
 	}
 
+	rbac := &CasbinRBAC{
+		enforcer:  enforcer,
+		logger:    logger,
+		hasEffect: modelHasEffect(m),
+	}
+
 	// Load policies from CSV string if provided
 	if policyText != "" {
 		// Create a string adapter
@@ -69,9 +104,6 @@ func NewCasbinRBACFromString(modelText, policyText string, logger interfaces.Log
 
 			// Parse CSV line
 			parts := strings.Split(line, ",")
-			if len(parts) < RequiredPolicyParts {
-				continue
-			}
 
 			// Clean up parts
 			for i := range parts {
@@ -79,9 +111,14 @@ func NewCasbinRBACFromString(modelText, policyText string, logger interfaces.Log
 			}
 
 			// Add policy
-			if parts[0] == "p" {
-				_, _ = enforcer.AddPolicy(parts[1], parts[2], parts[3])
-			} else if parts[0] == "g" && len(parts) >= 3 {
+			switch {
+			case parts[0] == "p" && len(parts) >= RequiredPolicyParts:
+				effect := EffectAllow
+				if len(parts) > RequiredPolicyParts {
+					effect = parts[RequiredPolicyParts]
+				}
+				_, _ = enforcer.AddPolicy(rbac.policy(parts[1], parts[2], parts[3], effect)...)
+			case parts[0] == "g" && len(parts) >= MinimumPolicyParts:
 				_, _ = enforcer.AddGroupingPolicy(parts[1], parts[2])
 			}
 		}
@@ -90,10 +127,31 @@ func NewCasbinRBACFromString(modelText, policyText string, logger interfaces.Log
 	// Enable auto-save
 	enforcer.EnableAutoSave(true)
 
-	return &CasbinRBAC{
-		enforcer: enforcer,
-		logger:   logger,
-	}, nil
+	return rbac, nil
+}
+
+// modelHasEffect reports whether the model's policies carry an eft field.
+func modelHasEffect(m model.Model) bool {
+	assertion, ok := m["p"]["p"]
+	if !ok {
+		return false
+	}
+	for _, token := range assertion.Tokens {
+		if token == "p_eft" {
+			return true
+		}
+	}
+	return false
+}
+
+// policy builds the policy parameters for a rule, adding the effect when the
+// model supports one.
+func (r *CasbinRBAC) policy(role, resource, action, effect string) []interface{} {
+	params := []interface{}{role, resource, action}
+	if r.hasEffect {
+		params = append(params, effect)
+	}
+	return params
 }
 
 // CheckPermission checks if a role has permission to perform an action on a resource.
@@ -124,35 +182,34 @@ func (r *CasbinRBAC) CheckPermissions(roles []string, resource, action string) b
 	return false
 }
 
-// GetRolePermissions returns all permissions for a role.
+// GetRolePermissions returns all permissions for a role, including those
+// inherited from its parents. Deny rules are not included.
 func (r *CasbinRBAC) GetRolePermissions(role string) map[string][]string {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
 	permissions := make(map[string][]string)
 
-	// Get all policies for the role
-	policies, _ := r.enforcer.GetFilteredPolicy(0, role)
+	// Get all policies for the role and the roles it inherits from
+	policies, err := r.enforcer.GetImplicitPermissionsForUser(role)
+	if err != nil {
+		r.logger.Error("Failed to get role permissions",
+			interfaces.Error(err),
+			interfaces.String("role", role))
+		return permissions
+	}
 
 	for _, policy := range policies {
 		if len(policy) >= MinimumPolicyParts {
+			if len(policy) >= RequiredPolicyParts && policy[3] == EffectDeny {
+				continue
+			}
+
 			resource := policy[1]
 			action := policy[2]
 
-			if _, exists := permissions[resource]; !exists {
-				permissions[resource] = []string{}
-			}
-
 			// Check if action already exists
-			found := false
-			for _, a := range permissions[resource] {
-				if a == action {
-					found = true
-					break
-				}
-			}
-
-			if !found {
+			if !slices.Contains(permissions[resource], action) {
 				permissions[resource] = append(permissions[resource], action)
 			}
 		}
@@ -166,7 +223,7 @@ func (r *CasbinRBAC) AddPermission(role, resource, action string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	added, err := r.enforcer.AddPolicy(role, resource, action)
+	added, err := r.enforcer.AddPolicy(r.policy(role, resource, action, EffectAllow)...)
 	if err != nil {
 		r.logger.Error("Failed to add permission",
 			interfaces.Error(err),
@@ -189,7 +246,7 @@ func (r *CasbinRBAC) RemovePermission(role, resource, action string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	removed, err := r.enforcer.RemovePolicy(role, resource, action)
+	removed, err := r.enforcer.RemovePolicy(r.policy(role, resource, action, EffectAllow)...)
 	if err != nil {
 		r.logger.Error("Failed to remove permission",
 			interfaces.Error(err),
@@ -207,6 +264,73 @@ func (r *CasbinRBAC) RemovePermission(role, resource, action string) {
 	}
 }
 
+// AddDeny adds a deny rule to a role. It overrides any permission the role
+// has or inherits. The model must have an eft policy field.
+func (r *CasbinRBAC) AddDeny(role, resource, action string) error {
+	if !r.hasEffect {
+		return errors.New("casbin model does not support deny rules")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.enforcer.AddPolicy(r.policy(role, resource, action, EffectDeny)...); err != nil {
+		return fmt.Errorf("failed to add deny rule: %w", err)
+	}
+
+	r.logger.Info("Deny rule added",
+		interfaces.String("role", role),
+		interfaces.String("resource", resource),
+		interfaces.String("action", action))
+
+	return nil
+}
+
+// RemoveDeny removes a deny rule from a role.
+func (r *CasbinRBAC) RemoveDeny(role, resource, action string) error {
+	if !r.hasEffect {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.enforcer.RemovePolicy(r.policy(role, resource, action, EffectDeny)...); err != nil {
+		return fmt.Errorf("failed to remove deny rule: %w", err)
+	}
+	return nil
+}
+
+// AddRoleInheritance makes role inherit the rules of parent.
+func (r *CasbinRBAC) AddRoleInheritance(role, parent string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ancestors, err := r.enforcer.GetImplicitRolesForUser(parent)
+	if err != nil {
+		return fmt.Errorf("failed to resolve role hierarchy: %w", err)
+	}
+	if parent == role || slices.Contains(ancestors, role) {
+		return fmt.Errorf("role %s cannot inherit from %s: inheritance cycle", role, parent)
+	}
+
+	if _, err := r.enforcer.AddGroupingPolicy(role, parent); err != nil {
+		return fmt.Errorf("failed to add role inheritance: %w", err)
+	}
+	return nil
+}
+
+// RemoveRoleInheritance stops role inheriting the rules of parent.
+func (r *CasbinRBAC) RemoveRoleInheritance(role, parent string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.enforcer.RemoveGroupingPolicy(role, parent); err != nil {
+		return fmt.Errorf("failed to remove role inheritance: %w", err)
+	}
+	return nil
+}
+
 // AssignRole assigns a role to a user.
 func (r *CasbinRBAC) AssignRole(userID, role string) error {
 	r.mu.Lock()
@@ -286,7 +410,7 @@ func (r *CasbinRBAC) AddRole(role string, permissions []Permission) error {
 
 	// Add each permission for the role
 	for _, perm := range permissions {
-		if _, err := r.enforcer.AddPolicy(role, perm.Resource, perm.Action); err != nil {
+		if _, err := r.enforcer.AddPolicy(r.policy(role, perm.Resource, perm.Action, EffectAllow)...); err != nil {
 			return fmt.Errorf("failed to add permission %s:%s to role %s: %w",
 				perm.Resource, perm.Action, role, err)
 		}
@@ -310,12 +434,17 @@ func (r *CasbinRBAC) DeleteRole(role string) error {
 		return fmt.Errorf("failed to remove role policies: %w", err)
 	}
 
-	// Remove all grouping policies (user assignments) for the role
+	// Remove all grouping policies (user assignments and child roles) for the role
 	removedGroups, err := r.enforcer.RemoveFilteredGroupingPolicy(1, role)
 	if err != nil {
 		return fmt.Errorf("failed to remove role assignments: %w", err)
 	}
 
+	// Remove the roles it inherits from
+	if _, err := r.enforcer.RemoveFilteredGroupingPolicy(0, role); err != nil {
+		return fmt.Errorf("failed to remove role inheritance: %w", err)
+	}
+
 	r.logger.Info("Role removed",
 		interfaces.String("role", role),
 		interfaces.Bool("policies_removed", removed),
@@ -422,21 +551,7 @@ func (p *CasbinPolicyEnforcer) CheckOwnership(
 	roles []string,
 	ownership ResourceOwnership,
 ) error {
-	// Check if user is the owner
-	if userID == resourceUserID {
-		return nil
-	}
-
-	// Check if admin access is allowed and user has admin role
-	if ownership.AllowAdmin {
-		for _, role := range roles {
-			if role == domain.RoleAdmin {
-				return nil
-			}
-		}
-	}
-
-	return errors.New("permission denied: not the resource owner")
+	return checkOwnership(userID, resourceUserID, roles, ownership)
 }
 
 // InitializeDefaultPolicies sets up the default policies for the system.
@@ -453,6 +568,7 @@ func InitializeDefaultPolicies(rbac *CasbinRBAC) error {
 			{Resource: domain.ResourceMedia, Action: domain.ActionWrite},
 			{Resource: domain.ResourceMedia, Action: domain.ActionDelete},
 			{Resource: domain.ResourceMedia, Action: domain.ActionAdmin},
+			{Resource: domain.ResourceMedia, Action: domain.ActionShare},
 			{Resource: domain.ResourceUser, Action: domain.ActionRead},
 			{Resource: domain.ResourceUser, Action: domain.ActionWrite},
 			{Resource: domain.ResourceUser, Action: domain.ActionDelete},
@@ -478,16 +594,20 @@ func InitializeDefaultPolicies(rbac *CasbinRBAC) error {
 			{Resource: domain.ResourceSystem, Action: domain.ActionDelete},
 			{Resource: domain.ResourceSystem, Action: domain.ActionAdmin},
 		},
+		domain.RoleModerator: {
+			// Moderators curate content on top of user permissions
+			{Resource: domain.ResourceLibrary, Action: domain.ActionWrite},
+			{Resource: domain.ResourceMedia, Action: domain.ActionDelete},
+		},
 		domain.RoleUser: {
-			// Standard user permissions
-			{Resource: domain.ResourceLibrary, Action: domain.ActionRead},
-			{Resource: domain.ResourceMedia, Action: domain.ActionRead},
+			// Standard user permissions on top of guest permissions
 			{Resource: domain.ResourceMedia, Action: domain.ActionWrite},
+			{Resource: domain.ResourceMedia, Action: domain.ActionShare},
 			{Resource: domain.ResourceUser, Action: domain.ActionRead},
 			{Resource: domain.ResourceUser, Action: domain.ActionWrite},
 			{Resource: domain.ResourceTranscoding, Action: domain.ActionRead},
-			{Resource: domain.ResourceStreaming, Action: domain.ActionRead},
 			{Resource: domain.ResourceAcquisition, Action: domain.ActionRead},
+			{Resource: domain.ResourceAcquisition, Action: ScopedAction(domain.ActionDelete, ConditionOwner)},
 			{Resource: domain.ResourceAnalytics, Action: domain.ActionRead},
 		},
 		domain.RoleGuest: {
@@ -505,5 +625,12 @@ func InitializeDefaultPolicies(rbac *CasbinRBAC) error {
 		}
 	}
 
+	// Each role inherits everything its parent can do
+	for role, parent := range DefaultRoleHierarchy() {
+		if err := rbac.AddRoleInheritance(role, parent); err != nil {
+			return fmt.Errorf("failed to initialize role %s: %w", role, err)
+		}
+	}
+
 	return nil
 }
@@ -146,7 +146,7 @@ func (suite *CasbinRBACTestSuite) TestUserRoleAssignment() {
 }
 
 func (suite *CasbinRBACTestSuite) TestAddRemoveRole() {
-	newRole := "moderator"
+	newRole := "curator"
 	permissions := []auth.Permission{
 		{Resource: domain.ResourceMedia, Action: domain.ActionRead},
 		{Resource: domain.ResourceMedia, Action: domain.ActionWrite},
@@ -253,6 +253,40 @@ func (suite *CasbinRBACTestSuite) TestCheckOwnership() {
 	suite.Require().Error(err)
 }
 
+func (suite *CasbinRBACTestSuite) TestHierarchyAndDeny() {
+	rbac, err := auth.NewCasbinRBACFromString(auth.DefaultCasbinModel, "", logger.NewNoop())
+	suite.Require().NoError(err)
+	suite.Require().NoError(auth.InitializeDefaultPolicies(rbac))
+
+	// Moderator inherits user, which inherits guest
+	suite.True(rbac.CheckPermission(domain.RoleModerator, domain.ResourceMedia, domain.ActionDelete))
+	suite.True(rbac.CheckPermission(domain.RoleModerator, domain.ResourceStreaming, domain.ActionRead))
+	suite.False(rbac.CheckPermission(domain.RoleUser, domain.ResourceMedia, domain.ActionDelete))
+	suite.Contains(rbac.GetRolePermissions(domain.RoleUser)[domain.ResourceLibrary], domain.ActionRead)
+	suite.Error(rbac.AddRoleInheritance(domain.RoleGuest, domain.RoleModerator))
+
+	// Wildcards
+	rbac.AddPermission("operator", auth.Wildcard, domain.ActionRead)
+	suite.True(rbac.CheckPermission("operator", domain.ResourceSystem, domain.ActionRead))
+	suite.False(rbac.CheckPermission("operator", domain.ResourceSystem, domain.ActionWrite))
+
+	// A deny on a parent applies to every role inheriting from it
+	suite.Require().NoError(rbac.AddDeny(domain.RoleUser, domain.ResourceMedia, domain.ActionWrite))
+	suite.False(rbac.CheckPermission(domain.RoleModerator, domain.ResourceMedia, domain.ActionWrite))
+
+	// Policies loaded from text accept an effect column
+	rbac, err = auth.NewCasbinRBACFromString(auth.DefaultCasbinModel, `
+p, editor, media, *, allow
+p, editor, media, delete, deny
+g, senior-editor, editor`, logger.NewNoop())
+	suite.Require().NoError(err)
+	suite.True(rbac.CheckPermission("senior-editor", domain.ResourceMedia, domain.ActionWrite))
+	suite.False(rbac.CheckPermission("senior-editor", domain.ResourceMedia, domain.ActionDelete))
+
+	// Models without an effect field cannot express deny rules
+	suite.Error(suite.rbac.AddDeny(domain.RoleUser, domain.ResourceMedia, domain.ActionWrite))
+}
+
 func TestCasbinRBACTestSuite(t *testing.T) {
 	suite.Run(t, new(CasbinRBACTestSuite))
 }
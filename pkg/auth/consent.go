@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ConsentExemptMethods returns the methods a user who has not accepted the
+// current terms or privacy policy can still call: enough to read and accept
+// the documents, refresh the token afterwards, sign out, or take their data
+// and leave.
+func ConsentExemptMethods() map[string]bool {
+	return map[string]bool{
+		"/narwhal.auth.v1.AuthService/Logout":                true,
+		"/narwhal.auth.v1.AuthService/RefreshToken":          true,
+		"/narwhal.auth.v1.AuthService/ValidateToken":         true,
+		"/narwhal.auth.v1.AuthService/GetCurrentUser":        true,
+		"/narwhal.auth.v1.AuthService/ListPendingConsents":   true,
+		"/narwhal.auth.v1.AuthService/AcceptConsents":        true,
+		"/narwhal.auth.v1.AuthService/RequestDataExport":     true,
+		"/narwhal.auth.v1.AuthService/GetDataExport":         true,
+		"/narwhal.auth.v1.AuthService/DeleteAccount":         true,
+		"/narwhal.auth.v1.AuthService/CancelAccountDeletion": true,
+	}
+}
+
+// RequireConsent rejects calls made with a token issued to a user who had
+// documents to accept, unless the method is exempt. Clients refresh their
+// token after accepting to clear the requirement.
+func RequireConsent(claims *CustomClaims, method string, exempt map[string]bool) error {
+	if claims == nil || !claims.ConsentRequired || claims.IsImpersonated() || exempt[method] {
+		return nil
+	}
+	return status.Error(codes.FailedPrecondition, "consent to the current terms is required")
+}
@@ -8,6 +8,9 @@ const (
 	DefaultAccessTTL    = 15 * time.Minute
 	RefreshTokenKeySize = 32
 
+	// API key constants.
+	APIKeyUsageResolution = time.Minute
+
 	// RBAC constants.
 	MinimumPolicyParts  = 3
 	RequiredPolicyParts = 4
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// ImpersonationBlockedMethods returns the destructive methods that cannot be
+// called with an impersonation token.
+func ImpersonationBlockedMethods() map[string]bool {
+	return map[string]bool{
+		"/narwhal.auth.v1.AuthService/ChangePassword":          true,
+		"/narwhal.auth.v1.AuthService/DeleteUser":              true,
+		"/narwhal.auth.v1.AuthService/Impersonate":             true,
+		"/narwhal.auth.v1.AuthService/RevokeDevice":            true,
+		"/narwhal.auth.v1.AuthService/CreateApiKey":            true,
+		"/narwhal.auth.v1.AuthService/RevokeApiKey":            true,
+		"/narwhal.auth.v1.AuthService/EnableTOTP":              true,
+		"/narwhal.auth.v1.AuthService/VerifyTOTP":              true,
+		"/narwhal.auth.v1.AuthService/DisableTOTP":             true,
+		"/narwhal.auth.v1.AuthService/RegenerateRecoveryCodes": true,
+		"/narwhal.auth.v1.AuthService/DeleteAvatar":            true,
+		"/narwhal.auth.v1.AuthService/DeleteAccount":           true,
+		"/narwhal.auth.v1.AuthService/RequestDataExport":       true,
+		"/narwhal.auth.v1.AuthService/GetDataExport":           true,
+
+		"/narwhal.library.v1.LibraryService/DeleteLibrary":   true,
+		"/narwhal.library.v1.LibraryService/RelocateLibrary": true,
+		"/narwhal.library.v1.LibraryService/DeleteMedia":     true,
+		"/narwhal.library.v1.LibraryService/ApplyPrune":      true,
+		"/narwhal.library.v1.LibraryService/ReplaceFile":     true,
+	}
+}
+
+// AuditImpersonation logs a call made with an impersonation token and
+// rejects it if its method is blocked. Calls with other tokens pass
+// through; logger may be nil to only block.
+func AuditImpersonation(logger interfaces.Logger, claims *CustomClaims, method string, blocked map[string]bool) error {
+	if claims == nil || !claims.IsImpersonated() {
+		return nil
+	}
+
+	isBlocked := blocked[method]
+	if logger != nil {
+		logger.Info("Impersonated request",
+			interfaces.String("impersonation_id", claims.ID),
+			interfaces.String("impersonator_id", claims.Impersonator),
+			interfaces.String("user_id", claims.UserID),
+			interfaces.String("method", method),
+			interfaces.Bool("blocked", isBlocked))
+	}
+
+	if isBlocked {
+		return status.Error(codes.PermissionDenied, "not allowed while impersonating a user")
+	}
+	return nil
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/pkg/tenant"
 )
 
 // JWTManager handles JWT token operations.
@@ -40,9 +41,80 @@ type CustomClaims struct {
 	UserID    string   `json:"user_id"`
 	Username  string   `json:"username"`
 	Email     string   `json:"email"`
+	TenantID  string   `json:"tenant_id,omitempty"`
 	Roles     []string `json:"roles"`
 	TokenType string   `json:"token_type"`
 	SessionID string   `json:"session_id,omitempty"`
+	// Impersonator is the ID of the admin acting as this user, if any.
+	Impersonator string `json:"impersonator,omitempty"`
+	// Language is the user's preferred language when the token was issued.
+	Language string `json:"language,omitempty"`
+	// ConsentRequired is set when the user had current terms or privacy
+	// policy versions to accept when the token was issued.
+	ConsentRequired bool `json:"consent_required,omitempty"`
+	// Share is set on tokens issued to guests of a share link.
+	Share *ShareGrant `json:"share,omitempty"`
+	// Kiosk is set on tokens issued to kiosk and display clients.
+	Kiosk *KioskGrant `json:"kiosk,omitempty"`
+}
+
+// ShareGrant is the access a share link gives a guest: streaming one media
+// item at up to a bitrate.
+type ShareGrant struct {
+	LinkID  string `json:"link_id"`
+	MediaID string `json:"media_id"`
+	// MaxBitrate is the highest bitrate streams may have, in kbps.
+	MaxBitrate int `json:"max_bitrate"`
+}
+
+// KioskGrant is the access a kiosk key gives a display client: reading
+// what is playing and what was added to some libraries.
+type KioskGrant struct {
+	KioskID string `json:"kiosk_id"`
+	// LibraryIDs are the libraries shown; empty shows every library.
+	LibraryIDs []string `json:"library_ids,omitempty"`
+}
+
+// IsImpersonated reports whether the token was issued to an admin acting
+// as another user.
+func (c *CustomClaims) IsImpersonated() bool {
+	return c.Impersonator != ""
+}
+
+// IsShare reports whether the token was issued to the guest of a share
+// link.
+func (c *CustomClaims) IsShare() bool {
+	return c.Share != nil
+}
+
+// IsKiosk reports whether the token was issued to a kiosk or display
+// client.
+func (c *CustomClaims) IsKiosk() bool {
+	return c.Kiosk != nil
+}
+
+// TenantUUID returns the tenant the token was issued for.
+// Tokens without a tenant claim belong to the default tenant.
+func (c *CustomClaims) TenantUUID() uuid.UUID {
+	id, err := uuid.Parse(c.TenantID)
+	if err != nil {
+		return tenant.DefaultID
+	}
+	return id
+}
+
+// IsPlatformAdmin reports whether the token was issued to an admin of the
+// default tenant, the only admins who manage the tenants themselves.
+func (c *CustomClaims) IsPlatformAdmin() bool {
+	if c.TenantUUID() != tenant.DefaultID {
+		return false
+	}
+	for _, role := range c.Roles {
+		if role == domain.RoleAdmin {
+			return true
+		}
+	}
+	return false
 }
 
 // GenerateTokenPair generates both access and refresh tokens.
@@ -90,6 +162,98 @@ func (j *JWTManager) GenerateTokenPair(user *domain.User, sessionID uuid.UUID) (
 	}, nil
 }
 
+// GenerateImpersonationToken generates a short-lived access token that acts
+// as user on behalf of impersonatorID. No refresh token is issued, so the
+// impersonation ends when the token expires.
+func (j *JWTManager) GenerateImpersonationToken(
+	user *domain.User,
+	impersonatorID, impersonationID uuid.UUID,
+	ttl time.Duration,
+) (*domain.AuthTokens, error) {
+	roleNames := make([]string, len(user.Roles))
+	for i, role := range user.Roles {
+		roleNames[i] = role.Name
+	}
+
+	claims := j.newClaims(user, roleNames, "", domain.TokenTypeAccess, ttl)
+	claims.ID = impersonationID.String()
+	claims.Impersonator = impersonatorID.String()
+
+	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(j.accessSecret))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate impersonation token: %w", err)
+	}
+
+	return &domain.AuthTokens{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(ttl.Seconds()),
+		ExpiresAt:   claims.ExpiresAt.Time,
+	}, nil
+}
+
+// GenerateShareToken generates an access token for the guest of a share
+// link. The guest has no account: the token carries the guest role, and
+// RestrictShare limits it to streaming the shared media.
+func (j *JWTManager) GenerateShareToken(
+	tenantID uuid.UUID,
+	grant ShareGrant,
+	ttl time.Duration,
+) (string, time.Time, error) {
+	now := time.Now()
+	claims := &CustomClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    j.issuer,
+			Subject:   "share:" + grant.LinkID,
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        uuid.New().String(),
+		},
+		TenantID:  tenantID.String(),
+		Roles:     []string{domain.RoleGuest},
+		TokenType: domain.TokenTypeAccess,
+		Share:     &grant,
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(j.accessSecret))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate share token: %w", err)
+	}
+	return token, claims.ExpiresAt.Time, nil
+}
+
+// GenerateKioskToken generates an access token for a kiosk or display
+// client. Like share guests, kiosks have no account: the token carries the
+// guest role, and RestrictKiosk limits it to the display methods.
+func (j *JWTManager) GenerateKioskToken(
+	tenantID uuid.UUID,
+	grant KioskGrant,
+	ttl time.Duration,
+) (string, time.Time, error) {
+	now := time.Now()
+	claims := &CustomClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    j.issuer,
+			Subject:   "kiosk:" + grant.KioskID,
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        uuid.New().String(),
+		},
+		TenantID:  tenantID.String(),
+		Roles:     []string{domain.RoleGuest},
+		TokenType: domain.TokenTypeAccess,
+		Kiosk:     &grant,
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(j.accessSecret))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate kiosk token: %w", err)
+	}
+	return token, claims.ExpiresAt.Time, nil
+}
+
 // generateToken creates a JWT token with the specified parameters.
 func (j *JWTManager) generateToken(
 	user *domain.User,
@@ -97,8 +261,20 @@ func (j *JWTManager) generateToken(
 	sessionID, tokenType, secret string,
 	ttl time.Duration,
 ) (string, error) {
+	claims := j.newClaims(user, roles, sessionID, tokenType, ttl)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secret))
+}
+
+// newClaims builds the claims for a token issued to user.
+func (j *JWTManager) newClaims(
+	user *domain.User,
+	roles []string,
+	sessionID, tokenType string,
+	ttl time.Duration,
+) *CustomClaims {
 	now := time.Now()
-	claims := CustomClaims{
+	return &CustomClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    j.issuer,
 			Subject:   user.ID.String(),
@@ -107,16 +283,16 @@ func (j *JWTManager) generateToken(
 			IssuedAt:  jwt.NewNumericDate(now),
 			ID:        uuid.New().String(),
 		},
-		UserID:    user.ID.String(),
-		Username:  user.Username,
-		Email:     user.Email,
-		Roles:     roles,
-		TokenType: tokenType,
-		SessionID: sessionID,
+		UserID:          user.ID.String(),
+		Username:        user.Username,
+		Email:           user.Email,
+		TenantID:        user.TenantID.String(),
+		Roles:           roles,
+		TokenType:       tokenType,
+		SessionID:       sessionID,
+		Language:        user.Preferences.Language,
+		ConsentRequired: user.ConsentRequired,
 	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
 }
 
 // ValidateAccessToken validates an access token and returns the claims.
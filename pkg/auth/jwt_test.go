@@ -43,6 +43,41 @@ func TestJWTManager_GenerateTokenPair(t *testing.T) {
 	assert.True(t, tokens.ExpiresAt.After(time.Now()))
 }
 
+func TestJWTManager_GenerateImpersonationToken(t *testing.T) {
+	// Setup
+	jwtManager := auth.NewJWTManager(
+		"test-access-secret",
+		"test-refresh-secret",
+		"test-issuer",
+		15*time.Minute,
+		7*24*time.Hour,
+	)
+
+	user := testutil.CreateTestUser("testuser", "test@example.com")
+	user.Roles = []domain.Role{
+		*testutil.CreateTestRole(domain.RoleUser, "User role"),
+	}
+	adminID := uuid.New()
+	impersonationID := uuid.New()
+
+	// Test
+	tokens, err := jwtManager.GenerateImpersonationToken(user, adminID, impersonationID, 5*time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, tokens.RefreshToken)
+	assert.Equal(t, int(5*time.Minute.Seconds()), tokens.ExpiresIn)
+
+	claims, err := jwtManager.ValidateAccessToken(tokens.AccessToken)
+
+	// Assert
+	require.NoError(t, err)
+	assert.True(t, claims.IsImpersonated())
+	assert.Equal(t, adminID.String(), claims.Impersonator)
+	assert.Equal(t, user.ID.String(), claims.UserID)
+	assert.Equal(t, impersonationID.String(), claims.ID)
+	assert.Empty(t, claims.SessionID)
+	assert.Equal(t, []string{domain.RoleUser}, claims.Roles)
+}
+
 func TestJWTManager_ValidateAccessToken_Success(t *testing.T) {
 	// Setup
 	jwtManager := auth.NewJWTManager(
@@ -78,6 +113,42 @@ func TestJWTManager_ValidateAccessToken_Success(t *testing.T) {
 	assert.Equal(t, "test-issuer", claims.Issuer)
 }
 
+func TestJWTManager_TenantClaim(t *testing.T) {
+	// Setup
+	jwtManager := auth.NewJWTManager(
+		"test-access-secret",
+		"test-refresh-secret",
+		"test-issuer",
+		15*time.Minute,
+		7*24*time.Hour,
+	)
+
+	user := testutil.CreateTestUser("testuser", "test@example.com")
+	user.TenantID = uuid.New()
+
+	tokens, err := jwtManager.GenerateTokenPair(user, uuid.New())
+	require.NoError(t, err)
+
+	// Test
+	claims, err := jwtManager.ValidateAccessToken(tokens.AccessToken)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, user.TenantID.String(), claims.TenantID)
+	assert.Equal(t, user.TenantID, claims.TenantUUID())
+	assert.Equal(t, uuid.Nil, (&auth.CustomClaims{}).TenantUUID())
+}
+
+func TestCustomClaims_IsPlatformAdmin(t *testing.T) {
+	admin := []string{domain.RoleAdmin}
+
+	assert.True(t, (&auth.CustomClaims{Roles: admin}).IsPlatformAdmin())
+	assert.True(t, (&auth.CustomClaims{TenantID: uuid.Nil.String(), Roles: admin}).IsPlatformAdmin())
+	assert.False(t, (&auth.CustomClaims{TenantID: uuid.New().String(), Roles: admin}).IsPlatformAdmin(),
+		"admins of other tenants manage only their own")
+	assert.False(t, (&auth.CustomClaims{Roles: []string{domain.RoleUser}}).IsPlatformAdmin())
+}
+
 func TestJWTManager_ValidateAccessToken_InvalidToken(t *testing.T) {
 	// Setup
 	jwtManager := auth.NewJWTManager(
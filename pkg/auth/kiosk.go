@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// KioskMethods returns the methods a kiosk or display client can call: the
+// read-only display surface and nothing else.
+func KioskMethods() map[string]bool {
+	return map[string]bool{
+		"/narwhal.library.v1.KioskService/GetDisplay": true,
+	}
+}
+
+// RestrictKiosk rejects calls made with a kiosk token to methods outside
+// allowed. The libraries a kiosk shows are applied by the kiosk service.
+func RestrictKiosk(claims *CustomClaims, method string, allowed map[string]bool) error {
+	if claims == nil || !claims.IsKiosk() {
+		return nil
+	}
+	if !allowed[method] {
+		return status.Error(codes.PermissionDenied, "kiosk tokens only allow reading the display")
+	}
+	return nil
+}
@@ -3,12 +3,18 @@ package auth
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/pkg/i18n"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/tenant"
 )
 
 // ContextKey is a type for context keys.
@@ -28,6 +34,16 @@ type AuthInterceptor struct {
 	jwtManager *JWTManager
 	rbac       RBACInterface
 	enforcer   PolicyEnforcerInterface
+	policies   map[string]MethodPolicy
+	resolver   AttributeResolver
+	public     map[string]bool
+	consent    map[string]bool
+	share      map[string]bool
+	kiosk      map[string]bool
+	apiKeys    APIKeyValidator
+
+	impersonationLog     interfaces.Logger
+	impersonationBlocked map[string]bool
 }
 
 // PolicyEnforcerInterface defines the interface for policy enforcement.
@@ -35,6 +51,7 @@ type PolicyEnforcerInterface interface {
 	Enforce(roles []string, resource, action string) error
 	EnforceAny(roles []string, permissions ...Permission) error
 	EnforceAll(roles []string, permissions ...Permission) error
+	CheckOwnership(userID, resourceUserID string, roles []string, ownership ResourceOwnership) error
 }
 
 // NewAuthInterceptor creates a new auth interceptor.
@@ -56,7 +73,49 @@ func NewAuthInterceptor(jwtManager *JWTManager, rbac RBACInterface) *AuthInterce
 		jwtManager: jwtManager,
 		rbac:       rbac,
 		enforcer:   enforcer,
+		policies:   DefaultMethodPolicies(),
+		public: map[string]bool{
+			"/grpc.health.v1.Health/Check": true,
+			"/grpc.health.v1.Health/Watch": true,
+		},
+		consent: ConsentExemptMethods(),
+		share:   ShareMethods(),
+		kiosk:   KioskMethods(),
+
+		impersonationBlocked: ImpersonationBlockedMethods(),
+	}
+}
+
+// WithPublicMethods adds to the methods callable without a token,
+// typically those of config.GetPublicMethods. The health checks stay
+// public.
+func (a *AuthInterceptor) WithPublicMethods(methods map[string]bool) *AuthInterceptor {
+	for method, public := range methods {
+		if public {
+			a.public[method] = true
+		}
 	}
+	return a
+}
+
+// WithImpersonationAudit logs every call made with an impersonation token
+// to logger. The blocked methods are rejected with or without it.
+func (a *AuthInterceptor) WithImpersonationAudit(logger interfaces.Logger) *AuthInterceptor {
+	a.impersonationLog = logger
+	return a
+}
+
+// WithAttributeResolver sets the resolver used to evaluate ownership and
+// library-membership conditions. Without one, only conditions on fields that
+// hold the owner's user ID can be satisfied.
+func (a *AuthInterceptor) WithAttributeResolver(resolver AttributeResolver) *AuthInterceptor {
+	a.resolver = resolver
+	return a
+}
+
+// SetMethodPolicy overrides the policy required to call a method.
+func (a *AuthInterceptor) SetMethodPolicy(method string, policy MethodPolicy) {
+	a.policies[method] = policy
 }
 
 // GenericPolicyEnforcer provides a generic policy enforcer for any RBAC implementation.
@@ -97,6 +156,16 @@ func (p *GenericPolicyEnforcer) EnforceAll(roles []string, permissions ...Permis
 	return nil
 }
 
+// CheckOwnership verifies if a user owns a resource.
+func (p *GenericPolicyEnforcer) CheckOwnership(
+	userID string,
+	resourceUserID string,
+	roles []string,
+	ownership ResourceOwnership,
+) error {
+	return checkOwnership(userID, resourceUserID, roles, ownership)
+}
+
 // UnaryServerInterceptor returns a gRPC unary interceptor for authentication.
 func (a *AuthInterceptor) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
@@ -111,8 +180,24 @@ func (a *AuthInterceptor) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
 			return nil, err
 		}
 
+		if err := a.requireConsent(newCtx, info.FullMethod); err != nil {
+			return nil, err
+		}
+
+		if err := a.restrictShare(newCtx, info.FullMethod, req); err != nil {
+			return nil, err
+		}
+
+		if err := a.restrictKiosk(newCtx, info.FullMethod); err != nil {
+			return nil, err
+		}
+
+		if err := a.auditImpersonation(newCtx, info.FullMethod); err != nil {
+			return nil, err
+		}
+
 		// Check authorization if required
-		if err := a.authorize(newCtx, info.FullMethod); err != nil {
+		if err := a.authorize(newCtx, info.FullMethod, req); err != nil {
 			return nil, err
 		}
 
@@ -134,8 +219,25 @@ func (a *AuthInterceptor) StreamServerInterceptor() grpc.StreamServerInterceptor
 			return err
 		}
 
-		// Check authorization if required
-		if err := a.authorize(newCtx, info.FullMethod); err != nil {
+		if err := a.requireConsent(newCtx, info.FullMethod); err != nil {
+			return err
+		}
+
+		if err := a.restrictShare(newCtx, info.FullMethod, nil); err != nil {
+			return err
+		}
+
+		if err := a.restrictKiosk(newCtx, info.FullMethod); err != nil {
+			return err
+		}
+
+		if err := a.auditImpersonation(newCtx, info.FullMethod); err != nil {
+			return err
+		}
+
+		// Check authorization if required. Stream requests are not known
+		// up front, so conditional permissions never apply to streams.
+		if err := a.authorize(newCtx, info.FullMethod, nil); err != nil {
 			return err
 		}
 
@@ -149,8 +251,30 @@ func (a *AuthInterceptor) StreamServerInterceptor() grpc.StreamServerInterceptor
 	}
 }
 
-// authenticate extracts and validates the JWT token from the request.
+// authenticate validates the API key or JWT token of the request.
 func (a *AuthInterceptor) authenticate(ctx context.Context) (context.Context, error) {
+	claims, err := a.claims(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add claims to context
+	ctx = context.WithValue(ctx, ContextKeyClaims, claims)
+	ctx = context.WithValue(ctx, ContextKeyUserID, claims.UserID)
+	ctx = context.WithValue(ctx, ContextKeyRoles, claims.Roles)
+	ctx = tenant.WithTenantID(ctx, claims.TenantUUID())
+	i18n.SetLanguage(ctx, claims.Language)
+
+	return ctx, nil
+}
+
+// claims returns the claims of the API key of the request, if it has one,
+// or else of its JWT token.
+func (a *AuthInterceptor) claims(ctx context.Context) (*CustomClaims, error) {
+	if key, ok := APIKeyFromContext(ctx); ok {
+		return AuthenticateAPIKey(ctx, a.apiKeys, key)
+	}
+
 	token, err := a.extractToken(ctx)
 	if err != nil {
 		return nil, status.Errorf(codes.Unauthenticated, "missing token: %v", err)
@@ -160,33 +284,89 @@ func (a *AuthInterceptor) authenticate(ctx context.Context) (context.Context, er
 	if err != nil {
 		return nil, status.Errorf(codes.Unauthenticated, "invalid token: %v", err)
 	}
+	return claims, nil
+}
 
-	// Add claims to context
-	ctx = context.WithValue(ctx, ContextKeyClaims, claims)
-	ctx = context.WithValue(ctx, ContextKeyUserID, claims.UserID)
-	ctx = context.WithValue(ctx, ContextKeyRoles, claims.Roles)
+// requireConsent rejects users who have current terms or privacy policy
+// versions to accept.
+func (a *AuthInterceptor) requireConsent(ctx context.Context, method string) error {
+	claims, _ := GetClaimsFromContext(ctx)
+	return RequireConsent(claims, method, a.consent)
+}
 
-	return ctx, nil
+// restrictShare limits share link guests to streaming the shared media.
+func (a *AuthInterceptor) restrictShare(ctx context.Context, method string, req interface{}) error {
+	claims, _ := GetClaimsFromContext(ctx)
+	return RestrictShare(claims, method, req, a.share)
+}
+
+// restrictKiosk limits kiosk and display clients to the display methods.
+func (a *AuthInterceptor) restrictKiosk(ctx context.Context, method string) error {
+	claims, _ := GetClaimsFromContext(ctx)
+	return RestrictKiosk(claims, method, a.kiosk)
+}
+
+// auditImpersonation logs calls made with impersonation tokens and rejects
+// the blocked methods.
+func (a *AuthInterceptor) auditImpersonation(ctx context.Context, method string) error {
+	claims, _ := GetClaimsFromContext(ctx)
+	return AuditImpersonation(a.impersonationLog, claims, method, a.impersonationBlocked)
 }
 
 // authorize checks if the user has permission to access the method.
-func (a *AuthInterceptor) authorize(ctx context.Context, method string) error {
+func (a *AuthInterceptor) authorize(ctx context.Context, method string, req interface{}) error {
 	// Get required permissions for the method
-	resource, action := a.getMethodPermissions(method)
-	if resource == "" || action == "" {
+	policy, ok := a.policies[method]
+	if !ok || policy.Resource == "" || policy.Action == "" {
 		// No specific permissions required
 		return nil
 	}
 
+	claims, _ := GetClaimsFromContext(ctx)
+	if err := RequireSystemAdmin(claims, policy); err != nil {
+		return err
+	}
+
 	roles, ok := ctx.Value(ContextKeyRoles).([]string)
 	if !ok {
 		return status.Error(codes.Internal, "roles not found in context")
 	}
 
-	if err := a.enforcer.Enforce(roles, resource, action); err != nil {
-		return status.Errorf(codes.PermissionDenied, "%v", err)
+	err := a.enforcer.Enforce(roles, policy.Resource, policy.Action)
+	if err == nil {
+		return nil
 	}
 
+	// Fall back to conditional grants such as "delete:owner"
+	userID, _ := GetUserIDFromContext(ctx)
+	for _, cond := range policy.Conditions {
+		if a.enforcer.Enforce(roles, policy.Resource, ScopedAction(policy.Action, cond.Kind)) != nil {
+			continue
+		}
+
+		ok, condErr := evaluateCondition(ctx, a.resolver, a.enforcer, cond, userID, roles, req)
+		if condErr != nil {
+			return status.Errorf(codes.Internal, "failed to evaluate access condition: %v", condErr)
+		}
+		if ok {
+			return nil
+		}
+	}
+
+	return status.Errorf(codes.PermissionDenied, "%v", err)
+}
+
+// RequireSystemAdmin rejects calls to methods of the system resource by
+// anyone but platform admins. Hooks, worker pools, plugins and
+// diagnostics are shared by every tenant of the install, so the roles of
+// other tenants' admins do not reach them.
+func RequireSystemAdmin(claims *CustomClaims, policy MethodPolicy) error {
+	if policy.Resource != domain.ResourceSystem {
+		return nil
+	}
+	if claims == nil || !claims.IsPlatformAdmin() {
+		return status.Error(codes.PermissionDenied, "platform admin access required")
+	}
 	return nil
 }
 
@@ -211,67 +391,198 @@ func (a *AuthInterceptor) extractToken(ctx context.Context) (string, error) {
 
 // skipAuth returns true if the method should skip authentication.
 func (a *AuthInterceptor) skipAuth(method string) bool {
-	// List of methods that don't require authentication
-	skipMethods := []string{
-		"/narwhal.user.v1.UserService/Login",
-		"/narwhal.user.v1.UserService/Register",
-		"/narwhal.user.v1.UserService/RefreshToken",
-		"/narwhal.user.v1.UserService/ForgotPassword",
-		"/narwhal.user.v1.UserService/ResetPassword",
-		"/grpc.health.v1.Health/Check",
-		"/grpc.health.v1.Health/Watch",
-	}
-
-	for _, m := range skipMethods {
-		if method == m {
-			return true
-		}
-	}
-
-	return false
+	return a.public[method]
 }
 
-// getMethodPermissions returns the required resource and action for a gRPC method.
-func (a *AuthInterceptor) getMethodPermissions(method string) (resource, action string) {
-	// Define permission requirements for each service method
-	permissions := map[string]struct{ Resource, Action string }{
+// DefaultMethodPolicies returns the permission required for each service method.
+func DefaultMethodPolicies() map[string]MethodPolicy {
+	return map[string]MethodPolicy{
 		// Library service
-		"/narwhal.library.v1.LibraryService/CreateLibrary": {"library", "write"},
-		"/narwhal.library.v1.LibraryService/UpdateLibrary": {"library", "write"},
-		"/narwhal.library.v1.LibraryService/DeleteLibrary": {"library", "delete"},
-		"/narwhal.library.v1.LibraryService/ScanLibrary":   {"library", "write"},
-		"/narwhal.library.v1.LibraryService/GetLibrary":    {"library", "read"},
-		"/narwhal.library.v1.LibraryService/ListLibraries": {"library", "read"},
+		"/narwhal.library.v1.LibraryService/CreateLibrary": {Resource: "library", Action: "write"},
+		"/narwhal.library.v1.LibraryService/UpdateLibrary": {Resource: "library", Action: "write"},
+		"/narwhal.library.v1.LibraryService/DeleteLibrary": {Resource: "library", Action: "delete"},
+		"/narwhal.library.v1.LibraryService/ScanLibrary":   {Resource: "library", Action: "write"},
+		"/narwhal.library.v1.LibraryService/PreviewScan":   {Resource: "library", Action: "write"},
+		"/narwhal.library.v1.LibraryService/GetLibrary": {
+			Resource:   "library",
+			Action:     "read",
+			Conditions: []Condition{{Kind: ConditionLibraryMember, Field: "id"}},
+		},
+		"/narwhal.library.v1.LibraryService/ListLibraries":          {Resource: "library", Action: "read"},
+		"/narwhal.library.v1.LibraryService/ExportLibrary":          {Resource: "library", Action: "read"},
+		"/narwhal.library.v1.LibraryService/ImportLibrary":          {Resource: "library", Action: "write"},
+		"/narwhal.library.v1.LibraryService/RelocateLibrary":        {Resource: "library", Action: "admin"},
+		"/narwhal.library.v1.LibraryService/CreateTranscodePolicy":  {Resource: "library", Action: "write"},
+		"/narwhal.library.v1.LibraryService/ListTranscodePolicies":  {Resource: "library", Action: "read"},
+		"/narwhal.library.v1.LibraryService/UpdateTranscodePolicy":  {Resource: "library", Action: "write"},
+		"/narwhal.library.v1.LibraryService/DeleteTranscodePolicy":  {Resource: "library", Action: "write"},
+		"/narwhal.library.v1.LibraryService/ApplyTranscodePolicies": {Resource: "library", Action: "write"},
+		"/narwhal.library.v1.LibraryService/RebuildSearchIndex":     {Resource: "system", Action: "admin"},
+		"/narwhal.library.v1.LibraryService/GetStorageUsage":        {Resource: "analytics", Action: "admin"},
+		"/narwhal.library.v1.LibraryService/ListPruneCandidates":    {Resource: "analytics", Action: "admin"},
+		"/narwhal.library.v1.LibraryService/ApplyPrune":             {Resource: "media", Action: "delete"},
+		"/narwhal.library.v1.LibraryService/ListPlaybackIssueStats": {Resource: "analytics", Action: "admin"},
+		"/narwhal.library.v1.LibraryService/ClearPlaybackIssues":    {Resource: "analytics", Action: "admin"},
+		"/narwhal.library.v1.LibraryService/ListHooks":              {Resource: "system", Action: "admin"},
+		"/narwhal.library.v1.LibraryService/SetHookEnabled":         {Resource: "system", Action: "admin"},
+		"/narwhal.library.v1.LibraryService/ListHookRuns":           {Resource: "system", Action: "admin"},
+		"/narwhal.library.v1.LibraryService/ListPlugins":            {Resource: "system", Action: "admin"},
+		"/narwhal.library.v1.LibraryService/ListWorkerPools":        {Resource: "system", Action: "admin"},
+		"/narwhal.library.v1.LibraryService/ResizeWorkerPool":       {Resource: "system", Action: "admin"},
+		"/narwhal.library.v1.LibraryService/CreateFeed":             {Resource: "library", Action: "write"},
+		"/narwhal.library.v1.LibraryService/ListFeeds":              {Resource: "library", Action: "write"},
+		"/narwhal.library.v1.LibraryService/UpdateFeed":             {Resource: "library", Action: "write"},
+		"/narwhal.library.v1.LibraryService/DeleteFeed":             {Resource: "library", Action: "write"},
+		"/narwhal.library.v1.LibraryService/TestFeed":               {Resource: "library", Action: "write"},
+		"/narwhal.library.v1.LibraryService/GetCalendar":            {Resource: "library", Action: "read"},
+		"/narwhal.library.v1.LibraryService/ListWanted":             {Resource: "library", Action: "read"},
+		"/narwhal.library.v1.LibraryService/SearchReleases":         {Resource: "library", Action: "write"},
+		"/narwhal.library.v1.LibraryService/GrabRelease":            {Resource: "library", Action: "write"},
+		"/narwhal.library.v1.LibraryService/ListBlocklist":          {Resource: "library", Action: "admin"},
+		"/narwhal.library.v1.LibraryService/AddToBlocklist":         {Resource: "library", Action: "admin"},
+		"/narwhal.library.v1.LibraryService/RemoveFromBlocklist":    {Resource: "library", Action: "admin"},
+		"/narwhal.library.v1.LibraryService/ListManualImports":      {Resource: "library", Action: "admin"},
+		"/narwhal.library.v1.LibraryService/ResolveManualImport":    {Resource: "library", Action: "admin"},
+		"/narwhal.library.v1.LibraryService/ReplaceFile":            {Resource: "library", Action: "admin"},
+		"/narwhal.library.v1.LibraryService/ListComponentHealth":    {Resource: "library", Action: "admin"},
 
 		// Media operations
-		"/narwhal.library.v1.LibraryService/GetMedia":    {"media", "read"},
-		"/narwhal.library.v1.LibraryService/ListMedia":   {"media", "read"},
-		"/narwhal.library.v1.LibraryService/SearchMedia": {"media", "read"},
-		"/narwhal.library.v1.LibraryService/UpdateMedia": {"media", "write"},
-		"/narwhal.library.v1.LibraryService/DeleteMedia": {"media", "delete"},
+		"/narwhal.library.v1.LibraryService/GetMedia": {Resource: "media", Action: "read"},
+		"/narwhal.library.v1.LibraryService/ListMedia": {
+			Resource:   "media",
+			Action:     "read",
+			Conditions: []Condition{{Kind: ConditionLibraryMember, Field: "library_id"}},
+		},
+		"/narwhal.library.v1.LibraryService/SearchMedia":         {Resource: "media", Action: "read"},
+		"/narwhal.library.v1.LibraryService/UpdateMedia":         {Resource: "media", Action: "write"},
+		"/narwhal.library.v1.LibraryService/DeleteMedia":         {Resource: "media", Action: "delete"},
+		"/narwhal.library.v1.LibraryService/MoveFile":            {Resource: "media", Action: "write"},
+		"/narwhal.library.v1.LibraryService/PreviewRename":       {Resource: "media", Action: "write"},
+		"/narwhal.library.v1.LibraryService/ApplyRename":         {Resource: "media", Action: "write"},
+		"/narwhal.library.v1.LibraryService/RefreshThemeMusic":   {Resource: "media", Action: "write"},
+		"/narwhal.library.v1.LibraryService/DeleteThemeMusic":    {Resource: "media", Action: "write"},
+		"/narwhal.library.v1.LibraryService/GetWorkflow":         {Resource: "media", Action: "read"},
+		"/narwhal.library.v1.LibraryService/ReportPlaybackIssue": {Resource: "media", Action: "read"},
+		"/narwhal.library.v1.LibraryService/AddToWatchlist":      {Resource: "media", Action: "read"},
+		"/narwhal.library.v1.LibraryService/RemoveFromWatchlist": {Resource: "media", Action: "read"},
+		"/narwhal.library.v1.LibraryService/ListWatchlist":       {Resource: "media", Action: "read"},
+		"/narwhal.library.v1.LibraryService/ListEpisodeFiles":    {Resource: "media", Action: "read"},
+		"/narwhal.library.v1.LibraryService/RecordWatchProgress": {Resource: "media", Action: "read"},
+		"/narwhal.library.v1.LibraryService/GetArtist":           {Resource: "media", Action: "read"},
+		"/narwhal.library.v1.LibraryService/CreateShareLink":     {Resource: "media", Action: "share"},
+		"/narwhal.library.v1.LibraryService/ListShareLinks":      {Resource: "media", Action: "share"},
+		"/narwhal.library.v1.LibraryService/RevokeShareLink":     {Resource: "media", Action: "share"},
+		"/narwhal.library.v1.LibraryService/ListShareLinkPlays":  {Resource: "media", Action: "share"},
+		"/narwhal.library.v1.LibraryService/ListWorkflowHistory": {Resource: "system", Action: "admin"},
+
+		// Users request content; admins decide on requests
+		"/narwhal.library.v1.LibraryService/SearchRequestableContent": {Resource: "media", Action: "read"},
+		"/narwhal.library.v1.LibraryService/CreateContentRequest":     {Resource: "media", Action: "read"},
+		"/narwhal.library.v1.LibraryService/ListContentRequests":      {Resource: "media", Action: "read"},
+		"/narwhal.library.v1.LibraryService/ApproveContentRequest":    {Resource: "library", Action: "write"},
+		"/narwhal.library.v1.LibraryService/DenyContentRequest":       {Resource: "library", Action: "write"},
+		"/narwhal.library.v1.LibraryService/GetRequestQuota":          {Resource: "media", Action: "read"},
+		"/narwhal.library.v1.LibraryService/SetRequestQuotaOverride":  {Resource: "library", Action: "write"},
+
+		// Users report media issues; admins resolve them
+		"/narwhal.library.v1.LibraryService/ReportMediaIssue":  {Resource: "media", Action: "read"},
+		"/narwhal.library.v1.LibraryService/ListMediaIssues":   {Resource: "media", Action: "read"},
+		"/narwhal.library.v1.LibraryService/ResolveMediaIssue": {Resource: "library", Action: "write"},
+
+		// Users revoke the iCalendar feed tokens of their calendar apps
+		"/narwhal.library.v1.LibraryService/RotateCalendarFeedToken": {Resource: "library", Action: "read"},
+
+		// Admins set up kiosks; kiosk tokens only read the display
+		"/narwhal.library.v1.LibraryService/CreateKiosk": {Resource: "library", Action: "write"},
+		"/narwhal.library.v1.LibraryService/ListKiosks":  {Resource: "library", Action: "write"},
+		"/narwhal.library.v1.LibraryService/RevokeKiosk": {Resource: "library", Action: "write"},
+
+		// Admins see which titles are watched
+		"/narwhal.library.v1.LibraryService/ListTitleAnalytics": {Resource: "analytics", Action: "admin"},
+		"/narwhal.library.v1.LibraryService/GetTitleAnalytics":  {Resource: "analytics", Action: "admin"},
+
+		// Acquisition service
+		"/narwhal.acquisition.v1.AcquisitionService/SearchContent": {Resource: "acquisition", Action: "read"},
+		"/narwhal.acquisition.v1.AcquisitionService/GetRelease":    {Resource: "acquisition", Action: "read"},
+		"/narwhal.acquisition.v1.AcquisitionService/AddDownload":   {Resource: "acquisition", Action: "write"},
+		"/narwhal.acquisition.v1.AcquisitionService/GetDownload": {
+			Resource:   "acquisition",
+			Action:     "read",
+			Conditions: []Condition{{Kind: ConditionOwner, Field: "id", Resource: ResourceDownload}},
+		},
+		"/narwhal.acquisition.v1.AcquisitionService/ListDownloads": {Resource: "acquisition", Action: "read"},
+		"/narwhal.acquisition.v1.AcquisitionService/CancelDownload": {
+			Resource:   "acquisition",
+			Action:     "delete",
+			Conditions: []Condition{{Kind: ConditionOwner, Field: "id", Resource: ResourceDownload}},
+		},
+		"/narwhal.acquisition.v1.AcquisitionService/RetryDownload": {
+			Resource:   "acquisition",
+			Action:     "write",
+			Conditions: []Condition{{Kind: ConditionOwner, Field: "id", Resource: ResourceDownload}},
+		},
+		"/narwhal.acquisition.v1.AcquisitionService/GetDownloadLogs": {
+			Resource:   "acquisition",
+			Action:     "read",
+			Conditions: []Condition{{Kind: ConditionOwner, Field: "id", Resource: ResourceDownload}},
+		},
+		"/narwhal.acquisition.v1.AcquisitionService/GetDownloadHistory":   {Resource: "acquisition", Action: "read"},
+		"/narwhal.acquisition.v1.AcquisitionService/CreateQualityProfile": {Resource: "acquisition", Action: "admin"},
+		"/narwhal.acquisition.v1.AcquisitionService/GetQualityProfile":    {Resource: "acquisition", Action: "read"},
+		"/narwhal.acquisition.v1.AcquisitionService/ListQualityProfiles":  {Resource: "acquisition", Action: "read"},
+		"/narwhal.acquisition.v1.AcquisitionService/UpdateQualityProfile": {Resource: "acquisition", Action: "admin"},
+		"/narwhal.acquisition.v1.AcquisitionService/DeleteQualityProfile": {Resource: "acquisition", Action: "admin"},
+		"/narwhal.acquisition.v1.AcquisitionService/ListIndexers":         {Resource: "acquisition", Action: "admin"},
+		"/narwhal.acquisition.v1.AcquisitionService/TestIndexer":          {Resource: "acquisition", Action: "admin"},
+
+		// Transcode logs show paths on the server
+		"/narwhal.transcoding.v1.TranscodingService/GetJobLogs": {Resource: "transcoding", Action: "admin"},
+
+		// Streaming service
+		"/narwhal.streaming.v1.StreamingService/CreateStream":        {Resource: "streaming", Action: "read"},
+		"/narwhal.streaming.v1.StreamingService/GetStreamInfo":       {Resource: "streaming", Action: "read"},
+		"/narwhal.streaming.v1.StreamingService/GetManifest":         {Resource: "streaming", Action: "read"},
+		"/narwhal.streaming.v1.StreamingService/GetSegment":          {Resource: "streaming", Action: "read"},
+		"/narwhal.streaming.v1.StreamingService/StopStream":          {Resource: "streaming", Action: "read"},
+		"/narwhal.streaming.v1.StreamingService/StartSession":        {Resource: "streaming", Action: "read"},
+		"/narwhal.streaming.v1.StreamingService/UpdateSession":       {Resource: "streaming", Action: "read"},
+		"/narwhal.streaming.v1.StreamingService/EndSession":          {Resource: "streaming", Action: "read"},
+		"/narwhal.streaming.v1.StreamingService/GetActiveStreams":    {Resource: "streaming", Action: "admin"},
+		"/narwhal.streaming.v1.StreamingService/ReportProgress":      {Resource: "streaming", Action: "read"},
+		"/narwhal.streaming.v1.StreamingService/GetPlaybackPosition": {Resource: "streaming", Action: "read"},
 
 		// User service
-		"/narwhal.user.v1.UserService/GetUser":    {"user", "read"},
-		"/narwhal.user.v1.UserService/ListUsers":  {"user", "read"},
-		"/narwhal.user.v1.UserService/UpdateUser": {"user", "write"},
-		"/narwhal.user.v1.UserService/DeleteUser": {"user", "delete"},
-		"/narwhal.user.v1.UserService/CreateUser": {"user", "admin"},
-		"/narwhal.user.v1.UserService/AssignRole": {"user", "admin"},
-		"/narwhal.user.v1.UserService/RemoveRole": {"user", "admin"},
+		"/narwhal.user.v1.UserService/GetUser":    {Resource: "user", Action: "read"},
+		"/narwhal.user.v1.UserService/ListUsers":  {Resource: "user", Action: "read"},
+		"/narwhal.user.v1.UserService/UpdateUser": {Resource: "user", Action: "write"},
+		"/narwhal.user.v1.UserService/DeleteUser": {Resource: "user", Action: "delete"},
+		"/narwhal.user.v1.UserService/CreateUser": {Resource: "user", Action: "admin"},
+		"/narwhal.user.v1.UserService/AssignRole": {Resource: "user", Action: "admin"},
+		"/narwhal.user.v1.UserService/RemoveRole": {Resource: "user", Action: "admin"},
 
 		// System operations
-		"/narwhal.user.v1.UserService/CreateRole":       {"system", "admin"},
-		"/narwhal.user.v1.UserService/UpdateRole":       {"system", "admin"},
-		"/narwhal.user.v1.UserService/DeleteRole":       {"system", "admin"},
-		"/narwhal.user.v1.UserService/CreatePermission": {"system", "admin"},
-		"/narwhal.user.v1.UserService/DeletePermission": {"system", "admin"},
+		"/narwhal.user.v1.UserService/CreateRole":       {Resource: "system", Action: "admin"},
+		"/narwhal.user.v1.UserService/UpdateRole":       {Resource: "system", Action: "admin"},
+		"/narwhal.user.v1.UserService/DeleteRole":       {Resource: "system", Action: "admin"},
+		"/narwhal.user.v1.UserService/CreatePermission": {Resource: "system", Action: "admin"},
+		"/narwhal.user.v1.UserService/DeletePermission": {Resource: "system", Action: "admin"},
+
+		// Dead-letter queue operations
+		"/narwhal.events.v1.DeadLetterService/ListDeadLetters":    {Resource: "system", Action: "read"},
+		"/narwhal.events.v1.DeadLetterService/GetDeadLetter":      {Resource: "system", Action: "read"},
+		"/narwhal.events.v1.DeadLetterService/RequeueDeadLetters": {Resource: "system", Action: "admin"},
+		"/narwhal.events.v1.DeadLetterService/DiscardDeadLetters": {Resource: "system", Action: "admin"},
+
+		// Diagnostics
+		"/narwhal.events.v1.DiagnosticsService/TailLogs":           {Resource: "system", Action: "admin"},
+		"/narwhal.events.v1.DiagnosticsService/ListActivity":       {Resource: "system", Action: "admin"},
+		"/narwhal.events.v1.DiagnosticsService/CaptureDiagnostics": {Resource: "system", Action: "admin"},
+
+		// Background tasks
+		"/narwhal.events.v1.TaskService/ListTasks":  {Resource: "system", Action: "read"},
+		"/narwhal.events.v1.TaskService/GetTask":    {Resource: "system", Action: "read"},
+		"/narwhal.events.v1.TaskService/CancelTask": {Resource: "system", Action: "admin"},
 	}
-
-	if perm, ok := permissions[method]; ok {
-		return perm.Resource, perm.Action
-	}
-
-	return "", ""
 }
 
 // wrappedServerStream wraps a grpc.ServerStream with a custom context.
@@ -303,6 +614,12 @@ func GetRolesFromContext(ctx context.Context) ([]string, bool) {
 	return roles, ok
 }
 
+// IsAdmin reports whether the caller has the admin role.
+func IsAdmin(ctx context.Context) bool {
+	roles, _ := GetRolesFromContext(ctx)
+	return slices.Contains(roles, domain.RoleAdmin)
+}
+
 // RequirePermission creates a function that checks for a specific permission.
 func (a *AuthInterceptor) RequirePermission(resource, action string) func(context.Context) error {
 	return func(ctx context.Context) error {
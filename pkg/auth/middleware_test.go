@@ -0,0 +1,274 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/logger"
+	"github.com/narwhalmedia/narwhal/test/testutil"
+)
+
+const (
+	cancelDownloadMethod = "/narwhal.acquisition.v1.AcquisitionService/CancelDownload"
+	getLibraryMethod     = "/narwhal.library.v1.LibraryService/GetLibrary"
+)
+
+type fakeResolver struct {
+	owners  map[string]string
+	members map[string]string
+}
+
+func (f *fakeResolver) ResourceOwner(_ context.Context, _, id string) (string, error) {
+	return f.owners[id], nil
+}
+
+func (f *fakeResolver) IsLibraryMember(_ context.Context, userID, libraryID string) (bool, error) {
+	return f.members[libraryID] == userID, nil
+}
+
+func callAs(
+	t *testing.T,
+	jwtManager *auth.JWTManager,
+	interceptor *auth.AuthInterceptor,
+	user *domain.User,
+	method string,
+	req interface{},
+) error {
+	tokens, err := jwtManager.GenerateTokenPair(user, uuid.New())
+	require.NoError(t, err)
+
+	ctx := metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs("authorization", "Bearer "+tokens.AccessToken))
+	handler := func(context.Context, interface{}) (interface{}, error) { return "ok", nil }
+
+	_, err = interceptor.UnaryServerInterceptor()(ctx, req, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+	return err
+}
+
+func userWithRole(role string) *domain.User {
+	user := testutil.CreateTestUser(role+"-user", role+"@example.com")
+	user.Roles = []domain.Role{*testutil.CreateTestRole(role, role)}
+	return user
+}
+
+func TestAuthInterceptor_OwnershipCondition(t *testing.T) {
+	jwtManager := auth.NewJWTManager("access", "refresh", "test", 15*time.Minute, time.Hour)
+	owner := userWithRole(domain.RoleUser)
+	other := userWithRole(domain.RoleUser)
+	admin := userWithRole(domain.RoleAdmin)
+	guest := userWithRole(domain.RoleGuest)
+
+	resolver := &fakeResolver{owners: map[string]string{"dl-1": owner.ID.String()}}
+	interceptor := auth.NewAuthInterceptor(jwtManager, auth.NewRBAC()).WithAttributeResolver(resolver)
+	req := wrapperspb.String("dl-1")
+	interceptor.SetMethodPolicy(cancelDownloadMethod, auth.MethodPolicy{
+		Resource:   domain.ResourceAcquisition,
+		Action:     domain.ActionDelete,
+		Conditions: []auth.Condition{{Kind: auth.ConditionOwner, Field: "value", Resource: auth.ResourceDownload}},
+	})
+
+	// Owners may cancel their own downloads
+	assert.NoError(t, callAs(t, jwtManager, interceptor, owner, cancelDownloadMethod, req))
+
+	// Other users may not
+	err := callAs(t, jwtManager, interceptor, other, cancelDownloadMethod, req)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// Roles granted the unconditional action bypass the condition
+	assert.NoError(t, callAs(t, jwtManager, interceptor, admin, cancelDownloadMethod, req))
+
+	// Roles without the scoped action are denied even when they own it
+	resolver.owners["dl-2"] = guest.ID.String()
+	err = callAs(t, jwtManager, interceptor, guest, cancelDownloadMethod, wrapperspb.String("dl-2"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// Conditions fail closed when the request field is missing
+	err = callAs(t, jwtManager, interceptor, owner, cancelDownloadMethod, wrapperspb.Int64(1))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestAuthInterceptor_LibraryMemberCondition(t *testing.T) {
+	jwtManager := auth.NewJWTManager("access", "refresh", "test", 15*time.Minute, time.Hour)
+	rbac := auth.NewRBAC()
+	rbac.AddPermission("family", domain.ResourceLibrary, auth.ScopedAction(domain.ActionRead, auth.ConditionLibraryMember))
+	member := userWithRole("family")
+	outsider := userWithRole("family")
+
+	interceptor := auth.NewAuthInterceptor(jwtManager, rbac)
+	interceptor.SetMethodPolicy(getLibraryMethod, auth.MethodPolicy{
+		Resource:   domain.ResourceLibrary,
+		Action:     domain.ActionRead,
+		Conditions: []auth.Condition{{Kind: auth.ConditionLibraryMember, Field: "value"}},
+	})
+	req := wrapperspb.String("lib-1")
+
+	// Without a resolver membership cannot be established
+	err := callAs(t, jwtManager, interceptor, member, getLibraryMethod, req)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	interceptor.WithAttributeResolver(&fakeResolver{members: map[string]string{"lib-1": member.ID.String()}})
+	assert.NoError(t, callAs(t, jwtManager, interceptor, member, getLibraryMethod, req))
+
+	err = callAs(t, jwtManager, interceptor, outsider, getLibraryMethod, req)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestAuthInterceptor_PublicMethods(t *testing.T) {
+	jwtManager := auth.NewJWTManager("access", "refresh", "test", 15*time.Minute, time.Hour)
+	manifestMethod := "/narwhal.streaming.v1.StreamingService/GetManifest"
+	interceptor := auth.NewAuthInterceptor(jwtManager, auth.NewRBAC())
+	handler := func(context.Context, interface{}) (interface{}, error) { return "ok", nil }
+	call := func(method string) error {
+		_, err := interceptor.UnaryServerInterceptor()(
+			context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+
+	// Health checks are public by default
+	assert.NoError(t, call("/grpc.health.v1.Health/Check"))
+	assert.Equal(t, codes.Unauthenticated, status.Code(call(manifestMethod)))
+
+	// Configured methods add to the defaults
+	interceptor.WithPublicMethods(map[string]bool{manifestMethod: true})
+	assert.NoError(t, call(manifestMethod))
+	assert.NoError(t, call("/grpc.health.v1.Health/Check"))
+}
+
+func TestAuthInterceptor_RequireConsent(t *testing.T) {
+	jwtManager := auth.NewJWTManager("access", "refresh", "test", 15*time.Minute, time.Hour)
+	interceptor := auth.NewAuthInterceptor(jwtManager, auth.NewRBAC())
+	user := userWithRole(domain.RoleUser)
+	user.ConsentRequired = true
+
+	err := callAs(t, jwtManager, interceptor, user, getLibraryMethod, nil)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.NoError(t, callAs(t, jwtManager, interceptor, user, "/narwhal.auth.v1.AuthService/AcceptConsents", nil))
+
+	user.ConsentRequired = false
+	assert.NoError(t, callAs(t, jwtManager, interceptor, user, getLibraryMethod, nil))
+}
+
+func TestAuthInterceptor_ShareTokensOnlyStream(t *testing.T) {
+	jwtManager := auth.NewJWTManager("access", "refresh", "test", 15*time.Minute, time.Hour)
+	interceptor := auth.NewAuthInterceptor(jwtManager, auth.NewRBAC())
+	token, expiresAt, err := jwtManager.GenerateShareToken(uuid.New(), auth.ShareGrant{
+		LinkID: uuid.NewString(), MediaID: uuid.NewString(), MaxBitrate: 4000,
+	}, time.Hour)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt, time.Minute)
+
+	ctx := metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs("authorization", "Bearer "+token))
+	handler := func(context.Context, interface{}) (interface{}, error) { return "ok", nil }
+	call := func(method string) error {
+		_, err := interceptor.UnaryServerInterceptor()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+
+	assert.NoError(t, call("/narwhal.streaming.v1.StreamingService/GetManifest"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(call(getLibraryMethod)))
+	assert.Equal(t, codes.PermissionDenied, status.Code(call("/narwhal.streaming.v1.StreamingService/GetActiveStreams")))
+}
+
+func TestAuthInterceptor_KioskTokensOnlyReadDisplay(t *testing.T) {
+	jwtManager := auth.NewJWTManager("access", "refresh", "test", 15*time.Minute, time.Hour)
+	interceptor := auth.NewAuthInterceptor(jwtManager, auth.NewRBAC())
+	libraryID := uuid.NewString()
+	token, _, err := jwtManager.GenerateKioskToken(uuid.New(), auth.KioskGrant{
+		KioskID: uuid.NewString(), LibraryIDs: []string{libraryID},
+	}, time.Hour)
+	require.NoError(t, err)
+
+	claims, err := jwtManager.ValidateAccessToken(token)
+	require.NoError(t, err)
+	assert.True(t, claims.IsKiosk())
+	assert.False(t, claims.IsShare())
+	assert.Equal(t, []string{libraryID}, claims.Kiosk.LibraryIDs)
+
+	ctx := metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs("authorization", "Bearer "+token))
+	handler := func(context.Context, interface{}) (interface{}, error) { return "ok", nil }
+	call := func(method string) error {
+		_, err := interceptor.UnaryServerInterceptor()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+
+	assert.NoError(t, call("/narwhal.library.v1.KioskService/GetDisplay"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(call(getLibraryMethod)))
+	assert.Equal(t, codes.PermissionDenied, status.Code(call("/narwhal.streaming.v1.StreamingService/GetManifest")))
+}
+
+func TestAuthInterceptor_AuditsImpersonation(t *testing.T) {
+	jwtManager := auth.NewJWTManager("access", "refresh", "test", 15*time.Minute, time.Hour)
+	ring := logger.NewRingBuffer(10)
+	interceptor := auth.NewAuthInterceptor(jwtManager, auth.NewRBAC()).
+		WithImpersonationAudit(logger.WithRing(logger.NewNoopLogger(), ring, "library"))
+	impersonatorID := uuid.New()
+	tokens, err := jwtManager.GenerateImpersonationToken(
+		userWithRole(domain.RoleAdmin), impersonatorID, uuid.New(), time.Hour)
+	require.NoError(t, err)
+
+	ctx := metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs("authorization", "Bearer "+tokens.AccessToken))
+	unary := func(method string) error {
+		handler := func(context.Context, interface{}) (interface{}, error) { return "ok", nil }
+		_, err := interceptor.UnaryServerInterceptor()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+	stream := func(method string) error {
+		handler := func(interface{}, grpc.ServerStream) error { return nil }
+		return interceptor.StreamServerInterceptor()(nil, &fakeServerStream{ctx: ctx},
+			&grpc.StreamServerInfo{FullMethod: method}, handler)
+	}
+
+	assert.NoError(t, unary(getLibraryMethod))
+	deleteLibrary := "/narwhal.library.v1.LibraryService/DeleteLibrary"
+	assert.Equal(t, codes.PermissionDenied, status.Code(unary(deleteLibrary)))
+	assert.Equal(t, codes.PermissionDenied, status.Code(stream(deleteLibrary)))
+
+	entries := ring.Tail(logger.TailFilter{})
+	require.Len(t, entries, 3)
+	for _, entry := range entries {
+		assert.Equal(t, "Impersonated request", entry.Message)
+		assert.Equal(t, impersonatorID.String(), entry.Fields["impersonator_id"])
+	}
+	assert.Equal(t, "false", entries[0].Fields["blocked"])
+	assert.Equal(t, "true", entries[2].Fields["blocked"])
+}
+
+type fakeServerStream struct {
+	grpc.ServerStream
+
+	ctx context.Context
+}
+
+func (f *fakeServerStream) Context() context.Context {
+	return f.ctx
+}
+
+func TestAuthInterceptor_SystemMethodsRequirePlatformAdmin(t *testing.T) {
+	jwtManager := auth.NewJWTManager("access", "refresh", "test", 15*time.Minute, time.Hour)
+	interceptor := auth.NewAuthInterceptor(jwtManager, auth.NewRBAC())
+	setHookEnabled := "/narwhal.library.v1.LibraryService/SetHookEnabled"
+
+	assert.NoError(t, callAs(t, jwtManager, interceptor, userWithRole(domain.RoleAdmin), setHookEnabled, nil))
+
+	// Admins of other tenants manage only their tenant, not the install
+	tenantAdmin := userWithRole(domain.RoleAdmin)
+	tenantAdmin.TenantID = uuid.New()
+	err := callAs(t, jwtManager, interceptor, tenantAdmin, setHookEnabled, nil)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.NoError(t, callAs(t, jwtManager, interceptor, tenantAdmin, getLibraryMethod, nil))
+}
@@ -2,22 +2,33 @@ package auth
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/narwhalmedia/narwhal/internal/user/domain"
 )
 
+// Wildcard matches any resource or action in a permission or deny rule.
+const Wildcard = "*"
+
 // RBAC provides role-based access control functionality.
+//
+// Roles inherit every rule of their parent roles. Deny rules take precedence
+// over allow rules anywhere in a role's inheritance chain, so a parent can be
+// narrowed without copying its permissions.
 type RBAC struct {
 	permissions map[string]map[string][]string // role -> resource -> actions
+	denies      map[string]map[string][]string // role -> resource -> actions
+	parents     map[string][]string            // role -> inherited roles
 }
 
 // NewRBAC creates a new RBAC instance with default permissions.
 func NewRBAC() *RBAC {
 	rbac := &RBAC{
 		permissions: make(map[string]map[string][]string),
+		denies:      make(map[string]map[string][]string),
+		parents:     make(map[string][]string),
 	}
 	rbac.initializeDefaultPermissions()
 	return rbac
@@ -28,7 +39,7 @@ func (r *RBAC) initializeDefaultPermissions() {
 	// Admin role - full access to everything
 	r.permissions[domain.RoleAdmin] = map[string][]string{
 		domain.ResourceLibrary:     {domain.ActionRead, domain.ActionWrite, domain.ActionDelete, domain.ActionAdmin},
-		domain.ResourceMedia:       {domain.ActionRead, domain.ActionWrite, domain.ActionDelete, domain.ActionAdmin},
+		domain.ResourceMedia:       {domain.ActionRead, domain.ActionWrite, domain.ActionDelete, domain.ActionAdmin, domain.ActionShare},
 		domain.ResourceUser:        {domain.ActionRead, domain.ActionWrite, domain.ActionDelete, domain.ActionAdmin},
 		domain.ResourceTranscoding: {domain.ActionRead, domain.ActionWrite, domain.ActionDelete, domain.ActionAdmin},
 		domain.ResourceStreaming:   {domain.ActionRead, domain.ActionWrite, domain.ActionDelete, domain.ActionAdmin},
@@ -37,40 +48,47 @@ func (r *RBAC) initializeDefaultPermissions() {
 		domain.ResourceSystem:      {domain.ActionRead, domain.ActionWrite, domain.ActionDelete, domain.ActionAdmin},
 	}
 
-	// User role - standard user permissions
+	// Guest role - minimal permissions
+	r.permissions[domain.RoleGuest] = map[string][]string{
+		domain.ResourceLibrary:   {domain.ActionRead},
+		domain.ResourceMedia:     {domain.ActionRead},
+		domain.ResourceStreaming: {domain.ActionRead},
+	}
+
+	for role, parent := range DefaultRoleHierarchy() {
+		r.parents[role] = []string{parent}
+	}
+
+	// User role - standard user permissions on top of guest
 	r.permissions[domain.RoleUser] = map[string][]string{
-		domain.ResourceLibrary:     {domain.ActionRead},
-		domain.ResourceMedia:       {domain.ActionRead, domain.ActionWrite},
+		domain.ResourceMedia:       {domain.ActionWrite, domain.ActionShare},
 		domain.ResourceUser:        {domain.ActionRead, domain.ActionWrite}, // Can read/update own profile
 		domain.ResourceTranscoding: {domain.ActionRead},
-		domain.ResourceStreaming:   {domain.ActionRead},
-		domain.ResourceAcquisition: {domain.ActionRead},
+		// Can cancel downloads they requested
+		domain.ResourceAcquisition: {domain.ActionRead, ScopedAction(domain.ActionDelete, ConditionOwner)},
 		domain.ResourceAnalytics:   {domain.ActionRead}, // Can view own analytics
-		domain.ResourceSystem:      {},                  // No system access
 	}
 
-	// Guest role - minimal permissions
-	r.permissions[domain.RoleGuest] = map[string][]string{
-		domain.ResourceLibrary:     {domain.ActionRead},
-		domain.ResourceMedia:       {domain.ActionRead},
-		domain.ResourceUser:        {},
-		domain.ResourceTranscoding: {},
-		domain.ResourceStreaming:   {domain.ActionRead},
-		domain.ResourceAcquisition: {},
-		domain.ResourceAnalytics:   {},
-		domain.ResourceSystem:      {},
+	// Moderator role - curates content on top of user
+	r.permissions[domain.RoleModerator] = map[string][]string{
+		domain.ResourceLibrary: {domain.ActionWrite},
+		domain.ResourceMedia:   {domain.ActionDelete},
 	}
 }
 
 // CheckPermission checks if a role has permission to perform an action on a resource.
 func (r *RBAC) CheckPermission(role, resource, action string) bool {
-	if resourcePerms, ok := r.permissions[role]; ok {
-		if actions, ok := resourcePerms[resource]; ok {
-			for _, a := range actions {
-				if a == action {
-					return true
-				}
-			}
+	lineage := r.lineage(role)
+
+	for _, ancestor := range lineage {
+		if ruleMatches(r.denies[ancestor], resource, action) {
+			return false
+		}
+	}
+
+	for _, ancestor := range lineage {
+		if ruleMatches(r.permissions[ancestor], resource, action) {
+			return true
 		}
 	}
 	return false
@@ -86,50 +104,129 @@ func (r *RBAC) CheckPermissions(roles []string, resource, action string) bool {
 	return false
 }
 
-// GetRolePermissions returns all permissions for a role.
+// GetRolePermissions returns all permissions for a role, including those
+// inherited from its parents. Deny rules are not included.
 func (r *RBAC) GetRolePermissions(role string) map[string][]string {
-	if perms, ok := r.permissions[role]; ok {
-		// Return a copy to prevent modification
-		result := make(map[string][]string)
-		for resource, actions := range perms {
-			result[resource] = append([]string{}, actions...)
+	if !r.roleExists(role) {
+		return nil
+	}
+
+	// Return a copy to prevent modification
+	result := make(map[string][]string)
+	for _, ancestor := range r.lineage(role) {
+		for resource, actions := range r.permissions[ancestor] {
+			for _, action := range actions {
+				if !slices.Contains(result[resource], action) {
+					result[resource] = append(result[resource], action)
+				}
+			}
 		}
-		return result
 	}
-	return nil
+	return result
 }
 
 // AddPermission adds a permission to a role.
 func (r *RBAC) AddPermission(role, resource, action string) {
-	if _, ok := r.permissions[role]; !ok {
-		r.permissions[role] = make(map[string][]string)
+	addRule(r.permissions, role, resource, action)
+}
+
+// RemovePermission removes a permission from a role.
+func (r *RBAC) RemovePermission(role, resource, action string) {
+	removeRule(r.permissions, role, resource, action)
+}
+
+// AddDeny adds a deny rule to a role. It overrides any permission the role
+// has or inherits.
+func (r *RBAC) AddDeny(role, resource, action string) error {
+	addRule(r.denies, role, resource, action)
+	return nil
+}
+
+// RemoveDeny removes a deny rule from a role.
+func (r *RBAC) RemoveDeny(role, resource, action string) {
+	removeRule(r.denies, role, resource, action)
+}
+
+// AddRoleInheritance makes role inherit the rules of parent.
+func (r *RBAC) AddRoleInheritance(role, parent string) error {
+	if slices.Contains(r.lineage(parent), role) {
+		return fmt.Errorf("role %s cannot inherit from %s: inheritance cycle", role, parent)
+	}
+	if !slices.Contains(r.parents[role], parent) {
+		r.parents[role] = append(r.parents[role], parent)
 	}
+	return nil
+}
 
-	if _, ok := r.permissions[role][resource]; !ok {
-		r.permissions[role][resource] = []string{}
+// RemoveRoleInheritance stops role inheriting the rules of parent.
+func (r *RBAC) RemoveRoleInheritance(role, parent string) {
+	r.parents[role] = slices.DeleteFunc(r.parents[role], func(p string) bool {
+		return p == parent
+	})
+}
+
+// GetRoleParents returns the roles a role directly inherits from.
+func (r *RBAC) GetRoleParents(role string) []string {
+	return append([]string{}, r.parents[role]...)
+}
+
+// lineage returns role followed by every role it inherits from, nearest
+// first. Each role appears once.
+func (r *RBAC) lineage(role string) []string {
+	lineage := []string{role}
+	for i := 0; i < len(lineage); i++ {
+		for _, parent := range r.parents[lineage[i]] {
+			if !slices.Contains(lineage, parent) {
+				lineage = append(lineage, parent)
+			}
+		}
 	}
+	return lineage
+}
 
-	// Check if action already exists
-	for _, a := range r.permissions[role][resource] {
-		if a == action {
-			return
+func (r *RBAC) roleExists(role string) bool {
+	_, hasPerms := r.permissions[role]
+	_, hasDenies := r.denies[role]
+	_, hasParents := r.parents[role]
+	return hasPerms || hasDenies || hasParents
+}
+
+// ruleMatches reports whether a role's rule set covers resource and action,
+// honouring wildcards.
+func ruleMatches(rules map[string][]string, resource, action string) bool {
+	for _, res := range []string{resource, Wildcard} {
+		for _, a := range rules[res] {
+			if a == action || a == Wildcard {
+				return true
+			}
 		}
 	}
+	return false
+}
+
+func addRule(rules map[string]map[string][]string, role, resource, action string) {
+	if _, ok := rules[role]; !ok {
+		rules[role] = make(map[string][]string)
+	}
 
-	r.permissions[role][resource] = append(r.permissions[role][resource], action)
+	// Check if action already exists
+	if slices.Contains(rules[role][resource], action) {
+		return
+	}
+
+	rules[role][resource] = append(rules[role][resource], action)
 }
 
-// RemovePermission removes a permission from a role.
-func (r *RBAC) RemovePermission(role, resource, action string) {
-	if resourcePerms, ok := r.permissions[role]; ok {
-		if actions, ok := resourcePerms[resource]; ok {
+func removeRule(rules map[string]map[string][]string, role, resource, action string) {
+	if resourceRules, ok := rules[role]; ok {
+		if actions, ok := resourceRules[resource]; ok {
 			newActions := []string{}
 			for _, a := range actions {
 				if a != action {
 					newActions = append(newActions, a)
 				}
 			}
-			r.permissions[role][resource] = newActions
+			rules[role][resource] = newActions
 		}
 	}
 }
@@ -203,21 +300,7 @@ func (p *PolicyEnforcer) CheckOwnership(
 	roles []string,
 	ownership ResourceOwnership,
 ) error {
-	// Check if user is the owner
-	if userID == resourceUserID {
-		return nil
-	}
-
-	// Check if admin access is allowed and user has admin role
-	if ownership.AllowAdmin {
-		for _, role := range roles {
-			if role == domain.RoleAdmin {
-				return nil
-			}
-		}
-	}
-
-	return errors.New("permission denied: not the resource owner")
+	return checkOwnership(userID, resourceUserID, roles, ownership)
 }
 
 // DefaultPermissions returns the default permission set for initial setup.
@@ -234,6 +317,7 @@ func DefaultPermissions() []domain.Permission {
 		{Resource: domain.ResourceMedia, Action: domain.ActionWrite, Description: "Add/update media"},
 		{Resource: domain.ResourceMedia, Action: domain.ActionDelete, Description: "Delete media"},
 		{Resource: domain.ResourceMedia, Action: domain.ActionAdmin, Description: "Manage media settings"},
+		{Resource: domain.ResourceMedia, Action: domain.ActionShare, Description: "Share media with guests"},
 
 		// User permissions
 		{Resource: domain.ResourceUser, Action: domain.ActionRead, Description: "View users"},
@@ -273,6 +357,14 @@ func DefaultPermissions() []domain.Permission {
 	}
 }
 
+// DefaultRoleHierarchy maps each default role to the role it inherits from.
+func DefaultRoleHierarchy() map[string]string {
+	return map[string]string{
+		domain.RoleModerator: domain.RoleUser,
+		domain.RoleUser:      domain.RoleGuest,
+	}
+}
+
 // DefaultRoles returns the default roles for initial setup.
 func DefaultRoles() []domain.Role {
 	return []domain.Role{
@@ -284,6 +376,10 @@ func DefaultRoles() []domain.Role {
 			Name:        domain.RoleUser,
 			Description: "Standard user with content access",
 		},
+		{
+			Name:        domain.RoleModerator,
+			Description: "Moderator who curates library content",
+		},
 		{
 			Name:        domain.RoleGuest,
 			Description: "Guest user with limited read-only access",
@@ -14,6 +14,8 @@ type RBACInterface interface {
 	GetRolePermissions(role string) map[string][]string
 	AddPermission(role, resource, action string)
 	RemovePermission(role, resource, action string)
+	AddDeny(role, resource, action string) error
+	AddRoleInheritance(role, parent string) error
 }
 
 // RBACType defines the type of RBAC implementation.
@@ -51,22 +53,7 @@ func NewRBACFromConfig(config RBACConfig) (RBACInterface, error) {
 		}
 
 		// Use embedded default configuration
-		modelText := `[request_definition]
-r = sub, obj, act
-
-[policy_definition]
-p = sub, obj, act
-
-[role_definition]
-g = _, _
-
-[policy_effect]
-e = some(where (p.eft == allow))
-
-[matchers]
-m = g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act`
-
-		rbac, err := NewCasbinRBACFromString(modelText, "", config.Logger)
+		rbac, err := NewCasbinRBACFromString(DefaultCasbinModel, "", config.Logger)
 		if err != nil {
 			return nil, err
 		}
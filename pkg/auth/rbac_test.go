@@ -130,6 +130,47 @@ func TestRBAC_AddRemovePermission(t *testing.T) {
 	rbac.RemovePermission("nonexistent", domain.ResourceLibrary, domain.ActionRead)
 }
 
+func TestRBAC_RoleInheritance(t *testing.T) {
+	rbac := auth.NewRBAC()
+
+	// Moderator inherits user, which inherits guest
+	assert.True(t, rbac.CheckPermission(domain.RoleModerator, domain.ResourceMedia, domain.ActionDelete))
+	assert.True(t, rbac.CheckPermission(domain.RoleModerator, domain.ResourceUser, domain.ActionWrite))
+	assert.True(t, rbac.CheckPermission(domain.RoleModerator, domain.ResourceStreaming, domain.ActionRead))
+	assert.False(t, rbac.CheckPermission(domain.RoleUser, domain.ResourceMedia, domain.ActionDelete))
+	assert.Contains(t, rbac.GetRolePermissions(domain.RoleModerator)[domain.ResourceLibrary], domain.ActionRead)
+
+	// Cycles are rejected
+	require.Error(t, rbac.AddRoleInheritance(domain.RoleGuest, domain.RoleModerator))
+	require.Error(t, rbac.AddRoleInheritance(domain.RoleGuest, domain.RoleGuest))
+
+	rbac.RemoveRoleInheritance(domain.RoleModerator, domain.RoleUser)
+	assert.False(t, rbac.CheckPermission(domain.RoleModerator, domain.ResourceUser, domain.ActionWrite))
+}
+
+func TestRBAC_WildcardsAndDeny(t *testing.T) {
+	rbac := auth.NewRBAC()
+
+	rbac.AddPermission("operator", auth.Wildcard, domain.ActionRead)
+	rbac.AddPermission("operator", domain.ResourceTranscoding, auth.Wildcard)
+	assert.True(t, rbac.CheckPermission("operator", domain.ResourceSystem, domain.ActionRead))
+	assert.True(t, rbac.CheckPermission("operator", domain.ResourceTranscoding, domain.ActionDelete))
+	assert.False(t, rbac.CheckPermission("operator", domain.ResourceSystem, domain.ActionWrite))
+
+	// A deny on a parent applies to every role inheriting from it
+	require.NoError(t, rbac.AddDeny(domain.RoleUser, domain.ResourceMedia, domain.ActionWrite))
+	assert.False(t, rbac.CheckPermission(domain.RoleUser, domain.ResourceMedia, domain.ActionWrite))
+	assert.False(t, rbac.CheckPermission(domain.RoleModerator, domain.ResourceMedia, domain.ActionWrite))
+
+	// Deny wins over a wildcard allow on the same role
+	require.NoError(t, rbac.AddDeny("operator", domain.ResourceSystem, auth.Wildcard))
+	assert.False(t, rbac.CheckPermission("operator", domain.ResourceSystem, domain.ActionRead))
+	assert.True(t, rbac.CheckPermission("operator", domain.ResourceMedia, domain.ActionRead))
+
+	rbac.RemoveDeny(domain.RoleUser, domain.ResourceMedia, domain.ActionWrite)
+	assert.True(t, rbac.CheckPermission(domain.RoleModerator, domain.ResourceMedia, domain.ActionWrite))
+}
+
 func TestPolicyEnforcer_Enforce(t *testing.T) {
 	rbac := auth.NewRBAC()
 	enforcer := auth.NewPolicyEnforcer(rbac)
@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ShareMethods returns the methods the guest of a share link can call:
+// enough to stream the shared media and nothing else.
+func ShareMethods() map[string]bool {
+	return map[string]bool{
+		"/narwhal.streaming.v1.StreamingService/CreateStream":  true,
+		"/narwhal.streaming.v1.StreamingService/GetStreamInfo": true,
+		"/narwhal.streaming.v1.StreamingService/GetManifest":   true,
+		"/narwhal.streaming.v1.StreamingService/GetSegment":    true,
+		"/narwhal.streaming.v1.StreamingService/StopStream":    true,
+		"/narwhal.streaming.v1.StreamingService/StartSession":  true,
+		"/narwhal.streaming.v1.StreamingService/UpdateSession": true,
+		"/narwhal.streaming.v1.StreamingService/EndSession":    true,
+	}
+}
+
+// RestrictShare rejects calls made with a share link token to methods
+// outside allowed, or to media other than the shared media. Requests are
+// checked for their media_id field; requests without one refer to streams
+// the guest created for the shared media. Streams must not exceed the
+// bitrate of the grant, which the streaming service applies.
+func RestrictShare(claims *CustomClaims, method string, req interface{}, allowed map[string]bool) error {
+	if claims == nil || !claims.IsShare() {
+		return nil
+	}
+	if !allowed[method] {
+		return status.Error(codes.PermissionDenied, "share links only allow streaming the shared media")
+	}
+	if mediaID, ok := requestField(req, "media_id"); ok && mediaID != claims.Share.MediaID {
+		return status.Error(codes.PermissionDenied, "share links only allow streaming the shared media")
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package auth_test
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// Test vectors of RFC 6238, truncated to six digits
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	for unix, want := range map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	} {
+		code, err := auth.TOTPCode(secret, auth.TOTPStep(time.Unix(unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, want, code, "at %d", unix)
+	}
+
+	_, err := auth.TOTPCode("not base32!", 1)
+	assert.Error(t, err)
+	_, err = auth.TOTPCode("", 1)
+	assert.Error(t, err, "empty secrets have no codes")
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := auth.GenerateTOTPSecret()
+	require.NoError(t, err)
+	assert.Len(t, secret, 32)
+
+	now := time.Now()
+	step := auth.TOTPStep(now)
+	code, err := auth.TOTPCode(secret, step)
+	require.NoError(t, err)
+
+	got, ok := auth.ValidateTOTP(secret, code, now)
+	assert.True(t, ok)
+	assert.Equal(t, step, got)
+
+	got, ok = auth.ValidateTOTP(secret, code[:3]+" "+code[3:], now.Add(auth.TOTPPeriod))
+	assert.True(t, ok, "codes a period old still work")
+	assert.Equal(t, step, got)
+
+	_, ok = auth.ValidateTOTP(secret, code, now.Add(3*auth.TOTPPeriod))
+	assert.False(t, ok)
+	_, ok = auth.ValidateTOTP(secret, "12345", now)
+	assert.False(t, ok)
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri, err := url.Parse(auth.TOTPURI("Narwhal", "alice@example.com", "JBSWY3DPEHPK3PXP"))
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/Narwhal:alice@example.com", uri.Path)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", uri.Query().Get("secret"))
+	assert.Equal(t, "Narwhal", uri.Query().Get("issuer"))
+}
@@ -0,0 +1,118 @@
+// Package cdn serves media streams through a content delivery network:
+// it signs the stream URLs players fetch segments from with tokens edges
+// verify, guards the origin edges pull from, and invalidates cached
+// segments of deleted media.
+package cdn
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OriginSecretHeader is the header edges send the origin secret in.
+const OriginSecretHeader = "X-Origin-Secret"
+
+// Signer signs the URLs of a CDN.
+type Signer interface {
+	// Sign returns the query parameters authorizing requests to every URL
+	// starting with prefix until expires.
+	Sign(prefix string, expires time.Time) url.Values
+}
+
+// Invalidator removes the cached files of media from the edges of a CDN.
+type Invalidator interface {
+	InvalidateMedia(ctx context.Context, mediaID string) error
+}
+
+// Key returns the path of a file of a stream, relative to the CDN base URL
+// and the origin.
+func Key(mediaID, streamID, name string) string {
+	return "media/" + mediaID + "/" + streamID + "/" + name
+}
+
+// CacheTag returns the tag edges cache the files of media under.
+func CacheTag(mediaID string) string {
+	return "media-" + mediaID
+}
+
+// URLBuilder builds the signed CDN URLs of stream files.
+type URLBuilder struct {
+	baseURL string
+	signer  Signer
+	ttl     time.Duration
+	now     func() time.Time
+}
+
+// NewURLBuilder creates a builder of URLs below baseURL whose tokens are
+// valid for ttl.
+func NewURLBuilder(baseURL string, signer Signer, ttl time.Duration) (*URLBuilder, error) {
+	if _, err := url.Parse(baseURL); err != nil || baseURL == "" {
+		return nil, errors.New("invalid CDN base URL")
+	}
+	if ttl <= 0 {
+		return nil, errors.New("token lifetime must be positive")
+	}
+	return &URLBuilder{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		signer:  signer,
+		ttl:     ttl,
+		now:     time.Now,
+	}, nil
+}
+
+// Stream returns a function giving the signed URLs of the files of a
+// stream. One token covers every file of the stream; it is reused until
+// half of its lifetime has passed, so playlists rendered in the meantime
+// do not sign every segment again.
+func (b *URLBuilder) Stream(mediaID, streamID string) func(name string) string {
+	prefix := b.baseURL + "/" + Key(mediaID, streamID, "")
+
+	var (
+		mu      sync.Mutex
+		query   string
+		renewAt time.Time
+	)
+	return func(name string) string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if now := b.now(); !now.Before(renewAt) {
+			query = b.signer.Sign(prefix, now.Add(b.ttl)).Encode()
+			renewAt = now.Add(b.ttl / 2)
+		}
+		return prefix + url.PathEscape(name) + "?" + query
+	}
+}
+
+// Origin guards the files edges pull from the origin. Requests must carry
+// the origin secret and a path of the form /media/{mediaID}/{file}; files
+// serves them with the path /{file}, tagged with the cache tag of the
+// media so that they can be purged.
+func Origin(secret string, files http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given := r.Header.Get(OriginSecretHeader)
+		if subtle.ConstantTimeCompare([]byte(given), []byte(secret)) != 1 {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		mediaID, file, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/media/"), "/")
+		if !ok || mediaID == "" || !strings.HasPrefix(r.URL.Path, "/media/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Edge-Cache-Tag", CacheTag(mediaID))
+
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = "/" + file
+		r2.URL.RawPath = ""
+		files.ServeHTTP(w, r2)
+	})
+}
@@ -0,0 +1,175 @@
+package cdn_test
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/pkg/cdn"
+)
+
+func TestCloudFrontSigner(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	signer, err := cdn.NewCloudFrontSigner("K2JCJMDEHXQW5F", pemKey)
+	require.NoError(t, err)
+	_, err = cdn.NewCloudFrontSigner("K2JCJMDEHXQW5F", []byte("not a key"))
+	assert.Error(t, err)
+
+	expires := time.Unix(1700000000, 0)
+	params := signer.Sign("https://cdn.example.com/media/m1/s1/", expires)
+	assert.Equal(t, "K2JCJMDEHXQW5F", params.Get("Key-Pair-Id"))
+
+	decode := func(value string) []byte {
+		value = strings.NewReplacer("-", "+", "_", "=", "~", "/").Replace(value)
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		require.NoError(t, err)
+		return decoded
+	}
+	policy := decode(params.Get("Policy"))
+	assert.JSONEq(t, `{"Statement":[{"Resource":"https://cdn.example.com/media/m1/s1/*",`+
+		`"Condition":{"DateLessThan":{"AWS:EpochTime":1700000000}}}]}`, string(policy))
+
+	digest := sha1.Sum(policy)
+	assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, digest[:], decode(params.Get("Signature"))))
+}
+
+func TestAkamaiSigner(t *testing.T) {
+	_, err := cdn.NewAkamaiSigner("not hex", "")
+	assert.Error(t, err)
+
+	key := "a1b2c3d4e5f60718"
+	signer, err := cdn.NewAkamaiSigner(key, "")
+	require.NoError(t, err)
+
+	params := signer.Sign("https://cdn.example.com/media/m1/s1/", time.Unix(1700000000, 0))
+	token := params.Get(cdn.DefaultAkamaiTokenName)
+	fields, signature, ok := strings.Cut(token, "~hmac=")
+	require.True(t, ok)
+	assert.Equal(t, "exp=1700000000~acl=/media/m1/s1/*", fields)
+
+	decoded, _ := hex.DecodeString(key)
+	mac := hmac.New(sha256.New, decoded)
+	mac.Write([]byte(fields))
+	assert.Equal(t, hex.EncodeToString(mac.Sum(nil)), signature)
+}
+
+// countingSigner counts the tokens it signs.
+type countingSigner struct {
+	signed int
+}
+
+func (s *countingSigner) Sign(prefix string, expires time.Time) url.Values {
+	s.signed++
+	return url.Values{"token": {prefix}}
+}
+
+func TestURLBuilderReusesTokens(t *testing.T) {
+	signer := &countingSigner{}
+	builder, err := cdn.NewURLBuilder("https://cdn.example.com/", signer, time.Hour)
+	require.NoError(t, err)
+
+	uri := builder.Stream("m1", "s1")
+	first := uri("seg0.ts")
+	assert.Equal(t, "https://cdn.example.com/media/m1/s1/seg0.ts?token=https%3A%2F%2Fcdn.example.com%2Fmedia%2Fm1%2Fs1%2F", first)
+	uri("seg1.ts")
+	assert.Equal(t, 1, signer.signed, "the token of the stream is reused")
+
+	_, err = cdn.NewURLBuilder("https://cdn.example.com", signer, 0)
+	assert.Error(t, err)
+}
+
+func TestOriginRequiresSecretAndTagsMedia(t *testing.T) {
+	files := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.URL.Path)
+	})
+	origin := cdn.Origin("s3cret", files)
+
+	req := httptest.NewRequest(http.MethodGet, "/media/m1/s1/seg0.ts", nil)
+	rec := httptest.NewRecorder()
+	origin.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	req.Header.Set(cdn.OriginSecretHeader, "s3cret")
+	rec = httptest.NewRecorder()
+	origin.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "/s1/seg0.ts", rec.Body.String())
+	assert.Equal(t, "media-m1", rec.Header().Get("Edge-Cache-Tag"))
+
+	req = httptest.NewRequest(http.MethodGet, "/other/seg0.ts", nil)
+	req.Header.Set(cdn.OriginSecretHeader, "s3cret")
+	rec = httptest.NewRecorder()
+	origin.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestCloudFrontInvalidator(t *testing.T) {
+	var path, auth, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		path, auth, body = r.URL.Path, r.Header.Get("Authorization"), string(data)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	invalidator, err := cdn.NewCloudFrontInvalidator(cdn.CloudFrontConfig{
+		DistributionID:  "E1ABCDEF",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		Endpoint:        server.URL,
+	}, server.Client())
+	require.NoError(t, err)
+
+	require.NoError(t, invalidator.InvalidateMedia(t.Context(), "m1"))
+	assert.Equal(t, "/2020-05-31/distribution/E1ABCDEF/invalidation", path)
+	assert.Contains(t, auth, "/us-east-1/cloudfront/aws4_request")
+	assert.Contains(t, body, "<Quantity>1</Quantity><Items><Path>/media/m1/*</Path></Items>")
+}
+
+func TestAkamaiInvalidator(t *testing.T) {
+	var path, auth, body string
+	status := http.StatusCreated
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		path, auth, body = r.URL.Path, r.Header.Get("Authorization"), string(data)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	invalidator, err := cdn.NewAkamaiInvalidator(cdn.EdgeGridCredentials{
+		Host:         server.URL,
+		ClientToken:  "client",
+		ClientSecret: "secret",
+		AccessToken:  "access",
+	}, server.Client())
+	require.NoError(t, err)
+
+	require.NoError(t, invalidator.InvalidateMedia(t.Context(), "m1"))
+	assert.Equal(t, "/ccu/v3/invalidate/tag/production", path)
+	assert.True(t, strings.HasPrefix(auth, "EG1-HMAC-SHA256 client_token=client;access_token=access;"))
+	assert.Contains(t, auth, ";signature=")
+	assert.JSONEq(t, `{"objects":["media-m1"]}`, body)
+
+	status = http.StatusForbidden
+	assert.Error(t, invalidator.InvalidateMedia(t.Context(), "m1"))
+}
@@ -0,0 +1,185 @@
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec // CloudFront signs policies with SHA-1
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/pkg/storage"
+)
+
+// cloudFrontEndpoint is the endpoint of the CloudFront API.
+const cloudFrontEndpoint = "https://cloudfront.amazonaws.com"
+
+// cloudFrontEncoding is the URL-safe base64 variant of CloudFront, which
+// replaces +, = and / with -, _ and ~.
+var cloudFrontEncoding = strings.NewReplacer("+", "-", "=", "_", "/", "~")
+
+// CloudFrontSigner signs URLs with the custom policies of CloudFront
+// signed URLs.
+type CloudFrontSigner struct {
+	keyPairID string
+	key       *rsa.PrivateKey
+}
+
+// NewCloudFrontSigner creates a signer for the key pair, whose private key
+// is PEM encoded in PKCS #1 or PKCS #8 form.
+func NewCloudFrontSigner(keyPairID string, privateKey []byte) (*CloudFrontSigner, error) {
+	if keyPairID == "" {
+		return nil, errors.New("cloudfront key pair ID is required")
+	}
+	block, _ := pem.Decode(privateKey)
+	if block == nil {
+		return nil, errors.New("cloudfront private key is not PEM encoded")
+	}
+
+	var key *rsa.PrivateKey
+	if parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		key = parsed
+	} else {
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cloudfront private key: %w", err)
+		}
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("cloudfront private key must be an RSA key")
+		}
+		key = rsaKey
+	}
+	if key.N.BitLen() < 1024 {
+		return nil, errors.New("cloudfront private key must have at least 1024 bits")
+	}
+	return &CloudFrontSigner{keyPairID: keyPairID, key: key}, nil
+}
+
+// Sign returns the Policy, Signature and Key-Pair-Id parameters of a custom
+// policy allowing prefix and everything below it.
+func (s *CloudFrontSigner) Sign(prefix string, expires time.Time) url.Values {
+	type condition struct {
+		DateLessThan map[string]int64 `json:"DateLessThan"`
+	}
+	type statement struct {
+		Resource  string    `json:"Resource"`
+		Condition condition `json:"Condition"`
+	}
+	policy, _ := json.Marshal(map[string][]statement{
+		"Statement": {{
+			Resource:  prefix + "*",
+			Condition: condition{DateLessThan: map[string]int64{"AWS:EpochTime": expires.Unix()}},
+		}},
+	})
+
+	digest := sha1.Sum(policy)
+	// Signing only fails for keys too small for the digest, which
+	// NewCloudFrontSigner rejects
+	signature, _ := rsa.SignPKCS1v15(nil, s.key, crypto.SHA1, digest[:])
+
+	return url.Values{
+		"Policy":      {cloudFrontEncoding.Replace(base64.StdEncoding.EncodeToString(policy))},
+		"Signature":   {cloudFrontEncoding.Replace(base64.StdEncoding.EncodeToString(signature))},
+		"Key-Pair-Id": {s.keyPairID},
+	}
+}
+
+// CloudFrontConfig contains the settings of a CloudFront distribution
+// invalidations are created for.
+type CloudFrontConfig struct {
+	DistributionID  string
+	AccessKeyID     string
+	SecretAccessKey string
+	// Endpoint overrides the CloudFront API endpoint.
+	Endpoint string
+}
+
+// CloudFrontInvalidator invalidates the paths of media in a CloudFront
+// distribution.
+type CloudFrontInvalidator struct {
+	cfg    CloudFrontConfig
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewCloudFrontInvalidator creates an invalidator for the distribution.
+func NewCloudFrontInvalidator(cfg CloudFrontConfig, client *http.Client) (*CloudFrontInvalidator, error) {
+	if cfg.DistributionID == "" {
+		return nil, errors.New("cloudfront distribution ID is required")
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("cloudfront credentials are required")
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = cloudFrontEndpoint
+	}
+	cfg.Endpoint = strings.TrimRight(cfg.Endpoint, "/")
+	return &CloudFrontInvalidator{cfg: cfg, client: client, now: time.Now}, nil
+}
+
+// cloudFrontInvalidation is the InvalidationBatch of the CloudFront API.
+type cloudFrontInvalidation struct {
+	XMLName         struct{} `xml:"http://cloudfront.amazonaws.com/doc/2020-05-31/ InvalidationBatch"`
+	CallerReference string   `xml:"CallerReference"`
+	Quantity        int      `xml:"Paths>Quantity"`
+	Paths           []string `xml:"Paths>Items>Path"`
+}
+
+// InvalidateMedia creates an invalidation of every stream file of media.
+func (i *CloudFrontInvalidator) InvalidateMedia(ctx context.Context, mediaID string) error {
+	paths := []string{"/media/" + mediaID + "/*"}
+	batch, err := xml.Marshal(cloudFrontInvalidation{
+		CallerReference: uuid.NewString(),
+		Quantity:        len(paths),
+		Paths:           paths,
+	})
+	if err != nil {
+		return err
+	}
+	body := append([]byte(xml.Header), batch...)
+
+	path := storage.EscapePath("/2020-05-31/distribution/" + i.cfg.DistributionID + "/invalidation")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.cfg.Endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/xml")
+	storage.SignV4(req, path, body, storage.AWSCredentials{
+		Region:          "us-east-1", // the CloudFront API is global
+		Service:         "cloudfront",
+		AccessKeyID:     i.cfg.AccessKeyID,
+		SecretAccessKey: i.cfg.SecretAccessKey,
+	}, i.now())
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to invalidate media: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("failed to invalidate media: %s", responseError(resp))
+	}
+	return nil
+}
+
+// responseError describes a failed response, including the start of its
+// body.
+func responseError(resp *http.Response) string {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Sprintf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
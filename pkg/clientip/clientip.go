@@ -0,0 +1,172 @@
+// Package clientip derives the IP address of the client behind a request.
+// Proxies such as load balancers and the HTTP gateway report the address
+// they received a request from in X-Forwarded-For, but any client can send
+// the header too, so only the hops added by trusted proxies are believed.
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Resolver derives client IPs from the addresses of trusted proxies.
+type Resolver struct {
+	trusted []netip.Prefix
+}
+
+// NewResolver creates a resolver trusting the proxies in a list of CIDRs,
+// such as "10.0.0.0/8", or single addresses. Without trusted proxies the
+// client IP is always the address of the peer.
+func NewResolver(trustedProxies []string) (*Resolver, error) {
+	r := &Resolver{}
+	for _, cidr := range trustedProxies {
+		cidr = strings.TrimSpace(cidr)
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(cidr)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		r.trusted = append(r.trusted, prefix.Masked())
+	}
+	return r, nil
+}
+
+// Trusted reports whether an address belongs to a trusted proxy.
+func (r *Resolver) Trusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range r.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the client IP of a request received from remote, the
+// address of the peer, with the values of its X-Forwarded-For and
+// X-Real-IP headers. Forwarded hops are read from the closest one back
+// while they come from trusted proxies; the first hop that does not is the
+// client. X-Real-IP is only believed from a trusted peer that forwarded no
+// hops.
+func (r *Resolver) Resolve(remote string, forwardedFor []string, realIP string) string {
+	client := hostOnly(remote)
+	if !r.Trusted(client) {
+		return client
+	}
+
+	var hops []string
+	for _, header := range forwardedFor {
+		for _, hop := range strings.Split(header, ",") {
+			if hop = hostOnly(strings.TrimSpace(hop)); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	if len(hops) == 0 {
+		if ip := hostOnly(strings.TrimSpace(realIP)); ip != "" {
+			return ip
+		}
+		return client
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		if _, err := netip.ParseAddr(hops[i]); err != nil {
+			// A garbled hop cannot be trusted past
+			return client
+		}
+		client = hops[i]
+		if !r.Trusted(client) {
+			return client
+		}
+	}
+	// Every hop is a trusted proxy: the first one is the client
+	return client
+}
+
+// FromRequest returns the client IP of an HTTP request.
+func (r *Resolver) FromRequest(req *http.Request) string {
+	return r.Resolve(req.RemoteAddr, req.Header.Values("X-Forwarded-For"), req.Header.Get("X-Real-IP"))
+}
+
+// FromIncomingContext returns the client IP of a gRPC call from its peer
+// and metadata.
+func (r *Resolver) FromIncomingContext(ctx context.Context) string {
+	var remote string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		remote = p.Addr.String()
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	var realIP string
+	if values := md.Get("x-real-ip"); len(values) > 0 {
+		realIP = values[0]
+	}
+	return r.Resolve(remote, md.Get("x-forwarded-for"), realIP)
+}
+
+// UnaryServerInterceptor resolves the client IP of calls into their
+// context, where FromContext finds it.
+func (r *Resolver) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(NewContext(ctx, r.FromIncomingContext(ctx)), req)
+	}
+}
+
+// StreamServerInterceptor resolves the client IP of streams into their
+// context, where FromContext finds it.
+func (r *Resolver) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := NewContext(ss.Context(), r.FromIncomingContext(ss.Context()))
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying a client IP.
+func NewContext(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, contextKey{}, ip)
+}
+
+// FromContext returns the client IP resolved by the interceptors, or the
+// address of the peer for calls they did not see, trusting no proxies.
+func FromContext(ctx context.Context) string {
+	if ip, ok := ctx.Value(contextKey{}).(string); ok {
+		return ip
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return hostOnly(p.Addr.String())
+	}
+	return ""
+}
+
+// hostOnly strips the port from an address.
+func hostOnly(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.Trim(addr, "[]")
+}
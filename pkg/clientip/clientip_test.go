@@ -0,0 +1,78 @@
+package clientip_test
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/narwhalmedia/narwhal/pkg/clientip"
+)
+
+func TestResolver_Resolve(t *testing.T) {
+	resolver, err := clientip.NewResolver([]string{"10.0.0.0/8", "192.168.1.5", "fd00::/8"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		remote       string
+		forwardedFor []string
+		realIP       string
+		want         string
+	}{
+		{"direct client", "203.0.113.7:5000", nil, "", "203.0.113.7"},
+		{"spoofed header from untrusted peer", "203.0.113.7:5000", []string{"1.1.1.1"}, "2.2.2.2", "203.0.113.7"},
+		{"trusted proxy", "10.0.0.2:443", []string{"203.0.113.7"}, "", "203.0.113.7"},
+		{"spoofed hop before trusted proxy", "10.0.0.2:443", []string{"1.1.1.1, 203.0.113.7"}, "", "203.0.113.7"},
+		{"chain of trusted proxies", "10.0.0.2:443", []string{"203.0.113.7, 192.168.1.5", "10.0.0.9"}, "", "203.0.113.7"},
+		{"all hops trusted", "10.0.0.2:443", []string{"10.0.0.7, 10.0.0.8"}, "", "10.0.0.7"},
+		{"garbled hop", "10.0.0.2:443", []string{"203.0.113.7, unknown"}, "", "10.0.0.2"},
+		{"real ip from trusted peer", "10.0.0.2:443", nil, "203.0.113.7", "203.0.113.7"},
+		{"ipv6", "[fd00::1]:443", []string{"2001:db8::7"}, "", "2001:db8::7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, resolver.Resolve(tt.remote, tt.forwardedFor, tt.realIP))
+		})
+	}
+
+	_, err = clientip.NewResolver([]string{"not-a-cidr"})
+	assert.Error(t, err)
+}
+
+func TestResolver_FromRequest(t *testing.T) {
+	resolver, err := clientip.NewResolver([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.2:443"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+
+	assert.Equal(t, "203.0.113.7", resolver.FromRequest(req))
+}
+
+func TestResolver_UnaryServerInterceptor(t *testing.T) {
+	resolver, err := clientip.NewResolver([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 443}})
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-forwarded-for", "203.0.113.7"))
+
+	var ip string
+	_, err = resolver.UnaryServerInterceptor()(ctx, nil, &grpc.UnaryServerInfo{},
+		func(ctx context.Context, _ interface{}) (interface{}, error) {
+			ip = clientip.FromContext(ctx)
+			return nil, nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.7", ip)
+
+	// Without the interceptor, forwarded hops are not believed
+	assert.Equal(t, "10.0.0.2", clientip.FromContext(ctx))
+}
@@ -14,6 +14,9 @@ import (
 	"github.com/knadh/koanf/providers/file"
 	"github.com/knadh/koanf/providers/structs"
 	"github.com/knadh/koanf/v2"
+
+	"github.com/narwhalmedia/narwhal/pkg/clientip"
+	"github.com/narwhalmedia/narwhal/pkg/loadshed"
 )
 
 // Config is the interface that all service configs must implement.
@@ -31,6 +34,19 @@ type BaseConfig struct {
 	Tracing    TracingConfig    `koanf:"tracing"`
 	Auth       AuthConfig       `koanf:"auth"`
 	Pagination PaginationConfig `koanf:"pagination"`
+	Events     EventsConfig     `koanf:"events"`
+	Storage    StorageConfig    `koanf:"storage"`
+	// Secrets configures the master key secrets stored in the database,
+	// such as provider API keys, are encrypted with.
+	Secrets SecretsConfig `koanf:"secrets"`
+	// CDN configures serving stream segments through a CDN.
+	CDN CDNConfig `koanf:"cdn"`
+	// Diagnostics configures the pprof, trace and expvar endpoints.
+	Diagnostics DiagnosticsConfig `koanf:"diagnostics"`
+	Plugins     PluginsConfig     `koanf:"plugins"`
+	// LoadShedding configures rejecting low-priority calls while the
+	// service is saturated.
+	LoadShedding LoadSheddingConfig `koanf:"load_shedding"`
 }
 
 // ServiceConfig contains service-specific metadata.
@@ -40,6 +56,22 @@ type ServiceConfig struct {
 	Environment string `koanf:"environment"` // dev, staging, production
 	Port        int    `koanf:"port"`
 	GRPCPort    int    `koanf:"grpc_port"`
+	// PublicMethods are full gRPC method names callable without a token,
+	// in addition to those of DefaultPublicMethods.
+	PublicMethods []string `koanf:"public_methods"`
+	// RequestTimeout bounds how long unary gRPC calls run. MethodTimeouts
+	// overrides it per full method name, on top of the longer defaults of
+	// methods that copy files or call providers; zero disables a timeout.
+	RequestTimeout time.Duration            `koanf:"request_timeout"`
+	MethodTimeouts map[string]time.Duration `koanf:"method_timeouts"`
+	// EnforceAPISunset rejects calls to deprecated API versions past their
+	// sunset, rather than only flagging them as deprecated.
+	EnforceAPISunset bool `koanf:"enforce_api_sunset"`
+	// TrustedProxies are the CIDRs or addresses of the load balancers and
+	// gateways in front of the service. Client IPs are only taken from the
+	// X-Forwarded-For hops they add; without any, the client IP is the peer
+	// address.
+	TrustedProxies []string `koanf:"trusted_proxies"`
 }
 
 // AuthConfig contains authentication configuration shared across services.
@@ -50,6 +82,27 @@ type AuthConfig struct {
 	RBACType             string        `koanf:"rbac_type"` // "builtin" or "casbin"
 	RBACModelPath        string        `koanf:"rbac_model_path"`
 	RBACPolicyPath       string        `koanf:"rbac_policy_path"`
+
+	// OIDCProviders are the OpenID Connect providers users can log in with
+	// besides their password, such as Keycloak, Authelia or Google.
+	OIDCProviders []OIDCProviderConfig `koanf:"oidc_providers"`
+}
+
+// OIDCProviderConfig defines an OpenID Connect provider. Clients sign users
+// in with the provider and exchange the ID token they get for tokens of
+// their own.
+type OIDCProviderConfig struct {
+	Name      string `koanf:"name"` // passed by clients exchanging tokens
+	IssuerURL string `koanf:"issuer_url"`
+	ClientID  string `koanf:"client_id"` // the audience of ID tokens
+	// RoleClaim is the claim holding the groups or roles of users, such as
+	// "groups" or Keycloak's "realm_access.roles". With a claim, roles are
+	// synced from RoleMapping on every login.
+	RoleClaim   string            `koanf:"role_claim"`
+	RoleMapping map[string]string `koanf:"role_mapping"` // claim value to role name
+	// DefaultRole is the role of users no claim value maps to a role.
+	// Without one, those users cannot log in.
+	DefaultRole string `koanf:"default_role"`
 }
 
 // PaginationConfig contains pagination configuration.
@@ -60,6 +113,141 @@ type PaginationConfig struct {
 	CursorExpiration    time.Duration `koanf:"cursor_expiration"`
 }
 
+// EventsConfig contains event bus delivery settings.
+type EventsConfig struct {
+	// MaxDeliveryAttempts is how often a handler is tried before the event
+	// is dead-lettered.
+	MaxDeliveryAttempts int `koanf:"max_delivery_attempts"`
+	// DeadLetterAlertThreshold is the dead-letter queue depth above which an
+	// alert is raised. Zero disables the alert.
+	DeadLetterAlertThreshold int `koanf:"dead_letter_alert_threshold"`
+}
+
+// DiagnosticsConfig contains the settings of the runtime diagnostics
+// endpoints served under /debug/ on the HTTP port.
+type DiagnosticsConfig struct {
+	Enabled bool `koanf:"enabled"`
+	// LocalhostOnly serves the endpoints to loopback clients without a
+	// token. Otherwise callers need an admin access token. Requests a
+	// reverse proxy forwarded are only local if the proxy is listed in
+	// Service.TrustedProxies and forwarded them for a loopback client.
+	LocalhostOnly bool `koanf:"localhost_only"`
+}
+
+// LoadSheddingConfig contains the limits past which a service is
+// saturated. Low-priority calls, such as scans and reports, are shed once
+// a limit is reached, and normal ones at twice a limit; playback and
+// authentication are never shed. A zero limit ignores its signal.
+type LoadSheddingConfig struct {
+	Enabled bool `koanf:"enabled"`
+	// Interval is how often the load is sampled.
+	Interval time.Duration `koanf:"interval"`
+	// MaxDBWait is the average wait for a database connection.
+	MaxDBWait     time.Duration `koanf:"max_db_wait"`
+	MaxGoroutines int           `koanf:"max_goroutines"`
+	// MaxIOPressure is the percentage of time tasks stall on IO, read from
+	// /proc/pressure/io where available.
+	MaxIOPressure float64 `koanf:"max_io_pressure"`
+	// RetryAfter is sent to shed calls as the retry-after header.
+	RetryAfter time.Duration `koanf:"retry_after"`
+	// MethodPriorities overrides the priority of full method names with
+	// "low", "normal" or "critical".
+	MethodPriorities map[string]string `koanf:"method_priorities"`
+}
+
+// PluginsConfig contains the sidecar plugins a service starts. Plugins are
+// executables serving the narwhal.plugin.v1 gRPC services.
+type PluginsConfig struct {
+	// StartTimeout is how long a plugin may take to start and complete the
+	// handshake.
+	StartTimeout time.Duration  `koanf:"start_timeout"`
+	Sidecars     []PluginConfig `koanf:"sidecars"`
+}
+
+// PluginConfig defines a sidecar plugin.
+type PluginConfig struct {
+	Name    string            `koanf:"name"`
+	Command string            `koanf:"command"` // absolute path of the plugin executable
+	Args    []string          `koanf:"args"`
+	Env     map[string]string `koanf:"env"` // added to the plugin's environment, such as API keys
+	Enabled bool              `koanf:"enabled"`
+}
+
+// StorageConfig contains the settings of the shared asset store, which
+// holds avatars, artwork and theme music.
+type StorageConfig struct {
+	Backend   string   `koanf:"backend"` // "local" or "s3"
+	LocalPath string   `koanf:"local_path"`
+	BaseURL   string   `koanf:"base_url"` // public URL assets are served from
+	S3        S3Config `koanf:"s3"`
+	// GCInterval is how often unreferenced assets are collected. Zero
+	// disables collection.
+	GCInterval time.Duration `koanf:"gc_interval"`
+	// GCGracePeriod is how long an asset stays unreferenced before it is
+	// collected.
+	GCGracePeriod time.Duration `koanf:"gc_grace_period"`
+}
+
+// S3Config contains the settings of an S3 compatible bucket.
+type S3Config struct {
+	Endpoint        string `koanf:"endpoint"`
+	Region          string `koanf:"region"`
+	Bucket          string `koanf:"bucket"`
+	AccessKeyID     string `koanf:"access_key_id"`
+	SecretAccessKey string `koanf:"secret_access_key"`
+}
+
+// CDNConfig contains the settings of the CDN stream segments are served
+// through. Players fetch segments from signed CDN URLs; edges either pull
+// them from the origin endpoint of the stream service or, in push mode,
+// from the asset store segments are uploaded to.
+type CDNConfig struct {
+	Enabled  bool   `koanf:"enabled"`
+	Provider string `koanf:"provider"` // "cloudfront" or "akamai"
+	BaseURL  string `koanf:"base_url"` // URL of the CDN distribution
+	Mode     string `koanf:"mode"`     // "pull" or "push"
+	// TokenTTL is how long signed segment URLs are valid.
+	TokenTTL time.Duration `koanf:"token_ttl"`
+	// OriginSecret is the secret edges send in the X-Origin-Secret header
+	// when pulling from the origin endpoint.
+	OriginSecret string           `koanf:"origin_secret"`
+	CloudFront   CloudFrontConfig `koanf:"cloudfront"`
+	Akamai       AkamaiConfig     `koanf:"akamai"`
+}
+
+// CloudFrontConfig contains the key pair URLs are signed with and the
+// credentials invalidations are created with.
+type CloudFrontConfig struct {
+	KeyPairID       string `koanf:"key_pair_id"`
+	PrivateKeyPath  string `koanf:"private_key_path"` // PEM encoded RSA key
+	DistributionID  string `koanf:"distribution_id"`
+	AccessKeyID     string `koanf:"access_key_id"`
+	SecretAccessKey string `koanf:"secret_access_key"`
+}
+
+// AkamaiConfig contains the token key URLs are signed with and the API
+// client credentials purges are requested with.
+type AkamaiConfig struct {
+	TokenKey     string `koanf:"token_key"`  // hex encoded
+	TokenName    string `koanf:"token_name"` // query parameter of tokens, hdnts by default
+	Host         string `koanf:"host"`
+	ClientToken  string `koanf:"client_token"`
+	ClientSecret string `koanf:"client_secret"`
+	AccessToken  string `koanf:"access_token"`
+}
+
+// SecretsConfig contains the master key credentials are encrypted with at
+// rest. To rotate the key, set a new one and list the old one under
+// PreviousEncryptionKeys until stored values have been re-encrypted.
+type SecretsConfig struct {
+	EncryptionKey string `koanf:"encryption_key"`
+	// EncryptionKeyFile is a file holding the key, as written by secret
+	// managers such as Docker and Kubernetes secrets or a Vault agent. It
+	// takes precedence over EncryptionKey.
+	EncryptionKeyFile      string   `koanf:"encryption_key_file"`
+	PreviousEncryptionKeys []string `koanf:"previous_encryption_keys"`
+}
+
 // DatabaseConfig contains database connection settings.
 type DatabaseConfig struct {
 	Host            string        `koanf:"host"`
@@ -269,6 +457,25 @@ func (c *BaseConfig) Validate() error {
 	if c.Service.Port <= 0 || c.Service.Port > 65535 {
 		return fmt.Errorf("invalid service port: %d", c.Service.Port)
 	}
+	for _, method := range c.Service.PublicMethods {
+		if !strings.HasPrefix(method, "/") || strings.Count(method, "/") != 2 {
+			return fmt.Errorf("invalid public method %q: expected /package.Service/Method", method)
+		}
+	}
+	if c.Service.RequestTimeout < 0 {
+		return errors.New("request timeout cannot be negative")
+	}
+	for method, timeout := range c.Service.MethodTimeouts {
+		if !strings.HasPrefix(method, "/") || strings.Count(method, "/") != 2 {
+			return fmt.Errorf("invalid timeout method %q: expected /package.Service/Method", method)
+		}
+		if timeout < 0 {
+			return fmt.Errorf("timeout of %s cannot be negative", method)
+		}
+	}
+	if _, err := clientip.NewResolver(c.Service.TrustedProxies); err != nil {
+		return err
+	}
 	if c.Database.Host == "" {
 		return errors.New("database host is required")
 	}
@@ -281,6 +488,120 @@ func (c *BaseConfig) Validate() error {
 	if c.Auth.AccessTokenDuration < time.Minute {
 		return errors.New("access token duration must be at least 1 minute")
 	}
+	providers := make(map[string]bool, len(c.Auth.OIDCProviders))
+	for _, provider := range c.Auth.OIDCProviders {
+		if provider.Name == "" {
+			return errors.New("OIDC provider name is required")
+		}
+		if providers[provider.Name] {
+			return fmt.Errorf("duplicate OIDC provider %s", provider.Name)
+		}
+		providers[provider.Name] = true
+		if provider.IssuerURL == "" || provider.ClientID == "" {
+			return fmt.Errorf("issuer URL and client ID of OIDC provider %s are required", provider.Name)
+		}
+	}
+	if c.Events.MaxDeliveryAttempts < 1 {
+		return errors.New("events max delivery attempts must be at least 1")
+	}
+	if c.Events.DeadLetterAlertThreshold < 0 {
+		return errors.New("dead-letter alert threshold cannot be negative")
+	}
+	switch c.Storage.Backend {
+	case "local":
+		if c.Storage.LocalPath == "" {
+			return errors.New("storage local path is required")
+		}
+	case "s3":
+		if c.Storage.S3.Endpoint == "" || c.Storage.S3.Region == "" || c.Storage.S3.Bucket == "" {
+			return errors.New("storage s3 endpoint, region and bucket are required")
+		}
+	default:
+		return fmt.Errorf("unknown storage backend %q", c.Storage.Backend)
+	}
+	if c.Storage.GCInterval < 0 || c.Storage.GCGracePeriod < 0 {
+		return errors.New("storage garbage collection settings cannot be negative")
+	}
+	if err := c.CDN.validate(c.Storage); err != nil {
+		return err
+	}
+	if err := c.LoadShedding.validate(); err != nil {
+		return err
+	}
+	if c.Plugins.StartTimeout < 0 {
+		return errors.New("plugin start timeout cannot be negative")
+	}
+	plugins := make(map[string]bool, len(c.Plugins.Sidecars))
+	for _, plugin := range c.Plugins.Sidecars {
+		if plugin.Name == "" {
+			return errors.New("plugin name is required")
+		}
+		if plugins[plugin.Name] {
+			return fmt.Errorf("duplicate plugin %s", plugin.Name)
+		}
+		plugins[plugin.Name] = true
+		if !filepath.IsAbs(plugin.Command) {
+			return fmt.Errorf("command of plugin %s must be an absolute path", plugin.Name)
+		}
+	}
+	return nil
+}
+
+func (c CDNConfig) validate(storage StorageConfig) error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.BaseURL == "" {
+		return errors.New("cdn base URL is required")
+	}
+	if c.TokenTTL < time.Minute {
+		return errors.New("cdn token TTL must be at least 1 minute")
+	}
+	switch c.Provider {
+	case "cloudfront":
+		if c.CloudFront.KeyPairID == "" || c.CloudFront.PrivateKeyPath == "" {
+			return errors.New("cloudfront key pair ID and private key path are required")
+		}
+	case "akamai":
+		if c.Akamai.TokenKey == "" {
+			return errors.New("akamai token key is required")
+		}
+	default:
+		return fmt.Errorf("unknown cdn provider %q", c.Provider)
+	}
+	switch c.Mode {
+	case "pull":
+		if c.OriginSecret == "" {
+			return errors.New("cdn pull mode requires an origin secret")
+		}
+	case "push":
+		if storage.Backend != "s3" {
+			return errors.New("cdn push mode requires the s3 storage backend")
+		}
+	default:
+		return fmt.Errorf("unknown cdn mode %q", c.Mode)
+	}
+	return nil
+}
+
+func (c LoadSheddingConfig) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Interval <= 0 {
+		return errors.New("load shedding interval must be positive")
+	}
+	if c.MaxDBWait < 0 || c.MaxGoroutines < 0 || c.MaxIOPressure < 0 || c.RetryAfter < 0 {
+		return errors.New("load shedding limits cannot be negative")
+	}
+	for method, name := range c.MethodPriorities {
+		if !strings.HasPrefix(method, "/") || strings.Count(method, "/") != 2 {
+			return fmt.Errorf("invalid load shedding method %q: expected /package.Service/Method", method)
+		}
+		if _, err := loadshed.ParsePriority(name); err != nil {
+			return fmt.Errorf("load shedding priority of %s: %w", method, err)
+		}
+	}
 	return nil
 }
 
@@ -288,9 +609,10 @@ func (c *BaseConfig) Validate() error {
 func GetDefaults() *BaseConfig {
 	return &BaseConfig{
 		Service: ServiceConfig{
-			Environment: "dev",
-			Port:        DefaultHTTPPort,
-			GRPCPort:    DefaultGRPCPort,
+			Environment:    "dev",
+			Port:           DefaultHTTPPort,
+			GRPCPort:       DefaultGRPCPort,
+			RequestTimeout: DefaultRequestTimeout,
 		},
 		Database: DatabaseConfig{
 			Host:            "localhost",
@@ -347,5 +669,36 @@ func GetDefaults() *BaseConfig {
 			DefaultPageSize:     50,
 			CursorExpiration:    24 * time.Hour,
 		},
+		Events: EventsConfig{
+			MaxDeliveryAttempts:      DefaultMaxDeliveryAttempts,
+			DeadLetterAlertThreshold: DefaultDeadLetterAlertThreshold,
+		},
+		Storage: StorageConfig{
+			Backend:       "local",
+			LocalPath:     "/tmp/narwhal/assets",
+			BaseURL:       "http://localhost:8080/assets",
+			GCInterval:    DefaultAssetGCInterval,
+			GCGracePeriod: DefaultAssetGCGracePeriod,
+		},
+		CDN: CDNConfig{
+			Provider: "cloudfront",
+			Mode:     "pull",
+			TokenTTL: DefaultCDNTokenTTL,
+		},
+		Diagnostics: DiagnosticsConfig{
+			Enabled:       false,
+			LocalhostOnly: true,
+		},
+		Plugins: PluginsConfig{
+			StartTimeout: DefaultPluginStartTimeout,
+		},
+		LoadShedding: LoadSheddingConfig{
+			Enabled:       true,
+			Interval:      DefaultLoadSheddingInterval,
+			MaxDBWait:     DefaultLoadSheddingMaxDBWait,
+			MaxGoroutines: DefaultLoadSheddingMaxGoroutines,
+			MaxIOPressure: DefaultLoadSheddingMaxIOPressure,
+			RetryAfter:    DefaultLoadSheddingRetryAfter,
+		},
 	}
 }
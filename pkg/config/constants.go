@@ -24,6 +24,9 @@ const (
 	DefaultReadTimeout     = 3 * time.Second
 	DefaultWriteTimeout    = 3 * time.Second
 
+	// DefaultRequestTimeout bounds unary gRPC calls.
+	DefaultRequestTimeout = 30 * time.Second
+
 	// Telemetry defaults.
 	DefaultTelemetryPort     = 2112
 	DefaultTelemetryInterval = 10
@@ -31,4 +34,75 @@ const (
 	// Auth defaults.
 	DefaultAccessTokenDuration = 15 * time.Minute
 	DefaultSamplingRate        = 0.1
+
+	// Event delivery defaults.
+	DefaultMaxDeliveryAttempts      = 3
+	DefaultDeadLetterAlertThreshold = 100
+
+	// Asset store defaults.
+	DefaultAssetGCInterval    = time.Hour
+	DefaultAssetGCGracePeriod = 24 * time.Hour
+
+	// CDN defaults.
+	DefaultCDNTokenTTL = 6 * time.Hour
+
+	// Plugin defaults.
+	DefaultPluginStartTimeout = 10 * time.Second
+
+	// Load shedding defaults.
+	DefaultLoadSheddingInterval      = 2 * time.Second
+	DefaultLoadSheddingMaxDBWait     = 250 * time.Millisecond
+	DefaultLoadSheddingMaxGoroutines = 10000
+	DefaultLoadSheddingMaxIOPressure = 60
+	DefaultLoadSheddingRetryAfter    = 5 * time.Second
+
+	// Download client defaults.
+	DefaultDownloadPollInterval = 30 * time.Second
+	DefaultFeedPollInterval     = 15 * time.Minute
+
+	// Indexer and download client health defaults.
+	DefaultHealthFailureThreshold  = 5
+	DefaultHealthRetestInterval    = time.Minute
+	DefaultHealthMaxRetestInterval = time.Hour
+
+	// Playback issue defaults.
+	DefaultPlaybackErrorRate   = 0.2
+	DefaultPlaybackMinSessions = 10
+	DefaultPlaybackIssueWindow = 30 * 24 * time.Hour
+
+	// Share link defaults.
+	DefaultShareLinkMaxTTL = 30 * 24 * time.Hour
+	DefaultShareMaxBitrate = 4000 // kbps
+	DefaultShareStreamTTL  = 4 * time.Hour
+
+	// Kiosk defaults.
+	DefaultKioskTokenTTL        = 12 * time.Hour
+	DefaultKioskRefreshInterval = 15 * time.Second
+
+	// Content request defaults. Quotas count the requests of the last
+	// week.
+	DefaultRequestQuotaPeriod = 7 * 24 * time.Hour
+
+	// Pruning defaults. Titles nobody watched for half a year are
+	// suggested, and disks with less than a tenth free are under pressure.
+	DefaultPruneUnwatchedAfter = 180 * 24 * time.Hour
+	DefaultPruneMinFreeSpace   = 0.1
+	DefaultPruneAdviceInterval = 24 * time.Hour
+
+	// Transcode priority defaults.
+	DefaultTranscodePriorityInterval = 15 * time.Minute
+	DefaultTranscodePriorityWindow   = 14 * 24 * time.Hour
+	DefaultTranscodeBackCatalogAge   = 365 * 24 * time.Hour
+	DefaultTranscodePopularGenres    = 5
+
+	// DefaultAniListURL is the AniList GraphQL API.
+	DefaultAniListURL = "https://graphql.anilist.co"
+
+	// Music video metadata APIs.
+	DefaultIMVDbURL   = "https://imvdb.com/api/v1"
+	DefaultAudioDBURL = "https://www.theaudiodb.com/api/v1/json"
+
+	// Malware scanning defaults.
+	DefaultClamdAddress       = "/var/run/clamav/clamd.ctl"
+	DefaultMalwareScanTimeout = 5 * time.Minute
 )
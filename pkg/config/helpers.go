@@ -1,12 +1,24 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/knadh/koanf/providers/structs"
+	"github.com/knadh/koanf/v2"
 	"gorm.io/gorm/logger"
 
+	"github.com/narwhalmedia/narwhal/pkg/cdn"
 	"github.com/narwhalmedia/narwhal/pkg/database"
+	"github.com/narwhalmedia/narwhal/pkg/encryption"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/loadshed"
+	"github.com/narwhalmedia/narwhal/pkg/retry"
+	"github.com/narwhalmedia/narwhal/pkg/storage"
 )
 
 // LoadServiceConfig is a generic helper to load service configuration.
@@ -37,6 +49,111 @@ func (c DatabaseConfig) ToDatabaseConfig() *database.PostgresConfig {
 	}
 }
 
+// ErrNoEncryptionKey is returned by NewEncryptor when no master key is
+// configured.
+var ErrNoEncryptionKey = errors.New("no encryption key configured")
+
+// NewEncryptor creates the encryptor of the configured master key and the
+// keys it replaced.
+func (c SecretsConfig) NewEncryptor() (*encryption.Encryptor, error) {
+	key := c.EncryptionKey
+	if c.EncryptionKeyFile != "" {
+		data, err := os.ReadFile(c.EncryptionKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read encryption key file: %w", err)
+		}
+		key = strings.TrimSpace(string(data))
+	}
+	if key == "" {
+		return nil, ErrNoEncryptionKey
+	}
+	return encryption.NewEncryptor(key, c.PreviousEncryptionKeys...)
+}
+
+// NewShedder creates the load shedder of the configured limits.
+func (c LoadSheddingConfig) NewShedder(logger interfaces.Logger) (*loadshed.Shedder, error) {
+	priorities := make(map[string]loadshed.Priority, len(c.MethodPriorities))
+	for method, name := range c.MethodPriorities {
+		p, err := loadshed.ParsePriority(name)
+		if err != nil {
+			return nil, fmt.Errorf("load shedding priority of %s: %w", method, err)
+		}
+		priorities[method] = p
+	}
+	limits := loadshed.Limits{
+		MaxDBWait:     c.MaxDBWait,
+		MaxGoroutines: c.MaxGoroutines,
+		MaxIOPressure: c.MaxIOPressure,
+	}
+	return loadshed.New(limits, priorities, c.RetryAfter, logger), nil
+}
+
+// NewObjectStore creates the object store of the configured backend.
+func (c StorageConfig) NewObjectStore() (interfaces.ObjectStore, error) {
+	if c.Backend == "s3" {
+		return storage.NewS3Store(storage.S3Config{
+			Endpoint:        c.S3.Endpoint,
+			Region:          c.S3.Region,
+			Bucket:          c.S3.Bucket,
+			AccessKeyID:     c.S3.AccessKeyID,
+			SecretAccessKey: c.S3.SecretAccessKey,
+		}, c.BaseURL, &http.Client{Timeout: time.Minute})
+	}
+	return storage.NewLocalStore(c.LocalPath, c.BaseURL)
+}
+
+// Policy returns the retry policy of the configuration.
+func (c RetryConfig) Policy() retry.Policy {
+	retryOn := make([]retry.Reason, len(c.RetryOn))
+	for i, reason := range c.RetryOn {
+		retryOn[i] = retry.Reason(reason)
+	}
+	return retry.Policy{
+		MaxAttempts:  c.MaxAttempts,
+		InitialDelay: c.InitialDelay,
+		MaxDelay:     c.MaxDelay,
+		Multiplier:   c.Multiplier,
+		RetryOn:      retryOn,
+	}
+}
+
+// NewSigner creates the URL signer of the configured CDN provider.
+func (c CDNConfig) NewSigner() (cdn.Signer, error) {
+	if c.Provider == "akamai" {
+		return cdn.NewAkamaiSigner(c.Akamai.TokenKey, c.Akamai.TokenName)
+	}
+	key, err := os.ReadFile(c.CloudFront.PrivateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cloudfront private key: %w", err)
+	}
+	return cdn.NewCloudFrontSigner(c.CloudFront.KeyPairID, key)
+}
+
+// NewInvalidator creates the invalidator of the configured CDN provider, or
+// nil if it has no API credentials.
+func (c CDNConfig) NewInvalidator() (cdn.Invalidator, error) {
+	client := &http.Client{Timeout: time.Minute}
+	if c.Provider == "akamai" {
+		if c.Akamai.Host == "" {
+			return nil, nil
+		}
+		return cdn.NewAkamaiInvalidator(cdn.EdgeGridCredentials{
+			Host:         c.Akamai.Host,
+			ClientToken:  c.Akamai.ClientToken,
+			ClientSecret: c.Akamai.ClientSecret,
+			AccessToken:  c.Akamai.AccessToken,
+		}, client)
+	}
+	if c.CloudFront.DistributionID == "" {
+		return nil, nil
+	}
+	return cdn.NewCloudFrontInvalidator(cdn.CloudFrontConfig{
+		DistributionID:  c.CloudFront.DistributionID,
+		AccessKeyID:     c.CloudFront.AccessKeyID,
+		SecretAccessKey: c.CloudFront.SecretAccessKey,
+	}, client)
+}
+
 // GetServiceVersion returns the service version from config or git.
 func GetServiceVersion(cfg *ServiceConfig) string {
 	if cfg.Version != "" {
@@ -72,6 +189,50 @@ func GetGRPCListenAddress(cfg *ServiceConfig) string {
 	return fmt.Sprintf(":%d", cfg.GRPCPort)
 }
 
+// DefaultPublicMethods returns the gRPC methods a service always serves
+// without a token: health checks and the calls of clients that have no
+// token yet.
+func DefaultPublicMethods(serviceName string) []string {
+	methods := []string{
+		"/grpc.health.v1.Health/Check",
+		"/grpc.health.v1.Health/Watch",
+	}
+	switch serviceName {
+	case "user":
+		methods = append(methods,
+			"/narwhal.auth.v1.AuthService/Login",
+			"/narwhal.auth.v1.AuthService/RefreshToken",
+			"/narwhal.auth.v1.AuthService/CreateUser", // First user creation
+			"/narwhal.auth.v1.AuthService/RedeemInvite",
+			"/narwhal.auth.v1.AuthService/Register",
+			"/narwhal.auth.v1.AuthService/VerifyEmail",
+			"/narwhal.auth.v1.AuthService/VerifyLogin",
+			"/narwhal.auth.v1.AuthService/ExchangeOIDCToken",
+			"/grpc.reflection.v1.ServerReflection/ServerReflectionInfo",
+		)
+	case "library":
+		methods = append(methods,
+			"/narwhal.library.v1.LibraryService/RedeemShareLink", // Guests have no account
+			"/narwhal.library.v1.KioskService/RedeemKioskKey",    // Kiosks have no account
+		)
+	}
+	return methods
+}
+
+// GetPublicMethods returns the set of gRPC methods that skip authentication:
+// the defaults of the service and the configured ones, which add to them.
+func GetPublicMethods(cfg *ServiceConfig) map[string]bool {
+	defaults := DefaultPublicMethods(cfg.Name)
+	methods := make(map[string]bool, len(defaults)+len(cfg.PublicMethods))
+	for _, method := range defaults {
+		methods[method] = true
+	}
+	for _, method := range cfg.PublicMethods {
+		methods[method] = true
+	}
+	return methods
+}
+
 // MustLoadServiceConfig loads config and panics on error (for main functions).
 func MustLoadServiceConfig[T Config](serviceName string, cfg T) T {
 	if err := LoadServiceConfig(serviceName, cfg); err != nil {
@@ -84,3 +245,87 @@ func MustLoadServiceConfig[T Config](serviceName string, cfg T) T {
 func PrintConfig(cfg Config) {
 	fmt.Printf("Loaded configuration:\n%+v\n", cfg)
 }
+
+// Redacted returns the configuration as a nested map keyed like config
+// files, with passwords, secrets and keys replaced so it can be shared in
+// bug reports.
+func Redacted(cfg Config) (map[string]interface{}, error) {
+	k := koanf.New(".")
+	if err := k.Load(structs.Provider(cfg, "koanf"), nil); err != nil {
+		return nil, err
+	}
+
+	for _, key := range k.Keys() {
+		name := key[strings.LastIndex(key, ".")+1:]
+		if !isSecretKey(name) || k.String(key) == "" {
+			continue
+		}
+		if err := k.Set(key, "REDACTED"); err != nil {
+			return nil, err
+		}
+	}
+
+	// The struct provider nests the embedded BaseConfig instead of
+	// squashing it into the top level like config files do
+	raw := k.Raw()
+	if base, ok := raw["BaseConfig"].(map[string]interface{}); ok {
+		delete(raw, "BaseConfig")
+		for key, value := range base {
+			raw[key] = value
+		}
+	}
+	redactPluginEnv(raw)
+	redactListItems(raw)
+	return raw, nil
+}
+
+// redactPluginEnv redacts the environment given to plugins, which often
+// holds API keys. Keys of list items are not flattened, so the loop over
+// keys in Redacted does not reach it.
+func redactPluginEnv(raw map[string]interface{}) {
+	plugins, _ := raw["plugins"].(map[string]interface{})
+	sidecars, _ := plugins["sidecars"].([]interface{})
+	for _, sidecar := range sidecars {
+		fields, ok := sidecar.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		env, _ := fields["env"].(map[string]string)
+		redacted := make(map[string]string, len(env))
+		for name := range env {
+			redacted[name] = "REDACTED"
+		}
+		fields["env"] = redacted
+	}
+}
+
+// redactListItems redacts secrets in the items of lists, such as the
+// passwords of download clients, which the loop over keys in Redacted does
+// not reach either.
+func redactListItems(raw map[string]interface{}) {
+	for _, value := range raw {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			redactListItems(v)
+		case []interface{}:
+			for _, item := range v {
+				fields, ok := item.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				for name, field := range fields {
+					if s, ok := field.(string); ok && s != "" && isSecretKey(name) {
+						fields[name] = "REDACTED"
+					}
+				}
+			}
+		}
+	}
+}
+
+func isSecretKey(name string) bool {
+	return strings.Contains(name, "secret") ||
+		strings.Contains(name, "password") ||
+		strings.HasSuffix(name, "_key") ||
+		strings.HasSuffix(name, "_token")
+}
@@ -0,0 +1,23 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/narwhalmedia/narwhal/pkg/config"
+)
+
+func TestGetPublicMethods(t *testing.T) {
+	cfg := config.GetDefaultUserConfig()
+	assert.True(t, config.GetPublicMethods(&cfg.Service)["/narwhal.auth.v1.AuthService/Login"])
+
+	// Configured methods add to the defaults instead of replacing them
+	cfg.Service.PublicMethods = []string{"/narwhal.auth.v1.AuthService/GetUser"}
+	methods := config.GetPublicMethods(&cfg.Service)
+	assert.True(t, methods["/narwhal.auth.v1.AuthService/GetUser"])
+	assert.True(t, methods["/narwhal.auth.v1.AuthService/Login"])
+	assert.True(t, methods["/narwhal.auth.v1.AuthService/Register"])
+	assert.True(t, methods["/grpc.health.v1.Health/Check"])
+	assert.False(t, methods["/narwhal.library.v1.LibraryService/RedeemShareLink"])
+}
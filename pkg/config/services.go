@@ -2,6 +2,8 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"path/filepath"
 	"time"
 )
 
@@ -10,16 +12,178 @@ type LibraryConfig struct {
 	BaseConfig `koanf:",squash"`
 
 	Library LibrarySettings `koanf:"library"`
+	Assets  AssetSettings   `koanf:"assets"`
 }
 
 // LibrarySettings contains library service specific settings.
 type LibrarySettings struct {
 	ScanInterval      time.Duration `koanf:"scan_interval"`
 	MaxConcurrentScan int           `koanf:"max_concurrent_scan"`
+	ScanWorkers       int           `koanf:"scan_workers"`    // files processed in parallel per scan
+	ScanBatchSize     int           `koanf:"scan_batch_size"` // media rows written per batch
 	FileExtensions    []string      `koanf:"file_extensions"`
 	IgnorePatterns    []string      `koanf:"ignore_patterns"`
 	ThumbnailSize     int           `koanf:"thumbnail_size"`
 	EnableAutoScan    bool          `koanf:"enable_auto_scan"`
+
+	// Finished workflows are archived once they are older than
+	// WorkflowRetention and are not among the WorkflowKeepPerMedia most
+	// recent of their media item. Zero disables either limit; a zero
+	// WorkflowArchiveInterval disables archival.
+	WorkflowRetention       time.Duration `koanf:"workflow_retention"`
+	WorkflowKeepPerMedia    int           `koanf:"workflow_keep_per_media"`
+	WorkflowArchiveInterval time.Duration `koanf:"workflow_archive_interval"`
+
+	// ImportMode is how workflow imports place downloaded files in a
+	// library: link, copy or move. ImportModes overrides it per download
+	// client, so torrents can be hardlinked to keep seeding while usenet
+	// downloads are moved.
+	ImportMode  string            `koanf:"import_mode"`
+	ImportModes map[string]string `koanf:"import_modes"`
+
+	// Imports of items that have a file replace it automatically if
+	// AutoReplace is set and the new file has a better quality, a codec
+	// earlier in ReplacePreferredCodecs or a higher bitrate, without being
+	// over ReplaceMaxSizeRatio times larger; zero is unlimited. Replaced
+	// files are moved to RecycleBinPath, or a hidden directory of their
+	// library if it is empty.
+	AutoReplace            bool     `koanf:"auto_replace"`
+	ReplacePreferredCodecs []string `koanf:"replace_preferred_codecs"`
+	ReplaceMaxSizeRatio    float64  `koanf:"replace_max_size_ratio"`
+	RecycleBinPath         string   `koanf:"recycle_bin_path"`
+
+	// Completed downloads are scanned for malware before they are imported
+	// when MalwareScanner is set: "clamd" streams them to the ClamAV daemon
+	// at ClamdAddress, a socket path or tcp://host:port, and "command" runs
+	// MalwareScanCommand with MalwareScanArgs and the file path, which
+	// exits 1 for infected files. Each file must be scanned within
+	// MalwareScanTimeout. Infected files are moved to QuarantinePath, or a
+	// hidden directory next to the download if it is empty.
+	MalwareScanner     string        `koanf:"malware_scanner"`
+	ClamdAddress       string        `koanf:"clamd_address"`
+	MalwareScanCommand string        `koanf:"malware_scan_command"`
+	MalwareScanArgs    []string      `koanf:"malware_scan_args"`
+	MalwareScanTimeout time.Duration `koanf:"malware_scan_timeout"`
+	QuarantinePath     string        `koanf:"quarantine_path"`
+
+	// Hooks are scripts run on library events. Runs older than
+	// HookRunRetention are deleted; zero keeps them.
+	Hooks            []HookConfig  `koanf:"hooks"`
+	HookRunRetention time.Duration `koanf:"hook_run_retention"`
+
+	// RSS feeds are polled every FeedPollInterval and matching releases
+	// are handed to DownloadClients; zero disables polling. Feeds naming
+	// no client use DefaultDownloadClient.
+	FeedPollInterval      time.Duration          `koanf:"feed_poll_interval"`
+	DownloadClients       []DownloadClientConfig `koanf:"download_clients"`
+	DefaultDownloadClient string                 `koanf:"default_download_client"`
+
+	// Indexers and download clients failing HealthFailureThreshold times
+	// in a row are disabled and re-tested after HealthRetestInterval,
+	// doubling after every failed re-test up to HealthMaxRetestInterval.
+	// CriticalComponents names the indexers and download clients that run
+	// the component_down hooks when they are disabled.
+	HealthFailureThreshold  int           `koanf:"health_failure_threshold"`
+	HealthRetestInterval    time.Duration `koanf:"health_retest_interval"`
+	HealthMaxRetestInterval time.Duration `koanf:"health_max_retest_interval"`
+	CriticalComponents      []string      `koanf:"critical_components"`
+
+	// Media whose share of playback sessions reporting stalls or decode
+	// errors within PlaybackIssueWindow exceeds PlaybackErrorRate, over at
+	// least PlaybackMinSessions sessions, is flagged. Zero disables
+	// flagging.
+	PlaybackErrorRate   float64       `koanf:"playback_error_rate"`
+	PlaybackMinSessions int           `koanf:"playback_min_sessions"`
+	PlaybackIssueWindow time.Duration `koanf:"playback_issue_window"`
+
+	// Share links stay valid for at most ShareLinkMaxTTL and stream at most
+	// at ShareMaxBitrate kbps. Each play issues a stream token valid for
+	// ShareStreamTTL, which also bounds how long a play outlasts the
+	// revocation of its link.
+	ShareLinkMaxTTL time.Duration `koanf:"share_link_max_ttl"`
+	ShareMaxBitrate int           `koanf:"share_max_bitrate"`
+	ShareStreamTTL  time.Duration `koanf:"share_stream_ttl"`
+
+	// Kiosks redeem their key for tokens valid for KioskTokenTTL. Displays
+	// watching for changes get what is playing recomputed every
+	// KioskRefreshInterval, and new or deleted media right away.
+	KioskTokenTTL        time.Duration `koanf:"kiosk_token_ttl"`
+	KioskRefreshInterval time.Duration `koanf:"kiosk_refresh_interval"`
+
+	// Users may request as many movies and seasons within
+	// RequestQuotaPeriod as the most generous RequestQuotas of their roles
+	// allow; roles without a quota do not limit. Requests matching one of
+	// RequestAutoApprove are approved without an admin.
+	RequestQuotaPeriod time.Duration                 `koanf:"request_quota_period"`
+	RequestQuotas      map[string]RequestQuotaConfig `koanf:"request_quotas"`
+	RequestAutoApprove []RequestAutoApproveConfig    `koanf:"request_auto_approve"`
+
+	// Requested transcodes are re-prioritized every
+	// TranscodePriorityInterval; zero disables prioritization. Watchlisted
+	// media, the next episodes of shows watched within
+	// TranscodePriorityWindow and new media in the TranscodePopularGenres
+	// most watched genres are bumped. Media added longer than
+	// TranscodeBackCatalogAge ago that nobody watched is demoted.
+	TranscodePriorityInterval time.Duration `koanf:"transcode_priority_interval"`
+	TranscodePriorityWindow   time.Duration `koanf:"transcode_priority_window"`
+	TranscodeBackCatalogAge   time.Duration `koanf:"transcode_back_catalog_age"`
+	TranscodePopularGenres    int           `koanf:"transcode_popular_genres"`
+
+	// Titles nobody watched for PruneUnwatchedAfter are suggested for
+	// deletion, with the copies of titles kept in equal or better quality;
+	// zero only suggests copies. Every PruneAdviceInterval, libraries whose
+	// disk has less than PruneMinFreeSpace of its space free are reported
+	// with their suggestions; zero disables the advice.
+	PruneUnwatchedAfter time.Duration `koanf:"prune_unwatched_after"`
+	PruneMinFreeSpace   float64       `koanf:"prune_min_free_space"`
+	PruneAdviceInterval time.Duration `koanf:"prune_advice_interval"`
+
+	// AniListURL is the AniList GraphQL API anime libraries fetch metadata
+	// from; empty disables the provider.
+	AniListURL string `koanf:"anilist_url"`
+
+	// Music video libraries fetch metadata from IMVDb and TheAudioDB; each
+	// provider is disabled without an API key.
+	IMVDbURL      string `koanf:"imvdb_url"`
+	IMVDbAPIKey   string `koanf:"imvdb_api_key"`
+	AudioDBURL    string `koanf:"audiodb_url"`
+	AudioDBAPIKey string `koanf:"audiodb_api_key"`
+}
+
+// HookConfig defines a script run on a library event with the event as JSON
+// on stdin. Hooks can only be defined here; the API can enable and disable
+// them but not change what they run.
+type HookConfig struct {
+	Name      string        `koanf:"name"`
+	Point     string        `koanf:"point"`   // import, transcode_complete, delete, component_down or malware_detected
+	Command   string        `koanf:"command"` // absolute path of the script
+	Args      []string      `koanf:"args"`
+	Timeout   time.Duration `koanf:"timeout"`
+	MaxMemory int64         `koanf:"max_memory"` // address space in bytes; zero is unlimited
+	MaxCPU    time.Duration `koanf:"max_cpu"`    // CPU time; zero is unlimited
+	Enabled   bool          `koanf:"enabled"`
+}
+
+// RequestQuotaConfig limits the content requests of a role. A zero limit
+// is unlimited.
+type RequestQuotaConfig struct {
+	Movies  int `koanf:"movies"`
+	Seasons int `koanf:"seasons"`
+}
+
+// RequestAutoApproveConfig approves the content requests of a role right
+// away, optionally only of a media type or up to a quality.
+type RequestAutoApproveConfig struct {
+	Role       string `koanf:"role"`
+	MediaType  string `koanf:"media_type"`  // movie, series or empty for both
+	MaxQuality string `koanf:"max_quality"` // sd, 720p, 1080p, 2160p or empty for any
+}
+
+// AssetSettings contains settings for library assets such as theme music.
+// Assets are kept in the shared asset store.
+type AssetSettings struct {
+	MaxThemeBytes    int    `koanf:"max_theme_bytes"`
+	ThemeProviderURL string `koanf:"theme_provider_url"` // e.g. https://tvthemes.plexapp.com/{tvdb_id}.mp3; empty disables downloads
 }
 
 // Validate validates the library configuration.
@@ -33,14 +197,153 @@ func (c *LibraryConfig) Validate() error {
 	if c.Library.MaxConcurrentScan < 1 {
 		return errors.New("max concurrent scan must be at least 1")
 	}
-	return nil
+	if c.Library.ScanWorkers < 1 {
+		return errors.New("scan workers must be at least 1")
+	}
+	if c.Library.ScanBatchSize < 1 {
+		return errors.New("scan batch size must be at least 1")
+	}
+	if c.Assets.MaxThemeBytes < 1 {
+		return errors.New("max theme bytes must be at least 1")
+	}
+	if c.Library.WorkflowRetention < 0 || c.Library.WorkflowKeepPerMedia < 0 || c.Library.WorkflowArchiveInterval < 0 {
+		return errors.New("workflow retention settings cannot be negative")
+	}
+	for client, mode := range c.Library.ImportModes {
+		if !validImportMode(mode) {
+			return fmt.Errorf("invalid import mode %q for download client %s", mode, client)
+		}
+	}
+	if c.Library.ImportMode != "" && !validImportMode(c.Library.ImportMode) {
+		return fmt.Errorf("invalid import mode %q", c.Library.ImportMode)
+	}
+	if c.Library.ReplaceMaxSizeRatio < 0 {
+		return errors.New("replace max size ratio cannot be negative")
+	}
+	if c.Library.RecycleBinPath != "" && !filepath.IsAbs(c.Library.RecycleBinPath) {
+		return errors.New("recycle bin path must be absolute")
+	}
+	switch c.Library.MalwareScanner {
+	case "":
+	case "clamd":
+		if c.Library.ClamdAddress == "" {
+			return errors.New("clamd address is required")
+		}
+	case "command":
+		if !filepath.IsAbs(c.Library.MalwareScanCommand) {
+			return errors.New("malware scan command must be an absolute path")
+		}
+	default:
+		return fmt.Errorf("invalid malware scanner %q", c.Library.MalwareScanner)
+	}
+	if c.Library.MalwareScanTimeout < 0 {
+		return errors.New("malware scan timeout cannot be negative")
+	}
+	if c.Library.QuarantinePath != "" && !filepath.IsAbs(c.Library.QuarantinePath) {
+		return errors.New("quarantine path must be absolute")
+	}
+	if c.Library.HookRunRetention < 0 {
+		return errors.New("hook run retention cannot be negative")
+	}
+	names := make(map[string]bool, len(c.Library.Hooks))
+	for _, hook := range c.Library.Hooks {
+		if hook.Name == "" {
+			return errors.New("hook name is required")
+		}
+		if names[hook.Name] {
+			return fmt.Errorf("duplicate hook %s", hook.Name)
+		}
+		names[hook.Name] = true
+		switch hook.Point {
+		case "import", "transcode_complete", "delete", "component_down", "malware_detected":
+		default:
+			return fmt.Errorf("invalid point %q for hook %s", hook.Point, hook.Name)
+		}
+		if !filepath.IsAbs(hook.Command) {
+			return fmt.Errorf("command of hook %s must be an absolute path", hook.Name)
+		}
+		if hook.Timeout < 0 || hook.MaxMemory < 0 || hook.MaxCPU < 0 {
+			return fmt.Errorf("limits of hook %s cannot be negative", hook.Name)
+		}
+	}
+	if c.Library.FeedPollInterval < 0 {
+		return errors.New("feed poll interval cannot be negative")
+	}
+	if c.Library.HealthFailureThreshold < 1 {
+		return errors.New("health failure threshold must be at least 1")
+	}
+	if c.Library.HealthRetestInterval <= 0 || c.Library.HealthMaxRetestInterval < c.Library.HealthRetestInterval {
+		return errors.New("health retest interval must be positive and at most the max retest interval")
+	}
+	if c.Library.PlaybackErrorRate < 0 || c.Library.PlaybackErrorRate >= 1 {
+		return errors.New("playback error rate must be at least 0 and below 1")
+	}
+	if c.Library.PlaybackMinSessions < 1 {
+		return errors.New("playback min sessions must be at least 1")
+	}
+	if c.Library.PlaybackIssueWindow <= 0 {
+		return errors.New("playback issue window must be positive")
+	}
+	if c.Library.ShareLinkMaxTTL <= 0 || c.Library.ShareMaxBitrate <= 0 || c.Library.ShareStreamTTL <= 0 {
+		return errors.New("share link max TTL, max bitrate and stream TTL must be positive")
+	}
+	if c.Library.KioskTokenTTL <= 0 || c.Library.KioskRefreshInterval <= 0 {
+		return errors.New("kiosk token TTL and refresh interval must be positive")
+	}
+	if c.Library.RequestQuotaPeriod <= 0 {
+		return errors.New("request quota period must be positive")
+	}
+	for role, quota := range c.Library.RequestQuotas {
+		if quota.Movies < 0 || quota.Seasons < 0 {
+			return fmt.Errorf("request quota of role %s cannot be negative", role)
+		}
+	}
+	for _, rule := range c.Library.RequestAutoApprove {
+		if rule.Role == "" {
+			return errors.New("request auto-approve rules need a role")
+		}
+		switch rule.MediaType {
+		case "", "movie", "series":
+		default:
+			return fmt.Errorf("invalid media type %q in request auto-approve rule of role %s", rule.MediaType, rule.Role)
+		}
+		switch rule.MaxQuality {
+		case "", "sd", "720p", "1080p", "2160p":
+		default:
+			return fmt.Errorf("invalid max quality %q in request auto-approve rule of role %s", rule.MaxQuality, rule.Role)
+		}
+	}
+	if c.Library.PruneUnwatchedAfter < 0 || c.Library.PruneAdviceInterval < 0 {
+		return errors.New("prune unwatched period and advice interval cannot be negative")
+	}
+	if c.Library.PruneMinFreeSpace < 0 || c.Library.PruneMinFreeSpace >= 1 {
+		return errors.New("prune min free space must be between 0 and 1")
+	}
+	if c.Library.TranscodePriorityInterval < 0 || c.Library.TranscodeBackCatalogAge < 0 || c.Library.TranscodePopularGenres < 0 {
+		return errors.New("transcode priority interval, back catalog age and popular genres cannot be negative")
+	}
+	if c.Library.TranscodePriorityInterval > 0 && c.Library.TranscodePriorityWindow <= 0 {
+		return errors.New("transcode priority window must be positive")
+	}
+	return validateDownloadClients(c.Library.DownloadClients, c.Library.DefaultDownloadClient)
+}
+
+// validImportMode reports whether mode is a known import mode.
+func validImportMode(mode string) bool {
+	switch mode {
+	case "link", "copy", "move":
+		return true
+	}
+	return false
 }
 
 // UserConfig extends BaseConfig with user/auth-specific settings.
 type UserConfig struct {
 	BaseConfig `koanf:",squash"`
 
-	Auth AuthSettings `koanf:"auth"`
+	Auth   AuthSettings   `koanf:"auth"`
+	Mail   MailSettings   `koanf:"mail"`
+	Avatar AvatarSettings `koanf:"avatar"`
 }
 
 // AuthSettings contains authentication specific settings.
@@ -56,6 +359,52 @@ type AuthSettings struct {
 	RequireEmailVerify bool          `koanf:"require_email_verify"`
 	EnableOAuth        bool          `koanf:"enable_oauth"`
 	OAuthProviders     []string      `koanf:"oauth_providers"`
+
+	AllowRegistration     bool     `koanf:"allow_registration"`
+	RequireApproval       bool     `koanf:"require_approval"`
+	RegistrationRateLimit int      `koanf:"registration_rate_limit"` // registrations per IP per hour
+	BlockedEmailDomains   []string `koanf:"blocked_email_domains"`
+
+	ImpersonationTTL time.Duration `koanf:"impersonation_ttl"`
+
+	// SignInProtection is "off", "notify" to email users about sign-ins
+	// from new devices or places, or "verify" to also hold those logins
+	// until the user enters a code sent to them.
+	SignInProtection      string        `koanf:"sign_in_protection"`
+	ImpossibleTravelSpeed float64       `koanf:"impossible_travel_speed"` // km/h, 0 disables the check
+	GeoIPURL              string        `koanf:"geoip_url"`               // {ip} is replaced with the address
+	LoginChallengeTTL     time.Duration `koanf:"login_challenge_ttl"`
+
+	// TOTPIssuer is the name authenticator apps list two-factor secrets
+	// under.
+	TOTPIssuer string `koanf:"totp_issuer"`
+}
+
+// Sign-in protection modes.
+const (
+	SignInProtectionOff    = "off"
+	SignInProtectionNotify = "notify"
+	SignInProtectionVerify = "verify"
+)
+
+// MailSettings contains outgoing email settings.
+type MailSettings struct {
+	SMTPHost     string `koanf:"smtp_host"`
+	SMTPPort     int    `koanf:"smtp_port"`
+	SMTPUsername string `koanf:"smtp_username"`
+	SMTPPassword string `koanf:"smtp_password"`
+	From         string `koanf:"from"`
+	BaseURL      string `koanf:"base_url"` // used to build links in emails
+}
+
+// AvatarSettings contains avatar upload settings. Avatars are kept in the
+// shared asset store.
+type AvatarSettings struct {
+	// StoragePath is the directory avatars uploaded before the asset store
+	// were kept in; they are still served from /avatars/.
+	StoragePath string `koanf:"storage_path"`
+	MaxBytes    int    `koanf:"max_bytes"`
+	Size        int    `koanf:"size"` // width and height of stored avatars in pixels
 }
 
 // Validate validates the user configuration.
@@ -72,6 +421,26 @@ func (c *UserConfig) Validate() error {
 	if c.Auth.BCryptCost < 10 || c.Auth.BCryptCost > 31 {
 		return errors.New("bcrypt cost must be between 10 and 31")
 	}
+	if c.Auth.ImpersonationTTL < time.Minute || c.Auth.ImpersonationTTL > time.Hour {
+		return errors.New("impersonation TTL must be between 1 minute and 1 hour")
+	}
+	switch c.Auth.SignInProtection {
+	case SignInProtectionOff, SignInProtectionNotify, SignInProtectionVerify:
+	default:
+		return fmt.Errorf("invalid sign-in protection: %q", c.Auth.SignInProtection)
+	}
+	if c.Auth.ImpossibleTravelSpeed < 0 {
+		return errors.New("impossible travel speed must not be negative")
+	}
+	if c.Auth.LoginChallengeTTL < time.Minute || c.Auth.LoginChallengeTTL > time.Hour {
+		return errors.New("login challenge TTL must be between 1 minute and 1 hour")
+	}
+	if c.Auth.TOTPIssuer == "" {
+		return errors.New("TOTP issuer is required")
+	}
+	if c.Avatar.Size < 32 || c.Avatar.Size > 1024 {
+		return errors.New("avatar size must be between 32 and 1024")
+	}
 	return nil
 }
 
@@ -90,10 +459,39 @@ type StreamingSettings struct {
 	BufferSize           int                `koanf:"buffer_size"`
 	MaxConcurrentStreams int                `koanf:"max_concurrent_streams"`
 	CachePath            string             `koanf:"cache_path"`
-	CacheSize            int64              `koanf:"cache_size"` // in bytes
+	CacheSize            int64              `koanf:"cache_size"`        // disk tier of the segment cache, in bytes
+	MemoryCacheSize      int64              `koanf:"memory_cache_size"` // memory tier of the segment cache, in bytes
+	CacheTTL             time.Duration      `koanf:"cache_ttl"`
+	PrewarmSegments      int                `koanf:"prewarm_segments"` // segments fetched ahead of active sessions
 	EnableHLS            bool               `koanf:"enable_hls"`
 	EnableDASH           bool               `koanf:"enable_dash"`
+	LowLatencyHLS        bool               `koanf:"low_latency_hls"`   // partial segments for live and JIT streams
+	PartDuration         time.Duration      `koanf:"part_duration"`     // target duration of LL-HLS partial segments
+	SessionWindow        time.Duration      `koanf:"session_window"`    // media JIT and live playlists list; zero keeps every segment
+	SessionMaxDisk       int64              `koanf:"session_max_disk"`  // segment bytes kept per JIT or live session; zero is unlimited
+	EncryptionMethod     string             `koanf:"encryption_method"` // none, aes-128, sample-aes
+	KeySecret            string             `koanf:"key_secret"`        // derives per-session keys and signs stream tokens
+	KeyRotationSegments  int                `koanf:"key_rotation_segments"`
+	KeyBaseURL           string             `koanf:"key_base_url"`   // public URL the key endpoint is served at
 	HardwareAccel        string             `koanf:"hardware_accel"` // none, nvidia, intel, amd
+	// GPUSessionLimit overrides the concurrent encode sessions of each
+	// detected GPU; zero uses the driver's limit for the card.
+	GPUSessionLimit int `koanf:"gpu_session_limit"`
+	// CPUEncodeSessions is the number of concurrent encodes run on the
+	// CPU once every GPU is saturated, or without GPUs.
+	CPUEncodeSessions int `koanf:"cpu_encode_sessions"`
+	// PlaybackReserve is the number of encode sessions batch transcodes
+	// leave free, so playback starts without pausing one.
+	PlaybackReserve int `koanf:"playback_reserve"`
+	// ReadaheadBuffer is the media duration JIT transcodes encode ahead
+	// of the playhead at full speed; zero encodes at full speed to the
+	// end. Past it they encode at playback speed, and pause past
+	// ReadaheadMax.
+	ReadaheadBuffer time.Duration `koanf:"readahead_buffer"`
+	ReadaheadMax    time.Duration `koanf:"readahead_max"`
+	// TranscodeRetry is how failed batch transcode jobs are retried
+	// automatically.
+	TranscodeRetry RetryConfig `koanf:"transcode_retry"`
 }
 
 // TranscodeProfile defines a transcoding profile.
@@ -117,6 +515,59 @@ func (c *StreamingConfig) Validate() error {
 	if c.Streaming.MaxConcurrentStreams < 1 {
 		return errors.New("max concurrent streams must be at least 1")
 	}
+	if c.Streaming.CacheSize < 0 || c.Streaming.MemoryCacheSize < 0 {
+		return errors.New("segment cache sizes cannot be negative")
+	}
+	if c.Streaming.CacheTTL < time.Second {
+		return errors.New("segment cache TTL must be at least 1 second")
+	}
+	if c.Streaming.PrewarmSegments < 0 {
+		return errors.New("prewarm segments cannot be negative")
+	}
+	if c.Streaming.GPUSessionLimit < 0 || c.Streaming.CPUEncodeSessions < 0 || c.Streaming.PlaybackReserve < 0 {
+		return errors.New("encode session limits cannot be negative")
+	}
+	if c.Streaming.TranscodingEnabled && c.Streaming.HardwareAccel != "nvidia" && c.Streaming.CPUEncodeSessions == 0 {
+		return errors.New("transcoding without NVIDIA GPUs requires CPU encode sessions")
+	}
+	if c.Streaming.ReadaheadBuffer < 0 || c.Streaming.ReadaheadMax < 0 {
+		return errors.New("readahead cannot be negative")
+	}
+	if c.Streaming.ReadaheadBuffer > 0 && c.Streaming.ReadaheadMax < c.Streaming.ReadaheadBuffer {
+		return errors.New("readahead max cannot be below the readahead buffer")
+	}
+	if err := c.Streaming.TranscodeRetry.Policy().Validate(); err != nil {
+		return fmt.Errorf("transcode retry: %w", err)
+	}
+	if c.Streaming.SessionWindow < 0 || c.Streaming.SessionMaxDisk < 0 {
+		return errors.New("session retention settings cannot be negative")
+	}
+	if c.Streaming.SessionWindow > 0 && c.Streaming.SessionWindow < c.Streaming.SegmentDuration {
+		return errors.New("session window must be at least one segment duration")
+	}
+	if c.Streaming.LowLatencyHLS {
+		if c.Streaming.PartDuration < 100*time.Millisecond {
+			return errors.New("part duration must be at least 100ms")
+		}
+		if c.Streaming.PartDuration > c.Streaming.SegmentDuration {
+			return errors.New("part duration cannot exceed segment duration")
+		}
+	}
+	switch c.Streaming.EncryptionMethod {
+	case "", "none":
+	case "aes-128", "sample-aes":
+		if len(c.Streaming.KeySecret) < 32 {
+			return errors.New("HLS encryption requires a key secret of at least 32 bytes")
+		}
+		if c.Streaming.KeyRotationSegments < 1 {
+			return errors.New("key rotation segments must be at least 1")
+		}
+		if c.Streaming.KeyBaseURL == "" {
+			return errors.New("HLS encryption requires a key base URL")
+		}
+	default:
+		return fmt.Errorf("invalid encryption method: %s", c.Streaming.EncryptionMethod)
+	}
 	return nil
 }
 
@@ -134,12 +585,45 @@ type AcquisitionSettings struct {
 	CompletedPath      string          `koanf:"completed_path"`
 	MaxActiveDownloads int             `koanf:"max_active_downloads"`
 	DownloadTimeout    time.Duration   `koanf:"download_timeout"`
-	RetryAttempts      int             `koanf:"retry_attempts"`
-	RetryDelay         time.Duration   `koanf:"retry_delay"`
 	MinFreeDiskSpace   int64           `koanf:"min_free_disk_space"` // in bytes
 	PreferredQuality   []string        `koanf:"preferred_quality"`
 	ExcludedKeywords   []string        `koanf:"excluded_keywords"`
 	RequiredKeywords   []string        `koanf:"required_keywords"`
+	// DownloadClients are the external torrent clients downloads are
+	// handed to. Downloads naming no client go to DefaultDownloadClient.
+	DownloadClients       []DownloadClientConfig `koanf:"download_clients"`
+	DefaultDownloadClient string                 `koanf:"default_download_client"`
+	// DownloadPollInterval is how often download clients are polled for
+	// progress and completed downloads.
+	DownloadPollInterval time.Duration `koanf:"download_poll_interval"`
+	// DownloadRetry is how failed downloads are retried automatically.
+	DownloadRetry RetryConfig `koanf:"download_retry"`
+}
+
+// DownloadClientConfig contains the configuration of an external download
+// client.
+type DownloadClientConfig struct {
+	Name     string `koanf:"name"`
+	Type     string `koanf:"type"` // qbittorrent or transmission
+	URL      string `koanf:"url"`
+	Username string `koanf:"username"`
+	Password string `koanf:"password"`
+	// Category is the qBittorrent category or Transmission label downloads
+	// are filed under.
+	Category string `koanf:"category"`
+	Enabled  bool   `koanf:"enabled"`
+}
+
+// RetryConfig contains an automatic retry policy. The delay before the
+// first retry is InitialDelay, multiplied by Multiplier for every further
+// one, up to MaxDelay. Only failures of the RetryOn reasons are retried;
+// the others, such as a missing release or a corrupt source, fail at once.
+type RetryConfig struct {
+	MaxAttempts  int           `koanf:"max_attempts"` // including the first; 1 never retries
+	InitialDelay time.Duration `koanf:"initial_delay"`
+	MaxDelay     time.Duration `koanf:"max_delay"`
+	Multiplier   float64       `koanf:"multiplier"`
+	RetryOn      []string      `koanf:"retry_on"` // empty retries network, timeout, disk_full, server_error, rate_limited and unknown
 }
 
 // IndexerConfig contains indexer configuration.
@@ -164,6 +648,40 @@ func (c *AcquisitionConfig) Validate() error {
 	if c.Acquisition.MaxActiveDownloads < 1 {
 		return errors.New("max active downloads must be at least 1")
 	}
+	if err := validateDownloadClients(c.Acquisition.DownloadClients, c.Acquisition.DefaultDownloadClient); err != nil {
+		return err
+	}
+	if len(c.Acquisition.DownloadClients) > 0 && c.Acquisition.DownloadPollInterval <= 0 {
+		return errors.New("download poll interval must be positive")
+	}
+	if err := c.Acquisition.DownloadRetry.Policy().Validate(); err != nil {
+		return fmt.Errorf("download retry: %w", err)
+	}
+	return nil
+}
+
+// validateDownloadClients checks download clients and that the default
+// client is one of them.
+func validateDownloadClients(clients []DownloadClientConfig, defaultClient string) error {
+	names := make(map[string]bool, len(clients))
+	for _, client := range clients {
+		if client.Name == "" {
+			return errors.New("download client name is required")
+		}
+		if names[client.Name] {
+			return fmt.Errorf("duplicate download client %s", client.Name)
+		}
+		names[client.Name] = true
+		if client.Type != "qbittorrent" && client.Type != "transmission" {
+			return fmt.Errorf("download client %s: unknown type %q", client.Name, client.Type)
+		}
+		if client.URL == "" {
+			return fmt.Errorf("download client %s: url is required", client.Name)
+		}
+	}
+	if defaultClient != "" && !names[defaultClient] {
+		return fmt.Errorf("default download client %s is not configured", defaultClient)
+	}
 	return nil
 }
 
@@ -173,12 +691,14 @@ func GetDefaultLibraryConfig() *LibraryConfig {
 	base.Service.Name = "library"
 	base.Service.Port = 8081
 	base.Service.GRPCPort = 9091
-
+	base.Storage.BaseURL = "http://localhost:8081/assets"
 	return &LibraryConfig{
 		BaseConfig: *base,
 		Library: LibrarySettings{
 			ScanInterval:      30 * time.Minute,
 			MaxConcurrentScan: 2,
+			ScanWorkers:       4,
+			ScanBatchSize:     100,
 			FileExtensions: []string{
 				".mp4",
 				".mkv",
@@ -194,6 +714,54 @@ func GetDefaultLibraryConfig() *LibraryConfig {
 			IgnorePatterns: []string{"sample", "trailer", "extra"},
 			ThumbnailSize:  320,
 			EnableAutoScan: true,
+
+			WorkflowRetention:       30 * 24 * time.Hour,
+			WorkflowKeepPerMedia:    5,
+			WorkflowArchiveInterval: time.Hour,
+
+			ImportMode:  "link",
+			AutoReplace: true,
+
+			ClamdAddress:       DefaultClamdAddress,
+			MalwareScanTimeout: DefaultMalwareScanTimeout,
+
+			HookRunRetention: 30 * 24 * time.Hour,
+
+			FeedPollInterval: DefaultFeedPollInterval,
+			DownloadClients:  []DownloadClientConfig{},
+
+			HealthFailureThreshold:  DefaultHealthFailureThreshold,
+			HealthRetestInterval:    DefaultHealthRetestInterval,
+			HealthMaxRetestInterval: DefaultHealthMaxRetestInterval,
+
+			PlaybackErrorRate:   DefaultPlaybackErrorRate,
+			PlaybackMinSessions: DefaultPlaybackMinSessions,
+			PlaybackIssueWindow: DefaultPlaybackIssueWindow,
+
+			ShareLinkMaxTTL: DefaultShareLinkMaxTTL,
+			ShareMaxBitrate: DefaultShareMaxBitrate,
+			ShareStreamTTL:  DefaultShareStreamTTL,
+
+			KioskTokenTTL:        DefaultKioskTokenTTL,
+			KioskRefreshInterval: DefaultKioskRefreshInterval,
+
+			RequestQuotaPeriod: DefaultRequestQuotaPeriod,
+
+			TranscodePriorityInterval: DefaultTranscodePriorityInterval,
+			TranscodePriorityWindow:   DefaultTranscodePriorityWindow,
+			TranscodeBackCatalogAge:   DefaultTranscodeBackCatalogAge,
+			TranscodePopularGenres:    DefaultTranscodePopularGenres,
+
+			PruneUnwatchedAfter: DefaultPruneUnwatchedAfter,
+			PruneMinFreeSpace:   DefaultPruneMinFreeSpace,
+			PruneAdviceInterval: DefaultPruneAdviceInterval,
+
+			AniListURL: DefaultAniListURL,
+			IMVDbURL:   DefaultIMVDbURL,
+			AudioDBURL: DefaultAudioDBURL,
+		},
+		Assets: AssetSettings{
+			MaxThemeBytes: 10 * 1024 * 1024,
 		},
 	}
 }
@@ -204,7 +772,7 @@ func GetDefaultUserConfig() *UserConfig {
 	base.Service.Name = "user"
 	base.Service.Port = 8082
 	base.Service.GRPCPort = 9092
-
+	base.Storage.BaseURL = "http://localhost:8082/assets"
 	return &UserConfig{
 		BaseConfig: *base,
 		Auth: AuthSettings{
@@ -219,6 +787,40 @@ func GetDefaultUserConfig() *UserConfig {
 			RequireEmailVerify: false,
 			EnableOAuth:        false,
 			OAuthProviders:     []string{},
+
+			AllowRegistration:     false,
+			RequireApproval:       true,
+			RegistrationRateLimit: 5,
+			BlockedEmailDomains: []string{
+				"mailinator.com",
+				"guerrillamail.com",
+				"10minutemail.com",
+				"tempmail.com",
+				"temp-mail.org",
+				"yopmail.com",
+				"trashmail.com",
+				"sharklasers.com",
+				"getnada.com",
+				"dispostable.com",
+			},
+
+			ImpersonationTTL: 15 * time.Minute,
+
+			SignInProtection:      SignInProtectionNotify,
+			ImpossibleTravelSpeed: 900,
+			LoginChallengeTTL:     15 * time.Minute,
+
+			TOTPIssuer: "Narwhal",
+		},
+		Mail: MailSettings{
+			SMTPPort: 587,
+			From:     "narwhal@localhost",
+			BaseURL:  "http://localhost:8080",
+		},
+		Avatar: AvatarSettings{
+			StoragePath: "/tmp/narwhal/avatars",
+			MaxBytes:    2 * 1024 * 1024,
+			Size:        256,
 		},
 	}
 }
@@ -257,9 +859,27 @@ func GetDefaultStreamingConfig() *StreamingConfig {
 			MaxConcurrentStreams: 10,
 			CachePath:            "/tmp/narwhal/streaming",
 			CacheSize:            1024 * 1024 * 1024 * 10, // 10GB
+			MemoryCacheSize:      1024 * 1024 * 256,       // 256MB
+			CacheTTL:             time.Hour,
+			PrewarmSegments:      3,
 			EnableHLS:            true,
 			EnableDASH:           false,
+			LowLatencyHLS:        false,
+			SessionMaxDisk:       1024 * 1024 * 1024 * 4, // 4GB
+			PartDuration:         time.Second,
+			EncryptionMethod:     "none",
+			KeyRotationSegments:  100,
+			KeyBaseURL:           "http://localhost:8083/keys",
 			HardwareAccel:        "none",
+			CPUEncodeSessions:    2,
+			PlaybackReserve:      1,
+			ReadaheadBuffer:      time.Minute,
+			ReadaheadMax:         5 * time.Minute,
+			TranscodeRetry: RetryConfig{
+				MaxAttempts:  3,
+				InitialDelay: time.Minute,
+				MaxDelay:     30 * time.Minute,
+			},
 		},
 	}
 }
@@ -274,17 +894,22 @@ func GetDefaultAcquisitionConfig() *AcquisitionConfig {
 	return &AcquisitionConfig{
 		BaseConfig: *base,
 		Acquisition: AcquisitionSettings{
-			Indexers:           []IndexerConfig{},
-			DownloadPath:       "/tmp/narwhal/downloads",
-			CompletedPath:      "/tmp/narwhal/completed",
-			MaxActiveDownloads: 3,
-			DownloadTimeout:    2 * time.Hour,
-			RetryAttempts:      3,
-			RetryDelay:         5 * time.Minute,
-			MinFreeDiskSpace:   1024 * 1024 * 1024, // 1GB
-			PreferredQuality:   []string{"1080p", "720p"},
-			ExcludedKeywords:   []string{"cam", "ts", "screener"},
-			RequiredKeywords:   []string{},
+			Indexers:             []IndexerConfig{},
+			DownloadPath:         "/tmp/narwhal/downloads",
+			CompletedPath:        "/tmp/narwhal/completed",
+			MaxActiveDownloads:   3,
+			DownloadTimeout:      2 * time.Hour,
+			MinFreeDiskSpace:     1024 * 1024 * 1024, // 1GB
+			PreferredQuality:     []string{"1080p", "720p"},
+			ExcludedKeywords:     []string{"cam", "ts", "screener"},
+			RequiredKeywords:     []string{},
+			DownloadClients:      []DownloadClientConfig{},
+			DownloadPollInterval: DefaultDownloadPollInterval,
+			DownloadRetry: RetryConfig{
+				MaxAttempts:  4,
+				InitialDelay: 5 * time.Minute,
+				MaxDelay:     2 * time.Hour,
+			},
 		},
 	}
 }
@@ -0,0 +1,190 @@
+// Package contract verifies the contracts between the services: the events
+// and RPCs a consumer relies on, and the fields it reads from them.
+//
+// Contracts are JSON files in test/contracts, one per consumer and
+// provider. Each interaction names an event type or a gRPC method, the
+// fields the consumer expects and an example recorded from the provider.
+// Both sides test against the same files:
+//
+//   - Consumer tests replay the examples through the consumer's handlers
+//     with ReplayEvents and ReplayUnaryClientInterceptor.
+//   - Provider tests record what the provider actually publishes and
+//     answers, with a Bus and an RPCRecorder, and check it against the
+//     expectations of every consumer with VerifyEvents and VerifyRPCs.
+//
+// A provider change removing or retyping a field a consumer reads fails
+// the provider's tests. Running the provider tests with
+// NARWHAL_CONTRACT_UPDATE=1 rewrites the examples from the recordings.
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// UpdateEnv rewrites the examples of the contracts from the recordings of
+// the provider tests when set.
+const UpdateEnv = "NARWHAL_CONTRACT_UPDATE"
+
+// Contract is what a consumer expects of a provider.
+type Contract struct {
+	Consumer     string        `json:"consumer"`
+	Provider     string        `json:"provider"`
+	Interactions []Interaction `json:"interactions"`
+
+	path string
+}
+
+// Interaction is an event or an RPC a consumer relies on. Exactly one of
+// Event and RPC is set.
+type Interaction struct {
+	Description string `json:"description"`
+	Event       *Event `json:"event,omitempty"`
+	RPC         *RPC   `json:"rpc,omitempty"`
+}
+
+// Event is an event a consumer subscribes to.
+type Event struct {
+	Type string `json:"type"`
+	// Version is the newest payload version the consumer understands.
+	Version uint32 `json:"version"`
+	// Expect are the payload fields the consumer reads.
+	Expect Fields `json:"expect"`
+	// Example is a payload recorded from the provider.
+	Example json.RawMessage `json:"example"`
+}
+
+// RPC is a unary gRPC method a consumer calls.
+type RPC struct {
+	// Method is the full method name, such as
+	// "/narwhal.auth.v1.AuthService/Login".
+	Method string `json:"method"`
+	// Expect are the response fields the consumer reads, by their JSON
+	// names.
+	Expect Fields `json:"expect"`
+	// Example is a response recorded from the provider, in the protobuf
+	// JSON mapping.
+	Example json.RawMessage `json:"example"`
+}
+
+// Load reads a contract file.
+func Load(path string) (*Contract, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var c Contract
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to decode contract %s: %w", path, err)
+	}
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("invalid contract %s: %w", path, err)
+	}
+	c.path = path
+	return &c, nil
+}
+
+// LoadDir reads every contract file of a directory, ordered by name.
+func LoadDir(dir string) ([]*Contract, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	contracts := make([]*Contract, 0, len(paths))
+	for _, path := range paths {
+		c, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		contracts = append(contracts, c)
+	}
+	return contracts, nil
+}
+
+// Save writes the contract back to the file it was loaded from.
+func (c *Contract) Save() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode contract: %w", err)
+	}
+	return os.WriteFile(c.path, append(data, '\n'), 0o644)
+}
+
+// Name identifies the contract in failures, such as "library -> user".
+func (c *Contract) Name() string {
+	return c.Consumer + " -> " + c.Provider
+}
+
+func (c *Contract) validate() error {
+	if c.Consumer == "" || c.Provider == "" {
+		return fmt.Errorf("consumer and provider are required")
+	}
+	for i, in := range c.Interactions {
+		switch {
+		case (in.Event == nil) == (in.RPC == nil):
+			return fmt.Errorf("interaction %d must have exactly one of event and rpc", i)
+		case in.Event != nil && (in.Event.Type == "" || in.Event.Version == 0):
+			return fmt.Errorf("event interaction %d needs a type and a version", i)
+		case in.RPC != nil && !strings.HasPrefix(in.RPC.Method, "/"):
+			return fmt.Errorf("rpc interaction %d needs a full method name", i)
+		}
+		if err := in.expect().validate(); err != nil {
+			return fmt.Errorf("interaction %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (in Interaction) expect() Fields {
+	if in.Event != nil {
+		return in.Event.Expect
+	}
+	return in.RPC.Expect
+}
+
+// Select returns the contracts matching a filter.
+func Select(contracts []*Contract, match func(*Contract) bool) []*Contract {
+	var selected []*Contract
+	for _, c := range contracts {
+		if match(c) {
+			selected = append(selected, c)
+		}
+	}
+	return selected
+}
+
+// ByConsumer matches the contracts of a consumer.
+func ByConsumer(consumer string) func(*Contract) bool {
+	return func(c *Contract) bool { return c.Consumer == consumer }
+}
+
+// ByProvider matches the contracts of a provider.
+func ByProvider(provider string) func(*Contract) bool {
+	return func(c *Contract) bool { return c.Provider == provider }
+}
+
+// Dir returns the contracts directory of the repository, found from the
+// working directory of a test.
+func Dir() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return filepath.Join(dir, "test", "contracts"), nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("no go.mod above the working directory")
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,229 @@
+package contract_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/narwhalmedia/narwhal/pkg/contract"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+)
+
+const healthCheck = "/grpc.health.v1.Health/Check"
+
+func writeContract(t *testing.T, body string) string {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "consumer-provider.json"), []byte(body), 0o644))
+	return dir
+}
+
+const eventContract = `{
+  "consumer": "consumer",
+  "provider": "provider",
+  "interactions": [{
+    "description": "reads deleted users",
+    "event": {
+      "type": "user.deleted",
+      "version": 1,
+      "expect": {"user_id": "string"},
+      "example": {"user_id": "u1", "username": "alice"}
+    }
+  }]
+}`
+
+func TestRepositoryContracts(t *testing.T) {
+	dir, err := contract.Dir()
+	require.NoError(t, err)
+
+	contracts, err := contract.LoadDir(dir)
+
+	require.NoError(t, err)
+	assert.NotEmpty(t, contracts)
+}
+
+func TestLoad_RejectsInvalidContracts(t *testing.T) {
+	for name, body := range map[string]string{
+		"no provider":  `{"consumer": "c", "interactions": []}`,
+		"no kind":      `{"consumer": "c", "provider": "p", "interactions": [{"description": "d"}]}`,
+		"unknown type": `{"consumer": "c", "provider": "p", "interactions": [{"rpc": {"method": "/s/M", "expect": {"a": "text"}}}]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := contract.LoadDir(writeContract(t, body))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestFields_Check(t *testing.T) {
+	fields := contract.Fields{
+		"id":          contract.TypeString,
+		"count":       contract.TypeInteger,
+		"size":        contract.TypeInteger,
+		"user.active": contract.TypeBool,
+		"tags":        contract.TypeArray,
+	}
+
+	assert.NoError(t, fields.Check([]byte(`{"id": "1", "count": 2, "size": "3", "user": {"active": true}, "tags": []}`)))
+
+	err := fields.Check([]byte(`{"id": 1, "count": 2.5, "size": "3", "user": {}, "tags": null}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "field id is number, expected string")
+	assert.Contains(t, err.Error(), "field count is number, expected integer")
+	assert.Contains(t, err.Error(), "missing field user.active")
+	assert.Contains(t, err.Error(), "field tags is null, expected array")
+}
+
+func TestReplayEvents(t *testing.T) {
+	contracts, err := contract.LoadDir(writeContract(t, eventContract))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	t.Run("unsubscribed", func(t *testing.T) {
+		err := contract.ReplayEvents(ctx, contracts, contract.NewBus())
+		assert.ErrorContains(t, err, "user.deleted is not subscribed to")
+	})
+
+	t.Run("handled", func(t *testing.T) {
+		bus := contract.NewBus()
+		var got map[string]interface{}
+		require.NoError(t, bus.Subscribe("user.deleted", events.NewConsumer("test", 1, func(_ context.Context, env *events.Envelope) error {
+			got = env.Payload()
+			return nil
+		})))
+
+		require.NoError(t, contract.ReplayEvents(ctx, contracts, bus))
+		assert.Equal(t, "u1", got["user_id"])
+	})
+
+	t.Run("handler fails", func(t *testing.T) {
+		bus := contract.NewBus()
+		require.NoError(t, bus.Subscribe("user.deleted", events.NewConsumer("test", 1, func(context.Context, *events.Envelope) error {
+			return assert.AnError
+		})))
+
+		assert.ErrorIs(t, contract.ReplayEvents(ctx, contracts, bus), assert.AnError)
+	})
+}
+
+func TestVerifyEvents(t *testing.T) {
+	dir := writeContract(t, eventContract)
+	contracts, err := contract.LoadDir(dir)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	t.Run("compatible", func(t *testing.T) {
+		bus := contract.NewBus()
+		require.NoError(t, bus.Publish(ctx, events.NewEvent("user.deleted", map[string]interface{}{"user_id": "u2"})))
+		require.NoError(t, bus.Publish(ctx, events.NewEvent("user.created", map[string]interface{}{"user_id": 2})))
+
+		assert.NoError(t, contract.VerifyEvents(contracts, bus.Published()))
+	})
+
+	t.Run("breaking", func(t *testing.T) {
+		bus := contract.NewBus()
+		require.NoError(t, bus.Publish(ctx, events.NewEvent("user.deleted", map[string]interface{}{"id": "u2"})))
+
+		err := contract.VerifyEvents(contracts, bus.Published())
+		assert.ErrorContains(t, err, "consumer -> provider: reads deleted users: user.deleted: missing field user_id")
+	})
+
+	t.Run("update", func(t *testing.T) {
+		t.Setenv(contract.UpdateEnv, "1")
+		bus := contract.NewBus()
+		require.NoError(t, bus.Publish(ctx, events.NewEvent("user.deleted", map[string]interface{}{"user_id": "u3"})))
+
+		require.NoError(t, contract.VerifyEvents(contracts, bus.Published()))
+
+		reloaded, err := contract.LoadDir(dir)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"user_id": "u3"}`, string(reloaded[0].Interactions[0].Event.Example))
+	})
+}
+
+const rpcContract = `{
+  "consumer": "consumer",
+  "provider": "provider",
+  "interactions": [{
+    "description": "checks the health of the provider",
+    "rpc": {
+      "method": "/grpc.health.v1.Health/Check",
+      "expect": {"status": "string"},
+      "example": {"status": "SERVING"}
+    }
+  }]
+}`
+
+func TestReplayUnaryClientInterceptor(t *testing.T) {
+	contracts, err := contract.LoadDir(writeContract(t, rpcContract))
+	require.NoError(t, err)
+
+	conn, err := grpc.NewClient("passthrough:///contract",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(contract.ReplayUnaryClientInterceptor(contracts)))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+
+	_, err = client.List(context.Background(), &healthpb.HealthListRequest{})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func TestVerifyRPCs(t *testing.T) {
+	contracts, err := contract.LoadDir(writeContract(t, rpcContract))
+	require.NoError(t, err)
+
+	var recorder contract.RPCRecorder
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(grpc.UnaryInterceptor(recorder.UnaryServerInterceptor()))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(listener) }()
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+
+	calls := recorder.Calls()
+	require.Len(t, calls, 1)
+	assert.Equal(t, healthCheck, calls[0].Method)
+	assert.NoError(t, contract.VerifyRPCs(contracts, calls))
+
+	// A provider that stopped setting the status breaks the consumer
+	calls[0].Response = []byte(`{}`)
+	assert.ErrorContains(t, contract.VerifyRPCs(contracts, calls), "missing field status")
+}
+
+func TestCheckSchemas(t *testing.T) {
+	contracts, err := contract.LoadDir(writeContract(t, rpcContract))
+	require.NoError(t, err)
+	require.NoError(t, contract.CheckSchemas(contracts, protoregistry.GlobalFiles))
+
+	contracts[0].Interactions[0].RPC.Expect["healthy"] = contract.TypeBool
+	assert.ErrorContains(t, contract.CheckSchemas(contracts, protoregistry.GlobalFiles),
+		"grpc.health.v1.HealthCheckResponse has no field healthy")
+}
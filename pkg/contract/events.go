@@ -0,0 +1,128 @@
+package contract
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/testing/fake"
+)
+
+// Bus is the event bus of contract tests. It records every published
+// event and delivers it synchronously, returning the errors of the
+// handlers.
+type Bus = fake.EventBus
+
+// NewBus creates a bus without subscribers.
+func NewBus() *Bus {
+	return fake.NewEventBus()
+}
+
+// ReplayEvents publishes the example of every event interaction of the
+// contracts to a consumer's bus. It fails if an example lacks the fields
+// its consumer expects, if a consumer's handler fails, and, on a Bus, if
+// the consumer does not subscribe to an event it declares.
+func ReplayEvents(ctx context.Context, contracts []*Contract, bus interfaces.EventBus) error {
+	var errs []error
+	for _, c := range contracts {
+		for _, in := range c.Interactions {
+			if in.Event == nil {
+				continue
+			}
+			if err := replayEvent(ctx, bus, in.Event); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s: %w", c.Name(), in.Description, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func replayEvent(ctx context.Context, bus interfaces.EventBus, e *Event) error {
+	if err := e.Expect.Check(e.Example); err != nil {
+		return fmt.Errorf("example of %s: %w", e.Type, err)
+	}
+	if b, ok := bus.(*Bus); ok && !b.Subscribed(e.Type) {
+		return fmt.Errorf("%s is not subscribed to", e.Type)
+	}
+
+	schema, ok := events.LookupSchema(e.Type)
+	if !ok {
+		return fmt.Errorf("%w: %s", events.ErrUnknownEventType, e.Type)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(e.Example, &payload); err != nil {
+		return fmt.Errorf("example of %s: %w", e.Type, err)
+	}
+
+	env := &events.Envelope{
+		SchemaVersion: events.EnvelopeSchemaVersion,
+		ID:            "contract-" + e.Type,
+		Type:          e.Type,
+		Version:       e.Version,
+		AggregateType: schema.AggregateType,
+		OccurredAt:    time.Now().UTC(),
+		Data:          payload,
+	}
+	if id, ok := payload[schema.AggregateType+"_id"].(string); ok {
+		env.AggID = id
+	}
+	return bus.Publish(ctx, env)
+}
+
+// VerifyEvents checks the events a provider published against the event
+// interactions of the contracts: their versions must be understood by the
+// consumers, and their payloads must have the fields the consumers
+// expect. Interactions with events that were not published are not
+// checked. With UpdateEnv set, the examples of the contracts that pass are
+// rewritten from the published payloads.
+func VerifyEvents(contracts []*Contract, published []*events.Envelope) error {
+	var errs []error
+	for _, c := range contracts {
+		var failed, updated bool
+		for _, in := range c.Interactions {
+			if in.Event == nil {
+				continue
+			}
+			for _, env := range published {
+				if env.Type != in.Event.Type {
+					continue
+				}
+				payload, err := verifyEvent(in.Event, env)
+				if err != nil {
+					failed = true
+					errs = append(errs, fmt.Errorf("%s: %s: %w", c.Name(), in.Description, err))
+					continue
+				}
+				if os.Getenv(UpdateEnv) != "" {
+					in.Event.Example = payload
+					updated = true
+				}
+			}
+		}
+		if updated && !failed {
+			if err := c.Save(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func verifyEvent(e *Event, env *events.Envelope) (json.RawMessage, error) {
+	if env.Version > e.Version {
+		return nil, fmt.Errorf("%s v%d is published, the consumer understands up to v%d", env.Type, env.Version, e.Version)
+	}
+	payload, err := json.Marshal(env.Payload())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", env.Type, err)
+	}
+	if err := e.Expect.Check(payload); err != nil {
+		return nil, fmt.Errorf("%s: %w", env.Type, err)
+	}
+	return payload, nil
+}
@@ -0,0 +1,121 @@
+package contract
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Field types of expectations, as they appear in JSON.
+const (
+	TypeString = "string"
+	TypeNumber = "number"
+	// TypeInteger also accepts the decimal strings the protobuf JSON
+	// mapping encodes 64-bit integers as.
+	TypeInteger = "integer"
+	TypeBool    = "bool"
+	TypeObject  = "object"
+	TypeArray   = "array"
+	// TypeAny only requires the field to be present.
+	TypeAny = "any"
+)
+
+// Fields maps the paths of the fields a consumer reads, with dots between
+// nested fields such as "user.id", to their types.
+type Fields map[string]string
+
+func (f Fields) validate() error {
+	for path, typ := range f {
+		switch typ {
+		case TypeString, TypeNumber, TypeInteger, TypeBool, TypeObject, TypeArray, TypeAny:
+		default:
+			return fmt.Errorf("field %s has unknown type %q", path, typ)
+		}
+	}
+	return nil
+}
+
+// Check returns an error describing every expected field missing from a
+// JSON object or of another type.
+func (f Fields) Check(data []byte) error {
+	var value map[string]interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("not a JSON object: %w", err)
+	}
+
+	var errs []error
+	for _, path := range f.paths() {
+		v, ok := lookup(value, path)
+		if !ok {
+			errs = append(errs, fmt.Errorf("missing field %s", path))
+			continue
+		}
+		if !hasType(v, f[path]) {
+			errs = append(errs, fmt.Errorf("field %s is %s, expected %s", path, typeOf(v), f[path]))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// paths returns the paths of the fields in order.
+func (f Fields) paths() []string {
+	paths := make([]string, 0, len(f))
+	for path := range f {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func lookup(value map[string]interface{}, path string) (interface{}, bool) {
+	var v interface{} = value
+	for _, name := range strings.Split(path, ".") {
+		object, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = object[name]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func hasType(v interface{}, typ string) bool {
+	switch typ {
+	case TypeAny:
+		return true
+	case TypeInteger:
+		switch n := v.(type) {
+		case float64:
+			return n == math.Trunc(n)
+		case string:
+			_, err := strconv.ParseInt(n, 10, 64)
+			return err == nil
+		}
+		return false
+	default:
+		return typeOf(v) == typ
+	}
+}
+
+func typeOf(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return TypeString
+	case float64:
+		return TypeNumber
+	case bool:
+		return TypeBool
+	case map[string]interface{}:
+		return TypeObject
+	case []interface{}:
+		return TypeArray
+	default:
+		return "null"
+	}
+}
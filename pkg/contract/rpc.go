@@ -0,0 +1,221 @@
+package contract
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/narwhalmedia/narwhal/pkg/events"
+)
+
+// Call is a unary call a provider answered.
+type Call struct {
+	Method string
+	// Response is the response in the protobuf JSON mapping, with proto
+	// field names; nil if the call failed.
+	Response json.RawMessage
+	Code     codes.Code
+}
+
+// recordOptions record responses with every field, as consumers read zero
+// values too, by the names of the protos.
+var recordOptions = protojson.MarshalOptions{EmitUnpopulated: true, UseProtoNames: true}
+
+// RPCRecorder records the calls a gRPC server answers.
+type RPCRecorder struct {
+	mu    sync.Mutex
+	calls []Call
+}
+
+// UnaryServerInterceptor records the calls of the server it is installed
+// on.
+func (r *RPCRecorder) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+
+		call := Call{Method: info.FullMethod, Code: status.Code(err)}
+		if msg, ok := resp.(proto.Message); ok && err == nil {
+			if call.Response, err = recordOptions.Marshal(msg); err != nil {
+				return nil, status.Errorf(codes.Internal, "failed to record response: %v", err)
+			}
+		}
+
+		r.mu.Lock()
+		r.calls = append(r.calls, call)
+		r.mu.Unlock()
+		return resp, err
+	}
+}
+
+// Calls returns the calls recorded so far.
+func (r *RPCRecorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// VerifyRPCs checks the successful calls a provider answered against the
+// RPC interactions of the contracts: their responses must have the fields
+// the consumers expect. Interactions with methods that were not called
+// are not checked. With UpdateEnv set, the examples of the contracts that
+// pass are rewritten from the responses.
+func VerifyRPCs(contracts []*Contract, calls []Call) error {
+	var errs []error
+	for _, c := range contracts {
+		var failed, updated bool
+		for _, in := range c.Interactions {
+			if in.RPC == nil {
+				continue
+			}
+			for _, call := range calls {
+				if call.Method != in.RPC.Method || call.Code != codes.OK {
+					continue
+				}
+				if err := in.RPC.Expect.Check(call.Response); err != nil {
+					failed = true
+					errs = append(errs, fmt.Errorf("%s: %s: %s: %w", c.Name(), in.Description, call.Method, err))
+					continue
+				}
+				if os.Getenv(UpdateEnv) != "" {
+					in.RPC.Example = call.Response
+					updated = true
+				}
+			}
+		}
+		if updated && !failed {
+			if err := c.Save(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ReplayUnaryClientInterceptor answers the calls of a consumer's client
+// with the examples of the RPC interactions of the contracts, without
+// reaching a server. Examples that lack the fields the consumer expects,
+// or that no longer match the response message, fail the call; calls to
+// methods missing from the contracts fail as unimplemented.
+func ReplayUnaryClientInterceptor(contracts []*Contract) grpc.UnaryClientInterceptor {
+	examples := make(map[string]*RPC)
+	for _, c := range contracts {
+		for _, in := range c.Interactions {
+			if in.RPC != nil {
+				examples[in.RPC.Method] = in.RPC
+			}
+		}
+	}
+
+	return func(_ context.Context, method string, _, reply interface{}, _ *grpc.ClientConn, _ grpc.UnaryInvoker, _ ...grpc.CallOption) error {
+		rpc, ok := examples[method]
+		if !ok {
+			return status.Errorf(codes.Unimplemented, "%s is not in the contracts", method)
+		}
+		if err := rpc.Expect.Check(rpc.Example); err != nil {
+			return status.Errorf(codes.Internal, "example of %s: %v", method, err)
+		}
+		msg, ok := reply.(proto.Message)
+		if !ok {
+			return status.Errorf(codes.Internal, "reply of %s is not a protobuf message", method)
+		}
+		if err := protojson.Unmarshal(rpc.Example, msg); err != nil {
+			return status.Errorf(codes.Internal, "example of %s does not match its response: %v", method, err)
+		}
+		return nil
+	}
+}
+
+// CheckSchemas checks the expectations of the contracts against the
+// protobuf schemas of the providers: every expected field of an RPC
+// response or an event payload must exist in its message. The schemas are
+// looked up in files, usually protoregistry.GlobalFiles once the generated
+// packages are imported, and the payload messages in the event catalog.
+func CheckSchemas(contracts []*Contract, files *protoregistry.Files) error {
+	var errs []error
+	for _, c := range contracts {
+		for _, in := range c.Interactions {
+			var message protoreflect.MessageDescriptor
+			var err error
+			if in.RPC != nil {
+				message, err = responseMessage(files, in.RPC.Method)
+			} else if schema, ok := events.LookupSchema(in.Event.Type); ok {
+				message, err = findMessage(files, schema.Payload)
+			} else {
+				err = fmt.Errorf("%w: %s", events.ErrUnknownEventType, in.Event.Type)
+			}
+			if err == nil {
+				err = checkFields(message, in.expect())
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s: %w", c.Name(), in.Description, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func responseMessage(files *protoregistry.Files, fullMethod string) (protoreflect.MessageDescriptor, error) {
+	service, method, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("service %s: %w", service, err)
+	}
+	sd, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, fmt.Errorf("method %s not found", fullMethod)
+	}
+	return md.Output(), nil
+}
+
+func findMessage(files *protoregistry.Files, name string) (protoreflect.MessageDescriptor, error) {
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("message %s: %w", name, err)
+	}
+	message, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message", name)
+	}
+	return message, nil
+}
+
+// checkFields checks that every path exists in a message, by the JSON or
+// the proto names of its fields.
+func checkFields(message protoreflect.MessageDescriptor, fields Fields) error {
+	var errs []error
+	for _, path := range fields.paths() {
+		md := message
+		for i, name := range strings.Split(path, ".") {
+			if md == nil {
+				errs = append(errs, fmt.Errorf("field %s of %s is not a message", path, message.FullName()))
+				break
+			}
+			fd := md.Fields().ByJSONName(name)
+			if fd == nil {
+				fd = md.Fields().ByName(protoreflect.Name(name))
+			}
+			if fd == nil {
+				errs = append(errs, fmt.Errorf("%s has no field %s", message.FullName(), strings.Join(strings.Split(path, ".")[:i+1], ".")))
+				break
+			}
+			md = fd.Message()
+		}
+	}
+	return errors.Join(errs...)
+}
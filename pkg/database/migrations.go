@@ -7,7 +7,9 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/narwhalmedia/narwhal/internal/library/repository"
+	userDomain "github.com/narwhalmedia/narwhal/internal/user/domain"
 	userRepo "github.com/narwhalmedia/narwhal/internal/user/repository"
+	"github.com/narwhalmedia/narwhal/pkg/assets"
 )
 
 // Migration represents a database migration.
@@ -136,6 +138,291 @@ func getAllMigrations() []MigrationEntry {
 			Name:    "Add composite constraints",
 			Up:      migration003AddConstraints,
 		},
+		{
+			Version: "20240101_004",
+			Name:    "Add watch states",
+			Up:      migration004AddWatchStates,
+		},
+		{
+			Version: "20240101_005",
+			Name:    "Add multi-tenancy",
+			Up:      migration005AddTenants,
+		},
+		{
+			Version: "20240101_006",
+			Name:    "Add invites and library grants",
+			Up:      migration006AddInvites,
+		},
+		{
+			Version: "20240101_007",
+			Name:    "Add self-service registration",
+			Up:      migration007AddRegistration,
+		},
+		{
+			Version: "20240101_008",
+			Name:    "Add uploaded avatars",
+			Up:      migration008AddAvatarKey,
+		},
+		{
+			Version: "20240101_009",
+			Name:    "Add typed user preferences",
+			Up:      migration009AddUserPreferences,
+		},
+		{
+			Version: "20240101_010",
+			Name:    "Add registered devices",
+			Up:      migration010AddDevices,
+		},
+		{
+			Version: "20240101_011",
+			Name:    "Add impersonation audit trail",
+			Up:      migration011AddImpersonations,
+		},
+		{
+			Version: "20240101_012",
+			Name:    "Add role inheritance and deny rules",
+			Up:      migration012AddRoleHierarchy,
+		},
+		{
+			Version: "20240101_013",
+			Name:    "Add media workflows",
+			Up:      migration013AddWorkflows,
+		},
+		{
+			Version: "20240101_014",
+			Name:    "Add scan manifests",
+			Up:      migration014AddScanManifests,
+		},
+		{
+			Version: "20240101_015",
+			Name:    "Add scan rules and media extras",
+			Up:      migration015AddScanRules,
+		},
+		{
+			Version: "20240101_016",
+			Name:    "Link extras to episodes",
+			Up:      migration016AddExtraEpisodes,
+		},
+		{
+			Version: "20240101_017",
+			Name:    "Add media theme music",
+			Up:      migration017AddMediaThemes,
+		},
+		{
+			Version: "20240101_018",
+			Name:    "Add content-addressed assets",
+			Up:      migration018AddAssets,
+		},
+		{
+			Version: "20240101_019",
+			Name:    "Add transcode policies",
+			Up:      migration019AddTranscodePolicies,
+		},
+		{
+			Version: "20240101_020",
+			Name:    "Add workflow history",
+			Up:      migration020AddWorkflowHistory,
+		},
+		{
+			Version: "20240101_021",
+			Name:    "Add feature flags",
+			Up:      migration021AddFeatureFlags,
+		},
+		{
+			Version: "20240101_022",
+			Name:    "Add tasks",
+			Up:      migration022AddTasks,
+		},
+		{
+			Version: "20240101_023",
+			Name:    "Add unique media paths",
+			Up:      migration023AddUniqueMediaPaths,
+		},
+		{
+			Version: "20240101_024",
+			Name:    "Add search documents",
+			Up:      migration024AddSearchDocuments,
+		},
+		{
+			Version: "20240101_025",
+			Name:    "Add consents",
+			Up:      migration025AddConsents,
+		},
+		{
+			Version: "20240101_026",
+			Name:    "Add data exports and account deletion",
+			Up:      migration026AddPrivacy,
+		},
+		{
+			Version: "20240101_027",
+			Name:    "Add storage usage",
+			Up:      migration027AddStorageUsage,
+		},
+		{
+			Version: "20240101_028",
+			Name:    "Add hooks",
+			Up:      migration028AddHooks,
+		},
+		{
+			Version: "20240101_029",
+			Name:    "Add feeds",
+			Up:      migration029AddFeeds,
+		},
+		{
+			Version: "20240101_030",
+			Name:    "Add calendar",
+			Up:      migration030AddCalendar,
+		},
+		{
+			Version: "20240101_031",
+			Name:    "Add quality cutoffs",
+			Up:      migration031AddQualityCutoffs,
+		},
+		{
+			Version: "20240101_032",
+			Name:    "Add release blocklist",
+			Up:      migration032AddBlocklist,
+		},
+		{
+			Version: "20240101_033",
+			Name:    "Add manual imports",
+			Up:      migration033AddManualImports,
+		},
+		{
+			Version: "20240101_034",
+			Name:    "Add playback issues",
+			Up:      migration034AddPlaybackIssues,
+		},
+		{
+			Version: "20240101_035",
+			Name:    "Add watchlists and transcode priorities",
+			Up:      migration035AddWatchlistsAndTranscodePriorities,
+		},
+		{
+			Version: "20240101_036",
+			Name:    "Add library metadata preferences",
+			Up:      migration036AddLibraryMetadataPreferences,
+		},
+		{
+			Version: "20240101_037",
+			Name:    "Add anime libraries",
+			Up:      migration037AddAnimeLibraries,
+		},
+		{
+			Version: "20240101_038",
+			Name:    "Add manual import replacements",
+			Up:      migration038AddManualImportReplacements,
+		},
+		{
+			Version: "20240101_039",
+			Name:    "Add library naming formats",
+			Up:      migration039AddLibraryNamingFormats,
+		},
+		{
+			Version: "20240101_040",
+			Name:    "Add episode files",
+			Up:      migration040AddEpisodeFiles,
+		},
+		{
+			Version: "20240101_041",
+			Name:    "Add media artists",
+			Up:      migration041AddMediaArtists,
+		},
+		{
+			Version: "20240101_042",
+			Name:    "Add sign-in history",
+			Up:      migration042AddSignInHistory,
+		},
+		{
+			Version: "20240101_043",
+			Name:    "Add worker pool sizes",
+			Up:      migration043AddWorkerPoolSizes,
+		},
+		{
+			Version: "20240101_044",
+			Name:    "Add library folder profiles",
+			Up:      migration044AddLibraryFolderProfiles,
+		},
+		{
+			Version: "20240101_045",
+			Name:    "Add share links",
+			Up:      migration045AddShareLinks,
+		},
+		{
+			Version: "20240101_046",
+			Name:    "Add content requests",
+			Up:      migration046AddContentRequests,
+		},
+		{
+			Version: "20240101_047",
+			Name:    "Add request quotas",
+			Up:      migration047AddRequestQuotas,
+		},
+		{
+			Version: "20240101_048",
+			Name:    "Add media issues",
+			Up:      migration048AddMediaIssues,
+		},
+		{
+			Version: "20240101_049",
+			Name:    "Add email digest deliveries",
+			Up:      migration049AddDigestDeliveries,
+		},
+		{
+			Version: "20240101_050",
+			Name:    "Add kiosks",
+			Up:      migration050AddKiosks,
+		},
+		{
+			Version: "20240101_051",
+			Name:    "Add viewings",
+			Up:      migration051AddViewings,
+		},
+		{
+			Version: "20240101_052",
+			Name:    "Add transcode outputs",
+			Up:      migration052AddTranscodeOutputs,
+		},
+		{
+			Version: "20240101_053",
+			Name:    "Add audio normalization",
+			Up:      migration053AddAudioNormalization,
+		},
+		{
+			Version: "20240101_054",
+			Name:    "Add user identities",
+			Up:      migration054AddUserIdentities,
+		},
+		{
+			Version: "20240101_055",
+			Name:    "Add API keys",
+			Up:      migration055AddAPIKeys,
+		},
+		{
+			Version: "20240101_056",
+			Name:    "Add two-factor authentication",
+			Up:      migration056AddTwoFactor,
+		},
+		{
+			Version: "20240101_057",
+			Name:    "Add tenants to episodes and watch states",
+			Up:      migration057AddEpisodeTenants,
+		},
+		{
+			Version: "20240101_058",
+			Name:    "Add tenants to feeds",
+			Up:      migration058AddFeedTenants,
+		},
+		{
+			Version: "20240101_059",
+			Name:    "Add calendar feed keys",
+			Up:      migration059AddCalendarFeedKeys,
+		},
+		{
+			Version: "20240101_060",
+			Name:    "Add tenants to storage usage",
+			Up:      migration060AddStorageUsageTenants,
+		},
 	}
 }
 
@@ -236,6 +523,740 @@ func migration003AddConstraints(tx *gorm.DB) error {
 	return nil
 }
 
+// migration004AddWatchStates adds per-user watch state tracking.
+func migration004AddWatchStates(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.WatchState{}); err != nil {
+		return fmt.Errorf("failed to migrate watch states: %w", err)
+	}
+
+	if err := tx.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_watch_states_user_media_episode ON watch_states(user_id, media_id, COALESCE(episode_id, '00000000-0000-0000-0000-000000000000'))").Error; err != nil {
+		return fmt.Errorf("failed to create index: %w", err)
+	}
+
+	return nil
+}
+
+// migration005AddTenants adds tenants and tenant ownership columns.
+func migration005AddTenants(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&userDomain.Tenant{}); err != nil {
+		return fmt.Errorf("failed to migrate tenants: %w", err)
+	}
+
+	// Existing rows are backfilled to the default tenant by the column default
+	if err := tx.AutoMigrate(
+		&userRepo.User{},
+		&repository.Library{},
+		&repository.MediaItem{},
+	); err != nil {
+		return fmt.Errorf("failed to add tenant columns: %w", err)
+	}
+
+	indexes := []string{
+		"CREATE INDEX IF NOT EXISTS idx_media_items_tenant_library ON media_items(tenant_id, library_id)",
+	}
+
+	for _, idx := range indexes {
+		if err := tx.Exec(idx).Error; err != nil {
+			return fmt.Errorf("failed to create index: %w", err)
+		}
+	}
+
+	// Library names are unique per tenant now, by idx_libraries_tenant_name
+	if err := tx.Exec("DROP INDEX IF EXISTS idx_libraries_name").Error; err != nil {
+		return fmt.Errorf("failed to drop index: %w", err)
+	}
+
+	return nil
+}
+
+// migration006AddInvites adds user invites and library access grants.
+func migration006AddInvites(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&userDomain.Invite{}, &userDomain.LibraryGrant{}); err != nil {
+		return fmt.Errorf("failed to migrate invites: %w", err)
+	}
+
+	return nil
+}
+
+// migration007AddRegistration adds email verification tokens and the
+// pending approval flag for self-registered users.
+func migration007AddRegistration(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&userDomain.EmailVerification{}); err != nil {
+		return fmt.Errorf("failed to migrate email verifications: %w", err)
+	}
+
+	if err := tx.AutoMigrate(&userRepo.User{}); err != nil {
+		return fmt.Errorf("failed to add pending approval column: %w", err)
+	}
+
+	return nil
+}
+
+// migration008AddAvatarKey adds the storage key for uploaded avatars.
+func migration008AddAvatarKey(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&userRepo.User{}); err != nil {
+		return fmt.Errorf("failed to add avatar key column: %w", err)
+	}
+
+	return nil
+}
+
+// migration009AddUserPreferences adds the key/value preference store.
+func migration009AddUserPreferences(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&userDomain.UserPreference{}); err != nil {
+		return fmt.Errorf("failed to migrate user preferences: %w", err)
+	}
+
+	return nil
+}
+
+// migration010AddDevices adds registered devices and links sessions to them.
+func migration010AddDevices(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&userDomain.Device{}); err != nil {
+		return fmt.Errorf("failed to migrate devices: %w", err)
+	}
+
+	if err := tx.AutoMigrate(&userRepo.Session{}); err != nil {
+		return fmt.Errorf("failed to add session device column: %w", err)
+	}
+
+	return nil
+}
+
+// migration011AddImpersonations adds the admin impersonation audit trail.
+func migration011AddImpersonations(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&userDomain.Impersonation{}); err != nil {
+		return fmt.Errorf("failed to migrate impersonations: %w", err)
+	}
+
+	return nil
+}
+
+// migration012AddRoleHierarchy adds role inheritance and deny rules, and
+// rebuilds already seeded roles on top of each other. Fresh installs are
+// seeded with the hierarchy directly.
+func migration012AddRoleHierarchy(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&userRepo.Permission{}, &userRepo.RoleInheritance{}); err != nil {
+		return fmt.Errorf("failed to migrate role hierarchy: %w", err)
+	}
+
+	statements := []string{
+		// A resource/action pair may now exist once per effect
+		"ALTER TABLE permissions DROP CONSTRAINT IF EXISTS unique_permission",
+		"ALTER TABLE permissions ADD CONSTRAINT unique_permission UNIQUE (resource, action, effect)",
+
+		// Add the moderator role to seeded installs
+		`INSERT INTO roles (id, name, description, created_at, updated_at)
+		SELECT gen_random_uuid(), 'moderator', 'Moderator who curates library content', NOW(), NOW()
+		WHERE EXISTS (SELECT 1 FROM roles WHERE name = 'admin')
+		ON CONFLICT (name) DO NOTHING`,
+		`INSERT INTO role_permissions (role_id, permission_id)
+		SELECT r.id, p.id FROM roles r, permissions p
+		WHERE r.name = 'moderator' AND p.effect = 'allow'
+		AND (p.resource, p.action) IN (('library', 'write'), ('media', 'write'), ('media', 'delete'))
+		ON CONFLICT DO NOTHING`,
+
+		// guest <- user <- moderator
+		`INSERT INTO role_inheritance (role_id, parent_id, created_at)
+		SELECT child.id, parent.id, NOW() FROM roles child, roles parent
+		WHERE (child.name, parent.name) IN (('user', 'guest'), ('moderator', 'user'))
+		ON CONFLICT DO NOTHING`,
+
+		// Users no longer need their own copy of what they inherit from guest
+		`DELETE FROM role_permissions
+		WHERE role_id IN (SELECT id FROM roles WHERE name = 'user')
+		AND permission_id IN (
+			SELECT rp.permission_id FROM role_permissions rp
+			JOIN roles r ON r.id = rp.role_id
+			WHERE r.name = 'guest'
+		)`,
+	}
+
+	for _, stmt := range statements {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("failed to migrate role seeds: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// migration013AddWorkflows adds the step timeline of media workflows.
+func migration013AddWorkflows(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.Workflow{}); err != nil {
+		return fmt.Errorf("failed to migrate workflows: %w", err)
+	}
+
+	return nil
+}
+
+// migration014AddScanManifests adds the directory manifests used by
+// incremental library scans.
+func migration014AddScanManifests(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.ScanManifestEntry{}); err != nil {
+		return fmt.Errorf("failed to migrate scan manifests: %w", err)
+	}
+
+	return nil
+}
+
+// migration015AddScanRules adds per-library scan rules and links extras to
+// their parent media.
+func migration015AddScanRules(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.Library{}, &repository.MediaItem{}); err != nil {
+		return fmt.Errorf("failed to migrate scan rules: %w", err)
+	}
+
+	return nil
+}
+
+// migration016AddExtraEpisodes links extras to the episode they belong to.
+func migration016AddExtraEpisodes(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.MediaItem{}); err != nil {
+		return fmt.Errorf("failed to migrate extra episodes: %w", err)
+	}
+
+	return nil
+}
+
+// migration017AddMediaThemes adds the stored theme music of series.
+func migration017AddMediaThemes(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.MediaItem{}); err != nil {
+		return fmt.Errorf("failed to migrate media themes: %w", err)
+	}
+
+	return nil
+}
+
+// migration018AddAssets adds the shared asset store and its references.
+func migration018AddAssets(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&assets.AssetModel{}, &assets.AssetRefModel{}); err != nil {
+		return fmt.Errorf("failed to migrate assets: %w", err)
+	}
+
+	return nil
+}
+
+// migration019AddTranscodePolicies adds per-library transcode policies and
+// the transcodes they have requested.
+func migration019AddTranscodePolicies(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.TranscodePolicy{}, &repository.TranscodeRequest{}); err != nil {
+		return fmt.Errorf("failed to migrate transcode policies: %w", err)
+	}
+
+	return nil
+}
+
+// migration020AddWorkflowHistory adds the archive of finished workflows and
+// an index for picking the workflows to archive.
+func migration020AddWorkflowHistory(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.WorkflowHistory{}); err != nil {
+		return fmt.Errorf("failed to migrate workflow history: %w", err)
+	}
+
+	if err := tx.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_workflows_media_created
+		ON workflows (media_id, created_at DESC)
+	`).Error; err != nil {
+		return fmt.Errorf("failed to create workflow index: %w", err)
+	}
+
+	return nil
+}
+
+// migration021AddFeatureFlags adds feature flags.
+func migration021AddFeatureFlags(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&userDomain.FeatureFlag{}); err != nil {
+		return fmt.Errorf("failed to migrate feature flags: %w", err)
+	}
+
+	return nil
+}
+
+// migration022AddTasks adds the record of background tasks.
+func migration022AddTasks(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.Task{}); err != nil {
+		return fmt.Errorf("failed to migrate tasks: %w", err)
+	}
+
+	return nil
+}
+
+// migration023AddUniqueMediaPaths makes media file paths unique, which
+// batch upserts of scan results rely on. Duplicate paths have to be
+// resolved by hand first, as the rows may have episodes and watch states.
+func migration023AddUniqueMediaPaths(tx *gorm.DB) error {
+	var duplicates int64
+	if err := tx.Raw(`
+		SELECT COUNT(*) FROM (
+			SELECT file_path FROM media_items
+			WHERE file_path <> '' AND deleted_at IS NULL
+			GROUP BY file_path HAVING COUNT(*) > 1
+		) d
+	`).Scan(&duplicates).Error; err != nil {
+		return fmt.Errorf("failed to check media paths: %w", err)
+	}
+	if duplicates > 0 {
+		return fmt.Errorf("%d media file paths are used by more than one media item", duplicates)
+	}
+
+	if err := tx.Exec(`
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_media_items_file_path_unique
+		ON media_items (file_path) WHERE file_path <> '' AND deleted_at IS NULL
+	`).Error; err != nil {
+		return fmt.Errorf("failed to create media path index: %w", err)
+	}
+
+	return nil
+}
+
+// migration024AddSearchDocuments adds the full-text search index of media.
+// It is filled by the index updater; existing media are indexed by running
+// RebuildSearchIndex once.
+func migration024AddSearchDocuments(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.SearchDocument{}); err != nil {
+		return fmt.Errorf("failed to migrate search documents: %w", err)
+	}
+
+	if err := tx.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_search_documents_document
+		ON search_documents USING gin(document)
+	`).Error; err != nil {
+		return fmt.Errorf("failed to create search document index: %w", err)
+	}
+
+	return nil
+}
+
+// migration025AddConsents adds the published terms and privacy documents
+// and the record of users accepting them.
+func migration025AddConsents(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&userDomain.ConsentDocument{}, &userDomain.Consent{}); err != nil {
+		return fmt.Errorf("failed to migrate consents: %w", err)
+	}
+
+	return nil
+}
+
+// migration026AddPrivacy adds user data exports and the scheduled deletion
+// time of accounts.
+func migration026AddPrivacy(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&userDomain.DataExport{}, &userDomain.DataExportSection{}); err != nil {
+		return fmt.Errorf("failed to migrate data exports: %w", err)
+	}
+
+	if err := tx.AutoMigrate(&userRepo.User{}); err != nil {
+		return fmt.Errorf("failed to add deletion schedule column: %w", err)
+	}
+
+	return nil
+}
+
+// migration027AddStorageUsage adds the storage usage of libraries. The
+// library service fills it for every library when it starts and keeps it
+// up to date from then on.
+func migration027AddStorageUsage(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.StorageUsage{}); err != nil {
+		return fmt.Errorf("failed to migrate storage usage: %w", err)
+	}
+
+	return nil
+}
+
+// migration028AddHooks adds the enabled state of hook scripts and the log
+// of their runs.
+func migration028AddHooks(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.HookState{}, &repository.HookRun{}); err != nil {
+		return fmt.Errorf("failed to migrate hooks: %w", err)
+	}
+
+	return nil
+}
+
+// migration029AddFeeds adds RSS feed subscriptions and the releases grabbed
+// from them.
+func migration029AddFeeds(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.Feed{}, &repository.FeedGrab{}); err != nil {
+		return fmt.Errorf("failed to migrate feeds: %w", err)
+	}
+
+	return nil
+}
+
+// migration030AddCalendar adds whether media are monitored and the home
+// release dates of movies.
+func migration030AddCalendar(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.MediaItem{}); err != nil {
+		return fmt.Errorf("failed to migrate calendar: %w", err)
+	}
+
+	indexes := []string{
+		"CREATE INDEX IF NOT EXISTS idx_episodes_air_date ON episodes(air_date) WHERE deleted_at IS NULL",
+	}
+	for _, idx := range indexes {
+		if err := tx.Exec(idx).Error; err != nil {
+			return fmt.Errorf("failed to create calendar index: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// migration031AddQualityCutoffs adds the quality files of a library are
+// upgraded to.
+func migration031AddQualityCutoffs(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.Library{}); err != nil {
+		return fmt.Errorf("failed to migrate quality cutoffs: %w", err)
+	}
+
+	return nil
+}
+
+// migration032AddBlocklist adds the releases that are never grabbed again.
+// Titles are matched case-insensitively.
+func migration032AddBlocklist(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.BlocklistEntry{}); err != nil {
+		return fmt.Errorf("failed to migrate blocklist: %w", err)
+	}
+
+	indexes := []string{
+		"CREATE INDEX IF NOT EXISTS idx_blocklist_title ON blocklist(LOWER(title))",
+	}
+	for _, idx := range indexes {
+		if err := tx.Exec(idx).Error; err != nil {
+			return fmt.Errorf("failed to create blocklist index: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// migration033AddManualImports adds the downloads parked for an admin to
+// match to library items.
+func migration033AddManualImports(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.ManualImport{}); err != nil {
+		return fmt.Errorf("failed to migrate manual imports: %w", err)
+	}
+
+	return nil
+}
+
+// migration034AddPlaybackIssues adds the playback issues clients report
+// and the media flagged for them.
+func migration034AddPlaybackIssues(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.PlaybackIssue{}, &repository.PlaybackFlag{}); err != nil {
+		return fmt.Errorf("failed to migrate playback issues: %w", err)
+	}
+
+	return nil
+}
+
+// migration035AddWatchlistsAndTranscodePriorities adds user watchlists and
+// the priority given to requested transcodes.
+func migration035AddWatchlistsAndTranscodePriorities(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.WatchlistEntry{}, &repository.TranscodeRequest{}); err != nil {
+		return fmt.Errorf("failed to migrate watchlists and transcode priorities: %w", err)
+	}
+
+	return nil
+}
+
+// migration036AddLibraryMetadataPreferences adds the language, region and
+// title style metadata of a library is fetched with.
+func migration036AddLibraryMetadataPreferences(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.Library{}); err != nil {
+		return fmt.Errorf("failed to migrate library metadata preferences: %w", err)
+	}
+
+	return nil
+}
+
+// migration037AddAnimeLibraries adds the anime flag of libraries and the
+// absolute numbers of episodes.
+func migration037AddAnimeLibraries(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.Library{}, &repository.Episode{}); err != nil {
+		return fmt.Errorf("failed to migrate anime libraries: %w", err)
+	}
+
+	return nil
+}
+
+// migration038AddManualImportReplacements adds the comparison of manual
+// imports with the file they would replace.
+func migration038AddManualImportReplacements(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.ManualImport{}); err != nil {
+		return fmt.Errorf("failed to migrate manual import replacements: %w", err)
+	}
+
+	return nil
+}
+
+// migration039AddLibraryNamingFormats adds the formats renames organize the
+// files of a library into.
+func migration039AddLibraryNamingFormats(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.Library{}); err != nil {
+		return fmt.Errorf("failed to migrate library naming formats: %w", err)
+	}
+
+	return nil
+}
+
+// migration040AddEpisodeFiles adds the files of episodes, so one file can
+// hold several episodes and one episode span several files, starting with
+// the file each episode points to.
+func migration040AddEpisodeFiles(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.EpisodeFile{}); err != nil {
+		return fmt.Errorf("failed to migrate episode files: %w", err)
+	}
+
+	err := tx.Exec(`
+		INSERT INTO episode_files (episode_id, media_id, file_path, part, duration, created_at, updated_at)
+		SELECT id, media_id, file_path, 0, 0, NOW(), NOW()
+		FROM episodes
+		WHERE file_path <> '' AND deleted_at IS NULL
+		ON CONFLICT DO NOTHING
+	`).Error
+	if err != nil {
+		return fmt.Errorf("failed to backfill episode files: %w", err)
+	}
+
+	return nil
+}
+
+// migration041AddMediaArtists adds the artist music tracks and music videos
+// are linked by, taking the artists of existing tracks from the first
+// directory under their library.
+func migration041AddMediaArtists(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.MediaItem{}); err != nil {
+		return fmt.Errorf("failed to migrate media artists: %w", err)
+	}
+
+	err := tx.Exec(`
+		UPDATE media_items m
+		SET artist = split_part(substr(m.file_path, length(l.path) + 2), '/', 1)
+		FROM libraries l
+		WHERE m.library_id = l.id
+			AND m.media_type = 'music'
+			AND m.artist = ''
+			AND m.file_path LIKE l.path || '/%/%'
+	`).Error
+	if err != nil {
+		return fmt.Errorf("failed to backfill track artists: %w", err)
+	}
+
+	return nil
+}
+
+// migration042AddSignInHistory adds the device fingerprint of sessions and
+// the sign-in history and challenges anomalous logins are checked with.
+func migration042AddSignInHistory(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&userRepo.Session{}); err != nil {
+		return fmt.Errorf("failed to migrate session fingerprints: %w", err)
+	}
+	if err := tx.AutoMigrate(&userDomain.SignIn{}, &userDomain.LoginChallenge{}); err != nil {
+		return fmt.Errorf("failed to migrate sign-in history: %w", err)
+	}
+	return nil
+}
+
+// migration043AddWorkerPoolSizes adds the worker pool sizes set at runtime.
+func migration043AddWorkerPoolSizes(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.WorkerPoolSize{}); err != nil {
+		return fmt.Errorf("failed to migrate worker pool sizes: %w", err)
+	}
+	return nil
+}
+
+// migration044AddLibraryFolderProfiles adds the folder structure profile of
+// a library and whether its scans ignore extras folders.
+func migration044AddLibraryFolderProfiles(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.Library{}); err != nil {
+		return fmt.Errorf("failed to migrate library folder profiles: %w", err)
+	}
+	return nil
+}
+
+// migration045AddShareLinks adds the links that let guests stream media and
+// the audit of their plays.
+func migration045AddShareLinks(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.ShareLink{}, &repository.ShareLinkPlay{}); err != nil {
+		return fmt.Errorf("failed to migrate share links: %w", err)
+	}
+	return nil
+}
+
+// migration046AddContentRequests adds the content users request, with at
+// most one request of a title that was not denied.
+func migration046AddContentRequests(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.ContentRequest{}); err != nil {
+		return fmt.Errorf("failed to migrate content requests: %w", err)
+	}
+	if err := tx.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_content_requests_open_title " +
+		"ON content_requests(tenant_id, provider, provider_id) WHERE status <> 'denied'").Error; err != nil {
+		return fmt.Errorf("failed to index content requests: %w", err)
+	}
+	return nil
+}
+
+// migration047AddRequestQuotas adds the seasons and quality of content
+// requests and the request quotas admins set for users.
+func migration047AddRequestQuotas(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.ContentRequest{}, &repository.RequestQuotaOverride{}); err != nil {
+		return fmt.Errorf("failed to migrate request quotas: %w", err)
+	}
+	return nil
+}
+
+// migration048AddMediaIssues adds the issues users report with media.
+func migration048AddMediaIssues(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.MediaIssue{}); err != nil {
+		return fmt.Errorf("failed to migrate media issues: %w", err)
+	}
+	return nil
+}
+
+// migration049AddDigestDeliveries adds the record of the last email digest
+// of each user.
+func migration049AddDigestDeliveries(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&userDomain.DigestDelivery{}); err != nil {
+		return fmt.Errorf("failed to migrate digest deliveries: %w", err)
+	}
+	return nil
+}
+
+// migration050AddKiosks adds the kiosk and display clients that read what
+// is playing and what was added without a user account.
+func migration050AddKiosks(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.Kiosk{}); err != nil {
+		return fmt.Errorf("failed to migrate kiosks: %w", err)
+	}
+	return nil
+}
+
+// migration051AddViewings adds the viewings progress heartbeats are
+// aggregated into for completion rates and retention curves.
+func migration051AddViewings(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.Viewing{}); err != nil {
+		return fmt.Errorf("failed to migrate viewings: %w", err)
+	}
+	return nil
+}
+
+// migration052AddTranscodeOutputs adds the completed transcodes reused for
+// sources transcoded before.
+func migration052AddTranscodeOutputs(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.TranscodeOutput{}); err != nil {
+		return fmt.Errorf("failed to migrate transcode outputs: %w", err)
+	}
+	return nil
+}
+
+// migration053AddAudioNormalization adds the audio normalization of
+// libraries and transcode policies, and the measured loudness of sources.
+func migration053AddAudioNormalization(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(
+		&repository.Library{},
+		&repository.TranscodePolicy{},
+		&repository.LoudnessMeasurement{},
+	); err != nil {
+		return fmt.Errorf("failed to migrate audio normalization: %w", err)
+	}
+	return nil
+}
+
+// migration054AddUserIdentities adds the identities linking users to the
+// OpenID Connect providers they log in with.
+func migration054AddUserIdentities(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&userDomain.UserIdentity{}); err != nil {
+		return fmt.Errorf("failed to migrate user identities: %w", err)
+	}
+	return nil
+}
+
+// migration055AddAPIKeys adds the API keys scripts and integrations call
+// the API with.
+func migration055AddAPIKeys(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&userDomain.APIKey{}); err != nil {
+		return fmt.Errorf("failed to migrate API keys: %w", err)
+	}
+	return nil
+}
+
+// migration056AddTwoFactor adds the TOTP secrets of users, their recovery
+// codes and the factor login challenges are answered with.
+func migration056AddTwoFactor(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&userRepo.User{}); err != nil {
+		return fmt.Errorf("failed to add TOTP columns: %w", err)
+	}
+	if err := tx.AutoMigrate(&userDomain.RecoveryCode{}, &userDomain.LoginChallenge{}); err != nil {
+		return fmt.Errorf("failed to migrate recovery codes: %w", err)
+	}
+	return nil
+}
+
+// migration057AddEpisodeTenants scopes episodes and watch states to
+// tenants, backfilling them from the tenants of their media.
+func migration057AddEpisodeTenants(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.Episode{}, &repository.WatchState{}); err != nil {
+		return fmt.Errorf("failed to add tenant columns: %w", err)
+	}
+
+	backfills := []string{
+		"UPDATE episodes e SET tenant_id = m.tenant_id FROM media_items m WHERE m.id = e.media_id",
+		"UPDATE watch_states w SET tenant_id = m.tenant_id FROM media_items m WHERE m.id = w.media_id",
+	}
+	for _, backfill := range backfills {
+		if err := tx.Exec(backfill).Error; err != nil {
+			return fmt.Errorf("failed to backfill tenants: %w", err)
+		}
+	}
+	return nil
+}
+
+// migration058AddFeedTenants scopes feeds to tenants, backfilling them
+// from their libraries. Releases are grabbed once per tenant, so the
+// tenant joins the key of feed grabs.
+func migration058AddFeedTenants(tx *gorm.DB) error {
+	statements := []string{
+		"ALTER TABLE feeds ADD COLUMN IF NOT EXISTS tenant_id uuid NOT NULL DEFAULT '00000000-0000-0000-0000-000000000000'",
+		"CREATE INDEX IF NOT EXISTS idx_feeds_tenant_id ON feeds(tenant_id)",
+		"UPDATE feeds f SET tenant_id = l.tenant_id FROM libraries l WHERE l.id = f.library_id",
+		"ALTER TABLE feed_grabs ADD COLUMN IF NOT EXISTS tenant_id uuid NOT NULL DEFAULT '00000000-0000-0000-0000-000000000000'",
+		"UPDATE feed_grabs g SET tenant_id = f.tenant_id FROM feeds f WHERE f.id = g.feed_id",
+		"ALTER TABLE feed_grabs DROP CONSTRAINT IF EXISTS feed_grabs_pkey",
+		"ALTER TABLE feed_grabs ADD PRIMARY KEY (tenant_id, key)",
+	}
+	for _, stmt := range statements {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("failed to add feed tenants: %w", err)
+		}
+	}
+	return nil
+}
+
+// migration059AddCalendarFeedKeys adds the per-user keys calendar feed
+// tokens are derived from, so users can revoke their feed tokens.
+func migration059AddCalendarFeedKeys(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.CalendarFeedKey{}); err != nil {
+		return fmt.Errorf("failed to migrate calendar feed keys: %w", err)
+	}
+	return nil
+}
+
+// migration060AddStorageUsageTenants scopes storage usage to tenants,
+// backfilling them from their libraries.
+func migration060AddStorageUsageTenants(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&repository.StorageUsage{}); err != nil {
+		return fmt.Errorf("failed to add tenant column: %w", err)
+	}
+	if err := tx.Exec(
+		"UPDATE storage_usage s SET tenant_id = l.tenant_id FROM libraries l WHERE l.id = s.library_id",
+	).Error; err != nil {
+		return fmt.Errorf("failed to backfill tenants: %w", err)
+	}
+	return nil
+}
+
 // isConstraintExistsError checks if the error is due to constraint already existing.
 func isConstraintExistsError(err error) bool {
 	if err == nil {
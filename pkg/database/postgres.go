@@ -9,6 +9,8 @@ import (
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+
+	"github.com/narwhalmedia/narwhal/pkg/tenant"
 )
 
 // PostgresConfig holds PostgreSQL connection configuration.
@@ -71,6 +73,11 @@ func NewGormDB(cfg *PostgresConfig) (*gorm.DB, error) {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
+	// Scope tenant-owned models to the tenant carried by the request context
+	if err := db.Use(tenant.NewScopePlugin()); err != nil {
+		return nil, fmt.Errorf("failed to register tenant scope plugin: %w", err)
+	}
+
 	// Get underlying SQL database to configure connection pool
 	sqlDB, err := db.DB()
 	if err != nil {
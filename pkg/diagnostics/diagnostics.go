@@ -0,0 +1,181 @@
+// Package diagnostics serves runtime profiles of a service and bundles
+// them into archives for bug reports.
+package diagnostics
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/clientip"
+)
+
+// Prefix is the path the diagnostics endpoints are served under.
+const Prefix = "/debug/"
+
+// NewHandler serves the pprof, trace and expvar endpoints under Prefix to
+// the requests allow accepts.
+func NewHandler(allow func(r *http.Request) bool) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(Prefix+"pprof/", pprof.Index)
+	mux.HandleFunc(Prefix+"pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc(Prefix+"pprof/profile", pprof.Profile)
+	mux.HandleFunc(Prefix+"pprof/symbol", pprof.Symbol)
+	mux.HandleFunc(Prefix+"pprof/trace", pprof.Trace)
+	mux.Handle(Prefix+"vars", expvar.Handler())
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allow(r) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// LocalhostOnly allows requests from loopback clients, resolved through
+// the trusted proxies of resolver. A reverse proxy on the same host
+// connects from a loopback address too, so requests carrying forwarding
+// headers are only allowed from trusted proxies forwarding for a loopback
+// client; those of other proxies are refused rather than taken as local.
+func LocalhostOnly(resolver *clientip.Resolver) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		forwarded := r.Header.Get("X-Forwarded-For") != "" ||
+			r.Header.Get("X-Real-IP") != "" ||
+			r.Header.Get("Forwarded") != ""
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil || (forwarded && !resolver.Trusted(host)) {
+			return false
+		}
+		ip := net.ParseIP(resolver.FromRequest(r))
+		return ip != nil && ip.IsLoopback()
+	}
+}
+
+// AdminOnly allows requests bearing an access token of a platform admin
+// whose roles grant system administration. Profiles and the configuration
+// cover the whole install, so admins of other tenants are refused.
+func AdminOnly(jwtManager *auth.JWTManager, rbac auth.RBACInterface) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			return false
+		}
+		claims, err := jwtManager.ValidateAccessToken(token)
+		if err != nil {
+			return false
+		}
+		return claims.IsPlatformAdmin() && rbac.CheckPermissions(claims.Roles, "system", "admin")
+	}
+}
+
+// Guard returns LocalhostOnly if localhostOnly is set and AdminOnly
+// otherwise.
+func Guard(
+	localhostOnly bool,
+	resolver *clientip.Resolver,
+	jwtManager *auth.JWTManager,
+	rbac auth.RBACInterface,
+) func(r *http.Request) bool {
+	if localhostOnly {
+		return LocalhostOnly(resolver)
+	}
+	return AdminOnly(jwtManager, rbac)
+}
+
+// Capture bundles a goroutine dump, a heap profile, runtime statistics and
+// the given configuration into a gzipped tar archive. config should already
+// be redacted; it is left out if nil.
+func Capture(service string, config map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+
+	add := func(name string, data []byte) error {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0o644,
+			Size:    int64(len(data)),
+			ModTime: now,
+		}); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	var goroutines bytes.Buffer
+	if err := runtimepprof.Lookup("goroutine").WriteTo(&goroutines, 2); err != nil {
+		return nil, err
+	}
+	if err := add("goroutines.txt", goroutines.Bytes()); err != nil {
+		return nil, err
+	}
+
+	runtime.GC()
+	var heap bytes.Buffer
+	if err := runtimepprof.Lookup("heap").WriteTo(&heap, 0); err != nil {
+		return nil, err
+	}
+	if err := add("heap.pb.gz", heap.Bytes()); err != nil {
+		return nil, err
+	}
+
+	stats, err := json.MarshalIndent(runtimeStats(service, now), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := add("runtime.json", stats); err != nil {
+		return nil, err
+	}
+
+	if config != nil {
+		data, err := json.MarshalIndent(config, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := add("config.json", data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func runtimeStats(service string, now time.Time) map[string]interface{} {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	return map[string]interface{}{
+		"service":        service,
+		"captured_at":    now.UTC(),
+		"go_version":     runtime.Version(),
+		"os":             runtime.GOOS,
+		"arch":           runtime.GOARCH,
+		"cpus":           runtime.NumCPU(),
+		"goroutines":     runtime.NumGoroutine(),
+		"heap_alloc":     mem.HeapAlloc,
+		"heap_objects":   mem.HeapObjects,
+		"total_alloc":    mem.TotalAlloc,
+		"sys":            mem.Sys,
+		"num_gc":         mem.NumGC,
+		"gc_pause_total": time.Duration(mem.PauseTotalNs).String(),
+	}
+}
@@ -0,0 +1,141 @@
+package diagnostics_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/clientip"
+	"github.com/narwhalmedia/narwhal/pkg/config"
+	"github.com/narwhalmedia/narwhal/pkg/diagnostics"
+)
+
+func TestHandlerGuards(t *testing.T) {
+	resolver, err := clientip.NewResolver(nil)
+	require.NoError(t, err)
+	handler := diagnostics.NewHandler(diagnostics.LocalhostOnly(resolver))
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+	req.RemoteAddr = "127.0.0.1:51234"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "memstats")
+
+	req.RemoteAddr = "203.0.113.7:51234"
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestLocalhostOnlyBehindProxy(t *testing.T) {
+	request := func(forwardedFor string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+		req.RemoteAddr = "127.0.0.1:51234"
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		return req
+	}
+
+	// A proxy on the same host that is not trusted does not make the
+	// clients it forwards for local
+	untrusted, err := clientip.NewResolver(nil)
+	require.NoError(t, err)
+	allow := diagnostics.LocalhostOnly(untrusted)
+	assert.True(t, allow(request("")))
+	assert.False(t, allow(request("203.0.113.7")))
+	assert.False(t, allow(request("127.0.0.1")))
+
+	trusted, err := clientip.NewResolver([]string{"127.0.0.1"})
+	require.NoError(t, err)
+	allow = diagnostics.LocalhostOnly(trusted)
+	assert.False(t, allow(request("203.0.113.7")))
+	assert.True(t, allow(request("127.0.0.1")))
+}
+
+func TestAdminOnly(t *testing.T) {
+	jwtManager := auth.NewJWTManager("access", "refresh", "test", time.Minute, time.Hour)
+	allow := diagnostics.AdminOnly(jwtManager, auth.NewRBAC())
+
+	token := func(role string) string {
+		user := &domain.User{Username: "someone", Roles: []domain.Role{{Name: role}}}
+		tokens, err := jwtManager.GenerateTokenPair(user, uuid.New())
+		require.NoError(t, err)
+		return tokens.AccessToken
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil)
+	assert.False(t, allow(req))
+
+	req.Header.Set("Authorization", "Bearer "+token("user"))
+	assert.False(t, allow(req))
+
+	req.Header.Set("Authorization", "Bearer "+token("admin"))
+	assert.True(t, allow(req))
+
+	// Admins of other tenants cannot profile the install
+	tenantAdmin := &domain.User{Username: "someone", TenantID: uuid.New(), Roles: []domain.Role{{Name: "admin"}}}
+	tokens, err := jwtManager.GenerateTokenPair(tenantAdmin, uuid.New())
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	assert.False(t, allow(req))
+}
+
+func TestCapture(t *testing.T) {
+	cfg := config.GetDefaultLibraryConfig()
+	cfg.Database.Password = "hunter2"
+	redacted, err := config.Redacted(cfg)
+	require.NoError(t, err)
+
+	archive, err := diagnostics.Capture("library", redacted)
+	require.NoError(t, err)
+
+	files := readArchive(t, archive)
+	assert.Contains(t, string(files["goroutines.txt"]), "goroutine")
+	assert.NotEmpty(t, files["heap.pb.gz"])
+
+	var stats map[string]interface{}
+	require.NoError(t, json.Unmarshal(files["runtime.json"], &stats))
+	assert.Equal(t, "library", stats["service"])
+
+	assert.NotContains(t, string(files["config.json"]), "hunter2")
+	var captured map[string]map[string]interface{}
+	require.NoError(t, json.Unmarshal(files["config.json"], &captured))
+	assert.Equal(t, "REDACTED", captured["database"]["password"])
+	assert.Equal(t, "localhost", captured["database"]["host"])
+	// Empty secrets stay empty so missing settings are visible
+	assert.Equal(t, "", captured["auth"]["jwt_secret"])
+}
+
+func readArchive(t *testing.T, archive []byte) map[string][]byte {
+	t.Helper()
+
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+
+	files := make(map[string][]byte)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[header.Name] = data
+	}
+}
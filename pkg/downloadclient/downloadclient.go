@@ -0,0 +1,169 @@
+// Package downloadclient hands downloads to external torrent clients, such
+// as qBittorrent and Transmission, and maps their progress onto narwhal's
+// download model.
+package downloadclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// Client types.
+const (
+	TypeQBittorrent  = "qbittorrent"
+	TypeTransmission = "transmission"
+)
+
+// ErrNotFound is returned for downloads a client does not know.
+var ErrNotFound = errors.New("download not found")
+
+// AddRequest describes a download to hand to a client.
+type AddRequest struct {
+	URL string // magnet link or URL of a .torrent file
+	// Category files the download under a qBittorrent category or a
+	// Transmission label. Empty uses the client's configured category.
+	Category string
+	// SavePath is the directory to download into; empty uses the client's
+	// default.
+	SavePath string
+	Paused   bool
+}
+
+// Status is the state of a download at a client, mapped onto narwhal's
+// download model.
+type Status struct {
+	ID       string // info hash, lower case
+	Name     string
+	Category string
+	State    models.DownloadStatus
+	// ClientState is the state as the client reports it, such as
+	// "stalledDL" or "seed wait".
+	ClientState string
+	Progress    float32 // 0 to 1
+	Size        int64
+	Downloaded  int64
+	// DownloadSpeed is in bytes per second.
+	DownloadSpeed int64
+	ETA           int // seconds; -1 if unknown
+	SavePath      string
+	// ContentPath is the file or directory the download is saved as.
+	ContentPath string
+	// Completed reports whether every wanted file was downloaded. Completed
+	// downloads may still be seeding.
+	Completed bool
+	Error     string
+}
+
+// Apply copies the progress of a download at its client onto a download.
+// The status is left alone; callers move it through its state machine.
+func (s *Status) Apply(download *models.Download) {
+	download.Progress = s.Progress
+	download.DownloadSpeed = s.DownloadSpeed
+	download.ETA = s.ETA
+	if s.Size > 0 {
+		download.Size = s.Size
+	}
+	if s.ContentPath != "" {
+		download.OutputPath = s.ContentPath
+	}
+	download.Error = s.Error
+}
+
+// Client is an external download client.
+type Client interface {
+	// Name returns the name the client is configured under.
+	Name() string
+	// Add hands a download to the client and returns its ID.
+	Add(ctx context.Context, req AddRequest) (string, error)
+	// Get returns the state of a download.
+	Get(ctx context.Context, id string) (*Status, error)
+	// List returns the downloads in a category, or all downloads if
+	// category is empty.
+	List(ctx context.Context, category string) ([]*Status, error)
+	// SetCategory moves a download to another category.
+	SetCategory(ctx context.Context, id, category string) error
+	// Remove removes a download, and its files if deleteFiles is set.
+	Remove(ctx context.Context, id string, deleteFiles bool) error
+}
+
+// Config configures a download client.
+type Config struct {
+	Name     string
+	Type     string // qbittorrent or transmission
+	URL      string // base URL of the web UI, such as http://localhost:8080
+	Username string
+	Password string
+	// Category is the category downloads are filed under when none is
+	// given.
+	Category string
+}
+
+// New creates a client of the configured type.
+func New(cfg Config, httpClient *http.Client) (Client, error) {
+	switch cfg.Type {
+	case TypeQBittorrent:
+		return NewQBittorrent(cfg, httpClient), nil
+	case TypeTransmission:
+		return NewTransmission(cfg, httpClient), nil
+	default:
+		return nil, fmt.Errorf("unknown download client type %q", cfg.Type)
+	}
+}
+
+// Clients selects the download client of a download: the one it names, or
+// the default client.
+type Clients struct {
+	clients     map[string]Client
+	defaultName string
+}
+
+// NewClients creates a set of clients with a default. An empty default
+// uses the client if there is only one.
+func NewClients(defaultName string, clients ...Client) (*Clients, error) {
+	c := &Clients{clients: make(map[string]Client, len(clients)), defaultName: defaultName}
+	for _, client := range clients {
+		if _, ok := c.clients[client.Name()]; ok {
+			return nil, fmt.Errorf("duplicate download client %s", client.Name())
+		}
+		c.clients[client.Name()] = client
+	}
+	if defaultName == "" && len(clients) == 1 {
+		c.defaultName = clients[0].Name()
+	}
+	if c.defaultName != "" {
+		if _, ok := c.clients[c.defaultName]; !ok {
+			return nil, fmt.Errorf("default download client %s is not configured", c.defaultName)
+		}
+	}
+	return c, nil
+}
+
+// For returns the named client, or the default client if name is empty.
+func (c *Clients) For(name string) (Client, error) {
+	if name == "" {
+		name = c.defaultName
+	}
+	if name == "" {
+		return nil, errors.New("no download client selected and no default configured")
+	}
+	client, ok := c.clients[name]
+	if !ok {
+		return nil, fmt.Errorf("download client %s is not configured", name)
+	}
+	return client, nil
+}
+
+// Names returns the names of the clients, sorted.
+func (c *Clients) Names() []string {
+	names := make([]string, 0, len(c.clients))
+	for name := range c.clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
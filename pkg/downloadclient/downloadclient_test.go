@@ -0,0 +1,367 @@
+package downloadclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/pkg/downloadclient"
+	"github.com/narwhalmedia/narwhal/pkg/logger"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+const hash = "0123456789abcdef0123456789abcdef01234567"
+
+// fakeQBittorrent serves the parts of the qBittorrent Web API the client
+// uses, expiring the session after the first request it serves.
+type fakeQBittorrent struct {
+	mu         sync.Mutex
+	logins     int
+	category   string
+	state      string
+	categories map[string]bool
+	tags       string
+	deleted    bool
+	expired    bool
+}
+
+func (f *fakeQBittorrent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path == "/api/v2/auth/login" {
+		if r.FormValue("username") != "admin" || r.FormValue("password") != "secret" {
+			_, _ = w.Write([]byte("Fails."))
+			return
+		}
+		f.logins++
+		f.expired = false
+		http.SetCookie(w, &http.Cookie{Name: "SID", Value: "session"})
+		_, _ = w.Write([]byte("Ok."))
+		return
+	}
+	if cookie, err := r.Cookie("SID"); err != nil || cookie.Value != "session" || f.expired {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/api/v2/torrents/createCategory":
+		if f.categories[r.FormValue("category")] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.categories[r.FormValue("category")] = true
+	case "/api/v2/torrents/add":
+		f.category = r.FormValue("category")
+		f.tags = r.FormValue("tags")
+		f.state = "metaDL"
+		f.expired = true
+	case "/api/v2/torrents/setCategory":
+		f.category = r.FormValue("category")
+	case "/api/v2/torrents/deleteTags":
+		f.tags = ""
+	case "/api/v2/torrents/delete":
+		f.deleted = r.FormValue("deleteFiles") == "true"
+	case "/api/v2/torrents/info":
+		query := r.URL.Query()
+		if f.state == "" ||
+			(query.Has("tag") && query.Get("tag") != f.tags) ||
+			(query.Has("category") && query.Get("category") != f.category) {
+			_, _ = w.Write([]byte("[]"))
+			return
+		}
+		_ = json.NewEncoder(w).Encode([]map[string]any{{
+			"hash":         strings.ToUpper(hash),
+			"name":         "Movie.2024.1080p",
+			"category":     f.category,
+			"state":        f.state,
+			"progress":     0.5,
+			"size":         1000,
+			"completed":    500,
+			"dlspeed":      100,
+			"eta":          8640000,
+			"save_path":    "/downloads",
+			"content_path": "/downloads/Movie.2024.1080p",
+			"amount_left":  500,
+		}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestQBittorrent(t *testing.T) {
+	fake := &fakeQBittorrent{categories: map[string]bool{"movies": true}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	ctx := context.Background()
+	client, err := downloadclient.New(downloadclient.Config{
+		Name:     "qbit",
+		Type:     downloadclient.TypeQBittorrent,
+		URL:      server.URL,
+		Username: "admin",
+		Password: "secret",
+		Category: "narwhal",
+	}, server.Client())
+	require.NoError(t, err)
+
+	id, err := client.Add(ctx, downloadclient.AddRequest{URL: "magnet:?xt=urn:btih:" + hash})
+	require.NoError(t, err)
+	assert.Equal(t, hash, id)
+	assert.Equal(t, "narwhal", fake.category)
+	assert.True(t, fake.categories["narwhal"])
+	assert.Empty(t, fake.tags, "lookup tag is removed")
+
+	status, err := client.Get(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, 2, fake.logins, "expired session is renewed")
+	assert.Equal(t, models.DownloadStatusQueued, status.State)
+	assert.Equal(t, -1, status.ETA)
+
+	fake.state = "stalledDL"
+	statuses, err := client.List(ctx, "narwhal")
+	require.NoError(t, err)
+	require.Len(t, statuses, 1)
+	assert.Equal(t, models.DownloadStatusDownloading, statuses[0].State)
+	assert.False(t, statuses[0].Completed)
+
+	require.NoError(t, client.SetCategory(ctx, id, "movies"))
+	statuses, err = client.List(ctx, "narwhal")
+	require.NoError(t, err)
+	assert.Empty(t, statuses)
+
+	fake.state = "stalledUP"
+	status, err = client.Get(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, models.DownloadStatusCompleted, status.State)
+	assert.True(t, status.Completed)
+	assert.Equal(t, "movies", status.Category)
+
+	download := &models.Download{}
+	status.Apply(download)
+	assert.Equal(t, float32(0.5), download.Progress)
+	assert.Equal(t, "/downloads/Movie.2024.1080p", download.OutputPath)
+
+	require.NoError(t, client.Remove(ctx, id, true))
+	assert.True(t, fake.deleted)
+}
+
+func TestQBittorrent_LoginFailure(t *testing.T) {
+	server := httptest.NewServer(&fakeQBittorrent{})
+	defer server.Close()
+
+	client := downloadclient.NewQBittorrent(downloadclient.Config{
+		Name:     "qbit",
+		URL:      server.URL,
+		Username: "admin",
+		Password: "wrong",
+	}, server.Client())
+
+	_, err := client.List(context.Background(), "")
+	assert.ErrorContains(t, err, "failed to log in")
+}
+
+// fakeTransmission serves the parts of the Transmission RPC API the client
+// uses.
+type fakeTransmission struct {
+	mu       sync.Mutex
+	torrents map[string]map[string]any
+	removed  bool
+}
+
+func (f *fakeTransmission) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if user, pass, _ := r.BasicAuth(); user != "admin" || pass != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Header.Get("X-Transmission-Session-Id") != "abc" {
+		w.Header().Set("X-Transmission-Session-Id", "abc")
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	var req struct {
+		Method    string         `json:"method"`
+		Arguments map[string]any `json:"arguments"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	args := map[string]any{}
+	switch req.Method {
+	case "torrent-add":
+		f.torrents[hash] = map[string]any{
+			"hashString":    hash,
+			"name":          "Show.S01E01",
+			"labels":        req.Arguments["labels"],
+			"status":        4,
+			"percentDone":   0.25,
+			"sizeWhenDone":  400,
+			"leftUntilDone": 300,
+			"haveValid":     100,
+			"rateDownload":  10,
+			"eta":           -1,
+			"downloadDir":   "/downloads",
+		}
+		args["torrent-added"] = map[string]any{"hashString": hash, "name": "Show.S01E01"}
+	case "torrent-get":
+		var torrents []map[string]any
+		for _, torrent := range f.torrents {
+			torrents = append(torrents, torrent)
+		}
+		args["torrents"] = torrents
+	case "torrent-set":
+		f.torrents[hash]["labels"] = req.Arguments["labels"]
+	case "torrent-remove":
+		f.removed = req.Arguments["delete-local-data"] == true
+		delete(f.torrents, hash)
+	default:
+		_ = json.NewEncoder(w).Encode(map[string]any{"result": "method name not recognized"})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"result": "success", "arguments": args})
+}
+
+func TestTransmission(t *testing.T) {
+	fake := &fakeTransmission{torrents: map[string]map[string]any{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	ctx := context.Background()
+	client, err := downloadclient.New(downloadclient.Config{
+		Name:     "transmission",
+		Type:     downloadclient.TypeTransmission,
+		URL:      server.URL,
+		Username: "admin",
+		Password: "secret",
+	}, server.Client())
+	require.NoError(t, err)
+
+	id, err := client.Add(ctx, downloadclient.AddRequest{URL: "magnet:?xt=urn:btih:" + hash, Category: "tv"})
+	require.NoError(t, err)
+	assert.Equal(t, hash, id)
+
+	status, err := client.Get(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, models.DownloadStatusDownloading, status.State)
+	assert.Equal(t, "download", status.ClientState)
+	assert.Equal(t, "tv", status.Category)
+	assert.False(t, status.Completed)
+
+	require.NoError(t, client.SetCategory(ctx, id, "anime"))
+	statuses, err := client.List(ctx, "tv")
+	require.NoError(t, err)
+	assert.Empty(t, statuses)
+
+	fake.torrents[hash]["status"] = 6
+	fake.torrents[hash]["leftUntilDone"] = 0
+	fake.torrents[hash]["percentDone"] = 1
+	statuses, err = client.List(ctx, "anime")
+	require.NoError(t, err)
+	require.Len(t, statuses, 1)
+	assert.Equal(t, models.DownloadStatusCompleted, statuses[0].State)
+	assert.True(t, statuses[0].Completed)
+	assert.Equal(t, "/downloads/Show.S01E01", statuses[0].ContentPath)
+
+	fake.torrents[hash]["error"] = 3
+	fake.torrents[hash]["errorString"] = "No space left on device"
+	status, err = client.Get(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, models.DownloadStatusFailed, status.State)
+	assert.Equal(t, "No space left on device", status.Error)
+
+	require.NoError(t, client.Remove(ctx, id, true))
+	assert.True(t, fake.removed)
+	_, err = client.Get(ctx, id)
+	assert.ErrorIs(t, err, downloadclient.ErrNotFound)
+}
+
+// stubClient is a client whose downloads are set by the test.
+type stubClient struct {
+	name     string
+	statuses []*downloadclient.Status
+}
+
+func (c *stubClient) Name() string { return c.name }
+
+func (c *stubClient) Add(context.Context, downloadclient.AddRequest) (string, error) {
+	return "", nil
+}
+
+func (c *stubClient) Get(context.Context, string) (*downloadclient.Status, error) {
+	return nil, downloadclient.ErrNotFound
+}
+
+func (c *stubClient) List(context.Context, string) ([]*downloadclient.Status, error) {
+	return c.statuses, nil
+}
+
+func (c *stubClient) SetCategory(context.Context, string, string) error { return nil }
+
+func (c *stubClient) Remove(context.Context, string, bool) error { return nil }
+
+func TestClients(t *testing.T) {
+	qbit, transmission := &stubClient{name: "qbit"}, &stubClient{name: "transmission"}
+
+	clients, err := downloadclient.NewClients("", qbit)
+	require.NoError(t, err)
+	client, err := clients.For("")
+	require.NoError(t, err)
+	assert.Same(t, qbit, client)
+
+	clients, err = downloadclient.NewClients("", qbit, transmission)
+	require.NoError(t, err)
+	_, err = clients.For("")
+	assert.Error(t, err, "no default with several clients")
+	client, err = clients.For("transmission")
+	require.NoError(t, err)
+	assert.Same(t, transmission, client)
+	assert.Equal(t, []string{"qbit", "transmission"}, clients.Names())
+
+	_, err = downloadclient.NewClients("sabnzbd", qbit)
+	assert.Error(t, err)
+	_, err = downloadclient.NewClients("", qbit, qbit)
+	assert.Error(t, err)
+}
+
+func TestWatcher_ReportsCompletedDownloadsOnce(t *testing.T) {
+	client := &stubClient{name: "qbit", statuses: []*downloadclient.Status{
+		{ID: "a", Completed: true},
+		{ID: "b"},
+	}}
+	clients, err := downloadclient.NewClients("", client)
+	require.NoError(t, err)
+
+	var completed []string
+	watcher := downloadclient.NewWatcher(clients, "", func(_ context.Context, _ downloadclient.Client, s *downloadclient.Status) {
+		completed = append(completed, s.ID)
+	}, logger.NewNoopLogger())
+
+	ctx := context.Background()
+	watcher.Poll(ctx)
+	assert.Equal(t, []string{"a"}, completed)
+
+	client.statuses[1].Completed = true
+	watcher.Poll(ctx)
+	assert.Equal(t, []string{"a", "b"}, completed)
+
+	// A download removed and added again is reported again
+	client.statuses = client.statuses[1:]
+	watcher.Poll(ctx)
+	client.statuses = append(client.statuses, &downloadclient.Status{ID: "a", Completed: true})
+	watcher.Poll(ctx)
+	assert.Equal(t, []string{"a", "b", "a"}, completed)
+}
@@ -0,0 +1,62 @@
+package downloadclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const formContentType = "application/x-www-form-urlencoded"
+
+// maxResponseSize bounds the responses read from clients. Listing thousands
+// of torrents stays well below it.
+const maxResponseSize = 32 << 20
+
+// StatusError is returned for responses with a non-2xx status.
+type StatusError struct {
+	StatusCode int
+	Header     http.Header
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("unexpected status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("unexpected status %d: %s", e.StatusCode, e.Body)
+}
+
+// HTTPStatus returns the status of the response, which classifies the
+// failure for retries.
+func (e *StatusError) HTTPStatus() int {
+	return e.StatusCode
+}
+
+func isStatus(err error, code int) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == code
+}
+
+// readResponse sends a request and reads its body, returning a StatusError
+// for non-2xx responses.
+func readResponse(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body := string(data)
+		if len(body) > 256 {
+			body = body[:256]
+		}
+		return nil, &StatusError{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}
+	}
+	return data, nil
+}
@@ -0,0 +1,318 @@
+package downloadclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// QBittorrent is a qBittorrent client, driven through its Web API v2.
+type QBittorrent struct {
+	cfg    Config
+	client *http.Client
+
+	mu  sync.Mutex
+	sid string // session cookie
+}
+
+var _ Client = (*QBittorrent)(nil)
+
+// NewQBittorrent creates a qBittorrent client.
+func NewQBittorrent(cfg Config, client *http.Client) *QBittorrent {
+	return &QBittorrent{
+		cfg:    cfg,
+		client: client,
+	}
+}
+
+// Name returns the name the client is configured under.
+func (q *QBittorrent) Name() string {
+	return q.cfg.Name
+}
+
+// Add hands a download to qBittorrent. The Web API does not return the
+// hash of added torrents, so the download is tagged and looked up by tag.
+func (q *QBittorrent) Add(ctx context.Context, req AddRequest) (string, error) {
+	category := req.Category
+	if category == "" {
+		category = q.cfg.Category
+	}
+	if category != "" {
+		if err := q.createCategory(ctx, category); err != nil {
+			return "", err
+		}
+	}
+
+	tag := "narwhal-" + uuid.NewString()
+	fields := map[string]string{
+		"urls": req.URL,
+		"tags": tag,
+	}
+	if category != "" {
+		fields["category"] = category
+	}
+	if req.SavePath != "" {
+		fields["savepath"] = req.SavePath
+	}
+	if req.Paused {
+		// paused before qBittorrent 5, stopped since
+		fields["paused"] = "true"
+		fields["stopped"] = "true"
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for key, value := range fields {
+		if err := form.WriteField(key, value); err != nil {
+			return "", err
+		}
+	}
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+
+	resp, err := q.do(ctx, "/api/v2/torrents/add", form.FormDataContentType(), body.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("failed to add download: %w", err)
+	}
+	// qBittorrent answers 200 "Fails." for torrents it rejects
+	if strings.TrimSpace(string(resp)) == "Fails." {
+		return "", fmt.Errorf("qBittorrent rejected %s", req.URL)
+	}
+
+	torrents, err := q.info(ctx, url.Values{"tag": {tag}})
+	if err != nil {
+		return "", err
+	}
+	if len(torrents) == 0 {
+		return "", fmt.Errorf("added download not found in qBittorrent")
+	}
+
+	hash := strings.ToLower(torrents[0].Hash)
+	// The tag was only needed to find the torrent
+	_, _ = q.do(ctx, "/api/v2/torrents/deleteTags", formContentType, []byte(url.Values{"tags": {tag}}.Encode()))
+	return hash, nil
+}
+
+// Get returns the state of a download.
+func (q *QBittorrent) Get(ctx context.Context, id string) (*Status, error) {
+	torrents, err := q.info(ctx, url.Values{"hashes": {strings.ToLower(id)}})
+	if err != nil {
+		return nil, err
+	}
+	if len(torrents) == 0 {
+		return nil, ErrNotFound
+	}
+	return torrents[0].status(), nil
+}
+
+// List returns the downloads in a category, or all downloads.
+func (q *QBittorrent) List(ctx context.Context, category string) ([]*Status, error) {
+	query := url.Values{}
+	if category != "" {
+		query.Set("category", category)
+	}
+	torrents, err := q.info(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*Status, len(torrents))
+	for i, torrent := range torrents {
+		statuses[i] = torrent.status()
+	}
+	return statuses, nil
+}
+
+// SetCategory moves a download to another category, creating the category
+// if needed.
+func (q *QBittorrent) SetCategory(ctx context.Context, id, category string) error {
+	if category != "" {
+		if err := q.createCategory(ctx, category); err != nil {
+			return err
+		}
+	}
+	form := url.Values{"hashes": {strings.ToLower(id)}, "category": {category}}
+	if _, err := q.do(ctx, "/api/v2/torrents/setCategory", formContentType, []byte(form.Encode())); err != nil {
+		return fmt.Errorf("failed to set category: %w", err)
+	}
+	return nil
+}
+
+// Remove removes a download, and its files if deleteFiles is set.
+func (q *QBittorrent) Remove(ctx context.Context, id string, deleteFiles bool) error {
+	form := url.Values{"hashes": {strings.ToLower(id)}, "deleteFiles": {fmt.Sprint(deleteFiles)}}
+	if _, err := q.do(ctx, "/api/v2/torrents/delete", formContentType, []byte(form.Encode())); err != nil {
+		return fmt.Errorf("failed to remove download: %w", err)
+	}
+	return nil
+}
+
+// createCategory creates a category. Existing categories are left alone.
+func (q *QBittorrent) createCategory(ctx context.Context, category string) error {
+	form := url.Values{"category": {category}}
+	_, err := q.do(ctx, "/api/v2/torrents/createCategory", formContentType, []byte(form.Encode()))
+	if err != nil && !isStatus(err, http.StatusConflict) {
+		return fmt.Errorf("failed to create category: %w", err)
+	}
+	return nil
+}
+
+func (q *QBittorrent) info(ctx context.Context, query url.Values) ([]qbittorrentTorrent, error) {
+	resp, err := q.do(ctx, "/api/v2/torrents/info?"+query.Encode(), "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list downloads: %w", err)
+	}
+
+	var torrents []qbittorrentTorrent
+	if err := json.Unmarshal(resp, &torrents); err != nil {
+		return nil, fmt.Errorf("failed to decode downloads: %w", err)
+	}
+	return torrents, nil
+}
+
+// do sends a request, logging in first if there is no session and again
+// once if the session expired. Requests without a body are GETs.
+func (q *QBittorrent) do(ctx context.Context, path, contentType string, body []byte) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		sid, err := q.session(ctx, attempt > 0)
+		if err != nil {
+			return nil, err
+		}
+
+		method := http.MethodGet
+		if body != nil {
+			method = http.MethodPost
+		}
+		req, err := http.NewRequestWithContext(ctx, method, q.url(path), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if sid != "" {
+			req.AddCookie(&http.Cookie{Name: "SID", Value: sid})
+		}
+		// qBittorrent refuses requests whose Referer or Origin do not
+		// match its host when CSRF protection is on
+		req.Header.Set("Referer", q.url("/"))
+
+		data, err := readResponse(q.client, req)
+		if isStatus(err, http.StatusForbidden) && attempt == 0 {
+			continue
+		}
+		return data, err
+	}
+}
+
+// session returns the session cookie, logging in if there is none or
+// renew is set.
+func (q *QBittorrent) session(ctx context.Context, renew bool) (string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.sid != "" && !renew {
+		return q.sid, nil
+	}
+
+	form := url.Values{"username": {q.cfg.Username}, "password": {q.cfg.Password}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, q.url("/api/v2/auth/login"),
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", formContentType)
+	req.Header.Set("Referer", q.url("/"))
+
+	resp, err := q.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to log in to qBittorrent: %w", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	if resp.StatusCode != http.StatusOK || strings.TrimSpace(string(data)) == "Fails." {
+		return "", fmt.Errorf("failed to log in to qBittorrent: status %d", resp.StatusCode)
+	}
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "SID" {
+			q.sid = cookie.Value
+		}
+	}
+	// Instances that bypass authentication for the host set no cookie
+	return q.sid, nil
+}
+
+func (q *QBittorrent) url(path string) string {
+	return strings.TrimSuffix(q.cfg.URL, "/") + path
+}
+
+// qbittorrentTorrent is a torrent in /api/v2/torrents/info.
+type qbittorrentTorrent struct {
+	Hash        string  `json:"hash"`
+	Name        string  `json:"name"`
+	Category    string  `json:"category"`
+	State       string  `json:"state"`
+	Progress    float64 `json:"progress"`
+	Size        int64   `json:"size"`
+	Completed   int64   `json:"completed"`
+	DlSpeed     int64   `json:"dlspeed"`
+	ETA         int     `json:"eta"`
+	SavePath    string  `json:"save_path"`
+	ContentPath string  `json:"content_path"`
+	AmountLeft  int64   `json:"amount_left"`
+}
+
+// qbittorrentInfiniteETA is the ETA qBittorrent reports when it has none.
+const qbittorrentInfiniteETA = 8640000
+
+func (t *qbittorrentTorrent) status() *Status {
+	s := &Status{
+		ID:            strings.ToLower(t.Hash),
+		Name:          t.Name,
+		Category:      t.Category,
+		ClientState:   t.State,
+		Progress:      float32(t.Progress),
+		Size:          t.Size,
+		Downloaded:    t.Completed,
+		DownloadSpeed: t.DlSpeed,
+		ETA:           t.ETA,
+		SavePath:      t.SavePath,
+		ContentPath:   t.ContentPath,
+	}
+	if s.ETA >= qbittorrentInfiniteETA {
+		s.ETA = -1
+	}
+
+	switch t.State {
+	case "error", "missingFiles":
+		s.State = models.DownloadStatusFailed
+		s.Error = "qBittorrent reports " + t.State
+	case "queuedDL", "checkingDL", "metaDL", "forcedMetaDL", "allocating", "checkingResumeData", "moving", "unknown":
+		s.State = models.DownloadStatusQueued
+	case "uploading", "stalledUP", "queuedUP", "forcedUP", "pausedUP", "stoppedUP", "checkingUP":
+		s.State = models.DownloadStatusCompleted
+		s.Completed = true
+	default: // downloading, stalledDL, forcedDL, pausedDL, stoppedDL
+		s.State = models.DownloadStatusDownloading
+	}
+	// Torrents with only some files wanted finish before progress reaches 1
+	if !s.Completed && t.AmountLeft == 0 && t.Progress > 0 && s.State != models.DownloadStatusFailed &&
+		s.State != models.DownloadStatusQueued {
+		s.State = models.DownloadStatusCompleted
+		s.Completed = true
+	}
+	return s
+}
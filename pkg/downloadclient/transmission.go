@@ -0,0 +1,326 @@
+package downloadclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+const transmissionSessionHeader = "X-Transmission-Session-Id"
+
+// transmissionFields are the torrent fields read by torrent-get.
+var transmissionFields = []string{
+	"hashString", "name", "labels", "status", "error", "errorString",
+	"percentDone", "sizeWhenDone", "leftUntilDone", "haveValid", "rateDownload",
+	"eta", "downloadDir", "isFinished",
+}
+
+// Transmission is a Transmission client, driven through its RPC API.
+// Categories map onto torrent labels; narwhal keeps the category as the
+// first label.
+type Transmission struct {
+	cfg    Config
+	client *http.Client
+
+	mu        sync.Mutex
+	sessionID string
+}
+
+var _ Client = (*Transmission)(nil)
+
+// NewTransmission creates a Transmission client.
+func NewTransmission(cfg Config, client *http.Client) *Transmission {
+	return &Transmission{
+		cfg:    cfg,
+		client: client,
+	}
+}
+
+// Name returns the name the client is configured under.
+func (t *Transmission) Name() string {
+	return t.cfg.Name
+}
+
+// Add hands a download to Transmission.
+func (t *Transmission) Add(ctx context.Context, req AddRequest) (string, error) {
+	category := req.Category
+	if category == "" {
+		category = t.cfg.Category
+	}
+
+	args := map[string]any{
+		"filename": req.URL,
+		"paused":   req.Paused,
+	}
+	if category != "" {
+		args["labels"] = []string{category}
+	}
+	if req.SavePath != "" {
+		args["download-dir"] = req.SavePath
+	}
+
+	var result struct {
+		Added     *transmissionTorrent `json:"torrent-added"`
+		Duplicate *transmissionTorrent `json:"torrent-duplicate"`
+	}
+	if err := t.call(ctx, "torrent-add", args, &result); err != nil {
+		return "", fmt.Errorf("failed to add download: %w", err)
+	}
+
+	added := result.Added
+	if added == nil {
+		added = result.Duplicate
+	}
+	if added == nil {
+		return "", fmt.Errorf("transmission returned no torrent for %s", req.URL)
+	}
+	// Labels are ignored by torrent-add before Transmission 4
+	if category != "" {
+		if err := t.SetCategory(ctx, added.HashString, category); err != nil {
+			return "", err
+		}
+	}
+	return strings.ToLower(added.HashString), nil
+}
+
+// Get returns the state of a download.
+func (t *Transmission) Get(ctx context.Context, id string) (*Status, error) {
+	torrents, err := t.get(ctx, []string{strings.ToLower(id)})
+	if err != nil {
+		return nil, err
+	}
+	if len(torrents) == 0 {
+		return nil, ErrNotFound
+	}
+	return torrents[0].status(), nil
+}
+
+// List returns the downloads labelled with a category, or all downloads.
+func (t *Transmission) List(ctx context.Context, category string) ([]*Status, error) {
+	torrents, err := t.get(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []*Status
+	for _, torrent := range torrents {
+		s := torrent.status()
+		if category != "" && s.Category != category {
+			continue
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
+
+// SetCategory moves a download to another category, replacing its first
+// label and keeping the others.
+func (t *Transmission) SetCategory(ctx context.Context, id, category string) error {
+	torrents, err := t.get(ctx, []string{strings.ToLower(id)})
+	if err != nil {
+		return err
+	}
+	if len(torrents) == 0 {
+		return ErrNotFound
+	}
+
+	labels := torrents[0].Labels
+	if len(labels) > 0 {
+		labels = labels[1:]
+	}
+	if category != "" {
+		labels = append([]string{category}, labels...)
+	}
+	if labels == nil {
+		labels = []string{}
+	}
+
+	args := map[string]any{
+		"ids":    []string{strings.ToLower(id)},
+		"labels": labels,
+	}
+	if err := t.call(ctx, "torrent-set", args, nil); err != nil {
+		return fmt.Errorf("failed to set category: %w", err)
+	}
+	return nil
+}
+
+// Remove removes a download, and its files if deleteFiles is set.
+func (t *Transmission) Remove(ctx context.Context, id string, deleteFiles bool) error {
+	args := map[string]any{
+		"ids":               []string{strings.ToLower(id)},
+		"delete-local-data": deleteFiles,
+	}
+	if err := t.call(ctx, "torrent-remove", args, nil); err != nil {
+		return fmt.Errorf("failed to remove download: %w", err)
+	}
+	return nil
+}
+
+// get returns the torrents with the given hashes, or all torrents.
+func (t *Transmission) get(ctx context.Context, ids []string) ([]transmissionTorrent, error) {
+	args := map[string]any{"fields": transmissionFields}
+	if ids != nil {
+		args["ids"] = ids
+	}
+
+	var result struct {
+		Torrents []transmissionTorrent `json:"torrents"`
+	}
+	if err := t.call(ctx, "torrent-get", args, &result); err != nil {
+		return nil, fmt.Errorf("failed to list downloads: %w", err)
+	}
+	return result.Torrents, nil
+}
+
+// call invokes an RPC method. Transmission answers 409 with a new session
+// ID when the session is missing or expired; the call is retried once with
+// it.
+func (t *Transmission) call(ctx context.Context, method string, args map[string]any, result any) error {
+	body, err := json.Marshal(map[string]any{"method": method, "arguments": args})
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url(), bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if t.cfg.Username != "" || t.cfg.Password != "" {
+			req.SetBasicAuth(t.cfg.Username, t.cfg.Password)
+		}
+		t.mu.Lock()
+		if t.sessionID != "" {
+			req.Header.Set(transmissionSessionHeader, t.sessionID)
+		}
+		t.mu.Unlock()
+
+		data, err := readResponse(t.client, req)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusConflict && attempt == 0 {
+			t.mu.Lock()
+			t.sessionID = statusErr.Header.Get(transmissionSessionHeader)
+			t.mu.Unlock()
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		var resp struct {
+			Result    string          `json:"result"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+		if resp.Result != "success" {
+			return fmt.Errorf("transmission: %s", resp.Result)
+		}
+		if result != nil && len(resp.Arguments) > 0 {
+			if err := json.Unmarshal(resp.Arguments, result); err != nil {
+				return fmt.Errorf("failed to decode response: %w", err)
+			}
+		}
+		return nil
+	}
+}
+
+func (t *Transmission) url() string {
+	base := strings.TrimSuffix(t.cfg.URL, "/")
+	if strings.HasSuffix(base, "/rpc") {
+		return base
+	}
+	return base + "/transmission/rpc"
+}
+
+// transmissionTorrent is a torrent in a torrent-get response.
+type transmissionTorrent struct {
+	HashString    string   `json:"hashString"`
+	Name          string   `json:"name"`
+	Labels        []string `json:"labels"`
+	Status        int      `json:"status"`
+	Error         int      `json:"error"`
+	ErrorString   string   `json:"errorString"`
+	PercentDone   float64  `json:"percentDone"`
+	SizeWhenDone  int64    `json:"sizeWhenDone"`
+	LeftUntilDone int64    `json:"leftUntilDone"`
+	HaveValid     int64    `json:"haveValid"`
+	RateDownload  int64    `json:"rateDownload"`
+	ETA           int      `json:"eta"`
+	DownloadDir   string   `json:"downloadDir"`
+	IsFinished    bool     `json:"isFinished"`
+}
+
+// Transmission torrent statuses.
+const (
+	transmissionStopped = iota
+	transmissionCheckWait
+	transmissionCheck
+	transmissionDownloadWait
+	transmissionDownload
+	transmissionSeedWait
+	transmissionSeed
+)
+
+var transmissionStates = map[int]string{
+	transmissionStopped:      "stopped",
+	transmissionCheckWait:    "check wait",
+	transmissionCheck:        "check",
+	transmissionDownloadWait: "download wait",
+	transmissionDownload:     "download",
+	transmissionSeedWait:     "seed wait",
+	transmissionSeed:         "seed",
+}
+
+// transmissionLocalError is the error class of local errors, such as a
+// full disk; 1 and 2 are tracker warnings and errors, which do not stop
+// the download.
+const transmissionLocalError = 3
+
+func (t *transmissionTorrent) status() *Status {
+	s := &Status{
+		ID:            strings.ToLower(t.HashString),
+		Name:          t.Name,
+		ClientState:   transmissionStates[t.Status],
+		Progress:      float32(t.PercentDone),
+		Size:          t.SizeWhenDone,
+		Downloaded:    t.HaveValid,
+		DownloadSpeed: t.RateDownload,
+		ETA:           t.ETA,
+		SavePath:      t.DownloadDir,
+		Completed:     t.LeftUntilDone == 0 && t.SizeWhenDone > 0,
+	}
+	if len(t.Labels) > 0 {
+		s.Category = t.Labels[0]
+	}
+	if s.ETA < 0 {
+		s.ETA = -1
+	}
+	if s.Completed {
+		s.ContentPath = path.Join(t.DownloadDir, t.Name)
+	}
+
+	switch {
+	case t.Error == transmissionLocalError:
+		s.State = models.DownloadStatusFailed
+		s.Error = t.ErrorString
+	case s.Completed:
+		s.State = models.DownloadStatusCompleted
+	case t.Status == transmissionCheckWait || t.Status == transmissionCheck || t.Status == transmissionDownloadWait:
+		s.State = models.DownloadStatusQueued
+	default: // downloading, or stopped before finishing
+		s.State = models.DownloadStatusDownloading
+	}
+	return s
+}
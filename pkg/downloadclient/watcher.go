@@ -0,0 +1,94 @@
+package downloadclient
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// CompletedFunc is called once for each download a watcher sees complete.
+type CompletedFunc func(ctx context.Context, client Client, status *Status)
+
+// Watcher polls download clients for downloads in a category and reports
+// each download once when it completes.
+type Watcher struct {
+	clients  *Clients
+	category string
+	onDone   CompletedFunc
+	logger   interfaces.Logger
+
+	mu       sync.Mutex
+	reported map[string]bool // client name + ID
+}
+
+// NewWatcher creates a watcher for the downloads in category across
+// clients. An empty category watches every download.
+func NewWatcher(clients *Clients, category string, onDone CompletedFunc, logger interfaces.Logger) *Watcher {
+	return &Watcher{
+		clients:  clients,
+		category: category,
+		onDone:   onDone,
+		logger:   logger,
+		reported: make(map[string]bool),
+	}
+}
+
+// Poll checks every client once and reports downloads that completed since
+// the last poll. Downloads that disappear from their client are forgotten.
+func (w *Watcher) Poll(ctx context.Context) {
+	for _, name := range w.clients.Names() {
+		client, _ := w.clients.For(name)
+		statuses, err := client.List(ctx, w.category)
+		if err != nil {
+			w.logger.Warn("Failed to poll download client",
+				interfaces.String("client", name),
+				interfaces.Error(err))
+			continue
+		}
+		w.check(ctx, client, statuses)
+	}
+}
+
+func (w *Watcher) check(ctx context.Context, client Client, statuses []*Status) {
+	seen := make(map[string]bool, len(statuses))
+	var completed []*Status
+
+	w.mu.Lock()
+	for _, s := range statuses {
+		key := client.Name() + "/" + s.ID
+		seen[key] = true
+		if s.Completed && !w.reported[key] {
+			w.reported[key] = true
+			completed = append(completed, s)
+		}
+	}
+	prefix := client.Name() + "/"
+	for key := range w.reported {
+		if strings.HasPrefix(key, prefix) && !seen[key] {
+			delete(w.reported, key)
+		}
+	}
+	w.mu.Unlock()
+
+	for _, s := range completed {
+		w.onDone(ctx, client, s)
+	}
+}
+
+// Run polls every interval until ctx is done.
+func (w *Watcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Poll(ctx)
+		}
+	}
+}
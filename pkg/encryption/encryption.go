@@ -6,45 +6,67 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 )
 
-// Encryptor provides AES-256-GCM encryption for sensitive data.
+// ciphertextPrefix marks values encrypted with a known key, as
+// "enc:<key id>:<base64>". Values encrypted before keys could be rotated
+// are bare base64.
+const ciphertextPrefix = "enc:"
+
+// Encryptor provides AES-256-GCM encryption for sensitive data. Values are
+// encrypted with the primary key; previous keys still decrypt values
+// encrypted before a key rotation until they are re-encrypted.
 type Encryptor struct {
+	primary  encryptionKey
+	previous []encryptionKey
+}
+
+type encryptionKey struct {
+	id  string
 	key []byte
 }
 
-// NewEncryptor creates a new encryptor with the provided key
-// The key will be hashed with SHA-256 to ensure it's exactly 32 bytes.
-func NewEncryptor(key string) (*Encryptor, error) {
+// NewEncryptor creates a new encryptor with the provided key and the keys
+// it replaced, newest first.
+// Keys are hashed with SHA-256 to ensure they are exactly 32 bytes.
+func NewEncryptor(key string, previousKeys ...string) (*Encryptor, error) {
 	if key == "" {
 		return nil, errors.New("encryption key cannot be empty")
 	}
 
-	// Hash the key to ensure it's exactly 32 bytes for AES-256
-	hash := sha256.Sum256([]byte(key))
+	e := &Encryptor{primary: deriveKey(key)}
+	for _, previous := range previousKeys {
+		if previous == "" || previous == key {
+			continue
+		}
+		e.previous = append(e.previous, deriveKey(previous))
+	}
+	return e, nil
+}
 
-	return &Encryptor{
-		key: hash[:],
-	}, nil
+// deriveKey hashes a key to the AES-256 key and identifies it by a hash of
+// that, so the ID tells nothing about the key.
+func deriveKey(key string) encryptionKey {
+	hash := sha256.Sum256([]byte(key))
+	id := sha256.Sum256(hash[:])
+	return encryptionKey{id: hex.EncodeToString(id[:4]), key: hash[:]}
 }
 
-// Encrypt encrypts plaintext using AES-256-GCM and returns base64 encoded ciphertext.
+// Encrypt encrypts plaintext using AES-256-GCM with the primary key and
+// returns it encoded with the key ID.
 func (e *Encryptor) Encrypt(plaintext string) (string, error) {
 	if plaintext == "" {
 		return "", nil
 	}
 
-	block, err := aes.NewCipher(e.key)
+	gcm, err := newGCM(e.primary.key)
 	if err != nil {
-		return "", fmt.Errorf("failed to create cipher: %w", err)
-	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", fmt.Errorf("failed to create GCM: %w", err)
+		return "", err
 	}
 
 	nonce := make([]byte, gcm.NonceSize())
@@ -54,28 +76,104 @@ func (e *Encryptor) Encrypt(plaintext string) (string, error) {
 
 	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
 
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	return ciphertextPrefix + e.primary.id + ":" + base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
-// Decrypt decrypts base64 encoded ciphertext using AES-256-GCM.
+// Decrypt decrypts ciphertext using the key it was encrypted with.
+// Ciphertexts from before key IDs were recorded are tried with every key.
 func (e *Encryptor) Decrypt(ciphertext string) (string, error) {
 	if ciphertext == "" {
 		return "", nil
 	}
 
-	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	id, encoded, ok := splitCiphertext(ciphertext)
+	if !ok {
+		// Legacy ciphertext: the first key that authenticates it is right
+		data, err := base64.StdEncoding.DecodeString(ciphertext)
+		if err != nil {
+			return "", fmt.Errorf("failed to decode ciphertext: %w", err)
+		}
+		var lastErr error
+		for _, k := range e.keys() {
+			plaintext, err := open(k.key, data)
+			if err == nil {
+				return plaintext, nil
+			}
+			lastErr = err
+		}
+		return "", lastErr
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
 	if err != nil {
 		return "", fmt.Errorf("failed to decode ciphertext: %w", err)
 	}
+	for _, k := range e.keys() {
+		if k.id == id {
+			return open(k.key, data)
+		}
+	}
+	return "", fmt.Errorf("ciphertext was encrypted with unknown key %s", id)
+}
+
+// NeedsRotation reports whether a ciphertext was encrypted with a key other
+// than the primary one, and should be re-encrypted.
+func (e *Encryptor) NeedsRotation(ciphertext string) bool {
+	if ciphertext == "" {
+		return false
+	}
+	id, _, ok := splitCiphertext(ciphertext)
+	return !ok || id != e.primary.id
+}
 
-	block, err := aes.NewCipher(e.key)
+// Rotate re-encrypts a ciphertext with the primary key.
+func (e *Encryptor) Rotate(ciphertext string) (string, error) {
+	plaintext, err := e.Decrypt(ciphertext)
 	if err != nil {
-		return "", fmt.Errorf("failed to create cipher: %w", err)
+		return "", err
+	}
+	return e.Encrypt(plaintext)
+}
+
+// IsEncrypted reports whether a value is a ciphertext produced by Encrypt,
+// as opposed to a plaintext stored before its column was encrypted.
+// Legacy bare base64 ciphertexts are not recognized.
+func IsEncrypted(value string) bool {
+	_, _, ok := splitCiphertext(value)
+	return ok
+}
+
+func (e *Encryptor) keys() []encryptionKey {
+	return append([]encryptionKey{e.primary}, e.previous...)
+}
+
+// splitCiphertext returns the key ID and base64 data of a ciphertext.
+func splitCiphertext(ciphertext string) (id, data string, ok bool) {
+	rest, ok := strings.CutPrefix(ciphertext, ciphertextPrefix)
+	if !ok {
+		return "", "", false
+	}
+	return strings.Cut(rest, ":")
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
 	}
 
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
-		return "", fmt.Errorf("failed to create GCM: %w", err)
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return gcm, nil
+}
+
+// open decrypts the nonce and sealed data of a ciphertext.
+func open(key, data []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
 	}
 
 	nonceSize := gcm.NonceSize()
@@ -183,3 +183,50 @@ func TestDifferentKeys(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, plaintext, decrypted)
 }
+
+func TestKeyRotation(t *testing.T) {
+	old, err := NewEncryptor("old-key")
+	require.NoError(t, err)
+	encrypted, err := old.Encrypt("secret-api-key")
+	require.NoError(t, err)
+	assert.False(t, old.NeedsRotation(encrypted))
+
+	rotated, err := NewEncryptor("new-key", "old-key")
+	require.NoError(t, err)
+
+	// Values encrypted with a previous key still decrypt
+	decrypted, err := rotated.Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "secret-api-key", decrypted)
+	assert.True(t, rotated.NeedsRotation(encrypted))
+
+	reencrypted, err := rotated.Rotate(encrypted)
+	require.NoError(t, err)
+	assert.False(t, rotated.NeedsRotation(reencrypted))
+
+	// Once the old key is dropped, only re-encrypted values decrypt
+	current, err := NewEncryptor("new-key")
+	require.NoError(t, err)
+	_, err = current.Decrypt(encrypted)
+	require.Error(t, err)
+	decrypted, err = current.Decrypt(reencrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "secret-api-key", decrypted)
+}
+
+func TestLegacyCiphertext(t *testing.T) {
+	// Ciphertexts written before key IDs were recorded are bare base64
+	enc, err := NewEncryptor("new-key", "legacy-key")
+	require.NoError(t, err)
+	legacy, err := NewEncryptor("legacy-key")
+	require.NoError(t, err)
+	encrypted, err := legacy.Encrypt("secret-api-key")
+	require.NoError(t, err)
+	_, bare, _ := splitCiphertext(encrypted)
+
+	assert.False(t, IsEncrypted(bare))
+	assert.True(t, enc.NeedsRotation(bare))
+	decrypted, err := enc.Decrypt(bare)
+	require.NoError(t, err)
+	assert.Equal(t, "secret-api-key", decrypted)
+}
@@ -0,0 +1,134 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// DefaultActivityFeedSize is the number of recent activities a service keeps.
+const DefaultActivityFeedSize = 500
+
+// Activity kinds.
+const (
+	ActivityLogin   = "login"
+	ActivityScan    = "scan"
+	ActivityImport  = "import"
+	ActivityFailure = "failure"
+)
+
+// activityKinds maps the notable event types to the kind of activity they
+// record. Status changes only count when the entity failed.
+var activityKinds = map[string]string{
+	"user.logged_in":               ActivityLogin,
+	"library.scan.completed":       ActivityScan,
+	"library.imported":             ActivityImport,
+	"media.status_changed":         ActivityFailure,
+	"download.status_changed":      ActivityFailure,
+	"transcode_job.status_changed": ActivityFailure,
+}
+
+// failedStatuses are the statuses of failed entities.
+var failedStatuses = map[string]bool{
+	"error":  true,
+	"failed": true,
+}
+
+// Activity is a notable event shown in the admin activity feed.
+type Activity struct {
+	ID          string
+	Kind        string
+	EventType   string
+	AggregateID string
+	OccurredAt  time.Time
+	Payload     map[string]interface{}
+}
+
+// ActivityFeed keeps the most recent notable events of a service, such as
+// logins, scans, imports and failures.
+type ActivityFeed struct {
+	mu         sync.Mutex
+	activities []Activity
+	next       int
+}
+
+// NewActivityFeed creates a feed holding the last size activities.
+func NewActivityFeed(size int) *ActivityFeed {
+	if size < 1 {
+		size = DefaultActivityFeedSize
+	}
+	return &ActivityFeed{activities: make([]Activity, 0, size)}
+}
+
+// Subscribe records the notable events published on bus.
+func (f *ActivityFeed) Subscribe(bus interfaces.EventBus) error {
+	consumer := NewConsumer("activity.feed", 1, func(_ context.Context, env *Envelope) error {
+		f.Record(env)
+		return nil
+	})
+	for eventType := range activityKinds {
+		if err := bus.Subscribe(eventType, consumer); err != nil {
+			return fmt.Errorf("failed to subscribe to %s: %w", eventType, err)
+		}
+	}
+	return nil
+}
+
+// Record adds an event to the feed if it is notable.
+func (f *ActivityFeed) Record(env *Envelope) {
+	kind, ok := activityKinds[env.Type]
+	if !ok {
+		return
+	}
+	if kind == ActivityFailure {
+		to, _ := env.Data["to"].(string)
+		if !failedStatuses[to] {
+			return
+		}
+	}
+
+	activity := Activity{
+		ID:          env.ID,
+		Kind:        kind,
+		EventType:   env.Type,
+		AggregateID: env.AggID,
+		OccurredAt:  env.OccurredAt,
+		Payload:     env.Data,
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.activities) < cap(f.activities) {
+		f.activities = append(f.activities, activity)
+		return
+	}
+	f.activities[f.next] = activity
+	f.next = (f.next + 1) % len(f.activities)
+}
+
+// List returns activities newest first, optionally filtered by kind and
+// limited to those that occurred after since.
+func (f *ActivityFeed) List(kind string, since time.Time, limit int) []Activity {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var activities []Activity
+	for i := len(f.activities) - 1; i >= 0; i-- {
+		activity := f.activities[(f.next+i)%len(f.activities)]
+		if kind != "" && activity.Kind != kind {
+			continue
+		}
+		if !since.IsZero() && !activity.OccurredAt.After(since) {
+			continue
+		}
+		activities = append(activities, activity)
+		if limit > 0 && len(activities) == limit {
+			break
+		}
+	}
+	return activities
+}
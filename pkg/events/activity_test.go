@@ -0,0 +1,51 @@
+package events_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/logger"
+)
+
+func TestActivityFeed(t *testing.T) {
+	ctx := context.Background()
+	bus := events.NewPublisher(events.NewInMemoryEventBus(logger.NewNoopLogger()), logger.NewNoopLogger())
+	feed := events.NewActivityFeed(2)
+	require.NoError(t, feed.Subscribe(bus))
+
+	require.NoError(t, bus.Publish(ctx, events.NewEvent("user.logged_in", map[string]interface{}{
+		"user_id":  "u1",
+		"username": "alice",
+	})))
+	// Status changes are only notable when the entity failed
+	require.NoError(t, bus.Publish(ctx, events.NewAggregateEvent("media.status_changed", "m1", map[string]interface{}{
+		"entity_id": "m1", "from": "pending", "to": "available",
+	})))
+	require.NoError(t, bus.Publish(ctx, events.NewAggregateEvent("media.status_changed", "m2", map[string]interface{}{
+		"entity_id": "m2", "from": "pending", "to": "error", "reason": "probe failed",
+	})))
+
+	activities := feed.List("", time.Time{}, 0)
+	require.Len(t, activities, 2)
+	assert.Equal(t, events.ActivityFailure, activities[0].Kind)
+	assert.Equal(t, "m2", activities[0].AggregateID)
+	assert.Equal(t, events.ActivityLogin, activities[1].Kind)
+	assert.Equal(t, "alice", activities[1].Payload["username"])
+
+	// The oldest activity drops out once the feed is full
+	require.NoError(t, bus.Publish(ctx, events.NewAggregateEvent("download.status_changed", "d1", map[string]interface{}{
+		"entity_id": "d1", "from": "downloading", "to": "failed",
+	})))
+	activities = feed.List("", time.Time{}, 0)
+	require.Len(t, activities, 2)
+	assert.Equal(t, "d1", activities[0].AggregateID)
+	assert.Equal(t, "m2", activities[1].AggregateID)
+
+	assert.Empty(t, feed.List(events.ActivityLogin, time.Time{}, 0))
+	assert.Len(t, feed.List(events.ActivityFailure, time.Time{}, 1), 1)
+}
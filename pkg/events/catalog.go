@@ -0,0 +1,159 @@
+package events
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Schema describes the payload of one event type. Payload schemas live in
+// api/proto/events/v1.
+type Schema struct {
+	Type          string
+	Version       uint32
+	AggregateType string
+	// Payload is the fully-qualified protobuf message of the payload.
+	Payload string
+}
+
+// payloadPackage is the protobuf package holding event payloads.
+const payloadPackage = "narwhal.events.v1."
+
+var (
+	catalogMu sync.RWMutex
+	catalog   = defaultCatalog()
+)
+
+// defaultCatalog lists every event published by the services in this repo.
+func defaultCatalog() map[string]Schema {
+	defaultSchemas := []Schema{
+		// User service
+		{Type: "user.created", Version: 1, AggregateType: "user", Payload: "UserCreated"},
+		{Type: "user.registered", Version: 1, AggregateType: "user", Payload: "UserRegistered"},
+		{Type: "user.updated", Version: 1, AggregateType: "user", Payload: "UserUpdated"},
+		{Type: "user.deleted", Version: 1, AggregateType: "user", Payload: "UserRemoved"},
+		{Type: "user.registration_rejected", Version: 1, AggregateType: "user", Payload: "UserRemoved"},
+		{Type: "user.activated", Version: 1, AggregateType: "user", Payload: "UserChanged"},
+		{Type: "user.deactivated", Version: 1, AggregateType: "user", Payload: "UserChanged"},
+		{Type: "user.email_verified", Version: 1, AggregateType: "user", Payload: "UserChanged"},
+		{Type: "user.registration_approved", Version: 1, AggregateType: "user", Payload: "UserChanged"},
+		{Type: "user.password_changed", Version: 1, AggregateType: "user", Payload: "UserChanged"},
+		{Type: "user.logged_out_all", Version: 1, AggregateType: "user", Payload: "UserChanged"},
+		{Type: "user.totp_enabled", Version: 1, AggregateType: "user", Payload: "UserChanged"},
+		{Type: "user.totp_disabled", Version: 1, AggregateType: "user", Payload: "UserChanged"},
+		{Type: "user.role_assigned", Version: 1, AggregateType: "user", Payload: "UserRoleChanged"},
+		{Type: "user.role_removed", Version: 1, AggregateType: "user", Payload: "UserRoleChanged"},
+		{Type: "user.logged_in", Version: 1, AggregateType: "user", Payload: "UserLoggedIn"},
+		{Type: "user.new_sign_in", Version: 1, AggregateType: "user", Payload: "UserNewSignIn"},
+		{Type: "user.logged_out", Version: 1, AggregateType: "user", Payload: "UserLoggedOut"},
+		{Type: "user.avatar_changed", Version: 1, AggregateType: "user", Payload: "UserAvatarChanged"},
+		{Type: "user.preferences_changed", Version: 1, AggregateType: "user", Payload: "UserPreferencesChanged"},
+		{Type: "user.impersonation_started", Version: 1, AggregateType: "user", Payload: "UserImpersonationStarted"},
+		{Type: "device.registered", Version: 1, AggregateType: "device", Payload: "DeviceRegistered"},
+		{Type: "device.settings_updated", Version: 1, AggregateType: "device", Payload: "DeviceSettingsUpdated"},
+		{Type: "device.revoked", Version: 1, AggregateType: "device", Payload: "DeviceRevoked"},
+		{Type: "invite.created", Version: 1, AggregateType: "invite", Payload: "InviteCreated"},
+		{Type: "invite.revoked", Version: 1, AggregateType: "invite", Payload: "InviteRevoked"},
+		{Type: "invite.redeemed", Version: 1, AggregateType: "invite", Payload: "InviteRedeemed"},
+		{Type: "tenant.created", Version: 1, AggregateType: "tenant", Payload: "TenantChanged"},
+		{Type: "tenant.updated", Version: 1, AggregateType: "tenant", Payload: "TenantChanged"},
+		{Type: "role.changed", Version: 1, AggregateType: "role", Payload: "AccessPolicyChanged"},
+		{Type: "permission.changed", Version: 1, AggregateType: "permission", Payload: "AccessPolicyChanged"},
+		{Type: "feature_flag.changed", Version: 1, AggregateType: "feature_flag", Payload: "FeatureFlagChanged"},
+		{Type: "feature_flag.deleted", Version: 1, AggregateType: "feature_flag", Payload: "FeatureFlagChanged"},
+		{Type: "consent.document_published", Version: 1, AggregateType: "consent_document", Payload: "ConsentDocumentPublished"},
+		{Type: "user.consented", Version: 1, AggregateType: "user", Payload: "UserConsented"},
+		{Type: "user.data_export_requested", Version: 1, AggregateType: "user", Payload: "DataExportRequested"},
+		{Type: "user.data_export_section", Version: 1, AggregateType: "user", Payload: "DataExportSection"},
+		{Type: "user.deletion_scheduled", Version: 1, AggregateType: "user", Payload: "UserDeletionScheduled"},
+		{Type: "user.deletion_cancelled", Version: 1, AggregateType: "user", Payload: "UserDeletionScheduled"},
+		{Type: "user.digest_requested", Version: 1, AggregateType: "user", Payload: "DigestRequested"},
+		{Type: "user.digest_composed", Version: 1, AggregateType: "user", Payload: "DigestComposed"},
+
+		// Library service
+		{Type: "library.created", Version: 1, AggregateType: "library", Payload: "LibraryChanged"},
+		{Type: "library.updated", Version: 1, AggregateType: "library", Payload: "LibraryChanged"},
+		{Type: "library.deleted", Version: 1, AggregateType: "library", Payload: "LibraryDeleted"},
+		{Type: "library.scan.completed", Version: 1, AggregateType: "library", Payload: "LibraryScanCompleted"},
+		{Type: "library.imported", Version: 1, AggregateType: "library", Payload: "LibraryImported"},
+		{Type: "library.relocated", Version: 1, AggregateType: "library", Payload: "LibraryRelocated"},
+		{Type: "library.prune_suggested", Version: 1, AggregateType: "library", Payload: "LibraryPruneSuggested"},
+		{Type: "media.added", Version: 1, AggregateType: "media", Payload: "MediaChanged"},
+		{Type: "media.updated", Version: 1, AggregateType: "media", Payload: "MediaChanged"},
+		{Type: "media.deleted", Version: 1, AggregateType: "media", Payload: "MediaDeleted"},
+		{Type: "media.file_replaced", Version: 1, AggregateType: "media", Payload: "MediaFileReplaced"},
+		{Type: "media.playback_flagged", Version: 1, AggregateType: "media", Payload: "MediaPlaybackFlagged"},
+		{Type: "media.shared", Version: 1, AggregateType: "media", Payload: "MediaShared"},
+		{Type: "media.share_played", Version: 1, AggregateType: "media", Payload: "MediaSharePlayed"},
+		{Type: "transcode.requested", Version: 1, AggregateType: "media", Payload: "TranscodeRequested"},
+		{Type: "transcode.reprioritized", Version: 1, AggregateType: "media", Payload: "TranscodeReprioritized"},
+		{Type: "transcode.reused", Version: 1, AggregateType: "media", Payload: "TranscodeReused"},
+		{Type: "transcode.completed", Version: 1, AggregateType: "media", Payload: "TranscodeCompleted"},
+		{Type: "feed.item_grabbed", Version: 1, AggregateType: "feed", Payload: "FeedItemGrabbed"},
+		{Type: "release.grabbed", Version: 1, AggregateType: "media", Payload: "ReleaseGrabbed"},
+		{Type: "component.disabled", Version: 1, AggregateType: "component", Payload: "ComponentDisabled"},
+		{Type: "component.enabled", Version: 1, AggregateType: "component", Payload: "ComponentEnabled"},
+		{Type: "download.quarantined", Version: 1, AggregateType: "workflow", Payload: "DownloadQuarantined"},
+		{Type: "content_request.created", Version: 1, AggregateType: "content_request", Payload: "ContentRequestChanged"},
+		{Type: "content_request.updated", Version: 1, AggregateType: "content_request", Payload: "ContentRequestChanged"},
+		{Type: "media_issue.reported", Version: 1, AggregateType: "media_issue", Payload: "MediaIssueChanged"},
+		{Type: "media_issue.resolved", Version: 1, AggregateType: "media_issue", Payload: "MediaIssueChanged"},
+
+		// Status state machines
+		{Type: "media.status_changed", Version: 1, AggregateType: "media", Payload: "StatusChanged"},
+		{Type: "download.status_changed", Version: 1, AggregateType: "download", Payload: "StatusChanged"},
+		{Type: "transcode_job.status_changed", Version: 1, AggregateType: "transcode_job", Payload: "StatusChanged"},
+	}
+
+	schemas := make(map[string]Schema, len(defaultSchemas))
+	for _, schema := range defaultSchemas {
+		schema.Payload = payloadPackage + schema.Payload
+		schemas[schema.Type] = schema
+	}
+	return schemas
+}
+
+// RegisterSchema adds an event type to the catalog or bumps its version.
+// Versions can only move forward.
+func RegisterSchema(schema Schema) error {
+	if schema.Type == "" || schema.AggregateType == "" || schema.Payload == "" {
+		return fmt.Errorf("schema for %q is incomplete", schema.Type)
+	}
+	if schema.Version == 0 {
+		return fmt.Errorf("schema for %q must have a version of at least 1", schema.Type)
+	}
+
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
+	if existing, ok := catalog[schema.Type]; ok && existing.Version > schema.Version {
+		return fmt.Errorf("schema for %q cannot be downgraded from v%d to v%d",
+			schema.Type, existing.Version, schema.Version)
+	}
+	catalog[schema.Type] = schema
+	return nil
+}
+
+// LookupSchema returns the current schema of an event type.
+func LookupSchema(eventType string) (Schema, bool) {
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+
+	schema, ok := catalog[eventType]
+	return schema, ok
+}
+
+// Schemas returns every registered schema ordered by event type.
+func Schemas() []Schema {
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+
+	schemas := make([]Schema, 0, len(catalog))
+	for _, schema := range catalog {
+		schemas = append(schemas, schema)
+	}
+	sort.Slice(schemas, func(i, j int) bool {
+		return schemas[i].Type < schemas[j].Type
+	})
+	return schemas
+}
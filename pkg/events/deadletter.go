@@ -0,0 +1,220 @@
+package events
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// DeadLetter is an event a handler failed to process after every delivery
+// attempt.
+type DeadLetter struct {
+	ID            string
+	Event         interfaces.Event
+	Handler       string
+	Reason        string
+	Attempts      int
+	FirstFailedAt time.Time
+	LastFailedAt  time.Time
+
+	handler interfaces.EventHandler
+}
+
+// DeadLetterQueue holds events whose handlers kept failing so they can be
+// inspected, requeued or discarded. An alert is raised when the queue grows
+// beyond its threshold and cleared once it drains back below it.
+type DeadLetterQueue struct {
+	mu        sync.Mutex
+	letters   map[string]*DeadLetter
+	threshold int
+	alerting  bool
+	onAlert   func(depth int)
+	logger    interfaces.Logger
+}
+
+// NewDeadLetterQueue creates a dead-letter queue. A threshold of zero
+// disables depth alerts.
+func NewDeadLetterQueue(threshold int, logger interfaces.Logger) *DeadLetterQueue {
+	return &DeadLetterQueue{
+		letters:   make(map[string]*DeadLetter),
+		threshold: threshold,
+		logger:    logger,
+	}
+}
+
+// OnAlert registers a callback run when the queue depth first exceeds the
+// threshold. Alerts are always logged.
+func (q *DeadLetterQueue) OnAlert(fn func(depth int)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.onAlert = fn
+}
+
+// Add dead-letters an event that handler failed to process.
+func (q *DeadLetterQueue) Add(event interfaces.Event, handler interfaces.EventHandler, err error, attempts int) *DeadLetter {
+	now := time.Now()
+	letter := &DeadLetter{
+		ID:            uuid.New().String(),
+		Event:         event,
+		Handler:       handler.EventType(),
+		Reason:        err.Error(),
+		Attempts:      attempts,
+		FirstFailedAt: now,
+		LastFailedAt:  now,
+		handler:       handler,
+	}
+
+	q.mu.Lock()
+	q.letters[letter.ID] = letter
+	alert := q.checkDepth()
+	q.mu.Unlock()
+
+	q.logger.Warn("Event dead-lettered",
+		interfaces.String("dead_letter_id", letter.ID),
+		interfaces.String("event_type", event.EventType()),
+		interfaces.String("handler", letter.Handler),
+		interfaces.Int("attempts", attempts),
+		interfaces.Error(err))
+	alert()
+
+	return letter
+}
+
+// List returns dead letters oldest first, optionally filtered by event type.
+func (q *DeadLetterQueue) List(eventType string, limit, offset int) ([]DeadLetter, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	letters := make([]DeadLetter, 0, len(q.letters))
+	for _, letter := range q.letters {
+		if eventType == "" || letter.Event.EventType() == eventType {
+			letters = append(letters, *letter)
+		}
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i].FirstFailedAt.Before(letters[j].FirstFailedAt)
+	})
+
+	total := len(letters)
+	if offset >= total {
+		return nil, total
+	}
+	letters = letters[offset:]
+	if limit > 0 && limit < len(letters) {
+		letters = letters[:limit]
+	}
+	return letters, total
+}
+
+// Get returns a single dead letter.
+func (q *DeadLetterQueue) Get(id string) (DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	letter, ok := q.letters[id]
+	if !ok {
+		return DeadLetter{}, errors.NotFound("dead letter not found")
+	}
+	return *letter, nil
+}
+
+// Requeue delivers dead letters to their handler again. Letters that are
+// processed are removed; letters that fail again stay in the queue with
+// their attempt count and reason updated. The IDs of the processed letters
+// are returned.
+func (q *DeadLetterQueue) Requeue(ctx context.Context, ids []string) ([]string, error) {
+	q.mu.Lock()
+	letters := make([]*DeadLetter, 0, len(ids))
+	for _, id := range ids {
+		letter, ok := q.letters[id]
+		if !ok {
+			q.mu.Unlock()
+			return nil, errors.NotFound("dead letter not found: " + id)
+		}
+		letters = append(letters, letter)
+	}
+	q.mu.Unlock()
+
+	var requeued []string
+	for _, letter := range letters {
+		err := letter.handler.Handle(ctx, letter.Event)
+
+		q.mu.Lock()
+		if err != nil {
+			letter.Attempts++
+			letter.Reason = err.Error()
+			letter.LastFailedAt = time.Now()
+		} else {
+			delete(q.letters, letter.ID)
+			requeued = append(requeued, letter.ID)
+		}
+		q.checkDepth()
+		q.mu.Unlock()
+	}
+
+	q.logger.Info("Dead letters requeued",
+		interfaces.Int("requested", len(ids)),
+		interfaces.Int("processed", len(requeued)))
+
+	return requeued, nil
+}
+
+// Discard drops dead letters without processing them and returns how many
+// were removed. Unknown IDs are ignored.
+func (q *DeadLetterQueue) Discard(ids []string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	discarded := 0
+	for _, id := range ids {
+		if _, ok := q.letters[id]; ok {
+			delete(q.letters, id)
+			discarded++
+		}
+	}
+	q.checkDepth()
+
+	q.logger.Info("Dead letters discarded", interfaces.Int("discarded", discarded))
+	return discarded
+}
+
+// Depth returns the number of dead letters in the queue.
+func (q *DeadLetterQueue) Depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.letters)
+}
+
+// checkDepth updates the alert state and returns the alert to raise, if
+// any, so it can run after the lock is released. Callers hold q.mu.
+func (q *DeadLetterQueue) checkDepth() func() {
+	depth := len(q.letters)
+	if q.threshold <= 0 {
+		return func() {}
+	}
+
+	if depth <= q.threshold {
+		q.alerting = false
+		return func() {}
+	}
+	if q.alerting {
+		return func() {}
+	}
+
+	q.alerting = true
+	onAlert := q.onAlert
+	return func() {
+		q.logger.Error("Dead-letter queue depth exceeds threshold",
+			interfaces.Int("depth", depth),
+			interfaces.Int("threshold", q.threshold))
+		if onAlert != nil {
+			onAlert(depth)
+		}
+	}
+}
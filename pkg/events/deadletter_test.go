@@ -0,0 +1,110 @@
+package events_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pkgerrors "github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/logger"
+)
+
+type flakyHandler struct {
+	failures int
+	calls    int
+}
+
+func (h *flakyHandler) Handle(context.Context, interfaces.Event) error {
+	h.calls++
+	if h.failures > 0 {
+		h.failures--
+		return errors.New("downstream unavailable")
+	}
+	return nil
+}
+
+func (h *flakyHandler) EventType() string {
+	return "flaky"
+}
+
+func TestEventBus_DeadLetters(t *testing.T) {
+	dlq := events.NewDeadLetterQueue(0, logger.NewNoopLogger())
+	bus := events.NewInMemoryEventBus(logger.NewNoopLogger()).WithDeadLetterQueue(dlq, 3)
+
+	// Handlers that recover within the attempt budget are not dead-lettered
+	recovering := &flakyHandler{failures: 2}
+	require.NoError(t, bus.Subscribe("user.created", recovering))
+	require.NoError(t, bus.Publish(context.Background(), events.NewEvent("user.created", nil)))
+	assert.Equal(t, 3, recovering.calls)
+	assert.Zero(t, dlq.Depth())
+
+	failing := &flakyHandler{failures: 4}
+	require.NoError(t, bus.Subscribe("user.deleted", failing))
+	require.NoError(t, bus.Publish(context.Background(), events.NewEvent("user.deleted", nil)))
+	assert.Equal(t, 3, failing.calls)
+	require.Equal(t, 1, dlq.Depth())
+
+	letters, total := dlq.List("", 0, 0)
+	require.Len(t, letters, 1)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, "user.deleted", letters[0].Event.EventType())
+	assert.Equal(t, "flaky", letters[0].Handler)
+	assert.Equal(t, 3, letters[0].Attempts)
+	assert.Equal(t, "downstream unavailable", letters[0].Reason)
+
+	// The first requeue fails again and keeps the letter
+	requeued, err := dlq.Requeue(context.Background(), []string{letters[0].ID})
+	require.NoError(t, err)
+	assert.Empty(t, requeued)
+	letter, err := dlq.Get(letters[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, 4, letter.Attempts)
+
+	requeued, err = dlq.Requeue(context.Background(), []string{letters[0].ID})
+	require.NoError(t, err)
+	assert.Equal(t, []string{letters[0].ID}, requeued)
+	assert.Zero(t, dlq.Depth())
+
+	_, err = dlq.Get(letters[0].ID)
+	assert.True(t, pkgerrors.IsNotFound(err))
+}
+
+func TestDeadLetterQueue_DiscardAndAlert(t *testing.T) {
+	dlq := events.NewDeadLetterQueue(2, logger.NewNoopLogger())
+	var alerts []int
+	dlq.OnAlert(func(depth int) { alerts = append(alerts, depth) })
+
+	handler := &flakyHandler{}
+	var ids []string
+	for range 4 {
+		letter := dlq.Add(events.NewEvent("media.added", nil), handler, errors.New("boom"), 1)
+		ids = append(ids, letter.ID)
+	}
+
+	// Alerts fire once when the threshold is crossed
+	assert.Equal(t, []int{3}, alerts)
+
+	filtered, total := dlq.List("media.deleted", 0, 0)
+	assert.Empty(t, filtered)
+	assert.Zero(t, total)
+	page, total := dlq.List("media.added", 2, 1)
+	assert.Len(t, page, 2)
+	assert.Equal(t, 4, total)
+
+	assert.Equal(t, 3, dlq.Discard(append(ids[:3], "unknown")))
+	assert.Equal(t, 1, dlq.Depth())
+
+	// Draining re-arms the alert
+	for range 2 {
+		dlq.Add(events.NewEvent("media.added", nil), handler, errors.New("boom"), 1)
+	}
+	assert.Equal(t, []int{3, 3}, alerts)
+
+	_, err := dlq.Requeue(context.Background(), []string{"unknown"})
+	assert.True(t, pkgerrors.IsNotFound(err))
+}
@@ -0,0 +1,184 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/tenant"
+)
+
+// EnvelopeSchemaVersion is the version of the envelope format itself.
+const EnvelopeSchemaVersion uint32 = 1
+
+// payloadTypeKey carries the payload message in the JSON form of an
+// envelope, matching the protobuf JSON mapping of google.protobuf.Any.
+const payloadTypeKey = "@type"
+
+// payloadTypeURLPrefix prefixes payload message names in type URLs.
+const payloadTypeURLPrefix = "type.googleapis.com/"
+
+var (
+	// ErrUnknownEventType is returned for events missing from the catalog.
+	ErrUnknownEventType = errors.New("unknown event type")
+	// ErrUnsupportedSchemaVersion is returned for envelopes in an unknown format.
+	ErrUnsupportedSchemaVersion = errors.New("unsupported envelope schema version")
+	// ErrUnsupportedVersion is returned for payload versions a reader does
+	// not understand.
+	ErrUnsupportedVersion = errors.New("unsupported event version")
+)
+
+// PayloadEvent is an event that can describe its payload as a map keyed
+// by the field names of its protobuf payload message.
+type PayloadEvent interface {
+	interfaces.Event
+	Payload() map[string]interface{}
+}
+
+// Envelope is the Go form of narwhal.events.v1.EventEnvelope. Every event
+// published through a Publisher is wrapped in one.
+type Envelope struct {
+	SchemaVersion uint32                 `json:"schema_version"`
+	ID            string                 `json:"id"`
+	Type          string                 `json:"type"`
+	Version       uint32                 `json:"version"`
+	AggregateType string                 `json:"aggregate_type"`
+	AggID         string                 `json:"aggregate_id,omitempty"`
+	TenantID      string                 `json:"tenant_id,omitempty"`
+	OccurredAt    time.Time              `json:"occurred_at"`
+	Data          map[string]interface{} `json:"payload"`
+}
+
+// Wrap puts an event into an envelope stamped with its current catalog
+// version. Envelopes are validated and returned as is.
+func Wrap(ctx context.Context, event interfaces.Event) (*Envelope, error) {
+	if env, ok := event.(*Envelope); ok {
+		return env, env.Validate()
+	}
+
+	schema, ok := LookupSchema(event.EventType())
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEventType, event.EventType())
+	}
+
+	payloadEvent, ok := event.(PayloadEvent)
+	if !ok {
+		return nil, fmt.Errorf("event %s does not expose a payload", event.EventType())
+	}
+	payload := payloadEvent.Payload()
+
+	env := &Envelope{
+		SchemaVersion: EnvelopeSchemaVersion,
+		ID:            uuid.New().String(),
+		Type:          schema.Type,
+		Version:       schema.Version,
+		AggregateType: schema.AggregateType,
+		AggID:         event.AggregateID(),
+		OccurredAt:    time.Unix(0, event.Timestamp()).UTC(),
+		Data:          payload,
+	}
+
+	// Events built from plain maps rarely set an aggregate ID
+	if env.AggID == "" {
+		if id, ok := payload[schema.AggregateType+"_id"]; ok {
+			env.AggID = fmt.Sprint(id)
+		}
+	}
+	if id, ok := payload["tenant_id"]; ok {
+		env.TenantID = fmt.Sprint(id)
+	} else if id, ok := tenant.FromContext(ctx); ok {
+		env.TenantID = id.String()
+	}
+
+	return env, nil
+}
+
+// EventType returns the type of the event.
+func (e *Envelope) EventType() string {
+	return e.Type
+}
+
+// Timestamp returns when the event occurred in Unix nanoseconds.
+func (e *Envelope) Timestamp() int64 {
+	return e.OccurredAt.UnixNano()
+}
+
+// AggregateID returns the ID of the aggregate that produced the event.
+func (e *Envelope) AggregateID() string {
+	return e.AggID
+}
+
+// Payload returns the event payload.
+func (e *Envelope) Payload() map[string]interface{} {
+	return e.Data
+}
+
+// Validate checks the envelope against its format and the catalog. Payload
+// versions newer than the catalog knows are rejected.
+func (e *Envelope) Validate() error {
+	if e.SchemaVersion != EnvelopeSchemaVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedSchemaVersion, e.SchemaVersion)
+	}
+	if e.ID == "" {
+		return errors.New("event ID is required")
+	}
+
+	schema, ok := LookupSchema(e.Type)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownEventType, e.Type)
+	}
+	if e.Version == 0 || e.Version > schema.Version {
+		return fmt.Errorf("%w: %s v%d (latest is v%d)", ErrUnsupportedVersion, e.Type, e.Version, schema.Version)
+	}
+	return nil
+}
+
+// Marshal encodes the envelope in the protobuf JSON form of EventEnvelope.
+func (e *Envelope) Marshal() ([]byte, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	schema, _ := LookupSchema(e.Type)
+
+	payload := make(map[string]interface{}, len(e.Data)+1)
+	for k, v := range e.Data {
+		payload[k] = v
+	}
+	payload[payloadTypeKey] = payloadTypeURLPrefix + schema.Payload
+
+	out := *e
+	out.Data = payload
+	return json.Marshal(&out)
+}
+
+// UnmarshalEnvelope decodes and validates an envelope produced by Marshal.
+func UnmarshalEnvelope(data []byte) (*Envelope, error) {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("failed to decode event envelope: %w", err)
+	}
+	if err := env.Validate(); err != nil {
+		return nil, err
+	}
+
+	schema, _ := LookupSchema(env.Type)
+	if typeURL, _ := env.Data[payloadTypeKey].(string); typeURL != payloadTypeURLPrefix+schema.Payload {
+		return nil, fmt.Errorf("payload of %s is %q, expected %s", env.Type, typeURL, schema.Payload)
+	}
+	delete(env.Data, payloadTypeKey)
+
+	return &env, nil
+}
+
+// PayloadOf returns the payload of an event, or nil if it has none.
+func PayloadOf(event interfaces.Event) map[string]interface{} {
+	if payloadEvent, ok := event.(PayloadEvent); ok {
+		return payloadEvent.Payload()
+	}
+	return nil
+}
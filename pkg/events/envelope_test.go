@@ -0,0 +1,103 @@
+package events_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/pkg/events"
+)
+
+func TestWrap(t *testing.T) {
+	event := events.NewEvent("user.created", map[string]interface{}{
+		"user_id":   "u-1",
+		"tenant_id": "t-1",
+		"username":  "alice",
+	})
+
+	env, err := events.Wrap(context.Background(), event)
+	require.NoError(t, err)
+	assert.Equal(t, events.EnvelopeSchemaVersion, env.SchemaVersion)
+	assert.NotEmpty(t, env.ID)
+	assert.Equal(t, "user.created", env.EventType())
+	assert.Equal(t, uint32(1), env.Version)
+	assert.Equal(t, "user", env.AggregateType)
+	assert.Equal(t, "u-1", env.AggregateID())
+	assert.Equal(t, "t-1", env.TenantID)
+	assert.Equal(t, event.Timestamp(), env.Timestamp())
+
+	// Envelopes pass through unchanged
+	again, err := events.Wrap(context.Background(), env)
+	require.NoError(t, err)
+	assert.Same(t, env, again)
+
+	_, err = events.Wrap(context.Background(), events.NewEvent("user.unknown", nil))
+	assert.ErrorIs(t, err, events.ErrUnknownEventType)
+}
+
+func TestEnvelope_MarshalRoundTrip(t *testing.T) {
+	env, err := events.Wrap(context.Background(), events.NewEvent("library.deleted", map[string]interface{}{
+		"library_id": "lib-1",
+	}))
+	require.NoError(t, err)
+
+	data, err := env.Marshal()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"@type":"type.googleapis.com/narwhal.events.v1.LibraryDeleted"`)
+
+	decoded, err := events.UnmarshalEnvelope(data)
+	require.NoError(t, err)
+	assert.Equal(t, env.ID, decoded.ID)
+	assert.Equal(t, "lib-1", decoded.AggregateID())
+	assert.Equal(t, env.Payload(), decoded.Payload())
+	assert.True(t, env.OccurredAt.Equal(decoded.OccurredAt))
+}
+
+func TestEnvelope_Versions(t *testing.T) {
+	env, err := events.Wrap(context.Background(), events.NewEvent("media.deleted", map[string]interface{}{
+		"media_id": "m-1",
+	}))
+	require.NoError(t, err)
+
+	// Payloads newer than the catalog are rejected
+	env.Version = 2
+	assert.ErrorIs(t, env.Validate(), events.ErrUnsupportedVersion)
+	_, err = env.Marshal()
+	assert.ErrorIs(t, err, events.ErrUnsupportedVersion)
+
+	env.Version = 1
+	env.SchemaVersion = 2
+	assert.ErrorIs(t, env.Validate(), events.ErrUnsupportedSchemaVersion)
+
+	// Versions only move forward
+	schema, ok := events.LookupSchema("media.deleted")
+	require.True(t, ok)
+	schema.Version = 0
+	assert.Error(t, events.RegisterSchema(schema))
+}
+
+func TestConsumer_MaxVersion(t *testing.T) {
+	require.NoError(t, events.RegisterSchema(events.Schema{
+		Type:          "test.versioned",
+		Version:       2,
+		AggregateType: "test",
+		Payload:       "narwhal.events.v1.TestVersioned",
+	}))
+
+	var handled []uint32
+	consumer := events.NewConsumer("test.consumer", 1, func(_ context.Context, env *events.Envelope) error {
+		handled = append(handled, env.Version)
+		return nil
+	})
+
+	env, err := events.Wrap(context.Background(), events.NewEvent("test.versioned", nil))
+	require.NoError(t, err)
+	assert.ErrorIs(t, consumer.Handle(context.Background(), env), events.ErrUnsupportedVersion)
+
+	env.Version = 1
+	assert.NoError(t, consumer.Handle(context.Background(), env))
+	assert.Equal(t, []uint32{1}, handled)
+	assert.Equal(t, "test.consumer", consumer.EventType())
+}
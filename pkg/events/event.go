@@ -46,3 +46,8 @@ func (e *BaseEvent) Timestamp() int64 {
 func (e *BaseEvent) AggregateID() string {
 	return e.AggID
 }
+
+// Payload returns the event data.
+func (e *BaseEvent) Payload() map[string]interface{} {
+	return e.Data
+}
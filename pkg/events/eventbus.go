@@ -3,6 +3,8 @@ package events
 import (
 	"context"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/narwhalmedia/narwhal/pkg/interfaces"
 )
@@ -15,6 +17,23 @@ type InMemoryEventBus struct {
 	wg       sync.WaitGroup
 	ctx      context.Context
 	cancel   context.CancelFunc
+
+	deadLetters *DeadLetterQueue
+	maxAttempts int
+
+	pending atomic.Int64
+	lagMu   sync.Mutex
+	lag     map[string]time.Duration
+}
+
+// BusStats is a snapshot of the delivery state of an event bus.
+type BusStats struct {
+	// Pending is the number of asynchronously published events not yet
+	// delivered to every handler.
+	Pending int
+	// Lag is how long after it occurred each handler received its latest
+	// event, keyed by handler name.
+	Lag map[string]time.Duration
 }
 
 // LocalEventBus is an alias for InMemoryEventBus.
@@ -25,6 +44,7 @@ func NewInMemoryEventBus(logger interfaces.Logger) *InMemoryEventBus {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &InMemoryEventBus{
 		handlers: make(map[string][]interfaces.EventHandler),
+		lag:      make(map[string]time.Duration),
 		logger:   logger,
 		ctx:      ctx,
 		cancel:   cancel,
@@ -36,6 +56,14 @@ func NewLocalEventBus(logger interfaces.Logger) *LocalEventBus {
 	return NewInMemoryEventBus(logger)
 }
 
+// WithDeadLetterQueue makes the bus retry failing handlers up to
+// maxAttempts times and dead-letter the event after that.
+func (eb *InMemoryEventBus) WithDeadLetterQueue(dlq *DeadLetterQueue, maxAttempts int) *InMemoryEventBus {
+	eb.deadLetters = dlq
+	eb.maxAttempts = maxAttempts
+	return eb
+}
+
 // Publish publishes an event to all subscribers.
 func (eb *InMemoryEventBus) Publish(ctx context.Context, event interfaces.Event) error {
 	eb.mu.RLock()
@@ -43,23 +71,44 @@ func (eb *InMemoryEventBus) Publish(ctx context.Context, event interfaces.Event)
 	eb.mu.RUnlock()
 
 	for _, handler := range handlers {
-		if err := handler.Handle(ctx, event); err != nil {
-			eb.logger.Error("Event handler failed",
-				interfaces.String("event_type", event.EventType()),
-				interfaces.String("handler", handler.EventType()),
-				interfaces.Error(err))
-			// Continue processing other handlers
-		}
+		// Failures are logged and dead-lettered; other handlers still run
+		eb.deliver(ctx, event, handler)
 	}
 
 	return nil
 }
 
+// deliver hands an event to a handler, retrying up to the configured number
+// of attempts before dead-lettering it.
+func (eb *InMemoryEventBus) deliver(ctx context.Context, event interfaces.Event, handler interfaces.EventHandler) {
+	attempts := max(eb.maxAttempts, 1)
+	eb.recordLag(handler.EventType(), event)
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = handler.Handle(ctx, event); err == nil {
+			return
+		}
+	}
+
+	eb.logger.Error("Event handler failed",
+		interfaces.String("event_type", event.EventType()),
+		interfaces.String("handler", handler.EventType()),
+		interfaces.Int("attempts", attempts),
+		interfaces.Error(err))
+
+	if eb.deadLetters != nil {
+		eb.deadLetters.Add(event, handler, err, attempts)
+	}
+}
+
 // PublishAsync publishes an event asynchronously.
 func (eb *InMemoryEventBus) PublishAsync(ctx context.Context, event interfaces.Event) {
 	eb.wg.Add(1)
+	eb.pending.Add(1)
 	go func() {
 		defer eb.wg.Done()
+		defer eb.pending.Add(-1)
 		if err := eb.Publish(ctx, event); err != nil {
 			eb.logger.Error("Async event publish failed",
 				interfaces.String("event_type", event.EventType()),
@@ -68,6 +117,29 @@ func (eb *InMemoryEventBus) PublishAsync(ctx context.Context, event interfaces.E
 	}()
 }
 
+func (eb *InMemoryEventBus) recordLag(handler string, event interfaces.Event) {
+	lag := max(time.Since(time.Unix(0, event.Timestamp())), 0)
+
+	eb.lagMu.Lock()
+	defer eb.lagMu.Unlock()
+	eb.lag[handler] = lag
+}
+
+// Stats returns the current delivery state of the bus.
+func (eb *InMemoryEventBus) Stats() BusStats {
+	eb.lagMu.Lock()
+	defer eb.lagMu.Unlock()
+
+	lag := make(map[string]time.Duration, len(eb.lag))
+	for handler, d := range eb.lag {
+		lag[handler] = d
+	}
+	return BusStats{
+		Pending: int(eb.pending.Load()),
+		Lag:     lag,
+	}
+}
+
 // Subscribe registers a handler for a specific event type.
 func (eb *InMemoryEventBus) Subscribe(eventType string, handler interfaces.EventHandler) error {
 	eb.mu.Lock()
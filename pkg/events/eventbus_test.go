@@ -0,0 +1,38 @@
+package events_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/logger"
+)
+
+func TestEventBus_Stats(t *testing.T) {
+	bus := events.NewInMemoryEventBus(logger.NewNoopLogger())
+	release := make(chan struct{})
+	require.NoError(t, bus.Subscribe("media.added", events.NewConsumer("blocking", 1, func(context.Context, *events.Envelope) error {
+		<-release
+		return nil
+	})))
+
+	event := events.NewAggregateEvent("media.added", "m1", map[string]interface{}{"media_id": "m1"})
+	event.Time = time.Now().Add(-time.Minute).UnixNano()
+	bus.PublishAsync(context.Background(), event)
+
+	require.Eventually(t, func() bool {
+		_, ok := bus.Stats().Lag["blocking"]
+		return ok
+	}, time.Second, time.Millisecond)
+	stats := bus.Stats()
+	assert.Equal(t, 1, stats.Pending)
+	assert.GreaterOrEqual(t, stats.Lag["blocking"], time.Minute)
+
+	close(release)
+	require.NoError(t, bus.Stop())
+	assert.Zero(t, bus.Stats().Pending)
+}
@@ -0,0 +1,85 @@
+package events
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// Publisher is an EventBus that wraps every published event in a versioned
+// Envelope. Events missing from the catalog are rejected.
+type Publisher struct {
+	interfaces.EventBus
+
+	logger interfaces.Logger
+}
+
+// NewPublisher wraps bus so everything published through it is enveloped.
+func NewPublisher(bus interfaces.EventBus, logger interfaces.Logger) *Publisher {
+	return &Publisher{
+		EventBus: bus,
+		logger:   logger,
+	}
+}
+
+// Publish wraps the event in an envelope and publishes it.
+func (p *Publisher) Publish(ctx context.Context, event interfaces.Event) error {
+	env, err := Wrap(ctx, event)
+	if err != nil {
+		return fmt.Errorf("failed to publish %s: %w", event.EventType(), err)
+	}
+	return p.EventBus.Publish(ctx, env)
+}
+
+// PublishAsync wraps the event in an envelope and publishes it
+// asynchronously. Events that cannot be wrapped are logged and dropped.
+func (p *Publisher) PublishAsync(ctx context.Context, event interfaces.Event) {
+	env, err := Wrap(ctx, event)
+	if err != nil {
+		p.logger.Error("Dropped invalid event",
+			interfaces.String("event_type", event.EventType()),
+			interfaces.Error(err))
+		return
+	}
+	p.EventBus.PublishAsync(ctx, env)
+}
+
+// Consumer is an EventHandler that only accepts payload versions it
+// understands. Unwrapped events are enveloped before being handled.
+type Consumer struct {
+	name       string
+	maxVersion uint32
+	handle     func(ctx context.Context, env *Envelope) error
+}
+
+// NewConsumer creates a consumer that handles payloads up to maxVersion.
+func NewConsumer(
+	name string,
+	maxVersion uint32,
+	handle func(ctx context.Context, env *Envelope) error,
+) *Consumer {
+	return &Consumer{
+		name:       name,
+		maxVersion: maxVersion,
+		handle:     handle,
+	}
+}
+
+// Handle validates the event version and passes the envelope on.
+func (c *Consumer) Handle(ctx context.Context, event interfaces.Event) error {
+	env, err := Wrap(ctx, event)
+	if err != nil {
+		return err
+	}
+	if env.Version > c.maxVersion {
+		return fmt.Errorf("%w: %s consumes %s up to v%d, got v%d",
+			ErrUnsupportedVersion, c.name, env.Type, c.maxVersion, env.Version)
+	}
+	return c.handle(ctx, env)
+}
+
+// EventType returns the consumer name.
+func (c *Consumer) EventType() string {
+	return c.name
+}
@@ -0,0 +1,106 @@
+// Package gpu detects the GPUs of a transcode worker and schedules encode
+// sessions onto them, falling back to the CPU when every GPU is saturated
+// and pausing batch encodes for playback.
+package gpu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// VendorNVIDIA is the vendor of the devices Detect finds.
+const VendorNVIDIA = "nvidia"
+
+// ConsumerNVENCSessions is the number of concurrent NVENC sessions the
+// drivers of consumer NVIDIA cards allow. Professional and data center
+// cards are not limited.
+const ConsumerNVENCSessions = 8
+
+// unlimitedNVENC are name prefixes of the NVIDIA cards whose NVENC sessions
+// are not limited by the driver.
+var unlimitedNVENC = []string{
+	"Tesla", "Quadro", "NVIDIA RTX A", "RTX A",
+	"NVIDIA A", "NVIDIA L", "NVIDIA T4", "NVIDIA H",
+}
+
+// Device is a GPU encode sessions can be scheduled onto.
+type Device struct {
+	Index       int
+	Name        string
+	Vendor      string
+	MemoryBytes int64
+	// MaxSessions is the number of concurrent encode sessions the device
+	// allows; zero is unlimited.
+	MaxSessions int
+}
+
+// Runner runs a command and returns its standard output.
+type Runner func(ctx context.Context, name string, args ...string) ([]byte, error)
+
+// ExecRunner runs commands on the host.
+func ExecRunner(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, name, args...).Output()
+}
+
+// NVENCSessionLimit returns the number of concurrent NVENC sessions an
+// NVIDIA card allows, from its name; zero is unlimited.
+func NVENCSessionLimit(name string) int {
+	for _, prefix := range unlimitedNVENC {
+		if strings.HasPrefix(name, prefix) {
+			return 0
+		}
+	}
+	return ConsumerNVENCSessions
+}
+
+// Detect lists the NVIDIA GPUs of the host with nvidia-smi. Hosts without
+// nvidia-smi have no GPUs. sessionLimit overrides the session limit of
+// every device when positive, such as for patched drivers.
+func Detect(ctx context.Context, run Runner, sessionLimit int) ([]Device, error) {
+	out, err := run(ctx, "nvidia-smi",
+		"--query-gpu=index,name,memory.total", "--format=csv,noheader,nounits")
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query GPUs: %w", err)
+	}
+
+	var devices []Device
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("unexpected nvidia-smi output %q", line)
+		}
+		index, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid GPU index in %q", line)
+		}
+		// memory.total is in MiB
+		memory, err := strconv.ParseInt(strings.TrimSpace(fields[2]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GPU memory in %q", line)
+		}
+		name := strings.TrimSpace(fields[1])
+
+		device := Device{
+			Index:       index,
+			Name:        name,
+			Vendor:      VendorNVIDIA,
+			MemoryBytes: memory << 20,
+			MaxSessions: NVENCSessionLimit(name),
+		}
+		if sessionLimit > 0 {
+			device.MaxSessions = sessionLimit
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
@@ -0,0 +1,197 @@
+package gpu_test
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/pkg/gpu"
+	"github.com/narwhalmedia/narwhal/pkg/metrics"
+)
+
+func TestDetect(t *testing.T) {
+	run := func(_ context.Context, name string, _ ...string) ([]byte, error) {
+		assert.Equal(t, "nvidia-smi", name)
+		return []byte("0, NVIDIA GeForce RTX 3060, 12288\n1, Tesla T4, 15360\n"), nil
+	}
+
+	devices, err := gpu.Detect(context.Background(), run, 0)
+	require.NoError(t, err)
+	require.Len(t, devices, 2)
+	assert.Equal(t, gpu.Device{
+		Index:       0,
+		Name:        "NVIDIA GeForce RTX 3060",
+		Vendor:      gpu.VendorNVIDIA,
+		MemoryBytes: 12288 << 20,
+		MaxSessions: gpu.ConsumerNVENCSessions,
+	}, devices[0])
+	assert.Zero(t, devices[1].MaxSessions, "data center cards are not limited")
+
+	// A configured limit overrides the driver's
+	devices, err = gpu.Detect(context.Background(), run, 3)
+	require.NoError(t, err)
+	assert.Equal(t, 3, devices[0].MaxSessions)
+	assert.Equal(t, 3, devices[1].MaxSessions)
+
+	// Hosts without nvidia-smi have no GPUs
+	devices, err = gpu.Detect(context.Background(), func(context.Context, string, ...string) ([]byte, error) {
+		return nil, exec.ErrNotFound
+	}, 0)
+	require.NoError(t, err)
+	assert.Empty(t, devices)
+
+	_, err = gpu.Detect(context.Background(), func(context.Context, string, ...string) ([]byte, error) {
+		return []byte("0, broken\n"), nil
+	}, 0)
+	assert.Error(t, err)
+}
+
+func TestSchedulerSpreadsSessionsAndFallsBackToCPU(t *testing.T) {
+	s := gpu.NewScheduler([]gpu.Device{
+		{Index: 0, Name: "GeForce", MaxSessions: 2},
+		{Index: 1, Name: "GeForce", MaxSessions: 1},
+	}, 1)
+	ctx := context.Background()
+
+	acquire := func() *gpu.Lease {
+		lease, err := s.Acquire(ctx, "", gpu.LaneBatch)
+		require.NoError(t, err)
+		return lease
+	}
+	first, second, third := acquire(), acquire(), acquire()
+	require.NotNil(t, first.Device)
+	require.NotNil(t, second.Device)
+	require.NotNil(t, third.Device)
+	assert.Equal(t, 0, first.Device.Index)
+	assert.Equal(t, 1, second.Device.Index, "the least busy GPU is picked")
+	assert.Equal(t, 0, third.Device.Index)
+
+	cpu := acquire()
+	assert.Nil(t, cpu.Device, "saturated GPUs fall back to the CPU")
+	_, ok := s.TryAcquire("", gpu.LaneBatch)
+	assert.False(t, ok)
+
+	usage := s.Usage()
+	require.Len(t, usage, 3)
+	assert.Equal(t, 2, usage[0].Active)
+	assert.InDelta(t, 1.0, usage[0].Utilization(), 1e-9)
+	assert.Equal(t, 1, usage[2].Active)
+	assert.Nil(t, usage[2].Device)
+
+	// Waiters get the first session freed
+	got := make(chan *gpu.Lease)
+	go func() {
+		lease, err := s.Acquire(ctx, "", gpu.LaneBatch)
+		assert.NoError(t, err)
+		got <- lease
+	}()
+	second.Release()
+	second.Release() // releasing twice frees one session
+	select {
+	case lease := <-got:
+		require.NotNil(t, lease.Device)
+		assert.Equal(t, 1, lease.Device.Index)
+	case <-time.After(time.Second):
+		t.Fatal("waiter not admitted")
+	}
+	_, ok = s.TryAcquire("", gpu.LaneBatch)
+	assert.False(t, ok)
+
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err := s.Acquire(timeout, "", gpu.LaneBatch)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	var out bytes.Buffer
+	s.WriteMetrics(metrics.NewWriter(&out), "w1")
+	assert.Contains(t, out.String(), `narwhal_transcoding_gpu_sessions{worker="w1",gpu="0",name="GeForce"} 2`)
+	assert.Contains(t, out.String(), `narwhal_transcoding_gpu_session_limit{worker="w1",gpu="1",name="GeForce"} 1`)
+	assert.Contains(t, out.String(), `narwhal_transcoding_cpu_sessions{worker="w1"} 1`)
+	assert.Contains(t, out.String(), `narwhal_transcoding_preemptions_total{worker="w1"} 0`)
+}
+
+func TestSchedulerPlaybackPreemptsBatch(t *testing.T) {
+	s := gpu.NewScheduler([]gpu.Device{{Index: 0, Name: "GeForce", MaxSessions: 3}}, 0).
+		WithPlaybackReserve(1)
+	ctx := context.Background()
+
+	older, ok := s.TryAcquire("older", gpu.LaneBatch)
+	require.True(t, ok)
+	newer, ok := s.TryAcquire("newer", gpu.LaneBatch)
+	require.True(t, ok)
+	_, ok = s.TryAcquire("batch", gpu.LaneBatch)
+	assert.False(t, ok, "batch jobs leave the reserve free")
+
+	reserved, ok := s.TryAcquire("play-1", gpu.LanePlayback)
+	require.True(t, ok, "playback takes the reserve")
+	assert.Equal(t, gpu.LanePlayback, reserved.Lane)
+
+	// A second playback job pauses the batch job started last
+	played := make(chan *gpu.Lease)
+	go func() {
+		lease, err := s.Acquire(ctx, "play-2", gpu.LanePlayback)
+		assert.NoError(t, err)
+		played <- lease
+	}()
+	select {
+	case <-newer.Preempted():
+	case <-time.After(time.Second):
+		t.Fatal("batch job not preempted")
+	}
+	select {
+	case <-older.Preempted():
+		t.Fatal("only one batch job is preempted")
+	default:
+	}
+
+	newer.Pause(42)
+	var playback *gpu.Lease
+	select {
+	case playback = <-played:
+		require.NotNil(t, playback.Device)
+	case <-time.After(time.Second):
+		t.Fatal("playback job not admitted")
+	}
+	segment, ok := s.Checkpoint("newer")
+	require.True(t, ok)
+	assert.Equal(t, 42, segment)
+
+	resumed := make(chan *gpu.Lease)
+	go func() {
+		lease, err := s.Acquire(ctx, "newer", gpu.LaneBatch)
+		assert.NoError(t, err)
+		resumed <- lease
+	}()
+	reserved.Release()
+	playback.Release()
+	select {
+	case lease := <-resumed:
+		assert.Equal(t, 42, lease.ResumeFrom, "paused jobs resume from their checkpoint")
+		assert.Equal(t, "newer", lease.JobID)
+	case <-time.After(time.Second):
+		t.Fatal("paused job not resumed")
+	}
+	_, ok = s.Checkpoint("newer")
+	assert.False(t, ok)
+
+	var out bytes.Buffer
+	s.WriteMetrics(metrics.NewWriter(&out), "w1")
+	assert.Contains(t, out.String(), `narwhal_transcoding_preemptions_total{worker="w1"} 1`)
+}
+
+func TestSchedulerUnlimitedAndEmpty(t *testing.T) {
+	s := gpu.NewScheduler([]gpu.Device{{Index: 0, Name: "Tesla T4"}}, 0)
+	for range 20 {
+		lease, ok := s.TryAcquire("", gpu.LaneBatch)
+		require.True(t, ok, "unlimited GPUs always have a session")
+		require.NotNil(t, lease.Device)
+	}
+
+	_, err := gpu.NewScheduler(nil, 0).Acquire(context.Background(), "job", gpu.LanePlayback)
+	assert.ErrorIs(t, err, gpu.ErrNoCapacity)
+}
@@ -0,0 +1,355 @@
+package gpu
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/narwhalmedia/narwhal/pkg/metrics"
+)
+
+// ErrNoCapacity is returned when a scheduler has neither GPUs nor CPU
+// sessions to run encodes on.
+var ErrNoCapacity = errors.New("no GPU or CPU encode sessions configured")
+
+// Lane is the class of a transcode job, which decides who waits for whom.
+type Lane int
+
+const (
+	// LaneBatch runs library and policy transcodes. Batch jobs leave the
+	// playback reserve free and are paused when playback needs their
+	// session.
+	LaneBatch Lane = iota
+	// LanePlayback runs the just-in-time transcodes of users pressing
+	// play, ahead of every batch job.
+	LanePlayback
+)
+
+// String returns the name of the lane.
+func (l Lane) String() string {
+	if l == LanePlayback {
+		return "playback"
+	}
+	return "batch"
+}
+
+// Scheduler hands out the encode sessions of a worker. Jobs go to the GPU
+// with the fewest sessions in use among those with a free session, and to
+// the CPU once every GPU is saturated; when the CPU is saturated as well,
+// they wait for a session to free up.
+//
+// Playback jobs go first: batch jobs leave the playback reserve free and
+// wait while playback jobs do, and a playback job finding no session
+// preempts the batch job that started last. Preempted jobs pause at a
+// checkpoint and resume from it, ahead of new batch jobs, once sessions
+// free up.
+type Scheduler struct {
+	mu      sync.Mutex
+	devices []*slot
+	cpu     *slot
+	reserve int
+	// batch are the running batch leases, oldest first
+	batch []*Lease
+	// checkpoints are the segments paused jobs resume from, by job ID
+	checkpoints      map[string]int
+	playbackWaiting  int
+	resumeWaiting    int
+	preemptsInFlight int
+	preemptions      int
+	// changed is closed and replaced whenever a session frees up
+	changed chan struct{}
+}
+
+// slot counts the sessions in use of a GPU, or of the CPU when device is
+// nil.
+type slot struct {
+	device *Device
+	active int
+	max    int // zero is unlimited for GPUs
+}
+
+func (s *slot) unlimited() bool {
+	return s.device != nil && s.max == 0
+}
+
+func (s *slot) free() bool {
+	return s.unlimited() || s.active < s.max
+}
+
+// NewScheduler creates a scheduler for the GPUs of a worker, falling back
+// to at most cpuSessions concurrent CPU encodes.
+func NewScheduler(devices []Device, cpuSessions int) *Scheduler {
+	s := &Scheduler{
+		cpu:         &slot{max: cpuSessions},
+		checkpoints: make(map[string]int),
+		changed:     make(chan struct{}),
+	}
+	for i := range devices {
+		device := devices[i]
+		s.devices = append(s.devices, &slot{device: &device, max: device.MaxSessions})
+	}
+	return s
+}
+
+// WithPlaybackReserve keeps n sessions free of batch jobs, so playback
+// starts without waiting for a batch job to pause.
+func (s *Scheduler) WithPlaybackReserve(n int) *Scheduler {
+	s.reserve = n
+	return s
+}
+
+// Lease is an encode session of a GPU, or of the CPU when Device is nil.
+// It must be released, or paused, when the encode ends.
+type Lease struct {
+	JobID string
+	Lane  Lane
+	// Device is the GPU to encode on; nil encodes on the CPU.
+	Device *Device
+	// ResumeFrom is the segment a paused job resumes encoding from; zero
+	// for jobs that were not paused.
+	ResumeFrom int
+
+	scheduler *Scheduler
+	slot      *slot
+	preempt   chan struct{}
+	preempted bool
+	once      sync.Once
+}
+
+// Preempted is closed when a playback job needs the session of a batch
+// job. The job should pause at the next segment boundary.
+func (l *Lease) Preempted() <-chan struct{} {
+	return l.preempt
+}
+
+// Release frees the session.
+func (l *Lease) Release() {
+	l.release(-1)
+}
+
+// Pause frees the session of a preempted job, which resumes from segment
+// the next time it acquires one.
+func (l *Lease) Pause(segment int) {
+	l.release(segment)
+}
+
+func (l *Lease) release(checkpoint int) {
+	l.once.Do(func() {
+		s := l.scheduler
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		l.slot.active--
+		if i := slices.Index(s.batch, l); i >= 0 {
+			s.batch = slices.Delete(s.batch, i, i+1)
+		}
+		if l.preempted {
+			s.preemptsInFlight--
+		}
+		if checkpoint >= 0 && l.JobID != "" {
+			s.checkpoints[l.JobID] = checkpoint
+		}
+		close(s.changed)
+		s.changed = make(chan struct{})
+	})
+}
+
+// Acquire waits for an encode session for a job until ctx is done.
+func (s *Scheduler) Acquire(ctx context.Context, jobID string, lane Lane) (*Lease, error) {
+	s.mu.Lock()
+	if len(s.devices) == 0 && s.cpu.max <= 0 {
+		s.mu.Unlock()
+		return nil, ErrNoCapacity
+	}
+	// Playback jobs hold back batch jobs, and paused jobs new batch jobs,
+	// while they wait
+	var waiting *int
+	if lane == LanePlayback {
+		waiting = &s.playbackWaiting
+	} else if _, paused := s.checkpoints[jobID]; paused {
+		waiting = &s.resumeWaiting
+	}
+	if waiting != nil {
+		*waiting++
+		defer func() {
+			s.mu.Lock()
+			*waiting--
+			s.mu.Unlock()
+		}()
+	}
+
+	for {
+		if lease := s.take(jobID, lane); lease != nil {
+			s.mu.Unlock()
+			return lease, nil
+		}
+		if lane == LanePlayback {
+			s.preemptBatch()
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		s.mu.Lock()
+	}
+}
+
+// TryAcquire takes an encode session for a job if one is free.
+func (s *Scheduler) TryAcquire(jobID string, lane Lane) (*Lease, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lease := s.take(jobID, lane)
+	return lease, lease != nil
+}
+
+// take takes a session of the least busy GPU with one free, or of the CPU.
+func (s *Scheduler) take(jobID string, lane Lane) *Lease {
+	checkpoint, paused := s.checkpoints[jobID]
+	if lane == LaneBatch &&
+		(s.playbackWaiting > 0 || (!paused && s.resumeWaiting > 0) || s.freeSessions() <= s.reserve) {
+		return nil
+	}
+
+	var best *slot
+	for _, d := range s.devices {
+		if d.free() && (best == nil || d.active < best.active) {
+			best = d
+		}
+	}
+	if best == nil && s.cpu.free() {
+		best = s.cpu
+	}
+	if best == nil {
+		return nil
+	}
+
+	best.active++
+	lease := &Lease{
+		JobID:     jobID,
+		Lane:      lane,
+		Device:    best.device,
+		scheduler: s,
+		slot:      best,
+		preempt:   make(chan struct{}),
+	}
+	if paused {
+		lease.ResumeFrom = checkpoint
+		delete(s.checkpoints, jobID)
+	}
+	if lane == LaneBatch {
+		s.batch = append(s.batch, lease)
+	}
+	return lease
+}
+
+// freeSessions returns the number of free sessions, unbounded with an
+// unlimited GPU.
+func (s *Scheduler) freeSessions() int {
+	free := max(s.cpu.max-s.cpu.active, 0)
+	for _, d := range s.devices {
+		if d.unlimited() {
+			return math.MaxInt
+		}
+		free += max(d.max-d.active, 0)
+	}
+	return free
+}
+
+// preemptBatch asks the batch job that started last to pause, unless
+// enough preemptions are under way for the waiting playback jobs.
+func (s *Scheduler) preemptBatch() {
+	if s.preemptsInFlight >= s.playbackWaiting {
+		return
+	}
+	for i := len(s.batch) - 1; i >= 0; i-- {
+		lease := s.batch[i]
+		if lease.preempted {
+			continue
+		}
+		lease.preempted = true
+		close(lease.preempt)
+		s.preemptsInFlight++
+		s.preemptions++
+		return
+	}
+}
+
+// Checkpoint returns the segment a paused job resumes from.
+func (s *Scheduler) Checkpoint(jobID string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	segment, ok := s.checkpoints[jobID]
+	return segment, ok
+}
+
+// Forget drops the checkpoint of a paused job, such as when it is
+// cancelled.
+func (s *Scheduler) Forget(jobID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.checkpoints, jobID)
+}
+
+// Usage is the number of sessions in use of a GPU, or of the CPU when
+// Device is nil.
+type Usage struct {
+	Device *Device
+	Active int
+	// Max is the number of sessions allowed; zero is unlimited.
+	Max int
+}
+
+// Utilization returns the share of the sessions in use, from 0 to 1; zero
+// for unlimited devices.
+func (u Usage) Utilization() float64 {
+	if u.Max <= 0 {
+		return 0
+	}
+	return float64(u.Active) / float64(u.Max)
+}
+
+// Usage returns the sessions in use of each GPU, then of the CPU.
+func (s *Scheduler) Usage() []Usage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usage := make([]Usage, 0, len(s.devices)+1)
+	for _, d := range s.devices {
+		device := *d.device
+		usage = append(usage, Usage{Device: &device, Active: d.active, Max: d.max})
+	}
+	return append(usage, Usage{Active: s.cpu.active, Max: s.cpu.max})
+}
+
+// WriteMetrics writes the sessions in use and allowed of each GPU and of
+// the CPU of a worker, and the batch jobs it preempted.
+func (s *Scheduler) WriteMetrics(w *metrics.Writer, workerID string) {
+	for _, u := range s.Usage() {
+		if u.Device == nil {
+			w.Gauge(metrics.TranscodeCPUSessions, "Encode sessions running on the CPU.",
+				float64(u.Active), "worker", workerID)
+			continue
+		}
+		labels := []string{"worker", workerID, "gpu", strconv.Itoa(u.Device.Index), "name", u.Device.Name}
+		w.Gauge(metrics.TranscodeGPUSessions, "Encode sessions running on a GPU.",
+			float64(u.Active), labels...)
+		w.Gauge(metrics.TranscodeGPUSessionLimit, "Encode sessions a GPU allows; zero is unlimited.",
+			float64(u.Max), labels...)
+	}
+
+	s.mu.Lock()
+	preemptions := s.preemptions
+	s.mu.Unlock()
+	w.Counter(metrics.TranscodePreemptionsTotal, "Batch transcodes paused for playback.",
+		float64(preemptions), "worker", workerID)
+}
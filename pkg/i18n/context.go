@@ -0,0 +1,48 @@
+package i18n
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type contextKey struct{}
+
+// language holds the language of a request. It is shared by the contexts
+// derived from the request's context, so a language learned late, such as
+// the preference of the authenticated user, is seen by the interceptors
+// that wrapped the call.
+type language struct {
+	value atomic.Value
+}
+
+// WithLanguage returns a copy of ctx carrying the given request language.
+func WithLanguage(ctx context.Context, lang string) context.Context {
+	l := &language{}
+	l.value.Store(normalize(lang))
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// SetLanguage changes the language of the request ctx belongs to. It does
+// nothing if lang is empty or ctx carries no language.
+func SetLanguage(ctx context.Context, lang string) {
+	if lang == "" {
+		return
+	}
+	if l, ok := ctx.Value(contextKey{}).(*language); ok {
+		l.value.Store(normalize(lang))
+	}
+}
+
+// FromContext returns the language of the request ctx belongs to, or the
+// default language.
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return DefaultLanguage
+	}
+	if l, ok := ctx.Value(contextKey{}).(*language); ok {
+		if lang, _ := l.value.Load().(string); lang != "" {
+			return lang
+		}
+	}
+	return DefaultLanguage
+}
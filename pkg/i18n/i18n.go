@@ -0,0 +1,182 @@
+// Package i18n localizes user-facing strings such as API error messages and
+// notification emails.
+//
+// Translations live in embedded JSON catalogs, one per language, that map
+// message keys to text. Error messages are keyed by their English text, so
+// a message without a translation is shown as it is. Templates such as
+// emails use named keys whose English text lives in the en catalog.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultLanguage is the language every lookup falls back to.
+const DefaultLanguage = "en"
+
+//go:embed locales/*.json
+var locales embed.FS
+
+// Catalog holds the translations of each language.
+type Catalog struct {
+	messages map[string]map[string]string
+}
+
+// NewCatalog loads the catalogs in fsys. Each file is named after its
+// language, such as de.json or pt-br.json.
+func NewCatalog(fsys fs.FS) (*Catalog, error) {
+	files, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list catalogs: %w", err)
+	}
+
+	c := &Catalog{messages: make(map[string]map[string]string, len(files))}
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read catalog %s: %w", file, err)
+		}
+
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return nil, fmt.Errorf("failed to parse catalog %s: %w", file, err)
+		}
+		c.messages[normalize(strings.TrimSuffix(file, path.Ext(file)))] = messages
+	}
+
+	return c, nil
+}
+
+var defaultCatalog = sync.OnceValue(func() *Catalog {
+	sub, err := fs.Sub(locales, "locales")
+	if err != nil {
+		panic(err)
+	}
+	c, err := NewCatalog(sub)
+	if err != nil {
+		panic(err)
+	}
+	return c
+})
+
+// Default returns the catalog embedded in the binary.
+func Default() *Catalog {
+	return defaultCatalog()
+}
+
+// T translates key into lang with the embedded catalog and formats it with
+// args.
+func T(lang, key string, args ...interface{}) string {
+	return Default().Sprintf(lang, key, args...)
+}
+
+// Languages returns the languages of the catalog.
+func (c *Catalog) Languages() []string {
+	languages := make([]string, 0, len(c.messages))
+	for lang := range c.messages {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Translate returns the text of key in lang. It falls back from a regional
+// language to its base language, such as pt-br to pt, then to the default
+// language, and finally to the key itself.
+func (c *Catalog) Translate(lang, key string) string {
+	for _, candidate := range Fallbacks(lang) {
+		if text, ok := c.messages[candidate][key]; ok {
+			return text
+		}
+	}
+	return key
+}
+
+// Sprintf translates key into lang and formats it with args.
+func (c *Catalog) Sprintf(lang, key string, args ...interface{}) string {
+	text := c.Translate(lang, key)
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// Supports reports whether lang is the default language or the catalog
+// has translations for it or its base language.
+func (c *Catalog) Supports(lang string) bool {
+	lang = normalize(lang)
+	if base, _, _ := strings.Cut(lang, "-"); base == DefaultLanguage {
+		return true
+	}
+	for _, candidate := range Fallbacks(lang) {
+		if _, ok := c.messages[candidate]; ok && candidate != DefaultLanguage {
+			return true
+		}
+	}
+	return false
+}
+
+// Match picks the language of an Accept-Language header the catalog
+// supports best. It returns the default language if it supports none.
+func (c *Catalog) Match(acceptLanguage string) string {
+	type weighted struct {
+		lang string
+		q    float64
+	}
+
+	var candidates []weighted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if lang != "" && lang != "*" && q > 0 {
+			candidates = append(candidates, weighted{lang: lang, q: q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+
+	for _, candidate := range candidates {
+		if c.Supports(candidate.lang) {
+			return normalize(candidate.lang)
+		}
+	}
+	return DefaultLanguage
+}
+
+// Fallbacks returns the languages a lookup in lang tries, in order.
+func Fallbacks(lang string) []string {
+	lang = normalize(lang)
+
+	var chain []string
+	for lang != "" {
+		chain = append(chain, lang)
+		i := strings.LastIndex(lang, "-")
+		if i < 0 {
+			break
+		}
+		lang = lang[:i]
+	}
+	if len(chain) == 0 || chain[len(chain)-1] != DefaultLanguage {
+		chain = append(chain, DefaultLanguage)
+	}
+	return chain
+}
+
+// normalize lowercases a language tag and separates its subtags with dashes.
+func normalize(lang string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(lang), "_", "-"))
+}
@@ -0,0 +1,79 @@
+package i18n_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/pkg/i18n"
+)
+
+func newCatalog(t *testing.T) *i18n.Catalog {
+	t.Helper()
+	catalog, err := i18n.NewCatalog(fstest.MapFS{
+		"en.json":    {Data: []byte(`{"greeting": "Hello %s"}`)},
+		"pt.json":    {Data: []byte(`{"greeting": "Olá %s", "media not found": "mídia não encontrada"}`)},
+		"pt-br.json": {Data: []byte(`{"media not found": "mídia não encontrada no Brasil"}`)},
+	})
+	require.NoError(t, err)
+	return catalog
+}
+
+func TestCatalog_Translate(t *testing.T) {
+	catalog := newCatalog(t)
+
+	assert.Equal(t, "mídia não encontrada no Brasil", catalog.Translate("pt_BR", "media not found"))
+	assert.Equal(t, "Olá Ana", catalog.Sprintf("pt-BR", "greeting", "Ana"))
+	assert.Equal(t, "Hello Ana", catalog.Sprintf("de", "greeting", "Ana"))
+	assert.Equal(t, "library not found", catalog.Translate("pt", "library not found"))
+}
+
+func TestCatalog_Match(t *testing.T) {
+	catalog := newCatalog(t)
+
+	assert.Equal(t, "pt-br", catalog.Match("pt-BR,pt;q=0.9,en;q=0.8"))
+	assert.Equal(t, "pt", catalog.Match("de;q=0.9, pt;q=0.5"))
+	assert.Equal(t, "en", catalog.Match("de, fr;q=0.5"))
+	assert.Equal(t, "en-us", catalog.Match("en-US, pt;q=0.5"))
+	assert.Equal(t, "en", catalog.Match(""))
+}
+
+func TestFallbacks(t *testing.T) {
+	assert.Equal(t, []string{"zh-hant-tw", "zh-hant", "zh", "en"}, i18n.Fallbacks("zh-Hant-TW"))
+	assert.Equal(t, []string{"en"}, i18n.Fallbacks(""))
+}
+
+func TestLanguageContext(t *testing.T) {
+	assert.Equal(t, i18n.DefaultLanguage, i18n.FromContext(context.Background()))
+
+	ctx := i18n.WithLanguage(context.Background(), "fr")
+	derived := context.WithValue(ctx, struct{}{}, "value")
+	i18n.SetLanguage(derived, "de")
+	assert.Equal(t, "de", i18n.FromContext(ctx))
+
+	i18n.SetLanguage(derived, "")
+	assert.Equal(t, "de", i18n.FromContext(ctx))
+}
+
+// Every embedded catalog must translate the templates of the en catalog
+// with the same placeholders.
+func TestDefaultCatalog(t *testing.T) {
+	catalog := i18n.Default()
+	require.Contains(t, catalog.Languages(), "en")
+
+	templates := []string{"email.verify.subject", "email.verify.body", "email.verify.approval"}
+	for _, lang := range catalog.Languages() {
+		for _, key := range templates {
+			text := catalog.Translate(lang, key)
+			require.NotEqual(t, key, text, "%s has no %s", lang, key)
+			assert.Equal(t,
+				strings.Count(catalog.Translate("en", key), "%"),
+				strings.Count(text, "%"),
+				"placeholders of %s in %s", key, lang)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Package imaging provides validation and resizing for user-supplied images.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"  // register GIF decoder
+	_ "image/jpeg" // register JPEG decoder
+	"image/png"
+)
+
+var (
+	// ErrUnsupportedFormat is returned for images that are not JPEG, PNG or GIF.
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	// ErrTooLarge is returned for images whose dimensions exceed the allowed maximum.
+	ErrTooLarge = errors.New("image dimensions too large")
+)
+
+// MaxSourceDimension bounds the width and height of decoded images so that a
+// small compressed upload cannot expand into an enormous bitmap.
+const MaxSourceDimension = 8192
+
+var supportedFormats = map[string]bool{
+	"jpeg": true,
+	"png":  true,
+	"gif":  true,
+}
+
+// Decode validates and decodes an image, returning it with its format name.
+func Decode(data []byte) (image.Image, string, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrUnsupportedFormat
+	}
+	if !supportedFormats[format] {
+		return nil, "", ErrUnsupportedFormat
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 ||
+		cfg.Width > MaxSourceDimension || cfg.Height > MaxSourceDimension {
+		return nil, "", ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %w", err)
+	}
+	return img, format, nil
+}
+
+// SquareThumbnail center-crops img to a square and scales it to size×size
+// using area averaging.
+func SquareThumbnail(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	crop := image.Rect(0, 0, side, side).Add(image.Pt(
+		b.Min.X+(b.Dx()-side)/2,
+		b.Min.Y+(b.Dy()-side)/2,
+	))
+
+	src := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(src, src.Bounds(), img, crop.Min, draw.Src)
+
+	if side <= size {
+		return scaleUp(src, size)
+	}
+	return scaleDown(src, size)
+}
+
+// EncodePNG encodes img as PNG.
+func EncodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// scaleDown averages every source pixel that falls inside each destination pixel.
+func scaleDown(src *image.RGBA, size int) *image.RGBA {
+	side := src.Bounds().Dx()
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+
+	for y := 0; y < size; y++ {
+		y0, y1 := y*side/size, (y+1)*side/size
+		for x := 0; x < size; x++ {
+			x0, x1 := x*side/size, (x+1)*side/size
+
+			var r, g, bl, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					i := src.PixOffset(sx, sy)
+					r += uint32(src.Pix[i])
+					g += uint32(src.Pix[i+1])
+					bl += uint32(src.Pix[i+2])
+					a += uint32(src.Pix[i+3])
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(bl / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// scaleUp uses nearest-neighbor sampling; avatars smaller than the target
+// size are rare and upscaling cannot add detail anyway.
+func scaleUp(src *image.RGBA, size int) *image.RGBA {
+	side := src.Bounds().Dx()
+	if side == size {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		sy := y * side / size
+		for x := 0; x < size; x++ {
+			sx := x * side / size
+			di, si := dst.PixOffset(x, y), src.PixOffset(sx, sy)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
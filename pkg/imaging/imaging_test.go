@@ -0,0 +1,62 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encodeTestPNG(t *testing.T, w, h int, c color.Color) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	img, format, err := Decode(encodeTestPNG(t, 40, 20, color.White))
+	require.NoError(t, err)
+	assert.Equal(t, "png", format)
+	assert.Equal(t, 40, img.Bounds().Dx())
+
+	_, _, err = Decode([]byte("definitely not an image"))
+	require.ErrorIs(t, err, ErrUnsupportedFormat)
+
+	_, _, err = Decode(encodeTestPNG(t, MaxSourceDimension+1, 1, color.White))
+	require.ErrorIs(t, err, ErrTooLarge)
+}
+
+func TestSquareThumbnail(t *testing.T) {
+	red := color.RGBA{R: 255, A: 255}
+	img, _, err := Decode(encodeTestPNG(t, 300, 200, red))
+	require.NoError(t, err)
+
+	thumb := SquareThumbnail(img, 64)
+	assert.Equal(t, image.Rect(0, 0, 64, 64), thumb.Bounds())
+	assert.Equal(t, red, thumb.RGBAAt(10, 10))
+
+	small := SquareThumbnail(image.NewRGBA(image.Rect(0, 0, 16, 32)), 64)
+	assert.Equal(t, image.Rect(0, 0, 64, 64), small.Bounds())
+}
+
+func TestEncodePNG(t *testing.T) {
+	data, err := EncodePNG(image.NewRGBA(image.Rect(0, 0, 8, 8)))
+	require.NoError(t, err)
+
+	_, format, err := Decode(data)
+	require.NoError(t, err)
+	assert.Equal(t, "png", format)
+}
@@ -0,0 +1,9 @@
+package interfaces
+
+import "context"
+
+// Mailer defines an interface for sending transactional email.
+type Mailer interface {
+	// Send delivers a plain-text message to a single recipient
+	Send(ctx context.Context, to, subject, body string) error
+}
@@ -0,0 +1,23 @@
+package interfaces
+
+import "context"
+
+// ObjectStore defines an interface for storing small binary objects such as images.
+type ObjectStore interface {
+	// Put stores data under key, replacing any existing object
+	Put(ctx context.Context, key string, data []byte) error
+
+	// Delete removes the object stored under key; missing objects are not an error
+	Delete(ctx context.Context, key string) error
+
+	// URL returns the public URL for key
+	URL(key string) string
+}
+
+// ObjectReader is implemented by object stores objects can be read back
+// from, such as those holding logs that are not served publicly.
+type ObjectReader interface {
+	// Get returns the object stored under key. Missing objects return an
+	// error wrapping fs.ErrNotExist
+	Get(ctx context.Context, key string) ([]byte, error)
+}
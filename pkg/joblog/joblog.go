@@ -0,0 +1,234 @@
+// Package joblog keeps the logs of transcode jobs and downloads, such as
+// the stderr of ffmpeg and the errors of download clients, so failures can
+// be diagnosed after the fact instead of from the service logs.
+//
+// Logs are captured in a Buffer, which keeps their start and end within a
+// fixed size, and kept gzipped in an object store. Failure events carry the
+// last lines of the log, as returned by Tail.
+package joblog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// Default sizes of the captured parts of a log. The start of an ffmpeg log
+// holds its configuration and stream mapping, the end the error that
+// stopped it.
+const (
+	DefaultHeadSize = 16 << 10
+	DefaultTailSize = 48 << 10
+)
+
+// Default limits of the tails carried by failure events.
+const (
+	DefaultTailLines = 20
+	maxTailBytes     = 4 << 10
+)
+
+// Buffer captures a log, keeping its first and last bytes once it outgrows
+// them. It is safe for concurrent use, so it can be the stdout and stderr
+// of a command at once.
+type Buffer struct {
+	mu       sync.Mutex
+	headSize int
+	tailSize int
+	head     []byte
+	tail     []byte
+	written  int64
+	now      func() time.Time
+}
+
+// NewBuffer creates a buffer keeping the first headSize and the last
+// tailSize bytes of a log.
+func NewBuffer(headSize, tailSize int) *Buffer {
+	return &Buffer{
+		headSize: headSize,
+		tailSize: tailSize,
+		now:      time.Now,
+	}
+}
+
+// Write appends p to the log. It never fails.
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.written += int64(len(p))
+	rest := p
+	if room := b.headSize - len(b.head); room > 0 {
+		n := min(room, len(rest))
+		b.head = append(b.head, rest[:n]...)
+		rest = rest[n:]
+	}
+	if len(rest) == 0 || b.tailSize <= 0 {
+		return len(p), nil
+	}
+
+	b.tail = append(b.tail, rest...)
+	// Compacting once the tail doubles keeps appends amortized
+	if len(b.tail) > 2*b.tailSize {
+		b.tail = append(b.tail[:0], b.tail[len(b.tail)-b.tailSize:]...)
+	}
+	return len(p), nil
+}
+
+// Logf appends a timestamped line to the log, such as an error reported by
+// a download client.
+func (b *Buffer) Logf(format string, args ...any) {
+	line := b.now().UTC().Format(time.RFC3339) + " " + strings.TrimRight(fmt.Sprintf(format, args...), "\n") + "\n"
+	_, _ = b.Write([]byte(line))
+}
+
+// Truncated reports whether bytes were dropped from the middle of the log.
+func (b *Buffer) Truncated() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.omitted() > 0
+}
+
+// Bytes returns the captured log. Truncated logs mark where bytes were
+// dropped.
+func (b *Buffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	tail := b.tail
+	if len(tail) > b.tailSize {
+		tail = tail[len(tail)-b.tailSize:]
+	}
+	log := make([]byte, 0, len(b.head)+len(tail)+64)
+	log = append(log, b.head...)
+	if omitted := b.omitted(); omitted > 0 {
+		log = append(log, fmt.Sprintf("\n[... %d bytes omitted ...]\n", omitted)...)
+	}
+	return append(log, tail...)
+}
+
+func (b *Buffer) omitted() int64 {
+	return b.written - int64(len(b.head)) - int64(min(len(b.tail), b.tailSize))
+}
+
+// Tail returns the last lines of a log, at most a few KiB of them. Carriage
+// returns end lines too, as they do in the progress output of ffmpeg.
+func Tail(log []byte, lines int) string {
+	var kept []string
+	size := 0
+	for end := len(log); end > 0 && len(kept) < lines; {
+		start := bytes.LastIndexAny(log[:end], "\r\n") + 1
+		line := strings.TrimSpace(string(log[start:end]))
+		end = max(start-1, 0)
+		if line == "" {
+			continue
+		}
+		if size+len(line) > maxTailBytes {
+			break
+		}
+		size += len(line) + 1
+		kept = append(kept, line)
+	}
+
+	for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+		kept[i], kept[j] = kept[j], kept[i]
+	}
+	return strings.Join(kept, "\n")
+}
+
+// Kind is the kind of entity a log belongs to.
+type Kind string
+
+// Kinds of logs.
+const (
+	KindTranscode Kind = "transcode"
+	KindDownload  Kind = "download"
+)
+
+// Objects is an object store logs can be read back from.
+type Objects interface {
+	interfaces.ObjectStore
+	interfaces.ObjectReader
+}
+
+// Log is a stored log.
+type Log struct {
+	Content    []byte
+	CapturedAt time.Time
+}
+
+// Store keeps logs gzipped in an object store. Logs may hold paths and
+// URLs, so the store should not serve its objects publicly.
+type Store struct {
+	objects Objects
+	now     func() time.Time
+}
+
+// NewStore creates a store keeping logs in objects.
+func NewStore(objects Objects) *Store {
+	return &Store{objects: objects, now: time.Now}
+}
+
+// Key returns the object key of the log of an entity.
+func Key(kind Kind, id uuid.UUID) string {
+	return fmt.Sprintf("logs/%s/%s.log.gz", kind, id)
+}
+
+// Save stores the log of an entity, replacing any earlier one, such as
+// that of a previous attempt.
+func (s *Store) Save(ctx context.Context, kind Kind, id uuid.UUID, log []byte) error {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.ModTime = s.now()
+	if _, err := zw.Write(log); err != nil {
+		return fmt.Errorf("failed to compress log: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to compress log: %w", err)
+	}
+	if err := s.objects.Put(ctx, Key(kind, id), buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to store log: %w", err)
+	}
+	return nil
+}
+
+// Load returns the log of an entity.
+func (s *Store) Load(ctx context.Context, kind Kind, id uuid.UUID) (*Log, error) {
+	data, err := s.objects.Get(ctx, Key(kind, id))
+	if stderrors.Is(err, fs.ErrNotExist) {
+		return nil, errors.NotFound(fmt.Sprintf("no log for %s %s", kind, id))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load log: %w", err)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress log: %w", err)
+	}
+	defer zr.Close()
+	content, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress log: %w", err)
+	}
+	return &Log{Content: content, CapturedAt: zr.ModTime}, nil
+}
+
+// Delete removes the log of an entity, if any.
+func (s *Store) Delete(ctx context.Context, kind Kind, id uuid.UUID) error {
+	if err := s.objects.Delete(ctx, Key(kind, id)); err != nil {
+		return fmt.Errorf("failed to delete log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package joblog_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/joblog"
+	"github.com/narwhalmedia/narwhal/pkg/storage"
+)
+
+func TestBuffer(t *testing.T) {
+	buf := joblog.NewBuffer(8, 8)
+	_, _ = buf.Write([]byte("ffmpeg v6"))
+	assert.False(t, buf.Truncated())
+	assert.Equal(t, "ffmpeg v6", string(buf.Bytes()))
+
+	for i := 0; i < 100; i++ {
+		_, _ = fmt.Fprintf(buf, "frame=%d\n", i)
+	}
+	_, _ = buf.Write([]byte("Error!\n"))
+	assert.True(t, buf.Truncated())
+	log := string(buf.Bytes())
+	assert.True(t, strings.HasPrefix(log, "ffmpeg v"), log)
+	assert.True(t, strings.HasSuffix(log, "\nError!\n"), log)
+	assert.Contains(t, log, "bytes omitted")
+}
+
+func TestTail(t *testing.T) {
+	log := []byte("Input #0, matroska\n\nframe=1 fps=0\rframe=2 fps=24\r\nError while decoding stream #0:1\nConversion failed!\n")
+	assert.Equal(t, "Error while decoding stream #0:1\nConversion failed!", joblog.Tail(log, 2))
+	assert.Equal(t, "frame=2 fps=24\nError while decoding stream #0:1\nConversion failed!", joblog.Tail(log, 3))
+	assert.Len(t, strings.Split(joblog.Tail(log, 50), "\n"), 5, "blank lines are skipped")
+	assert.Empty(t, joblog.Tail(nil, 5))
+
+	long := strings.Repeat("x", 3000)
+	assert.Equal(t, long, joblog.Tail([]byte(long+"\n"+long+"\n"), 2), "tails stay a few KiB")
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	objects, err := storage.NewLocalStore(t.TempDir(), "")
+	require.NoError(t, err)
+	store := joblog.NewStore(objects)
+	id := uuid.New()
+
+	_, err = store.Load(ctx, joblog.KindTranscode, id)
+	assert.True(t, errors.IsNotFound(err))
+
+	require.NoError(t, store.Save(ctx, joblog.KindTranscode, id, []byte("Conversion failed!\n")))
+	log, err := store.Load(ctx, joblog.KindTranscode, id)
+	require.NoError(t, err)
+	assert.Equal(t, "Conversion failed!\n", string(log.Content))
+	assert.WithinDuration(t, time.Now(), log.CapturedAt, 2*time.Second)
+
+	_, err = store.Load(ctx, joblog.KindDownload, id)
+	assert.True(t, errors.IsNotFound(err), "kinds are kept apart")
+
+	require.NoError(t, store.Delete(ctx, joblog.KindTranscode, id))
+	_, err = store.Load(ctx, joblog.KindTranscode, id)
+	assert.True(t, errors.IsNotFound(err))
+}
@@ -0,0 +1,343 @@
+// Package loadshed rejects low-priority calls while a service is saturated,
+// so playback and sign-in stay responsive during heavy scans and
+// transcodes. Saturation is sampled from the wait for database
+// connections, the number of goroutines and, on Linux, IO pressure.
+package loadshed
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/metrics"
+)
+
+// Priority is how important a method is to keep serving under load.
+type Priority int
+
+// Priorities, lowest first. Low priority calls are shed once the service
+// is saturated, normal ones once it is twice over its limits, and critical
+// ones never.
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityCritical
+)
+
+// ParsePriority parses "low", "normal" or "critical".
+func ParsePriority(s string) (Priority, error) {
+	switch s {
+	case "low":
+		return PriorityLow, nil
+	case "normal":
+		return PriorityNormal, nil
+	case "critical":
+		return PriorityCritical, nil
+	default:
+		return 0, fmt.Errorf("unknown priority %q", s)
+	}
+}
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityCritical:
+		return "critical"
+	default:
+		return "normal"
+	}
+}
+
+// DefaultMethodPriorities returns the priorities of the methods that are
+// not normal: playback and authentication are critical, and bulk
+// operations and reports that walk whole libraries are low.
+func DefaultMethodPriorities() map[string]Priority {
+	return map[string]Priority{
+		"/grpc.health.v1.Health/Check": PriorityCritical,
+		"/grpc.health.v1.Health/Watch": PriorityCritical,
+
+		"/narwhal.auth.v1.AuthService/Login":                PriorityCritical,
+		"/narwhal.auth.v1.AuthService/VerifyLogin":          PriorityCritical,
+		"/narwhal.auth.v1.AuthService/ExchangeOIDCToken":    PriorityCritical,
+		"/narwhal.auth.v1.AuthService/RefreshToken":         PriorityCritical,
+		"/narwhal.auth.v1.AuthService/ValidateToken":        PriorityCritical,
+		"/narwhal.auth.v1.AuthService/CheckPermission":      PriorityCritical,
+		"/narwhal.auth.v1.AuthService/BulkCheckPermissions": PriorityCritical,
+		"/narwhal.auth.v1.AuthService/RequestDataExport":    PriorityLow,
+		"/narwhal.auth.v1.AuthService/ListImpersonations":   PriorityLow,
+
+		"/narwhal.streaming.v1.StreamingService/CreateStream":        PriorityCritical,
+		"/narwhal.streaming.v1.StreamingService/GetStreamInfo":       PriorityCritical,
+		"/narwhal.streaming.v1.StreamingService/GetManifest":         PriorityCritical,
+		"/narwhal.streaming.v1.StreamingService/GetSegment":          PriorityCritical,
+		"/narwhal.streaming.v1.StreamingService/StopStream":          PriorityCritical,
+		"/narwhal.streaming.v1.StreamingService/StartSession":        PriorityCritical,
+		"/narwhal.streaming.v1.StreamingService/UpdateSession":       PriorityCritical,
+		"/narwhal.streaming.v1.StreamingService/EndSession":          PriorityCritical,
+		"/narwhal.streaming.v1.StreamingService/ReportProgress":      PriorityCritical,
+		"/narwhal.streaming.v1.StreamingService/GetPlaybackPosition": PriorityCritical,
+		"/narwhal.streaming.v1.StreamingService/GetDeviceProfile":    PriorityCritical,
+
+		"/narwhal.library.v1.LibraryService/RecordWatchProgress":    PriorityCritical,
+		"/narwhal.library.v1.LibraryService/ScanLibrary":            PriorityLow,
+		"/narwhal.library.v1.LibraryService/PreviewScan":            PriorityLow,
+		"/narwhal.library.v1.LibraryService/ExportLibrary":          PriorityLow,
+		"/narwhal.library.v1.LibraryService/ImportLibrary":          PriorityLow,
+		"/narwhal.library.v1.LibraryService/RelocateLibrary":        PriorityLow,
+		"/narwhal.library.v1.LibraryService/PreviewRename":          PriorityLow,
+		"/narwhal.library.v1.LibraryService/ApplyRename":            PriorityLow,
+		"/narwhal.library.v1.LibraryService/RefreshThemeMusic":      PriorityLow,
+		"/narwhal.library.v1.LibraryService/RebuildSearchIndex":     PriorityLow,
+		"/narwhal.library.v1.LibraryService/RefreshMetadata":        PriorityLow,
+		"/narwhal.library.v1.LibraryService/ApplyTranscodePolicies": PriorityLow,
+		"/narwhal.library.v1.LibraryService/ListWorkflowHistory":    PriorityLow,
+		"/narwhal.library.v1.LibraryService/GetStorageUsage":        PriorityLow,
+		"/narwhal.library.v1.LibraryService/ListPlaybackIssueStats": PriorityLow,
+		"/narwhal.library.v1.LibraryService/ListHookRuns":           PriorityLow,
+		"/narwhal.library.v1.LibraryService/SearchReleases":         PriorityLow,
+	}
+}
+
+// Limits are the levels of each signal at which the service is saturated.
+// A zero limit ignores its signal.
+type Limits struct {
+	// MaxDBWait is the average time calls waited for a database connection
+	// since the previous sample.
+	MaxDBWait time.Duration
+	// MaxGoroutines is the number of goroutines.
+	MaxGoroutines int
+	// MaxIOPressure is the share of time, in percent, some task stalled on
+	// IO over the last 10 seconds, from /proc/pressure/io.
+	MaxIOPressure float64
+}
+
+// Load is a sample of the signals.
+type Load struct {
+	DBWait     time.Duration
+	Goroutines int
+	IOPressure float64
+}
+
+// saturation returns how far load is into the limits: 1 is at the limit
+// of the most saturated signal.
+func (l Limits) saturation(load Load) float64 {
+	var s float64
+	if l.MaxDBWait > 0 {
+		s = max(s, float64(load.DBWait)/float64(l.MaxDBWait))
+	}
+	if l.MaxGoroutines > 0 {
+		s = max(s, float64(load.Goroutines)/float64(l.MaxGoroutines))
+	}
+	if l.MaxIOPressure > 0 {
+		s = max(s, load.IOPressure/l.MaxIOPressure)
+	}
+	return s
+}
+
+// Shedder samples the load of the service and sheds calls by the priority
+// of their method.
+type Shedder struct {
+	limits     Limits
+	priorities map[string]Priority
+	retryAfter time.Duration
+	logger     interfaces.Logger
+
+	db             *sql.DB
+	lastWaitCount  int64
+	lastWaitTotal  time.Duration
+	ioPressurePath string
+
+	// shedBelow is the lowest priority that is served
+	shedBelow atomic.Int32
+	load      atomic.Pointer[Load]
+
+	mu   sync.Mutex
+	shed map[string]uint64 // by method
+}
+
+// New creates a shedder with the default method priorities overridden by
+// priorities. Shed calls are told to retry after retryAfter. Nothing is
+// shed until the load is sampled.
+func New(limits Limits, priorities map[string]Priority, retryAfter time.Duration, logger interfaces.Logger) *Shedder {
+	merged := DefaultMethodPriorities()
+	for method, p := range priorities {
+		merged[method] = p
+	}
+	s := &Shedder{
+		limits:         limits,
+		priorities:     merged,
+		retryAfter:     retryAfter,
+		logger:         logger,
+		ioPressurePath: "/proc/pressure/io",
+		shed:           make(map[string]uint64),
+	}
+	s.load.Store(&Load{})
+	return s
+}
+
+// WithDB sets the database pool whose connection wait is sampled.
+func (s *Shedder) WithDB(db *sql.DB) *Shedder {
+	s.db = db
+	return s
+}
+
+// PriorityOf returns the priority of a full method name.
+func (s *Shedder) PriorityOf(method string) Priority {
+	if p, ok := s.priorities[method]; ok {
+		return p
+	}
+	return PriorityNormal
+}
+
+// Run samples the load every interval until ctx is done.
+func (s *Shedder) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Update(s.Sample())
+		}
+	}
+}
+
+// Sample reads the current load.
+func (s *Shedder) Sample() Load {
+	load := Load{Goroutines: runtime.NumGoroutine()}
+	if s.db != nil {
+		stats := s.db.Stats()
+		if waits := stats.WaitCount - s.lastWaitCount; waits > 0 {
+			load.DBWait = (stats.WaitDuration - s.lastWaitTotal) / time.Duration(waits)
+		}
+		s.lastWaitCount, s.lastWaitTotal = stats.WaitCount, stats.WaitDuration
+	}
+	if s.limits.MaxIOPressure > 0 {
+		// Pressure stall information is only available on Linux
+		if pressure, err := readIOPressure(s.ioPressurePath); err == nil {
+			load.IOPressure = pressure
+		}
+	}
+	return load
+}
+
+// Update sets the load calls are shed by.
+func (s *Shedder) Update(load Load) {
+	saturation := s.limits.saturation(load)
+	shedBelow := PriorityLow
+	switch {
+	case saturation >= 2:
+		shedBelow = PriorityCritical
+	case saturation >= 1:
+		shedBelow = PriorityNormal
+	}
+	s.load.Store(&load)
+
+	if previous := Priority(s.shedBelow.Swap(int32(shedBelow))); previous != shedBelow && s.logger != nil {
+		fields := []interfaces.Field{
+			interfaces.String("db_wait", load.DBWait.String()),
+			interfaces.Int("goroutines", load.Goroutines),
+			interfaces.Any("io_pressure", load.IOPressure),
+		}
+		if shedBelow == PriorityLow {
+			s.logger.Info("Load back to normal, no longer shedding calls", fields...)
+		} else {
+			s.logger.Warn("Service saturated, shedding calls below "+shedBelow.String()+" priority", fields...)
+		}
+	}
+}
+
+// admit returns Unavailable for calls to method while its priority is
+// shed, and counts them.
+func (s *Shedder) admit(method string) error {
+	if s.PriorityOf(method) >= Priority(s.shedBelow.Load()) {
+		return nil
+	}
+	s.mu.Lock()
+	s.shed[method]++
+	s.mu.Unlock()
+	return status.Error(codes.Unavailable, "server is overloaded, retry later")
+}
+
+// retryAfterHeader tells clients when to retry a shed call.
+func (s *Shedder) retryAfterHeader() metadata.MD {
+	return metadata.Pairs("retry-after", strconv.Itoa(int(max(s.retryAfter, time.Second).Seconds())))
+}
+
+// UnaryServerInterceptor sheds unary calls, with a retry-after header of
+// the seconds to wait.
+func (s *Shedder) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := s.admit(info.FullMethod); err != nil {
+			_ = grpc.SetHeader(ctx, s.retryAfterHeader())
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of
+// UnaryServerInterceptor.
+func (s *Shedder) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := s.admit(info.FullMethod); err != nil {
+			_ = ss.SetHeader(s.retryAfterHeader())
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// WriteMetrics writes the latest saturation and the calls shed to each method.
+func (s *Shedder) WriteMetrics(w *metrics.Writer) {
+	load := s.load.Load()
+	w.Gauge(metrics.LoadSaturation, "Load of the most saturated signal relative to its limit.",
+		s.limits.saturation(*load))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for method, count := range s.shed {
+		w.Counter(metrics.RequestsShedTotal, "Calls rejected while the service was saturated.",
+			float64(count), "method", method, "priority", s.PriorityOf(method).String())
+	}
+}
+
+// readIOPressure reads the "some avg10" share of a pressure stall file.
+func readIOPressure(path string) (float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "some" {
+			continue
+		}
+		if value, ok := strings.CutPrefix(fields[1], "avg10="); ok {
+			return strconv.ParseFloat(value, 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no io pressure in %s", path)
+}
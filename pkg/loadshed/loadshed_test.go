@@ -0,0 +1,75 @@
+package loadshed_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/narwhalmedia/narwhal/pkg/loadshed"
+	"github.com/narwhalmedia/narwhal/pkg/metrics"
+)
+
+const (
+	scanMethod     = "/narwhal.library.v1.LibraryService/ScanLibrary"
+	getMediaMethod = "/narwhal.library.v1.LibraryService/GetMedia"
+	segmentMethod  = "/narwhal.streaming.v1.StreamingService/GetSegment"
+)
+
+func TestShedder(t *testing.T) {
+	s := loadshed.New(loadshed.Limits{MaxDBWait: 100 * time.Millisecond, MaxGoroutines: 1000}, nil, 5*time.Second, nil)
+	interceptor := s.UnaryServerInterceptor()
+	call := func(method string) error {
+		_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method},
+			func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil })
+		return err
+	}
+
+	// Under the limits everything is served
+	s.Update(loadshed.Load{DBWait: 50 * time.Millisecond, Goroutines: 100})
+	require.NoError(t, call(scanMethod))
+	require.NoError(t, call(getMediaMethod))
+
+	// At a limit, low priority calls are shed
+	s.Update(loadshed.Load{DBWait: 150 * time.Millisecond, Goroutines: 100})
+	err := call(scanMethod)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	require.NoError(t, call(getMediaMethod))
+	require.NoError(t, call(segmentMethod))
+
+	// At twice a limit, only critical calls are served
+	s.Update(loadshed.Load{DBWait: 50 * time.Millisecond, Goroutines: 2500})
+	assert.Equal(t, codes.Unavailable, status.Code(call(getMediaMethod)))
+	require.NoError(t, call(segmentMethod))
+
+	var buf bytes.Buffer
+	s.WriteMetrics(metrics.NewWriter(&buf))
+	assert.Contains(t, buf.String(), `narwhal_load_saturation 2.5`)
+	assert.Contains(t, buf.String(),
+		`narwhal_requests_shed_total{method="/narwhal.library.v1.LibraryService/ScanLibrary",priority="low"} 1`)
+
+	// Once the load drops, calls are served again
+	s.Update(loadshed.Load{})
+	require.NoError(t, call(scanMethod))
+}
+
+func TestShedder_MethodPriorities(t *testing.T) {
+	s := loadshed.New(loadshed.Limits{MaxGoroutines: 10}, map[string]loadshed.Priority{
+		getMediaMethod: loadshed.PriorityCritical,
+		segmentMethod:  loadshed.PriorityLow,
+	}, time.Second, nil)
+
+	assert.Equal(t, loadshed.PriorityCritical, s.PriorityOf(getMediaMethod))
+	assert.Equal(t, loadshed.PriorityLow, s.PriorityOf(segmentMethod))
+	assert.Equal(t, loadshed.PriorityLow, s.PriorityOf(scanMethod))
+	assert.Equal(t, loadshed.PriorityNormal, s.PriorityOf("/narwhal.library.v1.LibraryService/ListMedia"))
+
+	_, err := loadshed.ParsePriority("urgent")
+	assert.Error(t, err)
+}
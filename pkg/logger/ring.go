@@ -0,0 +1,189 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// DefaultRingSize is the number of recent log entries a service keeps for
+// the log viewer.
+const DefaultRingSize = 2000
+
+// Entry is a log entry kept in a RingBuffer.
+type Entry struct {
+	// Seq increases by one with every entry, so readers can tail the
+	// buffer by asking for entries after the last one they saw.
+	Seq     uint64
+	Time    time.Time
+	Level   zapcore.Level
+	Service string
+	Message string
+	Fields  map[string]string
+}
+
+// TailFilter selects the entries returned by Tail.
+type TailFilter struct {
+	// MinLevel drops entries below this level.
+	MinLevel zapcore.Level
+	// Service only keeps entries of this service, if set.
+	Service string
+	// AfterSeq only keeps entries newer than this sequence number.
+	AfterSeq uint64
+	// Limit keeps the newest matching entries, if positive.
+	Limit int
+}
+
+// RingBuffer keeps the most recent log entries of a service in memory.
+type RingBuffer struct {
+	mu      sync.Mutex
+	entries []Entry
+	next    int
+	seq     uint64
+}
+
+// NewRingBuffer creates a buffer holding the last size entries.
+func NewRingBuffer(size int) *RingBuffer {
+	if size < 1 {
+		size = DefaultRingSize
+	}
+	return &RingBuffer{entries: make([]Entry, 0, size)}
+}
+
+// Add appends an entry, overwriting the oldest one once the buffer is full,
+// and returns its sequence number.
+func (r *RingBuffer) Add(entry Entry) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seq++
+	entry.Seq = r.seq
+	if len(r.entries) < cap(r.entries) {
+		r.entries = append(r.entries, entry)
+		return entry.Seq
+	}
+	r.entries[r.next] = entry
+	r.next = (r.next + 1) % len(r.entries)
+	return entry.Seq
+}
+
+// Tail returns the matching entries oldest first.
+func (r *RingBuffer) Tail(filter TailFilter) []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var entries []Entry
+	for i := range r.entries {
+		entry := r.entries[(r.next+i)%len(r.entries)]
+		if entry.Seq <= filter.AfterSeq || entry.Level < filter.MinLevel {
+			continue
+		}
+		if filter.Service != "" && entry.Service != filter.Service {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[len(entries)-filter.Limit:]
+	}
+	return entries
+}
+
+// LastSeq returns the sequence number of the newest entry.
+func (r *RingBuffer) LastSeq() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.seq
+}
+
+// RingLogger is a logger that records every entry in a RingBuffer before
+// passing it on.
+type RingLogger struct {
+	next    interfaces.Logger
+	ring    *RingBuffer
+	service string
+	fields  []interfaces.Field
+}
+
+// WithRing wraps next so every entry is also recorded in ring under service.
+func WithRing(next interfaces.Logger, ring *RingBuffer, service string) interfaces.Logger {
+	return &RingLogger{
+		next:    next,
+		ring:    ring,
+		service: service,
+	}
+}
+
+// Debug logs a debug message.
+func (l *RingLogger) Debug(msg string, fields ...interfaces.Field) {
+	l.record(zapcore.DebugLevel, msg, fields)
+	l.next.Debug(msg, fields...)
+}
+
+// Info logs an info message.
+func (l *RingLogger) Info(msg string, fields ...interfaces.Field) {
+	l.record(zapcore.InfoLevel, msg, fields)
+	l.next.Info(msg, fields...)
+}
+
+// Warn logs a warning message.
+func (l *RingLogger) Warn(msg string, fields ...interfaces.Field) {
+	l.record(zapcore.WarnLevel, msg, fields)
+	l.next.Warn(msg, fields...)
+}
+
+// Error logs an error message.
+func (l *RingLogger) Error(msg string, fields ...interfaces.Field) {
+	l.record(zapcore.ErrorLevel, msg, fields)
+	l.next.Error(msg, fields...)
+}
+
+// Fatal logs a fatal message and exits.
+func (l *RingLogger) Fatal(msg string, fields ...interfaces.Field) {
+	l.record(zapcore.FatalLevel, msg, fields)
+	l.next.Fatal(msg, fields...)
+}
+
+// WithContext returns a logger with context.
+func (l *RingLogger) WithContext(ctx context.Context) interfaces.Logger {
+	return &RingLogger{
+		next:    l.next.WithContext(ctx),
+		ring:    l.ring,
+		service: l.service,
+		fields:  l.fields,
+	}
+}
+
+// WithFields returns a logger with additional fields.
+func (l *RingLogger) WithFields(fields ...interfaces.Field) interfaces.Logger {
+	return &RingLogger{
+		next:    l.next.WithFields(fields...),
+		ring:    l.ring,
+		service: l.service,
+		fields:  append(append([]interfaces.Field(nil), l.fields...), fields...),
+	}
+}
+
+func (l *RingLogger) record(level zapcore.Level, msg string, fields []interfaces.Field) {
+	values := make(map[string]string, len(l.fields)+len(fields))
+	for _, field := range l.fields {
+		values[field.Key] = fmt.Sprint(field.Value)
+	}
+	for _, field := range fields {
+		values[field.Key] = fmt.Sprint(field.Value)
+	}
+
+	l.ring.Add(Entry{
+		Time:    time.Now(),
+		Level:   level,
+		Service: l.service,
+		Message: msg,
+		Fields:  values,
+	})
+}
@@ -0,0 +1,48 @@
+package logger_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/logger"
+)
+
+func TestRingBufferTail(t *testing.T) {
+	ring := logger.NewRingBuffer(3)
+	log := logger.WithRing(logger.NewNoopLogger(), ring, "library")
+
+	log.Debug("debug")
+	log.Info("first")
+	log.WithFields(interfaces.String("library_id", "lib-1")).Warn("second", interfaces.Error(errors.New("boom")))
+	log.Error("third")
+
+	// The oldest entry was overwritten
+	entries := ring.Tail(logger.TailFilter{})
+	require.Len(t, entries, 3)
+	assert.Equal(t, "first", entries[0].Message)
+	assert.Equal(t, uint64(2), entries[0].Seq)
+	assert.Equal(t, "third", entries[2].Message)
+	assert.Equal(t, uint64(4), ring.LastSeq())
+
+	assert.Equal(t, map[string]string{"library_id": "lib-1", "error": "boom"}, entries[1].Fields)
+	assert.Equal(t, "library", entries[1].Service)
+
+	entries = ring.Tail(logger.TailFilter{MinLevel: zapcore.WarnLevel})
+	require.Len(t, entries, 2)
+	assert.Equal(t, "second", entries[0].Message)
+
+	entries = ring.Tail(logger.TailFilter{AfterSeq: 3})
+	require.Len(t, entries, 1)
+	assert.Equal(t, "third", entries[0].Message)
+
+	entries = ring.Tail(logger.TailFilter{Limit: 1})
+	require.Len(t, entries, 1)
+	assert.Equal(t, "third", entries[0].Message)
+
+	assert.Empty(t, ring.Tail(logger.TailFilter{Service: "user"}))
+}
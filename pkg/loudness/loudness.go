@@ -0,0 +1,104 @@
+// Package loudness builds the ffmpeg loudnorm filters of two-pass EBU R128
+// audio normalization and parses the loudness the first pass measures.
+//
+// The first pass only measures the source; the second encodes it with the
+// measured values, which lets loudnorm normalize linearly instead of
+// compressing the dynamics of the audio on the fly.
+package loudness
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// EBU R128 targets.
+const (
+	TargetIntegrated = -23.0 // LUFS
+	TargetTruePeak   = -1.0  // dBTP
+	TargetRange      = 7.0   // LU
+)
+
+// ErrSilent is returned by Parse for sources without audible audio, which
+// have no loudness to normalize.
+var ErrSilent = errors.New("source audio is silent")
+
+// Measurement is the loudness of a source, as measured by the first pass.
+type Measurement struct {
+	Integrated   float64 // LUFS
+	TruePeak     float64 // dBTP
+	Range        float64 // LU
+	Threshold    float64 // LUFS
+	TargetOffset float64 // LU
+}
+
+// MeasureFilter returns the audio filter of the first pass, which prints
+// the measurement as JSON on stderr. Its output is discarded, such as with
+// -f null.
+func MeasureFilter() string {
+	return fmt.Sprintf("loudnorm=I=%s:TP=%s:LRA=%s:print_format=json",
+		format(TargetIntegrated), format(TargetTruePeak), format(TargetRange))
+}
+
+// NormalizeFilter returns the audio filter of the second pass, which
+// normalizes the source to the EBU R128 targets with its measurement.
+func NormalizeFilter(m Measurement) string {
+	return fmt.Sprintf("loudnorm=I=%s:TP=%s:LRA=%s:"+
+		"measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:"+
+		"linear=true:print_format=summary",
+		format(TargetIntegrated), format(TargetTruePeak), format(TargetRange),
+		format(m.Integrated), format(m.TruePeak), format(m.Range), format(m.Threshold), format(m.TargetOffset))
+}
+
+// Parse reads the measurement of the first pass from the stderr of ffmpeg,
+// where loudnorm prints it as the last JSON object.
+func Parse(stderr []byte) (Measurement, error) {
+	start := bytes.LastIndexByte(stderr, '{')
+	end := bytes.LastIndexByte(stderr, '}')
+	if start < 0 || end < start {
+		return Measurement{}, errors.New("no loudnorm measurement in ffmpeg output")
+	}
+
+	// loudnorm prints every value as a string
+	var raw struct {
+		InputI       string `json:"input_i"`
+		InputTP      string `json:"input_tp"`
+		InputLRA     string `json:"input_lra"`
+		InputThresh  string `json:"input_thresh"`
+		TargetOffset string `json:"target_offset"`
+	}
+	if err := json.Unmarshal(stderr[start:end+1], &raw); err != nil {
+		return Measurement{}, fmt.Errorf("invalid loudnorm measurement: %w", err)
+	}
+
+	var m Measurement
+	for _, field := range []struct {
+		name  string
+		value string
+		to    *float64
+	}{
+		{"input_i", raw.InputI, &m.Integrated},
+		{"input_tp", raw.InputTP, &m.TruePeak},
+		{"input_lra", raw.InputLRA, &m.Range},
+		{"input_thresh", raw.InputThresh, &m.Threshold},
+		{"target_offset", raw.TargetOffset, &m.TargetOffset},
+	} {
+		value, err := strconv.ParseFloat(field.value, 64)
+		if err != nil {
+			return Measurement{}, fmt.Errorf("invalid loudnorm %s %q", field.name, field.value)
+		}
+		*field.to = value
+	}
+	if math.IsInf(m.Integrated, -1) || math.IsInf(m.Threshold, -1) {
+		return Measurement{}, ErrSilent
+	}
+	return m, nil
+}
+
+// format formats a loudness value for a filter argument.
+func format(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
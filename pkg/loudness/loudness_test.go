@@ -0,0 +1,57 @@
+package loudness_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/pkg/loudness"
+)
+
+const firstPass = `[Parsed_loudnorm_0 @ 0x5581]
+{
+	"input_i" : "-27.61",
+	"input_tp" : "-4.47",
+	"input_lra" : "18.06",
+	"input_thresh" : "-39.20",
+	"output_i" : "-23.55",
+	"output_tp" : "-2.00",
+	"output_lra" : "7.10",
+	"output_thresh" : "-34.85",
+	"normalization_type" : "dynamic",
+	"target_offset" : "0.55"
+}
+`
+
+func TestParse(t *testing.T) {
+	m, err := loudness.Parse([]byte("size=N/A time=00:42:10.01 bitrate=N/A\n" + firstPass))
+	require.NoError(t, err)
+	assert.Equal(t, loudness.Measurement{
+		Integrated:   -27.61,
+		TruePeak:     -4.47,
+		Range:        18.06,
+		Threshold:    -39.20,
+		TargetOffset: 0.55,
+	}, m)
+
+	_, err = loudness.Parse([]byte(`{"input_i" : "-inf", "input_tp" : "-inf", "input_lra" : "0.00",
+		"input_thresh" : "-inf", "target_offset" : "inf"}`))
+	assert.ErrorIs(t, err, loudness.ErrSilent)
+
+	_, err = loudness.Parse([]byte("Output file is empty, nothing was encoded"))
+	assert.Error(t, err)
+
+	_, err = loudness.Parse([]byte(`{"input_i" : "loud"}`))
+	assert.Error(t, err)
+}
+
+func TestFilters(t *testing.T) {
+	assert.Equal(t, "loudnorm=I=-23.00:TP=-1.00:LRA=7.00:print_format=json", loudness.MeasureFilter())
+
+	m, err := loudness.Parse([]byte(firstPass))
+	require.NoError(t, err)
+	assert.Equal(t, "loudnorm=I=-23.00:TP=-1.00:LRA=7.00:"+
+		"measured_I=-27.61:measured_TP=-4.47:measured_LRA=18.06:measured_thresh=-39.20:offset=0.55:"+
+		"linear=true:print_format=summary", loudness.NormalizeFilter(m))
+}
@@ -0,0 +1,77 @@
+// Package mail provides Mailer implementations.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// SMTPConfig holds SMTP connection settings.
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPMailer sends mail through an SMTP relay.
+type SMTPMailer struct {
+	cfg SMTPConfig
+}
+
+// NewSMTPMailer creates a new SMTP mailer.
+func NewSMTPMailer(cfg SMTPConfig) *SMTPMailer {
+	return &SMTPMailer{cfg: cfg}
+}
+
+// Send sends a plain-text email.
+func (m *SMTPMailer) Send(_ context.Context, to, subject, body string) error {
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+	}
+
+	msg := strings.Join([]string{
+		"From: " + m.cfg.From,
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	if err := smtp.SendMail(addr, auth, m.cfg.From, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
+
+// LogMailer writes messages to the log instead of sending them.
+// It is intended for development installs without an SMTP relay.
+type LogMailer struct {
+	logger interfaces.Logger
+}
+
+// NewLogMailer creates a new log mailer.
+func NewLogMailer(logger interfaces.Logger) *LogMailer {
+	return &LogMailer{logger: logger}
+}
+
+// Send logs the email.
+func (m *LogMailer) Send(_ context.Context, to, subject, body string) error {
+	m.logger.Info("Email not sent (no SMTP relay configured)",
+		interfaces.String("to", to),
+		interfaces.String("subject", subject),
+		interfaces.String("body", body))
+	return nil
+}
@@ -0,0 +1,118 @@
+// Package metrics writes service metrics in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Names of the domain metrics exported by the services. The alert rules in
+// configs/prometheus/alerts.yml rely on them, so they must not change.
+const (
+	// TranscodeJobsPending is the number of transcode jobs waiting for a worker.
+	TranscodeJobsPending = "narwhal_transcoding_jobs_pending"
+	// TranscodeGPUSessions is the number of encode sessions running on
+	// each GPU of each transcode worker.
+	TranscodeGPUSessions = "narwhal_transcoding_gpu_sessions"
+	// TranscodeGPUSessionLimit is the number of encode sessions each GPU
+	// allows; zero is unlimited.
+	TranscodeGPUSessionLimit = "narwhal_transcoding_gpu_session_limit"
+	// TranscodeCPUSessions is the number of encode sessions running on the
+	// CPU of each transcode worker, once its GPUs are saturated.
+	TranscodeCPUSessions = "narwhal_transcoding_cpu_sessions"
+	// TranscodePreemptionsTotal counts the batch transcodes each worker
+	// paused to run playback transcodes.
+	TranscodePreemptionsTotal = "narwhal_transcoding_preemptions_total"
+	// DownloadsActive is the number of downloads in progress.
+	DownloadsActive = "narwhal_acquisition_downloads_active"
+	// EventsPending is the number of published events not yet delivered to
+	// every handler.
+	EventsPending = "narwhal_events_pending"
+	// EventsConsumerLagSeconds is how far behind each event handler was on
+	// its latest delivery.
+	EventsConsumerLagSeconds = "narwhal_events_consumer_lag_seconds"
+	// EventsDeadLetters is the number of events in the dead-letter queue.
+	EventsDeadLetters = "narwhal_events_dead_letters"
+	// LibraryScanDurationSeconds is the duration of the latest scan of each
+	// library.
+	LibraryScanDurationSeconds = "narwhal_library_scan_duration_seconds"
+	// LibraryImportFailuresTotal counts media that failed to import.
+	LibraryImportFailuresTotal = "narwhal_library_import_failures_total"
+	// LibraryImportSpaceSavedBytesTotal counts the bytes imports did not
+	// duplicate on disk by hardlinking downloads.
+	LibraryImportSpaceSavedBytesTotal = "narwhal_library_import_space_saved_bytes_total"
+	// StreamSessionsActive is the number of open playback sessions.
+	StreamSessionsActive = "narwhal_streaming_sessions_active"
+	// APIRequestsTotal counts the calls to each method of each API
+	// version, showing when a deprecated version can be removed.
+	APIRequestsTotal = "narwhal_api_requests_total"
+	// LoadSaturation is the latest load of a service relative to its
+	// limits: calls are shed from 1.
+	LoadSaturation = "narwhal_load_saturation"
+	// RequestsShedTotal counts the calls rejected while a service was
+	// saturated, by method and priority.
+	RequestsShedTotal = "narwhal_requests_shed_total"
+)
+
+// ContentType is the content type of the Prometheus text format.
+const ContentType = "text/plain; version=0.0.4"
+
+// Writer writes metrics in the Prometheus text format. The HELP and TYPE
+// lines of a metric are written before its first sample.
+type Writer struct {
+	w         io.Writer
+	described map[string]bool
+}
+
+// NewWriter creates a writer writing to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		w:         w,
+		described: make(map[string]bool),
+	}
+}
+
+// Gauge writes a gauge sample. labels are pairs of label names and values.
+func (w *Writer) Gauge(name, help string, value float64, labels ...string) {
+	w.sample("gauge", name, help, value, labels)
+}
+
+// Counter writes a counter sample. labels are pairs of label names and
+// values.
+func (w *Writer) Counter(name, help string, value float64, labels ...string) {
+	w.sample("counter", name, help, value, labels)
+}
+
+func (w *Writer) sample(kind, name, help string, value float64, labels []string) {
+	if !w.described[name] {
+		w.described[name] = true
+		fmt.Fprintf(w.w, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(w.w, "# TYPE %s %s\n", name, kind)
+	}
+
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(&b, "%s=%q", labels[i], labels[i+1])
+		}
+		b.WriteByte('}')
+	}
+	fmt.Fprintf(w.w, "%s %s\n", b.String(), strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// Handler serves the metrics written by collect.
+func Handler(collect func(w *Writer)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		w.WriteHeader(http.StatusOK)
+		collect(NewWriter(w))
+	})
+}
@@ -0,0 +1,28 @@
+package metrics_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/narwhalmedia/narwhal/pkg/metrics"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := metrics.NewWriter(&buf)
+
+	w.Gauge(metrics.EventsConsumerLagSeconds, "Event handler lag.", 1.5, "handler", "library.themes")
+	w.Gauge(metrics.EventsConsumerLagSeconds, "Event handler lag.", 0, "handler", "activity.feed")
+	w.Counter(metrics.LibraryImportFailuresTotal, "Failed imports.", 3)
+
+	assert.Equal(t, `# HELP narwhal_events_consumer_lag_seconds Event handler lag.
+# TYPE narwhal_events_consumer_lag_seconds gauge
+narwhal_events_consumer_lag_seconds{handler="library.themes"} 1.5
+narwhal_events_consumer_lag_seconds{handler="activity.feed"} 0
+# HELP narwhal_library_import_failures_total Failed imports.
+# TYPE narwhal_library_import_failures_total counter
+narwhal_library_import_failures_total 3
+`, buf.String())
+}
@@ -10,44 +10,53 @@ import (
 	"google.golang.org/grpc/status"
 
 	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/i18n"
+	"github.com/narwhalmedia/narwhal/pkg/tenant"
 )
 
+// systemPolicies holds the method policies of the dead-letter, diagnostics
+// and task services this interceptor guards, which only platform admins
+// may call.
+var systemPolicies = auth.DefaultMethodPolicies()
+
 // AuthInterceptor creates a gRPC interceptor for JWT authentication.
-func AuthInterceptor(jwtManager *auth.JWTManager, publicMethods map[string]bool) grpc.UnaryServerInterceptor {
+// Requests may send an API key instead, if apiKeys is not nil.
+func AuthInterceptor(
+	jwtManager *auth.JWTManager,
+	publicMethods map[string]bool,
+	apiKeys auth.APIKeyValidator,
+) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 		// Check if method is public
 		if publicMethods[info.FullMethod] {
 			return handler(ctx, req)
 		}
 
-		// Extract token from metadata
-		md, ok := metadata.FromIncomingContext(ctx)
-		if !ok {
-			return nil, status.Error(codes.Unauthenticated, "missing metadata")
+		claims, err := authenticate(ctx, jwtManager, apiKeys)
+		if err != nil {
+			return nil, err
 		}
 
-		// Get authorization header
-		authHeaders := md.Get("authorization")
-		if len(authHeaders) == 0 {
-			return nil, status.Error(codes.Unauthenticated, "missing authorization header")
-		}
+		// Add claims and tenant scope to context
+		ctx = context.WithValue(ctx, "claims", claims)
+		ctx = tenant.WithTenantID(ctx, claims.TenantUUID())
+		i18n.SetLanguage(ctx, claims.Language)
 
-		// Parse bearer token
-		authHeader := authHeaders[0]
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			return nil, status.Error(codes.Unauthenticated, "invalid authorization header format")
+		if err := auth.RequireConsent(claims, info.FullMethod, auth.ConsentExemptMethods()); err != nil {
+			return nil, err
 		}
 
-		token := strings.TrimPrefix(authHeader, "Bearer ")
+		if err := auth.RestrictShare(claims, info.FullMethod, req, auth.ShareMethods()); err != nil {
+			return nil, err
+		}
 
-		// Validate token
-		claims, err := jwtManager.ValidateAccessToken(token)
-		if err != nil {
-			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		if err := auth.RestrictKiosk(claims, info.FullMethod, auth.KioskMethods()); err != nil {
+			return nil, err
 		}
 
-		// Add claims to context
-		ctx = context.WithValue(ctx, "claims", claims)
+		if err := auth.RequireSystemAdmin(claims, systemPolicies[info.FullMethod]); err != nil {
+			return nil, err
+		}
 
 		// Call handler
 		return handler(ctx, req)
@@ -55,43 +64,45 @@ func AuthInterceptor(jwtManager *auth.JWTManager, publicMethods map[string]bool)
 }
 
 // StreamAuthInterceptor creates a gRPC stream interceptor for JWT authentication.
-func StreamAuthInterceptor(jwtManager *auth.JWTManager, publicMethods map[string]bool) grpc.StreamServerInterceptor {
+// Requests may send an API key instead, if apiKeys is not nil.
+func StreamAuthInterceptor(
+	jwtManager *auth.JWTManager,
+	publicMethods map[string]bool,
+	apiKeys auth.APIKeyValidator,
+) grpc.StreamServerInterceptor {
 	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
 		// Check if method is public
 		if publicMethods[info.FullMethod] {
 			return handler(srv, ss)
 		}
 
-		// Extract token from metadata
-		md, ok := metadata.FromIncomingContext(ss.Context())
-		if !ok {
-			return status.Error(codes.Unauthenticated, "missing metadata")
+		claims, err := authenticate(ss.Context(), jwtManager, apiKeys)
+		if err != nil {
+			return err
 		}
 
-		// Get authorization header
-		authHeaders := md.Get("authorization")
-		if len(authHeaders) == 0 {
-			return status.Error(codes.Unauthenticated, "missing authorization header")
+		i18n.SetLanguage(ss.Context(), claims.Language)
+
+		if err := auth.RequireConsent(claims, info.FullMethod, auth.ConsentExemptMethods()); err != nil {
+			return err
 		}
 
-		// Parse bearer token
-		authHeader := authHeaders[0]
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			return status.Error(codes.Unauthenticated, "invalid authorization header format")
+		if err := auth.RestrictShare(claims, info.FullMethod, nil, auth.ShareMethods()); err != nil {
+			return err
 		}
 
-		token := strings.TrimPrefix(authHeader, "Bearer ")
+		if err := auth.RestrictKiosk(claims, info.FullMethod, auth.KioskMethods()); err != nil {
+			return err
+		}
 
-		// Validate token
-		claims, err := jwtManager.ValidateAccessToken(token)
-		if err != nil {
-			return status.Error(codes.Unauthenticated, "invalid token")
+		if err := auth.RequireSystemAdmin(claims, systemPolicies[info.FullMethod]); err != nil {
+			return err
 		}
 
 		// Create wrapped stream with claims in context
 		wrappedStream := &wrappedServerStream{
 			ServerStream: ss,
-			ctx:          context.WithValue(ss.Context(), "claims", claims),
+			ctx:          tenant.WithTenantID(context.WithValue(ss.Context(), "claims", claims), claims.TenantUUID()),
 		}
 
 		// Call handler
@@ -99,6 +110,41 @@ func StreamAuthInterceptor(jwtManager *auth.JWTManager, publicMethods map[string
 	}
 }
 
+// authenticate validates the API key or bearer token of a request and
+// returns its claims.
+func authenticate(ctx context.Context, jwtManager *auth.JWTManager, apiKeys auth.APIKeyValidator) (*auth.CustomClaims, error) {
+	if key, ok := auth.APIKeyFromContext(ctx); ok {
+		return auth.AuthenticateAPIKey(ctx, apiKeys, key)
+	}
+
+	// Extract token from metadata
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing metadata")
+	}
+
+	// Get authorization header
+	authHeaders := md.Get("authorization")
+	if len(authHeaders) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "missing authorization header")
+	}
+
+	// Parse bearer token
+	authHeader := authHeaders[0]
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return nil, status.Error(codes.Unauthenticated, "invalid authorization header format")
+	}
+
+	token := strings.TrimPrefix(authHeader, "Bearer ")
+
+	// Validate token
+	claims, err := jwtManager.ValidateAccessToken(token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	return claims, nil
+}
+
 // wrappedServerStream wraps a ServerStream with a custom context.
 type wrappedServerStream struct {
 	grpc.ServerStream
@@ -109,14 +155,3 @@ type wrappedServerStream struct {
 func (w *wrappedServerStream) Context() context.Context {
 	return w.ctx
 }
-
-// PublicMethods returns a map of public gRPC methods that don't require authentication.
-func PublicMethods() map[string]bool {
-	return map[string]bool{
-		"/narwhal.auth.v1.AuthService/Login":                        true,
-		"/narwhal.auth.v1.AuthService/RefreshToken":                 true,
-		"/narwhal.auth.v1.AuthService/CreateUser":                   true, // First user creation
-		"/grpc.health.v1.Health/Check":                              true,
-		"/grpc.reflection.v1.ServerReflection/ServerReflectionInfo": true,
-	}
-}
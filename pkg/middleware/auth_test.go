@@ -0,0 +1,71 @@
+package middleware_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/middleware"
+)
+
+const getCurrentUserMethod = "/narwhal.auth.v1.AuthService/GetCurrentUser"
+
+// callWithToken calls method through the unary and stream interceptors
+// with a bearer token and returns their errors.
+func callWithToken(jwtManager *auth.JWTManager, token, method string) (unaryErr, streamErr error) {
+	ctx := metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs("authorization", "Bearer "+token))
+
+	unary := middleware.AuthInterceptor(jwtManager, nil, nil)
+	_, unaryErr = unary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method},
+		func(context.Context, interface{}) (interface{}, error) { return "ok", nil })
+
+	stream := middleware.StreamAuthInterceptor(jwtManager, nil, nil)
+	streamErr = stream(nil, &serverStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: method},
+		func(interface{}, grpc.ServerStream) error { return nil })
+	return unaryErr, streamErr
+}
+
+// serverStream is a server stream with a context.
+type serverStream struct {
+	grpc.ServerStream
+
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestAuthInterceptor_RejectsShareTokens(t *testing.T) {
+	jwtManager := auth.NewJWTManager("access", "refresh", "test", 15*time.Minute, time.Hour)
+	token, _, err := jwtManager.GenerateShareToken(uuid.New(), auth.ShareGrant{
+		LinkID: uuid.NewString(), MediaID: uuid.NewString(),
+	}, time.Hour)
+	require.NoError(t, err)
+
+	unaryErr, streamErr := callWithToken(jwtManager, token, getCurrentUserMethod)
+	assert.Equal(t, codes.PermissionDenied, status.Code(unaryErr))
+	assert.Equal(t, codes.PermissionDenied, status.Code(streamErr))
+}
+
+func TestAuthInterceptor_RejectsKioskTokens(t *testing.T) {
+	jwtManager := auth.NewJWTManager("access", "refresh", "test", 15*time.Minute, time.Hour)
+	token, _, err := jwtManager.GenerateKioskToken(uuid.New(), auth.KioskGrant{
+		KioskID: uuid.NewString(),
+	}, time.Hour)
+	require.NoError(t, err)
+
+	unaryErr, streamErr := callWithToken(jwtManager, token, getCurrentUserMethod)
+	assert.Equal(t, codes.PermissionDenied, status.Code(unaryErr))
+	assert.Equal(t, codes.PermissionDenied, status.Code(streamErr))
+}
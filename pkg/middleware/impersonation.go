@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	"github.com/narwhalmedia/narwhal/pkg/auth"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// ImpersonationInterceptor audits every call made with an impersonation
+// token and rejects the blocked methods. It must run after AuthInterceptor.
+func ImpersonationInterceptor(logger interfaces.Logger, blockedMethods map[string]bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := auditImpersonatedCall(ctx, logger, blockedMethods, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamImpersonationInterceptor is the streaming counterpart of
+// ImpersonationInterceptor. It must run after StreamAuthInterceptor.
+func StreamImpersonationInterceptor(logger interfaces.Logger, blockedMethods map[string]bool) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := auditImpersonatedCall(ss.Context(), logger, blockedMethods, info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func auditImpersonatedCall(ctx context.Context, logger interfaces.Logger, blockedMethods map[string]bool, method string) error {
+	claims, _ := ctx.Value("claims").(*auth.CustomClaims)
+	return auth.AuditImpersonation(logger, claims, method, blockedMethods)
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	commonpb "github.com/narwhalmedia/narwhal/pkg/common/v1"
+	"github.com/narwhalmedia/narwhal/pkg/i18n"
+)
+
+// acceptLanguageKeys are the metadata keys the caller's Accept-Language
+// arrives in, directly or forwarded by the HTTP gateway.
+var acceptLanguageKeys = []string{"accept-language", "grpcgateway-accept-language"}
+
+// LocalizationInterceptor translates the messages of returned errors into
+// the language of the caller. The language comes from Accept-Language and
+// is replaced by the preferred language of the authenticated user, so the
+// interceptor must run before the auth interceptor. The English message is
+// kept in an ErrorDetail for clients that match on it.
+func LocalizationInterceptor(catalog *i18n.Catalog) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx = i18n.WithLanguage(ctx, requestLanguage(ctx, catalog))
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return nil, localizeError(ctx, catalog, err)
+		}
+		return resp, nil
+	}
+}
+
+// StreamLocalizationInterceptor is the streaming counterpart of
+// LocalizationInterceptor. It must run before the stream auth interceptor.
+func StreamLocalizationInterceptor(catalog *i18n.Catalog) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := i18n.WithLanguage(ss.Context(), requestLanguage(ss.Context(), catalog))
+		err := handler(srv, &wrappedServerStream{ServerStream: ss, ctx: ctx})
+		if err != nil {
+			return localizeError(ctx, catalog, err)
+		}
+		return nil
+	}
+}
+
+// requestLanguage returns the language the caller accepts.
+func requestLanguage(ctx context.Context, catalog *i18n.Catalog) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return i18n.DefaultLanguage
+	}
+	for _, key := range acceptLanguageKeys {
+		if values := md.Get(key); len(values) > 0 {
+			return catalog.Match(values[0])
+		}
+	}
+	return i18n.DefaultLanguage
+}
+
+// localizeError translates the message of a gRPC status error. Errors
+// without a translation are returned unchanged.
+func localizeError(ctx context.Context, catalog *i18n.Catalog, err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	lang := i18n.FromContext(ctx)
+	message := catalog.Translate(lang, st.Message())
+	if message == st.Message() {
+		return err
+	}
+
+	// Details the error already carries are kept
+	proto := st.Proto()
+	proto.Message = message
+	localized, detailErr := status.FromProto(proto).WithDetails(&commonpb.ErrorDetail{
+		Code:     st.Code().String(),
+		Message:  st.Message(),
+		Metadata: map[string]string{"language": lang},
+	})
+	if detailErr != nil {
+		return err
+	}
+	return localized.Err()
+}
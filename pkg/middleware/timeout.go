@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Timeouts bound how long unary gRPC methods run. Methods has the timeouts
+// of full method names, which take precedence over Default; zero disables
+// the timeout of a method.
+type Timeouts struct {
+	Default time.Duration
+	Methods map[string]time.Duration
+}
+
+// NewTimeouts returns timeouts of def for methods without one of their
+// own: the DefaultMethodTimeouts, overridden by methods.
+func NewTimeouts(def time.Duration, methods map[string]time.Duration) Timeouts {
+	timeouts := Timeouts{Default: def, Methods: DefaultMethodTimeouts()}
+	for method, timeout := range methods {
+		timeouts.Methods[method] = timeout
+	}
+	return timeouts
+}
+
+// For returns the timeout of a full method name.
+func (t Timeouts) For(method string) time.Duration {
+	if timeout, ok := t.Methods[method]; ok {
+		return timeout
+	}
+	return t.Default
+}
+
+// DefaultMethodTimeouts returns the methods that copy files, talk to
+// metadata providers or walk whole libraries, which need longer than a
+// typical request.
+func DefaultMethodTimeouts() map[string]time.Duration {
+	return map[string]time.Duration{
+		"/narwhal.library.v1.LibraryService/ExportLibrary":       5 * time.Minute,
+		"/narwhal.library.v1.LibraryService/ImportLibrary":       5 * time.Minute,
+		"/narwhal.library.v1.LibraryService/RelocateLibrary":     10 * time.Minute,
+		"/narwhal.library.v1.LibraryService/MoveFile":            10 * time.Minute,
+		"/narwhal.library.v1.LibraryService/ReplaceFile":         10 * time.Minute,
+		"/narwhal.library.v1.LibraryService/ResolveManualImport": 10 * time.Minute,
+		"/narwhal.library.v1.LibraryService/RefreshMetadata":     2 * time.Minute,
+		"/narwhal.library.v1.LibraryService/RefreshThemeMusic":   2 * time.Minute,
+		"/narwhal.auth.v1.AuthService/RequestDataExport":         2 * time.Minute,
+	}
+}
+
+// TimeoutInterceptor cancels the context of unary calls once their method
+// times out. Deadlines set by the caller are kept when they are sooner.
+// Calls failing after their deadline passed or they were cancelled return
+// DeadlineExceeded or Canceled, whatever error the handler wrapped the
+// context error in.
+func TimeoutInterceptor(timeouts Timeouts) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if timeout := timeouts.For(info.FullMethod); timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return nil, contextError(ctx, err)
+		}
+		return resp, nil
+	}
+}
+
+// StreamTimeoutInterceptor is the streaming counterpart of
+// TimeoutInterceptor. Streams run as long as they are consumed, so only
+// deadlines set by the caller apply.
+func StreamTimeoutInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := handler(srv, ss); err != nil {
+			return contextError(ss.Context(), err)
+		}
+		return nil
+	}
+}
+
+// contextError returns DeadlineExceeded or Canceled for errors of calls
+// whose context is done, or that failed on a context error, and err
+// otherwise.
+func contextError(ctx context.Context, err error) error {
+	switch code := status.Code(err); {
+	case code == codes.DeadlineExceeded || code == codes.Canceled:
+		return err
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, "request timed out")
+	case errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled):
+		return status.Error(codes.Canceled, "request cancelled")
+	default:
+		return err
+	}
+}
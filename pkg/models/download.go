@@ -20,25 +20,28 @@ const (
 
 // Download represents a download task.
 type Download struct {
-	ID             uuid.UUID      `json:"id"                  db:"id"`
-	Title          string         `json:"title"               db:"title"`
-	Type           MediaType      `json:"type"                db:"type"`
-	IndexerID      string         `json:"indexer_id"          db:"indexer_id"`
-	DownloadURL    string         `json:"download_url"        db:"download_url"`
-	Size           int64          `json:"size"                db:"size"`
-	Status         DownloadStatus `json:"status"              db:"status"`
-	Progress       float32        `json:"progress"            db:"progress"`
-	DownloadSpeed  int64          `json:"download_speed"      db:"download_speed"`
-	ETA            int            `json:"eta"                 db:"eta"` // in seconds
-	DownloadClient string         `json:"download_client"     db:"download_client"`
-	OutputPath     string         `json:"output_path"         db:"output_path"`
-	Priority       int            `json:"priority"            db:"priority"`
-	RetryCount     int            `json:"retry_count"         db:"retry_count"`
-	Error          string         `json:"error,omitempty"     db:"error"`
-	Started        *time.Time     `json:"started,omitempty"   db:"started"`
-	Completed      *time.Time     `json:"completed,omitempty" db:"completed"`
-	Created        time.Time      `json:"created"             db:"created"`
-	Updated        time.Time      `json:"updated"             db:"updated"`
+	ID             uuid.UUID      `json:"id"                      db:"id"`
+	TenantID       uuid.UUID      `json:"tenant_id"               db:"tenant_id"`
+	RequestedBy    uuid.UUID      `json:"requested_by"            db:"requested_by"`
+	Title          string         `json:"title"                   db:"title"`
+	Type           MediaType      `json:"type"                    db:"type"`
+	IndexerID      string         `json:"indexer_id"              db:"indexer_id"`
+	DownloadURL    string         `json:"download_url"            db:"download_url"`
+	Size           int64          `json:"size"                    db:"size"`
+	Status         DownloadStatus `json:"status"                  db:"status"`
+	Progress       float32        `json:"progress"                db:"progress"`
+	DownloadSpeed  int64          `json:"download_speed"          db:"download_speed"`
+	ETA            int            `json:"eta"                     db:"eta"` // in seconds
+	DownloadClient string         `json:"download_client"         db:"download_client"`
+	OutputPath     string         `json:"output_path"             db:"output_path"`
+	Priority       int            `json:"priority"                db:"priority"`
+	RetryCount     int            `json:"retry_count"             db:"retry_count"`
+	Error          string         `json:"error,omitempty"         db:"error"`
+	NextRetryAt    *time.Time     `json:"next_retry_at,omitempty" db:"next_retry_at"`
+	Started        *time.Time     `json:"started,omitempty"       db:"started"`
+	Completed      *time.Time     `json:"completed,omitempty"     db:"completed"`
+	Created        time.Time      `json:"created"                 db:"created"`
+	Updated        time.Time      `json:"updated"                 db:"updated"`
 }
 
 // Release represents a release from an indexer.
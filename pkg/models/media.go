@@ -14,11 +14,15 @@ const (
 	MediaTypeSeries MediaType = "series"
 	MediaTypeTV     MediaType = "tv" // Alias for series
 	MediaTypeMusic  MediaType = "music"
+	// MediaTypeMusicVideo covers music videos and concert films, linked to
+	// the artists of music libraries by name
+	MediaTypeMusicVideo MediaType = "music_video"
 )
 
 // Media represents a media item in the library.
 type Media struct {
 	ID          uuid.UUID  `json:"id"                   db:"id"`
+	TenantID    uuid.UUID  `json:"tenant_id"            db:"tenant_id"`
 	LibraryID   uuid.UUID  `json:"library_id"           db:"library_id"`
 	Title       string     `json:"title"                db:"title"`
 	Type        MediaType  `json:"type"                 db:"type"`
@@ -49,39 +53,78 @@ type Media struct {
 	CreatedAt      time.Time  `json:"created_at"                 db:"created_at"`
 	UpdatedAt      time.Time  `json:"updated_at"                 db:"updated_at"`
 	Year           int        `json:"year,omitempty"             db:"year"`
+	// Artist is the performer of music tracks and music videos
+	Artist string `json:"artist,omitempty" db:"artist"`
+
+	// Extras such as trailers and samples are attached to their parent media,
+	// and to an episode of it when they belong to one
+	ParentID  *uuid.UUID `json:"parent_id,omitempty"  db:"parent_id"`
+	EpisodeID *uuid.UUID `json:"episode_id,omitempty" db:"episode_id"`
+	ExtraType string     `json:"extra_type,omitempty" db:"extra_type"`
+	Extras    []*Media   `json:"extras,omitempty"`
+
+	// Theme music played while browsing a series; ThemeKey is its object
+	// store key
+	ThemeKey string `json:"-"                   db:"theme_key"`
+	ThemeURL string `json:"theme_url,omitempty" db:"theme_url"`
+
+	// Monitored media are shown on the calendar, with the home releases of
+	// movies
+	Monitored           bool       `json:"monitored"                       db:"monitored"`
+	DigitalReleaseDate  *time.Time `json:"digital_release_date,omitempty"  db:"digital_release_date"`
+	PhysicalReleaseDate *time.Time `json:"physical_release_date,omitempty" db:"physical_release_date"`
 }
 
 // Episode represents an episode of a series.
 type Episode struct {
-	ID            uuid.UUID `json:"id"                 db:"id"`
-	MediaID       uuid.UUID `json:"media_id"           db:"media_id"`
-	SeasonNumber  int       `json:"season_number"      db:"season_number"`
-	EpisodeNumber int       `json:"episode_number"     db:"episode_number"`
-	Title         string    `json:"title"              db:"title"`
-	Path          string    `json:"path"               db:"path"`
-	Duration      int       `json:"duration"           db:"duration"`
-	AirDate       time.Time `json:"air_date,omitempty" db:"air_date"`
-	Added         time.Time `json:"added"              db:"added"`
+	ID             uuid.UUID `json:"id"                        db:"id"`
+	MediaID        uuid.UUID `json:"media_id"                  db:"media_id"`
+	SeasonNumber   int       `json:"season_number"             db:"season_number"`
+	EpisodeNumber  int       `json:"episode_number"            db:"episode_number"`
+	AbsoluteNumber int       `json:"absolute_number,omitempty" db:"absolute_number"` // anime numbering across seasons
+	Title          string    `json:"title"                     db:"title"`
+	Path           string    `json:"path"                      db:"path"`
+	Duration       int       `json:"duration"                  db:"duration"`
+	AirDate        time.Time `json:"air_date,omitempty"        db:"air_date"`
+	Added          time.Time `json:"added"                     db:"added"`
+}
+
+// EpisodeFile is a file holding an episode. Files holding several episodes
+// have one EpisodeFile per episode; episodes split across files have one
+// per part.
+type EpisodeFile struct {
+	ID        uuid.UUID `json:"id"         db:"id"`
+	EpisodeID uuid.UUID `json:"episode_id" db:"episode_id"`
+	MediaID   uuid.UUID `json:"media_id"   db:"media_id"`
+	Path      string    `json:"path"       db:"path"`
+	Part      int       `json:"part"       db:"part"`     // 1-based part of a split episode; 0 for whole episodes
+	Duration  int       `json:"duration"   db:"duration"` // in seconds; 0 if unknown
 }
 
 // Metadata contains enriched metadata for media items.
 type Metadata struct {
-	ID          uuid.UUID `json:"id"                     db:"id"`
-	MediaID     uuid.UUID `json:"media_id"               db:"media_id"`
-	Title       string    `json:"title,omitempty"        db:"title"`
-	IMDBID      string    `json:"imdb_id,omitempty"      db:"imdb_id"`
-	TMDBID      string    `json:"tmdb_id,omitempty"      db:"tmdb_id"`
-	TVDBID      string    `json:"tvdb_id,omitempty"      db:"tvdb_id"`
-	Description string    `json:"description,omitempty"  db:"description"`
-	ReleaseDate string    `json:"release_date,omitempty" db:"release_date"`
-	Rating      float32   `json:"rating,omitempty"       db:"rating"`
-	Genres      []string  `json:"genres,omitempty"`
-	Cast        []string  `json:"cast,omitempty"`
-	Directors   []string  `json:"directors,omitempty"`
-	PosterURL   string    `json:"poster_url,omitempty"   db:"poster_url"`
-	BackdropURL string    `json:"backdrop_url,omitempty" db:"backdrop_url"`
-	TrailerURL  string    `json:"trailer_url,omitempty"  db:"trailer_url"`
-	LastUpdated time.Time `json:"last_updated"           db:"last_updated"`
+	ID            uuid.UUID `json:"id"                       db:"id"`
+	MediaID       uuid.UUID `json:"media_id"                 db:"media_id"`
+	Title         string    `json:"title,omitempty"          db:"title"`
+	OriginalTitle string    `json:"original_title,omitempty" db:"original_title"`
+	IMDBID        string    `json:"imdb_id,omitempty"        db:"imdb_id"`
+	TMDBID        string    `json:"tmdb_id,omitempty"        db:"tmdb_id"`
+	TVDBID        string    `json:"tvdb_id,omitempty"        db:"tvdb_id"`
+	AniListID     string    `json:"anilist_id,omitempty"     db:"anilist_id"`
+	IMVDbID       string    `json:"imvdb_id,omitempty"       db:"imvdb_id"`
+	AudioDBID     string    `json:"audiodb_id,omitempty"     db:"audiodb_id"`
+	Artist        string    `json:"artist,omitempty"         db:"artist"` // performer of music videos
+	Description   string    `json:"description,omitempty"    db:"description"`
+	ReleaseDate   string    `json:"release_date,omitempty"   db:"release_date"`
+	Certification string    `json:"certification,omitempty"  db:"certification"` // age rating in the metadata region
+	Rating        float32   `json:"rating,omitempty"         db:"rating"`
+	Genres        []string  `json:"genres,omitempty"`
+	Cast          []string  `json:"cast,omitempty"`
+	Directors     []string  `json:"directors,omitempty"`
+	PosterURL     string    `json:"poster_url,omitempty"     db:"poster_url"`
+	BackdropURL   string    `json:"backdrop_url,omitempty"   db:"backdrop_url"`
+	TrailerURL    string    `json:"trailer_url,omitempty"    db:"trailer_url"`
+	LastUpdated   time.Time `json:"last_updated"             db:"last_updated"`
 }
 
 // Library represents a media library location.
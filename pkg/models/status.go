@@ -0,0 +1,53 @@
+package models
+
+// MediaStatus represents the availability of a media item.
+type MediaStatus string
+
+const (
+	MediaStatusPending   MediaStatus = "pending"
+	MediaStatusAvailable MediaStatus = "available"
+	MediaStatusMissing   MediaStatus = "missing"
+	MediaStatusError     MediaStatus = "error"
+)
+
+// TranscodeJobStatus represents the status of a transcode job.
+type TranscodeJobStatus string
+
+const (
+	TranscodeJobStatusQueued    TranscodeJobStatus = "queued"
+	TranscodeJobStatusRunning   TranscodeJobStatus = "running"
+	TranscodeJobStatusPaused    TranscodeJobStatus = "paused"
+	TranscodeJobStatusCompleted TranscodeJobStatus = "completed"
+	TranscodeJobStatusFailed    TranscodeJobStatus = "failed"
+	TranscodeJobStatusCancelled TranscodeJobStatus = "cancelled"
+)
+
+// MediaTransitions lists the allowed media status changes.
+var MediaTransitions = map[MediaStatus][]MediaStatus{
+	MediaStatusPending:   {MediaStatusAvailable, MediaStatusMissing, MediaStatusError},
+	MediaStatusAvailable: {MediaStatusMissing, MediaStatusError},
+	MediaStatusMissing:   {MediaStatusAvailable, MediaStatusError},
+	MediaStatusError:     {MediaStatusPending, MediaStatusAvailable, MediaStatusMissing},
+}
+
+// DownloadTransitions lists the allowed download status changes. Failed and
+// cancelled downloads can be queued again; completed downloads are final.
+var DownloadTransitions = map[DownloadStatus][]DownloadStatus{
+	DownloadStatusPending:     {DownloadStatusQueued, DownloadStatusFailed, DownloadStatusCancelled},
+	DownloadStatusQueued:      {DownloadStatusDownloading, DownloadStatusFailed, DownloadStatusCancelled},
+	DownloadStatusDownloading: {DownloadStatusQueued, DownloadStatusCompleted, DownloadStatusFailed, DownloadStatusCancelled},
+	DownloadStatusFailed:      {DownloadStatusQueued},
+	DownloadStatusCancelled:   {DownloadStatusQueued},
+}
+
+// TranscodeJobTransitions lists the allowed transcode job status changes.
+// Batch jobs are paused for playback and resume running; failed jobs can be
+// retried; completed and cancelled jobs are final.
+var TranscodeJobTransitions = map[TranscodeJobStatus][]TranscodeJobStatus{
+	TranscodeJobStatusQueued: {TranscodeJobStatusRunning, TranscodeJobStatusCancelled},
+	TranscodeJobStatusRunning: {
+		TranscodeJobStatusCompleted, TranscodeJobStatusFailed, TranscodeJobStatusCancelled, TranscodeJobStatusPaused,
+	},
+	TranscodeJobStatusPaused: {TranscodeJobStatusRunning, TranscodeJobStatusCancelled},
+	TranscodeJobStatusFailed: {TranscodeJobStatusQueued},
+}
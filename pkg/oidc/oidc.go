@@ -0,0 +1,321 @@
+// Package oidc verifies the ID tokens of OpenID Connect providers, such as
+// Keycloak, Authelia or Google.
+//
+// The keys tokens are signed with are found through the discovery document
+// of the provider and cached. They are fetched again when a token is signed
+// with an unknown key, as providers rotate their keys.
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidToken is returned by Verify for tokens that are malformed,
+// expired, not signed by the provider or not issued to the client.
+var ErrInvalidToken = errors.New("invalid ID token")
+
+const (
+	// refreshInterval is how often keys are fetched at most, so tokens
+	// signed with made up key IDs cannot flood the provider.
+	refreshInterval = time.Minute
+	// leeway is the clock skew allowed between the provider and us.
+	leeway = time.Minute
+)
+
+// signingMethods are the algorithms ID tokens may be signed with. HMAC is
+// left out, as it would sign with the client secret.
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// Claims are the claims of a verified ID token.
+type Claims struct {
+	Issuer  string
+	Subject string
+	Email   string
+	// EmailVerified is whether the provider verified the user owns Email.
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+	// Raw holds every claim, for provider specific ones such as groups.
+	Raw map[string]any
+}
+
+// Strings returns the strings of a claim, which may be a string or a list.
+// The path is dot separated for nested claims, such as the
+// "realm_access.roles" of Keycloak.
+func (c *Claims) Strings(path string) []string {
+	var value any = c.Raw
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// Verifier verifies the ID tokens a provider issued to a client. It is
+// safe for concurrent use.
+type Verifier struct {
+	issuer   string
+	clientID string
+	client   *http.Client
+
+	mu      sync.Mutex
+	jwksURI string
+	keys    map[string]any // by key ID
+	fetched time.Time
+}
+
+// NewVerifier creates a verifier of the ID tokens the provider at issuer
+// issued to clientID. Nothing is fetched until the first token is
+// verified.
+func NewVerifier(issuer, clientID string, client *http.Client) *Verifier {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Verifier{issuer: issuer, clientID: clientID, client: client}
+}
+
+// Verify checks the signature, issuer, audience and expiry of an ID token
+// and returns its claims. Tokens that fail the checks return an error
+// wrapping ErrInvalidToken; other errors are failures to reach the
+// provider.
+func (v *Verifier) Verify(ctx context.Context, rawToken string) (*Claims, error) {
+	// Errors finding the key are returned as they are, to tell failures to
+	// reach the provider from invalid tokens
+	var keyErr error
+	token, err := jwt.Parse(rawToken, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := v.key(ctx, kid)
+		keyErr = err
+		return key, err
+	},
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(v.issuer),
+		jwt.WithAudience(v.clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(leeway),
+	)
+	if keyErr != nil {
+		return nil, keyErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	raw := token.Claims.(jwt.MapClaims)
+	claims := &Claims{Raw: raw}
+	claims.Issuer, _ = raw["iss"].(string)
+	claims.Subject, _ = raw["sub"].(string)
+	claims.Email, _ = raw["email"].(string)
+	claims.Name, _ = raw["name"].(string)
+	claims.PreferredUsername, _ = raw["preferred_username"].(string)
+	// Some providers send booleans as strings
+	switch verified := raw["email_verified"].(type) {
+	case bool:
+		claims.EmailVerified = verified
+	case string:
+		claims.EmailVerified = verified == "true"
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// key returns the public key with ID kid, fetching the keys of the
+// provider if it is unknown. Tokens without a key ID are accepted from
+// providers with a single key.
+func (v *Verifier) key(ctx context.Context, kid string) (any, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if key, ok := v.lookup(kid); ok {
+		return key, nil
+	}
+	if time.Since(v.fetched) < refreshInterval {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, kid)
+	}
+	if err := v.fetchKeys(ctx); err != nil {
+		return nil, err
+	}
+	if key, ok := v.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, kid)
+}
+
+// lookup returns a cached key. The caller holds mu.
+func (v *Verifier) lookup(kid string) (any, bool) {
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+	key, ok := v.keys[kid]
+	return key, ok
+}
+
+// fetchKeys fetches the key set of the provider, discovering where it is
+// first. The caller holds mu.
+func (v *Verifier) fetchKeys(ctx context.Context) error {
+	v.fetched = time.Now()
+
+	if v.jwksURI == "" {
+		var discovery struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		url := strings.TrimSuffix(v.issuer, "/") + "/.well-known/openid-configuration"
+		if err := v.get(ctx, url, &discovery); err != nil {
+			return err
+		}
+		if discovery.Issuer != v.issuer {
+			return fmt.Errorf("provider issuer %q does not match %q", discovery.Issuer, v.issuer)
+		}
+		if discovery.JWKSURI == "" {
+			return errors.New("provider has no jwks_uri")
+		}
+		v.jwksURI = discovery.JWKSURI
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := v.get(ctx, v.jwksURI, &set); err != nil {
+		return err
+	}
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		// Keys of unsupported types are skipped rather than failing the
+		// whole set
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	v.keys = keys
+	return nil
+}
+
+// get fetches a JSON document of the provider.
+func (v *Verifier) get(ctx context.Context, url string, into any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch %s: %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(into); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", url, err)
+	}
+	return nil
+}
+
+// jwk is a JSON web key, of the RSA or EC type.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey decodes the public key of k.
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() {
+			return nil, errors.New("RSA exponent too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// decodeInt decodes a base64url encoded big-endian integer.
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key parameter: %w", err)
+	}
+	if len(b) == 0 {
+		return nil, errors.New("missing key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,194 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/pkg/oidc"
+)
+
+// provider is an OpenID Connect provider serving its discovery document
+// and keys.
+type provider struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	keys       []map[string]string
+	keyFetches int
+}
+
+func newProvider(t *testing.T) *provider {
+	p := &provider{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"issuer": p.URL, "jwks_uri": p.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, _ *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.keyFetches++
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": p.keys})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *provider) addRSAKey(t *testing.T, kid string) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = append(p.keys, map[string]string{
+		"kty": "RSA", "kid": kid, "use": "sig",
+		"n": encodeInt(key.N), "e": encodeInt(big.NewInt(int64(key.E))),
+	})
+	return key
+}
+
+func (p *provider) addECKey(t *testing.T, kid string) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = append(p.keys, map[string]string{
+		"kty": "EC", "kid": kid, "crv": "P-256",
+		"x": encodeInt(key.X), "y": encodeInt(key.Y),
+	})
+	return key
+}
+
+func (p *provider) fetches() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.keyFetches
+}
+
+func encodeInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key any, kid string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestVerify(t *testing.T) {
+	p := newProvider(t)
+	key := p.addRSAKey(t, "rsa-1")
+	v := oidc.NewVerifier(p.URL, "narwhal", nil)
+	ctx := context.Background()
+
+	claims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":                p.URL,
+			"sub":                "f3a1",
+			"aud":                "narwhal",
+			"exp":                time.Now().Add(time.Hour).Unix(),
+			"email":              "alice@example.com",
+			"email_verified":     "true",
+			"preferred_username": "alice",
+			"realm_access":       map[string]any{"roles": []string{"media-admin", "offline_access"}},
+			"groups":             "family",
+		}
+	}
+
+	got, err := v.Verify(ctx, sign(t, jwt.SigningMethodRS256, key, "rsa-1", claims()))
+	require.NoError(t, err)
+	assert.Equal(t, "f3a1", got.Subject)
+	assert.Equal(t, "alice@example.com", got.Email)
+	assert.True(t, got.EmailVerified)
+	assert.Equal(t, "alice", got.PreferredUsername)
+	assert.Equal(t, []string{"media-admin", "offline_access"}, got.Strings("realm_access.roles"))
+	assert.Equal(t, []string{"family"}, got.Strings("groups"))
+	assert.Empty(t, got.Strings("realm_access.roles.admin"))
+	assert.Empty(t, got.Strings("missing"))
+
+	for name, change := range map[string]func(jwt.MapClaims){
+		"other client":  func(c jwt.MapClaims) { c["aud"] = "someone-else" },
+		"other issuer":  func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+		"expired":       func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"no expiry":     func(c jwt.MapClaims) { delete(c, "exp") },
+		"no subject":    func(c jwt.MapClaims) { delete(c, "sub") },
+		"in the future": func(c jwt.MapClaims) { c["nbf"] = time.Now().Add(time.Hour).Unix() },
+	} {
+		c := claims()
+		change(c)
+		_, err := v.Verify(ctx, sign(t, jwt.SigningMethodRS256, key, "rsa-1", c))
+		assert.ErrorIs(t, err, oidc.ErrInvalidToken, name)
+	}
+
+	// Tokens signed by someone else
+	forged, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, err = v.Verify(ctx, sign(t, jwt.SigningMethodRS256, forged, "rsa-1", claims()))
+	assert.ErrorIs(t, err, oidc.ErrInvalidToken)
+
+	// or with the client secret
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, claims())
+	secret, err := hmac.SignedString([]byte("secret"))
+	require.NoError(t, err)
+	_, err = v.Verify(ctx, secret)
+	assert.ErrorIs(t, err, oidc.ErrInvalidToken)
+
+	_, err = v.Verify(ctx, "not a token")
+	assert.ErrorIs(t, err, oidc.ErrInvalidToken)
+	assert.Equal(t, 1, p.fetches(), "keys are cached")
+}
+
+func TestVerifyRotatedKeys(t *testing.T) {
+	p := newProvider(t)
+	p.addRSAKey(t, "old")
+	v := oidc.NewVerifier(p.URL, "narwhal", nil)
+	ctx := context.Background()
+
+	claims := jwt.MapClaims{"iss": p.URL, "sub": "f3a1", "aud": []string{"narwhal"}, "exp": time.Now().Add(time.Hour).Unix()}
+
+	// Keys are fetched at most once a minute, so unknown keys are only
+	// looked up once
+	_, err := v.Verify(ctx, sign(t, jwt.SigningMethodRS256, p.addRSAKey(t, "unseen"), "made-up", claims))
+	assert.ErrorIs(t, err, oidc.ErrInvalidToken)
+	assert.Equal(t, 1, p.fetches())
+
+	key := p.addECKey(t, "new")
+	_, err = v.Verify(ctx, sign(t, jwt.SigningMethodES256, key, "new", claims))
+	assert.ErrorIs(t, err, oidc.ErrInvalidToken)
+	assert.Equal(t, 1, p.fetches())
+
+	// A verifier fetching the keys since knows the rotated key
+	v = oidc.NewVerifier(p.URL, "narwhal", nil)
+	got, err := v.Verify(ctx, sign(t, jwt.SigningMethodES256, key, "new", claims))
+	require.NoError(t, err)
+	assert.Equal(t, "f3a1", got.Subject)
+}
+
+func TestVerifyUnreachableProvider(t *testing.T) {
+	p := newProvider(t)
+	key := p.addRSAKey(t, "rsa-1")
+	p.Close()
+
+	v := oidc.NewVerifier(p.URL, "narwhal", nil)
+	_, err := v.Verify(context.Background(), sign(t, jwt.SigningMethodRS256, key, "rsa-1", jwt.MapClaims{
+		"iss": p.URL, "sub": "f3a1", "aud": "narwhal", "exp": time.Now().Add(time.Hour).Unix(),
+	}))
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, oidc.ErrInvalidToken)
+}
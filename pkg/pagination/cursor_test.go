@@ -141,3 +141,21 @@ func TestPaginationHelpers(t *testing.T) {
 		assert.Empty(t, token) // No previous page
 	})
 }
+
+func BenchmarkPageTokens(b *testing.B) {
+	encoder, err := NewCursorEncoder([]byte("test-key-for-pagination-12345678"))
+	require.NoError(b, err)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// A page request: decode the token, issue the next one
+		token, err := GenerateNextPageToken(encoder, i%100_000, 50, 100_000+50)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := CalculateOffset(encoder, token, 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package plugin
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// The host sets the magic cookie in the environment of the plugins it
+// starts, so a plugin run by hand can tell it was not started by a host.
+const (
+	MagicCookieKey   = "NARWHAL_PLUGIN_MAGIC_COOKIE"
+	MagicCookieValue = "0d5c9f1e6b8a4e2f9c7d3b1a5e8f2c4d"
+)
+
+// handshakePrefix starts the line a plugin prints on stdout once it serves.
+const handshakePrefix = "narwhal-plugin"
+
+// Handshake is the address a plugin serves on, as announced on its stdout.
+type Handshake struct {
+	ProtocolVersion uint32
+	Network         string // tcp or unix
+	Address         string
+}
+
+// FormatHandshake returns the handshake line announcing addr:
+// narwhal-plugin|<protocol version>|<network>|<address>.
+func FormatHandshake(addr net.Addr) string {
+	return fmt.Sprintf("%s|%d|%s|%s", handshakePrefix, ProtocolVersion, addr.Network(), addr.String())
+}
+
+// ParseHandshake parses a handshake line.
+func ParseHandshake(line string) (Handshake, error) {
+	parts := strings.Split(strings.TrimSpace(line), "|")
+	if len(parts) != 4 || parts[0] != handshakePrefix {
+		return Handshake{}, fmt.Errorf("malformed handshake %q", line)
+	}
+
+	version, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return Handshake{}, fmt.Errorf("malformed protocol version %q", parts[1])
+	}
+	switch parts[2] {
+	case "tcp", "unix":
+	default:
+		return Handshake{}, fmt.Errorf("unsupported network %q", parts[2])
+	}
+	if parts[3] == "" {
+		return Handshake{}, fmt.Errorf("malformed handshake %q", line)
+	}
+
+	return Handshake{
+		ProtocolVersion: uint32(version),
+		Network:         parts[2],
+		Address:         parts[3],
+	}, nil
+}
+
+// Target returns the gRPC target of the address.
+func (h Handshake) Target() string {
+	if h.Network == "unix" {
+		return "unix://" + h.Address
+	}
+	return h.Address
+}
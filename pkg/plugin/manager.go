@@ -0,0 +1,359 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+const (
+	// DefaultStartTimeout bounds how long a plugin may take to announce
+	// itself.
+	DefaultStartTimeout = 10 * time.Second
+	// stopTimeout is how long a plugin may take to exit after SIGTERM
+	// before it is killed.
+	stopTimeout = 5 * time.Second
+)
+
+// State is the state of a plugin in the registry.
+type State string
+
+const (
+	StateRunning      State = "running"
+	StateFailed       State = "failed"       // the plugin could not be started
+	StateIncompatible State = "incompatible" // the handshake failed
+	StateExited       State = "exited"       // the plugin exited after starting
+)
+
+// Config defines a plugin to start.
+type Config struct {
+	Name    string
+	Command string // absolute path of the plugin executable
+	Args    []string
+	// Env is added to the environment of the plugin, such as API keys.
+	Env map[string]string
+}
+
+// HandshakeFunc asks a started plugin what it is and offers, telling it the
+// kinds of capability the host uses.
+type HandshakeFunc func(ctx context.Context, conn *grpc.ClientConn, kinds []Kind) (*Info, error)
+
+// Status is the registry entry of a plugin.
+type Status struct {
+	Name    string
+	Command string
+	Info    Info
+	// Capabilities are the negotiated capabilities the host uses.
+	Capabilities []Capability
+	State        State
+	Error        string
+	StartedAt    time.Time
+}
+
+// Provider is a capability of a running plugin with the connection to use
+// it over.
+type Provider struct {
+	Plugin     string
+	Capability Capability
+	Conn       *grpc.ClientConn
+}
+
+// Manager starts sidecar plugins, negotiates their capabilities and keeps
+// the registry of plugins and their state.
+type Manager struct {
+	handshake    HandshakeFunc
+	kinds        []Kind
+	startTimeout time.Duration
+	logger       interfaces.Logger
+
+	mu      sync.Mutex
+	plugins map[string]*process
+	closed  bool
+}
+
+type process struct {
+	status Status
+	cmd    *exec.Cmd
+	conn   *grpc.ClientConn
+	done   chan struct{}
+}
+
+// NewManager creates a plugin manager for a host using the given kinds of
+// capability.
+func NewManager(handshake HandshakeFunc, logger interfaces.Logger, kinds ...Kind) *Manager {
+	return &Manager{
+		handshake:    handshake,
+		kinds:        kinds,
+		startTimeout: DefaultStartTimeout,
+		logger:       logger,
+		plugins:      make(map[string]*process),
+	}
+}
+
+// WithStartTimeout sets how long a plugin may take to start and complete
+// the handshake.
+func (m *Manager) WithStartTimeout(timeout time.Duration) *Manager {
+	if timeout > 0 {
+		m.startTimeout = timeout
+	}
+	return m
+}
+
+// Load starts a plugin and negotiates its capabilities. Plugins that fail
+// to start are kept in the registry with their error.
+func (m *Manager) Load(ctx context.Context, cfg Config) (*Status, error) {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, errors.New("plugin manager is closed")
+	}
+	if p, ok := m.plugins[cfg.Name]; ok && p.status.State == StateRunning {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("plugin %s is already running", cfg.Name)
+	}
+	m.mu.Unlock()
+
+	p := &process{status: Status{Name: cfg.Name, Command: cfg.Command}}
+	err := m.start(ctx, cfg, p)
+	if err != nil {
+		p.status.Error = err.Error()
+		if errors.Is(err, ErrIncompatible) {
+			p.status.State = StateIncompatible
+		} else {
+			p.status.State = StateFailed
+		}
+		p.stop()
+		m.logger.Error("Failed to load plugin",
+			interfaces.String("plugin", cfg.Name),
+			interfaces.Error(err))
+	} else {
+		p.status.State = StateRunning
+		m.logger.Info("Plugin loaded",
+			interfaces.String("plugin", cfg.Name),
+			interfaces.String("version", p.status.Info.Version),
+			interfaces.Int("capabilities", len(p.status.Capabilities)))
+	}
+
+	m.mu.Lock()
+	m.plugins[cfg.Name] = p
+	status := p.status
+	m.mu.Unlock()
+
+	if err == nil {
+		go m.watch(p)
+	}
+	return &status, err
+}
+
+// start launches the plugin, waits for its handshake line and negotiates
+// over gRPC.
+func (m *Manager) start(ctx context.Context, cfg Config, p *process) error {
+	cmd := exec.Command(cfg.Command, cfg.Args...)
+	cmd.Env = []string{
+		"PATH=" + os.Getenv("PATH"),
+		MagicCookieKey + "=" + MagicCookieValue,
+	}
+	for key, value := range cfg.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	// Keep terminal signals meant for the host from reaching the plugin
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	// Pipes rather than cmd.StdoutPipe, so the output keeps being read
+	// while Wait runs
+	stdout, stdoutWriter := io.Pipe()
+	stderr, stderrWriter := io.Pipe()
+	cmd.Stdout = stdoutWriter
+	cmd.Stderr = stderrWriter
+	cmd.WaitDelay = stopTimeout
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start plugin: %w", err)
+	}
+	p.cmd = cmd
+	p.done = make(chan struct{})
+	p.status.StartedAt = time.Now()
+
+	go m.logOutput(cfg.Name, stderr)
+
+	lines := make(chan string, 1)
+	go func() {
+		reader := bufio.NewReader(stdout)
+		line, err := reader.ReadString('\n')
+		if err == nil {
+			lines <- line
+		}
+		close(lines)
+		// Anything printed after the handshake is logged
+		m.logOutput(cfg.Name, reader)
+	}()
+	go func() {
+		_ = cmd.Wait()
+		stdoutWriter.Close()
+		stderrWriter.Close()
+		close(p.done)
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, m.startTimeout)
+	defer cancel()
+
+	var line string
+	select {
+	case l, ok := <-lines:
+		if !ok {
+			return errors.New("plugin exited before the handshake")
+		}
+		line = l
+	case <-ctx.Done():
+		return errors.New("plugin did not announce itself in time")
+	}
+
+	handshake, err := ParseHandshake(line)
+	if err != nil {
+		return err
+	}
+	if handshake.ProtocolVersion == 0 || handshake.ProtocolVersion > ProtocolVersion {
+		return fmt.Errorf("%w: protocol version %d, host speaks up to %d",
+			ErrIncompatible, handshake.ProtocolVersion, ProtocolVersion)
+	}
+
+	conn, err := grpc.NewClient(handshake.Target(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return fmt.Errorf("failed to connect to plugin: %w", err)
+	}
+	p.conn = conn
+
+	info, err := m.handshake(ctx, conn, m.kinds)
+	if err != nil {
+		return fmt.Errorf("handshake failed: %w", err)
+	}
+	p.status.Info = *info
+	capabilities, err := Negotiate(info, m.kinds)
+	if err != nil {
+		return err
+	}
+	p.status.Capabilities = capabilities
+	return nil
+}
+
+// watch marks a plugin as exited when its process ends on its own.
+func (m *Manager) watch(p *process) {
+	<-p.done
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed || p.status.State != StateRunning {
+		return
+	}
+	p.status.State = StateExited
+	if p.cmd.ProcessState != nil {
+		p.status.Error = p.cmd.ProcessState.String()
+	}
+	m.logger.Error("Plugin exited",
+		interfaces.String("plugin", p.status.Name),
+		interfaces.String("state", p.status.Error))
+}
+
+// logOutput logs what a plugin writes, line by line.
+func (m *Manager) logOutput(name string, r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		m.logger.Info(scanner.Text(), interfaces.String("plugin", name))
+	}
+}
+
+// Plugins returns the registry, sorted by plugin name.
+func (m *Manager) Plugins() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statuses := make([]Status, 0, len(m.plugins))
+	for _, p := range m.plugins {
+		statuses = append(statuses, p.status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// Providers returns the capabilities of a kind offered by running plugins.
+func (m *Manager) Providers(kind Kind) []Provider {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var providers []Provider
+	for _, p := range m.plugins {
+		if p.status.State != StateRunning {
+			continue
+		}
+		for _, capability := range p.status.Capabilities {
+			if capability.Kind == kind {
+				providers = append(providers, Provider{Plugin: p.status.Name, Capability: capability, Conn: p.conn})
+			}
+		}
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		if providers[i].Plugin != providers[j].Plugin {
+			return providers[i].Plugin < providers[j].Plugin
+		}
+		return providers[i].Capability.Name < providers[j].Capability.Name
+	})
+	return providers
+}
+
+// Close stops every plugin.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	m.closed = true
+	plugins := make([]*process, 0, len(m.plugins))
+	for _, p := range m.plugins {
+		plugins = append(plugins, p)
+	}
+	m.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, p := range plugins {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.stop()
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// stop closes the connection to a plugin and terminates it, killing it if
+// it does not exit in time.
+func (p *process) stop() {
+	if p.conn != nil {
+		_ = p.conn.Close()
+	}
+	if p.cmd == nil || p.cmd.Process == nil {
+		return
+	}
+
+	select {
+	case <-p.done:
+		return
+	default:
+	}
+	_ = p.cmd.Process.Signal(syscall.SIGTERM)
+	select {
+	case <-p.done:
+	case <-time.After(stopTimeout):
+		_ = p.cmd.Process.Kill()
+		<-p.done
+	}
+}
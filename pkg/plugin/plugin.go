@@ -0,0 +1,72 @@
+// Package plugin runs sidecar plugins: executables that a service starts and
+// talks to over gRPC, so third parties can add metadata providers, indexers
+// and download clients without changing narwhal. The services plugins serve
+// are defined in api/proto/plugin/v1.
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ProtocolVersion is the newest plugin protocol version this host speaks.
+const ProtocolVersion uint32 = 1
+
+// ErrIncompatible is wrapped by errors for plugins that speak an unknown
+// protocol version or offer nothing the host uses.
+var ErrIncompatible = errors.New("incompatible plugin")
+
+// Kind is a kind of capability a plugin can offer.
+type Kind string
+
+const (
+	KindMetadataProvider Kind = "metadata_provider"
+	KindIndexer          Kind = "indexer"
+	KindDownloadClient   Kind = "download_client"
+)
+
+// Capability is something a plugin provides, such as a metadata provider
+// named "anidb".
+type Capability struct {
+	Kind     Kind
+	Name     string
+	Features []string // such as "tv" and "movie" for metadata providers
+}
+
+// HasFeature reports whether the capability lists a feature.
+func (c Capability) HasFeature(feature string) bool {
+	return slices.Contains(c.Features, feature)
+}
+
+// Info is what a plugin reports about itself in the handshake.
+type Info struct {
+	Name            string
+	Version         string
+	ProtocolVersion uint32
+	Capabilities    []Capability
+}
+
+// Negotiate returns the capabilities of a plugin the host uses. It fails
+// for plugins speaking a protocol version the host does not know, and for
+// plugins offering nothing the host uses.
+func Negotiate(info *Info, kinds []Kind) ([]Capability, error) {
+	if info.ProtocolVersion == 0 || info.ProtocolVersion > ProtocolVersion {
+		return nil, fmt.Errorf("%w: protocol version %d, host speaks up to %d",
+			ErrIncompatible, info.ProtocolVersion, ProtocolVersion)
+	}
+
+	var used []Capability
+	for _, capability := range info.Capabilities {
+		if capability.Name == "" {
+			return nil, fmt.Errorf("%w: %s capability without a name", ErrIncompatible, capability.Kind)
+		}
+		if slices.Contains(kinds, capability.Kind) {
+			used = append(used, capability)
+		}
+	}
+	if len(used) == 0 {
+		return nil, fmt.Errorf("%w: no capability of a kind the host uses", ErrIncompatible)
+	}
+	return used, nil
+}
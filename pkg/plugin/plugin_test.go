@@ -0,0 +1,155 @@
+package plugin_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/narwhalmedia/narwhal/pkg/logger"
+	"github.com/narwhalmedia/narwhal/pkg/plugin"
+)
+
+// TestMain runs the test binary as a plugin when the manager starts it.
+func TestMain(m *testing.M) {
+	if os.Getenv("NARWHAL_TEST_PLUGIN") == "1" {
+		if err := plugin.Serve(func(*grpc.Server) {}); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func testPlugin(name string) plugin.Config {
+	return plugin.Config{
+		Name:    name,
+		Command: os.Args[0],
+		Env:     map[string]string{"NARWHAL_TEST_PLUGIN": "1"},
+	}
+}
+
+func handshakeReturning(info *plugin.Info, err error) plugin.HandshakeFunc {
+	return func(context.Context, *grpc.ClientConn, []plugin.Kind) (*plugin.Info, error) {
+		return info, err
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	info := &plugin.Info{
+		ProtocolVersion: plugin.ProtocolVersion,
+		Capabilities: []plugin.Capability{
+			{Kind: plugin.KindMetadataProvider, Name: "anidb", Features: []string{"tv"}},
+			{Kind: plugin.KindDownloadClient, Name: "deluge"},
+		},
+	}
+
+	capabilities, err := plugin.Negotiate(info, []plugin.Kind{plugin.KindMetadataProvider})
+	require.NoError(t, err)
+	require.Len(t, capabilities, 1)
+	assert.Equal(t, "anidb", capabilities[0].Name)
+	assert.True(t, capabilities[0].HasFeature("tv"))
+
+	_, err = plugin.Negotiate(info, []plugin.Kind{plugin.KindIndexer})
+	assert.ErrorIs(t, err, plugin.ErrIncompatible)
+
+	info.ProtocolVersion = plugin.ProtocolVersion + 1
+	_, err = plugin.Negotiate(info, []plugin.Kind{plugin.KindMetadataProvider})
+	assert.ErrorIs(t, err, plugin.ErrIncompatible)
+}
+
+func TestHandshakeLine(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4567}
+	handshake, err := plugin.ParseHandshake(plugin.FormatHandshake(addr) + "\n")
+	require.NoError(t, err)
+	assert.Equal(t, plugin.ProtocolVersion, handshake.ProtocolVersion)
+	assert.Equal(t, "127.0.0.1:4567", handshake.Target())
+
+	unix, err := plugin.ParseHandshake("narwhal-plugin|1|unix|/tmp/plugin.sock")
+	require.NoError(t, err)
+	assert.Equal(t, "unix:///tmp/plugin.sock", unix.Target())
+
+	for _, line := range []string{"", "hello", "narwhal-plugin|x|tcp|127.0.0.1:1", "narwhal-plugin|1|udp|127.0.0.1:1"} {
+		_, err := plugin.ParseHandshake(line)
+		assert.Error(t, err, line)
+	}
+}
+
+func TestManager_LoadsPlugin(t *testing.T) {
+	info := &plugin.Info{
+		Name:            "anime",
+		Version:         "1.2.0",
+		ProtocolVersion: plugin.ProtocolVersion,
+		Capabilities: []plugin.Capability{
+			{Kind: plugin.KindMetadataProvider, Name: "anidb"},
+			{Kind: plugin.KindIndexer, Name: "nyaa"},
+		},
+	}
+	manager := plugin.NewManager(handshakeReturning(info, nil), logger.NewNoopLogger(), plugin.KindMetadataProvider)
+	defer manager.Close()
+
+	status, err := manager.Load(context.Background(), testPlugin("anime"))
+	require.NoError(t, err)
+	assert.Equal(t, plugin.StateRunning, status.State)
+	assert.Equal(t, "1.2.0", status.Info.Version)
+	// The host does not use indexers
+	assert.Len(t, status.Capabilities, 1)
+
+	providers := manager.Providers(plugin.KindMetadataProvider)
+	require.Len(t, providers, 1)
+	assert.Equal(t, "anime", providers[0].Plugin)
+	assert.Equal(t, "anidb", providers[0].Capability.Name)
+	assert.NotNil(t, providers[0].Conn)
+	assert.Empty(t, manager.Providers(plugin.KindIndexer))
+
+	_, err = manager.Load(context.Background(), testPlugin("anime"))
+	assert.Error(t, err)
+}
+
+func TestManager_KeepsFailedPlugins(t *testing.T) {
+	incompatible := &plugin.Info{Name: "old", ProtocolVersion: plugin.ProtocolVersion + 1}
+	manager := plugin.NewManager(handshakeReturning(incompatible, nil), logger.NewNoopLogger(), plugin.KindMetadataProvider).
+		WithStartTimeout(5 * time.Second)
+	defer manager.Close()
+
+	_, err := manager.Load(context.Background(), testPlugin("old"))
+	assert.ErrorIs(t, err, plugin.ErrIncompatible)
+
+	// Exits without announcing itself
+	_, err = manager.Load(context.Background(), plugin.Config{Name: "silent", Command: "/bin/true"})
+	assert.Error(t, err)
+
+	_, err = manager.Load(context.Background(), plugin.Config{Name: "missing", Command: "/nonexistent/plugin"})
+	assert.Error(t, err)
+
+	statuses := manager.Plugins()
+	require.Len(t, statuses, 3)
+	assert.Equal(t, "missing", statuses[0].Name)
+	assert.Equal(t, plugin.StateFailed, statuses[0].State)
+	assert.Equal(t, plugin.StateIncompatible, statuses[1].State)
+	assert.Equal(t, "old", statuses[1].Info.Name)
+	assert.Equal(t, plugin.StateFailed, statuses[2].State)
+	assert.NotEmpty(t, statuses[2].Error)
+	assert.Empty(t, manager.Providers(plugin.KindMetadataProvider))
+}
+
+func TestManager_HandshakeError(t *testing.T) {
+	manager := plugin.NewManager(handshakeReturning(nil, errors.New("unimplemented")), logger.NewNoopLogger(),
+		plugin.KindMetadataProvider)
+	defer manager.Close()
+
+	status, err := manager.Load(context.Background(), testPlugin("broken"))
+	require.Error(t, err)
+	assert.Equal(t, plugin.StateFailed, status.State)
+}
+
+func TestServe_RequiresHost(t *testing.T) {
+	t.Setenv(plugin.MagicCookieKey, "")
+	assert.ErrorIs(t, plugin.Serve(func(*grpc.Server) {}), plugin.ErrNotStartedByHost)
+}
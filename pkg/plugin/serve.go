@@ -0,0 +1,49 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"google.golang.org/grpc"
+)
+
+// ErrNotStartedByHost is returned by Serve when the plugin was run by hand
+// rather than started by a narwhal service.
+var ErrNotStartedByHost = errors.New("plugin must be started by a narwhal service")
+
+// Serve runs the gRPC server of a plugin written in Go. register adds the
+// plugin's services, including PluginService, to the server. Serve listens
+// on a loopback port, announces it to the host and serves until the host
+// stops the plugin.
+func Serve(register func(*grpc.Server)) error {
+	if os.Getenv(MagicCookieKey) != MagicCookieValue {
+		return ErrNotStartedByHost
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	server := grpc.NewServer()
+	register(server)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		if _, ok := <-signals; ok {
+			server.GracefulStop()
+		}
+	}()
+
+	if _, err := fmt.Fprintln(os.Stdout, FormatHandshake(listener.Addr())); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to announce plugin: %w", err)
+	}
+	return server.Serve(listener)
+}
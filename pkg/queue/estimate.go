@@ -0,0 +1,227 @@
+// Package queue estimates when queued jobs, such as transcodes and
+// downloads, start and finish.
+package queue
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// DefaultWindow is the number of recent jobs a worker's throughput is
+// averaged over.
+const DefaultWindow = 20
+
+// Estimator tracks the recent throughput of each worker and estimates the
+// queue position and wait of pending jobs from it. Work is measured in a
+// unit of the caller's choosing, such as seconds of media for transcodes or
+// bytes for downloads, so workers of different speeds are told apart.
+type Estimator struct {
+	window  int
+	workers map[string]*throughput
+	mu      sync.Mutex
+}
+
+// throughput is a ring of a worker's most recent samples.
+type throughput struct {
+	work    []float64
+	elapsed []time.Duration
+	next    int
+}
+
+func (t *throughput) rate() float64 {
+	var work float64
+	var elapsed time.Duration
+	for i := range t.work {
+		work += t.work[i]
+		elapsed += t.elapsed[i]
+	}
+	if elapsed <= 0 {
+		return 0
+	}
+	return work / elapsed.Seconds()
+}
+
+// NewEstimator creates an estimator averaging throughput over the last
+// window jobs of each worker.
+func NewEstimator(window int) *Estimator {
+	if window < 1 {
+		window = DefaultWindow
+	}
+	return &Estimator{
+		window:  window,
+		workers: make(map[string]*throughput),
+	}
+}
+
+// Observe records that a worker processed work units in elapsed, normally
+// when it finishes a job.
+func (e *Estimator) Observe(workerID string, work float64, elapsed time.Duration) {
+	if work <= 0 || elapsed <= 0 {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	t, ok := e.workers[workerID]
+	if !ok {
+		t = &throughput{}
+		e.workers[workerID] = t
+	}
+	if len(t.work) < e.window {
+		t.work = append(t.work, work)
+		t.elapsed = append(t.elapsed, elapsed)
+		return
+	}
+	t.work[t.next] = work
+	t.elapsed[t.next] = elapsed
+	t.next = (t.next + 1) % e.window
+}
+
+// Forget drops the samples of a worker that left the pool.
+func (e *Estimator) Forget(workerID string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.workers, workerID)
+}
+
+// Throughput returns the average throughput of a worker in work units per
+// second, and false if it has no samples.
+func (e *Estimator) Throughput(workerID string) (float64, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	t, ok := e.workers[workerID]
+	if !ok {
+		return 0, false
+	}
+	rate := t.rate()
+	return rate, rate > 0
+}
+
+// Worker is a worker of the pool. Remaining is the work left on its current
+// job, zero if it is idle.
+type Worker struct {
+	ID        string
+	Remaining float64
+}
+
+// Job is a pending job.
+type Job struct {
+	ID   string
+	Work float64
+}
+
+// Estimate is the expected start and run time of a pending job.
+type Estimate struct {
+	JobID string
+	// Position is the job's 1-based place in the queue.
+	Position int
+	// Wait is the time until a worker picks the job up, and Duration how
+	// long the job then runs. Both are only set if Known.
+	Wait     time.Duration
+	Duration time.Duration
+	Known    bool
+}
+
+// ETA returns the time until the job is expected to finish.
+func (e Estimate) ETA() time.Duration {
+	return e.Wait + e.Duration
+}
+
+// Estimate estimates the wait of each job of queue, in the order workers
+// will pick them up. Jobs go to the worker that becomes free first. Workers
+// without samples are assumed to run at the average throughput of the
+// others; if no worker has samples, estimates are not Known.
+func (e *Estimator) Estimate(workers []Worker, queue []Job) []Estimate {
+	estimates := make([]Estimate, len(queue))
+	for i, job := range queue {
+		estimates[i] = Estimate{JobID: job.ID, Position: i + 1}
+	}
+	if len(workers) == 0 {
+		return estimates
+	}
+
+	rates := e.rates(workers)
+	if rates == nil {
+		return estimates
+	}
+
+	pool := make(freeWorkers, len(workers))
+	for i, w := range workers {
+		pool[i] = freeWorker{index: i, at: max(w.Remaining, 0) / rates[i]}
+	}
+	heap.Init(&pool)
+
+	for i, job := range queue {
+		next := pool[0]
+		run := job.Work / rates[next.index]
+		estimates[i].Wait = seconds(next.at)
+		estimates[i].Duration = seconds(run)
+		estimates[i].Known = true
+
+		pool[0].at += run
+		heap.Fix(&pool, 0)
+	}
+	return estimates
+}
+
+// rates returns the throughput of each worker, or nil if none is known.
+func (e *Estimator) rates(workers []Worker) []float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	rates := make([]float64, len(workers))
+	var sum float64
+	known := 0
+	for i, w := range workers {
+		if t, ok := e.workers[w.ID]; ok {
+			rates[i] = t.rate()
+		}
+		if rates[i] > 0 {
+			sum += rates[i]
+			known++
+		}
+	}
+	if known == 0 {
+		return nil
+	}
+
+	average := sum / float64(known)
+	for i := range rates {
+		if rates[i] <= 0 {
+			rates[i] = average
+		}
+	}
+	return rates
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// freeWorker is a worker and the time from now it becomes free.
+type freeWorker struct {
+	index int
+	at    float64
+}
+
+// freeWorkers is a min-heap of workers by the time they become free.
+type freeWorkers []freeWorker
+
+func (h freeWorkers) Len() int { return len(h) }
+func (h freeWorkers) Less(i, j int) bool {
+	if h[i].at == h[j].at {
+		return h[i].index < h[j].index
+	}
+	return h[i].at < h[j].at
+}
+func (h freeWorkers) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *freeWorkers) Push(x any)   { *h = append(*h, x.(freeWorker)) }
+func (h *freeWorkers) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
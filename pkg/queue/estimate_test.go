@@ -0,0 +1,74 @@
+package queue_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/pkg/queue"
+)
+
+func TestEstimatorThroughputWindow(t *testing.T) {
+	e := queue.NewEstimator(2)
+
+	_, ok := e.Throughput("w1")
+	assert.False(t, ok)
+
+	e.Observe("w1", 100, 10*time.Second)
+	e.Observe("w1", 100, 30*time.Second)
+	rate, ok := e.Throughput("w1")
+	require.True(t, ok)
+	assert.InDelta(t, 5.0, rate, 1e-9)
+
+	// The oldest sample drops out of the window
+	e.Observe("w1", 300, 10*time.Second)
+	rate, _ = e.Throughput("w1")
+	assert.InDelta(t, 10.0, rate, 1e-9)
+
+	e.Forget("w1")
+	_, ok = e.Throughput("w1")
+	assert.False(t, ok)
+}
+
+func TestEstimatorEstimate(t *testing.T) {
+	e := queue.NewEstimator(queue.DefaultWindow)
+	e.Observe("fast", 20, 10*time.Second) // 2 units/s
+	e.Observe("slow", 10, 10*time.Second) // 1 unit/s
+
+	workers := []queue.Worker{
+		{ID: "fast", Remaining: 20}, // free in 10s
+		{ID: "slow"},                // idle
+		{ID: "new"},                 // no samples, assumed 1.5 units/s, idle
+	}
+	jobs := []queue.Job{{ID: "a", Work: 30}, {ID: "b", Work: 30}, {ID: "c", Work: 30}, {ID: "d", Work: 30}}
+
+	estimates := e.Estimate(workers, jobs)
+	require.Len(t, estimates, 4)
+
+	// a and b start right away on the idle workers
+	assert.Equal(t, "a", estimates[0].JobID)
+	assert.Equal(t, 1, estimates[0].Position)
+	assert.True(t, estimates[0].Known)
+	assert.Equal(t, time.Duration(0), estimates[0].Wait)
+	assert.Equal(t, 30*time.Second, estimates[0].Duration)
+	assert.Equal(t, time.Duration(0), estimates[1].Wait)
+	assert.Equal(t, 20*time.Second, estimates[1].Duration)
+
+	// c waits for the fast worker, d for the new one
+	assert.Equal(t, 10*time.Second, estimates[2].Wait)
+	assert.Equal(t, 25*time.Second, estimates[2].ETA())
+	assert.Equal(t, 4, estimates[3].Position)
+	assert.Equal(t, 20*time.Second, estimates[3].Wait)
+}
+
+func TestEstimatorEstimateUnknown(t *testing.T) {
+	e := queue.NewEstimator(queue.DefaultWindow)
+
+	estimates := e.Estimate([]queue.Worker{{ID: "w1"}}, []queue.Job{{ID: "a", Work: 10}, {ID: "b", Work: 10}})
+	require.Len(t, estimates, 2)
+	assert.Equal(t, 2, estimates[1].Position)
+	assert.False(t, estimates[1].Known)
+	assert.Zero(t, estimates[1].Wait)
+}
@@ -0,0 +1,96 @@
+// Package recovery reconciles work a previous process left unfinished, such
+// as scans or downloads that were in progress when a service stopped.
+package recovery
+
+import (
+	"context"
+	"time"
+
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// Actions taken on orphaned records.
+const (
+	// ActionFailed marks records failed; they have to be started again.
+	ActionFailed = "marked failed"
+	// ActionRequeued puts records back in their queue to be resumed.
+	ActionRequeued = "requeued"
+	// ActionRemoved deletes leftovers that are of no use.
+	ActionRemoved = "removed"
+)
+
+// Step reconciles one kind of record. Run returns the number of records
+// it recovered.
+type Step struct {
+	Name   string
+	Action string
+	Run    func(ctx context.Context) (int, error)
+}
+
+// Entry is the outcome of a step.
+type Entry struct {
+	Step   string
+	Action string
+	Count  int
+	Err    error
+}
+
+// Report summarizes a reconciliation pass.
+type Report struct {
+	Service  string
+	Entries  []Entry
+	Duration time.Duration
+}
+
+// Recovered returns the number of records recovered by all steps.
+func (r *Report) Recovered() int {
+	total := 0
+	for _, e := range r.Entries {
+		total += e.Count
+	}
+	return total
+}
+
+// Failed reports whether any step failed.
+func (r *Report) Failed() bool {
+	for _, e := range r.Entries {
+		if e.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Run runs the steps in order and logs a report. A failing step does not
+// stop the steps after it.
+func Run(ctx context.Context, service string, logger interfaces.Logger, steps ...Step) *Report {
+	started := time.Now()
+	report := &Report{Service: service, Entries: make([]Entry, 0, len(steps))}
+
+	for _, step := range steps {
+		n, err := step.Run(ctx)
+		report.Entries = append(report.Entries, Entry{Step: step.Name, Action: step.Action, Count: n, Err: err})
+
+		switch {
+		case err != nil:
+			logger.Error("Recovery step failed",
+				interfaces.String("service", service),
+				interfaces.String("step", step.Name),
+				interfaces.Error(err))
+		case n > 0:
+			logger.Warn("Recovered interrupted work",
+				interfaces.String("service", service),
+				interfaces.String("step", step.Name),
+				interfaces.String("action", step.Action),
+				interfaces.Int("count", n))
+		}
+	}
+	report.Duration = time.Since(started)
+
+	logger.Info("Recovery complete",
+		interfaces.String("service", service),
+		interfaces.Int("recovered", report.Recovered()),
+		interfaces.Bool("failed", report.Failed()),
+		interfaces.Any("duration", report.Duration))
+	return report
+}
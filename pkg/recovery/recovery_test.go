@@ -0,0 +1,47 @@
+package recovery_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/pkg/logger"
+	"github.com/narwhalmedia/narwhal/pkg/recovery"
+)
+
+func TestRun(t *testing.T) {
+	var ran []string
+	step := func(name string, n int, err error) recovery.Step {
+		return recovery.Step{
+			Name:   name,
+			Action: recovery.ActionFailed,
+			Run: func(context.Context) (int, error) {
+				ran = append(ran, name)
+				return n, err
+			},
+		}
+	}
+
+	report := recovery.Run(context.Background(), "library", logger.NewNoopLogger(),
+		step("tasks", 2, nil),
+		step("scans", 0, errors.New("database unavailable")),
+		step("workflows", 3, nil),
+	)
+
+	assert.Equal(t, []string{"tasks", "scans", "workflows"}, ran)
+	assert.Equal(t, "library", report.Service)
+	assert.Equal(t, 5, report.Recovered())
+	assert.True(t, report.Failed())
+	require.Len(t, report.Entries, 3)
+	assert.EqualError(t, report.Entries[1].Err, "database unavailable")
+}
+
+func TestRun_NothingToRecover(t *testing.T) {
+	report := recovery.Run(context.Background(), "user", logger.NewNoopLogger())
+
+	assert.Zero(t, report.Recovered())
+	assert.False(t, report.Failed())
+}
@@ -0,0 +1,238 @@
+// Package retry decides whether failed downloads and transcode jobs are
+// retried automatically, and when.
+//
+// Failures are classified by reason. Transient reasons, such as network
+// errors or a full disk, are retried with exponential backoff until the
+// policy runs out of attempts; permanent ones, such as a release that is
+// gone or a corrupt source, fail at once, since retrying cannot fix them.
+package retry
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+)
+
+// Reason is why an attempt failed.
+type Reason string
+
+// Failure reasons.
+const (
+	ReasonNetwork       Reason = "network"
+	ReasonTimeout       Reason = "timeout"
+	ReasonDiskFull      Reason = "disk_full"
+	ReasonServerError   Reason = "server_error"
+	ReasonRateLimited   Reason = "rate_limited"
+	ReasonNotFound      Reason = "not_found"
+	ReasonRejected      Reason = "rejected"
+	ReasonCorruptSource Reason = "corrupt_source"
+	ReasonPermanent     Reason = "permanent"
+	ReasonCancelled     Reason = "cancelled"
+	ReasonUnknown       Reason = "unknown"
+)
+
+// reasons are the known failure reasons.
+var reasons = map[Reason]bool{
+	ReasonNetwork: true, ReasonTimeout: true, ReasonDiskFull: true, ReasonServerError: true,
+	ReasonRateLimited: true, ReasonNotFound: true, ReasonRejected: true, ReasonCorruptSource: true,
+	ReasonPermanent: true, ReasonCancelled: true, ReasonUnknown: true,
+}
+
+// DefaultRetryOn are the reasons retried by policies that list none: those
+// that go away on their own. Unknown failures are retried too, as most
+// failures nobody anticipated are.
+var DefaultRetryOn = []Reason{
+	ReasonNetwork, ReasonTimeout, ReasonDiskFull, ReasonServerError, ReasonRateLimited, ReasonUnknown,
+}
+
+// ErrPermanent is wrapped by errors that retrying cannot fix.
+var ErrPermanent = stderrors.New("permanent failure")
+
+// Permanent returns err marked as a failure retrying cannot fix.
+func Permanent(err error) error {
+	return fmt.Errorf("%w: %w", ErrPermanent, err)
+}
+
+// ErrCorruptSource is wrapped by errors of sources that cannot be read,
+// such as a truncated file.
+var ErrCorruptSource = stderrors.New("corrupt source")
+
+// ffmpegCorruptMarkers are printed by ffmpeg for sources it cannot read.
+var ffmpegCorruptMarkers = [][]byte{
+	[]byte("Invalid data found when processing input"),
+	[]byte("moov atom not found"),
+	[]byte("could not find codec parameters"),
+	[]byte("Invalid NAL unit size"),
+	[]byte("EBML header parsing failed"),
+}
+
+// FFmpegError returns the error of a failed ffmpeg run, marked as a corrupt
+// source if its stderr says so.
+func FFmpegError(err error, stderr []byte) error {
+	for _, marker := range ffmpegCorruptMarkers {
+		if bytes.Contains(stderr, marker) {
+			return fmt.Errorf("%w: %w", ErrCorruptSource, err)
+		}
+	}
+	return err
+}
+
+// statusCoder is implemented by errors of HTTP responses, such as
+// downloadclient.StatusError.
+type statusCoder interface {
+	HTTPStatus() int
+}
+
+// Classify returns why an attempt failed.
+func Classify(err error) Reason {
+	var status statusCoder
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return ""
+	case stderrors.Is(err, ErrCorruptSource):
+		return ReasonCorruptSource
+	case stderrors.Is(err, ErrPermanent):
+		return ReasonPermanent
+	case stderrors.Is(err, context.Canceled):
+		return ReasonCancelled
+	case stderrors.Is(err, syscall.ENOSPC), stderrors.Is(err, syscall.EDQUOT):
+		return ReasonDiskFull
+	case stderrors.As(err, &status):
+		return classifyStatus(status.HTTPStatus())
+	case stderrors.Is(err, context.DeadlineExceeded), stderrors.Is(err, os.ErrDeadlineExceeded):
+		return ReasonTimeout
+	case stderrors.As(err, &netErr):
+		if netErr.Timeout() {
+			return ReasonTimeout
+		}
+		return ReasonNetwork
+	case stderrors.Is(err, syscall.ECONNREFUSED), stderrors.Is(err, syscall.ECONNRESET),
+		stderrors.Is(err, io.ErrUnexpectedEOF):
+		return ReasonNetwork
+	case stderrors.Is(err, fs.ErrNotExist), errors.IsNotFound(err):
+		return ReasonNotFound
+	case errors.IsBadRequest(err), errors.IsUnauthorized(err), errors.IsForbidden(err):
+		return ReasonRejected
+	}
+	return ReasonUnknown
+}
+
+func classifyStatus(code int) Reason {
+	switch {
+	case code == http.StatusNotFound, code == http.StatusGone:
+		return ReasonNotFound
+	case code == http.StatusRequestTimeout, code == http.StatusGatewayTimeout:
+		return ReasonTimeout
+	case code == http.StatusTooManyRequests:
+		return ReasonRateLimited
+	case code >= 500:
+		return ReasonServerError
+	case code >= 400:
+		return ReasonRejected
+	}
+	return ReasonUnknown
+}
+
+// Policy decides which failures are retried, how often and when. The
+// delay before the first retry is InitialDelay, multiplied by Multiplier
+// for every further one, up to MaxDelay.
+type Policy struct {
+	// MaxAttempts is the number of attempts, including the first. One
+	// never retries.
+	MaxAttempts  int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	// Multiplier defaults to 2.
+	Multiplier float64
+	// RetryOn are the reasons retried; empty retries DefaultRetryOn.
+	RetryOn []Reason
+}
+
+// Validate checks the policy.
+func (p Policy) Validate() error {
+	if p.MaxAttempts < 1 {
+		return stderrors.New("max attempts must be at least 1")
+	}
+	if p.InitialDelay < 0 || p.MaxDelay < 0 {
+		return stderrors.New("retry delays cannot be negative")
+	}
+	if p.MaxDelay > 0 && p.MaxDelay < p.InitialDelay {
+		return stderrors.New("max retry delay cannot be below the initial delay")
+	}
+	if p.Multiplier != 0 && p.Multiplier < 1 {
+		return stderrors.New("retry multiplier must be at least 1")
+	}
+	for _, reason := range p.RetryOn {
+		if !reasons[reason] {
+			return fmt.Errorf("unknown retry reason %q", reason)
+		}
+	}
+	return nil
+}
+
+// Retries reports whether the policy retries failures of a reason.
+// Cancelled attempts are never retried.
+func (p Policy) Retries(reason Reason) bool {
+	if reason == ReasonCancelled {
+		return false
+	}
+	retryOn := p.RetryOn
+	if len(retryOn) == 0 {
+		retryOn = DefaultRetryOn
+	}
+	for _, r := range retryOn {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// Delay returns how long to wait before the attempt after the given one,
+// counting from 1.
+func (p Policy) Delay(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+	delay := float64(p.InitialDelay) * math.Pow(multiplier, float64(max(attempt-1, 0)))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		return p.MaxDelay
+	}
+	if delay > math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(delay)
+}
+
+// Decision is what to do about a failed attempt.
+type Decision struct {
+	Reason Reason
+	Retry  bool
+	// RetryAt is when to make the next attempt, if retried.
+	RetryAt time.Time
+}
+
+// Decide decides whether to retry after the given attempt, counting from
+// 1, failed at now with err.
+func (p Policy) Decide(attempt int, err error, now time.Time) Decision {
+	decision := Decision{Reason: Classify(err)}
+	if attempt >= p.MaxAttempts || !p.Retries(decision.Reason) {
+		return decision
+	}
+	decision.Retry = true
+	decision.RetryAt = now.Add(p.Delay(attempt))
+	return decision
+}
@@ -0,0 +1,91 @@
+package retry_test
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/pkg/downloadclient"
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/retry"
+)
+
+func TestClassify(t *testing.T) {
+	status := func(code int) error {
+		return fmt.Errorf("failed to add download: %w", &downloadclient.StatusError{StatusCode: code})
+	}
+	tests := map[retry.Reason][]error{
+		retry.ReasonNotFound:      {status(http.StatusNotFound), status(http.StatusGone), fs.ErrNotExist, errors.NotFound("release")},
+		retry.ReasonRejected:      {status(http.StatusForbidden), errors.BadRequest("bad url")},
+		retry.ReasonServerError:   {status(http.StatusBadGateway)},
+		retry.ReasonRateLimited:   {status(http.StatusTooManyRequests)},
+		retry.ReasonTimeout:       {context.DeadlineExceeded, status(http.StatusGatewayTimeout)},
+		retry.ReasonNetwork:       {&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, syscall.ECONNRESET},
+		retry.ReasonDiskFull:      {&fs.PathError{Op: "write", Path: "/data/x.mkv", Err: syscall.ENOSPC}},
+		retry.ReasonCorruptSource: {retry.FFmpegError(stderrors.New("exit status 1"), []byte("x.mkv: Invalid data found when processing input"))},
+		retry.ReasonPermanent:     {retry.Permanent(stderrors.New("download is infected"))},
+		retry.ReasonCancelled:     {fmt.Errorf("transcode: %w", context.Canceled)},
+		retry.ReasonUnknown:       {stderrors.New("exit status 1"), retry.FFmpegError(stderrors.New("exit status 1"), []byte("Killed"))},
+	}
+	for reason, errs := range tests {
+		for _, err := range errs {
+			assert.Equal(t, reason, retry.Classify(err), "%v", err)
+		}
+	}
+	assert.Empty(t, retry.Classify(nil))
+}
+
+func TestPolicy_Delay(t *testing.T) {
+	p := retry.Policy{MaxAttempts: 10, InitialDelay: time.Minute, MaxDelay: time.Hour}
+	assert.Equal(t, time.Minute, p.Delay(1))
+	assert.Equal(t, 2*time.Minute, p.Delay(2))
+	assert.Equal(t, 32*time.Minute, p.Delay(6))
+	assert.Equal(t, time.Hour, p.Delay(7))
+	assert.Equal(t, time.Hour, p.Delay(1000))
+
+	p.Multiplier = 3
+	assert.Equal(t, 9*time.Minute, p.Delay(3))
+}
+
+func TestPolicy_Decide(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	p := retry.Policy{MaxAttempts: 3, InitialDelay: time.Minute}
+	diskFull := &fs.PathError{Op: "write", Path: "/data", Err: syscall.ENOSPC}
+
+	decision := p.Decide(1, diskFull, now)
+	assert.Equal(t, retry.Decision{Reason: retry.ReasonDiskFull, Retry: true, RetryAt: now.Add(time.Minute)}, decision)
+	assert.Equal(t, now.Add(2*time.Minute), p.Decide(2, diskFull, now).RetryAt)
+	assert.False(t, p.Decide(3, diskFull, now).Retry, "out of attempts")
+
+	gone := &downloadclient.StatusError{StatusCode: http.StatusNotFound}
+	assert.Equal(t, retry.Decision{Reason: retry.ReasonNotFound}, p.Decide(1, gone, now), "permanent failures fail at once")
+
+	p.RetryOn = []retry.Reason{retry.ReasonNotFound}
+	assert.True(t, p.Decide(1, gone, now).Retry)
+	assert.False(t, p.Decide(1, diskFull, now).Retry)
+	assert.False(t, p.Decide(1, context.Canceled, now).Retry)
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	require.NoError(t, retry.Policy{MaxAttempts: 1}.Validate())
+	require.NoError(t, retry.Policy{MaxAttempts: 3, InitialDelay: time.Minute, MaxDelay: time.Hour,
+		RetryOn: []retry.Reason{retry.ReasonNetwork}}.Validate())
+
+	for _, p := range []retry.Policy{
+		{},
+		{MaxAttempts: 3, InitialDelay: time.Hour, MaxDelay: time.Minute},
+		{MaxAttempts: 3, Multiplier: 0.5},
+		{MaxAttempts: 3, RetryOn: []retry.Reason{"cosmic_rays"}},
+	} {
+		assert.Error(t, p.Validate(), "%+v", p)
+	}
+}
@@ -0,0 +1,281 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// WorkflowStatus represents the overall state of a workflow.
+type WorkflowStatus string
+
+const (
+	WorkflowStatusRunning      WorkflowStatus = "running"
+	WorkflowStatusCompleted    WorkflowStatus = "completed"
+	WorkflowStatusCompensating WorkflowStatus = "compensating"
+	WorkflowStatusCompensated  WorkflowStatus = "compensated"
+	WorkflowStatusFailed       WorkflowStatus = "failed"
+	// WorkflowStatusParked is a workflow stopped by a step that needs a
+	// person to decide how to go on, such as an ambiguous import.
+	WorkflowStatusParked WorkflowStatus = "parked"
+)
+
+// StepStatus represents the state of a single workflow step.
+type StepStatus string
+
+const (
+	StepStatusPending            StepStatus = "pending"
+	StepStatusRunning            StepStatus = "running"
+	StepStatusCompleted          StepStatus = "completed"
+	StepStatusFailed             StepStatus = "failed"
+	StepStatusCompensated        StepStatus = "compensated"
+	StepStatusCompensationFailed StepStatus = "compensation_failed"
+	StepStatusParked             StepStatus = "parked"
+)
+
+// DefaultMaxAttempts is used for steps that do not set MaxAttempts.
+const DefaultMaxAttempts = 3
+
+// DefaultRetryDelay is the delay before the first retry of a step. It
+// doubles with every further attempt.
+const DefaultRetryDelay = time.Second
+
+// ErrParked is returned by steps, wrapped with Park, to park their
+// workflow. Parked steps are neither retried nor compensated: what they did
+// so far is kept for whoever picks the work up.
+var ErrParked = errors.New("workflow parked")
+
+// Park returns the error a step returns to park its workflow.
+func Park(reason string) error {
+	return fmt.Errorf("%w: %s", ErrParked, reason)
+}
+
+// ErrPermanent is wrapped by errors of steps that retrying cannot fix, such
+// as a download flagged as malware. Such steps are compensated at once.
+var ErrPermanent = errors.New("permanent failure")
+
+// Permanent returns the error a step returns to fail without being retried.
+func Permanent(err error) error {
+	return fmt.Errorf("%w: %w", ErrPermanent, err)
+}
+
+// StepRecord is the timeline entry of one step of a workflow.
+type StepRecord struct {
+	Name        string     `json:"name"`
+	Status      StepStatus `json:"status"`
+	Attempts    int        `json:"attempts"`
+	Error       string     `json:"error,omitempty"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// Workflow tracks a multi-step operation on a single media item. Data is
+// shared between steps, e.g. a download step records the path an import
+// step picks up.
+type Workflow struct {
+	ID        uuid.UUID
+	MediaID   uuid.UUID
+	Status    WorkflowStatus
+	Steps     []StepRecord
+	Data      map[string]string
+	Error     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Step is one unit of work in a workflow. Compensate undoes whatever
+// Execute managed to do, including partial work of a failed attempt, and
+// may be nil for steps with nothing to undo.
+type Step struct {
+	Name        string
+	MaxAttempts int
+	Execute     func(ctx context.Context, wf *Workflow) error
+	Compensate  func(ctx context.Context, wf *Workflow) error
+}
+
+// Store persists workflows so their progress survives restarts and can be
+// inspected.
+type Store interface {
+	CreateWorkflow(ctx context.Context, wf *Workflow) error
+	UpdateWorkflow(ctx context.Context, wf *Workflow) error
+}
+
+// Orchestrator runs workflows step by step. Failed steps are retried with
+// exponential backoff; once a step runs out of attempts or fails
+// permanently the steps run so far are compensated in reverse order. Steps
+// that park the workflow stop it as is.
+type Orchestrator struct {
+	store      Store
+	steps      []Step
+	retryDelay time.Duration
+	logger     interfaces.Logger
+}
+
+// NewOrchestrator creates an orchestrator for the given steps.
+func NewOrchestrator(store Store, logger interfaces.Logger, steps ...Step) *Orchestrator {
+	return &Orchestrator{
+		store:      store,
+		steps:      steps,
+		retryDelay: DefaultRetryDelay,
+		logger:     logger,
+	}
+}
+
+// WithRetryDelay sets the delay before the first retry of a step.
+func (o *Orchestrator) WithRetryDelay(delay time.Duration) *Orchestrator {
+	o.retryDelay = delay
+	return o
+}
+
+// Run executes a new workflow for a media item. The returned workflow holds
+// the full step timeline; the error is that of the step that failed, or
+// wraps ErrParked if a step parked the workflow.
+func (o *Orchestrator) Run(ctx context.Context, mediaID uuid.UUID, data map[string]string) (*Workflow, error) {
+	if data == nil {
+		data = make(map[string]string)
+	}
+
+	now := time.Now()
+	wf := &Workflow{
+		ID:        uuid.New(),
+		MediaID:   mediaID,
+		Status:    WorkflowStatusRunning,
+		Steps:     make([]StepRecord, len(o.steps)),
+		Data:      data,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	for i, step := range o.steps {
+		wf.Steps[i] = StepRecord{Name: step.Name, Status: StepStatusPending}
+	}
+
+	if err := o.store.CreateWorkflow(ctx, wf); err != nil {
+		return nil, fmt.Errorf("failed to create workflow: %w", err)
+	}
+
+	for i := range o.steps {
+		if err := o.runStep(ctx, wf, i); err != nil {
+			wf.Error = err.Error()
+			if errors.Is(err, ErrParked) {
+				wf.Status = WorkflowStatusParked
+				o.save(ctx, wf)
+				return wf, err
+			}
+			o.compensate(ctx, wf, i)
+			return wf, err
+		}
+	}
+
+	wf.Status = WorkflowStatusCompleted
+	o.save(ctx, wf)
+	return wf, nil
+}
+
+// runStep executes a step until it succeeds or runs out of attempts.
+func (o *Orchestrator) runStep(ctx context.Context, wf *Workflow, i int) error {
+	step := o.steps[i]
+	record := &wf.Steps[i]
+
+	maxAttempts := step.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+
+	started := time.Now()
+	record.StartedAt = &started
+	record.Status = StepStatusRunning
+
+	delay := o.retryDelay
+	for {
+		record.Attempts++
+		o.save(ctx, wf)
+
+		err := step.Execute(ctx, wf)
+		if err == nil {
+			completed := time.Now()
+			record.CompletedAt = &completed
+			record.Status = StepStatusCompleted
+			record.Error = ""
+			o.save(ctx, wf)
+			return nil
+		}
+
+		record.Error = err.Error()
+		o.logger.Warn("Workflow step failed",
+			interfaces.String("workflow_id", wf.ID.String()),
+			interfaces.String("step", step.Name),
+			interfaces.Int("attempt", record.Attempts),
+			interfaces.Error(err))
+
+		if errors.Is(err, ErrParked) {
+			completed := time.Now()
+			record.CompletedAt = &completed
+			record.Status = StepStatusParked
+			return fmt.Errorf("step %s parked: %w", step.Name, err)
+		}
+		if record.Attempts >= maxAttempts || errors.Is(err, ErrPermanent) {
+			completed := time.Now()
+			record.CompletedAt = &completed
+			record.Status = StepStatusFailed
+			return fmt.Errorf("step %s failed after %d attempts: %w", step.Name, record.Attempts, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			record.Status = StepStatusFailed
+			return fmt.Errorf("step %s interrupted: %w", step.Name, errors.Join(err, ctx.Err()))
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// compensate undoes the failed step and every step before it, newest
+// first. Compensation keeps going when a step cannot be undone so as much
+// as possible is cleaned up.
+func (o *Orchestrator) compensate(ctx context.Context, wf *Workflow, failed int) {
+	wf.Status = WorkflowStatusCompensating
+	o.save(ctx, wf)
+
+	// Compensation must run even if the workflow was cancelled
+	ctx = context.WithoutCancel(ctx)
+
+	wf.Status = WorkflowStatusCompensated
+	for i := failed; i >= 0; i-- {
+		step := o.steps[i]
+		record := &wf.Steps[i]
+		if step.Compensate == nil {
+			continue
+		}
+
+		if err := step.Compensate(ctx, wf); err != nil {
+			o.logger.Error("Workflow compensation failed",
+				interfaces.String("workflow_id", wf.ID.String()),
+				interfaces.String("step", step.Name),
+				interfaces.Error(err))
+			record.Status = StepStatusCompensationFailed
+			record.Error = err.Error()
+			wf.Status = WorkflowStatusFailed
+			continue
+		}
+		record.Status = StepStatusCompensated
+	}
+
+	o.save(ctx, wf)
+}
+
+// save persists workflow progress. Failures are logged rather than
+// returned so bookkeeping never aborts the work itself.
+func (o *Orchestrator) save(ctx context.Context, wf *Workflow) {
+	wf.UpdatedAt = time.Now()
+	if err := o.store.UpdateWorkflow(ctx, wf); err != nil {
+		o.logger.Error("Failed to save workflow",
+			interfaces.String("workflow_id", wf.ID.String()),
+			interfaces.Error(err))
+	}
+}
@@ -0,0 +1,173 @@
+package saga_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/pkg/logger"
+	"github.com/narwhalmedia/narwhal/pkg/saga"
+)
+
+type memoryStore struct {
+	saved map[uuid.UUID]saga.Workflow
+}
+
+func (s *memoryStore) CreateWorkflow(_ context.Context, wf *saga.Workflow) error {
+	s.saved[wf.ID] = *wf
+	return nil
+}
+
+func (s *memoryStore) UpdateWorkflow(_ context.Context, wf *saga.Workflow) error {
+	s.saved[wf.ID] = *wf
+	return nil
+}
+
+func step(name string, calls *[]string, failures int) saga.Step {
+	return saga.Step{
+		Name: name,
+		Execute: func(context.Context, *saga.Workflow) error {
+			*calls = append(*calls, name)
+			if failures > 0 {
+				failures--
+				return errors.New(name + " failed")
+			}
+			return nil
+		},
+		Compensate: func(context.Context, *saga.Workflow) error {
+			*calls = append(*calls, "undo "+name)
+			return nil
+		},
+	}
+}
+
+func TestOrchestrator_Completes(t *testing.T) {
+	store := &memoryStore{saved: make(map[uuid.UUID]saga.Workflow)}
+	var calls []string
+
+	orchestrator := saga.NewOrchestrator(store, logger.NewNoopLogger(),
+		step("download", &calls, 0),
+		step("import", &calls, 2),
+	).WithRetryDelay(0)
+
+	wf, err := orchestrator.Run(context.Background(), uuid.New(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, saga.WorkflowStatusCompleted, wf.Status)
+	assert.Equal(t, []string{"download", "import", "import", "import"}, calls)
+
+	// Retried steps keep their attempt count and clear the error
+	assert.Equal(t, 3, wf.Steps[1].Attempts)
+	assert.Equal(t, saga.StepStatusCompleted, wf.Steps[1].Status)
+	assert.Empty(t, wf.Steps[1].Error)
+	assert.NotNil(t, wf.Steps[1].CompletedAt)
+
+	assert.Equal(t, saga.WorkflowStatusCompleted, store.saved[wf.ID].Status)
+}
+
+func TestOrchestrator_Compensates(t *testing.T) {
+	store := &memoryStore{saved: make(map[uuid.UUID]saga.Workflow)}
+	var calls []string
+
+	orchestrator := saga.NewOrchestrator(store, logger.NewNoopLogger(),
+		step("download", &calls, 0),
+		step("import", &calls, 0),
+		step("transcode", &calls, saga.DefaultMaxAttempts),
+		step("publish", &calls, 0),
+	).WithRetryDelay(0)
+
+	wf, err := orchestrator.Run(context.Background(), uuid.New(), nil)
+	require.Error(t, err)
+	assert.Equal(t, saga.WorkflowStatusCompensated, wf.Status)
+	assert.Equal(t, []string{
+		"download", "import", "transcode", "transcode", "transcode",
+		"undo transcode", "undo import", "undo download",
+	}, calls)
+
+	assert.Equal(t, saga.StepStatusCompensated, wf.Steps[2].Status)
+	assert.Equal(t, "transcode failed", wf.Steps[2].Error)
+	assert.Equal(t, saga.StepStatusPending, wf.Steps[3].Status)
+	assert.Contains(t, wf.Error, "transcode")
+}
+
+func TestOrchestrator_CompensationFailure(t *testing.T) {
+	store := &memoryStore{saved: make(map[uuid.UUID]saga.Workflow)}
+	var calls []string
+
+	download := step("download", &calls, 0)
+	download.Compensate = func(context.Context, *saga.Workflow) error {
+		return errors.New("file is locked")
+	}
+
+	orchestrator := saga.NewOrchestrator(store, logger.NewNoopLogger(),
+		download,
+		saga.Step{
+			Name:        "import",
+			MaxAttempts: 1,
+			Execute: func(context.Context, *saga.Workflow) error {
+				return errors.New("library is gone")
+			},
+		},
+	)
+
+	wf, err := orchestrator.Run(context.Background(), uuid.New(), nil)
+	require.Error(t, err)
+	assert.Equal(t, saga.WorkflowStatusFailed, wf.Status)
+	assert.Equal(t, saga.StepStatusCompensationFailed, wf.Steps[0].Status)
+	assert.Equal(t, saga.StepStatusFailed, wf.Steps[1].Status)
+	assert.Equal(t, 1, wf.Steps[1].Attempts)
+}
+
+func TestOrchestrator_Parks(t *testing.T) {
+	store := &memoryStore{saved: make(map[uuid.UUID]saga.Workflow)}
+	var calls []string
+
+	orchestrator := saga.NewOrchestrator(store, logger.NewNoopLogger(),
+		step("download", &calls, 0),
+		saga.Step{
+			Name: "import",
+			Execute: func(context.Context, *saga.Workflow) error {
+				calls = append(calls, "import")
+				return saga.Park("ambiguous match")
+			},
+		},
+		step("transcode", &calls, 0),
+	).WithRetryDelay(0)
+
+	wf, err := orchestrator.Run(context.Background(), uuid.New(), nil)
+	require.ErrorIs(t, err, saga.ErrParked)
+	assert.Equal(t, saga.WorkflowStatusParked, wf.Status)
+	assert.Equal(t, []string{"download", "import"}, calls, "neither retried nor compensated")
+	assert.Equal(t, saga.StepStatusCompleted, wf.Steps[0].Status)
+	assert.Equal(t, saga.StepStatusParked, wf.Steps[1].Status)
+	assert.Equal(t, saga.StepStatusPending, wf.Steps[2].Status)
+	assert.Equal(t, saga.WorkflowStatusParked, store.saved[wf.ID].Status)
+}
+
+func TestOrchestrator_PermanentFailure(t *testing.T) {
+	store := &memoryStore{saved: make(map[uuid.UUID]saga.Workflow)}
+	var calls []string
+
+	orchestrator := saga.NewOrchestrator(store, logger.NewNoopLogger(),
+		step("download", &calls, 0),
+		saga.Step{
+			Name: "scan",
+			Execute: func(context.Context, *saga.Workflow) error {
+				calls = append(calls, "scan")
+				return saga.Permanent(errors.New("download is infected"))
+			},
+		},
+		step("import", &calls, 0),
+	).WithRetryDelay(0)
+
+	wf, err := orchestrator.Run(context.Background(), uuid.New(), nil)
+	require.ErrorIs(t, err, saga.ErrPermanent)
+	assert.Equal(t, saga.WorkflowStatusCompensated, wf.Status)
+	assert.Equal(t, []string{"download", "scan", "undo download"}, calls, "not retried")
+	assert.Equal(t, 1, wf.Steps[1].Attempts)
+	assert.Equal(t, saga.StepStatusFailed, wf.Steps[1].Status)
+	assert.Equal(t, saga.StepStatusPending, wf.Steps[2].Status)
+}
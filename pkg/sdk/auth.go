@@ -0,0 +1,60 @@
+package sdk
+
+import (
+	"context"
+	"time"
+
+	authpb "github.com/narwhalmedia/narwhal/pkg/auth/v1"
+)
+
+// Device describes the device a client logs in from, for the user's list
+// of sessions.
+type Device struct {
+	ID         string
+	Name       string
+	Platform   string // such as android, ios, web or tv
+	AppVersion string
+}
+
+// Login logs a user in. The client uses and refreshes the tokens of the
+// session from then on.
+func (c *Client) Login(ctx context.Context, username, password string, device Device) (*authpb.User, error) {
+	resp, err := c.auth.Login(ctx, &authpb.LoginRequest{
+		Username:   username,
+		Password:   password,
+		DeviceId:   device.ID,
+		DeviceName: device.Name,
+		Platform:   device.Platform,
+		AppVersion: device.AppVersion,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.tokens.set(newTokens(resp.GetAccessToken(), resp.GetRefreshToken(), resp.GetExpiresIn(), time.Now()))
+	return resp.GetUser(), nil
+}
+
+// Logout ends the session of the client, or every session of the user if
+// allDevices is set, and forgets its tokens.
+func (c *Client) Logout(ctx context.Context, allDevices bool) error {
+	_, err := c.auth.Logout(ctx, &authpb.LogoutRequest{
+		RefreshToken: c.tokens.get().RefreshToken,
+		AllDevices:   allDevices,
+	})
+	if err != nil {
+		return err
+	}
+
+	c.tokens.set(Tokens{})
+	return nil
+}
+
+// refresh exchanges a refresh token for new tokens.
+func (c *Client) refresh(ctx context.Context, refreshToken string) (Tokens, error) {
+	resp, err := c.auth.RefreshToken(ctx, &authpb.RefreshTokenRequest{RefreshToken: refreshToken})
+	if err != nil {
+		return Tokens{}, err
+	}
+	return newTokens(resp.GetAccessToken(), resp.GetRefreshToken(), resp.GetExpiresIn(), time.Now()), nil
+}
@@ -0,0 +1,175 @@
+// Package sdk is a client for Go programs using the Narwhal services. It
+// logs in and keeps the access token fresh, and wraps common flows such as
+// listing media, streaming and enqueueing downloads. The generated clients
+// of each service are available for the rest of the API.
+package sdk
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	acquisitionpb "github.com/narwhalmedia/narwhal/pkg/acquisition/v1"
+	authpb "github.com/narwhalmedia/narwhal/pkg/auth/v1"
+	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
+	streamingpb "github.com/narwhalmedia/narwhal/pkg/streaming/v1"
+)
+
+// DefaultRefreshBefore is how long before it expires the access token is
+// refreshed when Config.RefreshBefore is not set.
+const DefaultRefreshBefore = time.Minute
+
+// Endpoints are the gRPC addresses of the services, such as
+// "localhost:9090". An empty address uses Config.Address.
+type Endpoints struct {
+	Auth        string // the user service
+	Library     string
+	Streaming   string
+	Acquisition string
+}
+
+// Config configures a client.
+type Config struct {
+	// Address is the address of services without one in Endpoints, such as
+	// a gateway serving them all.
+	Address   string
+	Endpoints Endpoints
+	// Tokens are the tokens of a session to resume; empty tokens require a
+	// Login.
+	Tokens Tokens
+	// OnTokens is called with the new tokens after a login or refresh, so
+	// they can be persisted, and with empty tokens after a logout.
+	OnTokens func(Tokens)
+	// RefreshBefore is how long before it expires the access token is
+	// refreshed.
+	RefreshBefore time.Duration
+	// DialOptions are added to the options of every connection. Without
+	// transport credentials among them, connections are insecure.
+	DialOptions []grpc.DialOption
+}
+
+// Client talks to the Narwhal services as a user. It is safe for
+// concurrent use.
+type Client struct {
+	tokens *tokenSource
+
+	conns       []*grpc.ClientConn
+	auth        authpb.AuthServiceClient
+	library     librarypb.LibraryServiceClient
+	streaming   streamingpb.StreamingServiceClient
+	acquisition acquisitionpb.AcquisitionServiceClient
+}
+
+// New creates a client. Connections are made lazily, on the first call to
+// their service.
+func New(cfg Config) (*Client, error) {
+	if cfg.RefreshBefore <= 0 {
+		cfg.RefreshBefore = DefaultRefreshBefore
+	}
+
+	c := &Client{}
+	c.tokens = newTokenSource(cfg.Tokens, cfg.RefreshBefore, cfg.OnTokens, c.refresh)
+
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(c.tokens.unaryInterceptor),
+		grpc.WithChainStreamInterceptor(c.tokens.streamInterceptor),
+	}
+	// Later options win, so credentials given by the caller replace the
+	// insecure ones
+	opts = append(opts, cfg.DialOptions...)
+
+	dialed := make(map[string]*grpc.ClientConn)
+	dial := func(service, address string) (*grpc.ClientConn, error) {
+		if address == "" {
+			address = cfg.Address
+		}
+		if address == "" {
+			return nil, fmt.Errorf("no address for the %s service", service)
+		}
+		if conn, ok := dialed[address]; ok {
+			return conn, nil
+		}
+		conn, err := grpc.NewClient(address, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s client: %w", service, err)
+		}
+		dialed[address] = conn
+		c.conns = append(c.conns, conn)
+		return conn, nil
+	}
+
+	authConn, err := dial("auth", cfg.Endpoints.Auth)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	libraryConn, err := dial("library", cfg.Endpoints.Library)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	streamingConn, err := dial("streaming", cfg.Endpoints.Streaming)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	acquisitionConn, err := dial("acquisition", cfg.Endpoints.Acquisition)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	c.auth = authpb.NewAuthServiceClient(authConn)
+	c.library = librarypb.NewLibraryServiceClient(libraryConn)
+	c.streaming = streamingpb.NewStreamingServiceClient(streamingConn)
+	c.acquisition = acquisitionpb.NewAcquisitionServiceClient(acquisitionConn)
+	return c, nil
+}
+
+// Close closes the connections of the client.
+func (c *Client) Close() error {
+	var errs []error
+	for _, conn := range c.conns {
+		if err := conn.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	c.conns = nil
+	return errors.Join(errs...)
+}
+
+// Auth returns the client of the auth service. Its calls carry the access
+// token of the client.
+func (c *Client) Auth() authpb.AuthServiceClient {
+	return c.auth
+}
+
+// Library returns the client of the library service.
+func (c *Client) Library() librarypb.LibraryServiceClient {
+	return c.library
+}
+
+// Streaming returns the client of the streaming service.
+func (c *Client) Streaming() streamingpb.StreamingServiceClient {
+	return c.streaming
+}
+
+// Acquisition returns the client of the acquisition service.
+func (c *Client) Acquisition() acquisitionpb.AcquisitionServiceClient {
+	return c.acquisition
+}
+
+// Tokens returns the current tokens of the client.
+func (c *Client) Tokens() Tokens {
+	return c.tokens.get()
+}
+
+// SetTokens replaces the tokens of the client, such as with tokens obtained
+// elsewhere.
+func (c *Client) SetTokens(tokens Tokens) {
+	c.tokens.set(tokens)
+}
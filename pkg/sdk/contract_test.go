@@ -0,0 +1,51 @@
+package sdk_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/narwhalmedia/narwhal/pkg/contract"
+	"github.com/narwhalmedia/narwhal/pkg/sdk"
+)
+
+// TestContracts replays the responses the SDK relies on from the services
+// through the client.
+func TestContracts(t *testing.T) {
+	dir, err := contract.Dir()
+	require.NoError(t, err)
+	contracts, err := contract.LoadDir(dir)
+	require.NoError(t, err)
+
+	var refreshed []sdk.Tokens
+	client, err := sdk.New(sdk.Config{
+		Address: "passthrough:///contract",
+		// Every call refreshes the tokens, as they expire within the hour
+		RefreshBefore: time.Hour,
+		OnTokens:      func(tokens sdk.Tokens) { refreshed = append(refreshed, tokens) },
+		DialOptions: []grpc.DialOption{
+			grpc.WithChainUnaryInterceptor(contract.ReplayUnaryClientInterceptor(
+				contract.Select(contracts, contract.ByConsumer("sdk")))),
+		},
+	})
+	require.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+
+	user, err := client.Login(ctx, "alice", "secret", sdk.Device{})
+	require.NoError(t, err)
+	assert.NotEmpty(t, user.GetId())
+
+	for media, err := range client.ListMedia(ctx, sdk.ListMediaOptions{}) {
+		require.NoError(t, err)
+		assert.NotEmpty(t, media.GetTitle())
+	}
+
+	require.Len(t, refreshed, 2)
+	assert.NotEqual(t, refreshed[0].AccessToken, refreshed[1].AccessToken)
+	assert.False(t, refreshed[1].ExpiresAt.IsZero())
+}
@@ -0,0 +1,61 @@
+package sdk
+
+import (
+	"context"
+	"iter"
+
+	acquisitionpb "github.com/narwhalmedia/narwhal/pkg/acquisition/v1"
+	commonpb "github.com/narwhalmedia/narwhal/pkg/common/v1"
+)
+
+// Download describes a release to enqueue with EnqueueDownload. A release
+// found by a search is given by its release and indexer IDs; any other by
+// its download URL.
+type Download struct {
+	ReleaseID        string
+	IndexerID        string
+	Title            string
+	DownloadURL      string
+	QualityProfileID string
+	OutputPath       string
+	Priority         int32
+}
+
+// EnqueueDownload adds a release to the download queue.
+func (c *Client) EnqueueDownload(ctx context.Context, download Download) (*acquisitionpb.Download, error) {
+	resp, err := c.acquisition.AddDownload(ctx, &acquisitionpb.AddDownloadRequest{
+		ReleaseId:        download.ReleaseID,
+		IndexerId:        download.IndexerID,
+		Title:            download.Title,
+		DownloadUrl:      download.DownloadURL,
+		QualityProfileId: download.QualityProfileID,
+		OutputPath:       download.OutputPath,
+		Priority:         download.Priority,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetDownload(), nil
+}
+
+// ListDownloads iterates over the downloads with a status, or all of them
+// if status is unspecified.
+func (c *Client) ListDownloads(
+	ctx context.Context,
+	status acquisitionpb.DownloadStatus,
+	pageSize int32,
+) iter.Seq2[*acquisitionpb.Download, error] {
+	return paginate(ctx, pageSize, func(
+		ctx context.Context,
+		page *commonpb.PaginationRequest,
+	) ([]*acquisitionpb.Download, *commonpb.PaginationResponse, error) {
+		resp, err := c.acquisition.ListDownloads(ctx, &acquisitionpb.ListDownloadsRequest{
+			Pagination:   page,
+			StatusFilter: status,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return resp.GetDownloads(), resp.GetPagination(), nil
+	})
+}
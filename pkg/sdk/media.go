@@ -0,0 +1,63 @@
+package sdk
+
+import (
+	"context"
+	"iter"
+
+	commonpb "github.com/narwhalmedia/narwhal/pkg/common/v1"
+	librarypb "github.com/narwhalmedia/narwhal/pkg/library/v1"
+)
+
+// ListMediaOptions filter and sort the media of ListMedia.
+type ListMediaOptions struct {
+	LibraryID string // all libraries if empty
+	Type      commonpb.MediaType
+	SortBy    string // title, added, modified or size
+	SortOrder commonpb.SortOrder
+	PageSize  int32
+}
+
+// ListMedia iterates over the media items matching opts, fetching pages as
+// they are reached:
+//
+//	for media, err := range client.ListMedia(ctx, sdk.ListMediaOptions{}) {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(media.GetTitle())
+//	}
+func (c *Client) ListMedia(ctx context.Context, opts ListMediaOptions) iter.Seq2[*librarypb.Media, error] {
+	return paginate(ctx, opts.PageSize, func(
+		ctx context.Context,
+		page *commonpb.PaginationRequest,
+	) ([]*librarypb.Media, *commonpb.PaginationResponse, error) {
+		resp, err := c.library.ListMedia(ctx, &librarypb.ListMediaRequest{
+			Pagination: page,
+			LibraryId:  opts.LibraryID,
+			TypeFilter: opts.Type,
+			SortBy:     opts.SortBy,
+			SortOrder:  opts.SortOrder,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return resp.GetMedia(), resp.GetPagination(), nil
+	})
+}
+
+// SearchMedia iterates over the media items matching a query.
+func (c *Client) SearchMedia(ctx context.Context, query string, pageSize int32) iter.Seq2[*librarypb.Media, error] {
+	return paginate(ctx, pageSize, func(
+		ctx context.Context,
+		page *commonpb.PaginationRequest,
+	) ([]*librarypb.Media, *commonpb.PaginationResponse, error) {
+		resp, err := c.library.SearchMedia(ctx, &librarypb.SearchMediaRequest{
+			Query:      query,
+			Pagination: page,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return resp.GetResults(), resp.GetPagination(), nil
+	})
+}
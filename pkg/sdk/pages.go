@@ -0,0 +1,47 @@
+package sdk
+
+import (
+	"context"
+	"iter"
+
+	commonpb "github.com/narwhalmedia/narwhal/pkg/common/v1"
+)
+
+// DefaultPageSize is the page size of list calls when none is given.
+const DefaultPageSize = 50
+
+// fetchPage fetches the page of a list call with a page token, returning
+// its items and the token of the next page.
+type fetchPage[T any] func(ctx context.Context, page *commonpb.PaginationRequest) ([]T, *commonpb.PaginationResponse, error)
+
+// paginate iterates over the items of every page of a list call, fetching
+// pages as they are reached. Iteration stops at the first error, which is
+// yielded with a zero item.
+func paginate[T any](ctx context.Context, pageSize int32, fetch fetchPage[T]) iter.Seq2[T, error] {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	return func(yield func(T, error) bool) {
+		token := ""
+		for {
+			items, page, err := fetch(ctx, &commonpb.PaginationRequest{PageSize: pageSize, PageToken: token})
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			for _, item := range items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+
+			next := page.GetNextPageToken()
+			// A server echoing the token would otherwise loop forever
+			if next == "" || next == token || len(items) == 0 {
+				return
+			}
+			token = next
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	streamingpb "github.com/narwhalmedia/narwhal/pkg/streaming/v1"
+)
+
+// StreamOptions configure a stream started with StartStream.
+type StreamOptions struct {
+	EpisodeID string
+	Profile   string // such as 1080p, 720p or auto; the server picks if empty
+	Protocol  string // hls or dash
+	Options   map[string]string
+}
+
+// Stream is a stream started by the client.
+type Stream struct {
+	SessionID string
+	Info      *streamingpb.StreamInfo
+}
+
+// ID returns the ID of the stream.
+func (s *Stream) ID() string {
+	return s.Info.GetStreamId()
+}
+
+// ManifestURL returns the URL of the HLS or DASH manifest of the stream,
+// for players fetching it themselves.
+func (s *Stream) ManifestURL() string {
+	return s.Info.GetManifestUrl()
+}
+
+// StartStream starts streaming a media item. Stop it with StopStream when
+// playback ends.
+func (c *Client) StartStream(ctx context.Context, mediaID string, opts StreamOptions) (*Stream, error) {
+	resp, err := c.streaming.CreateStream(ctx, &streamingpb.CreateStreamRequest{
+		MediaId:   mediaID,
+		EpisodeId: opts.EpisodeID,
+		Profile:   opts.Profile,
+		Protocol:  opts.Protocol,
+		Options:   opts.Options,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Stream{SessionID: resp.GetSessionId(), Info: resp.GetStreamInfo()}, nil
+}
+
+// StopStream stops a stream started with StartStream.
+func (c *Client) StopStream(ctx context.Context, stream *Stream) error {
+	_, err := c.streaming.StopStream(ctx, &streamingpb.StopStreamRequest{
+		StreamId:  stream.ID(),
+		SessionId: stream.SessionID,
+	})
+	return err
+}
+
+// CopySegment writes a segment of a stream in a profile to w as its chunks
+// arrive, and returns the number of bytes written.
+func (c *Client) CopySegment(ctx context.Context, w io.Writer, stream *Stream, profileID, segment string) (int64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	chunks, err := c.streaming.GetSegment(ctx, &streamingpb.GetSegmentRequest{
+		StreamId:    stream.ID(),
+		SegmentName: segment,
+		ProfileId:   profileID,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var written int64
+	for {
+		resp, err := chunks.Recv()
+		if errors.Is(err, io.EOF) {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+
+		n, err := w.Write(resp.GetChunk())
+		written += int64(n)
+		if err != nil {
+			return written, fmt.Errorf("failed to write segment %s: %w", segment, err)
+		}
+		if resp.GetIsLast() {
+			return written, nil
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package sdk
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	authpb "github.com/narwhalmedia/narwhal/pkg/auth/v1"
+)
+
+// Tokens are the tokens of a session.
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	// ExpiresAt is when the access token expires; zero if unknown.
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// newTokens returns the tokens of a login or refresh that expire expiresIn
+// seconds after now.
+func newTokens(accessToken, refreshToken string, expiresIn int64, now time.Time) Tokens {
+	tokens := Tokens{AccessToken: accessToken, RefreshToken: refreshToken}
+	if expiresIn > 0 {
+		tokens.ExpiresAt = now.Add(time.Duration(expiresIn) * time.Second)
+	}
+	return tokens
+}
+
+// expiresWithin reports whether the access token expires within d of now.
+func (t Tokens) expiresWithin(now time.Time, d time.Duration) bool {
+	return !t.ExpiresAt.IsZero() && now.Add(d).After(t.ExpiresAt)
+}
+
+// unauthenticatedMethods are called without a token, and never cause a
+// refresh.
+var unauthenticatedMethods = map[string]bool{
+	authpb.AuthService_Login_FullMethodName:        true,
+	authpb.AuthService_RefreshToken_FullMethodName: true,
+}
+
+// tokenSource holds the tokens of a client and adds the access token to
+// its calls, refreshing it before it expires.
+type tokenSource struct {
+	mu     sync.Mutex
+	tokens Tokens
+
+	// refreshMu serializes refreshes, so concurrent calls finding the token
+	// stale refresh it once.
+	refreshMu     sync.Mutex
+	refreshBefore time.Duration
+	refreshFn     func(ctx context.Context, refreshToken string) (Tokens, error)
+	onTokens      func(Tokens)
+}
+
+func newTokenSource(
+	tokens Tokens,
+	refreshBefore time.Duration,
+	onTokens func(Tokens),
+	refreshFn func(ctx context.Context, refreshToken string) (Tokens, error),
+) *tokenSource {
+	return &tokenSource{
+		tokens:        tokens,
+		refreshBefore: refreshBefore,
+		refreshFn:     refreshFn,
+		onTokens:      onTokens,
+	}
+}
+
+func (s *tokenSource) get() Tokens {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens
+}
+
+// set replaces the tokens and tells onTokens.
+func (s *tokenSource) set(tokens Tokens) {
+	s.mu.Lock()
+	s.tokens = tokens
+	s.mu.Unlock()
+
+	if s.onTokens != nil {
+		s.onTokens(tokens)
+	}
+}
+
+// accessToken returns the access token, refreshed first if it expires
+// soon. It is empty if the client is not logged in.
+func (s *tokenSource) accessToken(ctx context.Context) (string, error) {
+	tokens := s.get()
+	if tokens.RefreshToken == "" || !tokens.expiresWithin(time.Now(), s.refreshBefore) {
+		return tokens.AccessToken, nil
+	}
+	tokens, err := s.refresh(ctx, tokens.AccessToken)
+	if err != nil {
+		return "", err
+	}
+	return tokens.AccessToken, nil
+}
+
+// refresh refreshes the tokens if their access token is still stale; a
+// concurrent call may have refreshed them already.
+func (s *tokenSource) refresh(ctx context.Context, stale string) (Tokens, error) {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	tokens := s.get()
+	if tokens.AccessToken != stale {
+		return tokens, nil
+	}
+	if tokens.RefreshToken == "" {
+		return Tokens{}, status.Error(codes.Unauthenticated, "not logged in")
+	}
+
+	tokens, err := s.refreshFn(ctx, tokens.RefreshToken)
+	if err != nil {
+		return Tokens{}, err
+	}
+	s.set(tokens)
+	return tokens, nil
+}
+
+// unaryInterceptor adds the access token to unary calls. A call rejected as
+// unauthenticated, such as after the token was revoked or when the clocks
+// of client and server disagree, is retried once with a refreshed token.
+func (s *tokenSource) unaryInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply interface{},
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	if unauthenticatedMethods[method] {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+
+	token, err := s.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	err = invoker(withToken(ctx, token), method, req, reply, cc, opts...)
+	if status.Code(err) != codes.Unauthenticated || s.get().RefreshToken == "" {
+		return err
+	}
+
+	tokens, refreshErr := s.refresh(ctx, token)
+	if refreshErr != nil {
+		return err
+	}
+	return invoker(withToken(ctx, tokens.AccessToken), method, req, reply, cc, opts...)
+}
+
+// streamInterceptor adds the access token to streaming calls. Streams fail
+// as they are received from, so they are not retried.
+func (s *tokenSource) streamInterceptor(
+	ctx context.Context,
+	desc *grpc.StreamDesc,
+	cc *grpc.ClientConn,
+	method string,
+	streamer grpc.Streamer,
+	opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	if unauthenticatedMethods[method] {
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+
+	token, err := s.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return streamer(withToken(ctx, token), desc, cc, method, opts...)
+}
+
+// withToken adds a bearer token to the outgoing metadata of a call. Calls
+// without a token go out as they are, for the server to reject if they
+// need one.
+func withToken(ctx context.Context, token string) context.Context {
+	if token == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
@@ -0,0 +1,137 @@
+package statemachine
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// ErrInvalidTransition is wrapped by errors returned for transitions the
+// machine does not allow.
+var ErrInvalidTransition = stderrors.New("invalid status transition")
+
+// Transition describes a status change of a single entity.
+type Transition[S ~string] struct {
+	EntityID string
+	From     S
+	To       S
+	Reason   string
+	// LogTail holds the last lines of the log of an entity that failed
+	LogTail string
+}
+
+// Hook is a side effect run when an entity enters a status. A hook error
+// aborts the transition.
+type Hook[S ~string] func(ctx context.Context, t Transition[S]) error
+
+// Machine guards the status of one kind of entity. Only transitions listed
+// in its table are allowed; successful transitions run the hooks registered
+// for the target status and publish an "<entity>.status_changed" event.
+type Machine[S ~string] struct {
+	entity      string
+	transitions map[S]map[S]bool
+	hooks       map[S][]Hook[S]
+	eventBus    interfaces.EventBus
+	logger      interfaces.Logger
+}
+
+// New creates a state machine for entity from a table of allowed
+// transitions. eventBus may be nil, in which case no events are published.
+func New[S ~string](
+	entity string,
+	transitions map[S][]S,
+	eventBus interfaces.EventBus,
+	logger interfaces.Logger,
+) *Machine[S] {
+	table := make(map[S]map[S]bool, len(transitions))
+	for from, targets := range transitions {
+		table[from] = make(map[S]bool, len(targets))
+		for _, to := range targets {
+			table[from][to] = true
+		}
+	}
+
+	return &Machine[S]{
+		entity:      entity,
+		transitions: table,
+		hooks:       make(map[S][]Hook[S]),
+		eventBus:    eventBus,
+		logger:      logger,
+	}
+}
+
+// OnEnter registers a hook run whenever an entity enters status. Hooks must
+// be registered before the machine is used.
+func (m *Machine[S]) OnEnter(status S, hook Hook[S]) {
+	m.hooks[status] = append(m.hooks[status], hook)
+}
+
+// CanTransition reports whether an entity may move from one status to
+// another. Staying in the same status is always allowed.
+func (m *Machine[S]) CanTransition(from, to S) bool {
+	return from == to || m.transitions[from][to]
+}
+
+// Transition moves the status pointed to by current to the target status.
+// Invalid transitions are logged and rejected with a conflict error, leaving
+// current untouched. Transitions to the current status are no-ops.
+func (m *Machine[S]) Transition(ctx context.Context, entityID string, current *S, to S, reason string) error {
+	return m.transition(ctx, current, Transition[S]{EntityID: entityID, To: to, Reason: reason})
+}
+
+// TransitionWithLog is Transition for entities that failed, whose event
+// carries the last lines of their log so that what went wrong shows up in
+// notifications without digging through service logs.
+func (m *Machine[S]) TransitionWithLog(
+	ctx context.Context,
+	entityID string,
+	current *S,
+	to S,
+	reason, logTail string,
+) error {
+	return m.transition(ctx, current, Transition[S]{EntityID: entityID, To: to, Reason: reason, LogTail: logTail})
+}
+
+func (m *Machine[S]) transition(ctx context.Context, current *S, t Transition[S]) error {
+	entityID, to := t.EntityID, t.To
+	from := *current
+	t.From = from
+	if from == to {
+		return nil
+	}
+
+	if !m.CanTransition(from, to) {
+		m.logger.Warn("Rejected invalid status transition",
+			interfaces.String("entity", m.entity),
+			interfaces.String("entity_id", entityID),
+			interfaces.String("from", string(from)),
+			interfaces.String("to", string(to)))
+		return errors.Wrap(errors.ErrorTypeConflict,
+			fmt.Sprintf("%s cannot move from %q to %q", m.entity, from, to), ErrInvalidTransition)
+	}
+
+	for _, hook := range m.hooks[to] {
+		if err := hook(ctx, t); err != nil {
+			return fmt.Errorf("%s transition to %q failed: %w", m.entity, to, err)
+		}
+	}
+	*current = to
+
+	if m.eventBus != nil {
+		payload := map[string]interface{}{
+			"entity_id": entityID,
+			"from":      string(from),
+			"to":        string(to),
+			"reason":    t.Reason,
+		}
+		if t.LogTail != "" {
+			payload["log_tail"] = t.LogTail
+		}
+		m.eventBus.PublishAsync(ctx, events.NewAggregateEvent(m.entity+".status_changed", entityID, payload))
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package statemachine_test
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+	"github.com/narwhalmedia/narwhal/pkg/logger"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+	"github.com/narwhalmedia/narwhal/pkg/statemachine"
+)
+
+type recordingBus struct {
+	interfaces.EventBus
+
+	published []interfaces.Event
+}
+
+func (b *recordingBus) PublishAsync(_ context.Context, event interfaces.Event) {
+	b.published = append(b.published, event)
+}
+
+func TestMachine_Transition(t *testing.T) {
+	bus := &recordingBus{}
+	machine := statemachine.New("download", models.DownloadTransitions, bus, logger.NewNoopLogger())
+	ctx := context.Background()
+
+	var entered []models.DownloadStatus
+	machine.OnEnter(models.DownloadStatusDownloading,
+		func(_ context.Context, tr statemachine.Transition[models.DownloadStatus]) error {
+			entered = append(entered, tr.To)
+			return nil
+		})
+
+	status := models.DownloadStatusQueued
+	require.NoError(t, machine.Transition(ctx, "dl-1", &status, models.DownloadStatusDownloading, "started"))
+	assert.Equal(t, models.DownloadStatusDownloading, status)
+	assert.Equal(t, []models.DownloadStatus{models.DownloadStatusDownloading}, entered)
+
+	require.Len(t, bus.published, 1)
+	assert.Equal(t, "download.status_changed", bus.published[0].EventType())
+	assert.Equal(t, "dl-1", bus.published[0].AggregateID())
+	assert.Equal(t, "queued", events.PayloadOf(bus.published[0])["from"])
+	assert.Equal(t, "downloading", events.PayloadOf(bus.published[0])["to"])
+
+	// Staying in the same status is a no-op
+	require.NoError(t, machine.Transition(ctx, "dl-1", &status, models.DownloadStatusDownloading, ""))
+	assert.Len(t, bus.published, 1)
+}
+
+func TestMachine_InvalidTransition(t *testing.T) {
+	bus := &recordingBus{}
+	machine := statemachine.New("download", models.DownloadTransitions, bus, logger.NewNoopLogger())
+
+	status := models.DownloadStatusCompleted
+	err := machine.Transition(context.Background(), "dl-1", &status, models.DownloadStatusDownloading, "")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, statemachine.ErrInvalidTransition)
+	assert.True(t, errors.IsConflict(err))
+	assert.Equal(t, models.DownloadStatusCompleted, status)
+	assert.Empty(t, bus.published)
+}
+
+func TestMachine_HookAbortsTransition(t *testing.T) {
+	bus := &recordingBus{}
+	machine := statemachine.New("transcode_job", models.TranscodeJobTransitions, bus, logger.NewNoopLogger())
+	machine.OnEnter(models.TranscodeJobStatusRunning,
+		func(context.Context, statemachine.Transition[models.TranscodeJobStatus]) error {
+			return stderrors.New("no workers available")
+		})
+
+	status := models.TranscodeJobStatusQueued
+	err := machine.Transition(context.Background(), "job-1", &status, models.TranscodeJobStatusRunning, "")
+	require.Error(t, err)
+	assert.Equal(t, models.TranscodeJobStatusQueued, status)
+	assert.Empty(t, bus.published)
+
+	assert.True(t, machine.CanTransition(models.TranscodeJobStatusFailed, models.TranscodeJobStatusQueued))
+	assert.False(t, machine.CanTransition(models.TranscodeJobStatusCompleted, models.TranscodeJobStatusQueued))
+}
+
+func TestMachine_TransitionWithLog(t *testing.T) {
+	bus := &recordingBus{}
+	machine := statemachine.New("transcode_job", models.TranscodeJobTransitions, bus, logger.NewNoopLogger())
+
+	var tail string
+	machine.OnEnter(models.TranscodeJobStatusFailed,
+		func(_ context.Context, tr statemachine.Transition[models.TranscodeJobStatus]) error {
+			tail = tr.LogTail
+			return nil
+		})
+
+	status := models.TranscodeJobStatusRunning
+	require.NoError(t, machine.TransitionWithLog(context.Background(), "job-1", &status,
+		models.TranscodeJobStatusFailed, "ffmpeg exited with status 1", "Conversion failed!"))
+	assert.Equal(t, "Conversion failed!", tail)
+	require.Len(t, bus.published, 1)
+	assert.Equal(t, "Conversion failed!", events.PayloadOf(bus.published[0])["log_tail"])
+	assert.Equal(t, "running", events.PayloadOf(bus.published[0])["from"])
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3Config contains the settings of an S3 compatible bucket.
+type S3Config struct {
+	Endpoint        string // e.g. https://s3.eu-west-1.amazonaws.com or a MinIO URL
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// S3Store stores objects in an S3 compatible bucket. Requests use
+// path-style addressing and are signed with AWS Signature Version 4.
+type S3Store struct {
+	cfg     S3Config
+	baseURL string
+	client  *http.Client
+	now     func() time.Time
+}
+
+// NewS3Store creates a store for the bucket whose objects are served at
+// baseURL, such as a CDN in front of the bucket. Without a baseURL objects
+// are served from the bucket itself.
+func NewS3Store(cfg S3Config, baseURL string, client *http.Client) (*S3Store, error) {
+	if cfg.Endpoint == "" || cfg.Region == "" || cfg.Bucket == "" {
+		return nil, errors.New("s3 endpoint, region and bucket are required")
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("s3 credentials are required")
+	}
+	if _, err := url.Parse(cfg.Endpoint); err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+
+	cfg.Endpoint = strings.TrimRight(cfg.Endpoint, "/")
+	if baseURL == "" {
+		baseURL = cfg.Endpoint + "/" + cfg.Bucket
+	}
+	return &S3Store{
+		cfg:     cfg,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  client,
+		now:     time.Now,
+	}, nil
+}
+
+// Put uploads data to the object for key.
+func (s *S3Store) Put(ctx context.Context, key string, data []byte) error {
+	resp, err := s.do(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return fmt.Errorf("failed to write object: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to write object: %s", s3Error(resp))
+	}
+	return nil
+}
+
+// Get downloads the object for key.
+func (s *S3Store) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("failed to read object %s: %w", key, fs.ErrNotExist)
+	default:
+		return nil, fmt.Errorf("failed to read object: %s", s3Error(resp))
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+	return data, nil
+}
+
+// Delete removes the object for key.
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK &&
+		resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("failed to delete object: %s", s3Error(resp))
+	}
+	return nil
+}
+
+// URL returns the public URL for key.
+func (s *S3Store) URL(key string) string {
+	return s.baseURL + "/" + key
+}
+
+func (s *S3Store) do(ctx context.Context, method, key string, body []byte) (*http.Response, error) {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return nil, fmt.Errorf("invalid object key: %q", key)
+	}
+
+	path := EscapePath("/" + s.cfg.Bucket + "/" + key)
+	req, err := http.NewRequestWithContext(ctx, method, s.cfg.Endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	SignV4(req, path, body, AWSCredentials{
+		Region:          s.cfg.Region,
+		Service:         "s3",
+		AccessKeyID:     s.cfg.AccessKeyID,
+		SecretAccessKey: s.cfg.SecretAccessKey,
+	}, s.now())
+	return s.client.Do(req)
+}
+
+// s3Error describes a failed response, including the start of its body,
+// which holds the S3 error code.
+func s3Error(resp *http.Response) string {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Sprintf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
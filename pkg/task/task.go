@@ -0,0 +1,357 @@
+// Package task tracks background work such as scans and cleanups so every
+// operation can be listed, followed and cancelled the same way.
+package task
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	pkgerrors "github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// Status represents the state of a task.
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+// Finished reports whether the task has stopped running.
+func (s Status) Finished() bool {
+	return s == StatusCompleted || s == StatusFailed || s == StatusCancelled
+}
+
+// MaxLogLines is the number of log lines kept per task; older lines are
+// dropped.
+const MaxLogLines = 200
+
+// progressInterval is the minimum time between progress saves.
+const progressInterval = time.Second
+
+// LogLine is a message logged by a task.
+type LogLine struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// Task is a unit of background work.
+type Task struct {
+	ID      uuid.UUID
+	Type    string
+	Payload map[string]string
+	Status  Status
+	// Progress is the fraction of the work done, from 0 to 1.
+	Progress    float64
+	Message     string
+	Logs        []LogLine
+	Error       string
+	CreatedAt   time.Time
+	StartedAt   *time.Time
+	CompletedAt *time.Time
+	UpdatedAt   time.Time
+}
+
+// Filter narrows a task listing. Empty fields match every task.
+type Filter struct {
+	Type   string
+	Status Status
+}
+
+// Store persists tasks so they can be inspected after they finish and from
+// other replicas.
+type Store interface {
+	CreateTask(ctx context.Context, t *Task) error
+	UpdateTask(ctx context.Context, t *Task) error
+	GetTask(ctx context.Context, id uuid.UUID) (*Task, error)
+	// ListTasks lists tasks, newest first.
+	ListTasks(ctx context.Context, filter Filter, limit, offset int) ([]*Task, error)
+	// InterruptTasks fails every task that is still pending or running.
+	InterruptTasks(ctx context.Context, reason string) (int, error)
+}
+
+// Func is the work of a task. It should return once ctx is cancelled and
+// can report progress with SetProgress and Log.
+type Func func(ctx context.Context) error
+
+// Manager runs tasks and records their progress.
+type Manager struct {
+	store  Store
+	logger interfaces.Logger
+
+	mu      sync.Mutex
+	running map[uuid.UUID]*run
+	wg      sync.WaitGroup
+
+	// ctx is cancelled by Stop to interrupt running tasks
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// run is a task running in this process.
+type run struct {
+	mu        sync.Mutex
+	task      *Task
+	cancel    context.CancelFunc
+	cancelled bool
+	savedAt   time.Time
+	store     Store
+	logger    interfaces.Logger
+}
+
+// NewManager creates a task manager.
+func NewManager(store Store, logger interfaces.Logger) *Manager {
+	m := &Manager{
+		store:   store,
+		logger:  logger,
+		running: make(map[uuid.UUID]*run),
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	return m
+}
+
+// Recover fails the tasks a previous process left unfinished. It should be
+// called on startup, before any task is submitted.
+func (m *Manager) Recover(ctx context.Context) (int, error) {
+	return m.store.InterruptTasks(ctx, "interrupted by restart")
+}
+
+// Submit records a task and runs it in the background. The task's context
+// carries the values of ctx but is only cancelled by Cancel and Stop.
+func (m *Manager) Submit(ctx context.Context, taskType string, payload map[string]string, fn Func) (*Task, error) {
+	r, runCtx, err := m.start(ctx, taskType, payload)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := r.snapshot()
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.finish(runCtx, r, fn(runCtx))
+	}()
+
+	return snapshot, nil
+}
+
+// Run records a task and runs it in the calling goroutine. The task is also
+// cancelled when ctx is.
+func (m *Manager) Run(ctx context.Context, taskType string, payload map[string]string, fn Func) error {
+	r, runCtx, err := m.start(ctx, taskType, payload)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, r.cancel)
+	defer stop()
+
+	m.wg.Add(1)
+	defer m.wg.Done()
+	err = fn(runCtx)
+	m.finish(runCtx, r, err)
+	return err
+}
+
+// Get retrieves a task.
+func (m *Manager) Get(ctx context.Context, id uuid.UUID) (*Task, error) {
+	m.mu.Lock()
+	r, ok := m.running[id]
+	m.mu.Unlock()
+	if ok {
+		return r.snapshot(), nil
+	}
+	return m.store.GetTask(ctx, id)
+}
+
+// List lists tasks, newest first.
+func (m *Manager) List(ctx context.Context, filter Filter, limit, offset int) ([]*Task, error) {
+	return m.store.ListTasks(ctx, filter, limit, offset)
+}
+
+// Cancel asks a running task to stop. Tasks left unfinished by another
+// process are marked cancelled right away.
+func (m *Manager) Cancel(ctx context.Context, id uuid.UUID) (*Task, error) {
+	m.mu.Lock()
+	r, ok := m.running[id]
+	m.mu.Unlock()
+	if ok {
+		r.mu.Lock()
+		r.cancelled = true
+		r.mu.Unlock()
+		r.cancel()
+		return r.snapshot(), nil
+	}
+
+	t, err := m.store.GetTask(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if t.Status.Finished() {
+		return nil, pkgerrors.Conflict("task already finished")
+	}
+
+	now := time.Now()
+	t.Status = StatusCancelled
+	t.CompletedAt = &now
+	t.UpdatedAt = now
+	if err := m.store.UpdateTask(ctx, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Stop cancels running tasks and waits for them to finish.
+func (m *Manager) Stop() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// start records a task and derives the context it runs with. The context
+// keeps the values of ctx, such as the tenant, and is cancelled by Cancel
+// and Stop.
+func (m *Manager) start(
+	ctx context.Context,
+	taskType string,
+	payload map[string]string,
+) (*run, context.Context, error) {
+	now := time.Now()
+	t := &Task{
+		ID:        uuid.New(),
+		Type:      taskType,
+		Payload:   payload,
+		Status:    StatusRunning,
+		CreatedAt: now,
+		StartedAt: &now,
+		UpdatedAt: now,
+	}
+	if err := m.store.CreateTask(ctx, t); err != nil {
+		return nil, nil, err
+	}
+
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(m.ctx, cancel)
+	r := &run{
+		task: t,
+		cancel: func() {
+			stop()
+			cancel()
+		},
+		savedAt: now,
+		store:   m.store,
+		logger:  m.logger,
+	}
+
+	m.mu.Lock()
+	m.running[t.ID] = r
+	m.mu.Unlock()
+
+	m.logger.Info("Task started",
+		interfaces.String("task_id", t.ID.String()),
+		interfaces.String("type", taskType))
+	return r, context.WithValue(runCtx, runKey{}, r), nil
+}
+
+func (m *Manager) finish(ctx context.Context, r *run, err error) {
+	m.mu.Lock()
+	delete(m.running, r.task.ID)
+	m.mu.Unlock()
+
+	r.mu.Lock()
+	now := time.Now()
+	switch {
+	case r.cancelled:
+		r.task.Status = StatusCancelled
+	case ctx.Err() != nil:
+		r.task.Status = StatusCancelled
+		if m.ctx.Err() != nil {
+			r.task.Error = "service stopped"
+		}
+	case err != nil:
+		r.task.Status = StatusFailed
+		r.task.Error = err.Error()
+	default:
+		r.task.Status = StatusCompleted
+		r.task.Progress = 1
+	}
+	r.task.CompletedAt = &now
+	r.task.UpdatedAt = now
+	r.mu.Unlock()
+
+	r.cancel()
+	r.save(context.WithoutCancel(ctx))
+
+	m.logger.Info("Task finished",
+		interfaces.String("task_id", r.task.ID.String()),
+		interfaces.String("type", r.task.Type),
+		interfaces.String("status", string(r.task.Status)))
+}
+
+func (r *run) snapshot() *Task {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := *r.task
+	t.Logs = append([]LogLine(nil), r.task.Logs...)
+	return &t
+}
+
+func (r *run) save(ctx context.Context) {
+	t := r.snapshot()
+	if err := r.store.UpdateTask(ctx, t); err != nil {
+		r.logger.Warn("Failed to save task",
+			interfaces.String("task_id", t.ID.String()),
+			interfaces.Error(err))
+	}
+}
+
+type runKey struct{}
+
+// SetProgress records the progress of the task running with ctx. Progress
+// is saved at most once a second. It does nothing outside a task.
+func SetProgress(ctx context.Context, progress float64, message string) {
+	r, ok := ctx.Value(runKey{}).(*run)
+	if !ok {
+		return
+	}
+
+	r.mu.Lock()
+	r.task.Progress = min(max(progress, 0), 1)
+	r.task.Message = message
+	now := time.Now()
+	r.task.UpdatedAt = now
+	due := now.Sub(r.savedAt) >= progressInterval
+	if due {
+		r.savedAt = now
+	}
+	r.mu.Unlock()
+
+	if due {
+		r.save(context.WithoutCancel(ctx))
+	}
+}
+
+// Log appends a line to the log of the task running with ctx. It does
+// nothing outside a task.
+func Log(ctx context.Context, message string) {
+	r, ok := ctx.Value(runKey{}).(*run)
+	if !ok {
+		return
+	}
+
+	r.mu.Lock()
+	now := time.Now()
+	r.task.Logs = append(r.task.Logs, LogLine{Time: now, Message: message})
+	if len(r.task.Logs) > MaxLogLines {
+		r.task.Logs = r.task.Logs[len(r.task.Logs)-MaxLogLines:]
+	}
+	r.task.UpdatedAt = now
+	r.savedAt = now
+	r.mu.Unlock()
+
+	r.save(context.WithoutCancel(ctx))
+}
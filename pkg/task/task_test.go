@@ -0,0 +1,167 @@
+package task_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pkgerrors "github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/logger"
+	"github.com/narwhalmedia/narwhal/pkg/task"
+)
+
+type memoryStore struct {
+	mu    sync.Mutex
+	tasks map[uuid.UUID]task.Task
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{tasks: make(map[uuid.UUID]task.Task)}
+}
+
+func (s *memoryStore) CreateTask(_ context.Context, t *task.Task) error {
+	return s.UpdateTask(context.Background(), t)
+}
+
+func (s *memoryStore) UpdateTask(_ context.Context, t *task.Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks[t.ID] = *t
+	return nil
+}
+
+func (s *memoryStore) GetTask(_ context.Context, id uuid.UUID) (*task.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tasks[id]
+	if !ok {
+		return nil, pkgerrors.NotFound("task not found")
+	}
+	return &t, nil
+}
+
+func (s *memoryStore) ListTasks(_ context.Context, filter task.Filter, _, _ int) ([]*task.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tasks []*task.Task
+	for _, t := range s.tasks {
+		if (filter.Type == "" || t.Type == filter.Type) && (filter.Status == "" || t.Status == filter.Status) {
+			tasks = append(tasks, &t)
+		}
+	}
+	return tasks, nil
+}
+
+func (s *memoryStore) InterruptTasks(_ context.Context, reason string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for id, t := range s.tasks {
+		if !t.Status.Finished() {
+			t.Status = task.StatusFailed
+			t.Error = reason
+			s.tasks[id] = t
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *memoryStore) waitFor(t *testing.T, id uuid.UUID, status task.Status) *task.Task {
+	t.Helper()
+	var got *task.Task
+	require.Eventually(t, func() bool {
+		got, _ = s.GetTask(context.Background(), id)
+		return got != nil && got.Status == status
+	}, time.Second, 5*time.Millisecond)
+	return got
+}
+
+func TestManager_Submit(t *testing.T) {
+	store := newMemoryStore()
+	manager := task.NewManager(store, logger.NewNoopLogger())
+	defer manager.Stop()
+
+	submitted, err := manager.Submit(context.Background(), "library.scan", map[string]string{"library_id": "1"},
+		func(ctx context.Context) error {
+			task.SetProgress(ctx, 0.5, "halfway")
+			task.Log(ctx, "found 10 files")
+			return nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, task.StatusRunning, submitted.Status)
+
+	done := store.waitFor(t, submitted.ID, task.StatusCompleted)
+	assert.InDelta(t, 1, done.Progress, 0)
+	assert.Equal(t, "halfway", done.Message)
+	require.Len(t, done.Logs, 1)
+	assert.Equal(t, "found 10 files", done.Logs[0].Message)
+	assert.NotNil(t, done.CompletedAt)
+}
+
+func TestManager_Failure(t *testing.T) {
+	store := newMemoryStore()
+	manager := task.NewManager(store, logger.NewNoopLogger())
+
+	err := manager.Run(context.Background(), "workflow.archive", nil, func(context.Context) error {
+		return errors.New("database unavailable")
+	})
+	require.Error(t, err)
+
+	tasks, err := manager.List(context.Background(), task.Filter{Status: task.StatusFailed}, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	assert.Equal(t, "database unavailable", tasks[0].Error)
+}
+
+func TestManager_Cancel(t *testing.T) {
+	store := newMemoryStore()
+	manager := task.NewManager(store, logger.NewNoopLogger())
+	defer manager.Stop()
+
+	started := make(chan struct{})
+	submitted, err := manager.Submit(context.Background(), "library.scan", nil, func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return nil
+	})
+	require.NoError(t, err)
+	<-started
+
+	_, err = manager.Cancel(context.Background(), submitted.ID)
+	require.NoError(t, err)
+	store.waitFor(t, submitted.ID, task.StatusCancelled)
+
+	_, err = manager.Cancel(context.Background(), submitted.ID)
+	assert.True(t, pkgerrors.IsConflict(err))
+}
+
+func TestManager_StopAndRecover(t *testing.T) {
+	store := newMemoryStore()
+	manager := task.NewManager(store, logger.NewNoopLogger())
+
+	submitted, err := manager.Submit(context.Background(), "library.scan", nil, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	require.NoError(t, err)
+
+	manager.Stop()
+	stopped, err := store.GetTask(context.Background(), submitted.ID)
+	require.NoError(t, err)
+	assert.Equal(t, task.StatusCancelled, stopped.Status)
+	assert.Equal(t, "service stopped", stopped.Error)
+
+	orphan := &task.Task{ID: uuid.New(), Type: "library.scan", Status: task.StatusRunning}
+	require.NoError(t, store.CreateTask(context.Background(), orphan))
+
+	n, err := task.NewManager(store, logger.NewNoopLogger()).Recover(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
@@ -0,0 +1,113 @@
+package tenant
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// FieldName is the struct field that marks a model as tenant-owned.
+const FieldName = "TenantID"
+
+// ErrCrossTenantWrite is returned when a row is created for a tenant other
+// than the one in the statement context.
+var ErrCrossTenantWrite = errors.New("tenant: row belongs to a different tenant")
+
+// ScopePlugin is a GORM plugin that transparently restricts queries on
+// tenant-owned models to the tenant found in the statement context, and
+// stamps that tenant on newly created rows.
+type ScopePlugin struct{}
+
+// NewScopePlugin creates a new tenant scope plugin.
+func NewScopePlugin() *ScopePlugin {
+	return &ScopePlugin{}
+}
+
+// Name implements gorm.Plugin.
+func (p *ScopePlugin) Name() string {
+	return "narwhal:tenant_scope"
+}
+
+// Initialize implements gorm.Plugin.
+func (p *ScopePlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+
+	if err := cb.Create().Before("gorm:create").Register("tenant:assign", assignTenant); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("gorm:query").Register("tenant:scope_query", scopeTenant); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("tenant:scope_update", scopeTenant); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("tenant:scope_delete", scopeTenant); err != nil {
+		return err
+	}
+	return cb.Row().Before("gorm:row").Register("tenant:scope_row", scopeTenant)
+}
+
+// tenantField returns the tenant field of the statement's model, if any.
+func tenantField(db *gorm.DB) *schema.Field {
+	if db.Statement == nil || db.Statement.Schema == nil {
+		return nil
+	}
+	return db.Statement.Schema.LookUpField(FieldName)
+}
+
+func scopeTenant(db *gorm.DB) {
+	field := tenantField(db)
+	if field == nil {
+		return
+	}
+
+	id, ok := FromContext(db.Statement.Context)
+	if !ok {
+		return
+	}
+
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{
+			Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName},
+			Value:  id,
+		},
+	}})
+}
+
+func assignTenant(db *gorm.DB) {
+	field := tenantField(db)
+	if field == nil {
+		return
+	}
+
+	id, ok := FromContext(db.Statement.Context)
+	if !ok {
+		return
+	}
+
+	rv := db.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			setTenant(db, field, reflect.Indirect(rv.Index(i)), id)
+		}
+	case reflect.Struct:
+		setTenant(db, field, rv, id)
+	}
+}
+
+func setTenant(db *gorm.DB, field *schema.Field, rv reflect.Value, id uuid.UUID) {
+	if current, zero := field.ValueOf(db.Statement.Context, rv); !zero {
+		if current != id {
+			_ = db.AddError(ErrCrossTenantWrite)
+		}
+		return
+	}
+	if err := field.Set(db.Statement.Context, rv, id); err != nil {
+		_ = db.AddError(err)
+	}
+}
@@ -0,0 +1,104 @@
+package tenant_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+
+	"github.com/narwhalmedia/narwhal/pkg/tenant"
+)
+
+type scopedModel struct {
+	ID       uuid.UUID
+	TenantID uuid.UUID
+	Name     string
+}
+
+type globalModel struct {
+	ID   uuid.UUID
+	Name string
+}
+
+type ScopePluginTestSuite struct {
+	suite.Suite
+
+	db *gorm.DB
+}
+
+func (suite *ScopePluginTestSuite) SetupTest() {
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+	suite.Require().NoError(err)
+	suite.Require().NoError(db.Use(tenant.NewScopePlugin()))
+	suite.db = db
+}
+
+func (suite *ScopePluginTestSuite) TestQueryScopedToContextTenant() {
+	tenantID := uuid.New()
+	ctx := tenant.WithTenantID(context.Background(), tenantID)
+
+	var rows []scopedModel
+	stmt := suite.db.WithContext(ctx).Where("name = ?", "a").Find(&rows).Statement
+
+	suite.Contains(stmt.SQL.String(), "tenant_id")
+	suite.Contains(stmt.Vars, tenantID)
+}
+
+func (suite *ScopePluginTestSuite) TestQueryWithoutTenantIsUnscoped() {
+	var rows []scopedModel
+	stmt := suite.db.WithContext(context.Background()).Find(&rows).Statement
+
+	suite.NotContains(stmt.SQL.String(), "tenant_id")
+}
+
+func (suite *ScopePluginTestSuite) TestGlobalModelIsUnscoped() {
+	ctx := tenant.WithTenantID(context.Background(), uuid.New())
+
+	var rows []globalModel
+	stmt := suite.db.WithContext(ctx).Find(&rows).Statement
+
+	suite.NotContains(stmt.SQL.String(), "tenant_id")
+}
+
+func (suite *ScopePluginTestSuite) TestDeleteScopedToContextTenant() {
+	tenantID := uuid.New()
+	ctx := tenant.WithTenantID(context.Background(), tenantID)
+
+	stmt := suite.db.WithContext(ctx).Delete(&scopedModel{}, "id = ?", uuid.New()).Statement
+
+	suite.Contains(stmt.SQL.String(), "tenant_id")
+	suite.Contains(stmt.Vars, tenantID)
+}
+
+func (suite *ScopePluginTestSuite) TestCreateAssignsTenant() {
+	tenantID := uuid.New()
+	ctx := tenant.WithTenantID(context.Background(), tenantID)
+
+	row := &scopedModel{ID: uuid.New(), Name: "a"}
+	suite.Require().NoError(suite.db.WithContext(ctx).Create(row).Error)
+
+	suite.Equal(tenantID, row.TenantID)
+}
+
+func (suite *ScopePluginTestSuite) TestCreateRejectsCrossTenantRow() {
+	ctx := tenant.WithTenantID(context.Background(), uuid.New())
+
+	row := &scopedModel{ID: uuid.New(), TenantID: uuid.New(), Name: "a"}
+	err := suite.db.WithContext(ctx).Create(row).Error
+
+	suite.ErrorIs(err, tenant.ErrCrossTenantWrite)
+}
+
+func (suite *ScopePluginTestSuite) TestQuotas() {
+	suite.True(tenant.Quotas{}.AllowsUsers(1000))
+	suite.True(tenant.Quotas{MaxUsers: 2}.AllowsUsers(1))
+	suite.False(tenant.Quotas{MaxUsers: 2}.AllowsUsers(2))
+	suite.False(tenant.Quotas{MaxLibraries: 1}.AllowsLibraries(1))
+}
+
+func TestScopePluginTestSuite(t *testing.T) {
+	suite.Run(t, new(ScopePluginTestSuite))
+}
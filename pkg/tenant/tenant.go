@@ -0,0 +1,54 @@
+// Package tenant provides tenant context propagation and tenant-scoped data access.
+package tenant
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// DefaultID is the tenant that owns data on single-household installs and
+// rows created before multi-tenancy was introduced.
+var DefaultID = uuid.Nil
+
+type contextKey struct{}
+
+// WithTenantID returns a copy of ctx scoped to the given tenant.
+func WithTenantID(ctx context.Context, id uuid.UUID) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the tenant ID carried by ctx, if any.
+func FromContext(ctx context.Context) (uuid.UUID, bool) {
+	if ctx == nil {
+		return uuid.Nil, false
+	}
+	id, ok := ctx.Value(contextKey{}).(uuid.UUID)
+	return id, ok
+}
+
+// Quotas holds per-tenant resource limits. Zero means unlimited.
+type Quotas struct {
+	MaxUsers          int
+	MaxLibraries      int
+	MaxStorageBytes   int64
+	MaxActiveStreams  int
+	MaxDownloadsQueue int
+}
+
+// Settings holds per-tenant configuration overrides.
+type Settings struct {
+	DefaultLanguage   string `gorm:"default:'en'"`
+	AllowRegistration bool   `gorm:"default:false"`
+	MaxStreamQuality  string `gorm:"default:'auto'"`
+}
+
+// AllowsUsers reports whether a tenant with count users may add another.
+func (q Quotas) AllowsUsers(count int64) bool {
+	return q.MaxUsers <= 0 || count < int64(q.MaxUsers)
+}
+
+// AllowsLibraries reports whether a tenant with count libraries may add another.
+func (q Quotas) AllowsLibraries(count int) bool {
+	return q.MaxLibraries <= 0 || count < q.MaxLibraries
+}
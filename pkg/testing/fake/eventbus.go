@@ -0,0 +1,114 @@
+package fake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/interfaces"
+)
+
+// EventBus records every published event in its envelope and delivers it
+// synchronously, returning the errors of the handlers, so tests see
+// failures the in-memory bus only logs.
+type EventBus struct {
+	mu        sync.Mutex
+	handlers  map[string][]interfaces.EventHandler
+	published []*events.Envelope
+}
+
+// NewEventBus creates a bus without subscribers.
+func NewEventBus() *EventBus {
+	return &EventBus{handlers: make(map[string][]interfaces.EventHandler)}
+}
+
+// Publish records the event and hands it to its subscribers.
+func (b *EventBus) Publish(ctx context.Context, event interfaces.Event) error {
+	env, err := events.Wrap(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.published = append(b.published, env)
+	handlers := append([]interfaces.EventHandler(nil), b.handlers[env.Type]...)
+	b.mu.Unlock()
+
+	var errs []error
+	for _, handler := range handlers {
+		if err := handler.Handle(ctx, env); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", handler.EventType(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// PublishAsync publishes the event synchronously, so it is recorded when
+// the call returns. Handler errors are dropped, as with any bus.
+func (b *EventBus) PublishAsync(ctx context.Context, event interfaces.Event) {
+	_ = b.Publish(ctx, event)
+}
+
+// Subscribe registers a handler for an event type.
+func (b *EventBus) Subscribe(eventType string, handler interfaces.EventHandler) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], handler)
+	return nil
+}
+
+// Unsubscribe removes a handler of an event type.
+func (b *EventBus) Unsubscribe(eventType string, handler interfaces.EventHandler) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	handlers := b.handlers[eventType]
+	for i, h := range handlers {
+		if h == handler {
+			b.handlers[eventType] = append(handlers[:i:i], handlers[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Start does nothing.
+func (b *EventBus) Start(context.Context) error { return nil }
+
+// Stop does nothing.
+func (b *EventBus) Stop() error { return nil }
+
+// Subscribed reports whether a handler is subscribed to an event type.
+func (b *EventBus) Subscribed(eventType string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.handlers[eventType]) > 0
+}
+
+// Published returns the envelopes of the events published so far.
+func (b *EventBus) Published() []*events.Envelope {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*events.Envelope(nil), b.published...)
+}
+
+// Events returns the envelopes of the events of a type published so far.
+func (b *EventBus) Events(eventType string) []*events.Envelope {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var matched []*events.Envelope
+	for _, env := range b.published {
+		if env.Type == eventType {
+			matched = append(matched, env)
+		}
+	}
+	return matched
+}
+
+// Reset forgets the events published so far. Subscribers are kept.
+func (b *EventBus) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.published = nil
+}
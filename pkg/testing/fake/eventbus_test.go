@@ -0,0 +1,40 @@
+package fake_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/pkg/events"
+	"github.com/narwhalmedia/narwhal/pkg/testing/fake"
+)
+
+func TestEventBus_DeliversSynchronously(t *testing.T) {
+	bus := fake.NewEventBus()
+	var handled []string
+	require.NoError(t, bus.Subscribe("media.added", events.NewConsumer("indexer", 1, func(_ context.Context, env *events.Envelope) error {
+		handled = append(handled, env.Type)
+		return nil
+	})))
+	require.NoError(t, bus.Subscribe("media.deleted", events.NewConsumer("cleaner", 1, func(context.Context, *events.Envelope) error {
+		return errors.New("disk full")
+	})))
+	ctx := context.Background()
+
+	require.NoError(t, bus.Publish(ctx, events.NewAggregateEvent("media.added", "m1", nil)))
+	err := bus.Publish(ctx, events.NewAggregateEvent("media.deleted", "m1", nil))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "disk full")
+	bus.PublishAsync(ctx, events.NewAggregateEvent("media.added", "m2", nil))
+
+	assert.Equal(t, []string{"media.added", "media.added"}, handled)
+	assert.Len(t, bus.Published(), 3)
+	assert.Len(t, bus.Events("media.deleted"), 1)
+
+	bus.Reset()
+	assert.Empty(t, bus.Published())
+	assert.True(t, bus.Subscribed("media.added"))
+}
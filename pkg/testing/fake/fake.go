@@ -0,0 +1,68 @@
+// Package fake provides in-memory implementations of the repositories and
+// the event bus for unit tests.
+//
+// The repositories keep their records in maps and follow the filters,
+// ordering and pagination of the GORM repositories, so a service test can
+// seed state and assert on it instead of scripting every call with mocks.
+// Records keep the IDs they are created with; missing IDs and timestamps
+// are assigned as the database would. Records are copied in and out, so
+// changing a returned record does not change the stored one until it is
+// saved.
+package fake
+
+import (
+	"maps"
+	"sort"
+	"time"
+)
+
+// clone returns a shallow copy of a record.
+func clone[T any](v *T) *T {
+	c := *v
+	return &c
+}
+
+// page returns a page of a listing with the LIMIT and OFFSET semantics of
+// the database: a negative limit does not limit the page.
+func page[T any](items []T, limit, offset int) []T {
+	if offset > 0 {
+		if offset >= len(items) {
+			return items[:0]
+		}
+		items = items[offset:]
+	}
+	if limit >= 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
+
+// collect returns copies of the records of m that keep accepts, sorted by
+// less. A nil keep accepts every record.
+func collect[K comparable, T any](m map[K]*T, keep func(*T) bool, less func(a, b *T) bool) []*T {
+	items := make([]*T, 0, len(m))
+	for _, v := range m {
+		if keep == nil || keep(v) {
+			items = append(items, clone(v))
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool { return less(items[i], items[j]) })
+	return items
+}
+
+// stamp sets a zero creation time to now.
+func stamp(t *time.Time, now time.Time) {
+	if t.IsZero() {
+		*t = now
+	}
+}
+
+// copyMap returns a map of the same records, so a transaction can add and
+// remove records without touching the maps it started from. Records are
+// never changed in place, only replaced.
+func copyMap[K comparable, V any](m map[K]V) map[K]V {
+	if m == nil {
+		return make(map[K]V)
+	}
+	return maps.Clone(m)
+}
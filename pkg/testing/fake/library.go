@@ -0,0 +1,3357 @@
+package fake
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"maps"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/internal/library/repository"
+	pkgerrors "github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+	"github.com/narwhalmedia/narwhal/pkg/saga"
+	"github.com/narwhalmedia/narwhal/pkg/task"
+)
+
+var errNoTransaction = errors.New("not in a transaction")
+
+// LibraryRepository is an in-memory repository of the library service.
+type LibraryRepository struct {
+	mu    sync.Mutex
+	state *libraryState
+	// parent is the repository a transaction commits to.
+	parent *LibraryRepository
+}
+
+var _ repository.Repository = (*LibraryRepository)(nil)
+
+type watchlistKey struct {
+	userID, mediaID uuid.UUID
+}
+
+type transcodeKey struct {
+	mediaID uuid.UUID
+	key     string
+}
+
+type transcodeOutputKey struct {
+	sourceHash, profileHash string
+}
+
+// searchDocument is the search index entry of a media item.
+type searchDocument struct {
+	words     map[string]bool
+	updatedAt time.Time
+}
+
+type libraryState struct {
+	libraries       map[uuid.UUID]*domain.Library
+	media           map[uuid.UUID]*models.Media
+	episodes        map[uuid.UUID]*models.Episode
+	episodeFiles    map[uuid.UUID][]*models.EpisodeFile // by episode
+	scans           map[uuid.UUID]*domain.ScanResult
+	manifests       map[uuid.UUID]domain.ScanManifest
+	providers       map[uuid.UUID]*domain.MetadataProviderConfig
+	watchStates     map[uuid.UUID]*models.WatchHistory
+	watchlist       map[watchlistKey]*domain.WatchlistEntry
+	workflows       map[uuid.UUID]*saga.Workflow
+	workflowHistory map[uuid.UUID]*saga.Workflow
+	policies        map[uuid.UUID]*domain.TranscodePolicy
+	transcodes      map[transcodeKey]*domain.TranscodeRequest
+	outputs         map[transcodeOutputKey]*domain.TranscodeOutput
+	loudness        map[string]*domain.LoudnessMeasurement
+	tasks           map[uuid.UUID]*task.Task
+	searchIndex     map[uuid.UUID]*searchDocument
+	storage         map[uuid.UUID][]*domain.StorageUsage
+	hookStates      map[string]bool
+	hookRuns        map[uuid.UUID]*domain.HookRun
+	poolSizes       map[string]int
+	feeds           map[uuid.UUID]*domain.Feed
+	grabs           map[string]*domain.FeedGrab
+	feedKeys        map[uuid.UUID]*domain.CalendarFeedKey
+	blocklist       map[uuid.UUID]*domain.BlocklistEntry
+	manualImports   map[uuid.UUID]*domain.ManualImport
+	playbackIssues  map[uuid.UUID]*domain.PlaybackIssue
+	playbackFlags   map[uuid.UUID]*domain.PlaybackFlag
+	shareLinks      map[uuid.UUID]*domain.ShareLink
+	shareLinkPlays  map[uuid.UUID]*domain.ShareLinkPlay
+	requests        map[uuid.UUID]*domain.ContentRequest
+	quotaOverrides  map[uuid.UUID]*domain.RequestQuotaOverride
+	issues          map[uuid.UUID]*domain.MediaIssue
+	kiosks          map[uuid.UUID]*domain.Kiosk
+	viewings        map[uuid.UUID]*domain.Viewing
+}
+
+func (s *libraryState) copy() *libraryState {
+	return &libraryState{
+		libraries:       copyMap(s.libraries),
+		media:           copyMap(s.media),
+		episodes:        copyMap(s.episodes),
+		episodeFiles:    copyMap(s.episodeFiles),
+		scans:           copyMap(s.scans),
+		manifests:       copyMap(s.manifests),
+		providers:       copyMap(s.providers),
+		watchStates:     copyMap(s.watchStates),
+		watchlist:       copyMap(s.watchlist),
+		workflows:       copyMap(s.workflows),
+		workflowHistory: copyMap(s.workflowHistory),
+		policies:        copyMap(s.policies),
+		transcodes:      copyMap(s.transcodes),
+		outputs:         copyMap(s.outputs),
+		loudness:        copyMap(s.loudness),
+		tasks:           copyMap(s.tasks),
+		searchIndex:     copyMap(s.searchIndex),
+		storage:         copyMap(s.storage),
+		hookStates:      copyMap(s.hookStates),
+		hookRuns:        copyMap(s.hookRuns),
+		poolSizes:       copyMap(s.poolSizes),
+		feeds:           copyMap(s.feeds),
+		grabs:           copyMap(s.grabs),
+		feedKeys:        copyMap(s.feedKeys),
+		blocklist:       copyMap(s.blocklist),
+		manualImports:   copyMap(s.manualImports),
+		playbackIssues:  copyMap(s.playbackIssues),
+		playbackFlags:   copyMap(s.playbackFlags),
+		shareLinks:      copyMap(s.shareLinks),
+		shareLinkPlays:  copyMap(s.shareLinkPlays),
+		requests:        copyMap(s.requests),
+		quotaOverrides:  copyMap(s.quotaOverrides),
+		issues:          copyMap(s.issues),
+		kiosks:          copyMap(s.kiosks),
+		viewings:        copyMap(s.viewings),
+	}
+}
+
+// NewLibraryRepository creates an empty library repository.
+func NewLibraryRepository() *LibraryRepository {
+	return &LibraryRepository{state: (&libraryState{}).copy()}
+}
+
+// BeginTx starts a transaction on a copy of the records. Committing it
+// replaces the records of the repository, including changes made outside
+// the transaction since it started.
+func (r *LibraryRepository) BeginTx(context.Context) (repository.Repository, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &LibraryRepository{state: r.state.copy(), parent: r}, nil
+}
+
+// Commit applies the changes of a transaction.
+func (r *LibraryRepository) Commit() error {
+	if r.parent == nil {
+		return errNoTransaction
+	}
+	r.mu.Lock()
+	state := r.state
+	r.mu.Unlock()
+
+	r.parent.mu.Lock()
+	r.parent.state = state
+	r.parent.mu.Unlock()
+	r.parent = nil
+	return nil
+}
+
+// Rollback discards the changes of a transaction.
+func (r *LibraryRepository) Rollback() error {
+	if r.parent == nil {
+		return errNoTransaction
+	}
+	r.parent = nil
+	return nil
+}
+
+// Libraries
+
+func cloneLibrary(l *domain.Library) *domain.Library {
+	c := clone(l)
+	c.ExcludePatterns = slices.Clone(l.ExcludePatterns)
+	return c
+}
+
+// CreateLibrary creates a library. Names and paths are unique.
+func (r *LibraryRepository) CreateLibrary(_ context.Context, library *domain.Library) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, l := range r.state.libraries {
+		if l.Name == library.Name || l.Path == library.Path {
+			return pkgerrors.Conflict("library name or path already exists")
+		}
+	}
+
+	if library.ID == uuid.Nil {
+		library.ID = uuid.New()
+	}
+	if library.ExtrasMode == "" {
+		library.ExtrasMode = domain.ExtrasModeSkip
+	}
+	if library.MetadataPreferences.TitleStyle == "" {
+		library.MetadataPreferences.TitleStyle = domain.TitleStyleTranslated
+	}
+	now := time.Now()
+	stamp(&library.CreatedAt, now)
+	stamp(&library.UpdatedAt, now)
+
+	r.state.libraries[library.ID] = cloneLibrary(library)
+	return nil
+}
+
+// GetLibrary retrieves a library by ID.
+func (r *LibraryRepository) GetLibrary(_ context.Context, id uuid.UUID) (*domain.Library, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	l, ok := r.state.libraries[id]
+	if !ok {
+		return nil, pkgerrors.NotFound("library not found")
+	}
+	return cloneLibrary(l), nil
+}
+
+// GetLibraryByPath retrieves a library by path.
+func (r *LibraryRepository) GetLibraryByPath(_ context.Context, path string) (*domain.Library, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, l := range r.state.libraries {
+		if l.Path == path {
+			return cloneLibrary(l), nil
+		}
+	}
+	return nil, pkgerrors.NotFound("library not found")
+}
+
+// UpdateLibrary updates the settings of a library. Its type is kept, as
+// are its extras mode and title style when they are empty.
+func (r *LibraryRepository) UpdateLibrary(_ context.Context, library *domain.Library) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.state.libraries[library.ID]
+	if !ok {
+		return pkgerrors.NotFound("library not found")
+	}
+
+	l := cloneLibrary(stored)
+	l.Name = library.Name
+	l.Path = library.Path
+	l.Enabled = library.Enabled
+	l.ScanInterval = library.ScanInterval
+	l.ExcludePatterns = slices.Clone(library.ExcludePatterns)
+	l.QualityCutoff = library.QualityCutoff
+	l.MetadataPreferences.Language = library.MetadataPreferences.Language
+	l.MetadataPreferences.Region = library.MetadataPreferences.Region
+	l.Anime = library.Anime
+	l.IgnoreExtrasFolders = library.IgnoreExtrasFolders
+	l.FolderProfile = library.FolderProfile
+	l.Naming = library.Naming
+	l.AudioNormalization = library.AudioNormalization
+	if library.ExtrasMode != "" {
+		l.ExtrasMode = library.ExtrasMode
+	}
+	if library.MetadataPreferences.TitleStyle != "" {
+		l.MetadataPreferences.TitleStyle = library.MetadataPreferences.TitleStyle
+	}
+	if library.LastScanAt != nil && !library.LastScanAt.IsZero() {
+		l.LastScanAt = library.LastScanAt
+	}
+	l.UpdatedAt = time.Now()
+
+	r.state.libraries[l.ID] = l
+	return nil
+}
+
+// DeleteLibrary deletes a library.
+func (r *LibraryRepository) DeleteLibrary(_ context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.state.libraries[id]; !ok {
+		return pkgerrors.NotFound("library not found")
+	}
+	delete(r.state.libraries, id)
+	return nil
+}
+
+// ListLibraries lists the libraries, enabled or not if enabled is nil, by
+// name.
+func (r *LibraryRepository) ListLibraries(_ context.Context, enabled *bool) ([]*domain.Library, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	libraries := collect(r.state.libraries,
+		func(l *domain.Library) bool { return enabled == nil || l.Enabled == *enabled },
+		func(a, b *domain.Library) bool { return a.Name < b.Name })
+	for i, l := range libraries {
+		libraries[i] = cloneLibrary(l)
+	}
+	return libraries, nil
+}
+
+// ListLibraryFiles lists the files the media and episodes of a library
+// point to, by path.
+func (r *LibraryRepository) ListLibraryFiles(_ context.Context, libraryID uuid.UUID) ([]*domain.LibraryFile, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	files := make([]*domain.LibraryFile, 0)
+	for _, m := range r.state.media {
+		if m.LibraryID == libraryID && m.FilePath != "" {
+			files = append(files, &domain.LibraryFile{MediaID: m.ID, Path: m.FilePath})
+		}
+	}
+	for _, ep := range r.state.episodes {
+		m, ok := r.state.media[ep.MediaID]
+		if ok && m.LibraryID == libraryID && ep.Path != "" {
+			files = append(files, &domain.LibraryFile{MediaID: ep.MediaID, EpisodeID: &ep.ID, Path: ep.Path})
+		}
+		for _, file := range r.state.episodeFiles[ep.ID] {
+			if ok && m.LibraryID == libraryID && file.Path != ep.Path {
+				files = append(files, &domain.LibraryFile{MediaID: ep.MediaID, EpisodeID: &ep.ID, Path: file.Path})
+			}
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// RenameFiles points the media and episodes of renamed files at their new
+// paths, all or none of them.
+func (r *LibraryRepository) RenameFiles(_ context.Context, files []domain.RenamedFile) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, file := range files {
+		if file.EpisodeID != nil {
+			ep, ok := r.state.episodes[*file.EpisodeID]
+			if !ok || ep.MediaID != file.MediaID || ep.Path != file.Path {
+				return pkgerrors.NotFound("renamed file " + file.Path + " not found")
+			}
+		} else if m, ok := r.state.media[file.MediaID]; !ok || m.FilePath != file.Path {
+			return pkgerrors.NotFound("renamed file " + file.Path + " not found")
+		}
+	}
+
+	for _, file := range files {
+		if file.EpisodeID != nil {
+			ep := clone(r.state.episodes[*file.EpisodeID])
+			ep.Path = file.NewPath
+			r.state.episodes[ep.ID] = ep
+			if files, ok := r.state.episodeFiles[ep.ID]; ok {
+				r.state.episodeFiles[ep.ID] = moveEpisodeFiles(files, func(path string) (string, bool) {
+					return file.NewPath, path == file.Path
+				})
+			}
+			continue
+		}
+		m := cloneMedia(r.state.media[file.MediaID])
+		m.FilePath, m.Path = file.NewPath, file.NewPath
+		r.state.media[m.ID] = m
+	}
+	return nil
+}
+
+// RelocateLibrary rewrites the from prefix of the paths of a library, its
+// media, episodes and scan manifest to to.
+func (r *LibraryRepository) RelocateLibrary(_ context.Context, libraryID uuid.UUID, from, to string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	from = filepath.Clean(from)
+	to = filepath.Clean(to)
+	fromPrefix := strings.TrimSuffix(from, "/") + "/"
+	toPrefix := strings.TrimSuffix(to, "/") + "/"
+	relocate := func(path string) (string, bool) {
+		switch {
+		case path == from:
+			return to, true
+		case strings.HasPrefix(path, fromPrefix):
+			return toPrefix + path[len(fromPrefix):], true
+		}
+		return path, false
+	}
+
+	stored, ok := r.state.libraries[libraryID]
+	if !ok {
+		return 0, pkgerrors.NotFound("library not found")
+	}
+	l := cloneLibrary(stored)
+	l.Path, _ = relocate(l.Path)
+	l.UpdatedAt = time.Now()
+	r.state.libraries[libraryID] = l
+
+	relocated := 0
+	for id, m := range r.state.media {
+		if m.LibraryID != libraryID {
+			continue
+		}
+		if path, ok := relocate(m.FilePath); ok {
+			m = cloneMedia(m)
+			m.FilePath, m.Path = path, path
+			r.state.media[id] = m
+			relocated++
+		}
+	}
+	for id, ep := range r.state.episodes {
+		if m, ok := r.state.media[ep.MediaID]; !ok || m.LibraryID != libraryID {
+			continue
+		}
+		if path, ok := relocate(ep.Path); ok {
+			ep = clone(ep)
+			ep.Path = path
+			r.state.episodes[id] = ep
+			relocated++
+		}
+		if files, ok := r.state.episodeFiles[id]; ok {
+			r.state.episodeFiles[id] = moveEpisodeFiles(files, relocate)
+		}
+	}
+
+	manifest := make(domain.ScanManifest, len(r.state.manifests[libraryID]))
+	for _, state := range r.state.manifests[libraryID] {
+		state.Path, _ = relocate(state.Path)
+		manifest[state.Path] = state
+	}
+	r.state.manifests[libraryID] = manifest
+
+	return relocated, nil
+}
+
+// Media
+
+func cloneMedia(m *models.Media) *models.Media {
+	c := clone(m)
+	c.Genres = slices.Clone(m.Genres)
+	c.Tags = slices.Clone(m.Tags)
+	return c
+}
+
+// storedMedia returns the copy of a media item the database keeps: the
+// file fields stand for the path and size, and attached records are left
+// out.
+func storedMedia(m *models.Media) *models.Media {
+	c := cloneMedia(m)
+	c.Path = m.FilePath
+	c.Size = m.FileSize
+	c.Added = m.CreatedAt
+	c.Modified = m.UpdatedAt
+	c.LastScanned = m.UpdatedAt
+	c.Metadata = nil
+	c.Episodes = nil
+	c.Extras = nil
+	return c
+}
+
+// updateMedia applies the columns UpdateMedia writes to a stored copy.
+func updateMedia(stored, m *models.Media, now time.Time) *models.Media {
+	c := cloneMedia(stored)
+	c.Title = m.Title
+	c.Status = m.Status
+	c.FilePath = m.FilePath
+	c.FileSize = m.FileSize
+	c.FileModifiedAt = m.FileModifiedAt
+	c.ParentID = m.ParentID
+	c.EpisodeID = m.EpisodeID
+	c.ExtraType = m.ExtraType
+	c.ThemeKey = m.ThemeKey
+	c.ThemeURL = m.ThemeURL
+	c.Description = m.Description
+	c.ReleaseDate = m.ReleaseDate
+	c.Duration = m.Duration
+	c.Genres = slices.Clone(m.Genres)
+	c.Tags = slices.Clone(m.Tags)
+	c.TMDBID = m.TMDBID
+	c.IMDBID = m.IMDBID
+	c.TVDBID = m.TVDBID
+	c.Codec = m.Codec
+	c.Resolution = m.Resolution
+	c.Bitrate = m.Bitrate
+	c.Monitored = m.Monitored
+	c.DigitalReleaseDate = m.DigitalReleaseDate
+	c.PhysicalReleaseDate = m.PhysicalReleaseDate
+	c.UpdatedAt = now
+	return storedMedia(c)
+}
+
+// mediaByPath returns the media item with a file path, if any.
+func (s *libraryState) mediaByPath(path string) (*models.Media, bool) {
+	if path == "" {
+		return nil, false
+	}
+	for _, m := range s.media {
+		if m.FilePath == path {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// createMedia stores a new media item. New media are monitored.
+func (s *libraryState) createMedia(media *models.Media, now time.Time) {
+	if media.ID == uuid.Nil {
+		media.ID = uuid.New()
+	}
+	if media.Status == "" {
+		media.Status = string(models.MediaStatusPending)
+	}
+	media.Monitored = true
+	stamp(&media.CreatedAt, now)
+	stamp(&media.UpdatedAt, now)
+	s.media[media.ID] = storedMedia(media)
+}
+
+// CreateMedia creates a media item. File paths are unique.
+func (r *LibraryRepository) CreateMedia(_ context.Context, media *models.Media) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.state.mediaByPath(media.FilePath); ok {
+		return pkgerrors.Conflict("media file path already exists")
+	}
+	r.state.createMedia(media, time.Now())
+	return nil
+}
+
+// CreateMediaBatch creates several media items, all or none of them.
+func (r *LibraryRepository) CreateMediaBatch(_ context.Context, media []*models.Media) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	paths := make(map[string]bool, len(media))
+	for _, m := range media {
+		if _, ok := r.state.mediaByPath(m.FilePath); ok || (m.FilePath != "" && paths[m.FilePath]) {
+			return pkgerrors.Conflict("media file path already exists")
+		}
+		paths[m.FilePath] = true
+	}
+
+	now := time.Now()
+	for _, m := range media {
+		r.state.createMedia(m, now)
+	}
+	return nil
+}
+
+// UpdateMediaBatch updates several media items. Items that do not exist
+// are skipped.
+func (r *LibraryRepository) UpdateMediaBatch(_ context.Context, media []*models.Media) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, m := range media {
+		if stored, ok := r.state.media[m.ID]; ok {
+			r.state.media[m.ID] = updateMedia(stored, m, now)
+		}
+	}
+	return nil
+}
+
+// UpsertMediaBatch creates or updates media items by file path. Updated
+// items keep their ID, monitoring and calendar dates, which are copied back
+// onto the media.
+func (r *LibraryRepository) UpsertMediaBatch(_ context.Context, media []*models.Media) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, m := range media {
+		stored, ok := r.state.mediaByPath(m.FilePath)
+		if !ok {
+			r.state.createMedia(m, now)
+			continue
+		}
+
+		c := cloneMedia(m)
+		c.ID = stored.ID
+		c.TenantID = stored.TenantID
+		c.LibraryID = stored.LibraryID
+		c.Type = stored.Type
+		c.Monitored = stored.Monitored
+		c.DigitalReleaseDate = stored.DigitalReleaseDate
+		c.PhysicalReleaseDate = stored.PhysicalReleaseDate
+		c.CreatedAt = stored.CreatedAt
+		c.UpdatedAt = now
+		r.state.media[c.ID] = storedMedia(c)
+
+		m.ID = c.ID
+		m.TenantID = c.TenantID
+		m.CreatedAt = c.CreatedAt
+		m.UpdatedAt = c.UpdatedAt
+		m.Monitored = c.Monitored
+	}
+	return len(media), nil
+}
+
+// GetMedia retrieves a media item by ID.
+func (r *LibraryRepository) GetMedia(_ context.Context, id uuid.UUID) (*models.Media, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, ok := r.state.media[id]
+	if !ok {
+		return nil, pkgerrors.NotFound("media not found")
+	}
+	return cloneMedia(m), nil
+}
+
+// GetMediaByPath retrieves a media item by file path.
+func (r *LibraryRepository) GetMediaByPath(_ context.Context, path string) (*models.Media, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, ok := r.state.mediaByPath(path)
+	if !ok {
+		return nil, pkgerrors.NotFound("media not found")
+	}
+	return cloneMedia(m), nil
+}
+
+// GetMediaByPaths retrieves the media items at the given file paths, keyed
+// by path. Paths without media are left out.
+func (r *LibraryRepository) GetMediaByPaths(_ context.Context, paths []string) (map[string]*models.Media, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	media := make(map[string]*models.Media, len(paths))
+	for _, path := range paths {
+		if m, ok := r.state.mediaByPath(path); ok {
+			media[path] = cloneMedia(m)
+		}
+	}
+	return media, nil
+}
+
+// GetMainMediaInDirectory gets the largest media item, other than extras,
+// whose file is directly inside dir. A non-empty nameContains further
+// requires the file name to contain it, ignoring case.
+func (r *LibraryRepository) GetMainMediaInDirectory(
+	_ context.Context,
+	libraryID uuid.UUID,
+	dir, nameContains string,
+) (*models.Media, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	candidates := collect(r.state.media, func(m *models.Media) bool {
+		name, ok := strings.CutPrefix(m.FilePath, prefix)
+		return ok && m.LibraryID == libraryID && m.ParentID == nil && m.ExtraType == "" &&
+			!strings.Contains(name, "/") &&
+			strings.Contains(strings.ToLower(name), strings.ToLower(nameContains))
+	}, func(a, b *models.Media) bool { return a.FileSize > b.FileSize })
+	if len(candidates) == 0 {
+		return nil, pkgerrors.NotFound("media not found")
+	}
+	return cloneMedia(candidates[0]), nil
+}
+
+// ListExtras lists the extras attached to a media item.
+func (r *LibraryRepository) ListExtras(_ context.Context, parentID uuid.UUID) ([]*models.Media, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	extras := collect(r.state.media,
+		func(m *models.Media) bool { return m.ParentID != nil && *m.ParentID == parentID },
+		func(a, b *models.Media) bool {
+			if a.ExtraType != b.ExtraType {
+				return a.ExtraType < b.ExtraType
+			}
+			return a.Title < b.Title
+		})
+	return cloneAllMedia(extras), nil
+}
+
+// SearchMedia searches the media other than extras by title and by the
+// words of the search index.
+func (r *LibraryRepository) SearchMedia(
+	_ context.Context,
+	query string,
+	mediaType *string,
+	status *string,
+	libraryID *uuid.UUID,
+	limit, offset int,
+) ([]*models.Media, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	media := collect(r.state.media, func(m *models.Media) bool {
+		switch {
+		case m.ParentID != nil:
+			return false
+		case query != "" && !strings.Contains(strings.ToLower(m.Title), strings.ToLower(query)) &&
+			!r.state.searchIndex[m.ID].matches(query):
+			return false
+		case mediaType != nil && *mediaType != "" && string(m.Type) != *mediaType:
+			return false
+		case status != nil && *status != "" && m.Status != *status:
+			return false
+		case libraryID != nil && m.LibraryID != *libraryID:
+			return false
+		}
+		return true
+	}, byTitle)
+	return cloneAllMedia(page(media, limit, offset)), nil
+}
+
+// UpdateMedia updates a media item.
+func (r *LibraryRepository) UpdateMedia(_ context.Context, media *models.Media) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.state.media[media.ID]
+	if !ok {
+		return pkgerrors.NotFound("media not found")
+	}
+	r.state.media[media.ID] = updateMedia(stored, media, time.Now())
+	return nil
+}
+
+// DeleteMedia deletes a media item.
+func (r *LibraryRepository) DeleteMedia(_ context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.state.media[id]; !ok {
+		return pkgerrors.NotFound("media not found")
+	}
+	delete(r.state.media, id)
+	return nil
+}
+
+// ListMediaByLibrary lists the media of a library other than extras, by
+// title.
+func (r *LibraryRepository) ListMediaByLibrary(
+	_ context.Context,
+	libraryID uuid.UUID,
+	status *string,
+	limit, offset int,
+) ([]*models.Media, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	media := collect(r.state.media, func(m *models.Media) bool {
+		return m.LibraryID == libraryID && m.ParentID == nil && (status == nil || *status == "" || m.Status == *status)
+	}, byTitle)
+	return cloneAllMedia(page(media, limit, offset)), nil
+}
+
+// ListMediaByArtist lists the media of an artist across libraries.
+func (r *LibraryRepository) ListMediaByArtist(_ context.Context, artist string) ([]*models.Media, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	media := collect(r.state.media, func(m *models.Media) bool {
+		return m.ParentID == nil && m.Artist != "" && strings.EqualFold(m.Artist, artist)
+	}, byTitle)
+	return cloneAllMedia(media), nil
+}
+
+// ListMediaAddedSince lists the available media added after since to the
+// given libraries, or to every library, newest first. Extras are left out.
+func (r *LibraryRepository) ListMediaAddedSince(
+	_ context.Context,
+	since time.Time,
+	libraryIDs []uuid.UUID,
+	limit int,
+) ([]*models.Media, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	media := collect(r.state.media, func(m *models.Media) bool {
+		return m.ParentID == nil && m.CreatedAt.After(since) &&
+			m.Status == string(models.MediaStatusAvailable) &&
+			(len(libraryIDs) == 0 || slices.Contains(libraryIDs, m.LibraryID))
+	}, func(a, b *models.Media) bool { return a.CreatedAt.After(b.CreatedAt) })
+	return cloneAllMedia(page(media, limit, 0)), nil
+}
+
+func byTitle(a, b *models.Media) bool { return a.Title < b.Title }
+
+// cloneAllMedia copies the slices of collected media, which collect copies
+// shallowly.
+func cloneAllMedia(media []*models.Media) []*models.Media {
+	for i, m := range media {
+		media[i] = cloneMedia(m)
+	}
+	return media
+}
+
+// Episodes
+
+// CreateEpisode creates an episode.
+func (r *LibraryRepository) CreateEpisode(_ context.Context, episode *models.Episode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if episode.ID == uuid.Nil {
+		episode.ID = uuid.New()
+	}
+	episode.Added = time.Now()
+	r.state.episodes[episode.ID] = clone(episode)
+	return nil
+}
+
+// GetEpisode retrieves an episode by ID.
+func (r *LibraryRepository) GetEpisode(_ context.Context, id uuid.UUID) (*models.Episode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ep, ok := r.state.episodes[id]
+	if !ok {
+		return nil, pkgerrors.NotFound("episode not found")
+	}
+	return clone(ep), nil
+}
+
+// GetEpisodeByNumber retrieves an episode by media ID, season and episode
+// number.
+func (r *LibraryRepository) GetEpisodeByNumber(
+	_ context.Context,
+	mediaID uuid.UUID,
+	season, episode int,
+) (*models.Episode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, ep := range r.state.episodes {
+		if ep.MediaID == mediaID && ep.SeasonNumber == season && ep.EpisodeNumber == episode {
+			return clone(ep), nil
+		}
+	}
+	return nil, pkgerrors.NotFound("episode not found")
+}
+
+// ListEpisodesByMedia lists the episodes of a media item by season and
+// episode number.
+func (r *LibraryRepository) ListEpisodesByMedia(_ context.Context, mediaID uuid.UUID) ([]*models.Episode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return collect(r.state.episodes,
+		func(ep *models.Episode) bool { return ep.MediaID == mediaID },
+		byEpisodeNumber), nil
+}
+
+// ListEpisodesBySeason lists the episodes of a season by episode number.
+func (r *LibraryRepository) ListEpisodesBySeason(
+	_ context.Context,
+	mediaID uuid.UUID,
+	season int,
+) ([]*models.Episode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return collect(r.state.episodes,
+		func(ep *models.Episode) bool { return ep.MediaID == mediaID && ep.SeasonNumber == season },
+		byEpisodeNumber), nil
+}
+
+func byEpisodeNumber(a, b *models.Episode) bool {
+	if a.SeasonNumber != b.SeasonNumber {
+		return a.SeasonNumber < b.SeasonNumber
+	}
+	return a.EpisodeNumber < b.EpisodeNumber
+}
+
+// UpdateEpisode updates the title, numbering, air date, duration and file
+// of an episode.
+func (r *LibraryRepository) UpdateEpisode(_ context.Context, episode *models.Episode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.state.episodes[episode.ID]
+	if !ok {
+		return pkgerrors.NotFound("episode not found")
+	}
+	ep := clone(stored)
+	ep.Title = episode.Title
+	ep.AbsoluteNumber = episode.AbsoluteNumber
+	ep.AirDate = episode.AirDate
+	ep.Duration = episode.Duration
+	ep.Path = episode.Path
+	r.state.episodes[ep.ID] = ep
+	return nil
+}
+
+// DeleteEpisode deletes an episode.
+func (r *LibraryRepository) DeleteEpisode(_ context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.state.episodes[id]; !ok {
+		return pkgerrors.NotFound("episode not found")
+	}
+	delete(r.state.episodes, id)
+	delete(r.state.episodeFiles, id)
+	return nil
+}
+
+// ListEpisodeFiles lists the files of the episodes of a media item, by path
+// and part. Episodes pointing to a file without episode files are listed
+// with that file as a whole.
+func (r *LibraryRepository) ListEpisodeFiles(_ context.Context, mediaID uuid.UUID) ([]*models.EpisodeFile, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	files := make([]*models.EpisodeFile, 0)
+	for _, ep := range r.state.episodes {
+		if ep.MediaID != mediaID {
+			continue
+		}
+		stored, ok := r.state.episodeFiles[ep.ID]
+		if !ok && ep.Path != "" {
+			stored = []*models.EpisodeFile{{EpisodeID: ep.ID, MediaID: ep.MediaID, Path: ep.Path}}
+		}
+		for _, file := range stored {
+			files = append(files, clone(file))
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].Path != files[j].Path {
+			return files[i].Path < files[j].Path
+		}
+		return files[i].Part < files[j].Part
+	})
+	return files, nil
+}
+
+// SetEpisodeFiles replaces the files of an episode and points the episode
+// at the first.
+func (r *LibraryRepository) SetEpisodeFiles(_ context.Context, episodeID uuid.UUID, files []*models.EpisodeFile) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.state.episodes[episodeID]
+	if !ok {
+		return pkgerrors.NotFound("episode not found")
+	}
+	ep := clone(stored)
+	ep.Path = ""
+
+	kept := make([]*models.EpisodeFile, len(files))
+	for i, file := range files {
+		if file.ID == uuid.Nil {
+			file.ID = uuid.New()
+		}
+		file.EpisodeID = episodeID
+		file.MediaID = ep.MediaID
+		kept[i] = clone(file)
+		if ep.Path == "" {
+			ep.Path = file.Path
+		}
+	}
+	r.state.episodes[episodeID] = ep
+	r.state.episodeFiles[episodeID] = kept
+	return nil
+}
+
+// moveEpisodeFiles returns episode files with their paths moved, copying
+// those that move.
+func moveEpisodeFiles(files []*models.EpisodeFile, move func(path string) (string, bool)) []*models.EpisodeFile {
+	moved := make([]*models.EpisodeFile, len(files))
+	for i, file := range files {
+		moved[i] = file
+		if path, ok := move(file.Path); ok {
+			moved[i] = clone(file)
+			moved[i].Path = path
+		}
+	}
+	return moved
+}
+
+// Scans
+
+// storedScan returns the fields of a scan the scan history keeps.
+func storedScan(scan *domain.ScanResult) *domain.ScanResult {
+	return &domain.ScanResult{
+		ID:           scan.ID,
+		LibraryID:    scan.LibraryID,
+		StartedAt:    scan.StartedAt,
+		CompletedAt:  scan.CompletedAt,
+		FilesScanned: scan.FilesScanned,
+		FilesAdded:   scan.FilesAdded,
+		FilesUpdated: scan.FilesUpdated,
+		FilesDeleted: scan.FilesDeleted,
+		ErrorMessage: scan.ErrorMessage,
+	}
+}
+
+// CreateScanHistory records a scan.
+func (r *LibraryRepository) CreateScanHistory(_ context.Context, scan *domain.ScanResult) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if scan.ID == uuid.Nil {
+		scan.ID = uuid.New()
+	}
+	stamp(&scan.StartedAt, time.Now())
+	r.state.scans[scan.ID] = storedScan(scan)
+	return nil
+}
+
+// UpdateScanHistory records the progress of a scan.
+func (r *LibraryRepository) UpdateScanHistory(_ context.Context, scan *domain.ScanResult) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.state.scans[scan.ID]
+	if !ok {
+		return nil
+	}
+	s := storedScan(scan)
+	s.LibraryID = stored.LibraryID
+	s.StartedAt = stored.StartedAt
+	r.state.scans[s.ID] = s
+	return nil
+}
+
+// GetLatestScan gets the latest scan of a library, or nil if it was never
+// scanned.
+func (r *LibraryRepository) GetLatestScan(_ context.Context, libraryID uuid.UUID) (*domain.ScanResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	scans := collect(r.state.scans,
+		func(s *domain.ScanResult) bool { return s.LibraryID == libraryID },
+		func(a, b *domain.ScanResult) bool { return a.StartedAt.After(b.StartedAt) })
+	if len(scans) == 0 {
+		return nil, nil
+	}
+	return scans[0], nil
+}
+
+// GetScanManifest gets the directory manifest of a library's last scan.
+func (r *LibraryRepository) GetScanManifest(_ context.Context, libraryID uuid.UUID) (domain.ScanManifest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	manifest := make(domain.ScanManifest, len(r.state.manifests[libraryID]))
+	maps.Copy(manifest, r.state.manifests[libraryID])
+	return manifest, nil
+}
+
+// SaveScanManifest replaces the directory manifest of a library.
+func (r *LibraryRepository) SaveScanManifest(
+	_ context.Context,
+	libraryID uuid.UUID,
+	manifest domain.ScanManifest,
+) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := make(domain.ScanManifest, len(manifest))
+	for _, state := range manifest {
+		stored[state.Path] = state
+	}
+	r.state.manifests[libraryID] = stored
+	return nil
+}
+
+// InterruptScans completes every scan that never completed.
+func (r *LibraryRepository) InterruptScans(_ context.Context, reason string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	interrupted := 0
+	for id, s := range r.state.scans {
+		if s.CompletedAt == nil {
+			s = clone(s)
+			s.CompletedAt = &now
+			s.ErrorMessage = reason
+			r.state.scans[id] = s
+			interrupted++
+		}
+	}
+	return interrupted, nil
+}
+
+// Metadata providers
+
+// CreateProvider creates a metadata provider. Names are unique.
+func (r *LibraryRepository) CreateProvider(_ context.Context, provider *domain.MetadataProviderConfig) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, p := range r.state.providers {
+		if p.Name == provider.Name {
+			return pkgerrors.Conflict("provider name already exists")
+		}
+	}
+
+	if provider.ID == uuid.Nil {
+		provider.ID = uuid.New()
+	}
+	now := time.Now()
+	stamp(&provider.CreatedAt, now)
+	stamp(&provider.UpdatedAt, now)
+	r.state.providers[provider.ID] = clone(provider)
+	return nil
+}
+
+// GetProvider retrieves a metadata provider by ID.
+func (r *LibraryRepository) GetProvider(_ context.Context, id uuid.UUID) (*domain.MetadataProviderConfig, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.state.providers[id]
+	if !ok {
+		return nil, pkgerrors.NotFound("provider not found")
+	}
+	return clone(p), nil
+}
+
+// GetProviderByName retrieves a metadata provider by name.
+func (r *LibraryRepository) GetProviderByName(_ context.Context, name string) (*domain.MetadataProviderConfig, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, p := range r.state.providers {
+		if p.Name == name {
+			return clone(p), nil
+		}
+	}
+	return nil, pkgerrors.NotFound("provider not found")
+}
+
+// ListProviders lists metadata providers, highest priority first.
+func (r *LibraryRepository) ListProviders(
+	_ context.Context,
+	enabled *bool,
+	providerType *string,
+) ([]*domain.MetadataProviderConfig, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return collect(r.state.providers, func(p *domain.MetadataProviderConfig) bool {
+		return (enabled == nil || p.Enabled == *enabled) &&
+			(providerType == nil || *providerType == "" || p.ProviderType == *providerType)
+	}, func(a, b *domain.MetadataProviderConfig) bool {
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		return a.Name < b.Name
+	}), nil
+}
+
+// UpdateProvider updates a metadata provider.
+func (r *LibraryRepository) UpdateProvider(_ context.Context, provider *domain.MetadataProviderConfig) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.state.providers[provider.ID]
+	if !ok {
+		return pkgerrors.NotFound("provider not found")
+	}
+	p := clone(provider)
+	p.CreatedAt = stored.CreatedAt
+	p.UpdatedAt = time.Now()
+	r.state.providers[p.ID] = p
+	return nil
+}
+
+// DeleteProvider deletes a metadata provider.
+func (r *LibraryRepository) DeleteProvider(_ context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.state.providers[id]; !ok {
+		return pkgerrors.NotFound("provider not found")
+	}
+	delete(r.state.providers, id)
+	return nil
+}
+
+// Watch states and watchlists
+
+func byLastWatched(a, b *models.WatchHistory) bool { return a.LastWatched.After(b.LastWatched) }
+
+// ListWatchStatesByMedia lists every user's watch states of a media item,
+// most recent first.
+func (r *LibraryRepository) ListWatchStatesByMedia(_ context.Context, mediaID uuid.UUID) ([]*models.WatchHistory, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return collect(r.state.watchStates,
+		func(w *models.WatchHistory) bool { return w.MediaID == mediaID },
+		byLastWatched), nil
+}
+
+// ListWatchStatesByUser lists a user's watch states, most recent first.
+func (r *LibraryRepository) ListWatchStatesByUser(_ context.Context, userID uuid.UUID) ([]*models.WatchHistory, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return collect(r.state.watchStates,
+		func(w *models.WatchHistory) bool { return w.UserID == userID },
+		byLastWatched), nil
+}
+
+// ListWatchStatesSince lists up to limit watch states of every user that
+// are not completed and were updated after since, most recent first.
+func (r *LibraryRepository) ListWatchStatesSince(_ context.Context, since time.Time, limit int) ([]*models.WatchHistory, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	states := collect(r.state.watchStates,
+		func(w *models.WatchHistory) bool { return !w.Completed && w.LastWatched.After(since) },
+		byLastWatched)
+	return page(states, limit, 0), nil
+}
+
+// UpsertWatchState creates or updates the watch state of a user for a
+// media item or episode.
+func (r *LibraryRepository) UpsertWatchState(_ context.Context, state *models.WatchHistory) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := clone(state)
+	stored.ID = uuid.New()
+	for _, w := range r.state.watchStates {
+		if w.UserID == state.UserID && w.MediaID == state.MediaID && sameID(w.EpisodeID, state.EpisodeID) {
+			stored.ID = w.ID
+			break
+		}
+	}
+	r.state.watchStates[stored.ID] = stored
+	state.ID = stored.ID
+	return nil
+}
+
+func sameID(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// AnonymizeWatchStates moves a user's watch states to a new random user ID.
+func (r *LibraryRepository) AnonymizeWatchStates(_ context.Context, userID uuid.UUID) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	anonymous := uuid.New()
+	var moved int64
+	for id, w := range r.state.watchStates {
+		if w.UserID == userID {
+			w = clone(w)
+			w.UserID = anonymous
+			r.state.watchStates[id] = w
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+// AddToWatchlist adds media to a user's watchlist. Adding media that is on
+// it already does nothing.
+func (r *LibraryRepository) AddToWatchlist(_ context.Context, entry *domain.WatchlistEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry.AddedAt = time.Now()
+	key := watchlistKey{entry.UserID, entry.MediaID}
+	if _, ok := r.state.watchlist[key]; !ok {
+		r.state.watchlist[key] = clone(entry)
+	}
+	return nil
+}
+
+// RemoveFromWatchlist removes media from a user's watchlist.
+func (r *LibraryRepository) RemoveFromWatchlist(_ context.Context, userID, mediaID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := watchlistKey{userID, mediaID}
+	if _, ok := r.state.watchlist[key]; !ok {
+		return pkgerrors.NotFound("media is not on the watchlist")
+	}
+	delete(r.state.watchlist, key)
+	return nil
+}
+
+// ListWatchlist lists a user's watchlist, most recently added first.
+func (r *LibraryRepository) ListWatchlist(_ context.Context, userID uuid.UUID) ([]*domain.WatchlistEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return collect(r.state.watchlist,
+		func(e *domain.WatchlistEntry) bool { return e.UserID == userID },
+		func(a, b *domain.WatchlistEntry) bool { return a.AddedAt.After(b.AddedAt) }), nil
+}
+
+// DeleteWatchlist empties a user's watchlist.
+func (r *LibraryRepository) DeleteWatchlist(_ context.Context, userID uuid.UUID) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	for key := range r.state.watchlist {
+		if key.userID == userID {
+			delete(r.state.watchlist, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Workflows
+
+func cloneWorkflow(wf *saga.Workflow) *saga.Workflow {
+	c := clone(wf)
+	c.Steps = slices.Clone(wf.Steps)
+	c.Data = maps.Clone(wf.Data)
+	return c
+}
+
+// CreateWorkflow records a workflow.
+func (r *LibraryRepository) CreateWorkflow(_ context.Context, wf *saga.Workflow) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.state.workflows[wf.ID]; ok {
+		return pkgerrors.Conflict("workflow already exists")
+	}
+	now := time.Now()
+	stamp(&wf.CreatedAt, now)
+	stamp(&wf.UpdatedAt, now)
+	r.state.workflows[wf.ID] = cloneWorkflow(wf)
+	return nil
+}
+
+// UpdateWorkflow saves the progress of a workflow.
+func (r *LibraryRepository) UpdateWorkflow(_ context.Context, wf *saga.Workflow) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	wf.UpdatedAt = time.Now()
+	r.state.workflows[wf.ID] = cloneWorkflow(wf)
+	return nil
+}
+
+// GetLatestWorkflow gets the most recent workflow of a media item.
+func (r *LibraryRepository) GetLatestWorkflow(_ context.Context, mediaID uuid.UUID) (*saga.Workflow, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	workflows := collect(r.state.workflows,
+		func(wf *saga.Workflow) bool { return wf.MediaID == mediaID },
+		func(a, b *saga.Workflow) bool { return a.CreatedAt.After(b.CreatedAt) })
+	if len(workflows) == 0 {
+		return nil, pkgerrors.NotFound("workflow not found")
+	}
+	return cloneWorkflow(workflows[0]), nil
+}
+
+// InterruptWorkflows fails every running or compensating workflow.
+func (r *LibraryRepository) InterruptWorkflows(_ context.Context, reason string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	interrupted := 0
+	for id, wf := range r.state.workflows {
+		if wf.Status == saga.WorkflowStatusRunning || wf.Status == saga.WorkflowStatusCompensating {
+			wf = cloneWorkflow(wf)
+			wf.Status = saga.WorkflowStatusFailed
+			wf.Error = reason
+			wf.UpdatedAt = now
+			r.state.workflows[id] = wf
+			interrupted++
+		}
+	}
+	return interrupted, nil
+}
+
+// ArchiveWorkflows moves finished workflows the retention policy no longer
+// keeps to the workflow history.
+func (r *LibraryRepository) ArchiveWorkflows(
+	_ context.Context,
+	finishedBefore time.Time,
+	keepPerMedia, limit int,
+) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	finished := collect(r.state.workflows,
+		func(wf *saga.Workflow) bool { return slices.Contains(domain.FinishedWorkflowStatuses, wf.Status) },
+		func(a, b *saga.Workflow) bool { return a.CreatedAt.After(b.CreatedAt) })
+
+	var expired []*saga.Workflow
+	position := make(map[uuid.UUID]int)
+	for _, wf := range finished {
+		position[wf.MediaID]++
+		if position[wf.MediaID] > keepPerMedia && wf.UpdatedAt.Before(finishedBefore) {
+			expired = append(expired, wf)
+		}
+	}
+	sort.SliceStable(expired, func(i, j int) bool { return expired[i].UpdatedAt.Before(expired[j].UpdatedAt) })
+	expired = page(expired, limit, 0)
+
+	for _, wf := range expired {
+		if _, ok := r.state.workflowHistory[wf.ID]; !ok {
+			r.state.workflowHistory[wf.ID] = wf
+		}
+		delete(r.state.workflows, wf.ID)
+	}
+	return len(expired), nil
+}
+
+// ListWorkflowHistory lists archived workflows, most recently finished
+// first.
+func (r *LibraryRepository) ListWorkflowHistory(
+	_ context.Context,
+	filter domain.WorkflowHistoryFilter,
+	limit, offset int,
+) ([]*saga.Workflow, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	workflows := collect(r.state.workflowHistory, func(wf *saga.Workflow) bool {
+		return (filter.MediaID == nil || wf.MediaID == *filter.MediaID) &&
+			(filter.Status == nil || wf.Status == *filter.Status) &&
+			(filter.FinishedAfter == nil || !wf.UpdatedAt.Before(*filter.FinishedAfter)) &&
+			(filter.FinishedBefore == nil || wf.UpdatedAt.Before(*filter.FinishedBefore))
+	}, func(a, b *saga.Workflow) bool { return a.UpdatedAt.After(b.UpdatedAt) })
+
+	workflows = page(workflows, limit, offset)
+	for i, wf := range workflows {
+		workflows[i] = cloneWorkflow(wf)
+	}
+	return workflows, nil
+}
+
+// Transcode policies
+
+// CreateTranscodePolicy creates a transcode policy.
+func (r *LibraryRepository) CreateTranscodePolicy(_ context.Context, policy *domain.TranscodePolicy) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if policy.ID == uuid.Nil {
+		policy.ID = uuid.New()
+	}
+	now := time.Now()
+	stamp(&policy.CreatedAt, now)
+	stamp(&policy.UpdatedAt, now)
+	r.state.policies[policy.ID] = clone(policy)
+	return nil
+}
+
+// GetTranscodePolicy retrieves a transcode policy by ID.
+func (r *LibraryRepository) GetTranscodePolicy(_ context.Context, id uuid.UUID) (*domain.TranscodePolicy, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.state.policies[id]
+	if !ok {
+		return nil, pkgerrors.NotFound("transcode policy not found")
+	}
+	return clone(p), nil
+}
+
+// ListTranscodePolicies lists the transcode policies of a library, oldest
+// first.
+func (r *LibraryRepository) ListTranscodePolicies(
+	_ context.Context,
+	libraryID uuid.UUID,
+) ([]*domain.TranscodePolicy, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return collect(r.state.policies,
+		func(p *domain.TranscodePolicy) bool { return p.LibraryID == libraryID },
+		func(a, b *domain.TranscodePolicy) bool { return a.CreatedAt.Before(b.CreatedAt) }), nil
+}
+
+// UpdateTranscodePolicy updates the name, profile, format and state of a
+// transcode policy.
+func (r *LibraryRepository) UpdateTranscodePolicy(_ context.Context, policy *domain.TranscodePolicy) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.state.policies[policy.ID]
+	if !ok {
+		return pkgerrors.NotFound("transcode policy not found")
+	}
+	p := clone(stored)
+	p.Name = policy.Name
+	p.Profile = policy.Profile
+	p.Format = policy.Format
+	p.Enabled = policy.Enabled
+	p.UpdatedAt = time.Now()
+	r.state.policies[p.ID] = p
+	return nil
+}
+
+// DeleteTranscodePolicy deletes a transcode policy. Its requests are kept.
+func (r *LibraryRepository) DeleteTranscodePolicy(_ context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.state.policies[id]; !ok {
+		return pkgerrors.NotFound("transcode policy not found")
+	}
+	delete(r.state.policies, id)
+	return nil
+}
+
+// ClaimTranscode records a transcode of a media item. It reports false if
+// the transcode was requested before.
+func (r *LibraryRepository) ClaimTranscode(
+	_ context.Context,
+	mediaID, policyID uuid.UUID,
+	key string,
+	priority domain.TranscodePriority,
+) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := transcodeKey{mediaID, key}
+	if _, ok := r.state.transcodes[k]; ok {
+		return false, nil
+	}
+	if priority == "" {
+		priority = domain.TranscodePriorityNormal
+	}
+	r.state.transcodes[k] = &domain.TranscodeRequest{
+		MediaID:   mediaID,
+		PolicyID:  policyID,
+		Key:       key,
+		Priority:  priority,
+		CreatedAt: time.Now(),
+	}
+	return true, nil
+}
+
+// ListTranscodeRequests lists a page of the requested transcodes, most
+// recent first.
+func (r *LibraryRepository) ListTranscodeRequests(_ context.Context, limit, offset int) ([]*domain.TranscodeRequest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	requests := collect(r.state.transcodes, nil, func(a, b *domain.TranscodeRequest) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		if a.MediaID != b.MediaID {
+			return bytes.Compare(a.MediaID[:], b.MediaID[:]) < 0
+		}
+		return a.Key < b.Key
+	})
+	return page(requests, limit, offset), nil
+}
+
+// SetTranscodePriority records the priority a requested transcode was
+// given.
+func (r *LibraryRepository) SetTranscodePriority(
+	_ context.Context,
+	mediaID uuid.UUID,
+	key string,
+	priority domain.TranscodePriority,
+) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := transcodeKey{mediaID, key}
+	stored, ok := r.state.transcodes[k]
+	if !ok {
+		return pkgerrors.NotFound("transcode request not found")
+	}
+	req := clone(stored)
+	req.Priority = priority
+	r.state.transcodes[k] = req
+	return nil
+}
+
+// GetTranscodePrioritySignals returns what hints at each of the media being
+// watched soon, in the order of mediaIDs.
+func (r *LibraryRepository) GetTranscodePrioritySignals(
+	_ context.Context,
+	mediaIDs []uuid.UUID,
+	since time.Time,
+) ([]*domain.TranscodePrioritySignals, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(mediaIDs) == 0 {
+		return nil, nil
+	}
+
+	signals := make([]*domain.TranscodePrioritySignals, 0, len(mediaIDs))
+	for _, id := range mediaIDs {
+		m, ok := r.state.media[id]
+		if !ok {
+			continue
+		}
+
+		s := &domain.TranscodePrioritySignals{MediaID: id, AddedAt: m.CreatedAt, Genres: slices.Clone(m.Genres)}
+		for key := range r.state.watchlist {
+			if key.mediaID == id {
+				s.Watchlisted++
+			}
+		}
+		watching := make(map[uuid.UUID]bool)
+		plays := make(map[uuid.UUID]bool)
+		for _, w := range r.state.watchStates {
+			if w.MediaID != id || w.LastWatched.Before(since) {
+				continue
+			}
+			plays[w.UserID] = true
+			if w.EpisodeID != nil {
+				watching[w.UserID] = true
+			}
+		}
+		s.Watching = int64(len(watching))
+		s.Plays = int64(len(plays))
+		signals = append(signals, s)
+	}
+	return signals, nil
+}
+
+// ListPopularGenres lists the genres of the media most users watched since
+// since, most watched first.
+func (r *LibraryRepository) ListPopularGenres(_ context.Context, since time.Time, limit int) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	viewers := make(map[string]map[uuid.UUID]bool)
+	for _, w := range r.state.watchStates {
+		m, ok := r.state.media[w.MediaID]
+		if !ok || w.LastWatched.Before(since) {
+			continue
+		}
+		for _, genre := range m.Genres {
+			if viewers[genre] == nil {
+				viewers[genre] = make(map[uuid.UUID]bool)
+			}
+			viewers[genre][w.UserID] = true
+		}
+	}
+
+	genres := slices.Collect(maps.Keys(viewers))
+	sort.Slice(genres, func(i, j int) bool {
+		if len(viewers[genres[i]]) != len(viewers[genres[j]]) {
+			return len(viewers[genres[i]]) > len(viewers[genres[j]])
+		}
+		return genres[i] < genres[j]
+	})
+	return page(genres, limit, 0), nil
+}
+
+// GetTranscodeOutput retrieves the completed transcode of a source with a
+// profile.
+func (r *LibraryRepository) GetTranscodeOutput(
+	_ context.Context,
+	sourceHash, profileHash string,
+) (*domain.TranscodeOutput, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	output, ok := r.state.outputs[transcodeOutputKey{sourceHash, profileHash}]
+	if !ok {
+		return nil, pkgerrors.NotFound("transcode output not found")
+	}
+	return clone(output), nil
+}
+
+// SaveTranscodeOutput records a completed transcode, replacing the one of
+// the same source and profile.
+func (r *LibraryRepository) SaveTranscodeOutput(_ context.Context, output *domain.TranscodeOutput) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.state.outputs[transcodeOutputKey{output.SourceHash, output.ProfileHash}] = clone(output)
+	return nil
+}
+
+// DeleteTranscodeOutput deletes the completed transcode of a source with a
+// profile.
+func (r *LibraryRepository) DeleteTranscodeOutput(_ context.Context, sourceHash, profileHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.state.outputs, transcodeOutputKey{sourceHash, profileHash})
+	return nil
+}
+
+// InvalidateTranscodeOutputs deletes the transcodes of a media item made
+// from a source other than keepSourceHash; empty deletes them all.
+func (r *LibraryRepository) InvalidateTranscodeOutputs(
+	_ context.Context,
+	mediaID uuid.UUID,
+	keepSourceHash string,
+) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deleted := 0
+	for k, output := range r.state.outputs {
+		if output.MediaID == mediaID && output.SourceHash != keepSourceHash {
+			delete(r.state.outputs, k)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// GetLoudnessMeasurement retrieves the measured loudness of a source.
+func (r *LibraryRepository) GetLoudnessMeasurement(
+	_ context.Context,
+	sourceHash string,
+) (*domain.LoudnessMeasurement, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	measurement, ok := r.state.loudness[sourceHash]
+	if !ok {
+		return nil, pkgerrors.NotFound("loudness measurement not found")
+	}
+	return clone(measurement), nil
+}
+
+// SaveLoudnessMeasurement records the measured loudness of a source,
+// replacing the one measured before.
+func (r *LibraryRepository) SaveLoudnessMeasurement(_ context.Context, measurement *domain.LoudnessMeasurement) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.state.loudness[measurement.SourceHash] = clone(measurement)
+	return nil
+}
+
+// Tasks
+
+func cloneTask(t *task.Task) *task.Task {
+	c := clone(t)
+	c.Payload = maps.Clone(t.Payload)
+	c.Logs = slices.Clone(t.Logs)
+	return c
+}
+
+// CreateTask records a new task.
+func (r *LibraryRepository) CreateTask(_ context.Context, t *task.Task) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.state.tasks[t.ID]; ok {
+		return pkgerrors.Conflict("task already exists")
+	}
+	now := time.Now()
+	stamp(&t.CreatedAt, now)
+	stamp(&t.UpdatedAt, now)
+	r.state.tasks[t.ID] = cloneTask(t)
+	return nil
+}
+
+// UpdateTask saves the progress of a task.
+func (r *LibraryRepository) UpdateTask(_ context.Context, t *task.Task) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t.UpdatedAt = time.Now()
+	r.state.tasks[t.ID] = cloneTask(t)
+	return nil
+}
+
+// GetTask gets a task by ID.
+func (r *LibraryRepository) GetTask(_ context.Context, id uuid.UUID) (*task.Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.state.tasks[id]
+	if !ok {
+		return nil, pkgerrors.NotFound("task not found")
+	}
+	return cloneTask(t), nil
+}
+
+// ListTasks lists tasks, newest first.
+func (r *LibraryRepository) ListTasks(_ context.Context, filter task.Filter, limit, offset int) ([]*task.Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tasks := collect(r.state.tasks, func(t *task.Task) bool {
+		return (filter.Type == "" || t.Type == filter.Type) && (filter.Status == "" || t.Status == filter.Status)
+	}, func(a, b *task.Task) bool { return a.CreatedAt.After(b.CreatedAt) })
+
+	tasks = page(tasks, limit, offset)
+	for i, t := range tasks {
+		tasks[i] = cloneTask(t)
+	}
+	return tasks, nil
+}
+
+// InterruptTasks fails every task that is still pending or running.
+func (r *LibraryRepository) InterruptTasks(_ context.Context, reason string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	interrupted := 0
+	for id, t := range r.state.tasks {
+		if t.Status == task.StatusPending || t.Status == task.StatusRunning {
+			t = cloneTask(t)
+			t.Status = task.StatusFailed
+			t.Error = reason
+			t.CompletedAt = &now
+			t.UpdatedAt = now
+			r.state.tasks[id] = t
+			interrupted++
+		}
+	}
+	return interrupted, nil
+}
+
+// Search index
+
+// searchWords splits text into the lower-case words the search index
+// matches.
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsNumber(c)
+	})
+}
+
+// matches reports whether the document has every word of a query.
+func (d *searchDocument) matches(query string) bool {
+	words := searchWords(query)
+	if d == nil || len(words) == 0 {
+		return false
+	}
+	for _, word := range words {
+		if !d.words[word] {
+			return false
+		}
+	}
+	return true
+}
+
+// IndexMedia creates or replaces the search documents of media items, from
+// their titles, descriptions, genres and tags.
+func (r *LibraryRepository) IndexMedia(_ context.Context, media []*models.Media) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, m := range media {
+		doc := &searchDocument{words: make(map[string]bool), updatedAt: now}
+		text := strings.Join(append(append([]string{m.Title, m.Description}, m.Genres...), m.Tags...), " ")
+		for _, word := range searchWords(text) {
+			doc.words[word] = true
+		}
+		r.state.searchIndex[m.ID] = doc
+	}
+	return nil
+}
+
+// RemoveFromSearchIndex removes the search document of a media item.
+func (r *LibraryRepository) RemoveFromSearchIndex(_ context.Context, mediaID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.state.searchIndex, mediaID)
+	return nil
+}
+
+// PruneSearchIndex removes the search documents last indexed before the
+// given time.
+func (r *LibraryRepository) PruneSearchIndex(_ context.Context, before time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pruned := 0
+	for id, doc := range r.state.searchIndex {
+		if doc.updatedAt.Before(before) {
+			delete(r.state.searchIndex, id)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+// Indexed reports whether a media item has a search document.
+func (r *LibraryRepository) Indexed(mediaID uuid.UUID) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.state.searchIndex[mediaID]
+	return ok
+}
+
+// Storage usage
+
+// RefreshStorageUsage replaces the storage usage of a library with totals
+// computed from its media files.
+func (r *LibraryRepository) RefreshStorageUsage(_ context.Context, libraryID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var tenantID uuid.UUID
+	if library, ok := r.state.libraries[libraryID]; ok {
+		tenantID = library.TenantID
+	}
+
+	type group struct{ mediaType, resolution string }
+	totals := make(map[group]*domain.StorageUsage)
+	now := time.Now()
+	for _, m := range r.state.media {
+		if m.LibraryID != libraryID || m.FilePath == "" {
+			continue
+		}
+		g := group{string(m.Type), m.Resolution}
+		if g.resolution == "" {
+			g.resolution = domain.ResolutionUnknown
+		}
+		if totals[g] == nil {
+			totals[g] = &domain.StorageUsage{
+				LibraryID:  libraryID,
+				TenantID:   tenantID,
+				MediaType:  g.mediaType,
+				Resolution: g.resolution,
+				UpdatedAt:  now,
+			}
+		}
+		totals[g].FileCount++
+		totals[g].TotalBytes += m.FileSize
+	}
+
+	r.state.storage[libraryID] = slices.Collect(maps.Values(totals))
+	return nil
+}
+
+// DeleteStorageUsage removes the storage usage of a library.
+func (r *LibraryRepository) DeleteStorageUsage(_ context.Context, libraryID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.state.storage, libraryID)
+	return nil
+}
+
+// ListStorageUsage returns the storage usage of a library, or of every
+// library if libraryID is nil.
+func (r *LibraryRepository) ListStorageUsage(_ context.Context, libraryID *uuid.UUID) ([]*domain.StorageUsage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	usage := make([]*domain.StorageUsage, 0)
+	for id, groups := range r.state.storage {
+		if libraryID != nil && id != *libraryID {
+			continue
+		}
+		for _, u := range groups {
+			usage = append(usage, clone(u))
+		}
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		a, b := usage[i], usage[j]
+		if a.LibraryID != b.LibraryID {
+			return bytes.Compare(a.LibraryID[:], b.LibraryID[:]) < 0
+		}
+		if a.MediaType != b.MediaType {
+			return a.MediaType < b.MediaType
+		}
+		return a.Resolution < b.Resolution
+	})
+	return usage, nil
+}
+
+// ListPruneItems lists the media items with a file of a library, or of
+// every library if libraryID is nil, except extras, with when anyone last
+// watched them.
+func (r *LibraryRepository) ListPruneItems(_ context.Context, libraryID *uuid.UUID) ([]domain.PruneItem, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	media := collect(r.state.media, func(m *models.Media) bool {
+		return m.FilePath != "" && m.ParentID == nil && (libraryID == nil || m.LibraryID == *libraryID)
+	}, func(a, b *models.Media) bool {
+		if a.Title != b.Title {
+			return a.Title < b.Title
+		}
+		return bytes.Compare(a.ID[:], b.ID[:]) < 0
+	})
+
+	items := make([]domain.PruneItem, len(media))
+	for i, m := range media {
+		items[i] = domain.PruneItem{Media: m}
+		last := func(at time.Time) {
+			if items[i].LastViewedAt == nil || at.After(*items[i].LastViewedAt) {
+				items[i].LastViewedAt = &at
+			}
+		}
+		for _, v := range r.state.viewings {
+			if v.MediaID == m.ID {
+				last(v.LastHeartbeat)
+			}
+		}
+		for _, w := range r.state.watchStates {
+			if w.MediaID == m.ID {
+				last(w.LastWatched)
+			}
+		}
+	}
+	return items, nil
+}
+
+// Hooks
+
+// ListHookStates returns whether each hook that was enabled or disabled is
+// enabled, by hook name.
+func (r *LibraryRepository) ListHookStates(context.Context) (map[string]bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return maps.Clone(r.state.hookStates), nil
+}
+
+// SetHookEnabled enables or disables a hook.
+func (r *LibraryRepository) SetHookEnabled(_ context.Context, name string, enabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.state.hookStates[name] = enabled
+	return nil
+}
+
+// CreateHookRun records a run of a hook.
+func (r *LibraryRepository) CreateHookRun(_ context.Context, run *domain.HookRun) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if run.ID == uuid.Nil {
+		run.ID = uuid.New()
+	}
+	r.state.hookRuns[run.ID] = clone(run)
+	return nil
+}
+
+// ListHookRuns lists the most recent runs of a hook, or of every hook if
+// name is empty, newest first.
+func (r *LibraryRepository) ListHookRuns(_ context.Context, name string, limit int) ([]*domain.HookRun, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	runs := collect(r.state.hookRuns,
+		func(run *domain.HookRun) bool { return name == "" || run.Hook == name },
+		func(a, b *domain.HookRun) bool { return a.StartedAt.After(b.StartedAt) })
+	return page(runs, limit, 0), nil
+}
+
+// DeleteHookRunsBefore deletes hook runs started before a time.
+func (r *LibraryRepository) DeleteHookRunsBefore(_ context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	for id, run := range r.state.hookRuns {
+		if run.StartedAt.Before(before) {
+			delete(r.state.hookRuns, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Worker pools
+
+// ListWorkerPoolSizes returns the size of each worker pool that was resized,
+// by pool name.
+func (r *LibraryRepository) ListWorkerPoolSizes(context.Context) (map[string]int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return maps.Clone(r.state.poolSizes), nil
+}
+
+// SetWorkerPoolSize records the size of a worker pool.
+func (r *LibraryRepository) SetWorkerPoolSize(_ context.Context, name string, size int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.state.poolSizes[name] = size
+	return nil
+}
+
+// Feeds
+
+func cloneFeed(f *domain.Feed) *domain.Feed {
+	c := clone(f)
+	c.Qualities = slices.Clone(f.Qualities)
+	return c
+}
+
+// CreateFeed creates a feed.
+func (r *LibraryRepository) CreateFeed(_ context.Context, feed *domain.Feed) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if feed.ID == uuid.Nil {
+		feed.ID = uuid.New()
+	}
+	now := time.Now()
+	stamp(&feed.CreatedAt, now)
+	stamp(&feed.UpdatedAt, now)
+	r.state.feeds[feed.ID] = cloneFeed(feed)
+	return nil
+}
+
+// GetFeed retrieves a feed by ID.
+func (r *LibraryRepository) GetFeed(_ context.Context, id uuid.UUID) (*domain.Feed, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, ok := r.state.feeds[id]
+	if !ok {
+		return nil, pkgerrors.NotFound("feed not found")
+	}
+	return cloneFeed(f), nil
+}
+
+// ListFeeds lists the feeds of a library, or of every library if libraryID
+// is nil, oldest first.
+func (r *LibraryRepository) ListFeeds(_ context.Context, libraryID *uuid.UUID) ([]*domain.Feed, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	feeds := collect(r.state.feeds,
+		func(f *domain.Feed) bool { return libraryID == nil || f.LibraryID == *libraryID },
+		func(a, b *domain.Feed) bool { return a.CreatedAt.Before(b.CreatedAt) })
+	for i, f := range feeds {
+		feeds[i] = cloneFeed(f)
+	}
+	return feeds, nil
+}
+
+// UpdateFeed updates the settings of a feed.
+func (r *LibraryRepository) UpdateFeed(_ context.Context, feed *domain.Feed) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.state.feeds[feed.ID]
+	if !ok {
+		return pkgerrors.NotFound("feed not found")
+	}
+	f := cloneFeed(stored)
+	f.Name = feed.Name
+	f.URL = feed.URL
+	f.Include = feed.Include
+	f.Exclude = feed.Exclude
+	f.Qualities = slices.Clone(feed.Qualities)
+	f.DownloadClient = feed.DownloadClient
+	f.Enabled = feed.Enabled
+	f.UpdatedAt = time.Now()
+	r.state.feeds[f.ID] = f
+	return nil
+}
+
+// DeleteFeed deletes a feed. Its grabs are kept.
+func (r *LibraryRepository) DeleteFeed(_ context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.state.feeds[id]; !ok {
+		return pkgerrors.NotFound("feed not found")
+	}
+	delete(r.state.feeds, id)
+	return nil
+}
+
+// SetFeedPolled records a poll of a feed and its error, if any.
+func (r *LibraryRepository) SetFeedPolled(_ context.Context, id uuid.UUID, polledAt time.Time, lastError string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if stored, ok := r.state.feeds[id]; ok {
+		f := cloneFeed(stored)
+		f.LastPolledAt = &polledAt
+		f.LastError = lastError
+		r.state.feeds[id] = f
+	}
+	return nil
+}
+
+// ClaimFeedItem records a grab unless its release was grabbed before.
+func (r *LibraryRepository) ClaimFeedItem(_ context.Context, grab *domain.FeedGrab) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.state.grabs[grab.Key]; ok {
+		return false, nil
+	}
+	r.state.grabs[grab.Key] = &domain.FeedGrab{
+		FeedID:    grab.FeedID,
+		Key:       grab.Key,
+		Title:     grab.Title,
+		GrabbedAt: grab.GrabbedAt,
+	}
+	return true, nil
+}
+
+// UpdateFeedGrab records the download client and download of a grab.
+func (r *LibraryRepository) UpdateFeedGrab(_ context.Context, grab *domain.FeedGrab) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if stored, ok := r.state.grabs[grab.Key]; ok {
+		g := clone(stored)
+		g.DownloadClient = grab.DownloadClient
+		g.DownloadID = grab.DownloadID
+		r.state.grabs[g.Key] = g
+	}
+	return nil
+}
+
+// ReleaseFeedItem forgets a grab, so its release is grabbed again.
+func (r *LibraryRepository) ReleaseFeedItem(_ context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.state.grabs, key)
+	return nil
+}
+
+// GrabbedFeedItems returns which of the keys were grabbed.
+func (r *LibraryRepository) GrabbedFeedItems(_ context.Context, keys []string) (map[string]bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	grabbed := make(map[string]bool)
+	for _, key := range keys {
+		if _, ok := r.state.grabs[key]; ok {
+			grabbed[key] = true
+		}
+	}
+	return grabbed, nil
+}
+
+// Calendar and wanted media
+
+// ListCalendar lists the episode air dates and movie release dates of
+// monitored media in [start, end), ordered by date.
+func (r *LibraryRepository) ListCalendar(
+	_ context.Context,
+	start, end time.Time,
+	libraryID *uuid.UUID,
+) ([]*domain.CalendarEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	inRange := func(t *time.Time) bool { return t != nil && !t.Before(start) && t.Before(end) }
+	inLibrary := func(m *models.Media) bool { return libraryID == nil || m.LibraryID == *libraryID }
+
+	entries := make([]*domain.CalendarEntry, 0)
+	for _, ep := range r.state.episodes {
+		m, ok := r.state.media[ep.MediaID]
+		if !ok || !m.Monitored || !inLibrary(m) || !inRange(&ep.AirDate) {
+			continue
+		}
+		entries = append(entries, &domain.CalendarEntry{
+			Type:          domain.CalendarEntryEpisode,
+			MediaID:       m.ID,
+			LibraryID:     m.LibraryID,
+			Title:         m.Title,
+			EpisodeID:     &ep.ID,
+			SeasonNumber:  ep.SeasonNumber,
+			EpisodeNumber: ep.EpisodeNumber,
+			EpisodeTitle:  ep.Title,
+			Date:          ep.AirDate,
+			Available:     ep.Path != "",
+		})
+	}
+
+	for _, m := range r.state.media {
+		if m.Type != models.MediaTypeMovie || m.ParentID != nil || !m.Monitored || !inLibrary(m) {
+			continue
+		}
+		releases := []struct {
+			entryType domain.CalendarEntryType
+			date      *time.Time
+		}{
+			{domain.CalendarEntryCinemaRelease, &m.ReleaseDate},
+			{domain.CalendarEntryDigitalRelease, m.DigitalReleaseDate},
+			{domain.CalendarEntryPhysicalRelease, m.PhysicalReleaseDate},
+		}
+		for _, release := range releases {
+			if !inRange(release.date) {
+				continue
+			}
+			entries = append(entries, &domain.CalendarEntry{
+				Type:      release.entryType,
+				MediaID:   m.ID,
+				LibraryID: m.LibraryID,
+				Title:     m.Title,
+				Date:      *release.date,
+				Available: m.Status == string(models.MediaStatusAvailable),
+			})
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].Date.Equal(entries[j].Date) {
+			return entries[i].Date.Before(entries[j].Date)
+		}
+		if entries[i].Title != entries[j].Title {
+			return entries[i].Title < entries[j].Title
+		}
+		return entries[i].Type < entries[j].Type
+	})
+	return entries, nil
+}
+
+// GetCalendarFeedKey returns the calendar feed key of a user.
+func (r *LibraryRepository) GetCalendarFeedKey(_ context.Context, userID uuid.UUID) (*domain.CalendarFeedKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k, ok := r.state.feedKeys[userID]
+	if !ok {
+		return nil, pkgerrors.NotFound("calendar feed key not found")
+	}
+	return clone(k), nil
+}
+
+// SetCalendarFeedKey sets the calendar feed key of a user, replacing any
+// set before.
+func (r *LibraryRepository) SetCalendarFeedKey(_ context.Context, key *domain.CalendarFeedKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stamp(&key.CreatedAt, time.Now())
+	r.state.feedKeys[key.UserID] = clone(key)
+	return nil
+}
+
+// wantedEpisodes returns the episodes of monitored series in existing
+// libraries, with the wanted items they stand for, by series and number.
+func (s *libraryState) wantedEpisodes(
+	libraryID *uuid.UUID,
+	keep func(*models.Episode, *domain.Library) bool,
+) []*domain.WantedItem {
+	episodes := collect(s.episodes, func(ep *models.Episode) bool {
+		m, ok := s.media[ep.MediaID]
+		if !ok || !m.Monitored || (libraryID != nil && m.LibraryID != *libraryID) {
+			return false
+		}
+		l, ok := s.libraries[m.LibraryID]
+		return ok && keep(ep, l)
+	}, func(a, b *models.Episode) bool {
+		if a.MediaID != b.MediaID {
+			return s.media[a.MediaID].Title < s.media[b.MediaID].Title
+		}
+		return byEpisodeNumber(a, b)
+	})
+
+	items := make([]*domain.WantedItem, len(episodes))
+	for i, ep := range episodes {
+		m := s.media[ep.MediaID]
+		item := &domain.WantedItem{
+			MediaID:       m.ID,
+			LibraryID:     m.LibraryID,
+			Title:         m.Title,
+			IMDBID:        m.IMDBID,
+			TVDBID:        m.TVDBID,
+			EpisodeID:     &ep.ID,
+			SeasonNumber:  ep.SeasonNumber,
+			EpisodeNumber: ep.EpisodeNumber,
+			EpisodeTitle:  ep.Title,
+			Cutoff:        s.libraries[m.LibraryID].QualityCutoff,
+		}
+		if !ep.AirDate.IsZero() {
+			item.Date = &ep.AirDate
+		}
+		if ep.Path != "" {
+			// Episodes do not record the resolution of their files
+			item.Quality = domain.ResolutionQuality("")
+		}
+		items[i] = item
+	}
+	return items
+}
+
+// wantedMovies returns the monitored movies in existing libraries, with
+// the wanted items they stand for, by title.
+func (s *libraryState) wantedMovies(
+	libraryID *uuid.UUID,
+	keep func(*models.Media, *domain.Library) bool,
+) []*domain.WantedItem {
+	movies := collect(s.media, func(m *models.Media) bool {
+		if m.Type != models.MediaTypeMovie || m.ParentID != nil || !m.Monitored ||
+			(libraryID != nil && m.LibraryID != *libraryID) {
+			return false
+		}
+		l, ok := s.libraries[m.LibraryID]
+		return ok && keep(m, l)
+	}, byTitle)
+
+	items := make([]*domain.WantedItem, len(movies))
+	for i, m := range movies {
+		item := &domain.WantedItem{
+			MediaID:   m.ID,
+			LibraryID: m.LibraryID,
+			Title:     m.Title,
+			IMDBID:    m.IMDBID,
+			TVDBID:    m.TVDBID,
+			Cutoff:    s.libraries[m.LibraryID].QualityCutoff,
+		}
+		if !m.ReleaseDate.IsZero() {
+			item.Date = &m.ReleaseDate
+		}
+		if m.Status == string(models.MediaStatusAvailable) {
+			item.Quality = domain.ResolutionQuality(m.Resolution)
+		}
+		items[i] = item
+	}
+	return items
+}
+
+// ListMissing lists monitored movies and aired episodes without a file.
+func (r *LibraryRepository) ListMissing(
+	_ context.Context,
+	libraryID *uuid.UUID,
+	airedBefore time.Time,
+) ([]*domain.WantedItem, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	episodes := r.state.wantedEpisodes(libraryID, func(ep *models.Episode, _ *domain.Library) bool {
+		return ep.Path == "" && !ep.AirDate.IsZero() && ep.AirDate.Before(airedBefore)
+	})
+	movies := r.state.wantedMovies(libraryID, func(m *models.Media, _ *domain.Library) bool {
+		return m.Status == string(models.MediaStatusMissing)
+	})
+	return append(episodes, movies...), nil
+}
+
+// ListUpgradeCandidates lists monitored movies and episodes with a file in
+// libraries with a quality cutoff.
+func (r *LibraryRepository) ListUpgradeCandidates(
+	_ context.Context,
+	libraryID *uuid.UUID,
+) ([]*domain.WantedItem, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	episodes := r.state.wantedEpisodes(libraryID, func(ep *models.Episode, l *domain.Library) bool {
+		return ep.Path != "" && l.QualityCutoff != ""
+	})
+	movies := r.state.wantedMovies(libraryID, func(m *models.Media, l *domain.Library) bool {
+		return m.Status == string(models.MediaStatusAvailable) && l.QualityCutoff != ""
+	})
+	return append(episodes, movies...), nil
+}
+
+// GetWantedItem returns a movie or an episode with the quality of its file.
+func (r *LibraryRepository) GetWantedItem(
+	_ context.Context,
+	mediaID uuid.UUID,
+	episodeID *uuid.UUID,
+) (*domain.WantedItem, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var items []*domain.WantedItem
+	if episodeID != nil {
+		items = r.state.wantedEpisodes(nil, func(ep *models.Episode, _ *domain.Library) bool {
+			return ep.ID == *episodeID && ep.MediaID == mediaID
+		})
+	} else {
+		items = r.state.wantedMovies(nil, func(m *models.Media, _ *domain.Library) bool {
+			return m.ID == mediaID
+		})
+	}
+
+	if len(items) == 0 {
+		return nil, pkgerrors.NotFound("monitored movie or episode not found")
+	}
+	return items[0], nil
+}
+
+// Blocklist
+
+func byNewest(a, b *domain.BlocklistEntry) bool { return a.CreatedAt.After(b.CreatedAt) }
+
+// AddBlocklistEntry blocklists a release.
+func (r *LibraryRepository) AddBlocklistEntry(_ context.Context, entry *domain.BlocklistEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if entry.ID == uuid.Nil {
+		entry.ID = uuid.New()
+	}
+	stamp(&entry.CreatedAt, time.Now())
+	r.state.blocklist[entry.ID] = clone(entry)
+	return nil
+}
+
+// ListBlocklist lists a page of blocklist entries, newest first, and the
+// number of entries in all pages.
+func (r *LibraryRepository) ListBlocklist(
+	_ context.Context,
+	limit, offset int,
+) ([]*domain.BlocklistEntry, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries := collect(r.state.blocklist, nil, byNewest)
+	return page(entries, limit, offset), int64(len(entries)), nil
+}
+
+// DeleteBlocklistEntry removes a release from the blocklist.
+func (r *LibraryRepository) DeleteBlocklistEntry(_ context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.state.blocklist[id]; !ok {
+		return pkgerrors.NotFound("blocklist entry not found")
+	}
+	delete(r.state.blocklist, id)
+	return nil
+}
+
+// FindBlocklisted returns the blocklist entries sharing an info hash, a
+// GUID or a title, ignoring case, with any of the releases.
+func (r *LibraryRepository) FindBlocklisted(
+	_ context.Context,
+	releases []domain.ReleaseIdentity,
+) ([]*domain.BlocklistEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hashes, guids, titles := make(map[string]bool), make(map[string]bool), make(map[string]bool)
+	for _, release := range releases {
+		if release.InfoHash != "" {
+			hashes[release.InfoHash] = true
+		}
+		if release.GUID != "" {
+			guids[release.GUID] = true
+		}
+		if release.Title != "" {
+			titles[strings.ToLower(release.Title)] = true
+		}
+	}
+	if len(hashes) == 0 && len(guids) == 0 && len(titles) == 0 {
+		return nil, nil
+	}
+
+	return collect(r.state.blocklist, func(e *domain.BlocklistEntry) bool {
+		return hashes[e.InfoHash] || guids[e.GUID] || titles[strings.ToLower(e.Title)]
+	}, byNewest), nil
+}
+
+// Manual imports
+
+func cloneManualImport(mi *domain.ManualImport) *domain.ManualImport {
+	c := clone(mi)
+	c.Candidates = slices.Clone(mi.Candidates)
+	return c
+}
+
+// CreateManualImport parks a download for an admin to match.
+func (r *LibraryRepository) CreateManualImport(_ context.Context, mi *domain.ManualImport) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if mi.ID == uuid.Nil {
+		mi.ID = uuid.New()
+	}
+	stamp(&mi.CreatedAt, time.Now())
+	r.state.manualImports[mi.ID] = cloneManualImport(mi)
+	return nil
+}
+
+// GetManualImport returns a parked download.
+func (r *LibraryRepository) GetManualImport(_ context.Context, id uuid.UUID) (*domain.ManualImport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	mi, ok := r.state.manualImports[id]
+	if !ok {
+		return nil, pkgerrors.NotFound("manual import not found")
+	}
+	return cloneManualImport(mi), nil
+}
+
+// ListManualImports lists a page of parked downloads, oldest first, and the
+// number of downloads in all pages.
+func (r *LibraryRepository) ListManualImports(
+	_ context.Context,
+	status *domain.ManualImportStatus,
+	limit, offset int,
+) ([]*domain.ManualImport, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	imports := collect(r.state.manualImports,
+		func(mi *domain.ManualImport) bool { return status == nil || mi.Status == *status },
+		func(a, b *domain.ManualImport) bool { return a.CreatedAt.Before(b.CreatedAt) })
+	total := int64(len(imports))
+
+	imports = page(imports, limit, offset)
+	for i, mi := range imports {
+		imports[i] = cloneManualImport(mi)
+	}
+	return imports, total, nil
+}
+
+// ResolveManualImport records the resolution of a pending import. It fails
+// with a conflict if the import was resolved already.
+func (r *LibraryRepository) ResolveManualImport(_ context.Context, mi *domain.ManualImport) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.state.manualImports[mi.ID]
+	if !ok || stored.Status != domain.ManualImportPending {
+		return pkgerrors.Conflict("manual import was resolved already")
+	}
+	c := cloneManualImport(stored)
+	c.Status = mi.Status
+	c.ImportedMediaID = mi.ImportedMediaID
+	c.ResolvedAt = mi.ResolvedAt
+	r.state.manualImports[c.ID] = c
+	return nil
+}
+
+// Playback issues
+
+// CreatePlaybackIssue records a playback issue.
+func (r *LibraryRepository) CreatePlaybackIssue(_ context.Context, issue *domain.PlaybackIssue) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if issue.ID == uuid.Nil {
+		issue.ID = uuid.New()
+	}
+	r.state.playbackIssues[issue.ID] = clone(issue)
+	return nil
+}
+
+// playbackIssueStats aggregates the issues reported since the given time
+// per media, with the flag of the media, if any.
+func (s *libraryState) playbackIssueStats(since time.Time) map[uuid.UUID]*domain.PlaybackIssueStats {
+	stats := make(map[uuid.UUID]*domain.PlaybackIssueStats)
+	sessions := make(map[uuid.UUID]map[string]bool)
+	errorSessions := make(map[uuid.UUID]map[string]bool)
+	decodeErrorSessions := make(map[uuid.UUID]map[string]bool)
+	add := func(sets map[uuid.UUID]map[string]bool, mediaID uuid.UUID, session string) {
+		if sets[mediaID] == nil {
+			sets[mediaID] = make(map[string]bool)
+		}
+		sets[mediaID][session] = true
+	}
+
+	for _, issue := range s.playbackIssues {
+		if issue.ReportedAt.Before(since) {
+			continue
+		}
+		st := stats[issue.MediaID]
+		if st == nil {
+			st = &domain.PlaybackIssueStats{MediaID: issue.MediaID}
+			if flag, ok := s.playbackFlags[issue.MediaID]; ok {
+				st.Flag = clone(flag)
+			}
+			stats[issue.MediaID] = st
+		}
+
+		add(sessions, issue.MediaID, issue.SessionID)
+		st.StallTime += issue.StallDuration
+		switch issue.Kind {
+		case domain.PlaybackIssueStall:
+			st.Stalls++
+			add(errorSessions, issue.MediaID, issue.SessionID)
+		case domain.PlaybackIssueDecodeError:
+			st.DecodeErrors++
+			add(errorSessions, issue.MediaID, issue.SessionID)
+			add(decodeErrorSessions, issue.MediaID, issue.SessionID)
+		case domain.PlaybackIssueBitrateSwitch:
+			st.BitrateSwitches++
+		}
+		if issue.ReportedAt.After(st.LastReportedAt) {
+			st.LastReportedAt = issue.ReportedAt
+		}
+	}
+
+	for id, st := range stats {
+		st.Sessions = int64(len(sessions[id]))
+		st.ErrorSessions = int64(len(errorSessions[id]))
+		st.DecodeErrorSessions = int64(len(decodeErrorSessions[id]))
+	}
+	return stats
+}
+
+// GetPlaybackIssueStats aggregates the issues reported for media since the
+// given time, with its flag, if any.
+func (r *LibraryRepository) GetPlaybackIssueStats(
+	_ context.Context,
+	mediaID uuid.UUID,
+	since time.Time,
+) (*domain.PlaybackIssueStats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if st, ok := r.state.playbackIssueStats(since)[mediaID]; ok {
+		return st, nil
+	}
+	return &domain.PlaybackIssueStats{MediaID: mediaID}, nil
+}
+
+// ListPlaybackIssueStats aggregates the issues reported per media matching
+// the filter, highest error rate first, and returns a page of them and the
+// number of media in all pages.
+func (r *LibraryRepository) ListPlaybackIssueStats(
+	_ context.Context,
+	filter domain.PlaybackIssueFilter,
+	limit, offset int,
+) ([]*domain.PlaybackIssueStats, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := collect(r.state.playbackIssueStats(filter.Since), func(st *domain.PlaybackIssueStats) bool {
+		m, ok := r.state.media[st.MediaID]
+		return ok && (filter.LibraryID == nil || m.LibraryID == *filter.LibraryID) &&
+			(!filter.FlaggedOnly || st.Flag != nil)
+	}, func(a, b *domain.PlaybackIssueStats) bool {
+		rateA := float64(a.ErrorSessions) / float64(a.Sessions)
+		rateB := float64(b.ErrorSessions) / float64(b.Sessions)
+		switch {
+		case rateA != rateB:
+			return rateA > rateB
+		case a.Sessions != b.Sessions:
+			return a.Sessions > b.Sessions
+		}
+		return bytes.Compare(a.MediaID[:], b.MediaID[:]) < 0
+	})
+	return page(stats, limit, offset), int64(len(stats)), nil
+}
+
+// FlagPlayback flags media unless it is flagged already. It reports whether
+// the media was flagged.
+func (r *LibraryRepository) FlagPlayback(_ context.Context, flag *domain.PlaybackFlag) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.state.playbackFlags[flag.MediaID]; ok {
+		return false, nil
+	}
+	r.state.playbackFlags[flag.MediaID] = clone(flag)
+	return true, nil
+}
+
+// ClearPlaybackIssues removes the flag of media and the issues reported for
+// it.
+func (r *LibraryRepository) ClearPlaybackIssues(_ context.Context, mediaID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.state.playbackFlags, mediaID)
+	for id, issue := range r.state.playbackIssues {
+		if issue.MediaID == mediaID {
+			delete(r.state.playbackIssues, id)
+		}
+	}
+	return nil
+}
+
+// Share links
+
+// CreateShareLink creates a share link.
+func (r *LibraryRepository) CreateShareLink(_ context.Context, link *domain.ShareLink) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, l := range r.state.shareLinks {
+		if l.TokenHash == link.TokenHash {
+			return pkgerrors.Conflict("share link token already exists")
+		}
+	}
+	if link.ID == uuid.Nil {
+		link.ID = uuid.New()
+	}
+	stamp(&link.CreatedAt, time.Now())
+	r.state.shareLinks[link.ID] = clone(link)
+	return nil
+}
+
+// GetShareLink retrieves a share link by ID.
+func (r *LibraryRepository) GetShareLink(_ context.Context, id uuid.UUID) (*domain.ShareLink, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	l, ok := r.state.shareLinks[id]
+	if !ok {
+		return nil, pkgerrors.NotFound("share link not found")
+	}
+	return clone(l), nil
+}
+
+// GetShareLinkByTokenHash retrieves the share link of a token.
+func (r *LibraryRepository) GetShareLinkByTokenHash(_ context.Context, tokenHash string) (*domain.ShareLink, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, l := range r.state.shareLinks {
+		if l.TokenHash == tokenHash {
+			return clone(l), nil
+		}
+	}
+	return nil, pkgerrors.NotFound("share link not found")
+}
+
+// ListShareLinks returns a page of the share links matching the filter,
+// newest first, and the number of links in all pages.
+func (r *LibraryRepository) ListShareLinks(
+	_ context.Context,
+	filter domain.ShareLinkFilter,
+	limit, offset int,
+) ([]*domain.ShareLink, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	links := collect(r.state.shareLinks, func(l *domain.ShareLink) bool {
+		return (filter.CreatedBy == nil || l.CreatedBy == *filter.CreatedBy) &&
+			(filter.MediaID == nil || l.MediaID == *filter.MediaID)
+	}, func(a, b *domain.ShareLink) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return bytes.Compare(a.ID[:], b.ID[:]) < 0
+	})
+	return page(links, limit, offset), int64(len(links)), nil
+}
+
+// RevokeShareLink revokes a share link. Revoking a revoked link does
+// nothing.
+func (r *LibraryRepository) RevokeShareLink(_ context.Context, id uuid.UUID, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	l, ok := r.state.shareLinks[id]
+	if !ok {
+		return pkgerrors.NotFound("share link not found")
+	}
+	if l.RevokedAt == nil {
+		c := clone(l)
+		c.RevokedAt = &at
+		r.state.shareLinks[id] = c
+	}
+	return nil
+}
+
+// RecordShareLinkPlay counts a play of a share link and records it, unless
+// the link is no longer active at the time of the play.
+func (r *LibraryRepository) RecordShareLinkPlay(_ context.Context, play *domain.ShareLinkPlay) (*domain.ShareLink, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	l, ok := r.state.shareLinks[play.ShareLinkID]
+	if !ok || l.Status(play.PlayedAt) != domain.ShareLinkActive {
+		return nil, pkgerrors.Conflict("share link is no longer active")
+	}
+	c := clone(l)
+	c.Views++
+	r.state.shareLinks[c.ID] = c
+
+	if play.ID == uuid.Nil {
+		play.ID = uuid.New()
+	}
+	r.state.shareLinkPlays[play.ID] = clone(play)
+	return clone(c), nil
+}
+
+// ListShareLinkPlays returns a page of the plays of a share link, newest
+// first, and the number of plays in all pages.
+func (r *LibraryRepository) ListShareLinkPlays(
+	_ context.Context,
+	linkID uuid.UUID,
+	limit, offset int,
+) ([]*domain.ShareLinkPlay, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	plays := collect(r.state.shareLinkPlays, func(p *domain.ShareLinkPlay) bool {
+		return p.ShareLinkID == linkID
+	}, func(a, b *domain.ShareLinkPlay) bool {
+		if !a.PlayedAt.Equal(b.PlayedAt) {
+			return a.PlayedAt.After(b.PlayedAt)
+		}
+		return bytes.Compare(a.ID[:], b.ID[:]) < 0
+	})
+	return page(plays, limit, offset), int64(len(plays)), nil
+}
+
+// Content requests
+
+// CreateContentRequest stores a pending content request. It fails with a
+// conflict if the title has a request that was not denied.
+func (r *LibraryRepository) CreateContentRequest(_ context.Context, request *domain.ContentRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range r.state.requests {
+		if c.Provider == request.Provider && c.ProviderID == request.ProviderID &&
+			c.Status != domain.ContentRequestDenied {
+			return pkgerrors.Conflict("title has been requested already")
+		}
+	}
+	if request.ID == uuid.Nil {
+		request.ID = uuid.New()
+	}
+	stamp(&request.CreatedAt, time.Now())
+	c := clone(request)
+	c.Seasons = slices.Clone(request.Seasons)
+	r.state.requests[request.ID] = c
+	return nil
+}
+
+// GetContentRequest retrieves a content request by ID.
+func (r *LibraryRepository) GetContentRequest(_ context.Context, id uuid.UUID) (*domain.ContentRequest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.state.requests[id]
+	if !ok {
+		return nil, pkgerrors.NotFound("content request not found")
+	}
+	return clone(c), nil
+}
+
+// GetContentRequestsByProviderIDs returns the requests that were not denied
+// of titles of a provider, by provider ID.
+func (r *LibraryRepository) GetContentRequestsByProviderIDs(
+	_ context.Context,
+	provider string,
+	providerIDs []string,
+) (map[string]*domain.ContentRequest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	requests := make(map[string]*domain.ContentRequest)
+	for _, c := range r.state.requests {
+		if c.Provider == provider && slices.Contains(providerIDs, c.ProviderID) &&
+			c.Status != domain.ContentRequestDenied {
+			requests[c.ProviderID] = clone(c)
+		}
+	}
+	return requests, nil
+}
+
+// ListContentRequests returns a page of the content requests matching the
+// filter, newest first, and the number of requests in all pages.
+func (r *LibraryRepository) ListContentRequests(
+	_ context.Context,
+	filter domain.ContentRequestFilter,
+	limit, offset int,
+) ([]*domain.ContentRequest, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	requests := collect(r.state.requests, func(c *domain.ContentRequest) bool {
+		return (filter.UserID == nil || c.UserID == *filter.UserID) &&
+			(filter.Status == "" || c.Status == filter.Status)
+	}, func(a, b *domain.ContentRequest) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return bytes.Compare(a.ID[:], b.ID[:]) < 0
+	})
+	return page(requests, limit, offset), int64(len(requests)), nil
+}
+
+// ListContentRequestsSince returns the content requests a user made since
+// a time, oldest first.
+func (r *LibraryRepository) ListContentRequestsSince(
+	_ context.Context,
+	userID uuid.UUID,
+	since time.Time,
+) ([]*domain.ContentRequest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return collect(r.state.requests, func(c *domain.ContentRequest) bool {
+		return c.UserID == userID && !c.CreatedAt.Before(since)
+	}, func(a, b *domain.ContentRequest) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return bytes.Compare(a.ID[:], b.ID[:]) < 0
+	}), nil
+}
+
+// DecideContentRequest saves the approval or denial of a content request,
+// unless it is no longer pending.
+func (r *LibraryRepository) DecideContentRequest(_ context.Context, request *domain.ContentRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.state.requests[request.ID]
+	if !ok {
+		return pkgerrors.NotFound("content request not found")
+	}
+	if c.Status != domain.ContentRequestPending {
+		return pkgerrors.Conflict("content request was decided already")
+	}
+	c = clone(c)
+	c.Status = request.Status
+	c.LibraryID = request.LibraryID
+	c.MediaID = request.MediaID
+	c.DecidedBy = request.DecidedBy
+	c.AutoApproved = request.AutoApproved
+	c.Reason = request.Reason
+	c.DecidedAt = request.DecidedAt
+	r.state.requests[c.ID] = c
+	return nil
+}
+
+// MarkContentRequestsAvailable marks the approved content requests of a
+// media item available and returns them.
+func (r *LibraryRepository) MarkContentRequestsAvailable(
+	_ context.Context,
+	mediaID uuid.UUID,
+	at time.Time,
+) ([]*domain.ContentRequest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var requests []*domain.ContentRequest
+	for id, c := range r.state.requests {
+		if c.MediaID == nil || *c.MediaID != mediaID || c.Status != domain.ContentRequestApproved {
+			continue
+		}
+		c = clone(c)
+		c.Status = domain.ContentRequestAvailable
+		c.AvailableAt = &at
+		r.state.requests[id] = c
+		requests = append(requests, clone(c))
+	}
+	return requests, nil
+}
+
+// GetRequestQuotaOverride returns the content request quota an admin set
+// for a user.
+func (r *LibraryRepository) GetRequestQuotaOverride(
+	_ context.Context,
+	userID uuid.UUID,
+) (*domain.RequestQuotaOverride, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	o, ok := r.state.quotaOverrides[userID]
+	if !ok {
+		return nil, pkgerrors.NotFound("request quota override not found")
+	}
+	return clone(o), nil
+}
+
+// SetRequestQuotaOverride sets the content request quota of a user,
+// replacing any set before.
+func (r *LibraryRepository) SetRequestQuotaOverride(_ context.Context, override *domain.RequestQuotaOverride) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stamp(&override.UpdatedAt, time.Now())
+	r.state.quotaOverrides[override.UserID] = clone(override)
+	return nil
+}
+
+// DeleteRequestQuotaOverride returns a user to the content request quota
+// of their roles.
+func (r *LibraryRepository) DeleteRequestQuotaOverride(_ context.Context, userID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.state.quotaOverrides, userID)
+	return nil
+}
+
+// Media issues
+
+// CreateMediaIssue stores a media issue.
+func (r *LibraryRepository) CreateMediaIssue(_ context.Context, issue *domain.MediaIssue) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.state.media[issue.MediaID]; !ok {
+		return pkgerrors.NotFound("media not found")
+	}
+	if issue.ID == uuid.Nil {
+		issue.ID = uuid.New()
+	}
+	stamp(&issue.CreatedAt, time.Now())
+	r.state.issues[issue.ID] = clone(issue)
+	return nil
+}
+
+// GetMediaIssue retrieves a media issue by ID.
+func (r *LibraryRepository) GetMediaIssue(_ context.Context, id uuid.UUID) (*domain.MediaIssue, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i, ok := r.state.issues[id]
+	if !ok {
+		return nil, pkgerrors.NotFound("media issue not found")
+	}
+	return clone(i), nil
+}
+
+// ListMediaIssues returns a page of the media issues matching the filter,
+// newest first, and the number of issues in all pages.
+func (r *LibraryRepository) ListMediaIssues(
+	_ context.Context,
+	filter domain.MediaIssueFilter,
+	limit, offset int,
+) ([]*domain.MediaIssue, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	issues := collect(r.state.issues, func(i *domain.MediaIssue) bool {
+		return (filter.UserID == nil || i.UserID == *filter.UserID) &&
+			(filter.MediaID == nil || i.MediaID == *filter.MediaID) &&
+			(filter.Status == "" || i.Status == filter.Status)
+	}, func(a, b *domain.MediaIssue) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return bytes.Compare(a.ID[:], b.ID[:]) < 0
+	})
+	return page(issues, limit, offset), int64(len(issues)), nil
+}
+
+// ResolveMediaIssue saves the resolution of a media issue, unless it is no
+// longer open.
+func (r *LibraryRepository) ResolveMediaIssue(_ context.Context, issue *domain.MediaIssue) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i, ok := r.state.issues[issue.ID]
+	if !ok {
+		return pkgerrors.NotFound("media issue not found")
+	}
+	if i.Status != domain.IssueOpen {
+		return pkgerrors.Conflict("media issue was resolved already")
+	}
+	i = clone(i)
+	i.Status = issue.Status
+	i.Action = issue.Action
+	i.Resolution = issue.Resolution
+	i.ResolvedBy = issue.ResolvedBy
+	i.ResolvedAt = issue.ResolvedAt
+	r.state.issues[i.ID] = i
+	return nil
+}
+
+// Kiosks
+
+// CreateKiosk creates a kiosk.
+func (r *LibraryRepository) CreateKiosk(_ context.Context, kiosk *domain.Kiosk) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, k := range r.state.kiosks {
+		if k.KeyHash == kiosk.KeyHash {
+			return pkgerrors.Conflict("kiosk key already exists")
+		}
+	}
+	if kiosk.ID == uuid.Nil {
+		kiosk.ID = uuid.New()
+	}
+	stamp(&kiosk.CreatedAt, time.Now())
+	k := clone(kiosk)
+	k.LibraryIDs = slices.Clone(kiosk.LibraryIDs)
+	r.state.kiosks[kiosk.ID] = k
+	return nil
+}
+
+// GetKiosk retrieves a kiosk by ID.
+func (r *LibraryRepository) GetKiosk(_ context.Context, id uuid.UUID) (*domain.Kiosk, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k, ok := r.state.kiosks[id]
+	if !ok {
+		return nil, pkgerrors.NotFound("kiosk not found")
+	}
+	return clone(k), nil
+}
+
+// GetKioskByKeyHash retrieves the kiosk of a key.
+func (r *LibraryRepository) GetKioskByKeyHash(_ context.Context, keyHash string) (*domain.Kiosk, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, k := range r.state.kiosks {
+		if k.KeyHash == keyHash {
+			return clone(k), nil
+		}
+	}
+	return nil, pkgerrors.NotFound("kiosk not found")
+}
+
+// ListKiosks lists the kiosks, newest first.
+func (r *LibraryRepository) ListKiosks(context.Context) ([]*domain.Kiosk, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return collect(r.state.kiosks, nil, func(a, b *domain.Kiosk) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return bytes.Compare(a.ID[:], b.ID[:]) < 0
+	}), nil
+}
+
+// RevokeKiosk revokes a kiosk. Revoking a revoked kiosk does nothing.
+func (r *LibraryRepository) RevokeKiosk(_ context.Context, id uuid.UUID, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k, ok := r.state.kiosks[id]
+	if !ok {
+		return pkgerrors.NotFound("kiosk not found")
+	}
+	if k.RevokedAt == nil {
+		c := clone(k)
+		c.RevokedAt = &at
+		r.state.kiosks[id] = c
+	}
+	return nil
+}
+
+// Viewings
+
+// LatestViewing retrieves the last viewing of a user of a media item, or of
+// an episode of it.
+func (r *LibraryRepository) LatestViewing(
+	_ context.Context,
+	userID, mediaID uuid.UUID,
+	episodeID *uuid.UUID,
+) (*domain.Viewing, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	viewings := collect(r.state.viewings, func(v *domain.Viewing) bool {
+		return v.UserID == userID && v.MediaID == mediaID && sameID(v.EpisodeID, episodeID)
+	}, func(a, b *domain.Viewing) bool { return a.StartedAt.After(b.StartedAt) })
+	if len(viewings) == 0 {
+		return nil, pkgerrors.NotFound("viewing not found")
+	}
+	return viewings[0], nil
+}
+
+// SaveViewing creates a viewing without an ID, or updates it.
+func (r *LibraryRepository) SaveViewing(_ context.Context, viewing *domain.Viewing) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if viewing.ID == uuid.Nil {
+		viewing.ID = uuid.New()
+	}
+	r.state.viewings[viewing.ID] = clone(viewing)
+	return nil
+}
+
+// ListViewings lists the viewings of a media item and its episodes started
+// after since.
+func (r *LibraryRepository) ListViewings(_ context.Context, mediaID uuid.UUID, since time.Time) ([]*domain.Viewing, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.viewingsOf(mediaID, since), nil
+}
+
+func (r *LibraryRepository) viewingsOf(mediaID uuid.UUID, since time.Time) []*domain.Viewing {
+	return collect(r.state.viewings, func(v *domain.Viewing) bool {
+		return v.MediaID == mediaID && !v.StartedAt.Before(since)
+	}, func(a, b *domain.Viewing) bool { return a.StartedAt.Before(b.StartedAt) })
+}
+
+// ListTitleStats aggregates the viewings started since the filter's time
+// per title, including titles nobody watched, and returns a page of them
+// in the order of the filter and the number of titles in all pages.
+// Extras are left out.
+func (r *LibraryRepository) ListTitleStats(
+	_ context.Context,
+	filter domain.AnalyticsFilter,
+	limit, offset int,
+) ([]*domain.TitleStats, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var stats []*domain.TitleStats
+	for _, m := range r.state.media {
+		if m.ParentID != nil || (filter.LibraryID != nil && m.LibraryID != *filter.LibraryID) {
+			continue
+		}
+		s := domain.AggregateViewings(m.ID, r.viewingsOf(m.ID, filter.Since))
+		if filter.Sort == domain.AnalyticsLowestCompletion && s.Viewings == 0 {
+			continue
+		}
+		s.Title = m.Title
+		stats = append(stats, &s)
+	}
+
+	sort.SliceStable(stats, func(i, j int) bool {
+		a, b := stats[i], stats[j]
+		switch filter.Sort {
+		case domain.AnalyticsMostWatched:
+			if a.Viewings != b.Viewings {
+				return a.Viewings > b.Viewings
+			}
+			if a.Completions != b.Completions {
+				return a.Completions > b.Completions
+			}
+		case domain.AnalyticsLowestCompletion:
+			if a.CompletionRate() != b.CompletionRate() {
+				return a.CompletionRate() < b.CompletionRate()
+			}
+			if a.Viewings != b.Viewings {
+				return a.Viewings > b.Viewings
+			}
+		default:
+			if a.Viewings != b.Viewings {
+				return a.Viewings < b.Viewings
+			}
+			if (a.LastViewedAt == nil) != (b.LastViewedAt == nil) {
+				return a.LastViewedAt == nil
+			}
+			if a.LastViewedAt != nil && !a.LastViewedAt.Equal(*b.LastViewedAt) {
+				return a.LastViewedAt.Before(*b.LastViewedAt)
+			}
+		}
+		if a.Title != b.Title {
+			return a.Title < b.Title
+		}
+		return bytes.Compare(a.MediaID[:], b.MediaID[:]) < 0
+	})
+	return page(stats, limit, offset), int64(len(stats)), nil
+}
+
+// AnonymizeViewings moves a user's viewings to a new random user ID.
+func (r *LibraryRepository) AnonymizeViewings(_ context.Context, userID uuid.UUID) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	anonymous := uuid.New()
+	var moved int64
+	for id, v := range r.state.viewings {
+		if v.UserID == userID {
+			v = clone(v)
+			v.UserID = anonymous
+			r.state.viewings[id] = v
+			moved++
+		}
+	}
+	return moved, nil
+}
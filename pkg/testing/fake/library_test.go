@@ -0,0 +1,103 @@
+package fake_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	pkgerrors "github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+	"github.com/narwhalmedia/narwhal/pkg/testing/fake"
+)
+
+func seedLibrary(t *testing.T, repo *fake.LibraryRepository, titles ...string) *domain.Library {
+	t.Helper()
+	ctx := context.Background()
+	library := &domain.Library{Name: "Movies", Path: "/media/movies", Type: "movie", Enabled: true}
+	require.NoError(t, repo.CreateLibrary(ctx, library))
+	for _, title := range titles {
+		require.NoError(t, repo.CreateMedia(ctx, &models.Media{
+			LibraryID: library.ID,
+			Title:     title,
+			Type:      models.MediaTypeMovie,
+			FilePath:  "/media/movies/" + title + ".mkv",
+		}))
+	}
+	return library
+}
+
+func titles(media []*models.Media) []string {
+	titles := make([]string, len(media))
+	for i, m := range media {
+		titles[i] = m.Title
+	}
+	return titles
+}
+
+func TestLibraryRepository_FiltersAndPages(t *testing.T) {
+	repo := fake.NewLibraryRepository()
+	library := seedLibrary(t, repo, "Heat", "Alien", "Brazil", "Casablanca")
+	ctx := context.Background()
+
+	media, err := repo.ListMediaByLibrary(ctx, library.ID, nil, 2, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Brazil", "Casablanca"}, titles(media))
+
+	media, err = repo.SearchMedia(ctx, "a", nil, nil, &library.ID, -1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Alien", "Brazil", "Casablanca", "Heat"}, titles(media))
+
+	media, err = repo.ListMediaByLibrary(ctx, uuid.New(), nil, 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, media)
+}
+
+func TestLibraryRepository_CopiesRecords(t *testing.T) {
+	repo := fake.NewLibraryRepository()
+	seedLibrary(t, repo, "Heat")
+	ctx := context.Background()
+
+	m, err := repo.GetMediaByPath(ctx, "/media/movies/Heat.mkv")
+	require.NoError(t, err)
+	assert.Equal(t, string(models.MediaStatusPending), m.Status)
+	assert.True(t, m.Monitored)
+	m.Title = "Changed"
+
+	stored, err := repo.GetMedia(ctx, m.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Heat", stored.Title)
+
+	err = repo.CreateMedia(ctx, &models.Media{Title: "Heat", FilePath: m.FilePath})
+	assert.True(t, pkgerrors.IsConflict(err))
+	_, err = repo.GetMedia(ctx, uuid.New())
+	assert.True(t, pkgerrors.IsNotFound(err))
+}
+
+func TestLibraryRepository_Transactions(t *testing.T) {
+	repo := fake.NewLibraryRepository()
+	library := seedLibrary(t, repo)
+	ctx := context.Background()
+
+	tx, err := repo.BeginTx(ctx)
+	require.NoError(t, err)
+	require.NoError(t, tx.CreateMedia(ctx, &models.Media{LibraryID: library.ID, Title: "Heat", FilePath: "/media/movies/heat.mkv"}))
+	require.NoError(t, tx.Rollback())
+
+	media, err := repo.ListMediaByLibrary(ctx, library.ID, nil, -1, 0)
+	require.NoError(t, err)
+	assert.Empty(t, media)
+
+	tx, err = repo.BeginTx(ctx)
+	require.NoError(t, err)
+	require.NoError(t, tx.CreateMedia(ctx, &models.Media{LibraryID: library.ID, Title: "Heat", FilePath: "/media/movies/heat.mkv"}))
+	require.NoError(t, tx.Commit())
+
+	media, err = repo.ListMediaByLibrary(ctx, library.ID, nil, -1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Heat"}, titles(media))
+	assert.Error(t, repo.Commit())
+}
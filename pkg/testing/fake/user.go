@@ -0,0 +1,1750 @@
+package fake
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/internal/user/repository"
+	pkgerrors "github.com/narwhalmedia/narwhal/pkg/errors"
+)
+
+// UserRepository is an in-memory repository of the user service. Users
+// and roles refer to their roles, permissions and parents by ID, which are
+// resolved when they are read, as the database joins them.
+type UserRepository struct {
+	mu    sync.Mutex
+	state *userState
+	// parent is the repository a transaction commits to.
+	parent *UserRepository
+}
+
+var _ repository.Repository = (*UserRepository)(nil)
+
+type grantKey struct {
+	userID, libraryID uuid.UUID
+}
+
+type preferenceKey struct {
+	userID uuid.UUID
+	key    string
+}
+
+type sectionKey struct {
+	exportID uuid.UUID
+	name     string
+}
+
+type userState struct {
+	users           map[uuid.UUID]*domain.User
+	userRoles       map[uuid.UUID][]uuid.UUID
+	roles           map[uuid.UUID]*domain.Role
+	rolePermissions map[uuid.UUID][]uuid.UUID
+	roleParents     map[uuid.UUID][]uuid.UUID
+	permissions     map[uuid.UUID]*domain.Permission
+	sessions        map[uuid.UUID]*domain.Session
+	tenants         map[uuid.UUID]*domain.Tenant
+	invites         map[uuid.UUID]*domain.Invite
+	grants          map[grantKey]*domain.LibraryGrant
+	verifications   map[uuid.UUID]*domain.EmailVerification
+	signIns         map[uuid.UUID]*domain.SignIn
+	challenges      map[uuid.UUID]*domain.LoginChallenge
+	identities      map[uuid.UUID]*domain.UserIdentity
+	apiKeys         map[uuid.UUID]*domain.APIKey
+	recoveryCodes   map[uuid.UUID]*domain.RecoveryCode
+	preferences     map[preferenceKey]*domain.UserPreference
+	digests         map[uuid.UUID]*domain.DigestDelivery
+	devices         map[uuid.UUID]*domain.Device
+	impersonations  map[uuid.UUID]*domain.Impersonation
+	featureFlags    map[string]*domain.FeatureFlag
+	documents       map[uuid.UUID]*domain.ConsentDocument
+	consents        map[uuid.UUID]*domain.Consent
+	exports         map[uuid.UUID]*domain.DataExport
+	sections        map[sectionKey]*domain.DataExportSection
+}
+
+func (s *userState) copy() *userState {
+	return &userState{
+		users:           copyMap(s.users),
+		userRoles:       copyMap(s.userRoles),
+		roles:           copyMap(s.roles),
+		rolePermissions: copyMap(s.rolePermissions),
+		roleParents:     copyMap(s.roleParents),
+		permissions:     copyMap(s.permissions),
+		sessions:        copyMap(s.sessions),
+		tenants:         copyMap(s.tenants),
+		invites:         copyMap(s.invites),
+		grants:          copyMap(s.grants),
+		verifications:   copyMap(s.verifications),
+		signIns:         copyMap(s.signIns),
+		challenges:      copyMap(s.challenges),
+		identities:      copyMap(s.identities),
+		apiKeys:         copyMap(s.apiKeys),
+		recoveryCodes:   copyMap(s.recoveryCodes),
+		preferences:     copyMap(s.preferences),
+		digests:         copyMap(s.digests),
+		devices:         copyMap(s.devices),
+		impersonations:  copyMap(s.impersonations),
+		featureFlags:    copyMap(s.featureFlags),
+		documents:       copyMap(s.documents),
+		consents:        copyMap(s.consents),
+		exports:         copyMap(s.exports),
+		sections:        copyMap(s.sections),
+	}
+}
+
+// NewUserRepository creates an empty user repository.
+func NewUserRepository() *UserRepository {
+	return &UserRepository{state: (&userState{}).copy()}
+}
+
+// BeginTx starts a transaction on a copy of the records. Committing it
+// replaces the records of the repository, including changes made outside
+// the transaction since it started.
+func (r *UserRepository) BeginTx(context.Context) (repository.Repository, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &UserRepository{state: r.state.copy(), parent: r}, nil
+}
+
+// Commit applies the changes of a transaction.
+func (r *UserRepository) Commit() error {
+	if r.parent == nil {
+		return errNoTransaction
+	}
+	r.mu.Lock()
+	state := r.state
+	r.mu.Unlock()
+
+	r.parent.mu.Lock()
+	r.parent.state = state
+	r.parent.mu.Unlock()
+	r.parent = nil
+	return nil
+}
+
+// Rollback discards the changes of a transaction.
+func (r *UserRepository) Rollback() error {
+	if r.parent == nil {
+		return errNoTransaction
+	}
+	r.parent = nil
+	return nil
+}
+
+// Users
+
+// storedUser returns the columns of a user, without its roles and
+// sessions.
+func storedUser(u *domain.User) *domain.User {
+	c := clone(u)
+	c.Roles = nil
+	c.Sessions = nil
+	return c
+}
+
+// user returns a copy of a stored user with its roles resolved.
+func (s *userState) user(u *domain.User) *domain.User {
+	c := clone(u)
+	for _, id := range s.userRoles[u.ID] {
+		if role, ok := s.roles[id]; ok {
+			c.Roles = append(c.Roles, *s.role(role, map[uuid.UUID]bool{id: true}))
+		}
+	}
+	return c
+}
+
+func (s *userState) listUsers(keep func(*domain.User) bool, less func(a, b *domain.User) bool) []*domain.User {
+	users := collect(s.users, keep, less)
+	for i, u := range users {
+		users[i] = s.user(u)
+	}
+	return users
+}
+
+// saveRoles stores the roles of a user, creating the roles that do not
+// exist yet.
+func (s *userState) saveRoles(user *domain.User, now time.Time) {
+	ids := make([]uuid.UUID, 0, len(user.Roles))
+	for i := range user.Roles {
+		role := &user.Roles[i]
+		if _, ok := s.roles[role.ID]; !ok {
+			s.createRole(role, now)
+		}
+		if !slices.Contains(ids, role.ID) {
+			ids = append(ids, role.ID)
+		}
+	}
+	s.userRoles[user.ID] = ids
+}
+
+// CreateUser creates a user with its roles. Usernames and emails are
+// unique.
+func (r *UserRepository) CreateUser(_ context.Context, user *domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.state.users {
+		if u.Username == user.Username || u.Email == user.Email {
+			return pkgerrors.Conflict("username or email already exists")
+		}
+	}
+
+	if user.ID == uuid.Nil {
+		user.ID = uuid.New()
+	}
+	now := time.Now()
+	stamp(&user.CreatedAt, now)
+	stamp(&user.UpdatedAt, now)
+	r.state.users[user.ID] = storedUser(user)
+	r.state.saveRoles(user, now)
+	return nil
+}
+
+func (r *UserRepository) findUser(keep func(*domain.User) bool) (*domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.state.users {
+		if keep(u) {
+			return r.state.user(u), nil
+		}
+	}
+	return nil, pkgerrors.NotFound("user not found")
+}
+
+// GetUser retrieves a user by ID with its roles.
+func (r *UserRepository) GetUser(_ context.Context, id uuid.UUID) (*domain.User, error) {
+	return r.findUser(func(u *domain.User) bool { return u.ID == id })
+}
+
+// GetUserByUsername retrieves a user by username with its roles.
+func (r *UserRepository) GetUserByUsername(_ context.Context, username string) (*domain.User, error) {
+	return r.findUser(func(u *domain.User) bool { return u.Username == username })
+}
+
+// GetUserByEmail retrieves a user by email with its roles.
+func (r *UserRepository) GetUserByEmail(_ context.Context, email string) (*domain.User, error) {
+	return r.findUser(func(u *domain.User) bool { return u.Email == email })
+}
+
+// UpdateUser saves a user and replaces its roles.
+func (r *UserRepository) UpdateUser(_ context.Context, user *domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	user.UpdatedAt = now
+	r.state.users[user.ID] = storedUser(user)
+	r.state.saveRoles(user, now)
+	return nil
+}
+
+// DeleteUser deletes a user.
+func (r *UserRepository) DeleteUser(_ context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.state.users[id]; !ok {
+		return pkgerrors.NotFound("user not found")
+	}
+	delete(r.state.users, id)
+	delete(r.state.userRoles, id)
+	return nil
+}
+
+// ListUsers lists a page of users, by creation time.
+func (r *UserRepository) ListUsers(_ context.Context, limit, offset int) ([]*domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return page(r.state.listUsers(nil, byCreation), limit, offset), nil
+}
+
+// ListUsersWithRole lists the users assigned a role, oldest first.
+func (r *UserRepository) ListUsersWithRole(_ context.Context, role string) ([]*domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.state.listUsers(func(u *domain.User) bool { return u.HasRole(role) }, byCreation), nil
+}
+
+func byCreation(a, b *domain.User) bool { return a.CreatedAt.Before(b.CreatedAt) }
+
+// CountUsers counts the users.
+func (r *UserRepository) CountUsers(context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return int64(len(r.state.users)), nil
+}
+
+// UserExists reports whether a user has the username or the email.
+func (r *UserRepository) UserExists(_ context.Context, username, email string) (bool, error) {
+	_, err := r.findUser(func(u *domain.User) bool { return u.Username == username || u.Email == email })
+	return err == nil, nil
+}
+
+// Roles
+
+// role returns a copy of a stored role with its permissions and its
+// parents, skipping any parent already on path so cycles terminate.
+func (s *userState) role(role *domain.Role, path map[uuid.UUID]bool) *domain.Role {
+	c := clone(role)
+	c.Permissions = nil
+	c.Parents = nil
+	for _, id := range s.rolePermissions[role.ID] {
+		if p, ok := s.permissions[id]; ok {
+			c.Permissions = append(c.Permissions, *p)
+		}
+	}
+	for _, id := range s.roleParents[role.ID] {
+		parent, ok := s.roles[id]
+		if !ok || path[id] {
+			continue
+		}
+		path[id] = true
+		c.Parents = append(c.Parents, *s.role(parent, path))
+		delete(path, id)
+	}
+	return c
+}
+
+// createRole stores a role and creates the permissions it refers to that
+// do not exist yet.
+func (s *userState) createRole(role *domain.Role, now time.Time) {
+	if role.ID == uuid.Nil {
+		role.ID = uuid.New()
+	}
+	stamp(&role.CreatedAt, now)
+	stamp(&role.UpdatedAt, now)
+
+	stored := clone(role)
+	stored.Permissions = nil
+	stored.Parents = nil
+	s.roles[role.ID] = stored
+	s.rolePermissions[role.ID] = nil
+	s.roleParents[role.ID] = nil
+	s.addRoleAssociations(role, now)
+}
+
+// addRoleAssociations adds the permissions and parents of a role to the
+// stored ones.
+func (s *userState) addRoleAssociations(role *domain.Role, now time.Time) {
+	permissions := slices.Clone(s.rolePermissions[role.ID])
+	for i := range role.Permissions {
+		p := &role.Permissions[i]
+		if _, ok := s.permissions[p.ID]; !ok {
+			s.createPermission(p, now)
+		}
+		if !slices.Contains(permissions, p.ID) {
+			permissions = append(permissions, p.ID)
+		}
+	}
+	s.rolePermissions[role.ID] = permissions
+
+	parents := slices.Clone(s.roleParents[role.ID])
+	for _, parent := range role.Parents {
+		if _, ok := s.roles[parent.ID]; ok && !slices.Contains(parents, parent.ID) {
+			parents = append(parents, parent.ID)
+		}
+	}
+	s.roleParents[role.ID] = parents
+}
+
+// CreateRole creates a role. Names are unique.
+func (r *UserRepository) CreateRole(_ context.Context, role *domain.Role) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, ro := range r.state.roles {
+		if ro.Name == role.Name {
+			return pkgerrors.Conflict("role name already exists")
+		}
+	}
+	r.state.createRole(role, time.Now())
+	return nil
+}
+
+func (r *UserRepository) findRole(keep func(*domain.Role) bool) (*domain.Role, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, role := range r.state.roles {
+		if keep(role) {
+			return r.state.role(role, map[uuid.UUID]bool{role.ID: true}), nil
+		}
+	}
+	return nil, pkgerrors.NotFound("role not found")
+}
+
+// GetRole retrieves a role by ID with its permissions and parents.
+func (r *UserRepository) GetRole(_ context.Context, id uuid.UUID) (*domain.Role, error) {
+	return r.findRole(func(role *domain.Role) bool { return role.ID == id })
+}
+
+// GetRoleByName retrieves a role by name with its permissions and parents.
+func (r *UserRepository) GetRoleByName(_ context.Context, name string) (*domain.Role, error) {
+	return r.findRole(func(role *domain.Role) bool { return role.Name == name })
+}
+
+// UpdateRole saves a role. Its permissions and parents are added to the
+// stored ones; removing them takes RemovePermissionsFromRole and
+// SetRoleParents.
+func (r *UserRepository) UpdateRole(_ context.Context, role *domain.Role) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.state.roles[role.ID]; !ok {
+		r.state.createRole(role, time.Now())
+		return nil
+	}
+	now := time.Now()
+	role.UpdatedAt = now
+	stored := clone(role)
+	stored.Permissions = nil
+	stored.Parents = nil
+	r.state.roles[role.ID] = stored
+	r.state.addRoleAssociations(role, now)
+	return nil
+}
+
+// DeleteRole deletes a role.
+func (r *UserRepository) DeleteRole(_ context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.state.roles[id]; !ok {
+		return pkgerrors.NotFound("role not found")
+	}
+	delete(r.state.roles, id)
+	delete(r.state.rolePermissions, id)
+	delete(r.state.roleParents, id)
+	return nil
+}
+
+// ListRoles lists the roles with their permissions and direct parents, by
+// name.
+func (r *UserRepository) ListRoles(context.Context) ([]*domain.Role, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	roles := collect(r.state.roles, nil, func(a, b *domain.Role) bool { return a.Name < b.Name })
+	for i, role := range roles {
+		resolved := r.state.role(role, map[uuid.UUID]bool{role.ID: true})
+		for j := range resolved.Parents {
+			resolved.Parents[j].Permissions = nil
+			resolved.Parents[j].Parents = nil
+		}
+		roles[i] = resolved
+	}
+	return roles, nil
+}
+
+// AssignPermissionsToRole grants existing permissions to a role.
+func (r *UserRepository) AssignPermissionsToRole(_ context.Context, roleID uuid.UUID, permissionIDs []uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	permissions := slices.Clone(r.state.rolePermissions[roleID])
+	for _, id := range permissionIDs {
+		if _, ok := r.state.permissions[id]; ok && !slices.Contains(permissions, id) {
+			permissions = append(permissions, id)
+		}
+	}
+	r.state.rolePermissions[roleID] = permissions
+	return nil
+}
+
+// RemovePermissionsFromRole revokes permissions from a role.
+func (r *UserRepository) RemovePermissionsFromRole(
+	_ context.Context,
+	roleID uuid.UUID,
+	permissionIDs []uuid.UUID,
+) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.state.rolePermissions[roleID] = slices.DeleteFunc(slices.Clone(r.state.rolePermissions[roleID]),
+		func(id uuid.UUID) bool { return slices.Contains(permissionIDs, id) })
+	return nil
+}
+
+// SetRoleParents replaces the roles a role inherits from.
+func (r *UserRepository) SetRoleParents(_ context.Context, roleID uuid.UUID, parentIDs []uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	parents := make([]uuid.UUID, 0, len(parentIDs))
+	for _, id := range parentIDs {
+		if _, ok := r.state.roles[id]; ok && !slices.Contains(parents, id) {
+			parents = append(parents, id)
+		}
+	}
+	r.state.roleParents[roleID] = parents
+	return nil
+}
+
+// Permissions
+
+// createPermission stores a permission, which allows unless it says
+// otherwise.
+func (s *userState) createPermission(permission *domain.Permission, now time.Time) {
+	if permission.ID == uuid.Nil {
+		permission.ID = uuid.New()
+	}
+	if permission.Effect == "" {
+		permission.Effect = domain.EffectAllow
+	}
+	stamp(&permission.CreatedAt, now)
+	stamp(&permission.UpdatedAt, now)
+	s.permissions[permission.ID] = clone(permission)
+}
+
+// CreatePermission creates a permission.
+func (r *UserRepository) CreatePermission(_ context.Context, permission *domain.Permission) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.state.createPermission(permission, time.Now())
+	return nil
+}
+
+// GetPermission retrieves a permission by ID.
+func (r *UserRepository) GetPermission(_ context.Context, id uuid.UUID) (*domain.Permission, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.state.permissions[id]
+	if !ok {
+		return nil, pkgerrors.NotFound("permission not found")
+	}
+	return clone(p), nil
+}
+
+// GetPermissionByResourceAction retrieves the permission allowing an
+// action on a resource.
+func (r *UserRepository) GetPermissionByResourceAction(
+	_ context.Context,
+	resource, action string,
+) (*domain.Permission, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, p := range r.state.permissions {
+		if p.Resource == resource && p.Action == action && p.Effect == domain.EffectAllow {
+			return clone(p), nil
+		}
+	}
+	return nil, pkgerrors.NotFound("permission not found")
+}
+
+// UpdatePermission saves a permission.
+func (r *UserRepository) UpdatePermission(_ context.Context, permission *domain.Permission) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	permission.UpdatedAt = time.Now()
+	r.state.permissions[permission.ID] = clone(permission)
+	return nil
+}
+
+// DeletePermission deletes a permission.
+func (r *UserRepository) DeletePermission(_ context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.state.permissions[id]; !ok {
+		return pkgerrors.NotFound("permission not found")
+	}
+	delete(r.state.permissions, id)
+	return nil
+}
+
+// ListPermissions lists the permissions by resource and action.
+func (r *UserRepository) ListPermissions(context.Context) ([]*domain.Permission, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return collect(r.state.permissions, nil, func(a, b *domain.Permission) bool {
+		if a.Resource != b.Resource {
+			return a.Resource < b.Resource
+		}
+		return a.Action < b.Action
+	}), nil
+}
+
+// Sessions
+
+// CreateSession creates a session.
+func (r *UserRepository) CreateSession(_ context.Context, session *domain.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range r.state.sessions {
+		if s.RefreshToken == session.RefreshToken {
+			return pkgerrors.Conflict("refresh token already exists")
+		}
+	}
+	if session.ID == uuid.Nil {
+		session.ID = uuid.New()
+	}
+	now := time.Now()
+	stamp(&session.CreatedAt, now)
+	stamp(&session.UpdatedAt, now)
+	r.state.sessions[session.ID] = clone(session)
+	return nil
+}
+
+// GetSession retrieves a session by ID.
+func (r *UserRepository) GetSession(_ context.Context, id uuid.UUID) (*domain.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.state.sessions[id]
+	if !ok {
+		return nil, pkgerrors.NotFound("session not found")
+	}
+	return clone(s), nil
+}
+
+// GetSessionByRefreshToken retrieves a session by refresh token.
+func (r *UserRepository) GetSessionByRefreshToken(_ context.Context, refreshToken string) (*domain.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range r.state.sessions {
+		if s.RefreshToken == refreshToken {
+			return clone(s), nil
+		}
+	}
+	return nil, pkgerrors.NotFound("session not found")
+}
+
+// UpdateSession saves a session.
+func (r *UserRepository) UpdateSession(_ context.Context, session *domain.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session.UpdatedAt = time.Now()
+	r.state.sessions[session.ID] = clone(session)
+	return nil
+}
+
+// DeleteSession deletes a session.
+func (r *UserRepository) DeleteSession(_ context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.state.sessions[id]; !ok {
+		return pkgerrors.NotFound("session not found")
+	}
+	delete(r.state.sessions, id)
+	return nil
+}
+
+func (r *UserRepository) deleteSessions(match func(*domain.Session) bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, s := range r.state.sessions {
+		if match(s) {
+			delete(r.state.sessions, id)
+		}
+	}
+}
+
+// DeleteUserSessions deletes the sessions of a user.
+func (r *UserRepository) DeleteUserSessions(_ context.Context, userID uuid.UUID) error {
+	r.deleteSessions(func(s *domain.Session) bool { return s.UserID == userID })
+	return nil
+}
+
+// DeleteDeviceSessions deletes the sessions of a device.
+func (r *UserRepository) DeleteDeviceSessions(_ context.Context, deviceID uuid.UUID) error {
+	r.deleteSessions(func(s *domain.Session) bool { return s.DeviceID != nil && *s.DeviceID == deviceID })
+	return nil
+}
+
+// DeleteExpiredSessions deletes the sessions that expired.
+func (r *UserRepository) DeleteExpiredSessions(context.Context) error {
+	now := time.Now()
+	r.deleteSessions(func(s *domain.Session) bool { return s.ExpiresAt.Before(now) })
+	return nil
+}
+
+// ListUserSessions lists the sessions of a user, oldest first.
+func (r *UserRepository) ListUserSessions(_ context.Context, userID uuid.UUID) ([]*domain.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return collect(r.state.sessions,
+		func(s *domain.Session) bool { return s.UserID == userID },
+		func(a, b *domain.Session) bool { return a.CreatedAt.Before(b.CreatedAt) }), nil
+}
+
+// Tenants
+
+// CreateTenant creates a tenant. Slugs are unique.
+func (r *UserRepository) CreateTenant(_ context.Context, tenant *domain.Tenant) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, t := range r.state.tenants {
+		if t.Slug == tenant.Slug {
+			return pkgerrors.Conflict("tenant slug already exists")
+		}
+	}
+	if tenant.ID == uuid.Nil {
+		tenant.ID = uuid.New()
+	}
+	now := time.Now()
+	stamp(&tenant.CreatedAt, now)
+	stamp(&tenant.UpdatedAt, now)
+	r.state.tenants[tenant.ID] = clone(tenant)
+	return nil
+}
+
+// GetTenant retrieves a tenant by ID.
+func (r *UserRepository) GetTenant(_ context.Context, id uuid.UUID) (*domain.Tenant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.state.tenants[id]
+	if !ok {
+		return nil, pkgerrors.NotFound("tenant not found")
+	}
+	return clone(t), nil
+}
+
+// GetTenantBySlug retrieves a tenant by slug.
+func (r *UserRepository) GetTenantBySlug(_ context.Context, slug string) (*domain.Tenant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, t := range r.state.tenants {
+		if t.Slug == slug {
+			return clone(t), nil
+		}
+	}
+	return nil, pkgerrors.NotFound("tenant not found")
+}
+
+// UpdateTenant saves a tenant.
+func (r *UserRepository) UpdateTenant(_ context.Context, tenant *domain.Tenant) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tenant.UpdatedAt = time.Now()
+	r.state.tenants[tenant.ID] = clone(tenant)
+	return nil
+}
+
+// ListTenants lists a page of tenants, by name.
+func (r *UserRepository) ListTenants(_ context.Context, limit, offset int) ([]*domain.Tenant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tenants := collect(r.state.tenants, nil, func(a, b *domain.Tenant) bool { return a.Name < b.Name })
+	return page(tenants, limit, offset), nil
+}
+
+// Invites
+
+func cloneInvite(i *domain.Invite) *domain.Invite {
+	c := clone(i)
+	c.LibraryIDs = slices.Clone(i.LibraryIDs)
+	return c
+}
+
+// CreateInvite creates an invite.
+func (r *UserRepository) CreateInvite(_ context.Context, invite *domain.Invite) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if invite.ID == uuid.Nil {
+		invite.ID = uuid.New()
+	}
+	now := time.Now()
+	stamp(&invite.CreatedAt, now)
+	stamp(&invite.UpdatedAt, now)
+	r.state.invites[invite.ID] = cloneInvite(invite)
+	return nil
+}
+
+// GetInvite retrieves an invite by ID.
+func (r *UserRepository) GetInvite(_ context.Context, id uuid.UUID) (*domain.Invite, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i, ok := r.state.invites[id]
+	if !ok {
+		return nil, pkgerrors.NotFound("invite not found")
+	}
+	return cloneInvite(i), nil
+}
+
+// GetInviteByTokenHash retrieves an invite by the hash of its token.
+func (r *UserRepository) GetInviteByTokenHash(_ context.Context, tokenHash string) (*domain.Invite, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, i := range r.state.invites {
+		if i.TokenHash == tokenHash {
+			return cloneInvite(i), nil
+		}
+	}
+	return nil, pkgerrors.NotFound("invite not found")
+}
+
+// ListInvites lists a page of invites, newest first.
+func (r *UserRepository) ListInvites(_ context.Context, limit, offset int) ([]*domain.Invite, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	invites := collect(r.state.invites, nil, func(a, b *domain.Invite) bool { return a.CreatedAt.After(b.CreatedAt) })
+	invites = page(invites, limit, offset)
+	for i, invite := range invites {
+		invites[i] = cloneInvite(invite)
+	}
+	return invites, nil
+}
+
+// RevokeInvite revokes a pending invite.
+func (r *UserRepository) RevokeInvite(_ context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.state.invites[id]
+	if !ok || stored.RedeemedAt != nil || stored.RevokedAt != nil {
+		return pkgerrors.Conflict("invite is no longer pending")
+	}
+	now := time.Now()
+	i := cloneInvite(stored)
+	i.RevokedAt = &now
+	i.UpdatedAt = now
+	r.state.invites[id] = i
+	return nil
+}
+
+// MarkInviteRedeemed claims a pending invite for a user.
+func (r *UserRepository) MarkInviteRedeemed(_ context.Context, id, userID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	stored, ok := r.state.invites[id]
+	if !ok || stored.RedeemedAt != nil || stored.RevokedAt != nil || !stored.ExpiresAt.After(now) {
+		return pkgerrors.Conflict("invite is no longer valid")
+	}
+	i := cloneInvite(stored)
+	i.RedeemedAt = &now
+	i.RedeemedBy = &userID
+	i.UpdatedAt = now
+	r.state.invites[id] = i
+	return nil
+}
+
+// Library grants
+
+// CreateLibraryGrants grants users access to libraries. Existing grants
+// are kept.
+func (r *UserRepository) CreateLibraryGrants(_ context.Context, grants []*domain.LibraryGrant) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, g := range grants {
+		key := grantKey{g.UserID, g.LibraryID}
+		if _, ok := r.state.grants[key]; ok {
+			continue
+		}
+		stamp(&g.CreatedAt, now)
+		r.state.grants[key] = clone(g)
+	}
+	return nil
+}
+
+// ListLibraryGrants lists the library grants of a user.
+func (r *UserRepository) ListLibraryGrants(_ context.Context, userID uuid.UUID) ([]*domain.LibraryGrant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return collect(r.state.grants,
+		func(g *domain.LibraryGrant) bool { return g.UserID == userID },
+		func(a, b *domain.LibraryGrant) bool { return a.CreatedAt.Before(b.CreatedAt) }), nil
+}
+
+// Registration
+
+// CreateEmailVerification creates an email verification.
+func (r *UserRepository) CreateEmailVerification(_ context.Context, verification *domain.EmailVerification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if verification.ID == uuid.Nil {
+		verification.ID = uuid.New()
+	}
+	stamp(&verification.CreatedAt, time.Now())
+	r.state.verifications[verification.ID] = clone(verification)
+	return nil
+}
+
+// GetEmailVerificationByTokenHash retrieves an email verification by the
+// hash of its token.
+func (r *UserRepository) GetEmailVerificationByTokenHash(
+	_ context.Context,
+	tokenHash string,
+) (*domain.EmailVerification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, v := range r.state.verifications {
+		if v.TokenHash == tokenHash {
+			return clone(v), nil
+		}
+	}
+	return nil, pkgerrors.NotFound("email verification not found")
+}
+
+// MarkEmailVerificationUsed claims an unused verification token.
+func (r *UserRepository) MarkEmailVerificationUsed(_ context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	stored, ok := r.state.verifications[id]
+	if !ok || stored.UsedAt != nil || !stored.ExpiresAt.After(now) {
+		return pkgerrors.Conflict("verification token is no longer valid")
+	}
+	v := clone(stored)
+	v.UsedAt = &now
+	r.state.verifications[id] = v
+	return nil
+}
+
+// ListPendingApprovals lists a page of the users awaiting approval, oldest
+// first.
+func (r *UserRepository) ListPendingApprovals(_ context.Context, limit, offset int) ([]*domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	users := r.state.listUsers(func(u *domain.User) bool { return u.PendingApproval }, byCreation)
+	return page(users, limit, offset), nil
+}
+
+// Sign-ins
+
+// CreateSignIn records a sign-in.
+func (r *UserRepository) CreateSignIn(_ context.Context, signIn *domain.SignIn) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if signIn.ID == uuid.Nil {
+		signIn.ID = uuid.New()
+	}
+	stamp(&signIn.CreatedAt, time.Now())
+	r.state.signIns[signIn.ID] = clone(signIn)
+	return nil
+}
+
+// ListSignIns returns the latest sign-ins of a user, newest first.
+func (r *UserRepository) ListSignIns(_ context.Context, userID uuid.UUID, limit int) ([]*domain.SignIn, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	signIns := collect(r.state.signIns,
+		func(s *domain.SignIn) bool { return s.UserID == userID },
+		func(a, b *domain.SignIn) bool { return a.CreatedAt.After(b.CreatedAt) })
+	return page(signIns, limit, 0), nil
+}
+
+// CreateLoginChallenge creates a login challenge.
+func (r *UserRepository) CreateLoginChallenge(_ context.Context, challenge *domain.LoginChallenge) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if challenge.ID == uuid.Nil {
+		challenge.ID = uuid.New()
+	}
+	stamp(&challenge.CreatedAt, time.Now())
+	r.state.challenges[challenge.ID] = clone(challenge)
+	return nil
+}
+
+// GetLoginChallenge retrieves a login challenge.
+func (r *UserRepository) GetLoginChallenge(_ context.Context, id uuid.UUID) (*domain.LoginChallenge, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	challenge, ok := r.state.challenges[id]
+	if !ok {
+		return nil, pkgerrors.NotFound("login challenge not found")
+	}
+	return clone(challenge), nil
+}
+
+// UpdateLoginChallenge replaces a login challenge.
+func (r *UserRepository) UpdateLoginChallenge(_ context.Context, challenge *domain.LoginChallenge) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.state.challenges[challenge.ID]; !ok {
+		return pkgerrors.NotFound("login challenge not found")
+	}
+	r.state.challenges[challenge.ID] = clone(challenge)
+	return nil
+}
+
+// Identities
+
+// CreateUserIdentity links a user to an identity. An identity is linked
+// to one user.
+func (r *UserRepository) CreateUserIdentity(_ context.Context, identity *domain.UserIdentity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, i := range r.state.identities {
+		if i.Provider == identity.Provider && i.Subject == identity.Subject {
+			return pkgerrors.Conflict("identity already linked")
+		}
+	}
+	if identity.ID == uuid.Nil {
+		identity.ID = uuid.New()
+	}
+	stamp(&identity.CreatedAt, time.Now())
+	r.state.identities[identity.ID] = clone(identity)
+	return nil
+}
+
+// GetUserIdentity retrieves the identity of a provider with a subject.
+func (r *UserRepository) GetUserIdentity(_ context.Context, provider, subject string) (*domain.UserIdentity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, i := range r.state.identities {
+		if i.Provider == provider && i.Subject == subject {
+			return clone(i), nil
+		}
+	}
+	return nil, pkgerrors.NotFound("user identity not found")
+}
+
+// API keys
+
+// CreateAPIKey creates an API key.
+func (r *UserRepository) CreateAPIKey(_ context.Context, key *domain.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if key.ID == uuid.Nil {
+		key.ID = uuid.New()
+	}
+	stamp(&key.CreatedAt, time.Now())
+	r.state.apiKeys[key.ID] = clone(key)
+	return nil
+}
+
+// GetAPIKey retrieves an API key by ID.
+func (r *UserRepository) GetAPIKey(_ context.Context, id uuid.UUID) (*domain.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k, ok := r.state.apiKeys[id]
+	if !ok {
+		return nil, pkgerrors.NotFound("API key not found")
+	}
+	return clone(k), nil
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of the key.
+func (r *UserRepository) GetAPIKeyByHash(_ context.Context, keyHash string) (*domain.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, k := range r.state.apiKeys {
+		if k.KeyHash == keyHash {
+			return clone(k), nil
+		}
+	}
+	return nil, pkgerrors.NotFound("API key not found")
+}
+
+// ListUserAPIKeys lists the API keys of a user, newest first.
+func (r *UserRepository) ListUserAPIKeys(_ context.Context, userID uuid.UUID) ([]*domain.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return collect(r.state.apiKeys,
+		func(k *domain.APIKey) bool { return k.UserID == userID },
+		func(a, b *domain.APIKey) bool { return a.CreatedAt.After(b.CreatedAt) }), nil
+}
+
+// RevokeAPIKey revokes an API key unless it already is.
+func (r *UserRepository) RevokeAPIKey(_ context.Context, id uuid.UUID, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if stored, ok := r.state.apiKeys[id]; ok && stored.RevokedAt == nil {
+		k := clone(stored)
+		k.RevokedAt = &at
+		r.state.apiKeys[id] = k
+	}
+	return nil
+}
+
+// TouchAPIKey records when an API key was last used.
+func (r *UserRepository) TouchAPIKey(_ context.Context, id uuid.UUID, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if stored, ok := r.state.apiKeys[id]; ok {
+		k := clone(stored)
+		k.LastUsedAt = &at
+		r.state.apiKeys[id] = k
+	}
+	return nil
+}
+
+// Two-factor authentication
+
+// ReplaceRecoveryCodes replaces the recovery codes of a user.
+func (r *UserRepository) ReplaceRecoveryCodes(_ context.Context, userID uuid.UUID, codes []*domain.RecoveryCode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deleteWhere(r.state.recoveryCodes, func(c *domain.RecoveryCode) bool { return c.UserID == userID })
+	now := time.Now()
+	for _, code := range codes {
+		if code.ID == uuid.Nil {
+			code.ID = uuid.New()
+		}
+		stamp(&code.CreatedAt, now)
+		r.state.recoveryCodes[code.ID] = clone(code)
+	}
+	return nil
+}
+
+// UseRecoveryCode marks an unused recovery code of a user as used.
+func (r *UserRepository) UseRecoveryCode(_ context.Context, userID uuid.UUID, codeHash string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, stored := range r.state.recoveryCodes {
+		if stored.UserID == userID && stored.CodeHash == codeHash && stored.UsedAt == nil {
+			c := clone(stored)
+			c.UsedAt = &at
+			r.state.recoveryCodes[id] = c
+			return nil
+		}
+	}
+	return pkgerrors.NotFound("recovery code not found")
+}
+
+// CountRecoveryCodes counts the unused recovery codes of a user.
+func (r *UserRepository) CountRecoveryCodes(_ context.Context, userID uuid.UUID) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	for _, c := range r.state.recoveryCodes {
+		if c.UserID == userID && c.UsedAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// DeleteRecoveryCodes deletes the recovery codes of a user.
+func (r *UserRepository) DeleteRecoveryCodes(_ context.Context, userID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deleteWhere(r.state.recoveryCodes, func(c *domain.RecoveryCode) bool { return c.UserID == userID })
+	return nil
+}
+
+// Preferences
+
+// ListUserPreferences lists the preferences of a user, by key.
+func (r *UserRepository) ListUserPreferences(_ context.Context, userID uuid.UUID) ([]*domain.UserPreference, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return collect(r.state.preferences,
+		func(p *domain.UserPreference) bool { return p.UserID == userID },
+		func(a, b *domain.UserPreference) bool { return a.Key < b.Key }), nil
+}
+
+// SetUserPreferences creates or replaces the values of preferences.
+func (r *UserRepository) SetUserPreferences(_ context.Context, prefs []*domain.UserPreference) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, p := range prefs {
+		key := preferenceKey{p.UserID, p.Key}
+		stored := clone(p)
+		if existing, ok := r.state.preferences[key]; ok {
+			stored.TenantID = existing.TenantID
+		}
+		stamp(&stored.UpdatedAt, now)
+		r.state.preferences[key] = stored
+	}
+	return nil
+}
+
+// DeleteUserPreferences deletes preferences of a user.
+func (r *UserRepository) DeleteUserPreferences(_ context.Context, userID uuid.UUID, keys []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, key := range keys {
+		delete(r.state.preferences, preferenceKey{userID, key})
+	}
+	return nil
+}
+
+// Digests
+
+// GetDigestDelivery returns the last digest delivery of a user.
+func (r *UserRepository) GetDigestDelivery(_ context.Context, userID uuid.UUID) (*domain.DigestDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, ok := r.state.digests[userID]
+	if !ok {
+		return nil, pkgerrors.NotFound("digest delivery not found")
+	}
+	return clone(d), nil
+}
+
+// SaveDigestDelivery creates or replaces the digest delivery of a user.
+func (r *UserRepository) SaveDigestDelivery(_ context.Context, delivery *domain.DigestDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delivery.UpdatedAt = time.Now()
+	r.state.digests[delivery.UserID] = clone(delivery)
+	return nil
+}
+
+// Devices
+
+// CreateDevice registers a device. A user registers a client once.
+func (r *UserRepository) CreateDevice(_ context.Context, device *domain.Device) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, d := range r.state.devices {
+		if d.UserID == device.UserID && d.ClientID == device.ClientID {
+			return pkgerrors.Conflict("device already registered")
+		}
+	}
+	if device.ID == uuid.Nil {
+		device.ID = uuid.New()
+	}
+	if device.DefaultQuality == "" {
+		device.DefaultQuality = "auto"
+	}
+	now := time.Now()
+	stamp(&device.CreatedAt, now)
+	stamp(&device.UpdatedAt, now)
+	r.state.devices[device.ID] = clone(device)
+	return nil
+}
+
+// GetDevice retrieves a device by ID.
+func (r *UserRepository) GetDevice(_ context.Context, id uuid.UUID) (*domain.Device, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, ok := r.state.devices[id]
+	if !ok {
+		return nil, pkgerrors.NotFound("device not found")
+	}
+	return clone(d), nil
+}
+
+// GetDeviceByClientID retrieves the device of a user by client ID.
+func (r *UserRepository) GetDeviceByClientID(
+	_ context.Context,
+	userID uuid.UUID,
+	clientID string,
+) (*domain.Device, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, d := range r.state.devices {
+		if d.UserID == userID && d.ClientID == clientID {
+			return clone(d), nil
+		}
+	}
+	return nil, pkgerrors.NotFound("device not found")
+}
+
+// UpdateDevice saves a device.
+func (r *UserRepository) UpdateDevice(_ context.Context, device *domain.Device) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	device.UpdatedAt = time.Now()
+	r.state.devices[device.ID] = clone(device)
+	return nil
+}
+
+// DeleteDevice deletes a device.
+func (r *UserRepository) DeleteDevice(_ context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.state.devices[id]; !ok {
+		return pkgerrors.NotFound("device not found")
+	}
+	delete(r.state.devices, id)
+	return nil
+}
+
+// ListUserDevices lists the devices of a user, most recently seen first.
+func (r *UserRepository) ListUserDevices(_ context.Context, userID uuid.UUID) ([]*domain.Device, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return collect(r.state.devices,
+		func(d *domain.Device) bool { return d.UserID == userID },
+		func(a, b *domain.Device) bool { return a.LastSeenAt.After(b.LastSeenAt) }), nil
+}
+
+// Impersonations
+
+// CreateImpersonation records an impersonation.
+func (r *UserRepository) CreateImpersonation(_ context.Context, impersonation *domain.Impersonation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if impersonation.ID == uuid.Nil {
+		impersonation.ID = uuid.New()
+	}
+	stamp(&impersonation.CreatedAt, time.Now())
+	r.state.impersonations[impersonation.ID] = clone(impersonation)
+	return nil
+}
+
+// ListImpersonations lists a page of impersonations, newest first. A
+// non-nil userID limits the results to those where the user was the
+// impersonator or target.
+func (r *UserRepository) ListImpersonations(
+	_ context.Context,
+	userID uuid.UUID,
+	limit, offset int,
+) ([]*domain.Impersonation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	impersonations := collect(r.state.impersonations, func(i *domain.Impersonation) bool {
+		return userID == uuid.Nil || i.ImpersonatorID == userID || i.TargetUserID == userID
+	}, func(a, b *domain.Impersonation) bool { return a.CreatedAt.After(b.CreatedAt) })
+	return page(impersonations, limit, offset), nil
+}
+
+// Feature flags
+
+func cloneFeatureFlag(f *domain.FeatureFlag) *domain.FeatureFlag {
+	c := clone(f)
+	c.UserIDs = slices.Clone(f.UserIDs)
+	return c
+}
+
+// CreateFeatureFlag creates a feature flag.
+func (r *UserRepository) CreateFeatureFlag(_ context.Context, flag *domain.FeatureFlag) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.state.featureFlags[flag.Key]; ok {
+		return pkgerrors.Conflict("feature flag already exists")
+	}
+	now := time.Now()
+	stamp(&flag.CreatedAt, now)
+	stamp(&flag.UpdatedAt, now)
+	r.state.featureFlags[flag.Key] = cloneFeatureFlag(flag)
+	return nil
+}
+
+// GetFeatureFlag retrieves a feature flag by key.
+func (r *UserRepository) GetFeatureFlag(_ context.Context, key string) (*domain.FeatureFlag, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, ok := r.state.featureFlags[key]
+	if !ok {
+		return nil, pkgerrors.NotFound("feature flag not found")
+	}
+	return cloneFeatureFlag(f), nil
+}
+
+// UpdateFeatureFlag saves a feature flag.
+func (r *UserRepository) UpdateFeatureFlag(_ context.Context, flag *domain.FeatureFlag) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	flag.UpdatedAt = time.Now()
+	r.state.featureFlags[flag.Key] = cloneFeatureFlag(flag)
+	return nil
+}
+
+// DeleteFeatureFlag deletes a feature flag.
+func (r *UserRepository) DeleteFeatureFlag(_ context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.state.featureFlags[key]; !ok {
+		return pkgerrors.NotFound("feature flag not found")
+	}
+	delete(r.state.featureFlags, key)
+	return nil
+}
+
+// ListFeatureFlags lists the feature flags by key.
+func (r *UserRepository) ListFeatureFlags(context.Context) ([]*domain.FeatureFlag, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	flags := collect(r.state.featureFlags, nil, func(a, b *domain.FeatureFlag) bool { return a.Key < b.Key })
+	for i, f := range flags {
+		flags[i] = cloneFeatureFlag(f)
+	}
+	return flags, nil
+}
+
+// Consents
+
+func byPublication(a, b *domain.ConsentDocument) bool { return a.PublishedAt.After(b.PublishedAt) }
+
+// CreateConsentDocument publishes a document version. A kind has each
+// version once.
+func (r *UserRepository) CreateConsentDocument(_ context.Context, document *domain.ConsentDocument) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, d := range r.state.documents {
+		if d.Kind == document.Kind && d.Version == document.Version {
+			return pkgerrors.Conflict("document version already exists")
+		}
+	}
+	if document.ID == uuid.Nil {
+		document.ID = uuid.New()
+	}
+	stamp(&document.CreatedAt, time.Now())
+	r.state.documents[document.ID] = clone(document)
+	return nil
+}
+
+// GetConsentDocument retrieves a document version by ID.
+func (r *UserRepository) GetConsentDocument(_ context.Context, id uuid.UUID) (*domain.ConsentDocument, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, ok := r.state.documents[id]
+	if !ok {
+		return nil, pkgerrors.NotFound("consent document not found")
+	}
+	return clone(d), nil
+}
+
+// ListConsentDocuments lists document versions newest first. A non-empty
+// kind limits the results to that kind.
+func (r *UserRepository) ListConsentDocuments(_ context.Context, kind string) ([]*domain.ConsentDocument, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return collect(r.state.documents,
+		func(d *domain.ConsentDocument) bool { return kind == "" || d.Kind == kind },
+		byPublication), nil
+}
+
+// ListPendingConsentDocuments lists the latest version of each kind that
+// the user has not accepted, by kind.
+func (r *UserRepository) ListPendingConsentDocuments(
+	_ context.Context,
+	userID uuid.UUID,
+) ([]*domain.ConsentDocument, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	latest := make(map[string]*domain.ConsentDocument)
+	for _, d := range collect(r.state.documents, nil, byPublication) {
+		if _, ok := latest[d.Kind]; !ok {
+			latest[d.Kind] = d
+		}
+	}
+	accepted := make(map[uuid.UUID]bool)
+	for _, c := range r.state.consents {
+		if c.UserID == userID {
+			accepted[c.DocumentID] = true
+		}
+	}
+
+	return collect(latest,
+		func(d *domain.ConsentDocument) bool { return !accepted[d.ID] },
+		func(a, b *domain.ConsentDocument) bool { return a.Kind < b.Kind }), nil
+}
+
+// CreateConsents records acceptances. Documents the user already accepted
+// keep their original record.
+func (r *UserRepository) CreateConsents(_ context.Context, consents []*domain.Consent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, consent := range consents {
+		if r.state.hasConsented(consent.UserID, consent.DocumentID) {
+			continue
+		}
+		if consent.ID == uuid.Nil {
+			consent.ID = uuid.New()
+		}
+		r.state.consents[consent.ID] = clone(consent)
+	}
+	return nil
+}
+
+func (s *userState) hasConsented(userID, documentID uuid.UUID) bool {
+	for _, c := range s.consents {
+		if c.UserID == userID && c.DocumentID == documentID {
+			return true
+		}
+	}
+	return false
+}
+
+// CountConsents counts the acceptances of a document version.
+func (r *UserRepository) CountConsents(_ context.Context, documentID uuid.UUID) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var count int64
+	for _, c := range r.state.consents {
+		if c.DocumentID == documentID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// HasConsented reports whether a user accepted a document version.
+func (r *UserRepository) HasConsented(_ context.Context, userID, documentID uuid.UUID) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.state.hasConsented(userID, documentID), nil
+}
+
+// ListUserConsents lists the acceptances of a user, oldest first.
+func (r *UserRepository) ListUserConsents(_ context.Context, userID uuid.UUID) ([]*domain.Consent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return collect(r.state.consents,
+		func(c *domain.Consent) bool { return c.UserID == userID },
+		func(a, b *domain.Consent) bool { return a.AcceptedAt.Before(b.AcceptedAt) }), nil
+}
+
+// Privacy
+
+func cloneDataExport(e *domain.DataExport) *domain.DataExport {
+	c := clone(e)
+	c.PendingSections = slices.Clone(e.PendingSections)
+	c.MissingSections = slices.Clone(e.MissingSections)
+	c.Archive = slices.Clone(e.Archive)
+	return c
+}
+
+func cloneSection(s *domain.DataExportSection) *domain.DataExportSection {
+	c := clone(s)
+	c.Data = slices.Clone(s.Data)
+	return c
+}
+
+// CreateDataExport creates an export together with the sections that are
+// already known.
+func (r *UserRepository) CreateDataExport(
+	_ context.Context,
+	export *domain.DataExport,
+	sections []*domain.DataExportSection,
+) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if export.ID == uuid.Nil {
+		export.ID = uuid.New()
+	}
+	if export.Status == "" {
+		export.Status = "pending"
+	}
+	now := time.Now()
+	stamp(&export.CreatedAt, now)
+	r.state.exports[export.ID] = cloneDataExport(export)
+	for _, section := range sections {
+		section.ExportID = export.ID
+		stamp(&section.CreatedAt, now)
+		r.state.sections[sectionKey{export.ID, section.Name}] = cloneSection(section)
+	}
+	return nil
+}
+
+// GetDataExport retrieves an export by ID.
+func (r *UserRepository) GetDataExport(_ context.Context, id uuid.UUID) (*domain.DataExport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.state.exports[id]
+	if !ok {
+		return nil, pkgerrors.NotFound("data export not found")
+	}
+	return cloneDataExport(e), nil
+}
+
+// AddDataExportSection stores a section contributed by another service and
+// returns the export with the section no longer pending. A section that
+// arrives twice keeps its first copy.
+func (r *UserRepository) AddDataExportSection(
+	_ context.Context,
+	section *domain.DataExportSection,
+) (*domain.DataExport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.state.exports[section.ExportID]
+	if !ok {
+		return nil, pkgerrors.NotFound("data export not found")
+	}
+
+	key := sectionKey{section.ExportID, section.Name}
+	if _, ok := r.state.sections[key]; !ok {
+		stamp(&section.CreatedAt, time.Now())
+		r.state.sections[key] = cloneSection(section)
+	}
+
+	e := cloneDataExport(stored)
+	e.PendingSections = slices.DeleteFunc(e.PendingSections, func(name string) bool { return name == section.Name })
+	r.state.exports[e.ID] = e
+	return cloneDataExport(e), nil
+}
+
+// ListDataExportSections lists the sections of an export, by name.
+func (r *UserRepository) ListDataExportSections(
+	_ context.Context,
+	exportID uuid.UUID,
+) ([]*domain.DataExportSection, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sections := collect(r.state.sections,
+		func(s *domain.DataExportSection) bool { return s.ExportID == exportID },
+		func(a, b *domain.DataExportSection) bool { return a.Name < b.Name })
+	for i, s := range sections {
+		sections[i] = cloneSection(s)
+	}
+	return sections, nil
+}
+
+// CompleteDataExport saves an assembled export and drops its sections,
+// which the archive now holds.
+func (r *UserRepository) CompleteDataExport(_ context.Context, export *domain.DataExport) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.state.exports[export.ID] = cloneDataExport(export)
+	r.state.deleteSections(export.ID)
+	return nil
+}
+
+func (s *userState) deleteSections(exportID uuid.UUID) {
+	for key := range s.sections {
+		if key.exportID == exportID {
+			delete(s.sections, key)
+		}
+	}
+}
+
+// DeleteExpiredDataExports deletes the exports that expired before the
+// given time, with their sections.
+func (r *UserRepository) DeleteExpiredDataExports(_ context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	for id, e := range r.state.exports {
+		if e.ExpiresAt.Before(before) {
+			delete(r.state.exports, id)
+			r.state.deleteSections(id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// ListUsersDueForDeletion lists users whose account deletion was scheduled
+// before the given time, oldest first.
+func (r *UserRepository) ListUsersDueForDeletion(
+	_ context.Context,
+	before time.Time,
+	limit int,
+) ([]*domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	users := r.state.listUsers(func(u *domain.User) bool {
+		return u.DeletionScheduledAt != nil && !u.DeletionScheduledAt.After(before)
+	}, func(a, b *domain.User) bool { return a.DeletionScheduledAt.Before(*b.DeletionScheduledAt) })
+	return page(users, limit, 0), nil
+}
+
+// PurgeUserData deletes everything stored about a user other than the user
+// itself. The impersonation audit trail is kept, but loses the IP
+// addresses of impersonations the user made.
+func (r *UserRepository) PurgeUserData(_ context.Context, userID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.state
+	deleteWhere(s.sessions, func(v *domain.Session) bool { return v.UserID == userID })
+	deleteWhere(s.devices, func(v *domain.Device) bool { return v.UserID == userID })
+	deleteWhere(s.preferences, func(v *domain.UserPreference) bool { return v.UserID == userID })
+	deleteWhere(s.consents, func(v *domain.Consent) bool { return v.UserID == userID })
+	deleteWhere(s.verifications, func(v *domain.EmailVerification) bool { return v.UserID == userID })
+	deleteWhere(s.signIns, func(v *domain.SignIn) bool { return v.UserID == userID })
+	deleteWhere(s.challenges, func(v *domain.LoginChallenge) bool { return v.UserID == userID })
+	deleteWhere(s.identities, func(v *domain.UserIdentity) bool { return v.UserID == userID })
+	deleteWhere(s.apiKeys, func(v *domain.APIKey) bool { return v.UserID == userID })
+	deleteWhere(s.recoveryCodes, func(v *domain.RecoveryCode) bool { return v.UserID == userID })
+	deleteWhere(s.grants, func(v *domain.LibraryGrant) bool { return v.UserID == userID })
+	delete(s.digests, userID)
+	for id, e := range s.exports {
+		if e.UserID == userID {
+			delete(s.exports, id)
+			s.deleteSections(id)
+		}
+	}
+
+	for id, i := range s.impersonations {
+		if i.ImpersonatorID == userID {
+			i = clone(i)
+			i.IPAddress = ""
+			s.impersonations[id] = i
+		}
+	}
+	return nil
+}
+
+// deleteWhere deletes the records of m that match.
+func deleteWhere[K comparable, T any](m map[K]*T, match func(*T) bool) {
+	for k, v := range m {
+		if match(v) {
+			delete(m, k)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package fake_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/user/domain"
+	pkgerrors "github.com/narwhalmedia/narwhal/pkg/errors"
+	"github.com/narwhalmedia/narwhal/pkg/testing/fake"
+)
+
+func TestUserRepository_ResolvesRoles(t *testing.T) {
+	repo := fake.NewUserRepository()
+	ctx := context.Background()
+
+	viewer := &domain.Role{Name: "viewer", Permissions: []domain.Permission{{Resource: "media", Action: "read"}}}
+	require.NoError(t, repo.CreateRole(ctx, viewer))
+	admin := &domain.Role{Name: "admin"}
+	require.NoError(t, repo.CreateRole(ctx, admin))
+	require.NoError(t, repo.SetRoleParents(ctx, admin.ID, []uuid.UUID{viewer.ID}))
+
+	user := &domain.User{Username: "alice", Email: "alice@example.com", Roles: []domain.Role{*admin}}
+	require.NoError(t, repo.CreateUser(ctx, user))
+	err := repo.CreateUser(ctx, &domain.User{Username: "alice", Email: "other@example.com"})
+	assert.True(t, pkgerrors.IsConflict(err))
+
+	got, err := repo.GetUserByUsername(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, got.Roles, 1)
+	require.Len(t, got.Roles[0].Parents, 1)
+	assert.Equal(t, "viewer", got.Roles[0].Parents[0].Name)
+	assert.True(t, got.HasPermission("media", "read"))
+}
+
+func TestUserRepository_Invites(t *testing.T) {
+	repo := fake.NewUserRepository()
+	ctx := context.Background()
+
+	invite := &domain.Invite{TokenHash: "hash", Role: "viewer", ExpiresAt: time.Now().Add(time.Hour)}
+	require.NoError(t, repo.CreateInvite(ctx, invite))
+	require.NoError(t, repo.MarkInviteRedeemed(ctx, invite.ID, uuid.New()))
+
+	assert.True(t, pkgerrors.IsConflict(repo.MarkInviteRedeemed(ctx, invite.ID, uuid.New())))
+	assert.True(t, pkgerrors.IsConflict(repo.RevokeInvite(ctx, invite.ID)))
+}
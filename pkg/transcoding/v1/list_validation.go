@@ -0,0 +1,60 @@
+package transcodingv1
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Page sizes for ListTranscodingJobs.
+const (
+	DefaultJobsPageSize = 50
+	MaxJobsPageSize     = 500
+)
+
+// ValidateListTranscodingJobsRequest validates the filters of a list request
+// and returns the page size to use.
+func ValidateListTranscodingJobsRequest(req *ListTranscodingJobsRequest) (int32, error) {
+	if req.GetPageSize() < 0 {
+		return 0, errors.New("page size cannot be negative")
+	}
+	if _, ok := SortOrder_name[int32(req.GetSortOrder())]; !ok {
+		return 0, errors.New("invalid sort order")
+	}
+	if err := validateJobFilters(req.GetCreatedAfter(), req.GetCreatedBefore(), req.GetMediaId(), req.GetProfileIds()); err != nil {
+		return 0, err
+	}
+
+	switch size := req.GetPageSize(); {
+	case size == 0:
+		return DefaultJobsPageSize, nil
+	case size > MaxJobsPageSize:
+		return MaxJobsPageSize, nil
+	default:
+		return size, nil
+	}
+}
+
+// ValidateCountTranscodingJobsRequest validates the filters of a count
+// request.
+func ValidateCountTranscodingJobsRequest(req *CountTranscodingJobsRequest) error {
+	return validateJobFilters(req.GetCreatedAfter(), req.GetCreatedBefore(), req.GetMediaId(), req.GetProfileIds())
+}
+
+func validateJobFilters(after, before *timestamppb.Timestamp, mediaID string, profileIDs []string) error {
+	if after != nil && before != nil && !after.AsTime().Before(before.AsTime()) {
+		return errors.New("created_after must be before created_before")
+	}
+	if mediaID != "" {
+		if _, err := uuid.Parse(mediaID); err != nil {
+			return errors.New("invalid media ID")
+		}
+	}
+	for _, id := range profileIDs {
+		if id == "" {
+			return errors.New("profile IDs cannot be empty")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package transcodingv1
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestValidateListTranscodingJobsRequest(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		req      *ListTranscodingJobsRequest
+		wantSize int32
+		wantErr  bool
+	}{
+		{
+			name:     "default page size",
+			req:      &ListTranscodingJobsRequest{},
+			wantSize: DefaultJobsPageSize,
+		},
+		{
+			name:     "page size is capped",
+			req:      &ListTranscodingJobsRequest{PageSize: 10000},
+			wantSize: MaxJobsPageSize,
+		},
+		{
+			name: "filters are valid",
+			req: &ListTranscodingJobsRequest{
+				PageSize:      20,
+				SortOrder:     SortOrder_SORT_ORDER_COMPLETED_DESC,
+				CreatedAfter:  timestamppb.New(now.Add(-time.Hour)),
+				CreatedBefore: timestamppb.New(now),
+				MediaId:       "6f1c1a44-5a8e-4c1e-9b6f-3f4f6f1f2a10",
+				ProfileIds:    []string{"720p"},
+			},
+			wantSize: 20,
+		},
+		{
+			name:    "negative page size is invalid",
+			req:     &ListTranscodingJobsRequest{PageSize: -1},
+			wantErr: true,
+		},
+		{
+			name:    "unknown sort order is invalid",
+			req:     &ListTranscodingJobsRequest{SortOrder: SortOrder(99)},
+			wantErr: true,
+		},
+		{
+			name: "inverted date range is invalid",
+			req: &ListTranscodingJobsRequest{
+				CreatedAfter:  timestamppb.New(now),
+				CreatedBefore: timestamppb.New(now.Add(-time.Hour)),
+			},
+			wantErr: true,
+		},
+		{
+			name:    "malformed media ID is invalid",
+			req:     &ListTranscodingJobsRequest{MediaId: "movie"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			size, err := ValidateListTranscodingJobsRequest(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateListTranscodingJobsRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && size != tt.wantSize {
+				t.Errorf("ValidateListTranscodingJobsRequest() size = %d, want %d", size, tt.wantSize)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter is a fixed-window, per-key rate limiter.
+type RateLimiter struct {
+	limit   int
+	window  time.Duration
+	windows map[string]*rateWindow
+	mu      sync.Mutex
+}
+
+type rateWindow struct {
+	count int
+	reset time.Time
+}
+
+// NewRateLimiter creates a limiter allowing limit events per key per window.
+// A limit of zero or less disables limiting.
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		limit:   limit,
+		window:  window,
+		windows: make(map[string]*rateWindow),
+	}
+}
+
+// Allow records an event for key and reports whether it is within the limit.
+func (l *RateLimiter) Allow(key string) bool {
+	if l.limit <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	w, ok := l.windows[key]
+	if !ok || now.After(w.reset) {
+		l.prune(now)
+		l.windows[key] = &rateWindow{count: 1, reset: now.Add(l.window)}
+		return true
+	}
+
+	if w.count >= l.limit {
+		return false
+	}
+	w.count++
+	return true
+}
+
+// prune drops expired windows. Callers must hold l.mu.
+func (l *RateLimiter) prune(now time.Time) {
+	for key, w := range l.windows {
+		if now.After(w.reset) {
+			delete(l.windows, key)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Package workerpool bounds concurrent work with limits that can be
+// resized while work is running.
+package workerpool
+
+import (
+	"context"
+	"sync"
+)
+
+// Limiter is a semaphore whose limit can change at runtime. Shrinking it
+// does not interrupt work holding a slot: excess holders drain as they
+// release their slots, and waiters are admitted once the work in progress
+// is below the new limit.
+type Limiter struct {
+	mu    sync.Mutex
+	limit int
+	inUse int
+	// changed is closed and replaced whenever a slot may have freed up
+	changed chan struct{}
+}
+
+// NewLimiter creates a limiter admitting limit holders at once.
+func NewLimiter(limit int) *Limiter {
+	return &Limiter{limit: limit, changed: make(chan struct{})}
+}
+
+// Acquire waits for a slot until ctx is done.
+func (l *Limiter) Acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.inUse < l.limit {
+			l.inUse++
+			l.mu.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Release frees a slot taken by Acquire.
+func (l *Limiter) Release() {
+	l.mu.Lock()
+	l.inUse--
+	l.broadcast()
+	l.mu.Unlock()
+}
+
+// SetLimit changes the number of holders admitted at once.
+func (l *Limiter) SetLimit(limit int) {
+	l.mu.Lock()
+	l.limit = limit
+	l.broadcast()
+	l.mu.Unlock()
+}
+
+// Limit returns the number of holders admitted at once.
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// InUse returns the number of slots held, which exceeds the limit while
+// a shrunk limiter drains.
+func (l *Limiter) InUse() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inUse
+}
+
+func (l *Limiter) broadcast() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
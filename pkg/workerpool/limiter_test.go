@@ -0,0 +1,46 @@
+package workerpool_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/pkg/workerpool"
+)
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := workerpool.NewLimiter(2)
+	require.NoError(t, l.Acquire(ctx))
+	require.NoError(t, l.Acquire(ctx))
+
+	// A full limiter makes callers wait
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.Acquire(short), context.DeadlineExceeded)
+
+	// Growing it admits waiters at once
+	acquired := make(chan error, 1)
+	go func() { acquired <- l.Acquire(ctx) }()
+	l.SetLimit(3)
+	require.NoError(t, <-acquired)
+	assert.Equal(t, 3, l.InUse())
+
+	// Shrinking it lets holders drain before admitting anyone
+	l.SetLimit(1)
+	go func() { acquired <- l.Acquire(ctx) }()
+	l.Release()
+	l.Release()
+	select {
+	case <-acquired:
+		t.Fatal("acquired a slot over the limit")
+	case <-time.After(10 * time.Millisecond):
+	}
+	l.Release()
+	require.NoError(t, <-acquired)
+	assert.Equal(t, 1, l.InUse())
+	assert.Equal(t, 1, l.Limit())
+}
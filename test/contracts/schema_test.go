@@ -0,0 +1,30 @@
+// Package contracts holds the contracts between the services, and checks
+// them against their protobuf schemas.
+package contracts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	// Register the schemas of the providers
+	_ "github.com/narwhalmedia/narwhal/pkg/acquisition/v1"
+	_ "github.com/narwhalmedia/narwhal/pkg/auth/v1"
+	_ "github.com/narwhalmedia/narwhal/pkg/events/v1"
+	_ "github.com/narwhalmedia/narwhal/pkg/library/v1"
+	_ "github.com/narwhalmedia/narwhal/pkg/streaming/v1"
+
+	"github.com/narwhalmedia/narwhal/pkg/contract"
+)
+
+// TestSchemas fails when a proto change removes a field a consumer reads,
+// before any provider test runs.
+func TestSchemas(t *testing.T) {
+	dir, err := contract.Dir()
+	require.NoError(t, err)
+	contracts, err := contract.LoadDir(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, contract.CheckSchemas(contracts, protoregistry.GlobalFiles))
+}
@@ -0,0 +1,204 @@
+package load_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/internal/library/repository"
+	"github.com/narwhalmedia/narwhal/pkg/database"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+	"github.com/narwhalmedia/narwhal/pkg/pagination"
+	"github.com/narwhalmedia/narwhal/test/load"
+	"github.com/narwhalmedia/narwhal/test/testutil"
+)
+
+const pageSize = 100
+
+var searchWords = []string{"silent", "river", "night", "empire", "winter", "shadow", "ocean", "storm"}
+
+// seededLibrary is a library of synthetic media in a Postgres container,
+// shared by the scenarios and benchmarks of the package.
+type seededLibrary struct {
+	repo    repository.Repository
+	library *domain.Library
+	items   int
+}
+
+// seeded is the seeded library, if PostgresEnv is set.
+var seeded *seededLibrary
+
+// TestMain seeds the library of the Postgres scenarios once, as seeding
+// takes far longer than any of them.
+func TestMain(m *testing.M) {
+	os.Exit(runWithPostgres(m))
+}
+
+func runWithPostgres(m *testing.M) int {
+	if os.Getenv(load.PostgresEnv) == "" {
+		return m.Run()
+	}
+
+	ctx := context.Background()
+	container, err := testutil.StartPostgresContainer(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer container.Close(ctx)
+
+	if err := database.NewMigrator(container.DB).Migrate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	seeded, err = seedLibrary(ctx, container, load.Scale(100_000))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return m.Run()
+}
+
+// librarySeed returns the seeded library. The scenarios need Docker, so
+// they only run when PostgresEnv is set.
+func librarySeed(tb testing.TB) *seededLibrary {
+	tb.Helper()
+	if seeded == nil {
+		tb.Skipf("set %s=1 to run the library scenarios against Postgres", load.PostgresEnv)
+	}
+	return seeded
+}
+
+func seedLibrary(ctx context.Context, container *testutil.PostgresContainer, items int) (*seededLibrary, error) {
+	repo, err := repository.NewGormRepository(container.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	library := &domain.Library{
+		ID:      uuid.New(),
+		Name:    "Load",
+		Path:    "/load/movies",
+		Type:    "movie",
+		Enabled: true,
+	}
+	if err := repo.CreateLibrary(ctx, library); err != nil {
+		return nil, err
+	}
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	const batchSize = 1000
+	for offset := 0; offset < items; offset += batchSize {
+		batch := make([]*models.Media, 0, batchSize)
+		for i := offset; i < min(offset+batchSize, items); i++ {
+			title := fmt.Sprintf("%s %s %d",
+				searchWords[rng.IntN(len(searchWords))], searchWords[rng.IntN(len(searchWords))], i)
+			batch = append(batch, &models.Media{
+				ID:          uuid.New(),
+				LibraryID:   library.ID,
+				Title:       title,
+				Type:        models.MediaTypeMovie,
+				Status:      "available",
+				FilePath:    fmt.Sprintf("/load/movies/%s/%s.mkv", title, title),
+				FileSize:    rng.Int64N(8 << 30),
+				Description: "A synthetic movie about " + searchWords[rng.IntN(len(searchWords))],
+				Genres:      []string{"Drama"},
+			})
+		}
+		if err := repo.CreateMediaBatch(ctx, batch); err != nil {
+			return nil, err
+		}
+		if err := repo.IndexMedia(ctx, batch); err != nil {
+			return nil, err
+		}
+	}
+	return &seededLibrary{repo: repo, library: library, items: items}, nil
+}
+
+// TestLibraryListing pages through a large library at random offsets,
+// decoding and issuing page tokens like the ListMedia handler.
+func TestLibraryListing(t *testing.T) {
+	lib := librarySeed(t)
+	encoder, err := pagination.NewCursorEncoder(make([]byte, 32))
+	require.NoError(t, err)
+
+	result := load.Run(context.Background(), load.Scenario{
+		Name:    "library_listing",
+		Workers: 16,
+		Ops:     load.Scale(2000),
+		Op: func(ctx context.Context, _, i int) error {
+			token, err := encoder.EncodeCursor(pagination.CreateOffsetCursor(i * 7919 % lib.items))
+			if err != nil {
+				return err
+			}
+			offset, err := pagination.CalculateOffset(encoder, token, 0)
+			if err != nil {
+				return err
+			}
+			if _, err := lib.repo.ListMediaByLibrary(ctx, lib.library.ID, nil, pageSize, offset); err != nil {
+				return err
+			}
+			_, err = pagination.GenerateNextPageToken(encoder, offset, pageSize, lib.items)
+			return err
+		},
+	})
+	t.Log(result)
+
+	require.NoError(t, load.Thresholds{
+		P95:           250 * time.Millisecond,
+		MinThroughput: 100,
+	}.Check(result))
+}
+
+// TestLibrarySearch searches a large library by title and indexed words.
+func TestLibrarySearch(t *testing.T) {
+	lib := librarySeed(t)
+
+	result := load.Run(context.Background(), load.Scenario{
+		Name:    "library_search",
+		Workers: 16,
+		Ops:     load.Scale(1000),
+		Op: func(ctx context.Context, _, i int) error {
+			_, err := lib.repo.SearchMedia(ctx, searchWords[i%len(searchWords)], nil, nil, &lib.library.ID, pageSize, 0)
+			return err
+		},
+	})
+	t.Log(result)
+
+	require.NoError(t, load.Thresholds{
+		P95:           500 * time.Millisecond,
+		MinThroughput: 20,
+	}.Check(result))
+}
+
+func BenchmarkSearchMedia(b *testing.B) {
+	lib := librarySeed(b)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := lib.repo.SearchMedia(ctx, searchWords[i%len(searchWords)], nil, nil, &lib.library.ID, pageSize, 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkListMediaPage(b *testing.B) {
+	lib := librarySeed(b)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		offset := i * pageSize % lib.items
+		if _, err := lib.repo.ListMediaByLibrary(ctx, lib.library.ID, nil, pageSize, offset); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
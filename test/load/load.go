@@ -0,0 +1,177 @@
+// Package load runs reproducible load scenarios against the services and
+// checks their results against thresholds, so performance regressions fail
+// CI like any other test.
+//
+// Scenarios run at a scale of 1 by default, sized to finish in seconds on a
+// CI runner. NARWHAL_LOAD_SCALE multiplies their sizes for local runs, and
+// NARWHAL_LOAD_SLACK loosens every threshold for slow machines. Scenarios
+// are skipped in short mode.
+package load
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Environment variables configuring the scenarios.
+const (
+	// ScaleEnv multiplies the size of the scenarios, such as 10.
+	ScaleEnv = "NARWHAL_LOAD_SCALE"
+	// SlackEnv multiplies the latency thresholds and divides the throughput
+	// thresholds, such as 2 on a slow runner.
+	SlackEnv = "NARWHAL_LOAD_SLACK"
+	// PostgresEnv enables the scenarios that need a Postgres container.
+	PostgresEnv = "NARWHAL_LOAD_POSTGRES"
+)
+
+// Scale returns n multiplied by the scale of the scenarios.
+func Scale(n int) int {
+	return int(math.Ceil(float64(n) * envFloat(ScaleEnv, 1)))
+}
+
+func envFloat(name string, def float64) float64 {
+	v, err := strconv.ParseFloat(os.Getenv(name), 64)
+	if err != nil || v <= 0 {
+		return def
+	}
+	return v
+}
+
+// Scenario is a load scenario: Workers goroutines share Ops operations.
+type Scenario struct {
+	Name    string
+	Workers int
+	Ops     int
+	// Op runs the i-th operation on a worker.
+	Op func(ctx context.Context, worker, i int) error
+}
+
+// Result is the outcome of a scenario.
+type Result struct {
+	Scenario string
+	Ops      int
+	Errors   int
+	// FirstError is the error of the first failed operation.
+	FirstError error
+	Duration   time.Duration
+	// latencies are sorted.
+	latencies []time.Duration
+}
+
+// Run runs a scenario until its operations are done or ctx is cancelled.
+func Run(ctx context.Context, s Scenario) Result {
+	workers := max(s.Workers, 1)
+	latencies := make([][]time.Duration, workers)
+	var next, errs atomic.Int64
+	var firstErr error
+	var errOnce sync.Once
+
+	started := time.Now()
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				i := int(next.Add(1)) - 1
+				if i >= s.Ops {
+					return
+				}
+
+				opStarted := time.Now()
+				err := s.Op(ctx, worker, i)
+				latencies[worker] = append(latencies[worker], time.Since(opStarted))
+				if err != nil {
+					errs.Add(1)
+					errOnce.Do(func() { firstErr = err })
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	r := Result{
+		Scenario:   s.Name,
+		Errors:     int(errs.Load()),
+		FirstError: firstErr,
+		Duration:   time.Since(started),
+		latencies:  slices.Concat(latencies...),
+	}
+	r.Ops = len(r.latencies)
+	slices.Sort(r.latencies)
+	return r
+}
+
+// Percentile returns the latency below which p percent of the operations
+// completed, such as 95.
+func (r Result) Percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p/100*float64(len(r.latencies)))) - 1
+	return r.latencies[min(max(i, 0), len(r.latencies)-1)]
+}
+
+// Throughput returns the operations completed per second.
+func (r Result) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Ops) / r.Duration.Seconds()
+}
+
+// ErrorRate returns the fraction of operations that failed.
+func (r Result) ErrorRate() float64 {
+	if r.Ops == 0 {
+		return 0
+	}
+	return float64(r.Errors) / float64(r.Ops)
+}
+
+// String summarizes the result for test logs.
+func (r Result) String() string {
+	return fmt.Sprintf("%s: %d ops in %s (%.0f ops/s), p50 %s, p95 %s, p99 %s, %d errors",
+		r.Scenario, r.Ops, r.Duration.Round(time.Millisecond), r.Throughput(),
+		r.Percentile(50), r.Percentile(95), r.Percentile(99), r.Errors)
+}
+
+// Thresholds are the limits a result must stay within. Zero limits are not
+// checked.
+type Thresholds struct {
+	P95           time.Duration
+	P99           time.Duration
+	MinThroughput float64 // operations per second
+	MaxErrorRate  float64
+}
+
+// Check returns an error describing every threshold the result exceeds,
+// after applying the slack of the environment and, under the race
+// detector, of its overhead.
+func (t Thresholds) Check(r Result) error {
+	slack := envFloat(SlackEnv, 1) * raceSlack
+	var failures []string
+	if t.P95 > 0 && float64(r.Percentile(95)) > float64(t.P95)*slack {
+		failures = append(failures, fmt.Sprintf("p95 %s above %s", r.Percentile(95), t.P95))
+	}
+	if t.P99 > 0 && float64(r.Percentile(99)) > float64(t.P99)*slack {
+		failures = append(failures, fmt.Sprintf("p99 %s above %s", r.Percentile(99), t.P99))
+	}
+	if t.MinThroughput > 0 && r.Throughput() < t.MinThroughput/slack {
+		failures = append(failures, fmt.Sprintf("throughput %.0f ops/s below %.0f", r.Throughput(), t.MinThroughput))
+	}
+	if r.ErrorRate() > t.MaxErrorRate {
+		failures = append(failures, fmt.Sprintf("error rate %.3f above %.3f (first error: %v)",
+			r.ErrorRate(), t.MaxErrorRate, r.FirstError))
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%s exceeded its thresholds: %v", r.Scenario, failures)
+	}
+	return nil
+}
@@ -0,0 +1,5 @@
+//go:build !race
+
+package load
+
+const raceSlack = 1
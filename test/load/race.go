@@ -0,0 +1,7 @@
+//go:build race
+
+package load
+
+// raceSlack loosens thresholds under the race detector, which slows code
+// down several times.
+const raceSlack = 10
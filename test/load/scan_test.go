@@ -0,0 +1,72 @@
+package load_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/library/domain"
+	"github.com/narwhalmedia/narwhal/pkg/logger"
+	"github.com/narwhalmedia/narwhal/test/load"
+)
+
+// TestScanSyntheticTree scans a synthetic library tree, fully and then
+// incrementally with the manifest of the first scan.
+func TestScanSyntheticTree(t *testing.T) {
+	if testing.Short() {
+		t.Skip("load scenario")
+	}
+
+	root := t.TempDir()
+	paths, err := load.BuildTree(root, load.TreeSpec{
+		Movies:            load.Scale(2000),
+		Shows:             load.Scale(40),
+		SeasonsPerShow:    5,
+		EpisodesPerSeason: 10,
+		Seed:              1,
+	})
+	require.NoError(t, err)
+	movies := filepath.Join(root, "Movies")
+	scanner := domain.NewScanner(logger.NewNoopLogger())
+
+	var scanned int
+	result := load.Run(context.Background(), load.Scenario{
+		Name:    "scan_full",
+		Workers: 1,
+		Ops:     3,
+		Op: func(context.Context, int, int) error {
+			files, err := scanner.ScanDirectory(root, "movie")
+			scanned = len(files)
+			return err
+		},
+	})
+	t.Log(result)
+	require.Len(t, paths, scanned)
+
+	// At least 20k files a second
+	perScan := time.Duration(float64(time.Second) * float64(len(paths)) / 20000)
+	require.NoError(t, load.Thresholds{P95: perScan}.Check(result))
+
+	first, err := scanner.ScanDirectoryIncremental(movies, "movie", nil, nil)
+	require.NoError(t, err)
+	result = load.Run(context.Background(), load.Scenario{
+		Name:    "scan_incremental",
+		Workers: 1,
+		Ops:     3,
+		Op: func(context.Context, int, int) error {
+			scan, err := scanner.ScanDirectoryIncremental(movies, "movie", nil, first.Manifest)
+			if err == nil && len(scan.Files) > 0 {
+				t.Errorf("incremental scan of an unchanged tree found %d files", len(scan.Files))
+			}
+			return err
+		},
+	})
+	t.Log(result)
+
+	// Files of unchanged directories are not stat'ed, so incremental scans
+	// of the movies stay within the budget of a full scan of the tree
+	require.NoError(t, load.Thresholds{P95: perScan}.Check(result))
+}
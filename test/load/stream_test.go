@@ -0,0 +1,172 @@
+package load_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/narwhalmedia/narwhal/internal/streaming/hls"
+	"github.com/narwhalmedia/narwhal/internal/streaming/segmentcache"
+	"github.com/narwhalmedia/narwhal/pkg/logger"
+	"github.com/narwhalmedia/narwhal/test/load"
+)
+
+const (
+	segmentsPerSession = 10
+	// Segments are produced much faster than they play, so blocking
+	// reloads time out after three target durations of a real stream
+	segmentInterval = 2 * time.Millisecond
+	targetDuration  = time.Second
+	segmentBytes    = 256 << 10
+)
+
+// syntheticOrigin serves segments of zeros.
+type syntheticOrigin struct{}
+
+func (syntheticOrigin) FetchSegment(_ context.Context, _ segmentcache.Key) ([]byte, error) {
+	return make([]byte, segmentBytes), nil
+}
+
+// hlsServer serves the live playlists of sessions and their segments from
+// a segment cache, as the streaming service does.
+type hlsServer struct {
+	cache    *segmentcache.Cache
+	mu       sync.Mutex
+	sessions map[string]*hls.LivePlaylist
+}
+
+func (s *hlsServer) start(id string) error {
+	playlist, err := hls.NewLivePlaylist(hls.Config{TargetDuration: targetDuration})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.sessions[id] = playlist
+	s.mu.Unlock()
+
+	// Produce segments like a transcoder running faster than real time
+	go func() {
+		ticker := time.NewTicker(segmentInterval)
+		defer ticker.Stop()
+		for n := 0; n < segmentsPerSession; n++ {
+			<-ticker.C
+			_ = playlist.CompleteSegment(fmt.Sprintf("%d.ts", n), segmentInterval)
+		}
+		playlist.End()
+	}()
+	return nil
+}
+
+func (s *hlsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id, name, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	s.mu.Lock()
+	playlist, ok := s.sessions[id]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if name == "index.m3u8" {
+		playlist.ServeHTTP(w, r)
+		return
+	}
+	index, err := strconv.Atoi(strings.TrimSuffix(name, ".ts"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	data, err := s.cache.Get(r.Context(), segmentcache.Key{StreamID: id, Profile: "1080p", Index: index})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write(data)
+}
+
+// play plays a session like a player: a blocking playlist reload for each
+// segment, then the segment.
+func play(ctx context.Context, client *http.Client, base, id string) error {
+	get := func(url string) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("GET %s: %s", url, resp.Status)
+		}
+		return nil
+	}
+
+	for n := 0; n < segmentsPerSession; n++ {
+		if err := get(fmt.Sprintf("%s/%s/index.m3u8?_HLS_msn=%d", base, id, n)); err != nil {
+			return err
+		}
+		if err := get(fmt.Sprintf("%s/%s/%d.ts", base, id, n)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TestConcurrentHLSSessions plays concurrent HLS sessions of live
+// playlists with blocking reloads, each fetching its segments through the
+// segment cache.
+func TestConcurrentHLSSessions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("load scenario")
+	}
+
+	cache, err := segmentcache.New(syntheticOrigin{}, segmentcache.Config{
+		MemoryBytes: 512 << 20,
+		TTL:         time.Minute,
+		Prewarm:     2,
+	}, logger.NewNoopLogger())
+	require.NoError(t, err)
+	t.Cleanup(cache.Close)
+
+	handler := &hlsServer{cache: cache, sessions: make(map[string]*hls.LivePlaylist)}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	sessions := load.Scale(50)
+	client := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: sessions}}
+
+	result := load.Run(context.Background(), load.Scenario{
+		Name:    "hls_sessions",
+		Workers: sessions,
+		Ops:     sessions * 2,
+		Op: func(ctx context.Context, _, i int) error {
+			id := fmt.Sprintf("session-%d", i)
+			if err := handler.start(id); err != nil {
+				return err
+			}
+			return play(ctx, client, server.URL, id)
+		},
+	})
+	t.Log(result)
+
+	// A session lasts as long as its segments take to produce; the rest is
+	// serving overhead
+	require.NoError(t, load.Thresholds{
+		P95: segmentsPerSession*segmentInterval + 500*time.Millisecond,
+	}.Check(result))
+}
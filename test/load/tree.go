@@ -0,0 +1,84 @@
+package load
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TreeSpec describes a synthetic library tree.
+type TreeSpec struct {
+	Movies            int
+	Shows             int
+	SeasonsPerShow    int
+	EpisodesPerSeason int
+	// Seed makes the titles and qualities of the tree reproducible.
+	Seed uint64
+}
+
+var (
+	titleWords = []string{
+		"Silent", "River", "Night", "Empire", "Lost", "Garden", "Winter", "Echo",
+		"Iron", "Last", "Summer", "Shadow", "Ocean", "Glass", "North", "Crown",
+		"Harbor", "Wild", "Golden", "Storm", "Hidden", "Paper", "Signal", "Orbit",
+	}
+	qualities = []string{"720p", "1080p", "1080p", "2160p"}
+	codecs    = []string{"x264", "x265", "x265", "AV1"}
+)
+
+// BuildTree creates the movie and episode files of a synthetic library
+// under root, named as downloads name them, and returns the paths of the
+// media files. Files are empty, so scans measure walking and parsing.
+// Every movie also gets a subtitle and an artwork file scans must skip.
+func BuildTree(root string, spec TreeSpec) ([]string, error) {
+	rng := rand.New(rand.NewPCG(spec.Seed, spec.Seed^0x6e617277))
+	var paths []string
+
+	create := func(path string) error {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile(path, nil, 0o644)
+	}
+
+	for i := 0; i < spec.Movies; i++ {
+		title := fmt.Sprintf("%s (%d)", randomTitle(rng, i), 1950+rng.IntN(75))
+		dir := filepath.Join(root, "Movies", title)
+		name := fmt.Sprintf("%s %s %s", title, qualities[rng.IntN(len(qualities))], codecs[rng.IntN(len(codecs))])
+
+		movie := filepath.Join(dir, name+".mkv")
+		for _, path := range []string{movie, filepath.Join(dir, name+".en.srt"), filepath.Join(dir, "poster.jpg")} {
+			if err := create(path); err != nil {
+				return nil, err
+			}
+		}
+		paths = append(paths, movie)
+	}
+
+	for i := 0; i < spec.Shows; i++ {
+		show := randomTitle(rng, spec.Movies+i)
+		for season := 1; season <= spec.SeasonsPerShow; season++ {
+			dir := filepath.Join(root, "TV", show, fmt.Sprintf("Season %02d", season))
+			for episode := 1; episode <= spec.EpisodesPerSeason; episode++ {
+				path := filepath.Join(dir, fmt.Sprintf("%s - S%02dE%02d - %s %s.mkv",
+					show, season, episode, randomTitle(rng, episode), qualities[rng.IntN(len(qualities))]))
+				if err := create(path); err != nil {
+					return nil, err
+				}
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths, nil
+}
+
+// randomTitle returns a title of two or three words, made unique by n.
+func randomTitle(rng *rand.Rand, n int) string {
+	words := make([]string, 2+rng.IntN(2))
+	for i := range words {
+		words[i] = titleWords[rng.IntN(len(titleWords))]
+	}
+	return fmt.Sprintf("%s %d", strings.Join(words, " "), n)
+}
@@ -0,0 +1,246 @@
+package testutil
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	librarydomain "github.com/narwhalmedia/narwhal/internal/library/domain"
+	userdomain "github.com/narwhalmedia/narwhal/internal/user/domain"
+	"github.com/narwhalmedia/narwhal/pkg/models"
+)
+
+// FactoryEpoch is the time of the clock of a new Factory.
+var FactoryEpoch = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// factoryNamespace namespaces the IDs of factories.
+var factoryNamespace = uuid.MustParse("6e61727a-6861-6c00-0000-000000000000")
+
+// Factory builds domain objects with deterministic IDs, names and times,
+// so that integration tests and their failures are reproducible. Two
+// factories with the same seed build the same objects in the same order.
+//
+// Every builder takes modifiers, applied in order after the defaults:
+//
+//	f := testutil.NewFactory(1)
+//	admin := f.User(func(u *userdomain.User) { u.Username = "admin" })
+//
+// A Factory is not safe for concurrent use.
+type Factory struct {
+	seed uint64
+	seq  uint64
+	now  time.Time
+}
+
+// NewFactory creates a factory. The seed selects the sequence of IDs.
+func NewFactory(seed uint64) *Factory {
+	return &Factory{seed: seed, now: FactoryEpoch}
+}
+
+// ID returns the next ID of the sequence.
+func (f *Factory) ID() uuid.UUID {
+	f.seq++
+	return uuid.NewSHA1(factoryNamespace, fmt.Appendf(nil, "%d/%d", f.seed, f.seq))
+}
+
+// Now returns the time of the factory's clock, which only moves with
+// Advance.
+func (f *Factory) Now() time.Time {
+	return f.now
+}
+
+// Advance moves the factory's clock forward.
+func (f *Factory) Advance(d time.Duration) {
+	f.now = f.now.Add(d)
+}
+
+// name returns a unique name with a prefix, such as "user-3".
+func (f *Factory) name(prefix string) string {
+	return fmt.Sprintf("%s-%d", prefix, f.seq+1)
+}
+
+func apply[T any](v *T, mods []func(*T)) *T {
+	for _, mod := range mods {
+		mod(v)
+	}
+	return v
+}
+
+// User builds an active, verified user whose password is
+// TestPassword.
+func (f *Factory) User(mods ...func(*userdomain.User)) *userdomain.User {
+	name := f.name("user")
+	user := &userdomain.User{
+		ID:          f.ID(),
+		Username:    name,
+		Email:       name + "@example.com",
+		DisplayName: name,
+		IsActive:    true,
+		IsVerified:  true,
+		CreatedAt:   f.now,
+		UpdatedAt:   f.now,
+		Preferences: userdomain.UserPreferences{
+			Language:         "en",
+			Theme:            "dark",
+			TimeZone:         "UTC",
+			AutoPlayNext:     true,
+			SubtitleLanguage: "en",
+			PreferredQuality: "auto",
+		},
+	}
+	user.SetPassword(TestPassword)
+	return apply(user, mods)
+}
+
+// TestPassword is the password of the users the factory builds.
+const TestPassword = "testpass123"
+
+// Role builds a role.
+func (f *Factory) Role(name string, mods ...func(*userdomain.Role)) *userdomain.Role {
+	return apply(&userdomain.Role{
+		ID:          f.ID(),
+		Name:        name,
+		Description: name + " role",
+		CreatedAt:   f.now,
+		UpdatedAt:   f.now,
+	}, mods)
+}
+
+// Session builds a session of a user, valid for a day.
+func (f *Factory) Session(userID uuid.UUID, mods ...func(*userdomain.Session)) *userdomain.Session {
+	id := f.ID()
+	return apply(&userdomain.Session{
+		ID:           id,
+		UserID:       userID,
+		RefreshToken: "refresh-" + id.String(),
+		DeviceInfo:   "Test Device",
+		IPAddress:    "127.0.0.1",
+		UserAgent:    "Test/1.0",
+		ExpiresAt:    f.now.Add(24 * time.Hour),
+		CreatedAt:    f.now,
+		UpdatedAt:    f.now,
+	}, mods)
+}
+
+// Library builds an enabled movie library. Use the path of a MediaTree to
+// scan files on disk.
+func (f *Factory) Library(mods ...func(*librarydomain.Library)) *librarydomain.Library {
+	name := f.name("library")
+	return apply(&librarydomain.Library{
+		ID:           f.ID(),
+		Name:         name,
+		Path:         "/test/" + name,
+		Type:         "movie",
+		Enabled:      true,
+		ScanInterval: 3600,
+		CreatedAt:    f.now,
+		UpdatedAt:    f.now,
+	}, mods)
+}
+
+// Media builds an available movie of a library.
+func (f *Factory) Media(libraryID uuid.UUID, mods ...func(*models.Media)) *models.Media {
+	title := f.name("Movie")
+	path := "/test/media/" + title + ".mp4"
+	return apply(&models.Media{
+		ID:          f.ID(),
+		LibraryID:   libraryID,
+		Title:       title,
+		Type:        models.MediaTypeMovie,
+		Path:        path,
+		Size:        100 << 20,
+		Duration:    3600,
+		Resolution:  "1920x1080",
+		Codec:       "h264",
+		Bitrate:     5000,
+		Added:       f.now,
+		Modified:    f.now,
+		LastScanned: f.now,
+		Status:      "available",
+		FilePath:    path,
+		FileSize:    100 << 20,
+	}, mods)
+}
+
+// Series builds a series of a library with the episodes of its seasons.
+func (f *Factory) Series(libraryID uuid.UUID, seasons, episodesPerSeason int, mods ...func(*models.Media)) (*models.Media, []*models.Episode) {
+	series := f.Media(libraryID, append([]func(*models.Media){func(m *models.Media) {
+		m.Title = strings.Replace(m.Title, "Movie", "Series", 1)
+		m.Type = models.MediaTypeSeries
+		m.Path = "/test/series/" + m.Title
+		m.FilePath = m.Path
+	}}, mods...)...)
+
+	var episodes []*models.Episode
+	for season := 1; season <= seasons; season++ {
+		for episode := 1; episode <= episodesPerSeason; episode++ {
+			episodes = append(episodes, f.Episode(series, season, episode))
+		}
+	}
+	return series, episodes
+}
+
+// Episode builds an episode of a series.
+func (f *Factory) Episode(series *models.Media, season, episode int, mods ...func(*models.Episode)) *models.Episode {
+	return apply(&models.Episode{
+		ID:            f.ID(),
+		MediaID:       series.ID,
+		SeasonNumber:  season,
+		EpisodeNumber: episode,
+		Title:         fmt.Sprintf("Episode %d", episode),
+		Path:          fmt.Sprintf("%s/Season %02d/S%02dE%02d.mp4", series.Path, season, season, episode),
+		Duration:      2400,
+		AirDate:       FactoryEpoch.AddDate(0, 0, 7*((season-1)*52+episode-1)),
+		Added:         f.now,
+	}, mods)
+}
+
+// Download builds a queued download of a movie, requested by a user.
+func (f *Factory) Download(requestedBy uuid.UUID, mods ...func(*models.Download)) *models.Download {
+	title := f.name("Download")
+	id := f.ID()
+	return apply(&models.Download{
+		ID:             id,
+		RequestedBy:    requestedBy,
+		Title:          title + " 1080p WEB-DL x264",
+		Type:           models.MediaTypeMovie,
+		IndexerID:      "test-indexer",
+		DownloadURL:    "magnet:?xt=urn:btih:" + strings.ReplaceAll(id.String(), "-", ""),
+		Size:           4 << 30,
+		Status:         models.DownloadStatusQueued,
+		DownloadClient: "test-client",
+		OutputPath:     "/downloads/" + title,
+		Created:        f.now,
+		Updated:        f.now,
+	}, mods)
+}
+
+// TranscodePolicy builds an enabled policy transcoding a library to
+// 720p HLS.
+func (f *Factory) TranscodePolicy(libraryID uuid.UUID, mods ...func(*librarydomain.TranscodePolicy)) *librarydomain.TranscodePolicy {
+	name := f.name("policy")
+	return apply(&librarydomain.TranscodePolicy{
+		ID:        f.ID(),
+		LibraryID: libraryID,
+		Name:      name,
+		Profile:   "720p",
+		Format:    librarydomain.TranscodeFormatHLS,
+		Enabled:   true,
+		CreatedAt: f.now,
+		UpdatedAt: f.now,
+	}, mods)
+}
+
+// TranscodeRequest builds the request of a policy to transcode media, at
+// normal priority.
+func (f *Factory) TranscodeRequest(media *models.Media, policy *librarydomain.TranscodePolicy, mods ...func(*librarydomain.TranscodeRequest)) *librarydomain.TranscodeRequest {
+	return apply(&librarydomain.TranscodeRequest{
+		MediaID:   media.ID,
+		PolicyID:  policy.ID,
+		Key:       librarydomain.TranscodeKey(media, policy),
+		Priority:  librarydomain.TranscodePriorityNormal,
+		CreatedAt: f.now,
+	}, mods)
+}
@@ -30,7 +30,7 @@ func CreateTestUser(username, email string) *domain.User {
 			PreferredQuality: "auto",
 		},
 	}
-	user.SetPassword("testpass123")
+	user.SetPassword(TestPassword)
 	return user
 }
 
@@ -0,0 +1,102 @@
+package testutil
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// VideoSpec describes a synthetic video.
+type VideoSpec struct {
+	Duration time.Duration // defaults to 2s
+	Width    int           // defaults to 320
+	Height   int           // defaults to 240
+	// FrameRate defaults to 24.
+	FrameRate int
+	// Audio adds a sine tone track.
+	Audio bool
+}
+
+func (s VideoSpec) withDefaults() VideoSpec {
+	if s.Duration <= 0 {
+		s.Duration = 2 * time.Second
+	}
+	if s.Width <= 0 {
+		s.Width = 320
+	}
+	if s.Height <= 0 {
+		s.Height = 240
+	}
+	if s.FrameRate <= 0 {
+		s.FrameRate = 24
+	}
+	return s
+}
+
+// RequireFFmpeg skips the test if ffmpeg is not installed.
+func RequireFFmpeg(tb testing.TB) {
+	tb.Helper()
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		tb.Skip("ffmpeg is not installed")
+	}
+}
+
+var (
+	videoCacheMu sync.Mutex
+	videoCache   = make(map[VideoSpec][]byte)
+)
+
+// SyntheticMP4 returns a tiny valid MP4 of a test pattern, encoded with
+// H.264 and AAC by ffmpeg. The encoding is bit-exact, so the same spec
+// always gives the same bytes, and each spec is only encoded once per test
+// binary. The test is skipped if ffmpeg is not installed.
+func SyntheticMP4(tb testing.TB, spec VideoSpec) []byte {
+	tb.Helper()
+	RequireFFmpeg(tb)
+	spec = spec.withDefaults()
+
+	videoCacheMu.Lock()
+	defer videoCacheMu.Unlock()
+	if data, ok := videoCache[spec]; ok {
+		return data
+	}
+
+	out := filepath.Join(tb.TempDir(), "synthetic.mp4")
+	args := []string{
+		"-hide_banner", "-loglevel", "error", "-y",
+		"-f", "lavfi", "-i", fmt.Sprintf("testsrc=size=%dx%d:rate=%d", spec.Width, spec.Height, spec.FrameRate),
+	}
+	if spec.Audio {
+		args = append(args, "-f", "lavfi", "-i", "sine=frequency=440:sample_rate=48000")
+	}
+	args = append(args,
+		"-t", fmt.Sprintf("%.3f", spec.Duration.Seconds()),
+		"-c:v", "libx264", "-preset", "ultrafast", "-pix_fmt", "yuv420p", "-threads", "1",
+	)
+	if spec.Audio {
+		args = append(args, "-c:a", "aac", "-b:a", "64k")
+	}
+	args = append(args,
+		"-map_metadata", "-1", "-fflags", "+bitexact", "-flags", "+bitexact",
+		"-movflags", "+faststart", out,
+	)
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("ffmpeg", args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		tb.Fatalf("generate synthetic mp4: %v: %s", err, stderr.String())
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		tb.Fatalf("read synthetic mp4: %v", err)
+	}
+	videoCache[spec] = data
+	return data
+}
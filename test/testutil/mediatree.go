@@ -0,0 +1,111 @@
+package testutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// MediaTree is a library tree on disk, laid out as the scanner expects
+// downloads to be named:
+//
+//	Movies/Title (Year)/Title (Year).mp4
+//	TV/Show/Season 01/Show - S01E01.mp4
+//
+// Media files are empty placeholders unless the tree plays videos, which
+// makes scans probe real streams.
+type MediaTree struct {
+	tb    testing.TB
+	root  string
+	video *VideoSpec
+}
+
+// NewMediaTree creates an empty tree in a temporary directory removed
+// after the test.
+func NewMediaTree(tb testing.TB) *MediaTree {
+	tb.Helper()
+	return &MediaTree{tb: tb, root: tb.TempDir()}
+}
+
+// WithVideo makes the media files of the tree synthetic MP4s of a spec,
+// generated by ffmpeg. The test is skipped if ffmpeg is not installed.
+func (t *MediaTree) WithVideo(spec VideoSpec) *MediaTree {
+	t.tb.Helper()
+	RequireFFmpeg(t.tb)
+	t.video = &spec
+	return t
+}
+
+// Root returns the directory of the tree.
+func (t *MediaTree) Root() string {
+	return t.root
+}
+
+// MoviesPath returns the directory of the movies of the tree.
+func (t *MediaTree) MoviesPath() string {
+	return filepath.Join(t.root, "Movies")
+}
+
+// TVPath returns the directory of the shows of the tree.
+func (t *MediaTree) TVPath() string {
+	return filepath.Join(t.root, "TV")
+}
+
+// Movie adds a movie and returns its path.
+func (t *MediaTree) Movie(title string, year int) string {
+	t.tb.Helper()
+	name := fmt.Sprintf("%s (%d)", title, year)
+	return t.media(filepath.Join("Movies", name, name+".mp4"))
+}
+
+// Episode adds an episode of a show and returns its path.
+func (t *MediaTree) Episode(show string, season, episode int) string {
+	t.tb.Helper()
+	return t.media(filepath.Join("TV", show, fmt.Sprintf("Season %02d", season),
+		fmt.Sprintf("%s - S%02dE%02d.mp4", show, season, episode)))
+}
+
+// Show adds the episodes of the seasons of a show and returns their paths.
+func (t *MediaTree) Show(show string, seasons, episodesPerSeason int) []string {
+	t.tb.Helper()
+	var paths []string
+	for season := 1; season <= seasons; season++ {
+		for episode := 1; episode <= episodesPerSeason; episode++ {
+			paths = append(paths, t.Episode(show, season, episode))
+		}
+	}
+	return paths
+}
+
+// File adds a file at a path relative to the root, such as a subtitle or
+// a poster, and returns its path.
+func (t *MediaTree) File(rel string, data []byte) string {
+	t.tb.Helper()
+	path := filepath.Join(t.root, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.tb.Fatalf("create media tree directory: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.tb.Fatalf("write media tree file: %v", err)
+	}
+	return path
+}
+
+// Remove deletes a file of the tree, such as one a test expects a rescan
+// to notice missing.
+func (t *MediaTree) Remove(path string) {
+	t.tb.Helper()
+	if err := os.Remove(path); err != nil {
+		t.tb.Fatalf("remove media tree file: %v", err)
+	}
+}
+
+func (t *MediaTree) media(rel string) string {
+	t.tb.Helper()
+	var data []byte
+	if t.video != nil {
+		data = SyntheticMP4(t.tb, *t.video)
+	}
+	return t.File(rel, data)
+}
@@ -23,9 +23,27 @@ type PostgresContainer struct {
 }
 
 // SetupPostgresContainer creates a new postgres container for testing.
+// It is terminated when the test completes.
 func SetupPostgresContainer(t *testing.T) *PostgresContainer {
-	ctx := context.Background()
+	pc, err := StartPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cleanup function
+	t.Cleanup(func() {
+		if err := pc.Close(context.Background()); err != nil {
+			t.Logf("Failed to terminate postgres container: %v", err)
+		}
+	})
+
+	return pc
+}
 
+// StartPostgresContainer creates a new postgres container outside of a
+// test, such as in TestMain, for tests sharing one database. Close it when
+// done.
+func StartPostgresContainer(ctx context.Context) (*PostgresContainer, error) {
 	// Create postgres container
 	pgContainer, err := tcpostgres.Run(ctx,
 		"postgres:16-alpine",
@@ -39,13 +57,14 @@ func SetupPostgresContainer(t *testing.T) *PostgresContainer {
 		),
 	)
 	if err != nil {
-		t.Fatalf("Failed to start postgres container: %v", err)
+		return nil, fmt.Errorf("failed to start postgres container: %w", err)
 	}
 
 	// Get connection string
 	connStr, err := pgContainer.ConnectionString(ctx, "sslmode=disable")
 	if err != nil {
-		t.Fatalf("Failed to get connection string: %v", err)
+		_ = pgContainer.Terminate(ctx)
+		return nil, fmt.Errorf("failed to get connection string: %w", err)
 	}
 
 	// Connect with GORM
@@ -53,25 +72,24 @@ func SetupPostgresContainer(t *testing.T) *PostgresContainer {
 		Logger: logger.Default.LogMode(logger.Silent),
 	})
 	if err != nil {
-		t.Fatalf("Failed to connect to test database: %v", err)
+		_ = pgContainer.Terminate(ctx)
+		return nil, fmt.Errorf("failed to connect to test database: %w", err)
 	}
 
-	// Cleanup function
-	t.Cleanup(func() {
-		sqlDB, _ := db.DB()
-		if sqlDB != nil {
-			sqlDB.Close()
-		}
-		if err := pgContainer.Terminate(ctx); err != nil {
-			t.Logf("Failed to terminate postgres container: %v", err)
-		}
-	})
-
 	return &PostgresContainer{
 		PostgresContainer: pgContainer,
 		ConnectionString:  connStr,
 		DB:                db,
+	}, nil
+}
+
+// Close closes the database connection and terminates the container.
+func (pc *PostgresContainer) Close(ctx context.Context) error {
+	sqlDB, _ := pc.DB.DB()
+	if sqlDB != nil {
+		sqlDB.Close()
 	}
+	return pc.Terminate(ctx)
 }
 
 // MigrateModels runs GORM auto-migration for the given models.